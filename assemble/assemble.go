@@ -0,0 +1,492 @@
+// Package assemble builds documents from the pages of other documents:
+// merging, extracting, inserting, reordering, deleting and splitting.
+//
+// It operates on semantic documents and carries the document-level objects
+// that refer to pages over to the result: outlines, link and open actions,
+// page labels, article threads, AcroForm fields, the structure tree,
+// embedded files and document JavaScript. Page references are remapped to
+// the new page order and objects whose pages are left out are dropped. Form
+// fields, default-resource fonts, structure IDs and role mappings, embedded
+// file names and JavaScript names that collide between source documents are
+// renamed. Page resources stay attached to their pages, so resource names
+// never collide.
+//
+// Source documents are not modified; pages and page-level objects are
+// copied, while resources, fonts and images are shared with the sources.
+package assemble
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// ErrNoPages is returned when an operation would produce a document
+// without pages.
+var ErrNoPages = errors.New("assemble: result has no pages")
+
+// Part selects pages of a source document, in output order. A nil Pages
+// selects every page. The same document may appear in several parts.
+type Part struct {
+	Doc   *semantic.Document
+	Pages []int
+}
+
+// Assemble builds a new document from the pages selected by parts. Document
+// information, metadata, language and output intents are taken from the
+// first part's document; the result is not encrypted.
+func Assemble(ctx context.Context, parts ...Part) (*semantic.Document, error) {
+	a := &assembler{
+		out:     &semantic.Document{},
+		byDoc:   make(map[*semantic.Document]*source),
+		pageMap: make(map[*semantic.Page]*semantic.Page),
+	}
+	for i, part := range parts {
+		if err := a.addPart(ctx, i, part); err != nil {
+			return nil, err
+		}
+	}
+	if len(a.out.Pages) == 0 {
+		return nil, ErrNoPages
+	}
+	a.finish()
+	return a.out, nil
+}
+
+// Merge concatenates documents.
+func Merge(ctx context.Context, docs ...*semantic.Document) (*semantic.Document, error) {
+	parts := make([]Part, len(docs))
+	for i, d := range docs {
+		parts[i] = Part{Doc: d}
+	}
+	return Assemble(ctx, parts...)
+}
+
+// Extract returns a document with the given pages of doc, in the given
+// order.
+func Extract(ctx context.Context, doc *semantic.Document, pages []int) (*semantic.Document, error) {
+	if pages == nil {
+		pages = []int{}
+	}
+	return Assemble(ctx, Part{Doc: doc, Pages: pages})
+}
+
+// Insert returns doc with every page of src inserted before page at; at may
+// equal the page count to append.
+func Insert(ctx context.Context, doc *semantic.Document, at int, src *semantic.Document) (*semantic.Document, error) {
+	if doc == nil {
+		return nil, errors.New("assemble: nil document")
+	}
+	if at < 0 || at > len(doc.Pages) {
+		return nil, fmt.Errorf("assemble: insert position %d out of range [0,%d]", at, len(doc.Pages))
+	}
+	return Assemble(ctx,
+		Part{Doc: doc, Pages: Range(0, at)},
+		Part{Doc: src},
+		Part{Doc: doc, Pages: Range(at, len(doc.Pages))},
+	)
+}
+
+// Reorder returns doc with its pages in the given order, which must be a
+// permutation of the page indices.
+func Reorder(ctx context.Context, doc *semantic.Document, order []int) (*semantic.Document, error) {
+	if doc == nil {
+		return nil, errors.New("assemble: nil document")
+	}
+	if len(order) != len(doc.Pages) {
+		return nil, fmt.Errorf("assemble: order has %d pages, document has %d", len(order), len(doc.Pages))
+	}
+	seen := make([]bool, len(doc.Pages))
+	for _, idx := range order {
+		if idx < 0 || idx >= len(seen) || seen[idx] {
+			return nil, fmt.Errorf("assemble: order is not a permutation of the pages")
+		}
+		seen[idx] = true
+	}
+	return Assemble(ctx, Part{Doc: doc, Pages: order})
+}
+
+// Delete returns doc without the given pages.
+func Delete(ctx context.Context, doc *semantic.Document, pages ...int) (*semantic.Document, error) {
+	if doc == nil {
+		return nil, errors.New("assemble: nil document")
+	}
+	drop := make(map[int]bool, len(pages))
+	for _, idx := range pages {
+		if idx < 0 || idx >= len(doc.Pages) {
+			return nil, fmt.Errorf("assemble: page %d out of range", idx)
+		}
+		drop[idx] = true
+	}
+	keep := []int{}
+	for i := range doc.Pages {
+		if !drop[i] {
+			keep = append(keep, i)
+		}
+	}
+	return Assemble(ctx, Part{Doc: doc, Pages: keep})
+}
+
+// Range returns the page indices from (inclusive) to to (exclusive).
+func Range(from, to int) []int {
+	out := []int{}
+	for i := from; i < to; i++ {
+		out = append(out, i)
+	}
+	return out
+}
+
+// source tracks what one input document contributes to the result.
+type source struct {
+	doc *semantic.Document
+	// pages maps source page indices to the first output page showing them.
+	pages map[int]int
+	// Renames applied to this document's objects.
+	fieldNames map[string]string
+	fonts      map[string]string
+	roles      map[string]string
+	fields     map[semantic.FormField]semantic.FormField
+}
+
+// origin records where an output page came from.
+type origin struct {
+	src   *source
+	index int
+}
+
+type assembler struct {
+	out     *semantic.Document
+	sources []*source
+	byDoc   map[*semantic.Document]*source
+	origins []origin
+	// pageMap maps source pages to their first output copy.
+	pageMap map[*semantic.Page]*semantic.Page
+	// Names taken in the result, with the document that owns them.
+	fieldOwners map[string]*source
+	structIDs   map[string]bool
+}
+
+func (a *assembler) addPart(ctx context.Context, n int, part Part) error {
+	if part.Doc == nil {
+		return fmt.Errorf("assemble: part %d has no document", n)
+	}
+	if err := part.Doc.LoadPages(ctx); err != nil {
+		return err
+	}
+	src := a.byDoc[part.Doc]
+	if src == nil {
+		src = &source{
+			doc:        part.Doc,
+			pages:      make(map[int]int),
+			fieldNames: make(map[string]string),
+			fonts:      make(map[string]string),
+			roles:      make(map[string]string),
+			fields:     make(map[semantic.FormField]semantic.FormField),
+		}
+		a.byDoc[part.Doc] = src
+		a.sources = append(a.sources, src)
+	}
+	pages := part.Pages
+	if pages == nil {
+		pages = Range(0, len(part.Doc.Pages))
+	}
+	for _, idx := range pages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if idx < 0 || idx >= len(part.Doc.Pages) || part.Doc.Pages[idx] == nil {
+			return fmt.Errorf("assemble: part %d: page %d out of range", n, idx)
+		}
+		p := part.Doc.Pages[idx]
+		np := *p
+		np.Index = len(a.out.Pages)
+		np.StructParents = nil // reassigned by the writer
+		np.Annotations = nil
+		np.Dirty = true
+		if _, ok := src.pages[idx]; !ok {
+			src.pages[idx] = np.Index
+		}
+		if _, ok := a.pageMap[p]; !ok {
+			a.pageMap[p] = &np
+		}
+		a.out.Pages = append(a.out.Pages, &np)
+		a.origins = append(a.origins, origin{src: src, index: idx})
+	}
+	return nil
+}
+
+// finish carries document-level objects over once every page is placed, so
+// that references to pages of later parts resolve.
+func (a *assembler) finish() {
+	first := a.sources[0].doc
+	out := a.out
+	out.Info = first.Info
+	out.Metadata = first.Metadata
+	out.Lang = first.Lang
+	out.OutputIntents = first.OutputIntents
+	out.Catalog = first.Catalog
+	if first.OpenAction != nil {
+		if act, ok := a.sources[0].remapAction(first.OpenAction); ok {
+			out.OpenAction = act
+		}
+	}
+	for _, src := range a.sources {
+		// Fields come first so widget annotations can point at the copies.
+		a.mergeForm(src)
+	}
+	for i, p := range out.Pages {
+		o := a.origins[i]
+		p.Annotations = o.src.copyAnnotations(o.src.doc.Pages[o.index].Annotations)
+	}
+	for _, src := range a.sources {
+		out.Marked = out.Marked || src.doc.Marked
+		out.Outlines = append(out.Outlines, src.remapOutlines(src.doc.Outlines)...)
+		out.Articles = append(out.Articles, src.remapArticles(src.doc.Articles)...)
+		a.mergeEmbeddedFiles(src)
+		a.mergeLayers(src)
+		a.mergeJavaScript(src)
+		a.mergeStructure(src)
+	}
+	out.PageLabels = a.pageLabels()
+}
+
+// remapAction points page-targeting actions at the output page. It reports
+// false when the target page is not part of the result.
+func (s *source) remapAction(act semantic.Action) (semantic.Action, bool) {
+	switch v := act.(type) {
+	case semantic.GoToAction:
+		idx, ok := s.pages[v.PageIndex]
+		if !ok {
+			return nil, false
+		}
+		v.PageIndex = idx
+		return v, true
+	case *semantic.GoToAction:
+		if v == nil {
+			return act, true
+		}
+		idx, ok := s.pages[v.PageIndex]
+		if !ok {
+			return nil, false
+		}
+		cp := *v
+		cp.PageIndex = idx
+		return &cp, true
+	}
+	return act, true
+}
+
+// copyAnnotations copies a page's annotations, remapping link targets and
+// widget fields. Links to pages that were left out are dropped.
+func (s *source) copyAnnotations(annots []semantic.Annotation) []semantic.Annotation {
+	if len(annots) == 0 {
+		return nil
+	}
+	copies := make(map[semantic.Annotation]semantic.Annotation, len(annots))
+	var out []semantic.Annotation
+	for _, annot := range annots {
+		cp := shallowCopy(annot)
+		keep := true
+		switch v := cp.(type) {
+		case *semantic.LinkAnnotation:
+			v.Action, keep = s.remapAction(v.Action)
+		case *semantic.ScreenAnnotation:
+			v.Action, keep = s.remapAction(v.Action)
+		case *semantic.WidgetAnnotation:
+			if f, ok := s.fields[v.Field]; ok {
+				v.Field = f
+			}
+		}
+		if keep {
+			copies[annot] = cp
+			out = append(out, cp)
+		}
+	}
+	for _, annot := range out {
+		if popup, ok := annot.(*semantic.PopupAnnotation); ok && popup.Parent != nil {
+			popup.Parent = copies[popup.Parent]
+		}
+	}
+	return out
+}
+
+// remapOutlines keeps outline items whose page is in the result, and items
+// whose page is not but that still have children, without a destination.
+func (s *source) remapOutlines(items []semantic.OutlineItem) []semantic.OutlineItem {
+	var out []semantic.OutlineItem
+	for _, item := range items {
+		children := s.remapOutlines(item.Children)
+		idx, ok := s.pages[item.PageIndex]
+		switch {
+		case ok:
+			item.PageIndex = idx
+		case len(children) > 0:
+			item.PageIndex = -1
+			item.Dest = nil
+		default:
+			continue
+		}
+		item.Children = children
+		item.Dirty = true
+		out = append(out, item)
+	}
+	return out
+}
+
+func (s *source) remapArticles(threads []semantic.ArticleThread) []semantic.ArticleThread {
+	var out []semantic.ArticleThread
+	for _, thread := range threads {
+		var beads []semantic.ArticleBead
+		for _, bead := range thread.Beads {
+			if idx, ok := s.pages[bead.PageIndex]; ok {
+				bead.PageIndex = idx
+				beads = append(beads, bead)
+			}
+		}
+		if len(beads) == 0 {
+			continue
+		}
+		thread.Beads = beads
+		out = append(out, thread)
+	}
+	return out
+}
+
+// pageLabels starts a label range wherever a source range starts or the
+// output stops following consecutive pages of one source. Pages from
+// documents without labels get an empty prefix.
+func (a *assembler) pageLabels() map[int]string {
+	any := false
+	for _, src := range a.sources {
+		any = any || len(src.doc.PageLabels) > 0
+	}
+	if !any {
+		return nil
+	}
+	labels := make(map[int]string)
+	for i, o := range a.origins {
+		_, starts := o.src.doc.PageLabels[o.index]
+		if i > 0 {
+			prev := a.origins[i-1]
+			starts = starts || prev.src != o.src || prev.index != o.index-1
+		}
+		if i == 0 || starts {
+			labels[i] = labelPrefix(o.src.doc.PageLabels, o.index)
+		}
+	}
+	return labels
+}
+
+// labelPrefix returns the prefix of the label range containing page idx.
+func labelPrefix(labels map[int]string, idx int) string {
+	best := -1
+	for start := range labels {
+		if start <= idx && start > best {
+			best = start
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	return labels[best]
+}
+
+func (a *assembler) mergeEmbeddedFiles(src *source) {
+	for _, ef := range src.doc.EmbeddedFiles {
+		dup := false
+		names := make(map[string]bool, len(a.out.EmbeddedFiles))
+		for _, existing := range a.out.EmbeddedFiles {
+			names[existing.Name] = true
+			if existing.Name == ef.Name && existing.Description == ef.Description && string(existing.Data) == string(ef.Data) {
+				dup = true
+			}
+		}
+		if dup {
+			continue
+		}
+		if names[ef.Name] {
+			ef.Name = uniqueFileName(ef.Name, names)
+		}
+		a.out.EmbeddedFiles = append(a.out.EmbeddedFiles, ef)
+	}
+}
+
+// mergeLayers adds the optional content groups of src, which its pages
+// share, with their default visibility and layer tree. Alternate
+// configurations are kept from the first document only.
+func (a *assembler) mergeLayers(src *source) {
+	props := src.doc.OCProperties
+	if props == nil {
+		return
+	}
+	if a.out.OCProperties == nil {
+		a.out.OCProperties = &semantic.OCProperties{Configs: props.Configs, Dirty: true}
+	}
+	out := a.out.OCProperties
+	known := make(map[*semantic.OptionalContentGroup]bool, len(out.OCGs))
+	for _, g := range out.OCGs {
+		known[g] = true
+	}
+	for _, g := range props.OCGs {
+		if g != nil && !known[g] {
+			known[g] = true
+			out.OCGs = append(out.OCGs, g)
+		}
+	}
+	d := props.D
+	if d == nil {
+		return
+	}
+	if out.D == nil {
+		out.D = &semantic.OCConfig{Name: d.Name, Creator: d.Creator, Intent: d.Intent, ListMode: d.ListMode}
+	}
+	// Groups are listed explicitly, so that the base state of either
+	// document does not decide the visibility of the other's.
+	for _, g := range props.OCGs {
+		if g != nil && !d.GroupVisible(g) {
+			out.D.OFF = append(out.D.OFF, g)
+		}
+	}
+	out.D.Order = append(out.D.Order, d.Order...)
+	out.D.RBGroups = append(out.D.RBGroups, d.RBGroups...)
+	out.D.Locked = append(out.D.Locked, d.Locked...)
+	out.D.AS = append(out.D.AS, d.AS...)
+}
+
+func (a *assembler) mergeJavaScript(src *source) {
+	if src.doc.Names == nil || len(src.doc.Names.JavaScript) == 0 {
+		return
+	}
+	if a.out.Names == nil {
+		a.out.Names = &semantic.Names{}
+	}
+	if a.out.Names.JavaScript == nil {
+		a.out.Names.JavaScript = make(map[string]semantic.JavaScriptAction)
+	}
+	js := a.out.Names.JavaScript
+	for _, name := range sortedKeys(src.doc.Names.JavaScript) {
+		action := src.doc.Names.JavaScript[name]
+		if existing, ok := js[name]; ok {
+			if existing.JS == action.JS {
+				continue
+			}
+			name = uniqueName(name, func(n string) bool { _, used := js[n]; return used })
+		}
+		js[name] = action
+	}
+}
+
+// shallowCopy copies the struct behind a pointer held in an interface, so
+// the copy can be changed without touching the source document.
+func shallowCopy[T any](v T) T {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return v
+	}
+	cp := reflect.New(rv.Elem().Type())
+	cp.Elem().Set(rv.Elem())
+	return cp.Interface().(T)
+}
@@ -0,0 +1,261 @@
+package assemble
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/wudi/pdfkit/extractor"
+	"github.com/wudi/pdfkit/ir"
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/writer"
+)
+
+// sampleDoc returns a tagged document of n pages named prefix-0..n-1 with a
+// bookmark and a paragraph per page, a link from the last page to the
+// first, a text field on the first page and an attachment.
+func sampleDoc(prefix string, n int) *semantic.Document {
+	doc := &semantic.Document{
+		PageLabels: map[int]string{0: prefix + "-"},
+		StructTree: &semantic.StructureTree{RoleMap: semantic.RoleMap{"Para": "P"}},
+		EmbeddedFiles: []semantic.EmbeddedFile{
+			{Name: "data.csv", Data: []byte(prefix)},
+		},
+		Names: &semantic.Names{JavaScript: map[string]semantic.JavaScriptAction{
+			"init": {JS: "app.alert('" + prefix + "');"},
+		}},
+	}
+	helv := &semantic.Font{Subtype: "Type1", BaseFont: "Helvetica"}
+	if prefix == "b" {
+		helv = &semantic.Font{Subtype: "Type1", BaseFont: "Times-Roman"}
+	}
+	doc.AcroForm = &semantic.AcroForm{
+		DefaultResources: &semantic.Resources{Fonts: map[string]*semantic.Font{"Helv": helv}},
+	}
+	for i := 0; i < n; i++ {
+		page := &semantic.Page{Index: i, MediaBox: semantic.Rectangle{URX: 200, URY: 200}}
+		doc.Pages = append(doc.Pages, page)
+		doc.Outlines = append(doc.Outlines, semantic.OutlineItem{Title: fmt.Sprintf("%s-%d", prefix, i), PageIndex: i})
+		doc.StructTree.K = append(doc.StructTree.K, &semantic.StructureElement{
+			S: "Para", ID: fmt.Sprintf("p%d", i), Pg: page,
+			K: []semantic.StructureItem{{MCID: 0}},
+		})
+	}
+	doc.Pages[n-1].Annotations = []semantic.Annotation{&semantic.LinkAnnotation{
+		BaseAnnotation: semantic.BaseAnnotation{Subtype: "Link", RectVal: semantic.Rectangle{URX: 10, URY: 10}},
+		Action:         semantic.GoToAction{PageIndex: 0},
+	}}
+	doc.AcroForm.Fields = []semantic.FormField{&semantic.TextFormField{
+		BaseFormField: semantic.BaseFormField{Name: "name", PageIndex: 0, DefaultAppearance: "/Helv 12 Tf 0 g"},
+	}}
+	return doc
+}
+
+func outlineTitles(items []semantic.OutlineItem) []string {
+	var out []string
+	for _, item := range items {
+		out = append(out, fmt.Sprintf("%s@%d", item.Title, item.PageIndex))
+	}
+	return out
+}
+
+func TestMerge(t *testing.T) {
+	a, b := sampleDoc("a", 2), sampleDoc("b", 3)
+	doc, err := Merge(context.Background(), a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Pages) != 5 {
+		t.Fatalf("pages = %d", len(doc.Pages))
+	}
+	for i, p := range doc.Pages {
+		if p.Index != i {
+			t.Errorf("page %d has index %d", i, p.Index)
+		}
+	}
+	if got := fmt.Sprint(outlineTitles(doc.Outlines)); got != "[a-0@0 a-1@1 b-0@2 b-1@3 b-2@4]" {
+		t.Errorf("outlines = %s", got)
+	}
+	link := doc.Pages[4].Annotations[0].(*semantic.LinkAnnotation)
+	if link.Action.(semantic.GoToAction).PageIndex != 2 {
+		t.Errorf("link target = %+v", link.Action)
+	}
+	if b.Pages[2].Annotations[0].(*semantic.LinkAnnotation).Action.(semantic.GoToAction).PageIndex != 0 {
+		t.Error("source link modified")
+	}
+	if got := fmt.Sprint(doc.PageLabels); got != "map[0:a- 2:b-]" {
+		t.Errorf("labels = %s", got)
+	}
+
+	// Fields: the second "name" is renamed and its DA follows the renamed font.
+	fields := doc.AcroForm.Fields
+	if len(fields) != 2 || fields[0].FieldName() != "name" || fields[1].FieldName() != "name_2" {
+		t.Fatalf("fields = %v, %v", fields[0].FieldName(), fields[1].FieldName())
+	}
+	if fields[1].FieldPageIndex() != 2 {
+		t.Errorf("second field page = %d", fields[1].FieldPageIndex())
+	}
+	if da := fields[1].(*semantic.TextFormField).DefaultAppearance; da != "/Helv_2 12 Tf 0 g" {
+		t.Errorf("renamed DA = %q", da)
+	}
+	if b.AcroForm.Fields[0].FieldName() != "name" {
+		t.Error("source field renamed")
+	}
+	if dr := doc.AcroForm.DefaultResources.Fonts; dr["Helv"].BaseFont != "Helvetica" || dr["Helv_2"].BaseFont != "Times-Roman" {
+		t.Errorf("DR fonts = %v", dr)
+	}
+
+	if got := []string{doc.EmbeddedFiles[0].Name, doc.EmbeddedFiles[1].Name}; got[0] != "data.csv" || got[1] != "data_2.csv" {
+		t.Errorf("embedded files = %v", got)
+	}
+	if _, ok := doc.Names.JavaScript["init_2"]; !ok || len(doc.Names.JavaScript) != 2 {
+		t.Errorf("javascript = %v", doc.Names.JavaScript)
+	}
+
+	tree := doc.StructTree
+	if len(tree.K) != 5 || tree.K[3].Pg != doc.Pages[3] || tree.K[3].ID != "p1_2" {
+		t.Fatalf("struct K = %d, K[3] = %+v", len(tree.K), tree.K[3])
+	}
+	if tree.IDTree["p1_2"] != tree.K[3] || tree.RoleMap["Para"] != "P" {
+		t.Errorf("IDTree/RoleMap not rebuilt")
+	}
+}
+
+func TestExtractDropsObjectsOfRemovedPages(t *testing.T) {
+	src := sampleDoc("a", 3)
+	doc, err := Extract(context.Background(), src, []int{2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(outlineTitles(doc.Outlines)); got != "[a-1@1 a-2@0]" {
+		t.Errorf("outlines = %s", got)
+	}
+	// The link on page 2 pointed at page 0, which is gone.
+	if len(doc.Pages[0].Annotations) != 0 {
+		t.Errorf("dangling link kept: %+v", doc.Pages[0].Annotations)
+	}
+	if len(doc.AcroForm.Fields) != 0 {
+		t.Errorf("field of removed page kept")
+	}
+	if len(doc.StructTree.K) != 2 || doc.StructTree.K[0].ID != "p1" || doc.StructTree.K[0].Pg != doc.Pages[1] {
+		t.Errorf("structure = %+v", doc.StructTree.K)
+	}
+	if got := fmt.Sprint(doc.PageLabels); got != "map[0:a- 1:a-]" {
+		t.Errorf("labels = %s", got)
+	}
+}
+
+func TestInsertReorderDelete(t *testing.T) {
+	ctx := context.Background()
+	base, extra := sampleDoc("a", 3), sampleDoc("b", 1)
+	doc, err := Insert(ctx, base, 1, extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Pages) != 4 || doc.Pages[1].MediaBox != extra.Pages[0].MediaBox {
+		t.Fatalf("pages = %d", len(doc.Pages))
+	}
+	// The link on base's last page still reaches base's first page.
+	if act := doc.Pages[3].Annotations[0].(*semantic.LinkAnnotation).Action.(semantic.GoToAction); act.PageIndex != 0 {
+		t.Errorf("link target = %d", act.PageIndex)
+	}
+	if got := fmt.Sprint(outlineTitles(doc.Outlines)); got != "[a-0@0 a-1@2 a-2@3 b-0@1]" {
+		t.Errorf("outlines = %s", got)
+	}
+
+	doc, err = Reorder(ctx, base, []int{2, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act := doc.Pages[0].Annotations[0].(*semantic.LinkAnnotation).Action.(semantic.GoToAction); act.PageIndex != 1 {
+		t.Errorf("reordered link target = %d", act.PageIndex)
+	}
+	if _, err := Reorder(ctx, base, []int{0, 0, 1}); err == nil {
+		t.Error("non-permutation accepted")
+	}
+
+	doc, err = Delete(ctx, base, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Pages) != 2 || doc.AcroForm != nil && len(doc.AcroForm.Fields) != 0 {
+		t.Errorf("delete kept %d pages", len(doc.Pages))
+	}
+	if _, err := Delete(ctx, base, 0, 1, 2); !errors.Is(err, ErrNoPages) {
+		t.Errorf("deleting every page = %v", err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	ctx := context.Background()
+	doc := sampleDoc("a", 5)
+	doc.Outlines = []semantic.OutlineItem{
+		{Title: "One", PageIndex: 0, Children: []semantic.OutlineItem{{Title: "One.1", PageIndex: 1}}},
+		{Title: "Two", PageIndex: 3},
+	}
+	parts, err := SplitByOutline(ctx, doc, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 2 || len(parts[0].Pages) != 3 || len(parts[1].Pages) != 2 {
+		t.Fatalf("parts = %d", len(parts))
+	}
+	if got := fmt.Sprint(outlineTitles(parts[1].Outlines)); got != "[Two@0]" {
+		t.Errorf("second part outlines = %s", got)
+	}
+	if got := parts[0].Outlines[0].Children; len(got) != 1 || got[0].PageIndex != 1 {
+		t.Errorf("nested outline = %+v", got)
+	}
+
+	parts, err = SplitEvery(ctx, doc, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 3 || len(parts[2].Pages) != 1 {
+		t.Fatalf("SplitEvery parts = %d", len(parts))
+	}
+}
+
+func TestMergeWrite(t *testing.T) {
+	a, b := sampleDoc("a", 1), sampleDoc("b", 2)
+	for _, d := range []*semantic.Document{a, b} {
+		for _, p := range d.Pages {
+			p.Contents = []semantic.ContentStream{{Operations: []semantic.Operation{
+				{Operator: "BDC", Operands: []semantic.Operand{semantic.NameOperand{Value: "P"}, semantic.DictOperand{Values: map[string]semantic.Operand{"MCID": semantic.NumberOperand{Value: 0}}}}},
+				{Operator: "EMC"},
+			}}}
+		}
+	}
+	merged, err := Merge(context.Background(), a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writer.NewWriter().Write(context.Background(), merged, &buf, writer.Config{Deterministic: true}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	parsed, err := ir.NewDefault().Parse(context.Background(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(parsed.Pages) != 3 || parsed.StructTree == nil || len(parsed.StructTree.K) != 3 {
+		t.Fatalf("parsed pages = %d, structure = %+v", len(parsed.Pages), parsed.StructTree)
+	}
+	ext, err := extractor.New(parsed.Decoded())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pages []int
+	for _, bm := range ext.ExtractBookmarks() {
+		pages = append(pages, bm.Page)
+	}
+	if fmt.Sprint(pages) != "[0 1 2]" {
+		t.Errorf("bookmark pages = %v", pages)
+	}
+	form, err := ext.ExtractAcroForm()
+	if err != nil || form == nil || len(form.Fields) != 2 || form.Fields[1].FieldName() != "name_2" {
+		t.Fatalf("form = %+v, %v", form, err)
+	}
+}
@@ -0,0 +1,137 @@
+package assemble
+
+import (
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+type defaultAppearancer interface {
+	GetDefaultAppearance() string
+	SetDefaultAppearance(string)
+}
+
+// mergeForm copies the fields of src whose widgets are on pages of the
+// result. A field name already used by another document is renamed, and
+// all fields of src sharing that name (such as radio buttons) get the same
+// new name.
+func (a *assembler) mergeForm(src *source) {
+	form := src.doc.AcroForm
+	if form == nil {
+		return
+	}
+	out := a.out.AcroForm
+	if out == nil {
+		out = &semantic.AcroForm{XFA: form.XFA}
+		a.out.AcroForm = out
+	} else {
+		// XFA data describes one document's fields and cannot be combined.
+		out.XFA = nil
+	}
+	out.NeedAppearances = out.NeedAppearances || form.NeedAppearances
+	a.mergeDefaultResources(src, form.DefaultResources)
+
+	for _, f := range form.Fields {
+		if f == nil {
+			continue
+		}
+		page := -1
+		if idx := f.FieldPageIndex(); idx >= 0 {
+			mapped, ok := src.pages[idx]
+			if !ok {
+				continue
+			}
+			page = mapped
+		}
+		nf := shallowCopy(f)
+		nf.SetFieldPageIndex(page)
+		if name := a.fieldName(src, f.FieldName()); name != f.FieldName() {
+			nf.SetFieldName(name)
+		}
+		if da, ok := nf.(defaultAppearancer); ok {
+			da.SetDefaultAppearance(renameDAFont(da.GetDefaultAppearance(), src.fonts))
+		}
+		nf.SetDirty(true)
+		src.fields[f] = nf
+		out.Fields = append(out.Fields, nf)
+	}
+	for _, f := range form.CalculationOrder {
+		if nf, ok := src.fields[f]; ok {
+			out.CalculationOrder = append(out.CalculationOrder, nf)
+		}
+	}
+}
+
+func (a *assembler) fieldName(src *source, name string) string {
+	if renamed, ok := src.fieldNames[name]; ok {
+		return renamed
+	}
+	if a.fieldOwners == nil {
+		a.fieldOwners = make(map[string]*source)
+	}
+	if owner, ok := a.fieldOwners[name]; ok && owner != src {
+		name = uniqueName(name, func(n string) bool { _, used := a.fieldOwners[n]; return used })
+	}
+	a.fieldOwners[name] = src
+	src.fieldNames[name] = name
+	return name
+}
+
+// mergeDefaultResources adds the form default resources of src. Fonts that
+// clash with a different font of the same name are renamed; the rename is
+// applied to the default appearance strings of src's fields.
+func (a *assembler) mergeDefaultResources(src *source, dr *semantic.Resources) {
+	if dr == nil {
+		return
+	}
+	form := a.out.AcroForm
+	if form.DefaultResources == nil {
+		form.DefaultResources = &semantic.Resources{}
+	}
+	res := form.DefaultResources
+	for _, name := range sortedKeys(dr.Fonts) {
+		font := dr.Fonts[name]
+		if res.Fonts == nil {
+			res.Fonts = make(map[string]*semantic.Font)
+		}
+		existing, ok := res.Fonts[name]
+		switch {
+		case !ok:
+			res.Fonts[name] = font
+		case sameFont(existing, font):
+		default:
+			renamed := uniqueName(name, func(n string) bool { _, used := res.Fonts[n]; return used })
+			src.fonts[name] = renamed
+			res.Fonts[renamed] = font
+		}
+	}
+	res.ExtGStates = mergeMissing(res.ExtGStates, dr.ExtGStates)
+	res.ColorSpaces = mergeMissing(res.ColorSpaces, dr.ColorSpaces)
+	res.XObjects = mergeMissing(res.XObjects, dr.XObjects)
+	res.Patterns = mergeMissing(res.Patterns, dr.Patterns)
+	res.Shadings = mergeMissing(res.Shadings, dr.Shadings)
+	res.Properties = mergeMissing(res.Properties, dr.Properties)
+}
+
+func sameFont(a, b *semantic.Font) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	embedded := func(f *semantic.Font) bool { return f.Descriptor != nil && len(f.Descriptor.FontFile) > 0 }
+	return a.Subtype == b.Subtype && a.BaseFont == b.BaseFont && a.Encoding == b.Encoding &&
+		!embedded(a) && !embedded(b)
+}
+
+// mergeMissing adds the entries of from whose names dst lacks.
+func mergeMissing[V any](dst, from map[string]V) map[string]V {
+	for name, v := range from {
+		if dst == nil {
+			dst = make(map[string]V)
+		}
+		if _, ok := dst[name]; !ok {
+			dst[name] = v
+		}
+	}
+	return dst
+}
@@ -0,0 +1,54 @@
+package assemble
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// uniqueName returns name with the first "_N" suffix (N >= 2) not in use.
+func uniqueName(name string, used func(string) bool) string {
+	for n := 2; ; n++ {
+		if cand := fmt.Sprintf("%s_%d", name, n); !used(cand) {
+			return cand
+		}
+	}
+}
+
+// uniqueFileName is uniqueName that keeps the file extension last.
+func uniqueFileName(name string, used map[string]bool) string {
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for n := 2; ; n++ {
+		if cand := fmt.Sprintf("%s_%d%s", stem, n, ext); !used[cand] {
+			return cand
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var daFontPattern = regexp.MustCompile(`/([^\s/\[\]()<>{}%]+)(\s+[-+.\d]+\s+Tf)`)
+
+// renameDAFont rewrites the font selected by a default appearance string.
+func renameDAFont(da string, renames map[string]string) string {
+	if len(renames) == 0 {
+		return da
+	}
+	return daFontPattern.ReplaceAllStringFunc(da, func(m string) string {
+		sub := daFontPattern.FindStringSubmatch(m)
+		if to, ok := renames[sub[1]]; ok {
+			return "/" + to + sub[2]
+		}
+		return m
+	})
+}
@@ -0,0 +1,77 @@
+package assemble
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// SplitEvery splits doc into documents of n pages; the last one may be
+// shorter.
+func SplitEvery(ctx context.Context, doc *semantic.Document, n int) ([]*semantic.Document, error) {
+	if doc == nil {
+		return nil, errors.New("assemble: nil document")
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("assemble: invalid page count %d", n)
+	}
+	var starts []int
+	for i := 0; i < len(doc.Pages); i += n {
+		starts = append(starts, i)
+	}
+	return splitAt(ctx, doc, starts)
+}
+
+// SplitByOutline splits doc before every page targeted by an outline item
+// at the given depth (1 for top-level bookmarks). Pages before the first
+// such page form a document of their own. Each part keeps the outline items
+// pointing into it.
+func SplitByOutline(ctx context.Context, doc *semantic.Document, level int) ([]*semantic.Document, error) {
+	if doc == nil {
+		return nil, errors.New("assemble: nil document")
+	}
+	if level < 1 {
+		return nil, fmt.Errorf("assemble: invalid outline level %d", level)
+	}
+	seen := map[int]bool{0: true}
+	starts := []int{0}
+	var walk func(items []semantic.OutlineItem, depth int)
+	walk = func(items []semantic.OutlineItem, depth int) {
+		for _, item := range items {
+			if depth == level {
+				if idx := item.PageIndex; idx > 0 && idx < len(doc.Pages) && !seen[idx] {
+					seen[idx] = true
+					starts = append(starts, idx)
+				}
+				continue
+			}
+			walk(item.Children, depth+1)
+		}
+	}
+	walk(doc.Outlines, 1)
+	sort.Ints(starts)
+	return splitAt(ctx, doc, starts)
+}
+
+// splitAt assembles the page ranges beginning at the sorted starts.
+func splitAt(ctx context.Context, doc *semantic.Document, starts []int) ([]*semantic.Document, error) {
+	if len(doc.Pages) == 0 {
+		return nil, ErrNoPages
+	}
+	out := make([]*semantic.Document, 0, len(starts))
+	for i, start := range starts {
+		end := len(doc.Pages)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		part, err := Assemble(ctx, Part{Doc: doc, Pages: Range(start, end)})
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, part)
+	}
+	return out, nil
+}
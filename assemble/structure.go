@@ -0,0 +1,112 @@
+package assemble
+
+import "github.com/wudi/pdfkit/ir/semantic"
+
+// mergeStructure appends the structure elements of src that still have
+// content in the result. Elements are copied with their pages remapped;
+// elements and content items on pages that were left out are dropped, and
+// so are elements left without children. The parent tree is rebuilt by the
+// writer.
+func (a *assembler) mergeStructure(src *source) {
+	tree := src.doc.StructTree
+	if tree == nil {
+		return
+	}
+	out := a.out.StructTree
+	if out == nil {
+		out = &semantic.StructureTree{Type: tree.Type, IDTree: make(map[string]*semantic.StructureElement)}
+		a.out.StructTree = out
+		a.structIDs = make(map[string]bool)
+	}
+	for _, role := range sortedKeys(tree.RoleMap) {
+		target := tree.RoleMap[role]
+		if out.RoleMap == nil {
+			out.RoleMap = make(semantic.RoleMap)
+		}
+		existing, ok := out.RoleMap[role]
+		switch {
+		case !ok:
+			out.RoleMap[role] = target
+		case existing != target:
+			renamed := uniqueName(role, func(n string) bool { _, used := out.RoleMap[n]; return used })
+			src.roles[role] = renamed
+			out.RoleMap[renamed] = target
+		}
+	}
+	out.ClassMap = mergeMissing(out.ClassMap, tree.ClassMap)
+	for _, ns := range tree.Namespaces {
+		dup := false
+		for _, existing := range out.Namespaces {
+			dup = dup || existing == ns || (existing != nil && ns != nil && existing.NS == ns.NS)
+		}
+		if !dup {
+			out.Namespaces = append(out.Namespaces, ns)
+		}
+	}
+	for _, elem := range tree.K {
+		if c := a.cloneElement(src, elem, nil, nil); c != nil {
+			out.K = append(out.K, c)
+		}
+	}
+}
+
+// cloneElement copies elem under parent. page is the source page inherited
+// from the nearest ancestor with one.
+func (a *assembler) cloneElement(src *source, elem, parent *semantic.StructureElement, page *semantic.Page) *semantic.StructureElement {
+	if elem == nil {
+		return nil
+	}
+	c := *elem
+	c.P = parent
+	c.K = nil
+	c.Dirty = true
+	if role, ok := src.roles[elem.S]; ok {
+		c.S = role
+	}
+	if elem.Pg != nil {
+		page = elem.Pg
+		c.Pg = a.pageMap[elem.Pg]
+		if c.Pg == nil && len(elem.K) == 0 {
+			return nil
+		}
+	}
+	for _, item := range elem.K {
+		switch {
+		case item.Element != nil:
+			kid := a.cloneElement(src, item.Element, &c, page)
+			if kid == nil {
+				continue
+			}
+			item.Element = kid
+		case item.MCR != nil:
+			pg := item.MCR.Pg
+			if pg == nil {
+				pg = page
+			}
+			if pg != nil && a.pageMap[pg] == nil {
+				continue
+			}
+			mcr := *item.MCR
+			if mcr.Pg != nil {
+				mcr.Pg = a.pageMap[mcr.Pg]
+			}
+			item.MCR = &mcr
+		default:
+			if page != nil && a.pageMap[page] == nil {
+				continue
+			}
+		}
+		c.K = append(c.K, item)
+	}
+	if len(elem.K) > 0 && len(c.K) == 0 {
+		return nil
+	}
+	if c.ID != "" {
+		if a.structIDs[c.ID] {
+			c.ID = uniqueName(c.ID, func(n string) bool { return a.structIDs[n] })
+		}
+		a.structIDs[c.ID] = true
+		a.out.StructTree.IDTree[c.ID] = &c
+	}
+	return &c
+}
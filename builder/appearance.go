@@ -1,259 +1,701 @@
 package builder
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/wudi/pdfkit/internal/pdfnum"
 	"github.com/wudi/pdfkit/ir/semantic"
 )
 
-// AppearanceGenerator handles the generation of appearance streams for form fields.
+// AppearanceGenerator generates appearance streams for form fields and
+// annotations. Appearances follow the entries that describe them: the
+// default appearance string (DA), the MK and BS dictionaries of widgets,
+// border effects (BE) and quadding (Q). Text is laid out with the metrics of
+// the fonts in the form's default resources.
 type AppearanceGenerator struct {
 	Form *semantic.AcroForm
+
+	codes map[*semantic.Font]map[rune]int // reverse ToUnicode maps
 }
 
 func NewAppearanceGenerator(form *semantic.AcroForm) *AppearanceGenerator {
 	return &AppearanceGenerator{Form: form}
 }
 
+// GenerateAppearances stores a generated normal appearance in the
+// AppearanceForm of every form field of doc and of every page annotation
+// that has no appearance, so that viewers ignoring NeedAppearances render
+// the document as intended. NeedAppearances is cleared afterwards. Fields
+// and annotations of types without a generator are left alone.
+func GenerateAppearances(doc *semantic.Document) error {
+	if doc == nil {
+		return errors.New("document is nil")
+	}
+	g := NewAppearanceGenerator(doc.AcroForm)
+	generated := make(map[semantic.FormField]bool)
+	field := func(f semantic.FormField) error {
+		if f == nil || generated[f] {
+			return nil
+		}
+		generated[f] = true
+		xo, err := g.Generate(f)
+		if errors.Is(err, errors.ErrUnsupported) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("field %q: %w", f.FieldName(), err)
+		}
+		if base := baseField(f); base != nil {
+			base.AppearanceForm = xo
+			base.Dirty = true
+		}
+		return nil
+	}
+	if doc.AcroForm != nil {
+		for _, f := range doc.AcroForm.Fields {
+			if err := field(f); err != nil {
+				return err
+			}
+		}
+	}
+	for i, p := range doc.Pages {
+		for _, a := range p.Annotations {
+			if w, ok := a.(*semantic.WidgetAnnotation); ok && w.Field != nil {
+				if err := field(w.Field); err != nil {
+					return err
+				}
+				w.AppearanceForm = w.Field.GetAppearanceForm()
+				continue
+			}
+			if a == nil || len(a.Base().Appearance) > 0 || a.Base().AppearanceForm != nil {
+				continue
+			}
+			xo, err := g.GenerateAnnotation(a)
+			if errors.Is(err, errors.ErrUnsupported) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("page %d: %s annotation: %w", i+1, a.Type(), err)
+			}
+			a.Base().AppearanceForm = xo
+			a.Base().Dirty = true
+		}
+	}
+	if doc.AcroForm != nil && doc.AcroForm.NeedAppearances {
+		doc.AcroForm.NeedAppearances = false
+		doc.AcroForm.Dirty = true
+	}
+	return nil
+}
+
+func baseField(f semantic.FormField) *semantic.BaseFormField {
+	switch t := f.(type) {
+	case *semantic.TextFormField:
+		return &t.BaseFormField
+	case *semantic.ChoiceFormField:
+		return &t.BaseFormField
+	case *semantic.ButtonFormField:
+		return &t.BaseFormField
+	case *semantic.SignatureFormField:
+		return &t.BaseFormField
+	case *semantic.GenericFormField:
+		return &t.BaseFormField
+	}
+	return nil
+}
+
+// Generate returns the normal appearance of a field as a form XObject.
 func (g *AppearanceGenerator) Generate(field semantic.FormField) (*semantic.XObject, error) {
 	switch f := field.(type) {
 	case *semantic.TextFormField:
 		return g.generateTextAppearance(f)
+	case *semantic.ChoiceFormField:
+		return g.generateChoiceAppearance(f)
 	case *semantic.ButtonFormField:
 		return g.generateButtonAppearance(f)
+	case *semantic.SignatureFormField:
+		return g.generateSignatureAppearance(f)
 	default:
-		return nil, fmt.Errorf("unsupported field type for appearance generation: %T", field)
+		return nil, fmt.Errorf("unsupported field type for appearance generation: %T: %w", field, errors.ErrUnsupported)
 	}
 }
 
-func (g *AppearanceGenerator) generateTextAppearance(field *semantic.TextFormField) (*semantic.XObject, error) {
-	// 1. Parse DA string
-	da := field.GetDefaultAppearance()
-	fontName, fontSize, color := parseDA(da)
-	if fontName == "" {
-		fontName = "Helv" // Default
-	}
-	if fontSize == 0 {
-		fontSize = 12
-	}
-
-	// 2. Calculate layout
-	rect := field.FieldRect()
-	width := rect.URX - rect.LLX
-	height := rect.URY - rect.LLY
-
-	// 3. Build content stream
-	var buf bytes.Buffer
-
-	// /Tx BMC ... EMC
-	buf.WriteString("/Tx BMC\n")
-	buf.WriteString("q\n")
-
-	// Clip to border (simplified)
-	buf.WriteString(fmt.Sprintf("1 1 %.2f %.2f re W n\n", width-2, height-2))
+// fieldStyle is the text style of a field from its DA string, resolved
+// against the appearance's resources.
+type fieldStyle struct {
+	font  *textFont
+	size  float64 // 0 for auto-sizing
+	color []float64
+}
 
-	// Set font and color
-	buf.WriteString(fmt.Sprintf("BT\n/%s %g Tf\n", fontName, fontSize))
+func (g *AppearanceGenerator) fieldStyle(res *appearanceResources, da string) fieldStyle {
+	name, size, color := parseDA(da)
+	return fieldStyle{font: res.font(name), size: size, color: color}
+}
 
-	// Set color
-	writeColor(&buf, color)
+// setFont writes the operators selecting the style's font at size and its
+// colour.
+func (s fieldStyle) setFont(c *contentWriter, size float64) {
+	fmt.Fprintf(c, "/%s %s Tf\n", s.font.name, pdfnum.Format(size, 3))
+	c.fill(s.color)
+}
 
-	// Position text
-	// Handle Quadding (alignment)
-	textWidth := g.measureText(field.Value, fontName, fontSize)
+// textPadding is the space between the border of a text field and its
+// text.
+const textPadding = 2
 
-	x := 2.0 // Default padding
-	switch field.Quadding {
-	case 1: // Center
-		x = (width - textWidth) / 2
-	case 2: // Right
-		x = width - textWidth - 2
+func (g *AppearanceGenerator) generateTextAppearance(field *semantic.TextFormField) (*semantic.XObject, error) {
+	width, height, matrix := appearanceBox(field)
+	res := g.newResources()
+	style := g.fieldStyle(res, field.GetDefaultAppearance())
+
+	var c contentWriter
+	inset := drawFrame(&c, width, height, field.BorderStyle, field.BorderColor, field.BackgroundColor)
+	flags := field.Flags
+	comb := flags&semantic.FieldFlagComb != 0 && field.MaxLen > 0 &&
+		flags&(semantic.FieldFlagMultiline|semantic.FieldFlagPassword|semantic.FieldFlagFileSelect) == 0
+	if comb && len(field.BorderColor) > 0 {
+		// Comb fields divide their box into MaxLen cells.
+		cell := width / float64(field.MaxLen)
+		c.stroke(field.BorderColor)
+		for i := 1; i < field.MaxLen; i++ {
+			c.op("m", float64(i)*cell, inset)
+			c.op("l", float64(i)*cell, height-inset)
+		}
+		c.op("S")
 	}
 
-	buf.WriteString(fmt.Sprintf("%.2f 2 Td\n", x))
-
-	// Draw text
-	text := escapeText(field.Value)
-	buf.WriteString(fmt.Sprintf("(%s) Tj\n", text))
-
-	buf.WriteString("ET\n")
-	buf.WriteString("Q\n")
-	buf.WriteString("EMC\n")
+	value := field.Value
+	if flags&semantic.FieldFlagPassword != 0 {
+		value = strings.Repeat("*", utf8.RuneCountInString(value))
+	}
+	c.WriteString("/Tx BMC\nq\n")
+	clipInside(&c, width, height, inset)
+	switch {
+	case flags&semantic.FieldFlagRichText != 0 && field.RichValue != "":
+		g.writeRichField(&c, res, style, parseRichText(field.RichValue), width, height, inset, field.Quadding, flags&semantic.FieldFlagMultiline != 0)
+	case comb:
+		writeComb(&c, style, value, field.MaxLen, width, height, inset)
+	case flags&semantic.FieldFlagMultiline != 0:
+		writeMultiline(&c, style, value, width, height, inset, field.Quadding)
+	default:
+		writeSingleLine(&c, style, value, width, height, inset, field.Quadding)
+	}
+	c.WriteString("Q\nEMC\n")
 
-	// 4. Create XObject
-	xobj := &semantic.XObject{
+	return &semantic.XObject{
 		Subtype:   "Form",
 		BBox:      semantic.Rectangle{LLX: 0, LLY: 0, URX: width, URY: height},
-		Resources: g.Form.DefaultResources, // Inherit DR
-		Data:      buf.Bytes(),
-	}
+		Matrix:    matrix,
+		Resources: res.resources(),
+		Data:      c.Bytes(),
+	}, nil
+}
 
-	return xobj, nil
+// clipInside clips to the area inside a border of the given inset.
+func clipInside(c *contentWriter, width, height, inset float64) {
+	c.op("re", inset+1, inset+1, width-2*inset-2, height-2*inset-2)
+	c.WriteString("W n\n")
 }
 
-func (g *AppearanceGenerator) measureText(text string, fontName string, fontSize float64) float64 {
-	// Try to find font in DefaultResources
-	var font *semantic.Font
-	if g.Form.DefaultResources != nil && g.Form.DefaultResources.Fonts != nil {
-		font = g.Form.DefaultResources.Fonts[fontName]
+// autoSize returns the font size fitting a single line of text into the
+// available width and height.
+func autoSize(font *textFont, text string, width, height float64) float64 {
+	ascent, descent := font.metrics()
+	size := height / (ascent - descent)
+	if w := font.measure(text, 1); w > 0 && width/w < size {
+		size = width / w
 	}
+	return max(size, 1)
+}
 
-	if font == nil {
-		// Fallback: assume average width of 0.5 em
-		return float64(len(text)) * fontSize * 0.5
+// writeSingleLine draws value on one line, centred vertically and aligned
+// horizontally by quadding.
+func writeSingleLine(c *contentWriter, style fieldStyle, value string, width, height, inset float64, quadding int) {
+	pad := inset + textPadding
+	size := style.size
+	if size == 0 {
+		size = autoSize(style.font, value, width-2*pad, height-2*pad)
 	}
+	ascent, descent := style.font.metrics()
+	y := (height-(ascent-descent)*size)/2 - descent*size
+	tw := style.font.measure(value, size)
+	x := pad
+	switch quadding {
+	case 1:
+		x = (width - tw) / 2
+	case 2:
+		x = width - pad - tw
+	}
+	c.WriteString("BT\n")
+	style.setFont(c, size)
+	c.op("Td", x, y)
+	fmt.Fprintf(c, "%s Tj\n", style.font.encode(value))
+	c.WriteString("ET\n")
+}
 
-	width := 0.0
-	for _, r := range text {
-		w := g.getCharWidth(font, r)
-		width += w / 1000.0 * fontSize
+// writeMultiline wraps value to the width of the field and draws it from
+// the top. With an automatic font size the largest size from 12 points down
+// whose lines fit the height is used.
+func writeMultiline(c *contentWriter, style fieldStyle, value string, width, height, inset float64, quadding int) {
+	pad := inset + textPadding
+	avail := width - 2*pad
+	ascent, descent := style.font.metrics()
+	size := style.size
+	var lines []string
+	layout := func(size float64) {
+		lines = wrapText(value, avail, func(s string) float64 { return style.font.measure(s, size) })
 	}
-	return width
+	if size == 0 {
+		for size = 12; size > 4; size -= 0.5 {
+			layout(size)
+			if ((ascent-descent)+float64(len(lines)-1)*lineSpacing)*size <= height-2*pad {
+				break
+			}
+		}
+	}
+	layout(size)
+	c.WriteString("BT\n")
+	style.setFont(c, size)
+	y := height - pad - ascent*size
+	for _, line := range lines {
+		tw := style.font.measure(line, size)
+		x := pad
+		switch quadding {
+		case 1:
+			x = (width - tw) / 2
+		case 2:
+			x = width - pad - tw
+		}
+		c.op("Tm", 1, 0, 0, 1, x, y)
+		fmt.Fprintf(c, "%s Tj\n", style.font.encode(line))
+		y -= size * lineSpacing
+	}
+	c.WriteString("ET\n")
 }
 
-func (g *AppearanceGenerator) getCharWidth(font *semantic.Font, r rune) float64 {
-	if font == nil {
-		return 500
+// lineSpacing is the distance between the baselines of wrapped text, as a
+// multiple of the font size.
+const lineSpacing = 1.15
+
+// writeComb draws the characters of value centred in maxLen equal cells.
+func writeComb(c *contentWriter, style fieldStyle, value string, maxLen int, width, height, inset float64) {
+	cell := width / float64(maxLen)
+	runes := []rune(value)
+	if len(runes) > maxLen {
+		runes = runes[:maxLen]
 	}
+	size := style.size
+	if size == 0 {
+		size = autoSize(style.font, "W", cell-2, height-2*(inset+textPadding))
+	}
+	ascent, descent := style.font.metrics()
+	y := (height-(ascent-descent)*size)/2 - descent*size
+	c.WriteString("BT\n")
+	style.setFont(c, size)
+	for i, r := range runes {
+		x := float64(i)*cell + (cell-style.font.measure(string(r), size))/2
+		c.op("Tm", 1, 0, 0, 1, x, y)
+		fmt.Fprintf(c, "%s Tj\n", style.font.encode(string(r)))
+	}
+	c.WriteString("ET\n")
+}
 
-	// 1. Check ToUnicode (Reverse lookup)
-	if len(font.ToUnicode) > 0 {
-		for code, runes := range font.ToUnicode {
-			if len(runes) == 1 && runes[0] == r {
-				// Found code for rune
-				if w, ok := font.Widths[code]; ok {
-					return float64(w)
-				}
-				if font.DescendantFont != nil {
-					if w, ok := font.DescendantFont.W[code]; ok {
-						return float64(w)
-					}
-					return float64(font.DescendantFont.DW)
-				}
+// writeRichField draws rich text into a text field, shrinking it to fit
+// when the DA string asks for an automatic size.
+func (g *AppearanceGenerator) writeRichField(c *contentWriter, res *appearanceResources, style fieldStyle, paras []richParagraph, width, height, inset float64, quadding int, multiline bool) {
+	pad := inset + textPadding
+	avail := width - 2*pad
+	size := style.size
+	var lines []richLine
+	if size == 0 {
+		for size = 12; size > 4; size -= 0.5 {
+			lines = layoutRich(res, paras, style.font, size, style.color, avail, multiline)
+			if richHeight(lines) <= height-2*pad {
+				break
 			}
 		}
 	}
+	lines = layoutRich(res, paras, style.font, size, style.color, avail, multiline)
+	top := height - pad
+	if !multiline && len(lines) > 0 {
+		// A single line is centred vertically like plain text.
+		top = (height + richHeight(lines[:1])) / 2
+		lines = lines[:1]
+	}
+	writeRich(c, lines, pad, top, avail, quadding)
+}
 
-	// 2. Simple Encoding (Rune == Code)
-	if int(r) < 256 {
-		if w, ok := font.Widths[int(r)]; ok {
-			return float64(w)
+// generateChoiceAppearance draws a combo box like a single-line text
+// field showing its value, and a list box as its options with the selected
+// ones highlighted.
+func (g *AppearanceGenerator) generateChoiceAppearance(field *semantic.ChoiceFormField) (*semantic.XObject, error) {
+	width, height, matrix := appearanceBox(field)
+	res := g.newResources()
+	style := g.fieldStyle(res, field.GetDefaultAppearance())
+
+	var c contentWriter
+	inset := drawFrame(&c, width, height, field.BorderStyle, field.BorderColor, field.BackgroundColor)
+	c.WriteString("/Tx BMC\nq\n")
+	clipInside(&c, width, height, inset)
+	if field.IsCombo {
+		value := ""
+		if len(field.Selected) > 0 {
+			value = field.Selected[0]
 		}
+		writeSingleLine(&c, style, value, width, height, inset, field.Quadding)
+	} else {
+		writeList(&c, style, field, width, height, inset)
 	}
+	c.WriteString("Q\nEMC\n")
+
+	return &semantic.XObject{
+		Subtype:   "Form",
+		BBox:      semantic.Rectangle{LLX: 0, LLY: 0, URX: width, URY: height},
+		Matrix:    matrix,
+		Resources: res.resources(),
+		Data:      c.Bytes(),
+	}, nil
+}
 
-	return 500 // Default
+// listHighlight is the colour behind the selected options of a list box.
+var listHighlight = []float64{0.6, 0.75, 0.85}
+
+func writeList(c *contentWriter, style fieldStyle, field *semantic.ChoiceFormField, width, height, inset float64) {
+	size := style.size
+	if size == 0 {
+		size = 12
+	}
+	ascent, descent := style.font.metrics()
+	row := size * lineSpacing
+	visible := int((height - 2*inset - 2) / row)
+	if visible < 1 {
+		visible = 1
+	}
+	selected := make(map[string]bool, len(field.Selected))
+	first := -1
+	for _, s := range field.Selected {
+		selected[s] = true
+	}
+	for i, o := range field.Options {
+		if selected[o] && first < 0 {
+			first = i
+		}
+	}
+	// Scroll so that the first selected option is visible.
+	top := 0
+	if first >= visible {
+		top = first - visible + 1
+	}
+	end := min(len(field.Options), top+visible)
+	for i := top; i < end; i++ {
+		if selected[field.Options[i]] {
+			y := height - inset - 1 - float64(i-top+1)*row
+			c.fill(listHighlight)
+			c.op("re", inset+1, y, width-2*inset-2, row)
+			c.op("f")
+		}
+	}
+	c.WriteString("BT\n")
+	style.setFont(c, size)
+	for i := top; i < end; i++ {
+		y := height - inset - 1 - float64(i-top+1)*row
+		baseline := y + (row-(ascent-descent)*size)/2 - descent*size
+		x := inset + textPadding
+		tw := style.font.measure(field.Options[i], size)
+		switch field.Quadding {
+		case 1:
+			x = (width - tw) / 2
+		case 2:
+			x = width - inset - textPadding - tw
+		}
+		c.op("Tm", 1, 0, 0, 1, x, baseline)
+		fmt.Fprintf(c, "%s Tj\n", style.font.encode(field.Options[i]))
+	}
+	c.WriteString("ET\n")
 }
 
 func (g *AppearanceGenerator) generateButtonAppearance(field *semantic.ButtonFormField) (*semantic.XObject, error) {
-	rect := field.FieldRect()
-	width := rect.URX - rect.LLX
-	height := rect.URY - rect.LLY
-
-	var buf bytes.Buffer
-	buf.WriteString("q\n")
-
-	if field.IsRadio {
-		// Draw Circle
-		// 1 g (white background)
-		// 0 0 0 RG (black border)
-		// 0.5 w (line width)
-		buf.WriteString("1 g\n0 0 0 RG\n0.5 w\n")
-
-		// Circle approximation using Bezier curves is complex to write manually.
-		// We'll use a simplified approach or just a square for now if we want to be lazy,
-		// but "Zero Compromise" suggests we should try.
-		// Or we can use a font glyph if available (ZapfDingbats l/m/n).
-		// Let's draw a circle path.
+	width, height, matrix := appearanceBox(field)
+	res := g.newResources()
+	mk := len(field.BorderColor) > 0 || len(field.BackgroundColor) > 0
+
+	var c contentWriter
+	c.WriteString("q\n")
+
+	switch {
+	case field.IsRadio:
 		cx, cy := width/2, height/2
 		r := (min(width, height) / 2) - 1
-
-		// Draw circle (simplified as 4 curves)
-		magic := r * 0.551784
-		buf.WriteString(fmt.Sprintf("%.2f %.2f m\n", cx+r, cy))
-		buf.WriteString(fmt.Sprintf("%.2f %.2f %.2f %.2f %.2f %.2f c\n", cx+r, cy+magic, cx+magic, cy+r, cx, cy+r))
-		buf.WriteString(fmt.Sprintf("%.2f %.2f %.2f %.2f %.2f %.2f c\n", cx-magic, cy+r, cx-r, cy+magic, cx-r, cy))
-		buf.WriteString(fmt.Sprintf("%.2f %.2f %.2f %.2f %.2f %.2f c\n", cx-r, cy-magic, cx-magic, cy-r, cx, cy-r))
-		buf.WriteString(fmt.Sprintf("%.2f %.2f %.2f %.2f %.2f %.2f c\n", cx+magic, cy-r, cx+r, cy-magic, cx+r, cy))
-		buf.WriteString("B\n") // Fill and stroke
+		bw := 0.5
+		if mk {
+			bw = borderWidth(field.BorderStyle, field.BorderColor)
+			c.fill(field.BackgroundColor)
+			c.stroke(field.BorderColor)
+		} else {
+			c.WriteString("1 g\n0 0 0 RG\n")
+		}
+		c.op("w", bw)
+		ellipse(&c, cx, cy, r-bw/2, r-bw/2)
+		switch {
+		case !mk:
+			c.op("B")
+		case len(field.BackgroundColor) > 0 && len(field.BorderColor) > 0 && bw > 0:
+			c.op("B")
+		case len(field.BackgroundColor) > 0:
+			c.op("f")
+		case bw > 0:
+			c.op("S")
+		default:
+			c.op("n")
+		}
 
 		if field.Checked {
-			// Draw Dot (smaller circle, filled black)
-			r2 := r / 2
-			magic2 := r2 * 0.551784
-			buf.WriteString("0 g\n")
-			buf.WriteString(fmt.Sprintf("%.2f %.2f m\n", cx+r2, cy))
-			buf.WriteString(fmt.Sprintf("%.2f %.2f %.2f %.2f %.2f %.2f c\n", cx+r2, cy+magic2, cx+magic2, cy+r2, cx, cy+r2))
-			buf.WriteString(fmt.Sprintf("%.2f %.2f %.2f %.2f %.2f %.2f c\n", cx-magic2, cy+r2, cx-r2, cy+magic2, cx-r2, cy))
-			buf.WriteString(fmt.Sprintf("%.2f %.2f %.2f %.2f %.2f %.2f c\n", cx-r2, cy-magic2, cx-magic2, cy-r2, cx, cy-r2))
-			buf.WriteString(fmt.Sprintf("%.2f %.2f %.2f %.2f %.2f %.2f c\n", cx+magic2, cy-r2, cx+r2, cy-magic2, cx+r2, cy))
-			buf.WriteString("f\n") // Fill
+			if field.Caption != "" {
+				g.writeSymbol(&c, res, field.GetDefaultAppearance(), field.Caption, width, height, bw)
+			} else {
+				style := g.fieldStyle(res, field.GetDefaultAppearance())
+				if !c.fill(style.color) {
+					c.WriteString("0 g\n")
+				}
+				ellipse(&c, cx, cy, r/2, r/2)
+				c.op("f")
+			}
+		}
+	case field.IsCheck:
+		inset := 0.0
+		if mk {
+			inset = drawFrame(&c, width, height, field.BorderStyle, field.BorderColor, field.BackgroundColor)
+		} else {
+			c.WriteString("1 g\n0 0 0 RG\n0.5 w\n")
+			c.op("re", 0, 0, width, height)
+			c.op("B")
 		}
-	} else if field.IsCheck {
-		// Draw Checkbox (Square)
-		// 1 g (white background)
-		// 0 0 0 RG (black border)
-		// 0.5 w (line width)
-		buf.WriteString("1 g\n0 0 0 RG\n0.5 w\n")
-		buf.WriteString(fmt.Sprintf("0 0 %.2f %.2f re\n", width, height))
-		buf.WriteString("B\n") // Fill and stroke
 
 		if field.Checked {
-			// Draw X
-			buf.WriteString("0 g\n") // Black
-			buf.WriteString("1 w\n")
-			padding := 3.0
-			buf.WriteString(fmt.Sprintf("%.2f %.2f m %.2f %.2f l S\n", padding, padding, width-padding, height-padding))
-			buf.WriteString(fmt.Sprintf("%.2f %.2f m %.2f %.2f l S\n", padding, height-padding, width-padding, padding))
+			if field.Caption != "" {
+				g.writeSymbol(&c, res, field.GetDefaultAppearance(), field.Caption, width, height, inset)
+			} else {
+				// Draw X
+				style := g.fieldStyle(res, field.GetDefaultAppearance())
+				if !c.stroke(style.color) {
+					c.WriteString("0 G\n")
+				}
+				c.WriteString("1 w\n")
+				padding := 3.0 + inset
+				c.op("m", padding, padding)
+				c.op("l", width-padding, height-padding)
+				c.op("S")
+				c.op("m", padding, height-padding)
+				c.op("l", width-padding, padding)
+				c.op("S")
+			}
 		}
-	} else {
-		// Push Button (Label)
-		// Draw Bevel effect?
-		buf.WriteString("0.75 g\n") // Light gray
-		buf.WriteString(fmt.Sprintf("0 0 %.2f %.2f re\n", width, height))
-		buf.WriteString("f\n")
-
-		// Draw Label (Caption)
-		// Assuming field.OnState or Name is the label?
-		// Usually PushButtons have a caption in MK dictionary (CA/RC).
-		// We'll use field.Caption if available, else Name, else "Button"
+	default:
+		// Push buttons show their caption, or failing that their name, on
+		// a gray face unless MK gives a background.
+		bg := field.BackgroundColor
+		if len(bg) == 0 {
+			bg = []float64{0.75}
+		}
+		inset := drawFrame(&c, width, height, field.BorderStyle, field.BorderColor, bg)
 		label := "Button"
 		if field.Caption != "" {
 			label = field.Caption
 		} else if field.Name != "" {
 			label = field.Name
 		}
+		style := g.fieldStyle(res, field.GetDefaultAppearance())
+		if field.GetDefaultAppearance() == "" {
+			style.size = 12
+		}
+		if len(style.color) == 0 {
+			style.color = []float64{0}
+		}
+		writeSingleLine(&c, style, label, width, height, inset, 1)
+	}
 
-		// Center text
-		fontSize := 12.0
-		textWidth := g.measureText(label, "Helv", fontSize)
-		x := (width - textWidth) / 2
-		y := (height - fontSize) / 2
+	c.WriteString("Q\n")
 
-		buf.WriteString("0 g\n") // Black text
-		buf.WriteString("BT\n/Helv 12 Tf\n")
-		buf.WriteString(fmt.Sprintf("%.2f %.2f Td\n", x, y))
-		buf.WriteString(fmt.Sprintf("(%s) Tj\n", escapeText(label)))
-		buf.WriteString("ET\n")
-	}
+	return &semantic.XObject{
+		Subtype:   "Form",
+		BBox:      semantic.Rectangle{LLX: 0, LLY: 0, URX: width, URY: height},
+		Matrix:    matrix,
+		Resources: res.resources(),
+		Data:      c.Bytes(),
+	}, nil
+}
 
-	buf.WriteString("Q\n")
+// writeSymbol draws the ZapfDingbats character a check box or radio button
+// names in its MK caption (4 is a check mark, 8 a cross, l a dot, n a
+// square, u a diamond, H a star), centred in the box.
+func (g *AppearanceGenerator) writeSymbol(c *contentWriter, res *appearanceResources, da, symbol string, width, height, inset float64) {
+	_, size, color := parseDA(da)
+	font := res.font("ZaDb")
+	if size == 0 {
+		size = (min(width, height) - 2*inset) * 0.8
+	}
+	tw := font.measure(symbol, size)
+	c.WriteString("BT\n")
+	fmt.Fprintf(c, "/%s %s Tf\n", font.name, pdfnum.Format(size, 3))
+	if !c.fill(color) {
+		c.WriteString("0 g\n")
+	}
+	c.op("Td", (width-tw)/2, (height-0.7*size)/2)
+	fmt.Fprintf(c, "%s Tj\n", font.encode(symbol))
+	c.WriteString("ET\n")
+}
 
-	xobj := &semantic.XObject{
+// generateSignatureAppearance draws the frame of an unsigned signature
+// field.
+func (g *AppearanceGenerator) generateSignatureAppearance(field *semantic.SignatureFormField) (*semantic.XObject, error) {
+	width, height, matrix := appearanceBox(field)
+	var c contentWriter
+	drawFrame(&c, width, height, field.BorderStyle, field.BorderColor, field.BackgroundColor)
+	return &semantic.XObject{
 		Subtype:   "Form",
 		BBox:      semantic.Rectangle{LLX: 0, LLY: 0, URX: width, URY: height},
-		Resources: g.Form.DefaultResources,
-		Data:      buf.Bytes(),
+		Matrix:    matrix,
+		Resources: g.newResources().resources(),
+		Data:      c.Bytes(),
+	}, nil
+}
+
+// measureText returns the width of text in the font with the resource name
+// fontName, assuming half an em per character for unknown fonts.
+func (g *AppearanceGenerator) measureText(text string, fontName string, fontSize float64) float64 {
+	tf := &textFont{name: fontName, base: standardFonts[fontName]}
+	if g.Form != nil && g.Form.DefaultResources != nil {
+		if f := g.Form.DefaultResources.Fonts[fontName]; f != nil {
+			tf = g.textFont(fontName, f)
+		}
 	}
-	return xobj, nil
+	return tf.measure(text, fontSize)
 }
 
-func min(a, b float64) float64 {
-	if a < b {
-		return a
+// borderWidth returns the width of a widget border: the BS width, 1 by
+// default, and 0 without a border colour.
+func borderWidth(bs *semantic.BorderStyle, bc []float64) float64 {
+	if len(bc) == 0 {
+		return 0
 	}
-	return b
+	if bs == nil {
+		return 1
+	}
+	return bs.Width
+}
+
+// drawFrame draws the background and border of a widget as described by
+// its MK colours and border style, returning the width taken by the
+// border: beveled and inset borders take twice the border width.
+func drawFrame(c *contentWriter, width, height float64, bs *semantic.BorderStyle, bc, bg []float64) float64 {
+	if c.fill(bg) {
+		c.op("re", 0, 0, width, height)
+		c.op("f")
+	}
+	bw := borderWidth(bs, bc)
+	if bw <= 0 {
+		return 0
+	}
+	style := "S"
+	var dash []float64
+	if bs != nil {
+		if bs.Style != "" {
+			style = bs.Style
+		}
+		dash = bs.Dash
+	}
+	if style == "B" || style == "I" {
+		light, dark := []float64{1}, []float64{0.5}
+		if style == "I" {
+			light, dark = []float64{0.5}, []float64{0.75}
+		} else if len(bg) == 1 || len(bg) == 3 {
+			dark = make([]float64, len(bg))
+			for i, v := range bg {
+				dark[i] = v / 2
+			}
+		}
+		// The top and left edges are lit, the bottom and right ones shaded.
+		c.fill(light)
+		c.op("m", bw, bw)
+		c.op("l", bw, height-bw)
+		c.op("l", width-bw, height-bw)
+		c.op("l", width-2*bw, height-2*bw)
+		c.op("l", 2*bw, height-2*bw)
+		c.op("l", 2*bw, 2*bw)
+		c.op("f")
+		c.fill(dark)
+		c.op("m", width-bw, height-bw)
+		c.op("l", width-bw, bw)
+		c.op("l", bw, bw)
+		c.op("l", 2*bw, 2*bw)
+		c.op("l", width-2*bw, 2*bw)
+		c.op("l", width-2*bw, height-2*bw)
+		c.op("f")
+	}
+	c.stroke(bc)
+	c.op("w", bw)
+	switch style {
+	case "U":
+		c.op("m", 0, bw/2)
+		c.op("l", width, bw/2)
+		c.op("S")
+		return bw
+	case "D":
+		if len(dash) == 0 {
+			dash = []float64{3}
+		}
+		writeDash(c, dash)
+	}
+	c.op("re", bw/2, bw/2, width-bw, height-bw)
+	c.op("S")
+	if style == "D" {
+		c.WriteString("[] 0 d\n")
+	}
+	if style == "B" || style == "I" {
+		return 2 * bw
+	}
+	return bw
+}
+
+func writeDash(c *contentWriter, dash []float64) {
+	parts := make([]string, len(dash))
+	for i, d := range dash {
+		parts[i] = pdfnum.Format(d, 3)
+	}
+	fmt.Fprintf(c, "[%s] 0 d\n", strings.Join(parts, " "))
+}
+
+// ellipse appends an ellipse centred on (cx, cy) to the path, as four
+// Bézier curves.
+func ellipse(c *contentWriter, cx, cy, rx, ry float64) {
+	const k = 0.551784
+	c.op("m", cx+rx, cy)
+	c.op("c", cx+rx, cy+k*ry, cx+k*rx, cy+ry, cx, cy+ry)
+	c.op("c", cx-k*rx, cy+ry, cx-rx, cy+k*ry, cx-rx, cy)
+	c.op("c", cx-rx, cy-k*ry, cx-k*rx, cy-ry, cx, cy-ry)
+	c.op("c", cx+k*rx, cy-ry, cx+rx, cy-k*ry, cx+rx, cy)
+}
+
+// appearanceBox returns the size of a field's appearance and the /Matrix
+// that turns it by the widget's MK rotation. A field rotated by 90 or 270
+// degrees lays out its appearance with the width and height of its Rect
+// swapped.
+func appearanceBox(field semantic.FormField) (width, height float64, matrix []float64) {
+	rect := field.FieldRect()
+	width, height = rect.URX-rect.LLX, rect.URY-rect.LLY
+	switch (field.GetRotation()%360 + 360) % 360 {
+	case 90:
+		return height, width, []float64{0, 1, -1, 0, 0, 0}
+	case 180:
+		return width, height, []float64{-1, 0, 0, -1, 0, 0}
+	case 270:
+		return height, width, []float64{0, -1, 1, 0, 0, 0}
+	}
+	return width, height, nil
 }
 
 func parseDA(da string) (fontName string, fontSize float64, color []float64) {
@@ -291,20 +733,3 @@ func parseDA(da string) (fontName string, fontSize float64, color []float64) {
 	}
 	return
 }
-
-func writeColor(buf *bytes.Buffer, color []float64) {
-	if len(color) == 1 {
-		buf.WriteString(fmt.Sprintf("%.2f g\n", color[0]))
-	} else if len(color) == 3 {
-		buf.WriteString(fmt.Sprintf("%.2f %.2f %.2f rg\n", color[0], color[1], color[2]))
-	} else if len(color) == 4 {
-		buf.WriteString(fmt.Sprintf("%.2f %.2f %.2f %.2f k\n", color[0], color[1], color[2], color[3]))
-	}
-}
-
-func escapeText(s string) string {
-	s = strings.ReplaceAll(s, "\\", "\\\\")
-	s = strings.ReplaceAll(s, "(", "\\(")
-	s = strings.ReplaceAll(s, ")", "\\)")
-	return s
-}
@@ -0,0 +1,607 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/wudi/pdfkit/internal/pdfnum"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// GenerateAnnotation returns the normal appearance of a markup annotation
+// as a form XObject. The appearance is drawn in default user space: its
+// BBox is the annotation's Rect, so geometry such as QuadPoints, InkList
+// and Vertices is used as is.
+func (g *AppearanceGenerator) GenerateAnnotation(a semantic.Annotation) (*semantic.XObject, error) {
+	if a == nil {
+		return nil, errors.New("annotation is nil")
+	}
+	base := a.Base()
+	rect := base.RectVal
+	if rect.URX <= rect.LLX || rect.URY <= rect.LLY {
+		return nil, fmt.Errorf("%s annotation has an empty Rect", a.Type())
+	}
+	res := &appearanceResources{g: g}
+	var c contentWriter
+	switch t := a.(type) {
+	case *semantic.SquareAnnotation:
+		drawShape(&c, base, t.IC, t.RD, false)
+	case *semantic.CircleAnnotation:
+		drawShape(&c, base, t.IC, t.RD, true)
+	case *semantic.LineAnnotation:
+		if len(t.L) != 4 {
+			return nil, errors.New("line annotation needs an L entry of 4 numbers")
+		}
+		drawPolyline(&c, base, []point{{t.L[0], t.L[1]}, {t.L[2], t.L[3]}}, t.LE, t.IC)
+	case *semantic.PolygonAnnotation:
+		pts := points(t.Vertices)
+		if len(pts) < 2 {
+			return nil, fmt.Errorf("%s annotation needs at least two vertices", a.Type())
+		}
+		if t.Type() == "PolyLine" {
+			drawPolyline(&c, base, pts, t.LE, t.IC)
+		} else {
+			drawPolygon(&c, base, pts, t.IC)
+		}
+	case *semantic.InkAnnotation:
+		drawInk(&c, base, t.InkList)
+	case *semantic.FreeTextAnnotation:
+		if g.Form != nil {
+			res.base = g.Form.DefaultResources
+		}
+		g.drawFreeText(&c, res, t)
+	case *semantic.HighlightAnnotation:
+		drawHighlight(&c, res, base, t.QuadPoints)
+	case *semantic.UnderlineAnnotation:
+		drawTextMarkup(&c, base, t.QuadPoints, underline)
+	case *semantic.StrikeOutAnnotation:
+		drawTextMarkup(&c, base, t.QuadPoints, strikeOut)
+	case *semantic.SquigglyAnnotation:
+		drawTextMarkup(&c, base, t.QuadPoints, squiggly)
+	case *semantic.StampAnnotation:
+		drawStamp(&c, res, base, t.Name)
+	case *semantic.TextAnnotation:
+		drawNote(&c, base)
+	default:
+		return nil, fmt.Errorf("unsupported annotation type for appearance generation: %s: %w", a.Type(), errors.ErrUnsupported)
+	}
+	var resources *semantic.Resources
+	if len(res.added) > 0 || len(res.gs) > 0 || res.base != nil {
+		resources = res.resources()
+	}
+	return &semantic.XObject{
+		Subtype:   "Form",
+		BBox:      rect,
+		Resources: resources,
+		Data:      c.Bytes(),
+	}, nil
+}
+
+// point is a point in default user space, also used as a vector.
+type point struct{ x, y float64 }
+
+func (p point) add(q point) point     { return point{p.x + q.x, p.y + q.y} }
+func (p point) sub(q point) point     { return point{p.x - q.x, p.y - q.y} }
+func (p point) scale(k float64) point { return point{p.x * k, p.y * k} }
+func (p point) length() float64       { return math.Hypot(p.x, p.y) }
+func (p point) perp() point           { return point{-p.y, p.x} }
+func (p point) unit() point           { return p.scale(1 / math.Max(p.length(), 1e-9)) }
+
+func (p point) rotate(rad float64) point {
+	s, c := math.Sincos(rad)
+	return point{p.x*c - p.y*s, p.x*s + p.y*c}
+}
+
+func (c *contentWriter) moveTo(p point)        { c.op("m", p.x, p.y) }
+func (c *contentWriter) lineTo(p point)        { c.op("l", p.x, p.y) }
+func (c *contentWriter) curveTo(a, b, p point) { c.op("c", a.x, a.y, b.x, b.y, p.x, p.y) }
+
+func points(coords []float64) []point {
+	pts := make([]point, 0, len(coords)/2)
+	for i := 0; i+1 < len(coords); i += 2 {
+		pts = append(pts, point{coords[i], coords[i+1]})
+	}
+	return pts
+}
+
+// annotBorderWidth returns the border width of an annotation from its BS
+// or Border entry, 1 by default.
+func annotBorderWidth(b *semantic.BaseAnnotation) float64 {
+	if b.BorderStyle != nil {
+		return b.BorderStyle.Width
+	}
+	if len(b.Border) >= 3 {
+		return b.Border[2]
+	}
+	return 1
+}
+
+// setStroke sets up stroking the border of an annotation in its C colour,
+// returning the border width and whether a border is drawn at all.
+func setStroke(c *contentWriter, b *semantic.BaseAnnotation, color []float64) (float64, bool) {
+	w := annotBorderWidth(b)
+	if w <= 0 || !c.stroke(color) {
+		return w, false
+	}
+	c.op("w", w)
+	if bs := b.BorderStyle; bs != nil && bs.Style == "D" {
+		dash := bs.Dash
+		if len(dash) == 0 {
+			dash = []float64{3}
+		}
+		writeDash(c, dash)
+	}
+	return w, true
+}
+
+// paint ends a path, filling and/or stroking it.
+func paint(c *contentWriter, fill, stroke, closed bool) {
+	switch {
+	case fill && stroke && closed:
+		c.op("b")
+	case fill && stroke:
+		c.op("B")
+	case fill:
+		c.op("f")
+	case stroke && closed:
+		c.op("s")
+	case stroke:
+		c.op("S")
+	default:
+		c.op("n")
+	}
+}
+
+// cloudIntensity returns the intensity of a cloudy border effect, or 0
+// when the annotation has none.
+func cloudIntensity(b *semantic.BaseAnnotation) float64 {
+	if b.BorderEffect == nil || b.BorderEffect.Style != "C" {
+		return 0
+	}
+	if b.BorderEffect.Intensity <= 0 {
+		return 0
+	}
+	return b.BorderEffect.Intensity
+}
+
+// cloudStep is the length of the arcs of a cloudy border.
+func cloudStep(intensity, width float64) float64 {
+	return 8*intensity + 2*width
+}
+
+// cloudBulge is how far the arcs of a cloudy border reach outside the
+// polygon they follow.
+func cloudBulge(intensity, width float64) float64 {
+	return 0.45*cloudStep(intensity, width) + width/2
+}
+
+// cloud appends a cloudy outline of the closed polygon pts to the path
+// (ISO 32000-1 §12.5.4): arcs bulging outwards, spaced evenly along the
+// polygon's edges.
+func cloud(c *contentWriter, pts []point, intensity, width float64) {
+	area := 0.0
+	for i, p := range pts {
+		q := pts[(i+1)%len(pts)]
+		area += p.x*q.y - q.x*p.y
+	}
+	if area < 0 {
+		// Walk the polygon counter-clockwise so that the right-hand side
+		// of each edge is the outside.
+		rev := make([]point, len(pts))
+		for i, p := range pts {
+			rev[len(pts)-1-i] = p
+		}
+		pts = rev
+	}
+	step := cloudStep(intensity, width)
+	var vs []point
+	for i, p := range pts {
+		d := pts[(i+1)%len(pts)].sub(p)
+		n := max(1, int(math.Round(d.length()/step)))
+		for j := 0; j < n; j++ {
+			vs = append(vs, p.add(d.scale(float64(j)/float64(n))))
+		}
+	}
+	c.moveTo(vs[0])
+	for i, a := range vs {
+		b := vs[(i+1)%len(vs)]
+		d := b.sub(a)
+		out := point{d.y, -d.x}.scale(0.6)
+		c.curveTo(a.add(out), b.add(out), b)
+	}
+	c.op("h")
+}
+
+// innerRect returns rect inset by RD, or by inset when RD is absent.
+func innerRect(rect semantic.Rectangle, rd []float64, inset float64) semantic.Rectangle {
+	if len(rd) == 4 {
+		return semantic.Rectangle{LLX: rect.LLX + rd[0], LLY: rect.LLY + rd[1], URX: rect.URX - rd[2], URY: rect.URY - rd[3]}
+	}
+	return semantic.Rectangle{LLX: rect.LLX + inset, LLY: rect.LLY + inset, URX: rect.URX - inset, URY: rect.URY - inset}
+}
+
+func corners(r semantic.Rectangle) []point {
+	return []point{{r.LLX, r.LLY}, {r.URX, r.LLY}, {r.URX, r.URY}, {r.LLX, r.URY}}
+}
+
+// drawShape draws a square or circle annotation inside its Rect less RD.
+func drawShape(c *contentWriter, b *semantic.BaseAnnotation, ic, rd []float64, circle bool) {
+	w, stroke := setStroke(c, b, b.Color)
+	fill := c.fill(ic)
+	intensity := cloudIntensity(b)
+	inset := w / 2
+	if intensity > 0 {
+		inset = cloudBulge(intensity, w)
+	}
+	r := innerRect(b.RectVal, rd, inset)
+	cx, cy := (r.LLX+r.URX)/2, (r.LLY+r.URY)/2
+	rx, ry := (r.URX-r.LLX)/2, (r.URY-r.LLY)/2
+	switch {
+	case intensity > 0 && circle:
+		pts := make([]point, 36)
+		for i := range pts {
+			s, co := math.Sincos(2 * math.Pi * float64(i) / float64(len(pts)))
+			pts[i] = point{cx + rx*co, cy + ry*s}
+		}
+		cloud(c, pts, intensity, w)
+	case intensity > 0:
+		cloud(c, corners(r), intensity, w)
+	case circle:
+		ellipse(c, cx, cy, rx, ry)
+	default:
+		c.op("re", r.LLX, r.LLY, r.URX-r.LLX, r.URY-r.LLY)
+	}
+	paint(c, fill, stroke, false)
+}
+
+// drawPolygon draws a closed polygon annotation, cloudy when its border
+// effect asks for it.
+func drawPolygon(c *contentWriter, b *semantic.BaseAnnotation, pts []point, ic []float64) {
+	w, stroke := setStroke(c, b, b.Color)
+	fill := c.fill(ic)
+	if intensity := cloudIntensity(b); intensity > 0 && len(pts) > 2 {
+		cloud(c, pts, intensity, w)
+	} else {
+		c.moveTo(pts[0])
+		for _, p := range pts[1:] {
+			c.lineTo(p)
+		}
+		c.op("h")
+	}
+	paint(c, fill, stroke, false)
+}
+
+// drawPolyline draws an open line through pts with the line endings le
+// at its first and last point; closed endings are filled with ic.
+func drawPolyline(c *contentWriter, b *semantic.BaseAnnotation, pts []point, le []string, ic []float64) {
+	w, stroke := setStroke(c, b, b.Color)
+	if !stroke {
+		return
+	}
+	c.moveTo(pts[0])
+	for _, p := range pts[1:] {
+		c.lineTo(p)
+	}
+	c.op("S")
+	if len(le) == 2 {
+		// Endings are drawn solid even on dashed lines.
+		c.WriteString("[] 0 d\n")
+		n := len(pts)
+		lineEnding(c, le[0], pts[0], pts[0].sub(pts[1]), w, ic)
+		lineEnding(c, le[1], pts[n-1], pts[n-1].sub(pts[n-2]), w, ic)
+	}
+}
+
+// lineEnding draws a line ending of the given style at tip, with dir
+// pointing away from the line.
+func lineEnding(c *contentWriter, style string, tip, dir point, width float64, ic []float64) {
+	s := 3*width + 4
+	d := dir.unit()
+	n := d.perp()
+	closed := false
+	switch style {
+	case "OpenArrow", "ClosedArrow":
+		c.moveTo(tip.sub(d.rotate(math.Pi / 6).scale(s)))
+		c.lineTo(tip)
+		c.lineTo(tip.sub(d.rotate(-math.Pi / 6).scale(s)))
+		closed = style == "ClosedArrow"
+	case "ROpenArrow", "RClosedArrow":
+		back := tip.sub(d.scale(s * math.Cos(math.Pi/6)))
+		c.moveTo(tip.add(n.scale(s / 2)))
+		c.lineTo(back)
+		c.lineTo(tip.sub(n.scale(s / 2)))
+		closed = style == "RClosedArrow"
+	case "Square":
+		h := s / 2
+		c.moveTo(tip.add(d.scale(h)).add(n.scale(h)))
+		c.lineTo(tip.sub(d.scale(h)).add(n.scale(h)))
+		c.lineTo(tip.sub(d.scale(h)).sub(n.scale(h)))
+		c.lineTo(tip.add(d.scale(h)).sub(n.scale(h)))
+		closed = true
+	case "Diamond":
+		h := s / 2
+		c.moveTo(tip.add(d.scale(h)))
+		c.lineTo(tip.add(n.scale(h)))
+		c.lineTo(tip.sub(d.scale(h)))
+		c.lineTo(tip.sub(n.scale(h)))
+		closed = true
+	case "Circle":
+		ellipse(c, tip.x, tip.y, s/2, s/2)
+		closed = true
+	case "Butt":
+		c.moveTo(tip.add(n.scale(s / 2)))
+		c.lineTo(tip.sub(n.scale(s / 2)))
+	case "Slash":
+		v := d.rotate(math.Pi / 3).scale(s / 2)
+		c.moveTo(tip.add(v))
+		c.lineTo(tip.sub(v))
+	default:
+		return
+	}
+	if closed {
+		fill := c.fill(ic)
+		paint(c, fill, true, true)
+		return
+	}
+	c.op("S")
+}
+
+// drawInk draws the strokes of an ink annotation with round joins and
+// caps.
+func drawInk(c *contentWriter, b *semantic.BaseAnnotation, ink [][]float64) {
+	if _, stroke := setStroke(c, b, b.Color); !stroke {
+		return
+	}
+	c.WriteString("1 J\n1 j\n")
+	for _, path := range ink {
+		pts := points(path)
+		if len(pts) == 0 {
+			continue
+		}
+		c.moveTo(pts[0])
+		if len(pts) == 1 {
+			c.lineTo(pts[0])
+		}
+		for _, p := range pts[1:] {
+			c.lineTo(p)
+		}
+	}
+	c.op("S")
+}
+
+// drawFreeText draws a free text annotation: its text box, filled with C
+// and bordered in the text colour, the text wrapped inside it, and its
+// callout line.
+func (g *AppearanceGenerator) drawFreeText(c *contentWriter, res *appearanceResources, a *semantic.FreeTextAnnotation) {
+	style := g.fieldStyle(res, a.DA)
+	if style.size == 0 {
+		style.size = 12
+	}
+	color := style.color
+	if len(color) == 0 {
+		color = []float64{0}
+	}
+	typewriter := a.IT == "FreeTextTypeWriter"
+	box := innerRect(a.RectVal, a.RD, 0)
+	w := 0.0
+	stroke := false
+	if !typewriter {
+		w, stroke = setStroke(c, &a.BaseAnnotation, color)
+	}
+	intensity := cloudIntensity(&a.BaseAnnotation)
+	if intensity > 0 && len(a.RD) != 4 {
+		box = innerRect(box, nil, cloudBulge(intensity, w))
+	}
+	fill := !typewriter && c.fill(a.Color)
+	if fill || stroke {
+		if intensity > 0 {
+			cloud(c, corners(box), intensity, w)
+		} else {
+			c.op("re", box.LLX+w/2, box.LLY+w/2, box.URX-box.LLX-w, box.URY-box.LLY-w)
+		}
+		paint(c, fill, stroke, false)
+	}
+	if pts := points(a.CL); len(pts) >= 2 && stroke {
+		c.moveTo(pts[0])
+		for _, p := range pts[1:] {
+			c.lineTo(p)
+		}
+		c.op("S")
+		c.WriteString("[] 0 d\n")
+		lineEnding(c, a.LE, pts[0], pts[0].sub(pts[1]), w, a.Color)
+	}
+
+	pad := w + textPadding
+	width := box.URX - box.LLX - 2*pad
+	var paras []richParagraph
+	if a.RichContents != "" {
+		paras = parseRichText(a.RichContents)
+	} else {
+		for _, line := range strings.Split(strings.ReplaceAll(a.Contents, "\r\n", "\n"), "\n") {
+			paras = append(paras, richParagraph{Runs: []richRun{{Text: line}}, Align: -1})
+		}
+	}
+	lines := layoutRich(res, paras, style.font, style.size, color, width, true)
+	c.WriteString("q\n")
+	c.op("re", box.LLX+w, box.LLY+w, box.URX-box.LLX-2*w, box.URY-box.LLY-2*w)
+	c.WriteString("W n\n")
+	writeRich(c, lines, box.LLX+pad, box.URY-pad, width, a.Q)
+	c.WriteString("Q\n")
+}
+
+// quads returns the quadrilaterals of a text markup annotation as their
+// upper left, upper right, lower left and lower right corners, the order
+// used by Acrobat. Without QuadPoints the Rect is the only quadrilateral.
+func quads(b *semantic.BaseAnnotation, qp []float64) [][4]point {
+	var qs [][4]point
+	for i := 0; i+7 < len(qp); i += 8 {
+		qs = append(qs, [4]point{{qp[i], qp[i+1]}, {qp[i+2], qp[i+3]}, {qp[i+4], qp[i+5]}, {qp[i+6], qp[i+7]}})
+	}
+	if len(qs) == 0 {
+		r := b.RectVal
+		qs = append(qs, [4]point{{r.LLX, r.URY}, {r.URX, r.URY}, {r.LLX, r.LLY}, {r.URX, r.LLY}})
+	}
+	return qs
+}
+
+// drawHighlight fills the quadrilaterals of a highlight annotation with its
+// colour, multiplied with the text below.
+func drawHighlight(c *contentWriter, res *appearanceResources, b *semantic.BaseAnnotation, qp []float64) {
+	color := b.Color
+	if len(color) == 0 {
+		color = []float64{1, 1, 0}
+	}
+	gs := res.extGState("GSHighlight", semantic.ExtGState{BlendMode: "Multiply"})
+	fmt.Fprintf(c, "/%s gs\n", gs)
+	c.fill(color)
+	for _, q := range quads(b, qp) {
+		c.moveTo(q[0])
+		c.lineTo(q[1])
+		c.lineTo(q[3])
+		c.lineTo(q[2])
+		c.op("h")
+	}
+	c.op("f")
+}
+
+type markup int
+
+const (
+	underline markup = iota
+	strikeOut
+	squiggly
+)
+
+// drawTextMarkup draws the lines of underline, strikeout and squiggly
+// annotations, with a thickness proportional to the height of each
+// quadrilateral.
+func drawTextMarkup(c *contentWriter, b *semantic.BaseAnnotation, qp []float64, kind markup) {
+	color := b.Color
+	if len(color) == 0 {
+		color = []float64{0}
+	}
+	c.stroke(color)
+	for _, q := range quads(b, qp) {
+		up := q[0].sub(q[2])
+		h := up.length()
+		if h == 0 {
+			continue
+		}
+		t := max(h/14, 0.5)
+		c.op("w", t)
+		u := up.unit()
+		switch kind {
+		case underline:
+			c.moveTo(q[2].add(u.scale(t)))
+			c.lineTo(q[3].add(u.scale(t)))
+		case strikeOut:
+			c.moveTo(q[2].add(up.scale(0.5)))
+			c.lineTo(q[3].add(up.scale(0.5)))
+		case squiggly:
+			along := q[3].sub(q[2])
+			period := h / 3
+			n := max(1, int(along.length()/(period/2)))
+			step := along.scale(1 / float64(n))
+			amp := u.scale(h / 8)
+			start := q[2].add(u.scale(t))
+			c.moveTo(start)
+			for i := 1; i <= n; i++ {
+				p := start.add(step.scale(float64(i)))
+				if i%2 == 1 {
+					p = p.add(amp)
+				}
+				c.lineTo(p)
+			}
+		}
+		c.op("S")
+	}
+}
+
+// stampLabel turns a stamp name such as NotApproved into the text it
+// shows, NOT APPROVED.
+func stampLabel(name string) string {
+	name = strings.TrimLeft(name, "#")
+	if name == "" {
+		name = "Draft"
+	}
+	var b strings.Builder
+	prev := ' '
+	for _, r := range name {
+		if unicode.IsUpper(r) && prev != ' ' && !unicode.IsUpper(prev) {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+		prev = r
+	}
+	return b.String()
+}
+
+// drawStamp draws the name of a stamp annotation in bold capitals inside a
+// rounded frame.
+func drawStamp(c *contentWriter, res *appearanceResources, b *semantic.BaseAnnotation, name string) {
+	color := b.Color
+	if len(color) == 0 {
+		color = []float64{0.8, 0.1, 0.1}
+	}
+	r := b.RectVal
+	w, h := r.URX-r.LLX, r.URY-r.LLY
+	lw := max(min(w, h)/20, 1)
+	radius := min(w, h) / 5
+	c.stroke(color)
+	c.op("w", lw)
+	roundedRect(c, r.LLX+lw/2, r.LLY+lw/2, w-lw, h-lw, radius)
+	c.op("S")
+
+	label := stampLabel(name)
+	font := res.font("HeBo")
+	pad := lw + radius/2
+	size := autoSize(font, label, w-2*pad, h-2*pad)
+	ascent, descent := font.metrics()
+	tw := font.measure(label, size)
+	c.WriteString("BT\n")
+	fmt.Fprintf(c, "/%s %s Tf\n", font.name, pdfnum.Format(size, 3))
+	c.fill(color)
+	c.op("Td", r.LLX+(w-tw)/2, r.LLY+(h-(ascent-descent)*size)/2-descent*size)
+	fmt.Fprintf(c, "%s Tj\n", font.encode(label))
+	c.WriteString("ET\n")
+}
+
+func roundedRect(c *contentWriter, x, y, w, h, r float64) {
+	const k = 0.551784
+	r = min(r, min(w, h)/2)
+	c.op("m", x+r, y)
+	c.op("l", x+w-r, y)
+	c.op("c", x+w-r+k*r, y, x+w, y+r-k*r, x+w, y+r)
+	c.op("l", x+w, y+h-r)
+	c.op("c", x+w, y+h-r+k*r, x+w-r+k*r, y+h, x+w-r, y+h)
+	c.op("l", x+r, y+h)
+	c.op("c", x+r-k*r, y+h, x, y+h-r+k*r, x, y+h-r)
+	c.op("l", x, y+r)
+	c.op("c", x, y+r-k*r, x+r-k*r, y, x+r, y)
+	c.op("h")
+}
+
+// drawNote draws the icon of a text (sticky note) annotation: a note
+// filled with its colour with lines of text.
+func drawNote(c *contentWriter, b *semantic.BaseAnnotation) {
+	color := b.Color
+	if len(color) == 0 {
+		color = []float64{1, 0.82, 0}
+	}
+	r := b.RectVal
+	w, h := r.URX-r.LLX, r.URY-r.LLY
+	c.fill(color)
+	c.WriteString("0.3 G\n")
+	c.op("w", 0.5)
+	roundedRect(c, r.LLX+0.5, r.LLY+0.5, w-1, h-1, min(w, h)/8)
+	c.op("B")
+	for i := 1; i <= 3; i++ {
+		y := r.URY - h*float64(i)/4.5
+		c.op("m", r.LLX+w/5, y)
+		c.op("l", r.URX-w/5, y)
+	}
+	c.op("S")
+}
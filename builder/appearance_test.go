@@ -1,6 +1,7 @@
 package builder
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -148,3 +149,201 @@ func TestMeasureText(t *testing.T) {
 		t.Errorf("Expected fallback width 15.0, got %f", width)
 	}
 }
+
+func TestGenerateTextFieldVariants(t *testing.T) {
+	generator := NewAppearanceGenerator(&semantic.AcroForm{DefaultResources: &semantic.Resources{}})
+	box := semantic.Rectangle{LLX: 0, LLY: 0, URX: 100, URY: 40}
+	text := func(flags int, value string) *semantic.TextFormField {
+		return &semantic.TextFormField{
+			BaseFormField: semantic.BaseFormField{Rect: box, Flags: flags, DefaultAppearance: "/Helv 0 Tf 0 0 1 rg"},
+			Value:         value,
+		}
+	}
+	generate := func(f semantic.FormField) *semantic.XObject {
+		t.Helper()
+		xo, err := generator.Generate(f)
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		return xo
+	}
+
+	multi := generate(text(semantic.FieldFlagMultiline, "The quick brown fox jumps over the lazy dog twice"))
+	if lines := strings.Count(string(multi.Data), " Tm\n"); lines < 2 {
+		t.Errorf("expected wrapped lines, got %s", multi.Data)
+	}
+	if strings.Contains(string(multi.Data), "/Helv 0 Tf") || !strings.Contains(string(multi.Data), "0 0 1 rg") {
+		t.Errorf("expected automatic size and DA colour, got %s", multi.Data)
+	}
+	if multi.Resources == nil || multi.Resources.Fonts["Helv"] == nil || multi.Resources.Fonts["Helv"].BaseFont != "Helvetica" {
+		t.Errorf("expected standard font in resources, got %+v", multi.Resources)
+	}
+
+	password := generate(text(semantic.FieldFlagPassword, "secret"))
+	if !strings.Contains(string(password.Data), "(******) Tj") {
+		t.Errorf("expected masked password, got %s", password.Data)
+	}
+
+	combField := text(semantic.FieldFlagComb, "1234")
+	combField.MaxLen = 5
+	combField.BorderColor = []float64{0}
+	comb := string(generate(combField).Data)
+	if strings.Count(comb, " Tm\n") != 4 || !strings.Contains(comb, "20 1 m") || !strings.Contains(comb, "80 1 m") {
+		t.Errorf("expected four characters in five cells, got %s", comb)
+	}
+
+	richField := text(semantic.FieldFlagRichText, "Plain bold")
+	richField.RichValue = `<body xmlns="http://www.w3.org/1999/xhtml"><p>Plain <b>bold</b> <span style="color:#FF0000">red</span></p></body>`
+	rich := generate(richField)
+	for _, want := range []string{"/HeBo ", "(bold ) Tj", "1 0 0 rg", "(red) Tj"} {
+		if !strings.Contains(string(rich.Data), want) {
+			t.Errorf("rich text lacks %q: %s", want, rich.Data)
+		}
+	}
+	if rich.Resources.Fonts["HeBo"] == nil || generator.Form.DefaultResources.Fonts != nil {
+		t.Errorf("expected bold font added to the appearance only, got %+v", rich.Resources)
+	}
+}
+
+func TestGenerateChoiceAppearance(t *testing.T) {
+	generator := NewAppearanceGenerator(&semantic.AcroForm{})
+	combo := &semantic.ChoiceFormField{
+		BaseFormField: semantic.BaseFormField{Rect: semantic.Rectangle{URX: 80, URY: 20}, DefaultAppearance: "/Helv 10 Tf 0 g"},
+		Options:       []string{"Red", "Green"},
+		Selected:      []string{"Green"},
+		IsCombo:       true,
+	}
+	xo, err := generator.Generate(combo)
+	if err != nil || !strings.Contains(string(xo.Data), "(Green) Tj") {
+		t.Fatalf("combo box appearance = %s, %v", xo.Data, err)
+	}
+
+	list := &semantic.ChoiceFormField{
+		BaseFormField: semantic.BaseFormField{Rect: semantic.Rectangle{URX: 80, URY: 60}, DefaultAppearance: "/Helv 10 Tf 0 g"},
+		Options:       []string{"A", "B", "C", "D", "E", "F"},
+		Selected:      []string{"F"},
+	}
+	xo, err = generator.Generate(list)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	content := string(xo.Data)
+	// Five rows fit; the list scrolls to show the selection.
+	if strings.Contains(content, "(A) Tj") || !strings.Contains(content, "(B) Tj") || !strings.Contains(content, "(F) Tj") {
+		t.Errorf("expected rows B to F, got %s", content)
+	}
+	if !strings.Contains(content, "0.6 0.75 0.85 rg") {
+		t.Errorf("expected highlighted selection, got %s", content)
+	}
+}
+
+func TestGenerateWidgetFrame(t *testing.T) {
+	generator := NewAppearanceGenerator(&semantic.AcroForm{})
+	field := &semantic.TextFormField{BaseFormField: semantic.BaseFormField{
+		Rect:            semantic.Rectangle{URX: 100, URY: 20},
+		BorderColor:     []float64{1, 0, 0},
+		BackgroundColor: []float64{0.9},
+		BorderStyle:     &semantic.BorderStyle{Width: 2, Style: "D", Dash: []float64{4, 2}},
+	}}
+	xo, _ := generator.Generate(field)
+	content := string(xo.Data)
+	for _, want := range []string{"0.9 g\n0 0 100 20 re\nf", "1 0 0 RG", "2 w", "[4 2] 0 d", "1 1 98 18 re\nS", "3 3 94 14 re\nW n"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("frame lacks %q: %s", want, content)
+		}
+	}
+
+	field.BorderStyle = &semantic.BorderStyle{Width: 1, Style: "B"}
+	xo, _ = generator.Generate(field)
+	if content := string(xo.Data); !strings.Contains(content, "0.45 g") || !strings.Contains(content, "3 3 94 14 re\nW n") {
+		t.Errorf("expected beveled border, got %s", content)
+	}
+
+	check := &semantic.ButtonFormField{
+		BaseFormField: semantic.BaseFormField{Rect: semantic.Rectangle{URX: 20, URY: 20}, BorderColor: []float64{0}, DefaultAppearance: "/ZaDb 0 Tf 0 g"},
+		IsCheck:       true,
+		Checked:       true,
+		Caption:       "4",
+	}
+	xo, _ = generator.Generate(check)
+	if content := string(xo.Data); !strings.Contains(content, "/ZaDb 14.4 Tf") || !strings.Contains(content, "(4) Tj") {
+		t.Errorf("expected check mark glyph, got %s", content)
+	}
+}
+
+func TestGenerateAnnotationAppearances(t *testing.T) {
+	generator := NewAppearanceGenerator(nil)
+	rect := semantic.Rectangle{LLX: 100, LLY: 100, URX: 200, URY: 160}
+	base := func(subtype string) semantic.BaseAnnotation {
+		return semantic.BaseAnnotation{Subtype: subtype, RectVal: rect, Color: []float64{1, 0, 0}}
+	}
+	cloudy := base("Square")
+	cloudy.BorderEffect = &semantic.BorderEffect{Style: "C", Intensity: 1}
+	freeText := base("FreeText")
+	freeText.Contents = "Note text"
+	freeText.Color = []float64{1, 1, 0.8}
+	tests := []struct {
+		annot semantic.Annotation
+		want  []string
+	}{
+		{&semantic.SquareAnnotation{BaseAnnotation: base("Square"), IC: []float64{0, 0, 1}}, []string{"1 0 0 RG", "0 0 1 rg", "100.5 100.5 99 59 re", "B"}},
+		{&semantic.SquareAnnotation{BaseAnnotation: cloudy}, []string{" c\n", "h\nS"}},
+		{&semantic.CircleAnnotation{BaseAnnotation: base("Circle")}, []string{" c\n", "S"}},
+		{&semantic.LineAnnotation{BaseAnnotation: base("Line"), L: []float64{110, 130, 190, 130}, LE: []string{"None", "ClosedArrow"}, IC: []float64{0}},
+			[]string{"110 130 m\n190 130 l\nS", "190 130 l", "b"}},
+		{&semantic.PolygonAnnotation{BaseAnnotation: base("Polygon"), Vertices: []float64{110, 110, 190, 110, 150, 150}}, []string{"110 110 m", "h\nS"}},
+		{&semantic.PolygonAnnotation{BaseAnnotation: base("PolyLine"), Vertices: []float64{110, 110, 190, 110, 150, 150}, LE: []string{"Circle", "None"}}, []string{"150 150 l\nS", " c\n"}},
+		{&semantic.InkAnnotation{BaseAnnotation: base("Ink"), InkList: [][]float64{{110, 110, 120, 130}}}, []string{"1 J", "110 110 m\n120 130 l"}},
+		{&semantic.FreeTextAnnotation{BaseAnnotation: freeText, DA: "/Helv 10 Tf 0 0 1 rg", CL: []float64{50, 50, 80, 80, 100, 80}, LE: "OpenArrow"},
+			[]string{"1 1 0.8 rg", "0 0 1 RG", "50 50 m\n80 80 l\n100 80 l", "(Note text) Tj"}},
+		{&semantic.HighlightAnnotation{BaseAnnotation: base("Highlight"), QuadPoints: []float64{100, 160, 200, 160, 100, 100, 200, 100}},
+			[]string{"/GSHighlight gs", "100 160 m\n200 160 l\n200 100 l\n100 100 l\nh"}},
+		{&semantic.UnderlineAnnotation{BaseAnnotation: base("Underline")}, []string{"100 104.286 m\n200 104.286 l\nS"}},
+		{&semantic.StrikeOutAnnotation{BaseAnnotation: base("StrikeOut")}, []string{"100 130 m\n200 130 l\nS"}},
+		{&semantic.SquigglyAnnotation{BaseAnnotation: base("Squiggly")}, []string{"100 104.286 m"}},
+		{&semantic.StampAnnotation{BaseAnnotation: base("Stamp"), Name: "NotApproved"}, []string{"(NOT APPROVED) Tj", "/HeBo "}},
+		{&semantic.TextAnnotation{BaseAnnotation: base("Text")}, []string{"1 0 0 rg", "B"}},
+	}
+	for _, tt := range tests {
+		xo, err := generator.GenerateAnnotation(tt.annot)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.annot.Type(), err)
+		}
+		if xo.BBox != rect {
+			t.Errorf("%s: BBox = %+v", tt.annot.Type(), xo.BBox)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(string(xo.Data), want) {
+				t.Errorf("%s: appearance lacks %q:\n%s", tt.annot.Type(), want, xo.Data)
+			}
+		}
+	}
+
+	xo, _ := generator.GenerateAnnotation(&semantic.HighlightAnnotation{BaseAnnotation: base("Highlight")})
+	if xo.Resources == nil || xo.Resources.ExtGStates["GSHighlight"].BlendMode != "Multiply" {
+		t.Errorf("highlight resources = %+v", xo.Resources)
+	}
+	if _, err := generator.GenerateAnnotation(&semantic.LinkAnnotation{BaseAnnotation: base("Link")}); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("expected unsupported error for links, got %v", err)
+	}
+}
+
+func TestGenerateAppearances(t *testing.T) {
+	name := &semantic.TextFormField{BaseFormField: semantic.BaseFormField{Name: "Name", Rect: semantic.Rectangle{URX: 100, URY: 20}}, Value: "Jane"}
+	sig := &semantic.GenericFormField{BaseFormField: semantic.BaseFormField{Name: "Other"}}
+	stored := &semantic.TextAnnotation{BaseAnnotation: semantic.BaseAnnotation{Subtype: "Text", RectVal: semantic.Rectangle{URX: 20, URY: 20}, Appearance: []byte("0 g")}}
+	ink := &semantic.InkAnnotation{BaseAnnotation: semantic.BaseAnnotation{Subtype: "Ink", RectVal: semantic.Rectangle{URX: 20, URY: 20}, Color: []float64{0}}, InkList: [][]float64{{1, 1, 5, 5}}}
+	doc := &semantic.Document{
+		Pages:    []*semantic.Page{{Annotations: []semantic.Annotation{stored, ink}}},
+		AcroForm: &semantic.AcroForm{NeedAppearances: true, Fields: []semantic.FormField{name, sig}},
+	}
+	if err := GenerateAppearances(doc); err != nil {
+		t.Fatalf("GenerateAppearances: %v", err)
+	}
+	if doc.AcroForm.NeedAppearances || name.AppearanceForm == nil || !strings.Contains(string(name.AppearanceForm.Data), "(Jane) Tj") {
+		t.Fatalf("field appearance = %+v", name.AppearanceForm)
+	}
+	if sig.AppearanceForm != nil || stored.AppearanceForm != nil || ink.AppearanceForm == nil {
+		t.Fatalf("unexpected appearances: generic %v, stored %v, ink %v", sig.AppearanceForm, stored.AppearanceForm, ink.AppearanceForm)
+	}
+}
@@ -0,0 +1,750 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/wudi/pdfkit/internal/pdfnum"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// contentWriter accumulates the operators of an appearance stream.
+type contentWriter struct {
+	bytes.Buffer
+}
+
+// op writes operands followed by operator on a line of their own.
+func (c *contentWriter) op(operator string, operands ...float64) {
+	for _, v := range operands {
+		c.WriteString(pdfnum.Format(v, 3))
+		c.WriteByte(' ')
+	}
+	c.WriteString(operator)
+	c.WriteByte('\n')
+}
+
+// fill and stroke set the non-stroking and stroking colour from a colour
+// array of 1 (gray), 3 (RGB) or 4 (CMYK) components. They report false
+// for an empty (transparent) colour.
+func (c *contentWriter) fill(color []float64) bool {
+	return c.color(color, "g", "rg", "k")
+}
+
+func (c *contentWriter) stroke(color []float64) bool {
+	return c.color(color, "G", "RG", "K")
+}
+
+func (c *contentWriter) color(color []float64, gray, rgb, cmyk string) bool {
+	switch len(color) {
+	case 1:
+		c.op(gray, color...)
+	case 3:
+		c.op(rgb, color...)
+	case 4:
+		c.op(cmyk, color...)
+	default:
+		return false
+	}
+	return true
+}
+
+// standardFonts maps the resource names Acrobat uses for the standard 14
+// fonts in form resources to their base font names.
+var standardFonts = map[string]string{
+	"Helv": "Helvetica",
+	"HeBo": "Helvetica-Bold",
+	"HeOb": "Helvetica-Oblique",
+	"HeBO": "Helvetica-BoldOblique",
+	"Cour": "Courier",
+	"CoBo": "Courier-Bold",
+	"CoOb": "Courier-Oblique",
+	"CoBO": "Courier-BoldOblique",
+	"TiRo": "Times-Roman",
+	"TiBo": "Times-Bold",
+	"TiIt": "Times-Italic",
+	"TiBI": "Times-BoldItalic",
+	"Symb": "Symbol",
+	"ZaDb": "ZapfDingbats",
+}
+
+// styledFonts lists the resource names of a standard font family by style:
+// regular, bold, italic and bold italic.
+var styledFonts = map[string][4]string{
+	"Helvetica": {"Helv", "HeBo", "HeOb", "HeBO"},
+	"Courier":   {"Cour", "CoBo", "CoOb", "CoBO"},
+	"Times":     {"TiRo", "TiBo", "TiIt", "TiBI"},
+}
+
+// helveticaWidths holds the advance widths of Helvetica for the printable
+// ASCII characters, from its AFM file.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// standardWidth approximates the width of r in a standard font without
+// width information: Courier is monospaced and the proportional fonts use
+// the Helvetica metrics.
+func standardWidth(baseFont string, r rune) float64 {
+	switch {
+	case strings.HasPrefix(baseFont, "Courier"):
+		return 600
+	case baseFont == "ZapfDingbats":
+		return 788
+	case r >= 32 && r < 127:
+		return float64(helveticaWidths[r-32])
+	}
+	return 556
+}
+
+// textFont is a font of an appearance stream together with the metrics
+// used to lay out text in it.
+type textFont struct {
+	name  string         // resource name
+	font  *semantic.Font // nil for a standard font missing from the resources
+	base  string         // base font name of a standard font
+	codes map[rune]int   // character codes by Unicode value, from ToUnicode
+}
+
+func (f *textFont) cid() bool {
+	return f.font != nil && f.font.Subtype == "Type0"
+}
+
+// code returns the character code that shows r.
+func (f *textFont) code(r rune) (int, bool) {
+	if c, ok := f.codes[r]; ok {
+		return c, true
+	}
+	if !f.cid() && r < 256 {
+		return int(r), true
+	}
+	return 0, false
+}
+
+// width returns the advance width of r in thousandths of an em.
+func (f *textFont) width(r rune) float64 {
+	if f.font == nil {
+		if f.base == "" {
+			return 500
+		}
+		return standardWidth(f.base, r)
+	}
+	code, _ := f.code(r)
+	if d := f.font.DescendantFont; d != nil {
+		if w, ok := d.W[code]; ok {
+			return float64(w)
+		}
+		if d.DW != 0 {
+			return float64(d.DW)
+		}
+		return 1000
+	}
+	if len(f.font.Widths) == 0 {
+		return standardWidth(f.font.BaseFont, r)
+	}
+	if w, ok := f.font.Widths[code]; ok {
+		return float64(w)
+	}
+	return 500
+}
+
+// measure returns the width of s at size.
+func (f *textFont) measure(s string, size float64) float64 {
+	w := 0.0
+	for _, r := range s {
+		w += f.width(r)
+	}
+	return w / 1000 * size
+}
+
+// metrics returns the ascent and descent of the font as fractions of the
+// font size.
+func (f *textFont) metrics() (ascent, descent float64) {
+	if f.font != nil && f.font.Descriptor != nil && f.font.Descriptor.Ascent != 0 {
+		return f.font.Descriptor.Ascent / 1000, f.font.Descriptor.Descent / 1000
+	}
+	return 0.718, -0.207
+}
+
+// encode returns s as a string operand of a text-showing operator: a hex
+// string of two-byte codes for composite fonts and a literal string of
+// single-byte codes otherwise. Characters the font cannot show are
+// replaced.
+func (f *textFont) encode(s string) string {
+	if f.cid() {
+		buf := make([]byte, 0, 2*len(s))
+		for _, r := range s {
+			c, _ := f.code(r)
+			buf = append(buf, byte(c>>8), byte(c))
+		}
+		return "<" + strings.ToUpper(hex.EncodeToString(buf)) + ">"
+	}
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range s {
+		c, ok := f.code(r)
+		if !ok || c > 255 {
+			c = '?'
+		}
+		switch c {
+		case '\\', '(', ')':
+			b.WriteByte('\\')
+			b.WriteByte(byte(c))
+		case '\r':
+			b.WriteString(`\r`)
+		case '\n':
+			b.WriteString(`\n`)
+		default:
+			b.WriteByte(byte(c))
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// appearanceResources collects the resources of one appearance stream:
+// the form's default resources plus the standard fonts the appearance uses
+// that they lack.
+type appearanceResources struct {
+	g     *AppearanceGenerator
+	base  *semantic.Resources
+	added map[string]*semantic.Font
+	gs    map[string]semantic.ExtGState
+}
+
+func (g *AppearanceGenerator) newResources() *appearanceResources {
+	r := &appearanceResources{g: g}
+	if g.Form != nil {
+		r.base = g.Form.DefaultResources
+	}
+	return r
+}
+
+func (r *appearanceResources) lookup(name string) *semantic.Font {
+	if r.base != nil && r.base.Fonts[name] != nil {
+		return r.base.Fonts[name]
+	}
+	return r.added[name]
+}
+
+// font returns the font with the resource name, adding a standard font to
+// the resources when the name is one of Acrobat's standard font names.
+// Unknown names fall back to Helvetica.
+func (r *appearanceResources) font(name string) *textFont {
+	if name == "" {
+		name = "Helv"
+	}
+	if f := r.lookup(name); f != nil {
+		return r.g.textFont(name, f)
+	}
+	base, ok := standardFonts[name]
+	if !ok {
+		name, base = "Helv", standardFonts["Helv"]
+		if f := r.lookup(name); f != nil {
+			return r.g.textFont(name, f)
+		}
+	}
+	if r.added == nil {
+		r.added = make(map[string]*semantic.Font)
+	}
+	f := &semantic.Font{Subtype: "Type1", BaseFont: base}
+	if base != "Symbol" && base != "ZapfDingbats" {
+		f.Encoding = "WinAnsiEncoding"
+	}
+	r.added[name] = f
+	return r.g.textFont(name, f)
+}
+
+// styled returns the bold and/or italic variant of f: a font of the same
+// family in the resources, or the matching standard font.
+func (r *appearanceResources) styled(f *textFont, bold, italic bool) *textFont {
+	if !bold && !italic {
+		return f
+	}
+	base := f.base
+	if f.font != nil {
+		base = f.font.BaseFont
+	}
+	family := base
+	if i := strings.IndexAny(family, "-,"); i > 0 {
+		family = family[:i]
+	}
+	if r.base != nil {
+		for name, font := range r.base.Fonts {
+			if font == nil || !strings.HasPrefix(font.BaseFont, family) {
+				continue
+			}
+			fb := strings.Contains(font.BaseFont, "Bold")
+			fi := strings.Contains(font.BaseFont, "Italic") || strings.Contains(font.BaseFont, "Oblique")
+			if fb == bold && fi == italic {
+				return r.g.textFont(name, font)
+			}
+		}
+	}
+	names, ok := styledFonts[family]
+	if !ok {
+		if strings.Contains(family, "Times") || strings.Contains(family, "Serif") {
+			names = styledFonts["Times"]
+		} else {
+			names = styledFonts["Helvetica"]
+		}
+	}
+	i := 0
+	if bold {
+		i++
+	}
+	if italic {
+		i += 2
+	}
+	return r.font(names[i])
+}
+
+// extGState registers a graphics state parameter dictionary and returns
+// its resource name.
+func (r *appearanceResources) extGState(name string, gs semantic.ExtGState) string {
+	if r.gs == nil {
+		r.gs = make(map[string]semantic.ExtGState)
+	}
+	r.gs[name] = gs
+	return name
+}
+
+// resources returns the resource dictionary of the appearance stream.
+func (r *appearanceResources) resources() *semantic.Resources {
+	if len(r.added) == 0 && len(r.gs) == 0 {
+		return r.base
+	}
+	res := &semantic.Resources{Fonts: make(map[string]*semantic.Font)}
+	if r.base != nil {
+		copied := *r.base
+		res = &copied
+		res.Fonts = make(map[string]*semantic.Font, len(r.base.Fonts)+len(r.added))
+		for name, f := range r.base.Fonts {
+			res.Fonts[name] = f
+		}
+	}
+	for name, f := range r.added {
+		res.Fonts[name] = f
+	}
+	if len(r.gs) > 0 {
+		gs := make(map[string]semantic.ExtGState, len(res.ExtGStates)+len(r.gs))
+		for name, s := range res.ExtGStates {
+			gs[name] = s
+		}
+		for name, s := range r.gs {
+			gs[name] = s
+		}
+		res.ExtGStates = gs
+	}
+	return res
+}
+
+// textFont wraps a font for layout, caching the reverse ToUnicode map.
+func (g *AppearanceGenerator) textFont(name string, font *semantic.Font) *textFont {
+	tf := &textFont{name: name, font: font, base: font.BaseFont}
+	if len(font.ToUnicode) == 0 {
+		return tf
+	}
+	if g.codes == nil {
+		g.codes = make(map[*semantic.Font]map[rune]int)
+	}
+	codes, ok := g.codes[font]
+	if !ok {
+		codes = make(map[rune]int, len(font.ToUnicode))
+		for code, runes := range font.ToUnicode {
+			if len(runes) != 1 {
+				continue
+			}
+			// Prefer the lowest code when several show the same character.
+			if c, seen := codes[runes[0]]; !seen || code < c {
+				codes[runes[0]] = code
+			}
+		}
+		g.codes[font] = codes
+	}
+	tf.codes = codes
+	return tf
+}
+
+// wrapText breaks text into lines no wider than width. Line breaks in the
+// text are kept; words wider than a line are broken between characters.
+func wrapText(text string, width float64, measure func(string) float64) []string {
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+	var lines []string
+	for _, para := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if measure(candidate) <= width || (line == "" && len([]rune(word)) == 1) {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			for measure(word) > width && len([]rune(word)) > 1 {
+				runes := []rune(word)
+				n := 1
+				for n < len(runes) && measure(string(runes[:n+1])) <= width {
+					n++
+				}
+				lines = append(lines, string(runes[:n]))
+				word = string(runes[n:])
+			}
+			line = word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// textStyle is the character style of a run of rich text.
+type textStyle struct {
+	Bold   bool
+	Italic bool
+	Size   float64   // 0 for the default size
+	Color  []float64 // nil for the default colour
+}
+
+// richRun is a run of rich text with a single style.
+type richRun struct {
+	Text string
+	textStyle
+}
+
+// richParagraph is a paragraph of rich text.
+type richParagraph struct {
+	Runs  []richRun
+	Align int // -1 when the paragraph sets no alignment, else a Q value
+}
+
+// parseRichText parses the XHTML subset used by rich text strings (ISO
+// 32000-1 §12.7.3.4): paragraphs, line breaks, bold and italic elements and
+// the font-weight, font-style, font-size, color and text-align properties.
+func parseRichText(s string) []richParagraph {
+	dec := xml.NewDecoder(strings.NewReader(s))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	var paras []richParagraph
+	cur := richParagraph{Align: -1}
+	styles := []textStyle{{}}
+	aligns := []int{-1}
+	space := true // at the start of a line, where whitespace is dropped
+	breakPara := func() {
+		if len(cur.Runs) > 0 || len(paras) > 0 {
+			paras = append(paras, cur)
+		}
+		cur = richParagraph{Align: aligns[len(aligns)-1]}
+		space = true
+	}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err != io.EOF && len(paras) == 0 && len(cur.Runs) == 0 {
+				// Not markup after all: treat it as plain text.
+				return []richParagraph{{Runs: []richRun{{Text: s}}, Align: -1}}
+			}
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			st := styles[len(styles)-1]
+			align := aligns[len(aligns)-1]
+			switch strings.ToLower(t.Name.Local) {
+			case "b", "strong":
+				st.Bold = true
+			case "i", "em":
+				st.Italic = true
+			case "br":
+				breakPara()
+				cur.Align = align
+			}
+			for _, a := range t.Attr {
+				if strings.EqualFold(a.Name.Local, "style") {
+					st, align = applyCSS(st, align, a.Value)
+				}
+			}
+			styles = append(styles, st)
+			aligns = append(aligns, align)
+			switch strings.ToLower(t.Name.Local) {
+			case "p", "div":
+				if len(cur.Runs) > 0 {
+					breakPara()
+				}
+				cur.Align = align
+			}
+		case xml.EndElement:
+			if len(styles) > 1 {
+				styles = styles[:len(styles)-1]
+				aligns = aligns[:len(aligns)-1]
+			}
+			switch strings.ToLower(t.Name.Local) {
+			case "p", "div":
+				breakPara()
+			}
+		case xml.CharData:
+			text := collapseSpace(string(t), &space)
+			if text != "" {
+				cur.Runs = append(cur.Runs, richRun{Text: text, textStyle: styles[len(styles)-1]})
+			}
+		}
+	}
+	if len(cur.Runs) > 0 {
+		paras = append(paras, cur)
+	}
+	return paras
+}
+
+// collapseSpace collapses whitespace in s into single spaces as XHTML does.
+// space reports whether the text so far ends in whitespace.
+func collapseSpace(s string, space *bool) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			if !*space {
+				b.WriteByte(' ')
+				*space = true
+			}
+			continue
+		}
+		b.WriteRune(r)
+		*space = false
+	}
+	return b.String()
+}
+
+// applyCSS applies the declarations of a style attribute.
+func applyCSS(st textStyle, align int, css string) (textStyle, int) {
+	for _, decl := range strings.Split(css, ";") {
+		prop, value, ok := strings.Cut(decl, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(strings.ToLower(value))
+		switch strings.TrimSpace(strings.ToLower(prop)) {
+		case "font-weight":
+			n, err := strconv.Atoi(value)
+			st.Bold = value == "bold" || value == "bolder" || (err == nil && n >= 600)
+		case "font-style":
+			st.Italic = value == "italic" || value == "oblique"
+		case "font-size":
+			if v, err := strconv.ParseFloat(strings.TrimRight(value, "ptx"), 64); err == nil && v > 0 {
+				st.Size = v
+			}
+		case "color":
+			if c := parseCSSColor(value); c != nil {
+				st.Color = c
+			}
+		case "text-align":
+			switch value {
+			case "left":
+				align = 0
+			case "center":
+				align = 1
+			case "right":
+				align = 2
+			}
+		}
+	}
+	return st, align
+}
+
+// parseCSSColor parses #RGB, #RRGGBB and rgb(r,g,b) colours.
+func parseCSSColor(s string) []float64 {
+	if strings.HasPrefix(s, "#") {
+		h := s[1:]
+		if len(h) == 3 {
+			h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+		}
+		b, err := hex.DecodeString(h)
+		if err != nil || len(b) != 3 {
+			return nil
+		}
+		return []float64{float64(b[0]) / 255, float64(b[1]) / 255, float64(b[2]) / 255}
+	}
+	if strings.HasPrefix(s, "rgb(") && strings.HasSuffix(s, ")") {
+		parts := strings.Split(s[4:len(s)-1], ",")
+		if len(parts) != 3 {
+			return nil
+		}
+		c := make([]float64, 3)
+		for i, p := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return nil
+			}
+			c[i] = clamp(v/255, 0, 1)
+		}
+		return c
+	}
+	return nil
+}
+
+func clamp(v, lo, hi float64) float64 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// richPiece is a part of a laid-out line of rich text.
+type richPiece struct {
+	text  string
+	font  *textFont
+	size  float64
+	color []float64
+	width float64
+}
+
+// richLine is a laid-out line of rich text.
+type richLine struct {
+	pieces  []richPiece
+	width   float64
+	ascent  float64 // largest ascent on the line
+	descent float64 // largest descent on the line (negative)
+	align   int
+}
+
+// layoutRich breaks paragraphs into lines no wider than width. Runs without
+// a size use size; runs without a colour use color.
+func layoutRich(res *appearanceResources, paras []richParagraph, base *textFont, size float64, color []float64, width float64, wrap bool) []richLine {
+	var lines []richLine
+	for _, para := range paras {
+		line := richLine{align: para.Align}
+		push := func() {
+			lines = append(lines, line)
+			line = richLine{align: para.Align}
+		}
+		pending := 0.0 // width of the space before the next word
+		for _, run := range para.Runs {
+			f := res.styled(base, run.Bold, run.Italic)
+			sz := run.Size
+			if sz == 0 {
+				sz = size
+			}
+			c := run.Color
+			if c == nil {
+				c = color
+			}
+			asc, desc := f.metrics()
+			for i, word := range strings.Split(run.Text, " ") {
+				if i > 0 && len(line.pieces) > 0 {
+					pending = f.measure(" ", sz)
+				}
+				if word == "" {
+					continue
+				}
+				w := f.measure(word, sz)
+				if wrap && len(line.pieces) > 0 && line.width+pending+w > width {
+					push()
+					pending = 0
+				}
+				if pending > 0 {
+					last := &line.pieces[len(line.pieces)-1]
+					last.text += " "
+					last.width += pending
+					line.width += pending
+					pending = 0
+				}
+				if n := len(line.pieces); n > 0 && strings.HasSuffix(line.pieces[n-1].text, " ") &&
+					line.pieces[n-1].font == f && line.pieces[n-1].size == sz && sameColor(line.pieces[n-1].color, c) {
+					line.pieces[n-1].text += word
+					line.pieces[n-1].width += w
+				} else {
+					line.pieces = append(line.pieces, richPiece{text: word, font: f, size: sz, color: c, width: w})
+				}
+				line.width += w
+				line.ascent = max(line.ascent, asc*sz)
+				line.descent = min(line.descent, desc*sz)
+			}
+		}
+		if line.ascent == 0 {
+			asc, desc := base.metrics()
+			line.ascent, line.descent = asc*size, desc*size
+		}
+		push()
+	}
+	return lines
+}
+
+// writeRich draws laid-out rich text lines top-down from top inside the
+// box [x, x+width]. align is the quadding used by paragraphs that set no
+// alignment.
+func writeRich(c *contentWriter, lines []richLine, x, top, width float64, align int) {
+	c.WriteString("BT\n")
+	var font *textFont
+	size := 0.0
+	var color []float64
+	y := top
+	for _, line := range lines {
+		y -= line.ascent
+		a := line.align
+		if a < 0 {
+			a = align
+		}
+		lx := x
+		switch a {
+		case 1:
+			lx = x + (width-line.width)/2
+		case 2:
+			lx = x + width - line.width
+		}
+		c.op("Tm", 1, 0, 0, 1, lx, y)
+		for _, p := range line.pieces {
+			if p.font != font || p.size != size {
+				font, size = p.font, p.size
+				fmt.Fprintf(c, "/%s %s Tf\n", font.name, pdfnum.Format(size, 3))
+			}
+			if !sameColor(p.color, color) {
+				color = p.color
+				c.fill(color)
+			}
+			fmt.Fprintf(c, "%s Tj\n", p.font.encode(p.text))
+		}
+		y += line.descent - (line.ascent-line.descent)*0.15
+	}
+	c.WriteString("ET\n")
+}
+
+func sameColor(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// richHeight returns the height taken by lines drawn by writeRich.
+func richHeight(lines []richLine) float64 {
+	h := 0.0
+	for i, line := range lines {
+		h += line.ascent - line.descent
+		if i < len(lines)-1 {
+			h += (line.ascent - line.descent) * 0.15
+		}
+	}
+	return h
+}
@@ -1,6 +1,8 @@
 package builder
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
 
@@ -9,6 +11,7 @@ import (
 	"github.com/wudi/pdfkit/ir/raw"
 	"github.com/wudi/pdfkit/ir/semantic"
 	"github.com/wudi/pdfkit/security"
+	"github.com/wudi/pdfkit/xmp"
 )
 
 // PDFBuilder provides a fluent API for PDF construction.
@@ -18,6 +21,7 @@ type PDFBuilder interface {
 	AddPage(page *semantic.Page) PDFBuilder
 	SetInfo(info *semantic.DocumentInfo) PDFBuilder
 	SetMetadata(xmp []byte) PDFBuilder
+	SetXMP(packet *xmp.Packet) PDFBuilder
 	SetLanguage(lang string) PDFBuilder
 	SetMarked(marked bool) PDFBuilder
 	AddPageLabel(pageIndex int, prefix string) PDFBuilder
@@ -28,11 +32,18 @@ type PDFBuilder interface {
 	RegisterTrueTypeFont(name string, data []byte) PDFBuilder
 	AddEmbeddedFile(file semantic.EmbeddedFile) PDFBuilder
 	SetCalculationOrder(fields []semantic.FormField) PDFBuilder
+	AddLayer(name string, visible bool) PDFBuilder
 	Form() FormBuilder
 	Build() (*semantic.Document, error)
 	MeasureText(text string, fontSize float64, fontName string) float64
 }
 
+// PageSink receives the pages of a streaming builder as they are
+// finished. writer.StreamWriter is one.
+type PageSink interface {
+	WritePage(ctx context.Context, page *semantic.Page) error
+}
+
 // PageBuilder provides a fluent API for page construction.
 type PageBuilder interface {
 	DrawText(text string, x, y float64, opts TextOptions) PageBuilder
@@ -43,6 +54,8 @@ type PageBuilder interface {
 	DrawTable(table Table, opts TableOptions) PageBuilder
 	AddAnnotation(ann semantic.Annotation) PageBuilder
 	AddFormField(field semantic.FormField) PageBuilder
+	BeginLayer(name string) PageBuilder
+	EndLayer() PageBuilder
 	SetMediaBox(box semantic.Rectangle) PageBuilder
 	SetCropBox(box semantic.Rectangle) PageBuilder
 	SetRotation(degrees int) PageBuilder
@@ -192,6 +205,7 @@ type builderImpl struct {
 	pages         []*semantic.Page
 	info          *semantic.DocumentInfo
 	metadata      []byte
+	xmpPacket     *xmp.Packet
 	lang          string
 	marked        bool
 	pageLabels    map[int]string
@@ -213,6 +227,11 @@ type builderImpl struct {
 	embeddedFiles []semantic.EmbeddedFile
 	acroForm      *semantic.AcroForm
 	pendingFields []pendingField
+	ocProperties  *semantic.OCProperties
+	// sink, when set, receives each page when it is finished; streamed
+	// counts the pages it has received.
+	sink     PageSink
+	streamed int
 }
 
 type pendingField struct {
@@ -223,6 +242,7 @@ type pendingField struct {
 type pageBuilderImpl struct {
 	parent *builderImpl
 	page   *semantic.Page
+	layers []*semantic.OptionalContentGroup // open BeginLayer sections
 }
 
 const (
@@ -267,6 +287,15 @@ var (
 // NewBuilder constructs a PDFBuilder.
 func NewBuilder() PDFBuilder { return &builderImpl{defaultFont: defaultFontResource} }
 
+// NewStreamingBuilder constructs a PDFBuilder that hands each page to sink
+// when it is finished and keeps no reference to it, so that long documents
+// need not be held in memory. Build then returns the document without its
+// pages, for the sink to complete. Outlines should name pages by
+// PageIndex; form fields are not supported.
+func NewStreamingBuilder(sink PageSink) PDFBuilder {
+	return &builderImpl{defaultFont: defaultFontResource, sink: sink}
+}
+
 func (b *builderImpl) NewPage(w, h float64) PageBuilder {
 	p := &semantic.Page{MediaBox: semantic.Rectangle{LLX: 0, LLY: 0, URX: w, URY: h}}
 	b.pages = append(b.pages, p)
@@ -292,6 +321,13 @@ func (b *builderImpl) SetMetadata(xmp []byte) PDFBuilder {
 	return b
 }
 
+// SetXMP sets structured XMP metadata, which replaces a packet set with
+// SetMetadata. The writer keeps it in agreement with SetInfo's values.
+func (b *builderImpl) SetXMP(packet *xmp.Packet) PDFBuilder {
+	b.xmpPacket = packet
+	return b
+}
+
 func (b *builderImpl) SetLanguage(lang string) PDFBuilder {
 	b.lang = lang
 	return b
@@ -433,8 +469,8 @@ func (b *builderImpl) Build() (*semantic.Document, error) {
 			doc.Outlines = append(doc.Outlines, b.convertOutline(out, pageIndexByPtr))
 		}
 	}
-	if len(b.metadata) > 0 {
-		doc.Metadata = &semantic.XMPMetadata{Raw: b.metadata}
+	if len(b.metadata) > 0 || b.xmpPacket != nil {
+		doc.Metadata = &semantic.XMPMetadata{Raw: b.metadata, Packet: b.xmpPacket}
 	}
 	if b.structTree != nil {
 		doc.StructTree = b.structTree
@@ -442,6 +478,9 @@ func (b *builderImpl) Build() (*semantic.Document, error) {
 	if b.acroForm != nil {
 		doc.AcroForm = b.acroForm
 	}
+	if b.ocProperties != nil {
+		doc.OCProperties = b.ocProperties
+	}
 	if b.encrypted {
 		doc.OwnerPassword = b.ownerPassword
 		doc.UserPassword = b.userPassword
@@ -901,11 +940,22 @@ func (p *pageBuilderImpl) DrawTable(table Table, opts TableOptions) PageBuilder
 }
 
 func (p *pageBuilderImpl) AddAnnotation(ann semantic.Annotation) PageBuilder {
+	if n := len(p.layers); n > 0 && ann != nil {
+		if base := ann.Base(); base != nil && base.OC == nil {
+			base.OC = p.layers[n-1]
+		}
+	}
 	p.page.Annotations = append(p.page.Annotations, ann)
 	return p
 }
 
 func (p *pageBuilderImpl) AddFormField(field semantic.FormField) PageBuilder {
+	if p.parent.sink != nil {
+		if p.parent.err == nil {
+			p.parent.err = errors.New("form fields are not supported when streaming pages")
+		}
+		return p
+	}
 	p.parent.pendingFields = append(p.parent.pendingFields, pendingField{
 		field: field,
 		page:  p.page,
@@ -928,7 +978,34 @@ func (p *pageBuilderImpl) SetRotation(degrees int) PageBuilder {
 	return p
 }
 
-func (p *pageBuilderImpl) Finish() PDFBuilder { return p.parent }
+func (p *pageBuilderImpl) Finish() PDFBuilder {
+	for len(p.layers) > 0 {
+		p.EndLayer()
+	}
+	if p.parent.sink != nil {
+		p.parent.streamPage(p.page)
+	}
+	return p.parent
+}
+
+// streamPage hands p to the sink and forgets it.
+func (b *builderImpl) streamPage(p *semantic.Page) {
+	for i := len(b.pages) - 1; i >= 0; i-- {
+		if b.pages[i] == p {
+			b.pages = append(b.pages[:i], b.pages[i+1:]...)
+			break
+		}
+	}
+	delete(b.mcidCounters, p)
+	if b.err != nil {
+		return
+	}
+	p.Index = b.streamed
+	b.streamed++
+	if err := b.sink.WritePage(context.Background(), p); err != nil {
+		b.err = err
+	}
+}
 
 func (b *builderImpl) fontForName(name string) (*semantic.Font, string, map[rune]int) {
 	if name == "" {
@@ -1045,6 +1122,8 @@ func (b *builderImpl) convertOutline(out Outline, pageIndex map[*semantic.Page]i
 	if out.Page != nil {
 		if resolved, ok := pageIndex[out.Page]; ok {
 			idx = resolved
+		} else if b.sink != nil {
+			idx = out.Page.Index
 		}
 	}
 	item := semantic.OutlineItem{Title: out.Title, PageIndex: idx}
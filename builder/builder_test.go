@@ -330,3 +330,54 @@ func TestBuilder_ErrorHandling(t *testing.T) {
 		t.Error("Expected error when adding embedded file without Subtype")
 	}
 }
+
+func TestBuilder_Layers(t *testing.T) {
+	b := NewBuilder().AddLayer("Notes", false)
+	b.NewPage(100, 100).
+		BeginLayer("Notes").
+		DrawRectangle(0, 0, 10, 10, RectOptions{Fill: true}).
+		AddAnnotation(&semantic.TextAnnotation{BaseAnnotation: semantic.BaseAnnotation{Subtype: "Text"}}).
+		BeginLayer("Guides").
+		Finish()
+	doc, err := b.Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	props := doc.OCProperties
+	notes, guides := props.Layer("Notes"), props.Layer("Guides")
+	if notes == nil || guides == nil {
+		t.Fatalf("layers = %+v", props.OCGs)
+	}
+	if props.Visible(notes) || !props.Visible(guides) {
+		t.Errorf("Notes should be hidden and Guides visible")
+	}
+	if len(props.D.Order) != 2 {
+		t.Errorf("order = %+v", props.D.Order)
+	}
+
+	page := doc.Pages[0]
+	if page.Resources.Properties["OC1"] != semantic.PropertyList(notes) || page.Resources.Properties["OC2"] != semantic.PropertyList(guides) {
+		t.Errorf("properties = %v", page.Resources.Properties)
+	}
+	ops := page.Contents[0].Operations
+	var bdc, emc int
+	for _, op := range ops {
+		switch op.Operator {
+		case "BDC":
+			bdc++
+		case "EMC":
+			emc++
+		}
+	}
+	if ops[0].Operator != "BDC" || bdc != 2 || emc != 2 {
+		t.Errorf("unbalanced layer sections: %+v", ops)
+	}
+	if page.Annotations[0].Base().OC != semantic.PropertyList(notes) {
+		t.Errorf("annotation OC = %v", page.Annotations[0].Base().OC)
+	}
+
+	props.SetVisible(notes, true)
+	if !props.Visible(notes) {
+		t.Errorf("SetVisible did not show Notes")
+	}
+}
@@ -0,0 +1,79 @@
+package builder
+
+import (
+	"fmt"
+
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// AddLayer adds an optional content group, shown by viewers as a layer,
+// that is initially visible or hidden. Content is assigned to it with
+// PageBuilder.BeginLayer; adding a layer whose name is taken changes the
+// visibility of the existing one.
+func (b *builderImpl) AddLayer(name string, visible bool) PDFBuilder {
+	if b.ocProperties == nil {
+		b.ocProperties = &semantic.OCProperties{}
+	}
+	if g := b.ocProperties.Layer(name); g != nil {
+		b.ocProperties.SetVisible(g, visible)
+		return b
+	}
+	b.ocProperties.AddLayer(name, visible)
+	return b
+}
+
+// layer returns the layer named name, adding a visible one if needed.
+func (b *builderImpl) layer(name string) *semantic.OptionalContentGroup {
+	if g := b.ocProperties.Layer(name); g != nil {
+		return g
+	}
+	b.AddLayer(name, true)
+	return b.ocProperties.Layer(name)
+}
+
+// BeginLayer starts a section of content belonging to the layer name,
+// added visible if it was not added with AddLayer: drawing operations up to
+// the matching EndLayer are marked as optional content of the layer, and
+// annotations added meanwhile belong to it. Sections nest.
+func (p *pageBuilderImpl) BeginLayer(name string) PageBuilder {
+	g := p.parent.layer(name)
+	res := p.ensureResources()
+	if res.Properties == nil {
+		res.Properties = make(map[string]semantic.PropertyList)
+	}
+	resName := ""
+	for n, pl := range res.Properties {
+		if pl == semantic.PropertyList(g) {
+			resName = n
+			break
+		}
+	}
+	if resName == "" {
+		for i := 1; ; i++ {
+			resName = fmt.Sprintf("OC%d", i)
+			if _, taken := res.Properties[resName]; !taken {
+				break
+			}
+		}
+		res.Properties[resName] = g
+	}
+	ops := p.ensureContentOps()
+	*ops = append(*ops, semantic.Operation{
+		Operator: "BDC",
+		Operands: []semantic.Operand{semantic.NameOperand{Value: "OC"}, semantic.NameOperand{Value: resName}},
+	})
+	p.layers = append(p.layers, g)
+	return p
+}
+
+// EndLayer ends the section started by the last BeginLayer. Sections still
+// open when the page is finished are ended then.
+func (p *pageBuilderImpl) EndLayer() PageBuilder {
+	if len(p.layers) == 0 {
+		return p
+	}
+	p.layers = p.layers[:len(p.layers)-1]
+	ops := p.ensureContentOps()
+	*ops = append(*ops, semantic.Operation{Operator: "EMC"})
+	return p
+}
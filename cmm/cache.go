@@ -0,0 +1,201 @@
+package cmm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/wudi/pdfkit/internal/pdfnum"
+)
+
+// maxCachePoints bounds the number of grid nodes of a CachedTransform.
+const maxCachePoints = 1 << 20
+
+// CachedTransform is a transform sampled on a regular grid. Three and four
+// channel inputs are interpolated tetrahedrally, which is much faster than
+// running a profile pipeline for every pixel.
+type CachedTransform struct {
+	inCh, outCh int
+	lut         colorLUT
+	strides     []int
+}
+
+// NewCachedTransform samples t with gridPoints nodes per input channel.
+// Inputs are device values in [0,1]. A gridPoints of zero selects a size
+// suited to inCh: 33 for three channels and 17 for four.
+func NewCachedTransform(t Transform, inCh, outCh, gridPoints int) (*CachedTransform, error) {
+	if inCh <= 0 || outCh <= 0 {
+		return nil, errors.New("cached transform needs input and output channels")
+	}
+	if gridPoints == 0 {
+		switch inCh {
+		case 1:
+			gridPoints = 256
+		case 2, 3:
+			gridPoints = 33
+		case 4:
+			gridPoints = 17
+		default:
+			gridPoints = 9
+		}
+	}
+	if gridPoints < 2 {
+		return nil, errors.New("cached transform needs at least two grid points")
+	}
+	points := 1
+	for i := 0; i < inCh; i++ {
+		points *= gridPoints
+		if points > maxCachePoints {
+			return nil, fmt.Errorf("cached transform grid too large for %d channels", inCh)
+		}
+	}
+	c := &CachedTransform{
+		inCh:    inCh,
+		outCh:   outCh,
+		lut:     colorLUT{grid: make([]int, inCh), outCh: outCh, data: make([]float64, points*outCh)},
+		strides: make([]int, inCh),
+	}
+	stride := outCh
+	for i := inCh - 1; i >= 0; i-- {
+		c.lut.grid[i] = gridPoints
+		c.strides[i] = stride
+		stride *= gridPoints
+	}
+	in := make([]float64, inCh)
+	for n := 0; n < points; n++ {
+		rem := n
+		for i := inCh - 1; i >= 0; i-- {
+			in[i] = float64(rem%gridPoints) / float64(gridPoints-1)
+			rem /= gridPoints
+		}
+		out, err := t.Convert(in)
+		if err != nil {
+			return nil, err
+		}
+		if len(out) != outCh {
+			return nil, fmt.Errorf("transform returned %d channels, want %d", len(out), outCh)
+		}
+		copy(c.lut.data[n*outCh:], out)
+	}
+	return c, nil
+}
+
+// Convert interpolates the sampled transform at in.
+func (c *CachedTransform) Convert(in []float64) ([]float64, error) {
+	if len(in) != c.inCh {
+		return nil, fmt.Errorf("input channels mismatch: expected %d, got %d", c.inCh, len(in))
+	}
+	out := make([]float64, c.outCh)
+	c.eval(in, out)
+	return out, nil
+}
+
+// ConvertPixels converts interleaved 8-bit samples of src into dst.
+func (c *CachedTransform) ConvertPixels(dst, src []byte) error {
+	return convertPixels(c, c.inCh, c.outCh, dst, src)
+}
+
+func (c *CachedTransform) eval(in, out []float64) {
+	switch c.inCh {
+	case 3:
+		for i := range out {
+			out[i] = 0
+		}
+		c.tetrahedral(in, 0, 0, out, 1)
+	case 4:
+		// Linear in the first channel between two tetrahedral lookups.
+		g := c.lut.grid[0]
+		x := pdfnum.Clamp01(in[0]) * float64(g-1)
+		idx := int(x)
+		if idx >= g-1 {
+			idx = g - 2
+		}
+		f := x - float64(idx)
+		for i := range out {
+			out[i] = 0
+		}
+		c.tetrahedral(in, idx*c.strides[0], 1, out, 1-f)
+		if f > 0 {
+			c.tetrahedral(in, (idx+1)*c.strides[0], 1, out, f)
+		}
+	default:
+		copy(out, c.lut.eval(in))
+	}
+}
+
+// tetrahedral adds w times the tetrahedral interpolation over the three
+// channels of in starting at first to out, within the grid at offset base.
+func (c *CachedTransform) tetrahedral(in []float64, base, first int, out []float64, w float64) {
+	var r [3]float64
+	for k := 0; k < 3; k++ {
+		g := c.lut.grid[first+k]
+		x := pdfnum.Clamp01(in[first+k]) * float64(g-1)
+		i := int(x)
+		if i >= g-1 {
+			i = g - 2
+		}
+		r[k] = x - float64(i)
+		base += i * c.strides[first+k]
+	}
+	sx, sy, sz := c.strides[first], c.strides[first+1], c.strides[first+2]
+	rx, ry, rz := r[0], r[1], r[2]
+	d := c.lut.data
+	at := func(o, ch int) float64 { return d[base+o+ch] }
+	for ch := range out {
+		v000 := at(0, ch)
+		v111 := at(sx+sy+sz, ch)
+		var c1, c2, c3 float64
+		switch {
+		case rx >= ry && ry >= rz:
+			v100, v110 := at(sx, ch), at(sx+sy, ch)
+			c1, c2, c3 = v100-v000, v110-v100, v111-v110
+		case rx >= rz && rz >= ry:
+			v100, v101 := at(sx, ch), at(sx+sz, ch)
+			c1, c2, c3 = v100-v000, v111-v101, v101-v100
+		case rz >= rx && rx >= ry:
+			v001, v101 := at(sz, ch), at(sx+sz, ch)
+			c1, c2, c3 = v101-v001, v111-v101, v001-v000
+		case ry >= rx && rx >= rz:
+			v010, v110 := at(sy, ch), at(sx+sy, ch)
+			c1, c2, c3 = v110-v010, v010-v000, v111-v110
+		case ry >= rz && rz >= rx:
+			v010, v011 := at(sy, ch), at(sy+sz, ch)
+			c1, c2, c3 = v111-v011, v010-v000, v011-v010
+		default: // rz >= ry >= rx
+			v001, v011 := at(sz, ch), at(sy+sz, ch)
+			c1, c2, c3 = v111-v011, v011-v001, v001-v000
+		}
+		out[ch] += w * (v000 + c1*rx + c2*ry + c3*rz)
+	}
+}
+
+// convertPixels converts interleaved 8-bit pixels one at a time.
+func convertPixels(t Transform, inCh, outCh int, dst, src []byte) error {
+	if len(src)%inCh != 0 {
+		return fmt.Errorf("source length %d is not a multiple of %d channels", len(src), inCh)
+	}
+	n := len(src) / inCh
+	if len(dst) < n*outCh {
+		return fmt.Errorf("destination holds %d bytes, need %d", len(dst), n*outCh)
+	}
+	cached, _ := t.(*CachedTransform)
+	in := make([]float64, inCh)
+	out := make([]float64, outCh)
+	for p := 0; p < n; p++ {
+		for i := range in {
+			in[i] = float64(src[p*inCh+i]) / 255
+		}
+		if cached != nil {
+			cached.eval(in, out)
+		} else {
+			res, err := t.Convert(in)
+			if err != nil {
+				return err
+			}
+			copy(out, res)
+		}
+		for i, v := range out {
+			dst[p*outCh+i] = uint8(pdfnum.Clamp01(v)*255 + 0.5)
+		}
+	}
+	return nil
+}
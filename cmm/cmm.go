@@ -18,10 +18,30 @@ type Transform interface {
 	Convert(src []float64) ([]float64, error)
 }
 
+// PixelTransform is a Transform that also converts interleaved 8-bit
+// samples in bulk.
+type PixelTransform interface {
+	Transform
+	// ConvertPixels converts the pixels of src into dst.
+	ConvertPixels(dst, src []byte) error
+}
+
 // Factory creates profiles and transforms.
 type Factory interface {
 	NewProfile(data []byte) (Profile, error)
 	NewTransform(src, dst Profile, intent RenderingIntent) (Transform, error)
+	// NewChainTransform links a sequence of profiles, which may include
+	// device link and abstract profiles.
+	NewChainTransform(profiles []Profile, opts TransformOptions) (Transform, error)
+}
+
+// TransformOptions configures a chained transform.
+type TransformOptions struct {
+	Intent RenderingIntent
+	// BlackPointCompensation maps the black point of each source profile
+	// onto the black point of the destination profile that follows it. It
+	// does not apply to absolute colorimetric transforms.
+	BlackPointCompensation bool
 }
 
 // RenderingIntent specifies the rendering intent for color conversion.
@@ -0,0 +1,190 @@
+package cmm
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/wudi/pdfkit/internal/pdfnum"
+)
+
+// Curve is a one-dimensional tone reproduction curve mapping [0,1] to [0,1].
+type Curve interface {
+	Eval(x float64) float64
+}
+
+type identityCurve struct{}
+
+func (identityCurve) Eval(x float64) float64 { return x }
+
+// gammaCurve is Y = X^gamma.
+type gammaCurve float64
+
+func (g gammaCurve) Eval(x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	return math.Pow(x, float64(g))
+}
+
+// tableCurve is a sampled curve with evenly spaced inputs.
+type tableCurve []float64
+
+func (t tableCurve) Eval(x float64) float64 { return interp1D(x, t) }
+
+// parametricCurve is a parametricCurveType ('para') function.
+type parametricCurve struct {
+	kind   uint16
+	params [7]float64 // g, a, b, c, d, e, f
+}
+
+// parametricParams is the number of parameters of each function type.
+var parametricParams = [...]int{1, 3, 4, 5, 7}
+
+func (c parametricCurve) Eval(x float64) float64 {
+	p := c.params
+	g, a, b, cc, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+	pow := func(v float64) float64 {
+		if v <= 0 {
+			return 0
+		}
+		return math.Pow(v, g)
+	}
+	var y float64
+	switch c.kind {
+	case 0:
+		y = pow(x)
+	case 1:
+		if a != 0 && x >= -b/a {
+			y = pow(a*x + b)
+		}
+	case 2:
+		y = cc
+		if a != 0 && x >= -b/a {
+			y = pow(a*x+b) + cc
+		}
+	case 3:
+		if x >= d {
+			y = pow(a*x + b)
+		} else {
+			y = cc * x
+		}
+	case 4:
+		if x >= d {
+			y = pow(a*x+b) + e
+		} else {
+			y = cc*x + f
+		}
+	}
+	return pdfnum.Clamp01(y)
+}
+
+// ReadCurve reads a curveType or parametricCurveType tag.
+func (p *ICCProfile) ReadCurve(sig string) (Curve, error) {
+	data, ok := p.GetTag(sig)
+	if !ok {
+		return nil, errors.New("tag not found")
+	}
+	c, _, err := parseCurve(data)
+	return c, err
+}
+
+// parseCurve decodes the curve at the start of data and reports the number
+// of bytes it occupies, excluding padding.
+func parseCurve(data []byte) (Curve, int, error) {
+	if len(data) < 12 {
+		return nil, 0, errors.New("curve too short")
+	}
+	switch binary.BigEndian.Uint32(data[0:4]) {
+	case 0x63757276: // 'curv'
+		count := int(binary.BigEndian.Uint32(data[8:12]))
+		size := 12 + 2*count
+		if size > len(data) {
+			return nil, 0, errors.New("curve table truncated")
+		}
+		switch count {
+		case 0:
+			return identityCurve{}, size, nil
+		case 1:
+			return gammaCurve(float64(binary.BigEndian.Uint16(data[12:14])) / 256.0), size, nil
+		}
+		table := make(tableCurve, count)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(data[12+2*i:])) / 65535.0
+		}
+		return table, size, nil
+	case 0x70617261: // 'para'
+		kind := binary.BigEndian.Uint16(data[8:10])
+		if int(kind) >= len(parametricParams) {
+			return nil, 0, errors.New("unsupported parametric curve type")
+		}
+		n := parametricParams[kind]
+		size := 12 + 4*n
+		if size > len(data) {
+			return nil, 0, errors.New("parametric curve truncated")
+		}
+		c := parametricCurve{kind: kind}
+		for i := 0; i < n; i++ {
+			c.params[i] = s15Fixed16ToFloat(binary.BigEndian.Uint32(data[12+4*i:]))
+		}
+		return c, size, nil
+	}
+	return nil, 0, errors.New("unsupported curve type")
+}
+
+// parseCurves reads n consecutive curves, each padded to four bytes,
+// starting at offset off of a tag.
+func parseCurves(tag []byte, off, n int) ([]Curve, error) {
+	curves := make([]Curve, n)
+	for i := range curves {
+		if off >= len(tag) {
+			return nil, errors.New("curves truncated")
+		}
+		c, size, err := parseCurve(tag[off:])
+		if err != nil {
+			return nil, err
+		}
+		curves[i] = c
+		off += (size + 3) &^ 3
+	}
+	return curves, nil
+}
+
+// inverseSamples is the resolution of sampled inverse curves.
+const inverseSamples = 4096
+
+// inverseCurve returns the inverse of a monotonic curve.
+func inverseCurve(c Curve) Curve {
+	switch c := c.(type) {
+	case identityCurve:
+		return c
+	case gammaCurve:
+		if c > 0 {
+			return gammaCurve(1 / c)
+		}
+	}
+	rising := c.Eval(1) >= c.Eval(0)
+	table := make(tableCurve, inverseSamples)
+	for i := range table {
+		y := float64(i) / (inverseSamples - 1)
+		lo, hi := 0.0, 1.0
+		for iter := 0; iter < 32; iter++ {
+			mid := (lo + hi) / 2
+			if (c.Eval(mid) < y) == rising {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		table[i] = (lo + hi) / 2
+	}
+	return table
+}
+
+func evalCurves(curves []Curve, v []float64) {
+	for i, c := range curves {
+		if i < len(v) {
+			v[i] = c.Eval(pdfnum.Clamp01(v[i]))
+		}
+	}
+}
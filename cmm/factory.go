@@ -3,6 +3,7 @@ package cmm
 import (
 	"bytes"
 	"errors"
+	"fmt"
 )
 
 type factoryImpl struct{}
@@ -26,20 +27,34 @@ func (f *factoryImpl) NewTransform(src, dst Profile, intent RenderingIntent) (Tr
 		return &identityTransform{}, nil
 	}
 
-	// Try Matrix/TRC for RGB -> XYZ
-	if src.ColorSpace() == "RGB " && dst.ColorSpace() == "XYZ " {
-		if icc, ok := src.(*ICCProfile); ok {
-			if trc, err := tryCreateMatrixTRC(icc); err == nil {
-				return trc, nil
-			}
+	srcICC, srcOK := src.(*ICCProfile)
+	dstICC, dstOK := dst.(*ICCProfile)
+	if srcOK && dstOK {
+		t, err := buildPipeline([]*ICCProfile{srcICC, dstICC}, TransformOptions{Intent: intent})
+		if err == nil {
+			return t, nil
+		}
+		if !errors.Is(err, errNoPipeline) {
+			return nil, err
 		}
 	}
 
-	// In a full implementation, we would build a pipeline here.
-	// For now, we return a basic transform that might fail or do simple conversion.
+	// Profiles without transform tags fall back to simple conversions.
 	return &basicTransform{src: src, dst: dst, intent: intent}, nil
 }
 
+func (f *factoryImpl) NewChainTransform(profiles []Profile, opts TransformOptions) (Transform, error) {
+	iccs := make([]*ICCProfile, len(profiles))
+	for i, p := range profiles {
+		icc, ok := p.(*ICCProfile)
+		if !ok || icc == nil {
+			return nil, fmt.Errorf("profile %d is not an ICC profile", i)
+		}
+		iccs[i] = icc
+	}
+	return buildPipeline(iccs, opts)
+}
+
 type identityTransform struct{}
 
 func (t *identityTransform) Convert(src []float64) ([]float64, error) {
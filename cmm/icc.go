@@ -3,6 +3,8 @@ package cmm
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"unicode/utf16"
 )
 
 // ICCProfile implements Profile for ICC data.
@@ -111,18 +113,19 @@ func (p *ICCProfile) readDescription(tag iccTag) string {
 			return string(raw[12 : 12+count-1]) // null terminated
 		}
 	} else if sig == 0x6D6C7563 { // 'mluc' - multiLocalizedUnicodeType
-		// Complex parsing, skip for now or implement basic
-		// 8-12: Number of records
-		// 12-16: Record size (12)
+		// 8-12: Number of records, 12-16: Record size (12)
+		// First record: ISO-639 (2), ISO-3166 (2), Len (4), Off (4)
 		numRecs := binary.BigEndian.Uint32(raw[8:12])
 		if numRecs > 0 && len(raw) >= 28 {
-			// First record: ISO-639 (2), ISO-3166 (2), Len (4), Off (4)
-			// nameLen := binary.BigEndian.Uint32(raw[20:24])
+			nameLen := binary.BigEndian.Uint32(raw[20:24])
 			nameOff := binary.BigEndian.Uint32(raw[24:28])
 			// Offset is relative to tag start
-			if nameOff < tag.Size {
-				// Read UTF-16BE... simplified
-				return "Localized Profile"
+			if uint64(nameOff)+uint64(nameLen) <= uint64(len(raw)) {
+				units := make([]uint16, nameLen/2)
+				for i := range units {
+					units[i] = binary.BigEndian.Uint16(raw[nameOff+uint32(2*i):])
+				}
+				return string(utf16.Decode(units))
 			}
 		}
 	}
@@ -141,6 +144,93 @@ func (p *ICCProfile) Data() []byte {
 	return p.data
 }
 
+// Version returns the major and minor profile format version.
+func (p *ICCProfile) Version() (major, minor int) {
+	return int(p.header.Version >> 24), int(p.header.Version>>20) & 0xF
+}
+
+// HasTag reports whether the profile contains the tag sig.
+func (p *ICCProfile) HasTag(sig string) bool {
+	_, ok := p.tags[sig]
+	return ok
+}
+
+// MediaWhitePoint returns the 'wtpt' tag, or the D50 PCS illuminant when the
+// profile has none.
+func (p *ICCProfile) MediaWhitePoint() [3]float64 {
+	if wp, err := p.ReadXYZTag("wtpt"); err == nil && wp[1] > 0 {
+		return wp
+	}
+	return [3]float64{D50X, D50Y, D50Z}
+}
+
+// requiredTags lists, per profile class, the tag sets of which at least one
+// must be present in full.
+func (p *ICCProfile) requiredTags() [][]string {
+	matrixTRC := []string{"rXYZ", "gXYZ", "bXYZ", "rTRC", "gTRC", "bTRC"}
+	switch p.Class() {
+	case "scnr", "mntr":
+		switch p.ColorSpace() {
+		case "GRAY":
+			return [][]string{{"kTRC"}, {"A2B0"}}
+		case "RGB ":
+			return [][]string{matrixTRC, {"A2B0"}}
+		}
+		return [][]string{{"A2B0"}}
+	case "prtr":
+		if p.ColorSpace() == "GRAY" {
+			return [][]string{{"kTRC"}, {"A2B0", "B2A0"}}
+		}
+		return [][]string{{"A2B0", "B2A0"}}
+	case "link", "abst":
+		return [][]string{{"A2B0"}}
+	case "spac":
+		return [][]string{{"A2B0", "B2A0"}}
+	case "nmcl":
+		return [][]string{{"ncl2"}}
+	}
+	return nil
+}
+
+// Validate checks the header, tag table and the tags required for the
+// profile class.
+func (p *ICCProfile) Validate() error {
+	if int(p.header.Size) > len(p.data) {
+		return fmt.Errorf("profile size %d exceeds data length %d", p.header.Size, len(p.data))
+	}
+	if major, _ := p.Version(); major < 2 || major > 4 {
+		return fmt.Errorf("unsupported profile version %d", major)
+	}
+	if p.requiredTags() == nil {
+		return fmt.Errorf("unknown profile class %q", p.Class())
+	}
+	if numChannels(p.ColorSpace()) == 0 {
+		return fmt.Errorf("unknown colour space %q", p.ColorSpace())
+	}
+	if p.Class() == "link" {
+		if numChannels(p.PCS()) == 0 {
+			return fmt.Errorf("unknown device link output space %q", p.PCS())
+		}
+	} else if pcs := p.PCS(); pcs != "XYZ " && pcs != "Lab " {
+		return fmt.Errorf("invalid PCS %q", pcs)
+	}
+	for sig, tag := range p.tags {
+		if uint64(tag.Offset)+uint64(tag.Size) > uint64(len(p.data)) {
+			return fmt.Errorf("tag %q lies outside the profile", sig)
+		}
+	}
+	for _, set := range p.requiredTags() {
+		complete := true
+		for _, sig := range set {
+			complete = complete && p.HasTag(sig)
+		}
+		if complete {
+			return nil
+		}
+	}
+	return fmt.Errorf("profile class %q lacks required tags %v", p.Class(), p.requiredTags()[0])
+}
+
 // GetTag returns the raw data for a tag if it exists.
 func (p *ICCProfile) GetTag(sig string) ([]byte, bool) {
 	tag, ok := p.tags[sig]
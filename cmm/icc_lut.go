@@ -247,56 +247,14 @@ func interp1D(val float64, table []float64) float64 {
 }
 
 func interpCLUT(in []float64, clut []float64, inCh, outCh, gridPoints int) []float64 {
-	// N-linear interpolation
-	// This is complex to implement generically for N dimensions.
-	// For now, let's implement for 3 inputs (common case RGB/Lab) and 4 inputs (CMYK).
-	// If N is large, this is slow.
-
-	// Simplified: Nearest Neighbor for now to save tokens/complexity, or Trilinear for 3D.
-	// Let's do Trilinear for 3D.
-
 	if inCh == 3 {
 		return interpCLUT3D(in, clut, outCh, gridPoints)
 	}
-	if inCh == 4 {
-		// Fallback to nearest neighbor for 4D
-		return interpCLUTNearest(in, clut, inCh, outCh, gridPoints)
+	grid := make([]int, inCh)
+	for i := range grid {
+		grid[i] = gridPoints
 	}
-
-	// Fallback
-	return interpCLUTNearest(in, clut, inCh, outCh, gridPoints)
-}
-
-func interpCLUTNearest(in []float64, clut []float64, inCh, outCh, gridPoints int) []float64 {
-	// Calculate index
-	idx := 0
-	stride := outCh
-	for i := 0; i < inCh; i++ {
-		// Scale input to grid index
-		val := in[i]
-		if val < 0 {
-			val = 0
-		}
-		if val > 1 {
-			val = 1
-		}
-		gridIdx := int(val*float64(gridPoints-1) + 0.5)
-
-		// Stride for this dimension
-		// Dim 0 varies fastest? Or slowest?
-		// ICC spec: "The first dimension varies least rapidly..."
-		// So index = d0 * (G^(N-1)) + d1 * (G^(N-2)) ...
-
-		power := int(math.Pow(float64(gridPoints), float64(inCh-1-i)))
-		idx += gridIdx * power
-	}
-
-	offset := idx * stride
-	out := make([]float64, outCh)
-	for c := 0; c < outCh; c++ {
-		out[c] = clut[offset+c]
-	}
-	return out
+	return (&colorLUT{grid: grid, outCh: outCh, data: clut}).eval(in)
 }
 
 func interpCLUT3D(in []float64, clut []float64, outCh, gridPoints int) []float64 {
@@ -0,0 +1,240 @@
+package cmm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/wudi/pdfkit/internal/pdfnum"
+)
+
+// Tag type signatures of the LUT-based transforms.
+const (
+	typeMFT1 = 0x6D667431 // 'mft1' lut8Type
+	typeMFT2 = 0x6D667432 // 'mft2' lut16Type
+	typeMAB  = 0x6D414220 // 'mAB ' lutAtoBType
+	typeMBA  = 0x6D424120 // 'mBA ' lutBtoAType
+)
+
+// colorLUT is a multidimensional colour lookup table. The first input
+// dimension varies least rapidly.
+type colorLUT struct {
+	grid  []int
+	outCh int
+	data  []float64
+}
+
+// eval interpolates the table multilinearly at in, whose components are in
+// [0,1].
+func (c *colorLUT) eval(in []float64) []float64 {
+	n := len(c.grid)
+	base := 0
+	strides := make([]int, n)
+	fracs := make([]float64, n)
+	stride := c.outCh
+	for i := n - 1; i >= 0; i-- {
+		g := c.grid[i]
+		strides[i] = stride
+		if g > 1 {
+			x := pdfnum.Clamp01(in[i]) * float64(g-1)
+			idx := int(x)
+			if idx >= g-1 {
+				idx = g - 2
+			}
+			fracs[i] = x - float64(idx)
+			base += idx * stride
+		}
+		stride *= g
+	}
+	out := make([]float64, c.outCh)
+	for corner := 0; corner < 1<<n; corner++ {
+		w := 1.0
+		off := base
+		for i := 0; i < n; i++ {
+			if corner&(1<<i) != 0 {
+				if c.grid[i] < 2 {
+					w = 0
+					break
+				}
+				w *= fracs[i]
+				off += strides[i]
+			} else {
+				w *= 1 - fracs[i]
+			}
+		}
+		if w == 0 {
+			continue
+		}
+		for ch := range out {
+			out[ch] += w * c.data[off+ch]
+		}
+	}
+	return out
+}
+
+// lutAB is a lutAtoBType or lutBtoAType transform. Device to PCS tags apply
+// A curves, CLUT, M curves, matrix and B curves in that order; PCS to device
+// tags apply them in reverse.
+type lutAB struct {
+	inCh, outCh int
+	aToB        bool
+	a, m, b     []Curve
+	matrix      *[12]float64
+	clut        *colorLUT
+}
+
+func parseLutAB(data []byte) (*lutAB, error) {
+	if len(data) < 32 {
+		return nil, errors.New("lutAB tag too short")
+	}
+	l := &lutAB{
+		inCh:  int(data[8]),
+		outCh: int(data[9]),
+		aToB:  binary.BigEndian.Uint32(data[0:4]) == typeMAB,
+	}
+	if l.inCh == 0 || l.outCh == 0 {
+		return nil, errors.New("lutAB tag has no channels")
+	}
+	offB := int(binary.BigEndian.Uint32(data[12:16]))
+	offMatrix := int(binary.BigEndian.Uint32(data[16:20]))
+	offM := int(binary.BigEndian.Uint32(data[20:24]))
+	offCLUT := int(binary.BigEndian.Uint32(data[24:28]))
+	offA := int(binary.BigEndian.Uint32(data[28:32]))
+
+	// The B and M curves sit on the PCS side, the A curves on the device side.
+	pcsCh, devCh := l.outCh, l.inCh
+	if !l.aToB {
+		pcsCh, devCh = l.inCh, l.outCh
+	}
+	var err error
+	if offB == 0 {
+		return nil, errors.New("lutAB tag lacks B curves")
+	}
+	if l.b, err = parseCurves(data, offB, pcsCh); err != nil {
+		return nil, err
+	}
+	if offM != 0 {
+		if l.m, err = parseCurves(data, offM, pcsCh); err != nil {
+			return nil, err
+		}
+	}
+	if offA != 0 {
+		if l.a, err = parseCurves(data, offA, devCh); err != nil {
+			return nil, err
+		}
+	}
+	if offMatrix != 0 {
+		if pcsCh != 3 || offMatrix+48 > len(data) {
+			return nil, errors.New("lutAB matrix invalid")
+		}
+		var m [12]float64
+		for i := range m {
+			m[i] = s15Fixed16ToFloat(binary.BigEndian.Uint32(data[offMatrix+4*i:]))
+		}
+		l.matrix = &m
+	}
+	if offCLUT != 0 {
+		if l.clut, err = parseCLUT(data, offCLUT, l.inCh, l.outCh); err != nil {
+			return nil, err
+		}
+	} else if l.inCh != l.outCh {
+		return nil, errors.New("lutAB tag without CLUT changes channel count")
+	}
+	return l, nil
+}
+
+func parseCLUT(data []byte, off, inCh, outCh int) (*colorLUT, error) {
+	if inCh > 16 || off+20 > len(data) {
+		return nil, errors.New("CLUT truncated")
+	}
+	c := &colorLUT{grid: make([]int, inCh), outCh: outCh}
+	points := 1
+	for i := range c.grid {
+		c.grid[i] = int(data[off+i])
+		if c.grid[i] == 0 {
+			return nil, errors.New("CLUT has empty dimension")
+		}
+		points *= c.grid[i]
+	}
+	precision := int(data[off+16])
+	if precision != 1 && precision != 2 {
+		return nil, fmt.Errorf("CLUT precision %d not supported", precision)
+	}
+	pos := off + 20
+	n := points * outCh
+	if pos+n*precision > len(data) {
+		return nil, errors.New("CLUT truncated")
+	}
+	c.data = make([]float64, n)
+	for i := range c.data {
+		if precision == 1 {
+			c.data[i] = float64(data[pos+i]) / 255.0
+		} else {
+			c.data[i] = float64(binary.BigEndian.Uint16(data[pos+2*i:])) / 65535.0
+		}
+	}
+	return c, nil
+}
+
+// Convert executes the transform on normalized input values.
+func (l *lutAB) Convert(in []float64) ([]float64, error) {
+	if len(in) != l.inCh {
+		return nil, errors.New("input channels mismatch")
+	}
+	v := append([]float64(nil), in...)
+	if l.aToB {
+		evalCurves(l.a, v)
+		if l.clut != nil {
+			v = l.clut.eval(v)
+		}
+		evalCurves(l.m, v)
+		l.applyMatrix(v)
+		evalCurves(l.b, v)
+	} else {
+		evalCurves(l.b, v)
+		l.applyMatrix(v)
+		evalCurves(l.m, v)
+		if l.clut != nil {
+			v = l.clut.eval(v)
+		}
+		evalCurves(l.a, v)
+	}
+	return v, nil
+}
+
+func (l *lutAB) applyMatrix(v []float64) {
+	if l.matrix == nil {
+		return
+	}
+	m := l.matrix
+	x, y, z := pdfnum.Clamp01(v[0]), pdfnum.Clamp01(v[1]), pdfnum.Clamp01(v[2])
+	v[0] = m[0]*x + m[1]*y + m[2]*z + m[9]
+	v[1] = m[3]*x + m[4]*y + m[5]*z + m[10]
+	v[2] = m[6]*x + m[7]*y + m[8]*z + m[11]
+}
+
+// ReadTransformTag reads a LUT-based tag (lut8Type, lut16Type, lutAtoBType
+// or lutBtoAType) as a transform on normalized values.
+func (p *ICCProfile) ReadTransformTag(sig string) (Transform, error) {
+	t, _, err := p.readTransformTag(sig)
+	return t, err
+}
+
+func (p *ICCProfile) readTransformTag(sig string) (Transform, uint32, error) {
+	data, ok := p.GetTag(sig)
+	if !ok {
+		return nil, 0, errors.New("tag not found")
+	}
+	if len(data) < 8 {
+		return nil, 0, errors.New("tag too short")
+	}
+	switch typ := binary.BigEndian.Uint32(data[0:4]); typ {
+	case typeMFT1, typeMFT2:
+		lut, err := p.ReadLUTTag(sig)
+		return lut, typ, err
+	case typeMAB, typeMBA:
+		lut, err := parseLutAB(data)
+		return lut, typ, err
+	}
+	return nil, 0, errors.New("unsupported LUT type")
+}
@@ -0,0 +1,450 @@
+package cmm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/wudi/pdfkit/internal/pdfnum"
+)
+
+// errNoPipeline reports a profile without tags describing its transform.
+var errNoPipeline = errors.New("profile has no transform tags")
+
+// perceptualBlack is the black point of the ICC v4 perceptual reference
+// medium.
+var perceptualBlack = [3]float64{0.00336, 0.0034731, 0.00287}
+
+// stage is one step of a transform pipeline. Profiles connect through PCS
+// XYZ values relative to the D50 illuminant.
+type stage func([]float64) ([]float64, error)
+
+// pipelineTransform runs profile stages in sequence.
+type pipelineTransform struct {
+	stages      []stage
+	inCh, outCh int
+
+	cacheOnce sync.Once
+	cache     *CachedTransform
+	cacheErr  error
+}
+
+func (t *pipelineTransform) Convert(in []float64) ([]float64, error) {
+	if len(in) != t.inCh {
+		return nil, fmt.Errorf("input channels mismatch: expected %d, got %d", t.inCh, len(in))
+	}
+	v := append([]float64(nil), in...)
+	for _, s := range t.stages {
+		var err error
+		if v, err = s(v); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// ConvertPixels converts interleaved 8-bit samples through a grid sampled
+// from the pipeline on first use.
+func (t *pipelineTransform) ConvertPixels(dst, src []byte) error {
+	t.cacheOnce.Do(func() {
+		t.cache, t.cacheErr = NewCachedTransform(t, t.inCh, t.outCh, 0)
+	})
+	if t.cacheErr != nil {
+		return convertPixels(t, t.inCh, t.outCh, dst, src)
+	}
+	return t.cache.ConvertPixels(dst, src)
+}
+
+// buildPipeline links profiles the way a CMM links a profile sequence: a
+// profile reached in device space is used on its device to PCS side, one
+// reached in PCS on its PCS to device side. Device links connect device
+// spaces and abstract profiles modify PCS values.
+func buildPipeline(profiles []*ICCProfile, opts TransformOptions) (*pipelineTransform, error) {
+	if len(profiles) == 0 {
+		return nil, errors.New("no profiles")
+	}
+	t := &pipelineTransform{inCh: numChannels(profiles[0].ColorSpace())}
+	var (
+		atPCS bool
+		space string      // colour space of the values so far
+		input *ICCProfile // profile that produced the current PCS values
+	)
+	for i, p := range profiles {
+		var (
+			stages []stage
+			err    error
+		)
+		switch {
+		case p.Class() == "link":
+			if atPCS {
+				return nil, errors.New("device link cannot follow a PCS connection")
+			}
+			if i > 0 && space != p.ColorSpace() {
+				return nil, fmt.Errorf("device link expects %q, got %q", p.ColorSpace(), space)
+			}
+			stages, err = p.linkStages()
+			space = p.PCS()
+		case p.Class() == "abst":
+			if !atPCS {
+				if i > 0 {
+					return nil, errors.New("abstract profile must follow a PCS connection")
+				}
+				stages = append(stages, toXYZ(p.ColorSpace()))
+			}
+			var abst []stage
+			abst, err = p.abstractStages()
+			stages = append(stages, abst...)
+			atPCS, space, input = true, p.PCS(), nil
+		case atPCS:
+			if opts.BlackPointCompensation && opts.Intent != IntentAbsoluteColorimetric && input != nil {
+				src, err1 := input.blackPoint(opts.Intent, false)
+				dst, err2 := p.blackPoint(opts.Intent, true)
+				if err1 == nil && err2 == nil && src != dst {
+					stages = append(stages, bpcStage(src, dst))
+				}
+			}
+			var out []stage
+			out, err = p.fromPCSStages(opts.Intent)
+			stages = append(stages, out...)
+			atPCS, space = false, p.ColorSpace()
+		default:
+			if i > 0 && numChannels(space) != numChannels(p.ColorSpace()) {
+				return nil, fmt.Errorf("profile %d expects %q, got %q", i, p.ColorSpace(), space)
+			}
+			stages, err = p.toPCSStages(opts.Intent)
+			atPCS, space, input = true, p.PCS(), p
+		}
+		if err != nil {
+			return nil, err
+		}
+		t.stages = append(t.stages, stages...)
+	}
+	if atPCS {
+		t.stages = append(t.stages, fromXYZ(space))
+	}
+	t.outCh = numChannels(space)
+	return t, nil
+}
+
+func intentTag(p *ICCProfile, prefix string, intent RenderingIntent) string {
+	n := 1
+	switch intent {
+	case IntentPerceptual:
+		n = 0
+	case IntentSaturation:
+		n = 2
+	}
+	if sig := fmt.Sprintf("%s%d", prefix, n); p.HasTag(sig) {
+		return sig
+	}
+	return prefix + "0"
+}
+
+// isPCSSpace reports whether values in space are XYZ or Lab numbers rather
+// than device values in [0,1].
+func isPCSSpace(space string) bool {
+	return space == "XYZ " || space == "Lab "
+}
+
+// toPCSStages converts device values of p to PCS XYZ.
+func (p *ICCProfile) toPCSStages(intent RenderingIntent) ([]stage, error) {
+	space, pcs := p.ColorSpace(), p.PCS()
+	var stages []stage
+	switch sig := intentTag(p, "A2B", intent); {
+	case p.HasTag(sig):
+		t, typ, err := p.readTransformTag(sig)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", sig, err)
+		}
+		stages = append(stages, lutStage(t, tagEncoding(space, typ), tagEncoding(pcs, typ)), toXYZ(pcs))
+	case space == "GRAY" && p.HasTag("kTRC"):
+		c, err := p.ReadCurve("kTRC")
+		if err != nil {
+			return nil, fmt.Errorf("kTRC: %w", err)
+		}
+		stages = append(stages, func(v []float64) ([]float64, error) {
+			y := c.Eval(pdfnum.Clamp01(v[0]))
+			if pcs == "Lab " {
+				return LabToXYZ([]float64{100 * y, 0, 0}), nil
+			}
+			return []float64{D50X * y, D50Y * y, D50Z * y}, nil
+		})
+	case space == "RGB " && p.HasTag("rXYZ"):
+		mat, err := tryCreateMatrixTRC(p)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, mat.Convert)
+	case isPCSSpace(space) && len(p.tags) == 0:
+		stages = append(stages, toXYZ(space))
+	default:
+		return nil, errNoPipeline
+	}
+	if intent == IntentAbsoluteColorimetric {
+		wp := p.MediaWhitePoint()
+		stages = append(stages, scaleStage([3]float64{wp[0] / D50X, wp[1] / D50Y, wp[2] / D50Z}))
+	}
+	return stages, nil
+}
+
+// fromPCSStages converts PCS XYZ to device values of p.
+func (p *ICCProfile) fromPCSStages(intent RenderingIntent) ([]stage, error) {
+	space, pcs := p.ColorSpace(), p.PCS()
+	var stages []stage
+	if intent == IntentAbsoluteColorimetric {
+		wp := p.MediaWhitePoint()
+		stages = append(stages, scaleStage([3]float64{D50X / wp[0], D50Y / wp[1], D50Z / wp[2]}))
+	}
+	switch sig := intentTag(p, "B2A", intent); {
+	case p.HasTag(sig):
+		t, typ, err := p.readTransformTag(sig)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", sig, err)
+		}
+		stages = append(stages, fromXYZ(pcs), lutStage(t, tagEncoding(pcs, typ), tagEncoding(space, typ)))
+	case space == "GRAY" && p.HasTag("kTRC"):
+		c, err := p.ReadCurve("kTRC")
+		if err != nil {
+			return nil, fmt.Errorf("kTRC: %w", err)
+		}
+		inv := inverseCurve(c)
+		stages = append(stages, func(v []float64) ([]float64, error) {
+			y := v[1]
+			if pcs == "Lab " {
+				y = XYZToLab(v)[0] / 100
+			}
+			return []float64{inv.Eval(pdfnum.Clamp01(y))}, nil
+		})
+	case space == "RGB " && p.HasTag("rXYZ"):
+		mat, err := tryCreateMatrixTRC(p)
+		if err != nil {
+			return nil, err
+		}
+		inv, err := mat.Inverse()
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, inv.Convert)
+	case isPCSSpace(space) && len(p.tags) == 0:
+		stages = append(stages, fromXYZ(space))
+	default:
+		return nil, errNoPipeline
+	}
+	return stages, nil
+}
+
+// linkStages applies the device link transform of p.
+func (p *ICCProfile) linkStages() ([]stage, error) {
+	t, typ, err := p.readTransformTag("A2B0")
+	if err != nil {
+		return nil, fmt.Errorf("A2B0: %w", err)
+	}
+	return []stage{lutStage(t, tagEncoding(p.ColorSpace(), typ), tagEncoding(p.PCS(), typ))}, nil
+}
+
+// abstractStages applies the PCS to PCS transform of an abstract profile.
+func (p *ICCProfile) abstractStages() ([]stage, error) {
+	t, typ, err := p.readTransformTag("A2B0")
+	if err != nil {
+		return nil, fmt.Errorf("A2B0: %w", err)
+	}
+	in, out := p.ColorSpace(), p.PCS()
+	return []stage{
+		fromXYZ(in),
+		lutStage(t, tagEncoding(in, typ), tagEncoding(out, typ)),
+		toXYZ(out),
+	}, nil
+}
+
+// blackPoint estimates the PCS XYZ black point of p for intent, following
+// the approach of common CMMs: the v4 perceptual black for LUT-based v4
+// profiles, a PCS round trip through output CMYK profiles and the colour of
+// device black otherwise. The result is neutral.
+func (p *ICCProfile) blackPoint(intent RenderingIntent, output bool) ([3]float64, error) {
+	major, _ := p.Version()
+	if major >= 4 && (intent == IntentPerceptual || intent == IntentSaturation) &&
+		(p.HasTag(intentTag(p, "A2B", intent)) || p.HasTag(intentTag(p, "B2A", intent))) {
+		return perceptualBlack, nil
+	}
+	var xyz []float64
+	if p.ColorSpace() == "CMYK" && p.HasTag(intentTag(p, "B2A", intent)) {
+		if intent == IntentAbsoluteColorimetric {
+			intent = IntentRelativeColorimetric
+		}
+		out, err := p.fromPCSStages(intent)
+		if err != nil {
+			return [3]float64{}, err
+		}
+		in, err := p.toPCSStages(intent)
+		if err != nil {
+			return [3]float64{}, err
+		}
+		if xyz, err = runStages(append(out, in...), LabToXYZ([]float64{0, 0, 0})); err != nil {
+			return [3]float64{}, err
+		}
+	} else {
+		in, err := p.toPCSStages(intent)
+		if err != nil {
+			return [3]float64{}, err
+		}
+		black := make([]float64, numChannels(p.ColorSpace()))
+		if p.ColorSpace() == "CMYK" {
+			for i := range black {
+				black[i] = 1
+			}
+		}
+		if xyz, err = runStages(in, black); err != nil {
+			return [3]float64{}, err
+		}
+	}
+	lab := XYZToLab(xyz)
+	l := lab[0]
+	if l < 0 || l > 50 {
+		l = 0
+	}
+	bp := LabToXYZ([]float64{l, 0, 0})
+	return [3]float64{bp[0], bp[1], bp[2]}, nil
+}
+
+func runStages(stages []stage, v []float64) ([]float64, error) {
+	for _, s := range stages {
+		var err error
+		if v, err = s(v); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// bpcStage scales XYZ so that src black maps to dst black while the D50
+// white stays in place.
+func bpcStage(src, dst [3]float64) stage {
+	white := [3]float64{D50X, D50Y, D50Z}
+	var scale, offset [3]float64
+	for i, w := range white {
+		d := src[i] - w
+		scale[i] = (dst[i] - w) / d
+		offset[i] = -w * (dst[i] - src[i]) / d
+	}
+	return func(v []float64) ([]float64, error) {
+		for i := range scale {
+			v[i] = scale[i]*v[i] + offset[i]
+		}
+		return v, nil
+	}
+}
+
+func scaleStage(f [3]float64) stage {
+	return func(v []float64) ([]float64, error) {
+		for i := range f {
+			v[i] *= f[i]
+		}
+		return v, nil
+	}
+}
+
+func toXYZ(space string) stage {
+	return func(v []float64) ([]float64, error) {
+		if space == "Lab " {
+			return LabToXYZ(v), nil
+		}
+		return v, nil
+	}
+}
+
+func fromXYZ(space string) stage {
+	return func(v []float64) ([]float64, error) {
+		if space == "Lab " {
+			return XYZToLab(v), nil
+		}
+		return v, nil
+	}
+}
+
+// valueEncoding describes how a LUT tag maps the values of a colour space
+// to its [0,1] inputs and outputs.
+type valueEncoding int
+
+const (
+	encDevice    valueEncoding = iota
+	encXYZ                     // u1Fixed15Number
+	encLab                     // ICC v4 and lut8Type Lab
+	encLabLegacy               // lut16Type Lab, where 0xFF00 is L* = 100
+)
+
+func tagEncoding(space string, typ uint32) valueEncoding {
+	switch space {
+	case "XYZ ":
+		return encXYZ
+	case "Lab ":
+		if typ == typeMFT2 {
+			return encLabLegacy
+		}
+		return encLab
+	}
+	return encDevice
+}
+
+const (
+	xyzScale    = 65535.0 / 32768.0
+	legacyScale = 65535.0 / 65280.0
+)
+
+func encodeValues(enc valueEncoding, v []float64) []float64 {
+	out := make([]float64, len(v))
+	switch enc {
+	case encXYZ:
+		for i, x := range v {
+			out[i] = x / xyzScale
+		}
+	case encLab, encLabLegacy:
+		out[0] = v[0] / 100
+		for i := 1; i < len(v); i++ {
+			out[i] = (v[i] + 128) / 255
+		}
+		if enc == encLabLegacy {
+			for i := range out {
+				out[i] /= legacyScale
+			}
+		}
+	default:
+		for i, x := range v {
+			out[i] = pdfnum.Clamp01(x)
+		}
+	}
+	return out
+}
+
+func decodeValues(enc valueEncoding, v []float64) []float64 {
+	out := make([]float64, len(v))
+	switch enc {
+	case encXYZ:
+		for i, x := range v {
+			out[i] = x * xyzScale
+		}
+	case encLab, encLabLegacy:
+		scale := 1.0
+		if enc == encLabLegacy {
+			scale = legacyScale
+		}
+		out[0] = v[0] * scale * 100
+		for i := 1; i < len(v); i++ {
+			out[i] = v[i]*scale*255 - 128
+		}
+	default:
+		for i, x := range v {
+			out[i] = pdfnum.Clamp01(x)
+		}
+	}
+	return out
+}
+
+func lutStage(t Transform, in, out valueEncoding) stage {
+	return func(v []float64) ([]float64, error) {
+		res, err := t.Convert(encodeValues(in, v))
+		if err != nil {
+			return nil, err
+		}
+		return decodeValues(out, res), nil
+	}
+}
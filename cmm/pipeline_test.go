@@ -0,0 +1,355 @@
+package cmm
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/wudi/pdfkit/internal/pdfnum"
+)
+
+// lutABTag encodes a lutAtoBType or lutBtoAType tag. Curve slices may be
+// nil; clut holds 16-bit CLUT entries for the given grid.
+func lutABTag(sig string, inCh, outCh int, b, m, a [][]byte, matrix []float64, grid []int, clut []float64) []byte {
+	data := make([]byte, 32)
+	copy(data[0:4], sig)
+	data[8], data[9] = byte(inCh), byte(outCh)
+	section := func(at int, body []byte) {
+		binary.BigEndian.PutUint32(data[at:], uint32(len(data)))
+		data = append(data, body...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	curves := func(at int, cs [][]byte) {
+		if cs == nil {
+			return
+		}
+		var body []byte
+		for _, c := range cs {
+			body = append(body, c...)
+			for len(body)%4 != 0 {
+				body = append(body, 0)
+			}
+		}
+		section(at, body)
+	}
+	curves(12, b)
+	if matrix != nil {
+		body := make([]byte, 48)
+		for i, v := range matrix {
+			binary.BigEndian.PutUint32(body[4*i:], toS15Fixed16(v))
+		}
+		section(16, body)
+	}
+	curves(20, m)
+	if grid != nil {
+		body := make([]byte, 20+2*len(clut))
+		for i, g := range grid {
+			body[i] = byte(g)
+		}
+		body[16] = 2
+		for i, v := range clut {
+			binary.BigEndian.PutUint16(body[20+2*i:], uint16(math.Round(pdfnum.Clamp01(v)*65535)))
+		}
+		section(24, body)
+	}
+	curves(28, a)
+	return data
+}
+
+func identityCurves(n int) [][]byte {
+	out := make([][]byte, n)
+	for i := range out {
+		out[i] = paraTag(0, 1)
+	}
+	return out
+}
+
+// sampleGrid evaluates f on a grid of g points per input channel.
+func sampleGrid(inCh, g int, f func([]float64) []float64) []float64 {
+	points := int(math.Pow(float64(g), float64(inCh)))
+	var out []float64
+	in := make([]float64, inCh)
+	for n := 0; n < points; n++ {
+		rem := n
+		for i := inCh - 1; i >= 0; i-- {
+			in[i] = float64(rem%g) / float64(g-1)
+			rem /= g
+		}
+		out = append(out, f(in)...)
+	}
+	return out
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// naiveCMYK is the reference CMYK to sRGB conversion of the test press
+// profile.
+func naiveCMYK(in []float64) []float64 {
+	k := 1 - in[3]
+	return []float64{(1 - in[0]) * k, (1 - in[1]) * k, (1 - in[2]) * k}
+}
+
+// pressProfile returns a CMYK output profile with Lab PCS whose A2B0 maps
+// CMYK through naiveCMYK and the sRGB primaries.
+func pressProfile(t *testing.T) *ICCProfile {
+	t.Helper()
+	toLab := func(in []float64) []float64 {
+		rgb := naiveCMYK(in)
+		r, g, b := srgbToLinear(rgb[0]), srgbToLinear(rgb[1]), srgbToLinear(rgb[2])
+		xyz := []float64{
+			0.4360747*r + 0.3850649*g + 0.1430804*b,
+			0.2225045*r + 0.7168786*g + 0.0606169*b,
+			0.0139322*r + 0.0971045*g + 0.7141733*b,
+		}
+		return encodeValues(encLab, XYZToLab(xyz))
+	}
+	a2b := lutABTag("mAB ", 4, 3, identityCurves(3), nil, identityCurves(4), nil,
+		[]int{9, 9, 9, 9}, sampleGrid(4, 9, toLab))
+	data := encodeProfile("prtr", "CMYK", "Lab ", 0x04300000, map[string][]byte{
+		"desc": mlucTag("Test press"),
+		"wtpt": xyzTag(D50X, D50Y, D50Z),
+		"A2B0": a2b,
+	})
+	p, err := NewICCProfile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestSRGBProfile(t *testing.T) {
+	p := SRGBProfile()
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if p.Name() != "sRGB IEC61966-2.1" {
+		t.Errorf("Name = %q", p.Name())
+	}
+	xyz, _ := NewICCProfile(makeProfileData("XYZ "))
+	tr, err := NewFactory().NewChainTransform([]Profile{p, xyz}, TransformOptions{Intent: IntentRelativeColorimetric})
+	if err != nil {
+		t.Fatal(err)
+	}
+	white, _ := tr.Convert([]float64{1, 1, 1})
+	if math.Abs(white[0]-D50X) > 0.001 || math.Abs(white[1]-D50Y) > 0.001 || math.Abs(white[2]-D50Z) > 0.002 {
+		t.Errorf("white = %v", white)
+	}
+	mid, _ := tr.Convert([]float64{0.5, 0.5, 0.5})
+	if math.Abs(mid[1]-srgbToLinear(0.5)) > 0.001 {
+		t.Errorf("mid gray Y = %f, want %f", mid[1], srgbToLinear(0.5))
+	}
+
+	// sRGB to itself through the PCS is lossless.
+	rt, err := NewFactory().NewChainTransform([]Profile{p, p}, TransformOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := []float64{0.1, 0.5, 0.9}
+	out, _ := rt.Convert(in)
+	for i := range in {
+		if math.Abs(out[i]-in[i]) > 0.001 {
+			t.Errorf("round trip %v = %v", in, out)
+			break
+		}
+	}
+}
+
+func TestCMYKToSRGB(t *testing.T) {
+	press := pressProfile(t)
+	tr, err := NewFactory().NewTransform(press, SRGBProfile(), IntentRelativeColorimetric)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range [][]float64{
+		{0, 0, 0, 0}, {1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1},
+		{0.2, 0.4, 0.6, 0.1}, {0.7, 0.1, 0.3, 0.5},
+	} {
+		out, err := tr.Convert(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := naiveCMYK(in)
+		for i := range want {
+			if math.Abs(out[i]-want[i]) > 0.02 {
+				t.Errorf("CMYK %v -> %v, want %v", in, out, want)
+				break
+			}
+		}
+	}
+
+	// Bulk conversion through the cached grid agrees with the pipeline.
+	pt, ok := tr.(PixelTransform)
+	if !ok {
+		t.Fatalf("%T is not a PixelTransform", tr)
+	}
+	src := []byte{0, 0, 0, 0, 255, 0, 0, 0, 51, 102, 153, 25, 180, 20, 70, 128}
+	dst := make([]byte, len(src)/4*3)
+	if err := pt.ConvertPixels(dst, src); err != nil {
+		t.Fatal(err)
+	}
+	for p := 0; p < len(src)/4; p++ {
+		in := make([]float64, 4)
+		for i := range in {
+			in[i] = float64(src[4*p+i]) / 255
+		}
+		want, _ := tr.Convert(in)
+		for i := range want {
+			if math.Abs(float64(dst[3*p+i])-want[i]*255) > 2 {
+				t.Errorf("pixel %d = %v, want %v", p, dst[3*p:3*p+3], want)
+				break
+			}
+		}
+	}
+}
+
+func TestRenderingIntents(t *testing.T) {
+	half := func(in []float64) []float64 { return []float64{in[0] / 2, in[1] / 2, in[2] / 2} }
+	rel := lutABTag("mAB ", 3, 3, identityCurves(3), nil, nil, nil, nil, nil)
+	perc := lutABTag("mAB ", 3, 3, identityCurves(3), nil, identityCurves(3), nil,
+		[]int{2, 2, 2}, sampleGrid(3, 2, half))
+	data := encodeProfile("scnr", "RGB ", "XYZ ", 0x04300000, map[string][]byte{
+		"desc": mlucTag("Intents"),
+		"wtpt": xyzTag(D50X/2, D50Y/2, D50Z/2),
+		"A2B0": perc,
+		"A2B1": rel,
+	})
+	p, err := NewICCProfile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xyz, _ := NewICCProfile(makeProfileData("XYZ "))
+	in := []float64{0.2, 0.4, 0.4}
+	for _, tc := range []struct {
+		intent RenderingIntent
+		scale  float64
+	}{
+		{IntentPerceptual, 0.5},
+		{IntentRelativeColorimetric, 1},
+		{IntentSaturation, 0.5}, // falls back to A2B0
+		{IntentAbsoluteColorimetric, 0.5},
+	} {
+		tr, err := NewFactory().NewTransform(p, xyz, tc.intent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, _ := tr.Convert(in)
+		for i := range in {
+			if want := in[i] * xyzScale * tc.scale; math.Abs(out[i]-want) > 0.001 {
+				t.Errorf("intent %d: %v, want scale %v", tc.intent, out, tc.scale)
+				break
+			}
+		}
+	}
+}
+
+func TestBlackPointCompensation(t *testing.T) {
+	// A gray input profile whose darkest colour is well above PCS black.
+	lift := make([]byte, 12+2*2)
+	copy(lift[0:4], "curv")
+	binary.BigEndian.PutUint32(lift[8:12], 2)
+	binary.BigEndian.PutUint16(lift[12:14], 0x1000)
+	binary.BigEndian.PutUint16(lift[14:16], 0xFFFF)
+	gray, err := NewICCProfile(encodeProfile("mntr", "GRAY", "XYZ ", 0x02100000, map[string][]byte{
+		"desc": mlucTag("Lifted gray"),
+		"wtpt": xyzTag(D50X, D50Y, D50Z),
+		"kTRC": lift,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := []Profile{gray, SRGBProfile()}
+	plain, err := NewFactory().NewChainTransform(chain, TransformOptions{Intent: IntentRelativeColorimetric})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bpc, err := NewFactory().NewChainTransform(chain, TransformOptions{Intent: IntentRelativeColorimetric, BlackPointCompensation: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	black, _ := plain.Convert([]float64{0})
+	if black[0] < 0.2 {
+		t.Errorf("uncompensated black = %v", black)
+	}
+	black, _ = bpc.Convert([]float64{0})
+	white, _ := bpc.Convert([]float64{1})
+	for i := range black {
+		if black[i] > 0.01 || white[i] < 0.99 {
+			t.Errorf("compensated black = %v, white = %v", black, white)
+			break
+		}
+	}
+}
+
+func TestDeviceLink(t *testing.T) {
+	invert := func(in []float64) []float64 { return []float64{1 - in[0], 1 - in[1], 1 - in[2], 0} }
+	link, err := NewICCProfile(encodeProfile("link", "RGB ", "CMYK", 0x04300000, map[string][]byte{
+		"desc": mlucTag("RGB to CMY"),
+		"A2B0": lutABTag("mAB ", 3, 4, identityCurves(4), nil, identityCurves(3), nil,
+			[]int{2, 2, 2}, sampleGrid(3, 2, invert)),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := link.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	tr, err := NewFactory().NewChainTransform([]Profile{link}, TransformOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := tr.Convert([]float64{0.2, 0.4, 0.6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{0.8, 0.6, 0.4, 0}
+	for i := range want {
+		if math.Abs(out[i]-want[i]) > 0.001 {
+			t.Fatalf("link = %v, want %v", out, want)
+		}
+	}
+}
+
+func TestParametricCurves(t *testing.T) {
+	srgb := parametricCurve{kind: 3, params: [7]float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045}}
+	for _, x := range []float64{0, 0.02, 0.5, 1} {
+		if got, want := srgb.Eval(x), srgbToLinear(x); math.Abs(got-want) > 1e-9 {
+			t.Errorf("type 3 at %v = %v, want %v", x, got, want)
+		}
+	}
+	inv := inverseCurve(srgb)
+	for _, x := range []float64{0.01, 0.3, 0.8} {
+		if got := inv.Eval(srgb.Eval(x)); math.Abs(got-x) > 0.001 {
+			t.Errorf("inverse at %v = %v", x, got)
+		}
+	}
+	c, _, err := parseCurve(paraTag(4, 1, 0.5, 0, 0.1, 0.2, 0.25, 0.05))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Eval(0.1); math.Abs(got-0.06) > 1e-4 {
+		t.Errorf("type 4 below d = %v", got)
+	}
+	if got := c.Eval(0.6); math.Abs(got-0.55) > 1e-4 {
+		t.Errorf("type 4 above d = %v", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	p, err := NewICCProfile(encodeProfile("prtr", "CMYK", "Lab ", 0x04300000, map[string][]byte{
+		"desc": mlucTag("Incomplete"),
+		"A2B0": lutABTag("mAB ", 4, 3, identityCurves(3), nil, nil, nil, nil, nil),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Validate(); err == nil {
+		t.Error("output profile without B2A0 validated")
+	}
+}
@@ -0,0 +1,119 @@
+package cmm
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"sync"
+	"unicode/utf16"
+)
+
+var (
+	srgbOnce    sync.Once
+	srgbProfile *ICCProfile
+)
+
+// SRGBProfile returns an ICC v4 display profile for sRGB (IEC 61966-2-1),
+// useful as the destination of on-screen previews.
+func SRGBProfile() *ICCProfile {
+	srgbOnce.Do(func() {
+		trc := paraTag(3, 2.4, 1/1.055, 0.055/1.055, 1/12.92, 0.04045)
+		data := encodeProfile("mntr", "RGB ", "XYZ ", 0x04300000, map[string][]byte{
+			"desc": mlucTag("sRGB IEC61966-2.1"),
+			"cprt": mlucTag("No copyright, use freely"),
+			"wtpt": xyzTag(D50X, D50Y, D50Z),
+			"rXYZ": xyzTag(0.4360747, 0.2225045, 0.0139322),
+			"gXYZ": xyzTag(0.3850649, 0.7168786, 0.0971045),
+			"bXYZ": xyzTag(0.1430804, 0.0606169, 0.7141733),
+			"rTRC": trc,
+			"gTRC": trc,
+			"bTRC": trc,
+		})
+		p, err := NewICCProfile(data)
+		if err != nil {
+			panic("cmm: invalid built-in sRGB profile: " + err.Error())
+		}
+		srgbProfile = p
+	})
+	return srgbProfile
+}
+
+// encodeProfile serializes a profile with the given header fields and
+// tags. Tags with identical data share storage.
+func encodeProfile(class, space, pcs string, version uint32, tags map[string][]byte) []byte {
+	sigs := make([]string, 0, len(tags))
+	for sig := range tags {
+		sigs = append(sigs, sig)
+	}
+	sort.Strings(sigs)
+
+	header := make([]byte, 132+12*len(sigs))
+	binary.BigEndian.PutUint32(header[8:12], version)
+	copy(header[12:16], class)
+	copy(header[16:20], space)
+	copy(header[20:24], pcs)
+	copy(header[36:40], "acsp")
+	binary.BigEndian.PutUint32(header[68:72], toS15Fixed16(D50X))
+	binary.BigEndian.PutUint32(header[72:76], toS15Fixed16(D50Y))
+	binary.BigEndian.PutUint32(header[76:80], toS15Fixed16(D50Z))
+	binary.BigEndian.PutUint32(header[128:132], uint32(len(sigs)))
+
+	data := header
+	offsets := make(map[string]int)
+	for i, sig := range sigs {
+		tag := tags[sig]
+		off, ok := offsets[string(tag)]
+		if !ok {
+			off = len(data)
+			offsets[string(tag)] = off
+			data = append(data, tag...)
+			for len(data)%4 != 0 {
+				data = append(data, 0)
+			}
+		}
+		entry := data[132+12*i:]
+		copy(entry[0:4], sig)
+		binary.BigEndian.PutUint32(entry[4:8], uint32(off))
+		binary.BigEndian.PutUint32(entry[8:12], uint32(len(tag)))
+	}
+	binary.BigEndian.PutUint32(data[0:4], uint32(len(data)))
+	return data
+}
+
+func toS15Fixed16(f float64) uint32 {
+	return uint32(int32(math.Round(f * 65536.0)))
+}
+
+func xyzTag(x, y, z float64) []byte {
+	b := make([]byte, 20)
+	copy(b[0:4], "XYZ ")
+	binary.BigEndian.PutUint32(b[8:12], toS15Fixed16(x))
+	binary.BigEndian.PutUint32(b[12:16], toS15Fixed16(y))
+	binary.BigEndian.PutUint32(b[16:20], toS15Fixed16(z))
+	return b
+}
+
+func paraTag(kind uint16, params ...float64) []byte {
+	b := make([]byte, 12+4*len(params))
+	copy(b[0:4], "para")
+	binary.BigEndian.PutUint16(b[8:10], kind)
+	for i, p := range params {
+		binary.BigEndian.PutUint32(b[12+4*i:], toS15Fixed16(p))
+	}
+	return b
+}
+
+func mlucTag(text string) []byte {
+	units := utf16.Encode([]rune(text))
+	b := make([]byte, 28+2*len(units))
+	copy(b[0:4], "mluc")
+	binary.BigEndian.PutUint32(b[8:12], 1)
+	binary.BigEndian.PutUint32(b[12:16], 12)
+	copy(b[16:20], "enUS")
+	binary.BigEndian.PutUint32(b[20:24], uint32(2*len(units)))
+	binary.BigEndian.PutUint32(b[24:28], 28)
+	for i, u := range units {
+		binary.BigEndian.PutUint16(b[28+2*i:], u)
+	}
+	return b
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"math"
+
+	"github.com/wudi/pdfkit/internal/pdfnum"
 )
 
 type basicTransform struct {
@@ -18,22 +20,8 @@ func (t *basicTransform) Convert(in []float64) ([]float64, error) {
 		return nil, fmt.Errorf("input channels mismatch: expected %d, got %d", srcCh, len(in))
 	}
 
-	// 2. Try ICC-based conversion if available
-	if srcICC, ok := t.src.(*ICCProfile); ok {
-		if dstICC, ok := t.dst.(*ICCProfile); ok {
-			// Try generic ICC conversion (LUT or Matrix)
-			out, err := convertICC(srcICC, dstICC, in)
-			if err == nil {
-				return out, nil
-			}
-			// Fallback if ICC fails (e.g. complex LUTs)
-		}
-	}
-
-	// 3. Simple conversions (fallback)
-	// If we had a real CMM, we would use the LUTs here.
-	// For now, we implement basic conversions between standard spaces if possible.
-
+	// 2. Simple conversions between standard spaces, used when the
+	// profiles do not describe their transforms.
 	dstCh := numChannels(t.dst.ColorSpace())
 	out := make([]float64, dstCh)
 
@@ -97,8 +85,8 @@ func (t *basicTransform) Convert(in []float64) ([]float64, error) {
 }
 
 type matrixTRCTransform struct {
-	srcGamma [3]float64
-	matrix   [9]float64 // rX, gX, bX, rY, gY, bY, rZ, gZ, bZ
+	curves [3]Curve
+	matrix [9]float64 // rX, gX, bX, rY, gY, bY, rZ, gZ, bZ
 }
 
 func (t *matrixTRCTransform) Convert(in []float64) ([]float64, error) {
@@ -106,9 +94,9 @@ func (t *matrixTRCTransform) Convert(in []float64) ([]float64, error) {
 		return nil, errors.New("input too short")
 	}
 	// 1. Linearize
-	r := math.Pow(in[0], t.srcGamma[0])
-	g := math.Pow(in[1], t.srcGamma[1])
-	b := math.Pow(in[2], t.srcGamma[2])
+	r := t.curves[0].Eval(pdfnum.Clamp01(in[0]))
+	g := t.curves[1].Eval(pdfnum.Clamp01(in[1]))
+	b := t.curves[2].Eval(pdfnum.Clamp01(in[2]))
 
 	// 2. Matrix Multiply (RGB -> XYZ)
 	x := t.matrix[0]*r + t.matrix[1]*g + t.matrix[2]*b
@@ -132,21 +120,15 @@ func tryCreateMatrixTRC(p *ICCProfile) (*matrixTRCTransform, error) {
 		return nil, err
 	}
 
-	rTRC, err := p.ReadCurveTag("rTRC")
-	if err != nil {
-		return nil, err
-	}
-	gTRC, err := p.ReadCurveTag("gTRC")
-	if err != nil {
-		return nil, err
-	}
-	bTRC, err := p.ReadCurveTag("bTRC")
-	if err != nil {
-		return nil, err
+	var curves [3]Curve
+	for i, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		if curves[i], err = p.ReadCurve(sig); err != nil {
+			return nil, err
+		}
 	}
 
 	return &matrixTRCTransform{
-		srcGamma: [3]float64{rTRC, gTRC, bTRC},
+		curves: curves,
 		matrix: [9]float64{
 			rXYZ[0], gXYZ[0], bXYZ[0], // X row
 			rXYZ[1], gXYZ[1], bXYZ[1], // Y row
@@ -165,8 +147,15 @@ func numChannels(cs string) int {
 		return 1
 	case "Lab ":
 		return 3
-	case "XYZ ":
+	case "XYZ ", "Luv ", "YCbr", "Yxy ", "HSV ", "HLS ", "CMY ":
 		return 3
+	case "2CLR", "3CLR", "4CLR", "5CLR", "6CLR", "7CLR", "8CLR",
+		"9CLR", "ACLR", "BCLR", "CCLR", "DCLR", "ECLR", "FCLR":
+		n := cs[0] - '0'
+		if cs[0] >= 'A' {
+			n = cs[0] - 'A' + 10
+		}
+		return int(n)
 	default:
 		return 0
 	}
@@ -179,66 +168,6 @@ func max(a, b float64) float64 {
 	return b
 }
 
-func convertICC(src, dst *ICCProfile, in []float64) ([]float64, error) {
-	// 1. Src -> PCS
-	toPCS, err := createToPCS(src)
-	if err != nil {
-		return nil, err
-	}
-	pcsSrc, err := toPCS.Convert(in)
-	if err != nil {
-		return nil, err
-	}
-
-	// Check PCS mismatch
-	srcPCS := src.PCS()
-	dstPCS := dst.PCS()
-
-	var pcsDst []float64
-	if srcPCS == dstPCS {
-		pcsDst = pcsSrc
-	} else {
-		// Convert PCS -> PCS (XYZ <-> Lab)
-		if srcPCS == "XYZ " && dstPCS == "Lab " {
-			pcsDst = XYZToLab(pcsSrc)
-		} else if srcPCS == "Lab " && dstPCS == "XYZ " {
-			pcsDst = LabToXYZ(pcsSrc)
-		} else {
-			// Fallback or error?
-			pcsDst = pcsSrc
-		}
-	}
-
-	// 2. PCS -> Dst
-	fromPCS, err := createFromPCS(dst)
-	if err != nil {
-		return nil, err
-	}
-	return fromPCS.Convert(pcsDst)
-}
-
-func createToPCS(p *ICCProfile) (Transform, error) {
-	// Try A2B0 (Device to PCS)
-	if lut, err := p.ReadLUTTag("A2B0"); err == nil {
-		return lut, nil
-	}
-	// Try Matrix/TRC
-	return tryCreateMatrixTRC(p)
-}
-
-func createFromPCS(p *ICCProfile) (Transform, error) {
-	// Try B2A0 (PCS to Device)
-	if lut, err := p.ReadLUTTag("B2A0"); err == nil {
-		return lut, nil
-	}
-	// Try Matrix/TRC (Inverse)
-	mat, err := tryCreateMatrixTRC(p)
-	if err != nil {
-		return nil, err
-	}
-	return mat.Inverse()
-}
-
 // D50 White Point for XYZ <-> Lab conversion
 const (
 	D50X = 0.9642
@@ -303,15 +232,16 @@ func (t *matrixTRCTransform) Inverse() (Transform, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &inverseMatrixTRCTransform{
-		destGamma: t.srcGamma,
-		matrix:    invMat,
-	}, nil
+	inv := &inverseMatrixTRCTransform{matrix: invMat}
+	for i, c := range t.curves {
+		inv.curves[i] = inverseCurve(c)
+	}
+	return inv, nil
 }
 
 type inverseMatrixTRCTransform struct {
-	destGamma [3]float64
-	matrix    [9]float64 // XYZ -> Linear RGB matrix
+	curves [3]Curve   // inverse tone curves
+	matrix [9]float64 // XYZ -> Linear RGB matrix
 }
 
 func (t *inverseMatrixTRCTransform) Convert(in []float64) ([]float64, error) {
@@ -325,11 +255,10 @@ func (t *inverseMatrixTRCTransform) Convert(in []float64) ([]float64, error) {
 	gLin := t.matrix[3]*x + t.matrix[4]*y + t.matrix[5]*z
 	bLin := t.matrix[6]*x + t.matrix[7]*y + t.matrix[8]*z
 
-	// 2. Apply Gamma (Linear RGB -> RGB)
-	// val = pow(lin, 1/gamma)
-	r := math.Pow(math.Max(0, rLin), 1.0/t.destGamma[0])
-	g := math.Pow(math.Max(0, gLin), 1.0/t.destGamma[1])
-	b := math.Pow(math.Max(0, bLin), 1.0/t.destGamma[2])
+	// 2. Apply inverse tone curves (Linear RGB -> RGB)
+	r := t.curves[0].Eval(pdfnum.Clamp01(rLin))
+	g := t.curves[1].Eval(pdfnum.Clamp01(gLin))
+	b := t.curves[2].Eval(pdfnum.Clamp01(bLin))
 
 	return []float64{r, g, b}, nil
 }
@@ -0,0 +1,340 @@
+package pdfa
+
+import (
+	"math"
+	"strings"
+
+	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// annotationTypes are the annotation types of PDF 1.4, which PDF/A-1
+// builds on, and of PDF 1.7, which PDF/A-2 and -3 build on.
+var (
+	annotationTypes14 = set("Text", "Link", "FreeText", "Line", "Square", "Circle", "Highlight", "Underline",
+		"Squiggly", "StrikeOut", "Stamp", "Ink", "Popup", "FileAttachment", "Sound", "Movie", "Widget",
+		"PrinterMark", "TrapNet")
+	annotationTypes17 = set("Text", "Link", "FreeText", "Line", "Square", "Circle", "Polygon", "PolyLine",
+		"Highlight", "Underline", "Squiggly", "StrikeOut", "Stamp", "Caret", "Ink", "Popup", "FileAttachment",
+		"Sound", "Movie", "Widget", "Screen", "PrinterMark", "TrapNet", "Watermark", "3D")
+	annotationTypes20 = set("Text", "Link", "FreeText", "Line", "Square", "Circle", "Polygon", "PolyLine",
+		"Highlight", "Underline", "Squiggly", "StrikeOut", "Stamp", "Caret", "Ink", "Popup", "FileAttachment",
+		"Sound", "Movie", "Widget", "Screen", "PrinterMark", "TrapNet", "Watermark", "3D", "Redact",
+		"Projection", "RichMedia")
+)
+
+// forbiddenActions are the action types no part of PDF/A permits.
+var forbiddenActions = set("Launch", "Sound", "Movie", "ResetForm", "ImportData", "JavaScript",
+	"Hide", "SetOCGState", "Rendition", "Trans", "GoTo3DView", "RichMediaExecute")
+
+// namedActions are the named actions PDF/A permits.
+var namedActions = set("NextPage", "PrevPage", "FirstPage", "LastPage")
+
+func set(items ...string) map[string]bool {
+	m := make(map[string]bool, len(items))
+	for _, s := range items {
+		m[s] = true
+	}
+	return m
+}
+
+// annotationAllowed reports whether level permits annotations of subtype.
+func annotationAllowed(subtype string, level Level) bool {
+	switch {
+	case level.IsLevelA1():
+		return annotationTypes14[subtype] && subtype != "FileAttachment" && subtype != "Sound" && subtype != "Movie"
+	case level.IsLevelA4():
+		switch subtype {
+		case "Sound", "Movie", "Screen":
+			return false
+		case "3D", "RichMedia":
+			return level == PDFA4E
+		}
+		return annotationTypes20[subtype]
+	}
+	switch subtype {
+	case "Sound", "Movie", "Screen", "3D":
+		return false
+	}
+	return annotationTypes17[subtype]
+}
+
+// actionAllowed reports whether level permits the action a.
+func actionAllowed(a semantic.Action, level Level) bool {
+	if a == nil {
+		return true
+	}
+	switch act := a.(type) {
+	case semantic.NamedAction:
+		return namedActions[act.Name]
+	case *semantic.NamedAction:
+		return namedActions[act.Name]
+	case semantic.URIAction:
+		return !javascriptURI(act.URI)
+	case *semantic.URIAction:
+		return !javascriptURI(act.URI)
+	}
+	t := a.ActionType()
+	if level.IsLevelA4() && (t == "GoTo3DView" || t == "RichMediaExecute") {
+		return level == PDFA4E
+	}
+	return !forbiddenActions[t]
+}
+
+func javascriptURI(uri string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(uri)), "javascript:")
+}
+
+// annotationAction returns the action an annotation triggers, if any.
+func annotationAction(a semantic.Annotation) semantic.Action {
+	switch a := a.(type) {
+	case *semantic.LinkAnnotation:
+		if a.Action == nil && a.URI != "" {
+			return semantic.URIAction{URI: a.URI}
+		}
+		return a.Action
+	case *semantic.ScreenAnnotation:
+		return a.Action
+	}
+	return nil
+}
+
+// requiredFlags and forbiddenFlags are the annotation flags PDF/A requires
+// set and clear.
+const (
+	requiredFlags  = semantic.AnnotFlagPrint
+	forbiddenFlags = semantic.AnnotFlagInvisible | semantic.AnnotFlagHidden | semantic.AnnotFlagNoView | semantic.AnnotFlagToggleNoView
+)
+
+// flagsExempt reports whether annotations of subtype are exempt from the
+// flag requirements: PDF/A-2 and later exempt pop-ups.
+func flagsExempt(subtype string, level Level) bool {
+	return subtype == "Popup" && !level.IsLevelA1()
+}
+
+// needsAppearance reports whether level requires an annotation to have a
+// normal appearance. Pop-ups, links and annotations of zero area are
+// exempt.
+func needsAppearance(a semantic.Annotation) bool {
+	base := a.Base()
+	switch base.Subtype {
+	case "Popup", "Link":
+		return false
+	}
+	r := base.RectVal
+	return r.URX != r.LLX && r.URY != r.LLY
+}
+
+// hasAppearance reports whether a has a normal appearance, directly or
+// through the form field of a widget.
+func hasAppearance(a semantic.Annotation) bool {
+	base := a.Base()
+	if base.AppearanceForm != nil || len(base.Appearance) > 0 {
+		return true
+	}
+	if w, ok := a.(*semantic.WidgetAnnotation); ok && w.Field != nil {
+		return w.Field.GetAppearanceForm() != nil || len(w.Field.GetAppearance()) > 0
+	}
+	return false
+}
+
+func (v *validator) checkAnnotations() {
+	for i, p := range v.doc.Pages {
+		for _, a := range p.Annotations {
+			if a == nil || a.Base() == nil {
+				continue
+			}
+			base := a.Base()
+			loc := pageLocation(i) + " Annotation " + base.Subtype
+			if !annotationAllowed(base.Subtype, v.level) {
+				v.add(ruleAnnotationType, loc, base.Subtype)
+				continue
+			}
+			if !flagsExempt(base.Subtype, v.level) && (base.Flags&requiredFlags == 0 || base.Flags&forbiddenFlags != 0) {
+				v.add(ruleAnnotationFlags, loc, "")
+			}
+			if needsAppearance(a) && !hasAppearance(a) {
+				v.add(ruleAnnotationAppearance, loc, "")
+			}
+			if act := annotationAction(a); !actionAllowed(act, v.level) {
+				v.add(ruleAction, loc, act.ActionType())
+			}
+		}
+	}
+	if !actionAllowed(v.doc.OpenAction, v.level) {
+		v.add(ruleAction, "Catalog OpenAction", v.doc.OpenAction.ActionType())
+	}
+	if v.doc.Names != nil && len(v.doc.Names.JavaScript) > 0 {
+		v.add(ruleAction, "Names", "document JavaScript")
+	}
+}
+
+func (v *validator) checkForms() {
+	form := v.doc.AcroForm
+	if form == nil {
+		return
+	}
+	if form.NeedAppearances {
+		v.add(ruleNeedAppearances, "AcroForm", "")
+	}
+	if len(form.XFA) > 0 {
+		v.add(ruleXFA, "AcroForm", "")
+	}
+	for _, f := range form.Fields {
+		if f == nil {
+			continue
+		}
+		loc := "Field " + f.FieldName()
+		if flags := f.GetAnnotationFlags(); flags&requiredFlags == 0 || flags&forbiddenFlags != 0 {
+			v.add(ruleAnnotationFlags, loc, "")
+		}
+		if f.GetAppearanceForm() == nil && len(f.GetAppearance()) == 0 {
+			r := f.FieldRect()
+			if r.URX != r.LLX && r.URY != r.LLY {
+				v.add(ruleAnnotationAppearance, loc, "")
+			}
+		}
+		if aa := f.GetAdditionalActions(); aa != nil && (aa.K != nil || aa.F != nil || aa.V != nil || aa.C != nil) {
+			v.add(ruleFieldActions, loc, "")
+		}
+	}
+}
+
+// fixAnnotations removes the annotations and actions the level forbids,
+// corrects annotation flags and generates missing appearances.
+func (e *enforcement) fixAnnotations() error {
+	for _, p := range e.doc.Pages {
+		if err := checkCancelled(e.ctx); err != nil {
+			return err
+		}
+		kept := p.Annotations[:0:0]
+		for _, a := range p.Annotations {
+			if a == nil || a.Base() == nil || !annotationAllowed(a.Base().Subtype, e.level) {
+				continue
+			}
+			base := a.Base()
+			if !flagsExempt(base.Subtype, e.level) {
+				if flags := base.Flags&^forbiddenFlags | requiredFlags; flags != base.Flags {
+					base.Flags = flags
+					base.Dirty = true
+				}
+			}
+			if !actionAllowed(annotationAction(a), e.level) {
+				switch a := a.(type) {
+				case *semantic.LinkAnnotation:
+					a.Action, a.URI = nil, ""
+				case *semantic.ScreenAnnotation:
+					a.Action = nil
+				}
+				base.Dirty = true
+			}
+			kept = append(kept, a)
+		}
+		if len(kept) != len(p.Annotations) {
+			p.Annotations = kept
+			p.Dirty = true
+		}
+	}
+	if !actionAllowed(e.doc.OpenAction, e.level) {
+		e.doc.OpenAction = nil
+	}
+	if e.doc.Names != nil {
+		e.doc.Names.JavaScript = nil
+	}
+	if form := e.doc.AcroForm; form != nil {
+		form.XFA = nil
+		form.NeedAppearances = false
+		for _, f := range form.Fields {
+			base := fieldBase(f)
+			if base == nil {
+				continue
+			}
+			base.AnnotationFlags = base.AnnotationFlags&^forbiddenFlags | requiredFlags
+			base.AdditionalActions = nil
+			base.Dirty = true
+		}
+		form.Dirty = true
+	}
+	e.fixAppearances()
+	return nil
+}
+
+// fixAppearances gives the fields and annotations that need a normal
+// appearance and have none a generated one. Those the generator cannot
+// draw get an empty appearance, which renders them invisible but
+// conforming.
+func (e *enforcement) fixAppearances() {
+	g := builder.NewAppearanceGenerator(e.doc.AcroForm)
+	done := make(map[semantic.FormField]bool)
+	field := func(f semantic.FormField) {
+		base := fieldBase(f)
+		if base == nil || done[f] {
+			return
+		}
+		done[f] = true
+		r := base.Rect
+		if base.AppearanceForm != nil || len(base.Appearance) > 0 || r.URX == r.LLX || r.URY == r.LLY {
+			return
+		}
+		xo, err := g.Generate(f)
+		if err != nil {
+			xo = emptyAppearance(r)
+		}
+		base.AppearanceForm = xo
+		base.Dirty = true
+	}
+	if e.doc.AcroForm != nil {
+		for _, f := range e.doc.AcroForm.Fields {
+			field(f)
+		}
+	}
+	for _, p := range e.doc.Pages {
+		for _, a := range p.Annotations {
+			if a == nil || a.Base() == nil {
+				continue
+			}
+			base := a.Base()
+			if w, ok := a.(*semantic.WidgetAnnotation); ok && w.Field != nil {
+				field(w.Field)
+				if base.AppearanceForm == nil && len(base.Appearance) == 0 {
+					base.AppearanceForm = w.Field.GetAppearanceForm()
+				}
+				continue
+			}
+			if !needsAppearance(a) || hasAppearance(a) {
+				continue
+			}
+			xo, err := g.GenerateAnnotation(a)
+			if err != nil {
+				xo = emptyAppearance(base.RectVal)
+			}
+			base.AppearanceForm = xo
+			base.Dirty = true
+		}
+	}
+}
+
+// emptyAppearance returns a form XObject drawing nothing over r.
+func emptyAppearance(r semantic.Rectangle) *semantic.XObject {
+	return &semantic.XObject{
+		Subtype: "Form",
+		BBox:    semantic.Rectangle{URX: math.Abs(r.URX - r.LLX), URY: math.Abs(r.URY - r.LLY)},
+		Dirty:   true,
+	}
+}
+
+func fieldBase(f semantic.FormField) *semantic.BaseFormField {
+	switch t := f.(type) {
+	case *semantic.TextFormField:
+		return &t.BaseFormField
+	case *semantic.ChoiceFormField:
+		return &t.BaseFormField
+	case *semantic.ButtonFormField:
+		return &t.BaseFormField
+	case *semantic.SignatureFormField:
+		return &t.BaseFormField
+	case *semantic.GenericFormField:
+		return &t.BaseFormField
+	}
+	return nil
+}
@@ -0,0 +1,796 @@
+package pdfa
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"maps"
+	"math"
+	"strings"
+
+	"github.com/wudi/pdfkit/cmm"
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/render"
+)
+
+// pdfaIntent is the subtype of PDF/A output intents.
+const pdfaIntent = "GTS_PDFA1"
+
+// deviceOrder lists the device colour spaces in the order they are
+// reported.
+var deviceOrder = []string{"DeviceGray", "DeviceRGB", "DeviceCMYK"}
+
+var deviceRules = map[string]rule{
+	"DeviceGray": ruleDeviceGray,
+	"DeviceRGB":  ruleDeviceRGB,
+	"DeviceCMYK": ruleDeviceCMYK,
+}
+
+// renderingIntents are the rendering intents ISO 32000 defines.
+var renderingIntents = map[string]bool{
+	"RelativeColorimetric": true,
+	"AbsoluteColorimetric": true,
+	"Perceptual":           true,
+	"Saturation":           true,
+}
+
+// validateOutputProfile checks that data is a well-formed output or display
+// profile, as ISO 19005 requires of an output intent's DestOutputProfile.
+// PDF/A-1 predates version 4 profiles.
+func validateOutputProfile(data []byte, level Level) error {
+	p, err := cmm.NewICCProfile(data)
+	if err != nil {
+		return err
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if class := p.Class(); class != "prtr" && class != "mntr" {
+		return fmt.Errorf("profile class %q is neither output nor display", class)
+	}
+	if major, minor := p.Version(); level.IsLevelA1() && major >= 4 {
+		return fmt.Errorf("profile version %d.%d is not allowed in PDF/A-1", major, minor)
+	}
+	switch p.ColorSpace() {
+	case "GRAY", "RGB ", "CMYK":
+		return nil
+	}
+	return fmt.Errorf("unsupported output colour space %q", p.ColorSpace())
+}
+
+// eachIntent calls fn for the PDF/A output intents of doc and its pages.
+func eachIntent(doc *semantic.Document, fn func(oi *semantic.OutputIntent, loc string)) {
+	for i := range doc.OutputIntents {
+		if doc.OutputIntents[i].S == pdfaIntent {
+			fn(&doc.OutputIntents[i], fmt.Sprintf("OutputIntent %d", i+1))
+		}
+	}
+	for i, p := range doc.Pages {
+		for j := range p.OutputIntents {
+			if p.OutputIntents[j].S == pdfaIntent {
+				fn(&p.OutputIntents[j], fmt.Sprintf("%s OutputIntent %d", pageLocation(i), j+1))
+			}
+		}
+	}
+}
+
+// checkOutputIntents checks the destination profiles of the PDF/A output
+// intents, which shall all be the same.
+func (v *validator) checkOutputIntents() {
+	var first []byte
+	eachIntent(v.doc, func(oi *semantic.OutputIntent, loc string) {
+		if len(oi.DestOutputProfile) == 0 {
+			v.add(ruleOutputIntentProfile, loc, "no DestOutputProfile")
+			return
+		}
+		if err := validateOutputProfile(oi.DestOutputProfile, v.level); err != nil {
+			v.add(ruleOutputIntentProfile, loc, err.Error())
+			return
+		}
+		if first == nil {
+			first = oi.DestOutputProfile
+		} else if !bytes.Equal(first, oi.DestOutputProfile) {
+			v.add(ruleOutputIntentMultiple, loc, "")
+		}
+	})
+}
+
+// intentSpace returns the colour space of the PDF/A output intent profile
+// of doc: "GRAY", "RGB " or "CMYK", or "" when doc has no valid one.
+func intentSpace(doc *semantic.Document, level Level) string {
+	space := ""
+	eachIntent(doc, func(oi *semantic.OutputIntent, _ string) {
+		if space != "" || validateOutputProfile(oi.DestOutputProfile, level) != nil {
+			return
+		}
+		if p, err := cmm.NewICCProfile(oi.DestOutputProfile); err == nil {
+			space = p.ColorSpace()
+		}
+	})
+	return space
+}
+
+// deviceAllowed reports whether content may use the device colour space
+// name under an output intent profile of colour space intent.
+func deviceAllowed(name, intent string) bool {
+	switch name {
+	case "DeviceGray":
+		return intent != ""
+	case "DeviceRGB":
+		return intent == "RGB "
+	case "DeviceCMYK":
+		return intent == "CMYK"
+	}
+	return true
+}
+
+// deviceUses returns the device colour spaces content uses that level
+// restricts. PDF/A-1 does not recognize Default colour spaces.
+func (use *usage) deviceUses(level Level) map[string]string {
+	if !level.IsLevelA1() {
+		return use.device
+	}
+	uses := maps.Clone(use.tagged)
+	maps.Copy(uses, use.device)
+	return uses
+}
+
+// disallowed returns the device colour spaces use depends on that the
+// output intent of colour space intent does not allow, with where each is
+// first used.
+func (use *usage) disallowed(level Level, intent string) map[string]string {
+	out := make(map[string]string)
+	for name, loc := range use.deviceUses(level) {
+		if !deviceAllowed(name, intent) {
+			out[name] = loc
+		}
+	}
+	return out
+}
+
+func (v *validator) checkColours(use *usage) {
+	intent := intentSpace(v.doc, v.level)
+	bad := use.disallowed(v.level, intent)
+	for _, name := range deviceOrder {
+		loc, ok := bad[name]
+		if !ok {
+			continue
+		}
+		detail := "no PDF/A output intent"
+		if intent != "" {
+			detail = "the output intent is " + strings.TrimSpace(intent)
+		}
+		v.add(deviceRules[name], loc, detail)
+	}
+	for _, ri := range use.intents {
+		if name := ri.value.(string); !renderingIntents[name] {
+			v.add(ruleRenderingIntent, ri.loc, name)
+		}
+	}
+}
+
+// fixOutputIntents gives all PDF/A output intents the first valid
+// destination profile among them, adding an sRGB output intent when the
+// document has none.
+func (e *enforcement) fixOutputIntents() {
+	var profile []byte
+	eachIntent(e.doc, func(oi *semantic.OutputIntent, _ string) {
+		if profile == nil && validateOutputProfile(oi.DestOutputProfile, e.level) == nil {
+			profile = oi.DestOutputProfile
+		}
+	})
+	found := false
+	eachIntent(e.doc, func(oi *semantic.OutputIntent, _ string) {
+		found = true
+		if profile == nil {
+			*oi = sRGBIntent()
+		} else {
+			oi.DestOutputProfile = profile
+		}
+	})
+	if !found {
+		e.doc.OutputIntents = append(e.doc.OutputIntents, sRGBIntent())
+	}
+}
+
+func sRGBIntent() semantic.OutputIntent {
+	return semantic.OutputIntent{
+		S:                         pdfaIntent,
+		OutputConditionIdentifier: "sRGB IEC61966-2.1",
+		Info:                      "sRGB IEC61966-2.1",
+		DestOutputProfile:         DefaultICCProfile,
+	}
+}
+
+// fixColours makes the device colours of the content agree with the
+// output intent. DeviceCMYK under an output intent that is not CMYK is
+// converted to DeviceRGB. DeviceRGB under one that is not RGB is tagged
+// with an sRGB DefaultRGB colour space where the level allows, and
+// otherwise replaced by sRGB in colour space objects and converted to the
+// output intent's colour space in content operators. With rasterization
+// enabled, pages still using device colours the output intent does not
+// allow, as in shadings and the alternates of Separation spaces, are
+// rasterized.
+func (e *enforcement) fixColours() error {
+	intent := intentSpace(e.doc, e.level)
+	use, err := scanContent(e.ctx, e.doc)
+	if err != nil {
+		return err
+	}
+	if _, ok := use.disallowed(e.level, intent)["DeviceCMYK"]; ok {
+		c := e.converter("DeviceCMYK", "DeviceRGB")
+		if err := eachStream(e.ctx, e.doc, c.stream); err != nil {
+			return err
+		}
+		if use, err = scanContent(e.ctx, e.doc); err != nil {
+			return err
+		}
+	}
+	if _, ok := use.disallowed(e.level, intent)["DeviceRGB"]; ok {
+		to := "DeviceGray"
+		if intent == "CMYK" {
+			to = "DeviceCMYK"
+		}
+		c := e.converter("DeviceRGB", to)
+		c.retag = true
+		c.tagDefault = !e.level.IsLevelA1()
+		if err := eachStream(e.ctx, e.doc, c.stream); err != nil {
+			return err
+		}
+	}
+	if err := e.fixRenderingIntents(); err != nil {
+		return err
+	}
+	return e.rasterizePages(func(use *usage) bool {
+		return len(use.disallowed(e.level, intent)) > 0
+	})
+}
+
+// fixRenderingIntents replaces unknown rendering intents of ri operators
+// with RelativeColorimetric.
+func (e *enforcement) fixRenderingIntents() error {
+	return eachStream(e.ctx, e.doc, func(s *stream) ([]semantic.Operation, error) {
+		var out []semantic.Operation
+		for i, op := range s.ops {
+			if name, ok := nameAt(op, 0); ok && op.Operator == "ri" && !renderingIntents[name] {
+				if out == nil {
+					out = append([]semantic.Operation(nil), s.ops...)
+				}
+				out[i] = semantic.Operation{Operator: "ri", Operands: []semantic.Operand{semantic.NameOperand{Value: "RelativeColorimetric"}}}
+			}
+		}
+		return out, nil
+	})
+}
+
+// sRGB returns the sRGB colour space shared by the colour spaces the
+// enforcement adds.
+func (e *enforcement) sRGB() *semantic.ICCBasedColorSpace {
+	if e.srgb == nil {
+		e.srgb = &semantic.ICCBasedColorSpace{
+			N:         3,
+			Profile:   DefaultICCProfile,
+			Alternate: semantic.DeviceColorSpace{Name: "DeviceRGB"},
+		}
+	}
+	return e.srgb
+}
+
+// colourConverter replaces the device colour space from in content.
+// Colour values in operators and image samples are converted to the device
+// colour space to. With retag, colour space objects built on from (image
+// colour spaces, Indexed bases, Separation and DeviceN alternates,
+// shadings and groups) use sRGB instead, which requires from to be
+// DeviceRGB. With tagDefault, resource dictionaries gain an sRGB
+// DefaultRGB colour space and their content is left as it is.
+type colourConverter struct {
+	e          *enforcement
+	r          *render.Renderer
+	from, to   string
+	retag      bool
+	tagDefault bool
+	res        map[*semantic.Resources]bool
+}
+
+func (e *enforcement) converter(from, to string) *colourConverter {
+	return &colourConverter{
+		e:    e,
+		r:    render.New(render.Options{}),
+		from: from,
+		to:   to,
+		res:  make(map[*semantic.Resources]bool),
+	}
+}
+
+// stream converts a content stream and the resources it is drawn with.
+func (c *colourConverter) stream(s *stream) ([]semantic.Operation, error) {
+	if s.form != nil && s.form.Group != nil && s.form.Group.CS != nil {
+		s.form.Group.CS = c.space(s.form.Group.CS)
+	}
+	if s.res != nil && !c.res[s.res] {
+		c.res[s.res] = true
+		if err := c.resources(s.res); err != nil {
+			return nil, err
+		}
+	}
+	if c.tagDefault && s.res != nil {
+		return nil, nil
+	}
+	return c.operators(s.ops, s.res)
+}
+
+func (c *colourConverter) resources(res *semantic.Resources) error {
+	if c.tagDefault {
+		if res.ColorSpaces == nil {
+			res.ColorSpaces = make(map[string]semantic.ColorSpace)
+		}
+		res.ColorSpaces["DefaultRGB"] = c.e.sRGB()
+		res.Dirty = true
+		return nil
+	}
+	for name, cs := range res.ColorSpaces {
+		if !isDevice(cs, c.from) {
+			res.ColorSpaces[name] = c.space(cs)
+		}
+	}
+	for name, xo := range res.XObjects {
+		if xo.Subtype != "Image" {
+			continue
+		}
+		if err := c.image(&xo); err != nil {
+			return err
+		}
+		res.XObjects[name] = xo
+	}
+	for _, sh := range res.Shadings {
+		c.shading(sh)
+	}
+	for _, p := range res.Patterns {
+		if sp, ok := p.(*semantic.ShadingPattern); ok && sp.Shading != nil {
+			c.shading(sp.Shading)
+		}
+	}
+	return nil
+}
+
+// space returns cs with the device colour space converted where that
+// keeps the meaning of colour values: Indexed lookup tables are converted,
+// and with retag DeviceRGB is replaced by sRGB.
+func (c *colourConverter) space(cs semantic.ColorSpace) semantic.ColorSpace {
+	switch s := cs.(type) {
+	case semantic.DeviceColorSpace, *semantic.DeviceColorSpace:
+		if c.retag && isDevice(cs, c.from) {
+			return c.e.sRGB()
+		}
+	case *semantic.IndexedColorSpace:
+		switch {
+		case !isDevice(s.Base, c.from):
+			s.Base = c.space(s.Base)
+		case c.retag:
+			s.Base = c.e.sRGB()
+		default:
+			s.Lookup = convertSamples(s.Lookup, c.from, c.to)
+			s.Base = semantic.DeviceColorSpace{Name: c.to}
+		}
+		s.Dirty = true
+	case *semantic.SeparationColorSpace:
+		s.Alternate = c.space(s.Alternate)
+		s.Dirty = true
+	case *semantic.DeviceNColorSpace:
+		s.Alternate = c.space(s.Alternate)
+		s.Dirty = true
+	case *semantic.PatternColorSpace:
+		if s.Underlying != nil {
+			s.Underlying = c.space(s.Underlying)
+		}
+	}
+	return cs
+}
+
+func (c *colourConverter) shading(sh semantic.Shading) {
+	var base *semantic.BaseShading
+	switch s := sh.(type) {
+	case *semantic.FunctionShading:
+		base = &s.BaseShading
+	case *semantic.MeshShading:
+		base = &s.BaseShading
+	default:
+		return
+	}
+	base.ColorSpace = c.space(base.ColorSpace)
+	base.Dirty = true
+}
+
+// image converts an image XObject. Images in the device colour space are
+// retagged or decoded and stored uncompressed in the target space.
+func (c *colourConverter) image(xo *semantic.XObject) error {
+	if xo.ImageMask || xo.ColorSpace == nil {
+		return nil
+	}
+	if !isDevice(xo.ColorSpace, c.from) {
+		xo.ColorSpace = c.space(xo.ColorSpace)
+		xo.Dirty = true
+		return nil
+	}
+	if c.retag {
+		xo.ColorSpace = c.e.sRGB()
+		xo.Dirty = true
+		return nil
+	}
+	img, err := c.r.DecodeImage(c.e.ctx, xo)
+	if err != nil {
+		// Left for rasterization.
+		return nil
+	}
+	xo.Data = encodePixels(img, c.to)
+	xo.ColorSpace = semantic.DeviceColorSpace{Name: c.to}
+	xo.BitsPerComponent = 8
+	xo.Filter, xo.DecodeParms, xo.Decode, xo.ColorKey = "", nil, nil, nil
+	xo.Dirty = true
+	return nil
+}
+
+// operators converts the colour operators of ops drawn with res. It
+// returns nil when nothing changed.
+func (c *colourConverter) operators(ops []semantic.Operation, res *semantic.Resources) ([]semantic.Operation, error) {
+	fromOps, toOps := colourOperators[c.from], colourOperators[c.to]
+	n := components[c.from]
+	var (
+		out           []semantic.Operation
+		fill, stroke  bool // the current colour space is from
+		stack         [][2]bool
+		changed       bool
+		convertValues = func(op semantic.Operation, name string) (semantic.Operation, bool) {
+			vals, ok := numbers(op.Operands)
+			if !ok || len(vals) != n {
+				return op, false
+			}
+			return semantic.Operation{Operator: name, Operands: numberOperands(convertColour(vals, c.from, c.to))}, true
+		}
+	)
+	for _, op := range ops {
+		switch op.Operator {
+		case "q":
+			stack = append(stack, [2]bool{fill, stroke})
+		case "Q":
+			if len(stack) > 0 {
+				fill, stroke = stack[len(stack)-1][0], stack[len(stack)-1][1]
+				stack = stack[:len(stack)-1]
+			}
+		case "g", "rg", "k":
+			fill = false
+			if op.Operator == fromOps[0] {
+				op, changed = convert(op, toOps[0], convertValues, changed)
+			}
+		case "G", "RG", "K":
+			stroke = false
+			if op.Operator == fromOps[1] {
+				op, changed = convert(op, toOps[1], convertValues, changed)
+			}
+		case "cs", "CS":
+			name, _ := nameAt(op, 0)
+			is := name == c.from || (res != nil && isDevice(res.ColorSpaces[name], c.from))
+			if op.Operator == "cs" {
+				fill = is
+			} else {
+				stroke = is
+			}
+			if is {
+				op = semantic.Operation{Operator: op.Operator, Operands: []semantic.Operand{semantic.NameOperand{Value: c.to}}}
+				changed = true
+			}
+		case "sc", "scn":
+			if fill {
+				op, changed = convert(op, op.Operator, convertValues, changed)
+			}
+		case "SC", "SCN":
+			if stroke {
+				op, changed = convert(op, op.Operator, convertValues, changed)
+			}
+		case contentstream.InlineImageOperator:
+			converted, ok, err := c.inlineImage(op, res)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				op, changed = converted, true
+			}
+		}
+		out = append(out, op)
+	}
+	if !changed {
+		return nil, nil
+	}
+	return out, nil
+}
+
+func convert(op semantic.Operation, name string, fn func(semantic.Operation, string) (semantic.Operation, bool), changed bool) (semantic.Operation, bool) {
+	out, ok := fn(op, name)
+	return out, changed || ok
+}
+
+// inlineImage converts an inline image in the device colour space, or
+// with an Indexed space built on it, storing its samples uncompressed.
+func (c *colourConverter) inlineImage(op semantic.Operation, res *semantic.Resources) (semantic.Operation, bool, error) {
+	if len(op.Operands) != 1 {
+		return op, false, nil
+	}
+	img, ok := op.Operands[0].(semantic.InlineImageOperand)
+	if !ok || inlineMask(img) {
+		return op, false, nil
+	}
+	values := maps.Clone(img.Image.Values)
+	switch cs := inlineValue(img, "CS", "ColorSpace").(type) {
+	case semantic.NameOperand:
+		name := inlineColourSpace(cs.Value)
+		if name != c.from && (res == nil || !isDevice(res.ColorSpaces[name], c.from)) {
+			return op, false, nil
+		}
+	case semantic.ArrayOperand:
+		// An Indexed space [/I base hival lookup] keeps its samples.
+		if len(cs.Values) != 4 {
+			return op, false, nil
+		}
+		base, ok := cs.Values[1].(semantic.NameOperand)
+		lookup, isString := cs.Values[3].(semantic.StringOperand)
+		if !ok || !isString || inlineColourSpace(base.Value) != c.from {
+			return op, false, nil
+		}
+		indexed := append([]semantic.Operand(nil), cs.Values...)
+		indexed[1] = semantic.NameOperand{Value: inlineAbbreviation(c.to)}
+		indexed[3] = semantic.StringOperand{Value: convertSamples(lookup.Value, c.from, c.to)}
+		delete(values, "ColorSpace")
+		values["CS"] = semantic.ArrayOperand{Values: indexed}
+		img.Image.Values = values
+		return semantic.Operation{Operator: op.Operator, Operands: []semantic.Operand{img}}, true, nil
+	default:
+		return op, false, nil
+	}
+	xo, err := c.r.InlineImage(c.e.ctx, img, res)
+	if err != nil {
+		return op, false, nil
+	}
+	decoded, err := c.r.DecodeImage(c.e.ctx, xo)
+	if err != nil {
+		return op, false, nil
+	}
+	for _, key := range []string{"ColorSpace", "BitsPerComponent", "Filter", "F", "DecodeParms", "DP", "Decode", "D"} {
+		delete(values, key)
+	}
+	values["CS"] = semantic.NameOperand{Value: inlineAbbreviation(c.to)}
+	values["BPC"] = semantic.NumberOperand{Value: 8}
+	out := semantic.InlineImageOperand{Image: semantic.DictOperand{Values: values}, Data: encodePixels(decoded, c.to)}
+	return semantic.Operation{Operator: op.Operator, Operands: []semantic.Operand{out}}, true, nil
+}
+
+// colourOperators are the fill and stroke operators of each device colour
+// space.
+var colourOperators = map[string][2]string{
+	"DeviceGray": {"g", "G"},
+	"DeviceRGB":  {"rg", "RG"},
+	"DeviceCMYK": {"k", "K"},
+}
+
+var components = map[string]int{"DeviceGray": 1, "DeviceRGB": 3, "DeviceCMYK": 4}
+
+func inlineAbbreviation(name string) string {
+	switch name {
+	case "DeviceGray":
+		return "G"
+	case "DeviceRGB":
+		return "RGB"
+	case "DeviceCMYK":
+		return "CMYK"
+	}
+	return name
+}
+
+// isDevice reports whether cs is the device colour space name.
+func isDevice(cs semantic.ColorSpace, name string) bool {
+	switch cs := cs.(type) {
+	case semantic.DeviceColorSpace:
+		return inlineColourSpace(cs.Name) == name
+	case *semantic.DeviceColorSpace:
+		return cs != nil && inlineColourSpace(cs.Name) == name
+	}
+	return false
+}
+
+// convertColour converts colour values between device colour spaces
+// with the conversions of ISO 32000-1, 10.3.
+func convertColour(vals []float64, from, to string) []float64 {
+	var r, g, b float64
+	switch from {
+	case "DeviceGray":
+		r, g, b = vals[0], vals[0], vals[0]
+	case "DeviceRGB":
+		r, g, b = vals[0], vals[1], vals[2]
+	case "DeviceCMYK":
+		k := vals[3]
+		r, g, b = (1-vals[0])*(1-k), (1-vals[1])*(1-k), (1-vals[2])*(1-k)
+	}
+	switch to {
+	case "DeviceGray":
+		return []float64{0.3*r + 0.59*g + 0.11*b}
+	case "DeviceCMYK":
+		k := 1 - max(r, g, b)
+		if k >= 1 {
+			return []float64{0, 0, 0, 1}
+		}
+		return []float64{(1 - r - k) / (1 - k), (1 - g - k) / (1 - k), (1 - b - k) / (1 - k), k}
+	}
+	return []float64{r, g, b}
+}
+
+// convertSamples converts 8-bit samples, such as an Indexed lookup table,
+// between device colour spaces.
+func convertSamples(data []byte, from, to string) []byte {
+	n := components[from]
+	out := make([]byte, 0, len(data)/n*components[to])
+	vals := make([]float64, n)
+	for i := 0; i+n <= len(data); i += n {
+		for j := range vals {
+			vals[j] = float64(data[i+j]) / 255
+		}
+		for _, v := range convertColour(vals, from, to) {
+			out = append(out, toByte(v))
+		}
+	}
+	return out
+}
+
+// encodePixels returns the colour of the pixels of img as 8-bit samples of
+// the device colour space to.
+func encodePixels(img *image.NRGBA, to string) []byte {
+	b := img.Bounds()
+	out := make([]byte, 0, b.Dx()*b.Dy()*components[to])
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			p := img.NRGBAAt(x, y)
+			if to == "DeviceRGB" {
+				out = append(out, p.R, p.G, p.B)
+				continue
+			}
+			rgb := []float64{float64(p.R) / 255, float64(p.G) / 255, float64(p.B) / 255}
+			for _, v := range convertColour(rgb, "DeviceRGB", to) {
+				out = append(out, toByte(v))
+			}
+		}
+	}
+	return out
+}
+
+func toByte(v float64) byte {
+	return byte(math.Round(math.Max(0, math.Min(1, v)) * 255))
+}
+
+func numbers(operands []semantic.Operand) ([]float64, bool) {
+	vals := make([]float64, len(operands))
+	for i, o := range operands {
+		n, ok := o.(semantic.NumberOperand)
+		if !ok {
+			return nil, false
+		}
+		vals[i] = n.Value
+	}
+	return vals, true
+}
+
+func numberOperands(vals []float64) []semantic.Operand {
+	out := make([]semantic.Operand, len(vals))
+	for i, v := range vals {
+		out[i] = semantic.NumberOperand{Value: math.Round(v*10000) / 10000}
+	}
+	return out
+}
+
+// rasterizePages replaces the content of each page for which bad reports
+// a problem with an image of the page, as drawn without its annotations.
+// It does nothing unless rasterization is enabled.
+func (e *enforcement) rasterizePages(bad func(use *usage) bool) error {
+	if !e.rasterization {
+		return nil
+	}
+	for i, p := range e.doc.Pages {
+		page := &semantic.Document{Pages: []*semantic.Page{{Resources: p.Resources, Contents: p.Contents}}}
+		use, err := scanContent(e.ctx, page)
+		if err != nil {
+			return err
+		}
+		if !bad(use) {
+			continue
+		}
+		if err := e.rasterize(p); err != nil {
+			return fmt.Errorf("%s: %w", pageLocation(i), err)
+		}
+	}
+	return nil
+}
+
+// rasterizeDPI is the resolution of rasterized pages.
+const rasterizeDPI = 150
+
+// rasterize replaces the content of p with an sRGB image of it, drawn
+// under the page's text in render mode 3 (invisible).
+func (e *enforcement) rasterize(p *semantic.Page) error {
+	ops, err := contentstream.PageOperations(p)
+	if err != nil {
+		return err
+	}
+	cp := *p
+	cp.Rotate = 0
+	cp.Annotations = nil
+	img, err := render.New(render.Options{DPI: rasterizeDPI, Box: render.MediaBox}).RenderPage(e.ctx, &cp)
+	if err != nil {
+		return err
+	}
+	b := img.Bounds()
+	data := make([]byte, 0, b.Dx()*b.Dy()*3)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			data = append(data, c.R, c.G, c.B)
+		}
+	}
+	box := p.MediaBox
+	text := invisibleText(ops)
+	var fonts map[string]*semantic.Font
+	if len(text) > 0 && p.Resources != nil {
+		fonts = p.Resources.Fonts
+	}
+	p.Resources = &semantic.Resources{Fonts: fonts, XObjects: map[string]semantic.XObject{"Im0": {
+		Subtype:          "Image",
+		Width:            b.Dx(),
+		Height:           b.Dy(),
+		ColorSpace:       e.sRGB(),
+		BitsPerComponent: 8,
+		Data:             data,
+	}}}
+	num := func(v float64) semantic.Operand { return semantic.NumberOperand{Value: v} }
+	out := []semantic.Operation{
+		{Operator: "q"},
+		{Operator: "cm", Operands: []semantic.Operand{num(box.URX - box.LLX), num(0), num(0), num(box.URY - box.LLY), num(box.LLX), num(box.LLY)}},
+		{Operator: "Do", Operands: []semantic.Operand{semantic.NameOperand{Value: "Im0"}}},
+		{Operator: "Q"},
+	}
+	if len(text) > 0 {
+		out = append(append(append(out, semantic.Operation{Operator: "q"}), text...), semantic.Operation{Operator: "Q"})
+	}
+	p.Contents = []semantic.ContentStream{{Operations: out}}
+	p.Dirty = true
+	return nil
+}
+
+// textLayerOps are the operators kept in the text layer of a rasterized
+// page: text objects, text state and the transformations placing them.
+var textLayerOps = map[string]bool{
+	"q": true, "Q": true, "cm": true, "BT": true, "ET": true,
+	"Tc": true, "Tw": true, "Tz": true, "TL": true, "Tf": true, "Ts": true,
+	"Td": true, "TD": true, "Tm": true, "T*": true,
+	"Tj": true, "TJ": true, "'": true, "\"": true,
+}
+
+// invisibleText returns the text showing operations of ops with the state
+// they depend on, in render mode 3, or nil when ops shows no text. Text
+// drawn by form XObjects and Type 3 glyph procedures is not included.
+func invisibleText(ops []semantic.Operation) []semantic.Operation {
+	var out []semantic.Operation
+	shows := false
+	for _, op := range ops {
+		if !textLayerOps[op.Operator] {
+			continue
+		}
+		out = append(out, op)
+		switch op.Operator {
+		case "BT":
+			out = append(out, semantic.Operation{Operator: "Tr", Operands: []semantic.Operand{semantic.NumberOperand{Value: 3}}})
+		case "Tj", "TJ", "'", "\"":
+			shows = true
+		}
+	}
+	if !shows {
+		return nil
+	}
+	return out
+}
@@ -0,0 +1,516 @@
+package pdfa
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// maxContentDepth bounds the nesting of form XObjects, patterns and Type 3
+// glyphs followed while walking content.
+const maxContentDepth = 16
+
+// stream is a content stream of the document together with the resources
+// it is drawn with.
+type stream struct {
+	ops  []semantic.Operation
+	res  *semantic.Resources
+	form *semantic.XObject // the form XObject holding the stream, if any
+	loc  string
+}
+
+// streamFunc is called for each content stream. It returns the operations
+// replacing the stream's, or nil to leave it unchanged.
+type streamFunc func(s *stream) ([]semantic.Operation, error)
+
+// streamWalker follows the content streams of a document through the form
+// XObjects, tiling patterns, soft masks and Type 3 glyph procedures they
+// use.
+type streamWalker struct {
+	ctx   context.Context
+	fn    streamFunc
+	forms map[*byte][]byte // form data visited, to its replacement
+	seen  map[any]bool     // patterns, soft mask groups and fonts visited
+}
+
+// eachStream calls fn for every content stream reachable from the pages of
+// doc, their annotation appearances and the appearances of form fields.
+// Each stream is visited once, before the streams it uses; replacements
+// returned by fn are written back in place.
+func eachStream(ctx context.Context, doc *semantic.Document, fn streamFunc) error {
+	w := &streamWalker{ctx: ctx, fn: fn, forms: make(map[*byte][]byte), seen: make(map[any]bool)}
+	for i, p := range doc.Pages {
+		if err := checkCancelled(ctx); err != nil {
+			return err
+		}
+		loc := pageLocation(i)
+		ops, _ := contentstream.PageOperations(p)
+		err := w.visit(&stream{ops: ops, res: p.Resources, loc: loc}, 0, func(out []semantic.Operation) {
+			p.Contents = []semantic.ContentStream{{Operations: out}}
+			p.Dirty = true
+		})
+		if err != nil {
+			return err
+		}
+		for _, a := range p.Annotations {
+			if a == nil || a.Base() == nil {
+				continue
+			}
+			base := a.Base()
+			aloc := loc + " Annotation " + base.Subtype
+			switch {
+			case base.AppearanceForm != nil:
+				if err := w.formPtr(base.AppearanceForm, p.Resources, aloc, 0); err != nil {
+					return err
+				}
+			case len(base.Appearance) > 0:
+				ops, _ := contentstream.ParseOperations(base.Appearance)
+				err := w.visit(&stream{ops: ops, loc: aloc}, 0, func(out []semantic.Operation) {
+					base.Appearance = contentstream.Serialize(out)
+					base.Dirty = true
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if doc.AcroForm != nil {
+		for _, f := range doc.AcroForm.Fields {
+			if f == nil {
+				continue
+			}
+			if af := f.GetAppearanceForm(); af != nil {
+				if err := w.formPtr(af, nil, "Field "+f.FieldName(), 0); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func pageLocation(i int) string {
+	return fmt.Sprintf("Page %d", i+1)
+}
+
+// visit calls the walker's function for s, writes a replacement back with
+// set and then visits the streams s uses.
+func (w *streamWalker) visit(s *stream, depth int, set func([]semantic.Operation)) error {
+	out, err := w.fn(s)
+	if err != nil {
+		return err
+	}
+	if out != nil {
+		set(out)
+		s.ops = out
+	}
+	if depth >= maxContentDepth || s.res == nil {
+		return nil
+	}
+	res := s.res
+	for _, op := range s.ops {
+		switch op.Operator {
+		case "Do":
+			if name, ok := nameAt(op, 0); ok {
+				if xo, ok := res.XObjects[name]; ok && xo.Subtype == "Form" {
+					if err := w.formEntry(res, name, s.loc+" XObject "+name, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+		case "scn", "SCN":
+			if name, ok := nameAt(op, len(op.Operands)-1); ok {
+				if p, ok := res.Patterns[name].(*semantic.TilingPattern); ok {
+					if err := w.pattern(p, res, s.loc+" Pattern "+name, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+		case "gs":
+			if name, ok := nameAt(op, 0); ok {
+				if gs, ok := res.ExtGStates[name]; ok && gs.SoftMask != nil && gs.SoftMask.Group != nil {
+					if err := w.formPtr(gs.SoftMask.Group, res, s.loc+" SoftMask "+name, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+		case "Tf":
+			if name, ok := nameAt(op, 0); ok {
+				if font := res.Fonts[name]; font != nil && font.Subtype == "Type3" {
+					if err := w.type3(font, res, s.loc+" Font "+name, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// formEntry visits the form XObject res.XObjects[name], storing it back
+// into the map when its content is replaced. Forms without resources use
+// res.
+func (w *streamWalker) formEntry(res *semantic.Resources, name, loc string, depth int) error {
+	xo := res.XObjects[name]
+	if len(xo.Data) == 0 {
+		return nil
+	}
+	key := &xo.Data[0]
+	if data, ok := w.forms[key]; ok {
+		// Another resource dictionary shares the form's data.
+		if data != nil {
+			xo.Data = data
+			xo.Dirty = true
+			res.XObjects[name] = xo
+		}
+		return nil
+	}
+	w.forms[key] = nil
+	formRes := xo.Resources
+	if formRes == nil {
+		formRes = res
+	}
+	ops, _ := contentstream.ParseOperations(xo.Data)
+	return w.visit(&stream{ops: ops, res: formRes, form: &xo, loc: loc}, depth, func(out []semantic.Operation) {
+		data := contentstream.Serialize(out)
+		w.forms[key] = data
+		xo.Data = data
+		xo.Dirty = true
+		res.XObjects[name] = xo
+	})
+}
+
+// formPtr visits a form XObject held by pointer, as soft mask groups and
+// appearances are.
+func (w *streamWalker) formPtr(xo *semantic.XObject, res *semantic.Resources, loc string, depth int) error {
+	if w.seen[xo] || len(xo.Data) == 0 {
+		return nil
+	}
+	w.seen[xo] = true
+	formRes := xo.Resources
+	if formRes == nil {
+		formRes = res
+	}
+	ops, _ := contentstream.ParseOperations(xo.Data)
+	return w.visit(&stream{ops: ops, res: formRes, form: xo, loc: loc}, depth, func(out []semantic.Operation) {
+		xo.Data = contentstream.Serialize(out)
+		xo.Dirty = true
+	})
+}
+
+func (w *streamWalker) pattern(p *semantic.TilingPattern, res *semantic.Resources, loc string, depth int) error {
+	if w.seen[p] || len(p.Content) == 0 {
+		return nil
+	}
+	w.seen[p] = true
+	patRes := p.Resources
+	if patRes == nil {
+		patRes = res
+	}
+	ops, _ := contentstream.ParseOperations(p.Content)
+	return w.visit(&stream{ops: ops, res: patRes, loc: loc}, depth, func(out []semantic.Operation) {
+		p.Content = contentstream.Serialize(out)
+	})
+}
+
+// type3 visits the glyph procedures of a Type 3 font. Fonts without
+// resources use res.
+func (w *streamWalker) type3(font *semantic.Font, res *semantic.Resources, loc string, depth int) error {
+	if w.seen[font] {
+		return nil
+	}
+	w.seen[font] = true
+	glyphRes := font.Resources
+	if glyphRes == nil {
+		glyphRes = res
+	}
+	for _, name := range slices.Sorted(maps.Keys(font.CharProcs)) {
+		ops, _ := contentstream.ParseOperations(font.CharProcs[name])
+		err := w.visit(&stream{ops: ops, res: glyphRes, loc: loc + " Glyph " + name}, depth, func(out []semantic.Operation) {
+			font.CharProcs[name] = contentstream.Serialize(out)
+			font.Dirty = true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// usage records what the content of a document uses for rendering.
+type usage struct {
+	fonts     map[*semantic.Font]*fontUse
+	fontOrder []*semantic.Font
+
+	// device maps a device colour space to where it is first used.
+	// Uses in content whose resources define the matching Default colour
+	// space are recorded in tagged instead.
+	device map[string]string
+	tagged map[string]string
+
+	intents   []located // rendering intents of ri operators
+	resources []located // every resource dictionary content is drawn with
+}
+
+// located is a value found at a location of the document.
+type located struct {
+	value any
+	loc   string
+}
+
+// fontUse lists the strings shown with a font.
+type fontUse struct {
+	loc     string // where the font is first used
+	seen    map[string]bool
+	strings [][]byte
+}
+
+// scanContent walks the content of doc and returns what it uses.
+func scanContent(ctx context.Context, doc *semantic.Document) (*usage, error) {
+	use := &usage{
+		fonts:  make(map[*semantic.Font]*fontUse),
+		device: make(map[string]string),
+		tagged: make(map[string]string),
+	}
+	resSeen := make(map[*semantic.Resources]bool)
+	err := eachStream(ctx, doc, func(s *stream) ([]semantic.Operation, error) {
+		if s.res != nil && !resSeen[s.res] {
+			resSeen[s.res] = true
+			use.resources = append(use.resources, located{s.res, s.loc})
+		}
+		use.record(s)
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return use, nil
+}
+
+// record notes what the operators of s use.
+func (use *usage) record(s *stream) {
+	res, loc := s.res, s.loc
+	if s.form != nil && s.form.Group != nil && s.form.Group.CS != nil {
+		use.colourSpace(s.form.Group.CS, res, loc)
+	}
+	var font *semantic.Font
+	for _, op := range s.ops {
+		switch op.Operator {
+		case "g", "G":
+			use.deviceSpace("DeviceGray", res, loc)
+		case "rg", "RG":
+			use.deviceSpace("DeviceRGB", res, loc)
+		case "k", "K":
+			use.deviceSpace("DeviceCMYK", res, loc)
+		case "cs", "CS":
+			if name, ok := nameAt(op, 0); ok {
+				use.colourSpace(resolveColourSpace(name, res), res, loc)
+			}
+		case "scn", "SCN":
+			if name, ok := nameAt(op, len(op.Operands)-1); ok && res != nil {
+				if p, ok := res.Patterns[name].(*semantic.ShadingPattern); ok && p.Shading != nil {
+					use.colourSpace(p.Shading.ShadingColorSpace(), res, loc+" Pattern "+name)
+				}
+			}
+		case "sh":
+			if name, ok := nameAt(op, 0); ok && res != nil {
+				if sh := res.Shadings[name]; sh != nil {
+					use.colourSpace(sh.ShadingColorSpace(), res, loc+" Shading "+name)
+				}
+			}
+		case "ri":
+			if name, ok := nameAt(op, 0); ok {
+				use.intents = append(use.intents, located{name, loc})
+			}
+		case "Do":
+			if name, ok := nameAt(op, 0); ok && res != nil {
+				if xo, ok := res.XObjects[name]; ok && xo.Subtype == "Image" {
+					use.image(xo, res, loc+" XObject "+name)
+				}
+			}
+		case contentstream.InlineImageOperator:
+			if len(op.Operands) == 1 {
+				if img, ok := op.Operands[0].(semantic.InlineImageOperand); ok {
+					use.inlineImage(img, res, loc)
+				}
+			}
+		case "Tf":
+			font = nil
+			if name, ok := nameAt(op, 0); ok && res != nil {
+				font = res.Fonts[name]
+			}
+		case "Tj", "'", "\"", "TJ":
+			use.text(font, op, loc)
+		}
+	}
+}
+
+// deviceSpace records a use of a device colour space.
+func (use *usage) deviceSpace(name string, res *semantic.Resources, loc string) {
+	uses := use.device
+	if defaultColourSpace(name, res) {
+		uses = use.tagged
+	}
+	if _, ok := uses[name]; !ok {
+		uses[name] = loc
+	}
+}
+
+// colourSpace records the device colour spaces cs depends on.
+func (use *usage) colourSpace(cs semantic.ColorSpace, res *semantic.Resources, loc string) {
+	for _, name := range deviceSpaces(cs) {
+		use.deviceSpace(name, res, loc)
+	}
+}
+
+func (use *usage) image(xo semantic.XObject, res *semantic.Resources, loc string) {
+	if !xo.ImageMask {
+		use.colourSpace(xo.ColorSpace, res, loc)
+	}
+	if xo.SMask != nil {
+		use.colourSpace(xo.SMask.ColorSpace, res, loc)
+	}
+}
+
+func (use *usage) inlineImage(img semantic.InlineImageOperand, res *semantic.Resources, loc string) {
+	if inlineMask(img) {
+		return
+	}
+	switch v := inlineValue(img, "CS", "ColorSpace").(type) {
+	case semantic.NameOperand:
+		use.colourSpace(resolveColourSpace(inlineColourSpace(v.Value), res), res, loc)
+	case semantic.ArrayOperand:
+		// An inline Indexed space: [/I base hival lookup].
+		if len(v.Values) > 1 {
+			if base, ok := v.Values[1].(semantic.NameOperand); ok {
+				use.colourSpace(resolveColourSpace(inlineColourSpace(base.Value), res), res, loc)
+			}
+		}
+	}
+}
+
+// text records the strings shown by op with font.
+func (use *usage) text(font *semantic.Font, op semantic.Operation, loc string) {
+	if font == nil {
+		return
+	}
+	u := use.fonts[font]
+	if u == nil {
+		u = &fontUse{loc: loc, seen: make(map[string]bool)}
+		use.fonts[font] = u
+		use.fontOrder = append(use.fontOrder, font)
+	}
+	add := func(s []byte) {
+		if len(s) > 0 && !u.seen[string(s)] {
+			u.seen[string(s)] = true
+			u.strings = append(u.strings, s)
+		}
+	}
+	for _, operand := range op.Operands {
+		switch v := operand.(type) {
+		case semantic.StringOperand:
+			add(v.Value)
+		case semantic.ArrayOperand:
+			for _, e := range v.Values {
+				if s, ok := e.(semantic.StringOperand); ok {
+					add(s.Value)
+				}
+			}
+		}
+	}
+}
+
+// inlineValue returns the entry of an inline image dictionary under its
+// abbreviated or full key.
+func inlineValue(img semantic.InlineImageOperand, short, long string) semantic.Operand {
+	if v, ok := img.Image.Values[short]; ok {
+		return v
+	}
+	return img.Image.Values[long]
+}
+
+// inlineMask reports whether an inline image is a stencil mask.
+func inlineMask(img semantic.InlineImageOperand) bool {
+	mask, ok := inlineValue(img, "IM", "ImageMask").(semantic.BoolOperand)
+	return ok && mask.Value
+}
+
+// resolveColourSpace returns the colour space a cs operand or image
+// ColorSpace entry names.
+func resolveColourSpace(name string, res *semantic.Resources) semantic.ColorSpace {
+	switch name {
+	case "DeviceGray", "DeviceRGB", "DeviceCMYK", "Pattern":
+		return semantic.DeviceColorSpace{Name: name}
+	}
+	if res != nil {
+		return res.ColorSpaces[name]
+	}
+	return nil
+}
+
+// inlineColourSpace expands the abbreviated colour space names of inline
+// images.
+func inlineColourSpace(name string) string {
+	switch name {
+	case "G":
+		return "DeviceGray"
+	case "RGB":
+		return "DeviceRGB"
+	case "CMYK":
+		return "DeviceCMYK"
+	}
+	return name
+}
+
+// deviceSpaces returns the device colour spaces cs is defined in terms
+// of, including the alternates of Separation and DeviceN spaces.
+func deviceSpaces(cs semantic.ColorSpace) []string {
+	switch cs := cs.(type) {
+	case semantic.DeviceColorSpace:
+		return deviceName(cs.Name)
+	case *semantic.DeviceColorSpace:
+		return deviceName(cs.Name)
+	case *semantic.IndexedColorSpace:
+		return deviceSpaces(cs.Base)
+	case *semantic.SeparationColorSpace:
+		if cs.Name == "All" || cs.Name == "None" {
+			return nil
+		}
+		return deviceSpaces(cs.Alternate)
+	case *semantic.DeviceNColorSpace:
+		return deviceSpaces(cs.Alternate)
+	case *semantic.PatternColorSpace:
+		return deviceSpaces(cs.Underlying)
+	}
+	return nil
+}
+
+func deviceName(name string) []string {
+	if name = inlineColourSpace(name); name == "DeviceGray" || name == "DeviceRGB" || name == "DeviceCMYK" {
+		return []string{name}
+	}
+	return nil
+}
+
+// defaultColourSpace reports whether res remaps the device colour space
+// name to a device-independent Default colour space.
+func defaultColourSpace(name string, res *semantic.Resources) bool {
+	if res == nil {
+		return false
+	}
+	cs, ok := res.ColorSpaces["Default"+name[len("Device"):]]
+	return ok && cs != nil && len(deviceSpaces(cs)) == 0
+}
+
+func nameAt(op semantic.Operation, i int) (string, bool) {
+	if i < 0 || i >= len(op.Operands) {
+		return "", false
+	}
+	n, ok := op.Operands[i].(semantic.NameOperand)
+	return n.Value, ok
+}
@@ -0,0 +1,354 @@
+package pdfa_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/wudi/pdfkit/compliance"
+	"github.com/wudi/pdfkit/compliance/pdfa"
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/ir"
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/writer"
+	"github.com/wudi/pdfkit/xmp"
+)
+
+// nonConformingDoc returns a document breaking rules of every kind: a
+// font that is not embedded, DeviceRGB without an output intent,
+// transparency, a JavaScript link, a hidden annotation without appearance
+// and metadata with an undeclared schema.
+func nonConformingDoc() *semantic.Document {
+	alpha := 0.5
+	metadata := xmp.New()
+	metadata.SetText("http://example.com/ns/custom/", "Project", "Archive")
+	return &semantic.Document{
+		Info:     &semantic.DocumentInfo{Title: "Report"},
+		Metadata: &semantic.XMPMetadata{Packet: metadata},
+		Pages: []*semantic.Page{{
+			MediaBox: semantic.Rectangle{URX: 200, URY: 100},
+			Resources: &semantic.Resources{
+				Fonts:      map[string]*semantic.Font{"F1": {Subtype: "Type1", BaseFont: "Helvetica"}},
+				ExtGStates: map[string]semantic.ExtGState{"GS1": {FillAlpha: &alpha}},
+			},
+			Contents: []semantic.ContentStream{{RawBytes: []byte(
+				"1 0 0 rg /GS1 gs 10 10 50 50 re f BT /F1 12 Tf 70 40 Td (Hello) Tj ET")}},
+			Annotations: []semantic.Annotation{
+				&semantic.LinkAnnotation{
+					BaseAnnotation: semantic.BaseAnnotation{Subtype: "Link", RectVal: semantic.Rectangle{LLX: 10, LLY: 10, URX: 60, URY: 60}},
+					Action:         semantic.JavaScriptAction{JS: "app.alert(1)"},
+				},
+				&semantic.SquareAnnotation{BaseAnnotation: semantic.BaseAnnotation{
+					Subtype: "Square",
+					RectVal: semantic.Rectangle{LLX: 100, LLY: 10, URX: 150, URY: 60},
+					Flags:   semantic.AnnotFlagHidden,
+				}},
+			},
+		}},
+	}
+}
+
+func codes(rep *compliance.Report) map[string]bool {
+	out := make(map[string]bool)
+	for _, v := range rep.Violations {
+		out[v.Code] = true
+	}
+	return out
+}
+
+func roundTrip(t *testing.T, doc *semantic.Document) *semantic.Document {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := writer.NewWriter().Write(context.Background(), doc, &buf, writer.Config{Deterministic: true}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	parsed, err := ir.NewDefault().Parse(context.Background(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return parsed
+}
+
+func TestValidateReportsClauses(t *testing.T) {
+	e := pdfa.NewEnforcer()
+	tests := []struct {
+		level pdfa.Level
+		want  []string
+	}{
+		// Font embedding, DeviceRGB, alpha, JavaScript, annotation flags,
+		// pdfaid, extension schema and Info consistency.
+		{pdfa.PDFA1B, []string{"6.3.4-1", "6.2.3.3-1", "6.4-5", "6.6.1-1", "6.5.3-2", "6.7.11-1", "6.7.8-1", "6.7.3-1"}},
+		// PDF/A-2 allows the transparency but requires appearances.
+		{pdfa.PDFA2B, []string{"6.2.11.4.1-1", "6.2.4.3-2", "6.5.1-1", "6.3.2-2", "6.3.3-1", "6.6.4-1", "6.6.2.3.1-1"}},
+		// PDF/A-4 requires pdfaid:rev.
+		{pdfa.PDFA4, []string{"6.2.10.4.1-1", "6.6.4-2"}},
+	}
+	for _, tt := range tests {
+		rep, err := e.Validate(context.Background(), nonConformingDoc(), tt.level)
+		if err != nil {
+			t.Fatalf("%v: validate: %v", tt.level, err)
+		}
+		got := codes(rep)
+		for _, code := range tt.want {
+			if !got[code] {
+				t.Errorf("%v: missing %s in %+v", tt.level, code, rep.Violations)
+			}
+		}
+		if tt.level != pdfa.PDFA1B && got["6.4-5"] {
+			t.Errorf("%v: transparency reported", tt.level)
+		}
+	}
+}
+
+func TestEnforceConverts(t *testing.T) {
+	e := pdfa.NewEnforcer()
+	ctx := context.Background()
+	for _, level := range []pdfa.Level{pdfa.PDFA1B, pdfa.PDFA2U, pdfa.PDFA3B, pdfa.PDFA4} {
+		doc := nonConformingDoc()
+		if err := e.Enforce(ctx, doc, level); err != nil {
+			t.Fatalf("%v: enforce: %v", level, err)
+		}
+		rep, err := e.Validate(ctx, doc, level)
+		if err != nil {
+			t.Fatalf("%v: validate: %v", level, err)
+		}
+		if !rep.Compliant {
+			t.Fatalf("%v: not compliant after enforcement: %+v", level, rep.Violations)
+		}
+
+		if font := doc.Pages[0].Resources.Fonts["F1"]; font == nil || font.Descriptor == nil || len(font.Descriptor.FontFile) == 0 {
+			t.Errorf("%v: font not embedded", level)
+		}
+		if link := doc.Pages[0].Annotations[0].(*semantic.LinkAnnotation); link.Action != nil {
+			t.Errorf("%v: JavaScript action kept", level)
+		}
+		square := doc.Pages[0].Annotations[1].Base()
+		if square.Flags != semantic.AnnotFlagPrint || square.AppearanceForm == nil {
+			t.Errorf("%v: square flags %d, appearance %v", level, square.Flags, square.AppearanceForm)
+		}
+		p, err := doc.Metadata.XMP()
+		if err != nil {
+			t.Fatalf("%v: metadata: %v", level, err)
+		}
+		if p.Extension("http://example.com/ns/custom/") == nil {
+			t.Errorf("%v: no extension schema for the custom namespace", level)
+		}
+		if p.Title() != "Report" {
+			t.Errorf("%v: dc:title %q", level, p.Title())
+		}
+
+		// The written file conforms as well, file structure included.
+		parsed := roundTrip(t, doc)
+		if rep, err = e.Validate(ctx, parsed, level); err != nil || !rep.Compliant {
+			t.Fatalf("%v: written file: %v %+v", level, err, rep.Violations)
+		}
+	}
+}
+
+func TestEnforceFlattensTransparencyForPDFA1(t *testing.T) {
+	ctx := context.Background()
+	// By default the transparent objects are made opaque and the page
+	// keeps its vector content and text.
+	e := pdfa.NewEnforcer()
+	doc := nonConformingDoc()
+	if err := e.Enforce(ctx, doc, pdfa.PDFA1B); err != nil {
+		t.Fatalf("enforce: %v", err)
+	}
+	res := doc.Pages[0].Resources
+	if gs := res.ExtGStates["GS1"]; gs.FillAlpha != nil {
+		t.Errorf("alpha kept: %+v", gs)
+	}
+	if _, ok := res.XObjects["Im0"]; ok {
+		t.Error("page rasterized without WithRasterization")
+	}
+	if content := pageContent(t, doc); !bytes.Contains(content, []byte("(Hello) Tj")) || !bytes.Contains(content, []byte("re")) {
+		t.Errorf("content not kept: %s", content)
+	}
+
+	// With rasterization the page becomes an image under invisible text.
+	e = pdfa.NewEnforcer(pdfa.WithRasterization(true))
+	doc = nonConformingDoc()
+	if err := e.Enforce(ctx, doc, pdfa.PDFA1B); err != nil {
+		t.Fatalf("enforce: %v", err)
+	}
+	res = doc.Pages[0].Resources
+	if len(res.ExtGStates) != 0 {
+		t.Errorf("graphics states kept: %+v", res.ExtGStates)
+	}
+	img, ok := res.XObjects["Im0"]
+	if !ok || img.Subtype != "Image" || img.Width != 417 || img.Height != 209 {
+		t.Errorf("page not rasterized: %+v", res.XObjects)
+	}
+	if font := res.Fonts["F1"]; font == nil || font.Descriptor == nil || len(font.Descriptor.FontFile) == 0 {
+		t.Error("text layer font not kept and embedded")
+	}
+	content := pageContent(t, doc)
+	for _, want := range []string{"/Im0 Do", "BT", "3 Tr", "(Hello) Tj"} {
+		if !bytes.Contains(content, []byte(want)) {
+			t.Errorf("rasterized content lacks %q: %s", want, content)
+		}
+	}
+	if bytes.Contains(content, []byte(" re")) {
+		t.Errorf("vector content kept: %s", content)
+	}
+	if rep, err := e.Validate(ctx, doc, pdfa.PDFA1B); err != nil || !rep.Compliant {
+		t.Fatalf("not compliant: %v %+v", err, rep.Violations)
+	}
+
+	// PDF/A-2 keeps the transparency and the vector content.
+	doc = nonConformingDoc()
+	if err := e.Enforce(ctx, doc, pdfa.PDFA2B); err != nil {
+		t.Fatalf("enforce: %v", err)
+	}
+	if _, ok := doc.Pages[0].Resources.ExtGStates["GS1"]; !ok {
+		t.Error("PDF/A-2 enforcement removed transparency")
+	}
+}
+
+func pageContent(t *testing.T, doc *semantic.Document) []byte {
+	t.Helper()
+	ops, err := contentstream.PageOperations(doc.Pages[0])
+	if err != nil {
+		t.Fatalf("page content: %v", err)
+	}
+	return contentstream.Serialize(ops)
+}
+
+func TestEnforceTagsDeviceColours(t *testing.T) {
+	e := pdfa.NewEnforcer()
+	ctx := context.Background()
+	// A CMYK output intent does not allow DeviceRGB: PDF/A-2 tags it with
+	// a DefaultRGB colour space.
+	cmyk := func() *semantic.Document {
+		doc := nonConformingDoc()
+		doc.OutputIntents = []semantic.OutputIntent{{S: "GTS_PDFA1", DestOutputProfile: cmykProfile(t)}}
+		return doc
+	}
+	doc := cmyk()
+	if err := e.Enforce(ctx, doc, pdfa.PDFA2B); err != nil {
+		t.Fatalf("enforce: %v", err)
+	}
+	if _, ok := doc.Pages[0].Resources.ColorSpaces["DefaultRGB"]; !ok {
+		t.Errorf("no DefaultRGB: %+v", doc.Pages[0].Resources.ColorSpaces)
+	}
+	if rep, _ := e.Validate(ctx, doc, pdfa.PDFA2B); !rep.Compliant {
+		t.Fatalf("not compliant: %+v", rep.Violations)
+	}
+
+	// PDF/A-1 ignores Default colour spaces: the colours are converted.
+	doc = cmyk()
+	doc.Pages[0].Resources.ExtGStates = nil
+	if err := e.Enforce(ctx, doc, pdfa.PDFA1B); err != nil {
+		t.Fatalf("enforce: %v", err)
+	}
+	rep, _ := e.Validate(ctx, doc, pdfa.PDFA1B)
+	if !rep.Compliant {
+		t.Fatalf("not compliant: %+v", rep.Violations)
+	}
+	ops := doc.Pages[0].Contents[0].Operations
+	if len(ops) == 0 || ops[0].Operator != "k" {
+		t.Errorf("rg not converted to k: %+v", ops)
+	}
+}
+
+// cmykProfile returns a version 2 CMYK output profile. Its lookup tables
+// are placeholders: only the header and tag table are looked at.
+func cmykProfile(t *testing.T) []byte {
+	t.Helper()
+	tags := []string{"A2B0", "B2A0"}
+	const tagSize = 12
+	data := make([]byte, 132+len(tags)*12+len(tags)*tagSize)
+	binary.BigEndian.PutUint32(data[0:], uint32(len(data)))
+	binary.BigEndian.PutUint32(data[8:], 0x02100000)
+	copy(data[12:], "prtr")
+	copy(data[16:], "CMYK")
+	copy(data[20:], "Lab ")
+	copy(data[36:], "acsp")
+	binary.BigEndian.PutUint32(data[128:], uint32(len(tags)))
+	for i, sig := range tags {
+		entry := 132 + i*12
+		copy(data[entry:], sig)
+		binary.BigEndian.PutUint32(data[entry+4:], uint32(132+len(tags)*12+i*tagSize))
+		binary.BigEndian.PutUint32(data[entry+8:], tagSize)
+	}
+	return data
+}
+
+// parseObjects parses a file holding objects as objects 1, 2, ..., with
+// object 1 as the catalog and no trailer ID.
+func parseObjects(t *testing.T, objects []string) *semantic.Document {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	doc, err := ir.NewDefault().Parse(context.Background(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return doc
+}
+
+func TestValidateFileStructure(t *testing.T) {
+	// No ID in the trailer, a catalog with additional actions, a wrong
+	// stream Length and an external stream reference.
+	doc := parseObjects(t, []string{
+		"<< /Type /Catalog /Pages 2 0 R /AA << >> >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 10 10] /Contents 4 0 R >>",
+		"<< /Length 12 /F (data.bin) >>\nstream\n0 0 5 5 re f\nendstream",
+	})
+	rep, err := pdfa.NewEnforcer().Validate(context.Background(), doc, pdfa.PDFA2B)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	got := codes(rep)
+	for _, code := range []string{"6.1.3-1", "6.5.2-1", "6.1.7.1-3"} {
+		if !got[code] {
+			t.Errorf("missing %s in %+v", code, rep.Violations)
+		}
+	}
+}
+
+func TestValidateFilterClauses(t *testing.T) {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		"<< /Length 0 /Filter /LZWDecode >>\nstream\n\nendstream",
+		"<< /Length 0 /Filter /Crypt >>\nstream\n\nendstream",
+	}
+	// PDF/A-1 predates crypt filters and has no clause for them.
+	for level, want := range map[pdfa.Level][2]string{
+		pdfa.PDFA1B: {"6.1.10-1", ""},
+		pdfa.PDFA2B: {"6.1.7.2-1", "6.1.7.2-2"},
+	} {
+		rep, err := pdfa.NewEnforcer().Validate(context.Background(), parseObjects(t, objects), level)
+		if err != nil {
+			t.Fatalf("%v: validate: %v", level, err)
+		}
+		locs := make(map[string]string)
+		for _, v := range rep.Violations {
+			locs[v.Code] = v.Location
+		}
+		crypt := !slices.Contains(slices.Collect(maps.Values(locs)), "Object 4 0 R")
+		if want[1] != "" {
+			crypt = locs[want[1]] == "Object 4 0 R"
+		}
+		if locs[want[0]] != "Object 3 0 R" || !crypt {
+			t.Errorf("%v: LZW and Crypt reported as %v", level, locs)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+package pdfa
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/goregular"
+
+	"github.com/wudi/pdfkit/fonts"
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/render"
+)
+
+// widthTolerance is the difference, in text space units, allowed between
+// a width of the font dictionary and the font program.
+const widthTolerance = 0.001 + 1e-6
+
+// maxListedCodes bounds the character codes listed in a violation.
+const maxListedCodes = 8
+
+// fontReport lists the character codes of a font that fail each check.
+type fontReport struct {
+	substituted bool
+	missing     []int
+	notdef      []int
+	widths      []int
+	unicode     []int
+}
+
+// checkFont resolves the strings shown with font against its font
+// program. The renderer substitutes a program for fonts that are not
+// embedded or cannot be read, which substituted reports.
+func checkFont(r *render.Renderer, font *semantic.Font, use *fontUse, unicode bool) fontReport {
+	var out fontReport
+	seen := make(map[int]bool)
+	for _, s := range use.strings {
+		glyphs, embedded := r.FontGlyphs(font, s)
+		if !embedded {
+			out.substituted = true
+			return out
+		}
+		for _, g := range glyphs {
+			if seen[g.Code] {
+				continue
+			}
+			seen[g.Code] = true
+			switch {
+			case !g.Defined:
+				out.missing = append(out.missing, g.Code)
+			case g.GID == 0 && font.Subtype != "Type3":
+				out.notdef = append(out.notdef, g.Code)
+			}
+			if g.Defined && font.Subtype != "Type3" && math.Abs(g.Width-g.Advance) > widthTolerance {
+				out.widths = append(out.widths, g.Code)
+			}
+			if unicode && !hasUnicode(font, g.Code) {
+				out.unicode = append(out.unicode, g.Code)
+			}
+		}
+	}
+	return out
+}
+
+// requiresUnicode reports whether level requires every character code to
+// map to Unicode.
+func requiresUnicode(level Level) bool {
+	return level == PDFA2U || level == PDFA3U || level.IsLevelA4()
+}
+
+func (v *validator) checkFonts(use *usage) {
+	r := render.New(render.Options{})
+	for _, font := range use.fontOrder {
+		u := use.fonts[font]
+		loc := u.loc + " Font " + font.BaseFont
+		if !isFontEmbedded(font) {
+			v.add(ruleFontEmbedded, loc, font.BaseFont)
+			continue
+		}
+		fr := checkFont(r, font, u, requiresUnicode(v.level))
+		if fr.substituted {
+			v.add(ruleFontEmbedded, loc, "the embedded program of "+font.BaseFont+" cannot be read")
+			continue
+		}
+		if len(fr.missing) > 0 {
+			v.add(ruleFontGlyphs, loc, "codes "+listCodes(fr.missing))
+		}
+		if len(fr.notdef) > 0 {
+			v.add(ruleFontNotdef, loc, "codes "+listCodes(fr.notdef))
+		}
+		if len(fr.widths) > 0 {
+			v.add(ruleFontWidths, loc, "codes "+listCodes(fr.widths))
+		}
+		if len(fr.unicode) > 0 {
+			v.add(ruleFontUnicode, loc, "codes "+listCodes(fr.unicode))
+		}
+	}
+}
+
+func listCodes(codes []int) string {
+	var b strings.Builder
+	for i, c := range codes {
+		if i == maxListedCodes {
+			fmt.Fprintf(&b, " and %d more", len(codes)-i)
+			break
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%d", c)
+	}
+	return b.String()
+}
+
+// hasUnicode reports whether code of font maps to Unicode, through the
+// font's ToUnicode map or, for simple fonts, the glyph name its encoding
+// assigns. Fonts with a ToUnicode CMap stream are assumed to map every
+// code.
+func hasUnicode(font *semantic.Font, code int) bool {
+	if len(font.ToUnicodeCMap) > 0 {
+		return true
+	}
+	if runes := font.ToUnicode[code]; len(runes) > 0 {
+		return runes[0] != 0 && runes[0] != 0xFEFF && runes[0] != 0xFFFE
+	}
+	if font.Subtype == "Type0" || code < 0 || code > 255 {
+		return false
+	}
+	_, ok := fonts.GlyphNameToRune(encodingNames(font)[code])
+	return ok
+}
+
+// encodingNames returns the glyph name font's encoding assigns to each
+// code, using the standard encoding when the font names none.
+func encodingNames(font *semantic.Font) fonts.EncodingTable {
+	names := fonts.StandardEncoding
+	base := font.Encoding
+	if font.EncodingDict != nil && font.EncodingDict.BaseEncoding != "" {
+		base = font.EncodingDict.BaseEncoding
+	}
+	if enc, ok := fonts.NamedEncoding(base); ok {
+		names = *enc
+	}
+	if font.EncodingDict != nil {
+		for _, d := range font.EncodingDict.Differences {
+			if d.Code >= 0 && d.Code < 256 {
+				names[d.Code] = d.Name
+			}
+		}
+	}
+	return names
+}
+
+func isFontEmbedded(f *semantic.Font) bool {
+	if f == nil {
+		return false
+	}
+	// Type3 fonts are defined by streams in the PDF, effectively embedded.
+	if f.Subtype == "Type3" {
+		return true
+	}
+	// Standard 14 fonts must also be embedded in PDF/A.
+	if f.Descriptor != nil && len(f.Descriptor.FontFile) > 0 {
+		return true
+	}
+	// Check descendant for Type0
+	if f.Subtype == "Type0" && f.DescendantFont != nil {
+		if f.DescendantFont.Descriptor != nil && len(f.DescendantFont.Descriptor.FontFile) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// fixFonts embeds a substitute program for used fonts that lack a
+// readable one, corrects widths that disagree with the font programs and,
+// where the level requires it, maps codes without Unicode values through
+// the glyphs they select.
+func (e *enforcement) fixFonts(use *usage) error {
+	unicode := requiresUnicode(e.level)
+	r := render.New(render.Options{})
+	for _, font := range use.fontOrder {
+		if err := checkCancelled(e.ctx); err != nil {
+			return err
+		}
+		u := use.fonts[font]
+		if font.Subtype == "Type3" {
+			continue
+		}
+		if fr := checkFont(r, font, u, false); fr.substituted || !isFontEmbedded(font) {
+			if err := embedSubstitute(font, u); err != nil {
+				return fmt.Errorf("font %s: %w", font.BaseFont, err)
+			}
+		}
+	}
+	// The fonts changed above are resolved again with a fresh renderer.
+	r = render.New(render.Options{})
+	for _, font := range use.fontOrder {
+		if font.Subtype == "Type3" {
+			continue
+		}
+		u := use.fonts[font]
+		var lookup func(gid int) (rune, bool)
+		if unicode {
+			desc := font.Descriptor
+			if font.Subtype == "Type0" && font.DescendantFont != nil {
+				desc = font.DescendantFont.Descriptor
+			}
+			lookup = glyphUnicode(desc)
+		}
+		for _, s := range u.strings {
+			glyphs, embedded := r.FontGlyphs(font, s)
+			if !embedded {
+				break
+			}
+			for _, g := range glyphs {
+				if g.Defined && math.Abs(g.Width-g.Advance) > widthTolerance {
+					setWidth(font, g, int(math.Round(g.Advance*1000)))
+				}
+				if unicode && !hasUnicode(font, g.Code) {
+					addUnicode(font, g, lookup)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func setWidth(font *semantic.Font, g render.Glyph, w int) {
+	if font.Subtype == "Type0" {
+		if d := font.DescendantFont; d != nil {
+			if d.W == nil {
+				d.W = make(map[int]int)
+			}
+			d.W[g.CID] = w
+		}
+	} else {
+		if font.Widths == nil {
+			font.Widths = make(map[int]int)
+		}
+		font.Widths[g.Code] = w
+	}
+	font.Dirty = true
+}
+
+// glyphUnicode returns a function mapping the glyph indices of the font
+// program in desc to Unicode: through the Unicode cmap of TrueType
+// programs and through glyph names otherwise.
+func glyphUnicode(desc *semantic.FontDescriptor) func(gid int) (rune, bool) {
+	if desc == nil || len(desc.FontFile) == 0 {
+		return nil
+	}
+	if tt, err := fonts.ParseTrueTypeFont(desc.FontFile); err == nil && tt.HasCMap(3, 1) {
+		reverse := make(map[int]rune)
+		for r := rune(0x20); r <= 0xFFFF; r++ {
+			if gid, ok := tt.LookupCMap(3, 1, uint32(r)); ok && gid != 0 {
+				if _, dup := reverse[gid]; !dup {
+					reverse[gid] = r
+				}
+			}
+		}
+		return func(gid int) (rune, bool) {
+			r, ok := reverse[gid]
+			return r, ok
+		}
+	}
+	var name func(gid int) string
+	if f, err := fonts.ParseCFFFont(desc.FontFile); err == nil {
+		name = f.GlyphName
+	} else if f, err := fonts.ParseType1Font(desc.FontFile, desc.Length1, desc.Length2); err == nil {
+		name = f.GlyphName
+	} else {
+		return nil
+	}
+	return func(gid int) (rune, bool) {
+		return fonts.GlyphNameToRune(name(gid))
+	}
+}
+
+// addUnicode maps the code of g to the Unicode value of its glyph.
+func addUnicode(font *semantic.Font, g render.Glyph, lookup func(gid int) (rune, bool)) {
+	if lookup == nil {
+		return
+	}
+	if r, ok := lookup(g.GID); ok {
+		if font.ToUnicode == nil {
+			font.ToUnicode = make(map[int][]rune)
+		}
+		font.ToUnicode[g.Code] = []rune{r}
+		font.Dirty = true
+	}
+}
+
+// substituteProgram returns the Go font standing in for a font named
+// baseFont, chosen by the style hints in the name.
+func substituteProgram(baseFont string) []byte {
+	name := strings.ToLower(baseFont)
+	if i := strings.IndexByte(name, '+'); i >= 0 {
+		name = name[i+1:]
+	}
+	bold := strings.Contains(name, "bold") || strings.Contains(name, "black") || strings.Contains(name, "heavy")
+	italic := strings.Contains(name, "italic") || strings.Contains(name, "oblique")
+	mono := strings.Contains(name, "courier") || strings.Contains(name, "mono")
+	switch {
+	case mono && bold:
+		return gomonobold.TTF
+	case mono:
+		return gomono.TTF
+	case bold && italic:
+		return gobolditalic.TTF
+	case bold:
+		return gobold.TTF
+	case italic:
+		return goitalic.TTF
+	}
+	return goregular.TTF
+}
+
+// embedSubstitute embeds a subset of a substitute TrueType program in
+// font, keeping the character codes of the content. Simple fonts become
+// TrueType fonts selecting glyphs by name; composite fonts become
+// CIDFontType2 fonts whose CIDToGIDMap follows their Unicode mapping.
+func embedSubstitute(font *semantic.Font, use *fontUse) error {
+	data := substituteProgram(font.BaseFont)
+	program, err := fonts.ParseTrueTypeFont(data)
+	if err != nil {
+		return err
+	}
+	loaded, err := fonts.LoadTrueType(font.BaseFont, data)
+	if err != nil {
+		return err
+	}
+	desc := *loaded.Descriptor
+	name := strings.ReplaceAll(stripSubsetTag(font.BaseFont), " ", "")
+	if name == "" {
+		name = desc.FontName
+	}
+
+	used := map[int]bool{0: true}
+	if font.Subtype == "Type0" {
+		if err := substituteComposite(font, use, program, used); err != nil {
+			return err
+		}
+	} else {
+		substituteSimple(font, use, program, used)
+	}
+	subset, err := fonts.SubsetTrueType(data, used)
+	if err != nil {
+		return err
+	}
+	desc.FontName = subsetTag(used) + "+" + name
+	desc.FontFile = subset
+	desc.FontFileType = "FontFile2"
+	desc.FontFileSubtype = ""
+	desc.Length1, desc.Length2 = 0, 0
+	font.BaseFont = desc.FontName
+	if font.Subtype == "Type0" {
+		desc.Flags = 4
+		font.DescendantFont.BaseFont = desc.FontName
+		font.DescendantFont.Descriptor = &desc
+	} else {
+		desc.Flags = 32
+		font.Descriptor = &desc
+	}
+	font.Dirty = true
+	return nil
+}
+
+func substituteSimple(font *semantic.Font, use *fontUse, program *fonts.TrueTypeFont, used map[int]bool) {
+	// A non-symbolic TrueType font shall use WinAnsiEncoding or
+	// MacRomanEncoding; other base encodings are kept through Differences.
+	names := encodingNames(font)
+	if font.Encoding != "WinAnsiEncoding" && font.Encoding != "MacRomanEncoding" {
+		diffs := []semantic.EncodingDifference{}
+		for code, n := range names {
+			if n != "" && n != fonts.WinAnsiEncoding[code] {
+				diffs = append(diffs, semantic.EncodingDifference{Code: code, Name: n})
+			}
+		}
+		font.Encoding = ""
+		font.EncodingDict = &semantic.EncodingDict{BaseEncoding: "WinAnsiEncoding", Differences: diffs}
+	}
+	font.Subtype = "TrueType"
+	font.Widths = make(map[int]int)
+	for _, s := range use.strings {
+		for _, c := range s {
+			gid := 0
+			if r, ok := fonts.GlyphNameToRune(names[c]); ok {
+				gid, _ = program.LookupCMap(3, 1, uint32(r))
+			}
+			used[gid] = true
+			font.Widths[int(c)] = int(math.Round(program.Advance(gid) * 1000 / program.UnitsPerEm()))
+		}
+	}
+}
+
+func substituteComposite(font *semantic.Font, use *fontUse, program *fonts.TrueTypeFont, used map[int]bool) error {
+	if font.DescendantFont == nil || len(font.ToUnicode) == 0 {
+		return fmt.Errorf("no Unicode mapping to select substitute glyphs")
+	}
+	r := render.New(render.Options{})
+	gids := make(map[int]int)
+	maxCID := 0
+	for _, s := range use.strings {
+		glyphs, _ := r.FontGlyphs(font, s)
+		for _, g := range glyphs {
+			gid := 0
+			if runes := font.ToUnicode[g.Code]; len(runes) > 0 {
+				gid, _ = program.LookupCMap(3, 1, uint32(runes[0]))
+			}
+			gids[g.CID] = gid
+			used[gid] = true
+			maxCID = max(maxCID, g.CID)
+		}
+	}
+	cidToGID := make([]byte, 2*(maxCID+1))
+	d := font.DescendantFont
+	d.Subtype = "CIDFontType2"
+	d.W = make(map[int]int)
+	for cid, gid := range gids {
+		binary.BigEndian.PutUint16(cidToGID[2*cid:], uint16(gid))
+		d.W[cid] = int(math.Round(program.Advance(gid) * 1000 / program.UnitsPerEm()))
+	}
+	d.CIDToGIDMap = cidToGID
+	d.CIDToGIDMapName = ""
+	return nil
+}
+
+func stripSubsetTag(name string) string {
+	if len(name) > 7 && name[6] == '+' && strings.ToUpper(name[:6]) == name[:6] {
+		return name[7:]
+	}
+	return name
+}
+
+// subsetTag derives the six capital letters naming a font subset from the
+// glyphs it contains.
+func subsetTag(gids map[int]bool) string {
+	h := fnv.New32a()
+	for gid := 0; len(gids) > 0 && gid <= maxKey(gids); gid++ {
+		if gids[gid] {
+			binary.Write(h, binary.BigEndian, uint32(gid))
+		}
+	}
+	sum := h.Sum32()
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + byte(sum%26)
+		sum /= 26
+	}
+	return string(tag)
+}
+
+func maxKey(m map[int]bool) int {
+	n := 0
+	for k := range m {
+		n = max(n, k)
+	}
+	return n
+}
@@ -0,0 +1,156 @@
+package pdfa
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/xmp"
+)
+
+// pdfa4Revision is the pdfaid:rev of ISO 19005-4:2020.
+const pdfa4Revision = "2020"
+
+// identification returns the pdfaid:part and pdfaid:conformance a
+// document conforming to level declares.
+func identification(level Level) (int, string) {
+	switch level {
+	case PDFA1B:
+		return 1, "B"
+	case PDFA2B:
+		return 2, "B"
+	case PDFA2U:
+		return 2, "U"
+	case PDFA3B:
+		return 3, "B"
+	case PDFA3U:
+		return 3, "U"
+	case PDFA4E:
+		return 4, "E"
+	case PDFA4F:
+		return 4, "F"
+	}
+	return 4, ""
+}
+
+// conformanceAllowed reports whether a document validated against level
+// may declare conformance: a level implies those below it, so PDF/A-2u
+// files also conform to PDF/A-2b and may be validated as such, and PDF/A-4e
+// and -4f files to PDF/A-4. Level A is accepted as implying B and U.
+func conformanceAllowed(conformance string, level Level) bool {
+	_, want := identification(level)
+	switch want {
+	case "B":
+		return conformance == "A" || conformance == "B" || conformance == "U"
+	case "U":
+		return conformance == "A" || conformance == "U"
+	case "":
+		return conformance == "" || conformance == "E" || conformance == "F"
+	}
+	return conformance == want
+}
+
+// packet returns the XMP packet of doc, or an error describing why it
+// has none.
+func packet(doc *semantic.Document) (*xmp.Packet, error) {
+	if doc.Metadata == nil || (doc.Metadata.Packet == nil && len(doc.Metadata.Raw) == 0) {
+		return nil, fmt.Errorf("no metadata stream")
+	}
+	return doc.Metadata.XMP()
+}
+
+func (v *validator) checkMetadata() {
+	p, err := packet(v.doc)
+	if err != nil {
+		v.add(ruleMetadata, "Catalog", err.Error())
+		return
+	}
+	wantPart, _ := identification(v.level)
+	part, conformance := p.PDFAIdentification()
+	if part != wantPart {
+		v.add(rulePDFAPart, "Metadata", fmt.Sprintf("pdfaid:part is %q", p.Text(xmp.NSPDFAID, "part")))
+	}
+	if !conformanceAllowed(conformance, v.level) {
+		v.add(rulePDFAConformance, "Metadata", fmt.Sprintf("pdfaid:conformance is %q", conformance))
+	}
+	if v.level.IsLevelA4() && strings.TrimSpace(p.Text(xmp.NSPDFAID, "rev")) != pdfa4Revision {
+		v.add(rulePDFARevision, "Metadata", fmt.Sprintf("pdfaid:rev is %q", p.Text(xmp.NSPDFAID, "rev")))
+	}
+	for _, ns := range p.UndeclaredNamespaces() {
+		v.add(ruleExtensionSchema, "Metadata", ns)
+	}
+	if _, changed := semantic.SyncXMP(v.doc.Info, p.Clone()); changed {
+		v.add(ruleInfoConsistency, "Info", "")
+	}
+}
+
+// fixMetadata brings the XMP metadata in line with the level: it is
+// created when missing or malformed, synchronized with the document
+// information, declares the level in pdfaid and gains extension schemas
+// for the namespaces PDF/A does not predefine.
+func (e *enforcement) fixMetadata() {
+	p, err := packet(e.doc)
+	if err != nil {
+		p = xmp.New()
+	} else {
+		p = p.Clone()
+	}
+	info, _ := semantic.SyncXMP(e.doc.Info, p)
+	e.doc.Info = info
+	part, conformance := identification(e.level)
+	p.SetPDFAIdentification(part, conformance)
+	if e.level.IsLevelA4() {
+		p.SetText(xmp.NSPDFAID, "rev", pdfa4Revision)
+	} else {
+		p.Delete(xmp.NSPDFAID, "rev")
+	}
+	for i, ns := range p.UndeclaredNamespaces() {
+		declareSchema(p, ns, fmt.Sprintf("ext%d", i+1))
+	}
+	e.doc.Metadata = &semantic.XMPMetadata{Packet: p, Raw: p.Marshal(xmp.DefaultPadding), Dirty: true}
+}
+
+// declareSchema adds an extension schema for the properties of ns. Their
+// value types are inferred from the values; structures, whose field types
+// would need declaring too, are removed. A namespace without a prefix is
+// given prefix.
+func declareSchema(p *xmp.Packet, ns, prefix string) {
+	if known := p.Prefix(ns); known != "" {
+		prefix = known
+	}
+	schema := xmp.ExtensionSchema{Schema: ns, NamespaceURI: ns, Prefix: prefix}
+	var structs []string
+	for _, prop := range p.Properties {
+		if prop.Namespace != ns {
+			continue
+		}
+		valueType := ""
+		switch prop.Value.Kind {
+		case xmp.Simple:
+			valueType = "Text"
+			if prop.Value.URI {
+				valueType = "URI"
+			}
+		case xmp.Seq:
+			valueType = "seq Text"
+		case xmp.Bag:
+			valueType = "bag Text"
+		case xmp.Alt:
+			valueType = "Lang Alt"
+		default:
+			structs = append(structs, prop.Name)
+			continue
+		}
+		schema.Properties = append(schema.Properties, xmp.ExtensionProperty{
+			Name:      prop.Name,
+			ValueType: valueType,
+			Category:  "external",
+		})
+	}
+	for _, name := range structs {
+		p.Delete(ns, name)
+	}
+	if len(schema.Properties) > 0 {
+		p.AddExtension(schema)
+	}
+}
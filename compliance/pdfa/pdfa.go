@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/wudi/pdfkit/cmm"
 	"github.com/wudi/pdfkit/compliance"
 	"github.com/wudi/pdfkit/filters"
 	"github.com/wudi/pdfkit/ir/decoded"
@@ -102,225 +101,258 @@ type Enforcer interface {
 	Validate(ctx context.Context, doc *semantic.Document, level Level) (*compliance.Report, error)
 }
 
-type enforcerImpl struct{}
+type enforcerImpl struct {
+	rasterization bool
+}
+
+// Option configures an Enforcer.
+type Option func(*enforcerImpl)
+
+// WithRasterization lets Enforce replace pages it cannot convert otherwise
+// with a 150 DPI image of the page: PDF/A-1 pages using transparency and
+// pages using device colours the output intent does not allow, as in
+// shadings and the alternates of Separation spaces. The text of such a
+// page is kept as an invisible layer over the image, so it can still be
+// searched and extracted, and annotations are kept; the vector content is
+// lost. Without it transparency is removed from the objects using it and
+// the remaining colour problems are left for Validate to report.
+func WithRasterization(enabled bool) Option {
+	return func(e *enforcerImpl) {
+		e.rasterization = enabled
+	}
+}
 
-func NewEnforcer() Enforcer { return &enforcerImpl{} }
+func NewEnforcer(opts ...Option) Enforcer {
+	e := &enforcerImpl{}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// validator holds the state of a validation.
+type validator struct {
+	report
+	ctx context.Context
+	doc *semantic.Document
+}
 
+// enforcement holds the state of an Enforce call.
+type enforcement struct {
+	ctx           context.Context
+	doc           *semantic.Document
+	level         Level
+	srgb          *semantic.ICCBasedColorSpace
+	rasterization bool
+}
+
+// Enforce converts doc to level: encryption is removed, output intents,
+// XMP metadata and annotations are brought in line, fonts that are not
+// embedded or that do not match their dictionaries are replaced by
+// embedded substitutes, device colours are converted or tagged, and for
+// PDF/A-1 optional content is removed and transparency flattened. With
+// WithRasterization, what cannot be converted otherwise is rasterized page
+// by page. The file structure requirements are met by writing doc.
 func (e *enforcerImpl) Enforce(ctx context.Context, doc *semantic.Document, level Level) error {
-	// 1. Remove encryption
+	if err := doc.LoadPages(ctx); err != nil {
+		return err
+	}
+	en := &enforcement{ctx: ctx, doc: doc, level: level, rasterization: e.rasterization}
 	if doc.Encrypted {
 		doc.Encrypted = false
 		doc.Permissions = raw.Permissions{}
 		doc.OwnerPassword = ""
 		doc.UserPassword = ""
 	}
-
-	// 2. Add OutputIntent if missing
-	if len(doc.OutputIntents) == 0 {
-		doc.OutputIntents = []semantic.OutputIntent{
-			{
-				S:                         "GTS_PDFA1",
-				OutputConditionIdentifier: "sRGB IEC61966-2.1",
-				Info:                      "sRGB IEC61966-2.1",
-				DestOutputProfile:         DefaultICCProfile,
-			},
-		}
-	}
-
-	// 3. Remove forbidden annotations
-	for _, p := range doc.Pages {
-		if err := checkCancelled(ctx); err != nil {
+	en.fixOutputIntents()
+	if level.IsLevelA1() {
+		if err := en.removeLayers(); err != nil {
 			return err
 		}
-		if len(p.Annotations) == 0 {
-			continue
-		}
-		var validAnnots []semantic.Annotation
-		for _, annot := range p.Annotations {
-			if !isForbiddenAnnotation(annot, level) {
-				validAnnots = append(validAnnots, annot)
-			}
+		if err := en.flattenTransparency(); err != nil {
+			return err
 		}
-		p.Annotations = validAnnots
 	}
-
+	if err := en.fixAnnotations(); err != nil {
+		return err
+	}
+	if err := en.fixImages(); err != nil {
+		return err
+	}
+	en.fixEmbeddedFiles()
+	use, err := scanContent(ctx, doc)
+	if err != nil {
+		return err
+	}
+	if err := en.fixFonts(use); err != nil {
+		return err
+	}
+	if err := en.fixColours(); err != nil {
+		return err
+	}
+	en.fixOptionalContent()
+	en.fixMetadata()
+	doc.Dirty = true
 	return nil
 }
 
+// Validate checks doc against the requirements of level. Violations carry
+// the identifier of the requirement in the part of ISO 19005 the level
+// belongs to, as in "6.2.11.4.1-1".
 func (e *enforcerImpl) Validate(ctx context.Context, doc *semantic.Document, level Level) (*compliance.Report, error) {
-	report := &compliance.Report{
-		Standard:   level.String(),
-		Violations: []compliance.Violation{},
+	if err := doc.LoadPages(ctx); err != nil {
+		return nil, err
+	}
+	v := &validator{
+		report: report{level: level, Report: &compliance.Report{
+			Standard:   level.String(),
+			Violations: []compliance.Violation{},
+		}},
+		ctx: ctx,
+		doc: doc,
 	}
-
-	// 1. Encryption forbidden
 	if doc.Encrypted {
-		report.Violations = append(report.Violations, compliance.Violation{
-			Code:        "ENC001",
-			Description: "Encryption is forbidden in PDF/A",
-			Location:    "Document",
-		})
+		v.add(ruleEncrypt, "Document", "")
 	}
-
-	// 2. OutputIntent required
-	if len(doc.OutputIntents) == 0 {
-		report.Violations = append(report.Violations, compliance.Violation{
-			Code:        "INT001",
-			Description: "OutputIntent is required",
-			Location:    "Catalog",
-		})
-	} else {
-		// Validate OutputIntent profile
-		for _, intent := range doc.OutputIntents {
-			if intent.DestOutputProfile != nil {
-				if _, err := cmm.NewICCProfile(intent.DestOutputProfile); err != nil {
-					report.Violations = append(report.Violations, compliance.Violation{
-						Code:        "INT002",
-						Description: "Invalid OutputIntent ICC profile: " + err.Error(),
-						Location:    "OutputIntent",
-					})
-				}
-			}
-		}
+	v.checkOutputIntents()
+	use, err := scanContent(ctx, doc)
+	if err != nil {
+		return nil, err
 	}
-
-	// 3. Font embedding required
-	visitedFonts := make(map[*semantic.Font]bool)
-
-	// 4. Transparency and Layers (if forbidden)
-	checkTransparency := !level.AllowsTransparency()
-	checkLayers := !level.AllowsLayers()
-
-	for i, p := range doc.Pages {
-		if err := checkCancelled(ctx); err != nil {
+	v.checkColours(use)
+	v.checkResources(use)
+	v.checkFonts(use)
+	v.checkAnnotations()
+	v.checkForms()
+	v.checkOptionalContent()
+	v.checkMetadata()
+	if err := v.checkEmbeddedFiles(); err != nil {
+		return nil, err
+	}
+	// Enforce marks the document dirty: its file structure is the one the
+	// writer will produce, not the one it was read from.
+	if !doc.Dirty {
+		if err := v.checkStructure(ctx, doc); err != nil {
 			return nil, err
 		}
-		pageLoc := "Page " + string(rune(i+1))
-
-		if p.Resources != nil {
-			// Check Fonts
-			for name, font := range p.Resources.Fonts {
-				if visitedFonts[font] {
-					continue
-				}
-				visitedFonts[font] = true
-
-				if !isFontEmbedded(font) {
-					report.Violations = append(report.Violations, compliance.Violation{
-						Code:        "FNT001",
-						Description: "Font must be embedded: " + font.BaseFont,
-						Location:    pageLoc + " Resource " + name,
-					})
-				}
-			}
+	}
+	v.Compliant = len(v.Violations) == 0
+	return v.Report, nil
+}
 
-			// Check Transparency in ExtGState
-			if checkTransparency {
-				for name, gs := range p.Resources.ExtGStates {
-					if isTransparent(gs) {
-						report.Violations = append(report.Violations, compliance.Violation{
-							Code:        "TRN001",
-							Description: "Transparency is forbidden in " + level.String(),
-							Location:    pageLoc + " ExtGState " + name,
-						})
-					}
-				}
-			}
+// checkOptionalContent checks the optional content properties: PDF/A-1
+// forbids them, and PDF/A-2 and later require named configurations
+// without automatic state changes.
+func (v *validator) checkOptionalContent() {
+	oc := v.doc.OCProperties
+	if oc == nil {
+		return
+	}
+	if v.level.IsLevelA1() {
+		v.add(ruleOCProperties, "Catalog", "")
+		return
+	}
+	for i, cfg := range append([]*semantic.OCConfig{oc.D}, oc.Configs...) {
+		if cfg == nil {
+			continue
+		}
+		loc := "OCProperties D"
+		if i > 0 {
+			loc = fmt.Sprintf("OCProperties Configs %d", i)
+		}
+		if cfg.Name == "" {
+			v.add(ruleOCConfigName, loc, "")
+		}
+		if len(cfg.AS) > 0 {
+			v.add(ruleOCConfigAS, loc, "")
+		}
+	}
+}
 
-			// Check Layers (Optional Content)
-			if checkLayers {
-				for name, prop := range p.Resources.Properties {
-					if _, ok := prop.(*semantic.OptionalContentGroup); ok {
-						report.Violations = append(report.Violations, compliance.Violation{
-							Code:        "LYR001",
-							Description: "Optional Content (Layers) is forbidden in " + level.String(),
-							Location:    pageLoc + " Property " + name,
-						})
-					}
-					if _, ok := prop.(*semantic.OptionalContentMembership); ok {
-						report.Violations = append(report.Violations, compliance.Violation{
-							Code:        "LYR001",
-							Description: "Optional Content (Layers) is forbidden in " + level.String(),
-							Location:    pageLoc + " Property " + name,
-						})
-					}
-				}
+// fixOptionalContent names unnamed configurations and removes their
+// automatic state changes.
+func (e *enforcement) fixOptionalContent() {
+	oc := e.doc.OCProperties
+	if oc == nil {
+		return
+	}
+	for i, cfg := range append([]*semantic.OCConfig{oc.D}, oc.Configs...) {
+		if cfg == nil {
+			continue
+		}
+		if cfg.Name == "" {
+			cfg.Name = "Default"
+			if i > 0 {
+				cfg.Name = fmt.Sprintf("Configuration %d", i)
 			}
+		}
+		cfg.AS = nil
+	}
+	oc.Dirty = true
+}
 
-			// Check XObjects for Transparency (SMask)
-			if checkTransparency {
-				for name, xobj := range p.Resources.XObjects {
-					if xobj.SMask != nil {
-						report.Violations = append(report.Violations, compliance.Violation{
-							Code:        "TRN002",
-							Description: "Image SMask (Transparency) is forbidden in " + level.String(),
-							Location:    pageLoc + " XObject " + name,
-						})
-					}
-					if xobj.Group != nil {
-						// Transparency Group XObject
-						report.Violations = append(report.Violations, compliance.Violation{
-							Code:        "TRN003",
-							Description: "Transparency Group XObject is forbidden in " + level.String(),
-							Location:    pageLoc + " XObject " + name,
-						})
-					}
+// checkEmbeddedFiles checks the embedded files: PDF/A-1 forbids them,
+// PDF/A-2 allows PDF/A files only and PDF/A-3 and -4 allow any file that
+// declares its MIME type and relationship to the document.
+func (v *validator) checkEmbeddedFiles() error {
+	for _, ef := range v.doc.EmbeddedFiles {
+		if err := checkCancelled(v.ctx); err != nil {
+			return err
+		}
+		loc := "EmbeddedFile " + ef.Name
+		if !v.level.AllowsAttachment() {
+			v.add(ruleEmbeddedFile, loc, "")
+			continue
+		}
+		if v.level.IsLevelA2() {
+			if ef.Subtype != "application/pdf" {
+				v.add(ruleEmbeddedPDFA, loc, "not a PDF file")
+			} else if err := validateEmbeddedPDF(v.ctx, ef.Data, v.level); err != nil {
+				if _, ok := err.(*ValidationCancelledError); ok {
+					return err
 				}
+				v.add(ruleEmbeddedPDFA, loc, err.Error())
 			}
+			continue
 		}
-
-		// 5. Annotations
-		for _, annot := range p.Annotations {
-			if isForbiddenAnnotation(annot, level) {
-				report.Violations = append(report.Violations, compliance.Violation{
-					Code:        "ACT001",
-					Description: "Forbidden annotation type or action for " + level.String() + ": " + annot.Base().Subtype,
-					Location:    pageLoc,
-				})
-			}
+		if ef.Relationship == "" {
+			v.add(ruleEmbeddedRelationship, loc, "")
+		}
+		if ef.Subtype == "" {
+			v.add(ruleEmbeddedSubtype, loc, "")
 		}
 	}
+	return nil
+}
 
-	// 6. Embedded Files
-	if len(doc.EmbeddedFiles) > 0 {
-		if !level.AllowsAttachment() {
-			report.Violations = append(report.Violations, compliance.Violation{
-				Code:        "ATT001",
-				Description: "Embedded files are forbidden in " + level.String(),
-				Location:    "Catalog",
-			})
-		} else if !level.AllowsArbitraryAttachment() {
-			// Must check if attachments are PDF/A compliant
-			for _, ef := range doc.EmbeddedFiles {
-				if ef.Subtype != "application/pdf" {
-					// If not PDF, it must be associated with a relationship (PDF/A-3)
-					// But if we are in PDF/A-2, only PDF/A compliant PDFs are allowed.
-					// Since we can't easily validate the embedded file recursively here without loading it,
-					// we check for metadata or assume non-compliant if it's not PDF.
-					if level.IsLevelA2() {
-						report.Violations = append(report.Violations, compliance.Violation{
-							Code:        "ATT002",
-							Description: "Embedded file must be PDF/A compliant in " + level.String(),
-							Location:    "EmbeddedFile " + ef.Name,
-						})
-					}
-				}
-				// Recursively validate embedded PDF
-				if ef.Subtype == "application/pdf" && len(ef.Data) > 0 {
-					if err := validateEmbeddedPDF(ctx, ef.Data, level); err != nil {
-						report.Violations = append(report.Violations, compliance.Violation{
-							Code:        "ATT003",
-							Description: "Embedded PDF validation failed: " + err.Error(),
-							Location:    "EmbeddedFile " + ef.Name,
-						})
-					}
-				}
+// fixEmbeddedFiles removes the embedded files the level does not allow
+// and gives the rest the entries it requires.
+func (e *enforcement) fixEmbeddedFiles() {
+	if len(e.doc.EmbeddedFiles) == 0 {
+		return
+	}
+	var kept []semantic.EmbeddedFile
+	for _, ef := range e.doc.EmbeddedFiles {
+		switch {
+		case !e.level.AllowsAttachment():
+			continue
+		case e.level.IsLevelA2():
+			if ef.Subtype != "application/pdf" || validateEmbeddedPDF(e.ctx, ef.Data, e.level) != nil {
+				continue
+			}
+		default:
+			if ef.Relationship == "" {
+				ef.Relationship = "Unspecified"
+				ef.Dirty = true
+			}
+			if ef.Subtype == "" {
+				ef.Subtype = "application/octet-stream"
+				ef.Dirty = true
 			}
 		}
+		kept = append(kept, ef)
 	}
-
-	report.Compliant = len(report.Violations) == 0
-	return report, nil
+	e.doc.EmbeddedFiles = kept
 }
 
 func validateEmbeddedPDF(ctx context.Context, data []byte, level Level) error {
@@ -382,104 +414,6 @@ func validateEmbeddedPDF(ctx context.Context, data []byte, level Level) error {
 	return nil
 }
 
-func isTransparent(gs semantic.ExtGState) bool {
-	if gs.SoftMask != nil {
-		return true
-	}
-	if gs.StrokeAlpha != nil && *gs.StrokeAlpha < 1.0 {
-		return true
-	}
-	if gs.FillAlpha != nil && *gs.FillAlpha < 1.0 {
-		return true
-	}
-	if gs.BlendMode != "" && gs.BlendMode != "Normal" && gs.BlendMode != "Compatible" {
-		return true
-	}
-	return false
-}
-
-func isFontEmbedded(f *semantic.Font) bool {
-	if f == nil {
-		return false
-	}
-	// Type3 fonts are defined by streams in the PDF, effectively embedded.
-	if f.Subtype == "Type3" {
-		return true
-	}
-	// Standard 14 fonts must also be embedded in PDF/A.
-	if f.Descriptor != nil && len(f.Descriptor.FontFile) > 0 {
-		return true
-	}
-	// Check descendant for Type0
-	if f.Subtype == "Type0" && f.DescendantFont != nil {
-		if f.DescendantFont.Descriptor != nil && len(f.DescendantFont.Descriptor.FontFile) > 0 {
-			return true
-		}
-	}
-	return false
-}
-
-func isForbiddenAnnotation(a semantic.Annotation, level Level) bool {
-	subtype := a.Base().Subtype
-
-	// Common forbidden types for A-1
-	if level.IsLevelA1() {
-		switch subtype {
-		case "Movie", "Sound", "Screen", "3D", "FileAttachment":
-			return true
-		}
-	} else {
-		// A-2+ allows more
-		switch subtype {
-		case "Movie", "Sound": // Still forbidden in A-2 (Screen used instead)
-			return true
-		}
-	}
-
-	// Check for JavaScript in URI (simplified check)
-	if link, ok := a.(*semantic.LinkAnnotation); ok {
-		if len(link.URI) > 11 && link.URI[:11] == "javascript:" {
-			return true
-		}
-		if checkAction(link.Action, level) {
-			return true
-		}
-	}
-
-	if screen, ok := a.(*semantic.ScreenAnnotation); ok {
-		if checkAction(screen.Action, level) {
-			return true
-		}
-	}
-
-	return false
-}
-
-func checkAction(a semantic.Action, level Level) bool {
-	if a == nil {
-		return false
-	}
-	switch a.ActionType() {
-	case "Launch":
-		return true // Forbidden in all PDF/A versions
-	case "Sound", "Movie":
-		return true // Forbidden (use Screen annotation instead)
-	case "ImportData":
-		return true // Forbidden in all PDF/A versions
-	case "ResetForm", "SubmitForm":
-		if level.IsLevelA1() {
-			return true // Forbidden in PDF/A-1
-		}
-		return false // Allowed in PDF/A-2+
-	case "JavaScript":
-		if level.IsLevelA1() {
-			return true // Forbidden in PDF/A-1
-		}
-		return false // Allowed in PDF/A-2+
-	}
-	return false
-}
-
 func checkCancelled(ctx context.Context) error {
 	select {
 	case <-ctx.Done():
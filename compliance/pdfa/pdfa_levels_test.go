@@ -47,13 +47,13 @@ func TestPDFALevels(t *testing.T) {
 
 		// A-1b: Forbidden
 		rep, _ := e.Validate(ctx, doc, pdfa.PDFA1B)
-		if !hasViolation(rep, "TRN001") {
+		if !hasViolation(rep, "6.4-5") {
 			t.Error("Expected transparency violation in PDF/A-1b")
 		}
 
 		// A-2b: Allowed
 		rep, _ = e.Validate(ctx, doc, pdfa.PDFA2B)
-		if hasViolation(rep, "TRN001") {
+		if hasViolation(rep, "6.4-5") {
 			t.Error("Unexpected transparency violation in PDF/A-2b")
 		}
 	})
@@ -66,13 +66,13 @@ func TestPDFALevels(t *testing.T) {
 
 		// A-1b: Forbidden
 		rep, _ := e.Validate(ctx, doc, pdfa.PDFA1B)
-		if !hasViolation(rep, "LYR001") {
+		if !hasViolation(rep, "6.1.13-1") {
 			t.Error("Expected layer violation in PDF/A-1b")
 		}
 
 		// A-2b: Allowed
 		rep, _ = e.Validate(ctx, doc, pdfa.PDFA2B)
-		if hasViolation(rep, "LYR001") {
+		if hasViolation(rep, "6.1.13-1") {
 			t.Error("Unexpected layer violation in PDF/A-2b")
 		}
 	})
@@ -85,13 +85,13 @@ func TestPDFALevels(t *testing.T) {
 
 		// A-1b: Forbidden
 		rep, _ := e.Validate(ctx, doc, pdfa.PDFA1B)
-		if !hasViolation(rep, "ATT001") {
+		if !hasViolation(rep, "6.1.11-2") {
 			t.Error("Expected attachment violation in PDF/A-1b")
 		}
 
 		// A-3b: Allowed
 		rep, _ = e.Validate(ctx, doc, pdfa.PDFA3B)
-		if hasViolation(rep, "ATT001") {
+		if hasViolation(rep, "6.1.11-2") {
 			t.Error("Unexpected attachment violation in PDF/A-3b")
 		}
 	})
@@ -104,13 +104,13 @@ func TestPDFALevels(t *testing.T) {
 
 		// A-1b: Forbidden
 		rep, _ := e.Validate(ctx, doc, pdfa.PDFA1B)
-		if !hasViolation(rep, "ACT001") {
+		if !hasViolation(rep, "6.5.2-1") {
 			t.Error("Expected Movie annotation violation in PDF/A-1b")
 		}
 
 		// A-2b: Forbidden (Movie is deprecated/forbidden in A-2 as well, use Screen)
 		rep, _ = e.Validate(ctx, doc, pdfa.PDFA2B)
-		if !hasViolation(rep, "ACT001") {
+		if !hasViolation(rep, "6.3.1-1") {
 			t.Error("Expected Movie annotation violation in PDF/A-2b")
 		}
 	})
@@ -7,6 +7,7 @@ import (
 	"github.com/wudi/pdfkit/compliance/pdfa"
 	"github.com/wudi/pdfkit/ir/semantic"
 	"github.com/wudi/pdfkit/writer"
+	"github.com/wudi/pdfkit/xmp"
 )
 
 func TestPDFALevelSharedType(t *testing.T) {
@@ -100,11 +101,15 @@ func TestPDFAEncryptedDocumentFailsValidation(t *testing.T) {
 	e := pdfa.NewEnforcer()
 	ctx := context.Background()
 
+	metadata := xmp.New()
+	metadata.SetPDFAIdentification(1, "B")
 	doc := &semantic.Document{
 		Encrypted: true,
 		OutputIntents: []semantic.OutputIntent{{
-			S: "GTS_PDFA1",
+			S:                 "GTS_PDFA1",
+			DestOutputProfile: pdfa.DefaultICCProfile,
 		}},
+		Metadata: &semantic.XMPMetadata{Packet: metadata},
 		Pages: []*semantic.Page{
 			{
 				MediaBox: semantic.Rectangle{URX: 10, URY: 10},
@@ -130,10 +135,32 @@ func TestPDFAEncryptedDocumentFailsValidation(t *testing.T) {
 	if rep.Compliant {
 		t.Fatal("expected encrypted document to be non-compliant")
 	}
-	if !hasViolation(rep, "ENC001") {
+	if !hasViolation(rep, "6.1.3-2") {
 		t.Fatalf("expected encryption violation, got %+v", rep.Violations)
 	}
 	if len(rep.Violations) != 1 {
 		t.Fatalf("expected only encryption violation, got %+v", rep.Violations)
 	}
 }
+
+func TestPDFAOutputIntentProfileClass(t *testing.T) {
+	e := pdfa.NewEnforcer()
+	// The default sRGB profile relabelled as an input ('scnr') profile.
+	profile := append([]byte(nil), pdfa.DefaultICCProfile...)
+	copy(profile[12:16], "scnr")
+	doc := &semantic.Document{
+		OutputIntents: []semantic.OutputIntent{{S: "GTS_PDFA1", DestOutputProfile: profile}},
+		Pages:         []*semantic.Page{{MediaBox: semantic.Rectangle{URX: 10, URY: 10}}},
+	}
+	rep, err := e.Validate(context.Background(), doc, pdfa.PDFA1B)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if !hasViolation(rep, "6.2.2-1") {
+		t.Fatalf("expected output intent violation, got %+v", rep.Violations)
+	}
+	doc.OutputIntents[0].DestOutputProfile = pdfa.DefaultICCProfile
+	if rep, _ = e.Validate(context.Background(), doc, pdfa.PDFA1B); hasViolation(rep, "6.2.2-1") {
+		t.Fatalf("default profile rejected: %+v", rep.Violations)
+	}
+}
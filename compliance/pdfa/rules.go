@@ -0,0 +1,129 @@
+package pdfa
+
+import "github.com/wudi/pdfkit/compliance"
+
+// rule is a requirement of ISO 19005. Violations are reported with the
+// identifier of the requirement in the part the level belongs to: the
+// clause of that part followed by the number of the test within it, as in
+// "6.3.4-1". The parts number their clauses differently, so a rule holds
+// one identifier each for PDF/A-1, for PDF/A-2 and -3 (which share their
+// clause structure) and for PDF/A-4; an empty identifier means the part
+// has no such requirement.
+type rule struct {
+	ids  [3]string
+	desc string
+}
+
+// id returns the identifier of r in the part of level, or "".
+func (r rule) id(level Level) string {
+	switch {
+	case level.IsLevelA1():
+		return r.ids[0]
+	case level.IsLevelA4():
+		return r.ids[2]
+	default:
+		return r.ids[1]
+	}
+}
+
+// File structure.
+var (
+	ruleTrailerID    = rule{[3]string{"6.1.3-1", "6.1.3-1", "6.1.3-1"}, "The file trailer shall contain the ID keyword"}
+	ruleEncrypt      = rule{[3]string{"6.1.3-2", "6.1.3-2", "6.1.3-2"}, "The Encrypt key shall not be present in the trailer"}
+	ruleStreamLength = rule{[3]string{"6.1.7-1", "6.1.7.1-1", "6.1.7.1-1"}, "The Length of a stream shall match the number of bytes between stream and endstream"}
+	ruleStreamFile   = rule{[3]string{"6.1.7-3", "6.1.7.1-3", "6.1.7.1-3"}, "A stream dictionary shall not contain the F, FFilter or FDecodeParms keys"}
+	ruleFilterLZW    = rule{[3]string{"6.1.10-1", "6.1.7.2-1", "6.1.7.2-1"}, "The LZWDecode filter shall not be used"}
+	ruleFilterCrypt  = rule{[3]string{"", "6.1.7.2-2", "6.1.7.2-2"}, "The Crypt filter shall not be used"}
+	ruleEmbeddedFile = rule{[3]string{"6.1.11-2", "", ""}, "The name dictionary shall not contain EmbeddedFiles"}
+	ruleOCProperties = rule{[3]string{"6.1.13-1", "", ""}, "The catalog shall not contain OCProperties"}
+	ruleOCConfigName = rule{[3]string{"", "6.9-1", ""}, "Each optional content configuration shall contain a Name"}
+	ruleOCConfigAS   = rule{[3]string{"", "6.9-4", ""}, "An optional content configuration shall not contain the AS key"}
+	ruleNeedsRender  = rule{[3]string{"", "6.4.2-2", "6.4.2-2"}, "The catalog shall not contain NeedsRendering"}
+)
+
+// Graphics.
+var (
+	ruleOutputIntentProfile  = rule{[3]string{"6.2.2-1", "6.2.3-3", "6.2.3-3"}, "The DestOutputProfile of a PDF/A output intent shall be a valid output or monitor ICC profile"}
+	ruleOutputIntentMultiple = rule{[3]string{"6.2.2-2", "6.2.3-2", "6.2.3-2"}, "All PDF/A output intents shall use the same DestOutputProfile"}
+	ruleDeviceRGB            = rule{[3]string{"6.2.3.3-1", "6.2.4.3-2", "6.2.4.3-2"}, "DeviceRGB shall only be used with an RGB output intent or a DefaultRGB colour space"}
+	ruleDeviceCMYK           = rule{[3]string{"6.2.3.3-2", "6.2.4.3-3", "6.2.4.3-3"}, "DeviceCMYK shall only be used with a CMYK output intent or a DefaultCMYK colour space"}
+	ruleDeviceGray           = rule{[3]string{"6.2.3.3-3", "6.2.4.3-4", "6.2.4.3-4"}, "DeviceGray shall only be used with an output intent or a DefaultGray colour space"}
+	ruleImageInterpolate     = rule{[3]string{"6.2.4-3", "6.2.8-3", "6.2.8-3"}, "The Interpolate key of an image shall be false"}
+	ruleImageAlternates      = rule{[3]string{"6.2.4-1", "6.2.8-1", "6.2.8-1"}, "An image dictionary shall not contain Alternates"}
+	ruleImageOPI             = rule{[3]string{"6.2.4-2", "6.2.8-2", "6.2.8-2"}, "An image dictionary shall not contain OPI"}
+	ruleFormXObject          = rule{[3]string{"6.2.5-1", "6.2.9-1", "6.2.9-1"}, "A form XObject shall not contain OPI or PS, or Subtype2 with the value PS"}
+	rulePostScript           = rule{[3]string{"6.2.7-1", "6.2.9-3", "6.2.9-3"}, "PostScript XObjects shall not be used"}
+	ruleTransfer             = rule{[3]string{"6.2.8-1", "6.2.5-1", "6.2.5-1"}, "An ExtGState shall not contain TR"}
+	ruleTransfer2            = rule{[3]string{"6.2.8-2", "6.2.5-2", "6.2.5-2"}, "An ExtGState shall not contain TR2 other than Default"}
+	ruleHalftone             = rule{[3]string{"", "6.2.5-3", "6.2.5-3"}, "An ExtGState shall not contain HTP"}
+	ruleRenderingIntent      = rule{[3]string{"6.2.9-1", "6.2.6-1", "6.2.6-1"}, "Rendering intents shall be RelativeColorimetric, AbsoluteColorimetric, Perceptual or Saturation"}
+)
+
+// Fonts.
+var (
+	ruleFontEmbedded = rule{[3]string{"6.3.4-1", "6.2.11.4.1-1", "6.2.10.4.1-1"}, "The font programs of all fonts used for rendering shall be embedded"}
+	ruleFontGlyphs   = rule{[3]string{"6.3.4-2", "6.2.11.4.1-2", "6.2.10.4.1-2"}, "Embedded font programs shall define all glyphs referenced for rendering"}
+	ruleFontWidths   = rule{[3]string{"6.3.6-1", "6.2.11.5-1", "6.2.10.5-1"}, "Glyph widths in the font dictionary shall match the widths in the font program"}
+	ruleFontUnicode  = rule{[3]string{"", "6.2.11.7-2", "6.2.10.7-1"}, "Each character code shall map to Unicode"}
+	ruleFontNotdef   = rule{[3]string{"", "6.2.11.8-1", "6.2.10.8-1"}, "The .notdef glyph shall not be referenced"}
+)
+
+// Transparency, PDF/A-1 only.
+var (
+	ruleSoftMask          = rule{[3]string{"6.4-1", "", ""}, "The SMask of an ExtGState shall be None"}
+	ruleImageSoftMask     = rule{[3]string{"6.4-2", "", ""}, "An XObject shall not contain an SMask"}
+	ruleTransparencyGroup = rule{[3]string{"6.4-3", "", ""}, "A group shall not have the subtype Transparency"}
+	ruleBlendMode         = rule{[3]string{"6.4-4", "", ""}, "The blend mode shall be Normal or Compatible"}
+	ruleAlpha             = rule{[3]string{"6.4-5", "", ""}, "The CA and ca values of an ExtGState shall be 1.0"}
+)
+
+// Annotations, actions and forms.
+var (
+	ruleAnnotationType       = rule{[3]string{"6.5.2-1", "6.3.1-1", "6.3.1-1"}, "Annotation types not permitted shall not be used"}
+	ruleAnnotationFlags      = rule{[3]string{"6.5.3-2", "6.3.2-2", "6.3.2-2"}, "Annotations shall be printable and not hidden, invisible or view-disabled"}
+	ruleAnnotationAppearance = rule{[3]string{"", "6.3.3-1", "6.3.3-1"}, "Annotations shall have a normal appearance"}
+	ruleAction               = rule{[3]string{"6.6.1-1", "6.5.1-1", "6.5.1-1"}, "Action types not permitted shall not be used"}
+	ruleCatalogActions       = rule{[3]string{"6.6.2-1", "6.5.2-1", "6.5.2-1"}, "The catalog shall not contain additional actions"}
+	rulePageActions          = rule{[3]string{"6.6.2-1", "6.5.2-2", "6.5.2-2"}, "A page shall not contain additional actions"}
+	ruleFieldActions         = rule{[3]string{"6.6.2-1", "6.4.1-2", "6.4.1-2"}, "A form field shall not contain additional actions"}
+	ruleNeedAppearances      = rule{[3]string{"6.9-1", "6.4.1-3", "6.4.1-3"}, "NeedAppearances shall be absent or false"}
+	ruleXFA                  = rule{[3]string{"", "6.4.2-1", "6.4.2-1"}, "The interactive form shall not contain XFA"}
+)
+
+// Metadata.
+var (
+	ruleMetadata        = rule{[3]string{"6.7.2-1", "6.6.2.1-1", "6.6.2.1-1"}, "The catalog shall contain a well-formed XMP metadata stream"}
+	ruleInfoConsistency = rule{[3]string{"6.7.3-1", "", ""}, "Document information entries shall be equivalent to their XMP properties"}
+	ruleExtensionSchema = rule{[3]string{"6.7.8-1", "6.6.2.3.1-1", ""}, "Properties not in predefined schemas shall be described by extension schemas"}
+	rulePDFAPart        = rule{[3]string{"6.7.11-1", "6.6.4-1", "6.6.4-1"}, "The pdfaid:part property shall identify the part of ISO 19005"}
+	rulePDFAConformance = rule{[3]string{"6.7.11-2", "6.6.4-2", "6.6.4-3"}, "The pdfaid:conformance property shall identify the conformance level"}
+	rulePDFARevision    = rule{[3]string{"", "", "6.6.4-2"}, "The pdfaid:rev property shall identify the year of the part"}
+)
+
+// Embedded files.
+var (
+	ruleEmbeddedPDFA         = rule{[3]string{"", "6.8-1", ""}, "Embedded files shall be PDF/A conforming files"}
+	ruleEmbeddedRelationship = rule{[3]string{"", "6.8-3", "6.9-2"}, "File specifications of embedded files shall contain AFRelationship"}
+	ruleEmbeddedSubtype      = rule{[3]string{"", "6.8-4", "6.9-3"}, "Embedded files shall declare their MIME type in Subtype"}
+)
+
+// report collects the violations of a validation.
+type report struct {
+	level Level
+	*compliance.Report
+}
+
+// add records a violation of r at loc, with detail appended to the rule's
+// description. Rules without an identifier in the level's part are
+// ignored.
+func (rep *report) add(r rule, loc, detail string) {
+	id := r.id(rep.level)
+	if id == "" {
+		return
+	}
+	desc := r.desc
+	if detail != "" {
+		desc += ": " + detail
+	}
+	rep.Violations = append(rep.Violations, compliance.Violation{Code: id, Description: desc, Location: loc})
+}
@@ -0,0 +1,83 @@
+package pdfa
+
+import "testing"
+
+// TestRuleIdentifiers pins the clause and test number each rule reports in
+// every part of ISO 19005, as numbered by the veraPDF validation profiles.
+func TestRuleIdentifiers(t *testing.T) {
+	tests := []struct {
+		name       string
+		r          rule
+		a1, a2, a4 string
+	}{
+		{"TrailerID", ruleTrailerID, "6.1.3-1", "6.1.3-1", "6.1.3-1"},
+		{"Encrypt", ruleEncrypt, "6.1.3-2", "6.1.3-2", "6.1.3-2"},
+		{"StreamLength", ruleStreamLength, "6.1.7-1", "6.1.7.1-1", "6.1.7.1-1"},
+		{"StreamFile", ruleStreamFile, "6.1.7-3", "6.1.7.1-3", "6.1.7.1-3"},
+		{"FilterLZW", ruleFilterLZW, "6.1.10-1", "6.1.7.2-1", "6.1.7.2-1"},
+		{"FilterCrypt", ruleFilterCrypt, "", "6.1.7.2-2", "6.1.7.2-2"},
+		{"EmbeddedFile", ruleEmbeddedFile, "6.1.11-2", "", ""},
+		{"OCProperties", ruleOCProperties, "6.1.13-1", "", ""},
+		{"OCConfigName", ruleOCConfigName, "", "6.9-1", ""},
+		{"OCConfigAS", ruleOCConfigAS, "", "6.9-4", ""},
+		{"NeedsRender", ruleNeedsRender, "", "6.4.2-2", "6.4.2-2"},
+
+		{"OutputIntentProfile", ruleOutputIntentProfile, "6.2.2-1", "6.2.3-3", "6.2.3-3"},
+		{"OutputIntentMultiple", ruleOutputIntentMultiple, "6.2.2-2", "6.2.3-2", "6.2.3-2"},
+		{"DeviceRGB", ruleDeviceRGB, "6.2.3.3-1", "6.2.4.3-2", "6.2.4.3-2"},
+		{"DeviceCMYK", ruleDeviceCMYK, "6.2.3.3-2", "6.2.4.3-3", "6.2.4.3-3"},
+		{"DeviceGray", ruleDeviceGray, "6.2.3.3-3", "6.2.4.3-4", "6.2.4.3-4"},
+		{"ImageAlternates", ruleImageAlternates, "6.2.4-1", "6.2.8-1", "6.2.8-1"},
+		{"ImageOPI", ruleImageOPI, "6.2.4-2", "6.2.8-2", "6.2.8-2"},
+		{"ImageInterpolate", ruleImageInterpolate, "6.2.4-3", "6.2.8-3", "6.2.8-3"},
+		{"FormXObject", ruleFormXObject, "6.2.5-1", "6.2.9-1", "6.2.9-1"},
+		{"PostScript", rulePostScript, "6.2.7-1", "6.2.9-3", "6.2.9-3"},
+		{"Transfer", ruleTransfer, "6.2.8-1", "6.2.5-1", "6.2.5-1"},
+		{"Transfer2", ruleTransfer2, "6.2.8-2", "6.2.5-2", "6.2.5-2"},
+		{"Halftone", ruleHalftone, "", "6.2.5-3", "6.2.5-3"},
+		{"RenderingIntent", ruleRenderingIntent, "6.2.9-1", "6.2.6-1", "6.2.6-1"},
+
+		{"FontEmbedded", ruleFontEmbedded, "6.3.4-1", "6.2.11.4.1-1", "6.2.10.4.1-1"},
+		{"FontGlyphs", ruleFontGlyphs, "6.3.4-2", "6.2.11.4.1-2", "6.2.10.4.1-2"},
+		{"FontWidths", ruleFontWidths, "6.3.6-1", "6.2.11.5-1", "6.2.10.5-1"},
+		{"FontUnicode", ruleFontUnicode, "", "6.2.11.7-2", "6.2.10.7-1"},
+		{"FontNotdef", ruleFontNotdef, "", "6.2.11.8-1", "6.2.10.8-1"},
+
+		{"SoftMask", ruleSoftMask, "6.4-1", "", ""},
+		{"ImageSoftMask", ruleImageSoftMask, "6.4-2", "", ""},
+		{"TransparencyGroup", ruleTransparencyGroup, "6.4-3", "", ""},
+		{"BlendMode", ruleBlendMode, "6.4-4", "", ""},
+		{"Alpha", ruleAlpha, "6.4-5", "", ""},
+
+		{"AnnotationType", ruleAnnotationType, "6.5.2-1", "6.3.1-1", "6.3.1-1"},
+		{"AnnotationFlags", ruleAnnotationFlags, "6.5.3-2", "6.3.2-2", "6.3.2-2"},
+		{"AnnotationAppearance", ruleAnnotationAppearance, "", "6.3.3-1", "6.3.3-1"},
+		{"Action", ruleAction, "6.6.1-1", "6.5.1-1", "6.5.1-1"},
+		{"CatalogActions", ruleCatalogActions, "6.6.2-1", "6.5.2-1", "6.5.2-1"},
+		{"PageActions", rulePageActions, "6.6.2-1", "6.5.2-2", "6.5.2-2"},
+		{"FieldActions", ruleFieldActions, "6.6.2-1", "6.4.1-2", "6.4.1-2"},
+		{"NeedAppearances", ruleNeedAppearances, "6.9-1", "6.4.1-3", "6.4.1-3"},
+		{"XFA", ruleXFA, "", "6.4.2-1", "6.4.2-1"},
+
+		{"Metadata", ruleMetadata, "6.7.2-1", "6.6.2.1-1", "6.6.2.1-1"},
+		{"InfoConsistency", ruleInfoConsistency, "6.7.3-1", "", ""},
+		{"ExtensionSchema", ruleExtensionSchema, "6.7.8-1", "6.6.2.3.1-1", ""},
+		{"PDFAPart", rulePDFAPart, "6.7.11-1", "6.6.4-1", "6.6.4-1"},
+		{"PDFAConformance", rulePDFAConformance, "6.7.11-2", "6.6.4-2", "6.6.4-3"},
+		{"PDFARevision", rulePDFARevision, "", "", "6.6.4-2"},
+
+		{"EmbeddedPDFA", ruleEmbeddedPDFA, "", "6.8-1", ""},
+		{"EmbeddedRelationship", ruleEmbeddedRelationship, "", "6.8-3", "6.9-2"},
+		{"EmbeddedSubtype", ruleEmbeddedSubtype, "", "6.8-4", "6.9-3"},
+	}
+	for _, tt := range tests {
+		for _, c := range []struct {
+			level Level
+			want  string
+		}{{PDFA1B, tt.a1}, {PDFA2B, tt.a2}, {PDFA3B, tt.a2}, {PDFA4, tt.a4}} {
+			if got := tt.r.id(c.level); got != c.want {
+				t.Errorf("%s in %v = %q, want %q", tt.name, c.level, got, c.want)
+			}
+		}
+	}
+}
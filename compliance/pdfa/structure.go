@@ -0,0 +1,198 @@
+package pdfa
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/wudi/pdfkit/ir/raw"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// maxObjectDepth bounds the nesting of direct objects followed when
+// checking the file structure.
+const maxObjectDepth = 32
+
+// checkStructure validates the objects of a parsed document as they were
+// read: the trailer, stream dictionaries and keys the semantic model does
+// not carry. The writer regenerates all of these, so the violations found
+// here are resolved by writing the document. Documents built in memory
+// have no file structure to check.
+func (v *validator) checkStructure(ctx context.Context, doc *semantic.Document) error {
+	dec := doc.Decoded()
+	if dec == nil || dec.Raw == nil {
+		return nil
+	}
+	rd := dec.Raw
+	if rd.Trailer != nil {
+		if _, ok := rd.Trailer.Get(raw.NameLiteral("ID")); !ok {
+			v.add(ruleTrailerID, "Trailer", "")
+		}
+		if root, ok := rd.Trailer.Get(raw.NameLiteral("Root")); ok {
+			if catalog, ok := resolveRaw(rd, root).(*raw.DictObj); ok {
+				if _, ok := catalog.Get(raw.NameLiteral("AA")); ok {
+					v.add(ruleCatalogActions, "Catalog", "")
+				}
+				if needs, ok := catalog.Get(raw.NameLiteral("NeedsRendering")); ok {
+					if b, ok := needs.(raw.BoolObj); !ok || b.V {
+						v.add(ruleNeedsRender, "Catalog", "")
+					}
+				}
+			}
+		}
+	}
+	for i, ref := range rd.Refs() {
+		if i%256 == 0 {
+			if err := checkCancelled(ctx); err != nil {
+				return err
+			}
+		}
+		obj, ok := rd.Get(ref)
+		if !ok {
+			continue
+		}
+		loc := fmt.Sprintf("Object %d %d R", ref.Num, ref.Gen)
+		if s, ok := obj.(*raw.StreamObj); ok && !rd.Encrypted {
+			v.checkStream(rd, s, loc)
+		}
+		v.checkObject(obj, loc, 0)
+	}
+	return nil
+}
+
+// checkStream checks a stream's Length and filters.
+func (v *validator) checkStream(rd *raw.Document, s *raw.StreamObj, loc string) {
+	if s.Dict == nil {
+		return
+	}
+	if l, ok := s.Dict.Get(raw.NameLiteral("Length")); ok {
+		if n, ok := resolveRaw(rd, l).(raw.NumberObj); ok && n.Int() != int64(len(s.Data)) {
+			v.add(ruleStreamLength, loc, fmt.Sprintf("Length %d, %d bytes", n.Int(), len(s.Data)))
+		}
+	}
+	for _, key := range []string{"F", "FFilter", "FDecodeParms"} {
+		if _, ok := s.Dict.Get(raw.NameLiteral(key)); ok {
+			v.add(ruleStreamFile, loc, key)
+		}
+	}
+	for _, f := range filterNames(resolveRaw(rd, dictValue(s.Dict, "Filter"))) {
+		switch f {
+		case "LZWDecode", "LZW":
+			v.add(ruleFilterLZW, loc, "")
+		case "Crypt":
+			v.add(ruleFilterCrypt, loc, "")
+		}
+	}
+}
+
+// checkObject checks the keys of the dictionaries in obj, following
+// direct objects only: indirect ones are checked on their own.
+func (v *validator) checkObject(obj raw.Object, loc string, depth int) {
+	if depth > maxObjectDepth {
+		return
+	}
+	var d *raw.DictObj
+	switch o := obj.(type) {
+	case *raw.StreamObj:
+		d = o.Dict
+	case *raw.DictObj:
+		d = o
+	case *raw.ArrayObj:
+		for _, item := range o.Items {
+			v.checkObject(item, loc, depth+1)
+		}
+		return
+	default:
+		return
+	}
+	if d == nil {
+		return
+	}
+	v.checkDict(d, loc)
+	for _, key := range slices.Sorted(maps.Keys(d.KV)) {
+		v.checkObject(d.KV[key], loc, depth+1)
+	}
+}
+
+// checkDict checks for keys PDF/A forbids in a dictionary.
+func (v *validator) checkDict(d *raw.DictObj, loc string) {
+	typ, subtype := nameValue(d, "Type"), nameValue(d, "Subtype")
+	has := func(key string) bool {
+		_, ok := d.Get(raw.NameLiteral(key))
+		return ok
+	}
+	switch {
+	case typ == "Page" && has("AA"):
+		v.add(rulePageActions, loc, "")
+	case subtype == "Image":
+		if has("Alternates") {
+			v.add(ruleImageAlternates, loc, "")
+		}
+		if has("OPI") {
+			v.add(ruleImageOPI, loc, "")
+		}
+	case subtype == "Form":
+		for _, key := range []string{"OPI", "PS"} {
+			if has(key) {
+				v.add(ruleFormXObject, loc, key)
+			}
+		}
+		if nameValue(d, "Subtype2") == "PS" {
+			v.add(ruleFormXObject, loc, "Subtype2")
+		}
+	case subtype == "PS" && (typ == "" || typ == "XObject"):
+		v.add(rulePostScript, loc, "")
+	case typ == "ExtGState" || typ == "":
+		if has("TR") && typ == "ExtGState" {
+			v.add(ruleTransfer, loc, "")
+		}
+		if tr2 := dictValue(d, "TR2"); tr2 != nil {
+			if n, ok := tr2.(raw.NameObj); !ok || n.Value() != "Default" {
+				v.add(ruleTransfer2, loc, "")
+			}
+		}
+		if has("HTP") {
+			v.add(ruleHalftone, loc, "")
+		}
+	}
+}
+
+func resolveRaw(rd *raw.Document, obj raw.Object) raw.Object {
+	if ref, ok := obj.(raw.Reference); ok {
+		if o, ok := rd.Get(ref.Ref()); ok {
+			return o
+		}
+		return nil
+	}
+	return obj
+}
+
+func dictValue(d *raw.DictObj, key string) raw.Object {
+	o, _ := d.Get(raw.NameLiteral(key))
+	return o
+}
+
+func nameValue(d *raw.DictObj, key string) string {
+	if n, ok := dictValue(d, key).(raw.NameObj); ok {
+		return n.Value()
+	}
+	return ""
+}
+
+// filterNames returns the filters of a Filter entry.
+func filterNames(obj raw.Object) []string {
+	switch f := obj.(type) {
+	case raw.NameObj:
+		return []string{f.Value()}
+	case *raw.ArrayObj:
+		var names []string
+		for _, item := range f.Items {
+			if n, ok := item.(raw.NameObj); ok {
+				names = append(names, n.Value())
+			}
+		}
+		return names
+	}
+	return nil
+}
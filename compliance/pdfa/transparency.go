@@ -0,0 +1,256 @@
+package pdfa
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/contentstream/editor"
+	"github.com/wudi/pdfkit/filters"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// finding is a violation found in a resource dictionary.
+type finding struct {
+	rule   rule
+	loc    string
+	detail string
+}
+
+// transparent reports whether the finding is transparency PDF/A-1
+// forbids.
+func (f finding) transparent() bool {
+	switch f.rule {
+	case ruleSoftMask, ruleImageSoftMask, ruleTransparencyGroup, ruleBlendMode, ruleAlpha:
+		return true
+	}
+	return false
+}
+
+// resourceFindings returns the violations in a resource dictionary content
+// is drawn with: transparency and optional content for PDF/A-1,
+// interpolated images, LZW-compressed and PostScript XObjects.
+func resourceFindings(res *semantic.Resources, loc string, level Level) []finding {
+	var out []finding
+	add := func(r rule, where, detail string) {
+		if r.id(level) != "" {
+			out = append(out, finding{r, loc + " " + where, detail})
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(res.ExtGStates)) {
+		gs := res.ExtGStates[name]
+		where := "ExtGState " + name
+		if gs.SoftMask != nil && gs.SoftMask.Subtype != "None" {
+			add(ruleSoftMask, where, "")
+		}
+		if gs.BlendMode != "" && gs.BlendMode != "Normal" && gs.BlendMode != "Compatible" {
+			add(ruleBlendMode, where, gs.BlendMode)
+		}
+		if (gs.FillAlpha != nil && *gs.FillAlpha < 1) || (gs.StrokeAlpha != nil && *gs.StrokeAlpha < 1) {
+			add(ruleAlpha, where, "")
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(res.XObjects)) {
+		xo := res.XObjects[name]
+		where := "XObject " + name
+		switch xo.Subtype {
+		case "Image":
+			if xo.SMask != nil {
+				add(ruleImageSoftMask, where, "")
+			}
+			if xo.Interpolate {
+				add(ruleImageInterpolate, where, "")
+			}
+		case "Form":
+			if xo.Group != nil {
+				add(ruleTransparencyGroup, where, "")
+			}
+		case "PS":
+			add(rulePostScript, where, "")
+		}
+		if xo.Filter == "LZWDecode" {
+			add(ruleFilterLZW, where, "")
+		}
+		if xo.OC != nil {
+			add(ruleOCProperties, where, "optional content")
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(res.Properties)) {
+		switch res.Properties[name].(type) {
+		case *semantic.OptionalContentGroup, *semantic.OptionalContentMembership:
+			add(ruleOCProperties, "Properties "+name, "optional content")
+		}
+	}
+	return out
+}
+
+func (v *validator) checkResources(use *usage) {
+	for _, r := range use.resources {
+		for _, f := range resourceFindings(r.value.(*semantic.Resources), r.loc, v.level) {
+			v.add(f.rule, f.loc, f.detail)
+		}
+	}
+}
+
+// flattenTransparency removes transparency for PDF/A-1. With
+// rasterization enabled, pages whose content uses transparency are
+// rasterized; everything else using transparency, annotation appearances
+// included, is made opaque.
+func (e *enforcement) flattenTransparency() error {
+	err := e.rasterizePages(func(use *usage) bool {
+		for _, r := range use.resources {
+			for _, f := range resourceFindings(r.value.(*semantic.Resources), r.loc, e.level) {
+				if f.transparent() {
+					return true
+				}
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	return eachStream(e.ctx, e.doc, func(s *stream) ([]semantic.Operation, error) {
+		if s.form != nil && s.form.Group != nil {
+			s.form.Group = nil
+			s.form.Dirty = true
+		}
+		if s.res != nil {
+			removeTransparency(s.res)
+		}
+		return nil, nil
+	})
+}
+
+// removeTransparency makes the graphics states and XObjects of res opaque.
+func removeTransparency(res *semantic.Resources) {
+	for name, gs := range res.ExtGStates {
+		if gs.SoftMask == nil && gs.FillAlpha == nil && gs.StrokeAlpha == nil && gs.BlendMode == "" {
+			continue
+		}
+		gs.SoftMask, gs.FillAlpha, gs.StrokeAlpha, gs.BlendMode = nil, nil, nil, ""
+		gs.Dirty = true
+		res.ExtGStates[name] = gs
+	}
+	for name, xo := range res.XObjects {
+		if xo.SMask == nil && xo.Group == nil {
+			continue
+		}
+		xo.SMask, xo.Group = nil, nil
+		xo.Dirty = true
+		res.XObjects[name] = xo
+	}
+}
+
+// removeLayers removes optional content for PDF/A-1. Content hidden in the
+// default configuration is deleted and the rest is kept unconditionally.
+func (e *enforcement) removeLayers() error {
+	if e.doc.OCProperties != nil {
+		if err := editor.NewEditor().RemoveHiddenContent(e.ctx, e.doc); err != nil {
+			return err
+		}
+	}
+	err := eachStream(e.ctx, e.doc, func(s *stream) ([]semantic.Operation, error) {
+		var out []semantic.Operation
+		for i, op := range s.ops {
+			// /OC /name BDC becomes /OC BMC, keeping the marked-content
+			// nesting intact.
+			if tag, ok := nameAt(op, 0); ok && tag == "OC" && op.Operator == "BDC" {
+				if out == nil {
+					out = append([]semantic.Operation(nil), s.ops...)
+				}
+				out[i] = semantic.Operation{Operator: "BMC", Operands: op.Operands[:1]}
+			}
+		}
+		if s.res != nil {
+			for name, p := range s.res.Properties {
+				switch p.(type) {
+				case *semantic.OptionalContentGroup, *semantic.OptionalContentMembership:
+					delete(s.res.Properties, name)
+					s.res.Dirty = true
+				}
+			}
+			for name, xo := range s.res.XObjects {
+				if xo.OC != nil {
+					xo.OC = nil
+					xo.Dirty = true
+					s.res.XObjects[name] = xo
+				}
+			}
+		}
+		return out, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range e.doc.Pages {
+		for _, a := range p.Annotations {
+			if a != nil && a.Base() != nil && a.Base().OC != nil {
+				a.Base().OC = nil
+				a.Base().Dirty = true
+			}
+		}
+	}
+	e.doc.OCProperties = nil
+	return nil
+}
+
+// fixImages turns off image interpolation, decodes LZW-compressed
+// XObjects and removes PostScript XObjects along with the operators
+// drawing them.
+func (e *enforcement) fixImages() error {
+	lzw := filters.NewLZWDecoder()
+	return eachStream(e.ctx, e.doc, func(s *stream) ([]semantic.Operation, error) {
+		if s.res == nil {
+			return nil, nil
+		}
+		removed := make(map[string]bool)
+		for name, xo := range s.res.XObjects {
+			if xo.Subtype == "PS" {
+				delete(s.res.XObjects, name)
+				removed[name] = true
+				continue
+			}
+			changed := false
+			if xo.Interpolate {
+				xo.Interpolate = false
+				changed = true
+			}
+			if xo.Filter == "LZWDecode" {
+				data, err := lzw.Decode(e.ctx, xo.Data, xo.DecodeParms)
+				if err != nil {
+					return nil, err
+				}
+				xo.Data, xo.Filter, xo.DecodeParms = data, "", nil
+				changed = true
+			}
+			if changed {
+				xo.Dirty = true
+				s.res.XObjects[name] = xo
+			}
+		}
+		out := make([]semantic.Operation, 0, len(s.ops))
+		changed := false
+		for _, op := range s.ops {
+			if name, ok := nameAt(op, 0); ok && op.Operator == "Do" && removed[name] {
+				changed = true
+				continue
+			}
+			if op.Operator == contentstream.InlineImageOperator && len(op.Operands) == 1 {
+				img, ok := op.Operands[0].(semantic.InlineImageOperand)
+				if interp, isBool := inlineValue(img, "I", "Interpolate").(semantic.BoolOperand); ok && isBool && interp.Value {
+					img.Image.Values = maps.Clone(img.Image.Values)
+					delete(img.Image.Values, "I")
+					delete(img.Image.Values, "Interpolate")
+					op = semantic.Operation{Operator: op.Operator, Operands: []semantic.Operand{img}}
+					changed = true
+				}
+			}
+			out = append(out, op)
+		}
+		if !changed {
+			return nil, nil
+		}
+		return out, nil
+	})
+}
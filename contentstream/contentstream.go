@@ -27,9 +27,13 @@ type ExecutionContext struct {
 }
 
 type GraphicsState struct {
-	CTM       coords.Matrix
-	LineWidth float64
-	stack     []*GraphicsState
+	CTM              coords.Matrix
+	LineWidth        float64
+	FillColorSpace   string
+	FillColor        []float64
+	StrokeColorSpace string
+	StrokeColor      []float64
+	stack            []*GraphicsState
 }
 
 func (gs *GraphicsState) Save() { clone := *gs; gs.stack = append(gs.stack, &clone) }
@@ -44,10 +48,27 @@ func (gs *GraphicsState) Restore() error {
 }
 
 type TextState struct {
-	Font           *semantic.Font
-	FontSize       float64
-	TextMatrix     coords.Matrix
-	TextLineMatrix coords.Matrix
+	Font              *semantic.Font
+	FontName          string // resource name selected by Tf
+	FontSize          float64
+	CharSpacing       float64 // Tc
+	WordSpacing       float64 // Tw
+	HorizontalScaling float64 // Tz, in percent
+	Leading           float64 // TL
+	Rise              float64 // Ts
+	RenderMode        TextRenderMode
+	TextMatrix        coords.Matrix
+	TextLineMatrix    coords.Matrix
+}
+
+// NewTextState returns the text state in effect at the start of a content
+// stream.
+func NewTextState() *TextState {
+	return &TextState{
+		HorizontalScaling: 100,
+		TextMatrix:        coords.Identity(),
+		TextLineMatrix:    coords.Identity(),
+	}
 }
 
 type simpleProcessor struct{ handlers map[string]OperatorHandler }
@@ -56,7 +77,7 @@ func NewProcessor() Processor                                           { return
 func (p *simpleProcessor) RegisterHandler(op string, h OperatorHandler) { p.handlers[op] = h }
 func (p *simpleProcessor) Process(ctx context.Context, stream []byte, state *GraphicsState) error {
 	tokens := tokenize(string(stream))
-	ec := &ExecutionContext{GraphicsState: state, TextState: &TextState{}}
+	ec := &ExecutionContext{GraphicsState: state, TextState: NewTextState()}
 	opStack := []semantic.Operand{}
 
 	for i := 0; i < len(tokens); i++ {
@@ -38,3 +38,54 @@ func TestProcessorDispatchesOperators(t *testing.T) {
 		t.Fatalf("unexpected operand types: %v", h.last)
 	}
 }
+
+func TestParseOperations(t *testing.T) {
+	src := []byte("q 1 0 0 1 10 20 cm\n/F1 12 Tf (a\\(b\\)\\101\\\nc) Tj <48 49> Tj [(x) -250 (y)] TJ\n" +
+		"/OC <</MCID 3 /Flag true>> BDC EMC\n" +
+		"BI /W 2 /H 1 /BPC 8 /CS /G ID \x00\xff EI Q")
+	ops, err := ParseOperations(src)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	var names []string
+	for _, op := range ops {
+		names = append(names, op.Operator)
+	}
+	want := []string{"q", "cm", "Tf", "Tj", "Tj", "TJ", "BDC", "EMC", InlineImageOperator, "Q"}
+	if len(names) != len(want) {
+		t.Fatalf("operators = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("operators = %v, want %v", names, want)
+		}
+	}
+	if s := string(ops[3].Operands[0].(semantic.StringOperand).Value); s != "a(b)Ac" {
+		t.Fatalf("literal string = %q", s)
+	}
+	if s := string(ops[4].Operands[0].(semantic.StringOperand).Value); s != "HI" {
+		t.Fatalf("hex string = %q", s)
+	}
+	arr := ops[5].Operands[0].(semantic.ArrayOperand)
+	if len(arr.Values) != 3 || arr.Values[1].(semantic.NumberOperand).Value != -250 {
+		t.Fatalf("TJ array = %+v", arr)
+	}
+	props := ops[6].Operands[1].(semantic.DictOperand)
+	if props.Values["MCID"].(semantic.NumberOperand).Value != 3 || !props.Values["Flag"].(semantic.BoolOperand).Value {
+		t.Fatalf("BDC properties = %+v", props)
+	}
+	img := ops[8].Operands[0].(semantic.InlineImageOperand)
+	if len(img.Data) != 2 || img.Data[0] != 0 || img.Data[1] != 0xff {
+		t.Fatalf("inline image data = %v", img.Data)
+	}
+}
+
+func TestParseOperationsLenient(t *testing.T) {
+	ops, err := ParseOperations([]byte("0 0 m 10 10 l S (unterminated"))
+	if err == nil {
+		t.Fatalf("expected error for unterminated string")
+	}
+	if len(ops) != 3 {
+		t.Fatalf("expected operations before the error, got %d", len(ops))
+	}
+}
@@ -13,6 +13,18 @@ type Editor interface {
 	// It also updates the StructureTree to remove references to deleted content (MCIDs).
 	RemoveRect(ctx context.Context, doc *semantic.Document, page *semantic.Page, rect semantic.Rectangle) error
 
+	// Redact removes all content within the rectangles at glyph, path
+	// segment and pixel granularity, recursing into form XObjects.
+	Redact(ctx context.Context, doc *semantic.Document, page *semantic.Page, rects ...semantic.Rectangle) error
+
+	// ApplyRedactions applies and then removes the page's redaction
+	// annotations, painting their fill colour and overlay text.
+	ApplyRedactions(ctx context.Context, doc *semantic.Document, page *semantic.Page) error
+
+	// RemoveHiddenContent removes the optional content hidden in the
+	// default configuration from content streams, XObjects and annotations.
+	RemoveHiddenContent(ctx context.Context, doc *semantic.Document) error
+
 	// ReplaceText replaces occurrences of oldText with newText.
 	// Note: This is a complex operation that may require font subsetting adjustments
 	// and layout recalculation.
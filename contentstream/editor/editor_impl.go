@@ -5,106 +5,24 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/wudi/pdfkit/filters"
 	"github.com/wudi/pdfkit/fonts"
 	"github.com/wudi/pdfkit/ir/semantic"
 )
 
-type EditorImpl struct{}
+// EditorImpl implements Editor. Pipeline decodes images kept in an image
+// codec (DCT, JPX, ...) when redaction has to rewrite their samples.
+type EditorImpl struct {
+	Pipeline *filters.Pipeline
+}
 
 func NewEditor() *EditorImpl {
-	return &EditorImpl{}
+	return &EditorImpl{Pipeline: defaultPipeline()}
 }
 
+// RemoveRect redacts everything inside rect; see Redact.
 func (e *EditorImpl) RemoveRect(ctx context.Context, doc *semantic.Document, page *semantic.Page, rect semantic.Rectangle) error {
-	// 1. Flatten content streams into a single list of operations
-	// Note: In a real implementation, we might want to keep them separate or handle them more carefully.
-	// For now, we assume we can work on the first stream or merge them.
-	// But wait, page.Contents is []ContentStream.
-	// If we modify operations, we need to write them back.
-
-	// Let's assume we work on all streams combined, but we need to track which stream an op belongs to.
-	// Or simpler: process each stream independently.
-
-	for i := range page.Contents {
-		stream := &page.Contents[i]
-
-		// 2. Build Spatial Index
-		idx := NewOpSpatialIndex(page.MediaBox)
-		if err := idx.Index(stream.Operations, page.Resources); err != nil {
-			return err
-		}
-
-		// 3. Query for operations in the rect
-		opIndices := idx.Query(rect)
-		if len(opIndices) == 0 {
-			continue
-		}
-
-		// 4. Remove operations
-		// Sort indices in descending order to remove safely
-		sort.Sort(sort.Reverse(sort.IntSlice(opIndices)))
-
-		// Use a map to avoid duplicates if Query returns same index multiple times (it shouldn't with current QuadTree but good practice)
-		seen := make(map[int]bool)
-		uniqueIndices := make([]int, 0, len(opIndices))
-		for _, index := range opIndices {
-			if !seen[index] {
-				seen[index] = true
-				uniqueIndices = append(uniqueIndices, index)
-			}
-		}
-
-		// Remove
-		for _, index := range uniqueIndices {
-			if index >= 0 && index < len(stream.Operations) {
-				// Note: BDC/BMC operators are typically not indexed by OpSpatialIndex as they have no bounding box.
-				// Therefore, we are usually removing content operations (Tj, Do, etc.).
-				// If removing content leaves an empty BDC...EMC block, it will be cleaned up in the next step.
-				stream.Operations = append(stream.Operations[:index], stream.Operations[index+1:]...)
-			}
-		}
-
-		// 5. Cleanup empty Marked Content sequences
-		// We repeatedly scan for BDC/BMC followed immediately by EMC and remove them.
-		for {
-			changed := false
-			var newOps []semantic.Operation
-			skipNext := false
-
-			for j := 0; j < len(stream.Operations); j++ {
-				if skipNext {
-					skipNext = false
-					continue
-				}
-
-				op := stream.Operations[j]
-				if op.Operator == "BDC" || op.Operator == "BMC" {
-					// Check next op
-					if j+1 < len(stream.Operations) {
-						nextOp := stream.Operations[j+1]
-						if nextOp.Operator == "EMC" {
-							// Found empty sequence, skip both
-							skipNext = true
-							changed = true
-							continue
-						}
-					}
-				}
-				newOps = append(newOps, op)
-			}
-			stream.Operations = newOps
-			if !changed {
-				break
-			}
-		}
-	}
-
-	// Repair StructTree if MCIDs were removed.
-	if doc != nil && doc.StructTree != nil {
-		e.RepairStructTree(page, doc.StructTree)
-	}
-
-	return nil
+	return e.Redact(ctx, doc, page, rect)
 }
 
 // RepairStructTree removes references to MCIDs that no longer exist on the page.
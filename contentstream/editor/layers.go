@@ -0,0 +1,213 @@
+package editor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// stateOperators change the graphics or text state outside text objects.
+// Viewers apply them even in hidden optional content, so they are kept
+// when the content around them is removed.
+var stateOperators = map[string]bool{
+	"q": true, "Q": true, "cm": true, "w": true, "J": true, "j": true, "M": true,
+	"d": true, "ri": true, "i": true, "gs": true,
+	"CS": true, "cs": true, "SC": true, "SCN": true, "sc": true, "scn": true,
+	"G": true, "g": true, "RG": true, "rg": true, "K": true, "k": true,
+	"Tc": true, "Tw": true, "Tz": true, "TL": true, "Tf": true, "Tr": true, "Ts": true,
+	"BX": true, "EX": true,
+}
+
+// RemoveHiddenContent permanently removes the optional content that is
+// hidden in the default configuration of doc's OCProperties: marked
+// content sections of hidden groups and membership dictionaries (including
+// their visibility expressions), XObjects whose OC entry is hidden, and
+// annotations whose OC entry is hidden. Form XObjects and annotation
+// appearances are rewritten recursively.
+//
+// Graphics state operators in removed sections are kept, as viewers apply
+// them to the content that follows; clipping paths are kept for the same
+// reason. The layers themselves stay in OCProperties. Form XObjects that
+// change are copied under a new resource name, leaving other users of
+// them untouched.
+func (e *EditorImpl) RemoveHiddenContent(ctx context.Context, doc *semantic.Document) error {
+	if doc == nil {
+		return errors.New("remove hidden content: nil document")
+	}
+	if err := doc.LoadPages(ctx); err != nil {
+		return err
+	}
+	r := &ocRemover{ctx: ctx, props: doc.OCProperties}
+	for _, page := range doc.Pages {
+		ops, err := contentstream.PageOperations(page)
+		if err != nil {
+			return fmt.Errorf("remove hidden content: page %d: %w", page.Index, err)
+		}
+		out, changed, err := r.run(ops, page.Resources, 0)
+		if err != nil {
+			return err
+		}
+		if changed {
+			page.Contents = []semantic.ContentStream{{Operations: out}}
+			page.Dirty = true
+		}
+
+		annots := page.Annotations[:0:0]
+		for _, a := range page.Annotations {
+			if a == nil {
+				continue
+			}
+			base := a.Base()
+			if base == nil {
+				annots = append(annots, a)
+				continue
+			}
+			if r.hidden(base.OC) {
+				changed = true
+				continue
+			}
+			if af := base.AppearanceForm; af != nil {
+				xo, formChanged, err := r.form(*af, page.Resources, 0)
+				if err != nil {
+					return err
+				}
+				if formChanged {
+					base.AppearanceForm = &xo
+					base.Dirty = true
+				}
+			}
+			annots = append(annots, a)
+		}
+		if len(annots) != len(page.Annotations) {
+			page.Annotations = annots
+			page.Dirty = true
+		}
+
+		if changed && doc.StructTree != nil {
+			e.RepairStructTree(page, doc.StructTree)
+		}
+	}
+	return nil
+}
+
+// ocRemover rewrites content streams without their hidden optional
+// content.
+type ocRemover struct {
+	ctx   context.Context
+	props *semantic.OCProperties
+}
+
+func (r *ocRemover) hidden(pl semantic.PropertyList) bool {
+	return pl != nil && !r.props.Visible(pl)
+}
+
+// run returns ops drawn with res without hidden content and reports
+// whether anything was removed.
+func (r *ocRemover) run(ops []semantic.Operation, res *semantic.Resources, depth int) ([]semantic.Operation, bool, error) {
+	if err := r.ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	var (
+		out     = make([]semantic.Operation, 0, len(ops))
+		changed bool
+		skip    int                  // open marked content in a removed section
+		path    []semantic.Operation // path of a removed section, kept for clipping
+		clip    bool
+	)
+	for _, op := range ops {
+		if skip > 0 {
+			switch op.Operator {
+			case "BDC", "BMC":
+				skip++
+			case "EMC":
+				skip--
+			case "m", "l", "c", "v", "y", "h", "re":
+				path = append(path, op)
+			case "W", "W*":
+				path = append(path, op)
+				clip = true
+			case "S", "s", "f", "F", "f*", "B", "B*", "b", "b*", "n":
+				if clip {
+					out = append(out, path...)
+					out = append(out, semantic.Operation{Operator: "n"})
+				}
+				path, clip = nil, false
+			default:
+				if stateOperators[op.Operator] {
+					out = append(out, op)
+				}
+			}
+			continue
+		}
+
+		switch op.Operator {
+		case "BDC":
+			if r.hidden(markedProperties(op, res)) {
+				skip = 1
+				changed = true
+				continue
+			}
+		case "Do":
+			name, ok := nameOperand(op.Operands, 0)
+			if !ok || res == nil {
+				break
+			}
+			xo, ok := res.XObjects[name]
+			if !ok {
+				break
+			}
+			if r.hidden(xo.OC) {
+				changed = true
+				continue
+			}
+			if xo.Subtype != "Form" || depth >= maxRedactDepth {
+				break
+			}
+			cleaned, formChanged, err := r.form(xo, res, depth+1)
+			if err != nil {
+				return nil, false, err
+			}
+			if formChanged {
+				changed = true
+				op = renameXObject(op, name, cleaned, res)
+			}
+		}
+		out = append(out, op)
+	}
+	return out, changed, nil
+}
+
+// form returns the form XObject xo without its hidden content. Forms
+// without resources use res.
+func (r *ocRemover) form(xo semantic.XObject, res *semantic.Resources, depth int) (semantic.XObject, bool, error) {
+	ops, err := contentstream.ParseOperations(xo.Data)
+	if err != nil {
+		return xo, false, nil
+	}
+	formRes := xo.Resources
+	if formRes == nil {
+		formRes = res
+	}
+	out, changed, err := r.run(ops, formRes, depth)
+	if err != nil || !changed {
+		return xo, false, err
+	}
+	xo.Data = contentstream.Serialize(out)
+	return xo, true, nil
+}
+
+// markedProperties returns the optional content a BDC operator marks, or
+// nil.
+func markedProperties(op semantic.Operation, res *semantic.Resources) semantic.PropertyList {
+	if tag, ok := nameOperand(op.Operands, 0); !ok || tag != "OC" {
+		return nil
+	}
+	name, ok := nameOperand(op.Operands, 1)
+	if !ok || res == nil {
+		return nil
+	}
+	return res.Properties[name]
+}
@@ -0,0 +1,111 @@
+package editor_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/contentstream/editor"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+func nameOp(v string) semantic.Operand { return semantic.NameOperand{Value: v} }
+
+func TestRemoveHiddenContent(t *testing.T) {
+	props := &semantic.OCProperties{}
+	shown := props.AddLayer("Shown", true)
+	hidden := props.AddLayer("Hidden", false)
+	notHidden := &semantic.OptionalContentMembership{VE: &semantic.VisibilityExpression{
+		Op: "Not", Operands: []*semantic.VisibilityExpression{{Group: hidden}},
+	}}
+	allOn := &semantic.OptionalContentMembership{OCGs: []*semantic.OptionalContentGroup{shown, hidden}, Policy: "AllOn"}
+
+	form := semantic.XObject{
+		Subtype: "Form",
+		BBox:    semantic.Rectangle{URX: 100, URY: 100},
+		Data:    []byte("/OC /MC1 BDC 0 0 5 5 re f EMC 1 1 2 2 re f"),
+	}
+	res := &semantic.Resources{
+		Properties: map[string]semantic.PropertyList{"OC1": shown, "OC2": hidden, "MC0": notHidden, "MC1": allOn},
+		XObjects: map[string]semantic.XObject{
+			"Fm1": form,
+			"Fm2": {Subtype: "Form", BBox: semantic.Rectangle{URX: 10, URY: 10}, Data: []byte("0 0 10 10 re f"), OC: hidden},
+		},
+		Fonts: map[string]*semantic.Font{"F1": monoFont()},
+	}
+	page := &semantic.Page{
+		MediaBox:  semantic.Rectangle{URX: 200, URY: 200},
+		Resources: res,
+		Contents: []semantic.ContentStream{{Operations: []semantic.Operation{
+			op("BDC", nameOp("OC"), nameOp("OC1")),
+			op("BT"), op("Tf", nameOp("F1"), num(10)), op("Tj", semantic.StringOperand{Value: []byte("shown")}), op("ET"),
+			op("EMC"),
+			op("BDC", nameOp("OC"), nameOp("OC2")),
+			op("rg", num(1), num(0), num(0)),
+			op("re", num(0), num(0), num(50), num(50)), op("W"), op("n"),
+			op("BT"), op("Tj", semantic.StringOperand{Value: []byte("secret")}), op("ET"),
+			op("BDC", nameOp("Span"), nameOp("P0")), op("EMC"),
+			op("re", num(60), num(60), num(10), num(10)), op("f"),
+			op("EMC"),
+			op("BDC", nameOp("OC"), nameOp("MC0")),
+			op("Tj", semantic.StringOperand{Value: []byte("not hidden")}),
+			op("EMC"),
+			op("Do", nameOp("Fm1")),
+			op("Do", nameOp("Fm2")),
+		}}},
+		Annotations: []semantic.Annotation{
+			&semantic.SquareAnnotation{BaseAnnotation: semantic.BaseAnnotation{Subtype: "Square", OC: hidden}},
+			&semantic.SquareAnnotation{BaseAnnotation: semantic.BaseAnnotation{Subtype: "Square", OC: shown}},
+			&semantic.SquareAnnotation{BaseAnnotation: semantic.BaseAnnotation{
+				Subtype:        "Square",
+				AppearanceForm: &semantic.XObject{Subtype: "Form", Resources: res, Data: []byte("/OC /OC2 BDC 0 0 1 1 re f EMC")},
+			}},
+		},
+	}
+	doc := &semantic.Document{Pages: []*semantic.Page{page}, OCProperties: props}
+
+	if err := editor.NewEditor().RemoveHiddenContent(context.Background(), doc); err != nil {
+		t.Fatalf("remove hidden content: %v", err)
+	}
+
+	ops := page.Contents[0].Operations
+	if text := shownText(ops); text != "shownnot hidden" {
+		t.Errorf("shown text = %q", text)
+	}
+	var got []string
+	for _, o := range ops {
+		got = append(got, o.Operator)
+	}
+	// The hidden section keeps its colour and its clipping path.
+	want := "BDC BT Tf Tj ET EMC rg re W n BDC Tj EMC Do"
+	if strings.Join(got, " ") != want {
+		t.Errorf("operators = %s, want %s", strings.Join(got, " "), want)
+	}
+
+	doOp := ops[len(ops)-1]
+	fmName := doOp.Operands[0].(semantic.NameOperand).Value
+	if fmName == "Fm1" {
+		t.Fatalf("changed form kept its name")
+	}
+	if string(res.XObjects["Fm1"].Data) != string(form.Data) {
+		t.Errorf("original form was modified")
+	}
+	formOps, err := contentstream.ParseOperations(res.XObjects[fmName].Data)
+	if err != nil {
+		t.Fatalf("parse form: %v", err)
+	}
+	if len(formOps) != 2 || formOps[0].Operator != "re" || formOps[1].Operator != "f" {
+		t.Errorf("form ops = %+v, AllOn membership should be hidden", formOps)
+	}
+
+	if len(page.Annotations) != 2 {
+		t.Fatalf("annotations = %d, want 2", len(page.Annotations))
+	}
+	if ap := page.Annotations[1].Base().AppearanceForm; len(ap.Data) != 0 {
+		t.Errorf("appearance = %q", ap.Data)
+	}
+	if !page.Dirty {
+		t.Errorf("page not marked dirty")
+	}
+}
@@ -0,0 +1,565 @@
+package editor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/coords"
+	"github.com/wudi/pdfkit/filters"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// maxRedactDepth bounds form XObject recursion; deeper forms that touch a
+// redaction area are dropped rather than left unredacted.
+const maxRedactDepth = 12
+
+// scrubbedProperties are marked-content properties that repeat the content
+// they describe and must go when that content is redacted.
+var scrubbedProperties = []string{"ActualText", "Alt", "E"}
+
+// Redact removes everything drawn inside rects (default user space) from
+// page. Text-showing operators are split at glyph boundaries, paths are
+// clipped geometrically, image samples are overwritten and form XObjects are
+// rewritten recursively, so the removed content is gone from the file rather
+// than hidden. Nothing is painted over the areas; ApplyRedactions does that
+// for redaction annotations.
+//
+// Image and form XObjects that need changes are copied under a new resource
+// name, leaving other pages that share them untouched. Images whose encoding
+// cannot be decoded are dropped when they touch an area. Lazily parsed pages
+// are loaded first.
+func (e *EditorImpl) Redact(ctx context.Context, doc *semantic.Document, page *semantic.Page, rects ...semantic.Rectangle) error {
+	if page == nil {
+		return errors.New("redact: nil page")
+	}
+	if err := page.Load(ctx); err != nil {
+		return err
+	}
+	areas := make([]semantic.Rectangle, 0, len(rects))
+	for _, r := range rects {
+		r = normalizeRect(r)
+		if r.URX < r.LLX || r.URY < r.LLY {
+			continue
+		}
+		areas = append(areas, r)
+	}
+	if len(areas) == 0 {
+		return nil
+	}
+	ops, err := contentstream.PageOperations(page)
+	if err != nil {
+		return fmt.Errorf("redact: parse content: %w", err)
+	}
+	pipeline := e.Pipeline
+	if pipeline == nil {
+		pipeline = defaultPipeline()
+	}
+	r := &redactor{ctx: ctx, rects: areas, pipeline: pipeline}
+	out, changed, err := r.run(ops, page.Resources, newRedactState(coords.Identity()), 0)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	page.Contents = []semantic.ContentStream{{Operations: dropEmptyMarkedContent(out)}}
+	page.Dirty = true
+
+	if doc != nil && doc.StructTree != nil {
+		e.RepairStructTree(page, doc.StructTree)
+	}
+	return nil
+}
+
+// defaultPipeline decodes the image codecs the semantic layer leaves
+// encoded.
+func defaultPipeline() *filters.Pipeline {
+	return filters.NewPipeline([]filters.Decoder{
+		filters.NewFlateDecoder(),
+		filters.NewLZWDecoder(),
+		filters.NewRunLengthDecoder(),
+		filters.NewASCII85Decoder(),
+		filters.NewASCIIHexDecoder(),
+		filters.NewDCTDecoder(),
+		filters.NewJPXDecoder(),
+		filters.NewCCITTFaxDecoder(),
+		filters.NewJBIG2Decoder(),
+	}, filters.Limits{})
+}
+
+// dropEmptyMarkedContent removes BDC/BMC ... EMC sequences left empty by
+// redaction, repeating until nested sequences are gone too.
+func dropEmptyMarkedContent(ops []semantic.Operation) []semantic.Operation {
+	for {
+		changed := false
+		out := ops[:0:0]
+		for j := 0; j < len(ops); j++ {
+			op := ops[j]
+			if (op.Operator == "BDC" || op.Operator == "BMC") && j+1 < len(ops) && ops[j+1].Operator == "EMC" {
+				j++
+				changed = true
+				continue
+			}
+			out = append(out, op)
+		}
+		ops = out
+		if !changed {
+			return ops
+		}
+	}
+}
+
+// redactState is the part of the graphics state redaction depends on.
+type redactState struct {
+	ctm         coords.Matrix
+	lineWidth   float64
+	font        *semantic.Font
+	fontSize    float64
+	charSpacing float64
+	wordSpacing float64
+	hScale      float64
+	leading     float64
+	rise        float64
+}
+
+func newRedactState(ctm coords.Matrix) redactState {
+	return redactState{ctm: ctm, lineWidth: 1, hScale: 1}
+}
+
+// redactor rewrites content streams so that nothing inside rects survives.
+type redactor struct {
+	ctx      context.Context
+	rects    []semantic.Rectangle
+	pipeline *filters.Pipeline
+}
+
+// run rewrites ops drawn with res starting from st and reports whether
+// anything was removed.
+func (r *redactor) run(ops []semantic.Operation, res *semantic.Resources, st redactState, depth int) ([]semantic.Operation, bool, error) {
+	if err := r.ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	var (
+		out     = make([]semantic.Operation, 0, len(ops))
+		changed bool
+		stack   []redactState
+		tm      = coords.Identity()
+		tlm     = coords.Identity()
+		path    pathState
+		marked  []int // indices in out of open BDC operators, -1 for BMC
+		touched = map[int]bool{}
+	)
+	hit := func() {
+		changed = true
+		for _, idx := range marked {
+			if idx >= 0 {
+				touched[idx] = true
+			}
+		}
+	}
+	nextLine := func() {
+		tlm = coords.Translate(0, -st.leading).Multiply(tlm)
+		tm = tlm
+	}
+
+	for i, op := range ops {
+		args := op.Operands
+		switch op.Operator {
+		case "q":
+			stack = append(stack, st)
+		case "Q":
+			if n := len(stack); n > 0 {
+				st = stack[n-1]
+				stack = stack[:n-1]
+			}
+		case "cm":
+			if len(args) == 6 {
+				st.ctm = matrixOperands(args).Multiply(st.ctm)
+			}
+		case "w":
+			if len(args) == 1 {
+				st.lineWidth = number(args[0])
+			}
+		case "gs":
+			if name, ok := nameOperand(args, 0); ok && res != nil {
+				if eg, ok := res.ExtGStates[name]; ok && eg.LineWidth != nil {
+					st.lineWidth = *eg.LineWidth
+				}
+			}
+
+		case "BT":
+			tm, tlm = coords.Identity(), coords.Identity()
+		case "Tf":
+			if len(args) == 2 {
+				st.font = nil
+				if name, ok := nameOperand(args, 0); ok && res != nil {
+					st.font = res.Fonts[name]
+				}
+				st.fontSize = number(args[1])
+			}
+		case "Tc":
+			if len(args) == 1 {
+				st.charSpacing = number(args[0])
+			}
+		case "Tw":
+			if len(args) == 1 {
+				st.wordSpacing = number(args[0])
+			}
+		case "Tz":
+			if len(args) == 1 {
+				st.hScale = number(args[0]) / 100
+			}
+		case "TL":
+			if len(args) == 1 {
+				st.leading = number(args[0])
+			}
+		case "Ts":
+			if len(args) == 1 {
+				st.rise = number(args[0])
+			}
+		case "Td", "TD":
+			if len(args) == 2 {
+				if op.Operator == "TD" {
+					st.leading = -number(args[1])
+				}
+				tlm = coords.Translate(number(args[0]), number(args[1])).Multiply(tlm)
+				tm = tlm
+			}
+		case "Tm":
+			if len(args) == 6 {
+				tlm = matrixOperands(args)
+				tm = tlm
+			}
+		case "T*":
+			nextLine()
+
+		case "Tj", "TJ", "'", "\"":
+			var prefix []semantic.Operation
+			var items []semantic.Operand
+			switch op.Operator {
+			case "Tj", "'":
+				if len(args) > 0 {
+					items = args[len(args)-1:]
+				}
+			case "TJ":
+				if len(args) > 0 {
+					if arr, ok := args[0].(semantic.ArrayOperand); ok {
+						items = arr.Values
+					}
+				}
+			case "\"":
+				if len(args) == 3 {
+					st.wordSpacing, st.charSpacing = number(args[0]), number(args[1])
+					items = args[2:]
+					prefix = append(prefix,
+						semantic.Operation{Operator: "Tw", Operands: args[:1]},
+						semantic.Operation{Operator: "Tc", Operands: args[1:2]})
+				}
+			}
+			if op.Operator == "'" || op.Operator == "\"" {
+				nextLine()
+				prefix = append(prefix, semantic.Operation{Operator: "T*"})
+			}
+			shown, removed := r.showText(items, &st, &tm)
+			if !removed {
+				out = append(out, op)
+				continue
+			}
+			hit()
+			out = append(out, prefix...)
+			if hasString(shown) || (hasNumber(shown) && textFollows(ops[i+1:])) {
+				out = append(out, semantic.Operation{Operator: "TJ", Operands: []semantic.Operand{semantic.ArrayOperand{Values: shown}}})
+			}
+			continue
+
+		case "BDC", "BMC":
+			idx := -1
+			if op.Operator == "BDC" {
+				idx = len(out)
+			}
+			marked = append(marked, idx)
+		case "EMC":
+			if n := len(marked); n > 0 {
+				marked = marked[:n-1]
+			}
+
+		case "m", "l", "c", "v", "y", "h", "re":
+			path.add(op)
+			continue
+		case "W", "W*":
+			path.clip = op.Operator
+			continue
+		case "S", "s", "f", "F", "f*", "B", "B*", "b", "b*", "n":
+			painted, removed := r.paintPath(&path, op.Operator, st)
+			if removed {
+				hit()
+			}
+			out = append(out, painted...)
+			path = pathState{}
+			continue
+
+		case "Do":
+			name, ok := nameOperand(args, 0)
+			if !ok || res == nil {
+				break
+			}
+			repl, removed, err := r.doXObject(op, name, res, st, depth)
+			if err != nil {
+				return nil, false, err
+			}
+			if removed {
+				hit()
+				out = append(out, repl...)
+				continue
+			}
+		case contentstream.InlineImageOperator:
+			repl, removed := r.inlineImage(op, res, st)
+			if removed {
+				hit()
+				out = append(out, repl...)
+				continue
+			}
+		}
+		out = append(out, op)
+	}
+	// A path without a painting operator draws nothing; keep it verbatim.
+	out = append(out, path.ops...)
+
+	for idx := range touched {
+		out[idx] = scrubMarkedContent(out[idx])
+	}
+	return out, changed, nil
+}
+
+// textFollows reports whether a text-showing operator follows in ops before
+// the text position is reset, i.e. whether the current position matters.
+func textFollows(ops []semantic.Operation) bool {
+	for _, op := range ops {
+		switch op.Operator {
+		case "Tj", "TJ":
+			return true
+		case "ET", "Td", "TD", "Tm", "T*", "'", "\"":
+			return false
+		}
+	}
+	return false
+}
+
+// scrubMarkedContent drops properties of a BDC operator that would repeat
+// redacted content.
+func scrubMarkedContent(op semantic.Operation) semantic.Operation {
+	if len(op.Operands) < 2 {
+		return op
+	}
+	dict, ok := op.Operands[1].(semantic.DictOperand)
+	if !ok {
+		return op
+	}
+	values := make(map[string]semantic.Operand, len(dict.Values))
+	for k, v := range dict.Values {
+		values[k] = v
+	}
+	for _, k := range scrubbedProperties {
+		delete(values, k)
+	}
+	operands := append([]semantic.Operand{}, op.Operands...)
+	operands[1] = semantic.DictOperand{Values: values}
+	return semantic.Operation{Operator: op.Operator, Operands: operands}
+}
+
+// showText walks the glyphs of a text-showing operator, advancing tm, and
+// returns the TJ array with glyphs inside the redaction areas replaced by
+// equivalent positioning adjustments so the remaining glyphs do not move.
+func (r *redactor) showText(items []semantic.Operand, st *redactState, tm *coords.Matrix) ([]semantic.Operand, bool) {
+	font := st.font
+	codeLen, splittable := 1, true
+	if font != nil && font.Subtype == "Type0" {
+		codeLen = 2
+		splittable = identityEncoding(font)
+	}
+	descent, ascent := contentstream.FontExtents(font)
+	fs, th := st.fontSize, st.hScale
+
+	var (
+		shown  []semantic.Operand
+		run    []byte
+		anyHit bool
+	)
+	flush := func() {
+		if len(run) > 0 {
+			shown = append(shown, semantic.StringOperand{Value: run})
+			run = nil
+		}
+	}
+	adjust := func(v float64) {
+		flush()
+		if n := len(shown); n > 0 {
+			if prev, ok := shown[n-1].(semantic.NumberOperand); ok {
+				shown[n-1] = semantic.NumberOperand{Value: prev.Value + v}
+				return
+			}
+		}
+		shown = append(shown, semantic.NumberOperand{Value: v})
+	}
+
+	type glyphPos struct {
+		code   []byte
+		tx     float64 // advance in unscaled text space
+		inside bool
+	}
+	var glyphs [][]glyphPos
+	for _, item := range items {
+		switch v := item.(type) {
+		case semantic.StringOperand:
+			var gs []glyphPos
+			for i := 0; i < len(v.Value); i += codeLen {
+				end := min(i+codeLen, len(v.Value))
+				code := 0
+				for _, b := range v.Value[i:end] {
+					code = code<<8 | int(b)
+				}
+				w0 := contentstream.GlyphWidth(font, code)
+				tx := w0*fs + st.charSpacing
+				if end-i == 1 && code == 32 {
+					tx += st.wordSpacing
+				}
+				m := tm.Multiply(st.ctm)
+				box := transformRect(semantic.Rectangle{
+					LLX: 0, LLY: st.rise + descent*fs,
+					URX: w0 * fs * th, URY: st.rise + ascent*fs,
+				}, m)
+				inside := r.hits(box)
+				anyHit = anyHit || inside
+				gs = append(gs, glyphPos{code: v.Value[i:end], tx: tx, inside: inside})
+				*tm = coords.Translate(tx*th, 0).Multiply(*tm)
+			}
+			glyphs = append(glyphs, gs)
+		case semantic.NumberOperand:
+			*tm = coords.Translate(-v.Value/1000*fs*th, 0).Multiply(*tm)
+			glyphs = append(glyphs, nil)
+		default:
+			glyphs = append(glyphs, nil)
+		}
+	}
+	if !anyHit {
+		return nil, false
+	}
+
+	for k, item := range items {
+		switch v := item.(type) {
+		case semantic.StringOperand:
+			for _, g := range glyphs[k] {
+				if g.inside || !splittable {
+					if fs != 0 {
+						adjust(-g.tx / fs * 1000)
+					}
+					continue
+				}
+				run = append(run, g.code...)
+			}
+			flush()
+		case semantic.NumberOperand:
+			adjust(v.Value)
+		}
+	}
+	return shown, true
+}
+
+func hasString(items []semantic.Operand) bool {
+	for _, it := range items {
+		if _, ok := it.(semantic.StringOperand); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasNumber(items []semantic.Operand) bool {
+	for _, it := range items {
+		if n, ok := it.(semantic.NumberOperand); ok && n.Value != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// identityEncoding reports whether a composite font uses two-byte codes,
+// the only layout redaction splits; other CMaps lose whole operators.
+func identityEncoding(font *semantic.Font) bool {
+	switch font.Encoding {
+	case "", "Identity-H", "Identity-V":
+		return true
+	}
+	return false
+}
+
+// hits reports whether box overlaps a redaction area. Boxes without area
+// count when they touch one, so zero-width glyphs are not missed.
+func (r *redactor) hits(box semantic.Rectangle) bool {
+	for _, rect := range r.rects {
+		if overlaps(box, rect) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps is intersects for redaction: boxes with area must share area
+// with rect, so merely touching neighbours survive.
+func overlaps(box, rect semantic.Rectangle) bool {
+	if box.URX < rect.LLX || box.LLX > rect.URX || box.URY < rect.LLY || box.LLY > rect.URY {
+		return false
+	}
+	if box.URX > box.LLX && box.URY > box.LLY {
+		return box.URX > rect.LLX && box.LLX < rect.URX && box.URY > rect.LLY && box.LLY < rect.URY
+	}
+	return true
+}
+
+func normalizeRect(r semantic.Rectangle) semantic.Rectangle {
+	return semantic.Rectangle{
+		LLX: math.Min(r.LLX, r.URX), LLY: math.Min(r.LLY, r.URY),
+		URX: math.Max(r.LLX, r.URX), URY: math.Max(r.LLY, r.URY),
+	}
+}
+
+// transformRect returns the bounding box of r mapped through m.
+func transformRect(r semantic.Rectangle, m coords.Matrix) semantic.Rectangle {
+	return boundsOf(
+		m.Transform(coords.Point{X: r.LLX, Y: r.LLY}),
+		m.Transform(coords.Point{X: r.URX, Y: r.LLY}),
+		m.Transform(coords.Point{X: r.LLX, Y: r.URY}),
+		m.Transform(coords.Point{X: r.URX, Y: r.URY}),
+	)
+}
+
+func boundsOf(pts ...coords.Point) semantic.Rectangle {
+	b := semantic.Rectangle{LLX: math.Inf(1), LLY: math.Inf(1), URX: math.Inf(-1), URY: math.Inf(-1)}
+	for _, p := range pts {
+		b.LLX, b.URX = math.Min(b.LLX, p.X), math.Max(b.URX, p.X)
+		b.LLY, b.URY = math.Min(b.LLY, p.Y), math.Max(b.URY, p.Y)
+	}
+	return b
+}
+
+func matrixOperands(args []semantic.Operand) coords.Matrix {
+	return coords.Matrix{number(args[0]), number(args[1]), number(args[2]), number(args[3]), number(args[4]), number(args[5])}
+}
+
+func number(op semantic.Operand) float64 {
+	if n, ok := op.(semantic.NumberOperand); ok {
+		return n.Value
+	}
+	return 0
+}
+
+func nameOperand(args []semantic.Operand, i int) (string, bool) {
+	if i >= len(args) {
+		return "", false
+	}
+	n, ok := args[i].(semantic.NameOperand)
+	return n.Value, ok
+}
@@ -0,0 +1,219 @@
+package editor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/coords"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// overlayFont is the font used for redaction overlay text.
+var overlayFont = semantic.Font{Subtype: "Type1", BaseFont: "Helvetica", Encoding: "WinAnsiEncoding"}
+
+// ApplyRedactions applies the page's redaction annotations: the content
+// under each one is removed as by Redact, its area is filled with the
+// annotation's interior colour (black when unset) and the overlay text is
+// drawn on top. The redaction annotations are then removed from the page.
+func (e *EditorImpl) ApplyRedactions(ctx context.Context, doc *semantic.Document, page *semantic.Page) error {
+	if page == nil {
+		return nil
+	}
+	var redactions []*semantic.RedactAnnotation
+	var keep []semantic.Annotation
+	for _, a := range page.Annotations {
+		if ra, ok := a.(*semantic.RedactAnnotation); ok {
+			redactions = append(redactions, ra)
+			continue
+		}
+		keep = append(keep, a)
+	}
+	if len(redactions) == 0 {
+		return nil
+	}
+
+	var all []semantic.Rectangle
+	for _, ra := range redactions {
+		all = append(all, redactionAreas(ra)...)
+	}
+	if err := e.Redact(ctx, doc, page, all...); err != nil {
+		return err
+	}
+
+	ops, err := contentstream.PageOperations(page)
+	if err != nil {
+		return fmt.Errorf("redact: parse content: %w", err)
+	}
+	// Isolate the existing content so the overlay starts from the default
+	// graphics state.
+	out := make([]semantic.Operation, 0, len(ops)+2)
+	out = append(out, semantic.Operation{Operator: "q"})
+	out = append(out, ops...)
+	out = append(out, semantic.Operation{Operator: "Q"})
+	for _, ra := range redactions {
+		out = append(out, overlayOperations(page, ra)...)
+	}
+	page.Contents = []semantic.ContentStream{{Operations: out}}
+	page.Annotations = keep
+	page.Dirty = true
+	return nil
+}
+
+// redactionAreas returns the areas marked by a redaction annotation: one
+// per quadrilateral, or the annotation rectangle when there are none.
+func redactionAreas(ra *semantic.RedactAnnotation) []semantic.Rectangle {
+	var areas []semantic.Rectangle
+	for i := 0; i+8 <= len(ra.QuadPoints); i += 8 {
+		q := ra.QuadPoints[i : i+8]
+		areas = append(areas, boundsOf(
+			coords.Point{X: q[0], Y: q[1]}, coords.Point{X: q[2], Y: q[3]},
+			coords.Point{X: q[4], Y: q[5]}, coords.Point{X: q[6], Y: q[7]},
+		))
+	}
+	if len(areas) == 0 {
+		areas = append(areas, normalizeRect(ra.Rect()))
+	}
+	return areas
+}
+
+// overlayOperations paints the redacted areas of ra and its overlay text.
+func overlayOperations(page *semantic.Page, ra *semantic.RedactAnnotation) []semantic.Operation {
+	num := func(v float64) semantic.Operand { return semantic.NumberOperand{Value: v} }
+	fill, luminance := colorOperation(ra.IC)
+
+	ops := []semantic.Operation{{Operator: "q"}, fill}
+	areas := redactionAreas(ra)
+	for _, a := range areas {
+		ops = append(ops, semantic.Operation{Operator: "re", Operands: []semantic.Operand{
+			num(a.LLX), num(a.LLY), num(a.URX - a.LLX), num(a.URY - a.LLY),
+		}})
+	}
+	ops = append(ops, semantic.Operation{Operator: "f"}, semantic.Operation{Operator: "Q"})
+
+	text := winAnsi(ra.OverlayText)
+	box := normalizeRect(ra.Rect())
+	if box.URX-box.LLX <= 0 || box.URY-box.LLY <= 0 {
+		box = areas[0]
+		for _, a := range areas[1:] {
+			box = boundsOf(coords.Point{X: box.LLX, Y: box.LLY}, coords.Point{X: box.URX, Y: box.URY},
+				coords.Point{X: a.LLX, Y: a.LLY}, coords.Point{X: a.URX, Y: a.URY})
+		}
+	}
+	width, height := box.URX-box.LLX, box.URY-box.LLY
+	if len(text) == 0 || width <= 0 || height <= 0 {
+		return ops
+	}
+
+	// Helvetica averages about half an em per character; that is close
+	// enough to fit the text into the box.
+	const avgWidth = 0.5
+	size := math.Min(12, height*0.8)
+	if w := avgWidth * size * float64(len(text)); w > width {
+		size = width / (avgWidth * float64(len(text)))
+	}
+	if size <= 0 {
+		return ops
+	}
+	lines := [][]byte{text}
+	if repeatOverlay(ra) {
+		perLine := int(width / (avgWidth * size))
+		var line []byte
+		for len(line)+len(text) <= perLine {
+			line = append(line, text...)
+			line = append(line, ' ')
+		}
+		line = []byte(strings.TrimRight(string(line), " "))
+		lines = nil
+		for n := int(height / (size * 1.2)); n > 0; n-- {
+			lines = append(lines, line)
+		}
+	}
+
+	textGray := 1.0
+	if luminance >= 0.5 {
+		textGray = 0
+	}
+	fontName := overlayFontName(page)
+	ops = append(ops,
+		semantic.Operation{Operator: "q"},
+		semantic.Operation{Operator: "BT"},
+		semantic.Operation{Operator: "Tf", Operands: []semantic.Operand{semantic.NameOperand{Value: fontName}, num(size)}},
+		semantic.Operation{Operator: "g", Operands: []semantic.Operand{num(textGray)}},
+	)
+	lead := size * 1.2
+	top := box.LLY + (height+lead*float64(len(lines)))/2 - size
+	for i, line := range lines {
+		x := box.LLX + (width-avgWidth*size*float64(len(line)))/2
+		y := top - lead*float64(i)
+		ops = append(ops,
+			semantic.Operation{Operator: "Tm", Operands: []semantic.Operand{num(1), num(0), num(0), num(1), num(x), num(y)}},
+			semantic.Operation{Operator: "Tj", Operands: []semantic.Operand{semantic.StringOperand{Value: line}}},
+		)
+	}
+	return append(ops, semantic.Operation{Operator: "ET"}, semantic.Operation{Operator: "Q"})
+}
+
+// repeatOverlay reports whether the overlay text should tile the area.
+func repeatOverlay(ra *semantic.RedactAnnotation) bool {
+	return len(ra.Repeat) > 0 && ra.Repeat[0] != 0
+}
+
+// colorOperation returns the non-stroking colour operator for components
+// (black when empty) and its approximate luminance.
+func colorOperation(c []float64) (semantic.Operation, float64) {
+	operands := make([]semantic.Operand, len(c))
+	for i, v := range c {
+		operands[i] = semantic.NumberOperand{Value: v}
+	}
+	switch len(c) {
+	case 1:
+		return semantic.Operation{Operator: "g", Operands: operands}, c[0]
+	case 3:
+		return semantic.Operation{Operator: "rg", Operands: operands}, 0.3*c[0] + 0.59*c[1] + 0.11*c[2]
+	case 4:
+		return semantic.Operation{Operator: "k", Operands: operands}, (1 - math.Min(1, 0.3*c[0]+0.59*c[1]+0.11*c[2]+c[3]))
+	}
+	return semantic.Operation{Operator: "g", Operands: []semantic.Operand{semantic.NumberOperand{Value: 0}}}, 0
+}
+
+// overlayFontName returns the resource name of the overlay font on page,
+// adding it when needed.
+func overlayFontName(page *semantic.Page) string {
+	if page.Resources == nil {
+		page.Resources = &semantic.Resources{}
+	}
+	res := page.Resources
+	if res.Fonts == nil {
+		res.Fonts = make(map[string]*semantic.Font)
+	}
+	name := "Helv"
+	for i := 1; ; i++ {
+		f, taken := res.Fonts[name]
+		if !taken {
+			font := overlayFont
+			res.Fonts[name] = &font
+			res.Dirty = true
+			return name
+		}
+		if f.BaseFont == overlayFont.BaseFont && f.Subtype == overlayFont.Subtype && f.Encoding == overlayFont.Encoding {
+			return name
+		}
+		name = fmt.Sprintf("Helv%d", i)
+	}
+}
+
+// winAnsi encodes s for the overlay font, replacing characters outside
+// Latin-1 with '?'.
+func winAnsi(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff || r < 0x20 {
+			r = '?'
+		}
+		out = append(out, byte(r))
+	}
+	return out
+}
@@ -0,0 +1,345 @@
+package editor
+
+import (
+	"fmt"
+
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/coords"
+	"github.com/wudi/pdfkit/internal/bitpack"
+	"github.com/wudi/pdfkit/ir/raw"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// doXObject redacts a Do operator. Images get their samples inside the
+// areas overwritten and forms are redacted recursively; either way the
+// changed XObject is stored under a new name so other uses keep the
+// original.
+func (r *redactor) doXObject(op semantic.Operation, name string, res *semantic.Resources, st redactState, depth int) ([]semantic.Operation, bool, error) {
+	xo, ok := res.XObjects[name]
+	if !ok {
+		return nil, false, nil
+	}
+	switch xo.Subtype {
+	case "Form":
+		m := st.ctm
+		if len(xo.Matrix) == 6 {
+			m = coords.Matrix{xo.Matrix[0], xo.Matrix[1], xo.Matrix[2], xo.Matrix[3], xo.Matrix[4], xo.Matrix[5]}.Multiply(m)
+		}
+		if !r.hits(transformRect(xo.BBox, m)) {
+			return nil, false, nil
+		}
+		if depth >= maxRedactDepth {
+			return nil, true, nil
+		}
+		ops, err := contentstream.ParseOperations(xo.Data)
+		if err != nil {
+			return nil, true, nil
+		}
+		formRes := xo.Resources
+		if formRes == nil {
+			formRes = res
+		}
+		sub := st
+		sub.ctm = m
+		out, changed, err := r.run(ops, formRes, sub, depth+1)
+		if err != nil || !changed {
+			return nil, false, err
+		}
+		xo.Data = contentstream.Serialize(dropEmptyMarkedContent(out))
+		return []semantic.Operation{renameXObject(op, name, xo, res)}, true, nil
+
+	default:
+		m := st.ctm
+		box := transformRect(semantic.Rectangle{URX: 1, URY: 1}, m)
+		if !r.hits(box) {
+			return nil, false, nil
+		}
+		for _, rect := range r.rects {
+			if contains(rect, box) {
+				return nil, true, nil
+			}
+		}
+		if err := r.blankImage(&xo, m); err != nil {
+			return nil, true, nil
+		}
+		return []semantic.Operation{renameXObject(op, name, xo, res)}, true, nil
+	}
+}
+
+// renameXObject stores xo in res under a name derived from name and
+// returns op pointing at it.
+func renameXObject(op semantic.Operation, name string, xo semantic.XObject, res *semantic.Resources) semantic.Operation {
+	newName := name
+	for i := 1; ; i++ {
+		newName = fmt.Sprintf("%sR%d", name, i)
+		if _, taken := res.XObjects[newName]; !taken {
+			break
+		}
+	}
+	xo.OriginalRef = raw.ObjectRef{}
+	xo.Dirty = true
+	res.XObjects[newName] = xo
+	res.Dirty = true
+	operands := append([]semantic.Operand{}, op.Operands...)
+	operands[0] = semantic.NameOperand{Value: newName}
+	return semantic.Operation{Operator: op.Operator, Operands: operands}
+}
+
+// inlineImage redacts a BI/ID/EI image. Filtered inline images are not
+// decoded; one that touches an area is dropped.
+func (r *redactor) inlineImage(op semantic.Operation, res *semantic.Resources, st redactState) ([]semantic.Operation, bool) {
+	box := transformRect(semantic.Rectangle{URX: 1, URY: 1}, st.ctm)
+	if !r.hits(box) {
+		return nil, false
+	}
+	if len(op.Operands) == 0 {
+		return nil, true
+	}
+	ii, ok := op.Operands[0].(semantic.InlineImageOperand)
+	if !ok {
+		return nil, true
+	}
+	for _, rect := range r.rects {
+		if contains(rect, box) {
+			return nil, true
+		}
+	}
+	dict := ii.Image.Values
+	get := func(long, short string) semantic.Operand {
+		if v, ok := dict[long]; ok {
+			return v
+		}
+		return dict[short]
+	}
+	if get("Filter", "F") != nil {
+		return nil, true
+	}
+	xo := semantic.XObject{
+		Width:            int(number(get("Width", "W"))),
+		Height:           int(number(get("Height", "H"))),
+		BitsPerComponent: int(number(get("BitsPerComponent", "BPC"))),
+		Data:             append([]byte(nil), ii.Data...),
+	}
+	if b, ok := get("ImageMask", "IM").(semantic.BoolOperand); ok {
+		xo.ImageMask = b.Value
+	}
+	if arr, ok := get("Decode", "D").(semantic.ArrayOperand); ok {
+		for _, v := range arr.Values {
+			xo.Decode = append(xo.Decode, number(v))
+		}
+	}
+	n := 1
+	if !xo.ImageMask {
+		if n = inlineComponents(get("ColorSpace", "CS"), res); n == 0 {
+			return nil, true
+		}
+	}
+	if err := r.blankSamples(&xo, n, st.ctm); err != nil {
+		return nil, true
+	}
+	ii.Data = xo.Data
+	return []semantic.Operation{{Operator: op.Operator, Operands: []semantic.Operand{ii}}}, true
+}
+
+// inlineComponents returns the number of colour components of an inline
+// image colour space, or 0 when it cannot be determined.
+func inlineComponents(cs semantic.Operand, res *semantic.Resources) int {
+	switch v := cs.(type) {
+	case semantic.NameOperand:
+		switch v.Value {
+		case "G", "DeviceGray", "CalGray":
+			return 1
+		case "RGB", "DeviceRGB", "CalRGB", "Lab":
+			return 3
+		case "CMYK", "DeviceCMYK":
+			return 4
+		case "I", "Indexed":
+			return 1
+		}
+		if res != nil {
+			if named, ok := res.ColorSpaces[v.Value]; ok {
+				return components(named)
+			}
+		}
+	case semantic.ArrayOperand:
+		if len(v.Values) > 0 {
+			if name, ok := v.Values[0].(semantic.NameOperand); ok && (name.Value == "I" || name.Value == "Indexed") {
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+// components returns the number of colour components of cs, or 0 when it
+// is unknown.
+func components(cs semantic.ColorSpace) int {
+	switch c := cs.(type) {
+	case nil:
+		return 1 // soft masks may omit their implied DeviceGray
+	case *semantic.ICCBasedColorSpace:
+		if c.N > 0 {
+			return c.N
+		}
+		if c.Alternate == nil {
+			return 0
+		}
+		return components(c.Alternate)
+	case *semantic.IndexedColorSpace, *semantic.SeparationColorSpace:
+		return 1
+	case *semantic.DeviceNColorSpace:
+		return len(c.Names)
+	}
+	switch cs.ColorSpaceName() {
+	case "DeviceGray", "CalGray", "G":
+		return 1
+	case "DeviceRGB", "CalRGB", "Lab", "RGB":
+		return 3
+	case "DeviceCMYK", "CMYK":
+		return 4
+	}
+	return 0
+}
+
+// blankImage overwrites the samples of xo (and its soft mask) that land
+// inside a redaction area when the image is drawn with ctm. Images kept in
+// an image codec are decoded first and stored as plain samples.
+func (r *redactor) blankImage(xo *semantic.XObject, ctm coords.Matrix) error {
+	if err := r.decodeImage(xo); err != nil {
+		return err
+	}
+	n := 1
+	if !xo.ImageMask {
+		if n = components(xo.ColorSpace); n == 0 {
+			return fmt.Errorf("redact: unsupported image colour space")
+		}
+	}
+	if err := r.blankSamples(xo, n, ctm); err != nil {
+		return err
+	}
+	if xo.SMask != nil {
+		sm := *xo.SMask
+		if err := r.blankImage(&sm, ctm); err != nil {
+			xo.SMask = nil
+		} else {
+			sm.OriginalRef = raw.ObjectRef{}
+			sm.Dirty = true
+			xo.SMask = &sm
+		}
+	}
+	return nil
+}
+
+// decodeImage replaces codec-encoded data with plain samples.
+func (r *redactor) decodeImage(xo *semantic.XObject) error {
+	if xo.Filter == "" {
+		return nil
+	}
+	w, h := xo.Width, xo.Height
+	data, err := r.pipeline.Decode(r.ctx, xo.Data, []string{xo.Filter}, nil)
+	if err != nil {
+		return err
+	}
+	switch {
+	case xo.Filter == "CCITTFaxDecode" && len(data) >= w*h:
+		// One 8-bit gray sample per pixel.
+		if xo.ImageMask {
+			data = bitpack.GrayToBits(data, w, h, 1)
+		} else {
+			xo.ColorSpace = semantic.DeviceColorSpace{Name: "DeviceGray"}
+			xo.BitsPerComponent = 8
+			xo.Decode = nil
+		}
+	case len(data) >= w*h*4:
+		// Image codecs decode to NRGBA.
+		if xo.ImageMask {
+			data = bitpack.GrayToBits(data, w, h, 4)
+		} else {
+			rgb := make([]byte, w*h*3)
+			for i := 0; i < w*h; i++ {
+				copy(rgb[i*3:i*3+3], data[i*4:i*4+3])
+			}
+			data = rgb
+			xo.ColorSpace = semantic.DeviceColorSpace{Name: "DeviceRGB"}
+			xo.BitsPerComponent = 8
+			xo.Decode = nil
+		}
+	default:
+		return fmt.Errorf("redact: unexpected %s output", xo.Filter)
+	}
+	xo.Data = data
+	xo.Filter = ""
+	return nil
+}
+
+// blankSamples overwrites every pixel of xo whose footprint overlaps a
+// redaction area. Colour samples become 0, stencil masks stop painting and
+// soft masks become fully transparent.
+func (r *redactor) blankSamples(xo *semantic.XObject, n int, ctm coords.Matrix) error {
+	w, h := xo.Width, xo.Height
+	if w <= 0 || h <= 0 {
+		return fmt.Errorf("redact: invalid image size %dx%d", w, h)
+	}
+	bpc := xo.BitsPerComponent
+	if xo.ImageMask {
+		n, bpc = 1, 1
+	}
+	if bpc <= 0 {
+		bpc = 8
+	}
+	if bpc != 1 && bpc != 2 && bpc != 4 && bpc != 8 && bpc != 16 {
+		return fmt.Errorf("redact: unsupported bits per component %d", bpc)
+	}
+	blank := uint32(0)
+	if xo.ImageMask && !(len(xo.Decode) >= 2 && xo.Decode[0] > xo.Decode[1]) {
+		blank = 1
+	}
+	rowBits := w * n * bpc
+	rowBytes := (rowBits + 7) / 8
+	data := make([]byte, rowBytes*h)
+	copy(data, xo.Data)
+
+	// Pixel (x, y) covers [x, x+1] × [y, y+1] in image space, which maps
+	// onto the unit square upside down.
+	img := coords.Matrix{1 / float64(w), 0, 0, -1 / float64(h), 0, 1}.Multiply(ctm)
+	inv, err := img.Inverse()
+	if err != nil {
+		return nil
+	}
+	for _, rect := range r.rects {
+		span := transformRect(rect, inv)
+		x0, x1 := clampInt(int(span.LLX)-1, 0, w), clampInt(int(span.URX)+1, 0, w)
+		y0, y1 := clampInt(int(span.LLY)-1, 0, h), clampInt(int(span.URY)+1, 0, h)
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				px := transformRect(semantic.Rectangle{LLX: float64(x), LLY: float64(y), URX: float64(x + 1), URY: float64(y + 1)}, img)
+				if !overlaps(px, rect) {
+					continue
+				}
+				bit := y*rowBytes*8 + x*n*bpc
+				for k := 0; k < n; k++ {
+					writeBits(data, bit+k*bpc, bpc, blank)
+				}
+			}
+		}
+	}
+	xo.Data = data
+	return nil
+}
+
+func writeBits(data []byte, bit, n int, v uint32) {
+	for i := n - 1; i >= 0; i-- {
+		idx := bit / 8
+		shift := uint(7 - bit%8)
+		if v>>uint(i)&1 == 1 {
+			data[idx] |= 1 << shift
+		} else {
+			data[idx] &^= 1 << shift
+		}
+		bit++
+	}
+}
+
+func clampInt(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
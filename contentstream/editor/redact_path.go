@@ -0,0 +1,445 @@
+package editor
+
+import (
+	"math"
+
+	"github.com/wudi/pdfkit/coords"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// pathState collects a path under construction. Coordinates are kept in
+// user space at construction time, with curves flattened.
+type pathState struct {
+	ops      []semantic.Operation
+	subpaths []subpath
+	cur      coords.Point
+	start    coords.Point
+	clip     string
+}
+
+type subpath struct {
+	pts    []coords.Point
+	closed bool
+}
+
+// add records a path construction operator.
+func (p *pathState) add(op semantic.Operation) {
+	p.ops = append(p.ops, op)
+	args := op.Operands
+	pt := func(i int) coords.Point { return coords.Point{X: number(args[i]), Y: number(args[i+1])} }
+	switch op.Operator {
+	case "m":
+		if len(args) == 2 {
+			p.cur = pt(0)
+			p.start = p.cur
+			p.subpaths = append(p.subpaths, subpath{pts: []coords.Point{p.cur}})
+		}
+	case "l":
+		if len(args) == 2 {
+			p.lineTo(pt(0))
+		}
+	case "c":
+		if len(args) == 6 {
+			p.curveTo(pt(0), pt(2), pt(4))
+		}
+	case "v":
+		if len(args) == 4 {
+			p.curveTo(p.cur, pt(0), pt(2))
+		}
+	case "y":
+		if len(args) == 4 {
+			p.curveTo(pt(0), pt(2), pt(2))
+		}
+	case "h":
+		if n := len(p.subpaths); n > 0 {
+			p.subpaths[n-1].closed = true
+			p.cur = p.start
+		}
+	case "re":
+		if len(args) == 4 {
+			x, y, w, h := number(args[0]), number(args[1]), number(args[2]), number(args[3])
+			p.subpaths = append(p.subpaths, subpath{pts: []coords.Point{
+				{X: x, Y: y}, {X: x + w, Y: y}, {X: x + w, Y: y + h}, {X: x, Y: y + h},
+			}, closed: true})
+			p.cur = coords.Point{X: x, Y: y}
+			p.start = p.cur
+		}
+	}
+}
+
+func (p *pathState) lineTo(pt coords.Point) {
+	if len(p.subpaths) == 0 || p.subpaths[len(p.subpaths)-1].closed {
+		p.subpaths = append(p.subpaths, subpath{pts: []coords.Point{p.cur}})
+		p.start = p.cur
+	}
+	sp := &p.subpaths[len(p.subpaths)-1]
+	sp.pts = append(sp.pts, pt)
+	p.cur = pt
+}
+
+// curveTo flattens a cubic Bézier into line segments. The segment count
+// follows the control polygon length so flattening error stays well below
+// a point at any practical scale.
+func (p *pathState) curveTo(c1, c2, end coords.Point) {
+	p0 := p.cur
+	length := dist(p0, c1) + dist(c1, c2) + dist(c2, end)
+	n := int(math.Ceil(length / 2))
+	n = max(4, min(n, 64))
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		mt := 1 - t
+		a, b, c, d := mt*mt*mt, 3*mt*mt*t, 3*mt*t*t, t*t*t
+		p.lineTo(coords.Point{
+			X: a*p0.X + b*c1.X + c*c2.X + d*end.X,
+			Y: a*p0.Y + b*c1.Y + c*c2.Y + d*end.Y,
+		})
+	}
+	p.cur = end
+}
+
+func dist(a, b coords.Point) float64 { return math.Hypot(b.X-a.X, b.Y-a.Y) }
+
+// paintPath emits the path with its painting operator. Paths that reach
+// into a redaction area are rebuilt from what lies outside it: fills are
+// clipped polygon by polygon and strokes segment by segment, with the
+// stroke test widened by the line width. A clipping operator keeps the
+// original geometry since a clip draws nothing itself.
+func (r *redactor) paintPath(p *pathState, paint string, st redactState) ([]semantic.Operation, bool) {
+	original := func() []semantic.Operation {
+		out := append([]semantic.Operation{}, p.ops...)
+		if p.clip != "" {
+			out = append(out, semantic.Operation{Operator: p.clip})
+		}
+		return append(out, semantic.Operation{Operator: paint})
+	}
+	if paint == "n" || len(p.subpaths) == 0 {
+		return original(), false
+	}
+	inv, err := st.ctm.Inverse()
+	if err != nil {
+		return original(), false
+	}
+
+	var fill, stroke, evenOdd, closeAll bool
+	switch paint {
+	case "f", "F":
+		fill = true
+	case "f*":
+		fill, evenOdd = true, true
+	case "S":
+		stroke = true
+	case "s":
+		stroke, closeAll = true, true
+	case "B":
+		fill, stroke = true, true
+	case "B*":
+		fill, stroke, evenOdd = true, true, true
+	case "b":
+		fill, stroke, closeAll = true, true, true
+	case "b*":
+		fill, stroke, closeAll, evenOdd = true, true, true, true
+	}
+
+	page := make([]subpath, len(p.subpaths))
+	for i, sp := range p.subpaths {
+		pts := make([]coords.Point, len(sp.pts))
+		for j, pt := range sp.pts {
+			pts[j] = st.ctm.Transform(pt)
+		}
+		page[i] = subpath{pts: pts, closed: sp.closed || closeAll}
+	}
+	margin := math.Max(st.lineWidth*maxScale(st.ctm), 1)
+	strokeRects := make([]semantic.Rectangle, len(r.rects))
+	for i, rect := range r.rects {
+		strokeRects[i] = semantic.Rectangle{LLX: rect.LLX - margin, LLY: rect.LLY - margin, URX: rect.URX + margin, URY: rect.URY + margin}
+	}
+
+	fillHit := fill && polygonsHit(page, r.rects)
+	strokeHit := stroke && segmentsHit(page, strokeRects)
+	if !fillHit && !strokeHit {
+		return original(), false
+	}
+
+	var out []semantic.Operation
+	emit := func(pts []coords.Point, closed bool) {
+		for i, pt := range pts {
+			u := inv.Transform(pt)
+			operator := "l"
+			if i == 0 {
+				operator = "m"
+			}
+			out = append(out, semantic.Operation{Operator: operator, Operands: []semantic.Operand{
+				semantic.NumberOperand{Value: u.X}, semantic.NumberOperand{Value: u.Y},
+			}})
+		}
+		if closed {
+			out = append(out, semantic.Operation{Operator: "h"})
+		}
+	}
+	if fill {
+		polys := subtractRects(page, r.rects)
+		for _, poly := range polys {
+			emit(poly, true)
+		}
+		if len(polys) > 0 {
+			op := "f"
+			if evenOdd {
+				op = "f*"
+			}
+			out = append(out, semantic.Operation{Operator: op})
+		}
+	}
+	if stroke {
+		lines := clipSegments(page, strokeRects)
+		for _, line := range lines {
+			emit(line.pts, line.closed)
+		}
+		if len(lines) > 0 {
+			out = append(out, semantic.Operation{Operator: "S"})
+		}
+	}
+	if p.clip != "" {
+		out = append(out, p.ops...)
+		out = append(out, semantic.Operation{Operator: p.clip}, semantic.Operation{Operator: "n"})
+	}
+	return out, true
+}
+
+// maxScale returns the largest factor by which m stretches a length.
+func maxScale(m coords.Matrix) float64 {
+	a, b, c, d := m[0], m[1], m[2], m[3]
+	s := a*a + b*b + c*c + d*d
+	det := a*d - b*c
+	return math.Sqrt((s + math.Sqrt(math.Max(s*s-4*det*det, 0))) / 2)
+}
+
+// halfPlane is the set of points with A*x + B*y <= C.
+type halfPlane struct{ A, B, C float64 }
+
+func (h halfPlane) eval(p coords.Point) float64 { return h.A*p.X + h.B*p.Y - h.C }
+
+// outsideRegions splits the complement of rect into four disjoint convex
+// regions: left and right of it, and below and above it between its sides.
+func outsideRegions(rect semantic.Rectangle) [][]halfPlane {
+	between := []halfPlane{{-1, 0, -rect.LLX}, {1, 0, rect.URX}}
+	return [][]halfPlane{
+		{{1, 0, rect.LLX}},
+		{{-1, 0, -rect.URX}},
+		append([]halfPlane{{0, 1, rect.LLY}}, between...),
+		append([]halfPlane{{0, -1, -rect.URY}}, between...),
+	}
+}
+
+func insideRegion(rect semantic.Rectangle) []halfPlane {
+	return []halfPlane{{-1, 0, -rect.LLX}, {1, 0, rect.URX}, {0, -1, -rect.LLY}, {0, 1, rect.URY}}
+}
+
+// clipPolygon clips a closed polygon against a convex region
+// (Sutherland–Hodgman). Winding numbers inside the region are preserved, so
+// either fill rule still applies to the result.
+func clipPolygon(poly []coords.Point, region []halfPlane) []coords.Point {
+	for _, h := range region {
+		if len(poly) == 0 {
+			return nil
+		}
+		var out []coords.Point
+		prev := poly[len(poly)-1]
+		pv := h.eval(prev)
+		for _, cur := range poly {
+			cv := h.eval(cur)
+			if (pv <= 0) != (cv <= 0) {
+				t := pv / (pv - cv)
+				out = append(out, coords.Point{X: prev.X + t*(cur.X-prev.X), Y: prev.Y + t*(cur.Y-prev.Y)})
+			}
+			if cv <= 0 {
+				out = append(out, cur)
+			}
+			prev, pv = cur, cv
+		}
+		poly = out
+	}
+	return poly
+}
+
+func polygonArea(poly []coords.Point) float64 {
+	area := 0.0
+	for i, p := range poly {
+		q := poly[(i+1)%len(poly)]
+		area += p.X*q.Y - q.X*p.Y
+	}
+	return area / 2
+}
+
+func polygonsHit(subpaths []subpath, rects []semantic.Rectangle) bool {
+	for _, rect := range rects {
+		for _, sp := range subpaths {
+			if clipped := clipPolygon(sp.pts, insideRegion(rect)); len(clipped) >= 3 && math.Abs(polygonArea(clipped)) > 1e-9 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// subtractRects removes rects from the filled area of subpaths. Each rect
+// splits every group of polygons into the parts lying in the four regions
+// around it; groups occupy disjoint regions, so filling them together with
+// the original rule reproduces the original fill minus the rects.
+func subtractRects(subpaths []subpath, rects []semantic.Rectangle) [][]coords.Point {
+	group := make([][]coords.Point, 0, len(subpaths))
+	for _, sp := range subpaths {
+		if len(sp.pts) >= 3 {
+			group = append(group, sp.pts)
+		}
+	}
+	groups := [][][]coords.Point{group}
+	for _, rect := range rects {
+		var next [][][]coords.Point
+		for _, g := range groups {
+			if !overlaps(polygonBounds(g), rect) {
+				next = append(next, g)
+				continue
+			}
+			for _, region := range outsideRegions(rect) {
+				var part [][]coords.Point
+				for _, poly := range g {
+					if clipped := clipPolygon(poly, region); len(clipped) >= 3 && math.Abs(polygonArea(clipped)) > 1e-9 {
+						part = append(part, clipped)
+					}
+				}
+				if len(part) > 0 {
+					next = append(next, part)
+				}
+			}
+		}
+		groups = next
+	}
+	var out [][]coords.Point
+	for _, g := range groups {
+		out = append(out, g...)
+	}
+	return out
+}
+
+func polygonBounds(polys [][]coords.Point) semantic.Rectangle {
+	var all []coords.Point
+	for _, p := range polys {
+		all = append(all, p...)
+	}
+	return boundsOf(all...)
+}
+
+// segmentInside returns the parameter interval of a→b inside rect
+// (Liang–Barsky); ok is false when the segment misses it.
+func segmentInside(a, b coords.Point, rect semantic.Rectangle) (t0, t1 float64, ok bool) {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	t0, t1 = 0, 1
+	for _, e := range [4][2]float64{
+		{-dx, a.X - rect.LLX}, {dx, rect.URX - a.X},
+		{-dy, a.Y - rect.LLY}, {dy, rect.URY - a.Y},
+	} {
+		p, q := e[0], e[1]
+		if p == 0 {
+			if q < 0 {
+				return 0, 0, false
+			}
+			continue
+		}
+		t := q / p
+		if p < 0 {
+			t0 = math.Max(t0, t)
+		} else {
+			t1 = math.Min(t1, t)
+		}
+		if t0 > t1 {
+			return 0, 0, false
+		}
+	}
+	return t0, t1, true
+}
+
+func segments(sp subpath) [][2]coords.Point {
+	var segs [][2]coords.Point
+	for i := 1; i < len(sp.pts); i++ {
+		segs = append(segs, [2]coords.Point{sp.pts[i-1], sp.pts[i]})
+	}
+	if sp.closed && len(sp.pts) > 1 {
+		segs = append(segs, [2]coords.Point{sp.pts[len(sp.pts)-1], sp.pts[0]})
+	}
+	if len(sp.pts) == 1 {
+		segs = append(segs, [2]coords.Point{sp.pts[0], sp.pts[0]})
+	}
+	return segs
+}
+
+func segmentsHit(subpaths []subpath, rects []semantic.Rectangle) bool {
+	for _, sp := range subpaths {
+		for _, seg := range segments(sp) {
+			for _, rect := range rects {
+				if _, _, ok := segmentInside(seg[0], seg[1], rect); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// clipSegments removes the parts of every stroked segment inside rects and
+// joins what remains into polylines. Subpaths left whole stay closed.
+func clipSegments(subpaths []subpath, rects []semantic.Rectangle) []subpath {
+	var out []subpath
+	for _, sp := range subpaths {
+		segs := segments(sp)
+		whole := true
+		var line []coords.Point
+		flush := func() {
+			if len(line) >= 2 {
+				out = append(out, subpath{pts: line})
+			}
+			line = nil
+		}
+		for _, seg := range segs {
+			a, b := seg[0], seg[1]
+			keep := [][2]float64{{0, 1}}
+			for _, rect := range rects {
+				t0, t1, ok := segmentInside(a, b, rect)
+				if !ok {
+					continue
+				}
+				var next [][2]float64
+				for _, iv := range keep {
+					if iv[0] < t0 {
+						next = append(next, [2]float64{iv[0], math.Min(iv[1], t0)})
+					}
+					if iv[1] > t1 {
+						next = append(next, [2]float64{math.Max(iv[0], t1), iv[1]})
+					}
+				}
+				keep = next
+			}
+			if len(keep) != 1 || keep[0] != [2]float64{0, 1} {
+				whole = false
+			}
+			at := func(t float64) coords.Point {
+				return coords.Point{X: a.X + t*(b.X-a.X), Y: a.Y + t*(b.Y-a.Y)}
+			}
+			for _, iv := range keep {
+				if iv[0] > 0 || len(line) == 0 {
+					flush()
+					line = append(line, at(iv[0]))
+				}
+				line = append(line, at(iv[1]))
+				if iv[1] < 1 {
+					flush()
+				}
+			}
+		}
+		if whole && sp.closed && len(sp.pts) > 1 {
+			out = append(out, subpath{pts: sp.pts, closed: true})
+			continue
+		}
+		flush()
+	}
+	return out
+}
@@ -0,0 +1,432 @@
+package editor_test
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/contentstream/editor"
+	"github.com/wudi/pdfkit/extractor"
+	"github.com/wudi/pdfkit/ir"
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/writer"
+)
+
+func num(v float64) semantic.Operand { return semantic.NumberOperand{Value: v} }
+
+func op(operator string, operands ...semantic.Operand) semantic.Operation {
+	return semantic.Operation{Operator: operator, Operands: operands}
+}
+
+// monoFont is a simple font whose glyphs are all 500 units wide.
+func monoFont() *semantic.Font {
+	widths := make(map[int]int)
+	for c := 32; c < 127; c++ {
+		widths[c] = 500
+	}
+	return &semantic.Font{Subtype: "Type1", BaseFont: "Courier", Widths: widths}
+}
+
+// shownText concatenates the strings shown by text operators.
+func shownText(ops []semantic.Operation) string {
+	var sb strings.Builder
+	for _, o := range ops {
+		for _, operand := range o.Operands {
+			switch v := operand.(type) {
+			case semantic.StringOperand:
+				sb.Write(v.Value)
+			case semantic.ArrayOperand:
+				for _, item := range v.Values {
+					if s, ok := item.(semantic.StringOperand); ok {
+						sb.Write(s.Value)
+					}
+				}
+			}
+		}
+	}
+	return sb.String()
+}
+
+func TestRedact_SplitsTextAtGlyphs(t *testing.T) {
+	page := &semantic.Page{
+		MediaBox:  semantic.Rectangle{URX: 300, URY: 300},
+		Resources: &semantic.Resources{Fonts: map[string]*semantic.Font{"F1": monoFont()}},
+		Contents: []semantic.ContentStream{{Operations: []semantic.Operation{
+			op("BT"),
+			op("Tf", semantic.NameOperand{Value: "F1"}, num(10)),
+			op("Tm", num(1), num(0), num(0), num(1), num(100), num(100)),
+			op("Tj", semantic.StringOperand{Value: []byte("Hello Secret World")}),
+			op("Tj", semantic.StringOperand{Value: []byte("!")}),
+			op("ET"),
+		}}},
+	}
+
+	// Each glyph is 5pt wide: "Secret" spans x = 130..160.
+	rect := semantic.Rectangle{LLX: 131, LLY: 95, URX: 159, URY: 115}
+	if err := editor.NewEditor().Redact(context.Background(), nil, page, rect); err != nil {
+		t.Fatalf("Redact: %v", err)
+	}
+
+	ops := page.Contents[0].Operations
+	if got := shownText(ops); got != "Hello  World!" {
+		t.Fatalf("shown text = %q", got)
+	}
+	var tj *semantic.Operation
+	for i := range ops {
+		if ops[i].Operator == "TJ" {
+			tj = &ops[i]
+		}
+	}
+	if tj == nil {
+		t.Fatalf("expected the split string as TJ, got %+v", ops)
+	}
+	arr := tj.Operands[0].(semantic.ArrayOperand).Values
+	if len(arr) != 3 {
+		t.Fatalf("TJ array = %+v", arr)
+	}
+	// The gap keeps " World" where it was: six 500-unit glyphs.
+	if n, ok := arr[1].(semantic.NumberOperand); !ok || n.Value != -3000 {
+		t.Errorf("gap adjustment = %+v, want -3000", arr[1])
+	}
+}
+
+func TestRedact_KeepsPositionForFollowingText(t *testing.T) {
+	page := &semantic.Page{
+		Resources: &semantic.Resources{Fonts: map[string]*semantic.Font{"F1": monoFont()}},
+		Contents: []semantic.ContentStream{{Operations: []semantic.Operation{
+			op("BT"),
+			op("Tf", semantic.NameOperand{Value: "F1"}, num(10)),
+			op("Tc", num(1)),
+			op("Td", num(0), num(0)),
+			op("Tj", semantic.StringOperand{Value: []byte("AB")}),
+			op("Tj", semantic.StringOperand{Value: []byte("CD")}),
+			op("ET"),
+		}}},
+	}
+	// Glyphs advance 6pt (5pt + 1pt spacing): "AB" spans x = 0..12.
+	if err := editor.NewEditor().Redact(context.Background(), nil, page, semantic.Rectangle{LLX: 0, LLY: -5, URX: 11, URY: 15}); err != nil {
+		t.Fatalf("Redact: %v", err)
+	}
+	ops := page.Contents[0].Operations
+	if got := shownText(ops); got != "CD" {
+		t.Fatalf("shown text = %q", got)
+	}
+	for _, o := range ops {
+		if o.Operator != "TJ" {
+			continue
+		}
+		arr := o.Operands[0].(semantic.ArrayOperand).Values
+		if len(arr) != 1 || math.Abs(arr[0].(semantic.NumberOperand).Value+1200) > 1e-9 {
+			t.Fatalf("placeholder TJ = %+v, want [-1200]", arr)
+		}
+		return
+	}
+	t.Fatalf("missing placeholder advance in %+v", ops)
+}
+
+func TestRedact_ScrubsActualText(t *testing.T) {
+	page := &semantic.Page{
+		Resources: &semantic.Resources{Fonts: map[string]*semantic.Font{"F1": monoFont()}},
+		Contents: []semantic.ContentStream{{Operations: []semantic.Operation{
+			op("BDC", semantic.NameOperand{Value: "Span"}, semantic.DictOperand{Values: map[string]semantic.Operand{
+				"ActualText": semantic.StringOperand{Value: []byte("Secret")},
+				"MCID":       num(0),
+			}}),
+			op("BT"),
+			op("Tf", semantic.NameOperand{Value: "F1"}, num(10)),
+			op("Tj", semantic.StringOperand{Value: []byte("Sec ok")}),
+			op("ET"),
+			op("EMC"),
+		}}},
+	}
+	if err := editor.NewEditor().Redact(context.Background(), nil, page, semantic.Rectangle{LLX: 0, LLY: 0, URX: 14, URY: 5}); err != nil {
+		t.Fatalf("Redact: %v", err)
+	}
+	bdc := page.Contents[0].Operations[0]
+	props := bdc.Operands[1].(semantic.DictOperand).Values
+	if _, ok := props["ActualText"]; ok {
+		t.Error("ActualText survived redaction")
+	}
+	if _, ok := props["MCID"]; !ok {
+		t.Error("MCID removed")
+	}
+}
+
+// pathArea sums the signed areas of the closed subpaths built by ops.
+func pathArea(ops []semantic.Operation) float64 {
+	var pts [][2]float64
+	area := 0.0
+	flush := func() {
+		for i := range pts {
+			j := (i + 1) % len(pts)
+			area += pts[i][0]*pts[j][1] - pts[j][0]*pts[i][1]
+		}
+		pts = nil
+	}
+	for _, o := range ops {
+		switch o.Operator {
+		case "m":
+			flush()
+			fallthrough
+		case "l":
+			pts = append(pts, [2]float64{o.Operands[0].(semantic.NumberOperand).Value, o.Operands[1].(semantic.NumberOperand).Value})
+		}
+	}
+	flush()
+	return math.Abs(area / 2)
+}
+
+func TestRedact_ClipsFilledPath(t *testing.T) {
+	page := &semantic.Page{
+		Contents: []semantic.ContentStream{{Operations: []semantic.Operation{
+			op("cm", num(2), num(0), num(0), num(2), num(0), num(0)),
+			op("re", num(0), num(0), num(50), num(50)),
+			op("f"),
+		}}},
+	}
+	// Page space: the square covers 0..100; cut a hole at 25..75.
+	if err := editor.NewEditor().Redact(context.Background(), nil, page, semantic.Rectangle{LLX: 25, LLY: 25, URX: 75, URY: 75}); err != nil {
+		t.Fatalf("Redact: %v", err)
+	}
+	ops := page.Contents[0].Operations
+	if last := ops[len(ops)-1].Operator; last != "f" {
+		t.Fatalf("last operator = %s", last)
+	}
+	// Path coordinates stay in user space (half of page space).
+	if got, want := pathArea(ops), 50.0*50-25*25; math.Abs(got-want) > 1e-6 {
+		t.Errorf("remaining area = %v, want %v", got, want)
+	}
+	for _, o := range ops {
+		if o.Operator == "m" || o.Operator == "l" {
+			x, y := o.Operands[0].(semantic.NumberOperand).Value, o.Operands[1].(semantic.NumberOperand).Value
+			if x > 12.5+1e-9 && x < 37.5-1e-9 && y > 12.5+1e-9 && y < 37.5-1e-9 {
+				t.Errorf("vertex (%v, %v) inside the redacted area", x, y)
+			}
+		}
+	}
+}
+
+func TestRedact_ClipsStrokedPath(t *testing.T) {
+	page := &semantic.Page{
+		Contents: []semantic.ContentStream{{Operations: []semantic.Operation{
+			op("m", num(0), num(50)),
+			op("l", num(100), num(50)),
+			op("S"),
+			op("m", num(0), num(90)),
+			op("l", num(100), num(90)),
+			op("S"),
+		}}},
+	}
+	if err := editor.NewEditor().Redact(context.Background(), nil, page, semantic.Rectangle{LLX: 40, LLY: 40, URX: 60, URY: 60}); err != nil {
+		t.Fatalf("Redact: %v", err)
+	}
+	var got []string
+	for _, o := range page.Contents[0].Operations {
+		s := o.Operator
+		for _, a := range o.Operands {
+			s += " " + string(contentstream.SerializeOperand(a))
+		}
+		got = append(got, s)
+	}
+	want := []string{"m 0 50", "l 39 50", "m 61 50", "l 100 50", "S", "m 0 90", "l 100 90", "S"}
+	if strings.Join(got, ";") != strings.Join(want, ";") {
+		t.Errorf("ops = %v, want %v", got, want)
+	}
+}
+
+func TestRedact_BlanksImagePixels(t *testing.T) {
+	data := bytes.Repeat([]byte{0xff}, 16)
+	img := semantic.XObject{
+		Subtype: "Image", Width: 4, Height: 4, BitsPerComponent: 8,
+		ColorSpace: semantic.DeviceColorSpace{Name: "DeviceGray"},
+		Data:       data,
+	}
+	res := &semantic.Resources{XObjects: map[string]semantic.XObject{"Im1": img}}
+	page := &semantic.Page{
+		Resources: res,
+		Contents: []semantic.ContentStream{{Operations: []semantic.Operation{
+			op("q"),
+			op("cm", num(40), num(0), num(0), num(40), num(0), num(0)),
+			op("Do", semantic.NameOperand{Value: "Im1"}),
+			op("Q"),
+		}}},
+	}
+	// Pixels are 10pt squares; the first row is at the top (y = 30..40).
+	if err := editor.NewEditor().Redact(context.Background(), nil, page, semantic.Rectangle{LLX: 11, LLY: 31, URX: 19, URY: 39}); err != nil {
+		t.Fatalf("Redact: %v", err)
+	}
+	do := page.Contents[0].Operations[2]
+	name := do.Operands[0].(semantic.NameOperand).Value
+	if name == "Im1" {
+		t.Fatal("image was changed in place")
+	}
+	if !bytes.Equal(res.XObjects["Im1"].Data, data) || res.XObjects["Im1"].Data[1] != 0xff {
+		t.Error("original image modified")
+	}
+	got := res.XObjects[name].Data
+	for i, v := range got {
+		want := byte(0xff)
+		if i == 1 {
+			want = 0
+		}
+		if v != want {
+			t.Errorf("pixel %d = %#x, want %#x", i, v, want)
+		}
+	}
+}
+
+func TestRedact_DropsImageInsideArea(t *testing.T) {
+	res := &semantic.Resources{XObjects: map[string]semantic.XObject{"Im1": {
+		Subtype: "Image", Width: 1, Height: 1, BitsPerComponent: 8, Filter: "JBIG2Decode", Data: []byte{1},
+	}}}
+	page := &semantic.Page{
+		Resources: res,
+		Contents: []semantic.ContentStream{{Operations: []semantic.Operation{
+			op("cm", num(10), num(0), num(0), num(10), num(10), num(10)),
+			op("Do", semantic.NameOperand{Value: "Im1"}),
+		}}},
+	}
+	if err := editor.NewEditor().Redact(context.Background(), nil, page, semantic.Rectangle{LLX: 15, LLY: 0, URX: 30, URY: 30}); err != nil {
+		t.Fatalf("Redact: %v", err)
+	}
+	for _, o := range page.Contents[0].Operations {
+		if o.Operator == "Do" {
+			t.Fatal("undecodable image touching the area was kept")
+		}
+	}
+}
+
+func TestRedact_RecursesIntoForms(t *testing.T) {
+	form := semantic.XObject{
+		Subtype:   "Form",
+		BBox:      semantic.Rectangle{URX: 100, URY: 20},
+		Matrix:    []float64{1, 0, 0, 1, 50, 50},
+		Resources: &semantic.Resources{Fonts: map[string]*semantic.Font{"F1": monoFont()}},
+		Data:      []byte("BT /F1 10 Tf (Top Secret) Tj ET"),
+	}
+	res := &semantic.Resources{XObjects: map[string]semantic.XObject{"Fm1": form}}
+	page := &semantic.Page{
+		Resources: res,
+		Contents:  []semantic.ContentStream{{RawBytes: []byte("/Fm1 Do")}},
+	}
+	// "Secret" starts at x = 50 + 4*5 in page space.
+	if err := editor.NewEditor().Redact(context.Background(), nil, page, semantic.Rectangle{LLX: 71, LLY: 48, URX: 99, URY: 60}); err != nil {
+		t.Fatalf("Redact: %v", err)
+	}
+	if len(page.Contents) != 1 || page.Contents[0].RawBytes != nil {
+		t.Fatalf("raw content kept: %+v", page.Contents)
+	}
+	name := page.Contents[0].Operations[0].Operands[0].(semantic.NameOperand).Value
+	ops, err := contentstream.ParseOperations(res.XObjects[name].Data)
+	if err != nil {
+		t.Fatalf("parse form: %v", err)
+	}
+	if got := shownText(ops); got != "Top " {
+		t.Errorf("form text = %q", got)
+	}
+	if string(res.XObjects["Fm1"].Data) != string(form.Data) {
+		t.Error("original form modified")
+	}
+}
+
+func TestApplyRedactions_TextNotExtractable(t *testing.T) {
+	b := builder.NewBuilder()
+	b.NewPage(300, 300).
+		DrawText("Public Secret", 72, 200, builder.TextOptions{FontSize: 12}).
+		Finish()
+	built, err := b.Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := writer.NewWriter().Write(context.Background(), built, &buf, writer.Config{Deterministic: true}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	doc, err := ir.NewDefault().Parse(context.Background(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	// Without widths every glyph is taken as 6pt: "Secret" spans 114..150.
+	page := doc.Pages[0]
+	page.Annotations = append(page.Annotations, &semantic.RedactAnnotation{
+		BaseAnnotation: semantic.BaseAnnotation{Subtype: "Redact", RectVal: semantic.Rectangle{LLX: 113, LLY: 195, URX: 160, URY: 215}},
+		IC:             []float64{0, 0, 0},
+		OverlayText:    "XXX",
+	})
+	if err := editor.NewEditor().ApplyRedactions(context.Background(), doc, page); err != nil {
+		t.Fatalf("ApplyRedactions: %v", err)
+	}
+	if len(page.Annotations) != 0 {
+		t.Errorf("redaction annotation kept: %+v", page.Annotations)
+	}
+
+	buf.Reset()
+	if err := writer.NewWriter().Write(context.Background(), doc, &buf, writer.Config{Deterministic: true}); err != nil {
+		t.Fatalf("write redacted: %v", err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("Secret")) {
+		t.Error("redacted text present in output file")
+	}
+	redacted, err := ir.NewDefault().Parse(context.Background(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parse redacted: %v", err)
+	}
+	ext, err := extractor.New(redacted.Decoded())
+	if err != nil {
+		t.Fatalf("extractor: %v", err)
+	}
+	texts, err := ext.ExtractText()
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	var all strings.Builder
+	for _, pt := range texts {
+		all.WriteString(pt.Content)
+	}
+	got := all.String()
+	if strings.Contains(got, "Secret") || strings.Contains(got, "S") {
+		t.Errorf("redacted text recoverable: %q", got)
+	}
+	if !strings.Contains(got, "Public") || !strings.Contains(got, "XXX") {
+		t.Errorf("extracted text = %q, want the public part and the overlay", got)
+	}
+}
+
+func TestRedact_LoadsLazyPage(t *testing.T) {
+	b := builder.NewBuilder()
+	b.NewPage(300, 300).
+		DrawText("Public Secret", 72, 200, builder.TextOptions{FontSize: 12}).
+		Finish()
+	built, err := b.Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := writer.NewWriter().Write(context.Background(), built, &buf, writer.Config{Deterministic: true}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	doc, err := ir.NewDefault().WithLazyLoading(16).Parse(context.Background(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	page := doc.Pages[0]
+	if page.Contents != nil {
+		t.Fatal("expected page content deferred until Load")
+	}
+
+	if err := editor.NewEditor().RemoveRect(context.Background(), doc, page, semantic.Rectangle{LLX: 113, LLY: 195, URX: 160, URY: 215}); err != nil {
+		t.Fatalf("RemoveRect: %v", err)
+	}
+	ops, err := contentstream.PageOperations(page)
+	if err != nil {
+		t.Fatalf("parse content: %v", err)
+	}
+	if got := shownText(ops); strings.Contains(got, "Secret") || !strings.Contains(got, "Public") {
+		t.Errorf("shown text = %q, want the public part only", got)
+	}
+}
@@ -0,0 +1,563 @@
+package contentstream
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// InlineImageOperator is the synthetic operator used for BI/ID/EI sequences.
+// The single operand is a semantic.InlineImageOperand, which mirrors how the
+// writer serializes inline images.
+const InlineImageOperator = "INLINE_IMAGE"
+
+// ParseOperations tokenizes a content stream into operations. Parsing is
+// lenient: malformed input yields every operation recovered before the
+// problem together with a non-nil error.
+func ParseOperations(data []byte) ([]semantic.Operation, error) {
+	lx := &lexer{data: data}
+	var ops []semantic.Operation
+	var stack []semantic.Operand
+	for {
+		tok, err := lx.next()
+		if err != nil {
+			return ops, err
+		}
+		switch tok.kind {
+		case tokEOF:
+			return ops, nil
+		case tokKeyword:
+			switch tok.text {
+			case "true", "false":
+				stack = append(stack, semantic.BoolOperand{Value: tok.text == "true"})
+				continue
+			case "null":
+				continue
+			case "BI":
+				img, err := lx.inlineImage()
+				if err != nil {
+					return ops, err
+				}
+				ops = append(ops, semantic.Operation{Operator: InlineImageOperator, Operands: []semantic.Operand{img}})
+				stack = nil
+				continue
+			}
+			ops = append(ops, semantic.Operation{Operator: tok.text, Operands: stack})
+			stack = nil
+		default:
+			operand, err := lx.operand(tok)
+			if err != nil {
+				return ops, err
+			}
+			stack = append(stack, operand)
+		}
+	}
+}
+
+// PageOperations returns the operations of page, parsing raw content when
+// the semantic layer kept the bytes only. Streams are concatenated first
+// because an operation may span stream boundaries.
+func PageOperations(page *semantic.Page) ([]semantic.Operation, error) {
+	parsed := true
+	for _, cs := range page.Contents {
+		if len(cs.Operations) == 0 && len(cs.RawBytes) > 0 {
+			parsed = false
+			break
+		}
+	}
+	if parsed {
+		var ops []semantic.Operation
+		for _, cs := range page.Contents {
+			ops = append(ops, cs.Operations...)
+		}
+		return ops, nil
+	}
+	var data []byte
+	for _, cs := range page.Contents {
+		data = append(data, cs.RawBytes...)
+		data = append(data, '\n')
+	}
+	return ParseOperations(data)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokName
+	tokString
+	tokArrayStart
+	tokArrayEnd
+	tokDictStart
+	tokDictEnd
+	tokKeyword
+)
+
+type lexToken struct {
+	kind  tokenKind
+	text  string
+	bytes []byte
+	num   float64
+}
+
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func (l *lexer) skipWhitespace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isWhitespace(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+func (l *lexer) next() (lexToken, error) {
+	l.skipWhitespace()
+	if l.pos >= len(l.data) {
+		return lexToken{kind: tokEOF}, nil
+	}
+	c := l.data[l.pos]
+	switch c {
+	case '[':
+		l.pos++
+		return lexToken{kind: tokArrayStart}, nil
+	case ']':
+		l.pos++
+		return lexToken{kind: tokArrayEnd}, nil
+	case '{', '}':
+		// Braces only appear inside PostScript calculator functions; skip them.
+		l.pos++
+		return l.next()
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return lexToken{kind: tokDictStart}, nil
+		}
+		return l.hexString()
+	case '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return lexToken{kind: tokDictEnd}, nil
+		}
+		l.pos++
+		return l.next()
+	case '(':
+		return l.literalString()
+	case ')':
+		l.pos++
+		return l.next()
+	case '/':
+		return l.name(), nil
+	}
+	start := l.pos
+	for l.pos < len(l.data) && !isDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	text := string(l.data[start:l.pos])
+	if looksNumeric(text) {
+		num, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			// Malformed numbers such as "--1" or "1.2.3" are read as zero,
+			// matching the behaviour of common viewers.
+			num = 0
+		}
+		return lexToken{kind: tokNumber, num: num}, nil
+	}
+	return lexToken{kind: tokKeyword, text: text}, nil
+}
+
+func (l *lexer) name() lexToken {
+	l.pos++ // '/'
+	var buf bytes.Buffer
+	for l.pos < len(l.data) && !isDelim(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				buf.WriteByte(byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		buf.WriteByte(c)
+		l.pos++
+	}
+	return lexToken{kind: tokName, text: buf.String()}
+}
+
+func (l *lexer) hexString() (lexToken, error) {
+	l.pos++ // '<'
+	var out []byte
+	var hi byte
+	haveHi := false
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			if haveHi {
+				out = append(out, hi<<4)
+			}
+			return lexToken{kind: tokString, bytes: out}, nil
+		}
+		v, ok := hexValue(c)
+		if !ok {
+			continue
+		}
+		if haveHi {
+			out = append(out, hi<<4|v)
+			haveHi = false
+		} else {
+			hi = v
+			haveHi = true
+		}
+	}
+	return lexToken{}, errors.New("unterminated hex string")
+}
+
+func (l *lexer) literalString() (lexToken, error) {
+	l.pos++ // '('
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+			out = append(out, c)
+		case ')':
+			depth--
+			if depth == 0 {
+				return lexToken{kind: tokString, bytes: out}, nil
+			}
+			out = append(out, c)
+		case '\r':
+			// End-of-line sequences inside literals are normalized to LF.
+			if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+				l.pos++
+			}
+			out = append(out, '\n')
+		case '\\':
+			if l.pos >= len(l.data) {
+				continue
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+				// Line continuation.
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for n := 0; n < 2 && l.pos < len(l.data); n++ {
+						d := l.data[l.pos]
+						if d < '0' || d > '7' {
+							break
+						}
+						v = v*8 + int(d-'0')
+						l.pos++
+					}
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+	return lexToken{}, errors.New("unterminated literal string")
+}
+
+// operand converts a token (and any nested tokens it opens) into an operand.
+func (l *lexer) operand(tok lexToken) (semantic.Operand, error) {
+	switch tok.kind {
+	case tokNumber:
+		return semantic.NumberOperand{Value: tok.num}, nil
+	case tokName:
+		return semantic.NameOperand{Value: tok.text}, nil
+	case tokString:
+		return semantic.StringOperand{Value: tok.bytes}, nil
+	case tokArrayStart:
+		var values []semantic.Operand
+		for {
+			t, err := l.next()
+			if err != nil {
+				return nil, err
+			}
+			switch t.kind {
+			case tokEOF:
+				return nil, errors.New("unterminated array")
+			case tokArrayEnd:
+				return semantic.ArrayOperand{Values: values}, nil
+			case tokKeyword:
+				if v, ok := keywordOperand(t.text); ok {
+					values = append(values, v)
+				}
+				continue
+			}
+			v, err := l.operand(t)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+	case tokDictStart:
+		values := make(map[string]semantic.Operand)
+		for {
+			t, err := l.next()
+			if err != nil {
+				return nil, err
+			}
+			if t.kind == tokEOF {
+				return nil, errors.New("unterminated dictionary")
+			}
+			if t.kind == tokDictEnd {
+				return semantic.DictOperand{Values: values}, nil
+			}
+			if t.kind != tokName {
+				return nil, fmt.Errorf("dictionary key is not a name")
+			}
+			vt, err := l.next()
+			if err != nil {
+				return nil, err
+			}
+			if vt.kind == tokKeyword {
+				if v, ok := keywordOperand(vt.text); ok {
+					values[t.text] = v
+				}
+				continue
+			}
+			if vt.kind == tokDictEnd || vt.kind == tokEOF {
+				return nil, errors.New("dictionary key without value")
+			}
+			v, err := l.operand(vt)
+			if err != nil {
+				return nil, err
+			}
+			values[t.text] = v
+		}
+	case tokArrayEnd, tokDictEnd:
+		return nil, errors.New("unexpected closing delimiter")
+	}
+	return nil, fmt.Errorf("unexpected token")
+}
+
+// inlineImage reads the BI dictionary, the ID marker, the sample data and the
+// closing EI. The lexer must be positioned just after BI.
+func (l *lexer) inlineImage() (semantic.InlineImageOperand, error) {
+	dict := semantic.DictOperand{Values: make(map[string]semantic.Operand)}
+	for {
+		t, err := l.next()
+		if err != nil {
+			return semantic.InlineImageOperand{}, err
+		}
+		if t.kind == tokEOF {
+			return semantic.InlineImageOperand{}, errors.New("inline image missing ID")
+		}
+		if t.kind == tokKeyword && t.text == "ID" {
+			break
+		}
+		if t.kind != tokName {
+			continue
+		}
+		vt, err := l.next()
+		if err != nil {
+			return semantic.InlineImageOperand{}, err
+		}
+		if vt.kind == tokKeyword {
+			if v, ok := keywordOperand(vt.text); ok {
+				dict.Values[t.text] = v
+			}
+			continue
+		}
+		v, err := l.operand(vt)
+		if err != nil {
+			return semantic.InlineImageOperand{}, err
+		}
+		dict.Values[t.text] = v
+	}
+	// A single whitespace byte separates ID from the data.
+	if l.pos < len(l.data) && isWhitespace(l.data[l.pos]) {
+		l.pos++
+	}
+	start := l.pos
+	end := -1
+	if n := inlineImageLength(dict); n > 0 && start+n <= len(l.data) {
+		if idx := findEI(l.data, start+n); idx >= 0 && idx-start-n <= 2 {
+			end = start + n
+			l.pos = idx + 2
+		}
+	}
+	if end < 0 {
+		idx := findEI(l.data, start)
+		if idx < 0 {
+			l.pos = len(l.data)
+			return semantic.InlineImageOperand{Image: dict, Data: l.data[start:]}, errors.New("inline image missing EI")
+		}
+		end = idx
+		for end > start && isWhitespace(l.data[end-1]) {
+			end--
+		}
+		l.pos = idx + 2
+	}
+	data := make([]byte, end-start)
+	copy(data, l.data[start:end])
+	return semantic.InlineImageOperand{Image: dict, Data: data}, nil
+}
+
+// inlineImageLength computes the byte length of unfiltered inline image data,
+// or 0 when the data is filtered or the dictionary is incomplete.
+func inlineImageLength(dict semantic.DictOperand) int {
+	get := func(keys ...string) (semantic.Operand, bool) {
+		for _, k := range keys {
+			if v, ok := dict.Values[k]; ok {
+				return v, true
+			}
+		}
+		return nil, false
+	}
+	if f, ok := get("F", "Filter"); ok {
+		if arr, isArr := f.(semantic.ArrayOperand); !isArr || len(arr.Values) > 0 {
+			return 0
+		}
+	}
+	num := func(keys ...string) int {
+		if v, ok := get(keys...); ok {
+			if n, ok := v.(semantic.NumberOperand); ok {
+				return int(n.Value)
+			}
+		}
+		return 0
+	}
+	w, h := num("W", "Width"), num("H", "Height")
+	if w <= 0 || h <= 0 {
+		return 0
+	}
+	bpc := num("BPC", "BitsPerComponent")
+	comps := 1
+	if v, ok := get("IM", "ImageMask"); ok {
+		if b, ok := v.(semantic.BoolOperand); ok && b.Value {
+			bpc = 1
+		}
+	}
+	if v, ok := get("CS", "ColorSpace"); ok {
+		if n, ok := v.(semantic.NameOperand); ok {
+			switch n.Value {
+			case "G", "DeviceGray", "CalGray", "I", "Indexed":
+				comps = 1
+			case "RGB", "DeviceRGB", "CalRGB", "Lab":
+				comps = 3
+			case "CMYK", "DeviceCMYK":
+				comps = 4
+			default:
+				return 0
+			}
+		} else if arr, ok := v.(semantic.ArrayOperand); ok && len(arr.Values) > 0 {
+			if n, ok := arr.Values[0].(semantic.NameOperand); !ok || (n.Value != "I" && n.Value != "Indexed") {
+				return 0
+			}
+		}
+	}
+	if bpc <= 0 {
+		return 0
+	}
+	return (w*comps*bpc + 7) / 8 * h
+}
+
+// findEI locates an EI keyword delimited by whitespace (or end of data).
+func findEI(data []byte, from int) int {
+	for i := from; i+1 < len(data); i++ {
+		if data[i] != 'E' || data[i+1] != 'I' {
+			continue
+		}
+		if i > from && !isWhitespace(data[i-1]) {
+			continue
+		}
+		if i+2 < len(data) && !isDelim(data[i+2]) {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+func keywordOperand(text string) (semantic.Operand, bool) {
+	switch text {
+	case "true":
+		return semantic.BoolOperand{Value: true}, true
+	case "false":
+		return semantic.BoolOperand{Value: false}, true
+	}
+	return nil, false
+}
+
+func looksNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	digits := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9':
+			digits = true
+		case c == '.' || c == '-' || c == '+':
+		default:
+			return false
+		}
+	}
+	return digits || s == "." || s == "-" || s == "+"
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func isWhitespace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return isWhitespace(c)
+}
@@ -0,0 +1,123 @@
+package contentstream
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/wudi/pdfkit/internal/pdfnum"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// Serialize encodes operations as content stream bytes, one operation per
+// line. It is the inverse of ParseOperations.
+func Serialize(ops []semantic.Operation) []byte {
+	var buf bytes.Buffer
+	for _, op := range ops {
+		if op.Operator == InlineImageOperator && len(op.Operands) > 0 {
+			if ii, ok := op.Operands[0].(semantic.InlineImageOperand); ok {
+				buf.WriteString("BI\n")
+				keys := make([]string, 0, len(ii.Image.Values))
+				for k := range ii.Image.Values {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					buf.WriteString("/" + k + " ")
+					buf.Write(SerializeOperand(ii.Image.Values[k]))
+					buf.WriteByte('\n')
+				}
+				buf.WriteString("ID ")
+				buf.Write(ii.Data)
+				buf.WriteString("\nEI\n")
+				continue
+			}
+		}
+		for i, operand := range op.Operands {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.Write(SerializeOperand(operand))
+		}
+		if len(op.Operands) > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(op.Operator)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// SerializeOperand encodes a single operand in content stream syntax.
+func SerializeOperand(op semantic.Operand) []byte {
+	switch v := op.(type) {
+	case semantic.NumberOperand:
+		return []byte(pdfnum.Format(v.Value, -1))
+	case semantic.NameOperand:
+		return []byte("/" + v.Value)
+	case semantic.StringOperand:
+		return escapeString(v.Value)
+	case semantic.BoolOperand:
+		if v.Value {
+			return []byte("true")
+		}
+		return []byte("false")
+	case semantic.ArrayOperand:
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		for i, it := range v.Values {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.Write(SerializeOperand(it))
+		}
+		buf.WriteByte(']')
+		return buf.Bytes()
+	case semantic.DictOperand:
+		var buf bytes.Buffer
+		buf.WriteString("<<")
+		keys := make([]string, 0, len(v.Values))
+		for k := range v.Values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			buf.WriteString("/" + k + " ")
+			buf.Write(SerializeOperand(v.Values[k]))
+		}
+		buf.WriteString(">>")
+		return buf.Bytes()
+	default:
+		return []byte("null")
+	}
+}
+
+func escapeString(data []byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte('(')
+	for _, ch := range data {
+		switch ch {
+		case '\\', '(', ')':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case '\n':
+			b.WriteString("\\n")
+		case '\r':
+			b.WriteString("\\r")
+		case '\t':
+			b.WriteString("\\t")
+		case '\b':
+			b.WriteString("\\b")
+		case '\f':
+			b.WriteString("\\f")
+		default:
+			if ch < 0x20 || ch >= 0x80 {
+				fmt.Fprintf(&b, "\\%03o", ch)
+			} else {
+				b.WriteByte(ch)
+			}
+		}
+	}
+	b.WriteByte(')')
+	return b.Bytes()
+}
@@ -0,0 +1,496 @@
+package contentstream
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/wudi/pdfkit/coords"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// maxFormDepth bounds the nesting of form XObjects followed by TraceText.
+const maxFormDepth = 12
+
+// Glyph is a single glyph painted by a text-showing operator.
+type Glyph struct {
+	OpIndex    int    // index of the showing (or Do) operation in the traced stream
+	Code       []byte // character code
+	Font       *semantic.Font
+	FontName   string  // resource name of the font
+	FontSize   float64 // font size set by Tf
+	Width      float64 // advance width in em units
+	Matrix     coords.Matrix
+	Origin     coords.Point       // origin on the baseline in default user space
+	Rect       semantic.Rectangle // box from descent to ascent in default user space
+	RenderMode TextRenderMode
+	ColorSpace string    // fill colour space, or stroke colour space for stroked-only text
+	Color      []float64 // colour components in ColorSpace
+	MCID       int       // innermost marked-content identifier, -1 outside tagged content
+	Artifact   bool      // inside /Artifact marked content
+}
+
+// TraceText executes the operations virtually and returns every glyph they
+// paint, including glyphs drawn by form XObjects. Matrix maps glyph space
+// (em units, y up from the baseline) to default user space; it combines the
+// font size, horizontal scaling, rise, text matrix and CTM.
+func (t *Tracer) TraceText(ops []semantic.Operation, resources *semantic.Resources) ([]Glyph, error) {
+	gs := &GraphicsState{CTM: coords.Identity(), FillColorSpace: "DeviceGray", FillColor: []float64{0}, StrokeColorSpace: "DeviceGray", StrokeColor: []float64{0}}
+	var out []Glyph
+	err := traceText(ops, resources, gs, NewTextState(), -1, 0, nil, &out)
+	return out, err
+}
+
+// markedContent is an open BMC/BDC sequence.
+type markedContent struct {
+	mcid     int
+	artifact bool
+}
+
+// traceText walks ops appending glyphs to out. opIndex, when non-negative,
+// overrides the operation index recorded for glyphs (the Do of a form).
+func traceText(ops []semantic.Operation, res *semantic.Resources, gs *GraphicsState, ts *TextState, opIndex, depth int, marked []markedContent, out *[]Glyph) error {
+	var textStack []TextState
+	for i, op := range ops {
+		idx := i
+		if opIndex >= 0 {
+			idx = opIndex
+		}
+		switch op.Operator {
+		case "q":
+			gs.Save()
+			textStack = append(textStack, *ts)
+		case "Q":
+			if err := gs.Restore(); err != nil {
+				return err
+			}
+			if n := len(textStack); n > 0 {
+				*ts = textStack[n-1]
+				textStack = textStack[:n-1]
+			}
+		case "cm":
+			if len(op.Operands) == 6 {
+				gs.CTM = operandToMatrix(op.Operands).Multiply(gs.CTM)
+			}
+		case "g", "rg", "k", "sc", "scn":
+			gs.FillColor = colorOperands(op.Operands)
+			switch op.Operator {
+			case "g":
+				gs.FillColorSpace = "DeviceGray"
+			case "rg":
+				gs.FillColorSpace = "DeviceRGB"
+			case "k":
+				gs.FillColorSpace = "DeviceCMYK"
+			}
+		case "G", "RG", "K", "SC", "SCN":
+			gs.StrokeColor = colorOperands(op.Operands)
+			switch op.Operator {
+			case "G":
+				gs.StrokeColorSpace = "DeviceGray"
+			case "RG":
+				gs.StrokeColorSpace = "DeviceRGB"
+			case "K":
+				gs.StrokeColorSpace = "DeviceCMYK"
+			}
+		case "cs", "CS":
+			if len(op.Operands) == 1 {
+				if name, ok := op.Operands[0].(semantic.NameOperand); ok {
+					if op.Operator == "cs" {
+						gs.FillColorSpace, gs.FillColor = name.Value, nil
+					} else {
+						gs.StrokeColorSpace, gs.StrokeColor = name.Value, nil
+					}
+				}
+			}
+		case "BMC", "BDC":
+			mc := markedContent{mcid: -1}
+			if n := len(marked); n > 0 {
+				mc = marked[n-1]
+			}
+			if len(op.Operands) > 0 {
+				if tag, ok := op.Operands[0].(semantic.NameOperand); ok && tag.Value == "Artifact" {
+					mc.artifact = true
+				}
+			}
+			if op.Operator == "BDC" && len(op.Operands) == 2 {
+				if props, ok := op.Operands[1].(semantic.DictOperand); ok {
+					if id, ok := props.Values["MCID"].(semantic.NumberOperand); ok {
+						mc.mcid = int(id.Value)
+					}
+				}
+			}
+			marked = append(marked, mc)
+		case "EMC":
+			if n := len(marked); n > 0 {
+				marked = marked[:n-1]
+			}
+		case "Do":
+			if depth >= maxFormDepth || len(op.Operands) != 1 || res == nil {
+				continue
+			}
+			name, ok := op.Operands[0].(semantic.NameOperand)
+			if !ok {
+				continue
+			}
+			xo, ok := res.XObjects[name.Value]
+			if !ok || xo.Subtype != "Form" {
+				continue
+			}
+			formOps, err := ParseOperations(xo.Data)
+			if err != nil && len(formOps) == 0 {
+				continue
+			}
+			formRes := xo.Resources
+			if formRes == nil {
+				formRes = res
+			}
+			gs.Save()
+			if len(xo.Matrix) == 6 {
+				m := coords.Matrix{xo.Matrix[0], xo.Matrix[1], xo.Matrix[2], xo.Matrix[3], xo.Matrix[4], xo.Matrix[5]}
+				gs.CTM = m.Multiply(gs.CTM)
+			}
+			formTS := *ts
+			err = traceText(formOps, formRes, gs, &formTS, idx, depth+1, marked, out)
+			if rerr := gs.Restore(); err == nil {
+				err = rerr
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			if ts.apply(op, res) {
+				continue
+			}
+			items, ok := ts.showOperands(op)
+			if !ok {
+				continue
+			}
+			mc := markedContent{mcid: -1}
+			if n := len(marked); n > 0 {
+				mc = marked[n-1]
+			}
+			space, color := gs.FillColorSpace, gs.FillColor
+			if ts.RenderMode == TextStroke || ts.RenderMode == TextStrokeClip {
+				space, color = gs.StrokeColorSpace, gs.StrokeColor
+			}
+			ts.show(items, gs.CTM, func(code []byte, trm coords.Matrix, w0 float64) {
+				descent, ascent := FontExtents(ts.Font)
+				*out = append(*out, Glyph{
+					OpIndex:    idx,
+					Code:       code,
+					Font:       ts.Font,
+					FontName:   ts.FontName,
+					FontSize:   ts.FontSize,
+					Width:      w0,
+					Matrix:     trm,
+					Origin:     trm.Transform(coords.Point{}),
+					Rect:       transformBox(semantic.Rectangle{LLY: descent, URX: w0, URY: ascent}, trm),
+					RenderMode: ts.RenderMode,
+					ColorSpace: space,
+					Color:      color,
+					MCID:       mc.mcid,
+					Artifact:   mc.artifact,
+				})
+			})
+		}
+	}
+	return nil
+}
+
+// apply updates the text state for text object, state and positioning
+// operators and reports whether op was one of them.
+func (ts *TextState) apply(op semantic.Operation, res *semantic.Resources) bool {
+	args := op.Operands
+	switch op.Operator {
+	case "BT":
+		ts.TextMatrix = coords.Identity()
+		ts.TextLineMatrix = coords.Identity()
+	case "ET":
+	case "Tf":
+		if len(args) == 2 {
+			if name, ok := args[0].(semantic.NameOperand); ok {
+				ts.FontName = name.Value
+				ts.Font = nil
+				if res != nil {
+					ts.Font = res.Fonts[name.Value]
+				}
+			}
+			ts.FontSize = operandToFloat(args[1])
+		}
+	case "Tc":
+		if len(args) == 1 {
+			ts.CharSpacing = operandToFloat(args[0])
+		}
+	case "Tw":
+		if len(args) == 1 {
+			ts.WordSpacing = operandToFloat(args[0])
+		}
+	case "Tz":
+		if len(args) == 1 {
+			ts.HorizontalScaling = operandToFloat(args[0])
+		}
+	case "TL":
+		if len(args) == 1 {
+			ts.Leading = operandToFloat(args[0])
+		}
+	case "Ts":
+		if len(args) == 1 {
+			ts.Rise = operandToFloat(args[0])
+		}
+	case "Tr":
+		if len(args) == 1 {
+			ts.RenderMode = TextRenderMode(operandToFloat(args[0]))
+		}
+	case "Td", "TD":
+		if len(args) == 2 {
+			tx, ty := operandToFloat(args[0]), operandToFloat(args[1])
+			if op.Operator == "TD" {
+				ts.Leading = -ty
+			}
+			ts.moveLine(tx, ty)
+		}
+	case "Tm":
+		if len(args) == 6 {
+			ts.TextLineMatrix = operandToMatrix(args)
+			ts.TextMatrix = ts.TextLineMatrix
+		}
+	case "T*":
+		ts.moveLine(0, -ts.Leading)
+	default:
+		return false
+	}
+	return true
+}
+
+func (ts *TextState) moveLine(tx, ty float64) {
+	ts.TextLineMatrix = coords.Translate(tx, ty).Multiply(ts.TextLineMatrix)
+	ts.TextMatrix = ts.TextLineMatrix
+}
+
+// showOperands returns the TJ-style items shown by a text-showing
+// operator, first applying the line move and spacing of ' and ".
+func (ts *TextState) showOperands(op semantic.Operation) ([]semantic.Operand, bool) {
+	args := op.Operands
+	switch op.Operator {
+	case "Tj":
+		if len(args) == 1 {
+			if _, ok := args[0].(semantic.StringOperand); ok {
+				return args, true
+			}
+		}
+	case "TJ":
+		if len(args) == 1 {
+			if arr, ok := args[0].(semantic.ArrayOperand); ok {
+				return arr.Values, true
+			}
+		}
+	case "'":
+		if len(args) == 1 {
+			ts.moveLine(0, -ts.Leading)
+			return args, true
+		}
+	case "\"":
+		if len(args) == 3 {
+			ts.WordSpacing = operandToFloat(args[0])
+			ts.CharSpacing = operandToFloat(args[1])
+			ts.moveLine(0, -ts.Leading)
+			return args[2:], true
+		}
+	}
+	return nil, false
+}
+
+// show advances the text matrix over items (strings and TJ adjustments),
+// calling visit for every glyph with its code, text rendering matrix in em
+// units and width.
+func (ts *TextState) show(items []semantic.Operand, ctm coords.Matrix, visit func(code []byte, trm coords.Matrix, w0 float64)) {
+	fs, th := ts.FontSize, ts.HorizontalScaling/100
+	for _, item := range items {
+		switch v := item.(type) {
+		case semantic.StringOperand:
+			for _, code := range charCodes(ts.Font, v.Value) {
+				c := 0
+				for _, b := range code {
+					c = c<<8 | int(b)
+				}
+				w0 := GlyphWidth(ts.Font, c)
+				if visit != nil {
+					trm := coords.Matrix{fs * th, 0, 0, fs, 0, ts.Rise}.Multiply(ts.TextMatrix).Multiply(ctm)
+					visit(code, trm, w0)
+				}
+				tx := w0*fs + ts.CharSpacing
+				if len(code) == 1 && c == 32 {
+					tx += ts.WordSpacing
+				}
+				ts.TextMatrix = coords.Translate(tx*th, 0).Multiply(ts.TextMatrix)
+			}
+		case semantic.NumberOperand:
+			ts.TextMatrix = coords.Translate(-v.Value/1000*fs*th, 0).Multiply(ts.TextMatrix)
+		}
+	}
+}
+
+// charCodes splits s into character codes. Simple fonts use one byte per
+// code; composite fonts follow the codespace ranges of an embedded CMap and
+// otherwise use two bytes as the Identity CMaps do.
+func charCodes(font *semantic.Font, s []byte) [][]byte {
+	var codes [][]byte
+	if font == nil || font.Subtype != "Type0" {
+		for i := range s {
+			codes = append(codes, s[i:i+1])
+		}
+		return codes
+	}
+	ranges := codespaceRanges(font.EncodingCMap)
+	for i := 0; i < len(s); {
+		n := 0
+		for _, r := range ranges {
+			if len(r.low) <= len(s)-i && r.contains(s[i:i+len(r.low)]) {
+				n = len(r.low)
+				break
+			}
+		}
+		if n == 0 {
+			n = min(2, len(s)-i)
+		}
+		codes = append(codes, s[i:i+n])
+		i += n
+	}
+	return codes
+}
+
+type codespaceRange struct{ low, high []byte }
+
+func (r codespaceRange) contains(code []byte) bool {
+	for i, b := range code {
+		if b < r.low[i] || b > r.high[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// codespaceRanges reads the begincodespacerange sections of a CMap.
+func codespaceRanges(cmap []byte) []codespaceRange {
+	var ranges []codespaceRange
+	for {
+		start := bytes.Index(cmap, []byte("begincodespacerange"))
+		if start < 0 {
+			return ranges
+		}
+		cmap = cmap[start+len("begincodespacerange"):]
+		end := bytes.Index(cmap, []byte("endcodespacerange"))
+		if end < 0 {
+			return ranges
+		}
+		var hexes [][]byte
+		section := cmap[:end]
+		for {
+			open := bytes.IndexByte(section, '<')
+			if open < 0 {
+				break
+			}
+			closing := bytes.IndexByte(section[open:], '>')
+			if closing < 0 {
+				break
+			}
+			hexes = append(hexes, decodeHexDigits(section[open+1:open+closing]))
+			section = section[open+closing+1:]
+		}
+		for i := 0; i+1 < len(hexes); i += 2 {
+			if len(hexes[i]) > 0 && len(hexes[i]) == len(hexes[i+1]) {
+				ranges = append(ranges, codespaceRange{low: hexes[i], high: hexes[i+1]})
+			}
+		}
+		cmap = cmap[end:]
+	}
+}
+
+func decodeHexDigits(src []byte) []byte {
+	var out []byte
+	var cur byte
+	half := false
+	for _, c := range src {
+		var v byte
+		switch {
+		case c >= '0' && c <= '9':
+			v = c - '0'
+		case c >= 'a' && c <= 'f':
+			v = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			v = c - 'A' + 10
+		default:
+			continue
+		}
+		if half {
+			out = append(out, cur<<4|v)
+		} else {
+			cur = v
+		}
+		half = !half
+	}
+	if half {
+		out = append(out, cur<<4)
+	}
+	return out
+}
+
+// GlyphWidth returns the horizontal displacement of code in font, in em
+// units. Missing widths default to half an em for simple fonts and to the
+// default width of composite fonts.
+func GlyphWidth(font *semantic.Font, code int) float64 {
+	if font == nil {
+		return 0.5
+	}
+	if w, ok := font.Widths[code]; ok {
+		if font.Subtype == "Type3" && len(font.FontMatrix) == 6 {
+			return float64(w) * font.FontMatrix[0]
+		}
+		return float64(w) / 1000
+	}
+	if font.Subtype == "Type0" {
+		if desc := font.DescendantFont; desc != nil {
+			if w, ok := desc.W[code]; ok {
+				return float64(w) / 1000
+			}
+			if desc.DW > 0 {
+				return float64(desc.DW) / 1000
+			}
+		}
+		return 1
+	}
+	return 0.5
+}
+
+// FontExtents returns the descent and ascent of font in em units, falling
+// back to typical Latin values when the font has no descriptor metrics.
+func FontExtents(font *semantic.Font) (float64, float64) {
+	if font != nil {
+		desc := font.Descriptor
+		if desc == nil && font.DescendantFont != nil {
+			desc = font.DescendantFont.Descriptor
+		}
+		if desc != nil && desc.Ascent > desc.Descent {
+			return math.Min(desc.Descent, 0) / 1000, desc.Ascent / 1000
+		}
+	}
+	return -0.25, 0.95
+}
+
+func colorOperands(args []semantic.Operand) []float64 {
+	var c []float64
+	for _, a := range args {
+		if n, ok := a.(semantic.NumberOperand); ok {
+			c = append(c, n.Value)
+		}
+	}
+	return c
+}
+
+func transformBox(r semantic.Rectangle, m coords.Matrix) semantic.Rectangle {
+	return pointsToRect(
+		m.Transform(coords.Point{X: r.LLX, Y: r.LLY}),
+		m.Transform(coords.Point{X: r.URX, Y: r.LLY}),
+		m.Transform(coords.Point{X: r.LLX, Y: r.URY}),
+		m.Transform(coords.Point{X: r.URX, Y: r.URY}),
+	)
+}
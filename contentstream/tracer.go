@@ -27,10 +27,8 @@ func (t *Tracer) Trace(ops []semantic.Operation, resources *semantic.Resources)
 	gs := &GraphicsState{
 		CTM: coords.Identity(),
 	}
-	ts := &TextState{
-		TextMatrix:     coords.Identity(),
-		TextLineMatrix: coords.Identity(),
-	}
+	ts := NewTextState()
+	var textStack []TextState
 
 	for i, op := range ops {
 		var rect semantic.Rectangle
@@ -40,64 +38,31 @@ func (t *Tracer) Trace(ops []semantic.Operation, resources *semantic.Resources)
 		// Graphics State
 		case "q":
 			gs.Save()
+			textStack = append(textStack, *ts)
 		case "Q":
 			if err := gs.Restore(); err != nil {
 				return nil, err
 			}
+			if n := len(textStack); n > 0 {
+				*ts = textStack[n-1]
+				textStack = textStack[:n-1]
+			}
 		case "cm":
 			if len(op.Operands) == 6 {
 				m := operandToMatrix(op.Operands)
 				gs.CTM = m.Multiply(gs.CTM)
 			}
 
-		// Text Objects
-		case "BT":
-			ts.TextMatrix = coords.Identity()
-			ts.TextLineMatrix = coords.Identity()
-		case "ET":
-			// End text object
-
-		// Text State
-		case "Tf":
-			if len(op.Operands) == 2 {
-				if name, ok := op.Operands[0].(semantic.NameOperand); ok {
-					if font, ok := resources.Fonts[name.Value]; ok {
-						ts.Font = font
-					}
-				}
-				if size, ok := op.Operands[1].(semantic.NumberOperand); ok {
-					ts.FontSize = size.Value
-				}
-			}
-		case "Tm":
-			if len(op.Operands) == 6 {
-				ts.TextLineMatrix = operandToMatrix(op.Operands)
-				ts.TextMatrix = ts.TextLineMatrix
-			}
-		case "Td":
-			if len(op.Operands) == 2 {
-				tx := operandToFloat(op.Operands[0])
-				ty := operandToFloat(op.Operands[1])
-				m := coords.Translate(tx, ty)
-				ts.TextLineMatrix = m.Multiply(ts.TextLineMatrix)
-				ts.TextMatrix = ts.TextLineMatrix
-			}
-
-		// Text Showing
-		case "Tj":
-			if len(op.Operands) == 1 {
-				if str, ok := op.Operands[0].(semantic.StringOperand); ok {
-					rect = calculateTextRect(str.Value, ts, gs)
-					hasRect = true
-				}
-			}
-		case "TJ":
-			if len(op.Operands) == 1 {
-				if arr, ok := op.Operands[0].(semantic.ArrayOperand); ok {
-					rect = calculateTJRect(arr.Values, ts, gs)
-					hasRect = true
-				}
+		// Text
+		case "BT", "ET", "Tf", "Tc", "Tw", "Tz", "TL", "Ts", "Tr", "Td", "TD", "Tm", "T*":
+			ts.apply(op, resources)
+		case "Tj", "TJ", "'", "\"":
+			items, ok := ts.showOperands(op)
+			if !ok || ts.Font == nil {
+				continue
 			}
+			rect = calculateTextRect(items, ts, gs)
+			hasRect = true
 
 		// Path Construction (Simplified: only 're')
 		case "re":
@@ -192,89 +157,23 @@ func operandToFloat(op semantic.Operand) float64 {
 	return 0
 }
 
-func calculateTextRect(text []byte, ts *TextState, gs *GraphicsState) semantic.Rectangle {
-	if ts.Font == nil {
+// calculateTextRect returns the box covering the glyphs of items and
+// advances the text matrix past them.
+func calculateTextRect(items []semantic.Operand, ts *TextState, gs *GraphicsState) semantic.Rectangle {
+	descent, ascent := FontExtents(ts.Font)
+	var corners []coords.Point
+	ts.show(items, gs.CTM, func(_ []byte, trm coords.Matrix, w0 float64) {
+		corners = append(corners,
+			trm.Transform(coords.Point{X: 0, Y: descent}),
+			trm.Transform(coords.Point{X: w0, Y: descent}),
+			trm.Transform(coords.Point{X: 0, Y: ascent}),
+			trm.Transform(coords.Point{X: w0, Y: ascent}),
+		)
+	})
+	if len(corners) == 0 {
 		return semantic.Rectangle{}
 	}
-
-	width := 0.0
-	// Simple width calculation (ignoring encoding issues for now, assuming 1 byte = 1 char)
-	// In reality, we need to use Font.Encoding and Font.Widths properly.
-	for _, b := range text {
-		if w, ok := ts.Font.Widths[int(b)]; ok {
-			width += float64(w)
-		} else {
-			// Default width?
-			width += 500 // Assume 500/1000 em
-		}
-	}
-
-	// Convert width from glyph space (1000 units) to text space
-	width = width / 1000.0 * ts.FontSize
-
-	// Height is font size
-	height := ts.FontSize
-
-	// Text Matrix transforms text space to user space
-	// Current point is (0,0) in text space (relative to Tm)
-	// But wait, Td/Tm updates TextMatrix.
-	// We need to apply TextMatrix then CTM.
-
-	// Text space rect: (0, 0) to (width, height) (simplified, ignoring descent)
-	// Actually, origin is usually baseline. So (0, descent) to (width, ascent).
-	// Let's assume (0, 0) to (width, height) for simplicity of "covering" the text.
-
-	// Combined Matrix: TextMatrix * CTM
-	m := ts.TextMatrix.Multiply(gs.CTM)
-
-	p1 := m.Transform(coords.Point{X: 0, Y: 0})
-	p2 := m.Transform(coords.Point{X: width, Y: 0})
-	p3 := m.Transform(coords.Point{X: 0, Y: height})
-	p4 := m.Transform(coords.Point{X: width, Y: height})
-
-	// Update TextMatrix for next glyphs (advance width)
-	// T_m = T_m * Translate(width, 0) ? No, T_m is global.
-	// The text matrix is updated by drawing text? No, only Td/Tm updates it.
-	// But subsequent Tj calls? Usually they are separate.
-	// If multiple strings in TJ, we handle them.
-
-	return pointsToRect(p1, p2, p3, p4)
-}
-
-func calculateTJRect(ops []semantic.Operand, ts *TextState, gs *GraphicsState) semantic.Rectangle {
-	// Similar to calculateTextRect but handles array of strings and numbers (kerning)
-	// For now, simplified: just sum up widths.
-	totalWidth := 0.0
-	if ts.Font == nil {
-		return semantic.Rectangle{}
-	}
-
-	for _, op := range ops {
-		if str, ok := op.(semantic.StringOperand); ok {
-			for _, b := range str.Value {
-				if w, ok := ts.Font.Widths[int(b)]; ok {
-					totalWidth += float64(w)
-				} else {
-					totalWidth += 500
-				}
-			}
-		} else if num, ok := op.(semantic.NumberOperand); ok {
-			// Kerning is in thousands of em, subtracted
-			totalWidth -= num.Value
-		}
-	}
-
-	width := totalWidth / 1000.0 * ts.FontSize
-	height := ts.FontSize
-
-	m := ts.TextMatrix.Multiply(gs.CTM)
-
-	p1 := m.Transform(coords.Point{X: 0, Y: 0})
-	p2 := m.Transform(coords.Point{X: width, Y: 0})
-	p3 := m.Transform(coords.Point{X: 0, Y: height})
-	p4 := m.Transform(coords.Point{X: width, Y: height})
-
-	return pointsToRect(p1, p2, p3, p4)
+	return pointsToRect(corners...)
 }
 
 func pointsToRect(points ...coords.Point) semantic.Rectangle {
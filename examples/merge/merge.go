@@ -5,8 +5,9 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/assemble"
 	"github.com/wudi/pdfkit/ir"
+	"github.com/wudi/pdfkit/ir/semantic"
 	"github.com/wudi/pdfkit/writer"
 )
 
@@ -19,40 +20,21 @@ func main() {
 	outputPath := os.Args[1]
 	inputPaths := os.Args[2:]
 
-	b := builder.NewBuilder()
-
+	var docs []*semantic.Document
 	for _, inputPath := range inputPaths {
 		fmt.Printf("Processing %s...\n", inputPath)
-		f, err := os.Open(inputPath)
+		doc, err := parseFile(inputPath)
 		if err != nil {
-			fmt.Printf("Error opening %s: %v\n", inputPath, err)
+			fmt.Printf("Error parsing %s: %v\n", inputPath, err)
 			os.Exit(1)
 		}
-		// We defer close, but inside a loop it's better to close explicitly or use a function.
-		// However, for a simple script, defer is okay if not too many files.
-		// But to be safe, let's wrap in a func or close manually.
-		func() {
-			defer f.Close()
-
-			// Parse the input PDF
-			pipeline := ir.NewDefault()
-			doc, err := pipeline.Parse(context.Background(), f)
-			if err != nil {
-				fmt.Printf("Error parsing %s: %v\n", inputPath, err)
-				os.Exit(1)
-			}
-
-			// Add pages to the builder
-			for _, page := range doc.Pages {
-				b.AddPage(page)
-			}
-		}()
+		docs = append(docs, doc)
 	}
 
-	// Build the new document
-	newDoc, err := b.Build()
+	// Merge the documents, keeping outlines, forms, structure and labels
+	newDoc, err := assemble.Merge(context.Background(), docs...)
 	if err != nil {
-		fmt.Printf("Error building new document: %v\n", err)
+		fmt.Printf("Error merging documents: %v\n", err)
 		os.Exit(1)
 	}
 
@@ -79,3 +61,12 @@ func main() {
 
 	fmt.Println("Done!")
 }
+
+func parseFile(path string) (*semantic.Document, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ir.NewDefault().Parse(context.Background(), f)
+}
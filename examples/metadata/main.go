@@ -8,6 +8,7 @@ import (
 	"github.com/wudi/pdfkit/builder"
 	"github.com/wudi/pdfkit/ir/semantic"
 	"github.com/wudi/pdfkit/writer"
+	"github.com/wudi/pdfkit/xmp"
 )
 
 func main() {
@@ -26,22 +27,11 @@ func main() {
 		Producer: "PDFKit",
 	})
 
-	// Set XMP Metadata (optional)
-	xmp := []byte(`<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
-<x:xmpmeta xmlns:x="adobe:ns:meta/">
-  <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
-    <rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
-      <dc:format>application/pdf</dc:format>
-      <dc:title>
-        <rdf:Alt>
-          <rdf:li xml:lang="x-default">Metadata Example</rdf:li>
-        </rdf:Alt>
-      </dc:title>
-    </rdf:Description>
-  </rdf:RDF>
-</x:xmpmeta>
-<?xpacket end="w"?>`)
-	b.SetMetadata(xmp)
+	// Set XMP Metadata (optional); the writer fills in the Info values.
+	packet := xmp.New()
+	packet.SetText(xmp.NSDC, "format", "application/pdf")
+	packet.SetLangText(xmp.NSDC, "title", "de", "Metadaten-Beispiel")
+	b.SetXMP(packet)
 
 	doc, err := b.Build()
 	if err != nil {
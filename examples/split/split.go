@@ -6,7 +6,7 @@ import (
 	"os"
 	"path/filepath"
 
-	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/assemble"
 	"github.com/wudi/pdfkit/ir"
 	"github.com/wudi/pdfkit/writer"
 )
@@ -43,23 +43,19 @@ func main() {
 
 	fmt.Printf("Found %d pages.\n", len(doc.Pages))
 
-	for i, page := range doc.Pages {
+	parts, err := assemble.SplitEvery(context.Background(), doc, 1)
+	if err != nil {
+		fmt.Printf("Error splitting document: %v\n", err)
+		os.Exit(1)
+	}
+
+	for i, newDoc := range parts {
 		pageNum := i + 1
 		outputFilename := fmt.Sprintf("page_%d.pdf", pageNum)
 		outputPath := filepath.Join(outputDir, outputFilename)
 
 		fmt.Printf("Extracting page %d to %s...\n", pageNum, outputPath)
 
-		// Create a new builder for the single page
-		b := builder.NewBuilder()
-		b.AddPage(page)
-
-		newDoc, err := b.Build()
-		if err != nil {
-			fmt.Printf("Error building document for page %d: %v\n", pageNum, err)
-			continue
-		}
-
 		// Write the single-page PDF
 		outFile, err := os.Create(outputPath)
 		if err != nil {
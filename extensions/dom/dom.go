@@ -10,6 +10,11 @@ import (
 type Adapter struct {
 	doc      *semantic.Document
 	fieldMap map[string]scripting.FormFieldProxy
+	names    []string
+
+	// AlertHandler receives the messages of app.alert. Without one they
+	// are printed.
+	AlertHandler func(message string)
 }
 
 func New(doc *semantic.Document) *Adapter {
@@ -18,13 +23,30 @@ func New(doc *semantic.Document) *Adapter {
 	return a
 }
 
+// buildFieldMap groups the widgets of the form by field name: widgets with
+// the same fully qualified name, such as the buttons of a radio group,
+// are one field.
 func (a *Adapter) buildFieldMap() {
 	a.fieldMap = make(map[string]scripting.FormFieldProxy)
+	a.names = nil
 	if a.doc.AcroForm == nil {
 		return
 	}
+	widgets := make(map[string][]semantic.FormField)
 	for _, f := range a.doc.AcroForm.Fields {
-		a.fieldMap[f.FieldName()] = NewFieldProxy(f)
+		if f == nil {
+			continue
+		}
+		name := f.FieldName()
+		if _, ok := widgets[name]; !ok {
+			a.names = append(a.names, name)
+		}
+		widgets[name] = append(widgets[name], f)
+	}
+	for _, name := range a.names {
+		p := NewFieldProxy(widgets[name][0], widgets[name][1:]...)
+		p.form = a.doc.AcroForm
+		a.fieldMap[name] = p
 	}
 }
 
@@ -43,5 +65,30 @@ func (a *Adapter) GetPage(index int) (scripting.PageProxy, error) {
 }
 
 func (a *Adapter) Alert(message string) {
+	if a.AlertHandler != nil {
+		a.AlertHandler(message)
+		return
+	}
 	fmt.Printf("JS Alert: %s\n", message)
 }
+
+func (a *Adapter) FieldNames() []string {
+	return append([]string(nil), a.names...)
+}
+
+func (a *Adapter) CalculationOrder() []string {
+	if a.doc.AcroForm == nil {
+		return nil
+	}
+	var names []string
+	for _, f := range a.doc.AcroForm.CalculationOrder {
+		if f != nil {
+			names = append(names, f.FieldName())
+		}
+	}
+	return names
+}
+
+func (a *Adapter) NumPages() int {
+	return len(a.doc.Pages)
+}
@@ -1,9 +1,11 @@
 package dom
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/scripting"
 )
 
 func TestAdapter_GetField(t *testing.T) {
@@ -52,3 +54,69 @@ func TestAdapter_GetPage(t *testing.T) {
 		t.Errorf("Expected index 1, got %d", idx)
 	}
 }
+
+func TestAdapter_RadioGroup(t *testing.T) {
+	radio := func(on string) *semantic.ButtonFormField {
+		return &semantic.ButtonFormField{BaseFormField: semantic.BaseFormField{Name: "size"}, IsRadio: true, OnState: on}
+	}
+	small, large := radio("S"), radio("L")
+	check := &semantic.ButtonFormField{BaseFormField: semantic.BaseFormField{Name: "gift"}, IsCheck: true}
+	doc := &semantic.Document{AcroForm: &semantic.AcroForm{Fields: []semantic.FormField{small, large, check}}}
+
+	adapter := New(doc)
+	if names := adapter.FieldNames(); len(names) != 2 || names[0] != "size" || names[1] != "gift" {
+		t.Fatalf("FieldNames = %v", names)
+	}
+	field, _ := adapter.GetField("size")
+	if field.Type() != scripting.FieldRadioButton || field.GetValue() != "Off" {
+		t.Fatalf("radio group = %s %v", field.Type(), field.GetValue())
+	}
+	if items := field.Items(); len(items) != 2 || items[1].Export != "L" {
+		t.Errorf("Items = %v", items)
+	}
+	field.SetValue("L")
+	if small.Checked || !large.Checked || large.AppearanceState != "L" || small.AppearanceState != "Off" {
+		t.Errorf("SetValue(L): small %v %s, large %v %s", small.Checked, small.AppearanceState, large.Checked, large.AppearanceState)
+	}
+	if field.GetValue() != "L" || !doc.AcroForm.Dirty {
+		t.Errorf("value %v, form dirty %v", field.GetValue(), doc.AcroForm.Dirty)
+	}
+
+	gift, _ := adapter.GetField("gift")
+	gift.SetValue(true)
+	if gift.GetValue() != "Yes" || !check.Checked {
+		t.Errorf("check box = %v", gift.GetValue())
+	}
+}
+
+func TestFieldProxy_Appearance(t *testing.T) {
+	field := &semantic.TextFormField{
+		BaseFormField: semantic.BaseFormField{
+			Name:              "amount",
+			Rect:              semantic.Rectangle{URX: 100, URY: 20},
+			DefaultAppearance: "/Helv 10 Tf 0 g",
+		},
+		Value: "1234.5",
+	}
+	proxy := NewFieldProxy(field)
+
+	proxy.SetColor("text", []float64{1, 0, 0})
+	if field.DefaultAppearance != "/Helv 10 Tf 1 0 0 rg" {
+		t.Errorf("DA = %q", field.DefaultAppearance)
+	}
+	if c := proxy.Color("text"); len(c) != 3 || c[0] != 1 {
+		t.Errorf("text colour = %v", c)
+	}
+	proxy.SetColor("text", []float64{1.0 / 3, 1e-9, 2})
+	if field.DefaultAppearance != "/Helv 10 Tf 0.333 0 1 rg" {
+		t.Errorf("DA = %q", field.DefaultAppearance)
+	}
+
+	proxy.SetDisplayValue("$1,234.50")
+	if field.AppearanceForm == nil || !strings.Contains(string(field.AppearanceForm.Data), "($1,234.50) Tj") {
+		t.Fatalf("appearance does not show the display value: %+v", field.AppearanceForm)
+	}
+	if field.Value != "1234.5" {
+		t.Errorf("display value replaced the value: %q", field.Value)
+	}
+}
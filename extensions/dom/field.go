@@ -1,15 +1,50 @@
 package dom
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/internal/pdfnum"
 	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/scripting"
 )
 
+// FieldProxy exposes a form field, with all its widgets, to scripts.
 type FieldProxy struct {
-	field semantic.FormField
+	field   semantic.FormField
+	widgets []semantic.FormField
+	form    *semantic.AcroForm
+}
+
+// NewFieldProxy returns a proxy for the field f. Further widgets of the
+// same field, such as the other buttons of a radio group, share its value.
+func NewFieldProxy(f semantic.FormField, widgets ...semantic.FormField) *FieldProxy {
+	return &FieldProxy{field: f, widgets: append([]semantic.FormField{f}, widgets...)}
+}
+
+func base(f semantic.FormField) *semantic.BaseFormField {
+	switch t := f.(type) {
+	case *semantic.TextFormField:
+		return &t.BaseFormField
+	case *semantic.ChoiceFormField:
+		return &t.BaseFormField
+	case *semantic.ButtonFormField:
+		return &t.BaseFormField
+	case *semantic.SignatureFormField:
+		return &t.BaseFormField
+	case *semantic.GenericFormField:
+		return &t.BaseFormField
+	}
+	return nil
 }
 
-func NewFieldProxy(f semantic.FormField) *FieldProxy {
-	return &FieldProxy{field: f}
+func onState(f *semantic.ButtonFormField) string {
+	if f.OnState != "" {
+		return f.OnState
+	}
+	return "Yes"
 }
 
 func (p *FieldProxy) GetValue() interface{} {
@@ -17,39 +52,350 @@ func (p *FieldProxy) GetValue() interface{} {
 	case *semantic.TextFormField:
 		return f.Value
 	case *semantic.ButtonFormField:
-		if f.IsCheck || f.IsRadio {
-			return f.Checked
+		if f.IsPush {
+			return ""
+		}
+		for _, w := range p.widgets {
+			if b, ok := w.(*semantic.ButtonFormField); ok && b.Checked {
+				return onState(b)
+			}
 		}
-		return f.OnState // Or caption?
+		return "Off"
 	case *semantic.ChoiceFormField:
-		if f.IsMultiSelect {
-			return f.Selected
+		if f.IsMultiSelect && len(f.Selected) > 1 {
+			return append([]string(nil), f.Selected...)
 		}
 		if len(f.Selected) > 0 {
 			return f.Selected[0]
 		}
 		return ""
+	case *semantic.GenericFormField:
+		return f.Value
 	default:
 		return nil
 	}
 }
 
+// values converts a value set by a script to strings.
+func (p *FieldProxy) values(val interface{}) []string {
+	switch v := val.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		out := make([]string, len(v))
+		for i, item := range v {
+			out[i] = fmt.Sprint(item)
+		}
+		return out
+	case bool:
+		if b, ok := p.field.(*semantic.ButtonFormField); ok && v {
+			return []string{onState(b)}
+		}
+		return []string{"Off"}
+	case float64:
+		return []string{pdfnum.Format(v, -1)}
+	case nil:
+		return nil
+	}
+	return []string{fmt.Sprint(val)}
+}
+
 func (p *FieldProxy) SetValue(val interface{}) {
-	p.field.SetDirty(true)
+	values := p.values(val)
+	first := ""
+	if len(values) > 0 {
+		first = values[0]
+	}
+	for _, w := range p.widgets {
+		w.SetDirty(true)
+		switch f := w.(type) {
+		case *semantic.TextFormField:
+			if f.Value != first {
+				f.RichValue = ""
+			}
+			f.Value = first
+		case *semantic.ButtonFormField:
+			if f.IsPush {
+				continue
+			}
+			on := first != "" && first != "Off"
+			if on && f.OnState == "" && len(p.widgets) == 1 {
+				f.OnState = first
+			}
+			f.Checked = on && onState(f) == first
+			f.AppearanceState = "Off"
+			if f.Checked {
+				f.AppearanceState = onState(f)
+			}
+		case *semantic.ChoiceFormField:
+			f.Selected = nil
+			for _, v := range values {
+				if v != "" {
+					f.Selected = append(f.Selected, v)
+				}
+			}
+		case *semantic.GenericFormField:
+			f.Value = first
+		}
+	}
+	if p.form != nil {
+		p.form.Dirty = true
+	}
+}
+
+func (p *FieldProxy) Name() string {
+	return p.field.FieldName()
+}
+
+func (p *FieldProxy) Type() string {
 	switch f := p.field.(type) {
 	case *semantic.TextFormField:
-		if s, ok := val.(string); ok {
-			f.Value = s
+		return scripting.FieldText
+	case *semantic.ButtonFormField:
+		switch {
+		case f.IsRadio:
+			return scripting.FieldRadioButton
+		case f.IsCheck:
+			return scripting.FieldCheckBox
+		}
+		return scripting.FieldButton
+	case *semantic.ChoiceFormField:
+		if f.IsCombo {
+			return scripting.FieldComboBox
+		}
+		return scripting.FieldListBox
+	case *semantic.SignatureFormField:
+		return scripting.FieldSignature
+	}
+	return ""
+}
+
+func (p *FieldProxy) Flags() int {
+	return p.field.FieldFlags()
+}
+
+func (p *FieldProxy) SetFlags(flags int) {
+	for _, w := range p.widgets {
+		w.SetFieldFlags(flags)
+		w.SetDirty(true)
+	}
+}
+
+func (p *FieldProxy) AnnotationFlags() int {
+	return p.field.GetAnnotationFlags()
+}
+
+func (p *FieldProxy) SetAnnotationFlags(flags int) {
+	for _, w := range p.widgets {
+		if b := base(w); b != nil {
+			b.AnnotationFlags = flags
+			b.Dirty = true
+		}
+	}
+}
+
+func (p *FieldProxy) Items() []scripting.FieldItem {
+	var items []scripting.FieldItem
+	switch f := p.field.(type) {
+	case *semantic.ChoiceFormField:
+		for _, o := range f.Options {
+			items = append(items, scripting.FieldItem{Display: o, Export: o})
 		}
 	case *semantic.ButtonFormField:
-		if b, ok := val.(bool); ok {
-			f.Checked = b
+		if f.IsPush {
+			return nil
+		}
+		for _, w := range p.widgets {
+			if b, ok := w.(*semantic.ButtonFormField); ok {
+				items = append(items, scripting.FieldItem{Display: onState(b), Export: onState(b)})
+			}
 		}
+	}
+	return items
+}
+
+func (p *FieldProxy) SetItems(items []scripting.FieldItem) {
+	switch f := p.field.(type) {
 	case *semantic.ChoiceFormField:
-		if s, ok := val.(string); ok {
-			f.Selected = []string{s}
-		} else if strs, ok := val.([]string); ok {
-			f.Selected = strs
+		f.Options = nil
+		for _, item := range items {
+			o := item.Export
+			if o == "" {
+				o = item.Display
+			}
+			f.Options = append(f.Options, o)
+		}
+		f.Dirty = true
+	case *semantic.ButtonFormField:
+		for i, w := range p.widgets {
+			if b, ok := w.(*semantic.ButtonFormField); ok && i < len(items) {
+				b.OnState = items[i].Export
+				b.Dirty = true
+			}
+		}
+	}
+}
+
+func (p *FieldProxy) Color(kind string) []float64 {
+	b := base(p.field)
+	if b == nil {
+		return nil
+	}
+	switch kind {
+	case "text":
+		c, _ := daColor(b.DefaultAppearance)
+		return c
+	case "fill":
+		return b.BackgroundColor
+	case "stroke":
+		return b.BorderColor
+	}
+	return nil
+}
+
+func (p *FieldProxy) SetColor(kind string, components []float64) {
+	for _, w := range p.widgets {
+		b := base(w)
+		if b == nil {
+			continue
+		}
+		c := append([]float64(nil), components...)
+		switch kind {
+		case "text":
+			b.DefaultAppearance = setDAColor(b.DefaultAppearance, c)
+		case "fill":
+			b.BackgroundColor = c
+		case "stroke":
+			b.BorderColor = c
+		}
+		b.Dirty = true
+	}
+}
+
+func (p *FieldProxy) CharLimit() int {
+	if t, ok := p.field.(*semantic.TextFormField); ok {
+		return t.MaxLen
+	}
+	return 0
+}
+
+func (p *FieldProxy) PageIndex() int {
+	return p.field.FieldPageIndex()
+}
+
+func (p *FieldProxy) Rect() [4]float64 {
+	r := p.field.FieldRect()
+	return [4]float64{r.LLX, r.LLY, r.URX, r.URY}
+}
+
+func (p *FieldProxy) Action(trigger string) string {
+	aa := p.field.GetAdditionalActions()
+	if aa == nil {
+		return ""
+	}
+	var action semantic.Action
+	switch trigger {
+	case "K":
+		action = aa.K
+	case "F":
+		action = aa.F
+	case "V":
+		action = aa.V
+	case "C":
+		action = aa.C
+	}
+	switch js := action.(type) {
+	case semantic.JavaScriptAction:
+		return js.JS
+	case *semantic.JavaScriptAction:
+		return js.JS
+	}
+	return ""
+}
+
+// SetDisplayValue regenerates the appearances of the widgets, showing text
+// in place of the value of text fields and combo boxes.
+func (p *FieldProxy) SetDisplayValue(text string) {
+	gen := builder.NewAppearanceGenerator(p.form)
+	for _, w := range p.widgets {
+		shown := w
+		switch f := w.(type) {
+		case *semantic.TextFormField:
+			if text != f.Value {
+				c := *f
+				c.Value, c.RichValue = text, ""
+				shown = &c
+			}
+		case *semantic.ChoiceFormField:
+			if f.IsCombo && (len(f.Selected) == 0 || text != f.Selected[0]) {
+				c := *f
+				c.Selected = []string{text}
+				shown = &c
+			}
+		}
+		xo, err := gen.Generate(shown)
+		if err != nil {
+			continue
+		}
+		if b := base(w); b != nil {
+			b.AppearanceForm = xo
+			b.Dirty = true
+		}
+	}
+}
+
+// daColor returns the colour set by a default appearance string.
+func daColor(da string) ([]float64, bool) {
+	tokens := strings.Fields(da)
+	for i := len(tokens) - 1; i >= 0; i-- {
+		n := colorOperands(tokens[i])
+		if n < 0 || i < n {
+			continue
+		}
+		c := make([]float64, n)
+		for j := range c {
+			v, err := strconv.ParseFloat(tokens[i-n+j], 64)
+			if err != nil {
+				return nil, false
+			}
+			c[j] = v
+		}
+		return c, true
+	}
+	return nil, false
+}
+
+// setDAColor replaces the colour of a default appearance string.
+func setDAColor(da string, c []float64) string {
+	tokens := strings.Fields(da)
+	var out []string
+	for i := 0; i < len(tokens); i++ {
+		if n := colorOperands(tokens[i]); n >= 0 && len(out) >= n {
+			out = out[:len(out)-n]
+			continue
+		}
+		out = append(out, tokens[i])
+	}
+	op := map[int]string{1: "g", 3: "rg", 4: "k"}[len(c)]
+	if op != "" {
+		for _, v := range c {
+			out = append(out, pdfnum.Format(pdfnum.Clamp01(v), 3))
 		}
+		out = append(out, op)
+	}
+	return strings.Join(out, " ")
+}
+
+func colorOperands(op string) int {
+	switch op {
+	case "g":
+		return 1
+	case "rg":
+		return 3
+	case "k":
+		return 4
 	}
+	return -1
 }
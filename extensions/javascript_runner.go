@@ -44,8 +44,17 @@ func (r *JavaScriptRunner) Transform(ctx context.Context, doc *semantic.Document
 
 	collector := &scriptCollector{}
 
-	// 1. Register DOM
-	if err := r.engine.RegisterDOM(dom.New(doc)); err != nil {
+	// 1. Register DOM. Engines that dispatch events get a form runner,
+	// which registers the DOM itself.
+	adapter := dom.New(doc)
+	var form *scripting.FormRunner
+	if events, ok := r.engine.(scripting.EventEngine); ok {
+		runner, err := scripting.NewFormRunner(events, adapter)
+		if err != nil {
+			return err
+		}
+		form = runner
+	} else if err := r.engine.RegisterDOM(adapter); err != nil {
 		return err
 	}
 
@@ -59,9 +68,18 @@ func (r *JavaScriptRunner) Transform(ctx context.Context, doc *semantic.Document
 		return err
 	}
 
-	// 4. Execute Form Calculation scripts
+	// 4. Execute Form Calculation scripts: with a form runner the form is
+	// recalculated and every field formatted, otherwise the calculate
+	// scripts run as plain scripts.
 	if doc.AcroForm != nil {
-		if err := r.executeFormScripts(ctx, doc.AcroForm, collector); err != nil {
+		if form != nil {
+			if err := form.Run(ctx); err != nil {
+				if isContextError(err) {
+					return err
+				}
+				collector.add("AcroForm", "", err)
+			}
+		} else if err := r.executeFormScripts(ctx, doc.AcroForm, collector); err != nil {
 			return err
 		}
 	}
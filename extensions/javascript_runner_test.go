@@ -113,3 +113,40 @@ func TestJavaScriptRunner_ErrorAggregation(t *testing.T) {
 		}
 	}
 }
+
+func TestJavaScriptRunner_FormProcessing(t *testing.T) {
+	field := func(name, value string, aa *semantic.AdditionalActions) *semantic.TextFormField {
+		return &semantic.TextFormField{
+			BaseFormField: semantic.BaseFormField{
+				Name:              name,
+				Rect:              semantic.Rectangle{URX: 120, URY: 20},
+				DefaultAppearance: "/Helv 10 Tf 0 g",
+				AdditionalActions: aa,
+			},
+			Value: value,
+		}
+	}
+	price := field("price", "12.5", nil)
+	qty := field("qty", "4", nil)
+	total := field("total", "", &semantic.AdditionalActions{
+		C: semantic.JavaScriptAction{JS: `AFSimple_Calculate("PRD", ["price", "qty"]);`},
+		F: semantic.JavaScriptAction{JS: `AFNumber_Format(2, 0, 0, 0, "$", true);`},
+	})
+	doc := &semantic.Document{
+		OpenAction: semantic.JavaScriptAction{JS: `this.getField("qty").value = 2;`},
+		AcroForm:   &semantic.AcroForm{Fields: []semantic.FormField{price, qty, total}},
+	}
+
+	if err := NewJavaScriptRunner(scripting.NewEngine()).Execute(context.Background(), doc); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if total.Value != "25" {
+		t.Errorf("total = %q", total.Value)
+	}
+	if total.AppearanceForm == nil || !strings.Contains(string(total.AppearanceForm.Data), "($25.00) Tj") {
+		t.Errorf("total appearance does not show the formatted value")
+	}
+	if !doc.AcroForm.Dirty || !total.Dirty {
+		t.Errorf("changes not marked dirty")
+	}
+}
@@ -3,6 +3,7 @@ package extractor
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 
@@ -30,6 +31,11 @@ func New(dec *decoded.DecodedDocument) (*Extractor, error) {
 	if dec.Raw == nil {
 		return nil, errors.New("decoded document missing raw representation")
 	}
+	// Extraction walks raw objects directly, so lazy documents are
+	// materialized first.
+	if err := dec.Raw.LoadAll(context.Background()); err != nil {
+		return nil, err
+	}
 	catalog := rootCatalog(dec.Raw)
 	if catalog == nil {
 		return nil, errors.New("pdf catalog not found in trailer")
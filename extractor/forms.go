@@ -118,6 +118,26 @@ func (e *Extractor) extractFieldNode(obj raw.Object, dict *raw.DictObj, inherite
 	// Common properties
 	base.Name, _ = stringFromDict(dict, "T")
 	base.Flags, _ = intFromObject(valueFromDict(dict, "Ff"))
+	base.AnnotationFlags, _ = intFromObject(valueFromDict(dict, "F"))
+	if mk := derefDict(e.raw, valueFromDict(dict, "MK")); mk != nil {
+		base.Rotation, _ = intFromObject(valueFromDict(mk, "R"))
+		if bc := derefArray(e.raw, valueFromDict(mk, "BC")); bc != nil {
+			base.BorderColor = extractFloatArray(bc)
+		}
+		if bg := derefArray(e.raw, valueFromDict(mk, "BG")); bg != nil {
+			base.BackgroundColor = extractFloatArray(bg)
+		}
+	}
+	if bs := derefDict(e.raw, valueFromDict(dict, "BS")); bs != nil {
+		base.BorderStyle = &semantic.BorderStyle{Width: 1}
+		if w, ok := floatFromObject(valueFromDict(bs, "W")); ok {
+			base.BorderStyle.Width = w
+		}
+		base.BorderStyle.Style, _ = nameFromDict(bs, "S")
+		if d := derefArray(e.raw, valueFromDict(bs, "D")); d != nil {
+			base.BorderStyle.Dash = extractFloatArray(d)
+		}
+	}
 	base.DefaultAppearance, _ = stringFromDict(dict, "DA")
 	if q, ok := intFromObject(valueFromDict(dict, "Q")); ok {
 		base.Quadding = q
@@ -137,6 +157,7 @@ func (e *Extractor) extractFieldNode(obj raw.Object, dict *raw.DictObj, inherite
 	case "Tx":
 		tx := &semantic.TextFormField{BaseFormField: base}
 		tx.Value, _ = stringFromObject(valueFromDict(dict, "V"))
+		tx.RichValue, _ = stringFromObject(valueFromDict(dict, "RV"))
 		tx.MaxLen, _ = intFromObject(valueFromDict(dict, "MaxLen"))
 		field = tx
 	case "Btn":
@@ -169,9 +190,8 @@ func (e *Extractor) extractFieldNode(obj raw.Object, dict *raw.DictObj, inherite
 	case "Ch":
 		ch := &semantic.ChoiceFormField{BaseFormField: base}
 		flags := base.Flags
-		if flags&(1<<17) != 0 {
-			ch.IsCombo = true
-		}
+		ch.IsCombo = flags&semantic.FieldFlagCombo != 0
+		ch.IsMultiSelect = flags&semantic.FieldFlagMultiSelect != 0
 		if optArr := derefArray(e.raw, valueFromDict(dict, "Opt")); optArr != nil {
 			for _, o := range optArr.Items {
 				if s, ok := stringFromObject(o); ok {
@@ -185,6 +205,12 @@ func (e *Extractor) extractFieldNode(obj raw.Object, dict *raw.DictObj, inherite
 		}
 		if v, ok := stringFromObject(valueFromDict(dict, "V")); ok {
 			ch.Selected = []string{v}
+		} else if arr := derefArray(e.raw, valueFromDict(dict, "V")); arr != nil {
+			for _, o := range arr.Items {
+				if s, ok := stringFromObject(o); ok {
+					ch.Selected = append(ch.Selected, s)
+				}
+			}
 		}
 		field = ch
 	case "Sig":
@@ -2,68 +2,127 @@ package extractor
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"image/png"
+	"sort"
+
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/render"
 )
 
-// ImageAsset represents an image XObject found on a page.
+// ImageAsset represents an image XObject or inline image found on a page.
 type ImageAsset struct {
-	Page             int
+	Page int
+	// ResourceName is the XObject name; inline images are named inline-1,
+	// inline-2, ... in content order.
 	ResourceName     string
 	Width            int
 	Height           int
 	BitsPerComponent int
 	ColorSpace       string
 	Filters          []string
-	Data             []byte
+	// Data holds the samples with generic filters removed. Image codecs
+	// (DCT, JPX, CCITT) stay encoded and are named in Filters.
+	Data []byte
+	// Image is the parsed image with its colour space, Decode array and
+	// masks. ToImage decodes faithfully from it when set.
+	Image  *semantic.XObject
+	Inline bool
 }
 
-// ExtractImages walks page resources and returns embedded image XObjects.
+// imageRenderer decodes image samples for ToImage and expands inline images.
+var imageRenderer = render.New(render.Options{})
+
+// ExtractImages returns the image XObjects in page resources and the inline
+// images drawn by page content streams.
 func (e *Extractor) ExtractImages() ([]ImageAsset, error) {
+	ctx := context.Background()
+	doc, err := semantic.NewBuilder().Build(ctx, e.dec)
+	if err != nil {
+		return nil, err
+	}
 	var assets []ImageAsset
-	for idx, page := range e.pages {
-		resDict := derefDict(e.raw, valueFromDict(page, "Resources"))
-		if resDict == nil {
-			continue
+	for idx, page := range doc.Pages {
+		if err := page.Load(ctx); err != nil {
+			return nil, err
+		}
+		if res := page.Resources; res != nil {
+			names := make([]string, 0, len(res.XObjects))
+			for name, xo := range res.XObjects {
+				if xo.Subtype == "Image" {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				xo := res.XObjects[name]
+				assets = append(assets, newImageAsset(idx, name, &xo, false))
+			}
 		}
-		xobjects := derefDict(e.raw, valueFromDict(resDict, "XObject"))
-		if xobjects == nil {
+		ops, err := contentstream.PageOperations(page)
+		if err != nil && len(ops) == 0 {
 			continue
 		}
-		for name, obj := range xobjects.KV {
-			data, dict, filters, ok := streamData(e.dec, obj)
-			if !ok || dict == nil {
+		n := 0
+		for _, op := range ops {
+			if op.Operator != contentstream.InlineImageOperator || len(op.Operands) == 0 {
 				continue
 			}
-			subtype, _ := nameFromDict(dict, "Subtype")
-			if subtype != "Image" {
+			inline, ok := op.Operands[0].(semantic.InlineImageOperand)
+			if !ok {
 				continue
 			}
-			width, _ := intFromObject(valueFromDict(dict, "Width"))
-			height, _ := intFromObject(valueFromDict(dict, "Height"))
-			bpc, _ := intFromObject(valueFromDict(dict, "BitsPerComponent"))
-			color, _ := nameFromDict(dict, "ColorSpace")
-			asset := ImageAsset{
-				Page:             idx,
-				ResourceName:     name,
-				Width:            width,
-				Height:           height,
-				BitsPerComponent: bpc,
-				ColorSpace:       color,
-				Filters:          filters,
-				Data:             data,
+			xo, err := imageRenderer.InlineImage(ctx, inline, page.Resources)
+			if err != nil {
+				continue
 			}
-			assets = append(assets, asset)
+			n++
+			assets = append(assets, newImageAsset(idx, fmt.Sprintf("inline-%d", n), xo, true))
 		}
 	}
 	return assets, nil
 }
 
-// ToImage converts the raw image data into a standard Go image.Image.
+func newImageAsset(page int, name string, xo *semantic.XObject, inline bool) ImageAsset {
+	asset := ImageAsset{
+		Page:             page,
+		ResourceName:     name,
+		Width:            xo.Width,
+		Height:           xo.Height,
+		BitsPerComponent: xo.BitsPerComponent,
+		Data:             xo.Data,
+		Image:            xo,
+		Inline:           inline,
+	}
+	if xo.ColorSpace != nil {
+		asset.ColorSpace = xo.ColorSpace.ColorSpaceName()
+	}
+	if xo.Filter != "" {
+		asset.Filters = []string{xo.Filter}
+	}
+	return asset
+}
+
+// ToImage converts the image into a standard Go image. Images found by
+// ExtractImages decode through their colour space, Decode array and masks
+// into an *image.NRGBA; stencil masks come back as black over transparency.
+// Hand-built assets without Image fall back to guessing the pixel layout
+// from the data length.
 func (i ImageAsset) ToImage() (image.Image, error) {
+	if i.Image != nil {
+		return imageRenderer.DecodeImage(context.Background(), i.Image)
+	}
+	return i.guessImage()
+}
+
+// guessImage interprets Data as 8-bit samples laid out as the data length
+// suggests.
+func (i ImageAsset) guessImage() (image.Image, error) {
 	if len(i.Data) == 0 {
 		return nil, errors.New("image data is empty")
 	}
@@ -0,0 +1,227 @@
+package extractor
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"testing"
+
+	"github.com/wudi/pdfkit/cmm"
+	"github.com/wudi/pdfkit/ir"
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/writer"
+)
+
+var (
+	gray = semantic.DeviceColorSpace{Name: "DeviceGray"}
+	rgb  = semantic.DeviceColorSpace{Name: "DeviceRGB"}
+)
+
+func decodeAsset(t *testing.T, xo *semantic.XObject) *image.NRGBA {
+	t.Helper()
+	img, err := ImageAsset{Width: xo.Width, Height: xo.Height, Image: xo}.ToImage()
+	if err != nil {
+		t.Fatalf("to image: %v", err)
+	}
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		t.Fatalf("image type %T", img)
+	}
+	return nrgba
+}
+
+// pixels returns the RGBA bytes of every pixel in row order.
+func pixels(img *image.NRGBA) [][4]uint8 {
+	var out [][4]uint8
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			o := img.PixOffset(x, y)
+			out = append(out, [4]uint8{img.Pix[o], img.Pix[o+1], img.Pix[o+2], img.Pix[o+3]})
+		}
+	}
+	return out
+}
+
+func near(a, b [4]uint8, tol int) bool {
+	for i := range a {
+		d := int(a[i]) - int(b[i])
+		if d < -tol || d > tol {
+			return false
+		}
+	}
+	return true
+}
+
+func TestImageAsset_ToImageColorSpaces(t *testing.T) {
+	black, white := [4]uint8{0, 0, 0, 255}, [4]uint8{255, 255, 255, 255}
+	red, blue := [4]uint8{255, 0, 0, 255}, [4]uint8{0, 0, 255, 255}
+	clear := [4]uint8{}
+	tests := []struct {
+		name string
+		xo   *semantic.XObject
+		want [][4]uint8
+	}{
+		{
+			name: "1-bit gray",
+			xo:   &semantic.XObject{Width: 3, Height: 1, BitsPerComponent: 1, ColorSpace: gray, Data: []byte{0b01000000}},
+			want: [][4]uint8{black, white, black},
+		},
+		{
+			name: "inverted decode",
+			xo:   &semantic.XObject{Width: 2, Height: 1, BitsPerComponent: 1, ColorSpace: gray, Decode: []float64{1, 0}, Data: []byte{0b01000000}},
+			want: [][4]uint8{white, black},
+		},
+		{
+			name: "16-bit RGB",
+			xo:   &semantic.XObject{Width: 1, Height: 1, BitsPerComponent: 16, ColorSpace: rgb, Data: []byte{0xff, 0xff, 0, 0, 0x80, 0}},
+			want: [][4]uint8{{255, 0, 128, 255}},
+		},
+		{
+			name: "2-bit palette",
+			xo: &semantic.XObject{Width: 3, Height: 1, BitsPerComponent: 2,
+				ColorSpace: &semantic.IndexedColorSpace{Base: rgb, Hival: 2, Lookup: []byte{255, 0, 0, 0, 0, 255, 255, 255, 255}},
+				Data:       []byte{0b00011000}},
+			want: [][4]uint8{red, blue, white},
+		},
+		{
+			name: "separation tint",
+			xo: &semantic.XObject{Width: 2, Height: 1, BitsPerComponent: 8,
+				ColorSpace: &semantic.SeparationColorSpace{Name: "Spot", Alternate: semantic.DeviceColorSpace{Name: "DeviceCMYK"},
+					TintTransform: &semantic.ExponentialFunction{BaseFunction: semantic.BaseFunction{Type: 2, Domain: []float64{0, 1}},
+						C0: []float64{0, 0, 0, 0}, C1: []float64{1, 0, 0, 0}, N: 1}},
+				Data: []byte{0, 255}},
+			want: [][4]uint8{white, {0, 255, 255, 255}},
+		},
+		{
+			name: "lab",
+			xo: &semantic.XObject{Width: 2, Height: 1, BitsPerComponent: 8, ColorSpace: semantic.DeviceColorSpace{Name: "Lab"},
+				Data: []byte{255, 128, 128, 0, 128, 128}},
+			want: [][4]uint8{white, black},
+		},
+		{
+			name: "icc based",
+			xo: &semantic.XObject{Width: 2, Height: 1, BitsPerComponent: 8,
+				ColorSpace: &semantic.ICCBasedColorSpace{N: 3, Profile: cmm.SRGBProfile().Data(), Alternate: rgb},
+				Data:       []byte{255, 0, 0, 0, 0, 255}},
+			want: [][4]uint8{red, blue},
+		},
+		{
+			name: "stencil",
+			xo:   &semantic.XObject{Width: 2, Height: 1, BitsPerComponent: 1, ImageMask: true, Data: []byte{0b01000000}},
+			want: [][4]uint8{black, clear},
+		},
+		{
+			name: "colour key",
+			xo: &semantic.XObject{Width: 3, Height: 1, BitsPerComponent: 8, ColorSpace: gray,
+				ColorKey: []int{200, 255}, Data: []byte{0, 210, 255}},
+			want: [][4]uint8{black, clear, clear},
+		},
+		{
+			name: "stencil mask",
+			xo: &semantic.XObject{Width: 2, Height: 1, BitsPerComponent: 8, ColorSpace: gray, Data: []byte{0, 255},
+				Mask: &semantic.XObject{Width: 2, Height: 1, BitsPerComponent: 1, ImageMask: true, Data: []byte{0b01000000}}},
+			want: [][4]uint8{black, {255, 255, 255, 0}},
+		},
+		{
+			name: "soft mask",
+			xo: &semantic.XObject{Width: 2, Height: 1, BitsPerComponent: 8, ColorSpace: gray, Data: []byte{0, 255},
+				SMask: &semantic.XObject{Width: 2, Height: 1, BitsPerComponent: 8, ColorSpace: gray, Data: []byte{255, 51}}},
+			want: [][4]uint8{black, {255, 255, 255, 51}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := pixels(decodeAsset(t, tc.xo))
+			if len(got) != len(tc.want) {
+				t.Fatalf("pixels = %v", got)
+			}
+			for i := range got {
+				if !near(got[i], tc.want[i], 2) {
+					t.Fatalf("pixel %d = %v, want %v (all %v)", i, got[i], tc.want[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestImageAsset_ToImageGuessesHandBuiltAssets(t *testing.T) {
+	img, err := ImageAsset{Width: 1, Height: 1, Data: []byte{0, 0, 255}}.ToImage()
+	if err != nil {
+		t.Fatalf("to image: %v", err)
+	}
+	if r, g, b, _ := img.At(0, 0).RGBA(); r != 0 || g != 0 || b != 0xffff {
+		t.Fatalf("pixel = %v", img.At(0, 0))
+	}
+}
+
+func TestExtractor_ExtractImagesWithInlineImages(t *testing.T) {
+	palette := &semantic.XObject{
+		Subtype: "Image", Width: 2, Height: 2, BitsPerComponent: 4,
+		ColorSpace: &semantic.IndexedColorSpace{Base: rgb, Hival: 1, Lookup: []byte{255, 0, 0, 0, 0, 255}},
+		ColorKey:   []int{1, 1},
+		Data:       []byte{0x01, 0x10},
+	}
+	inline := semantic.InlineImageOperand{
+		Image: semantic.DictOperand{Values: map[string]semantic.Operand{
+			"W": num(8), "H": num(1), "BPC": num(1), "CS": semantic.NameOperand{Value: "G"},
+		}},
+		Data: []byte{0x0f},
+	}
+	page := &semantic.Page{
+		MediaBox:  semantic.Rectangle{URX: 100, URY: 100},
+		Resources: &semantic.Resources{XObjects: map[string]semantic.XObject{"Im1": *palette}},
+		Contents: []semantic.ContentStream{{Operations: []semantic.Operation{
+			op("Do", semantic.NameOperand{Value: "Im1"}),
+			op("INLINE_IMAGE", inline),
+		}}},
+	}
+	var buf bytes.Buffer
+	if err := writer.NewWriter().Write(context.Background(), &semantic.Document{Pages: []*semantic.Page{page}}, &buf, writer.Config{Deterministic: true}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	doc, err := ir.NewDefault().Parse(context.Background(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	ext, err := New(doc.Decoded())
+	if err != nil {
+		t.Fatalf("extractor: %v", err)
+	}
+	assets, err := ext.ExtractImages()
+	if err != nil {
+		t.Fatalf("extract images: %v", err)
+	}
+	if len(assets) != 2 {
+		t.Fatalf("assets = %+v", assets)
+	}
+	if a := assets[0]; a.ResourceName != "Im1" || a.Inline || a.ColorSpace != "Indexed" || a.BitsPerComponent != 4 {
+		t.Fatalf("xobject asset = %+v", a)
+	}
+	img, err := assets[0].ToImage()
+	if err != nil {
+		t.Fatalf("to image: %v", err)
+	}
+	got := pixels(img.(*image.NRGBA))
+	want := [][4]uint8{{255, 0, 0, 255}, {}, {}, {255, 0, 0, 255}}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("palette pixels = %v", got)
+		}
+	}
+
+	if a := assets[1]; a.ResourceName != "inline-1" || !a.Inline || a.Width != 8 || a.BitsPerComponent != 1 {
+		t.Fatalf("inline asset = %+v", a)
+	}
+	png, err := assets[1].ToPNG()
+	if err != nil || len(png) == 0 {
+		t.Fatalf("to png: %v", err)
+	}
+	img, err = assets[1].ToImage()
+	if err != nil {
+		t.Fatalf("to image: %v", err)
+	}
+	got = pixels(img.(*image.NRGBA))
+	if got[0] != [4]uint8{0, 0, 0, 255} || got[7] != [4]uint8{255, 255, 255, 255} {
+		t.Fatalf("inline pixels = %v", got)
+	}
+}
@@ -0,0 +1,568 @@
+package extractor
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/coords"
+	"github.com/wudi/pdfkit/fonts"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// LayoutOptions tunes layout analysis. Zero values select the defaults.
+type LayoutOptions struct {
+	// WordGap is the gap between glyphs on a line, as a fraction of the
+	// font size, above which they belong to different words (default 0.15).
+	WordGap float64
+	// RunGap is the largest gap along a baseline, as a multiple of the
+	// font size, between text runs joined into one line (default 1).
+	// Wider gaps, such as column gutters, separate lines.
+	RunGap float64
+	// BlockGap is the largest vertical gap between consecutive lines of a
+	// block, as a fraction of the line height (default 0.5).
+	BlockGap float64
+	// IgnoreStructure orders tagged pages geometrically instead of by
+	// their structure tree.
+	IgnoreStructure bool
+}
+
+func (o LayoutOptions) withDefaults() LayoutOptions {
+	if o.WordGap <= 0 {
+		o.WordGap = 0.15
+	}
+	if o.RunGap <= 0 {
+		o.RunGap = 1
+	}
+	if o.BlockGap <= 0 {
+		o.BlockGap = 0.5
+	}
+	return o
+}
+
+// TextGlyph is a positioned glyph. Coordinates are in the page's default
+// user space (before /Rotate is applied).
+type TextGlyph struct {
+	Text       string
+	BBox       semantic.Rectangle
+	Origin     coords.Point
+	Font       string  // base font name, or the resource name when unknown
+	FontSize   float64 // size in user space, including text and CTM scaling
+	ColorSpace string
+	Color      []float64
+	Rotation   float64 // baseline angle in degrees, counter-clockwise
+	MCID       int     // marked-content identifier, -1 when untagged
+}
+
+// TextWord is a run of glyphs without whitespace between them.
+type TextWord struct {
+	Text       string
+	BBox       semantic.Rectangle
+	Font       string
+	FontSize   float64
+	ColorSpace string
+	Color      []float64
+	Rotation   float64
+	Glyphs     []TextGlyph
+}
+
+// TextLine is a sequence of words sharing a baseline.
+type TextLine struct {
+	Text     string
+	BBox     semantic.Rectangle
+	Rotation float64
+	Words    []TextWord
+}
+
+// TextBlock is a group of consecutive lines, such as a paragraph.
+type TextBlock struct {
+	Text  string
+	BBox  semantic.Rectangle
+	Lines []TextLine
+}
+
+// PageLayout is the text of a page organised into blocks in reading order.
+type PageLayout struct {
+	Page     int
+	Label    string
+	MediaBox semantic.Rectangle
+	Rotate   int
+	Blocks   []TextBlock
+}
+
+// Text returns the page text in reading order, one line per line and
+// blocks separated by blank lines.
+func (p PageLayout) Text() string {
+	parts := make([]string, len(p.Blocks))
+	for i, b := range p.Blocks {
+		parts[i] = b.Text
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// ExtractLayout returns the positioned text of every page.
+func (e *Extractor) ExtractLayout(opts LayoutOptions) ([]PageLayout, error) {
+	doc, err := semantic.NewBuilder().Build(context.Background(), e.dec)
+	if err != nil {
+		return nil, err
+	}
+	layouts, err := AnalyzeLayout(context.Background(), doc, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range layouts {
+		layouts[i].Label = e.pageLabels[layouts[i].Page]
+	}
+	return layouts, nil
+}
+
+// AnalyzeLayout returns the positioned text of every page of doc. Glyph
+// positions follow the text state exactly as contentstream.Tracer computes
+// them; glyphs are grouped into words, lines and blocks, and blocks are put
+// in reading order by their position in the structure tree when the page is
+// tagged, and by recursive whitespace cuts (columns first) otherwise.
+func AnalyzeLayout(ctx context.Context, doc *semantic.Document, opts LayoutOptions) ([]PageLayout, error) {
+	if doc == nil {
+		return nil, errors.New("document is required")
+	}
+	opts = opts.withDefaults()
+	dec := newGlyphDecoder()
+	out := make([]PageLayout, 0, len(doc.Pages))
+	for idx, page := range doc.Pages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := page.Load(ctx); err != nil {
+			return nil, err
+		}
+		ops, err := contentstream.PageOperations(page)
+		if err != nil && len(ops) == 0 {
+			return nil, err
+		}
+		glyphs, err := contentstream.NewTracer().TraceText(ops, page.Resources)
+		if err != nil {
+			return nil, err
+		}
+		var order map[int]int
+		if !opts.IgnoreStructure && doc.StructTree != nil {
+			order = structureOrder(doc.StructTree, page)
+		}
+		out = append(out, PageLayout{
+			Page:     idx,
+			MediaBox: page.MediaBox,
+			Rotate:   page.Rotate,
+			Blocks:   layoutGlyphs(glyphs, dec, order, opts),
+		})
+	}
+	return out, nil
+}
+
+// placedGlyph is a glyph expressed in the frame of its baseline: u runs
+// along the baseline and v across it.
+type placedGlyph struct {
+	TextGlyph
+	rot      int // rotation rounded to whole degrees
+	u0, u1   float64
+	v        float64 // baseline
+	vlo, vhi float64 // descent and ascent
+	size     float64
+	space    bool
+	seq      int
+}
+
+// lineGroup is a set of glyphs sharing a baseline.
+type lineGroup struct {
+	rot      int
+	glyphs   []*placedGlyph
+	u0, u1   float64
+	vlo, vhi float64
+	size     float64
+}
+
+func (l *lineGroup) add(g *placedGlyph) {
+	if len(l.glyphs) == 0 {
+		l.rot, l.u0, l.u1, l.vlo, l.vhi, l.size = g.rot, g.u0, g.u1, g.vlo, g.vhi, g.size
+	} else {
+		l.u0, l.u1 = math.Min(l.u0, g.u0), math.Max(l.u1, g.u1)
+		l.vlo, l.vhi = math.Min(l.vlo, g.vlo), math.Max(l.vhi, g.vhi)
+		l.size = math.Max(l.size, g.size)
+	}
+	l.glyphs = append(l.glyphs, g)
+}
+
+func (l *lineGroup) merge(o *lineGroup) {
+	for _, g := range o.glyphs {
+		l.add(g)
+	}
+}
+
+// sameBaseline reports whether the vertical extents of a and b overlap by
+// at least half of the smaller one.
+func sameBaseline(alo, ahi, blo, bhi float64) bool {
+	overlap := math.Min(ahi, bhi) - math.Max(alo, blo)
+	return overlap > 0 && overlap >= 0.5*math.Min(ahi-alo, bhi-blo)
+}
+
+// frame returns the unit vectors along and across a baseline at rot degrees.
+func frame(rot int) (coords.Point, coords.Point) {
+	a := float64(rot) * math.Pi / 180
+	c, s := math.Cos(a), math.Sin(a)
+	return coords.Point{X: c, Y: s}, coords.Point{X: -s, Y: c}
+}
+
+func dot(p, d coords.Point) float64 { return p.X*d.X + p.Y*d.Y }
+
+func layoutGlyphs(glyphs []contentstream.Glyph, dec *glyphDecoder, order map[int]int, opts LayoutOptions) []TextBlock {
+	placed := placeGlyphs(glyphs, dec)
+	if len(placed) == 0 {
+		return nil
+	}
+
+	// Runs follow content order: a glyph continues the previous run when it
+	// sits on the same baseline just after it.
+	var runs []*lineGroup
+	for _, g := range placed {
+		if n := len(runs); n > 0 {
+			r := runs[n-1]
+			gap := g.u0 - r.u1
+			if r.rot == g.rot && sameBaseline(r.vlo, r.vhi, g.vlo, g.vhi) &&
+				gap >= -0.5*g.size && gap <= opts.RunGap*math.Max(g.size, r.size) {
+				r.add(g)
+				continue
+			}
+		}
+		r := &lineGroup{}
+		r.add(g)
+		runs = append(runs, r)
+	}
+
+	// Runs drawn out of order (table cells, kerning done with separate
+	// operators) are joined with the nearby runs on their baseline.
+	sort.SliceStable(runs, func(i, j int) bool {
+		if runs[i].rot != runs[j].rot {
+			return runs[i].rot < runs[j].rot
+		}
+		return runs[i].vhi > runs[j].vhi
+	})
+	var lines []*lineGroup
+	for _, r := range runs {
+		joined := false
+		for _, l := range lines {
+			if l.rot != r.rot || !sameBaseline(l.vlo, l.vhi, r.vlo, r.vhi) {
+				continue
+			}
+			gap := math.Max(r.u0-l.u1, l.u0-r.u1)
+			if gap <= opts.RunGap*math.Max(l.size, r.size) {
+				l.merge(r)
+				joined = true
+				break
+			}
+		}
+		if !joined {
+			lines = append(lines, r)
+		}
+	}
+
+	var built []*blockGroup
+	sort.SliceStable(lines, func(i, j int) bool {
+		if lines[i].rot != lines[j].rot {
+			return lines[i].rot < lines[j].rot
+		}
+		return lines[i].vhi > lines[j].vhi
+	})
+	for _, l := range lines {
+		line, ok := buildLine(l, opts)
+		if !ok {
+			continue
+		}
+		var target *blockGroup
+		for _, b := range built {
+			if b.continues(l, opts) {
+				target = b
+				break
+			}
+		}
+		if target == nil {
+			target = &blockGroup{rank: -1}
+			built = append(built, target)
+		}
+		target.Lines = append(target.Lines, line)
+		target.last = l
+		for _, g := range l.glyphs {
+			if r, ok := order[g.MCID]; ok && g.MCID >= 0 && (target.rank < 0 || r < target.rank) {
+				target.rank = r
+			}
+		}
+	}
+	for _, b := range built {
+		b.finish()
+	}
+	return readingOrder(built)
+}
+
+// placeGlyphs decodes glyphs and expresses them in their baseline frame, in
+// content order.
+func placeGlyphs(glyphs []contentstream.Glyph, dec *glyphDecoder) []*placedGlyph {
+	var placed []*placedGlyph
+	for i, g := range glyphs {
+		text := dec.text(g.Font, g.Code)
+		if text == "" {
+			continue
+		}
+		m := g.Matrix
+		size := math.Hypot(m[2], m[3])
+		if size == 0 || math.IsNaN(size) || math.IsInf(size, 0) {
+			continue
+		}
+		rotation := math.Atan2(m[1], m[0]) * 180 / math.Pi
+		if rotation < 0 {
+			rotation += 360
+		}
+		rot := int(math.Round(rotation)) % 360
+		along, across := frame(rot)
+		end := m.Transform(coords.Point{X: g.Width})
+		u0, u1 := dot(g.Origin, along), dot(end, along)
+		if u1 < u0 {
+			u0, u1 = u1, u0
+		}
+		descent, ascent := contentstream.FontExtents(g.Font)
+		v := dot(g.Origin, across)
+		font := g.FontName
+		if g.Font != nil && g.Font.BaseFont != "" {
+			font = g.Font.BaseFont
+		}
+		placed = append(placed, &placedGlyph{
+			TextGlyph: TextGlyph{
+				Text:       text,
+				BBox:       g.Rect,
+				Origin:     g.Origin,
+				Font:       font,
+				FontSize:   size,
+				ColorSpace: g.ColorSpace,
+				Color:      g.Color,
+				Rotation:   rotation,
+				MCID:       g.MCID,
+			},
+			rot:   rot,
+			u0:    u0,
+			u1:    u1,
+			v:     v,
+			vlo:   v + descent*size,
+			vhi:   v + ascent*size,
+			size:  size,
+			space: strings.TrimSpace(text) == "",
+			seq:   i,
+		})
+	}
+	return placed
+}
+
+// buildLine splits a line group into words and reports whether it holds
+// any visible text.
+func buildLine(l *lineGroup, opts LayoutOptions) (TextLine, bool) {
+	glyphs := append([]*placedGlyph(nil), l.glyphs...)
+	sort.SliceStable(glyphs, func(i, j int) bool {
+		if glyphs[i].u0 != glyphs[j].u0 {
+			return glyphs[i].u0 < glyphs[j].u0
+		}
+		return glyphs[i].seq < glyphs[j].seq
+	})
+
+	var words [][]*placedGlyph
+	var cur []*placedGlyph
+	var prev *placedGlyph
+	flush := func() {
+		if len(cur) > 0 {
+			words = append(words, cur)
+			cur = nil
+		}
+	}
+	for _, g := range glyphs {
+		if g.space {
+			flush()
+			prev = nil
+			continue
+		}
+		if prev != nil {
+			// Overprinted duplicates simulate bold text.
+			if g.Text == prev.Text && math.Abs(g.u0-prev.u0) < 0.1*g.size && math.Abs(g.v-prev.v) < 0.1*g.size {
+				continue
+			}
+			if g.u0-prev.u1 > opts.WordGap*math.Max(g.size, prev.size) {
+				flush()
+			}
+		}
+		cur = append(cur, g)
+		prev = g
+	}
+	flush()
+	if len(words) == 0 {
+		return TextLine{}, false
+	}
+
+	line := TextLine{Rotation: words[0][0].Rotation}
+	texts := make([]string, len(words))
+	for i, w := range words {
+		word := TextWord{
+			Font:       w[0].Font,
+			FontSize:   w[0].FontSize,
+			ColorSpace: w[0].ColorSpace,
+			Color:      w[0].Color,
+			Rotation:   w[0].Rotation,
+			BBox:       w[0].BBox,
+		}
+		var sb strings.Builder
+		for _, g := range w {
+			sb.WriteString(g.Text)
+			word.BBox = unionRect(word.BBox, g.BBox)
+			word.Glyphs = append(word.Glyphs, g.TextGlyph)
+		}
+		word.Text = sb.String()
+		texts[i] = word.Text
+		if i == 0 {
+			line.BBox = word.BBox
+		} else {
+			line.BBox = unionRect(line.BBox, word.BBox)
+		}
+		line.Words = append(line.Words, word)
+	}
+	line.Text = strings.Join(texts, " ")
+	return line, true
+}
+
+// blockGroup collects the lines of a block while they are being built.
+type blockGroup struct {
+	TextBlock
+	last *lineGroup
+	rank int // earliest structure position of its content, -1 when untagged
+}
+
+// continues reports whether l, the next line down, belongs to the block:
+// it must share the rotation and a similar font size, overlap the previous
+// line horizontally and follow it closely.
+func (b *blockGroup) continues(l *lineGroup, opts LayoutOptions) bool {
+	p := b.last
+	if p.rot != l.rot {
+		return false
+	}
+	if ratio := math.Max(p.size, l.size) / math.Min(p.size, l.size); ratio > 1.3 {
+		return false
+	}
+	if math.Min(p.u1, l.u1)-math.Max(p.u0, l.u0) <= 0 {
+		return false
+	}
+	h := math.Max(p.vhi-p.vlo, l.vhi-l.vlo)
+	gap := p.vlo - l.vhi
+	return gap >= -0.5*h && gap <= opts.BlockGap*h
+}
+
+func (b *blockGroup) finish() {
+	texts := make([]string, len(b.Lines))
+	for i, l := range b.Lines {
+		texts[i] = l.Text
+		if i == 0 {
+			b.BBox = l.BBox
+		} else {
+			b.BBox = unionRect(b.BBox, l.BBox)
+		}
+	}
+	b.Text = strings.Join(texts, "\n")
+}
+
+func unionRect(a, b semantic.Rectangle) semantic.Rectangle {
+	return semantic.Rectangle{
+		LLX: math.Min(a.LLX, b.LLX), LLY: math.Min(a.LLY, b.LLY),
+		URX: math.Max(a.URX, b.URX), URY: math.Max(a.URY, b.URY),
+	}
+}
+
+// glyphDecoder maps character codes to Unicode text, caching the tables
+// derived from each font.
+type glyphDecoder struct {
+	cmaps     map[*semantic.Font]*toUnicodeMap
+	encodings map[*semantic.Font]*[256]string
+}
+
+func newGlyphDecoder() *glyphDecoder {
+	return &glyphDecoder{
+		cmaps:     make(map[*semantic.Font]*toUnicodeMap),
+		encodings: make(map[*semantic.Font]*[256]string),
+	}
+}
+
+// text returns the Unicode text of code in font: from its ToUnicode CMap
+// when present, then from the glyph names of a simple font's encoding.
+func (d *glyphDecoder) text(font *semantic.Font, code []byte) string {
+	if font == nil {
+		return latin1(code)
+	}
+	cm, ok := d.cmaps[font]
+	if !ok {
+		if len(font.ToUnicodeCMap) > 0 {
+			cm = parseToUnicodeCMap(font.ToUnicodeCMap)
+		}
+		d.cmaps[font] = cm
+	}
+	if cm != nil {
+		if s, ok := cm.entries[string(code)]; ok {
+			return s
+		}
+	}
+	c := 0
+	for _, b := range code {
+		c = c<<8 | int(b)
+	}
+	if runes, ok := font.ToUnicode[c]; ok {
+		return string(runes)
+	}
+	if font.Subtype == "Type0" {
+		if strings.Contains(font.Encoding, "UCS2") || strings.Contains(font.Encoding, "UTF16") {
+			return decodeUTF16BE(code)
+		}
+		return string(unicode.ReplacementChar)
+	}
+	names := d.encoding(font)
+	if name := names[code[0]]; name != "" {
+		if r, ok := fonts.GlyphNameToRune(name); ok {
+			return string(r)
+		}
+	}
+	return latin1(code)
+}
+
+// encoding returns the glyph names of a simple font's encoding.
+func (d *glyphDecoder) encoding(font *semantic.Font) *[256]string {
+	if names, ok := d.encodings[font]; ok {
+		return names
+	}
+	base := font.Encoding
+	if font.EncodingDict != nil && font.EncodingDict.BaseEncoding != "" {
+		base = font.EncodingDict.BaseEncoding
+	}
+	table, ok := fonts.NamedEncoding(base)
+	if !ok {
+		table = &fonts.StandardEncoding
+	}
+	names := [256]string(*table)
+	if font.EncodingDict != nil {
+		for _, diff := range font.EncodingDict.Differences {
+			if diff.Code >= 0 && diff.Code < 256 {
+				names[diff.Code] = diff.Name
+			}
+		}
+	}
+	d.encodings[font] = &names
+	return &names
+}
+
+func latin1(code []byte) string {
+	runes := make([]rune, len(code))
+	for i, b := range code {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
@@ -0,0 +1,141 @@
+package extractor
+
+import (
+	"math"
+	"sort"
+
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// readingOrder sorts blocks geometrically and then, when some of them are
+// tagged, moves the tagged blocks into structure order within the slots
+// they occupy so untagged content (artifacts such as running heads) keeps
+// its geometric place.
+func readingOrder(blocks []*blockGroup) []TextBlock {
+	ordered := xyCut(blocks)
+	var ranked []*blockGroup
+	for _, b := range ordered {
+		if b.rank >= 0 {
+			ranked = append(ranked, b)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].rank < ranked[j].rank })
+	out := make([]TextBlock, len(ordered))
+	next := 0
+	for i, b := range ordered {
+		if b.rank >= 0 {
+			b = ranked[next]
+			next++
+		}
+		out[i] = b.TextBlock
+	}
+	return out
+}
+
+// xyCut orders blocks by recursively splitting them at whitespace that
+// crosses the whole group: at vertical gutters first, so columns are read
+// one after another, then at horizontal gaps, widest first.
+func xyCut(blocks []*blockGroup) []*blockGroup {
+	if len(blocks) <= 1 {
+		return blocks
+	}
+	if groups := splitAtGaps(blocks, func(r semantic.Rectangle) (float64, float64) { return r.LLX, r.URX }); len(groups) > 1 {
+		return cutGroups(groups)
+	}
+	groups := splitAtGaps(blocks, func(r semantic.Rectangle) (float64, float64) { return -r.URY, -r.LLY })
+	if len(groups) > 1 {
+		return cutGroups(groups)
+	}
+	out := append([]*blockGroup(nil), blocks...)
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i].BBox, out[j].BBox
+		if a.URY != b.URY {
+			return a.URY > b.URY
+		}
+		return a.LLX < b.LLX
+	})
+	return out
+}
+
+func cutGroups(groups [][]*blockGroup) []*blockGroup {
+	var out []*blockGroup
+	for _, g := range groups {
+		out = append(out, xyCut(g)...)
+	}
+	return out
+}
+
+// splitAtGaps projects blocks onto an axis and splits them at the gaps in
+// the projection that are at least half as wide as the widest one. Groups
+// are returned in increasing axis order.
+func splitAtGaps(blocks []*blockGroup, span func(semantic.Rectangle) (float64, float64)) [][]*blockGroup {
+	sorted := append([]*blockGroup(nil), blocks...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, _ := span(sorted[i].BBox)
+		b, _ := span(sorted[j].BBox)
+		return a < b
+	})
+	type gap struct {
+		at    int // index of the first block after the gap
+		width float64
+	}
+	var gaps []gap
+	widest := 0.0
+	_, end := span(sorted[0].BBox)
+	for i := 1; i < len(sorted); i++ {
+		lo, hi := span(sorted[i].BBox)
+		if w := lo - end; w > 0 {
+			gaps = append(gaps, gap{at: i, width: w})
+			widest = math.Max(widest, w)
+		}
+		end = math.Max(end, hi)
+	}
+	var groups [][]*blockGroup
+	start := 0
+	for _, g := range gaps {
+		if g.width >= widest/2 {
+			groups = append(groups, sorted[start:g.at])
+			start = g.at
+		}
+	}
+	return append(groups, sorted[start:])
+}
+
+// structureOrder returns the position of each marked-content sequence of
+// page in a depth-first walk of the structure tree.
+func structureOrder(tree *semantic.StructureTree, page *semantic.Page) map[int]int {
+	order := make(map[int]int)
+	var walk func(elem *semantic.StructureElement, pg *semantic.Page)
+	walk = func(elem *semantic.StructureElement, pg *semantic.Page) {
+		if elem.Pg != nil {
+			pg = elem.Pg
+		}
+		for _, item := range elem.K {
+			switch {
+			case item.Element != nil:
+				walk(item.Element, pg)
+			case item.MCR != nil:
+				p := item.MCR.Pg
+				if p == nil {
+					p = pg
+				}
+				if _, seen := order[item.MCR.MCID]; p == page && !seen {
+					order[item.MCR.MCID] = len(order)
+				}
+			case item.MCID >= 0:
+				if _, seen := order[item.MCID]; pg == page && !seen {
+					order[item.MCID] = len(order)
+				}
+			}
+		}
+	}
+	for _, elem := range tree.K {
+		if elem != nil {
+			walk(elem, nil)
+		}
+	}
+	if len(order) == 0 {
+		return nil
+	}
+	return order
+}
@@ -0,0 +1,215 @@
+package extractor
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/ir"
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/writer"
+)
+
+func num(v float64) semantic.Operand { return semantic.NumberOperand{Value: v} }
+
+func op(operator string, operands ...semantic.Operand) semantic.Operation {
+	return semantic.Operation{Operator: operator, Operands: operands}
+}
+
+func str(s string) semantic.Operand { return semantic.StringOperand{Value: []byte(s)} }
+
+// textAt shows s with its baseline starting at (x, y).
+func textAt(x, y float64, s string) []semantic.Operation {
+	return []semantic.Operation{
+		op("Tm", num(1), num(0), num(0), num(1), num(x), num(y)),
+		op("Tj", str(s)),
+	}
+}
+
+// monoPage returns a page using a font whose glyphs are half an em wide.
+func monoPage(ops ...semantic.Operation) *semantic.Page {
+	widths := make(map[int]int)
+	for c := 32; c < 127; c++ {
+		widths[c] = 500
+	}
+	font := &semantic.Font{Subtype: "Type1", BaseFont: "Courier", Encoding: "WinAnsiEncoding", Widths: widths}
+	return &semantic.Page{
+		MediaBox:  semantic.Rectangle{URX: 612, URY: 792},
+		Resources: &semantic.Resources{Fonts: map[string]*semantic.Font{"F1": font}},
+		Contents:  []semantic.ContentStream{{Operations: ops}},
+	}
+}
+
+func analyze(t *testing.T, doc *semantic.Document, opts LayoutOptions) PageLayout {
+	t.Helper()
+	layouts, err := AnalyzeLayout(context.Background(), doc, opts)
+	if err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+	if len(layouts) != 1 {
+		t.Fatalf("layouts = %d", len(layouts))
+	}
+	return layouts[0]
+}
+
+func TestAnalyzeLayout_GlyphGeometry(t *testing.T) {
+	page := monoPage(
+		op("cm", num(2), num(0), num(0), num(2), num(0), num(0)),
+		op("BT"),
+		op("Tf", semantic.NameOperand{Value: "F1"}, num(10)),
+		op("rg", num(1), num(0), num(0)),
+		op("Tc", num(1)),
+		op("Td", num(50), num(100)),
+		op("Tj", str("AB")),
+		op("ET"),
+	)
+	layout := analyze(t, &semantic.Document{Pages: []*semantic.Page{page}}, LayoutOptions{})
+	if len(layout.Blocks) != 1 || len(layout.Blocks[0].Lines) != 1 || len(layout.Blocks[0].Lines[0].Words) != 1 {
+		t.Fatalf("layout = %+v", layout)
+	}
+	word := layout.Blocks[0].Lines[0].Words[0]
+	if word.Text != "AB" || word.Font != "Courier" || word.FontSize != 20 || word.ColorSpace != "DeviceRGB" {
+		t.Fatalf("word = %+v", word)
+	}
+	// Glyphs advance 6pt (5pt + 1pt spacing) in user space, doubled by the CTM.
+	b := word.Glyphs[1]
+	if b.Origin.X != 112 || b.Origin.Y != 200 {
+		t.Errorf("second glyph origin = %+v", b.Origin)
+	}
+	want := semantic.Rectangle{LLX: 112, LLY: 195, URX: 122, URY: 219}
+	if b.BBox != want {
+		t.Errorf("second glyph box = %+v, want %+v", b.BBox, want)
+	}
+}
+
+func TestAnalyzeLayout_WordsAndRotation(t *testing.T) {
+	page := monoPage(
+		op("BT"),
+		op("Tf", semantic.NameOperand{Value: "F1"}, num(10)),
+		op("Td", num(100), num(700)),
+		// A 300-unit gap separates words; 50 units is kerning.
+		op("TJ", semantic.ArrayOperand{Values: []semantic.Operand{str("Ke"), num(50), str("rn"), num(-300), str("gap"), str(" "), str("end")}}),
+		op("Tm", num(0), num(1), num(-1), num(0), num(300), num(100)),
+		op("Tj", str("Up")),
+		op("ET"),
+	)
+	layout := analyze(t, &semantic.Document{Pages: []*semantic.Page{page}}, LayoutOptions{})
+	var lines []TextLine
+	for _, b := range layout.Blocks {
+		lines = append(lines, b.Lines...)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("lines = %+v", lines)
+	}
+	var words []string
+	for _, w := range lines[0].Words {
+		words = append(words, w.Text)
+	}
+	if strings.Join(words, "|") != "Kern|gap|end" {
+		t.Errorf("words = %q", words)
+	}
+	up := lines[1]
+	if up.Text != "Up" || up.Rotation != 90 {
+		t.Errorf("rotated line = %q at %v degrees", up.Text, up.Rotation)
+	}
+	// Ascenders point towards -x; descenders cross the baseline at x = 300.
+	if want := (semantic.Rectangle{LLX: 290.5, LLY: 100, URX: 302.5, URY: 110}); up.BBox != want {
+		t.Errorf("rotated box = %+v", up.BBox)
+	}
+}
+
+func TestAnalyzeLayout_Columns(t *testing.T) {
+	ops := []semantic.Operation{op("BT"), op("Tf", semantic.NameOperand{Value: "F1"}, num(20))}
+	ops = append(ops, textAt(72, 720, "A Two Column Title Spanning The Page")...)
+	ops = append(ops, op("Tf", semantic.NameOperand{Value: "F1"}, num(10)))
+	// Rows are drawn across both columns, as table-like producers do.
+	left := []string{"left one", "left two", "left three"}
+	right := []string{"right one", "right two", "right three"}
+	for i := range left {
+		y := 650 - float64(i)*12
+		ops = append(ops, textAt(72, y, left[i])...)
+		ops = append(ops, textAt(320, y, right[i])...)
+	}
+	ops = append(ops, textAt(72, 40, "footer")...)
+	ops = append(ops, op("ET"))
+
+	layout := analyze(t, &semantic.Document{Pages: []*semantic.Page{monoPage(ops...)}}, LayoutOptions{})
+	want := "A Two Column Title Spanning The Page\n\n" +
+		"left one\nleft two\nleft three\n\n" +
+		"right one\nright two\nright three\n\n" +
+		"footer"
+	if got := layout.Text(); got != want {
+		t.Errorf("text =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestAnalyzeLayout_StructureOrder(t *testing.T) {
+	mc := func(id int, x, y float64, s string) []semantic.Operation {
+		ops := []semantic.Operation{op("BDC", semantic.NameOperand{Value: "P"}, semantic.DictOperand{Values: map[string]semantic.Operand{"MCID": num(float64(id))}})}
+		ops = append(ops, textAt(x, y, s)...)
+		return append(ops, op("EMC"))
+	}
+	ops := []semantic.Operation{op("BT"), op("Tf", semantic.NameOperand{Value: "F1"}, num(10))}
+	ops = append(ops, mc(0, 72, 400, "second on page")...)
+	ops = append(ops, mc(1, 72, 600, "first on page")...)
+	ops = append(ops, op("BMC", semantic.NameOperand{Value: "Artifact"}))
+	ops = append(ops, textAt(72, 750, "running head")...)
+	ops = append(ops, op("EMC"), op("ET"))
+	page := monoPage(ops...)
+
+	// The structure reads MCID 0 before MCID 1.
+	para := func(id int) *semantic.StructureElement {
+		return &semantic.StructureElement{S: "P", Pg: page, K: []semantic.StructureItem{{MCID: id}}}
+	}
+	doc := &semantic.Document{
+		Pages:      []*semantic.Page{page},
+		StructTree: &semantic.StructureTree{K: []*semantic.StructureElement{para(0), para(1)}},
+	}
+	if got, want := analyze(t, doc, LayoutOptions{}).Text(), "running head\n\nsecond on page\n\nfirst on page"; got != want {
+		t.Errorf("tagged order = %q, want %q", got, want)
+	}
+	if got, want := analyze(t, doc, LayoutOptions{IgnoreStructure: true}).Text(), "running head\n\nfirst on page\n\nsecond on page"; got != want {
+		t.Errorf("geometric order = %q, want %q", got, want)
+	}
+}
+
+func TestExtractor_ExtractLayout(t *testing.T) {
+	b := builder.NewBuilder()
+	b.NewPage(300, 300).
+		DrawText("Lower", 50, 100, builder.TextOptions{FontSize: 12}).
+		DrawText("Upper", 50, 200, builder.TextOptions{FontSize: 12}).
+		Finish()
+	built, err := b.Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := writer.NewWriter().Write(context.Background(), built, &buf, writer.Config{Deterministic: true}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	doc, err := ir.NewDefault().Parse(context.Background(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	ext, err := New(doc.Decoded())
+	if err != nil {
+		t.Fatalf("extractor: %v", err)
+	}
+	layouts, err := ext.ExtractLayout(LayoutOptions{})
+	if err != nil {
+		t.Fatalf("layout: %v", err)
+	}
+	if len(layouts) != 1 {
+		t.Fatalf("layouts = %+v", layouts)
+	}
+	if got := layouts[0].Text(); got != "Upper\n\nLower" {
+		t.Fatalf("text = %q", got)
+	}
+	upper := layouts[0].Blocks[0].Lines[0].Words[0]
+	if math.Abs(upper.BBox.LLX-50) > 1e-6 || upper.BBox.LLY > 200 || upper.BBox.URY < 200+12*0.7 || upper.FontSize != 12 {
+		t.Errorf("word = %+v", upper)
+	}
+}
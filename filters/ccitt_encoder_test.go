@@ -0,0 +1,87 @@
+package filters
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+// bilevelPage draws a packed 1-bit image (0 black) mixing noise, glyph-like
+// marks that repeat and long runs.
+func bilevelPage(width, height int, seed int64) []byte {
+	rng := rand.New(rand.NewSource(seed))
+	stride := (width + 7) / 8
+	data := make([]byte, stride*height)
+	for i := range data {
+		data[i] = 0xFF
+	}
+	set := func(x, y int) {
+		if x >= 0 && y >= 0 && x < width && y < height {
+			data[y*stride+x/8] &^= 0x80 >> uint(x%8)
+		}
+	}
+	glyphs := make([][]byte, 6)
+	for i := range glyphs {
+		// Rows of random length from a common left edge keep each
+		// glyph one connected component.
+		g := make([]byte, 7*9)
+		for row := 0; row < 9; row++ {
+			for j, n := 0, 1+rng.Intn(7); j < n; j++ {
+				g[row*7+j] = 1
+			}
+		}
+		glyphs[i] = g
+	}
+	for y := 2; y+9 < height/2; y += 12 {
+		for x := 2; x+7 < width; x += 9 {
+			g := glyphs[rng.Intn(len(glyphs))]
+			for j, v := range g {
+				if v == 1 {
+					set(x+j%7, y+j/7)
+				}
+			}
+		}
+	}
+	for y := height / 2; y < height*3/4; y++ {
+		for x := 0; x < width; x++ {
+			if rng.Intn(5) == 0 {
+				set(x, y)
+			}
+		}
+	}
+	for y := height * 3 / 4; y < height; y++ {
+		for x := y % 3; x < width-y%5; x++ {
+			set(x, y)
+		}
+	}
+	return data
+}
+
+func TestEncodeCCITTFaxRoundTrip(t *testing.T) {
+	for _, size := range []struct{ w, h int }{{1, 1}, {13, 7}, {200, 120}, {3000, 40}, {5000, 8}} {
+		samples := bilevelPage(size.w, size.h, int64(size.w))
+		enc, err := EncodeCCITTFax(samples, size.w, size.h)
+		if err != nil {
+			t.Fatalf("%dx%d: encode: %v", size.w, size.h, err)
+		}
+		gray, err := NewCCITTFaxDecoder().Decode(context.Background(), enc, CCITTFaxParams(size.w, size.h))
+		if err != nil {
+			t.Fatalf("%dx%d: decode: %v", size.w, size.h, err)
+		}
+		stride := (size.w + 7) / 8
+		for y := 0; y < size.h; y++ {
+			for x := 0; x < size.w; x++ {
+				white := samples[y*stride+x/8]&(0x80>>uint(x%8)) != 0
+				if (gray[y*size.w+x] != 0) != white {
+					t.Fatalf("%dx%d: pixel (%d,%d) differs", size.w, size.h, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeCCITTFaxRejectsShortInput(t *testing.T) {
+	if _, err := EncodeCCITTFax(make([]byte, 3), 16, 2); err == nil {
+		t.Fatal("expected error for truncated samples")
+	}
+}
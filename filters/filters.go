@@ -362,6 +362,9 @@ func (jbig2Decoder) Decode(ctx context.Context, in []byte, params raw.Dictionary
 	if nativeErr == nil {
 		return native, nil
 	}
+	if pix, err := decodeJBIG2(in, globals); err == nil {
+		return pix, nil
+	}
 	if pix, err := decodeImageToNRGBA(in); err == nil {
 		return pix, nil
 	}
@@ -627,10 +630,9 @@ func applyPredictor(data []byte, params raw.Dictionary) ([]byte, error) {
 			cols = n.Int()
 		}
 	}
-	if bpc%8 != 0 {
-		return nil, errors.New("predictor with non-8-bit components not supported")
-	}
-	bytesPerPixel := int(colors * (bpc / 8))
+	// PNG predictors work on whole bytes, pairing each with the byte one
+	// pixel, or for pixels under a byte one byte, before it.
+	bytesPerPixel := int(max(1, colors*bpc/8))
 	rowBytes := int(math.Ceil(float64(cols*colors*bpc) / 8.0))
 	if rowBytes <= 0 {
 		return nil, errors.New("invalid predictor row size")
@@ -638,6 +640,9 @@ func applyPredictor(data []byte, params raw.Dictionary) ([]byte, error) {
 
 	switch pred {
 	case 2: // TIFF (no per-row filter byte)
+		if bpc%8 != 0 {
+			return nil, errors.New("predictor with non-8-bit components not supported")
+		}
 		out := make([]byte, len(data))
 		copy(out, data)
 		for i := rowBytes; i < len(out); i++ {
@@ -0,0 +1,183 @@
+package filters
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+
+	"github.com/wudi/pdfkit/ir/raw"
+)
+
+// PredictorParams describes the rows of samples PNG predictors work on, as
+// the /Colors, /BitsPerComponent and /Columns of a stream's DecodeParms.
+type PredictorParams struct {
+	Colors           int
+	BitsPerComponent int
+	Columns          int
+}
+
+// rowBytes returns the length of a row and the distance to the
+// corresponding byte of the previous pixel.
+func (p PredictorParams) rowBytes() (row, pixel int) {
+	bits := p.Colors * p.BitsPerComponent
+	return (p.Columns*bits + 7) / 8, max(1, bits/8)
+}
+
+// DecodeParms returns the /DecodeParms of a stream encoded with the PNG
+// predictors EncodePNGPredictor chooses.
+func (p PredictorParams) DecodeParms() raw.Dictionary {
+	d := raw.Dict()
+	d.Set(raw.NameLiteral("Predictor"), raw.NumberInt(15))
+	d.Set(raw.NameLiteral("Colors"), raw.NumberInt(int64(p.Colors)))
+	d.Set(raw.NameLiteral("BitsPerComponent"), raw.NumberInt(int64(p.BitsPerComponent)))
+	d.Set(raw.NameLiteral("Columns"), raw.NumberInt(int64(p.Columns)))
+	return d
+}
+
+// EncodePNGPredictor applies PNG predictors to the rows of data, choosing
+// for each row whichever of None, Sub, Up, Average and Paeth leaves the
+// smallest sum of absolute differences, the heuristic of libpng.
+func EncodePNGPredictor(data []byte, p PredictorParams) ([]byte, error) {
+	if p.Colors <= 0 || p.Columns <= 0 {
+		return nil, errors.New("invalid predictor parameters")
+	}
+	switch p.BitsPerComponent {
+	case 1, 2, 4, 8, 16:
+	default:
+		return nil, errors.New("invalid predictor parameters")
+	}
+	rowLen, bpp := p.rowBytes()
+	if len(data)%rowLen != 0 {
+		return nil, errors.New("predictor data does not align to rows")
+	}
+	rows := len(data) / rowLen
+	out := make([]byte, 0, rows*(rowLen+1))
+	prev := make([]byte, rowLen)
+	var candidates [5][]byte
+	for i := range candidates {
+		candidates[i] = make([]byte, rowLen)
+	}
+	for r := 0; r < rows; r++ {
+		row := data[r*rowLen : (r+1)*rowLen]
+		for i, v := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			candidates[0][i] = v
+			candidates[1][i] = v - left
+			candidates[2][i] = v - up
+			candidates[3][i] = v - byte((int(left)+int(up))/2)
+			candidates[4][i] = v - paeth(left, up, upLeft)
+		}
+		best, bestSum := 0, -1
+		for f, c := range candidates {
+			sum := 0
+			for _, v := range c {
+				sum += abs8(v)
+			}
+			if bestSum < 0 || sum < bestSum {
+				best, bestSum = f, sum
+			}
+		}
+		out = append(out, byte(best))
+		out = append(out, candidates[best]...)
+		prev = row
+	}
+	return out, nil
+}
+
+func abs8(v byte) int {
+	if v < 128 {
+		return int(v)
+	}
+	return 256 - int(v)
+}
+
+// FlateOptions tunes EncodeFlate.
+type FlateOptions struct {
+	// Level is the zlib compression level; 0 chooses one from the size of
+	// the data.
+	Level int
+	// Predictor, when set, has PNG predictors applied to the rows it
+	// describes before compression.
+	Predictor *PredictorParams
+	// Exhaustive compresses the data at several levels and, with a
+	// Predictor, with and without prediction, keeping the smallest result.
+	Exhaustive bool
+}
+
+// flateLevel returns the compression level EncodeFlate uses for n bytes of
+// data when none is given: the best for small streams, where it costs
+// little, and faster ones as streams grow.
+func flateLevel(n int) int {
+	switch {
+	case n < 1<<20:
+		return zlib.BestCompression
+	case n < 16<<20:
+		return zlib.DefaultCompression
+	}
+	return 4
+}
+
+// EncodeFlate compresses data for a FlateDecode stream. The returned
+// DecodeParms are nil unless a predictor was applied.
+func EncodeFlate(data []byte, opts FlateOptions) ([]byte, raw.Dictionary, error) {
+	level := opts.Level
+	if level == 0 {
+		level = flateLevel(len(data))
+	}
+	levels := []int{level}
+	if opts.Exhaustive {
+		for _, l := range []int{zlib.DefaultCompression, zlib.BestCompression, zlib.HuffmanOnly} {
+			if l != level {
+				levels = append(levels, l)
+			}
+		}
+	}
+	type input struct {
+		data  []byte
+		parms raw.Dictionary
+	}
+	var inputs []input
+	if opts.Predictor != nil {
+		if predicted, err := EncodePNGPredictor(data, *opts.Predictor); err == nil {
+			inputs = append(inputs, input{predicted, opts.Predictor.DecodeParms()})
+		}
+	}
+	if len(inputs) == 0 || opts.Exhaustive {
+		inputs = append(inputs, input{data: data})
+	}
+	var (
+		best      []byte
+		bestParms raw.Dictionary
+	)
+	for _, in := range inputs {
+		for _, l := range levels {
+			out, err := deflate(in.data, l)
+			if err != nil {
+				return nil, nil, err
+			}
+			if best == nil || len(out) < len(best) {
+				best, bestParms = out, in.parms
+			}
+		}
+	}
+	return best, bestParms, nil
+}
+
+func deflate(data []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := zlib.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
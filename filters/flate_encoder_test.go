@@ -0,0 +1,91 @@
+package filters
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+)
+
+// gradient returns rows of smoothly varying samples with a little noise,
+// like a scanned photograph.
+func gradient(p PredictorParams, rows int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	rowLen, _ := p.rowBytes()
+	data := make([]byte, rowLen*rows)
+	for y := 0; y < rows; y++ {
+		for x := 0; x < rowLen; x++ {
+			data[y*rowLen+x] = byte(x + 2*y + rng.Intn(3))
+		}
+	}
+	return data
+}
+
+func TestEncodeFlatePredictorRoundTrip(t *testing.T) {
+	for _, p := range []PredictorParams{
+		{Colors: 3, BitsPerComponent: 8, Columns: 97},
+		{Colors: 1, BitsPerComponent: 16, Columns: 40},
+		{Colors: 1, BitsPerComponent: 1, Columns: 61},
+		{Colors: 4, BitsPerComponent: 4, Columns: 9},
+	} {
+		data := gradient(p, 33)
+		enc, parms, err := EncodeFlate(data, FlateOptions{Predictor: &p})
+		if err != nil {
+			t.Fatalf("%+v: encode: %v", p, err)
+		}
+		if parms == nil {
+			t.Fatalf("%+v: no DecodeParms", p)
+		}
+		out, err := NewFlateDecoder().Decode(context.Background(), enc, parms)
+		if err != nil {
+			t.Fatalf("%+v: decode: %v", p, err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatalf("%+v: round trip mismatch", p)
+		}
+	}
+}
+
+func TestEncodeFlatePredictorShrinksImages(t *testing.T) {
+	p := PredictorParams{Colors: 3, BitsPerComponent: 8, Columns: 200}
+	data := gradient(p, 200)
+	plain, parms, err := EncodeFlate(data, FlateOptions{})
+	if err != nil || parms != nil {
+		t.Fatalf("encode: %v, %v", parms, err)
+	}
+	predicted, _, err := EncodeFlate(data, FlateOptions{Predictor: &p})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if len(predicted) >= len(plain) {
+		t.Errorf("predicted %d bytes, plain %d", len(predicted), len(plain))
+	}
+}
+
+func TestEncodeFlateExhaustive(t *testing.T) {
+	// Text gains nothing from prediction; the exhaustive search must not
+	// keep it.
+	data := bytes.Repeat([]byte("BT /F1 12 Tf 72 712 Td (Hello) Tj ET\n"), 50)
+	p := PredictorParams{Colors: 1, BitsPerComponent: 8, Columns: len(data)}
+	enc, parms, err := EncodeFlate(data, FlateOptions{Predictor: &p, Exhaustive: true})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	single, _, _ := EncodeFlate(data, FlateOptions{Predictor: &p})
+	if len(enc) > len(single) {
+		t.Errorf("exhaustive %d bytes, single %d", len(enc), len(single))
+	}
+	out, err := NewFlateDecoder().Decode(context.Background(), enc, parms)
+	if err != nil || !bytes.Equal(out, data) {
+		t.Fatalf("round trip failed: %v", err)
+	}
+}
+
+func TestEncodePNGPredictorRejectsMisalignedData(t *testing.T) {
+	if _, err := EncodePNGPredictor(make([]byte, 10), PredictorParams{Colors: 1, BitsPerComponent: 8, Columns: 3}); err == nil {
+		t.Error("expected error for data not a whole number of rows")
+	}
+	if _, err := EncodePNGPredictor(make([]byte, 9), PredictorParams{Colors: 1, BitsPerComponent: 3, Columns: 3}); err == nil {
+		t.Error("expected error for 3 bits per component")
+	}
+}
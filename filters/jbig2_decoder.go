@@ -0,0 +1,436 @@
+package filters
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+
+	"golang.org/x/image/ccitt"
+)
+
+// errJBIG2Truncated reports a segment running past the end of its stream.
+var errJBIG2Truncated = errors.New("JBIG2 data truncated")
+
+// jbig2Segment is a parsed segment header with its data.
+type jbig2Segment struct {
+	number uint32
+	typ    byte
+	refs   []uint32
+	data   []byte
+}
+
+// parseJBIG2Segments splits a stream in the embedded organization (T.88
+// Annex D.3), which has no file header, into its segments.
+func parseJBIG2Segments(data []byte) ([]jbig2Segment, error) {
+	var out []jbig2Segment
+	for len(data) > 0 {
+		if len(data) < 6 {
+			return nil, errJBIG2Truncated
+		}
+		s := jbig2Segment{number: binary.BigEndian.Uint32(data), typ: data[4] & 0x3F}
+		longPage := data[4]&0x40 != 0
+		count := int(data[5] >> 5)
+		pos := 6
+		if count == 7 {
+			if len(data) < 9 {
+				return nil, errJBIG2Truncated
+			}
+			count = int(binary.BigEndian.Uint32(data[5:]) & 0x1FFFFFFF)
+			pos = 9 + (count+8)/8
+		}
+		size := 1
+		if s.number > 65536 {
+			size = 4
+		} else if s.number > 256 {
+			size = 2
+		}
+		pageSize := 1
+		if longPage {
+			pageSize = 4
+		}
+		if count > len(data) || len(data) < pos+count*size+pageSize+4 {
+			return nil, errJBIG2Truncated
+		}
+		for i := 0; i < count; i++ {
+			switch size {
+			case 1:
+				s.refs = append(s.refs, uint32(data[pos]))
+			case 2:
+				s.refs = append(s.refs, uint32(binary.BigEndian.Uint16(data[pos:])))
+			default:
+				s.refs = append(s.refs, binary.BigEndian.Uint32(data[pos:]))
+			}
+			pos += size
+		}
+		pos += pageSize
+		length := binary.BigEndian.Uint32(data[pos:])
+		pos += 4
+		if length == 0xFFFFFFFF {
+			return nil, UnsupportedError{Filter: "JBIG2Decode (segment of unknown length)"}
+		}
+		if uint64(len(data)-pos) < uint64(length) {
+			return nil, errJBIG2Truncated
+		}
+		s.data = data[pos : pos+int(length)]
+		out = append(out, s)
+		data = data[pos+int(length):]
+	}
+	return out, nil
+}
+
+// jbig2Decoding is the state of decoding one page.
+type jbig2Decoding struct {
+	page *jbig2Bitmap
+	// symbols holds the symbols each symbol dictionary exports.
+	symbols map[uint32][]*jbig2Bitmap
+}
+
+// decodeJBIG2 decodes an embedded JBIG2 stream and its globals in pure Go,
+// returning NRGBA pixels. It supports the arithmetic-coded symbol
+// dictionaries and text regions without refinement and the generic
+// regions most encoders produce; other segments yield an UnsupportedError.
+func decodeJBIG2(page, globals []byte) ([]byte, error) {
+	d := &jbig2Decoding{symbols: make(map[uint32][]*jbig2Bitmap)}
+	for _, stream := range [][]byte{globals, page} {
+		segments, err := parseJBIG2Segments(stream)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range segments {
+			if err := d.segment(s); err != nil {
+				return nil, fmt.Errorf("JBIG2 segment %d: %w", s.number, err)
+			}
+		}
+	}
+	if d.page == nil {
+		return nil, errors.New("JBIG2 stream has no page information")
+	}
+	return jbig2MonochromeToNRGBA(d.page.w, d.page.h, d.page.stride, d.page.data)
+}
+
+func (d *jbig2Decoding) segment(s jbig2Segment) error {
+	switch s.typ {
+	case jbig2PageInformation:
+		return d.pageInformation(s.data)
+	case jbig2SymbolDictionary:
+		syms, err := d.symbolDictionary(s)
+		if err != nil {
+			return err
+		}
+		d.symbols[s.number] = syms
+		return nil
+	case jbig2IntermediateTextRegion, jbig2ImmediateTextRegion, jbig2LosslessTextRegion:
+		return d.textRegion(s)
+	case jbig2IntermediateGeneric, jbig2ImmediateGeneric, jbig2LosslessGeneric:
+		return d.genericRegion(s.data)
+	case jbig2EndOfPage, jbig2EndOfStripe, jbig2EndOfFile, jbig2Profiles, jbig2Tables, jbig2Extension:
+		return nil
+	}
+	return UnsupportedError{Filter: fmt.Sprintf("JBIG2Decode (segment type %d)", s.typ)}
+}
+
+func (d *jbig2Decoding) pageInformation(data []byte) error {
+	if len(data) < 19 {
+		return errJBIG2Truncated
+	}
+	w, h := binary.BigEndian.Uint32(data), binary.BigEndian.Uint32(data[4:])
+	if h == 0xFFFFFFFF {
+		return UnsupportedError{Filter: "JBIG2Decode (striped page of unknown height)"}
+	}
+	if err := validateNativeImageBounds(int(w), int(h)); err != nil {
+		return err
+	}
+	d.page = newJBIG2Bitmap(int(w), int(h))
+	d.page.fill(int(data[16] >> 2 & 1))
+	return nil
+}
+
+// jbig2Region is a region segment information field (T.88 7.4.1).
+type jbig2Region struct {
+	w, h, x, y, op int
+}
+
+func parseJBIG2Region(data []byte) (jbig2Region, []byte, error) {
+	if len(data) < 17 {
+		return jbig2Region{}, nil, errJBIG2Truncated
+	}
+	r := jbig2Region{
+		w:  int(binary.BigEndian.Uint32(data)),
+		h:  int(binary.BigEndian.Uint32(data[4:])),
+		x:  int(int32(binary.BigEndian.Uint32(data[8:]))),
+		y:  int(int32(binary.BigEndian.Uint32(data[12:]))),
+		op: int(data[16] & 7),
+	}
+	if err := validateNativeImageBounds(max(r.w, 1), max(r.h, 1)); err != nil {
+		return r, nil, err
+	}
+	return r, data[17:], nil
+}
+
+// parseJBIG2AT reads the adaptive template pixels of a template.
+func parseJBIG2AT(data []byte, template int) ([4][2]int, []byte, error) {
+	var at [4][2]int
+	n := jbig2TemplateAT[template]
+	if len(data) < 2*n {
+		return at, nil, errJBIG2Truncated
+	}
+	for i := 0; i < n; i++ {
+		at[i] = [2]int{int(int8(data[2*i])), int(int8(data[2*i+1]))}
+	}
+	return at, data[2*n:], nil
+}
+
+func (d *jbig2Decoding) place(r jbig2Region, b *jbig2Bitmap) error {
+	if d.page == nil {
+		return errors.New("region before page information")
+	}
+	d.page.compose(b, r.x, r.y, r.op)
+	return nil
+}
+
+func (d *jbig2Decoding) genericRegion(data []byte) error {
+	r, data, err := parseJBIG2Region(data)
+	if err != nil {
+		return err
+	}
+	if len(data) < 1 {
+		return errJBIG2Truncated
+	}
+	flags := data[0]
+	data = data[1:]
+	if flags&0x10 != 0 {
+		return UnsupportedError{Filter: "JBIG2Decode (extended template)"}
+	}
+	if flags&1 != 0 {
+		b, err := decodeJBIG2MMR(data, r.w, r.h)
+		if err != nil {
+			return err
+		}
+		return d.place(r, b)
+	}
+	g := jbig2Generic{template: int(flags >> 1 & 3), tpgdon: flags&8 != 0}
+	if g.at, data, err = parseJBIG2AT(data, g.template); err != nil {
+		return err
+	}
+	return d.place(r, g.decode(newMQDecoder(data), r.w, r.h, newGenericContexts()))
+}
+
+// decodeJBIG2MMR decodes a generic region coded with MMR, which is CCITT
+// Group 4 with black as 1.
+func decodeJBIG2MMR(data []byte, w, h int) (*jbig2Bitmap, error) {
+	gray := image.NewGray(image.Rect(0, 0, w, h))
+	if err := ccitt.DecodeIntoGray(gray, bytes.NewReader(data), ccitt.MSB, ccitt.Group4, &ccitt.Options{}); err != nil {
+		return nil, err
+	}
+	b := newJBIG2Bitmap(w, h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if gray.Pix[y*gray.Stride+x] == 0 {
+				b.put(x, y, 1)
+			}
+		}
+	}
+	return b, nil
+}
+
+// referredSymbols concatenates the symbols exported by the dictionaries s
+// refers to, in the order it refers to them.
+func (d *jbig2Decoding) referredSymbols(s jbig2Segment) []*jbig2Bitmap {
+	var out []*jbig2Bitmap
+	for _, ref := range s.refs {
+		out = append(out, d.symbols[ref]...)
+	}
+	return out
+}
+
+// symbolDictionary decodes an arithmetic-coded symbol dictionary without
+// refinement or aggregation (T.88 6.5).
+func (d *jbig2Decoding) symbolDictionary(s jbig2Segment) ([]*jbig2Bitmap, error) {
+	data := s.data
+	if len(data) < 2 {
+		return nil, errJBIG2Truncated
+	}
+	flags := binary.BigEndian.Uint16(data)
+	data = data[2:]
+	if flags&3 != 0 {
+		return nil, UnsupportedError{Filter: "JBIG2Decode (Huffman or refinement symbol dictionary)"}
+	}
+	g := jbig2Generic{template: int(flags >> 10 & 3)}
+	var err error
+	if g.at, data, err = parseJBIG2AT(data, g.template); err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, errJBIG2Truncated
+	}
+	numExported := int(binary.BigEndian.Uint32(data))
+	numNew := int(binary.BigEndian.Uint32(data[4:]))
+	data = data[8:]
+	input := d.referredSymbols(s)
+	if numNew > len(data)*8 || numExported > len(input)+numNew {
+		return nil, errors.New("JBIG2 symbol counts invalid")
+	}
+	dec := newMQDecoder(data)
+	iadh, iadw, iaex := newIntContexts(), newIntContexts(), newIntContexts()
+	gb := newGenericContexts()
+	created := make([]*jbig2Bitmap, 0, numNew)
+	height := 0
+	for len(created) < numNew {
+		dh, ok := dec.decodeInt(iadh)
+		if !ok {
+			return nil, errors.New("JBIG2 height class delta out of band")
+		}
+		height += dh
+		width := 0
+		for {
+			dw, ok := dec.decodeInt(iadw)
+			if !ok {
+				break
+			}
+			width += dw
+			if len(created) >= numNew || width <= 0 || height <= 0 || width > maxNativeImageDimension || height > maxNativeImageDimension {
+				return nil, errors.New("JBIG2 symbol size invalid")
+			}
+			created = append(created, g.decode(dec, width, height, gb))
+		}
+	}
+	all := append(input, created...)
+	exported := make([]*jbig2Bitmap, 0, numExported)
+	for i, export := 0, false; i < len(all); export = !export {
+		run, ok := dec.decodeInt(iaex)
+		if !ok || run < 0 || i+run > len(all) {
+			return nil, errors.New("JBIG2 export flags invalid")
+		}
+		if export {
+			exported = append(exported, all[i:i+run]...)
+		}
+		i += run
+	}
+	return exported, nil
+}
+
+// Reference corners of text regions (T.88 7.4.3.1.1).
+const (
+	jbig2BottomLeft = iota
+	jbig2TopLeft
+	jbig2BottomRight
+	jbig2TopRight
+)
+
+// textRegion decodes an arithmetic-coded text region without refinement
+// (T.88 6.4).
+func (d *jbig2Decoding) textRegion(s jbig2Segment) error {
+	r, data, err := parseJBIG2Region(s.data)
+	if err != nil {
+		return err
+	}
+	if len(data) < 6 {
+		return errJBIG2Truncated
+	}
+	flags := binary.BigEndian.Uint16(data)
+	if flags&3 != 0 {
+		return UnsupportedError{Filter: "JBIG2Decode (Huffman or refinement text region)"}
+	}
+	strips := 1 << (flags >> 2 & 3)
+	corner := int(flags >> 4 & 3)
+	transposed := flags&0x40 != 0
+	op := int(flags >> 7 & 3)
+	offset := int(flags>>10&0x1F) << 27 >> 27
+	instances := int(binary.BigEndian.Uint32(data[2:]))
+	data = data[6:]
+	symbols := d.referredSymbols(s)
+	codeLen := 0
+	for 1<<uint(codeLen) < len(symbols) {
+		codeLen++
+	}
+	region := newJBIG2Bitmap(r.w, r.h)
+	region.fill(int(flags >> 9 & 1))
+	dec := newMQDecoder(data)
+	iadt, iafs, iads, iait := newIntContexts(), newIntContexts(), newIntContexts(), newIntContexts()
+	iaid := make(mqContexts, 1<<uint(codeLen))
+	next := func(cx mqContexts) (int, error) {
+		v, ok := dec.decodeInt(cx)
+		if !ok {
+			return 0, errors.New("JBIG2 text region value out of band")
+		}
+		return v, nil
+	}
+	stripT, err := next(iadt)
+	if err != nil {
+		return err
+	}
+	stripT *= -strips
+	firstS := 0
+	for n := 0; n < instances; {
+		dt, err := next(iadt)
+		if err != nil {
+			return err
+		}
+		stripT += dt * strips
+		curS := 0
+		for first := true; n < instances; first = false {
+			if first {
+				dfs, err := next(iafs)
+				if err != nil {
+					return err
+				}
+				firstS += dfs
+				curS = firstS
+			} else {
+				ds, ok := dec.decodeInt(iads)
+				if !ok {
+					break
+				}
+				curS += ds + offset
+			}
+			curT := 0
+			if strips > 1 {
+				if curT, err = next(iait); err != nil {
+					return err
+				}
+			}
+			t := stripT + curT
+			id := dec.decodeID(iaid, codeLen)
+			if id < 0 || id >= len(symbols) {
+				return fmt.Errorf("JBIG2 symbol ID %d out of range", id)
+			}
+			sym := symbols[id]
+			right, bottom := corner == jbig2TopRight || corner == jbig2BottomRight, corner == jbig2BottomLeft || corner == jbig2BottomRight
+			var x, y int
+			if !transposed {
+				if right {
+					curS += sym.w - 1
+				}
+				x, y = curS, t
+				if right {
+					x -= sym.w - 1
+				}
+				if bottom {
+					y -= sym.h - 1
+				}
+				if !right {
+					curS += sym.w - 1
+				}
+			} else {
+				if bottom {
+					curS += sym.h - 1
+				}
+				x, y = t, curS
+				if right {
+					x -= sym.w - 1
+				}
+				if bottom {
+					y -= sym.h - 1
+				}
+				if !bottom {
+					curS += sym.h - 1
+				}
+			}
+			region.compose(sym, x, y, op)
+			n++
+		}
+	}
+	return d.place(r, region)
+}
@@ -0,0 +1,462 @@
+package filters
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// JBIG2 segment types (T.88 7.3).
+const (
+	jbig2SymbolDictionary        = 0
+	jbig2IntermediateTextRegion  = 4
+	jbig2ImmediateTextRegion     = 6
+	jbig2LosslessTextRegion      = 7
+	jbig2IntermediateGeneric     = 36
+	jbig2ImmediateGeneric        = 38
+	jbig2LosslessGeneric         = 39
+	jbig2PageInformation         = 48
+	jbig2EndOfPage               = 49
+	jbig2EndOfStripe             = 50
+	jbig2EndOfFile               = 51
+	jbig2Profiles                = 52
+	jbig2Tables                  = 53
+	jbig2Extension               = 62
+	jbig2GlobalDictionarySegment = 0
+)
+
+// jbig2MaxSymbol bounds the width and height of the connected components
+// the symbol coder turns into symbols; larger ones, such as rules, frames
+// and pictures, are coded in a generic region.
+const jbig2MaxSymbol = 256
+
+// EncodeJBIG2 compresses a bilevel image losslessly as a JBIG2 generic
+// region, returning an embedded stream for JBIG2Decode that needs no
+// JBIG2Globals. Samples are packed as for EncodeCCITTFax, with 0 black.
+func EncodeJBIG2(samples []byte, width, height int) ([]byte, error) {
+	b, err := jbig2FromSamples(samples, width, height)
+	if err != nil {
+		return nil, err
+	}
+	out := jbig2PageInfo(nil, 1, width, height)
+	return appendJBIG2Segment(out, 2, jbig2ImmediateGeneric, nil, 1, jbig2GenericRegion(b, 0, 0)), nil
+}
+
+// jbig2FromSamples converts PDF image samples, where 0 is black, to a
+// JBIG2 bitmap.
+func jbig2FromSamples(samples []byte, width, height int) (*jbig2Bitmap, error) {
+	if err := validateNativeImageBounds(width, height); err != nil {
+		return nil, err
+	}
+	b := newJBIG2Bitmap(width, height)
+	if len(samples) < len(b.data) {
+		return nil, errors.New("JBIG2 samples truncated")
+	}
+	pad := byte(0xFF) << uint(8*b.stride-width)
+	for y := 0; y < height; y++ {
+		row := b.data[y*b.stride : (y+1)*b.stride]
+		for i := range row {
+			row[i] = ^samples[y*b.stride+i]
+		}
+		row[len(row)-1] &= pad
+	}
+	return b, nil
+}
+
+// appendJBIG2Segment appends a segment header (T.88 7.2) and data. Pages
+// are numbered below 256 and segments refer to at most four others.
+func appendJBIG2Segment(out []byte, number uint32, typ byte, refs []uint32, page byte, data []byte) []byte {
+	out = binary.BigEndian.AppendUint32(out, number)
+	out = append(out, typ, byte(len(refs))<<5)
+	for _, r := range refs {
+		switch {
+		case number <= 256:
+			out = append(out, byte(r))
+		case number <= 65536:
+			out = binary.BigEndian.AppendUint16(out, uint16(r))
+		default:
+			out = binary.BigEndian.AppendUint32(out, r)
+		}
+	}
+	out = append(out, page)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(data)))
+	return append(out, data...)
+}
+
+// jbig2PageInfo appends the page information segment of a lossless page.
+func jbig2PageInfo(out []byte, number uint32, width, height int) []byte {
+	var data []byte
+	data = binary.BigEndian.AppendUint32(data, uint32(width))
+	data = binary.BigEndian.AppendUint32(data, uint32(height))
+	data = binary.BigEndian.AppendUint32(data, 0)
+	data = binary.BigEndian.AppendUint32(data, 0)
+	// Eventually lossless, white default pixel, OR combination, no stripes.
+	data = append(data, 0x01, 0, 0)
+	return appendJBIG2Segment(out, number, jbig2PageInformation, nil, 1, data)
+}
+
+// jbig2RegionInfo appends a region segment information field combining
+// the region with OR.
+func jbig2RegionInfo(data []byte, width, height, x, y int) []byte {
+	data = binary.BigEndian.AppendUint32(data, uint32(width))
+	data = binary.BigEndian.AppendUint32(data, uint32(height))
+	data = binary.BigEndian.AppendUint32(data, uint32(x))
+	data = binary.BigEndian.AppendUint32(data, uint32(y))
+	return append(data, jbig2OpOR)
+}
+
+// jbig2AppendAT appends adaptive template pixel positions.
+func jbig2AppendAT(data []byte, at [4][2]int) []byte {
+	for _, p := range at {
+		data = append(data, byte(int8(p[0])), byte(int8(p[1])))
+	}
+	return data
+}
+
+// jbig2GenericRegion returns the data of an immediate generic region
+// segment coding b at (x, y) with template 0.
+func jbig2GenericRegion(b *jbig2Bitmap, x, y int) []byte {
+	data := jbig2RegionInfo(nil, b.w, b.h, x, y)
+	data = append(data, 0)
+	data = jbig2AppendAT(data, jbig2DefaultAT)
+	e := newMQEncoder()
+	jbig2Generic{at: jbig2DefaultAT}.encode(e, b, newGenericContexts())
+	return append(data, e.flush()...)
+}
+
+// JBIG2Encoder compresses a set of bilevel images, such as the pages of a
+// scan, as JBIG2 text regions. Each connected component of black pixels
+// becomes an instance of a symbol, identical components share one, and
+// symbols occurring in more than one image are stored once in a global
+// symbol dictionary for JBIG2Globals. Coding is lossless: components are
+// only merged when they match exactly.
+type JBIG2Encoder struct {
+	symbols []*jbig2Symbol
+	index   map[string]int
+	pages   []*jbig2Page
+}
+
+type jbig2Symbol struct {
+	b *jbig2Bitmap
+	// pages counts the images using the symbol, last being the latest.
+	pages, last int
+	// id is the symbol's position in the dictionary holding it.
+	id int
+}
+
+type jbig2Page struct {
+	w, h      int
+	instances []jbig2Instance
+	// residue holds the components too large to be symbols.
+	residue *jbig2Bitmap
+}
+
+type jbig2Instance struct {
+	symbol, x, y int
+}
+
+// NewJBIG2Encoder returns an encoder without images.
+func NewJBIG2Encoder() *JBIG2Encoder {
+	return &JBIG2Encoder{index: make(map[string]int)}
+}
+
+// AddPage adds a bilevel image with samples packed as for EncodeJBIG2 and
+// returns its index among the streams Encode returns.
+func (e *JBIG2Encoder) AddPage(samples []byte, width, height int) (int, error) {
+	b, err := jbig2FromSamples(samples, width, height)
+	if err != nil {
+		return 0, err
+	}
+	n := len(e.pages)
+	page := &jbig2Page{w: width, h: height}
+	for _, c := range jbig2Components(b) {
+		if c.b.w > jbig2MaxSymbol || c.b.h > jbig2MaxSymbol {
+			if page.residue == nil {
+				page.residue = newJBIG2Bitmap(width, height)
+			}
+			page.residue.compose(c.b, c.x, c.y, jbig2OpOR)
+			continue
+		}
+		key := string(binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, uint32(c.b.w)), uint32(c.b.h))) + string(c.b.data)
+		s, ok := e.index[key]
+		if !ok {
+			s = len(e.symbols)
+			e.index[key] = s
+			e.symbols = append(e.symbols, &jbig2Symbol{b: c.b, last: -1})
+		}
+		if sym := e.symbols[s]; sym.last != n {
+			sym.pages++
+			sym.last = n
+		}
+		page.instances = append(page.instances, jbig2Instance{symbol: s, x: c.x, y: c.y})
+	}
+	e.pages = append(e.pages, page)
+	return n, nil
+}
+
+// Encode returns the JBIG2Globals stream, nil when no symbol is shared by
+// two images, and an embedded stream for each image in the order they were
+// added. Images whose text region would take more space than a generic
+// region, as noise makes it, and those using a single symbol are coded as
+// generic regions.
+func (e *JBIG2Encoder) Encode() (globals []byte, pages [][]byte, err error) {
+	var shared []*jbig2Symbol
+	for _, s := range e.symbols {
+		if s.pages > 1 {
+			shared = append(shared, s)
+		}
+	}
+	if len(shared) > 0 {
+		globals = appendJBIG2Segment(nil, jbig2GlobalDictionarySegment, jbig2SymbolDictionary, nil, 0, jbig2SymbolDictionaryData(shared))
+	}
+	for _, p := range e.pages {
+		pages = append(pages, e.encodePage(p, shared))
+	}
+	return globals, pages, nil
+}
+
+func (e *JBIG2Encoder) encodePage(p *jbig2Page, shared []*jbig2Symbol) []byte {
+	var local []*jbig2Symbol
+	seen := make(map[int]bool)
+	for _, in := range p.instances {
+		if s := e.symbols[in.symbol]; s.pages == 1 && !seen[in.symbol] {
+			seen[in.symbol] = true
+			local = append(local, s)
+		}
+	}
+	out := jbig2PageInfo(nil, 1, p.w, p.h)
+	b := newJBIG2Bitmap(p.w, p.h)
+	if p.residue != nil {
+		b.compose(p.residue, 0, 0, jbig2OpOR)
+	}
+	for _, in := range p.instances {
+		b.compose(e.symbols[in.symbol].b, in.x, in.y, jbig2OpOR)
+	}
+	generic := appendJBIG2Segment(out, 2, jbig2ImmediateGeneric, nil, 1, jbig2GenericRegion(b, 0, 0))
+	if len(p.instances) == 0 || len(shared)+len(local) < 2 {
+		// A text region over one symbol would code IDs in zero bits,
+		// which decoders disagree on.
+		return generic
+	}
+	var refs []uint32
+	if len(shared) > 0 {
+		refs = append(refs, jbig2GlobalDictionarySegment)
+	}
+	if len(local) > 0 {
+		out = appendJBIG2Segment(out, 2, jbig2SymbolDictionary, nil, 1, jbig2SymbolDictionaryData(local))
+		refs = append(refs, 2)
+	}
+	if len(p.instances) > 0 {
+		out = appendJBIG2Segment(out, 3, jbig2ImmediateTextRegion, refs, 1, e.textRegion(p, len(shared), len(shared)+len(local)))
+	}
+	if r := p.residue; r != nil {
+		x0, y0, x1, y1 := jbig2Bounds(r)
+		crop := newJBIG2Bitmap(x1-x0, y1-y0)
+		crop.compose(r, -x0, -y0, jbig2OpReplace)
+		out = appendJBIG2Segment(out, 4, jbig2ImmediateGeneric, nil, 1, jbig2GenericRegion(crop, x0, y0))
+	}
+	if len(generic) < len(out) {
+		return generic
+	}
+	return out
+}
+
+// jbig2Bounds returns the bounding box of the black pixels of b, which has
+// at least one.
+func jbig2Bounds(b *jbig2Bitmap) (x0, y0, x1, y1 int) {
+	x0, y0 = b.w, b.h
+	for y := 0; y < b.h; y++ {
+		for x := 0; x < b.w; x++ {
+			if b.get(x, y) == 1 {
+				x0, y0 = min(x0, x), min(y0, y)
+				x1, y1 = max(x1, x+1), max(y1, y+1)
+			}
+		}
+	}
+	return x0, y0, x1, y1
+}
+
+// jbig2SymbolDictionaryData codes symbols, which it sorts into height
+// classes of increasing width and numbers in that order, as a symbol
+// dictionary exporting all of them (T.88 6.5).
+func jbig2SymbolDictionaryData(symbols []*jbig2Symbol) []byte {
+	sort.SliceStable(symbols, func(i, j int) bool {
+		a, b := symbols[i].b, symbols[j].b
+		if a.h != b.h {
+			return a.h < b.h
+		}
+		return a.w < b.w
+	})
+	data := []byte{0, 0}
+	data = jbig2AppendAT(data, jbig2DefaultAT)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(symbols)))
+	data = binary.BigEndian.AppendUint32(data, uint32(len(symbols)))
+	e := newMQEncoder()
+	iadh, iadw, iaex := newIntContexts(), newIntContexts(), newIntContexts()
+	gb := newGenericContexts()
+	generic := jbig2Generic{at: jbig2DefaultAT}
+	height := 0
+	for i := 0; i < len(symbols); {
+		h := symbols[i].b.h
+		e.encodeInt(iadh, h-height, false)
+		height = h
+		width := 0
+		for ; i < len(symbols) && symbols[i].b.h == h; i++ {
+			s := symbols[i]
+			s.id = i
+			e.encodeInt(iadw, s.b.w-width, false)
+			width = s.b.w
+			generic.encode(e, s.b, gb)
+		}
+		e.encodeInt(iadw, 0, true)
+	}
+	// Export flags: no input symbols, then every new one.
+	e.encodeInt(iaex, 0, false)
+	e.encodeInt(iaex, len(symbols), false)
+	return append(data, e.flush()...)
+}
+
+// jbig2LogStrips is the base-2 logarithm of the height of the strips
+// text regions group symbol instances in.
+const jbig2LogStrips = 2
+
+// textRegion returns the data of a text region placing the instances of p
+// with their bottom-left corners, which glyphs on a line mostly share.
+// Symbol IDs number the shared symbols first and the page's own after
+// them, from offset.
+func (e *JBIG2Encoder) textRegion(p *jbig2Page, offset, numSymbols int) []byte {
+	type placed struct {
+		jbig2Instance
+		t, strip int
+	}
+	instances := make([]placed, len(p.instances))
+	for i, in := range p.instances {
+		t := in.y + e.symbols[in.symbol].b.h - 1
+		instances[i] = placed{in, t, t >> jbig2LogStrips << jbig2LogStrips}
+	}
+	sort.SliceStable(instances, func(i, j int) bool {
+		if instances[i].strip != instances[j].strip {
+			return instances[i].strip < instances[j].strip
+		}
+		return instances[i].x < instances[j].x
+	})
+	data := jbig2RegionInfo(nil, p.w, p.h, 0, 0)
+	// Arithmetic coding, no refinement, REFCORNER BOTTOMLEFT, OR.
+	data = binary.BigEndian.AppendUint16(data, jbig2LogStrips<<2)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(instances)))
+	codeLen := 0
+	for 1<<uint(codeLen) < numSymbols {
+		codeLen++
+	}
+	enc := newMQEncoder()
+	iadt, iafs, iads, iait := newIntContexts(), newIntContexts(), newIntContexts(), newIntContexts()
+	iaid := make(mqContexts, 1<<uint(codeLen))
+	enc.encodeInt(iadt, 0, false)
+	stripT, firstS := 0, 0
+	for i := 0; i < len(instances); {
+		strip := instances[i].strip
+		enc.encodeInt(iadt, (strip-stripT)>>jbig2LogStrips, false)
+		stripT = strip
+		curS := 0
+		for first := true; i < len(instances) && instances[i].strip == strip; i++ {
+			in := instances[i]
+			if first {
+				enc.encodeInt(iafs, in.x-firstS, false)
+				firstS = in.x
+				first = false
+			} else {
+				enc.encodeInt(iads, in.x-curS, false)
+			}
+			enc.encodeInt(iait, in.t-strip, false)
+			s := e.symbols[in.symbol]
+			id := s.id
+			if s.pages == 1 {
+				id += offset
+			}
+			enc.encodeID(iaid, codeLen, id)
+			curS = in.x + s.b.w - 1
+		}
+		enc.encodeInt(iads, 0, true)
+	}
+	return append(data, enc.flush()...)
+}
+
+// jbig2Component is a connected component of black pixels.
+type jbig2Component struct {
+	x, y int
+	b    *jbig2Bitmap
+}
+
+// jbig2Components returns the 8-connected components of b in the order of
+// their topmost run.
+func jbig2Components(b *jbig2Bitmap) []jbig2Component {
+	type run struct{ y, x0, x1 int }
+	var runs []run
+	var parent []int
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	prevStart, prevEnd := 0, 0
+	for y := 0; y < b.h; y++ {
+		start := len(runs)
+		row := b.data[y*b.stride : (y+1)*b.stride]
+		for x := 0; x < b.w; {
+			if x&7 == 0 && row[x>>3] == 0 {
+				x += 8
+				continue
+			}
+			if b.get(x, y) == 0 {
+				x++
+				continue
+			}
+			x0 := x
+			for x < b.w && b.get(x, y) == 1 {
+				x++
+			}
+			runs = append(runs, run{y, x0, x})
+			parent = append(parent, len(parent))
+		}
+		// Join runs touching a run of the previous row, diagonals included.
+		j := prevStart
+		for i := start; i < len(runs); i++ {
+			for j < prevEnd && runs[j].x1 < runs[i].x0 {
+				j++
+			}
+			for k := j; k < prevEnd && runs[k].x0 <= runs[i].x1; k++ {
+				if a, c := find(i), find(k); a != c {
+					parent[max(a, c)] = min(a, c)
+				}
+			}
+		}
+		prevStart, prevEnd = start, len(runs)
+	}
+	index := make(map[int]int)
+	type box struct{ x0, y0, x1, y1 int }
+	var boxes []box
+	for i, r := range runs {
+		root := find(i)
+		c, ok := index[root]
+		if !ok {
+			c = len(boxes)
+			index[root] = c
+			boxes = append(boxes, box{r.x0, r.y, r.x1, r.y + 1})
+		}
+		bx := &boxes[c]
+		bx.x0, bx.x1, bx.y1 = min(bx.x0, r.x0), max(bx.x1, r.x1), r.y+1
+	}
+	out := make([]jbig2Component, len(boxes))
+	for i, bx := range boxes {
+		out[i] = jbig2Component{x: bx.x0, y: bx.y0, b: newJBIG2Bitmap(bx.x1-bx.x0, bx.y1-bx.y0)}
+	}
+	for i, r := range runs {
+		c := out[index[find(i)]]
+		for x := r.x0; x < r.x1; x++ {
+			c.b.put(x-c.x, r.y-c.y, 1)
+		}
+	}
+	return out
+}
@@ -0,0 +1,136 @@
+package filters
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/wudi/pdfkit/ir/raw"
+)
+
+func TestMQIntegerRoundTrip(t *testing.T) {
+	values := []int{0, 1, 3, 4, 19, 20, 83, 84, 339, 340, 4435, 4436, 70000, -1, -5, -400, -5000}
+	e := newMQEncoder()
+	cx, ids := newIntContexts(), make(mqContexts, 1<<5)
+	for _, v := range values {
+		e.encodeInt(cx, v, false)
+		e.encodeID(ids, 5, (v%32+32)%32)
+	}
+	e.encodeInt(cx, 0, true)
+	d := newMQDecoder(e.flush())
+	cx, ids = newIntContexts(), make(mqContexts, 1<<5)
+	for _, v := range values {
+		got, ok := d.decodeInt(cx)
+		if !ok || got != v {
+			t.Fatalf("decodeInt = %d, %v; want %d", got, ok, v)
+		}
+		if id := d.decodeID(ids, 5); id != (v%32+32)%32 {
+			t.Fatalf("decodeID = %d for %d", id, v)
+		}
+	}
+	if _, ok := d.decodeInt(cx); ok {
+		t.Fatal("expected out-of-band value")
+	}
+}
+
+// checkJBIG2Pixels compares decoded NRGBA pixels with packed samples.
+func checkJBIG2Pixels(t *testing.T, pix, samples []byte, width, height int) {
+	t.Helper()
+	if len(pix) != width*height*4 {
+		t.Fatalf("decoded %d bytes, want %d", len(pix), width*height*4)
+	}
+	stride := (width + 7) / 8
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			white := samples[y*stride+x/8]&(0x80>>uint(x%8)) != 0
+			if (pix[(y*width+x)*4] != 0) != white {
+				t.Fatalf("pixel (%d,%d) differs", x, y)
+			}
+		}
+	}
+}
+
+func decodeJBIG2Stream(t *testing.T, page, globals []byte) []byte {
+	t.Helper()
+	var params raw.Dictionary
+	if globals != nil {
+		params = raw.Dict()
+		params.Set(raw.NameLiteral("JBIG2Globals"), raw.NewStream(raw.Dict(), globals))
+	}
+	pix, err := NewJBIG2Decoder().Decode(context.Background(), page, params)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return pix
+}
+
+func TestEncodeJBIG2GenericRoundTrip(t *testing.T) {
+	for _, size := range []struct{ w, h int }{{1, 1}, {13, 7}, {300, 160}} {
+		samples := bilevelPage(size.w, size.h, int64(size.h))
+		enc, err := EncodeJBIG2(samples, size.w, size.h)
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		checkJBIG2Pixels(t, decodeJBIG2Stream(t, enc, nil), samples, size.w, size.h)
+	}
+}
+
+func TestJBIG2EncoderSharesSymbols(t *testing.T) {
+	const w, h = 320, 200
+	e := NewJBIG2Encoder()
+	var pages [][]byte
+	for i := 0; i < 3; i++ {
+		samples := bilevelPage(w, h/2, 7)
+		samples = append(samples, bytes.Repeat([]byte{0xFF}, len(samples))...)
+		if i == 2 {
+			// A page with marks of its own and a component too large to
+			// be a symbol.
+			samples = bilevelPage(w, h, 11)
+			for y := 10; y < 20; y++ {
+				for x := 0; x < w; x++ {
+					samples[y*(w/8)+x/8] &^= 0x80 >> uint(x%8)
+				}
+			}
+		}
+		pages = append(pages, samples)
+		if n, err := e.AddPage(samples, w, h); err != nil || n != i {
+			t.Fatalf("AddPage = %d, %v", n, err)
+		}
+	}
+	globals, streams, err := e.Encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if len(globals) == 0 || len(streams) != 3 {
+		t.Fatalf("got %d bytes of globals and %d streams", len(globals), len(streams))
+	}
+	generic, _ := EncodeJBIG2(pages[0], w, h)
+	if len(streams[1]) >= len(generic) {
+		t.Errorf("symbol coding took %d bytes, generic coding %d", len(streams[1]), len(generic))
+	}
+	for i, s := range streams {
+		checkJBIG2Pixels(t, decodeJBIG2Stream(t, s, globals), pages[i], w, h)
+	}
+}
+
+func TestJBIG2EncoderSingleSymbolPage(t *testing.T) {
+	const w, h = 16, 4
+	samples := bytes.Repeat([]byte{0xFF}, 2*h)
+	samples[2] = 0x7F
+	e := NewJBIG2Encoder()
+	if _, err := e.AddPage(samples, w, h); err != nil {
+		t.Fatal(err)
+	}
+	globals, streams, err := e.Encode()
+	if err != nil || globals != nil {
+		t.Fatalf("Encode = %v, %v", globals, err)
+	}
+	checkJBIG2Pixels(t, decodeJBIG2Stream(t, streams[0], nil), samples, w, h)
+}
+
+func TestDecodeJBIG2RejectsTruncated(t *testing.T) {
+	enc, _ := EncodeJBIG2(bilevelPage(40, 10, 1), 40, 10)
+	if _, err := decodeJBIG2(enc[:len(enc)/2], nil); err == nil {
+		t.Fatal("expected error for truncated stream")
+	}
+}
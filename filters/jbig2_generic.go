@@ -0,0 +1,200 @@
+package filters
+
+// jbig2Bitmap is a packed bitmap in which 1 is black, as JBIG2 codes it.
+type jbig2Bitmap struct {
+	w, h, stride int
+	data         []byte
+}
+
+func newJBIG2Bitmap(w, h int) *jbig2Bitmap {
+	stride := (w + 7) / 8
+	return &jbig2Bitmap{w: w, h: h, stride: stride, data: make([]byte, stride*h)}
+}
+
+// get returns the pixel at (x, y); pixels outside the bitmap are 0.
+func (b *jbig2Bitmap) get(x, y int) int {
+	if x < 0 || y < 0 || x >= b.w || y >= b.h {
+		return 0
+	}
+	return int(b.data[y*b.stride+x>>3] >> (7 - uint(x&7)) & 1)
+}
+
+func (b *jbig2Bitmap) put(x, y, v int) {
+	mask := byte(0x80) >> uint(x&7)
+	if v != 0 {
+		b.data[y*b.stride+x>>3] |= mask
+	} else {
+		b.data[y*b.stride+x>>3] &^= mask
+	}
+}
+
+func (b *jbig2Bitmap) fill(v int) {
+	fill := byte(0)
+	if v != 0 {
+		fill = 0xFF
+	}
+	for i := range b.data {
+		b.data[i] = fill
+	}
+}
+
+// Combination operators of region segments (T.88 7.4.1.5).
+const (
+	jbig2OpOR = iota
+	jbig2OpAND
+	jbig2OpXOR
+	jbig2OpXNOR
+	jbig2OpReplace
+)
+
+// compose combines src into b with its top-left corner at (x, y).
+func (b *jbig2Bitmap) compose(src *jbig2Bitmap, x, y, op int) {
+	for sy := 0; sy < src.h; sy++ {
+		dy := y + sy
+		if dy < 0 || dy >= b.h {
+			continue
+		}
+		for sx := 0; sx < src.w; sx++ {
+			dx := x + sx
+			if dx < 0 || dx >= b.w {
+				continue
+			}
+			s, d := src.get(sx, sy), b.get(dx, dy)
+			switch op {
+			case jbig2OpOR:
+				d |= s
+			case jbig2OpAND:
+				d &= s
+			case jbig2OpXOR:
+				d ^= s
+			case jbig2OpXNOR:
+				d = 1 ^ d ^ s
+			default:
+				d = s
+			}
+			b.put(dx, dy, d)
+		}
+	}
+}
+
+// jbig2Generic holds the parameters of the generic region decoding
+// procedure (T.88 6.2) for arithmetic coding.
+type jbig2Generic struct {
+	template int
+	tpgdon   bool
+	// at holds the adaptive template pixels as x, y pairs.
+	at [4][2]int
+}
+
+// jbig2DefaultAT are the nominal adaptive template pixel positions of
+// template 0 (T.88 6.2.5.3), which the encoder always uses.
+var jbig2DefaultAT = [4][2]int{{3, -1}, {-3, -1}, {2, -2}, {-2, -2}}
+
+// jbig2Templates are the fixed pixels of each generic template, and
+// jbig2TemplateAT the number of adaptive ones it adds.
+var (
+	jbig2Templates = [4][][2]int{
+		{{-1, -2}, {0, -2}, {1, -2}, {-2, -1}, {-1, -1}, {0, -1}, {1, -1}, {2, -1}, {-4, 0}, {-3, 0}, {-2, 0}, {-1, 0}},
+		{{-1, -2}, {0, -2}, {1, -2}, {2, -2}, {-2, -1}, {-1, -1}, {0, -1}, {1, -1}, {2, -1}, {-3, 0}, {-2, 0}, {-1, 0}},
+		{{-1, -2}, {0, -2}, {1, -2}, {-2, -1}, {-1, -1}, {0, -1}, {1, -1}, {-2, 0}, {-1, 0}},
+		{{-3, -1}, {-2, -1}, {-1, -1}, {0, -1}, {1, -1}, {-4, 0}, {-3, 0}, {-2, 0}, {-1, 0}},
+	}
+	jbig2TemplateAT = [4]int{4, 1, 1, 1}
+	// jbig2TypicalContext is the context of the SLTP pseudo-pixel.
+	jbig2TypicalContext = [4]int{0x9B25, 0x0795, 0x00E5, 0x0195}
+)
+
+// newGenericContexts returns contexts for any generic template.
+func newGenericContexts() mqContexts { return make(mqContexts, 1<<16) }
+
+// code runs the generic region procedure over b. For each pixel, and for
+// the typical prediction bit of each row, it calls bit with the context
+// and the value b holds, and stores the value bit returns: an encoder
+// codes and returns the value, a decoder decodes one and ignores it.
+func (g jbig2Generic) code(b *jbig2Bitmap, cx mqContexts, bit func(cx mqContexts, i, v int) int) {
+	pixels := g.pixels()
+	fast := g.template == 0 && g.at == jbig2DefaultAT
+	ltp := 0
+	for y := 0; y < b.h; y++ {
+		if g.tpgdon {
+			typical := 1
+			for x := 0; x < b.w && typical == 1; x++ {
+				if b.get(x, y) != b.get(x, y-1) {
+					typical = 0
+				}
+			}
+			ltp ^= bit(cx, jbig2TypicalContext[g.template], typical^ltp)
+			if ltp == 1 {
+				for x := 0; x < b.w; x++ {
+					b.put(x, y, b.get(x, y-1))
+				}
+				continue
+			}
+		}
+		if fast {
+			g.codeRowFast(b, y, cx, bit)
+			continue
+		}
+		for x := 0; x < b.w; x++ {
+			ctx := 0
+			for _, p := range pixels {
+				ctx = ctx<<1 | b.get(x+p[0], y+p[1])
+			}
+			v := b.get(x, y)
+			if r := bit(cx, ctx, v); r != v {
+				b.put(x, y, r)
+			}
+		}
+	}
+}
+
+// codeRowFast codes a row with template 0 and the nominal adaptive pixels,
+// shifting the context along the row instead of gathering it per pixel.
+func (g jbig2Generic) codeRowFast(b *jbig2Bitmap, y int, cx mqContexts, bit func(cx mqContexts, i, v int) int) {
+	// c2 holds row y-2 from x-2 to x+2, c1 row y-1 from x-3 to x+3 and c0
+	// row y from x-4 to x-1; the adaptive pixels are their outer ends.
+	c2 := b.get(0, y-2)<<2 | b.get(1, y-2)<<1 | b.get(2, y-2)
+	c1 := b.get(0, y-1)<<3 | b.get(1, y-1)<<2 | b.get(2, y-1)<<1 | b.get(3, y-1)
+	c0 := 0
+	for x := 0; x < b.w; x++ {
+		v := b.get(x, y)
+		r := bit(cx, c2<<11|c1<<4|c0, v)
+		if r != v {
+			b.put(x, y, r)
+		}
+		c2 = (c2<<1 | b.get(x+3, y-2)) & 0x1F
+		c1 = (c1<<1 | b.get(x+4, y-1)) & 0x7F
+		c0 = (c0<<1 | r) & 0xF
+	}
+}
+
+// pixels returns the template pixels, adaptive ones included, in the
+// order they form the context: by row, then by column, most significant
+// first.
+func (g jbig2Generic) pixels() [][2]int {
+	out := append([][2]int(nil), jbig2Templates[g.template]...)
+	out = append(out, g.at[:jbig2TemplateAT[g.template]]...)
+	for i := 1; i < len(out); i++ {
+		for j := i; j > 0 && (out[j][1] < out[j-1][1] || out[j][1] == out[j-1][1] && out[j][0] < out[j-1][0]); j-- {
+			out[j], out[j-1] = out[j-1], out[j]
+		}
+	}
+	return out
+}
+
+// encode codes b with e.
+func (g jbig2Generic) encode(e *mqEncoder, b *jbig2Bitmap, cx mqContexts) {
+	g.code(b, cx, func(cx mqContexts, i, v int) int {
+		e.encode(cx, i, v)
+		return v
+	})
+}
+
+// decode decodes a w by h bitmap with d.
+func (g jbig2Generic) decode(d *mqDecoder, w, h int, cx mqContexts) *jbig2Bitmap {
+	b := newJBIG2Bitmap(w, h)
+	g.code(b, cx, func(cx mqContexts, i, _ int) int {
+		return d.decode(cx, i)
+	})
+	return b
+}
@@ -0,0 +1,329 @@
+package filters
+
+// mqState is a row of the MQ coder's probability estimation table (T.88
+// Table E.1).
+type mqState struct {
+	qe         uint32
+	nmps, nlps uint8
+	switchMPS  bool
+}
+
+var mqTable = [47]mqState{
+	{0x5601, 1, 1, true}, {0x3401, 2, 6, false}, {0x1801, 3, 9, false}, {0x0AC1, 4, 12, false},
+	{0x0521, 5, 29, false}, {0x0221, 38, 33, false}, {0x5601, 7, 6, true}, {0x5401, 8, 14, false},
+	{0x4801, 9, 14, false}, {0x3801, 10, 14, false}, {0x3001, 11, 17, false}, {0x2401, 12, 18, false},
+	{0x1C01, 13, 20, false}, {0x1601, 29, 21, false}, {0x5601, 15, 14, true}, {0x5401, 16, 14, false},
+	{0x5101, 17, 15, false}, {0x4801, 18, 16, false}, {0x3801, 19, 17, false}, {0x3401, 20, 18, false},
+	{0x3001, 21, 19, false}, {0x2801, 22, 19, false}, {0x2401, 23, 20, false}, {0x2201, 24, 21, false},
+	{0x1C01, 25, 22, false}, {0x1801, 26, 23, false}, {0x1601, 27, 24, false}, {0x1401, 28, 25, false},
+	{0x1201, 29, 26, false}, {0x1101, 30, 27, false}, {0x0AC1, 31, 28, false}, {0x09C1, 32, 29, false},
+	{0x08A1, 33, 30, false}, {0x0521, 34, 31, false}, {0x0441, 35, 32, false}, {0x02A1, 36, 33, false},
+	{0x0221, 37, 34, false}, {0x0141, 38, 35, false}, {0x0111, 39, 36, false}, {0x0085, 40, 37, false},
+	{0x0049, 41, 38, false}, {0x0025, 42, 39, false}, {0x0015, 43, 40, false}, {0x0009, 44, 41, false},
+	{0x0005, 45, 42, false}, {0x0001, 45, 43, false}, {0x5601, 46, 46, false},
+}
+
+// mqContexts holds the adaptive state of a set of contexts: the index into
+// mqTable shifted left once, with the more probable symbol in the low bit.
+type mqContexts []uint8
+
+// mqEncoder is the arithmetic encoder of T.88 Annex E.2.
+type mqEncoder struct {
+	a, c uint32
+	ct   uint
+	b    byte
+	// bp counts the bytes before b; b starts as a byte preceding the
+	// output that is never emitted.
+	bp  int
+	out []byte
+}
+
+func newMQEncoder() *mqEncoder {
+	return &mqEncoder{a: 0x8000, ct: 12, bp: -1}
+}
+
+func (e *mqEncoder) encode(cx mqContexts, i int, d int) {
+	s := &mqTable[cx[i]>>1]
+	mps := int(cx[i] & 1)
+	e.a -= s.qe
+	if d == mps {
+		if e.a&0x8000 != 0 {
+			e.c += s.qe
+			return
+		}
+		if e.a < s.qe {
+			e.a = s.qe
+		} else {
+			e.c += s.qe
+		}
+		cx[i] = s.nmps<<1 | uint8(mps)
+	} else {
+		if e.a < s.qe {
+			e.c += s.qe
+		} else {
+			e.a = s.qe
+		}
+		if s.switchMPS {
+			mps = 1 - mps
+		}
+		cx[i] = s.nlps<<1 | uint8(mps)
+	}
+	for {
+		e.a <<= 1
+		e.c <<= 1
+		e.ct--
+		if e.ct == 0 {
+			e.byteOut()
+		}
+		if e.a&0x8000 != 0 {
+			return
+		}
+	}
+}
+
+func (e *mqEncoder) emit() {
+	if e.bp >= 0 {
+		e.out = append(e.out, e.b)
+	}
+	e.bp++
+}
+
+func (e *mqEncoder) byteOut() {
+	if e.b != 0xFF && e.c >= 0x8000000 {
+		// Propagate the carry into the previous byte.
+		e.b++
+		if e.b == 0xFF {
+			e.c &= 0x7FFFFFF
+		}
+	}
+	e.emit()
+	if e.b == 0xFF {
+		// Bit stuffing: a byte following 0xFF carries seven bits.
+		e.b = byte(e.c >> 20)
+		e.c &= 0xFFFFF
+		e.ct = 7
+		return
+	}
+	e.b = byte(e.c >> 19)
+	e.c &= 0x7FFFF
+	e.ct = 8
+}
+
+// flush terminates the code stream with the 0xFFAC marker and returns it.
+func (e *mqEncoder) flush() []byte {
+	temp := e.c + e.a
+	e.c |= 0xFFFF
+	if e.c >= temp {
+		e.c -= 0x8000
+	}
+	e.c <<= e.ct
+	e.byteOut()
+	e.c <<= e.ct
+	e.byteOut()
+	e.emit()
+	if e.b != 0xFF {
+		e.b = 0xFF
+		e.emit()
+	}
+	e.b = 0xAC
+	e.emit()
+	return e.out
+}
+
+// mqDecoder is the arithmetic decoder of T.88 Annex E.3.
+type mqDecoder struct {
+	data        []byte
+	bp          int
+	chigh, clow uint32
+	ct          int
+	a           uint32
+}
+
+func newMQDecoder(data []byte) *mqDecoder {
+	d := &mqDecoder{data: data}
+	d.chigh = uint32(d.at(0))
+	d.byteIn()
+	d.chigh = (d.chigh<<7)&0xFFFF | (d.clow>>9)&0x7F
+	d.clow = (d.clow << 7) & 0xFFFF
+	d.ct -= 7
+	d.a = 0x8000
+	return d
+}
+
+// at returns the byte at i; past the end of the data the decoder reads
+// 0xFF as T.88 prescribes.
+func (d *mqDecoder) at(i int) byte {
+	if i < len(d.data) {
+		return d.data[i]
+	}
+	return 0xFF
+}
+
+func (d *mqDecoder) byteIn() {
+	switch {
+	case d.at(d.bp) != 0xFF:
+		d.bp++
+		d.clow += uint32(d.at(d.bp)) << 8
+		d.ct = 8
+	case d.at(d.bp+1) > 0x8F:
+		d.clow += 0xFF00
+		d.ct = 8
+	default:
+		d.bp++
+		d.clow += uint32(d.at(d.bp)) << 9
+		d.ct = 7
+	}
+	if d.clow > 0xFFFF {
+		d.chigh += d.clow >> 16
+		d.clow &= 0xFFFF
+	}
+}
+
+func (d *mqDecoder) decode(cx mqContexts, i int) int {
+	s := &mqTable[cx[i]>>1]
+	mps := int(cx[i] & 1)
+	a := d.a - s.qe
+	var bit int
+	if d.chigh < s.qe {
+		if a < s.qe {
+			bit = mps
+			cx[i] = s.nmps<<1 | uint8(mps)
+		} else {
+			bit = 1 - mps
+			if s.switchMPS {
+				mps = bit
+			}
+			cx[i] = s.nlps<<1 | uint8(mps)
+		}
+		a = s.qe
+	} else {
+		d.chigh -= s.qe
+		if a&0x8000 != 0 {
+			d.a = a
+			return mps
+		}
+		if a < s.qe {
+			bit = 1 - mps
+			if s.switchMPS {
+				mps = bit
+			}
+			cx[i] = s.nlps<<1 | uint8(mps)
+		} else {
+			bit = mps
+			cx[i] = s.nmps<<1 | uint8(mps)
+		}
+	}
+	for {
+		if d.ct == 0 {
+			d.byteIn()
+		}
+		a <<= 1
+		d.chigh = (d.chigh<<1)&0xFFFF | (d.clow>>15)&1
+		d.clow = (d.clow << 1) & 0xFFFF
+		d.ct--
+		if a&0x8000 != 0 {
+			break
+		}
+	}
+	d.a = a
+	return bit
+}
+
+// mqIntRanges are the value ranges of the integer coding procedure
+// (T.88 Table A.1), each introduced by a prefix of ones ended by a zero
+// except in the last range.
+var mqIntRanges = [...]struct {
+	low  int
+	bits int
+}{
+	{0, 2}, {4, 4}, {20, 6}, {84, 8}, {340, 12}, {4436, 32},
+}
+
+// newIntContexts returns the contexts of one integer coding procedure
+// (IADH, IADW, IAEX and so on).
+func newIntContexts() mqContexts { return make(mqContexts, 512) }
+
+// intContext advances the PREV value of the integer coding procedure.
+func intContext(prev, bit int) int {
+	if prev < 256 {
+		return prev<<1 | bit
+	}
+	return (prev<<1|bit)&511 | 256
+}
+
+// encodeInt codes v with the integer arithmetic coding procedure of T.88
+// Annex A.2, or the out-of-band value when oob is set.
+func (e *mqEncoder) encodeInt(cx mqContexts, v int, oob bool) {
+	prev := 1
+	put := func(bit int) {
+		e.encode(cx, prev, bit)
+		prev = intContext(prev, bit)
+	}
+	sign := 0
+	if v < 0 || oob {
+		sign, v = 1, -v
+	}
+	if oob {
+		v = 0
+	}
+	put(sign)
+	r := 0
+	for r < len(mqIntRanges)-1 && v >= mqIntRanges[r+1].low {
+		put(1)
+		r++
+	}
+	if r < len(mqIntRanges)-1 {
+		put(0)
+	}
+	v -= mqIntRanges[r].low
+	for i := mqIntRanges[r].bits - 1; i >= 0; i-- {
+		put(v >> uint(i) & 1)
+	}
+}
+
+// decodeInt decodes a value coded by encodeInt, reporting false for the
+// out-of-band value.
+func (d *mqDecoder) decodeInt(cx mqContexts) (int, bool) {
+	prev := 1
+	get := func() int {
+		bit := d.decode(cx, prev)
+		prev = intContext(prev, bit)
+		return bit
+	}
+	sign := get()
+	r := 0
+	for r < len(mqIntRanges)-1 && get() == 1 {
+		r++
+	}
+	v := 0
+	for i := 0; i < mqIntRanges[r].bits; i++ {
+		v = v<<1 | get()
+	}
+	v += mqIntRanges[r].low
+	if sign == 1 {
+		if v == 0 {
+			return 0, false
+		}
+		v = -v
+	}
+	return v, true
+}
+
+// encodeID codes a symbol ID of n bits with the IAID procedure (T.88
+// Annex A.3).
+func (e *mqEncoder) encodeID(cx mqContexts, n int, id int) {
+	prev := 1
+	for i := n - 1; i >= 0; i-- {
+		bit := id >> uint(i) & 1
+		e.encode(cx, prev, bit)
+		prev = prev<<1 | bit
+	}
+}
+
+func (d *mqDecoder) decodeID(cx mqContexts, n int) int {
+	prev := 1
+	for i := 0; i < n; i++ {
+		prev = prev<<1 | d.decode(cx, prev)
+	}
+	return prev - 1<<uint(n)
+}
@@ -10,10 +10,13 @@ import (
 
 // CFF represents a parsed Compact Font Format structure.
 type CFF struct {
-	Header   CFFHeader
-	Names    []string
-	TopDicts []map[int][]Operand // Key is operator, value is operands
-	Strings  []string
+	Header      CFFHeader
+	Names       []string
+	TopDicts    []map[int][]Operand // Key is operator, value is operands
+	Strings     []string
+	GlobalSubrs [][]byte
+
+	data []byte
 }
 
 type CFFHeader struct {
@@ -77,11 +80,17 @@ func ParseCFF(data []byte) (*CFF, error) {
 		strings[i] = string(b)
 	}
 
+	// Global Subr INDEX; tolerate truncated programs that stop after the
+	// String INDEX.
+	globalSubrs, _ := readIndex(r)
+
 	return &CFF{
-		Header:   hdr,
-		Names:    nameStrings,
-		TopDicts: topDicts,
-		Strings:  strings,
+		Header:      hdr,
+		Names:       nameStrings,
+		TopDicts:    topDicts,
+		Strings:     strings,
+		GlobalSubrs: globalSubrs,
+		data:        data,
 	}, nil
 }
 
@@ -98,8 +107,11 @@ func readIndex(r *bytes.Reader) ([][]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if offSize < 1 || offSize > 4 {
+		return nil, fmt.Errorf("invalid index offset size %d", offSize)
+	}
 
-	offsets := make([]int, count+1)
+	offsets := make([]int, int(count)+1)
 	for i := 0; i <= int(count); i++ {
 		off, err := readOffset(r, int(offSize))
 		if err != nil {
@@ -109,6 +121,9 @@ func readIndex(r *bytes.Reader) ([][]byte, error) {
 	}
 
 	totalSize := offsets[count] - 1 // Offsets are 1-based relative to data start
+	if totalSize < 0 || totalSize > r.Len() {
+		return nil, fmt.Errorf("invalid index size %d", totalSize)
+	}
 
 	data := make([]byte, totalSize)
 	if _, err := io.ReadFull(r, data); err != nil {
@@ -0,0 +1,429 @@
+package fonts
+
+import (
+	"errors"
+	"math"
+)
+
+const (
+	maxCharstringStack = 48
+	maxSubrDepth       = 10
+)
+
+var errCharstring = errors.New("cff: malformed charstring")
+
+// type2Interp executes Type 2 charstrings (Adobe Technical Note #5177).
+type type2Interp struct {
+	font      *CFFFont
+	priv      *cffPrivate
+	pen       outlinePen
+	stack     []float64
+	transient [32]float64
+	nStems    int
+	haveWidth bool
+	width     float64
+	ended     bool
+	seac      *[4]float64
+	onSubr    func(global bool, idx int) // observes subroutine calls
+}
+
+func subrBias(n int) int {
+	switch {
+	case n < 1240:
+		return 107
+	case n < 33900:
+		return 1131
+	default:
+		return 32768
+	}
+}
+
+func (it *type2Interp) takeWidth(expected int, oddMeansWidth bool) {
+	if it.haveWidth {
+		return
+	}
+	it.haveWidth = true
+	it.width = it.priv.defaultWidthX
+	hasExtra := len(it.stack) > expected
+	if oddMeansWidth {
+		hasExtra = len(it.stack)%2 == 1
+	}
+	if hasExtra && len(it.stack) > 0 {
+		it.width = it.priv.nominalWidthX + it.stack[0]
+		it.stack = it.stack[1:]
+	}
+}
+
+func (it *type2Interp) push(v float64) error {
+	if len(it.stack) >= maxCharstringStack {
+		return errCharstring
+	}
+	it.stack = append(it.stack, v)
+	return nil
+}
+
+func (it *type2Interp) run(cs []byte, depth int) error {
+	if depth > maxSubrDepth {
+		return errCharstring
+	}
+	p := &it.pen
+	for i := 0; i < len(cs) && !it.ended; {
+		b := cs[i]
+		i++
+		switch {
+		case b >= 32 && b <= 246:
+			if err := it.push(float64(int(b) - 139)); err != nil {
+				return err
+			}
+			continue
+		case b >= 247 && b <= 250:
+			if i >= len(cs) {
+				return errCharstring
+			}
+			if err := it.push(float64((int(b)-247)*256 + int(cs[i]) + 108)); err != nil {
+				return err
+			}
+			i++
+			continue
+		case b >= 251 && b <= 254:
+			if i >= len(cs) {
+				return errCharstring
+			}
+			if err := it.push(float64(-(int(b)-251)*256 - int(cs[i]) - 108)); err != nil {
+				return err
+			}
+			i++
+			continue
+		case b == 28:
+			if i+1 >= len(cs) {
+				return errCharstring
+			}
+			if err := it.push(float64(int16(uint16(cs[i])<<8 | uint16(cs[i+1])))); err != nil {
+				return err
+			}
+			i += 2
+			continue
+		case b == 255:
+			if i+3 >= len(cs) {
+				return errCharstring
+			}
+			v := int32(uint32(cs[i])<<24 | uint32(cs[i+1])<<16 | uint32(cs[i+2])<<8 | uint32(cs[i+3]))
+			if err := it.push(float64(v) / 65536); err != nil {
+				return err
+			}
+			i += 4
+			continue
+		}
+
+		s := it.stack
+		switch b {
+		case 1, 3, 18, 23: // hstem, vstem, hstemhm, vstemhm
+			it.takeWidth(0, true)
+			it.nStems += len(it.stack) / 2
+		case 19, 20: // hintmask, cntrmask
+			it.takeWidth(0, true)
+			it.nStems += len(it.stack) / 2
+			i += (it.nStems + 7) / 8
+		case 21: // rmoveto
+			it.takeWidth(2, false)
+			s = it.stack
+			if len(s) < 2 {
+				return errCharstring
+			}
+			p.moveTo(p.x+s[0], p.y+s[1])
+		case 22: // hmoveto
+			it.takeWidth(1, false)
+			s = it.stack
+			if len(s) < 1 {
+				return errCharstring
+			}
+			p.moveTo(p.x+s[0], p.y)
+		case 4: // vmoveto
+			it.takeWidth(1, false)
+			s = it.stack
+			if len(s) < 1 {
+				return errCharstring
+			}
+			p.moveTo(p.x, p.y+s[0])
+		case 5: // rlineto
+			for k := 0; k+1 < len(s); k += 2 {
+				p.lineTo(p.x+s[k], p.y+s[k+1])
+			}
+		case 6, 7: // hlineto, vlineto
+			horiz := b == 6
+			for k := 0; k < len(s); k++ {
+				if horiz {
+					p.lineTo(p.x+s[k], p.y)
+				} else {
+					p.lineTo(p.x, p.y+s[k])
+				}
+				horiz = !horiz
+			}
+		case 8: // rrcurveto
+			for k := 0; k+5 < len(s); k += 6 {
+				it.curve(s[k], s[k+1], s[k+2], s[k+3], s[k+4], s[k+5])
+			}
+		case 24: // rcurveline
+			k := 0
+			for ; k+7 < len(s); k += 6 {
+				it.curve(s[k], s[k+1], s[k+2], s[k+3], s[k+4], s[k+5])
+			}
+			if k+1 < len(s) {
+				p.lineTo(p.x+s[k], p.y+s[k+1])
+			}
+		case 25: // rlinecurve
+			k := 0
+			for ; k+7 < len(s); k += 2 {
+				p.lineTo(p.x+s[k], p.y+s[k+1])
+			}
+			if k+5 < len(s) {
+				it.curve(s[k], s[k+1], s[k+2], s[k+3], s[k+4], s[k+5])
+			}
+		case 26: // vvcurveto
+			k, dx1 := 0, 0.0
+			if len(s)%2 == 1 {
+				dx1, k = s[0], 1
+			}
+			for ; k+3 < len(s); k += 4 {
+				it.curve(dx1, s[k], s[k+1], s[k+2], 0, s[k+3])
+				dx1 = 0
+			}
+		case 27: // hhcurveto
+			k, dy1 := 0, 0.0
+			if len(s)%2 == 1 {
+				dy1, k = s[0], 1
+			}
+			for ; k+3 < len(s); k += 4 {
+				it.curve(s[k], dy1, s[k+1], s[k+2], s[k+3], 0)
+				dy1 = 0
+			}
+		case 30, 31: // vhcurveto, hvcurveto
+			horiz := b == 31
+			for k := 0; k+3 < len(s); k += 4 {
+				last := 0.0
+				if k+5 == len(s) {
+					last = s[k+4]
+				}
+				if horiz {
+					it.curve(s[k], 0, s[k+1], s[k+2], last, s[k+3])
+				} else {
+					it.curve(0, s[k], s[k+1], s[k+2], s[k+3], last)
+				}
+				horiz = !horiz
+			}
+		case 10, 29: // callsubr, callgsubr
+			if len(s) == 0 {
+				return errCharstring
+			}
+			subrs := it.priv.subrs
+			if b == 29 {
+				subrs = it.font.cff.GlobalSubrs
+			}
+			idx := int(s[len(s)-1]) + subrBias(len(subrs))
+			it.stack = s[:len(s)-1]
+			if idx < 0 || idx >= len(subrs) {
+				return errCharstring
+			}
+			if it.onSubr != nil {
+				it.onSubr(b == 29, idx)
+			}
+			if err := it.run(subrs[idx], depth+1); err != nil {
+				return err
+			}
+			continue
+		case 11: // return
+			return nil
+		case 14: // endchar
+			// A width operand is present when 1 or 5 operands remain.
+			it.takeWidth(0, true)
+			s = it.stack
+			if len(s) >= 4 {
+				it.seac = &[4]float64{s[len(s)-4], s[len(s)-3], s[len(s)-2], s[len(s)-1]}
+			}
+			it.ended = true
+		case 12:
+			if i >= len(cs) {
+				return errCharstring
+			}
+			esc := cs[i]
+			i++
+			if err := it.escape(esc); err != nil {
+				return err
+			}
+			continue
+		}
+		it.stack = it.stack[:0]
+	}
+	return nil
+}
+
+// curve appends a relative cubic Bézier.
+func (it *type2Interp) curve(dx1, dy1, dx2, dy2, dx3, dy3 float64) {
+	p := &it.pen
+	c1x, c1y := p.x+dx1, p.y+dy1
+	c2x, c2y := c1x+dx2, c1y+dy2
+	p.cubeTo(c1x, c1y, c2x, c2y, c2x+dx3, c2y+dy3)
+}
+
+func (it *type2Interp) escape(op byte) error {
+	s := it.stack
+	pop := func() float64 {
+		if len(it.stack) == 0 {
+			return 0
+		}
+		v := it.stack[len(it.stack)-1]
+		it.stack = it.stack[:len(it.stack)-1]
+		return v
+	}
+	b2f := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	p := &it.pen
+	switch op {
+	case 34: // hflex
+		if len(s) < 7 {
+			return errCharstring
+		}
+		y0 := p.y
+		it.curve(s[0], 0, s[1], s[2], s[3], 0)
+		it.curve(s[4], 0, s[5], y0-p.y, s[6], 0)
+	case 35: // flex
+		if len(s) < 12 {
+			return errCharstring
+		}
+		it.curve(s[0], s[1], s[2], s[3], s[4], s[5])
+		it.curve(s[6], s[7], s[8], s[9], s[10], s[11])
+	case 36: // hflex1
+		if len(s) < 9 {
+			return errCharstring
+		}
+		y0 := p.y
+		it.curve(s[0], s[1], s[2], s[3], s[4], 0)
+		c1x, c1y := p.x+s[5], p.y
+		c2x, c2y := c1x+s[6], c1y+s[7]
+		p.cubeTo(c1x, c1y, c2x, c2y, c2x+s[8], y0)
+	case 37: // flex1
+		if len(s) < 11 {
+			return errCharstring
+		}
+		x0, y0 := p.x, p.y
+		dx := s[0] + s[2] + s[4] + s[6] + s[8]
+		dy := s[1] + s[3] + s[5] + s[7] + s[9]
+		it.curve(s[0], s[1], s[2], s[3], s[4], s[5])
+		c1x, c1y := p.x+s[6], p.y+s[7]
+		c2x, c2y := c1x+s[8], c1y+s[9]
+		if math.Abs(dx) > math.Abs(dy) {
+			p.cubeTo(c1x, c1y, c2x, c2y, c2x+s[10], y0)
+		} else {
+			p.cubeTo(c1x, c1y, c2x, c2y, x0, c2y+s[10])
+		}
+	case 3: // and
+		b, a := pop(), pop()
+		it.stack = append(it.stack, b2f(a != 0 && b != 0))
+		return nil
+	case 4: // or
+		b, a := pop(), pop()
+		it.stack = append(it.stack, b2f(a != 0 || b != 0))
+		return nil
+	case 5: // not
+		a := pop()
+		it.stack = append(it.stack, b2f(a == 0))
+		return nil
+	case 9: // abs
+		it.stack = append(it.stack, math.Abs(pop()))
+		return nil
+	case 10: // add
+		b, a := pop(), pop()
+		it.stack = append(it.stack, a+b)
+		return nil
+	case 11: // sub
+		b, a := pop(), pop()
+		it.stack = append(it.stack, a-b)
+		return nil
+	case 12: // div
+		b, a := pop(), pop()
+		if b == 0 {
+			it.stack = append(it.stack, 0)
+		} else {
+			it.stack = append(it.stack, a/b)
+		}
+		return nil
+	case 14: // neg
+		it.stack = append(it.stack, -pop())
+		return nil
+	case 15: // eq
+		b, a := pop(), pop()
+		it.stack = append(it.stack, b2f(a == b))
+		return nil
+	case 18: // drop
+		pop()
+		return nil
+	case 20: // put
+		idx, v := pop(), pop()
+		if i := int(idx); i >= 0 && i < len(it.transient) {
+			it.transient[i] = v
+		}
+		return nil
+	case 21: // get
+		idx := int(pop())
+		v := 0.0
+		if idx >= 0 && idx < len(it.transient) {
+			v = it.transient[idx]
+		}
+		it.stack = append(it.stack, v)
+		return nil
+	case 22: // ifelse
+		v2, v1, s2, s1 := pop(), pop(), pop(), pop()
+		if v1 <= v2 {
+			it.stack = append(it.stack, s1)
+		} else {
+			it.stack = append(it.stack, s2)
+		}
+		return nil
+	case 23: // random
+		it.stack = append(it.stack, 0.5)
+		return nil
+	case 24: // mul
+		b, a := pop(), pop()
+		it.stack = append(it.stack, a*b)
+		return nil
+	case 26: // sqrt
+		it.stack = append(it.stack, math.Sqrt(math.Abs(pop())))
+		return nil
+	case 27: // dup
+		if len(it.stack) == 0 {
+			return errCharstring
+		}
+		it.stack = append(it.stack, it.stack[len(it.stack)-1])
+		return nil
+	case 28: // exch
+		b, a := pop(), pop()
+		it.stack = append(it.stack, b, a)
+		return nil
+	case 29: // index
+		idx := int(pop())
+		if idx < 0 {
+			idx = 0
+		}
+		if idx >= len(it.stack) {
+			return errCharstring
+		}
+		it.stack = append(it.stack, it.stack[len(it.stack)-1-idx])
+		return nil
+	case 30: // roll
+		j, n := int(pop()), int(pop())
+		if n <= 0 || n > len(it.stack) {
+			return nil
+		}
+		seg := it.stack[len(it.stack)-n:]
+		j = ((j % n) + n) % n
+		rolled := append(append([]float64{}, seg[n-j:]...), seg[:n-j]...)
+		copy(seg, rolled)
+		return nil
+	}
+	it.stack = it.stack[:0]
+	return nil
+}
@@ -0,0 +1,436 @@
+package fonts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// CFFFont exposes the glyph programs of a bare CFF font program as embedded
+// with FontFile3 /Subtype /Type1C or /CIDFontType0C.
+type CFFFont struct {
+	Name string
+
+	cff         *CFF
+	fontMatrix  [6]float64
+	charStrings [][]byte
+	charset     []int // gid -> SID (name-keyed) or CID (CID-keyed)
+	isCID       bool
+	private     cffPrivate
+	fdPrivates  []cffPrivate
+	fdSelect    func(gid int) int
+	encoding    map[int]int // built-in code -> gid
+	byName      map[string]int
+	byCID       map[int]int
+}
+
+type cffPrivate struct {
+	subrs         [][]byte
+	defaultWidthX float64
+	nominalWidthX float64
+}
+
+// CFF DICT operators used when loading glyph programs.
+const (
+	cffOpCharset     = 15
+	cffOpEncoding    = 16
+	cffOpCharStrings = 17
+	cffOpPrivate     = 18
+	cffOpSubrs       = 19
+	cffOpDefaultW    = 20
+	cffOpNominalW    = 21
+	cffOpFontMatrix  = 1207
+	cffOpROS         = 1230
+	cffOpFDArray     = 1236
+	cffOpFDSelect    = 1237
+)
+
+// ParseCFFFont parses the first font of a CFF program including its
+// charstrings, charset, encoding and private dictionaries.
+func ParseCFFFont(data []byte) (*CFFFont, error) {
+	cff, err := ParseCFF(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(cff.TopDicts) == 0 {
+		return nil, errors.New("cff: no top dict")
+	}
+	top := cff.TopDicts[0]
+	f := &CFFFont{
+		cff:        cff,
+		fontMatrix: [6]float64{0.001, 0, 0, 0.001, 0, 0},
+		fdSelect:   func(int) int { return 0 },
+	}
+	if len(cff.Names) > 0 {
+		f.Name = cff.Names[0]
+	}
+	if fm := top[cffOpFontMatrix]; len(fm) == 6 {
+		for i, op := range fm {
+			f.fontMatrix[i] = op.value()
+		}
+	}
+	csOff := dictInt(top, cffOpCharStrings, 0)
+	if csOff <= 0 {
+		return nil, errors.New("cff: missing CharStrings")
+	}
+	f.charStrings, err = indexAt(data, csOff)
+	if err != nil {
+		return nil, fmt.Errorf("cff: read CharStrings: %w", err)
+	}
+	_, f.isCID = top[cffOpROS]
+
+	if f.isCID {
+		fdArrayOff := dictInt(top, cffOpFDArray, 0)
+		fds, err := indexAt(data, fdArrayOff)
+		if err != nil {
+			return nil, fmt.Errorf("cff: read FDArray: %w", err)
+		}
+		for _, fdData := range fds {
+			fd, err := parseDict(fdData)
+			if err != nil {
+				return nil, fmt.Errorf("cff: parse font dict: %w", err)
+			}
+			f.fdPrivates = append(f.fdPrivates, readPrivate(data, fd))
+		}
+		if off := dictInt(top, cffOpFDSelect, 0); off > 0 {
+			f.fdSelect = parseFDSelect(data, off, len(f.charStrings))
+		}
+	} else {
+		f.private = readPrivate(data, top)
+	}
+
+	f.charset = parseCharset(data, dictInt(top, cffOpCharset, 0), len(f.charStrings))
+	if f.isCID {
+		f.byCID = make(map[int]int, len(f.charset))
+		for gid, cid := range f.charset {
+			f.byCID[cid] = gid
+		}
+	} else {
+		f.byName = make(map[string]int, len(f.charset))
+		for gid, sid := range f.charset {
+			name := f.sidString(sid)
+			if _, ok := f.byName[name]; !ok {
+				f.byName[name] = gid
+			}
+		}
+		f.encoding = f.parseEncoding(data, dictInt(top, cffOpEncoding, 0))
+	}
+	return f, nil
+}
+
+// NumGlyphs reports the number of charstrings.
+func (f *CFFFont) NumGlyphs() int { return len(f.charStrings) }
+
+// UnitsPerEm derives the glyph space resolution from the FontMatrix.
+func (f *CFFFont) UnitsPerEm() float64 {
+	if f.fontMatrix[0] != 0 {
+		return 1 / f.fontMatrix[0]
+	}
+	return 1000
+}
+
+// FontMatrix returns the top-level FontMatrix.
+func (f *CFFFont) FontMatrix() [6]float64 { return f.fontMatrix }
+
+// IsCID reports whether the font is CID-keyed.
+func (f *CFFFont) IsCID() bool { return f.isCID }
+
+// GlyphName returns the glyph name of gid for name-keyed fonts.
+func (f *CFFFont) GlyphName(gid int) string {
+	if f.isCID || gid < 0 || gid >= len(f.charset) {
+		return ""
+	}
+	return f.sidString(f.charset[gid])
+}
+
+// GlyphIndexByName looks up a glyph by name in name-keyed fonts.
+func (f *CFFFont) GlyphIndexByName(name string) (int, bool) {
+	gid, ok := f.byName[name]
+	return gid, ok
+}
+
+// GlyphIndexByCID maps a CID to a glyph index. Name-keyed fonts treat the
+// CID as a glyph index.
+func (f *CFFFont) GlyphIndexByCID(cid int) (int, bool) {
+	if !f.isCID {
+		return cid, cid >= 0 && cid < len(f.charStrings)
+	}
+	gid, ok := f.byCID[cid]
+	return gid, ok
+}
+
+// GlyphIndexByCode maps a single-byte code through the font's built-in
+// encoding.
+func (f *CFFFont) GlyphIndexByCode(code int) (int, bool) {
+	gid, ok := f.encoding[code]
+	return gid, ok
+}
+
+// Outline interprets the Type 2 charstring of gid.
+func (f *CFFFont) Outline(gid int) (*GlyphOutline, error) {
+	if gid < 0 || gid >= len(f.charStrings) {
+		return nil, fmt.Errorf("cff: glyph %d out of range", gid)
+	}
+	priv := &f.private
+	if f.isCID {
+		fd := f.fdSelect(gid)
+		if fd < 0 || fd >= len(f.fdPrivates) {
+			return nil, fmt.Errorf("cff: invalid font dict %d", fd)
+		}
+		priv = &f.fdPrivates[fd]
+	}
+	it := &type2Interp{font: f, priv: priv}
+	if err := it.run(f.charStrings[gid], 0); err != nil {
+		return nil, err
+	}
+	out := &GlyphOutline{Segments: it.pen.segs, Advance: it.width}
+	if it.seac != nil {
+		return f.composeSeac(out, it.seac[0], it.seac[1], int(it.seac[2]), int(it.seac[3]))
+	}
+	return out, nil
+}
+
+func (f *CFFFont) composeSeac(out *GlyphOutline, adx, ady float64, bchar, achar int) (*GlyphOutline, error) {
+	if bchar < 0 || bchar > 255 || achar < 0 || achar > 255 {
+		return out, nil
+	}
+	base, ok := f.byName[StandardEncoding[bchar]]
+	if !ok {
+		return out, nil
+	}
+	accent, ok := f.byName[StandardEncoding[achar]]
+	if !ok {
+		return out, nil
+	}
+	bo, err := f.Outline(base)
+	if err != nil {
+		return nil, err
+	}
+	ao, err := f.Outline(accent)
+	if err != nil {
+		return nil, err
+	}
+	segs := append(append([]OutlineSegment{}, bo.Segments...), translateSegments(ao.Segments, adx, ady)...)
+	return &GlyphOutline{Segments: segs, Advance: out.Advance}, nil
+}
+
+func (f *CFFFont) sidString(sid int) string {
+	s, _ := f.lookupSID(sid)
+	return s
+}
+
+// lookupSID resolves a SID and reports whether it names a standard string
+// or an entry of the String INDEX.
+func (f *CFFFont) lookupSID(sid int) (string, bool) {
+	if sid < 0 {
+		return "", false
+	}
+	if sid < len(cffStandardStrings) {
+		return cffStandardStrings[sid], true
+	}
+	if idx := sid - len(cffStandardStrings); idx < len(f.cff.Strings) {
+		return f.cff.Strings[idx], true
+	}
+	return "", false
+}
+
+func (f *CFFFont) parseEncoding(data []byte, off int) map[int]int {
+	enc := make(map[int]int)
+	switch off {
+	case 0:
+		for code, name := range StandardEncoding {
+			if name == "" {
+				continue
+			}
+			if gid, ok := f.byName[name]; ok {
+				enc[code] = gid
+			}
+		}
+		return enc
+	case 1:
+		return enc // Expert encoding: rarely used in PDFs; rely on /Encoding.
+	}
+	if off < 0 || off >= len(data) {
+		return enc
+	}
+	format := data[off]
+	p := off + 1
+	switch format & 0x7f {
+	case 0:
+		if p >= len(data) {
+			return enc
+		}
+		n := int(data[p])
+		p++
+		for i := 0; i < n && p < len(data); i++ {
+			enc[int(data[p])] = i + 1
+			p++
+		}
+	case 1:
+		if p >= len(data) {
+			return enc
+		}
+		n := int(data[p])
+		p++
+		gid := 1
+		for i := 0; i < n && p+1 < len(data); i++ {
+			first, left := int(data[p]), int(data[p+1])
+			p += 2
+			for c := first; c <= first+left && c < 256; c++ {
+				enc[c] = gid
+				gid++
+			}
+		}
+	}
+	if format&0x80 != 0 && p < len(data) {
+		n := int(data[p])
+		p++
+		for i := 0; i < n && p+2 < len(data); i++ {
+			code := int(data[p])
+			sid := int(binary.BigEndian.Uint16(data[p+1:]))
+			p += 3
+			if gid, ok := f.byName[f.sidString(sid)]; ok {
+				enc[code] = gid
+			}
+		}
+	}
+	return enc
+}
+
+func (o Operand) value() float64 {
+	if o.IsInt {
+		return float64(o.Int)
+	}
+	return o.Float
+}
+
+func dictInt(d map[int][]Operand, op int, def int) int {
+	ops := d[op]
+	if len(ops) == 0 {
+		return def
+	}
+	return int(ops[len(ops)-1].value())
+}
+
+func indexAt(data []byte, off int) ([][]byte, error) {
+	if off < 0 || off >= len(data) {
+		return nil, fmt.Errorf("offset %d out of range", off)
+	}
+	r := bytes.NewReader(data)
+	if _, err := r.Seek(int64(off), 0); err != nil {
+		return nil, err
+	}
+	return readIndex(r)
+}
+
+func readPrivate(data []byte, d map[int][]Operand) cffPrivate {
+	var priv cffPrivate
+	ops := d[cffOpPrivate]
+	if len(ops) < 2 {
+		return priv
+	}
+	size, off := int(ops[0].value()), int(ops[1].value())
+	if off < 0 || size < 0 || off > len(data) || size > len(data)-off {
+		return priv
+	}
+	pd, err := parseDict(data[off : off+size])
+	if err != nil {
+		return priv
+	}
+	if v := pd[cffOpDefaultW]; len(v) > 0 {
+		priv.defaultWidthX = v[0].value()
+	}
+	if v := pd[cffOpNominalW]; len(v) > 0 {
+		priv.nominalWidthX = v[0].value()
+	}
+	if rel := dictInt(pd, cffOpSubrs, 0); rel > 0 {
+		priv.subrs, _ = indexAt(data, off+rel)
+	}
+	return priv
+}
+
+func parseCharset(data []byte, off int, numGlyphs int) []int {
+	cs := make([]int, numGlyphs)
+	if off <= 2 {
+		// Predefined charsets; ISOAdobe maps gid to SID directly.
+		for i := range cs {
+			cs[i] = i
+		}
+		return cs
+	}
+	if off >= len(data) {
+		return cs
+	}
+	format := data[off]
+	p := off + 1
+	gid := 1
+	switch format {
+	case 0:
+		for ; gid < numGlyphs && p+1 < len(data); gid++ {
+			cs[gid] = int(binary.BigEndian.Uint16(data[p:]))
+			p += 2
+		}
+	case 1, 2:
+		for gid < numGlyphs {
+			var first, left int
+			if format == 1 {
+				if p+2 >= len(data) {
+					break
+				}
+				first, left = int(binary.BigEndian.Uint16(data[p:])), int(data[p+2])
+				p += 3
+			} else {
+				if p+3 >= len(data) {
+					break
+				}
+				first, left = int(binary.BigEndian.Uint16(data[p:])), int(binary.BigEndian.Uint16(data[p+2:]))
+				p += 4
+			}
+			for k := 0; k <= left && gid < numGlyphs; k++ {
+				cs[gid] = first + k
+				gid++
+			}
+		}
+	}
+	return cs
+}
+
+func parseFDSelect(data []byte, off int, numGlyphs int) func(int) int {
+	if off < 0 || off >= len(data) {
+		return func(int) int { return 0 }
+	}
+	switch data[off] {
+	case 0:
+		table := data[off+1:]
+		return func(gid int) int {
+			if gid < len(table) {
+				return int(table[gid])
+			}
+			return 0
+		}
+	case 3:
+		if off+3 > len(data) {
+			break
+		}
+		n := int(binary.BigEndian.Uint16(data[off+1:]))
+		type fdRange struct{ first, fd int }
+		ranges := make([]fdRange, 0, n)
+		p := off + 3
+		for i := 0; i < n && p+2 < len(data); i++ {
+			ranges = append(ranges, fdRange{int(binary.BigEndian.Uint16(data[p:])), int(data[p+2])})
+			p += 3
+		}
+		return func(gid int) int {
+			fd := 0
+			for _, r := range ranges {
+				if gid < r.first {
+					break
+				}
+				fd = r.fd
+			}
+			return fd
+		}
+	}
+	return func(int) int { return 0 }
+}
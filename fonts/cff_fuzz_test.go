@@ -0,0 +1,39 @@
+package fonts
+
+import "testing"
+
+func FuzzParseCFFFont(f *testing.F) {
+	f.Add(testNameKeyedCFF())
+	f.Add(testCIDKeyedCFF())
+	f.Add([]byte("00\n0000000\xff\xff\x010")) // INDEX count 65535
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		font, err := ParseCFFFont(data)
+		if err != nil {
+			return
+		}
+		for gid := 0; gid < font.NumGlyphs() && gid < 16; gid++ {
+			_ = font.GlyphName(gid)
+			_, _ = font.Outline(gid)
+		}
+	})
+}
+
+func FuzzSubsetCFF(f *testing.F) {
+	f.Add(testNameKeyedCFF(), 1, 3)
+	f.Add(testCIDKeyedCFF(), 2, 1)
+
+	f.Fuzz(func(t *testing.T, data []byte, g1, g2 int) {
+		_, _ = SubsetCFF(data, []int{g1, g2})
+		_, _ = SubsetCFFToCID(data, []int{0, g1, g2})
+	})
+}
+
+func FuzzConvertType1ToCFF(f *testing.F) {
+	clear, binPart := testType1Font()
+	f.Add(append(append([]byte{}, clear...), binPart...), len(clear), len(binPart))
+
+	f.Fuzz(func(t *testing.T, data []byte, length1, length2 int) {
+		_, _ = ConvertType1ToCFF(data, length1, length2, nil)
+	})
+}
@@ -0,0 +1,465 @@
+package fonts
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Top DICT operators dropped from every subset: offsets are rewritten and
+// UniqueID/XUID must not identify a modified font.
+var cffSubsetSkip = map[int]bool{
+	cffOpCharset: true, cffOpEncoding: true, cffOpCharStrings: true, cffOpPrivate: true,
+	cffOpFDArray: true, cffOpFDSelect: true,
+	13: true, 14: true, 1235: true, // UniqueID, XUID, UIDBase
+}
+
+// Top DICT operators only meaningful for CID-keyed fonts.
+var cffCIDOps = map[int]bool{
+	cffOpROS: true, 1231: true, 1232: true, 1233: true, 1234: true, 1238: true, // CIDFontVersion .. CIDCount, FontName
+}
+
+// SubsetCFF returns a CFF program holding only .notdef and the glyphs in
+// gids. Name-keyed fonts keep their glyph names and built-in encoding and
+// CID-keyed fonts keep their CIDs, so the subset is a drop-in replacement
+// for the original program. Accent components referenced through seac are
+// kept as well.
+func SubsetCFF(data []byte, gids []int) ([]byte, error) {
+	f, err := ParseCFFFont(data)
+	if err != nil {
+		return nil, err
+	}
+	set := map[int]bool{0: true}
+	for _, gid := range gids {
+		if gid < 0 || gid >= len(f.charStrings) {
+			return nil, fmt.Errorf("cff: glyph %d out of range", gid)
+		}
+		set[gid] = true
+	}
+	usage, err := f.subrUsage(sortedGIDs(set))
+	if err != nil {
+		return nil, err
+	}
+	if !f.isCID && len(usage.seac) > 0 {
+		// seac names its components by standard code; keep them and
+		// account for their subroutines.
+		for _, seac := range usage.seac {
+			for _, code := range []int{int(seac[2]), int(seac[3])} {
+				if code < 0 || code > 255 {
+					continue
+				}
+				if comp, ok := f.byName[StandardEncoding[code]]; ok {
+					set[comp] = true
+				}
+			}
+		}
+		if usage, err = f.subrUsage(sortedGIDs(set)); err != nil {
+			return nil, err
+		}
+	}
+	return f.writeSubset(sortedGIDs(set), usage, false)
+}
+
+// SubsetCFFToCID returns a CID-keyed CFF program (ROS Adobe-Identity-0)
+// whose glyph i, selected by CID i, is glyph gids[i] of data. gids[0] must
+// be 0. Name-keyed programs are converted; glyphs built with seac are
+// flattened since CID-keyed fonts cannot reference glyphs by name.
+func SubsetCFFToCID(data []byte, gids []int) ([]byte, error) {
+	f, err := ParseCFFFont(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(gids) == 0 || gids[0] != 0 {
+		return nil, errors.New("cff: subset must start with .notdef")
+	}
+	for _, gid := range gids {
+		if gid < 0 || gid >= len(f.charStrings) {
+			return nil, fmt.Errorf("cff: glyph %d out of range", gid)
+		}
+	}
+	usage, err := f.subrUsage(gids)
+	if err != nil {
+		return nil, err
+	}
+	return f.writeSubset(gids, usage, true)
+}
+
+// cffUsage records the subroutines reached from a set of glyphs.
+type cffUsage struct {
+	global map[int]bool
+	local  map[int]map[int]bool // font DICT -> subroutine index
+	seac   map[int][4]float64   // glyphs ending in seac
+}
+
+func (f *CFFFont) subrUsage(gids []int) (*cffUsage, error) {
+	u := &cffUsage{global: make(map[int]bool), local: make(map[int]map[int]bool), seac: make(map[int][4]float64)}
+	for _, gid := range gids {
+		fd, priv := 0, &f.private
+		if f.isCID {
+			fd = f.fdSelect(gid)
+			if fd < 0 || fd >= len(f.fdPrivates) {
+				return nil, fmt.Errorf("cff: invalid font dict %d", fd)
+			}
+			priv = &f.fdPrivates[fd]
+		}
+		local := u.local[fd]
+		if local == nil {
+			local = make(map[int]bool)
+			u.local[fd] = local
+		}
+		it := &type2Interp{font: f, priv: priv, onSubr: func(global bool, idx int) {
+			if global {
+				u.global[idx] = true
+			} else {
+				local[idx] = true
+			}
+		}}
+		if err := it.run(f.charStrings[gid], 0); err != nil {
+			return nil, fmt.Errorf("cff: glyph %d: %w", gid, err)
+		}
+		if it.seac != nil {
+			u.seac[gid] = *it.seac
+		}
+	}
+	return u, nil
+}
+
+// keepSubrs replaces unused subroutines with a bare return so the indices
+// and bias seen by the kept charstrings do not change, and drops the unused
+// tail down to the smallest count with the same bias.
+func keepSubrs(subrs [][]byte, used map[int]bool) [][]byte {
+	last := -1
+	for idx := range used {
+		last = max(last, idx)
+	}
+	if last < 0 {
+		return nil
+	}
+	n := last + 1
+	switch {
+	case len(subrs) >= 33900:
+		n = max(n, 33900)
+	case len(subrs) >= 1240:
+		n = max(n, 1240)
+	}
+	out := make([][]byte, n)
+	for i := range out {
+		if used[i] {
+			out[i] = subrs[i]
+		} else {
+			out[i] = []byte{11}
+		}
+	}
+	return out
+}
+
+func (f *CFFFont) writeSubset(gids []int, usage *cffUsage, toCID bool) ([]byte, error) {
+	top := f.cff.TopDicts[0]
+	b := &cffBuild{
+		name:    f.Name,
+		strings: &cffStringTable{},
+		gsubrs:  keepSubrs(f.cff.GlobalSubrs, usage.global),
+		cid:     f.isCID || toCID,
+	}
+	skip := make(map[int]bool, len(cffSubsetSkip))
+	for op := range cffSubsetSkip {
+		skip[op] = true
+	}
+	if toCID || !f.isCID {
+		for op := range cffCIDOps {
+			skip[op] = true
+		}
+	}
+	if toCID {
+		b.top = append(b.top, cffDictEntry{op: cffOpROS, operands: cffInts(b.strings.sid("Adobe"), b.strings.sid("Identity"), 0)})
+	}
+	entries, err := copyDict(top, skip, f.lookupSID, b.strings)
+	if err != nil {
+		return nil, err
+	}
+	b.top = append(b.top, entries...)
+	if toCID {
+		b.top = append(b.top, cffDictEntry{op: 1234, operands: cffInts(len(gids))}) // CIDCount
+	}
+
+	b.charStrings = make([][]byte, len(gids))
+	for i, gid := range gids {
+		b.charStrings[i] = f.charStrings[gid]
+		if _, ok := usage.seac[gid]; ok && toCID && !f.isCID {
+			o, err := f.Outline(gid)
+			if err != nil {
+				return nil, err
+			}
+			b.charStrings[i] = type2Charstring(o, f.private.nominalWidthX)
+		}
+	}
+	for i, gid := range gids[1:] {
+		switch {
+		case toCID:
+			b.charset = append(b.charset, i+1)
+		case f.isCID:
+			b.charset = append(b.charset, f.charset[gid])
+		default:
+			b.charset = append(b.charset, b.strings.sid(f.GlyphName(gid)))
+		}
+	}
+
+	if !b.cid {
+		priv, err := f.privateOut(top, usage.local[0], b.strings)
+		if err != nil {
+			return nil, err
+		}
+		b.privates = []cffPrivateOut{priv}
+		switch off := dictInt(top, cffOpEncoding, 0); off {
+		case 0, 1:
+			b.encodingID = off
+		default:
+			newGID := make(map[int]int, len(gids))
+			for i, gid := range gids {
+				newGID[gid] = i
+			}
+			enc := make(map[int]int)
+			for code, gid := range f.encoding {
+				if n, ok := newGID[gid]; ok && n > 0 {
+					enc[code] = n
+				}
+			}
+			b.encoding = encodeEncoding(enc, append([]int{0}, b.charset...))
+		}
+		return b.bytes(), nil
+	}
+
+	if !f.isCID {
+		// A name-keyed program converted to CID-keyed gets a single font
+		// DICT carrying its Private DICT.
+		priv, err := f.privateOut(top, usage.local[0], b.strings)
+		if err != nil {
+			return nil, err
+		}
+		b.privates = []cffPrivateOut{priv}
+		b.fontDicts = [][]cffDictEntry{{{op: 1238, operands: cffInts(b.strings.sid(f.Name))}}}
+		b.fdSelect = make([]int, len(gids))
+		return b.bytes(), nil
+	}
+
+	fdDicts, err := indexAt(f.cff.data, dictInt(top, cffOpFDArray, 0))
+	if err != nil {
+		return nil, fmt.Errorf("cff: read FDArray: %w", err)
+	}
+	newFD := make(map[int]int)
+	for _, gid := range gids {
+		fd := f.fdSelect(gid)
+		if _, ok := newFD[fd]; ok {
+			continue
+		}
+		if fd < 0 || fd >= len(fdDicts) {
+			return nil, fmt.Errorf("cff: invalid font dict %d", fd)
+		}
+		d, err := parseDict(fdDicts[fd])
+		if err != nil {
+			return nil, fmt.Errorf("cff: parse font dict: %w", err)
+		}
+		priv, err := f.privateOut(d, usage.local[fd], b.strings)
+		if err != nil {
+			return nil, err
+		}
+		fontDict, err := copyDict(d, map[int]bool{cffOpPrivate: true}, f.lookupSID, b.strings)
+		if err != nil {
+			return nil, err
+		}
+		newFD[fd] = len(b.fontDicts)
+		b.fontDicts = append(b.fontDicts, fontDict)
+		b.privates = append(b.privates, priv)
+	}
+	b.fdSelect = make([]int, len(gids))
+	for i, gid := range gids {
+		b.fdSelect[i] = newFD[f.fdSelect(gid)]
+	}
+	return b.bytes(), nil
+}
+
+// privateOut copies the Private DICT referenced by d with only the used
+// local subroutines.
+func (f *CFFFont) privateOut(d map[int][]Operand, used map[int]bool, strs *cffStringTable) (cffPrivateOut, error) {
+	var out cffPrivateOut
+	ops := d[cffOpPrivate]
+	if len(ops) < 2 {
+		return out, nil
+	}
+	data := f.cff.data
+	size, off := int(ops[0].value()), int(ops[1].value())
+	if off < 0 || size < 0 || off > len(data) || size > len(data)-off {
+		return out, errors.New("cff: invalid Private DICT")
+	}
+	pd, err := parseDict(data[off : off+size])
+	if err != nil {
+		return out, fmt.Errorf("cff: parse Private DICT: %w", err)
+	}
+	if out.dict, err = copyDict(pd, map[int]bool{cffOpSubrs: true}, f.lookupSID, strs); err != nil {
+		return out, err
+	}
+	if rel := dictInt(pd, cffOpSubrs, 0); rel > 0 && len(used) > 0 {
+		subrs, err := indexAt(data, off+rel)
+		if err != nil {
+			return out, fmt.Errorf("cff: read Subrs: %w", err)
+		}
+		out.subrs = keepSubrs(subrs, used)
+	}
+	return out, nil
+}
+
+func sortedGIDs(set map[int]bool) []int {
+	out := make([]int, 0, len(set))
+	for gid := range set {
+		out = append(out, gid)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// ConvertType1ToCFF converts a Type 1 font program into a name-keyed CFF
+// (Type1C) program holding .notdef and the glyphs in names; nil names keeps
+// every glyph. Charstrings are rebuilt from the interpreted outlines, so
+// hints are dropped and seac accents are flattened.
+func ConvertType1ToCFF(data []byte, length1, length2 int, names []string) ([]byte, error) {
+	f, err := ParseType1Font(data, length1, length2)
+	if err != nil {
+		return nil, err
+	}
+	return f.toCFF(names)
+}
+
+func (f *Type1Font) toCFF(names []string) ([]byte, error) {
+	if names == nil {
+		names = f.names
+	}
+	keep := []string{".notdef"}
+	seen := map[string]bool{".notdef": true}
+	for _, n := range names {
+		if _, ok := f.byName[n]; ok && !seen[n] {
+			seen[n] = true
+			keep = append(keep, n)
+		}
+	}
+	sort.Strings(keep[1:])
+
+	b := &cffBuild{
+		name:     f.Name,
+		strings:  &cffStringTable{},
+		privates: []cffPrivateOut{{dict: []cffDictEntry{{op: cffOpDefaultW, operands: cffInts(0)}}}},
+	}
+	if b.name == "" {
+		b.name = "Type1"
+	}
+	bbox := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	newGID := make(map[string]int, len(keep))
+	for gid, name := range keep {
+		newGID[name] = gid
+		cs := []byte{139, 14} // zero-width empty .notdef
+		if idx, ok := f.byName[name]; ok {
+			o, err := f.Outline(idx)
+			if err != nil {
+				return nil, fmt.Errorf("type1: glyph %q: %w", name, err)
+			}
+			cs = type2Charstring(o, 0)
+			for _, s := range o.Segments {
+				for _, p := range s.Points[:segmentPoints(s.Op)] {
+					bbox[0], bbox[1] = min(bbox[0], p.X), min(bbox[1], p.Y)
+					bbox[2], bbox[3] = max(bbox[2], p.X), max(bbox[3], p.Y)
+				}
+			}
+		}
+		b.charStrings = append(b.charStrings, cs)
+		if gid > 0 {
+			b.charset = append(b.charset, b.strings.sid(name))
+		}
+	}
+	if f.fontMatrix != [6]float64{0.001, 0, 0, 0.001, 0, 0} {
+		m := make([]Operand, 6)
+		for i, v := range f.fontMatrix {
+			m[i] = Operand{Float: v}
+		}
+		b.top = append(b.top, cffDictEntry{op: cffOpFontMatrix, operands: m})
+	}
+	if bbox[0] <= bbox[2] {
+		b.top = append(b.top, cffDictEntry{op: 5, operands: cffInts( // FontBBox
+			int(math.Floor(bbox[0])), int(math.Floor(bbox[1])), int(math.Ceil(bbox[2])), int(math.Ceil(bbox[3])))})
+	}
+	enc := make(map[int]int)
+	for code, name := range f.encoding {
+		if gid, ok := newGID[name]; ok && gid > 0 {
+			enc[code] = gid
+		}
+	}
+	b.encoding = encodeEncoding(enc, append([]int{0}, b.charset...))
+	return b.bytes(), nil
+}
+
+func segmentPoints(op OutlineOp) int {
+	switch op {
+	case OutlineQuadTo:
+		return 2
+	case OutlineCubeTo:
+		return 3
+	}
+	return 1
+}
+
+// type2Charstring encodes an outline as a Type 2 charstring without hints.
+// The advance is written relative to nominalWidth.
+func type2Charstring(o *GlyphOutline, nominalWidth float64) []byte {
+	b := appendCSNumber(nil, csRound(o.Advance-nominalWidth))
+	var x, y float64
+	deltas := func(pts ...OutlinePoint) {
+		for _, p := range pts {
+			dx, dy := csRound(p.X-x), csRound(p.Y-y)
+			b = appendCSNumber(appendCSNumber(b, dx), dy)
+			x, y = x+dx, y+dy
+		}
+	}
+	for _, s := range o.Segments {
+		switch s.Op {
+		case OutlineMoveTo:
+			deltas(s.Points[0])
+			b = append(b, 21) // rmoveto
+		case OutlineLineTo:
+			deltas(s.Points[0])
+			b = append(b, 5) // rlineto
+		case OutlineQuadTo:
+			c, p := s.Points[0], s.Points[1]
+			c1 := OutlinePoint{x + (c.X-x)*2/3, y + (c.Y-y)*2/3}
+			c2 := OutlinePoint{p.X + (c.X-p.X)*2/3, p.Y + (c.Y-p.Y)*2/3}
+			deltas(c1, c2, p)
+			b = append(b, 8) // rrcurveto
+		case OutlineCubeTo:
+			deltas(s.Points[0], s.Points[1], s.Points[2])
+			b = append(b, 8)
+		}
+	}
+	return append(b, 14) // endchar
+}
+
+// csRound rounds v to the 16.16 fixed-point precision of charstrings.
+func csRound(v float64) float64 {
+	return math.Round(v*65536) / 65536
+}
+
+func appendCSNumber(b []byte, v float64) []byte {
+	if v != math.Trunc(v) || v < -32768 || v > 32767 {
+		n := int32(math.Round(v * 65536))
+		return append(b, 255, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	switch n := int(v); {
+	case n >= -107 && n <= 107:
+		return append(b, byte(n+139))
+	case n >= 108 && n <= 1131:
+		n -= 108
+		return append(b, byte(n>>8+247), byte(n))
+	case n >= -1131 && n <= -108:
+		n = -n - 108
+		return append(b, byte(n>>8+251), byte(n))
+	default:
+		return append(b, 28, byte(n>>8), byte(n))
+	}
+}
@@ -0,0 +1,297 @@
+package fonts
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Charstrings shared by the synthetic fonts below. Subroutine operands are
+// biased by -107, so index 0 is 32, index 1 is 33 and index 2 is 34.
+var (
+	csRight  = []byte{239, 139, 5, 11} // 100 0 rlineto return
+	csUp     = []byte{139, 239, 5, 11} // 0 100 rlineto return
+	csLeft   = []byte{39, 139, 5, 11}  // -100 0 rlineto return
+	csNotdef = []byte{139, 14}         // 0 endchar
+)
+
+// testCFFGlyphs returns .notdef and three glyphs of width 50 starting at
+// (10,20): one calling local subr 1 and global subr 0, one calling local
+// subr 2 and one without subroutines.
+func testCFFGlyphs() [][]byte {
+	return [][]byte{
+		csNotdef,
+		{189, 149, 159, 21, 33, 10, 32, 29, 14},
+		{189, 149, 159, 21, 34, 10, 14},
+		{189, 149, 159, 21, 239, 239, 5, 14},
+	}
+}
+
+func testNameKeyedCFF() []byte {
+	strs := &cffStringTable{}
+	b := &cffBuild{
+		name:    "Synthetic",
+		strings: strs,
+		top: []cffDictEntry{
+			{op: 2, operands: cffInts(strs.sid("Synthetic Sans"))}, // FullName
+			{op: 13, operands: cffInts(4000000)},                   // UniqueID
+		},
+		gsubrs:      [][]byte{csLeft, csUp},
+		charStrings: testCFFGlyphs(),
+		charset:     []int{strs.sid("A"), strs.sid("B"), strs.sid("glyph3")},
+		encoding:    encodeEncoding(map[int]int{65: 1, 66: 2, 67: 3}, nil),
+		privates:    []cffPrivateOut{{subrs: [][]byte{csUp, csRight, csUp}}},
+	}
+	return b.bytes()
+}
+
+func testCIDKeyedCFF() []byte {
+	strs := &cffStringTable{}
+	b := &cffBuild{
+		name:        "SyntheticCID",
+		strings:     strs,
+		top:         []cffDictEntry{{op: cffOpROS, operands: cffInts(strs.sid("Adobe"), strs.sid("Japan1"), 6)}},
+		gsubrs:      [][]byte{csLeft},
+		charStrings: testCFFGlyphs(),
+		charset:     []int{100, 200, 300},
+		cid:         true,
+		privates: []cffPrivateOut{
+			{subrs: [][]byte{csUp, csRight}},
+			{subrs: [][]byte{csUp, csRight, csUp}},
+		},
+		fontDicts: [][]cffDictEntry{nil, nil},
+		fdSelect:  []int{1, 0, 1, 1},
+	}
+	return b.bytes()
+}
+
+func sameOutline(t *testing.T, what string, a, b *CFFFont, ga, gb int) {
+	t.Helper()
+	oa, err := a.Outline(ga)
+	if err != nil {
+		t.Fatalf("%s: original outline: %v", what, err)
+	}
+	ob, err := b.Outline(gb)
+	if err != nil {
+		t.Fatalf("%s: subset outline: %v", what, err)
+	}
+	if oa.Advance != ob.Advance || len(oa.Segments) != len(ob.Segments) {
+		t.Fatalf("%s: outline %+v, want %+v", what, ob, oa)
+	}
+	for i := range oa.Segments {
+		if oa.Segments[i] != ob.Segments[i] {
+			t.Fatalf("%s: segment %d = %+v, want %+v", what, i, ob.Segments[i], oa.Segments[i])
+		}
+	}
+}
+
+func TestSubsetCFF(t *testing.T) {
+	data := testNameKeyedCFF()
+	orig, err := ParseCFFFont(data)
+	if err != nil {
+		t.Fatalf("parse original: %v", err)
+	}
+	out, err := SubsetCFF(data, []int{1})
+	if err != nil {
+		t.Fatalf("SubsetCFF: %v", err)
+	}
+	sub, err := ParseCFFFont(out)
+	if err != nil {
+		t.Fatalf("parse subset: %v", err)
+	}
+	if sub.NumGlyphs() != 2 || sub.GlyphName(1) != "A" {
+		t.Fatalf("subset has %d glyphs, glyph 1 %q", sub.NumGlyphs(), sub.GlyphName(1))
+	}
+	sameOutline(t, "A", orig, sub, 1, 1)
+
+	// Unused subroutines become returns and the unused tail is dropped.
+	if subrs := sub.private.subrs; len(subrs) != 2 || !bytes.Equal(subrs[0], []byte{11}) || !bytes.Equal(subrs[1], csRight) {
+		t.Errorf("local subrs = %v", subrs)
+	}
+	if gsubrs := sub.cff.GlobalSubrs; len(gsubrs) != 1 || !bytes.Equal(gsubrs[0], csLeft) {
+		t.Errorf("global subrs = %v", gsubrs)
+	}
+
+	if gid, ok := sub.GlyphIndexByCode(65); !ok || gid != 1 {
+		t.Errorf("code 65 maps to %d, %v", gid, ok)
+	}
+	if _, ok := sub.GlyphIndexByCode(66); ok {
+		t.Error("code 66 of a dropped glyph is still encoded")
+	}
+	top := sub.cff.TopDicts[0]
+	if name := sub.sidString(dictInt(top, 2, 0)); name != "Synthetic Sans" {
+		t.Errorf("FullName = %q", name)
+	}
+	if _, ok := top[13]; ok {
+		t.Error("UniqueID kept in subset")
+	}
+	if len(out) >= len(data) {
+		t.Errorf("subset is %d bytes, original %d", len(out), len(data))
+	}
+}
+
+func TestSubsetCFF_CIDKeyed(t *testing.T) {
+	data := testCIDKeyedCFF()
+	orig, err := ParseCFFFont(data)
+	if err != nil {
+		t.Fatalf("parse original: %v", err)
+	}
+
+	out, err := SubsetCFF(data, []int{2})
+	if err != nil {
+		t.Fatalf("SubsetCFF: %v", err)
+	}
+	sub, err := ParseCFFFont(out)
+	if err != nil {
+		t.Fatalf("parse subset: %v", err)
+	}
+	gid, ok := sub.GlyphIndexByCID(200)
+	if !sub.IsCID() || !ok {
+		t.Fatalf("CID 200 missing from subset")
+	}
+	if _, ok := sub.GlyphIndexByCID(100); ok {
+		t.Error("CID 100 kept in subset")
+	}
+	sameOutline(t, "CID 200", orig, sub, 2, gid)
+	// Only the second font DICT is referenced.
+	if len(sub.fdPrivates) != 1 {
+		t.Errorf("subset has %d font DICTs, want 1", len(sub.fdPrivates))
+	}
+
+	out, err = SubsetCFFToCID(data, []int{0, 3, 1})
+	if err != nil {
+		t.Fatalf("SubsetCFFToCID: %v", err)
+	}
+	sub, err = ParseCFFFont(out)
+	if err != nil {
+		t.Fatalf("parse CID subset: %v", err)
+	}
+	for cid, gid := range []int{0, 3, 1} {
+		if g, ok := sub.GlyphIndexByCID(cid); !ok || g != cid {
+			t.Fatalf("CID %d maps to glyph %d, %v", cid, g, ok)
+		}
+		sameOutline(t, "identity CID", orig, sub, gid, cid)
+	}
+	ros := sub.cff.TopDicts[0][cffOpROS]
+	if len(ros) != 3 || sub.sidString(ros[0].Int) != "Adobe" || sub.sidString(ros[1].Int) != "Identity" {
+		t.Errorf("ROS = %v", ros)
+	}
+
+	if _, err := SubsetCFFToCID(data, []int{1}); err == nil {
+		t.Error("expected an error for a subset without .notdef")
+	}
+}
+
+func TestSubsetCFFToCID_NameKeyed(t *testing.T) {
+	data := testNameKeyedCFF()
+	orig, _ := ParseCFFFont(data)
+	out, err := SubsetCFFToCID(data, []int{0, 2})
+	if err != nil {
+		t.Fatalf("SubsetCFFToCID: %v", err)
+	}
+	sub, err := ParseCFFFont(out)
+	if err != nil {
+		t.Fatalf("parse subset: %v", err)
+	}
+	if !sub.IsCID() || sub.NumGlyphs() != 2 {
+		t.Fatalf("cid=%v glyphs=%d", sub.IsCID(), sub.NumGlyphs())
+	}
+	sameOutline(t, "B", orig, sub, 2, 1)
+}
+
+func TestConvertType1ToCFF(t *testing.T) {
+	clear, binPart := testType1Font()
+	data := append(append([]byte{}, clear...), binPart...)
+	t1, err := ParseType1Font(data, len(clear), len(binPart))
+	if err != nil {
+		t.Fatalf("parse Type 1: %v", err)
+	}
+	out, err := ConvertType1ToCFF(data, len(clear), len(binPart), []string{"square", "missing"})
+	if err != nil {
+		t.Fatalf("ConvertType1ToCFF: %v", err)
+	}
+	f, err := ParseCFFFont(out)
+	if err != nil {
+		t.Fatalf("parse CFF: %v", err)
+	}
+	if f.Name != "Sq" || f.NumGlyphs() != 2 {
+		t.Fatalf("name=%q glyphs=%d", f.Name, f.NumGlyphs())
+	}
+	gid, ok := f.GlyphIndexByCode(65)
+	if !ok || f.GlyphName(gid) != "square" {
+		t.Fatalf("code 65 maps to %d (%q)", gid, f.GlyphName(gid))
+	}
+	want, _ := t1.Outline(1)
+	got, err := f.Outline(gid)
+	if err != nil {
+		t.Fatalf("outline: %v", err)
+	}
+	if got.Advance != want.Advance || len(got.Segments) != len(want.Segments) {
+		t.Fatalf("outline %+v, want %+v", got, want)
+	}
+	for i := range want.Segments {
+		if got.Segments[i].Points[0] != want.Segments[i].Points[0] {
+			t.Fatalf("segment %d = %+v, want %+v", i, got.Segments[i], want.Segments[i])
+		}
+	}
+}
+
+func TestSubsetCFF_Malformed(t *testing.T) {
+	badSID := func(sid int) []byte {
+		strs := &cffStringTable{}
+		b := &cffBuild{
+			name:        "Bad",
+			strings:     strs,
+			top:         []cffDictEntry{{op: 2, operands: cffInts(sid)}}, // FullName
+			charStrings: testCFFGlyphs(),
+			charset:     []int{strs.sid("A"), strs.sid("B"), strs.sid("C")},
+			privates:    []cffPrivateOut{{subrs: [][]byte{csUp, csRight, csUp}}},
+			gsubrs:      [][]byte{csLeft},
+		}
+		return b.bytes()
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"negative SID", badSID(-903)},
+		{"unknown SID", badSID(60000)},
+		{"negative Private", patchTopOffset(t, testNameKeyedCFF(), cffOpPrivate, -31)},
+		{"huge Private", patchTopOffset(t, testNameKeyedCFF(), cffOpPrivate, 1<<30)},
+		{"negative FDArray", patchTopOffset(t, testCIDKeyedCFF(), cffOpFDArray, -31)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := SubsetCFF(tt.data, []int{1}); err == nil {
+				t.Error("SubsetCFF: expected an error")
+			}
+			if _, err := SubsetCFFToCID(tt.data, []int{0, 1}); err == nil {
+				t.Error("SubsetCFFToCID: expected an error")
+			}
+		})
+	}
+}
+
+func TestConvertType1ToCFF_Malformed(t *testing.T) {
+	clear, binPart := testType1Font()
+	data := append(append([]byte{}, clear...), binPart...)
+	corrupt := append([]byte{}, data...)
+	for i := len(clear) + 4; i < len(corrupt); i += 7 {
+		corrupt[i] ^= 0x5a
+	}
+	tests := []struct {
+		name             string
+		data             []byte
+		length1, length2 int
+	}{
+		{"truncated", data[:len(clear)+10], len(clear), len(binPart)},
+		{"negative lengths", data, -5, -1},
+		{"lengths past end", data, len(data) + 10, 1 << 20},
+		{"corrupt private", corrupt, len(clear), len(binPart)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Any result is acceptable as long as nothing panics.
+			_, _ = ConvertType1ToCFF(tt.data, tt.length1, tt.length2, []string{"square"})
+		})
+	}
+}
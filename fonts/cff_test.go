@@ -2,6 +2,7 @@ package fonts
 
 import (
 	"bytes"
+	"encoding/binary"
 	"testing"
 )
 
@@ -60,3 +61,66 @@ func TestParseCFF(t *testing.T) {
 		t.Errorf("Expected operand 100 for op 14, got %v", ops)
 	}
 }
+
+// patchTopOffset overwrites the five-byte offset operand of op in the Top
+// DICT of a program written by cffBuild.
+func patchTopOffset(t *testing.T, data []byte, op int, v int32) []byte {
+	t.Helper()
+	f, err := ParseCFFFont(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	pat := binary.BigEndian.AppendUint32([]byte{29}, uint32(dictInt(f.cff.TopDicts[0], op, 0)))
+	if op >= 1200 {
+		pat = append(pat, 12, byte(op-1200))
+	} else {
+		pat = append(pat, byte(op))
+	}
+	i := bytes.Index(data, pat)
+	if i < 0 {
+		t.Fatalf("offset operand of op %d not found", op)
+	}
+	out := append([]byte(nil), data...)
+	binary.BigEndian.PutUint32(out[i+1:], uint32(v))
+	return out
+}
+
+func TestParseCFFFont_Malformed(t *testing.T) {
+	badOffSize := testNameKeyedCFF()
+	badOffSize[4+2] = 0xd8 // offSize of the Name INDEX
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"offSize", badOffSize},
+		{"truncated", testNameKeyedCFF()[:40]},
+		{"index count 65535", []byte("00\n0000000\xff\xff\x010")},
+		{"negative CharStrings", patchTopOffset(t, testNameKeyedCFF(), cffOpCharStrings, -31)},
+		{"negative charset", patchTopOffset(t, testNameKeyedCFF(), cffOpCharset, -31)},
+		{"negative Encoding", patchTopOffset(t, testNameKeyedCFF(), cffOpEncoding, -31)},
+		{"negative FDSelect", patchTopOffset(t, testCIDKeyedCFF(), cffOpFDSelect, -31)},
+		{"negative FDArray", patchTopOffset(t, testCIDKeyedCFF(), cffOpFDArray, -31)},
+		{"huge Encoding", patchTopOffset(t, testNameKeyedCFF(), cffOpEncoding, 1<<30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseCFFFont(tt.data)
+			if err != nil {
+				return
+			}
+			for gid := 0; gid < f.NumGlyphs(); gid++ {
+				f.GlyphName(gid)
+				f.Outline(gid)
+			}
+		})
+	}
+
+	f, err := ParseCFFFont(testNameKeyedCFF())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := f.sidString(-903); s != "" {
+		t.Errorf("sidString(-903) = %q", s)
+	}
+}
@@ -0,0 +1,415 @@
+package fonts
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// cffDictEntry is one operator of a DICT being written. Offset operands are
+// written in the fixed five-byte form so a DICT keeps its size when the
+// offsets are filled in during layout.
+type cffDictEntry struct {
+	op       int
+	operands []Operand
+	offset   bool
+}
+
+// CFF DICT operators whose operands are SIDs.
+var cffSIDOps = map[int]bool{
+	0: true, 1: true, 2: true, 3: true, 4: true, // version, Notice, FullName, FamilyName, Weight
+	1200: true, 1221: true, 1222: true, 1238: true, // Copyright, PostScript, BaseFontName, FontName
+}
+
+// cffStringTable collects the strings of a CFF being written. Standard
+// strings keep their predefined SIDs.
+type cffStringTable struct {
+	strs []string
+	sids map[string]int
+}
+
+var cffStandardSIDs = func() map[string]int {
+	m := make(map[string]int, len(cffStandardStrings))
+	for sid, s := range cffStandardStrings {
+		m[s] = sid
+	}
+	return m
+}()
+
+func (t *cffStringTable) sid(s string) int {
+	if sid, ok := cffStandardSIDs[s]; ok {
+		return sid
+	}
+	if sid, ok := t.sids[s]; ok {
+		return sid
+	}
+	if t.sids == nil {
+		t.sids = make(map[string]int)
+	}
+	sid := len(cffStandardStrings) + len(t.strs)
+	t.strs = append(t.strs, s)
+	t.sids[s] = sid
+	return sid
+}
+
+func (t *cffStringTable) items() [][]byte {
+	out := make([][]byte, len(t.strs))
+	for i, s := range t.strs {
+		out[i] = []byte(s)
+	}
+	return out
+}
+
+func cffInts(vs ...int) []Operand {
+	ops := make([]Operand, len(vs))
+	for i, v := range vs {
+		ops[i] = Operand{Int: v, IsInt: true}
+	}
+	return ops
+}
+
+// copyDict converts a parsed DICT back into entries, dropping the operators
+// in skip and re-registering SID operands in strs. ROS comes first as the
+// specification requires for CID-keyed fonts. SIDs that lookup cannot
+// resolve are reported as errors.
+func copyDict(d map[int][]Operand, skip map[int]bool, lookup func(int) (string, bool), strs *cffStringTable) ([]cffDictEntry, error) {
+	ops := make([]int, 0, len(d))
+	for op := range d {
+		if !skip[op] {
+			ops = append(ops, op)
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if (ops[i] == cffOpROS) != (ops[j] == cffOpROS) {
+			return ops[i] == cffOpROS
+		}
+		return ops[i] < ops[j]
+	})
+	entries := make([]cffDictEntry, 0, len(ops))
+	for _, op := range ops {
+		operands := append([]Operand(nil), d[op]...)
+		n := 0
+		switch {
+		case cffSIDOps[op] && len(operands) == 1:
+			n = 1
+		case op == cffOpROS && len(operands) == 3:
+			n = 2
+		}
+		for i := 0; i < n; i++ {
+			s, ok := lookup(int(operands[i].value()))
+			if !ok {
+				return nil, fmt.Errorf("cff: invalid SID %v for DICT operator %d", operands[i].value(), op)
+			}
+			operands[i] = Operand{Int: strs.sid(s), IsInt: true}
+		}
+		entries = append(entries, cffDictEntry{op: op, operands: operands})
+	}
+	return entries, nil
+}
+
+func encodeDict(entries []cffDictEntry) []byte {
+	var b []byte
+	for _, e := range entries {
+		for _, o := range e.operands {
+			switch {
+			case e.offset:
+				b = append(b, 29)
+				b = binary.BigEndian.AppendUint32(b, uint32(int32(o.Int)))
+			case o.IsInt:
+				b = appendDictInt(b, o.Int)
+			default:
+				b = appendDictReal(b, o.Float)
+			}
+		}
+		if e.op >= 1200 {
+			b = append(b, 12, byte(e.op-1200))
+		} else {
+			b = append(b, byte(e.op))
+		}
+	}
+	return b
+}
+
+func appendDictInt(b []byte, v int) []byte {
+	switch {
+	case v >= -107 && v <= 107:
+		return append(b, byte(v+139))
+	case v >= 108 && v <= 1131:
+		v -= 108
+		return append(b, byte(v>>8+247), byte(v))
+	case v >= -1131 && v <= -108:
+		v = -v - 108
+		return append(b, byte(v>>8+251), byte(v))
+	case v >= -32768 && v <= 32767:
+		return append(b, 28, byte(v>>8), byte(v))
+	}
+	b = append(b, 29)
+	return binary.BigEndian.AppendUint32(b, uint32(int32(v)))
+}
+
+// appendDictReal writes a real number operand as packed BCD nibbles.
+func appendDictReal(b []byte, f float64) []byte {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	var nibbles []byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+			nibbles = append(nibbles, c-'0')
+		case c == '.':
+			nibbles = append(nibbles, 0xa)
+		case c == '-':
+			nibbles = append(nibbles, 0xe)
+		case c == 'e' || c == 'E':
+			if i+1 < len(s) && s[i+1] == '-' {
+				nibbles = append(nibbles, 0xc)
+				i++
+			} else {
+				nibbles = append(nibbles, 0xb)
+				if i+1 < len(s) && s[i+1] == '+' {
+					i++
+				}
+			}
+		}
+	}
+	nibbles = append(nibbles, 0xf)
+	if len(nibbles)%2 == 1 {
+		nibbles = append(nibbles, 0xf)
+	}
+	b = append(b, 30)
+	for i := 0; i < len(nibbles); i += 2 {
+		b = append(b, nibbles[i]<<4|nibbles[i+1])
+	}
+	return b
+}
+
+func appendIndex(b []byte, items [][]byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(items)))
+	if len(items) == 0 {
+		return b
+	}
+	end := 1
+	for _, it := range items {
+		end += len(it)
+	}
+	offSize := 1
+	for lim := 0xff; end > lim && offSize < 4; lim = lim<<8 | 0xff {
+		offSize++
+	}
+	b = append(b, byte(offSize))
+	off := 1
+	for i := 0; i <= len(items); i++ {
+		for k := offSize - 1; k >= 0; k-- {
+			b = append(b, byte(off>>(8*k)))
+		}
+		if i < len(items) {
+			off += len(items[i])
+		}
+	}
+	for _, it := range items {
+		b = append(b, it...)
+	}
+	return b
+}
+
+// encodeCharset writes the charset of glyphs 1..n-1 in whichever of
+// formats 0 and 2 is shorter.
+func encodeCharset(ids []int) []byte {
+	f0 := []byte{0}
+	for _, id := range ids {
+		f0 = binary.BigEndian.AppendUint16(f0, uint16(id))
+	}
+	f2 := []byte{2}
+	for i := 0; i < len(ids); {
+		j := i
+		for j+1 < len(ids) && ids[j+1] == ids[j]+1 {
+			j++
+		}
+		f2 = binary.BigEndian.AppendUint16(f2, uint16(ids[i]))
+		f2 = binary.BigEndian.AppendUint16(f2, uint16(j-i))
+		i = j + 1
+	}
+	if len(f2) < len(f0) {
+		return f2
+	}
+	return f0
+}
+
+// encodeEncoding writes a custom encoding (format 0 with supplements) for
+// the code -> glyph assignments in enc. sids holds the charset SID of each
+// glyph, needed by supplements.
+func encodeEncoding(enc map[int]int, sids []int) []byte {
+	codes := make([]int, 0, len(enc))
+	for code, gid := range enc {
+		if gid > 0 && code >= 0 && code < 256 {
+			codes = append(codes, code)
+		}
+	}
+	sort.Ints(codes)
+	byGID := make(map[int][]int)
+	for _, code := range codes {
+		byGID[enc[code]] = append(byGID[enc[code]], code)
+	}
+	// Format 0 assigns one code to each glyph from glyph 1 up to the first
+	// glyph without a code; everything else becomes a supplement.
+	var primary []byte
+	for gid := 1; len(byGID[gid]) > 0 && len(primary) < 255; gid++ {
+		primary = append(primary, byte(byGID[gid][0]))
+		byGID[gid] = byGID[gid][1:]
+	}
+	type supplement struct{ code, sid int }
+	var sups []supplement
+	for gid, cs := range byGID {
+		for _, code := range cs {
+			sups = append(sups, supplement{code, sids[gid]})
+		}
+	}
+	sort.Slice(sups, func(i, j int) bool { return sups[i].code < sups[j].code })
+	if len(sups) > 255 {
+		sups = sups[:255]
+	}
+	format := byte(0)
+	if len(sups) > 0 {
+		format |= 0x80
+	}
+	out := append([]byte{format, byte(len(primary))}, primary...)
+	if len(sups) > 0 {
+		out = append(out, byte(len(sups)))
+		for _, s := range sups {
+			out = append(out, byte(s.code))
+			out = binary.BigEndian.AppendUint16(out, uint16(s.sid))
+		}
+	}
+	return out
+}
+
+// encodeFDSelect writes an FDSelect in format 3.
+func encodeFDSelect(fds []int) []byte {
+	var ranges []byte
+	n := 0
+	for gid, fd := range fds {
+		if gid == 0 || fd != fds[gid-1] {
+			ranges = binary.BigEndian.AppendUint16(ranges, uint16(gid))
+			ranges = append(ranges, byte(fd))
+			n++
+		}
+	}
+	out := binary.BigEndian.AppendUint16([]byte{3}, uint16(n))
+	out = append(out, ranges...)
+	return binary.BigEndian.AppendUint16(out, uint16(len(fds)))
+}
+
+// cffPrivateOut is a Private DICT and its local subroutines.
+type cffPrivateOut struct {
+	dict  []cffDictEntry
+	subrs [][]byte
+}
+
+// cffBuild describes a single-font CFF program to be written. Top and font
+// DICTs must not contain offset operators; they are added during layout.
+type cffBuild struct {
+	name        string
+	top         []cffDictEntry
+	strings     *cffStringTable
+	gsubrs      [][]byte
+	charStrings [][]byte
+	charset     []int  // SID or CID of glyphs 1..n-1
+	encoding    []byte // custom encoding; nil uses encodingID
+	encodingID  int    // 0 standard, 1 expert
+	cid         bool
+	privates    []cffPrivateOut  // one per font DICT, or the only Private
+	fontDicts   [][]cffDictEntry // CID-keyed only
+	fdSelect    []int            // CID-keyed only
+}
+
+func (c *cffBuild) bytes() []byte {
+	topDict := func(charsetOff, encodingOff, fdSelectOff, csOff, fdArrayOff, privSize, privOff int) []byte {
+		entries := append([]cffDictEntry(nil), c.top...)
+		entries = append(entries,
+			cffDictEntry{op: cffOpCharset, operands: cffInts(charsetOff), offset: true},
+			cffDictEntry{op: cffOpCharStrings, operands: cffInts(csOff), offset: true})
+		if c.cid {
+			entries = append(entries,
+				cffDictEntry{op: cffOpFDArray, operands: cffInts(fdArrayOff), offset: true},
+				cffDictEntry{op: cffOpFDSelect, operands: cffInts(fdSelectOff), offset: true})
+		} else {
+			if c.encoding != nil {
+				entries = append(entries, cffDictEntry{op: cffOpEncoding, operands: cffInts(encodingOff), offset: true})
+			} else if c.encodingID != 0 {
+				entries = append(entries, cffDictEntry{op: cffOpEncoding, operands: cffInts(c.encodingID)})
+			}
+			entries = append(entries, cffDictEntry{op: cffOpPrivate, operands: cffInts(privSize, privOff), offset: true})
+		}
+		return encodeDict(entries)
+	}
+	privDicts := make([][]byte, len(c.privates))
+	for i, p := range c.privates {
+		entries := p.dict
+		if len(p.subrs) > 0 {
+			// The Subrs offset is relative to the Private DICT, which the
+			// subroutines directly follow.
+			entries = append(append([]cffDictEntry(nil), entries...), cffDictEntry{op: cffOpSubrs, operands: cffInts(0), offset: true})
+			size := len(encodeDict(entries))
+			entries[len(entries)-1].operands = cffInts(size)
+		}
+		privDicts[i] = encodeDict(entries)
+	}
+	privBlock := func(i int) []byte {
+		return appendIndex(append([]byte(nil), privDicts[i]...), c.privates[i].subrs)
+	}
+	fdArray := func(privOffs []int) []byte {
+		items := make([][]byte, len(c.fontDicts))
+		for i, fd := range c.fontDicts {
+			entries := append(append([]cffDictEntry(nil), fd...),
+				cffDictEntry{op: cffOpPrivate, operands: cffInts(len(privDicts[i]), privOffs[i]), offset: true})
+			items[i] = encodeDict(entries)
+		}
+		return appendIndex(nil, items)
+	}
+
+	header := []byte{1, 0, 4, 4}
+	nameIndex := appendIndex(nil, [][]byte{[]byte(c.name)})
+	strIndex := appendIndex(nil, c.strings.items())
+	gsubrIndex := appendIndex(nil, c.gsubrs)
+	topLen := len(appendIndex(nil, [][]byte{topDict(0, 0, 0, 0, 0, 0, 0)}))
+
+	charset := encodeCharset(c.charset)
+	var fdSelect []byte
+	if c.cid {
+		fdSelect = encodeFDSelect(c.fdSelect)
+	}
+	csIndex := appendIndex(nil, c.charStrings)
+
+	charsetOff := len(header) + len(nameIndex) + topLen + len(strIndex) + len(gsubrIndex)
+	encodingOff := charsetOff + len(charset)
+	fdSelectOff := encodingOff + len(c.encoding)
+	csOff := fdSelectOff + len(fdSelect)
+	fdArrayOff := csOff + len(csIndex)
+	privOff := fdArrayOff
+	if c.cid {
+		privOff += len(fdArray(make([]int, len(c.fontDicts))))
+	}
+	privOffs := make([]int, len(c.privates))
+	var privs []byte
+	for i := range c.privates {
+		privOffs[i] = privOff + len(privs)
+		privs = append(privs, privBlock(i)...)
+	}
+
+	var privSize int
+	if len(privDicts) > 0 {
+		privSize = len(privDicts[0])
+	}
+	out := append(header, nameIndex...)
+	out = appendIndex(out, [][]byte{topDict(charsetOff, encodingOff, fdSelectOff, csOff, fdArrayOff, privSize, privOffs[0])})
+	out = append(out, strIndex...)
+	out = append(out, gsubrIndex...)
+	out = append(out, charset...)
+	out = append(out, c.encoding...)
+	out = append(out, fdSelect...)
+	out = append(out, csIndex...)
+	if c.cid {
+		out = append(out, fdArray(privOffs)...)
+	}
+	return append(out, privs...)
+}
@@ -0,0 +1,253 @@
+package fonts
+
+import (
+	"strconv"
+	"strings"
+)
+
+// EncodingTable maps single-byte character codes to glyph names.
+type EncodingTable [256]string
+
+// StandardEncoding is Adobe's standard Latin text encoding (PDF 32000 Annex D).
+var StandardEncoding = buildEncoding(asciiStandard, map[int]string{
+	39: "quoteright", 96: "quoteleft",
+	161: "exclamdown", 162: "cent", 163: "sterling", 164: "fraction", 165: "yen", 166: "florin",
+	167: "section", 168: "currency", 169: "quotesingle", 170: "quotedblleft", 171: "guillemotleft",
+	172: "guilsinglleft", 173: "guilsinglright", 174: "fi", 175: "fl", 177: "endash", 178: "dagger",
+	179: "daggerdbl", 180: "periodcentered", 182: "paragraph", 183: "bullet", 184: "quotesinglbase",
+	185: "quotedblbase", 186: "quotedblright", 187: "guillemotright", 188: "ellipsis", 189: "perthousand",
+	191: "questiondown", 193: "grave", 194: "acute", 195: "circumflex", 196: "tilde", 197: "macron",
+	198: "breve", 199: "dotaccent", 200: "dieresis", 202: "ring", 203: "cedilla", 205: "hungarumlaut",
+	206: "ogonek", 207: "caron", 208: "emdash", 225: "AE", 227: "ordfeminine", 232: "Lslash",
+	233: "Oslash", 234: "OE", 235: "ordmasculine", 241: "ae", 245: "dotlessi", 248: "lslash",
+	249: "oslash", 250: "oe", 251: "germandbls",
+})
+
+// WinAnsiEncoding is the Windows code page 1252 encoding used by most PDF
+// producers for simple fonts.
+var WinAnsiEncoding = buildEncoding(asciiStandard, winAnsiHigh())
+
+// MacRomanEncoding is the Mac OS standard Roman encoding as defined by PDF.
+var MacRomanEncoding = buildEncoding(asciiStandard, macRomanHigh())
+
+// PDFDocEncoding is the encoding used for PDF text strings outside content
+// streams.
+var PDFDocEncoding = buildEncoding(asciiStandard, pdfDocHigh())
+
+// NamedEncoding returns the predefined encoding for a PDF /Encoding name.
+func NamedEncoding(name string) (*EncodingTable, bool) {
+	switch name {
+	case "StandardEncoding":
+		return &StandardEncoding, true
+	case "WinAnsiEncoding":
+		return &WinAnsiEncoding, true
+	case "MacRomanEncoding":
+		return &MacRomanEncoding, true
+	case "PDFDocEncoding":
+		return &PDFDocEncoding, true
+	}
+	return nil, false
+}
+
+// GlyphNameToRune maps a glyph name to its Unicode value following the
+// Adobe Glyph List conventions, including uniXXXX and uXXXX[XX] forms and
+// suffixed variants such as "a.sc" or "f_i".
+func GlyphNameToRune(name string) (rune, bool) {
+	if r, ok := glyphRunes[name]; ok {
+		return r, true
+	}
+	if dot := strings.IndexByte(name, '.'); dot > 0 {
+		return GlyphNameToRune(name[:dot])
+	}
+	if us := strings.IndexByte(name, '_'); us > 0 {
+		return GlyphNameToRune(name[:us])
+	}
+	if strings.HasPrefix(name, "uni") && len(name) >= 7 {
+		if v, err := strconv.ParseUint(name[3:7], 16, 32); err == nil {
+			return rune(v), true
+		}
+	}
+	if strings.HasPrefix(name, "u") && len(name) >= 5 && len(name) <= 7 {
+		if v, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+			return rune(v), true
+		}
+	}
+	return 0, false
+}
+
+// RuneToGlyphName returns the conventional glyph name for r.
+func RuneToGlyphName(r rune) string {
+	if name, ok := runeGlyphs[r]; ok {
+		return name
+	}
+	if r <= 0xFFFF {
+		return "uni" + strings.ToUpper(strconv.FormatInt(int64(r), 16))
+	}
+	return "u" + strings.ToUpper(strconv.FormatInt(int64(r), 16))
+}
+
+var asciiStandard = [...]string{
+	"space", "exclam", "quotedbl", "numbersign", "dollar", "percent", "ampersand", "quotesingle",
+	"parenleft", "parenright", "asterisk", "plus", "comma", "hyphen", "period", "slash",
+	"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine",
+	"colon", "semicolon", "less", "equal", "greater", "question", "at",
+	"A", "B", "C", "D", "E", "F", "G", "H", "I", "J", "K", "L", "M", "N", "O", "P", "Q", "R", "S", "T", "U", "V", "W", "X", "Y", "Z",
+	"bracketleft", "backslash", "bracketright", "asciicircum", "underscore", "grave",
+	"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m", "n", "o", "p", "q", "r", "s", "t", "u", "v", "w", "x", "y", "z",
+	"braceleft", "bar", "braceright", "asciitilde",
+}
+
+// latin1Names holds the glyph names for U+00A1 through U+00FF.
+var latin1Names = [...]string{
+	"exclamdown", "cent", "sterling", "currency", "yen", "brokenbar", "section", "dieresis",
+	"copyright", "ordfeminine", "guillemotleft", "logicalnot", "hyphen", "registered", "macron",
+	"degree", "plusminus", "twosuperior", "threesuperior", "acute", "mu", "paragraph",
+	"periodcentered", "cedilla", "onesuperior", "ordmasculine", "guillemotright", "onequarter",
+	"onehalf", "threequarters", "questiondown",
+	"Agrave", "Aacute", "Acircumflex", "Atilde", "Adieresis", "Aring", "AE", "Ccedilla",
+	"Egrave", "Eacute", "Ecircumflex", "Edieresis", "Igrave", "Iacute", "Icircumflex", "Idieresis",
+	"Eth", "Ntilde", "Ograve", "Oacute", "Ocircumflex", "Otilde", "Odieresis", "multiply",
+	"Oslash", "Ugrave", "Uacute", "Ucircumflex", "Udieresis", "Yacute", "Thorn", "germandbls",
+	"agrave", "aacute", "acircumflex", "atilde", "adieresis", "aring", "ae", "ccedilla",
+	"egrave", "eacute", "ecircumflex", "edieresis", "igrave", "iacute", "icircumflex", "idieresis",
+	"eth", "ntilde", "ograve", "oacute", "ocircumflex", "otilde", "odieresis", "divide",
+	"oslash", "ugrave", "uacute", "ucircumflex", "udieresis", "yacute", "thorn", "ydieresis",
+}
+
+func buildEncoding(ascii [95]string, high map[int]string) EncodingTable {
+	var t EncodingTable
+	for i, n := range ascii {
+		t[32+i] = n
+	}
+	for code, n := range high {
+		t[code] = n
+	}
+	return t
+}
+
+func winAnsiHigh() map[int]string {
+	m := map[int]string{
+		128: "Euro", 130: "quotesinglbase", 131: "florin", 132: "quotedblbase", 133: "ellipsis",
+		134: "dagger", 135: "daggerdbl", 136: "circumflex", 137: "perthousand", 138: "Scaron",
+		139: "guilsinglleft", 140: "OE", 142: "Zcaron", 145: "quoteleft", 146: "quoteright",
+		147: "quotedblleft", 148: "quotedblright", 149: "bullet", 150: "endash", 151: "emdash",
+		152: "tilde", 153: "trademark", 154: "scaron", 155: "guilsinglright", 156: "oe",
+		158: "zcaron", 159: "Ydieresis", 160: "space", 173: "hyphen",
+	}
+	for i, n := range latin1Names {
+		if _, ok := m[0xA1+i]; !ok {
+			m[0xA1+i] = n
+		}
+	}
+	return m
+}
+
+func macRomanHigh() map[int]string {
+	names := [...]string{
+		"Adieresis", "Aring", "Ccedilla", "Eacute", "Ntilde", "Odieresis", "Udieresis", "aacute",
+		"agrave", "acircumflex", "adieresis", "atilde", "aring", "ccedilla", "eacute", "egrave",
+		"ecircumflex", "edieresis", "iacute", "igrave", "icircumflex", "idieresis", "ntilde", "oacute",
+		"ograve", "ocircumflex", "odieresis", "otilde", "uacute", "ugrave", "ucircumflex", "udieresis",
+		"dagger", "degree", "cent", "sterling", "section", "bullet", "paragraph", "germandbls",
+		"registered", "copyright", "trademark", "acute", "dieresis", "notequal", "AE", "Oslash",
+		"infinity", "plusminus", "lessequal", "greaterequal", "yen", "mu", "partialdiff", "summation",
+		"product", "pi", "integral", "ordfeminine", "ordmasculine", "Omega", "ae", "oslash",
+		"questiondown", "exclamdown", "logicalnot", "radical", "florin", "approxequal", "Delta", "guillemotleft",
+		"guillemotright", "ellipsis", "space", "Agrave", "Atilde", "Otilde", "OE", "oe",
+		"endash", "emdash", "quotedblleft", "quotedblright", "quoteleft", "quoteright", "divide", "lozenge",
+		"ydieresis", "Ydieresis", "fraction", "currency", "guilsinglleft", "guilsinglright", "fi", "fl",
+		"daggerdbl", "periodcentered", "quotesinglbase", "quotedblbase", "perthousand", "Acircumflex", "Ecircumflex", "Aacute",
+		"Edieresis", "Egrave", "Iacute", "Icircumflex", "Idieresis", "Igrave", "Oacute", "Ocircumflex",
+		"apple", "Ograve", "Uacute", "Ucircumflex", "Ugrave", "dotlessi", "circumflex", "tilde",
+		"macron", "breve", "dotaccent", "ring", "cedilla", "hungarumlaut", "ogonek", "caron",
+	}
+	m := map[int]string{39: "quotesingle", 96: "grave"}
+	for i, n := range names {
+		m[128+i] = n
+	}
+	return m
+}
+
+func pdfDocHigh() map[int]string {
+	m := map[int]string{
+		24: "breve", 25: "caron", 26: "circumflex", 27: "dotaccent", 28: "hungarumlaut", 29: "ogonek",
+		30: "ring", 31: "tilde",
+		128: "bullet", 129: "dagger", 130: "daggerdbl", 131: "ellipsis", 132: "emdash", 133: "endash",
+		134: "florin", 135: "fraction", 136: "guilsinglleft", 137: "guilsinglright", 138: "minus",
+		139: "perthousand", 140: "quotedblbase", 141: "quotedblleft", 142: "quotedblright",
+		143: "quoteleft", 144: "quoteright", 145: "quotesinglbase", 146: "trademark", 147: "fi",
+		148: "fl", 149: "Lslash", 150: "OE", 151: "Scaron", 152: "Ydieresis", 153: "Zcaron",
+		154: "dotlessi", 155: "lslash", 156: "oe", 157: "scaron", 158: "zcaron", 160: "Euro",
+	}
+	for i, n := range latin1Names {
+		m[0xA1+i] = n
+	}
+	return m
+}
+
+// glyphRunes covers every name used by the predefined encodings plus a few
+// common additions from the Adobe Glyph List.
+var glyphRunes = func() map[string]rune {
+	m := map[string]rune{
+		"quotesingle": '\'', "grave": '`', "quoteright": 0x2019, "quoteleft": 0x2018,
+		"fraction": 0x2044, "fi": 0xFB01, "fl": 0xFB02, "ff": 0xFB00, "ffi": 0xFB03, "ffl": 0xFB04,
+		"dotlessi": 0x0131, "Lslash": 0x0141, "lslash": 0x0142, "OE": 0x0152, "oe": 0x0153,
+		"Scaron": 0x0160, "scaron": 0x0161, "Zcaron": 0x017D, "zcaron": 0x017E, "Ydieresis": 0x0178,
+		"florin": 0x0192, "circumflex": 0x02C6, "caron": 0x02C7, "breve": 0x02D8, "dotaccent": 0x02D9,
+		"ring": 0x02DA, "ogonek": 0x02DB, "tilde": 0x02DC, "hungarumlaut": 0x02DD,
+		"endash": 0x2013, "emdash": 0x2014, "quotesinglbase": 0x201A, "quotedblleft": 0x201C,
+		"quotedblright": 0x201D, "quotedblbase": 0x201E, "dagger": 0x2020, "daggerdbl": 0x2021,
+		"bullet": 0x2022, "ellipsis": 0x2026, "perthousand": 0x2030, "guilsinglleft": 0x2039,
+		"guilsinglright": 0x203A, "Euro": 0x20AC, "trademark": 0x2122, "minus": 0x2212,
+		"notequal": 0x2260, "infinity": 0x221E, "lessequal": 0x2264, "greaterequal": 0x2265,
+		"partialdiff": 0x2202, "summation": 0x2211, "product": 0x220F, "pi": 0x03C0,
+		"integral": 0x222B, "Omega": 0x2126, "radical": 0x221A, "approxequal": 0x2248,
+		"Delta": 0x2206, "lozenge": 0x25CA, "apple": 0xF8FF, "nbspace": 0x00A0,
+		"nonbreakingspace": 0x00A0, "sfthyphen": 0x00AD, "periodcentered": 0x00B7,
+		"middot": 0x00B7, "mu": 0x00B5, "Gamma": 0x0393, "Theta": 0x0398, "Lambda": 0x039B,
+		"Xi": 0x039E, "Pi": 0x03A0, "Sigma": 0x03A3, "Phi": 0x03A6, "Psi": 0x03A8,
+		"alpha": 0x03B1, "beta": 0x03B2, "gamma": 0x03B3, "delta": 0x03B4, "epsilon": 0x03B5,
+		"zeta": 0x03B6, "eta": 0x03B7, "theta": 0x03B8, "iota": 0x03B9, "kappa": 0x03BA,
+		"lambda": 0x03BB, "nu": 0x03BD, "xi": 0x03BE, "omicron": 0x03BF, "rho": 0x03C1,
+		"sigma": 0x03C3, "tau": 0x03C4, "upsilon": 0x03C5, "phi": 0x03C6, "chi": 0x03C7,
+		"psi": 0x03C8, "omega": 0x03C9, "arrowleft": 0x2190, "arrowup": 0x2191,
+		"arrowright": 0x2192, "arrowdown": 0x2193, "arrowboth": 0x2194, "degree": 0x00B0,
+		"checkmark": 0x2713, "universal": 0x2200, "existential": 0x2203, "element": 0x2208,
+		"emptyset": 0x2205, "gradient": 0x2207, "similar": 0x223C, "congruent": 0x2245,
+		"equivalence": 0x2261, "intersection": 0x2229, "union": 0x222A, "therefore": 0x2234,
+		"perpendicular": 0x22A5, "dotmath": 0x22C5, "logicaland": 0x2227, "logicalor": 0x2228,
+		"multiply": 0x00D7, "divide": 0x00F7, "angle": 0x2220, "proportional": 0x221D,
+		"propersubset": 0x2282, "propersuperset": 0x2283, "reflexsubset": 0x2286,
+		"reflexsuperset": 0x2287, "aleph": 0x2135, "weierstrass": 0x2118, "Ifraktur": 0x2111,
+		"Rfraktur": 0x211C, "suchthat": 0x220B, "notsubset": 0x2284, "notelement": 0x2209,
+		"spade": 0x2660, "club": 0x2663, "heart": 0x2665, "diamond": 0x2666,
+	}
+	for i, n := range asciiStandard {
+		if _, ok := m[n]; !ok {
+			m[n] = rune(32 + i)
+		}
+	}
+	for i, n := range latin1Names {
+		if _, ok := m[n]; !ok {
+			m[n] = rune(0xA1 + i)
+		}
+	}
+	m["hyphen"] = '-'
+	m["space"] = ' '
+	return m
+}()
+
+var runeGlyphs = func() map[rune]string {
+	m := make(map[rune]string, len(glyphRunes))
+	for name, r := range glyphRunes {
+		if existing, ok := m[r]; ok && existing < name {
+			continue
+		}
+		m[r] = name
+	}
+	m[' '] = "space"
+	m['-'] = "hyphen"
+	m[0x00A0] = "space"
+	m[0x00B7] = "periodcentered"
+	return m
+}()
@@ -74,8 +74,9 @@ func LoadOpenType(name string, data []byte) (*semantic.Font, error) {
 				scaleFixed(bounds.Max.X, unitsPerEm),
 				scaleFixed(bounds.Max.Y, unitsPerEm),
 			},
-			FontFile:     cffData,
-			FontFileType: "FontFile3", // Type1C
+			FontFile:        cffData,
+			FontFileType:    "FontFile3",
+			FontFileSubtype: "Type1C",
 		}
 
 		// For CFF, we usually use Type1C (Compact Font Format)
@@ -96,6 +97,7 @@ func LoadOpenType(name string, data []byte) (*semantic.Font, error) {
 		widths := glyphWidths(f, buf, unitsPerEm, ppem)
 
 		if isCID {
+			descriptor.FontFileSubtype = "CIDFontType0C"
 			cidInfo := semantic.CIDSystemInfo{Registry: "Adobe", Ordering: "Identity", Supplement: 0}
 			descendant := &semantic.CIDFont{
 				Subtype:       "CIDFontType0", // CFF based
@@ -0,0 +1,86 @@
+package fonts
+
+// OutlineOp identifies the kind of a glyph outline segment.
+type OutlineOp int
+
+const (
+	OutlineMoveTo OutlineOp = iota
+	OutlineLineTo
+	OutlineQuadTo
+	OutlineCubeTo
+)
+
+// OutlinePoint is a point in glyph space (font units, Y axis up).
+type OutlinePoint struct{ X, Y float64 }
+
+// OutlineSegment is one drawing command. MoveTo and LineTo use Points[0],
+// QuadTo uses Points[0:2] and CubeTo uses Points[0:3]; the last point used is
+// always the segment end point.
+type OutlineSegment struct {
+	Op     OutlineOp
+	Points [3]OutlinePoint
+}
+
+// GlyphOutline is the vector outline of a single glyph together with its
+// advance width, both expressed in glyph space units.
+type GlyphOutline struct {
+	Segments []OutlineSegment
+	Advance  float64
+}
+
+// OutlineFont is implemented by embedded font programs that can produce glyph
+// outlines. UnitsPerEm relates glyph space to text space (1/UnitsPerEm).
+type OutlineFont interface {
+	NumGlyphs() int
+	UnitsPerEm() float64
+	Outline(gid int) (*GlyphOutline, error)
+}
+
+type outlinePen struct {
+	segs []OutlineSegment
+	open bool
+	x, y float64
+}
+
+func (p *outlinePen) moveTo(x, y float64) {
+	p.segs = append(p.segs, OutlineSegment{Op: OutlineMoveTo, Points: [3]OutlinePoint{{x, y}}})
+	p.x, p.y = x, y
+	p.open = true
+}
+
+func (p *outlinePen) lineTo(x, y float64) {
+	if !p.open {
+		p.moveTo(p.x, p.y)
+	}
+	p.segs = append(p.segs, OutlineSegment{Op: OutlineLineTo, Points: [3]OutlinePoint{{x, y}}})
+	p.x, p.y = x, y
+}
+
+func (p *outlinePen) quadTo(cx, cy, x, y float64) {
+	if !p.open {
+		p.moveTo(p.x, p.y)
+	}
+	p.segs = append(p.segs, OutlineSegment{Op: OutlineQuadTo, Points: [3]OutlinePoint{{cx, cy}, {x, y}}})
+	p.x, p.y = x, y
+}
+
+func (p *outlinePen) cubeTo(c1x, c1y, c2x, c2y, x, y float64) {
+	if !p.open {
+		p.moveTo(p.x, p.y)
+	}
+	p.segs = append(p.segs, OutlineSegment{Op: OutlineCubeTo, Points: [3]OutlinePoint{{c1x, c1y}, {c2x, c2y}, {x, y}}})
+	p.x, p.y = x, y
+}
+
+// translate offsets every point of segs by (dx, dy).
+func translateSegments(segs []OutlineSegment, dx, dy float64) []OutlineSegment {
+	out := make([]OutlineSegment, len(segs))
+	for i, s := range segs {
+		for j := range s.Points {
+			s.Points[j].X += dx
+			s.Points[j].Y += dy
+		}
+		out[i] = s
+	}
+	return out
+}
@@ -0,0 +1,246 @@
+package fonts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestTrueTypeOutline(t *testing.T) {
+	f, err := ParseTrueTypeFont(goregular.TTF)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if f.UnitsPerEm() != 2048 {
+		t.Fatalf("unitsPerEm = %v", f.UnitsPerEm())
+	}
+	gid, ok := f.LookupCMap(3, 1, 'A')
+	if !ok || gid == 0 {
+		t.Fatalf("cmap lookup for A failed")
+	}
+	o, err := f.Outline(gid)
+	if err != nil {
+		t.Fatalf("outline: %v", err)
+	}
+	if len(o.Segments) == 0 || o.Segments[0].Op != OutlineMoveTo {
+		t.Fatalf("unexpected outline %+v", o.Segments)
+	}
+	if o.Advance <= 0 || o.Advance != f.Advance(gid) {
+		t.Fatalf("advance = %v", o.Advance)
+	}
+	minY, maxY := 1e9, -1e9
+	for _, s := range o.Segments {
+		for _, p := range s.Points[:1] {
+			minY = min(minY, p.Y)
+			maxY = max(maxY, p.Y)
+		}
+	}
+	if minY < -1 || maxY < 1000 {
+		t.Fatalf("outline of A should sit on the baseline with Y up, got y range [%v,%v]", minY, maxY)
+	}
+}
+
+func type1Encrypt(plain []byte, key uint16) []byte {
+	r := key
+	data := append([]byte{0, 0, 0, 0}, plain...)
+	out := make([]byte, len(data))
+	for i, p := range data {
+		c := p ^ byte(r>>8)
+		out[i] = c
+		r = (uint16(c)+r)*52845 + 22719
+	}
+	return out
+}
+
+// testType1Font builds a Type 1 program with a single "square" glyph at
+// code 65 drawn through a subroutine, returning the cleartext and the
+// eexec-encrypted portions.
+func testType1Font() (clear, binPart []byte) {
+	// 0 500 hsbw 100 100 rmoveto 300 hlineto 0 callsubr -300 hlineto closepath endchar
+	square := []byte{139, 248, 136, 13, 239, 239, 21, 247, 192, 6, 139, 10, 251, 192, 6, 9, 14}
+	// 300 vlineto return
+	subr := []byte{247, 192, 7, 11}
+	notdef := []byte{139, 139, 13, 14}
+
+	var priv bytes.Buffer
+	priv.WriteString("dup /Private 8 dict dup begin\n/lenIV 4 def\n/Subrs 1 array\n")
+	enc := type1Encrypt(subr, charstringKey)
+	fmt.Fprintf(&priv, "dup 0 %d RD ", len(enc))
+	priv.Write(enc)
+	priv.WriteString(" NP\nND\n2 index /CharStrings 2 dict dup begin\n")
+	for _, g := range []struct {
+		name string
+		cs   []byte
+	}{{".notdef", notdef}, {"square", square}} {
+		enc := type1Encrypt(g.cs, charstringKey)
+		fmt.Fprintf(&priv, "/%s %d RD ", g.name, len(enc))
+		priv.Write(enc)
+		priv.WriteString(" ND\n")
+	}
+	priv.WriteString("end\nend\n")
+
+	clear = []byte("%!PS-AdobeFont-1.0: Sq\n/FontName /Sq def\n/FontMatrix [0.001 0 0 0.001 0 0] readonly def\n" +
+		"/Encoding 256 array\n0 1 255 {1 index exch /.notdef put} for\ndup 65 /square put\nreadonly def\ncurrentfile eexec\n")
+	return clear, type1Encrypt(priv.Bytes(), eexecKey)
+}
+
+func TestType1FontOutline(t *testing.T) {
+	clear, binPart := testType1Font()
+
+	var pfb bytes.Buffer
+	for _, seg := range []struct {
+		kind byte
+		data []byte
+	}{{1, clear}, {2, binPart}} {
+		pfb.Write([]byte{0x80, seg.kind})
+		binary.Write(&pfb, binary.LittleEndian, uint32(len(seg.data)))
+		pfb.Write(seg.data)
+	}
+	pfb.Write([]byte{0x80, 3})
+
+	for name, data := range map[string][]byte{
+		"pfb": pfb.Bytes(),
+		"raw": append(append([]byte{}, clear...), binPart...),
+	} {
+		f, err := ParseType1Font(data, len(clear), len(binPart))
+		if err != nil {
+			t.Fatalf("%s: parse: %v", name, err)
+		}
+		if f.Name != "Sq" || f.UnitsPerEm() != 1000 {
+			t.Fatalf("%s: name=%q upem=%v", name, f.Name, f.UnitsPerEm())
+		}
+		if n, ok := f.EncodingName(65); !ok || n != "square" {
+			t.Fatalf("%s: encoding 65 = %q", name, n)
+		}
+		gid, ok := f.GlyphIndexByName("square")
+		if !ok {
+			t.Fatalf("%s: square glyph missing", name)
+		}
+		o, err := f.Outline(gid)
+		if err != nil {
+			t.Fatalf("%s: outline: %v", name, err)
+		}
+		want := []OutlinePoint{{100, 100}, {400, 100}, {400, 400}, {100, 400}}
+		if len(o.Segments) != len(want) {
+			t.Fatalf("%s: segments = %+v", name, o.Segments)
+		}
+		for i, s := range o.Segments {
+			if s.Points[0] != want[i] {
+				t.Fatalf("%s: segment %d = %+v, want %+v", name, i, s.Points[0], want[i])
+			}
+		}
+		if o.Advance != 500 {
+			t.Fatalf("%s: advance = %v", name, o.Advance)
+		}
+	}
+}
+
+func cffIndex(items ...[]byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint16(len(items)))
+	if len(items) == 0 {
+		return b.Bytes()
+	}
+	b.WriteByte(4)
+	off := uint32(1)
+	binary.Write(&b, binary.BigEndian, off)
+	for _, it := range items {
+		off += uint32(len(it))
+		binary.Write(&b, binary.BigEndian, off)
+	}
+	for _, it := range items {
+		b.Write(it)
+	}
+	return b.Bytes()
+}
+
+func cffInt(v int) []byte {
+	return []byte{29, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+func TestCFFFontOutline(t *testing.T) {
+	notdef := []byte{14}
+	// 50 10 20 rmoveto 100 hlineto 100 vlineto -100 hlineto endchar
+	glyph := []byte{189, 149, 159, 21, 239, 6, 239, 7, 39, 6, 14}
+	charStrings := cffIndex(notdef, glyph)
+	private := []byte{}
+
+	header := []byte{1, 0, 4, 4}
+	names := cffIndex([]byte("Test"))
+	strs := cffIndex()
+	gsubrs := cffIndex()
+	// Top DICT has a fixed size because every operand uses the 5-byte form.
+	topSize := 5 + 1 + 5 + 5 + 1
+	topIndexSize := len(cffIndex(make([]byte, topSize)))
+	base := len(header) + len(names) + topIndexSize + len(strs) + len(gsubrs)
+	top := append(cffInt(base), cffOpCharStrings)
+	top = append(top, cffInt(len(private))...)
+	top = append(top, cffInt(base+len(charStrings))...)
+	top = append(top, cffOpPrivate)
+
+	var data []byte
+	data = append(data, header...)
+	data = append(data, names...)
+	data = append(data, cffIndex(top)...)
+	data = append(data, strs...)
+	data = append(data, gsubrs...)
+	data = append(data, charStrings...)
+	data = append(data, private...)
+
+	f, err := ParseCFFFont(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if f.NumGlyphs() != 2 || f.UnitsPerEm() != 1000 {
+		t.Fatalf("glyphs=%d upem=%v", f.NumGlyphs(), f.UnitsPerEm())
+	}
+	if f.GlyphName(1) != "space" {
+		t.Fatalf("glyph 1 name = %q (ISOAdobe charset)", f.GlyphName(1))
+	}
+	o, err := f.Outline(1)
+	if err != nil {
+		t.Fatalf("outline: %v", err)
+	}
+	want := []OutlinePoint{{10, 20}, {110, 20}, {110, 120}, {10, 120}}
+	if len(o.Segments) != len(want) {
+		t.Fatalf("segments = %+v", o.Segments)
+	}
+	for i, s := range o.Segments {
+		if s.Points[0] != want[i] {
+			t.Fatalf("segment %d = %+v, want %+v", i, s.Points[0], want[i])
+		}
+	}
+	// nominalWidthX defaults to 0, so the explicit width is 50.
+	if o.Advance != 50 {
+		t.Fatalf("advance = %v", o.Advance)
+	}
+}
+
+func TestEncodings(t *testing.T) {
+	if len(cffStandardStrings) != 391 {
+		t.Fatalf("standard strings = %d", len(cffStandardStrings))
+	}
+	if WinAnsiEncoding[0x80] != "Euro" || WinAnsiEncoding['A'] != "A" {
+		t.Fatalf("WinAnsi mismatch: %q %q", WinAnsiEncoding[0x80], WinAnsiEncoding['A'])
+	}
+	if StandardEncoding[0x27] != "quoteright" || StandardEncoding[0xE1] != "AE" {
+		t.Fatalf("Standard mismatch: %q %q", StandardEncoding[0x27], StandardEncoding[0xE1])
+	}
+	if MacRomanEncoding[0x80] != "Adieresis" {
+		t.Fatalf("MacRoman 0x80 = %q", MacRomanEncoding[0x80])
+	}
+	if enc, ok := NamedEncoding("WinAnsiEncoding"); !ok || enc != &WinAnsiEncoding {
+		t.Fatalf("NamedEncoding lookup failed")
+	}
+	for name, want := range map[string]rune{"A": 'A', "eacute": 'é', "uni20AC": '€', "u1F600": 0x1F600, "a.sc": 'a', "f_i": 'f'} {
+		if r, ok := GlyphNameToRune(name); !ok || r != want {
+			t.Errorf("GlyphNameToRune(%q) = %q, %v", name, r, ok)
+		}
+	}
+	if RuneToGlyphName('é') != "eacute" {
+		t.Errorf("RuneToGlyphName(é) = %q", RuneToGlyphName('é'))
+	}
+}
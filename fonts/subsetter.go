@@ -11,6 +11,9 @@ type Subset struct {
 	SubsetToOriginal map[int]int // Map new CID -> original CID
 	UsedCIDs         []int       // List of used CIDs
 	GlyphSet         map[int]bool
+	// Simple marks single-byte fonts. Their codes are kept, so GlyphSet
+	// holds the used codes and content streams are not rewritten.
+	Simple bool
 }
 
 type Planner struct {
@@ -25,6 +28,18 @@ func NewPlanner() *Planner {
 
 func (p *Planner) Plan(analyzer *Analyzer) {
 	for font, used := range analyzer.UsedGlyphs {
+		if font.Subtype != "Type0" {
+			codes := make(map[int]bool, len(used))
+			for code := range used {
+				codes[code] = true
+			}
+			p.Subsets[font] = &Subset{GlyphSet: codes, Simple: true}
+			continue
+		}
+		if font.Encoding != "Identity-H" && font.Encoding != "Identity-V" {
+			// Codes of other CMaps cannot be renumbered.
+			continue
+		}
 		glyphSet := make(map[int]bool)
 		for cid := range used {
 			glyphSet[cid] = true
@@ -88,17 +103,31 @@ func NewSubsetter() *Subsetter {
 func (s *Subsetter) Apply(doc *semantic.Document, planner *Planner) {
 	// 1. Update Fonts
 	for font, subset := range planner.Subsets {
+		if subset.Simple {
+			subsetSimpleFont(font, subset)
+			continue
+		}
+		desc := font.Descriptor
+		if font.DescendantFont != nil && font.DescendantFont.Descriptor != nil {
+			desc = font.DescendantFont.Descriptor
+		}
+
+		// 1.0 Subset CFF programs first: their glyphs are renumbered with
+		// the CIDs, so fonts that cannot be subset keep their original
+		// CIDs.
+		if isBareCFF(desc) {
+			if font.DescendantFont == nil || !subsetCIDFontType0(font, desc, subset) {
+				delete(planner.Subsets, font)
+				continue
+			}
+		}
+
 		// 1.1 Filter Widths (using New CIDs)
 		newWidths := make(map[int]int)
 		for _, newCID := range subset.UsedCIDs {
 			oldCID := subset.SubsetToOriginal[newCID]
-			if w, ok := font.Widths[oldCID]; ok {
+			if w, ok := cidWidth(font, oldCID); ok {
 				newWidths[newCID] = w
-			} else {
-				// Use default width if available in descendant
-				if font.DescendantFont != nil {
-					newWidths[newCID] = font.DescendantFont.DW
-				}
 			}
 		}
 		font.Widths = newWidths
@@ -106,7 +135,11 @@ func (s *Subsetter) Apply(doc *semantic.Document, planner *Planner) {
 			font.DescendantFont.W = newWidths
 		}
 
-		// 1.2 Filter ToUnicode (using New CIDs)
+		// 1.2 Filter ToUnicode (using New CIDs). A parsed CMap stream is
+		// decoded so it can be renumbered too.
+		if len(font.ToUnicode) == 0 && len(font.ToUnicodeCMap) > 0 {
+			font.ToUnicode = ParseToUnicodeCMap(font.ToUnicodeCMap)
+		}
 		if font.ToUnicode != nil {
 			newToUnicode := make(map[int][]rune)
 			for _, newCID := range subset.UsedCIDs {
@@ -116,34 +149,47 @@ func (s *Subsetter) Apply(doc *semantic.Document, planner *Planner) {
 				}
 			}
 			font.ToUnicode = newToUnicode
+			font.ToUnicodeCMap = nil
+		}
+
+		if isBareCFF(desc) {
+			continue
 		}
 
 		// 1.3 Generate CIDToGIDMap
-		// We need to map NewCID -> OldGID.
-		// Since original font was Identity-H, OldCID = OldGID.
-		// So we map NewCID -> OldCID.
+		// We need to map NewCID -> OldGID through the original map, which
+		// is the identity unless the font carried a CIDToGIDMap stream.
+		usedGIDs := make(map[int]bool, len(subset.GlyphSet))
 		if font.DescendantFont != nil {
+			oldMap := font.DescendantFont.CIDToGIDMap
 			cidToGid := make([]byte, len(subset.UsedCIDs)*2)
 			for _, newCID := range subset.UsedCIDs {
-				oldCID := subset.SubsetToOriginal[newCID]
-				cidToGid[newCID*2] = byte(oldCID >> 8)
-				cidToGid[newCID*2+1] = byte(oldCID)
+				oldGID := subset.SubsetToOriginal[newCID]
+				if len(oldMap) > 0 {
+					if oldGID*2+1 < len(oldMap) {
+						oldGID = int(oldMap[oldGID*2])<<8 | int(oldMap[oldGID*2+1])
+					} else {
+						oldGID = 0
+					}
+				}
+				usedGIDs[oldGID] = true
+				cidToGid[newCID*2] = byte(oldGID >> 8)
+				cidToGid[newCID*2+1] = byte(oldGID)
 			}
 			font.DescendantFont.CIDToGIDMap = cidToGid
 			font.DescendantFont.CIDToGIDMapName = "" // Use stream, not name
-		}
-
-		// 1.4 Subset FontFile
-		if font.Descriptor != nil && len(font.Descriptor.FontFile) > 0 && font.Descriptor.FontFileType == "FontFile2" {
-			// Identity-H means CID=GID, so the glyph set directly maps to TrueType glyph IDs.
-			usedGIDs := make(map[int]bool, len(subset.GlyphSet))
+		} else {
 			for gid := range subset.GlyphSet {
 				usedGIDs[gid] = true
 			}
+		}
 
-			newFontData, err := SubsetTrueType(font.Descriptor.FontFile, usedGIDs)
-			if err == nil && len(newFontData) < len(font.Descriptor.FontFile) {
-				font.Descriptor.FontFile = newFontData
+		// 1.4 Subset FontFile
+		if desc != nil && len(desc.FontFile) > 0 && desc.FontFileType == "FontFile2" {
+			// The subset keeps glyph IDs, so the map above stays valid.
+			newFontData, err := SubsetTrueType(desc.FontFile, usedGIDs)
+			if err == nil && len(newFontData) < len(desc.FontFile) {
+				replaceFontFile(desc, newFontData)
 			}
 		}
 	}
@@ -171,7 +217,7 @@ func rewriteContentStream(stream *semantic.ContentStream, resources *semantic.Re
 			}
 		} else if op.Operator == "Tj" {
 			if currentFont != nil {
-				if subset, ok := planner.Subsets[currentFont]; ok {
+				if subset, ok := planner.Subsets[currentFont]; ok && !subset.Simple {
 					if len(op.Operands) > 0 {
 						if strOp, ok := op.Operands[0].(semantic.StringOperand); ok {
 							newData := remapString(strOp.Value, subset)
@@ -182,7 +228,7 @@ func rewriteContentStream(stream *semantic.ContentStream, resources *semantic.Re
 			}
 		} else if op.Operator == "TJ" {
 			if currentFont != nil {
-				if subset, ok := planner.Subsets[currentFont]; ok {
+				if subset, ok := planner.Subsets[currentFont]; ok && !subset.Simple {
 					if len(op.Operands) > 0 {
 						if arrOp, ok := op.Operands[0].(semantic.ArrayOperand); ok {
 							newValues := make([]semantic.Operand, len(arrOp.Values))
@@ -222,3 +268,211 @@ func remapString(data []byte, subset *Subset) []byte {
 	}
 	return res
 }
+
+// isBareCFF reports whether desc embeds a bare CFF program (FontFile3
+// without the OpenType wrapper).
+func isBareCFF(desc *semantic.FontDescriptor) bool {
+	if desc == nil || len(desc.FontFile) == 0 || desc.FontFileType != "FontFile3" {
+		return false
+	}
+	switch desc.FontFileSubtype {
+	case "", "Type1C", "CIDFontType0C":
+		return true
+	}
+	return false
+}
+
+// cidWidth looks up the width of cid in the descendant's W array, then in
+// the font's widths, falling back to the default width.
+func cidWidth(font *semantic.Font, cid int) (int, bool) {
+	if d := font.DescendantFont; d != nil {
+		if w, ok := d.W[cid]; ok {
+			return w, true
+		}
+	}
+	if w, ok := font.Widths[cid]; ok {
+		return w, true
+	}
+	if d := font.DescendantFont; d != nil {
+		if d.DW > 0 {
+			return d.DW, true
+		}
+		return 1000, true
+	}
+	return 0, false
+}
+
+// subsetCIDFontType0 replaces the CFF program of a Type0 font with one whose
+// CIDs are the new CIDs of subset, so no CIDToGIDMap is needed.
+func subsetCIDFontType0(font *semantic.Font, desc *semantic.FontDescriptor, subset *Subset) bool {
+	cff, err := ParseCFFFont(desc.FontFile)
+	if err != nil {
+		return false
+	}
+	gids := make([]int, len(subset.UsedCIDs))
+	for i, newCID := range subset.UsedCIDs {
+		if gid, ok := cff.GlyphIndexByCID(subset.SubsetToOriginal[newCID]); ok {
+			gids[i] = gid
+		}
+	}
+	data, err := SubsetCFFToCID(desc.FontFile, gids)
+	if err != nil {
+		return false
+	}
+	replaceFontFile(desc, data)
+	desc.FontFileSubtype = "CIDFontType0C"
+	cidInfo := semantic.CIDSystemInfo{Registry: "Adobe", Ordering: "Identity", Supplement: 0}
+	font.CIDSystemInfo = &cidInfo
+	font.DescendantFont.CIDSystemInfo = cidInfo
+	font.DescendantFont.CIDToGIDMap = nil
+	font.DescendantFont.CIDToGIDMapName = ""
+	return true
+}
+
+func replaceFontFile(desc *semantic.FontDescriptor, data []byte) {
+	desc.FontFile = data
+	if desc.FontFileType == "FontFile2" && desc.Length1 > 0 {
+		desc.Length1 = len(data)
+	}
+}
+
+// subsetSimpleFont reduces the program of a single-byte font to the glyphs
+// its used codes select. Type 1 programs are converted to CFF on the way.
+func subsetSimpleFont(font *semantic.Font, subset *Subset) {
+	desc := font.Descriptor
+	if desc == nil || len(desc.FontFile) == 0 {
+		return
+	}
+	codes := make([]int, 0, len(subset.GlyphSet))
+	for code := range subset.GlyphSet {
+		if code >= 0 && code < 256 {
+			codes = append(codes, code)
+		}
+	}
+	sort.Ints(codes)
+
+	switch {
+	case desc.FontFileType == "FontFile":
+		t1, err := ParseType1Font(desc.FontFile, desc.Length1, desc.Length2)
+		if err != nil {
+			return
+		}
+		names := simpleGlyphNames(font, t1.EncodingName)
+		keep := make([]string, 0, len(codes))
+		for _, code := range codes {
+			if names[code] != "" {
+				keep = append(keep, names[code])
+			}
+		}
+		data, err := t1.toCFF(keep)
+		if err == nil && len(data) < len(desc.FontFile) {
+			desc.FontFile = data
+			desc.FontFileType = "FontFile3"
+			desc.FontFileSubtype = "Type1C"
+			desc.Length1, desc.Length2, desc.Length3 = 0, 0, 0
+		}
+	case isBareCFF(desc):
+		cff, err := ParseCFFFont(desc.FontFile)
+		if err != nil || cff.IsCID() {
+			return
+		}
+		names := simpleGlyphNames(font, func(code int) (string, bool) {
+			if gid, ok := cff.GlyphIndexByCode(code); ok {
+				return cff.GlyphName(gid), true
+			}
+			return "", false
+		})
+		var gids []int
+		for _, code := range codes {
+			if gid, ok := cff.GlyphIndexByName(names[code]); ok {
+				gids = append(gids, gid)
+			}
+			if gid, ok := cff.GlyphIndexByCode(code); ok {
+				gids = append(gids, gid)
+			}
+		}
+		data, err := SubsetCFF(desc.FontFile, gids)
+		if err == nil && len(data) < len(desc.FontFile) {
+			desc.FontFile = data
+		}
+	case desc.FontFileType == "FontFile2":
+		tt, err := ParseTrueTypeFont(desc.FontFile)
+		if err != nil {
+			return
+		}
+		names := simpleGlyphNames(font, nil)
+		gids := map[int]bool{0: true}
+		for _, code := range codes {
+			for _, gid := range simpleTrueTypeGlyphs(tt, code, names[code], desc.Flags&4 != 0) {
+				gids[gid] = true
+			}
+		}
+		data, err := SubsetTrueType(desc.FontFile, gids)
+		if err == nil && len(data) < len(desc.FontFile) {
+			replaceFontFile(desc, data)
+		}
+	}
+}
+
+// simpleGlyphNames returns the glyph name each code selects: the font's
+// Differences over its base encoding, or over the program's built-in
+// encoding when no base encoding is named.
+func simpleGlyphNames(font *semantic.Font, builtin func(int) (string, bool)) EncodingTable {
+	var names EncodingTable
+	base := font.Encoding
+	if font.EncodingDict != nil && font.EncodingDict.BaseEncoding != "" {
+		base = font.EncodingDict.BaseEncoding
+	}
+	if enc, ok := NamedEncoding(base); ok {
+		names = *enc
+	} else if builtin != nil {
+		for code := range names {
+			names[code], _ = builtin(code)
+		}
+	} else {
+		names = StandardEncoding
+	}
+	if font.EncodingDict != nil {
+		for _, d := range font.EncodingDict.Differences {
+			if d.Code >= 0 && d.Code < len(names) {
+				names[d.Code] = d.Name
+			}
+		}
+	}
+	return names
+}
+
+// simpleTrueTypeGlyphs returns every glyph a viewer may select for code of
+// a simple TrueType font (PDF 32000-1 9.6.6.4); keeping a few extra glyphs
+// is cheaper than guessing the viewer's choice wrong.
+func simpleTrueTypeGlyphs(tt *TrueTypeFont, code int, name string, symbolic bool) []int {
+	var gids []int
+	add := func(gid int, ok bool) {
+		if ok && gid > 0 {
+			gids = append(gids, gid)
+		}
+	}
+	if name != "" {
+		if r, ok := GlyphNameToRune(name); ok {
+			add(tt.LookupCMap(3, 1, uint32(r)))
+		}
+		for c, n := range MacRomanEncoding {
+			if n == name {
+				add(tt.LookupCMap(1, 0, uint32(c)))
+				break
+			}
+		}
+		if cff := tt.CFF(); cff != nil {
+			add(cff.GlyphIndexByName(name))
+		}
+	}
+	for _, base := range []uint32{0xF000, 0, 0xF100, 0xF200} {
+		add(tt.LookupCMap(3, 0, base|uint32(code)))
+	}
+	add(tt.LookupCMap(1, 0, uint32(code)))
+	add(tt.LookupAnyCMap(uint32(code)))
+	if symbolic {
+		add(code, code < tt.NumGlyphs())
+	}
+	return gids
+}
@@ -1,8 +1,11 @@
 package fonts
 
 import (
+	"bytes"
 	"os"
 	"testing"
+
+	"github.com/wudi/pdfkit/ir/semantic"
 )
 
 func TestSubsetTrueType(t *testing.T) {
@@ -50,3 +53,91 @@ func TestSubsetTrueType(t *testing.T) {
 		t.Error("Subsetted font missing head table")
 	}
 }
+
+func TestSubsetter_CFFAndType1(t *testing.T) {
+	cffData := testCIDKeyedCFF()
+	cidDesc := &semantic.FontDescriptor{FontName: "SyntheticCID", FontFile: cffData, FontFileType: "FontFile3", FontFileSubtype: "CIDFontType0C"}
+	cidFont := &semantic.Font{
+		Subtype:       "Type0",
+		BaseFont:      "SyntheticCID",
+		Encoding:      "Identity-H",
+		CIDSystemInfo: &semantic.CIDSystemInfo{Registry: "Adobe", Ordering: "Japan1", Supplement: 6},
+		DescendantFont: &semantic.CIDFont{
+			Subtype:    "CIDFontType0",
+			BaseFont:   "SyntheticCID",
+			DW:         1000,
+			W:          map[int]int{100: 500, 200: 600, 300: 700},
+			Descriptor: cidDesc,
+		},
+		ToUnicodeCMap: []byte("2 beginbfchar\n<00C8> <0042>\n<012C> <0043>\nendbfchar\n"),
+	}
+	clear, binPart := testType1Font()
+	t1Data := append(append([]byte{}, clear...), binPart...)
+	t1Desc := &semantic.FontDescriptor{FontName: "Sq", FontFile: t1Data, FontFileType: "FontFile", Length1: len(clear), Length2: len(binPart)}
+	t1Font := &semantic.Font{Subtype: "Type1", BaseFont: "Sq", Widths: map[int]int{65: 500}, Descriptor: t1Desc}
+
+	doc := &semantic.Document{Pages: []*semantic.Page{{
+		Resources: &semantic.Resources{Fonts: map[string]*semantic.Font{"F1": cidFont, "F2": t1Font}},
+		Contents: []semantic.ContentStream{{Operations: []semantic.Operation{
+			{Operator: "BT"},
+			{Operator: "Tf", Operands: []semantic.Operand{semantic.NameOperand{Value: "F1"}, semantic.NumberOperand{Value: 12}}},
+			{Operator: "Tj", Operands: []semantic.Operand{semantic.StringOperand{Value: []byte{0x01, 0x2C, 0x00, 0xC8}}}},
+			{Operator: "Tf", Operands: []semantic.Operand{semantic.NameOperand{Value: "F2"}, semantic.NumberOperand{Value: 12}}},
+			{Operator: "Tj", Operands: []semantic.Operand{semantic.StringOperand{Value: []byte("A")}}},
+			{Operator: "ET"},
+		}}},
+	}}}
+
+	analyzer := NewAnalyzer()
+	analyzer.Analyze(doc)
+	planner := NewPlanner()
+	planner.Plan(analyzer)
+	NewSubsetter().Apply(doc, planner)
+
+	ops := doc.Pages[0].Contents[0].Operations
+	if got := ops[2].Operands[0].(semantic.StringOperand).Value; !bytes.Equal(got, []byte{0, 2, 0, 1}) {
+		t.Errorf("CID string = % x, want 00 02 00 01", got)
+	}
+	if got := ops[4].Operands[0].(semantic.StringOperand).Value; string(got) != "A" {
+		t.Errorf("simple font string rewritten to % x", got)
+	}
+
+	// The CFF program is now CID-keyed by the new CIDs.
+	orig, _ := ParseCFFFont(cffData)
+	sub, err := ParseCFFFont(cidDesc.FontFile)
+	if err != nil {
+		t.Fatalf("parse subset CFF: %v", err)
+	}
+	if sub.NumGlyphs() != 3 {
+		t.Errorf("subset has %d glyphs, want 3", sub.NumGlyphs())
+	}
+	sameOutline(t, "CID 200", orig, sub, 2, 1)
+	sameOutline(t, "CID 300", orig, sub, 3, 2)
+	if cidFont.CIDSystemInfo.Ordering != "Identity" || cidFont.DescendantFont.CIDSystemInfo.Ordering != "Identity" {
+		t.Errorf("CIDSystemInfo not updated: %+v", cidFont.CIDSystemInfo)
+	}
+	if len(cidFont.DescendantFont.CIDToGIDMap) != 0 {
+		t.Error("CIDToGIDMap written for a CFF font")
+	}
+	if w := cidFont.DescendantFont.W; w[0] != 1000 || w[1] != 600 || w[2] != 700 {
+		t.Errorf("widths = %v", w)
+	}
+	if len(cidFont.ToUnicodeCMap) != 0 || string(cidFont.ToUnicode[1]) != "B" || string(cidFont.ToUnicode[2]) != "C" {
+		t.Errorf("ToUnicode = %v", cidFont.ToUnicode)
+	}
+
+	// The Type 1 program is converted to a CFF subset and keeps its codes.
+	if t1Desc.FontFileType != "FontFile3" || t1Desc.FontFileSubtype != "Type1C" || t1Desc.Length1 != 0 {
+		t.Fatalf("Type 1 font not converted: %s/%s", t1Desc.FontFileType, t1Desc.FontFileSubtype)
+	}
+	conv, err := ParseCFFFont(t1Desc.FontFile)
+	if err != nil {
+		t.Fatalf("parse converted font: %v", err)
+	}
+	if gid, ok := conv.GlyphIndexByCode('A'); !ok || conv.GlyphName(gid) != "square" {
+		t.Errorf("code A maps to %q", conv.GlyphName(gid))
+	}
+	if t1Font.Widths[65] != 500 {
+		t.Errorf("simple font widths changed: %v", t1Font.Widths)
+	}
+}
@@ -0,0 +1,143 @@
+package fonts
+
+import (
+	"bytes"
+	"encoding/hex"
+	"unicode/utf16"
+)
+
+// ParseToUnicodeCMap reads the bfchar and bfrange mappings of a ToUnicode
+// CMap stream into a code -> runes map.
+func ParseToUnicodeCMap(data []byte) map[int][]rune {
+	out := make(map[int][]rune)
+	toks := cmapTokens(data)
+	state := ""
+	for i := 0; i < len(toks); i++ {
+		switch t := toks[i]; t {
+		case "beginbfchar", "beginbfrange":
+			state = t
+			continue
+		case "endbfchar", "endbfrange":
+			state = ""
+			continue
+		}
+		switch state {
+		case "beginbfchar":
+			if i+1 >= len(toks) {
+				break
+			}
+			src, ok1 := cmapHex(toks[i])
+			dst, ok2 := cmapHex(toks[i+1])
+			if ok1 && ok2 {
+				out[cmapCode(src)] = cmapRunes(dst)
+			}
+			i++
+		case "beginbfrange":
+			if i+2 >= len(toks) {
+				break
+			}
+			lo, ok1 := cmapHex(toks[i])
+			hi, ok2 := cmapHex(toks[i+1])
+			if !ok1 || !ok2 {
+				continue
+			}
+			first, last := cmapCode(lo), cmapCode(hi)
+			if last < first || last-first > 0xffff {
+				i += 2
+				continue
+			}
+			if toks[i+2] == "[" {
+				i += 3
+				for code := first; i < len(toks) && toks[i] != "]"; i++ {
+					if dst, ok := cmapHex(toks[i]); ok && code <= last {
+						out[code] = cmapRunes(dst)
+					}
+					code++
+				}
+				continue
+			}
+			dst, ok := cmapHex(toks[i+2])
+			i += 2
+			if !ok || len(dst) == 0 {
+				continue
+			}
+			for code := first; code <= last; code++ {
+				out[code] = cmapRunes(dst)
+				// Ranges increment the last byte of the destination.
+				dst = append([]byte(nil), dst...)
+				dst[len(dst)-1]++
+			}
+		}
+	}
+	return out
+}
+
+// cmapTokens splits a CMap into hex strings (kept with their brackets),
+// array brackets and bare words.
+func cmapTokens(data []byte) []string {
+	var toks []string
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case c == '<' && (i+1 >= len(data) || data[i+1] != '<'):
+			end := bytes.IndexByte(data[i:], '>')
+			if end < 0 {
+				return toks
+			}
+			toks = append(toks, string(data[i:i+end+1]))
+			i += end + 1
+		case c == '[' || c == ']':
+			toks = append(toks, string(c))
+			i++
+		case c <= ' ' || bytes.IndexByte([]byte("<>(){}/"), c) >= 0:
+			i++
+		default:
+			start := i
+			for i < len(data) && data[i] > ' ' && bytes.IndexByte([]byte("<>[](){}/%"), data[i]) < 0 {
+				i++
+			}
+			toks = append(toks, string(data[start:i]))
+		}
+	}
+	return toks
+}
+
+func cmapHex(tok string) ([]byte, bool) {
+	if len(tok) < 2 || tok[0] != '<' || tok[len(tok)-1] != '>' {
+		return nil, false
+	}
+	digits := make([]byte, 0, len(tok))
+	for i := 1; i < len(tok)-1; i++ {
+		if tok[i] > ' ' {
+			digits = append(digits, tok[i])
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b := make([]byte, len(digits)/2)
+	if _, err := hex.Decode(b, digits); err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+func cmapCode(b []byte) int {
+	code := 0
+	for _, c := range b {
+		code = code<<8 | int(c)
+	}
+	return code
+}
+
+func cmapRunes(b []byte) []rune {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return utf16.Decode(units)
+}
@@ -0,0 +1,32 @@
+package fonts
+
+import "testing"
+
+func TestParseToUnicodeCMap(t *testing.T) {
+	cmap := []byte(`/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0003> <0020>
+<0010> <D83DDE00>
+endbfchar
+2 beginbfrange
+<0020> <0022> <0041>
+<0030> <0031> [<0066006C> <0078>]
+endbfrange
+endcmap
+end end`)
+	got := ParseToUnicodeCMap(cmap)
+	want := map[int]string{0x03: " ", 0x10: "\U0001F600", 0x20: "A", 0x21: "B", 0x22: "C", 0x30: "fl", 0x31: "x"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d mappings, want %d: %v", len(got), len(want), got)
+	}
+	for code, s := range want {
+		if string(got[code]) != s {
+			t.Errorf("code %#x = %q, want %q", code, string(got[code]), s)
+		}
+	}
+}
@@ -0,0 +1,503 @@
+package fonts
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// TrueTypeFont gives access to the glyph outlines and character maps of an
+// sfnt font program: TrueType outlines (FontFile2) or CFF-flavoured OpenType
+// (FontFile3 with Subtype OpenType).
+type TrueTypeFont struct {
+	unitsPerEm  float64
+	numGlyphs   int
+	locaFormat  int16
+	loca        []byte
+	glyf        []byte
+	hmtx        []byte
+	numHMetrics int
+	cmaps       []ttCMap
+	cff         *CFFFont
+}
+
+type ttCMap struct {
+	platformID uint16
+	encodingID uint16
+	lookup     func(code uint32) int
+}
+
+const maxCompositeDepth = 8
+
+// ParseTrueTypeFont parses an sfnt font program. The parser tolerates the
+// stripped-down subsets commonly embedded in PDFs: only head, maxp and either
+// glyf/loca or CFF are required.
+func ParseTrueTypeFont(data []byte) (*TrueTypeFont, error) {
+	p := &ttParser{data: data}
+	if err := p.ParseDirectory(); err != nil {
+		return nil, err
+	}
+	f := &TrueTypeFont{unitsPerEm: 1000}
+
+	head, err := p.ReadTable("head")
+	if err == nil && len(head) >= 54 {
+		if upem := binary.BigEndian.Uint16(head[18:20]); upem > 0 {
+			f.unitsPerEm = float64(upem)
+		}
+		f.locaFormat = int16(binary.BigEndian.Uint16(head[50:52]))
+	}
+	if maxp, err := p.ReadTable("maxp"); err == nil && len(maxp) >= 6 {
+		f.numGlyphs = int(binary.BigEndian.Uint16(maxp[4:6]))
+	}
+	if hhea, err := p.ReadTable("hhea"); err == nil && len(hhea) >= 36 {
+		f.numHMetrics = int(binary.BigEndian.Uint16(hhea[34:36]))
+	}
+	f.hmtx, _ = p.ReadTable("hmtx")
+
+	if cffData, err := p.ReadTable("CFF "); err == nil {
+		cff, err := ParseCFFFont(cffData)
+		if err != nil {
+			return nil, fmt.Errorf("parse CFF table: %w", err)
+		}
+		f.cff = cff
+		if f.numGlyphs == 0 {
+			f.numGlyphs = cff.NumGlyphs()
+		}
+	} else {
+		f.loca, err = p.ReadTable("loca")
+		if err != nil {
+			return nil, err
+		}
+		f.glyf, err = p.ReadTable("glyf")
+		if err != nil {
+			return nil, err
+		}
+		entry := 2
+		if f.locaFormat != 0 {
+			entry = 4
+		}
+		if n := len(f.loca)/entry - 1; f.numGlyphs == 0 || n < f.numGlyphs {
+			f.numGlyphs = n
+		}
+	}
+
+	if cmap, err := p.ReadTable("cmap"); err == nil {
+		f.cmaps = parseCMapTable(cmap)
+	}
+	return f, nil
+}
+
+// NumGlyphs reports the number of glyphs in the font.
+func (f *TrueTypeFont) NumGlyphs() int { return f.numGlyphs }
+
+// UnitsPerEm reports the glyph space resolution.
+func (f *TrueTypeFont) UnitsPerEm() float64 { return f.unitsPerEm }
+
+// HasCMap reports whether a (platform, encoding) cmap subtable is present.
+func (f *TrueTypeFont) HasCMap(platformID, encodingID int) bool {
+	for _, c := range f.cmaps {
+		if int(c.platformID) == platformID && int(c.encodingID) == encodingID {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupCMap maps code through the given cmap subtable. It returns false when
+// the subtable is missing or maps the code to .notdef.
+func (f *TrueTypeFont) LookupCMap(platformID, encodingID int, code uint32) (int, bool) {
+	for _, c := range f.cmaps {
+		if int(c.platformID) == platformID && int(c.encodingID) == encodingID {
+			if gid := c.lookup(code); gid > 0 {
+				return gid, true
+			}
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// LookupAnyCMap tries every cmap subtable in order.
+func (f *TrueTypeFont) LookupAnyCMap(code uint32) (int, bool) {
+	for _, c := range f.cmaps {
+		if gid := c.lookup(code); gid > 0 {
+			return gid, true
+		}
+	}
+	return 0, false
+}
+
+// Advance returns the horizontal advance of gid in font units.
+func (f *TrueTypeFont) Advance(gid int) float64 {
+	if f.numHMetrics == 0 || len(f.hmtx) < 4 {
+		return 0
+	}
+	idx := gid
+	if idx >= f.numHMetrics {
+		idx = f.numHMetrics - 1
+	}
+	if idx*4+2 > len(f.hmtx) {
+		return 0
+	}
+	return float64(binary.BigEndian.Uint16(f.hmtx[idx*4:]))
+}
+
+// CFF returns the embedded CFF program for CFF-flavoured OpenType fonts.
+func (f *TrueTypeFont) CFF() *CFFFont { return f.cff }
+
+// Outline returns the outline of gid in font units.
+func (f *TrueTypeFont) Outline(gid int) (*GlyphOutline, error) {
+	if gid < 0 || gid >= f.numGlyphs {
+		return nil, fmt.Errorf("glyph %d out of range", gid)
+	}
+	if f.cff != nil {
+		out, err := f.cff.Outline(gid)
+		if err != nil {
+			return nil, err
+		}
+		if adv := f.Advance(gid); adv > 0 {
+			out.Advance = adv
+		}
+		return out, nil
+	}
+	pen := &outlinePen{}
+	if err := f.appendGlyph(pen, gid, [6]float64{1, 0, 0, 1, 0, 0}, 0); err != nil {
+		return nil, err
+	}
+	return &GlyphOutline{Segments: pen.segs, Advance: f.Advance(gid)}, nil
+}
+
+func (f *TrueTypeFont) glyphData(gid int) []byte {
+	var start, end uint32
+	if f.locaFormat == 0 {
+		if (gid+1)*2+2 > len(f.loca) {
+			return nil
+		}
+		start = uint32(binary.BigEndian.Uint16(f.loca[gid*2:])) * 2
+		end = uint32(binary.BigEndian.Uint16(f.loca[gid*2+2:])) * 2
+	} else {
+		if (gid+1)*4+4 > len(f.loca) {
+			return nil
+		}
+		start = binary.BigEndian.Uint32(f.loca[gid*4:])
+		end = binary.BigEndian.Uint32(f.loca[gid*4+4:])
+	}
+	if start >= end || end > uint32(len(f.glyf)) {
+		return nil
+	}
+	return f.glyf[start:end]
+}
+
+// appendGlyph draws gid transformed by m (a, b, c, d, e, f) into pen.
+func (f *TrueTypeFont) appendGlyph(pen *outlinePen, gid int, m [6]float64, depth int) error {
+	if depth > maxCompositeDepth {
+		return errors.New("composite glyph nesting too deep")
+	}
+	g := f.glyphData(gid)
+	if len(g) < 10 {
+		return nil
+	}
+	numContours := int16(binary.BigEndian.Uint16(g))
+	if numContours >= 0 {
+		return appendSimpleGlyph(pen, g, int(numContours), m)
+	}
+	off := 10
+	for {
+		if off+4 > len(g) {
+			return nil
+		}
+		flags := binary.BigEndian.Uint16(g[off:])
+		sub := int(binary.BigEndian.Uint16(g[off+2:]))
+		off += 4
+		var dx, dy float64
+		if flags&0x0001 != 0 {
+			if off+4 > len(g) {
+				return nil
+			}
+			dx = float64(int16(binary.BigEndian.Uint16(g[off:])))
+			dy = float64(int16(binary.BigEndian.Uint16(g[off+2:])))
+			off += 4
+		} else {
+			if off+2 > len(g) {
+				return nil
+			}
+			dx = float64(int8(g[off]))
+			dy = float64(int8(g[off+1]))
+			off += 2
+		}
+		if flags&0x0002 == 0 {
+			// Point matching is rare in PDF-embedded fonts; fall back to no offset.
+			dx, dy = 0, 0
+		}
+		a, b, c, d := 1.0, 0.0, 0.0, 1.0
+		f2dot14 := func(i int) float64 { return float64(int16(binary.BigEndian.Uint16(g[i:]))) / 16384 }
+		switch {
+		case flags&0x0008 != 0 && off+2 <= len(g):
+			a = f2dot14(off)
+			d = a
+			off += 2
+		case flags&0x0040 != 0 && off+4 <= len(g):
+			a = f2dot14(off)
+			d = f2dot14(off + 2)
+			off += 4
+		case flags&0x0080 != 0 && off+8 <= len(g):
+			a = f2dot14(off)
+			b = f2dot14(off + 2)
+			c = f2dot14(off + 4)
+			d = f2dot14(off + 6)
+			off += 8
+		}
+		// Component transform followed by the parent transform.
+		cm := [6]float64{
+			a*m[0] + b*m[2], a*m[1] + b*m[3],
+			c*m[0] + d*m[2], c*m[1] + d*m[3],
+			dx*m[0] + dy*m[2] + m[4], dx*m[1] + dy*m[3] + m[5],
+		}
+		if err := f.appendGlyph(pen, sub, cm, depth+1); err != nil {
+			return err
+		}
+		if flags&0x0020 == 0 {
+			return nil
+		}
+	}
+}
+
+func appendSimpleGlyph(pen *outlinePen, g []byte, numContours int, m [6]float64) error {
+	off := 10
+	if off+2*numContours+2 > len(g) {
+		return errors.New("truncated glyph")
+	}
+	endPts := make([]int, numContours)
+	for i := range endPts {
+		endPts[i] = int(binary.BigEndian.Uint16(g[off:]))
+		off += 2
+	}
+	if numContours == 0 {
+		return nil
+	}
+	numPoints := endPts[numContours-1] + 1
+	insLen := int(binary.BigEndian.Uint16(g[off:]))
+	off += 2 + insLen
+	flags := make([]byte, 0, numPoints)
+	for len(flags) < numPoints {
+		if off >= len(g) {
+			return errors.New("truncated glyph flags")
+		}
+		fl := g[off]
+		off++
+		flags = append(flags, fl)
+		if fl&0x08 != 0 {
+			if off >= len(g) {
+				return errors.New("truncated glyph flags")
+			}
+			n := int(g[off])
+			off++
+			for k := 0; k < n && len(flags) < numPoints; k++ {
+				flags = append(flags, fl)
+			}
+		}
+	}
+	xs := make([]float64, numPoints)
+	ys := make([]float64, numPoints)
+	readCoords := func(dst []float64, shortBit, sameBit byte) error {
+		v := 0
+		for i, fl := range flags {
+			switch {
+			case fl&shortBit != 0:
+				if off >= len(g) {
+					return errors.New("truncated glyph coordinates")
+				}
+				d := int(g[off])
+				off++
+				if fl&sameBit == 0 {
+					d = -d
+				}
+				v += d
+			case fl&sameBit == 0:
+				if off+2 > len(g) {
+					return errors.New("truncated glyph coordinates")
+				}
+				v += int(int16(binary.BigEndian.Uint16(g[off:])))
+				off += 2
+			}
+			dst[i] = float64(v)
+		}
+		return nil
+	}
+	if err := readCoords(xs, 0x02, 0x10); err != nil {
+		return err
+	}
+	if err := readCoords(ys, 0x04, 0x20); err != nil {
+		return err
+	}
+	type pt struct {
+		x, y float64
+		on   bool
+	}
+	start := 0
+	for _, end := range endPts {
+		if end < start || end >= numPoints {
+			return errors.New("invalid contour end point")
+		}
+		pts := make([]pt, 0, end-start+1)
+		for i := start; i <= end; i++ {
+			x := xs[i]*m[0] + ys[i]*m[2] + m[4]
+			y := xs[i]*m[1] + ys[i]*m[3] + m[5]
+			pts = append(pts, pt{x, y, flags[i]&0x01 != 0})
+		}
+		start = end + 1
+		if len(pts) == 0 {
+			continue
+		}
+		// Rotate so the contour begins on an on-curve point, synthesizing one
+		// between two off-curve points when none exists.
+		first := -1
+		for i, p := range pts {
+			if p.on {
+				first = i
+				break
+			}
+		}
+		if first < 0 {
+			mid := pt{(pts[0].x + pts[1%len(pts)].x) / 2, (pts[0].y + pts[1%len(pts)].y) / 2, true}
+			pts = append([]pt{mid}, pts...)
+			first = 0
+		}
+		pts = append(pts[first:], pts[:first]...)
+		pen.moveTo(pts[0].x, pts[0].y)
+		var ctrl *pt
+		for i := 1; i <= len(pts); i++ {
+			p := pts[i%len(pts)]
+			if p.on {
+				if ctrl != nil {
+					pen.quadTo(ctrl.x, ctrl.y, p.x, p.y)
+					ctrl = nil
+				} else {
+					pen.lineTo(p.x, p.y)
+				}
+				continue
+			}
+			if ctrl != nil {
+				mx, my := (ctrl.x+p.x)/2, (ctrl.y+p.y)/2
+				pen.quadTo(ctrl.x, ctrl.y, mx, my)
+			}
+			cp := p
+			ctrl = &cp
+		}
+		pen.open = false
+	}
+	return nil
+}
+
+func parseCMapTable(data []byte) []ttCMap {
+	if len(data) < 4 {
+		return nil
+	}
+	n := int(binary.BigEndian.Uint16(data[2:]))
+	var out []ttCMap
+	for i := 0; i < n; i++ {
+		rec := 4 + i*8
+		if rec+8 > len(data) {
+			break
+		}
+		pid := binary.BigEndian.Uint16(data[rec:])
+		eid := binary.BigEndian.Uint16(data[rec+2:])
+		off := int(binary.BigEndian.Uint32(data[rec+4:]))
+		if off+2 > len(data) {
+			continue
+		}
+		if lookup := parseCMapSubtable(data[off:]); lookup != nil {
+			out = append(out, ttCMap{platformID: pid, encodingID: eid, lookup: lookup})
+		}
+	}
+	return out
+}
+
+func parseCMapSubtable(t []byte) func(uint32) int {
+	u16 := func(i int) int {
+		if i+2 > len(t) {
+			return 0
+		}
+		return int(binary.BigEndian.Uint16(t[i:]))
+	}
+	u32 := func(i int) uint32 {
+		if i+4 > len(t) {
+			return 0
+		}
+		return binary.BigEndian.Uint32(t[i:])
+	}
+	switch u16(0) {
+	case 0:
+		if len(t) < 6+256 {
+			return nil
+		}
+		table := t[6 : 6+256]
+		return func(code uint32) int {
+			if code > 255 {
+				return 0
+			}
+			return int(table[code])
+		}
+	case 4:
+		segX2 := u16(6)
+		endOff := 14
+		startOff := endOff + segX2 + 2
+		deltaOff := startOff + segX2
+		rangeOff := deltaOff + segX2
+		if rangeOff+segX2 > len(t) {
+			return nil
+		}
+		return func(code uint32) int {
+			if code > 0xFFFF {
+				return 0
+			}
+			c := int(code)
+			for s := 0; s < segX2; s += 2 {
+				if c > u16(endOff+s) {
+					continue
+				}
+				if c < u16(startOff+s) {
+					return 0
+				}
+				delta := u16(deltaOff + s)
+				ro := u16(rangeOff + s)
+				if ro == 0 {
+					return (c + delta) & 0xFFFF
+				}
+				idx := rangeOff + s + ro + 2*(c-u16(startOff+s))
+				gid := u16(idx)
+				if gid == 0 {
+					return 0
+				}
+				return (gid + delta) & 0xFFFF
+			}
+			return 0
+		}
+	case 6:
+		first := u16(6)
+		count := u16(8)
+		return func(code uint32) int {
+			c := int(code) - first
+			if c < 0 || c >= count {
+				return 0
+			}
+			return u16(10 + 2*c)
+		}
+	case 12:
+		groups := int(u32(12))
+		if 16+groups*12 > len(t) {
+			return nil
+		}
+		return func(code uint32) int {
+			for g := 0; g < groups; g++ {
+				base := 16 + g*12
+				start, end := u32(base), u32(base+4)
+				if code >= start && code <= end {
+					return int(u32(base+8) + code - start)
+				}
+			}
+			return 0
+		}
+	}
+	return nil
+}
@@ -0,0 +1,677 @@
+package fonts
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Type1Font exposes the glyph outlines of an embedded Type 1 font program
+// (FontFile). Both PFB files and the raw cleartext+eexec form stored in PDFs
+// are accepted.
+type Type1Font struct {
+	Name string
+
+	fontMatrix  [6]float64
+	encoding    map[int]string
+	charStrings map[string][]byte
+	subrs       [][]byte
+	names       []string
+	byName      map[string]int
+}
+
+const (
+	eexecKey      = 55665
+	charstringKey = 4330
+)
+
+// ParseType1Font parses a Type 1 font program. length1 and length2 are the
+// /Length1 and /Length2 values of the font file stream; when they are zero
+// or inconsistent the eexec section is located by scanning.
+func ParseType1Font(data []byte, length1, length2 int) (*Type1Font, error) {
+	clear, enc, err := splitType1(data, length1, length2)
+	if err != nil {
+		return nil, err
+	}
+	if isHexData(enc) {
+		enc = decodeHexLoose(enc)
+	}
+	priv := decryptType1(enc, eexecKey, 4)
+
+	f := &Type1Font{
+		fontMatrix:  [6]float64{0.001, 0, 0, 0.001, 0, 0},
+		encoding:    make(map[int]string),
+		charStrings: make(map[string][]byte),
+	}
+	f.parseCleartext(clear)
+	if err := f.parsePrivate(priv); err != nil {
+		return nil, err
+	}
+	f.names = make([]string, 0, len(f.charStrings))
+	for name := range f.charStrings {
+		f.names = append(f.names, name)
+	}
+	sort.Strings(f.names)
+	// Keep .notdef at glyph index 0 like other font formats.
+	for i, n := range f.names {
+		if n == ".notdef" {
+			f.names[0], f.names[i] = f.names[i], f.names[0]
+			break
+		}
+	}
+	f.byName = make(map[string]int, len(f.names))
+	for i, n := range f.names {
+		f.byName[n] = i
+	}
+	return f, nil
+}
+
+// NumGlyphs reports the number of charstrings.
+func (f *Type1Font) NumGlyphs() int { return len(f.names) }
+
+// UnitsPerEm derives the glyph space resolution from the FontMatrix.
+func (f *Type1Font) UnitsPerEm() float64 {
+	if f.fontMatrix[0] != 0 {
+		return 1 / f.fontMatrix[0]
+	}
+	return 1000
+}
+
+// FontMatrix returns the font's FontMatrix.
+func (f *Type1Font) FontMatrix() [6]float64 { return f.fontMatrix }
+
+// GlyphName returns the name of the glyph at gid.
+func (f *Type1Font) GlyphName(gid int) string {
+	if gid < 0 || gid >= len(f.names) {
+		return ""
+	}
+	return f.names[gid]
+}
+
+// GlyphIndexByName looks up a glyph index by name.
+func (f *Type1Font) GlyphIndexByName(name string) (int, bool) {
+	gid, ok := f.byName[name]
+	return gid, ok
+}
+
+// EncodingName returns the glyph name assigned to code by the font's
+// built-in encoding.
+func (f *Type1Font) EncodingName(code int) (string, bool) {
+	n, ok := f.encoding[code]
+	return n, ok
+}
+
+// Outline interprets the charstring of gid.
+func (f *Type1Font) Outline(gid int) (*GlyphOutline, error) {
+	if gid < 0 || gid >= len(f.names) {
+		return nil, fmt.Errorf("type1: glyph %d out of range", gid)
+	}
+	return f.outlineByName(f.names[gid], 0)
+}
+
+func (f *Type1Font) outlineByName(name string, depth int) (*GlyphOutline, error) {
+	cs, ok := f.charStrings[name]
+	if !ok {
+		return nil, fmt.Errorf("type1: glyph %q not found", name)
+	}
+	it := &type1Interp{font: f}
+	if err := it.run(cs, 0); err != nil {
+		return nil, err
+	}
+	out := &GlyphOutline{Segments: it.pen.segs, Advance: it.width}
+	if it.seac != nil && depth == 0 {
+		asb, adx, ady := it.seac[0], it.seac[1], it.seac[2]
+		bchar, achar := int(it.seac[3]), int(it.seac[4])
+		if bchar < 0 || bchar > 255 || achar < 0 || achar > 255 {
+			return out, nil
+		}
+		base, err := f.outlineByName(StandardEncoding[bchar], depth+1)
+		if err != nil {
+			return out, nil
+		}
+		accent, err := f.outlineByName(StandardEncoding[achar], depth+1)
+		if err != nil {
+			return &GlyphOutline{Segments: base.Segments, Advance: out.Advance}, nil
+		}
+		segs := append(append([]OutlineSegment{}, base.Segments...),
+			translateSegments(accent.Segments, it.sbx+adx-asb, ady)...)
+		return &GlyphOutline{Segments: segs, Advance: out.Advance}, nil
+	}
+	return out, nil
+}
+
+func splitType1(data []byte, length1, length2 int) ([]byte, []byte, error) {
+	if len(data) > 6 && data[0] == 0x80 {
+		var clear, enc []byte
+		for p := 0; p+6 <= len(data) && data[p] == 0x80; {
+			kind := data[p+1]
+			if kind == 3 {
+				break
+			}
+			n := int(uint32(data[p+2]) | uint32(data[p+3])<<8 | uint32(data[p+4])<<16 | uint32(data[p+5])<<24)
+			p += 6
+			if n < 0 || p+n > len(data) {
+				return nil, nil, errors.New("type1: truncated PFB segment")
+			}
+			if kind == 1 {
+				clear = append(clear, data[p:p+n]...)
+			} else {
+				enc = append(enc, data[p:p+n]...)
+			}
+			p += n
+		}
+		return clear, enc, nil
+	}
+	if length1 > 0 && length1 < len(data) && bytes.Contains(data[:length1], []byte("eexec")) {
+		end := len(data)
+		if length2 > 0 && length1+length2 <= len(data) {
+			end = length1 + length2
+		}
+		return data[:length1], data[length1:end], nil
+	}
+	idx := bytes.Index(data, []byte("eexec"))
+	if idx < 0 {
+		return nil, nil, errors.New("type1: eexec section not found")
+	}
+	p := idx + len("eexec")
+	for p < len(data) && (data[p] == '\r' || data[p] == '\n' || data[p] == ' ' || data[p] == '\t') {
+		p++
+	}
+	end := len(data)
+	if length2 > 0 && p+length2 <= len(data) {
+		end = p + length2
+	}
+	return data[:p], data[p:end], nil
+}
+
+func isHexData(b []byte) bool {
+	n := 0
+	for _, c := range b {
+		if c == ' ' || c == '\r' || c == '\n' || c == '\t' {
+			continue
+		}
+		if _, ok := hexDigit(c); !ok {
+			return false
+		}
+		n++
+		if n == 4 {
+			return true
+		}
+	}
+	return false
+}
+
+func hexDigit(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func decodeHexLoose(b []byte) []byte {
+	clean := make([]byte, 0, len(b))
+	for _, c := range b {
+		if _, ok := hexDigit(c); ok {
+			clean = append(clean, c)
+		}
+	}
+	if len(clean)%2 == 1 {
+		clean = clean[:len(clean)-1]
+	}
+	out := make([]byte, len(clean)/2)
+	hex.Decode(out, clean)
+	return out
+}
+
+func decryptType1(data []byte, key uint16, skip int) []byte {
+	r := key
+	out := make([]byte, len(data))
+	for i, c := range data {
+		out[i] = c ^ byte(r>>8)
+		r = (uint16(c)+r)*52845 + 22719
+	}
+	if skip < 0 {
+		return data
+	}
+	if skip > len(out) {
+		return nil
+	}
+	return out[skip:]
+}
+
+// type1Lexer walks PostScript tokens while allowing binary reads.
+type type1Lexer struct {
+	data []byte
+	pos  int
+}
+
+func (l *type1Lexer) token() string {
+	d := l.data
+	for l.pos < len(d) {
+		c := d[l.pos]
+		if c == '%' {
+			for l.pos < len(d) && d[l.pos] != '\n' && d[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0 {
+			l.pos++
+			continue
+		}
+		break
+	}
+	if l.pos >= len(d) {
+		return ""
+	}
+	start := l.pos
+	c := d[l.pos]
+	if c == '[' || c == ']' || c == '{' || c == '}' {
+		l.pos++
+		return string(c)
+	}
+	if c == '/' {
+		l.pos++
+	}
+	for l.pos < len(d) {
+		c = d[l.pos]
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0 ||
+			c == '[' || c == ']' || c == '{' || c == '}' || c == '/' || c == '%' || c == '(' || c == ')' {
+			break
+		}
+		l.pos++
+	}
+	return string(d[start:l.pos])
+}
+
+// binary reads n bytes following the single space after an RD/-| token.
+func (l *type1Lexer) binary(n int) []byte {
+	l.pos++ // separator
+	if n < 0 || l.pos+n > len(l.data) {
+		l.pos = len(l.data)
+		return nil
+	}
+	b := l.data[l.pos : l.pos+n]
+	l.pos += n
+	return b
+}
+
+func (f *Type1Font) parseCleartext(clear []byte) {
+	lx := &type1Lexer{data: clear}
+	for {
+		tok := lx.token()
+		if tok == "" {
+			return
+		}
+		switch tok {
+		case "/FontName":
+			if n := lx.token(); len(n) > 1 && n[0] == '/' {
+				f.Name = n[1:]
+			}
+		case "/FontMatrix":
+			if open := lx.token(); open != "[" && open != "{" {
+				continue
+			}
+			var m [6]float64
+			ok := true
+			for i := 0; i < 6; i++ {
+				v, err := strconv.ParseFloat(lx.token(), 64)
+				if err != nil {
+					ok = false
+					break
+				}
+				m[i] = v
+			}
+			if ok {
+				f.fontMatrix = m
+			}
+		case "/Encoding":
+			next := lx.token()
+			if next == "StandardEncoding" {
+				for code, name := range StandardEncoding {
+					if name != "" {
+						f.encoding[code] = name
+					}
+				}
+				continue
+			}
+			// Custom encodings: "dup <code> /<name> put" entries until "readonly" or "def".
+			for {
+				t := lx.token()
+				if t == "" || t == "readonly" || t == "def" {
+					break
+				}
+				if t != "dup" {
+					continue
+				}
+				code, err := strconv.Atoi(lx.token())
+				name := lx.token()
+				if err == nil && len(name) > 1 && name[0] == '/' {
+					f.encoding[code] = name[1:]
+				}
+			}
+		}
+	}
+}
+
+func (f *Type1Font) parsePrivate(priv []byte) error {
+	lenIV := 4
+	if idx := bytes.Index(priv, []byte("/lenIV")); idx >= 0 {
+		lx := &type1Lexer{data: priv, pos: idx + len("/lenIV")}
+		if v, err := strconv.Atoi(lx.token()); err == nil {
+			lenIV = v
+		}
+	}
+	if idx := bytes.Index(priv, []byte("/Subrs")); idx >= 0 {
+		lx := &type1Lexer{data: priv, pos: idx + len("/Subrs")}
+		count, err := strconv.Atoi(lx.token())
+		if err == nil && count > 0 && count < 1<<16 {
+			f.subrs = make([][]byte, count)
+			for n := 0; n < count; n++ {
+				tok := lx.token()
+				for tok != "" && tok != "dup" && tok != "/CharStrings" {
+					tok = lx.token()
+				}
+				if tok != "dup" {
+					break
+				}
+				i, err1 := strconv.Atoi(lx.token())
+				size, err2 := strconv.Atoi(lx.token())
+				lx.token() // RD or -|
+				if err1 != nil || err2 != nil {
+					break
+				}
+				b := lx.binary(size)
+				if i >= 0 && i < count {
+					f.subrs[i] = decryptType1(b, charstringKey, lenIV)
+				}
+				lx.token() // NP or |
+			}
+		}
+	}
+	idx := bytes.Index(priv, []byte("/CharStrings"))
+	if idx < 0 {
+		return errors.New("type1: CharStrings not found")
+	}
+	lx := &type1Lexer{data: priv, pos: idx + len("/CharStrings")}
+	for {
+		tok := lx.token()
+		if tok == "" || tok == "begin" {
+			break
+		}
+	}
+	for {
+		tok := lx.token()
+		if tok == "" || tok == "end" {
+			break
+		}
+		if len(tok) < 2 || tok[0] != '/' {
+			continue
+		}
+		size, err := strconv.Atoi(lx.token())
+		if err != nil {
+			continue
+		}
+		lx.token() // RD or -|
+		b := lx.binary(size)
+		f.charStrings[tok[1:]] = decryptType1(b, charstringKey, lenIV)
+		lx.token() // ND or |-
+	}
+	if len(f.charStrings) == 0 {
+		return errors.New("type1: no charstrings")
+	}
+	return nil
+}
+
+// type1Interp executes Type 1 charstrings (Adobe Type 1 Font Format, ch. 6).
+type type1Interp struct {
+	font    *Type1Font
+	pen     outlinePen
+	stack   []float64
+	psStack []float64
+	x, y    float64
+	sbx     float64
+	width   float64
+	flexing bool
+	flexPts []OutlinePoint
+	seac    []float64
+	ended   bool
+}
+
+func (it *type1Interp) moveTo(x, y float64) {
+	it.x, it.y = x, y
+	if it.flexing {
+		it.flexPts = append(it.flexPts, OutlinePoint{x, y})
+		return
+	}
+	it.pen.moveTo(x, y)
+}
+
+func (it *type1Interp) lineTo(x, y float64) {
+	it.x, it.y = x, y
+	it.pen.lineTo(x, y)
+}
+
+func (it *type1Interp) curve(dx1, dy1, dx2, dy2, dx3, dy3 float64) {
+	c1x, c1y := it.x+dx1, it.y+dy1
+	c2x, c2y := c1x+dx2, c1y+dy2
+	it.x, it.y = c2x+dx3, c2y+dy3
+	it.pen.cubeTo(c1x, c1y, c2x, c2y, it.x, it.y)
+}
+
+func (it *type1Interp) run(cs []byte, depth int) error {
+	if depth > maxSubrDepth {
+		return errCharstring
+	}
+	for i := 0; i < len(cs) && !it.ended; {
+		b := cs[i]
+		i++
+		switch {
+		case b >= 32 && b <= 246:
+			it.stack = append(it.stack, float64(int(b)-139))
+			continue
+		case b >= 247 && b <= 250:
+			if i >= len(cs) {
+				return errCharstring
+			}
+			it.stack = append(it.stack, float64((int(b)-247)*256+int(cs[i])+108))
+			i++
+			continue
+		case b >= 251 && b <= 254:
+			if i >= len(cs) {
+				return errCharstring
+			}
+			it.stack = append(it.stack, float64(-(int(b)-251)*256-int(cs[i])-108))
+			i++
+			continue
+		case b == 255:
+			if i+3 >= len(cs) {
+				return errCharstring
+			}
+			v := int32(uint32(cs[i])<<24 | uint32(cs[i+1])<<16 | uint32(cs[i+2])<<8 | uint32(cs[i+3]))
+			it.stack = append(it.stack, float64(v))
+			i += 4
+			continue
+		}
+		if len(it.stack) > maxCharstringStack {
+			return errCharstring
+		}
+		s := it.stack
+		need := func(n int) bool { return len(s) >= n }
+		switch b {
+		case 13: // hsbw
+			if !need(2) {
+				return errCharstring
+			}
+			it.sbx, it.width = s[0], s[1]
+			it.x, it.y = s[0], 0
+		case 21: // rmoveto
+			if !need(2) {
+				return errCharstring
+			}
+			it.moveTo(it.x+s[0], it.y+s[1])
+		case 22: // hmoveto
+			if !need(1) {
+				return errCharstring
+			}
+			it.moveTo(it.x+s[0], it.y)
+		case 4: // vmoveto
+			if !need(1) {
+				return errCharstring
+			}
+			it.moveTo(it.x, it.y+s[0])
+		case 5: // rlineto
+			if !need(2) {
+				return errCharstring
+			}
+			it.lineTo(it.x+s[0], it.y+s[1])
+		case 6: // hlineto
+			if !need(1) {
+				return errCharstring
+			}
+			it.lineTo(it.x+s[0], it.y)
+		case 7: // vlineto
+			if !need(1) {
+				return errCharstring
+			}
+			it.lineTo(it.x, it.y+s[0])
+		case 8: // rrcurveto
+			if !need(6) {
+				return errCharstring
+			}
+			it.curve(s[0], s[1], s[2], s[3], s[4], s[5])
+		case 30: // vhcurveto
+			if !need(4) {
+				return errCharstring
+			}
+			it.curve(0, s[0], s[1], s[2], s[3], 0)
+		case 31: // hvcurveto
+			if !need(4) {
+				return errCharstring
+			}
+			it.curve(s[0], 0, s[1], s[2], 0, s[3])
+		case 9: // closepath
+			it.pen.open = false
+		case 10: // callsubr
+			if !need(1) {
+				return errCharstring
+			}
+			idx := int(s[len(s)-1])
+			it.stack = s[:len(s)-1]
+			if idx < 0 || idx >= len(it.font.subrs) {
+				return errCharstring
+			}
+			if err := it.run(it.font.subrs[idx], depth+1); err != nil {
+				return err
+			}
+			continue
+		case 11: // return
+			return nil
+		case 14: // endchar
+			it.ended = true
+		case 1, 3: // hstem, vstem
+		case 12:
+			if i >= len(cs) {
+				return errCharstring
+			}
+			esc := cs[i]
+			i++
+			if keep, err := it.escape(esc); err != nil {
+				return err
+			} else if keep {
+				continue
+			}
+		}
+		it.stack = it.stack[:0]
+	}
+	return nil
+}
+
+// escape runs a two-byte operator. It reports whether the operand stack must
+// be preserved (for operators that push results).
+func (it *type1Interp) escape(op byte) (bool, error) {
+	s := it.stack
+	switch op {
+	case 0, 1, 2: // dotsection, vstem3, hstem3
+	case 6: // seac
+		if len(s) < 5 {
+			return false, errCharstring
+		}
+		it.seac = append([]float64{}, s[len(s)-5:]...)
+		it.ended = true
+	case 7: // sbw
+		if len(s) < 4 {
+			return false, errCharstring
+		}
+		it.sbx, it.width = s[0], s[2]
+		it.x, it.y = s[0], s[1]
+	case 12: // div
+		if len(s) < 2 {
+			return false, errCharstring
+		}
+		a, b := s[len(s)-2], s[len(s)-1]
+		v := 0.0
+		if b != 0 {
+			v = a / b
+		}
+		it.stack = append(s[:len(s)-2], v)
+		return true, nil
+	case 16: // callothersubr
+		if len(s) < 2 {
+			return false, errCharstring
+		}
+		other := int(s[len(s)-1])
+		n := int(s[len(s)-2])
+		s = s[:len(s)-2]
+		if n < 0 || n > len(s) {
+			return false, errCharstring
+		}
+		args := append([]float64{}, s[len(s)-n:]...)
+		it.stack = s[:len(s)-n]
+		switch other {
+		case 0: // end flex
+			it.flexing = false
+			if len(it.flexPts) >= 7 {
+				p := it.flexPts
+				it.pen.cubeTo(p[1].X, p[1].Y, p[2].X, p[2].Y, p[3].X, p[3].Y)
+				it.pen.cubeTo(p[4].X, p[4].Y, p[5].X, p[5].Y, p[6].X, p[6].Y)
+				it.x, it.y = p[6].X, p[6].Y
+			}
+			it.psStack = append(it.psStack[:0], it.y, it.x)
+		case 1: // start flex
+			it.flexing = true
+			it.flexPts = it.flexPts[:0]
+		case 2: // flex point, recorded by the preceding rmoveto
+		case 3: // hint replacement
+			it.psStack = append(it.psStack[:0], 3)
+		default:
+			it.psStack = it.psStack[:0]
+			for k := len(args) - 1; k >= 0; k-- {
+				it.psStack = append(it.psStack, args[k])
+			}
+		}
+		return true, nil
+	case 17: // pop
+		v := 0.0
+		if n := len(it.psStack); n > 0 {
+			v = it.psStack[n-1]
+			it.psStack = it.psStack[:n-1]
+		}
+		it.stack = append(it.stack, v)
+		return true, nil
+	case 33: // setcurrentpoint
+		if len(s) < 2 {
+			return false, errCharstring
+		}
+		it.x, it.y = s[0], s[1]
+	}
+	return false, nil
+}
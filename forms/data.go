@@ -0,0 +1,206 @@
+package forms
+
+import (
+	"errors"
+
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// Data is the form data exchanged through FDF and XFDF files: field values
+// and page annotations, detached from the document they belong to.
+type Data struct {
+	// File is the PDF file the data was exported from (FDF /F, XFDF <f>).
+	File        string
+	Fields      []FieldValue
+	Annotations []PageAnnotation
+}
+
+// FieldValue is the value of a field, identified by its fully qualified
+// name.
+type FieldValue struct {
+	Name string
+	// Type is the field type (Tx, Btn, Ch) when known. FDF files store the
+	// values of buttons as names.
+	Type string
+	// Values holds the field value: one entry for text fields and buttons
+	// (the on state, or "Off"), one per selected option for choice fields.
+	Values []string
+	// RichValue is the rich text (XHTML) value of a text field.
+	RichValue string
+}
+
+// PageAnnotation is an annotation together with the index of its page.
+type PageAnnotation struct {
+	Page       int
+	Annotation semantic.Annotation
+}
+
+// exchanged reports whether annotations of subtype travel in FDF and XFDF
+// files: the markup annotations a reviewer adds, not links, pop-ups or
+// widgets.
+func exchanged(subtype string) bool {
+	switch subtype {
+	case "Text", "FreeText", "Line", "Square", "Circle", "Highlight", "Underline",
+		"StrikeOut", "Squiggly", "Ink", "Stamp":
+		return true
+	}
+	return false
+}
+
+// Export collects the field values and markup annotations of doc. Fields
+// sharing a name, such as the buttons of a radio group, produce a single
+// value.
+func Export(doc *semantic.Document) *Data {
+	data := &Data{}
+	if doc == nil {
+		return data
+	}
+	if doc.AcroForm != nil {
+		index := make(map[string]int)
+		for _, field := range doc.AcroForm.Fields {
+			if field == nil || field.FieldName() == "" {
+				continue
+			}
+			v, ok := fieldValue(field)
+			if !ok {
+				continue
+			}
+			if i, seen := index[v.Name]; seen {
+				// A later radio button of the group holds the on state.
+				if len(v.Values) == 1 && v.Values[0] != "Off" {
+					data.Fields[i] = v
+				}
+				continue
+			}
+			index[v.Name] = len(data.Fields)
+			data.Fields = append(data.Fields, v)
+		}
+	}
+	for i, p := range doc.Pages {
+		for _, a := range p.Annotations {
+			if a != nil && exchanged(a.Type()) {
+				data.Annotations = append(data.Annotations, PageAnnotation{Page: i, Annotation: a})
+			}
+		}
+	}
+	return data
+}
+
+func fieldValue(field semantic.FormField) (FieldValue, bool) {
+	v := FieldValue{Name: field.FieldName(), Type: field.FieldType()}
+	switch f := field.(type) {
+	case *semantic.TextFormField:
+		v.Values = []string{f.Value}
+		v.RichValue = f.RichValue
+	case *semantic.ChoiceFormField:
+		v.Values = append([]string(nil), f.Selected...)
+	case *semantic.ButtonFormField:
+		if f.IsPush {
+			return v, false
+		}
+		v.Values = []string{"Off"}
+		if f.Checked {
+			v.Values[0] = onState(f)
+		}
+	case *semantic.GenericFormField:
+		v.Values = []string{f.Value}
+	default:
+		return v, false
+	}
+	return v, true
+}
+
+func onState(f *semantic.ButtonFormField) string {
+	if f.OnState != "" {
+		return f.OnState
+	}
+	return "Yes"
+}
+
+// Import applies data to doc. Field values are matched by fully qualified
+// name; names without a field in doc are ignored. An annotation replaces
+// the annotation with the same NM on its page and is added to the page
+// otherwise. Since the stored appearances of changed fields are out of
+// date, the form is marked as needing appearances.
+func Import(doc *semantic.Document, data *Data) error {
+	if doc == nil {
+		return errors.New("forms: document is nil")
+	}
+	if data == nil {
+		return nil
+	}
+	if form := doc.AcroForm; form != nil && len(data.Fields) > 0 {
+		byName := make(map[string][]semantic.FormField)
+		for _, field := range form.Fields {
+			if field != nil {
+				byName[field.FieldName()] = append(byName[field.FieldName()], field)
+			}
+		}
+		changed := false
+		for _, v := range data.Fields {
+			for _, field := range byName[v.Name] {
+				setValue(field, v)
+				field.SetDirty(true)
+				changed = true
+			}
+		}
+		if changed {
+			form.NeedAppearances = true
+			form.Dirty = true
+		}
+	}
+	for _, pa := range data.Annotations {
+		if pa.Annotation == nil || pa.Page < 0 || pa.Page >= len(doc.Pages) {
+			continue
+		}
+		p := doc.Pages[pa.Page]
+		replaced := false
+		if nm := pa.Annotation.Base().NM; nm != "" {
+			for i, a := range p.Annotations {
+				if a != nil && a.Base().NM == nm {
+					p.Annotations[i] = pa.Annotation
+					replaced = true
+					break
+				}
+			}
+		}
+		if !replaced {
+			p.Annotations = append(p.Annotations, pa.Annotation)
+		}
+		pa.Annotation.Base().Dirty = true
+		p.Dirty = true
+	}
+	return nil
+}
+
+func setValue(field semantic.FormField, v FieldValue) {
+	first := ""
+	if len(v.Values) > 0 {
+		first = v.Values[0]
+	}
+	switch f := field.(type) {
+	case *semantic.TextFormField:
+		f.Value = first
+		f.RichValue = v.RichValue
+	case *semantic.ChoiceFormField:
+		f.Selected = append([]string(nil), v.Values...)
+	case *semantic.ButtonFormField:
+		if f.IsPush {
+			return
+		}
+		on := first != "" && first != "Off"
+		if f.IsRadio && f.OnState != "" {
+			// Only the button whose on state is the value is selected.
+			on = on && f.OnState == first
+		} else if on && f.OnState == "" {
+			f.OnState = first
+		}
+		f.Checked = on
+		f.AppearanceState = "Off"
+		if on {
+			f.AppearanceState = onState(f)
+		}
+	case *semantic.GenericFormField:
+		f.Value = first
+	}
+}
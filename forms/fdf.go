@@ -0,0 +1,502 @@
+package forms
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/wudi/pdfkit/internal/pdftext"
+	"github.com/wudi/pdfkit/ir/raw"
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/parser"
+	"github.com/wudi/pdfkit/recovery"
+	"github.com/wudi/pdfkit/writer"
+	"github.com/wudi/pdfkit/xref"
+)
+
+// WriteFDF writes data as an FDF file (ISO 32000-1 §12.7.7). Field values
+// form a tree of partial names below /Fields; annotations are indirect
+// objects listed in /Annots, each with its /Page index.
+func WriteFDF(w io.Writer, data *Data) error {
+	if data == nil {
+		return errors.New("forms: data is nil")
+	}
+	fdf := raw.Dict()
+	if data.File != "" {
+		fdf.Set(raw.NameLiteral("F"), textString(data.File))
+	}
+	if len(data.Fields) > 0 {
+		fdf.Set(raw.NameLiteral("Fields"), fdfFields(fieldTree(data.Fields)))
+	}
+	var objects []raw.Object
+	if len(data.Annotations) > 0 {
+		annots := raw.NewArray()
+		for _, pa := range data.Annotations {
+			if pa.Annotation == nil {
+				continue
+			}
+			ref := raw.ObjectRef{Num: len(objects) + 2}
+			objects = append(objects, annotDict(pa.Annotation, pa.Page))
+			annots.Append(raw.Ref(ref.Num, ref.Gen))
+		}
+		fdf.Set(raw.NameLiteral("Annots"), annots)
+	}
+	catalog := raw.Dict()
+	catalog.Set(raw.NameLiteral("FDF"), fdf)
+	objects = append([]raw.Object{catalog}, objects...)
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("%FDF-1.2\n%\xe2\xe3\xcf\xd3\n")
+	s := writer.NewWriter()
+	for i, obj := range objects {
+		b, err := s.SerializeObject(raw.ObjectRef{Num: i + 1}, obj)
+		if err != nil {
+			return err
+		}
+		bw.Write(b)
+	}
+	bw.WriteString("trailer\n<</Root 1 0 R>>\n%%EOF\n")
+	return bw.Flush()
+}
+
+// fieldNode is a node of the field name tree; names are split at periods.
+type fieldNode struct {
+	name  string
+	value *FieldValue
+	kids  []*fieldNode
+}
+
+func fieldTree(values []FieldValue) []*fieldNode {
+	root := &fieldNode{}
+	for i := range values {
+		n := root
+		for _, part := range strings.Split(values[i].Name, ".") {
+			var next *fieldNode
+			for _, k := range n.kids {
+				if k.name == part {
+					next = k
+					break
+				}
+			}
+			if next == nil {
+				next = &fieldNode{name: part}
+				n.kids = append(n.kids, next)
+			}
+			n = next
+		}
+		n.value = &values[i]
+	}
+	return root.kids
+}
+
+func fdfFields(nodes []*fieldNode) *raw.ArrayObj {
+	arr := raw.NewArray()
+	for _, n := range nodes {
+		d := raw.Dict()
+		d.Set(raw.NameLiteral("T"), textString(n.name))
+		if v := n.value; v != nil {
+			switch {
+			case len(v.Values) == 1 && v.Type == "Btn":
+				d.Set(raw.NameLiteral("V"), nameObject(v.Values[0]))
+			case len(v.Values) == 1:
+				d.Set(raw.NameLiteral("V"), textString(v.Values[0]))
+			case len(v.Values) > 1:
+				vals := raw.NewArray()
+				for _, s := range v.Values {
+					vals.Append(textString(s))
+				}
+				d.Set(raw.NameLiteral("V"), vals)
+			}
+			if v.RichValue != "" {
+				d.Set(raw.NameLiteral("RV"), textString(v.RichValue))
+			}
+		}
+		if len(n.kids) > 0 {
+			d.Set(raw.NameLiteral("Kids"), fdfFields(n.kids))
+		}
+		arr.Append(d)
+	}
+	return arr
+}
+
+// ReadFDF reads an FDF file. FDF files carry no PDF header and usually no
+// cross-reference table, so objects are located by scanning the file.
+func ReadFDF(ctx context.Context, r io.ReaderAt) (*Data, error) {
+	p := parser.NewDocumentParser(parser.Config{XRef: xref.ResolverConfig{Recovery: scanObjects{}}})
+	doc, err := p.Parse(ctx, r)
+	if err != nil {
+		return nil, fmt.Errorf("forms: parse FDF: %w", err)
+	}
+	f := &fdfReader{doc: doc}
+	var catalog, fdf *raw.DictObj
+	if doc.Trailer != nil {
+		if root, ok := doc.Trailer.Get(raw.NameLiteral("Root")); ok {
+			catalog = f.dict(root)
+		}
+	}
+	if catalog != nil {
+		fdf = f.dict(f.get(catalog, "FDF"))
+	}
+	if fdf == nil {
+		return nil, errors.New("forms: FDF dictionary not found")
+	}
+	data := &Data{}
+	if s, ok := f.get(fdf, "F").(raw.String); ok {
+		data.File = pdftext.Decode(s.Value())
+	} else if spec := f.dict(f.get(fdf, "F")); spec != nil {
+		if s, ok := f.get(spec, "F").(raw.String); ok {
+			data.File = pdftext.Decode(s.Value())
+		}
+	}
+	if fields, ok := f.get(fdf, "Fields").(*raw.ArrayObj); ok {
+		f.fields(fields, "", &data.Fields, 0)
+	}
+	if annots, ok := f.get(fdf, "Annots").(*raw.ArrayObj); ok {
+		for _, item := range annots.Items {
+			d := f.dict(item)
+			if d == nil {
+				continue
+			}
+			if pa, ok := annotFromDict(d, f.resolve); ok {
+				data.Annotations = append(data.Annotations, pa)
+			}
+		}
+	}
+	return data, nil
+}
+
+// scanObjects asks the cross-reference resolver to rebuild the table by
+// scanning the file.
+type scanObjects struct{}
+
+func (scanObjects) OnError(ctx context.Context, err error, loc recovery.Location) recovery.Action {
+	if loc.Component == "xref" {
+		return recovery.ActionFix
+	}
+	return recovery.ActionFail
+}
+
+type fdfReader struct {
+	doc *raw.Document
+}
+
+// maxFieldDepth bounds the nesting of FDF field dictionaries.
+const maxFieldDepth = 32
+
+func (f *fdfReader) resolve(o raw.Object) raw.Object {
+	for i := 0; i < 8; i++ {
+		ref, ok := o.(raw.RefObj)
+		if !ok {
+			return o
+		}
+		o = f.doc.Objects[ref.Ref()]
+	}
+	return nil
+}
+
+func (f *fdfReader) dict(o raw.Object) *raw.DictObj {
+	d, _ := f.resolve(o).(*raw.DictObj)
+	return d
+}
+
+func (f *fdfReader) get(d *raw.DictObj, key string) raw.Object {
+	v, _ := d.Get(raw.NameLiteral(key))
+	return f.resolve(v)
+}
+
+func (f *fdfReader) fields(arr *raw.ArrayObj, prefix string, out *[]FieldValue, depth int) {
+	if depth > maxFieldDepth {
+		return
+	}
+	for _, item := range arr.Items {
+		d := f.dict(item)
+		if d == nil {
+			continue
+		}
+		name := prefix
+		if t, ok := f.get(d, "T").(raw.String); ok {
+			if name != "" {
+				name += "."
+			}
+			name += pdftext.Decode(t.Value())
+		}
+		v := FieldValue{Name: name}
+		switch val := f.get(d, "V").(type) {
+		case raw.String:
+			v.Values = []string{pdftext.Decode(val.Value())}
+		case raw.NameObj:
+			v.Values = []string{val.Value()}
+			v.Type = "Btn"
+		case *raw.ArrayObj:
+			for _, it := range val.Items {
+				switch s := f.resolve(it).(type) {
+				case raw.String:
+					v.Values = append(v.Values, pdftext.Decode(s.Value()))
+				case raw.NameObj:
+					v.Values = append(v.Values, s.Value())
+				}
+			}
+		}
+		switch rv := f.get(d, "RV").(type) {
+		case raw.String:
+			v.RichValue = pdftext.Decode(rv.Value())
+		case *raw.StreamObj:
+			v.RichValue = richStream(rv.Data)
+		}
+		if v.Values != nil || v.RichValue != "" {
+			*out = append(*out, v)
+		}
+		if kids, ok := f.get(d, "Kids").(*raw.ArrayObj); ok {
+			f.fields(kids, name, out, depth+1)
+		}
+	}
+}
+
+// annotDict builds the FDF dictionary of an annotation on page.
+func annotDict(a semantic.Annotation, page int) *raw.DictObj {
+	b := a.Base()
+	d := raw.Dict()
+	d.Set(raw.NameLiteral("Type"), raw.NameLiteral("Annot"))
+	d.Set(raw.NameLiteral("Subtype"), raw.NameLiteral(a.Type()))
+	d.Set(raw.NameLiteral("Page"), raw.NumberInt(int64(page)))
+	r := a.Rect()
+	d.Set(raw.NameLiteral("Rect"), numbers([]float64{r.LLX, r.LLY, r.URX, r.URY}))
+	setText := func(key, s string) {
+		if s != "" {
+			d.Set(raw.NameLiteral(key), textString(s))
+		}
+	}
+	setNumbers := func(key string, v []float64) {
+		if len(v) > 0 {
+			d.Set(raw.NameLiteral(key), numbers(v))
+		}
+	}
+	setText("Contents", b.Contents)
+	setText("RC", b.RichContents)
+	setText("NM", b.NM)
+	setText("T", b.Author)
+	setText("M", b.Modified)
+	if b.Flags != 0 {
+		d.Set(raw.NameLiteral("F"), raw.NumberInt(int64(b.Flags)))
+	}
+	setNumbers("C", b.Color)
+	setNumbers("Border", b.Border)
+	switch t := a.(type) {
+	case *semantic.TextAnnotation:
+		if t.Open {
+			d.Set(raw.NameLiteral("Open"), raw.Bool(true))
+		}
+		if t.Icon != "" {
+			d.Set(raw.NameLiteral("Name"), nameObject(t.Icon))
+		}
+	case *semantic.FreeTextAnnotation:
+		setText("DA", t.DA)
+		if t.Q != 0 {
+			d.Set(raw.NameLiteral("Q"), raw.NumberInt(int64(t.Q)))
+		}
+	case *semantic.LineAnnotation:
+		setNumbers("L", t.L)
+		if len(t.LE) > 0 {
+			le := raw.NewArray()
+			for _, s := range t.LE {
+				le.Append(nameObject(s))
+			}
+			d.Set(raw.NameLiteral("LE"), le)
+		}
+		setNumbers("IC", t.IC)
+	case *semantic.SquareAnnotation:
+		setNumbers("IC", t.IC)
+		setNumbers("RD", t.RD)
+	case *semantic.CircleAnnotation:
+		setNumbers("IC", t.IC)
+		setNumbers("RD", t.RD)
+	case *semantic.HighlightAnnotation:
+		setNumbers("QuadPoints", t.QuadPoints)
+	case *semantic.UnderlineAnnotation:
+		setNumbers("QuadPoints", t.QuadPoints)
+	case *semantic.StrikeOutAnnotation:
+		setNumbers("QuadPoints", t.QuadPoints)
+	case *semantic.SquigglyAnnotation:
+		setNumbers("QuadPoints", t.QuadPoints)
+	case *semantic.InkAnnotation:
+		ink := raw.NewArray()
+		for _, path := range t.InkList {
+			ink.Append(numbers(path))
+		}
+		d.Set(raw.NameLiteral("InkList"), ink)
+	case *semantic.StampAnnotation:
+		if t.Name != "" {
+			d.Set(raw.NameLiteral("Name"), nameObject(t.Name))
+		}
+	}
+	return d
+}
+
+// annotFromDict builds an annotation from its FDF dictionary.
+func annotFromDict(d *raw.DictObj, resolve func(raw.Object) raw.Object) (PageAnnotation, bool) {
+	get := func(key string) raw.Object {
+		v, _ := d.Get(raw.NameLiteral(key))
+		return resolve(v)
+	}
+	text := func(key string) string {
+		switch v := get(key).(type) {
+		case raw.String:
+			return pdftext.Decode(v.Value())
+		case *raw.StreamObj:
+			return richStream(v.Data)
+		}
+		return ""
+	}
+	nums := func(key string) []float64 {
+		arr, _ := get(key).(*raw.ArrayObj)
+		return floats(arr, resolve)
+	}
+	name := func(key string) string {
+		n, _ := get(key).(raw.NameObj)
+		return n.Value()
+	}
+	subtype := name("Subtype")
+	if !exchanged(subtype) {
+		return PageAnnotation{}, false
+	}
+	page := 0
+	if n, ok := get("Page").(raw.Number); ok {
+		page = int(n.Int())
+	}
+	base := semantic.BaseAnnotation{
+		Subtype:      subtype,
+		Contents:     text("Contents"),
+		RichContents: text("RC"),
+		NM:           text("NM"),
+		Author:       text("T"),
+		Modified:     text("M"),
+		Color:        nums("C"),
+		Border:       nums("Border"),
+	}
+	if r := nums("Rect"); len(r) == 4 {
+		base.RectVal = semantic.Rectangle{LLX: r[0], LLY: r[1], URX: r[2], URY: r[3]}
+	}
+	if n, ok := get("F").(raw.Number); ok {
+		base.Flags = int(n.Int())
+	}
+	var a semantic.Annotation
+	switch subtype {
+	case "Text":
+		t := &semantic.TextAnnotation{BaseAnnotation: base, Icon: name("Name")}
+		if b, ok := get("Open").(raw.BoolObj); ok {
+			t.Open = b.Value()
+		}
+		a = t
+	case "FreeText":
+		t := &semantic.FreeTextAnnotation{BaseAnnotation: base, DA: text("DA")}
+		if n, ok := get("Q").(raw.Number); ok {
+			t.Q = int(n.Int())
+		}
+		a = t
+	case "Line":
+		t := &semantic.LineAnnotation{BaseAnnotation: base, L: nums("L"), IC: nums("IC")}
+		if le, ok := get("LE").(*raw.ArrayObj); ok {
+			for _, it := range le.Items {
+				if n, ok := resolve(it).(raw.NameObj); ok {
+					t.LE = append(t.LE, n.Value())
+				}
+			}
+		}
+		a = t
+	case "Square":
+		a = &semantic.SquareAnnotation{BaseAnnotation: base, IC: nums("IC"), RD: nums("RD")}
+	case "Circle":
+		a = &semantic.CircleAnnotation{BaseAnnotation: base, IC: nums("IC"), RD: nums("RD")}
+	case "Highlight":
+		a = &semantic.HighlightAnnotation{BaseAnnotation: base, QuadPoints: nums("QuadPoints")}
+	case "Underline":
+		a = &semantic.UnderlineAnnotation{BaseAnnotation: base, QuadPoints: nums("QuadPoints")}
+	case "StrikeOut":
+		a = &semantic.StrikeOutAnnotation{BaseAnnotation: base, QuadPoints: nums("QuadPoints")}
+	case "Squiggly":
+		a = &semantic.SquigglyAnnotation{BaseAnnotation: base, QuadPoints: nums("QuadPoints")}
+	case "Ink":
+		t := &semantic.InkAnnotation{BaseAnnotation: base}
+		if ink, ok := get("InkList").(*raw.ArrayObj); ok {
+			for _, it := range ink.Items {
+				path, _ := resolve(it).(*raw.ArrayObj)
+				t.InkList = append(t.InkList, floats(path, resolve))
+			}
+		}
+		a = t
+	case "Stamp":
+		a = &semantic.StampAnnotation{BaseAnnotation: base, Name: name("Name")}
+	}
+	return PageAnnotation{Page: page, Annotation: a}, true
+}
+
+// nameObject returns a name whose characters outside the regular set are
+// written as #xx escapes.
+func nameObject(s string) raw.NameObj {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7F || strings.IndexByte("#%()/<>[]{}", c) >= 0 {
+			fmt.Fprintf(&b, "#%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return raw.NameLiteral(b.String())
+}
+
+func numbers(v []float64) *raw.ArrayObj {
+	arr := raw.NewArray()
+	for _, f := range v {
+		arr.Append(raw.NumberFloat(f))
+	}
+	return arr
+}
+
+func floats(arr *raw.ArrayObj, resolve func(raw.Object) raw.Object) []float64 {
+	if arr == nil {
+		return nil
+	}
+	out := make([]float64, 0, arr.Len())
+	for _, it := range arr.Items {
+		if n, ok := resolve(it).(raw.Number); ok {
+			out = append(out, n.Float())
+		}
+	}
+	return out
+}
+
+// textString encodes s as a PDF text string: ASCII text as a literal
+// string, anything else as UTF-16BE with a byte order mark.
+func textString(s string) raw.Object {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return raw.Str([]byte(s))
+	}
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 2, 2+2*len(units))
+	b[0], b[1] = 0xFE, 0xFF
+	for _, u := range units {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	return raw.HexStr(b)
+}
+
+// richStream decodes the rich text of a stream, which is XML in UTF-8
+// unless it carries the byte order mark of a text string.
+func richStream(b []byte) string {
+	if pdftext.HasBOM(b) {
+		return pdftext.Decode(b)
+	}
+	return string(b)
+}
@@ -0,0 +1,225 @@
+package forms
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+const richName = `<body xmlns="http://www.w3.org/1999/xhtml"><p><b>Jane</b> Doe</p></body>`
+
+// contract returns a two-page document with a filled form and review
+// annotations; blank returns the same document with empty fields and no
+// annotations.
+func contract(blank bool) *semantic.Document {
+	name := &semantic.TextFormField{BaseFormField: semantic.BaseFormField{Name: "party.name"}}
+	city := &semantic.TextFormField{BaseFormField: semantic.BaseFormField{Name: "party.city", PageIndex: 1}}
+	agree := &semantic.ButtonFormField{BaseFormField: semantic.BaseFormField{Name: "agree"}, IsCheck: true, OnState: "Yes"}
+	express := &semantic.ButtonFormField{BaseFormField: semantic.BaseFormField{Name: "ship"}, IsRadio: true, OnState: "Express"}
+	ground := &semantic.ButtonFormField{BaseFormField: semantic.BaseFormField{Name: "ship"}, IsRadio: true, OnState: "Ground"}
+	options := &semantic.ChoiceFormField{BaseFormField: semantic.BaseFormField{Name: "options"}, Options: []string{"A", "B", "C"}, IsMultiSelect: true}
+	doc := &semantic.Document{
+		Pages: []*semantic.Page{{}, {}},
+		AcroForm: &semantic.AcroForm{
+			Fields: []semantic.FormField{name, city, agree, express, ground, options},
+		},
+	}
+	if blank {
+		return doc
+	}
+	name.Value, name.RichValue = "Jane Doe", richName
+	city.Value = "Zürich"
+	agree.Checked = true
+	ground.Checked = true
+	options.Selected = []string{"A", "C"}
+	doc.Pages[0].Annotations = []semantic.Annotation{
+		&semantic.HighlightAnnotation{
+			BaseAnnotation: semantic.BaseAnnotation{
+				Subtype: "Highlight", NM: "h1", Author: "Reviewer", Contents: "Check this",
+				RichContents: `<body><p>Check <i>this</i></p></body>`, Modified: "D:20240102030405Z",
+				RectVal: semantic.Rectangle{LLX: 10, LLY: 20, URX: 110, URY: 40}, Color: []float64{1, 1, 0},
+				Flags: semantic.AnnotFlagPrint,
+			},
+			QuadPoints: []float64{10, 40, 110, 40, 10, 20, 110, 20},
+		},
+		&semantic.LinkAnnotation{BaseAnnotation: semantic.BaseAnnotation{Subtype: "Link"}, URI: "https://example.com"},
+	}
+	doc.Pages[1].Annotations = []semantic.Annotation{
+		&semantic.InkAnnotation{
+			BaseAnnotation: semantic.BaseAnnotation{Subtype: "Ink", NM: "ink1", Color: []float64{0, 0, 1},
+				RectVal: semantic.Rectangle{LLX: 0, LLY: 0, URX: 50, URY: 50}, Border: []float64{0, 0, 2}},
+			InkList: [][]float64{{1, 2, 3, 4}, {5, 6, 7.5, 8}},
+		},
+		&semantic.FreeTextAnnotation{
+			BaseAnnotation: semantic.BaseAnnotation{Subtype: "FreeText", NM: "note", Contents: "Approved",
+				RectVal: semantic.Rectangle{LLX: 100, LLY: 100, URX: 200, URY: 120}},
+			DA: "/Helv 12 Tf 0 g", Q: 1,
+		},
+		&semantic.LineAnnotation{
+			BaseAnnotation: semantic.BaseAnnotation{Subtype: "Line", NM: "arrow", RectVal: semantic.Rectangle{URX: 100, URY: 100}},
+			L:              []float64{0, 0, 100, 100}, LE: []string{"None", "OpenArrow"}, IC: []float64{1, 0, 0},
+		},
+	}
+	return doc
+}
+
+func checkExported(t *testing.T, data *Data) {
+	t.Helper()
+	got := make(map[string]FieldValue)
+	for _, v := range data.Fields {
+		got[v.Name] = v
+	}
+	want := map[string][]string{
+		"party.name": {"Jane Doe"}, "party.city": {"Zürich"}, "agree": {"Yes"}, "ship": {"Ground"}, "options": {"A", "C"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("fields = %+v", data.Fields)
+	}
+	for name, values := range want {
+		if !reflect.DeepEqual(got[name].Values, values) {
+			t.Errorf("%s = %q, want %q", name, got[name].Values, values)
+		}
+	}
+	if got["party.name"].RichValue != richName {
+		t.Errorf("rich value = %q", got["party.name"].RichValue)
+	}
+	if len(data.Annotations) != 4 {
+		t.Fatalf("annotations = %+v", data.Annotations)
+	}
+}
+
+// checkImported verifies that the filled contract was imported into a
+// blank one.
+func checkImported(t *testing.T, src, doc *semantic.Document) {
+	t.Helper()
+	for i, field := range doc.AcroForm.Fields {
+		if !reflect.DeepEqual(field, src.AcroForm.Fields[i]) {
+			t.Errorf("field %d = %+v, want %+v", i, field, src.AcroForm.Fields[i])
+		}
+	}
+	for i := range doc.Pages {
+		var want []semantic.Annotation
+		for _, a := range src.Pages[i].Annotations {
+			if a.Type() != "Link" {
+				want = append(want, a)
+			}
+		}
+		got := doc.Pages[i].Annotations
+		if len(got) != len(want) {
+			t.Fatalf("page %d annotations = %+v", i, got)
+		}
+		for j := range got {
+			g, w := got[j].Base(), want[j].Base()
+			if g.NM != w.NM || g.Contents != w.Contents || g.RichContents != w.RichContents || g.Author != w.Author ||
+				g.Modified != w.Modified || g.Flags != w.Flags || g.RectVal != w.RectVal || !reflect.DeepEqual(g.Color, w.Color) {
+				t.Errorf("page %d annotation %d = %+v, want %+v", i, j, *g, *w)
+			}
+		}
+	}
+	hl := doc.Pages[0].Annotations[0].(*semantic.HighlightAnnotation)
+	if !reflect.DeepEqual(hl.QuadPoints, []float64{10, 40, 110, 40, 10, 20, 110, 20}) {
+		t.Errorf("quad points = %v", hl.QuadPoints)
+	}
+	ink := doc.Pages[1].Annotations[0].(*semantic.InkAnnotation)
+	if !reflect.DeepEqual(ink.InkList, [][]float64{{1, 2, 3, 4}, {5, 6, 7.5, 8}}) || ink.Border[2] != 2 {
+		t.Errorf("ink = %+v", ink)
+	}
+	ft := doc.Pages[1].Annotations[1].(*semantic.FreeTextAnnotation)
+	if ft.DA != "/Helv 12 Tf 0 g" || ft.Q != 1 {
+		t.Errorf("free text = %+v", ft)
+	}
+	line := doc.Pages[1].Annotations[2].(*semantic.LineAnnotation)
+	if !reflect.DeepEqual(line.L, []float64{0, 0, 100, 100}) || !reflect.DeepEqual(line.LE, []string{"None", "OpenArrow"}) ||
+		!reflect.DeepEqual(line.IC, []float64{1, 0, 0}) {
+		t.Errorf("line = %+v", line)
+	}
+	if !doc.AcroForm.NeedAppearances {
+		t.Error("NeedAppearances not set after import")
+	}
+}
+
+// settle checks the appearance states Import selects for the buttons and
+// resets them, together with the dirty flags, so that fields compare equal
+// to the source.
+func settle(t *testing.T, doc *semantic.Document) {
+	t.Helper()
+	states := []string{"Yes", "Off", "Ground"}
+	for i, f := range doc.AcroForm.Fields {
+		f.SetDirty(false)
+		if b, ok := f.(*semantic.ButtonFormField); ok {
+			if want := states[i-2]; b.AppearanceState != want {
+				t.Errorf("%s appearance state = %q, want %q", b.Name, b.AppearanceState, want)
+			}
+			b.AppearanceState = ""
+		}
+	}
+}
+
+func TestFDFRoundTrip(t *testing.T) {
+	src := contract(false)
+	data := Export(src)
+	data.File = "contract.pdf"
+	checkExported(t, data)
+
+	var buf bytes.Buffer
+	if err := WriteFDF(&buf, data); err != nil {
+		t.Fatalf("write FDF: %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%FDF-1.2")) {
+		t.Fatalf("FDF header: %q", buf.Bytes()[:20])
+	}
+	read, err := ReadFDF(context.Background(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("read FDF: %v", err)
+	}
+	if read.File != "contract.pdf" {
+		t.Errorf("file = %q", read.File)
+	}
+	checkExported(t, read)
+
+	doc := contract(true)
+	// An annotation with the same NM is replaced rather than duplicated.
+	doc.Pages[1].Annotations = []semantic.Annotation{
+		&semantic.InkAnnotation{BaseAnnotation: semantic.BaseAnnotation{Subtype: "Ink", NM: "ink1"}},
+	}
+	if err := Import(doc, read); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	settle(t, doc)
+	checkImported(t, src, doc)
+}
+
+func TestReadFDFHierarchy(t *testing.T) {
+	// Partial names below Kids, a UTF-16 value, a button name value, a
+	// multi-selection array and a rich text value in a stream.
+	rv := `<body><p>Rich</p></body>`
+	fdf := "%FDF-1.2\n1 0 obj\n<< /FDF << /F (form.pdf) /Fields [\n" +
+		"<< /T (party) /Kids [ << /T (name) /V <FEFF004A00F6> >> << /T (note) /RV 2 0 R >> ] >>\n" +
+		"<< /T (agree) /V /On >>\n" +
+		"<< /T (options) /V [(A) (B)] >>\n" +
+		"] >> >>\nendobj\n" +
+		"2 0 obj\n<< /Length " + strconv.Itoa(len(rv)) + " >>\nstream\n" + rv + "\nendstream\nendobj\n" +
+		"trailer\n<< /Root 1 0 R >>\n%%EOF\n"
+	data, err := ReadFDF(context.Background(), strings.NewReader(fdf))
+	if err != nil {
+		t.Fatalf("read FDF: %v", err)
+	}
+	want := []FieldValue{
+		{Name: "party.name", Values: []string{"Jö"}},
+		{Name: "party.note", RichValue: rv},
+		{Name: "agree", Type: "Btn", Values: []string{"On"}},
+		{Name: "options", Values: []string{"A", "B"}},
+	}
+	if !reflect.DeepEqual(data.Fields, want) {
+		t.Fatalf("fields = %+v", data.Fields)
+	}
+
+	if _, err := ReadFDF(context.Background(), strings.NewReader("%FDF-1.2\n1 0 obj\n<< >>\nendobj\ntrailer\n<< /Root 1 0 R >>\n")); err == nil {
+		t.Fatal("expected error for missing FDF dictionary")
+	}
+}
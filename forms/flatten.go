@@ -0,0 +1,288 @@
+// Package forms works with the interactive forms (AcroForms) of semantic
+// documents.
+package forms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// FlattenOptions controls Flatten.
+type FlattenOptions struct {
+	// Fields names the fields to flatten. When empty, every field and
+	// widget annotation is flattened.
+	Fields []string
+	// PrintOnly draws only the widgets flagged for printing, as they appear
+	// on paper. By default every widget that is visible on screen is drawn.
+	PrintOnly bool
+}
+
+// Flatten turns form fields into static page content. The normal
+// appearance of each selected widget is drawn into its page as a form
+// XObject, positioned by the widget's Rect and the appearance's BBox and
+// Matrix; the widget annotations and their fields are then removed.
+//
+// Appearances are generated for fields that have none, and for every field
+// when the form sets NeedAppearances, since stored appearances may not show
+// the current values. Hidden widgets, and widgets that are not shown in the
+// selected mode, are removed without being drawn. XFA data is dropped once
+// any field is flattened, and the AcroForm itself once no fields or widgets
+// remain.
+func Flatten(ctx context.Context, doc *semantic.Document, opts FlattenOptions) error {
+	if doc == nil {
+		return errors.New("forms: document is nil")
+	}
+	f := &flattener{
+		doc:  doc,
+		opts: opts,
+		ops:  make(map[*semantic.Page][]semantic.Operation),
+	}
+	if len(opts.Fields) > 0 {
+		f.selected = make(map[string]bool, len(opts.Fields))
+		for _, name := range opts.Fields {
+			f.selected[name] = true
+		}
+	}
+	form := doc.AcroForm
+	if form == nil {
+		form = &semantic.AcroForm{}
+	}
+	f.gen = builder.NewAppearanceGenerator(form)
+	f.needAppearances = form.NeedAppearances
+
+	inForm := make(map[semantic.FormField]bool, len(form.Fields))
+	flattened := make(map[semantic.FormField]bool)
+	var kept []semantic.FormField
+	for _, field := range form.Fields {
+		inForm[field] = true
+		if !f.wants(field) {
+			kept = append(kept, field)
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		xo := f.appearance(field, field.GetAppearanceForm(), field.GetAppearance(), field.FieldRect(), field.GetRotation())
+		if err := f.draw(ctx, field.FieldPageIndex(), field.FieldRect(), field.GetAnnotationFlags(), xo); err != nil {
+			return fmt.Errorf("flatten field %q: %w", field.FieldName(), err)
+		}
+		flattened[field] = true
+	}
+
+	widgetsLeft := false
+	for i, p := range doc.Pages {
+		var annots []semantic.Annotation
+		for _, a := range p.Annotations {
+			w, ok := a.(*semantic.WidgetAnnotation)
+			if !ok {
+				annots = append(annots, a)
+				continue
+			}
+			switch {
+			case w.Field != nil && inForm[w.Field]:
+				// The field was drawn from the form, if selected.
+				if flattened[w.Field] {
+					continue
+				}
+			case f.wants(w.Field):
+				rotation := 0
+				if w.Field != nil {
+					rotation = w.Field.GetRotation()
+				}
+				xo := f.appearance(w.Field, w.AppearanceForm, w.Appearance, w.RectVal, rotation)
+				if err := f.draw(ctx, i, w.RectVal, w.Flags, xo); err != nil {
+					return fmt.Errorf("flatten widget on page %d: %w", i+1, err)
+				}
+				continue
+			}
+			annots = append(annots, a)
+			widgetsLeft = true
+		}
+		if len(annots) != len(p.Annotations) {
+			p.Annotations = annots
+			p.Dirty = true
+		}
+	}
+	f.finish()
+
+	if doc.AcroForm == nil || len(flattened) == 0 {
+		return nil
+	}
+	form.Fields = kept
+	var order []semantic.FormField
+	for _, field := range form.CalculationOrder {
+		if !flattened[field] {
+			order = append(order, field)
+		}
+	}
+	form.CalculationOrder = order
+	form.XFA = nil
+	form.Dirty = true
+	if len(kept) == 0 && !widgetsLeft {
+		doc.AcroForm = nil
+	}
+	return nil
+}
+
+type flattener struct {
+	doc             *semantic.Document
+	opts            FlattenOptions
+	selected        map[string]bool
+	gen             *builder.AppearanceGenerator
+	needAppearances bool
+	ops             map[*semantic.Page][]semantic.Operation
+	pages           []*semantic.Page // pages with ops, in drawing order
+}
+
+// wants reports whether a widget of field is selected for flattening.
+// Widgets without a field are only flattened along with everything else.
+func (f *flattener) wants(field semantic.FormField) bool {
+	if f.selected == nil {
+		return true
+	}
+	return field != nil && f.selected[field.FieldName()]
+}
+
+// visible reports whether a widget with the given annotation flags is
+// drawn.
+func (f *flattener) visible(flags int) bool {
+	if flags&semantic.AnnotFlagHidden != 0 {
+		return false
+	}
+	if f.opts.PrintOnly {
+		return flags&semantic.AnnotFlagPrint != 0
+	}
+	return flags&semantic.AnnotFlagNoView == 0
+}
+
+// appearance returns the normal appearance of a widget as a form XObject,
+// generating it when the widget has none or it is stale. It returns nil
+// when the widget has no appearance and none can be generated.
+func (f *flattener) appearance(field semantic.FormField, form *semantic.XObject, data []byte, rect semantic.Rectangle, rotation int) *semantic.XObject {
+	if form != nil && !f.needAppearances {
+		return form
+	}
+	if field != nil && ((form == nil && len(data) == 0) || f.needAppearances) {
+		if xo, err := f.gen.Generate(field); err == nil {
+			return xo
+		}
+	}
+	if form != nil {
+		return form
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	// A stored appearance is laid out in the widget's rotated box.
+	w, h := rect.URX-rect.LLX, rect.URY-rect.LLY
+	var matrix []float64
+	switch (rotation%360 + 360) % 360 {
+	case 90:
+		w, h = h, w
+		matrix = []float64{0, 1, -1, 0, 0, 0}
+	case 180:
+		matrix = []float64{-1, 0, 0, -1, 0, 0}
+	case 270:
+		w, h = h, w
+		matrix = []float64{0, -1, 1, 0, 0, 0}
+	}
+	var res *semantic.Resources
+	if f.doc.AcroForm != nil {
+		res = f.doc.AcroForm.DefaultResources
+	}
+	return &semantic.XObject{
+		Subtype:   "Form",
+		BBox:      semantic.Rectangle{URX: w, URY: h},
+		Matrix:    matrix,
+		Resources: res,
+		Data:      data,
+	}
+}
+
+// draw queues xo for painting into rect on page pageIndex.
+func (f *flattener) draw(ctx context.Context, pageIndex int, rect semantic.Rectangle, flags int, xo *semantic.XObject) error {
+	if xo == nil || !f.visible(flags) || pageIndex < 0 || pageIndex >= len(f.doc.Pages) {
+		return nil
+	}
+	cm, ok := fitMatrix(xo.BBox, xo.Matrix, rect)
+	if !ok {
+		return nil
+	}
+	p := f.doc.Pages[pageIndex]
+	if err := p.Load(ctx); err != nil {
+		return err
+	}
+	if p.Resources == nil {
+		p.Resources = &semantic.Resources{}
+	}
+	if p.Resources.XObjects == nil {
+		p.Resources.XObjects = make(map[string]semantic.XObject)
+	}
+	name := ""
+	for n := len(p.Resources.XObjects) + 1; ; n++ {
+		name = fmt.Sprintf("Flat%d", n)
+		if _, taken := p.Resources.XObjects[name]; !taken {
+			break
+		}
+	}
+	p.Resources.XObjects[name] = *xo
+
+	if _, seen := f.ops[p]; !seen {
+		f.pages = append(f.pages, p)
+	}
+	cmOps := make([]semantic.Operand, len(cm))
+	for i, v := range cm {
+		cmOps[i] = semantic.NumberOperand{Value: v}
+	}
+	f.ops[p] = append(f.ops[p],
+		semantic.Operation{Operator: "q"},
+		semantic.Operation{Operator: "cm", Operands: cmOps},
+		semantic.Operation{Operator: "Do", Operands: []semantic.Operand{semantic.NameOperand{Value: name}}},
+		semantic.Operation{Operator: "Q"},
+	)
+	return nil
+}
+
+// finish appends the queued appearances to their pages. The existing
+// content is wrapped in q/Q so that graphics state it leaves behind does
+// not affect the appearances.
+func (f *flattener) finish() {
+	for _, p := range f.pages {
+		contents := make([]semantic.ContentStream, 0, len(p.Contents)+2)
+		contents = append(contents, semantic.ContentStream{Operations: []semantic.Operation{{Operator: "q"}}})
+		contents = append(contents, p.Contents...)
+		ops := append([]semantic.Operation{{Operator: "Q"}}, f.ops[p]...)
+		p.Contents = append(contents, semantic.ContentStream{Operations: ops})
+		p.Dirty = true
+	}
+}
+
+// fitMatrix returns the matrix that maps a form's BBox, as transformed by
+// its Matrix, onto rect (ISO 32000-1 §12.5.5). It reports false when
+// either box is empty.
+func fitMatrix(bbox semantic.Rectangle, m []float64, rect semantic.Rectangle) ([]float64, bool) {
+	if len(m) != 6 {
+		m = []float64{1, 0, 0, 1, 0, 0}
+	}
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, pt := range [][2]float64{{bbox.LLX, bbox.LLY}, {bbox.URX, bbox.LLY}, {bbox.LLX, bbox.URY}, {bbox.URX, bbox.URY}} {
+		x := m[0]*pt[0] + m[2]*pt[1] + m[4]
+		y := m[1]*pt[0] + m[3]*pt[1] + m[5]
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+	llx, urx := math.Min(rect.LLX, rect.URX), math.Max(rect.LLX, rect.URX)
+	lly, ury := math.Min(rect.LLY, rect.URY), math.Max(rect.LLY, rect.URY)
+	if maxX-minX == 0 || maxY-minY == 0 || urx-llx == 0 || ury-lly == 0 {
+		return nil, false
+	}
+	sx := (urx - llx) / (maxX - minX)
+	sy := (ury - lly) / (maxY - minY)
+	return []float64{sx, 0, 0, sy, llx - minX*sx, lly - minY*sy}, true
+}
@@ -0,0 +1,171 @@
+package forms
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/ir"
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/writer"
+)
+
+func text(name string, rect semantic.Rectangle) *semantic.TextFormField {
+	return &semantic.TextFormField{BaseFormField: semantic.BaseFormField{
+		Name: name, Rect: rect, DefaultAppearance: "/Helv 10 Tf 0 g", AnnotationFlags: semantic.AnnotFlagPrint,
+	}}
+}
+
+// drawn returns the content appended to p by Flatten.
+func drawn(p *semantic.Page) string {
+	if len(p.Contents) == 0 {
+		return ""
+	}
+	return string(contentstream.Serialize(p.Contents[len(p.Contents)-1].Operations))
+}
+
+func TestFlattenFilledForm(t *testing.T) {
+	b := builder.NewBuilder()
+	b.NewPage(300, 300).
+		DrawText("Contract", 10, 280, builder.TextOptions{}).
+		AddFormField(text("Name", semantic.Rectangle{LLX: 10, LLY: 200, URX: 110, URY: 220})).
+		AddFormField(&semantic.ButtonFormField{BaseFormField: semantic.BaseFormField{
+			Name: "Agree", Rect: semantic.Rectangle{LLX: 10, LLY: 100, URX: 30, URY: 120},
+		}, IsCheck: true}).
+		Finish()
+	b.Form().SetText("Name", "Jane Doe").SetCheckbox("Agree", true)
+	doc, err := b.Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	doc.AcroForm.XFA = []byte("<xdp/>")
+
+	if err := Flatten(context.Background(), doc, FlattenOptions{}); err != nil {
+		t.Fatalf("flatten: %v", err)
+	}
+	if doc.AcroForm != nil {
+		t.Fatalf("AcroForm kept: %+v", doc.AcroForm)
+	}
+	p := doc.Pages[0]
+	if len(p.Resources.XObjects) != 2 {
+		t.Fatalf("xobjects = %v", p.Resources.XObjects)
+	}
+	name := p.Resources.XObjects["Flat1"]
+	if name.Subtype != "Form" || !strings.Contains(string(name.Data), "(Jane Doe) Tj") {
+		t.Fatalf("name appearance = %q", name.Data)
+	}
+	got := drawn(p)
+	for _, want := range []string{"Q", "1 0 0 1 10 200 cm", "/Flat1 Do", "1 0 0 1 10 100 cm", "/Flat2 Do"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("appended content %q lacks %q", got, want)
+		}
+	}
+	if first := p.Contents[0].Operations; len(first) != 1 || first[0].Operator != "q" {
+		t.Fatalf("original content not wrapped: %+v", p.Contents[0])
+	}
+
+	var buf bytes.Buffer
+	if err := writer.NewWriter().Write(context.Background(), doc, &buf, writer.Config{Deterministic: true}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("/AcroForm")) || bytes.Contains(buf.Bytes(), []byte("/Widget")) {
+		t.Fatal("written document is still interactive")
+	}
+	parsed, err := ir.NewDefault().Parse(context.Background(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	xo, ok := parsed.Pages[0].Resources.XObjects["Flat1"]
+	if !ok || xo.Subtype != "Form" || xo.BBox.URX != 100 || xo.BBox.URY != 20 || !strings.Contains(string(xo.Data), "Jane Doe") {
+		t.Fatalf("parsed appearance = %+v", xo)
+	}
+}
+
+func TestFlattenSelectedFields(t *testing.T) {
+	keep := text("Keep", semantic.Rectangle{LLX: 0, LLY: 0, URX: 50, URY: 10})
+	hidden := text("Hidden", semantic.Rectangle{LLX: 0, LLY: 20, URX: 50, URY: 30})
+	hidden.AnnotationFlags = semantic.AnnotFlagHidden | semantic.AnnotFlagPrint
+	screen := text("Screen", semantic.Rectangle{LLX: 0, LLY: 40, URX: 50, URY: 50})
+	screen.AnnotationFlags = 0
+	screen.Appearance = []byte("0 0 1 rg 0 0 50 10 re f")
+	doc := &semantic.Document{
+		Pages: []*semantic.Page{{MediaBox: semantic.Rectangle{URX: 100, URY: 100}}},
+		AcroForm: &semantic.AcroForm{
+			Fields:           []semantic.FormField{keep, hidden, screen},
+			CalculationOrder: []semantic.FormField{keep, hidden},
+			XFA:              []byte("<xdp/>"),
+		},
+	}
+
+	err := Flatten(context.Background(), doc, FlattenOptions{Fields: []string{"Hidden", "Screen"}, PrintOnly: true})
+	if err != nil {
+		t.Fatalf("flatten: %v", err)
+	}
+	form := doc.AcroForm
+	if form == nil || len(form.Fields) != 1 || form.Fields[0] != keep {
+		t.Fatalf("fields = %+v", form)
+	}
+	if len(form.CalculationOrder) != 1 || form.XFA != nil {
+		t.Fatalf("form = %+v", form)
+	}
+	// The hidden field is removed without drawing; the field shown only on
+	// screen is left out of a print flattening.
+	if p := doc.Pages[0]; p.Resources != nil || len(p.Contents) != 0 {
+		t.Fatalf("page drawn: %+v", p)
+	}
+
+	if err := Flatten(context.Background(), doc, FlattenOptions{}); err != nil {
+		t.Fatalf("flatten: %v", err)
+	}
+	if doc.AcroForm != nil || len(doc.Pages[0].Resources.XObjects) != 1 {
+		t.Fatalf("second flatten: form %+v, page %+v", doc.AcroForm, doc.Pages[0])
+	}
+}
+
+func TestFlattenWidgetGeometry(t *testing.T) {
+	// A stored appearance of a widget rotated by 90 degrees is laid out in a
+	// 100×20 box and turned into the 20×100 Rect.
+	field := text("Rotated", semantic.Rectangle{LLX: 100, LLY: 200, URX: 120, URY: 300})
+	field.Rotation = 90
+	field.Appearance = []byte("BT /Helv 10 Tf 2 5 Td (up) Tj ET")
+	widget := &semantic.WidgetAnnotation{BaseAnnotation: semantic.BaseAnnotation{
+		Subtype: "Widget", RectVal: semantic.Rectangle{LLX: 10, LLY: 10, URX: 30, URY: 20}, Appearance: []byte("0 g 0 0 20 10 re f"),
+	}}
+	link := &semantic.LinkAnnotation{BaseAnnotation: semantic.BaseAnnotation{Subtype: "Link"}, URI: "https://example.com"}
+	doc := &semantic.Document{
+		Pages: []*semantic.Page{{
+			MediaBox:    semantic.Rectangle{URX: 400, URY: 400},
+			Annotations: []semantic.Annotation{widget, link},
+			Contents:    []semantic.ContentStream{{RawBytes: []byte("0 0 m 10 10 l S")}},
+		}},
+		AcroForm: &semantic.AcroForm{Fields: []semantic.FormField{field}},
+	}
+	if err := Flatten(context.Background(), doc, FlattenOptions{}); err != nil {
+		t.Fatalf("flatten: %v", err)
+	}
+	p := doc.Pages[0]
+	if len(p.Annotations) != 1 || p.Annotations[0] != link {
+		t.Fatalf("annotations = %+v", p.Annotations)
+	}
+	rotated := p.Resources.XObjects["Flat1"]
+	if rotated.BBox.URX != 100 || rotated.BBox.URY != 20 || len(rotated.Matrix) != 6 || rotated.Matrix[1] != 1 {
+		t.Fatalf("rotated appearance = %+v", rotated)
+	}
+	got := drawn(p)
+	for _, want := range []string{"1 0 0 1 120 200 cm /Flat1 Do", "1 0 0 1 10 10 cm /Flat2 Do"} {
+		if !strings.Contains(strings.Join(strings.Fields(got), " "), want) {
+			t.Fatalf("appended content %q lacks %q", got, want)
+		}
+	}
+
+	cm, ok := fitMatrix(semantic.Rectangle{LLX: -5, LLY: -5, URX: 5, URY: 5}, nil, semantic.Rectangle{LLX: 0, LLY: 0, URX: 20, URY: 40})
+	if !ok || cm[0] != 2 || cm[3] != 4 || cm[4] != 10 || cm[5] != 20 {
+		t.Fatalf("fit = %v", cm)
+	}
+	if _, ok := fitMatrix(semantic.Rectangle{}, nil, semantic.Rectangle{URX: 1, URY: 1}); ok {
+		t.Fatal("expected empty BBox to be rejected")
+	}
+}
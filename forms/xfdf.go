@@ -0,0 +1,422 @@
+package forms
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/wudi/pdfkit/internal/pdfnum"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// xfdfNS is the XFDF namespace.
+const xfdfNS = "http://ns.adobe.com/xfdf/"
+
+type xfdfDoc struct {
+	XMLName xml.Name    `xml:"http://ns.adobe.com/xfdf/ xfdf"`
+	File    *xfdfFile   `xml:"f"`
+	Fields  []xfdfField `xml:"fields>field"`
+	Annots  *xfdfAnnots `xml:"annots"`
+}
+
+type xfdfFile struct {
+	Href string `xml:"href,attr"`
+}
+
+type xfdfAnnots struct {
+	Items []xfdfAnnot `xml:",any"`
+}
+
+type xfdfField struct {
+	Name   string      `xml:"name,attr"`
+	Values []string    `xml:"value"`
+	Rich   *xfdfRich   `xml:"value-richtext"`
+	Fields []xfdfField `xml:"field"`
+}
+
+// xfdfRich holds rich text (XHTML) markup verbatim.
+type xfdfRich struct {
+	Inner string `xml:",innerxml"`
+}
+
+type xfdfAnnot struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Contents *string    `xml:"contents"`
+	Rich     *xfdfRich  `xml:"contents-richtext"`
+	DA       *string    `xml:"defaultappearance"`
+	Gestures []string   `xml:"inklist>gesture"`
+}
+
+// xfdfElements maps annotation subtypes to XFDF element names.
+var xfdfElements = map[string]string{
+	"Text": "text", "FreeText": "freetext", "Line": "line", "Square": "square",
+	"Circle": "circle", "Highlight": "highlight", "Underline": "underline",
+	"StrikeOut": "strikeout", "Squiggly": "squiggly", "Ink": "ink", "Stamp": "stamp",
+}
+
+// xfdfFlags lists the XFDF names of the annotation flags, by bit.
+var xfdfFlags = []string{"invisible", "hidden", "print", "nozoom", "norotate", "noview",
+	"readonly", "locked", "togglenoview", "lockedcontents"}
+
+var xfdfJustification = []string{"left", "centered", "right"}
+
+// WriteXFDF writes data as an XFDF document (ISO 19444-1).
+func WriteXFDF(w io.Writer, data *Data) error {
+	if data == nil {
+		return errors.New("forms: data is nil")
+	}
+	doc := xfdfDoc{}
+	if data.File != "" {
+		doc.File = &xfdfFile{Href: data.File}
+	}
+	doc.Fields = xfdfFields(fieldTree(data.Fields))
+	for _, pa := range data.Annotations {
+		if pa.Annotation == nil {
+			continue
+		}
+		if x, ok := xfdfAnnotation(pa.Annotation, pa.Page); ok {
+			if doc.Annots == nil {
+				doc.Annots = &xfdfAnnots{}
+			}
+			doc.Annots.Items = append(doc.Annots.Items, x)
+		}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func xfdfFields(nodes []*fieldNode) []xfdfField {
+	var out []xfdfField
+	for _, n := range nodes {
+		f := xfdfField{Name: n.name, Fields: xfdfFields(n.kids)}
+		if v := n.value; v != nil {
+			f.Values = v.Values
+			if v.RichValue != "" {
+				f.Rich = richText(v.RichValue)
+			}
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// richText wraps rich text markup for verbatim output; text that is not
+// well-formed XML is escaped instead.
+func richText(s string) *xfdfRich {
+	d := xml.NewDecoder(strings.NewReader(s))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			return &xfdfRich{Inner: s}
+		}
+		if err != nil {
+			var b bytes.Buffer
+			xml.EscapeText(&b, []byte(s))
+			return &xfdfRich{Inner: b.String()}
+		}
+	}
+}
+
+func xfdfAnnotation(a semantic.Annotation, page int) (xfdfAnnot, bool) {
+	elem, ok := xfdfElements[a.Type()]
+	if !ok {
+		return xfdfAnnot{}, false
+	}
+	b := a.Base()
+	x := xfdfAnnot{XMLName: xml.Name{Local: elem}}
+	attr := func(name, value string) {
+		if value != "" {
+			x.Attrs = append(x.Attrs, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+		}
+	}
+	r := a.Rect()
+	attr("page", strconv.Itoa(page))
+	attr("rect", joinNumbers([]float64{r.LLX, r.LLY, r.URX, r.URY}, ","))
+	attr("name", b.NM)
+	attr("title", b.Author)
+	attr("date", b.Modified)
+	attr("flags", flagNames(b.Flags))
+	attr("color", hexColor(b.Color))
+	if len(b.Border) == 3 {
+		attr("width", pdfnum.Format(b.Border[2], -1))
+	}
+	if b.Contents != "" {
+		x.Contents = &b.Contents
+	}
+	if b.RichContents != "" {
+		x.Rich = richText(b.RichContents)
+	}
+	switch t := a.(type) {
+	case *semantic.TextAnnotation:
+		attr("icon", t.Icon)
+		if t.Open {
+			attr("open", "yes")
+		}
+	case *semantic.FreeTextAnnotation:
+		if t.Q > 0 && t.Q < len(xfdfJustification) {
+			attr("justification", xfdfJustification[t.Q])
+		}
+		if t.DA != "" {
+			x.DA = &t.DA
+		}
+	case *semantic.LineAnnotation:
+		if len(t.L) == 4 {
+			attr("start", joinNumbers(t.L[:2], ","))
+			attr("end", joinNumbers(t.L[2:], ","))
+		}
+		if len(t.LE) == 2 {
+			attr("head", t.LE[0])
+			attr("tail", t.LE[1])
+		}
+		attr("interior-color", hexColor(t.IC))
+	case *semantic.SquareAnnotation:
+		attr("interior-color", hexColor(t.IC))
+		attr("fringe", joinNumbers(t.RD, ","))
+	case *semantic.CircleAnnotation:
+		attr("interior-color", hexColor(t.IC))
+		attr("fringe", joinNumbers(t.RD, ","))
+	case *semantic.HighlightAnnotation:
+		attr("coords", joinNumbers(t.QuadPoints, ","))
+	case *semantic.UnderlineAnnotation:
+		attr("coords", joinNumbers(t.QuadPoints, ","))
+	case *semantic.StrikeOutAnnotation:
+		attr("coords", joinNumbers(t.QuadPoints, ","))
+	case *semantic.SquigglyAnnotation:
+		attr("coords", joinNumbers(t.QuadPoints, ","))
+	case *semantic.InkAnnotation:
+		for _, path := range t.InkList {
+			var pts []string
+			for i := 0; i+1 < len(path); i += 2 {
+				pts = append(pts, pdfnum.Format(path[i], -1)+","+pdfnum.Format(path[i+1], -1))
+			}
+			x.Gestures = append(x.Gestures, strings.Join(pts, ";"))
+		}
+	case *semantic.StampAnnotation:
+		attr("icon", t.Name)
+	}
+	return x, true
+}
+
+// ReadXFDF reads an XFDF document.
+func ReadXFDF(r io.Reader) (*Data, error) {
+	var doc xfdfDoc
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("forms: parse XFDF: %w", err)
+	}
+	if doc.XMLName.Space != xfdfNS && doc.XMLName.Space != "" {
+		return nil, fmt.Errorf("forms: unexpected XFDF namespace %q", doc.XMLName.Space)
+	}
+	data := &Data{}
+	if doc.File != nil {
+		data.File = doc.File.Href
+	}
+	readXFDFFields(doc.Fields, "", &data.Fields, 0)
+	if doc.Annots == nil {
+		return data, nil
+	}
+	for _, x := range doc.Annots.Items {
+		if pa, ok := xfdfAnnotationFrom(x); ok {
+			data.Annotations = append(data.Annotations, pa)
+		}
+	}
+	return data, nil
+}
+
+func readXFDFFields(fields []xfdfField, prefix string, out *[]FieldValue, depth int) {
+	if depth > maxFieldDepth {
+		return
+	}
+	for _, f := range fields {
+		name := f.Name
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if len(f.Values) > 0 || f.Rich != nil {
+			v := FieldValue{Name: name, Values: f.Values}
+			if f.Rich != nil {
+				v.RichValue = strings.TrimSpace(f.Rich.Inner)
+			}
+			*out = append(*out, v)
+		}
+		readXFDFFields(f.Fields, name, out, depth+1)
+	}
+}
+
+func xfdfAnnotationFrom(x xfdfAnnot) (PageAnnotation, bool) {
+	subtype := ""
+	for s, elem := range xfdfElements {
+		if elem == x.XMLName.Local {
+			subtype = s
+			break
+		}
+	}
+	if subtype == "" {
+		return PageAnnotation{}, false
+	}
+	attrs := make(map[string]string, len(x.Attrs))
+	for _, a := range x.Attrs {
+		attrs[a.Name.Local] = a.Value
+	}
+	page, _ := strconv.Atoi(attrs["page"])
+	base := semantic.BaseAnnotation{
+		Subtype:  subtype,
+		NM:       attrs["name"],
+		Author:   attrs["title"],
+		Modified: attrs["date"],
+		Flags:    flagBits(attrs["flags"]),
+		Color:    parseHexColor(attrs["color"]),
+	}
+	if r := splitNumbers(attrs["rect"]); len(r) == 4 {
+		base.RectVal = semantic.Rectangle{LLX: r[0], LLY: r[1], URX: r[2], URY: r[3]}
+	}
+	if w, err := strconv.ParseFloat(attrs["width"], 64); err == nil {
+		base.Border = []float64{0, 0, w}
+	}
+	if x.Contents != nil {
+		base.Contents = *x.Contents
+	}
+	if x.Rich != nil {
+		base.RichContents = strings.TrimSpace(x.Rich.Inner)
+	}
+	var a semantic.Annotation
+	switch subtype {
+	case "Text":
+		a = &semantic.TextAnnotation{BaseAnnotation: base, Icon: attrs["icon"], Open: attrs["open"] == "yes"}
+	case "FreeText":
+		t := &semantic.FreeTextAnnotation{BaseAnnotation: base}
+		for i, j := range xfdfJustification {
+			if attrs["justification"] == j {
+				t.Q = i
+			}
+		}
+		if x.DA != nil {
+			t.DA = *x.DA
+		}
+		a = t
+	case "Line":
+		t := &semantic.LineAnnotation{BaseAnnotation: base, IC: parseHexColor(attrs["interior-color"])}
+		if start, end := splitNumbers(attrs["start"]), splitNumbers(attrs["end"]); len(start) == 2 && len(end) == 2 {
+			t.L = append(start, end...)
+		}
+		if head, tail := attrs["head"], attrs["tail"]; head != "" || tail != "" {
+			t.LE = []string{orNone(head), orNone(tail)}
+		}
+		a = t
+	case "Square":
+		a = &semantic.SquareAnnotation{BaseAnnotation: base, IC: parseHexColor(attrs["interior-color"]), RD: splitNumbers(attrs["fringe"])}
+	case "Circle":
+		a = &semantic.CircleAnnotation{BaseAnnotation: base, IC: parseHexColor(attrs["interior-color"]), RD: splitNumbers(attrs["fringe"])}
+	case "Highlight":
+		a = &semantic.HighlightAnnotation{BaseAnnotation: base, QuadPoints: splitNumbers(attrs["coords"])}
+	case "Underline":
+		a = &semantic.UnderlineAnnotation{BaseAnnotation: base, QuadPoints: splitNumbers(attrs["coords"])}
+	case "StrikeOut":
+		a = &semantic.StrikeOutAnnotation{BaseAnnotation: base, QuadPoints: splitNumbers(attrs["coords"])}
+	case "Squiggly":
+		a = &semantic.SquigglyAnnotation{BaseAnnotation: base, QuadPoints: splitNumbers(attrs["coords"])}
+	case "Ink":
+		t := &semantic.InkAnnotation{BaseAnnotation: base}
+		for _, g := range x.Gestures {
+			t.InkList = append(t.InkList, splitNumbers(strings.ReplaceAll(g, ";", ",")))
+		}
+		a = t
+	case "Stamp":
+		a = &semantic.StampAnnotation{BaseAnnotation: base, Name: attrs["icon"]}
+	}
+	return PageAnnotation{Page: page, Annotation: a}, true
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "None"
+	}
+	return s
+}
+
+func flagNames(flags int) string {
+	var names []string
+	for bit, name := range xfdfFlags {
+		if flags&(1<<bit) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func flagBits(s string) int {
+	flags := 0
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		for bit, n := range xfdfFlags {
+			if n == name {
+				flags |= 1 << bit
+			}
+		}
+	}
+	return flags
+}
+
+// hexColor formats a gray, RGB or CMYK colour as #RRGGBB.
+func hexColor(c []float64) string {
+	var r, g, b float64
+	switch len(c) {
+	case 1:
+		r, g, b = c[0], c[0], c[0]
+	case 3:
+		r, g, b = c[0], c[1], c[2]
+	case 4:
+		r, g, b = (1-c[0])*(1-c[3]), (1-c[1])*(1-c[3]), (1-c[2])*(1-c[3])
+	default:
+		return ""
+	}
+	byteOf := func(v float64) int {
+		return int(pdfnum.Clamp01(v)*255 + 0.5)
+	}
+	return fmt.Sprintf("#%02X%02X%02X", byteOf(r), byteOf(g), byteOf(b))
+}
+
+func parseHexColor(s string) []float64 {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return nil
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return nil
+	}
+	return []float64{float64(v>>16&0xFF) / 255, float64(v>>8&0xFF) / 255, float64(v&0xFF) / 255}
+}
+
+func joinNumbers(v []float64, sep string) string {
+	parts := make([]string, len(v))
+	for i, f := range v {
+		parts[i] = pdfnum.Format(f, -1)
+	}
+	return strings.Join(parts, sep)
+}
+
+func splitNumbers(s string) []float64 {
+	if s == "" {
+		return nil
+	}
+	var out []float64
+	for _, part := range strings.Split(s, ",") {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(part), 64); err == nil {
+			out = append(out, f)
+		}
+	}
+	return out
+}
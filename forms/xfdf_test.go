@@ -0,0 +1,83 @@
+package forms
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestXFDFRoundTrip(t *testing.T) {
+	src := contract(false)
+	data := Export(src)
+	data.File = "contract.pdf"
+
+	var buf bytes.Buffer
+	if err := WriteXFDF(&buf, data); err != nil {
+		t.Fatalf("write XFDF: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{`xmlns="http://ns.adobe.com/xfdf/"`, `<f href="contract.pdf">`, richName, `<highlight`, `color="#FFFF00"`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("XFDF lacks %q:\n%s", want, out)
+		}
+	}
+	read, err := ReadXFDF(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("read XFDF: %v", err)
+	}
+	if read.File != "contract.pdf" {
+		t.Errorf("file = %q", read.File)
+	}
+	checkExported(t, read)
+
+	doc := contract(true)
+	if err := Import(doc, read); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	settle(t, doc)
+	checkImported(t, src, doc)
+}
+
+func TestReadXFDF(t *testing.T) {
+	const doc = `<?xml version="1.0" encoding="UTF-8"?>
+<xfdf xmlns="http://ns.adobe.com/xfdf/" xml:space="preserve">
+  <fields>
+    <field name="party">
+      <field name="name"><value>Jane</value></field>
+      <field name="bio"><value-richtext><body xmlns="http://www.w3.org/1999/xhtml"><p>Hi &amp; <b>bye</b></p></body></value-richtext></field>
+    </field>
+    <field name="options"><value>A</value><value>B</value></field>
+  </fields>
+  <annots>
+    <text page="1" rect="1,2,3,4" name="n1" title="Ann" color="#00FF00" flags="print,nozoom" icon="Comment" open="yes">
+      <contents>Hello</contents>
+    </text>
+    <unknown page="0" rect="0,0,1,1"/>
+  </annots>
+</xfdf>`
+	data, err := ReadXFDF(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("read XFDF: %v", err)
+	}
+	want := []FieldValue{
+		{Name: "party.name", Values: []string{"Jane"}},
+		{Name: "party.bio", RichValue: `<body xmlns="http://www.w3.org/1999/xhtml"><p>Hi &amp; <b>bye</b></p></body>`},
+		{Name: "options", Values: []string{"A", "B"}},
+	}
+	if !reflect.DeepEqual(data.Fields, want) {
+		t.Fatalf("fields = %+v", data.Fields)
+	}
+	if len(data.Annotations) != 1 || data.Annotations[0].Page != 1 {
+		t.Fatalf("annotations = %+v", data.Annotations)
+	}
+	a := data.Annotations[0].Annotation.Base()
+	if a.Subtype != "Text" || a.NM != "n1" || a.Author != "Ann" || a.Contents != "Hello" || a.Flags != 12 ||
+		a.RectVal.URX != 3 || !reflect.DeepEqual(a.Color, []float64{0, 1, 0}) {
+		t.Fatalf("annotation = %+v", *a)
+	}
+
+	if _, err := ReadXFDF(strings.NewReader(`<xfdf/>`)); err == nil {
+		t.Fatal("expected error for missing XFDF namespace")
+	}
+}
@@ -0,0 +1,275 @@
+// Package function evaluates PDF function objects (ISO 32000-1 §7.10):
+// sampled (Type 0), exponential (Type 2), stitching (Type 3) and PostScript
+// calculator (Type 4) functions.
+//
+// A function compiles once into an Evaluator: sample tables are decoded and
+// calculator programs are translated to a flat instruction list, so that
+// shadings, tint transforms and transfer functions can evaluate them for
+// every pixel cheaply. Evaluators are safe for concurrent use.
+package function
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// Evaluator is a compiled PDF function.
+type Evaluator struct {
+	domain  []float64
+	rng     []float64
+	inputs  int
+	outputs int
+	eval    func(x []float64) ([]float64, error)
+}
+
+// Inputs returns the number of input values, one per Domain interval.
+func (e *Evaluator) Inputs() int { return e.inputs }
+
+// Outputs returns the number of output values.
+func (e *Evaluator) Outputs() int { return e.outputs }
+
+// Eval clips in to the function's Domain, evaluates the function and clips
+// the results to its Range.
+func (e *Evaluator) Eval(in []float64) ([]float64, error) {
+	if len(in) < e.inputs {
+		return nil, fmt.Errorf("function takes %d inputs, got %d", e.inputs, len(in))
+	}
+	x := make([]float64, e.inputs)
+	for i := range x {
+		x[i] = clip(in[i], e.domain[2*i], e.domain[2*i+1])
+	}
+	out, err := e.eval(x)
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		if 2*i+1 < len(e.rng) {
+			out[i] = clip(out[i], e.rng[2*i], e.rng[2*i+1])
+		}
+	}
+	return out, nil
+}
+
+var cache sync.Map // semantic.Function -> *Evaluator or error
+
+// Eval evaluates fn at in, compiling it on first use. Compiled functions
+// are cached by identity, so fn must not be modified afterwards.
+func Eval(fn semantic.Function, in []float64) ([]float64, error) {
+	if fn == nil {
+		return nil, errors.New("function is nil")
+	}
+	cached, ok := cache.Load(fn)
+	if !ok {
+		e, err := Compile(fn)
+		if err != nil {
+			cached = err
+		} else {
+			cached = e
+		}
+		cache.Store(fn, cached)
+	}
+	if err, ok := cached.(error); ok {
+		return nil, err
+	}
+	return cached.(*Evaluator).Eval(in)
+}
+
+// Compile validates fn and prepares it for evaluation.
+func Compile(fn semantic.Function) (*Evaluator, error) {
+	return compile(fn, 0)
+}
+
+// maxDepth bounds the nesting of stitching functions.
+const maxDepth = 16
+
+func compile(fn semantic.Function, depth int) (*Evaluator, error) {
+	if fn == nil {
+		return nil, errors.New("function is nil")
+	}
+	if depth > maxDepth {
+		return nil, errors.New("stitching functions nested too deeply")
+	}
+	e := &Evaluator{domain: fn.FunctionDomain(), rng: fn.FunctionRange()}
+	if len(e.domain) == 0 && (fn.FunctionType() == 2 || fn.FunctionType() == 3) {
+		// Single-input functions are commonly written without a Domain.
+		e.domain = []float64{0, 1}
+	}
+	if err := checkDomain(e.domain); err != nil {
+		return nil, err
+	}
+	if len(e.rng)%2 != 0 {
+		return nil, errors.New("function Range must have an even number of entries")
+	}
+	e.inputs = len(e.domain) / 2
+	e.outputs = len(e.rng) / 2
+	switch f := fn.(type) {
+	case *semantic.SampledFunction:
+		s, err := newSampled(f, e.domain, e.rng)
+		if err != nil {
+			return nil, err
+		}
+		e.eval = s.eval
+	case *semantic.ExponentialFunction:
+		x, err := newExponential(f, e.domain)
+		if err != nil {
+			return nil, err
+		}
+		e.outputs = len(x.c0)
+		e.eval = x.eval
+	case *semantic.StitchingFunction:
+		s, err := newStitching(f, e.domain, depth)
+		if err != nil {
+			return nil, err
+		}
+		e.outputs = s.fns[0].outputs
+		e.eval = s.eval
+	case *semantic.PostScriptFunction:
+		if e.outputs == 0 {
+			return nil, errors.New("PostScript function requires Range")
+		}
+		prog, err := compilePostScript(f.Code)
+		if err != nil {
+			return nil, err
+		}
+		e.eval = prog.runner(e.inputs, e.outputs)
+	default:
+		return nil, fmt.Errorf("unsupported function type %d", fn.FunctionType())
+	}
+	if e.inputs != 1 && fn.FunctionType() != 0 && fn.FunctionType() != 4 {
+		return nil, fmt.Errorf("type %d function must take one input", fn.FunctionType())
+	}
+	return e, nil
+}
+
+func checkDomain(d []float64) error {
+	if len(d) == 0 || len(d)%2 != 0 {
+		return errors.New("function Domain must have an even, non-zero number of entries")
+	}
+	for i := 0; i < len(d); i += 2 {
+		if d[i] > d[i+1] {
+			return fmt.Errorf("function Domain interval %d is inverted", i/2)
+		}
+	}
+	return nil
+}
+
+func clip(v, lo, hi float64) float64 {
+	if math.IsNaN(v) || v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// interpolate maps x from [x0,x1] onto [y0,y1].
+func interpolate(x, x0, x1, y0, y1 float64) float64 {
+	if x1 == x0 {
+		return y0
+	}
+	return y0 + (x-x0)*(y1-y0)/(x1-x0)
+}
+
+// exponential is a Type 2 function: C0 + x^N × (C1 − C0).
+type exponential struct {
+	c0, c1 []float64
+	n      float64
+}
+
+func newExponential(f *semantic.ExponentialFunction, d []float64) (*exponential, error) {
+	x := &exponential{c0: f.C0, c1: f.C1, n: f.N}
+	if len(x.c0) == 0 {
+		x.c0 = []float64{0}
+	}
+	if len(x.c1) == 0 {
+		x.c1 = []float64{1}
+	}
+	if len(x.c0) != len(x.c1) {
+		return nil, errors.New("exponential function C0 and C1 differ in size")
+	}
+	if x.n != math.Trunc(x.n) && d[0] < 0 {
+		return nil, errors.New("exponential function with non-integer N needs a non-negative Domain")
+	}
+	if x.n < 0 && d[0] <= 0 && d[1] >= 0 {
+		return nil, errors.New("exponential function with negative N must exclude zero from its Domain")
+	}
+	return x, nil
+}
+
+func (x *exponential) eval(in []float64) ([]float64, error) {
+	p := in[0]
+	if x.n != 1 {
+		p = math.Pow(p, x.n)
+	}
+	out := make([]float64, len(x.c0))
+	for i := range out {
+		out[i] = x.c0[i] + p*(x.c1[i]-x.c0[i])
+	}
+	return out, nil
+}
+
+// stitching is a Type 3 function combining 1-input subfunctions over
+// adjacent subdomains.
+type stitching struct {
+	fns    []*Evaluator
+	bounds []float64
+	encode []float64
+	d0, d1 float64
+}
+
+func newStitching(f *semantic.StitchingFunction, domain []float64, depth int) (*stitching, error) {
+	k := len(f.Functions)
+	if k == 0 {
+		return nil, errors.New("stitching function has no subfunctions")
+	}
+	if len(f.Bounds) != k-1 {
+		return nil, fmt.Errorf("stitching function needs %d Bounds, has %d", k-1, len(f.Bounds))
+	}
+	if len(f.Encode) < 2*k {
+		return nil, fmt.Errorf("stitching function needs %d Encode values, has %d", 2*k, len(f.Encode))
+	}
+	s := &stitching{bounds: f.Bounds, encode: f.Encode, d0: domain[0], d1: domain[1]}
+	prev := s.d0
+	for _, b := range f.Bounds {
+		if b < prev || b > s.d1 {
+			return nil, errors.New("stitching function Bounds out of order")
+		}
+		prev = b
+	}
+	for i, sub := range f.Functions {
+		e, err := compile(sub, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("stitching subfunction %d: %w", i, err)
+		}
+		if e.inputs != 1 {
+			return nil, fmt.Errorf("stitching subfunction %d takes %d inputs", i, e.inputs)
+		}
+		if i > 0 && e.outputs != s.fns[0].outputs {
+			return nil, fmt.Errorf("stitching subfunction %d has %d outputs, want %d", i, e.outputs, s.fns[0].outputs)
+		}
+		s.fns = append(s.fns, e)
+	}
+	return s, nil
+}
+
+func (s *stitching) eval(in []float64) ([]float64, error) {
+	x := in[0]
+	// Subdomain k is [Bounds[k-1], Bounds[k]); the last one includes d1.
+	k := 0
+	for k < len(s.bounds) && x >= s.bounds[k] {
+		k++
+	}
+	lo, hi := s.d0, s.d1
+	if k > 0 {
+		lo = s.bounds[k-1]
+	}
+	if k < len(s.bounds) {
+		hi = s.bounds[k]
+	}
+	return s.fns[k].Eval([]float64{interpolate(x, lo, hi, s.encode[2*k], s.encode[2*k+1])})
+}
@@ -0,0 +1,228 @@
+package function
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+func base(typ int, domain, rng []float64) semantic.BaseFunction {
+	return semantic.BaseFunction{Type: typ, Domain: domain, Range: rng}
+}
+
+func eval(t *testing.T, fn semantic.Function, in ...float64) []float64 {
+	t.Helper()
+	out, err := Eval(fn, in)
+	if err != nil {
+		t.Fatalf("eval %v: %v", in, err)
+	}
+	return out
+}
+
+func approx(t *testing.T, got []float64, want ...float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range got {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestExponential(t *testing.T) {
+	fn := &semantic.ExponentialFunction{
+		BaseFunction: base(2, []float64{0, 1}, nil),
+		C0:           []float64{0, 1},
+		C1:           []float64{1, 0},
+		N:            2,
+	}
+	approx(t, eval(t, fn, 0.5), 0.25, 0.75)
+	// Inputs are clipped to the Domain.
+	approx(t, eval(t, fn, 2), 1, 0)
+	approx(t, eval(t, fn, -1), 0, 1)
+
+	e, err := Compile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Inputs() != 1 || e.Outputs() != 2 {
+		t.Fatalf("inputs/outputs = %d/%d", e.Inputs(), e.Outputs())
+	}
+
+	bad := &semantic.ExponentialFunction{BaseFunction: base(2, []float64{-1, 1}, nil), N: 0.5}
+	if _, err := Compile(bad); err == nil {
+		t.Fatal("expected error for non-integer N over negative domain")
+	}
+}
+
+func TestStitching(t *testing.T) {
+	up := &semantic.ExponentialFunction{BaseFunction: base(2, []float64{0, 1}, nil), C0: []float64{0}, C1: []float64{1}, N: 1}
+	down := &semantic.ExponentialFunction{BaseFunction: base(2, []float64{0, 1}, nil), C0: []float64{1}, C1: []float64{0}, N: 1}
+	fn := &semantic.StitchingFunction{
+		BaseFunction: base(3, []float64{0, 10}, []float64{0, 0.8}),
+		Functions:    []semantic.Function{up, down},
+		Bounds:       []float64{4},
+		Encode:       []float64{0, 1, 0, 1},
+	}
+	approx(t, eval(t, fn, 2), 0.5)
+	approx(t, eval(t, fn, 4), 0.8) // second subdomain starts at the bound; clipped to Range
+	approx(t, eval(t, fn, 7), 0.5)
+	approx(t, eval(t, fn, 10), 0)
+
+	fn.Bounds = nil
+	if _, err := Compile(fn); err == nil {
+		t.Fatal("expected error for missing Bounds")
+	}
+}
+
+func TestSampled(t *testing.T) {
+	// 2-input, 1-output table: f(x,y) = x + 2y on a 2×2 grid, 8-bit samples
+	// decoded to [0,3].
+	bilinear := &semantic.SampledFunction{
+		BaseFunction:  base(0, []float64{0, 1, 0, 1}, []float64{0, 3}),
+		Size:          []int{2, 2},
+		BitsPerSample: 8,
+		// The first input varies fastest.
+		Samples: []byte{0, 85, 170, 255},
+	}
+	approx(t, eval(t, bilinear, 0, 0), 0)
+	approx(t, eval(t, bilinear, 1, 1), 3)
+	approx(t, eval(t, bilinear, 0.5, 0.5), 1.5)
+	approx(t, eval(t, bilinear, 0.25, 1), 2.25)
+
+	// 12-bit samples with an Encode that reverses the table and a Decode.
+	reversed := &semantic.SampledFunction{
+		BaseFunction:  base(0, []float64{0, 1}, []float64{0, 1}),
+		Size:          []int{3},
+		BitsPerSample: 12,
+		Encode:        []float64{2, 0},
+		Decode:        []float64{0, 2},
+		Samples:       []byte{0x00, 0x08, 0x00, 0xFF, 0xF0},
+	}
+	// Samples 0, 0x800, 0xFFF decode to 0, ~1, 2 (clipped to Range 1).
+	approx(t, eval(t, reversed, 0), 1)
+	approx(t, eval(t, reversed, 1), 0)
+	if got := eval(t, reversed, 0.75); math.Abs(got[0]-float64(0x800)*2/4095/2) > 1e-9 {
+		t.Fatalf("got %v", got)
+	}
+
+	short := &semantic.SampledFunction{
+		BaseFunction:  base(0, []float64{0, 1}, []float64{0, 1}),
+		Size:          []int{4},
+		BitsPerSample: 8,
+		Samples:       []byte{1, 2},
+	}
+	if _, err := Compile(short); err == nil {
+		t.Fatal("expected error for truncated samples")
+	}
+}
+
+func ps(domain, rng []float64, code string) *semantic.PostScriptFunction {
+	return &semantic.PostScriptFunction{BaseFunction: base(4, domain, rng), Code: []byte(code)}
+}
+
+func TestPostScript(t *testing.T) {
+	unit := []float64{0, 1}
+	tests := []struct {
+		name string
+		code string
+		in   []float64
+		rng  []float64
+		want []float64
+	}{
+		{"arithmetic", "{ 2 mul 1 add 3 div }", []float64{0.5}, []float64{0, 10}, []float64{2.0 / 3}},
+		{"integers", "{ pop 7 2 idiv 7 2 mod 1 4 bitshift }", []float64{0}, []float64{0, 100, 0, 100, 0, 100}, []float64{3, 1, 16}},
+		{"trig", "{ pop 90 sin 0 cos 1 1 atan 45 div }", []float64{0}, []float64{-1, 1, -1, 1, 0, 2}, []float64{1, 1, 1}},
+		{"stack", "{ 1 2 3 3 1 roll 2 index exch pop }", []float64{0.5}, []float64{0, 5, 0, 5, 0, 5, 0, 5}, []float64{0.5, 3, 1, 3}},
+		{"copy", "{ dup 2 copy add add add }", []float64{0.25}, []float64{0, 1}, []float64{1}},
+		{"if", "{ dup 0.5 gt { pop 1 } if }", []float64{0.75}, unit, []float64{1}},
+		{"if not taken", "{ dup 0.5 gt { pop 1 } if }", []float64{0.25}, unit, []float64{0.25}},
+		{"ifelse", "{ 0.5 lt { 0 } { 1 } ifelse }", []float64{0.25}, unit, []float64{0}},
+		{"nested", "{ dup 0.5 lt { 0.25 lt { 0.1 } { 0.2 } ifelse } { pop 0.9 } ifelse }", []float64{0.3}, unit, []float64{0.2}},
+		{"booleans", "{ pop true false or 3 4 lt and { 1 } { 0 } ifelse }", []float64{0}, unit, []float64{1}},
+		{"rounding", "{ pop -2.5 round 2.5 round -2.7 truncate 2.2 ceiling -2.2 floor }", []float64{0}, []float64{-9, 9, -9, 9, -9, 9, -9, 9, -9, 9}, []float64{-2, 3, -2, 3, -3}},
+		{"range clip", "{ 10 mul }", []float64{0.5}, unit, []float64{1}},
+		{"comments", "{ % scale\n 2 mul }", []float64{0.25}, unit, []float64{0.5}},
+		{"cmyk tint", "{ dup 0.2 mul exch dup 0 mul exch dup 0.9 mul exch 0.1 mul }", []float64{1}, []float64{0, 1, 0, 1, 0, 1, 0, 1}, []float64{0.2, 0, 0.9, 0.1}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			domain := make([]float64, 0, 2*len(tc.in))
+			for range tc.in {
+				domain = append(domain, 0, 1)
+			}
+			approx(t, eval(t, ps(domain, tc.rng, tc.code), tc.in...), tc.want...)
+		})
+	}
+}
+
+func TestPostScriptErrors(t *testing.T) {
+	unit := []float64{0, 1}
+	compileErrors := map[string]string{
+		"unknown operator": "{ 1 frobnicate }",
+		"no braces":        "1 2 add",
+		"unterminated":     "{ 1 { 2 } if",
+		"bare procedure":   "{ { 1 } }",
+		"if without proc":  "{ true if }",
+	}
+	for name, code := range compileErrors {
+		if _, err := Compile(ps(unit, unit, code)); err == nil {
+			t.Errorf("%s: expected compile error", name)
+		}
+	}
+	runErrors := map[string]string{
+		"underflow":  "{ add add }",
+		"type check": "{ 1 idiv }",
+		"div zero":   "{ 0 div }",
+		"bool cond":  "{ { 1 } if }",
+		"overflow":   "{ " + strings.Repeat("1 ", 101) + "}",
+		"bool out":   "{ pop true }",
+	}
+	for name, code := range runErrors {
+		e, err := Compile(ps(unit, unit, code))
+		if err != nil {
+			t.Errorf("%s: compile: %v", name, err)
+			continue
+		}
+		if _, err := e.Eval([]float64{0.5}); err == nil {
+			t.Errorf("%s: expected evaluation error", name)
+		}
+	}
+	if _, err := Compile(ps(unit, nil, "{ }")); err == nil {
+		t.Error("expected error for missing Range")
+	}
+}
+
+func TestEvalCachesCompiledFunctions(t *testing.T) {
+	fn := ps([]float64{0, 1}, []float64{0, 1}, "{ 1 exch sub }")
+	approx(t, eval(t, fn, 0.25), 0.75)
+	cached, ok := cache.Load(semantic.Function(fn))
+	if !ok {
+		t.Fatal("function not cached")
+	}
+	approx(t, eval(t, fn, 0.5), 0.5)
+	if again, _ := cache.Load(semantic.Function(fn)); again != cached {
+		t.Fatal("function compiled twice")
+	}
+	if _, err := Eval(fn, nil); err == nil {
+		t.Fatal("expected error for missing inputs")
+	}
+}
+
+func BenchmarkPostScript(b *testing.B) {
+	e, err := Compile(ps([]float64{0, 1}, []float64{0, 1, 0, 1, 0, 1, 0, 1},
+		"{ dup 0.5 gt { dup 0.2 mul exch 0.4 mul } { dup 0.1 mul exch 0.3 mul } ifelse 0 1 }"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	in := []float64{0.7}
+	for i := 0; i < b.N; i++ {
+		if _, err := e.Eval(in); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,572 @@
+package function
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// A Type 4 function body is a PostScript calculator procedure. Compilation
+// flattens it into a list of instructions in which the conditional
+// operators become jumps, so evaluation is a single loop over a value
+// stack without any parsing or procedure objects.
+
+// psMaxStack is the operand stack limit of the calculator (ISO 32000-1
+// Annex C.2 sets it at 100).
+const psMaxStack = 100
+
+type psOp uint8
+
+const (
+	opPush      psOp = iota
+	opJump           // unconditional jump to arg
+	opJumpFalse      // pop a boolean, jump to arg when false
+
+	opAbs
+	opAdd
+	opAtan
+	opCeiling
+	opCos
+	opCvi
+	opCvr
+	opDiv
+	opExp
+	opFloor
+	opIdiv
+	opLn
+	opLog
+	opMod
+	opMul
+	opNeg
+	opRound
+	opSin
+	opSqrt
+	opSub
+	opTruncate
+
+	opAnd
+	opBitshift
+	opEq
+	opGe
+	opGt
+	opLe
+	opLt
+	opNe
+	opNot
+	opOr
+	opXor
+
+	opCopy
+	opDup
+	opExch
+	opIndex
+	opPop
+	opRoll
+)
+
+var psOperators = map[string]psOp{
+	"abs": opAbs, "add": opAdd, "atan": opAtan, "ceiling": opCeiling,
+	"cos": opCos, "cvi": opCvi, "cvr": opCvr, "div": opDiv, "exp": opExp,
+	"floor": opFloor, "idiv": opIdiv, "ln": opLn, "log": opLog, "mod": opMod,
+	"mul": opMul, "neg": opNeg, "round": opRound, "sin": opSin,
+	"sqrt": opSqrt, "sub": opSub, "truncate": opTruncate,
+	"and": opAnd, "bitshift": opBitshift, "eq": opEq, "ge": opGe, "gt": opGt,
+	"le": opLe, "lt": opLt, "ne": opNe, "not": opNot, "or": opOr, "xor": opXor,
+	"copy": opCopy, "dup": opDup, "exch": opExch, "index": opIndex,
+	"pop": opPop, "roll": opRoll,
+}
+
+type psKind uint8
+
+const (
+	psInt psKind = iota
+	psReal
+	psBool
+)
+
+// psValue is a calculator operand. Integers and booleans are held in v as
+// well (booleans as 0 or 1).
+type psValue struct {
+	v    float64
+	kind psKind
+}
+
+type psInstr struct {
+	op  psOp
+	val psValue // operand of opPush
+	arg int     // jump target
+}
+
+type psProgram []psInstr
+
+// psNode is a parsed procedure element: a token or a nested procedure.
+type psNode struct {
+	tok  string
+	proc []psNode
+	sub  bool
+}
+
+func compilePostScript(code []byte) (psProgram, error) {
+	toks := psTokens(code)
+	if len(toks) == 0 || toks[0] != "{" {
+		return nil, errors.New("PostScript function must be a procedure in braces")
+	}
+	body, next, err := parsePSProc(toks, 1)
+	if err != nil {
+		return nil, err
+	}
+	if next != len(toks) {
+		return nil, errors.New("PostScript function has tokens after its procedure")
+	}
+	var prog psProgram
+	if err := prog.emit(body); err != nil {
+		return nil, err
+	}
+	return prog, nil
+}
+
+func psTokens(code []byte) []string {
+	var toks []string
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+	}
+	for i := 0; i < len(code); {
+		c := code[i]
+		switch {
+		case c == '{' || c == '}':
+			toks = append(toks, string(c))
+			i++
+		case isSpace(c):
+			i++
+		case c == '%':
+			for i < len(code) && code[i] != '\n' && code[i] != '\r' {
+				i++
+			}
+		default:
+			j := i
+			for j < len(code) && !isSpace(code[j]) && code[j] != '{' && code[j] != '}' && code[j] != '%' {
+				j++
+			}
+			toks = append(toks, string(code[i:j]))
+			i = j
+		}
+	}
+	return toks
+}
+
+// parsePSProc parses the procedure body starting at pos, just after its
+// opening brace, and returns the position after the closing brace.
+func parsePSProc(toks []string, pos int) ([]psNode, int, error) {
+	var nodes []psNode
+	for pos < len(toks) {
+		t := toks[pos]
+		pos++
+		switch t {
+		case "}":
+			return nodes, pos, nil
+		case "{":
+			sub, next, err := parsePSProc(toks, pos)
+			if err != nil {
+				return nil, 0, err
+			}
+			nodes = append(nodes, psNode{proc: sub, sub: true})
+			pos = next
+		default:
+			nodes = append(nodes, psNode{tok: t})
+		}
+	}
+	return nil, 0, errors.New("PostScript function has an unterminated procedure")
+}
+
+// emit appends the instructions of a procedure body. Nested procedures are
+// only valid as the operands of if and ifelse.
+func (p *psProgram) emit(nodes []psNode) error {
+	for i := 0; i < len(nodes); i++ {
+		n := nodes[i]
+		switch {
+		case n.sub && i+1 < len(nodes) && nodes[i+1].tok == "if":
+			jump := p.add(psInstr{op: opJumpFalse})
+			if err := p.emit(n.proc); err != nil {
+				return err
+			}
+			(*p)[jump].arg = len(*p)
+			i++
+		case n.sub && i+2 < len(nodes) && nodes[i+1].sub && nodes[i+2].tok == "ifelse":
+			jumpElse := p.add(psInstr{op: opJumpFalse})
+			if err := p.emit(n.proc); err != nil {
+				return err
+			}
+			jumpEnd := p.add(psInstr{op: opJump})
+			(*p)[jumpElse].arg = len(*p)
+			if err := p.emit(nodes[i+1].proc); err != nil {
+				return err
+			}
+			(*p)[jumpEnd].arg = len(*p)
+			i += 2
+		case n.sub:
+			return errors.New("PostScript procedure must be followed by if or ifelse")
+		case n.tok == "true" || n.tok == "false":
+			p.add(psInstr{op: opPush, val: psBoolValue(n.tok == "true")})
+		case n.tok == "if" || n.tok == "ifelse":
+			return fmt.Errorf("PostScript %s without procedure operands", n.tok)
+		default:
+			if op, ok := psOperators[n.tok]; ok {
+				p.add(psInstr{op: op})
+				continue
+			}
+			v, err := parsePSNumber(n.tok)
+			if err != nil {
+				return err
+			}
+			p.add(psInstr{op: opPush, val: v})
+		}
+	}
+	return nil
+}
+
+func (p *psProgram) add(in psInstr) int {
+	*p = append(*p, in)
+	return len(*p) - 1
+}
+
+func parsePSNumber(tok string) (psValue, error) {
+	if i, err := strconv.ParseInt(tok, 10, 32); err == nil {
+		return psValue{v: float64(i), kind: psInt}, nil
+	}
+	if f, err := strconv.ParseFloat(tok, 64); err == nil {
+		return psValue{v: f, kind: psReal}, nil
+	}
+	return psValue{}, fmt.Errorf("PostScript function uses unknown operator %q", tok)
+}
+
+func psBoolValue(b bool) psValue {
+	if b {
+		return psValue{v: 1, kind: psBool}
+	}
+	return psValue{kind: psBool}
+}
+
+// runner returns the evaluation function of the program for the given
+// number of inputs and outputs.
+func (p psProgram) runner(inputs, outputs int) func([]float64) ([]float64, error) {
+	return func(x []float64) ([]float64, error) {
+		var buf [psMaxStack]psValue
+		st := buf[:0]
+		for _, v := range x[:inputs] {
+			st = append(st, psValue{v: v, kind: psReal})
+		}
+		st, err := p.run(st)
+		if err != nil {
+			return nil, err
+		}
+		if len(st) < outputs {
+			return nil, fmt.Errorf("PostScript function left %d values, want %d", len(st), outputs)
+		}
+		out := make([]float64, outputs)
+		for i, v := range st[len(st)-outputs:] {
+			if v.kind == psBool {
+				return nil, errors.New("PostScript function returned a boolean")
+			}
+			out[i] = v.v
+		}
+		return out, nil
+	}
+}
+
+var (
+	errStackUnderflow = errors.New("PostScript stack underflow")
+	errStackOverflow  = errors.New("PostScript stack overflow")
+	errTypeCheck      = errors.New("PostScript type check")
+	errRangeCheck     = errors.New("PostScript range check")
+	errUndefined      = errors.New("PostScript undefined result")
+)
+
+func (p psProgram) run(st []psValue) ([]psValue, error) {
+	for pc := 0; pc < len(p); pc++ {
+		in := &p[pc]
+		switch in.op {
+		case opPush:
+			if len(st) == psMaxStack {
+				return nil, errStackOverflow
+			}
+			st = append(st, in.val)
+			continue
+		case opJump:
+			pc = in.arg - 1
+			continue
+		case opJumpFalse:
+			if len(st) == 0 {
+				return nil, errStackUnderflow
+			}
+			c := st[len(st)-1]
+			st = st[:len(st)-1]
+			if c.kind != psBool {
+				return nil, errTypeCheck
+			}
+			if c.v == 0 {
+				pc = in.arg - 1
+			}
+			continue
+		}
+		var err error
+		if st, err = psExec(in.op, st); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// psExec applies a stack or arithmetic operator.
+func psExec(op psOp, st []psValue) ([]psValue, error) {
+	n := len(st)
+	need := 2
+	switch op {
+	case opAbs, opCeiling, opCos, opCvi, opCvr, opFloor, opLn, opLog, opNeg,
+		opRound, opSin, opSqrt, opTruncate, opNot, opDup, opPop, opCopy, opIndex:
+		need = 1
+	}
+	if n < need {
+		return nil, errStackUnderflow
+	}
+	if need == 1 {
+		a := st[n-1]
+		switch op {
+		case opDup:
+			if n == psMaxStack {
+				return nil, errStackOverflow
+			}
+			return append(st, a), nil
+		case opPop:
+			return st[:n-1], nil
+		case opCopy:
+			k, err := psIndexArg(a, n-1)
+			if err != nil {
+				return nil, err
+			}
+			st = st[:n-1]
+			if len(st)+k > psMaxStack {
+				return nil, errStackOverflow
+			}
+			return append(st, st[len(st)-k:]...), nil
+		case opIndex:
+			k, err := psIndexArg(a, n-2)
+			if err != nil {
+				return nil, err
+			}
+			st[n-1] = st[n-2-k]
+			return st, nil
+		case opNot:
+			switch a.kind {
+			case psBool:
+				st[n-1] = psBoolValue(a.v == 0)
+			case psInt:
+				st[n-1] = psValue{v: float64(^int32(a.v)), kind: psInt}
+			default:
+				return nil, errTypeCheck
+			}
+			return st, nil
+		}
+		if a.kind == psBool {
+			return nil, errTypeCheck
+		}
+		r, err := psUnary(op, a)
+		if err != nil {
+			return nil, err
+		}
+		st[n-1] = r
+		return st, nil
+	}
+
+	a, b := st[n-2], st[n-1]
+	switch op {
+	case opExch:
+		st[n-2], st[n-1] = b, a
+		return st, nil
+	case opRoll:
+		if a.kind != psInt || b.kind != psInt {
+			return nil, errTypeCheck
+		}
+		k, j := int(a.v), int(b.v)
+		st = st[:n-2]
+		if k < 0 || k > len(st) {
+			return nil, errRangeCheck
+		}
+		if k > 0 {
+			seg := st[len(st)-k:]
+			j = ((j % k) + k) % k
+			rolled := append(append(make([]psValue, 0, k), seg[k-j:]...), seg[:k-j]...)
+			copy(seg, rolled)
+		}
+		return st, nil
+	}
+	r, err := psBinary(op, a, b)
+	if err != nil {
+		return nil, err
+	}
+	st[n-2] = r
+	return st[:n-1], nil
+}
+
+// psIndexArg validates the integer operand of copy and index against the
+// number of values available.
+func psIndexArg(v psValue, avail int) (int, error) {
+	if v.kind != psInt {
+		return 0, errTypeCheck
+	}
+	k := int(v.v)
+	if k < 0 || k > avail {
+		return 0, errRangeCheck
+	}
+	return k, nil
+}
+
+func psUnary(op psOp, a psValue) (psValue, error) {
+	real := func(v float64) (psValue, error) {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return psValue{}, errUndefined
+		}
+		return psValue{v: v, kind: psReal}, nil
+	}
+	same := func(v float64) (psValue, error) { return psValue{v: v, kind: a.kind}, nil }
+	switch op {
+	case opAbs:
+		return same(math.Abs(a.v))
+	case opNeg:
+		return same(-a.v)
+	case opCeiling:
+		return same(math.Ceil(a.v))
+	case opFloor:
+		return same(math.Floor(a.v))
+	case opRound:
+		return same(math.Floor(a.v + 0.5))
+	case opTruncate:
+		return same(math.Trunc(a.v))
+	case opCvi:
+		t := math.Trunc(a.v)
+		if t < math.MinInt32 || t > math.MaxInt32 {
+			return psValue{}, errRangeCheck
+		}
+		return psValue{v: t, kind: psInt}, nil
+	case opCvr:
+		return psValue{v: a.v, kind: psReal}, nil
+	case opSqrt:
+		if a.v < 0 {
+			return psValue{}, errRangeCheck
+		}
+		return real(math.Sqrt(a.v))
+	case opSin:
+		return real(math.Sin(a.v * math.Pi / 180))
+	case opCos:
+		return real(math.Cos(a.v * math.Pi / 180))
+	case opLn:
+		if a.v <= 0 {
+			return psValue{}, errRangeCheck
+		}
+		return real(math.Log(a.v))
+	case opLog:
+		if a.v <= 0 {
+			return psValue{}, errRangeCheck
+		}
+		return real(math.Log10(a.v))
+	}
+	return psValue{}, fmt.Errorf("PostScript operator %d is not unary", op)
+}
+
+func psBinary(op psOp, a, b psValue) (psValue, error) {
+	switch op {
+	case opEq, opNe:
+		if (a.kind == psBool) != (b.kind == psBool) {
+			return psBoolValue(op == opNe), nil
+		}
+		return psBoolValue((a.v == b.v) == (op == opEq)), nil
+	case opAnd, opOr, opXor:
+		if a.kind != b.kind || a.kind == psReal {
+			return psValue{}, errTypeCheck
+		}
+		x, y := int32(a.v), int32(b.v)
+		var r int32
+		switch op {
+		case opAnd:
+			r = x & y
+		case opOr:
+			r = x | y
+		default:
+			r = x ^ y
+		}
+		return psValue{v: float64(r), kind: a.kind}, nil
+	}
+	if a.kind == psBool || b.kind == psBool {
+		return psValue{}, errTypeCheck
+	}
+	ints := a.kind == psInt && b.kind == psInt
+	arith := func(v float64) (psValue, error) {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return psValue{}, errUndefined
+		}
+		// Integer results that overflow become reals, as in PostScript.
+		if ints && v >= math.MinInt32 && v <= math.MaxInt32 {
+			return psValue{v: v, kind: psInt}, nil
+		}
+		return psValue{v: v, kind: psReal}, nil
+	}
+	switch op {
+	case opAdd:
+		return arith(a.v + b.v)
+	case opSub:
+		return arith(a.v - b.v)
+	case opMul:
+		return arith(a.v * b.v)
+	case opDiv:
+		if b.v == 0 {
+			return psValue{}, errUndefined
+		}
+		return psValue{v: a.v / b.v, kind: psReal}, nil
+	case opIdiv, opMod, opBitshift:
+		if !ints {
+			return psValue{}, errTypeCheck
+		}
+		x, y := int32(a.v), int32(b.v)
+		switch op {
+		case opIdiv:
+			if y == 0 {
+				return psValue{}, errUndefined
+			}
+			return psValue{v: float64(x / y), kind: psInt}, nil
+		case opMod:
+			if y == 0 {
+				return psValue{}, errUndefined
+			}
+			return psValue{v: float64(x % y), kind: psInt}, nil
+		default:
+			if y >= 0 {
+				return psValue{v: float64(x << uint(y&31)), kind: psInt}, nil
+			}
+			return psValue{v: float64(uint32(x) >> uint(-y&31)), kind: psInt}, nil
+		}
+	case opExp:
+		r := math.Pow(a.v, b.v)
+		if math.IsNaN(r) || math.IsInf(r, 0) {
+			return psValue{}, errUndefined
+		}
+		return psValue{v: r, kind: psReal}, nil
+	case opAtan:
+		if a.v == 0 && b.v == 0 {
+			return psValue{}, errUndefined
+		}
+		deg := math.Atan2(a.v, b.v) * 180 / math.Pi
+		if deg < 0 {
+			deg += 360
+		}
+		return psValue{v: deg, kind: psReal}, nil
+	case opGe:
+		return psBoolValue(a.v >= b.v), nil
+	case opGt:
+		return psBoolValue(a.v > b.v), nil
+	case opLe:
+		return psBoolValue(a.v <= b.v), nil
+	case opLt:
+		return psBoolValue(a.v < b.v), nil
+	}
+	return psValue{}, fmt.Errorf("PostScript operator %d is not binary", op)
+}
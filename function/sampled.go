@@ -0,0 +1,119 @@
+package function
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/wudi/pdfkit/internal/bitpack"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// maxSamples bounds the decoded size of a sample table.
+const maxSamples = 1 << 24
+
+// sampled is a Type 0 function. Samples are decoded to output values once;
+// evaluation interpolates multilinearly between the grid nodes around the
+// encoded input. Order 3 (cubic spline) tables are interpolated linearly
+// as well.
+type sampled struct {
+	size    []int
+	strides []int // sample-table stride per input, in values
+	encode  []float64
+	domain  []float64
+	outputs int
+	values  []float64
+}
+
+func newSampled(f *semantic.SampledFunction, domain, rng []float64) (*sampled, error) {
+	m := len(domain) / 2
+	n := len(rng) / 2
+	if n == 0 {
+		return nil, errors.New("sampled function requires Range")
+	}
+	if len(f.Size) != m {
+		return nil, fmt.Errorf("sampled function has %d Size entries for %d inputs", len(f.Size), m)
+	}
+	switch f.BitsPerSample {
+	case 1, 2, 4, 8, 12, 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("sampled function BitsPerSample %d not supported", f.BitsPerSample)
+	}
+	s := &sampled{size: f.Size, strides: make([]int, m), domain: domain, outputs: n}
+	points := 1
+	for i, sz := range f.Size {
+		if sz <= 0 {
+			return nil, fmt.Errorf("sampled function Size %d is not positive", sz)
+		}
+		s.strides[i] = points * n
+		points *= sz
+		if points*n > maxSamples {
+			return nil, errors.New("sampled function table too large")
+		}
+	}
+	s.encode = make([]float64, 2*m)
+	for i := 0; i < m; i++ {
+		s.encode[2*i], s.encode[2*i+1] = 0, float64(f.Size[i]-1)
+		if 2*i+1 < len(f.Encode) {
+			s.encode[2*i], s.encode[2*i+1] = f.Encode[2*i], f.Encode[2*i+1]
+		}
+	}
+	decode := rng
+	if len(f.Decode) >= 2*n {
+		decode = f.Decode
+	}
+	if need := (points*n*f.BitsPerSample + 7) / 8; len(f.Samples) < need {
+		return nil, fmt.Errorf("sampled function has %d bytes of samples, need %d", len(f.Samples), need)
+	}
+	maxVal := math.Exp2(float64(f.BitsPerSample)) - 1
+	s.values = make([]float64, points*n)
+	for i := range s.values {
+		v := float64(bitpack.ReadBits(f.Samples, i*f.BitsPerSample, f.BitsPerSample))
+		j := i % n
+		s.values[i] = decode[2*j] + v*(decode[2*j+1]-decode[2*j])/maxVal
+	}
+	return s, nil
+}
+
+func (s *sampled) eval(x []float64) ([]float64, error) {
+	m := len(s.size)
+	base := 0
+	var fracs [32]float64
+	if m > len(fracs) {
+		return nil, errors.New("sampled function has too many inputs")
+	}
+	for i := 0; i < m; i++ {
+		e := interpolate(x[i], s.domain[2*i], s.domain[2*i+1], s.encode[2*i], s.encode[2*i+1])
+		e = clip(e, 0, float64(s.size[i]-1))
+		lo := int(e)
+		if lo >= s.size[i]-1 {
+			lo = s.size[i] - 1
+			fracs[i] = 0
+		} else {
+			fracs[i] = e - float64(lo)
+		}
+		base += lo * s.strides[i]
+	}
+	out := make([]float64, s.outputs)
+	// Sum the 2^m corners of the enclosing cell, skipping those with no
+	// weight (which also covers inputs sitting on the last grid node).
+	for corner := 0; corner < 1<<m; corner++ {
+		w := 1.0
+		off := base
+		for i := 0; i < m && w != 0; i++ {
+			if corner&(1<<i) != 0 {
+				w *= fracs[i]
+				off += s.strides[i]
+			} else {
+				w *= 1 - fracs[i]
+			}
+		}
+		if w == 0 {
+			continue
+		}
+		for j := range out {
+			out[j] += w * s.values[off+j]
+		}
+	}
+	return out, nil
+}
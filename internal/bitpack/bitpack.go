@@ -0,0 +1,45 @@
+// Package bitpack reads and writes the packed samples of images and
+// sampled functions.
+package bitpack
+
+// ReadBits reads the unsigned big-endian bit field of n bits, at most 32,
+// starting at bit offset bit of data. Bits past the end of data read as 0.
+func ReadBits(data []byte, bit, n int) uint32 {
+	if bit&7 == 0 && n&7 == 0 {
+		var v uint32
+		for i := bit >> 3; i < (bit+n)>>3; i++ {
+			v <<= 8
+			if i < len(data) {
+				v |= uint32(data[i])
+			}
+		}
+		return v
+	}
+	var v uint32
+	for k := 0; k < n; k++ {
+		i := (bit + k) >> 3
+		var b uint32
+		if i < len(data) {
+			b = uint32(data[i]>>(7-uint((bit+k)&7))) & 1
+		}
+		v = v<<1 | b
+	}
+	return v
+}
+
+// GrayToBits packs the 8-bit gray samples of a w×h image into rows of
+// 1-bit samples, samples of 128 and above becoming 1. stride is the
+// distance in bytes between samples, 4 for the first channel of RGBA
+// pixels.
+func GrayToBits(gray []byte, w, h, stride int) []byte {
+	rowBytes := (w + 7) / 8
+	out := make([]byte, rowBytes*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if gray[(y*w+x)*stride] >= 128 {
+				out[y*rowBytes+x/8] |= 0x80 >> uint(x%8)
+			}
+		}
+	}
+	return out
+}
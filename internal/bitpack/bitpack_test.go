@@ -0,0 +1,45 @@
+package bitpack
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReadBits(t *testing.T) {
+	data := []byte{0xA5, 0x3C, 0xFF}
+	tests := []struct {
+		bit, n int
+		want   uint32
+	}{
+		{0, 1, 1},
+		{1, 1, 0},
+		{0, 4, 0xA},
+		{4, 4, 0x5},
+		{4, 8, 0x53},
+		{0, 16, 0xA53C},
+		{8, 16, 0x3CFF},
+		{3, 12, 0x29E},
+		{16, 16, 0xFF00}, // past the end
+		{40, 3, 0},
+	}
+	for _, tt := range tests {
+		if got := ReadBits(data, tt.bit, tt.n); got != tt.want {
+			t.Errorf("ReadBits(%d, %d) = %#x, want %#x", tt.bit, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestGrayToBits(t *testing.T) {
+	gray := []byte{
+		0, 255, 128, 127, 200, 0, 0, 0, 255,
+		255, 0, 0, 0, 0, 0, 0, 0, 0,
+	}
+	want := []byte{0x68, 0x80, 0x80, 0x00}
+	if got := GrayToBits(gray, 9, 2, 1); !bytes.Equal(got, want) {
+		t.Errorf("GrayToBits = %x, want %x", got, want)
+	}
+	rgba := []byte{255, 0, 0, 255, 0, 255, 255, 255}
+	if got := GrayToBits(rgba, 2, 1, 4); !bytes.Equal(got, []byte{0x80}) {
+		t.Errorf("GrayToBits with stride 4 = %x", got)
+	}
+}
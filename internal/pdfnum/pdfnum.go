@@ -0,0 +1,38 @@
+// Package pdfnum holds the number helpers shared by the packages writing
+// content streams, appearance streams and form data.
+package pdfnum
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Format writes v in plain decimal notation, as content streams require,
+// rounded to prec fraction digits without trailing zeros. A negative prec
+// uses the fewest digits that represent v exactly. NaN and infinities
+// become 0.
+func Format(v float64, prec int) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "0"
+	}
+	s := strconv.FormatFloat(v, 'f', prec, 64)
+	if strings.IndexByte(s, '.') >= 0 {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	if s == "-0" || s == "" {
+		return "0"
+	}
+	return s
+}
+
+// Clamp01 limits v to the range [0, 1] of colour components; NaN becomes 0.
+func Clamp01(v float64) float64 {
+	if v < 0 || math.IsNaN(v) {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
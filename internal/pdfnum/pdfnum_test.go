@@ -0,0 +1,38 @@
+package pdfnum
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		v    float64
+		prec int
+		want string
+	}{
+		{0, -1, "0"},
+		{math.Copysign(0, -1), -1, "0"},
+		{1e-7, -1, "0.0000001"},
+		{12345678901, -1, "12345678901"},
+		{-2.5, -1, "-2.5"},
+		{1.0 / 3, 3, "0.333"},
+		{2.0004, 3, "2"},
+		{-0.0001, 3, "0"},
+		{math.NaN(), -1, "0"},
+		{math.Inf(1), 3, "0"},
+	}
+	for _, tt := range tests {
+		if got := Format(tt.v, tt.prec); got != tt.want {
+			t.Errorf("Format(%v, %d) = %q, want %q", tt.v, tt.prec, got, tt.want)
+		}
+	}
+}
+
+func TestClamp01(t *testing.T) {
+	for v, want := range map[float64]float64{-1: 0, 0.25: 0.25, 3: 1, math.NaN(): 0} {
+		if got := Clamp01(v); got != want {
+			t.Errorf("Clamp01(%v) = %v, want %v", v, got, want)
+		}
+	}
+}
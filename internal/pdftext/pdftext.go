@@ -0,0 +1,68 @@
+// Package pdftext decodes PDF text strings (ISO 32000-2 7.9.2.2), shared
+// by the packages reading document, form and signature dictionaries.
+package pdftext
+
+import (
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Decode decodes a PDF text string: UTF-16BE when it starts with the byte
+// order mark FE FF, UTF-8 when it starts with EF BB BF, and PDFDocEncoding
+// otherwise. Unpaired surrogates and codes PDFDocEncoding leaves undefined
+// become U+FFFD.
+func Decode(b []byte) string {
+	switch {
+	case len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF:
+		units := make([]uint16, 0, (len(b)-2)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(units))
+	case len(b) >= 3 && b[0] == 0xEF && b[1] == 0xBB && b[2] == 0xBF:
+		return string(b[3:])
+	}
+	ascii := true
+	for _, c := range b {
+		if c >= utf8.RuneSelf || pdfDoc[c] != rune(c) {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return string(b)
+	}
+	out := make([]byte, 0, len(b)+len(b)/2)
+	for _, c := range b {
+		out = utf8.AppendRune(out, pdfDoc[c])
+	}
+	return string(out)
+}
+
+// HasBOM reports whether b starts with the UTF-16BE or UTF-8 byte order
+// mark of a Unicode text string.
+func HasBOM(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF ||
+		len(b) >= 3 && b[0] == 0xEF && b[1] == 0xBB && b[2] == 0xBF
+}
+
+// pdfDoc maps PDFDocEncoding codes to Unicode (ISO 32000-2 Annex D.3).
+var pdfDoc = func() [256]rune {
+	var t [256]rune
+	for i := range t {
+		t[i] = rune(i)
+	}
+	copy(t[0x18:], []rune{
+		0x02D8, 0x02C7, 0x02C6, 0x02D9, 0x02DD, 0x02DB, 0x02DA, 0x02DC,
+	})
+	copy(t[0x80:], []rune{
+		0x2022, 0x2020, 0x2021, 0x2026, 0x2014, 0x2013, 0x0192, 0x2044,
+		0x2039, 0x203A, 0x2212, 0x2030, 0x201E, 0x201C, 0x201D, 0x2018,
+		0x2019, 0x201A, 0x2122, 0xFB01, 0xFB02, 0x0141, 0x0152, 0x0160,
+		0x0178, 0x017D, 0x0131, 0x0142, 0x0153, 0x0161, 0x017E, utf8.RuneError,
+		0x20AC,
+	})
+	t[0x7F] = utf8.RuneError
+	t[0xAD] = utf8.RuneError
+	return t
+}()
@@ -0,0 +1,23 @@
+package pdftext
+
+import "testing"
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		want string
+	}{
+		{[]byte("plain"), "plain"},
+		{[]byte{0xFE, 0xFF, 0x00, 0x41, 0xD8, 0x3D, 0xDE, 0x00}, "A\U0001F600"},
+		{[]byte{0xFE, 0xFF, 0x00, 0x41, 0xD8, 0x3D}, "A�"},
+		{[]byte{0xEF, 0xBB, 0xBF, 0xC3, 0xA9}, "é"},
+		{[]byte{'S', 'i', 'g', 'n', 'e', 'd', ' ', 0x84, ' ', 0xE9, 0x92}, "Signed — é™"},
+		{[]byte{0xA0, 0x18, 0x9F, 0xAD}, "€˘��"},
+		{[]byte{0xC3, 0xA9}, "Ã©"},
+	}
+	for _, tt := range tests {
+		if got := Decode(tt.in); got != tt.want {
+			t.Errorf("Decode(% x) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package decoded
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/wudi/pdfkit/ir/raw"
 )
@@ -21,12 +22,28 @@ type Stream interface {
 }
 
 // DecodedDocument contains decoded objects plus a back-reference to the raw doc.
+//
+// For lazily parsed raw documents Streams starts empty and streams are
+// decoded on demand by Stream.
 type DecodedDocument struct {
 	Raw               *raw.Document
 	Streams           map[raw.ObjectRef]Stream
 	Perms             raw.Permissions
 	Encrypted         bool
 	MetadataEncrypted bool
+	decode            func(ctx context.Context, ref raw.ObjectRef) (Stream, error)
+}
+
+// Stream returns the decoded stream for ref, decoding it on first use when
+// the document was not decoded eagerly.
+func (d *DecodedDocument) Stream(ctx context.Context, ref raw.ObjectRef) (Stream, error) {
+	if s, ok := d.Streams[ref]; ok {
+		return s, nil
+	}
+	if d.decode == nil {
+		return nil, fmt.Errorf("stream %v not found", ref)
+	}
+	return d.decode(ctx, ref)
 }
 
 // Decoder transforms Raw IR into Decoded IR (applies filters/security).
@@ -23,6 +23,19 @@ func (d *decoderImpl) Decode(ctx context.Context, rawDoc *raw.Document) (*Decode
 	streams := make(map[raw.ObjectRef]Stream)
 	resolver := d.makeResolver(rawDoc)
 
+	if rawDoc.Lazy() {
+		return &DecodedDocument{
+			Raw:               rawDoc,
+			Streams:           streams,
+			Perms:             rawDoc.Permissions,
+			Encrypted:         rawDoc.Encrypted,
+			MetadataEncrypted: rawDoc.MetadataEncrypted,
+			decode: func(ctx context.Context, ref raw.ObjectRef) (Stream, error) {
+				return d.decodeStream(ctx, rawDoc, ref, resolver)
+			},
+		}, nil
+	}
+
 	// Collect all stream tasks
 	type task struct {
 		ref raw.ObjectRef
@@ -142,11 +155,33 @@ func (s decodedStream) Dictionary() raw.Dictionary { return s.raw.Dictionary() }
 func (s decodedStream) Data() []byte               { return s.data }
 func (s decodedStream) Filters() []string          { return s.filters }
 
+// decodeStream loads and decodes a single stream of a lazy document.
+func (d *decoderImpl) decodeStream(ctx context.Context, doc *raw.Document, ref raw.ObjectRef, resolver filters.StreamResolver) (Stream, error) {
+	obj, err := doc.Resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := obj.(raw.Stream)
+	if !ok {
+		return nil, fmt.Errorf("object %v is not a stream", ref)
+	}
+	data := s.RawData()
+	names, params := filters.ExtractFilters(s.Dictionary())
+	if d.pipeline != nil && len(names) > 0 {
+		decodedData, err := d.pipeline.DecodeWithResolver(ctx, data, names, params, resolver)
+		if err != nil {
+			return nil, fmt.Errorf("decode filters %v for %v: %w", names, ref, err)
+		}
+		data = decodedData
+	}
+	return decodedStream{raw: s, data: data, filters: names}, nil
+}
+
 func (d *decoderImpl) makeResolver(doc *raw.Document) filters.StreamResolver {
 	return func(ctx context.Context, ref raw.ObjectRef) ([]byte, error) {
-		obj, ok := doc.Objects[ref]
-		if !ok {
-			return nil, fmt.Errorf("object %v not found", ref)
+		obj, err := doc.Resolve(ctx, ref)
+		if err != nil {
+			return nil, err
 		}
 		stream, ok := obj.(raw.Stream)
 		if !ok {
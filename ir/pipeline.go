@@ -2,6 +2,8 @@ package ir
 
 import (
 	"context"
+	"crypto"
+	"crypto/x509"
 	"fmt"
 	"io"
 
@@ -21,6 +23,10 @@ type Pipeline struct {
 	semanticBuilder  semantic.Builder
 	recovery         recovery.Strategy
 	password         string
+	cert             *x509.Certificate
+	privKey          crypto.Decrypter
+	lazy             bool
+	cacheSize        int
 }
 
 // NewDefault constructs a pipeline with basic components (raw parser, filter decoder, no-op security, minimal semantic builder).
@@ -53,10 +59,32 @@ func (p *Pipeline) WithPassword(pwd string) *Pipeline {
 	return p
 }
 
+// WithCertificate sets the recipient certificate and private key used to open
+// PDFs encrypted with the public-key security handler.
+func (p *Pipeline) WithCertificate(cert *x509.Certificate, key crypto.Decrypter) *Pipeline {
+	p.cert = cert
+	p.privKey = key
+	return p
+}
+
+// WithLazyLoading makes Parse resolve objects on first access instead of
+// loading the whole file up front. Up to cacheSize loaded objects are kept
+// in an LRU cache (<= 0 selects parser.DefaultCacheSize), and page resources
+// and contents are parsed only when a page is loaded: Page.Resources and
+// Page.Contents are nil until semantic.Page.Load or Document.LoadPages is
+// called, and code reading them must call one of these first.
+func (p *Pipeline) WithLazyLoading(cacheSize int) *Pipeline {
+	p.lazy = true
+	p.cacheSize = cacheSize
+	return p
+}
+
 // Parse orchestrates Raw -> Decoded -> Semantic pipeline.
 func (p *Pipeline) Parse(ctx context.Context, r io.ReaderAt) (doc *semantic.Document, err error) {
 	if dp, ok := p.rawParser.(*parser.DocumentParser); ok {
 		dp.SetPassword(p.password)
+		dp.SetCredentials(p.cert, p.privKey)
+		dp.SetLazy(p.lazy, p.cacheSize)
 	}
 
 	rawDoc, err := p.rawParser.Parse(ctx, r)
@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 	"testing"
+
+	"github.com/wudi/pdfkit/ir/raw"
 )
 
 func TestPipelineDecodeASCIIHexStream(t *testing.T) {
@@ -39,3 +41,67 @@ func TestPipelineDecodeASCIIHexStream(t *testing.T) {
 		}
 	}
 }
+
+func TestPipelineLazyLoading(t *testing.T) {
+	buf := &bytes.Buffer{}
+	buf.WriteString("%PDF-1.7\n")
+	content := "0 0 1 rg 0 0 10 10 re f"
+	objs := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 /MediaBox [0 0 200 100] >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /ProcSet [/PDF] >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+	}
+	offsets := make([]int, len(objs))
+	for i, o := range objs {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xrefOff := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(buf, "trailer << /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xrefOff)
+
+	ctx := context.Background()
+	doc, err := NewDefault().WithLazyLoading(16).Parse(ctx, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("pipeline parse failed: %v", err)
+	}
+	dec := doc.Decoded()
+	if !dec.Raw.Lazy() || len(dec.Raw.Objects) != 0 {
+		t.Fatalf("expected lazy raw document, got %d objects", len(dec.Raw.Objects))
+	}
+	if len(dec.Streams) != 0 {
+		t.Fatalf("expected no eagerly decoded streams, got %d", len(dec.Streams))
+	}
+	if len(doc.Pages) != 1 {
+		t.Fatalf("expected 1 page, got %d", len(doc.Pages))
+	}
+	page := doc.Pages[0]
+	if page.MediaBox.URX != 200 {
+		t.Fatalf("expected inherited MediaBox, got %+v", page.MediaBox)
+	}
+	if page.Contents != nil || page.Resources != nil {
+		t.Fatalf("expected page content deferred until Load")
+	}
+
+	if err := page.Load(ctx); err != nil {
+		t.Fatalf("load page: %v", err)
+	}
+	if len(page.Contents) != 1 || string(page.Contents[0].RawBytes) != content {
+		t.Fatalf("unexpected page contents: %+v", page.Contents)
+	}
+	if page.Resources == nil {
+		t.Fatalf("expected page resources after Load")
+	}
+
+	s, err := dec.Stream(ctx, raw.ObjectRef{Num: 4})
+	if err != nil {
+		t.Fatalf("decode stream on demand: %v", err)
+	}
+	if string(s.Data()) != content {
+		t.Fatalf("unexpected stream data: %q", s.Data())
+	}
+}
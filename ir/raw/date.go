@@ -0,0 +1,47 @@
+package raw
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDate parses a PDF date string, D:YYYYMMDDHHmmSSOHH'mm', in which
+// every field after the year is optional. Dates without a time zone are
+// UTC.
+func ParseDate(s string) (time.Time, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+	if len(s) < 4 {
+		return time.Time{}, false
+	}
+	fields := []int{0, 1, 1, 0, 0, 0}
+	widths := []int{4, 2, 2, 2, 2, 2}
+	for i, w := range widths {
+		if len(s) < w || s[0] < '0' || s[0] > '9' {
+			break
+		}
+		n, err := strconv.Atoi(s[:w])
+		if err != nil {
+			return time.Time{}, false
+		}
+		fields[i] = n
+		s = s[w:]
+	}
+	loc := time.UTC
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		sign := 1
+		if s[0] == '-' {
+			sign = -1
+		}
+		digits := strings.ReplaceAll(s[1:], "'", "")
+		var hh, mm int
+		if len(digits) >= 2 {
+			hh, _ = strconv.Atoi(digits[:2])
+		}
+		if len(digits) >= 4 {
+			mm, _ = strconv.Atoi(digits[2:4])
+		}
+		loc = time.FixedZone("", sign*(hh*3600+mm*60))
+	}
+	return time.Date(fields[0], time.Month(fields[1]), fields[2], fields[3], fields[4], fields[5], 0, loc), true
+}
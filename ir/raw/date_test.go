@@ -0,0 +1,20 @@
+package raw
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	got, ok := ParseDate("D:20240102030405+05'30'")
+	if !ok {
+		t.Fatal("parse failed")
+	}
+	want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("", 5*3600+30*60))
+	if !got.Equal(want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	if got, ok := ParseDate("D:2023"); !ok || got.Year() != 2023 || got.Month() != time.January {
+		t.Fatalf("year only = %v", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
 )
 
 // ObjectRef uniquely identifies an indirect PDF object.
@@ -96,9 +97,21 @@ type Permissions struct {
 	Print, Modify, Copy, ModifyAnnotations, FillForms, ExtractAccessible, Assemble, PrintHighQuality bool
 }
 
+// ObjectSource resolves indirect objects on demand. Lazily parsed documents
+// keep Objects empty and fetch through a source instead.
+type ObjectSource interface {
+	Load(ctx context.Context, ref ObjectRef) (Object, error)
+	Refs() []ObjectRef
+}
+
 // Document is the root container for raw PDF objects.
+//
+// Objects holds materialized objects. When Source is set the document is
+// lazy: objects missing from Objects are loaded from Source on access via
+// Get/Resolve, and LoadAll materializes the remainder.
 type Document struct {
 	Objects           map[ObjectRef]Object
+	Source            ObjectSource
 	Trailer           Dictionary
 	Version           string // e.g., "1.7"
 	Metadata          DocumentMetadata
@@ -110,6 +123,80 @@ type Document struct {
 	Collection        Dictionary
 }
 
+// Lazy reports whether objects are resolved on demand through Source.
+func (d *Document) Lazy() bool { return d.Source != nil }
+
+// Resolve returns the object for ref, loading it from Source when it has not
+// been materialized.
+func (d *Document) Resolve(ctx context.Context, ref ObjectRef) (Object, error) {
+	if obj, ok := d.Objects[ref]; ok {
+		return obj, nil
+	}
+	if d.Source == nil {
+		return nil, fmt.Errorf("object %v not found", ref)
+	}
+	return d.Source.Load(ctx, ref)
+}
+
+// Get is Resolve without a context, reporting only whether ref resolved.
+func (d *Document) Get(ref ObjectRef) (Object, bool) {
+	obj, err := d.Resolve(context.Background(), ref)
+	if err != nil {
+		return nil, false
+	}
+	return obj, true
+}
+
+// Refs lists the references of all objects in the document, materialized
+// or not, in ascending object number order.
+func (d *Document) Refs() []ObjectRef {
+	refs := make([]ObjectRef, 0, len(d.Objects))
+	for ref := range d.Objects {
+		refs = append(refs, ref)
+	}
+	if d.Source != nil {
+		for _, ref := range d.Source.Refs() {
+			if _, ok := d.Objects[ref]; !ok {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Num != refs[j].Num {
+			return refs[i].Num < refs[j].Num
+		}
+		return refs[i].Gen < refs[j].Gen
+	})
+	return refs
+}
+
+// LoadAll materializes every object from Source into Objects and detaches
+// the source, turning a lazy document into an eager one. It is a no-op for
+// eager documents.
+func (d *Document) LoadAll(ctx context.Context) error {
+	if d.Source == nil {
+		return nil
+	}
+	if d.Objects == nil {
+		d.Objects = make(map[ObjectRef]Object)
+	}
+	for _, ref := range d.Source.Refs() {
+		if _, ok := d.Objects[ref]; ok {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		obj, err := d.Source.Load(ctx, ref)
+		if err != nil {
+			return fmt.Errorf("load object %d: %w", ref.Num, err)
+		}
+		d.Objects[ref] = obj
+	}
+	d.Source = nil
+	return nil
+}
+
 // Parser converts bytes into a raw.Document.
 type Parser interface {
 	Parse(ctx context.Context, r io.ReaderAt) (*Document, error)
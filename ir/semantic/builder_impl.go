@@ -24,7 +24,13 @@ func (b *builderImpl) Build(ctx context.Context, dec *decoded.DecodedDocument) (
 	}
 
 	if dec.Raw != nil && dec.Raw.Trailer != nil {
-		resolver := &simpleResolver{doc: dec.Raw, dec: dec}
+		resolver := &simpleResolver{ctx: ctx, doc: dec.Raw, dec: dec, ocgs: make(map[raw.ObjectRef]*OptionalContentGroup)}
+
+		if infoObj, ok := dec.Raw.Trailer.Get(raw.NameLiteral("Info")); ok {
+			if info, ok := parseDocumentInfo(infoObj, resolver); ok {
+				doc.Info = info
+			}
+		}
 
 		// Get Root (Catalog)
 		rootObj, ok := dec.Raw.Trailer.Get(raw.NameLiteral("Root"))
@@ -38,6 +44,19 @@ func (b *builderImpl) Build(ctx context.Context, dec *decoded.DecodedDocument) (
 			}
 
 			if catalog, ok := rootObj.(*raw.DictObj); ok {
+				if mdObj, ok := catalog.Get(raw.NameLiteral("Metadata")); ok {
+					if md, ok := parseMetadata(mdObj, resolver); ok {
+						doc.Metadata = md
+					}
+				}
+
+				// Parse OCProperties first: pages share its groups.
+				if ocObj, ok := catalog.Get(raw.NameLiteral("OCProperties")); ok {
+					if props, ok := parseOCProperties(ocObj, resolver); ok {
+						doc.OCProperties = props
+					}
+				}
+
 				// Parse Pages
 				if pagesObj, ok := catalog.Get(raw.NameLiteral("Pages")); ok {
 					pages, err := parsePages(pagesObj, resolver, inheritedPageProps{})
@@ -74,20 +93,34 @@ func (b *builderImpl) Build(ctx context.Context, dec *decoded.DecodedDocument) (
 }
 
 type simpleResolver struct {
-	doc *raw.Document
-	dec *decoded.DecodedDocument
+	ctx  context.Context
+	doc  *raw.Document
+	dec  *decoded.DecodedDocument
+	ocgs map[raw.ObjectRef]*OptionalContentGroup // groups of the catalog's OCProperties
 }
 
 func (r *simpleResolver) Resolve(ref raw.ObjectRef) (raw.Object, error) {
-	if obj, ok := r.doc.Objects[ref]; ok {
-		return obj, nil
-	}
-	return nil, fmt.Errorf("object %v not found", ref)
+	return r.doc.Resolve(r.ctx, ref)
 }
 
 func (r *simpleResolver) ResolveStream(ref raw.ObjectRef) ([]byte, error) {
-	if s, ok := r.dec.Streams[ref]; ok {
-		return s.Data(), nil
+	s, err := r.dec.Stream(r.ctx, ref)
+	if err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("stream %v not found", ref)
+	return s.Data(), nil
+}
+
+func (r *simpleResolver) optionalContentGroups() map[raw.ObjectRef]*OptionalContentGroup {
+	return r.ocgs
+}
+
+// Lazy reports whether the underlying raw document loads objects on demand.
+func (r *simpleResolver) Lazy() bool { return r.doc.Lazy() }
+
+// withContext returns a copy of r resolving under ctx.
+func (r *simpleResolver) withContext(ctx context.Context) rawResolver {
+	cp := *r
+	cp.ctx = ctx
+	return &cp
 }
@@ -13,6 +13,29 @@ type AcroForm struct {
 	Dirty            bool
 }
 
+// Field flags (Ff entry), ISO 32000-1 Tables 221, 226, 228 and 230.
+const (
+	FieldFlagReadOnly          = 1 << 0
+	FieldFlagRequired          = 1 << 1
+	FieldFlagNoExport          = 1 << 2
+	FieldFlagMultiline         = 1 << 12
+	FieldFlagPassword          = 1 << 13
+	FieldFlagNoToggleToOff     = 1 << 14
+	FieldFlagRadio             = 1 << 15
+	FieldFlagPushbutton        = 1 << 16
+	FieldFlagCombo             = 1 << 17
+	FieldFlagEdit              = 1 << 18
+	FieldFlagSort              = 1 << 19
+	FieldFlagFileSelect        = 1 << 20
+	FieldFlagMultiSelect       = 1 << 21
+	FieldFlagDoNotSpellCheck   = 1 << 22
+	FieldFlagDoNotScroll       = 1 << 23
+	FieldFlagComb              = 1 << 24
+	FieldFlagRichText          = 1 << 25
+	FieldFlagRadiosInUnison    = 1 << 25
+	FieldFlagCommitOnSelChange = 1 << 26
+)
+
 // FormField is the interface for all form fields.
 type FormField interface {
 	FieldType() string
@@ -20,6 +43,7 @@ type FormField interface {
 	FieldFlags() int
 	FieldRect() Rectangle
 	FieldPageIndex() int
+	SetFieldName(string)
 	SetFieldRect(Rectangle)
 	SetFieldPageIndex(int)
 	SetFieldFlags(int)
@@ -29,6 +53,12 @@ type FormField interface {
 	GetAppearanceState() string
 	GetBorder() []float64
 	GetColor() []float64
+	GetAnnotationFlags() int
+	GetRotation() int
+	GetBorderStyle() *BorderStyle
+	GetBorderColor() []float64
+	GetBackgroundColor() []float64
+	GetAppearanceForm() *XObject
 
 	// Reference management
 	Reference() raw.ObjectRef
@@ -52,10 +82,16 @@ type BaseFormField struct {
 	Name              string
 	PageIndex         int
 	Rect              Rectangle
-	Flags             int
+	Flags             int // Ff entry
+	AnnotationFlags   int // F entry of the widget annotation (AnnotFlagHidden, AnnotFlagPrint, ...); when zero the writer uses Flags, as it always has
+	Rotation          int // R entry of the MK dictionary: appearance rotation in degrees
 	Appearance        []byte
+	AppearanceForm    *XObject // normal appearance with its BBox, Matrix and Resources; written in place of Appearance
 	AppearanceState   string
 	Border            []float64
+	BorderStyle       *BorderStyle // BS entry of the widget annotation
+	BorderColor       []float64    // BC entry of the MK dictionary
+	BackgroundColor   []float64    // BG entry of the MK dictionary
 	Color             []float64
 	DefaultAppearance string             // DA entry
 	Quadding          int                // Q entry: 0=Left, 1=Center, 2=Right
@@ -69,6 +105,7 @@ func (f *BaseFormField) FieldName() string                        { return f.Nam
 func (f *BaseFormField) FieldPageIndex() int                      { return f.PageIndex }
 func (f *BaseFormField) FieldRect() Rectangle                     { return f.Rect }
 func (f *BaseFormField) FieldFlags() int                          { return f.Flags }
+func (f *BaseFormField) SetFieldName(name string)                 { f.Name = name }
 func (f *BaseFormField) SetFieldRect(r Rectangle)                 { f.Rect = r }
 func (f *BaseFormField) SetFieldPageIndex(i int)                  { f.PageIndex = i }
 func (f *BaseFormField) SetFieldFlags(flags int)                  { f.Flags = flags }
@@ -76,7 +113,14 @@ func (f *BaseFormField) GetAppearance() []byte                    { return f.App
 func (f *BaseFormField) GetAppearanceState() string               { return f.AppearanceState }
 func (f *BaseFormField) GetBorder() []float64                     { return f.Border }
 func (f *BaseFormField) GetColor() []float64                      { return f.Color }
+func (f *BaseFormField) GetAnnotationFlags() int                  { return f.AnnotationFlags }
+func (f *BaseFormField) GetRotation() int                         { return f.Rotation }
+func (f *BaseFormField) GetBorderStyle() *BorderStyle             { return f.BorderStyle }
+func (f *BaseFormField) GetBorderColor() []float64                { return f.BorderColor }
+func (f *BaseFormField) GetBackgroundColor() []float64            { return f.BackgroundColor }
+func (f *BaseFormField) GetAppearanceForm() *XObject              { return f.AppearanceForm }
 func (f *BaseFormField) GetDefaultAppearance() string             { return f.DefaultAppearance }
+func (f *BaseFormField) SetDefaultAppearance(da string)           { f.DefaultAppearance = da }
 func (f *BaseFormField) GetQuadding() int                         { return f.Quadding }
 func (f *BaseFormField) Reference() raw.ObjectRef                 { return f.Ref }
 func (f *BaseFormField) SetReference(r raw.ObjectRef)             { f.Ref = r }
@@ -87,8 +131,9 @@ func (f *BaseFormField) GetAdditionalActions() *AdditionalActions { return f.Add
 // TextFormField represents a text field (Tx).
 type TextFormField struct {
 	BaseFormField
-	Value  string
-	MaxLen int
+	Value     string
+	RichValue string // RV entry: rich text (XHTML) form of Value
+	MaxLen    int
 }
 
 func (f *TextFormField) FieldType() string { return "Tx" }
@@ -0,0 +1,59 @@
+package semantic
+
+import (
+	"strings"
+	"time"
+
+	"github.com/wudi/pdfkit/xmp"
+)
+
+// SyncXMP makes the document information and the XMP packet carry the
+// same values, as PDF/A requires. A value set in info wins over the XMP
+// property it maps to and is written into packet; XMP values fill the
+// entries info lacks. It returns the merged information, leaving info
+// untouched, and reports whether packet was changed.
+func SyncXMP(info *DocumentInfo, packet *xmp.Packet) (*DocumentInfo, bool) {
+	out := &DocumentInfo{}
+	if info != nil {
+		cp := *info
+		out = &cp
+	}
+	changed := false
+	text := func(dst *string, get func() string, set func(string)) {
+		switch v := get(); {
+		case *dst != "" && v != *dst:
+			set(*dst)
+			changed = true
+		case *dst == "":
+			*dst = v
+		}
+	}
+	text(&out.Title, packet.Title, packet.SetTitle)
+	text(&out.Subject, packet.Description, packet.SetDescription)
+	text(&out.Creator, packet.CreatorTool, packet.SetCreatorTool)
+	text(&out.Producer, packet.Producer, packet.SetProducer)
+	text(&out.Trapped, packet.Trapped, packet.SetTrapped)
+	text(&out.Author, func() string {
+		return strings.Join(packet.Creators(), ", ")
+	}, func(s string) {
+		packet.SetCreators(s)
+	})
+	keywords := strings.Join(out.Keywords, ",")
+	text(&keywords, packet.Keywords, packet.SetKeywords)
+	if len(out.Keywords) == 0 && keywords != "" {
+		out.Keywords = strings.Split(keywords, ",")
+	}
+	date := func(dst *time.Time, get func() (time.Time, bool), set func(time.Time)) {
+		v, ok := get()
+		switch {
+		case !dst.IsZero() && (!ok || xmp.FormatDate(v) != xmp.FormatDate(*dst)):
+			set(*dst)
+			changed = true
+		case dst.IsZero() && ok:
+			*dst = v
+		}
+	}
+	date(&out.CreationDate, packet.CreateDate, packet.SetCreateDate)
+	date(&out.ModDate, packet.ModifyDate, packet.SetModifyDate)
+	return out, changed
+}
@@ -0,0 +1,61 @@
+package semantic
+
+import (
+	"strings"
+
+	"github.com/wudi/pdfkit/ir/raw"
+)
+
+// parseDocumentInfo parses the trailer's Info dictionary.
+func parseDocumentInfo(obj raw.Object, resolver rawResolver) (*DocumentInfo, bool) {
+	dict, ok := resolveDict(obj, resolver)
+	if !ok {
+		return nil, false
+	}
+	info := &DocumentInfo{
+		Title:    getString(dict, "Title"),
+		Author:   getString(dict, "Author"),
+		Subject:  getString(dict, "Subject"),
+		Creator:  getString(dict, "Creator"),
+		Producer: getString(dict, "Producer"),
+		Trapped:  getName(dict, "Trapped"),
+	}
+	if ref, ok := obj.(raw.Reference); ok {
+		info.OriginalRef = ref.Ref()
+	}
+	if info.Trapped == "" {
+		info.Trapped = getString(dict, "Trapped")
+	}
+	if kw := getString(dict, "Keywords"); kw != "" {
+		info.Keywords = strings.Split(kw, ",")
+	}
+	info.CreationDate, _ = raw.ParseDate(getString(dict, "CreationDate"))
+	info.ModDate, _ = raw.ParseDate(getString(dict, "ModDate"))
+	return info, true
+}
+
+// parseMetadata parses the catalog's XMP metadata stream. The packet is
+// parsed on demand by XMPMetadata.XMP.
+func parseMetadata(obj raw.Object, resolver rawResolver) (*XMPMetadata, bool) {
+	md := &XMPMetadata{}
+	if ref, ok := obj.(raw.Reference); ok {
+		md.OriginalRef = ref.Ref()
+		if sr, ok := resolver.(streamResolver); ok {
+			if data, err := sr.ResolveStream(ref.Ref()); err == nil {
+				md.Raw = data
+				return md, true
+			}
+		}
+		o, err := resolver.Resolve(ref.Ref())
+		if err != nil {
+			return nil, false
+		}
+		obj = o
+	}
+	stream, ok := obj.(*raw.StreamObj)
+	if !ok {
+		return nil, false
+	}
+	md.Raw = stream.Data
+	return md, true
+}
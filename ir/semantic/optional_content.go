@@ -0,0 +1,220 @@
+package semantic
+
+import "github.com/wudi/pdfkit/ir/raw"
+
+// OCProperties models the optional content properties dictionary of the
+// catalog: the document's optional content groups, shown by viewers as
+// layers, and the configurations deciding which of them are visible.
+//
+// Groups are shared by pointer with the property lists of resources,
+// XObjects and annotations that refer to them. Layers are listed through
+// OCGs, created with AddLayer, renamed by setting their Name and toggled
+// with SetVisible.
+type OCProperties struct {
+	OCGs        []*OptionalContentGroup
+	D           *OCConfig   // default configuration
+	Configs     []*OCConfig // alternate configurations
+	OriginalRef raw.ObjectRef
+	Dirty       bool
+}
+
+// OCConfig is an optional content configuration dictionary.
+type OCConfig struct {
+	Name      string
+	Creator   string
+	BaseState string // ON (default), OFF or Unchanged
+	ON        []*OptionalContentGroup
+	OFF       []*OptionalContentGroup
+	Intent    []string // View (default), Design or All
+	AS        []OCAutoState
+	Order     []OCOrderItem
+	ListMode  string // AllPages (default) or VisiblePages
+	RBGroups  [][]*OptionalContentGroup
+	Locked    []*OptionalContentGroup
+}
+
+// OCAutoState is an entry of the AS array of a configuration: on Event
+// (View, Print or Export) the state of OCGs follows the usage dictionary
+// entries named by Category (Zoom, Print, View, Export, Language, User).
+type OCAutoState struct {
+	Event    string
+	OCGs     []*OptionalContentGroup
+	Category []string
+}
+
+// OCOrderItem is an entry of the Order array of a configuration, which
+// viewers show as the layer tree. An item is a group with its nested
+// items, or, without a group, a collection of items with an optional
+// label.
+type OCOrderItem struct {
+	Group    *OptionalContentGroup
+	Label    string
+	Children []OCOrderItem
+}
+
+// VisibilityExpression is the VE entry of an optional content membership
+// dictionary: a group, or an And, Or or Not of expressions.
+type VisibilityExpression struct {
+	Op       string // And, Or or Not; empty for a group
+	Group    *OptionalContentGroup
+	Operands []*VisibilityExpression
+}
+
+// Layer returns the first group named name, or nil.
+func (p *OCProperties) Layer(name string) *OptionalContentGroup {
+	if p == nil {
+		return nil
+	}
+	for _, g := range p.OCGs {
+		if g != nil && g.Name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+// AddLayer creates a group named name, adds it to the document and to the
+// top level of the default configuration's layer tree and sets its
+// visibility.
+func (p *OCProperties) AddLayer(name string, visible bool) *OptionalContentGroup {
+	g := &OptionalContentGroup{Name: name, BasePropertyList: BasePropertyList{Dirty: true}}
+	p.OCGs = append(p.OCGs, g)
+	if p.D == nil {
+		p.D = &OCConfig{}
+	}
+	p.D.Order = append(p.D.Order, OCOrderItem{Group: g})
+	p.SetVisible(g, visible)
+	return g
+}
+
+// SetVisible turns g on or off in the default configuration. Turning a
+// group on turns off the other groups of its radio button groups.
+func (p *OCProperties) SetVisible(g *OptionalContentGroup, visible bool) {
+	if p.D == nil {
+		p.D = &OCConfig{}
+	}
+	d := p.D
+	d.ON, d.OFF = withoutGroup(d.ON, g), withoutGroup(d.OFF, g)
+	if visible {
+		d.ON = append(d.ON, g)
+		for _, rb := range d.RBGroups {
+			if !containsGroup(rb, g) {
+				continue
+			}
+			for _, other := range rb {
+				if other != g && d.GroupVisible(other) {
+					d.ON = withoutGroup(d.ON, other)
+					d.OFF = append(d.OFF, other)
+				}
+			}
+		}
+	} else {
+		d.OFF = append(d.OFF, g)
+	}
+	p.Dirty = true
+}
+
+// Visible reports whether content marked with pl is visible in the
+// default configuration. Content without optional content is visible.
+func (p *OCProperties) Visible(pl PropertyList) bool {
+	if p == nil {
+		return (*OCConfig)(nil).Visible(pl)
+	}
+	return p.D.Visible(pl)
+}
+
+// GroupVisible reports whether g is on in the configuration.
+func (c *OCConfig) GroupVisible(g *OptionalContentGroup) bool {
+	if c == nil {
+		return true
+	}
+	if c.BaseState == "OFF" {
+		return containsGroup(c.ON, g)
+	}
+	return !containsGroup(c.OFF, g)
+}
+
+// Visible reports whether content marked with pl, a group or a membership
+// dictionary, is visible in the configuration.
+func (c *OCConfig) Visible(pl PropertyList) bool {
+	switch p := pl.(type) {
+	case *OptionalContentGroup:
+		return p == nil || c.GroupVisible(p)
+	case *OptionalContentMembership:
+		if p == nil {
+			return true
+		}
+		if p.VE != nil {
+			return c.evaluate(p.VE)
+		}
+		var groups []*OptionalContentGroup
+		for _, g := range p.OCGs {
+			if g != nil {
+				groups = append(groups, g)
+			}
+		}
+		if len(groups) == 0 {
+			return true
+		}
+		on := 0
+		for _, g := range groups {
+			if c.GroupVisible(g) {
+				on++
+			}
+		}
+		switch p.Policy {
+		case "AllOn":
+			return on == len(groups)
+		case "AnyOff":
+			return on < len(groups)
+		case "AllOff":
+			return on == 0
+		default: // AnyOn
+			return on > 0
+		}
+	}
+	return true
+}
+
+func (c *OCConfig) evaluate(ve *VisibilityExpression) bool {
+	switch ve.Op {
+	case "":
+		return ve.Group == nil || c.GroupVisible(ve.Group)
+	case "Not":
+		return len(ve.Operands) == 0 || ve.Operands[0] == nil || !c.evaluate(ve.Operands[0])
+	case "And":
+		for _, op := range ve.Operands {
+			if op != nil && !c.evaluate(op) {
+				return false
+			}
+		}
+		return true
+	case "Or":
+		for _, op := range ve.Operands {
+			if op != nil && c.evaluate(op) {
+				return true
+			}
+		}
+		return len(ve.Operands) == 0
+	}
+	return true
+}
+
+func containsGroup(groups []*OptionalContentGroup, g *OptionalContentGroup) bool {
+	for _, x := range groups {
+		if x == g {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutGroup(groups []*OptionalContentGroup, g *OptionalContentGroup) []*OptionalContentGroup {
+	out := groups[:0:0]
+	for _, x := range groups {
+		if x != g {
+			out = append(out, x)
+		}
+	}
+	return out
+}
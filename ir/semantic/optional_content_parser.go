@@ -0,0 +1,293 @@
+package semantic
+
+import "github.com/wudi/pdfkit/ir/raw"
+
+// ocgResolver is implemented by resolvers that share the optional content
+// groups of the catalog with the property lists parsed after it, so that
+// a group is one object wherever it is referenced.
+type ocgResolver interface {
+	optionalContentGroups() map[raw.ObjectRef]*OptionalContentGroup
+}
+
+// parseOCProperties parses the catalog's OCProperties dictionary. The
+// groups it lists are recorded with the resolver before pages are parsed.
+func parseOCProperties(obj raw.Object, resolver rawResolver) (*OCProperties, bool) {
+	dict, ok := resolveDict(obj, resolver)
+	if !ok {
+		return nil, false
+	}
+	props := &OCProperties{}
+	if ref, ok := obj.(raw.Reference); ok {
+		props.OriginalRef = ref.Ref()
+	}
+	var cache map[raw.ObjectRef]*OptionalContentGroup
+	if c, ok := resolver.(ocgResolver); ok {
+		cache = c.optionalContentGroups()
+	}
+	if v, ok := dict.Get(raw.NameLiteral("OCGs")); ok {
+		if arr, ok := resolveArray(v, resolver); ok {
+			for _, item := range arr.Items {
+				g := parseOCGroup(item, resolver)
+				if g == nil {
+					continue
+				}
+				if ref, ok := item.(raw.Reference); ok && cache != nil {
+					cache[ref.Ref()] = g
+				}
+				props.OCGs = append(props.OCGs, g)
+			}
+		}
+	}
+	if v, ok := dict.Get(raw.NameLiteral("D")); ok {
+		props.D = parseOCConfig(v, resolver)
+	}
+	if v, ok := dict.Get(raw.NameLiteral("Configs")); ok {
+		if arr, ok := resolveArray(v, resolver); ok {
+			for _, item := range arr.Items {
+				if c := parseOCConfig(item, resolver); c != nil {
+					props.Configs = append(props.Configs, c)
+				}
+			}
+		}
+	}
+	return props, true
+}
+
+// parseOCGroup returns the group obj refers to: the one recorded from the
+// catalog if any, otherwise a newly parsed one.
+func parseOCGroup(obj raw.Object, resolver rawResolver) *OptionalContentGroup {
+	if ref, ok := obj.(raw.Reference); ok {
+		if c, ok := resolver.(ocgResolver); ok {
+			if g := c.optionalContentGroups()[ref.Ref()]; g != nil {
+				return g
+			}
+		}
+	}
+	dict, ok := resolveDict(obj, resolver)
+	if !ok || getName(dict, "Type") != "OCG" {
+		return nil
+	}
+	g := &OptionalContentGroup{Name: getString(dict, "Name")}
+	if ref, ok := obj.(raw.Reference); ok {
+		g.OriginalRef = ref.Ref()
+	}
+	if i, ok := dict.Get(raw.NameLiteral("Intent")); ok {
+		g.Intent = parseNames(i, resolver)
+	}
+	if u, ok := dict.Get(raw.NameLiteral("Usage")); ok {
+		if ud, ok := resolveDict(u, resolver); ok {
+			g.Usage = parseOCUsage(ud, resolver)
+		}
+	}
+	return g
+}
+
+// parseOCGroups parses a group or an array of groups, skipping entries
+// that are not groups.
+func parseOCGroups(obj raw.Object, resolver rawResolver) []*OptionalContentGroup {
+	arr, ok := resolveArray(obj, resolver)
+	if !ok {
+		if g := parseOCGroup(obj, resolver); g != nil {
+			return []*OptionalContentGroup{g}
+		}
+		return nil
+	}
+	var groups []*OptionalContentGroup
+	for _, item := range arr.Items {
+		if g := parseOCGroup(item, resolver); g != nil {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// parseNames parses a name or an array of names.
+func parseNames(obj raw.Object, resolver rawResolver) []string {
+	if name, ok := obj.(raw.NameObj); ok {
+		return []string{name.Value()}
+	}
+	arr, ok := resolveArray(obj, resolver)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, item := range arr.Items {
+		if name, ok := item.(raw.NameObj); ok {
+			names = append(names, name.Value())
+		}
+	}
+	return names
+}
+
+func parseOCUsage(dict *raw.DictObj, resolver rawResolver) *OCUsage {
+	u := &OCUsage{}
+	sub := func(key string) *raw.DictObj {
+		if v, ok := dict.Get(raw.NameLiteral(key)); ok {
+			if d, ok := resolveDict(v, resolver); ok {
+				return d
+			}
+		}
+		return nil
+	}
+	if d := sub("CreatorInfo"); d != nil {
+		u.CreatorInfo = &OCCreatorInfo{Creator: getString(d, "Creator"), Subtype: getName(d, "Subtype")}
+	}
+	if d := sub("Language"); d != nil {
+		u.Language = &OCLanguage{Lang: getString(d, "Lang"), Preferred: getName(d, "Preferred") == "ON"}
+	}
+	if d := sub("Export"); d != nil {
+		u.Export = &OCExport{ExportState: getName(d, "ExportState") == "ON"}
+	}
+	if d := sub("Zoom"); d != nil {
+		z := &OCZoom{}
+		if n, ok := d.Get(raw.NameLiteral("min")); ok {
+			if num, ok := n.(raw.NumberObj); ok {
+				z.Min = num.Float()
+			}
+		}
+		if n, ok := d.Get(raw.NameLiteral("max")); ok {
+			if num, ok := n.(raw.NumberObj); ok {
+				z.Max = num.Float()
+			}
+		}
+		u.Zoom = z
+	}
+	if d := sub("Print"); d != nil {
+		u.Print = &OCPrint{Subtype: getName(d, "Subtype"), PrintState: getName(d, "PrintState") == "ON"}
+	}
+	if d := sub("View"); d != nil {
+		u.View = &OCView{ViewState: getName(d, "ViewState") == "ON"}
+	}
+	if d := sub("User"); d != nil {
+		user := &OCUser{Type: getName(d, "Type")}
+		if n, ok := d.Get(raw.NameLiteral("Name")); ok {
+			if arr, ok := resolveArray(n, resolver); ok {
+				for _, item := range arr.Items {
+					user.User = append(user.User, textString(item))
+				}
+			} else {
+				user.Name = textString(n)
+			}
+		}
+		u.User = user
+	}
+	return u
+}
+
+func parseOCConfig(obj raw.Object, resolver rawResolver) *OCConfig {
+	dict, ok := resolveDict(obj, resolver)
+	if !ok {
+		return nil
+	}
+	c := &OCConfig{
+		Name:      getString(dict, "Name"),
+		Creator:   getString(dict, "Creator"),
+		BaseState: getName(dict, "BaseState"),
+		ListMode:  getName(dict, "ListMode"),
+	}
+	groups := func(key string) []*OptionalContentGroup {
+		if v, ok := dict.Get(raw.NameLiteral(key)); ok {
+			return parseOCGroups(v, resolver)
+		}
+		return nil
+	}
+	c.ON, c.OFF, c.Locked = groups("ON"), groups("OFF"), groups("Locked")
+	if v, ok := dict.Get(raw.NameLiteral("Intent")); ok {
+		c.Intent = parseNames(v, resolver)
+	}
+	if v, ok := dict.Get(raw.NameLiteral("AS")); ok {
+		if arr, ok := resolveArray(v, resolver); ok {
+			for _, item := range arr.Items {
+				d, ok := resolveDict(item, resolver)
+				if !ok {
+					continue
+				}
+				as := OCAutoState{Event: getName(d, "Event")}
+				if g, ok := d.Get(raw.NameLiteral("OCGs")); ok {
+					as.OCGs = parseOCGroups(g, resolver)
+				}
+				if cat, ok := d.Get(raw.NameLiteral("Category")); ok {
+					as.Category = parseNames(cat, resolver)
+				}
+				c.AS = append(c.AS, as)
+			}
+		}
+	}
+	if v, ok := dict.Get(raw.NameLiteral("Order")); ok {
+		if arr, ok := resolveArray(v, resolver); ok {
+			c.Order = parseOCOrder(arr, resolver, 0)
+		}
+	}
+	if v, ok := dict.Get(raw.NameLiteral("RBGroups")); ok {
+		if arr, ok := resolveArray(v, resolver); ok {
+			for _, item := range arr.Items {
+				if rb := parseOCGroups(item, resolver); len(rb) > 0 {
+					c.RBGroups = append(c.RBGroups, rb)
+				}
+			}
+		}
+	}
+	return c
+}
+
+// maxOCDepth bounds the nesting of Order and VE arrays.
+const maxOCDepth = 32
+
+// parseOCOrder parses an Order array. An array following a group holds
+// the group's nested items; other arrays are collections, labelled when
+// they start with a text string.
+func parseOCOrder(arr *raw.ArrayObj, resolver rawResolver, depth int) []OCOrderItem {
+	var items []OCOrderItem
+	for _, item := range arr.Items {
+		if sub, ok := resolveArray(item, resolver); ok {
+			if depth >= maxOCDepth {
+				continue
+			}
+			entries := sub.Items
+			label := ""
+			if len(entries) > 0 {
+				switch entries[0].(type) {
+				case raw.StringObj, raw.HexStringObj:
+					label = textString(entries[0])
+					entries = entries[1:]
+				}
+			}
+			children := parseOCOrder(raw.NewArray(entries...), resolver, depth+1)
+			if n := len(items); n > 0 && label == "" && items[n-1].Group != nil && items[n-1].Children == nil {
+				items[n-1].Children = children
+			} else {
+				items = append(items, OCOrderItem{Label: label, Children: children})
+			}
+			continue
+		}
+		if g := parseOCGroup(item, resolver); g != nil {
+			items = append(items, OCOrderItem{Group: g})
+		}
+	}
+	return items
+}
+
+// parseVisibilityExpression parses a VE array or group.
+func parseVisibilityExpression(obj raw.Object, resolver rawResolver, depth int) *VisibilityExpression {
+	arr, ok := resolveArray(obj, resolver)
+	if !ok {
+		if g := parseOCGroup(obj, resolver); g != nil {
+			return &VisibilityExpression{Group: g}
+		}
+		return nil
+	}
+	if arr.Len() == 0 || depth >= maxOCDepth {
+		return nil
+	}
+	op, ok := arr.Items[0].(raw.NameObj)
+	if !ok {
+		return nil
+	}
+	ve := &VisibilityExpression{Op: op.Value()}
+	for _, item := range arr.Items[1:] {
+		if operand := parseVisibilityExpression(item, resolver, depth+1); operand != nil {
+			ve.Operands = append(ve.Operands, operand)
+		}
+	}
+	return ve
+}
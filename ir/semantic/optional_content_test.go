@@ -0,0 +1,54 @@
+package semantic
+
+import "testing"
+
+func TestOCProperties_Visibility(t *testing.T) {
+	props := &OCProperties{}
+	a := props.AddLayer("A", true)
+	b := props.AddLayer("B", false)
+	c := props.AddLayer("C", true)
+
+	var nilProps *OCProperties
+	if !nilProps.Visible(b) {
+		t.Errorf("content without OCProperties should be visible")
+	}
+	if !props.Visible(a) || props.Visible(b) {
+		t.Errorf("A should be visible and B hidden")
+	}
+
+	for _, tc := range []struct {
+		policy string
+		want   bool
+	}{{"", true}, {"AnyOn", true}, {"AllOn", false}, {"AnyOff", true}, {"AllOff", false}} {
+		m := &OptionalContentMembership{OCGs: []*OptionalContentGroup{a, b}, Policy: tc.policy}
+		if got := props.Visible(m); got != tc.want {
+			t.Errorf("policy %q: visible = %v, want %v", tc.policy, got, tc.want)
+		}
+	}
+
+	ve := &OptionalContentMembership{
+		OCGs:   []*OptionalContentGroup{a},
+		Policy: "AllOn",
+		VE: &VisibilityExpression{Op: "Or", Operands: []*VisibilityExpression{
+			{Group: b},
+			{Op: "Not", Operands: []*VisibilityExpression{{Group: c}}},
+		}},
+	}
+	if props.Visible(ve) {
+		t.Errorf("VE should take precedence over OCGs")
+	}
+
+	props.D.RBGroups = [][]*OptionalContentGroup{{a, b}}
+	props.SetVisible(b, true)
+	if props.Visible(a) || !props.Visible(b) || !props.Visible(c) {
+		t.Errorf("radio button group: A %v, B %v, C %v", props.Visible(a), props.Visible(b), props.Visible(c))
+	}
+	if !props.Dirty {
+		t.Errorf("SetVisible should mark the properties dirty")
+	}
+
+	off := &OCConfig{BaseState: "OFF", ON: []*OptionalContentGroup{c}}
+	if off.GroupVisible(a) || !off.GroupVisible(c) {
+		t.Errorf("BaseState OFF: only groups in ON are visible")
+	}
+}
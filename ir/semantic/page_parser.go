@@ -2,6 +2,7 @@ package semantic
 
 import (
 	"fmt"
+	"sync"
 
 	"context"
 
@@ -20,8 +21,10 @@ type inheritedPageProps struct {
 // parsePages traverses the page tree and returns a flat list of pages.
 func parsePages(obj raw.Object, resolver rawResolver, inherited inheritedPageProps) ([]*Page, error) {
 	// Resolve indirect reference
+	var objRef raw.ObjectRef
 	if ref, ok := obj.(raw.Reference); ok {
-		resolved, err := resolver.Resolve(ref.Ref())
+		objRef = ref.Ref()
+		resolved, err := resolver.Resolve(objRef)
 		if err != nil {
 			return nil, err
 		}
@@ -76,6 +79,7 @@ func parsePages(obj raw.Object, resolver rawResolver, inherited inheritedPagePro
 		if err != nil {
 			return nil, err
 		}
+		page.OriginalRef = objRef
 		return []*Page{page}, nil
 	}
 
@@ -138,29 +142,12 @@ func parsePage(dict *raw.DictObj, resolver rawResolver, inherited inheritedPageP
 		page.Rotate = *inherited.Rotate
 	}
 
-	// Resources
-	if resObj, ok := dict.Get(raw.NameLiteral("Resources")); ok {
-		res, err := parseResources(resObj, resolver)
-		if err == nil {
-			page.Resources = res
-		} else {
-			// Warning: failed to parse resources
-		}
-	} else if inherited.Resources != nil {
-		res, err := parseResources(inherited.Resources, resolver)
-		if err == nil {
-			page.Resources = res
-		}
-	}
-
-	// Contents
-	if contentsObj, ok := dict.Get(raw.NameLiteral("Contents")); ok {
-		streams, err := parseContentStreams(contentsObj, resolver)
-		if err != nil {
-			// Warning: failed to parse content streams
-		} else {
-			page.Contents = streams
-		}
+	// Resources and Contents; lazily loaded documents defer both until the
+	// page is loaded.
+	if lr, ok := resolver.(lazyResolver); ok && lr.Lazy() {
+		page.lazy = &pageContent{dict: dict, resources: inherited.Resources, resolver: lr}
+	} else {
+		parsePageContent(page, dict, inherited.Resources, resolver)
 	}
 
 	// Parse Viewports
@@ -196,6 +183,73 @@ func parsePage(dict *raw.DictObj, resolver rawResolver, inherited inheritedPageP
 	return page, nil
 }
 
+// lazyResolver is implemented by resolvers over lazily loaded raw documents.
+type lazyResolver interface {
+	rawResolver
+	Lazy() bool
+	withContext(ctx context.Context) rawResolver
+}
+
+// pageContent holds what is needed to parse a page's resources and content
+// streams on first access.
+type pageContent struct {
+	mu        sync.Mutex
+	done      bool
+	dict      *raw.DictObj
+	resources raw.Object // inherited /Resources
+	resolver  lazyResolver
+}
+
+// Load parses the page's resources and content streams when their parsing
+// was deferred by lazy document loading. It is a no-op for eagerly parsed or
+// already loaded pages and is safe to call concurrently.
+func (p *Page) Load(ctx context.Context) error {
+	lc := p.lazy
+	if lc == nil {
+		return nil
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if lc.done {
+		return nil
+	}
+	parsePageContent(p, lc.dict, lc.resources, lc.resolver.withContext(ctx))
+	if err := ctx.Err(); err != nil {
+		// Leave the page unloaded so a later call can retry.
+		p.Resources, p.Contents = nil, nil
+		return err
+	}
+	lc.done = true
+	return nil
+}
+
+// parsePageContent fills the page's Resources and Contents from its
+// dictionary, falling back to inherited resources.
+func parsePageContent(page *Page, dict *raw.DictObj, inherited raw.Object, resolver rawResolver) {
+	if resObj, ok := dict.Get(raw.NameLiteral("Resources")); ok {
+		res, err := parseResources(resObj, resolver)
+		if err == nil {
+			page.Resources = res
+		} else {
+			// Warning: failed to parse resources
+		}
+	} else if inherited != nil {
+		res, err := parseResources(inherited, resolver)
+		if err == nil {
+			page.Resources = res
+		}
+	}
+
+	if contentsObj, ok := dict.Get(raw.NameLiteral("Contents")); ok {
+		streams, err := parseContentStreams(contentsObj, resolver)
+		if err != nil {
+			// Warning: failed to parse content streams
+		} else {
+			page.Contents = streams
+		}
+	}
+}
+
 func parseOutputIntents(obj raw.Object, resolver rawResolver) ([]OutputIntent, error) {
 	arr, ok := resolveArray(obj, resolver)
 	if !ok {
@@ -466,9 +520,18 @@ func parseContentStreams(obj raw.Object, resolver rawResolver) ([]ContentStream,
 }
 
 func decodeStream(stream *raw.StreamObj) ([]byte, error) {
+	names, params := streamFilters(stream)
+	if len(names) == 0 {
+		return stream.Data, nil
+	}
+	return decodeFilters(stream.Data, names, params)
+}
+
+// streamFilters returns the /Filter names of stream with their /DecodeParms.
+func streamFilters(stream *raw.StreamObj) ([]string, []raw.Dictionary) {
 	filterObj, ok := stream.Dict.Get(raw.NameLiteral("Filter"))
 	if !ok {
-		return stream.Data, nil
+		return nil, nil
 	}
 
 	var filterNames []string
@@ -482,10 +545,6 @@ func decodeStream(stream *raw.StreamObj) ([]byte, error) {
 		}
 	}
 
-	if len(filterNames) == 0 {
-		return stream.Data, nil
-	}
-
 	var params []raw.Dictionary
 	if paramObj, ok := stream.Dict.Get(raw.NameLiteral("DecodeParms")); ok {
 		if dict, ok := paramObj.(*raw.DictObj); ok {
@@ -500,7 +559,14 @@ func decodeStream(stream *raw.StreamObj) ([]byte, error) {
 			}
 		}
 	}
+	return filterNames, params
+}
 
+// decodeFilters applies the generic (non-image) filters to data.
+func decodeFilters(data []byte, filterNames []string, params []raw.Dictionary) ([]byte, error) {
+	if len(filterNames) == 0 {
+		return data, nil
+	}
 	pipeline := filters.NewPipeline([]filters.Decoder{
 		filters.NewFlateDecoder(),
 		filters.NewASCII85Decoder(),
@@ -509,5 +575,5 @@ func decodeStream(stream *raw.StreamObj) ([]byte, error) {
 		filters.NewRunLengthDecoder(),
 	}, filters.Limits{MaxDecompressedSize: 100 * 1024 * 1024})
 
-	return pipeline.Decode(context.Background(), stream.Data, filterNames, params)
+	return pipeline.Decode(context.Background(), data, filterNames, params)
 }
@@ -163,11 +163,146 @@ func parseColorSpace(obj raw.Object, resolver rawResolver) (ColorSpace, error) {
 			return &SpectrallyDefinedColorSpace{Data: data}, nil
 		}
 		return nil, fmt.Errorf("SpectrallyDefined second element is not stream")
+	case "ICCBased":
+		// [ /ICCBased <stream> ]
+		if len(arr.Items) < 2 {
+			return nil, fmt.Errorf("ICCBased missing stream")
+		}
+		_, stream, ok := resolveStreamDict(arr.Items[1], resolver)
+		if !ok || stream == nil {
+			return nil, fmt.Errorf("ICCBased second element is not stream")
+		}
+		icc := &ICCBasedColorSpace{}
+		if ref, ok := arr.Items[1].(raw.RefObj); ok {
+			icc.OriginalRef = ref.Ref()
+		}
+		if n, ok := stream.Dict.Get(raw.NameLiteral("N")); ok {
+			if num, ok := n.(raw.NumberObj); ok {
+				icc.N = int(num.Int())
+			}
+		}
+		if alt, ok := stream.Dict.Get(raw.NameLiteral("Alternate")); ok {
+			if c, err := parseColorSpace(alt, resolver); err == nil {
+				icc.Alternate = c
+			}
+		}
+		if rng, ok := stream.Dict.Get(raw.NameLiteral("Range")); ok {
+			icc.Range = parseNumberArray(rng)
+		}
+		data, err := decodeStream(stream)
+		if err != nil {
+			data = stream.Data
+		}
+		icc.Profile = data
+		return icc, nil
+	case "Indexed", "I":
+		// [ /Indexed base hival lookup ]
+		if len(arr.Items) < 4 {
+			return nil, fmt.Errorf("Indexed color space needs 4 elements")
+		}
+		base, err := parseColorSpace(arr.Items[1], resolver)
+		if err != nil {
+			return nil, fmt.Errorf("Indexed base: %w", err)
+		}
+		ics := &IndexedColorSpace{Base: base}
+		if n, ok := arr.Items[2].(raw.NumberObj); ok {
+			ics.Hival = int(n.Int())
+		}
+		lookup := arr.Items[3]
+		if ref, ok := lookup.(raw.RefObj); ok {
+			if resolved, err := resolver.Resolve(ref.Ref()); err == nil {
+				lookup = resolved
+			}
+		}
+		switch v := lookup.(type) {
+		case raw.StringObj:
+			ics.Lookup = v.Value()
+		case *raw.StreamObj:
+			data, err := decodeStream(v)
+			if err != nil {
+				data = v.Data
+			}
+			ics.Lookup = data
+		}
+		return ics, nil
+	case "Separation":
+		// [ /Separation name alternateSpace tintTransform ]
+		if len(arr.Items) < 4 {
+			return nil, fmt.Errorf("Separation color space needs 4 elements")
+		}
+		scs := &SeparationColorSpace{}
+		if n, ok := arr.Items[1].(raw.NameObj); ok {
+			scs.Name = n.Value()
+		}
+		if alt, err := parseColorSpace(arr.Items[2], resolver); err == nil {
+			scs.Alternate = alt
+		}
+		if fn, err := parseFunction(arr.Items[3], resolver); err == nil {
+			scs.TintTransform = fn
+		}
+		return scs, nil
+	case "DeviceN":
+		// [ /DeviceN names alternateSpace tintTransform attributes? ]
+		if len(arr.Items) < 4 {
+			return nil, fmt.Errorf("DeviceN color space needs at least 4 elements")
+		}
+		dn := &DeviceNColorSpace{}
+		if names, ok := resolveArray(arr.Items[1], resolver); ok {
+			for _, it := range names.Items {
+				if n, ok := it.(raw.NameObj); ok {
+					dn.Names = append(dn.Names, n.Value())
+				}
+			}
+		}
+		if alt, err := parseColorSpace(arr.Items[2], resolver); err == nil {
+			dn.Alternate = alt
+		}
+		if fn, err := parseFunction(arr.Items[3], resolver); err == nil {
+			dn.TintTransform = fn
+		}
+		if len(arr.Items) > 4 {
+			if attrs, ok := resolveDict(arr.Items[4], resolver); ok {
+				dn.Attributes = &DeviceNAttributes{Subtype: getName(attrs, "Subtype")}
+			}
+		}
+		return dn, nil
+	case "Pattern":
+		// [ /Pattern underlying ]
+		pcs := &PatternColorSpace{}
+		if len(arr.Items) > 1 {
+			if under, err := parseColorSpace(arr.Items[1], resolver); err == nil {
+				pcs.Underlying = under
+			}
+		}
+		return pcs, nil
 	}
 
 	return DeviceColorSpace{Name: name}, nil // Fallback
 }
 
+// resolveStreamDict resolves obj to a dictionary. Streams (tiling patterns,
+// mesh shadings, sampled functions) yield their stream dictionary together
+// with the stream itself.
+func resolveStreamDict(obj raw.Object, resolver rawResolver) (*raw.DictObj, *raw.StreamObj, bool) {
+	if ref, ok := obj.(raw.RefObj); ok {
+		resolved, err := resolver.Resolve(ref.Ref())
+		if err != nil {
+			return nil, nil, false
+		}
+		obj = resolved
+	}
+	switch v := obj.(type) {
+	case *raw.DictObj:
+		return v, nil, true
+	case *raw.StreamObj:
+		if v.Dict == nil {
+			return nil, nil, false
+		}
+		return v.Dict, v, true
+	}
+	return nil, nil, false
+}
+
 func parseExtGState(obj raw.Object, resolver rawResolver) (*ExtGState, error) {
 	dict, ok := resolveDict(obj, resolver)
 	if !ok {
@@ -230,6 +365,30 @@ func parseExtGState(obj raw.Object, resolver rawResolver) (*ExtGState, error) {
 		}
 	}
 
+	if v, ok := dict.Get(raw.NameLiteral("SMask")); ok {
+		if n, ok := v.(raw.NameObj); ok && n.Value() == "None" {
+			gs.SoftMask = &SoftMaskDict{Subtype: "None"}
+		} else if smDict, ok := resolveDict(v, resolver); ok {
+			sm := &SoftMaskDict{Subtype: getName(smDict, "S")}
+			if g, ok := smDict.Get(raw.NameLiteral("G")); ok {
+				if xo, err := parseXObject(g, resolver); err == nil {
+					sm.Group = xo
+				}
+			}
+			if bc, ok := smDict.Get(raw.NameLiteral("BC")); ok {
+				sm.BackdropColor = parseNumberArray(bc)
+			}
+			if tr, ok := smDict.Get(raw.NameLiteral("TR")); ok {
+				if n, ok := tr.(raw.NameObj); ok {
+					sm.Transfer = n.Value()
+				} else if fn, err := parseFunction(tr, resolver); err == nil {
+					sm.TransferFunction = fn
+				}
+			}
+			gs.SoftMask = sm
+		}
+	}
+
 	// UseBlackPtComp (PDF 2.0)
 	if v, ok := dict.Get(raw.NameLiteral("UseBlackPtComp")); ok {
 		if b, ok := v.(raw.BoolObj); ok {
@@ -299,22 +458,6 @@ func parseFont(obj raw.Object, resolver rawResolver) (*Font, error) {
 				}
 			}
 		}
-		if tuObj, ok := dict.Get(raw.NameLiteral("ToUnicode")); ok {
-			// Preserve ToUnicode CMap
-			if ref, ok := tuObj.(raw.Reference); ok {
-				resolved, err := resolver.Resolve(ref.Ref())
-				if err == nil {
-					tuObj = resolved
-				}
-			}
-			if stream, ok := tuObj.(*raw.StreamObj); ok {
-				data, err := decodeStream(stream)
-				if err != nil {
-					data = stream.Data
-				}
-				f.ToUnicodeCMap = data
-			}
-		}
 	} else {
 		// Simple Font Widths
 		if wObj, ok := dict.Get(raw.NameLiteral("Widths")); ok {
@@ -335,6 +478,27 @@ func parseFont(obj raw.Object, resolver rawResolver) (*Font, error) {
 		}
 	}
 
+	if tuObj, ok := dict.Get(raw.NameLiteral("ToUnicode")); ok {
+		// Preserve ToUnicode CMap
+		if ref, ok := tuObj.(raw.Reference); ok {
+			resolved, err := resolver.Resolve(ref.Ref())
+			if err == nil {
+				tuObj = resolved
+			}
+		}
+		if stream, ok := tuObj.(*raw.StreamObj); ok {
+			data, err := decodeStream(stream)
+			if err != nil {
+				data = stream.Data
+			}
+			f.ToUnicodeCMap = data
+		}
+	}
+
+	if f.Subtype == "Type3" {
+		parseType3Font(f, dict, resolver)
+	}
+
 	// FontDescriptor
 	if fdObj, ok := dict.Get(raw.NameLiteral("FontDescriptor")); ok {
 		if fdDict, ok := resolveDict(fdObj, resolver); ok {
@@ -345,6 +509,43 @@ func parseFont(obj raw.Object, resolver rawResolver) (*Font, error) {
 	return f, nil
 }
 
+func parseType3Font(f *Font, dict *raw.DictObj, resolver rawResolver) {
+	if cp, ok := dict.Get(raw.NameLiteral("CharProcs")); ok {
+		if cpDict, ok := resolveDict(cp, resolver); ok {
+			f.CharProcs = make(map[string][]byte, len(cpDict.KV))
+			for name, v := range cpDict.KV {
+				if ref, ok := v.(raw.Reference); ok {
+					resolved, err := resolver.Resolve(ref.Ref())
+					if err != nil {
+						continue
+					}
+					v = resolved
+				}
+				if stream, ok := v.(*raw.StreamObj); ok {
+					data, err := decodeStream(stream)
+					if err != nil {
+						data = stream.Data
+					}
+					f.CharProcs[name] = data
+				}
+			}
+		}
+	}
+	if fm, ok := dict.Get(raw.NameLiteral("FontMatrix")); ok {
+		f.FontMatrix = parseNumberArray(fm)
+	}
+	if bb, ok := dict.Get(raw.NameLiteral("FontBBox")); ok {
+		if rect := parseRectangleFromObj(bb); rect != nil {
+			f.FontBBox = *rect
+		}
+	}
+	if res, ok := dict.Get(raw.NameLiteral("Resources")); ok {
+		if r, err := parseResources(res, resolver); err == nil {
+			f.Resources = r
+		}
+	}
+}
+
 func parseCIDFont(dict *raw.DictObj, resolver rawResolver) *CIDFont {
 	cf := &CIDFont{}
 	if s, ok := dict.Get(raw.NameLiteral("Subtype")); ok {
@@ -597,10 +798,59 @@ func parseFontDescriptor(dict *raw.DictObj, resolver rawResolver) *FontDescripto
 	return fd
 }
 
+// imageCodecs are the image filters whose output is not plain samples and
+// which parseXObject therefore leaves encoded.
+var imageCodecs = map[string]bool{
+	"DCTDecode":      true,
+	"JPXDecode":      true,
+	"CCITTFaxDecode": true,
+	"JBIG2Decode":    true,
+}
+
+// jbig2Globals splits the /JBIG2Globals stream out of JBIG2Decode
+// parameters, returning its decoded data and the remaining parameters.
+func jbig2Globals(params raw.Dictionary, resolver rawResolver) ([]byte, raw.Dictionary) {
+	if params == nil {
+		return nil, nil
+	}
+	obj, ok := params.Get(raw.NameLiteral("JBIG2Globals"))
+	if !ok {
+		return nil, params
+	}
+	if ref, ok := obj.(raw.Reference); ok {
+		resolved, err := resolver.Resolve(ref.Ref())
+		if err != nil {
+			return nil, params
+		}
+		obj = resolved
+	}
+	stream, ok := obj.(*raw.StreamObj)
+	if !ok {
+		return nil, params
+	}
+	data, err := decodeStream(stream)
+	if err != nil {
+		return nil, params
+	}
+	rest := raw.Dict()
+	for _, k := range params.Keys() {
+		if k.Value() != "JBIG2Globals" {
+			v, _ := params.Get(k)
+			rest.Set(k, v)
+		}
+	}
+	if rest.Len() == 0 {
+		return data, nil
+	}
+	return data, rest
+}
+
 func parseXObject(obj raw.Object, resolver rawResolver) (*XObject, error) {
 	// Resolve
+	var objRef raw.ObjectRef
 	if ref, ok := obj.(raw.Reference); ok {
-		resolved, err := resolver.Resolve(ref.Ref())
+		objRef = ref.Ref()
+		resolved, err := resolver.Resolve(objRef)
 		if err != nil {
 			return nil, err
 		}
@@ -613,13 +863,34 @@ func parseXObject(obj raw.Object, resolver rawResolver) (*XObject, error) {
 	}
 	dict := stream.Dict
 
+	xo := &XObject{OriginalRef: objRef}
 	data, err := decodeStream(stream)
 	if err != nil {
-		// Warning: failed to decode XObject stream
+		// Image codecs (DCT, JPX, CCITT, JBIG2) are kept encoded: strip
+		// the generic filters in front of them and record the codec in
+		// Filter.
 		data = stream.Data
+		names, params := streamFilters(stream)
+		if n := len(names); n > 0 && imageCodecs[names[n-1]] {
+			if pre, err := decodeFilters(stream.Data, names[:n-1], params); err == nil {
+				data = pre
+				xo.Filter = names[n-1]
+				if len(params) >= n {
+					xo.DecodeParms = params[n-1]
+				}
+				if xo.Filter == "JBIG2Decode" {
+					xo.JBIG2Globals, xo.DecodeParms = jbig2Globals(xo.DecodeParms, resolver)
+				}
+			}
+		}
 	}
+	xo.Data = data
 
-	xo := &XObject{Data: data}
+	if oc, ok := dict.Get(raw.NameLiteral("OC")); ok {
+		if pl, err := parsePropertyList(oc, resolver); err == nil {
+			xo.OC = pl
+		}
+	}
 
 	if s, ok := dict.Get(raw.NameLiteral("Subtype")); ok {
 		if name, ok := s.(raw.NameObj); ok {
@@ -653,12 +924,36 @@ func parseXObject(obj raw.Object, resolver rawResolver) (*XObject, error) {
 				xo.Interpolate = b.Value()
 			}
 		}
+		if im, ok := dict.Get(raw.NameLiteral("ImageMask")); ok {
+			if b, ok := im.(raw.BoolObj); ok {
+				xo.ImageMask = b.Value()
+			}
+		}
+		if xo.ImageMask && xo.BitsPerComponent == 0 {
+			xo.BitsPerComponent = 1
+		}
+		if d, ok := dict.Get(raw.NameLiteral("Decode")); ok {
+			xo.Decode = parseNumberArray(d)
+		}
 		if sm, ok := dict.Get(raw.NameLiteral("SMask")); ok {
 			// Recursive call for SMask XObject
 			if smXo, err := parseXObject(sm, resolver); err == nil {
 				xo.SMask = smXo
 			}
 		}
+		if m, ok := dict.Get(raw.NameLiteral("Mask")); ok {
+			if arr, ok := resolveArray(m, resolver); ok {
+				for _, v := range parseNumberArray(arr) {
+					xo.ColorKey = append(xo.ColorKey, int(v))
+				}
+			} else if mXo, err := parseXObject(m, resolver); err == nil {
+				mXo.ImageMask = true
+				if mXo.BitsPerComponent == 0 {
+					mXo.BitsPerComponent = 1
+				}
+				xo.Mask = mXo
+			}
+		}
 	} else if xo.Subtype == "Form" {
 		if bb, ok := dict.Get(raw.NameLiteral("BBox")); ok {
 			if rect := parseRectangleFromObj(bb); rect != nil {
@@ -713,10 +1008,14 @@ func parsePattern(obj raw.Object, resolver rawResolver) (Pattern, error) {
 		obj = resolved
 	}
 
-	dict, ok := resolveDict(obj, resolver)
+	dict, stream, ok := resolveStreamDict(obj, resolver)
 	if !ok {
 		return nil, fmt.Errorf("pattern is not a dict")
 	}
+	var matrix []float64
+	if m, ok := dict.Get(raw.NameLiteral("Matrix")); ok {
+		matrix = parseNumberArray(m)
+	}
 
 	pt := 0
 	if t, ok := dict.Get(raw.NameLiteral("PatternType")); ok {
@@ -727,9 +1026,13 @@ func parsePattern(obj raw.Object, resolver rawResolver) (Pattern, error) {
 
 	if pt == 1 {
 		// Tiling
-		tp := &TilingPattern{BasePattern: BasePattern{Type: 1}}
-		if stream, ok := obj.(*raw.StreamObj); ok {
-			tp.Content = stream.Data
+		tp := &TilingPattern{BasePattern: BasePattern{Type: 1, Matrix: matrix}}
+		if stream != nil {
+			data, err := decodeStream(stream)
+			if err != nil {
+				data = stream.Data
+			}
+			tp.Content = data
 		}
 		if paint, ok := dict.Get(raw.NameLiteral("PaintType")); ok {
 			if n, ok := paint.(raw.NumberObj); ok {
@@ -764,7 +1067,7 @@ func parsePattern(obj raw.Object, resolver rawResolver) (Pattern, error) {
 		return tp, nil
 	} else if pt == 2 {
 		// Shading Pattern
-		sp := &ShadingPattern{BasePattern: BasePattern{Type: 2}}
+		sp := &ShadingPattern{BasePattern: BasePattern{Type: 2, Matrix: matrix}}
 		if sh, ok := dict.Get(raw.NameLiteral("Shading")); ok {
 			if s, err := parseShading(sh, resolver); err == nil {
 				sp.Shading = s
@@ -791,7 +1094,7 @@ func parseShading(obj raw.Object, resolver rawResolver) (Shading, error) {
 		obj = resolved
 	}
 
-	dict, ok := resolveDict(obj, resolver)
+	dict, stream, ok := resolveStreamDict(obj, resolver)
 	if !ok {
 		return nil, fmt.Errorf("shading is not a dict")
 	}
@@ -840,16 +1143,22 @@ func parseShading(obj raw.Object, resolver rawResolver) (Shading, error) {
 				}
 			}
 		}
-		if _, ok := dict.Get(raw.NameLiteral("Function")); ok {
-			// Parse function (simplified: skip for now or implement parseFunction)
-			// We need parseFunction to support shadings fully.
+		if m, ok := dict.Get(raw.NameLiteral("Matrix")); ok {
+			fs.Matrix = parseNumberArray(m)
+		}
+		if f, ok := dict.Get(raw.NameLiteral("Function")); ok {
+			fs.Function = parseFunctionList(f, resolver)
 		}
 		return fs, nil
 	} else if st >= 4 && st <= 7 {
 		// Mesh based
 		ms := &MeshShading{BaseShading: base}
-		if stream, ok := obj.(*raw.StreamObj); ok {
-			ms.Stream = stream.Data
+		if stream != nil {
+			data, err := decodeStream(stream)
+			if err != nil {
+				data = stream.Data
+			}
+			ms.Stream = data
 		}
 		if bpc, ok := dict.Get(raw.NameLiteral("BitsPerCoordinate")); ok {
 			if n, ok := bpc.(raw.NumberObj); ok {
@@ -869,63 +1178,163 @@ func parseShading(obj raw.Object, resolver rawResolver) (Shading, error) {
 		if d, ok := dict.Get(raw.NameLiteral("Decode")); ok {
 			ms.Decode = parseNumberArray(d)
 		}
+		if vpr, ok := dict.Get(raw.NameLiteral("VerticesPerRow")); ok {
+			if n, ok := vpr.(raw.NumberObj); ok {
+				ms.VerticesPerRow = int(n.Int())
+			}
+		}
+		if f, ok := dict.Get(raw.NameLiteral("Function")); ok {
+			if fns := parseFunctionList(f, resolver); len(fns) == 1 {
+				ms.Function = fns[0]
+			}
+		}
 		return ms, nil
 	}
 
 	return nil, fmt.Errorf("unknown shading type %d", st)
 }
 
-func parsePropertyList(obj raw.Object, resolver rawResolver) (PropertyList, error) {
-	// Resolve
-	if ref, ok := obj.(raw.Reference); ok {
-		resolved, err := resolver.Resolve(ref.Ref())
-		if err != nil {
-			return nil, err
+// parseFunctionList parses a /Function entry, which is either a single
+// function or an array of 1-in, 1-out functions (one per colour component).
+func parseFunctionList(obj raw.Object, resolver rawResolver) []Function {
+	if arr, ok := resolveArray(obj, resolver); ok {
+		var fns []Function
+		for _, item := range arr.Items {
+			if f, err := parseFunction(item, resolver); err == nil {
+				fns = append(fns, f)
+			}
 		}
-		obj = resolved
+		return fns
+	}
+	if f, err := parseFunction(obj, resolver); err == nil {
+		return []Function{f}
 	}
+	return nil
+}
 
-	dict, ok := resolveDict(obj, resolver)
+func parseFunction(obj raw.Object, resolver rawResolver) (Function, error) {
+	var ref raw.ObjectRef
+	if r, ok := obj.(raw.RefObj); ok {
+		ref = r.Ref()
+	}
+	dict, stream, ok := resolveStreamDict(obj, resolver)
 	if !ok {
-		return nil, fmt.Errorf("property list is not a dict")
+		return nil, fmt.Errorf("function is not a dict or stream")
 	}
 
-	typ := ""
-	if t, ok := dict.Get(raw.NameLiteral("Type")); ok {
-		if name, ok := t.(raw.NameObj); ok {
-			typ = name.Value()
+	ft := -1
+	if t, ok := dict.Get(raw.NameLiteral("FunctionType")); ok {
+		if n, ok := t.(raw.NumberObj); ok {
+			ft = int(n.Int())
 		}
 	}
+	base := BaseFunction{Type: ft, Ref: ref, OriginalRef: ref}
+	if d, ok := dict.Get(raw.NameLiteral("Domain")); ok {
+		base.Domain = parseNumberArray(d)
+	}
+	if r, ok := dict.Get(raw.NameLiteral("Range")); ok {
+		base.Range = parseNumberArray(r)
+	}
 
-	if typ == "OCG" {
-		ocg := &OptionalContentGroup{}
-		if n, ok := dict.Get(raw.NameLiteral("Name")); ok {
-			if s, ok := n.(raw.StringObj); ok {
-				ocg.Name = string(s.Value())
+	streamData := func() []byte {
+		data, err := decodeStream(stream)
+		if err != nil {
+			return stream.Data
+		}
+		return data
+	}
+
+	switch ft {
+	case 0:
+		if stream == nil {
+			return nil, fmt.Errorf("sampled function is not a stream")
+		}
+		f := &SampledFunction{BaseFunction: base, Order: 1}
+		if sz, ok := dict.Get(raw.NameLiteral("Size")); ok {
+			for _, v := range parseNumberArray(sz) {
+				f.Size = append(f.Size, int(v))
+			}
+		}
+		if bps, ok := dict.Get(raw.NameLiteral("BitsPerSample")); ok {
+			if n, ok := bps.(raw.NumberObj); ok {
+				f.BitsPerSample = int(n.Int())
 			}
 		}
-		if i, ok := dict.Get(raw.NameLiteral("Intent")); ok {
-			if name, ok := i.(raw.NameObj); ok {
-				ocg.Intent = []string{name.Value()}
-			} else if arr, ok := resolveArray(i, resolver); ok {
+		if ord, ok := dict.Get(raw.NameLiteral("Order")); ok {
+			if n, ok := ord.(raw.NumberObj); ok {
+				f.Order = int(n.Int())
+			}
+		}
+		if enc, ok := dict.Get(raw.NameLiteral("Encode")); ok {
+			f.Encode = parseNumberArray(enc)
+		}
+		if dec, ok := dict.Get(raw.NameLiteral("Decode")); ok {
+			f.Decode = parseNumberArray(dec)
+		}
+		f.Samples = streamData()
+		return f, nil
+	case 2:
+		f := &ExponentialFunction{BaseFunction: base, C0: []float64{0}, C1: []float64{1}}
+		if c0, ok := dict.Get(raw.NameLiteral("C0")); ok {
+			f.C0 = parseNumberArray(c0)
+		}
+		if c1, ok := dict.Get(raw.NameLiteral("C1")); ok {
+			f.C1 = parseNumberArray(c1)
+		}
+		if n, ok := dict.Get(raw.NameLiteral("N")); ok {
+			if num, ok := n.(raw.NumberObj); ok {
+				f.N = num.Float()
+			}
+		}
+		return f, nil
+	case 3:
+		f := &StitchingFunction{BaseFunction: base}
+		if fns, ok := dict.Get(raw.NameLiteral("Functions")); ok {
+			if arr, ok := resolveArray(fns, resolver); ok {
 				for _, item := range arr.Items {
-					if name, ok := item.(raw.NameObj); ok {
-						ocg.Intent = append(ocg.Intent, name.Value())
+					sub, err := parseFunction(item, resolver)
+					if err != nil {
+						return nil, fmt.Errorf("stitching sub-function: %w", err)
 					}
+					f.Functions = append(f.Functions, sub)
 				}
 			}
 		}
-		return ocg, nil
+		if b, ok := dict.Get(raw.NameLiteral("Bounds")); ok {
+			f.Bounds = parseNumberArray(b)
+		}
+		if e, ok := dict.Get(raw.NameLiteral("Encode")); ok {
+			f.Encode = parseNumberArray(e)
+		}
+		return f, nil
+	case 4:
+		if stream == nil {
+			return nil, fmt.Errorf("PostScript function is not a stream")
+		}
+		return &PostScriptFunction{BaseFunction: base, Code: streamData()}, nil
+	}
+	return nil, fmt.Errorf("unknown function type %d", ft)
+}
+
+func parsePropertyList(obj raw.Object, resolver rawResolver) (PropertyList, error) {
+	dict, ok := resolveDict(obj, resolver)
+	if !ok {
+		return nil, fmt.Errorf("property list is not a dict")
+	}
+
+	typ := getName(dict, "Type")
+	if typ == "OCG" {
+		return parseOCGroup(obj, resolver), nil
 	} else if typ == "OCMD" {
-		ocmd := &OptionalContentMembership{}
-		if p, ok := dict.Get(raw.NameLiteral("P")); ok {
-			if name, ok := p.(raw.NameObj); ok {
-				ocmd.Policy = name.Value()
-			}
+		ocmd := &OptionalContentMembership{Policy: getName(dict, "P")}
+		if ref, ok := obj.(raw.Reference); ok {
+			ocmd.OriginalRef = ref.Ref()
+		}
+		if g, ok := dict.Get(raw.NameLiteral("OCGs")); ok {
+			ocmd.OCGs = parseOCGroups(g, resolver)
 		}
-		if _, ok := dict.Get(raw.NameLiteral("OCGs")); ok {
-			// Parse OCGs (recursive or reference)
-			// Simplified: skip deep parsing for now
+		if ve, ok := dict.Get(raw.NameLiteral("VE")); ok {
+			ocmd.VE = parseVisibilityExpression(ve, resolver, 0)
 		}
 		return ocmd, nil
 	}
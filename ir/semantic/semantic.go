@@ -2,11 +2,13 @@ package semantic
 
 import (
 	"context"
+	"time"
 
 	"github.com/wudi/pdfkit/geo"
 	"github.com/wudi/pdfkit/ir/decoded"
 	"github.com/wudi/pdfkit/ir/raw"
 	"github.com/wudi/pdfkit/security"
+	"github.com/wudi/pdfkit/xmp"
 )
 
 // Document is the semantic representation of a PDF.
@@ -24,6 +26,7 @@ type Document struct {
 	StructTree        *StructureTree
 	DPartRoot         *DPartRoot // PDF/VT
 	OutputIntents     []OutputIntent
+	OCProperties      *OCProperties // optional content (layers)
 	EmbeddedFiles     []EmbeddedFile
 	Names             *Names // Document-level named objects
 	OpenAction        Action // Action to perform when opening the document
@@ -43,7 +46,22 @@ type Document struct {
 // Decoded returns the underlying decoded document (if set).
 func (d *Document) Decoded() *decoded.DecodedDocument { return d.decoded }
 
-// Page models a single PDF page.
+// LoadPages loads the resources and contents of every page whose parsing was
+// deferred by lazy loading. Consumers that walk the whole document call it
+// first; it is a no-op for eagerly parsed documents.
+func (d *Document) LoadPages(ctx context.Context) error {
+	for _, p := range d.Pages {
+		if err := p.Load(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Page models a single PDF page. On a lazily parsed document (see
+// ir.Pipeline.WithLazyLoading) Resources and Contents stay nil until Load
+// or Document.LoadPages has run, so code reading them must load the page
+// first.
 type Page struct {
 	Index           int
 	MediaBox        Rectangle
@@ -51,9 +69,9 @@ type Page struct {
 	TrimBox         Rectangle
 	BleedBox        Rectangle
 	ArtBox          Rectangle
-	Rotate          int // degrees: 0/90/180/270
-	Resources       *Resources
-	Contents        []ContentStream
+	Rotate          int             // degrees: 0/90/180/270
+	Resources       *Resources      // nil until Load on lazily parsed documents
+	Contents        []ContentStream // nil until Load on lazily parsed documents
 	Annotations     []Annotation
 	UserUnit        float64
 	StructParents   *int           // PDF 1.3
@@ -64,6 +82,7 @@ type Page struct {
 	ref             raw.ObjectRef
 	OriginalRef     raw.ObjectRef
 	Dirty           bool
+	lazy            *pageContent // deferred Resources/Contents, see Load
 }
 
 // Transition describes the visual transition when moving to the page.
@@ -112,6 +131,11 @@ type StringOperand struct{ Value []byte }
 func (StringOperand) operand()     {}
 func (StringOperand) Type() string { return "string" }
 
+type BoolOperand struct{ Value bool }
+
+func (BoolOperand) operand()     {}
+func (BoolOperand) Type() string { return "bool" }
+
 type ArrayOperand struct{ Values []Operand }
 
 func (ArrayOperand) operand()     {}
@@ -198,10 +222,12 @@ type ExtGState struct {
 
 // SoftMaskDict represents a soft-mask dictionary used in ExtGState.
 type SoftMaskDict struct {
-	Subtype       string    // /S (Alpha, Luminosity)
+	Subtype       string    // /S (Alpha, Luminosity); "None" for /SMask /None
 	Group         *XObject  // /G (Transparency Group XObject)
 	BackdropColor []float64 // /BC
 	Transfer      string    // /TR (Transfer function name)
+	// TransferFunction is /TR when given as a function rather than a name.
+	TransferFunction Function
 }
 
 // TransparencyGroup describes the attributes of a transparency group XObject.
@@ -296,14 +322,21 @@ type XObject struct {
 	ColorSpace
 	BitsPerComponent int
 	Data             []byte
-	Filter           string     // Optional: specific filter to use (e.g. DCTDecode)
-	BBox             Rectangle  // used for Form XObjects
-	Matrix           []float64  // /Matrix (optional)
-	Resources        *Resources // /Resources (for Form XObjects)
+	Filter           string         // Optional: specific filter to use (e.g. DCTDecode)
+	DecodeParms      raw.Dictionary // /DecodeParms of Filter (e.g. CCITT /K and /Columns)
+	JBIG2Globals     []byte         // decoded /JBIG2Globals stream of a JBIG2Decode Filter, shared between images
+	BBox             Rectangle      // used for Form XObjects
+	Matrix           []float64      // /Matrix (optional)
+	Resources        *Resources     // /Resources (for Form XObjects)
 	Interpolate      bool
+	ImageMask        bool      // /ImageMask: 1-bit stencil painted with the fill colour
+	Decode           []float64 // /Decode array for images
 	SMask            *XObject
+	Mask             *XObject           // /Mask stencil mask (explicit masking)
+	ColorKey         []int              // /Mask colour-key ranges: min and max per component
 	Group            *TransparencyGroup // /Group (for Form XObjects)
 	AssociatedFiles  []EmbeddedFile     // PDF 2.0
+	OC               PropertyList       // /OC: optional content the XObject belongs to
 	OriginalRef      raw.ObjectRef
 	Dirty            bool
 }
@@ -378,6 +411,7 @@ type FunctionShading struct {
 	BaseShading
 	Coords   []float64
 	Domain   []float64
+	Matrix   []float64  // Type 1 only: maps the domain into shading space
 	Function []Function // Function object or array of functions
 	Extend   []bool
 }
@@ -389,6 +423,7 @@ type MeshShading struct {
 	BitsPerComponent  int
 	BitsPerFlag       int
 	Decode            []float64
+	VerticesPerRow    int      // Type 5 only
 	Function          Function // Optional function for Type 4, 5, 6
 	Stream            []byte   // The mesh data stream
 }
@@ -456,23 +491,42 @@ type EmbeddedFile struct {
 
 // DocumentInfo models /Info dictionary values.
 type DocumentInfo struct {
-	Title       string
-	Author      string
-	Subject     string
-	Creator     string
-	Producer    string
-	Trapped     string // "True", "False", or "Unknown"
-	Keywords    []string
-	OriginalRef raw.ObjectRef
-	Dirty       bool
+	Title        string
+	Author       string
+	Subject      string
+	Creator      string
+	Producer     string
+	Trapped      string // "True", "False", or "Unknown"
+	Keywords     []string
+	CreationDate time.Time
+	ModDate      time.Time
+	OriginalRef  raw.ObjectRef
+	Dirty        bool
 }
 
+// XMPMetadata is the document's XMP metadata stream. Packet, when set,
+// takes precedence over Raw; writers keep it and the document information
+// dictionary in agreement.
 type XMPMetadata struct {
 	Raw         []byte
+	Packet      *xmp.Packet
 	OriginalRef raw.ObjectRef
 	Dirty       bool
 }
 
+// XMP returns the structured form of the metadata, parsing Raw on first
+// use.
+func (m *XMPMetadata) XMP() (*xmp.Packet, error) {
+	if m.Packet == nil {
+		p, err := xmp.Parse(m.Raw)
+		if err != nil {
+			return nil, err
+		}
+		m.Packet = p
+	}
+	return m.Packet, nil
+}
+
 // OutputIntent models color output intent metadata.
 type OutputIntent struct {
 	S                         string
@@ -493,17 +547,52 @@ type Annotation interface {
 	Base() *BaseAnnotation
 }
 
+// Annotation flags (F entry), ISO 32000-1 Table 165.
+const (
+	AnnotFlagInvisible      = 1 << 0
+	AnnotFlagHidden         = 1 << 1
+	AnnotFlagPrint          = 1 << 2
+	AnnotFlagNoZoom         = 1 << 3
+	AnnotFlagNoRotate       = 1 << 4
+	AnnotFlagNoView         = 1 << 5
+	AnnotFlagReadOnly       = 1 << 6
+	AnnotFlagLocked         = 1 << 7
+	AnnotFlagToggleNoView   = 1 << 8
+	AnnotFlagLockedContents = 1 << 9
+)
+
+// BorderStyle is a border style dictionary (BS entry).
+type BorderStyle struct {
+	Width float64   // W entry: border width in points (default 1)
+	Style string    // S entry: S (solid), D (dashed), B (beveled), I (inset) or U (underline)
+	Dash  []float64 // D entry: dash array of a dashed border
+}
+
+// BorderEffect is a border effect dictionary (BE entry).
+type BorderEffect struct {
+	Style     string  // S entry: S (none) or C (cloudy)
+	Intensity float64 // I entry: intensity of the effect, 0 to 2
+}
+
 // BaseAnnotation provides common fields for annotations.
 type BaseAnnotation struct {
 	Subtype         string
 	RectVal         Rectangle
 	Contents        string
+	RichContents    string // RC entry: rich text (XHTML) form of Contents
+	NM              string // NM entry: name unique among the page's annotations
+	Author          string // T entry of markup annotations, shown as the pop-up title
+	Modified        string // M entry: date of last modification
 	Appearance      []byte
+	AppearanceForm  *XObject // normal appearance with its BBox, Matrix and Resources; written in place of Appearance
 	Flags           int
 	Border          []float64
+	BorderStyle     *BorderStyle  // BS entry
+	BorderEffect    *BorderEffect // BE entry
 	Color           []float64
 	AppearanceState string
 	AssociatedFiles []EmbeddedFile // PDF 2.0
+	OC              PropertyList   // OC entry: optional content the annotation belongs to
 	Ref             raw.ObjectRef
 	OriginalRef     raw.ObjectRef
 	Dirty           bool
@@ -563,8 +652,12 @@ type SquigglyAnnotation struct {
 // FreeTextAnnotation represents a free text annotation.
 type FreeTextAnnotation struct {
 	BaseAnnotation
-	DA string // Default appearance string
-	Q  int    // Quadding (justification): 0=Left, 1=Center, 2=Right
+	DA string    // Default appearance string
+	Q  int       // Quadding (justification): 0=Left, 1=Center, 2=Right
+	IT string    // Intent: FreeText, FreeTextCallout or FreeTextTypeWriter
+	CL []float64 // Callout line: 4 or 6 numbers, starting at the point the callout points to
+	LE string    // Line ending style of the callout line
+	RD []float64 // Rect differences: the text box inset from Rect
 }
 
 // LineAnnotation represents a line annotation.
@@ -589,6 +682,15 @@ type CircleAnnotation struct {
 	RD []float64 // Rect differences (padding)
 }
 
+// PolygonAnnotation represents a polygon (Subtype Polygon) or polyline
+// (Subtype PolyLine) annotation.
+type PolygonAnnotation struct {
+	BaseAnnotation
+	Vertices []float64 // Vertices [x1 y1 x2 y2 ...]
+	LE       []string  // Line ending styles [start end] of a polyline
+	IC       []float64 // Interior color
+}
+
 // StampAnnotation represents a stamp annotation.
 type StampAnnotation struct {
 	BaseAnnotation
@@ -664,6 +766,8 @@ type ThreeDAnnotation struct {
 // RedactAnnotation represents a redaction annotation.
 type RedactAnnotation struct {
 	BaseAnnotation
+	QuadPoints  []float64 // Areas to redact; Rect is used when empty
+	IC          []float64 // Interior colour used to fill the redacted area
 	OverlayText string    // The text to be displayed on the redacted area
 	Repeat      []float64 // The repeat interval for the overlay text
 }
@@ -1009,7 +1113,8 @@ func (g *OptionalContentGroup) PropertyListType() string { return "OCG" }
 type OptionalContentMembership struct {
 	BasePropertyList
 	OCGs   []*OptionalContentGroup
-	Policy string // /AllOn, /AnyOn, /AnyOff, /AllOff
+	Policy string                // /AllOn, /AnyOn, /AnyOff, /AllOff
+	VE     *VisibilityExpression // takes precedence over OCGs and Policy
 }
 
 func (m *OptionalContentMembership) PropertyListType() string { return "OCMD" }
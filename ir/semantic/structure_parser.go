@@ -553,21 +553,26 @@ func getName(d *raw.DictObj, key string) string {
 
 func getString(d *raw.DictObj, key string) string {
 	if v, ok := d.Get(raw.NameLiteral(key)); ok {
-		var b []byte
-		if s, ok := v.(raw.StringObj); ok {
-			b = s.Value()
-		} else if s, ok := v.(raw.HexStringObj); ok {
-			b = s.Value()
-		}
-
-		if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
-			return decodeUTF16BE(b[2:])
-		}
-		return string(b)
+		return textString(v)
 	}
 	return ""
 }
 
+// textString decodes a text string object.
+func textString(v raw.Object) string {
+	var b []byte
+	if s, ok := v.(raw.StringObj); ok {
+		b = s.Value()
+	} else if s, ok := v.(raw.HexStringObj); ok {
+		b = s.Value()
+	}
+
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		return decodeUTF16BE(b[2:])
+	}
+	return string(b)
+}
+
 func decodeUTF16BE(data []byte) string {
 	if len(data)%2 != 0 {
 		data = data[:len(data)-1]
@@ -13,6 +13,7 @@ import (
 	"github.com/wudi/pdfkit/ir/raw"
 	"github.com/wudi/pdfkit/ir/semantic"
 	"github.com/wudi/pdfkit/security"
+	"github.com/wudi/pdfkit/xmp"
 )
 
 // --- Mocks ---
@@ -40,6 +41,7 @@ func (m *MockBuilder) MeasureText(text string, fontSize float64, fontName string
 func (m *MockBuilder) AddPage(page *semantic.Page) builder.PDFBuilder               { return m }
 func (m *MockBuilder) SetInfo(info *semantic.DocumentInfo) builder.PDFBuilder       { return m }
 func (m *MockBuilder) SetMetadata(xmp []byte) builder.PDFBuilder                    { return m }
+func (m *MockBuilder) SetXMP(packet *xmp.Packet) builder.PDFBuilder                 { return m }
 func (m *MockBuilder) SetLanguage(lang string) builder.PDFBuilder                   { return m }
 func (m *MockBuilder) SetMarked(marked bool) builder.PDFBuilder                     { return m }
 func (m *MockBuilder) AddPageLabel(pageIndex int, prefix string) builder.PDFBuilder { return m }
@@ -54,6 +56,7 @@ func (m *MockBuilder) RegisterFont(name string, font *semantic.Font) builder.PDF
 func (m *MockBuilder) RegisterTrueTypeFont(name string, data []byte) builder.PDFBuilder   { return m }
 func (m *MockBuilder) AddEmbeddedFile(file semantic.EmbeddedFile) builder.PDFBuilder      { return m }
 func (m *MockBuilder) SetCalculationOrder(fields []semantic.FormField) builder.PDFBuilder { return m }
+func (m *MockBuilder) AddLayer(name string, visible bool) builder.PDFBuilder              { return m }
 func (m *MockBuilder) Form() builder.FormBuilder                                          { return nil }
 func (m *MockBuilder) Build() (*semantic.Document, error)                                 { return &semantic.Document{}, nil }
 
@@ -122,6 +125,8 @@ func (m *MockPageBuilder) DrawLine(x1, y1, x2, y2 float64, opts builder.LineOpti
 	return m
 }
 func (m *MockPageBuilder) AddFormField(field semantic.FormField) builder.PageBuilder { return m }
+func (m *MockPageBuilder) BeginLayer(name string) builder.PageBuilder                { return m }
+func (m *MockPageBuilder) EndLayer() builder.PageBuilder                             { return m }
 func (m *MockPageBuilder) SetMediaBox(box semantic.Rectangle) builder.PageBuilder    { return m }
 func (m *MockPageBuilder) SetCropBox(box semantic.Rectangle) builder.PageBuilder     { return m }
 func (m *MockPageBuilder) SetRotation(degrees int) builder.PageBuilder               { return m }
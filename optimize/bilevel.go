@@ -0,0 +1,268 @@
+package optimize
+
+import (
+	"bytes"
+	"compress/zlib"
+	"image"
+	"image/jpeg"
+
+	"github.com/wudi/pdfkit/filters"
+	"github.com/wudi/pdfkit/ir/raw"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// BilevelCodec selects the codec bilevel images are recompressed with.
+type BilevelCodec int
+
+const (
+	// BilevelNone leaves bilevel images as they are.
+	BilevelNone BilevelCodec = iota
+	// BilevelCCITT compresses each image with CCITT Group 4.
+	BilevelCCITT
+	// BilevelJBIG2 compresses each image as a JBIG2 generic region.
+	BilevelJBIG2
+	// BilevelJBIG2Symbols compresses the images as JBIG2 text regions,
+	// sharing the symbols that repeat across images in one JBIG2Globals
+	// stream. It suits text-heavy scans; coding stays lossless.
+	BilevelJBIG2Symbols
+)
+
+// Pixels of a near-bilevel image count as black below bilevelDark and as
+// white above bilevelLight, provided their channels differ by at most
+// bilevelChroma; bilevelThreshold splits them when thresholding.
+const (
+	bilevelDark      = 64
+	bilevelLight     = 191
+	bilevelChroma    = 64
+	bilevelThreshold = 128
+)
+
+// bilevel is a candidate for recompression: its 1-bit samples, 0 black and
+// rows padded to whole bytes, and whether they were 1-bit already.
+type bilevel struct {
+	samples []byte
+	packed  bool
+}
+
+// bilevelSamples returns the samples of xo when it is bilevel or, within
+// NearBilevelTolerance, nearly so. Thresholding needs a tolerance above 0
+// unless every pixel is pure black or white. Nothing is a candidate when
+// no bilevel codec is configured.
+func (o *Optimizer) bilevelSamples(xo semantic.XObject) (bilevel, bool) {
+	if o.config.Bilevel == BilevelNone || xo.Width <= 0 || xo.Height <= 0 || len(xo.ColorKey) > 0 {
+		return bilevel{}, false
+	}
+	stride := (xo.Width + 7) / 8
+	if xo.Filter == "" && (xo.ImageMask || (xo.BitsPerComponent == 1 && len(xo.Decode) == 0 && colorSpaceName(xo) == "DeviceGray")) {
+		if len(xo.Data) < stride*xo.Height {
+			return bilevel{}, false
+		}
+		return bilevel{samples: xo.Data[:stride*xo.Height], packed: true}, true
+	}
+	if xo.ImageMask || len(xo.Decode) > 0 {
+		return bilevel{}, false
+	}
+	pixel, ok := grayPixels(xo)
+	if !ok {
+		return bilevel{}, false
+	}
+	total := xo.Width * xo.Height
+	limit := int(o.config.NearBilevelTolerance * float64(total))
+	mid, exact := 0, true
+	samples := make([]byte, stride*xo.Height)
+	for y := 0; y < xo.Height; y++ {
+		row := samples[y*stride:]
+		for x := 0; x < xo.Width; x++ {
+			v, chroma := pixel(x, y)
+			if (v != 0 && v != 255) || chroma != 0 {
+				exact = false
+			}
+			if (v >= bilevelDark && v <= bilevelLight) || chroma > bilevelChroma {
+				if mid++; mid > limit {
+					return bilevel{}, false
+				}
+			}
+			if v >= bilevelThreshold {
+				row[x>>3] |= 0x80 >> (x & 7)
+			}
+		}
+	}
+	if !exact && o.config.NearBilevelTolerance <= 0 {
+		return bilevel{}, false
+	}
+	return bilevel{samples: samples}, true
+}
+
+func colorSpaceName(xo semantic.XObject) string {
+	if xo.ColorSpace == nil {
+		return ""
+	}
+	return xo.ColorSpace.ColorSpaceName()
+}
+
+// grayPixels returns an accessor for the luminance of the pixels of an
+// 8-bit gray or RGB image, raw or JPEG-compressed, along with how far their
+// colour strays from neutral.
+func grayPixels(xo semantic.XObject) (func(x, y int) (v, chroma int), bool) {
+	w, h := xo.Width, xo.Height
+	if xo.Filter == "DCTDecode" {
+		img, err := jpeg.Decode(bytes.NewReader(xo.Data))
+		if err != nil || img.Bounds().Dx() != w || img.Bounds().Dy() != h {
+			return nil, false
+		}
+		switch img := img.(type) {
+		case *image.Gray:
+			return func(x, y int) (int, int) { return int(img.Pix[y*img.Stride+x]), 0 }, true
+		case *image.YCbCr:
+			return func(x, y int) (int, int) {
+				c := img.COffset(x, y)
+				return int(img.Y[img.YOffset(x, y)]), max(abs(int(img.Cb[c])-128), abs(int(img.Cr[c])-128)) * 2
+			}, true
+		}
+		return nil, false
+	}
+	if xo.Filter != "" || xo.BitsPerComponent != 8 {
+		return nil, false
+	}
+	switch colorSpaceName(xo) {
+	case "DeviceGray":
+		if len(xo.Data) < w*h {
+			return nil, false
+		}
+		return func(x, y int) (int, int) { return int(xo.Data[y*w+x]), 0 }, true
+	case "DeviceRGB":
+		if len(xo.Data) < w*h*3 {
+			return nil, false
+		}
+		return func(x, y int) (int, int) {
+			p := xo.Data[(y*w+x)*3:]
+			r, g, b := int(p[0]), int(p[1]), int(p[2])
+			return (299*r + 587*g + 114*b) / 1000, max(r, g, b) - min(r, g, b)
+		}, true
+	}
+	return nil, false
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// toBilevel returns xo holding the 1-bit samples of b, unencoded. Stencil
+// masks keep their Decode array.
+func toBilevel(xo semantic.XObject, b bilevel) semantic.XObject {
+	xo.Data = b.samples
+	xo.Filter, xo.DecodeParms, xo.JBIG2Globals = "", nil, nil
+	xo.BitsPerComponent = 1
+	if !xo.ImageMask {
+		xo.ColorSpace = &semantic.DeviceColorSpace{Name: "DeviceGray"}
+	}
+	xo.Dirty = true
+	return xo
+}
+
+// encodeBilevel recompresses a bilevel image with the configured per-image
+// codec. Images that were 1-bit already are only switched when the codec
+// beats the Flate compression they would otherwise be written with.
+func (o *Optimizer) encodeBilevel(xo semantic.XObject, b bilevel) (semantic.XObject, error) {
+	var (
+		data   []byte
+		filter string
+		parms  raw.Dictionary
+		err    error
+	)
+	switch o.config.Bilevel {
+	case BilevelCCITT:
+		data, err = filters.EncodeCCITTFax(b.samples, xo.Width, xo.Height)
+		filter, parms = "CCITTFaxDecode", filters.CCITTFaxParams(xo.Width, xo.Height)
+	case BilevelJBIG2:
+		data, err = filters.EncodeJBIG2(b.samples, xo.Width, xo.Height)
+		filter = "JBIG2Decode"
+	default:
+		return xo, nil
+	}
+	if err != nil {
+		return xo, err
+	}
+	if b.packed && !smallerThanFlate(data, b.samples) {
+		return xo, nil
+	}
+	xo = toBilevel(xo, b)
+	xo.Data, xo.Filter, xo.DecodeParms = data, filter, parms
+	return xo, nil
+}
+
+func smallerThanFlate(data, samples []byte) bool {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(samples); err != nil {
+		return true
+	}
+	if err := w.Close(); err != nil {
+		return true
+	}
+	return len(data) < buf.Len()
+}
+
+// symbolBatch collects the bilevel images of a document for
+// BilevelJBIG2Symbols, which encodes them together once all are known.
+type symbolBatch struct {
+	enc    *filters.JBIG2Encoder
+	images []symbolImage
+	pages  map[raw.ObjectRef]int
+}
+
+// symbolImage is an image of the batch: where it is held and which
+// encoder page holds its samples.
+type symbolImage struct {
+	res  *semantic.Resources
+	name string
+	page int
+	b    bilevel
+}
+
+func newSymbolBatch() *symbolBatch {
+	return &symbolBatch{enc: filters.NewJBIG2Encoder(), pages: make(map[raw.ObjectRef]int)}
+}
+
+// add queues the image name of res. An image shared through its object
+// reference is encoded once.
+func (s *symbolBatch) add(res *semantic.Resources, name string, xo semantic.XObject, b bilevel) error {
+	page, ok := s.pages[xo.OriginalRef]
+	if !ok || xo.OriginalRef.Num == 0 {
+		var err error
+		if page, err = s.enc.AddPage(b.samples, xo.Width, xo.Height); err != nil {
+			return err
+		}
+		if xo.OriginalRef.Num != 0 {
+			s.pages[xo.OriginalRef] = page
+		}
+	}
+	s.images = append(s.images, symbolImage{res: res, name: name, page: page, b: b})
+	return nil
+}
+
+// encode encodes the queued images and stores the results in their
+// resource dictionaries.
+func (s *symbolBatch) encode() error {
+	if len(s.images) == 0 {
+		return nil
+	}
+	globals, pages, err := s.enc.Encode()
+	if err != nil {
+		return err
+	}
+	for _, img := range s.images {
+		xo := img.res.XObjects[img.name]
+		data := pages[img.page]
+		if img.b.packed && !smallerThanFlate(data, img.b.samples) {
+			continue
+		}
+		xo = toBilevel(xo, img.b)
+		xo.Data, xo.Filter, xo.JBIG2Globals = data, "JBIG2Decode", globals
+		img.res.XObjects[img.name] = xo
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package optimize
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/wudi/pdfkit/filters"
+	"github.com/wudi/pdfkit/ir/raw"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// textScan returns 8-bit gray samples of a page of repeated glyphs with
+// scanner noise: ink and paper are not quite black and white, and a few
+// pixels on glyph edges are mid-gray.
+func textScan(width, height int, seed int64) []byte {
+	rng := rand.New(rand.NewSource(seed))
+	pix := make([]byte, width*height)
+	for i := range pix {
+		pix[i] = byte(240 + rng.Intn(16))
+	}
+	glyphs := make([][]bool, 4)
+	for i := range glyphs {
+		g := make([]bool, 6*8)
+		for row := 0; row < 8; row++ {
+			for j, n := 0, 1+rng.Intn(6); j < n; j++ {
+				g[row*6+j] = true
+			}
+		}
+		glyphs[i] = g
+	}
+	for y := 2; y+8 < height; y += 11 {
+		for x := 2; x+6 < width; x += 8 {
+			g := glyphs[rng.Intn(len(glyphs))]
+			for i, on := range g {
+				if on {
+					pix[(y+i/6)*width+x+i%6] = byte(rng.Intn(20))
+				}
+			}
+			if rng.Intn(50) == 0 {
+				pix[y*width+x] = 140
+			}
+		}
+	}
+	return pix
+}
+
+// threshold packs 8-bit gray samples into 1-bit ones.
+func threshold(pix []byte, width, height int) []byte {
+	stride := (width + 7) / 8
+	out := make([]byte, stride*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if pix[y*width+x] >= 128 {
+				out[y*stride+x/8] |= 0x80 >> uint(x%8)
+			}
+		}
+	}
+	return out
+}
+
+func grayImage(pix []byte, width, height int) semantic.XObject {
+	return semantic.XObject{
+		Subtype:          "Image",
+		Width:            width,
+		Height:           height,
+		ColorSpace:       &semantic.DeviceColorSpace{Name: "DeviceGray"},
+		BitsPerComponent: 8,
+		Data:             pix,
+	}
+}
+
+func imageDoc(images ...semantic.XObject) *semantic.Document {
+	doc := &semantic.Document{}
+	for _, xo := range images {
+		doc.Pages = append(doc.Pages, &semantic.Page{
+			Resources: &semantic.Resources{XObjects: map[string]semantic.XObject{"Im1": xo}},
+		})
+	}
+	return doc
+}
+
+func TestOptimizeBilevel_CCITT(t *testing.T) {
+	width, height := 200, 90
+	pix := textScan(width, height, 1)
+	doc := imageDoc(grayImage(pix, width, height))
+	if err := New(Config{Bilevel: BilevelCCITT, NearBilevelTolerance: 0.01}).Optimize(context.Background(), doc); err != nil {
+		t.Fatalf("Optimize failed: %v", err)
+	}
+	xo := doc.Pages[0].Resources.XObjects["Im1"]
+	if xo.Filter != "CCITTFaxDecode" || xo.BitsPerComponent != 1 || !xo.Dirty {
+		t.Fatalf("got Filter %q, BitsPerComponent %d", xo.Filter, xo.BitsPerComponent)
+	}
+	gray, err := filters.NewCCITTFaxDecoder().Decode(context.Background(), xo.Data, xo.DecodeParms)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := threshold(pix, width, height)
+	if !bytes.Equal(threshold(gray, width, height), want) {
+		t.Error("decoded image differs from the thresholded scan")
+	}
+}
+
+func TestOptimizeBilevel_KeepsMidtones(t *testing.T) {
+	width, height := 200, 90
+	pix := textScan(width, height, 2)
+
+	// Without a tolerance the noisy scan is not thresholded.
+	doc := imageDoc(grayImage(pix, width, height))
+	if err := New(Config{Bilevel: BilevelJBIG2}).Optimize(context.Background(), doc); err != nil {
+		t.Fatalf("Optimize failed: %v", err)
+	}
+	if xo := doc.Pages[0].Resources.XObjects["Im1"]; xo.Filter != "" || xo.BitsPerComponent != 8 {
+		t.Errorf("noisy scan was converted: Filter %q", xo.Filter)
+	}
+
+	// A photograph is never bilevel.
+	for i := range pix {
+		pix[i] = byte(i)
+	}
+	doc = imageDoc(grayImage(pix, width, height))
+	if err := New(Config{Bilevel: BilevelJBIG2, NearBilevelTolerance: 0.05}).Optimize(context.Background(), doc); err != nil {
+		t.Fatalf("Optimize failed: %v", err)
+	}
+	if xo := doc.Pages[0].Resources.XObjects["Im1"]; xo.Filter != "" {
+		t.Errorf("photograph was converted: Filter %q", xo.Filter)
+	}
+}
+
+func TestOptimizeBilevel_JBIG2Symbols(t *testing.T) {
+	width, height := 240, 120
+	var images []semantic.XObject
+	var want [][]byte
+	for i := 0; i < 2; i++ {
+		samples := threshold(textScan(width, height, 3), width, height)
+		want = append(want, samples)
+		images = append(images, semantic.XObject{
+			Subtype:          "Image",
+			Width:            width,
+			Height:           height,
+			ColorSpace:       &semantic.DeviceColorSpace{Name: "DeviceGray"},
+			BitsPerComponent: 1,
+			Data:             samples,
+			OriginalRef:      raw.ObjectRef{Num: 10 + i},
+		})
+	}
+	doc := imageDoc(images...)
+	if err := New(Config{Bilevel: BilevelJBIG2Symbols}).Optimize(context.Background(), doc); err != nil {
+		t.Fatalf("Optimize failed: %v", err)
+	}
+	first := doc.Pages[0].Resources.XObjects["Im1"]
+	if len(first.JBIG2Globals) == 0 {
+		t.Fatal("no JBIG2Globals")
+	}
+	for i, p := range doc.Pages {
+		xo := p.Resources.XObjects["Im1"]
+		if xo.Filter != "JBIG2Decode" {
+			t.Fatalf("page %d: got Filter %q", i, xo.Filter)
+		}
+		if !bytes.Equal(xo.JBIG2Globals, first.JBIG2Globals) {
+			t.Fatalf("page %d: JBIG2Globals not shared", i)
+		}
+		parms := raw.Dict()
+		parms.Set(raw.NameLiteral("JBIG2Globals"), raw.NewStream(raw.Dict(), xo.JBIG2Globals))
+		rgba, err := filters.NewJBIG2Decoder().Decode(context.Background(), xo.Data, parms)
+		if err != nil {
+			t.Fatalf("page %d: decode: %v", i, err)
+		}
+		gray := make([]byte, width*height)
+		for j := range gray {
+			gray[j] = rgba[j*4]
+		}
+		if !bytes.Equal(threshold(gray, width, height), want[i]) {
+			t.Errorf("page %d: decoded image differs", i)
+		}
+	}
+}
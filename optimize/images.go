@@ -25,6 +25,10 @@ func (o *Optimizer) optimizeImages(ctx context.Context, doc *semantic.Document)
 
 	// 2. Visit and optimize resources
 	seenRes := make(map[*semantic.Resources]bool)
+	var symbols *symbolBatch
+	if o.config.Bilevel == BilevelJBIG2Symbols {
+		symbols = newSymbolBatch()
+	}
 
 	var visitResources func(res *semantic.Resources) error
 	visitResources = func(res *semantic.Resources) error {
@@ -36,6 +40,19 @@ func (o *Optimizer) optimizeImages(ctx context.Context, doc *semantic.Document)
 		// XObjects
 		for name, xo := range res.XObjects {
 			if xo.Subtype == "Image" {
+				// Bilevel images go to the bilevel codecs rather than JPEG.
+				if b, ok := o.bilevelSamples(xo); ok {
+					var err error
+					if symbols != nil {
+						err = symbols.add(res, name, xo, b)
+					} else {
+						res.XObjects[name], err = o.encodeBilevel(xo, b)
+					}
+					if err != nil {
+						return err
+					}
+					continue
+				}
 				optimized, err := o.processImage(ctx, xo, usageMap)
 				if err != nil {
 					return err
@@ -74,6 +91,9 @@ func (o *Optimizer) optimizeImages(ctx context.Context, doc *semantic.Document)
 			return err
 		}
 	}
+	if symbols != nil {
+		return symbols.encode()
+	}
 
 	return nil
 }
@@ -12,11 +12,14 @@ type Config struct {
 	CombineDuplicateDirectObjects   bool
 	CombineIdenticalIndirectObjects bool
 	CombineDuplicateStreams         bool
-	CompressStreams                 bool
+	CompressStreams                 bool // recompress streams with Flate, PNG predictors for images and xref streams
+	TryAlternatives                 bool // with CompressStreams, try several levels and keep the smallest encoding
 	UseObjectStreams                bool
 	ImageQuality                    int // 0-100, 0 means no change
 	ImageUpperPPI                   float64
 	CleanUnusedResources            bool
+	Bilevel                         BilevelCodec // codec for bilevel images, BilevelNone leaves them alone
+	NearBilevelTolerance            float64      // fraction of mid-tone pixels allowed when thresholding a scan to bilevel
 }
 
 type Optimizer struct {
@@ -28,13 +31,21 @@ func New(config Config) *Optimizer {
 }
 
 func (o *Optimizer) Optimize(ctx context.Context, doc *semantic.Document) error {
+	if err := doc.LoadPages(ctx); err != nil {
+		return err
+	}
+	if dec := doc.Decoded(); dec != nil && dec.Raw != nil {
+		if err := dec.Raw.LoadAll(ctx); err != nil {
+			return err
+		}
+	}
 	if o.config.CleanUnusedResources {
 		if err := o.cleanUnusedResources(ctx, doc); err != nil {
 			return fmt.Errorf("failed to clean unused resources: %w", err)
 		}
 	}
 
-	if o.config.ImageQuality > 0 || o.config.ImageUpperPPI > 0 {
+	if o.config.ImageQuality > 0 || o.config.ImageUpperPPI > 0 || o.config.Bilevel != BilevelNone {
 		if err := o.optimizeImages(ctx, doc); err != nil {
 			return fmt.Errorf("failed to optimize images: %w", err)
 		}
@@ -49,6 +60,17 @@ func (o *Optimizer) Optimize(ctx context.Context, doc *semantic.Document) error
 }
 
 func (o *Optimizer) OptimizeRaw(ctx context.Context, doc *raw.Document) error {
+	// Whole-document passes need every object materialized.
+	if err := doc.LoadAll(ctx); err != nil {
+		return err
+	}
+	// Recompress first so identical streams end up with identical data.
+	if o.config.CompressStreams {
+		if err := o.compressStreams(ctx, doc); err != nil {
+			return fmt.Errorf("failed to compress streams: %w", err)
+		}
+	}
+
 	if o.config.CombineIdenticalIndirectObjects {
 		if err := o.combineObjects(doc, true, true); err != nil {
 			return fmt.Errorf("failed to combine identical indirect objects: %w", err)
@@ -1,53 +1,185 @@
 package optimize
 
 import (
-	"bytes"
-	"compress/zlib"
 	"context"
 
+	"github.com/wudi/pdfkit/filters"
 	"github.com/wudi/pdfkit/ir/raw"
-	"github.com/wudi/pdfkit/ir/semantic"
 )
 
-func (o *Optimizer) compressStreams(ctx context.Context, doc *semantic.Document) error {
-	decodedDoc := doc.Decoded()
-	if decodedDoc == nil || decodedDoc.Raw == nil {
+// recompressible are the filters compressStreams decodes to recompress a
+// stream; streams with others, image codecs among them, are left alone.
+var recompressible = map[string]bool{
+	"FlateDecode":     true,
+	"LZWDecode":       true,
+	"ASCIIHexDecode":  true,
+	"ASCII85Decode":   true,
+	"RunLengthDecode": true,
+}
+
+// compressStreams recompresses the streams of doc with Flate at a level
+// chosen from their size, applying PNG predictors to images and xref
+// streams. A stream keeps its encoding unless the new one is smaller.
+// Encrypted documents are left alone: their stream data is ciphertext.
+func (o *Optimizer) compressStreams(ctx context.Context, doc *raw.Document) error {
+	if doc.Encrypted {
 		return nil
 	}
-
-	for ref, decodedStream := range decodedDoc.Streams {
-		// We want to replace the raw stream content with Flate compressed version of decoded data.
-		rawObj, ok := decodedDoc.Raw.Objects[ref]
+	pipeline := filters.NewPipeline([]filters.Decoder{
+		filters.NewFlateDecoder(),
+		filters.NewLZWDecoder(),
+		filters.NewASCIIHexDecoder(),
+		filters.NewASCII85Decoder(),
+		filters.NewRunLengthDecoder(),
+	}, filters.Limits{})
+	for _, obj := range doc.Objects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		stream, ok := obj.(*raw.StreamObj)
 		if !ok {
 			continue
 		}
-		rawStream, ok := rawObj.(*raw.StreamObj)
-		if !ok {
+		dict := stream.Dictionary()
+		if _, external := dict.Get(raw.NameLiteral("F")); external {
 			continue
 		}
-
-		// Compress decoded data
-		var b bytes.Buffer
-		w := zlib.NewWriter(&b)
-		if _, err := w.Write(decodedStream.Data()); err != nil {
-			w.Close()
-			continue // Skip if compression fails
+		names, params := filters.ExtractFilters(dict)
+		supported := true
+		for _, name := range names {
+			supported = supported && recompressible[name]
 		}
-		w.Close()
-		compressedData := b.Bytes()
-
-		// Update raw stream
-		rawStream.Data = compressedData
-		dict := rawStream.Dictionary()
+		if !supported {
+			continue
+		}
+		data, err := pipeline.Decode(ctx, stream.Data, names, params)
+		if err != nil {
+			continue // leave streams we cannot decode as they are
+		}
+		opts := filters.FlateOptions{Predictor: streamPredictor(doc, dict, len(data)), Exhaustive: o.config.TryAlternatives}
+		compressed, parms, err := filters.EncodeFlate(data, opts)
+		if err != nil || len(compressed) >= len(stream.Data) {
+			continue
+		}
+		stream.Data = compressed
 		dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("FlateDecode"))
-		dict.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(compressedData))))
-
-		// Remove DecodeParms as we are re-encoding with standard Flate
+		dict.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(compressed))))
 		if d, ok := dict.(*raw.DictObj); ok {
 			delete(d.KV, "DecodeParms")
-			delete(d.KV, "F")
-			delete(d.KV, "FDecodeParms")
+		}
+		if parms != nil {
+			dict.Set(raw.NameLiteral("DecodeParms"), parms)
 		}
 	}
 	return nil
 }
+
+// streamPredictor returns the rows of an image or xref stream holding n
+// bytes of data, or nil for other streams and images whose layout is
+// unknown.
+func streamPredictor(doc *raw.Document, dict raw.Dictionary, n int) *filters.PredictorParams {
+	switch dictName(doc, dict, "Type") {
+	case "XRef":
+		w, ok := resolve(doc, dictValue(dict, "W")).(*raw.ArrayObj)
+		if !ok {
+			return nil
+		}
+		cols := 0
+		for _, item := range w.Items {
+			v, ok := resolve(doc, item).(raw.NumberObj)
+			if !ok || v.Int() < 0 {
+				return nil
+			}
+			cols += int(v.Int())
+		}
+		if cols == 0 || n%cols != 0 {
+			return nil
+		}
+		return &filters.PredictorParams{Colors: 1, BitsPerComponent: 8, Columns: cols}
+	}
+	if dictName(doc, dict, "Subtype") != "Image" {
+		return nil
+	}
+	width, height := dictInt(doc, dict, "Width"), dictInt(doc, dict, "Height")
+	p := filters.PredictorParams{Colors: 1, BitsPerComponent: 1, Columns: width}
+	if mask, ok := resolve(doc, dictValue(dict, "ImageMask")).(raw.BoolObj); !ok || !mask.Value() {
+		p.Colors = rawComponents(doc, resolve(doc, dictValue(dict, "ColorSpace")))
+		p.BitsPerComponent = dictInt(doc, dict, "BitsPerComponent")
+	}
+	switch p.BitsPerComponent {
+	case 1, 2, 4, 8, 16:
+	default:
+		return nil
+	}
+	if width <= 0 || height <= 0 || p.Colors == 0 || n != (p.Colors*p.BitsPerComponent*width+7)/8*height {
+		return nil
+	}
+	return &p
+}
+
+// rawComponents returns the number of colour components of the colour
+// space cs, or 0 when it is unknown.
+func rawComponents(doc *raw.Document, cs raw.Object) int {
+	name := ""
+	var arr *raw.ArrayObj
+	switch v := cs.(type) {
+	case raw.Name:
+		name = v.Value()
+	case *raw.ArrayObj:
+		if len(v.Items) == 0 {
+			return 0
+		}
+		n, ok := resolve(doc, v.Items[0]).(raw.Name)
+		if !ok {
+			return 0
+		}
+		name, arr = n.Value(), v
+	}
+	switch name {
+	case "DeviceGray", "CalGray", "Indexed", "Separation":
+		return 1
+	case "DeviceRGB", "CalRGB", "Lab":
+		return 3
+	case "DeviceCMYK":
+		return 4
+	case "DeviceN":
+		if arr != nil && len(arr.Items) > 1 {
+			if names, ok := resolve(doc, arr.Items[1]).(*raw.ArrayObj); ok {
+				return len(names.Items)
+			}
+		}
+	case "ICCBased":
+		if arr != nil && len(arr.Items) > 1 {
+			if profile, ok := resolve(doc, arr.Items[1]).(*raw.StreamObj); ok {
+				return dictInt(doc, profile.Dictionary(), "N")
+			}
+		}
+	}
+	return 0
+}
+
+func resolve(doc *raw.Document, obj raw.Object) raw.Object {
+	if ref, ok := obj.(raw.RefObj); ok {
+		return doc.Objects[ref.Ref()]
+	}
+	return obj
+}
+
+func dictValue(dict raw.Dictionary, key string) raw.Object {
+	v, _ := dict.Get(raw.NameLiteral(key))
+	return v
+}
+
+func dictName(doc *raw.Document, dict raw.Dictionary, key string) string {
+	if n, ok := resolve(doc, dictValue(dict, key)).(raw.Name); ok {
+		return n.Value()
+	}
+	return ""
+}
+
+func dictInt(doc *raw.Document, dict raw.Dictionary, key string) int {
+	if n, ok := resolve(doc, dictValue(dict, key)).(raw.NumberObj); ok {
+		return int(n.Int())
+	}
+	return 0
+}
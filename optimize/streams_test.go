@@ -0,0 +1,86 @@
+package optimize
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/wudi/pdfkit/filters"
+	"github.com/wudi/pdfkit/ir/raw"
+)
+
+func decodeRawStream(t *testing.T, s *raw.StreamObj) []byte {
+	t.Helper()
+	names, params := filters.ExtractFilters(s.Dictionary())
+	out, err := filters.NewPipeline([]filters.Decoder{filters.NewFlateDecoder()}, filters.Limits{}).Decode(context.Background(), s.Data, names, params)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return out
+}
+
+func TestCompressStreams(t *testing.T) {
+	const size = 48
+	pixels := make([]byte, size*size*3)
+	for i := range pixels {
+		pixels[i] = byte(i/3%size*2 + i/(3*size))
+	}
+	imgDict := raw.Dict()
+	imgDict.Set(raw.NameLiteral("Subtype"), raw.NameLiteral("Image"))
+	imgDict.Set(raw.NameLiteral("Width"), raw.NumberInt(size))
+	imgDict.Set(raw.NameLiteral("Height"), raw.NumberInt(size))
+	imgDict.Set(raw.NameLiteral("BitsPerComponent"), raw.NumberInt(8))
+	imgDict.Set(raw.NameLiteral("ColorSpace"), raw.Ref(4, 0))
+	image := raw.NewStream(imgDict, pixels)
+
+	text := bytes.Repeat([]byte("0 0 m 10 10 l S\n"), 40)
+	content := raw.NewStream(raw.Dict(), text)
+
+	jpegDict := raw.Dict()
+	jpegDict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("DCTDecode"))
+	jpeg := raw.NewStream(jpegDict, bytes.Repeat([]byte{0xFF}, 100))
+
+	doc := &raw.Document{Objects: map[raw.ObjectRef]raw.Object{
+		{Num: 1}: image,
+		{Num: 2}: content,
+		{Num: 3}: jpeg,
+		{Num: 4}: raw.NameLiteral("DeviceRGB"),
+	}}
+	if err := New(Config{CompressStreams: true}).OptimizeRaw(context.Background(), doc); err != nil {
+		t.Fatalf("OptimizeRaw failed: %v", err)
+	}
+
+	parms, ok := image.Dictionary().Get(raw.NameLiteral("DecodeParms"))
+	if !ok {
+		t.Fatal("image was compressed without a predictor")
+	}
+	if cols, _ := parms.(raw.Dictionary).Get(raw.NameLiteral("Columns")); cols.(raw.NumberObj).Int() != size {
+		t.Errorf("predictor Columns %v, want %d", cols, size)
+	}
+	if got := decodeRawStream(t, image); !bytes.Equal(got, pixels) {
+		t.Error("image data differs after recompression")
+	}
+
+	if _, ok := content.Dictionary().Get(raw.NameLiteral("DecodeParms")); ok {
+		t.Error("content stream was given a predictor")
+	}
+	if got := decodeRawStream(t, content); !bytes.Equal(got, text) {
+		t.Error("content stream differs after recompression")
+	}
+
+	if f, _ := jpeg.Dictionary().Get(raw.NameLiteral("Filter")); f.(raw.Name).Value() != "DCTDecode" || len(jpeg.Data) != 100 {
+		t.Error("DCT stream was recompressed")
+	}
+}
+
+func TestCompressStreams_SkipsEncrypted(t *testing.T) {
+	data := bytes.Repeat([]byte("ciphertext"), 20)
+	stream := raw.NewStream(raw.Dict(), data)
+	doc := &raw.Document{Objects: map[raw.ObjectRef]raw.Object{{Num: 1}: stream}, Encrypted: true}
+	if err := New(Config{CompressStreams: true}).OptimizeRaw(context.Background(), doc); err != nil {
+		t.Fatalf("OptimizeRaw failed: %v", err)
+	}
+	if _, ok := stream.Dictionary().Get(raw.NameLiteral("Filter")); ok || !bytes.Equal(stream.Data, data) {
+		t.Error("stream of an encrypted document was recompressed")
+	}
+}
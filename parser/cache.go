@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/wudi/pdfkit/ir/raw"
+)
+
+// DefaultCacheSize is the number of objects kept by the LRU cache that lazy
+// parsing installs when Config.Cache is nil.
+const DefaultCacheSize = 1024
+
+// LRUCache is a Cache bounded to a fixed number of objects, evicting the
+// least recently used entry when full. It is safe for concurrent use.
+type LRUCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[raw.ObjectRef]*list.Element
+}
+
+type lruEntry struct {
+	ref raw.ObjectRef
+	obj raw.Object
+}
+
+// NewLRUCache returns a cache holding at most size objects. A size <= 0 uses
+// DefaultCacheSize.
+func NewLRUCache(size int) *LRUCache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &LRUCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[raw.ObjectRef]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(ref raw.ObjectRef) (raw.Object, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[ref]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry).obj, true
+}
+
+func (c *LRUCache) Put(ref raw.ObjectRef, obj raw.Object) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[ref]; ok {
+		el.Value.(*lruEntry).obj = obj
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[ref] = c.order.PushFront(&lruEntry{ref: ref, obj: obj})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).ref)
+	}
+}
+
+// Len reports the number of cached objects.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,36 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/wudi/pdfkit/ir/raw"
+)
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRUCache(2)
+	r1, r2, r3 := raw.ObjectRef{Num: 1}, raw.ObjectRef{Num: 2}, raw.ObjectRef{Num: 3}
+	c.Put(r1, raw.NumberInt(1))
+	c.Put(r2, raw.NumberInt(2))
+	// Touch 1 so that 2 becomes the eviction candidate.
+	if _, ok := c.Get(r1); !ok {
+		t.Fatalf("expected object 1 cached")
+	}
+	c.Put(r3, raw.NumberInt(3))
+
+	if c.Len() != 2 {
+		t.Fatalf("expected 2 entries, got %d", c.Len())
+	}
+	if _, ok := c.Get(r2); ok {
+		t.Fatalf("expected object 2 evicted")
+	}
+	for _, ref := range []raw.ObjectRef{r1, r3} {
+		if _, ok := c.Get(ref); !ok {
+			t.Fatalf("expected %v cached", ref)
+		}
+	}
+
+	c.Put(r1, raw.NumberInt(10))
+	if obj, _ := c.Get(r1); obj.(raw.NumberObj).Int() != 10 {
+		t.Fatalf("expected updated value, got %v", obj)
+	}
+}
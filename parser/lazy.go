@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"context"
+
+	"github.com/wudi/pdfkit/ir/raw"
+	"github.com/wudi/pdfkit/xref"
+)
+
+// lazyObjStreams is how many decoded object streams a lazy loader retains.
+// Objects taken from them still land in the LRU cache; this only bounds the
+// memory held by whole decoded streams.
+const lazyObjStreams = 4
+
+// lazySource backs raw.Document.Source for lazily parsed documents.
+type lazySource struct {
+	loader ObjectLoader
+	table  xref.Table
+}
+
+func (s *lazySource) Load(ctx context.Context, ref raw.ObjectRef) (raw.Object, error) {
+	return s.loader.Load(ctx, ref)
+}
+
+func (s *lazySource) Refs() []raw.ObjectRef { return tableRefs(s.table) }
+
+// tableRefs lists the in-use objects of an xref table, including objects
+// stored in object streams.
+func tableRefs(table xref.Table) []raw.ObjectRef {
+	var refs []raw.ObjectRef
+	for _, objNum := range table.Objects() {
+		if objNum == 0 {
+			continue // free head entry
+		}
+		_, gen, found := table.Lookup(objNum)
+		if !found {
+			if _, _, ok := table.ObjStream(objNum); !ok {
+				continue
+			}
+			gen = 0
+		}
+		refs = append(refs, raw.ObjectRef{Num: objNum, Gen: gen})
+	}
+	return refs
+}
@@ -35,6 +35,9 @@ type ObjectLoaderBuilder struct {
 	limits    security.Limits
 	cache     Cache
 	recovery  recovery.Strategy
+	// maxObjStreams bounds the decoded object streams kept by the loader;
+	// zero keeps all of them.
+	maxObjStreams int
 }
 
 func (b *ObjectLoaderBuilder) WithXRef(table xref.Table) *ObjectLoaderBuilder {
@@ -71,28 +74,30 @@ func (b *ObjectLoaderBuilder) Build() (ObjectLoader, error) {
 		}
 	}
 	return &objectLoader{
-		reader:    b.reader,
-		xrefTable: b.xrefTable,
-		scanner:   b.scanner,
-		security:  sec,
-		maxDepth:  maxDepth,
-		limits:    b.limits,
-		cache:     b.cache,
-		recovery:  b.recovery,
+		reader:        b.reader,
+		xrefTable:     b.xrefTable,
+		scanner:       b.scanner,
+		security:      sec,
+		maxDepth:      maxDepth,
+		limits:        b.limits,
+		cache:         b.cache,
+		recovery:      b.recovery,
+		maxObjStreams: b.maxObjStreams,
 	}, nil
 }
 
 type objectLoader struct {
-	reader    io.ReaderAt
-	xrefTable xref.Table
-	scanner   scanner.Scanner
-	security  security.Handler
-	maxDepth  int
-	limits    security.Limits
-	cache     Cache
-	recovery  recovery.Strategy
-	mu        sync.Mutex
-	objstm    map[int]map[int]raw.Object
+	reader        io.ReaderAt
+	xrefTable     xref.Table
+	scanner       scanner.Scanner
+	security      security.Handler
+	maxDepth      int
+	limits        security.Limits
+	cache         Cache
+	recovery      recovery.Strategy
+	mu            sync.Mutex
+	objstm        map[int]map[int]raw.Object
+	maxObjStreams int
 }
 
 func (o *objectLoader) Load(ctx context.Context, ref raw.ObjectRef) (raw.Object, error) {
@@ -119,6 +124,9 @@ func (o *objectLoader) LoadIndirect(ctx context.Context, ref raw.ObjectRef, dept
 	return o.Load(ctx, ref)
 }
 
+// loadOnce reads ref from the file. Loads are serialised on mu because they
+// share the scanner's read position and the decoded object streams; cache
+// hits in Load do not take the lock.
 func (o *objectLoader) loadOnce(ctx context.Context, ref raw.ObjectRef) (raw.Object, error) {
 	o.mu.Lock()
 	defer o.mu.Unlock()
@@ -303,6 +311,12 @@ func (o *objectLoader) loadFromObjectStream(ctx context.Context, ref raw.ObjectR
 		}
 		objs[objNum] = obj
 	}
+	if o.maxObjStreams > 0 && len(o.objstm) >= o.maxObjStreams {
+		for num := range o.objstm {
+			delete(o.objstm, num)
+			break
+		}
+	}
 	o.objstm[objStreamNum] = objs
 	if obj, ok := objs[ref.Num]; ok {
 		return obj, nil
@@ -477,6 +491,9 @@ func isEncryptDictionary(d *raw.DictObj) bool {
 	if !ok {
 		return false
 	}
+	if name, ok := filter.(raw.NameObj); ok && name.Value() == "Adobe.PubSec" {
+		return true
+	}
 	if name, ok := filter.(raw.NameObj); ok && name.Value() == "Standard" {
 		if _, hasO := d.Get(raw.NameLiteral("O")); hasO {
 			if _, hasU := d.Get(raw.NameLiteral("U")); hasU {
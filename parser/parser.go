@@ -2,6 +2,8 @@ package parser
 
 import (
 	"context"
+	"crypto"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
@@ -24,6 +26,17 @@ type Config struct {
 	Limits      security.Limits
 	Cache       Cache
 	Password    string
+	// Certificate and PrivateKey open documents encrypted for recipients
+	// with the public-key security handler.
+	Certificate *x509.Certificate
+	PrivateKey  crypto.Decrypter
+	// Lazy leaves raw.Document.Objects empty and resolves objects through
+	// the loader on first access. Unless Cache is set, loaded objects are
+	// kept in an LRU cache of CacheSize entries. Semantic pages built from
+	// a lazy document defer their Resources and Contents until
+	// semantic.Page.Load or Document.LoadPages is called.
+	Lazy      bool
+	CacheSize int
 }
 
 // DocumentParser builds a raw.Document using xref tables/streams and the object loader.
@@ -46,6 +59,20 @@ func (p *DocumentParser) SetPassword(pwd string) {
 	p.cfg.Password = pwd
 }
 
+// SetCredentials updates the recipient certificate and key used to decrypt
+// public-key encrypted PDFs.
+func (p *DocumentParser) SetCredentials(cert *x509.Certificate, key crypto.Decrypter) {
+	p.cfg.Certificate = cert
+	p.cfg.PrivateKey = key
+}
+
+// SetLazy toggles on-demand object loading; cacheSize bounds the LRU cache
+// used when no Cache is configured (<= 0 selects DefaultCacheSize).
+func (p *DocumentParser) SetLazy(lazy bool, cacheSize int) {
+	p.cfg.Lazy = lazy
+	p.cfg.CacheSize = cacheSize
+}
+
 func (p *DocumentParser) Parse(ctx context.Context, r io.ReaderAt) (*raw.Document, error) {
 	resolver := xref.NewResolver(p.cfg.XRef)
 	table, err := resolver.Resolve(ctx, r)
@@ -67,6 +94,12 @@ func (p *DocumentParser) Parse(ctx context.Context, r io.ReaderAt) (*raw.Documen
 		cache:     p.cfg.Cache,
 		recovery:  p.cfg.Recovery,
 	}
+	if p.cfg.Lazy {
+		if builder.cache == nil {
+			builder.cache = NewLRUCache(p.cfg.CacheSize)
+		}
+		builder.maxObjStreams = lazyObjStreams
+	}
 	loader, err := builder.Build()
 	if err != nil {
 		return nil, err
@@ -111,25 +144,16 @@ func (p *DocumentParser) Parse(ctx context.Context, r io.ReaderAt) (*raw.Documen
 		}
 	}
 
-	for _, objNum := range table.Objects() {
-		if objNum == 0 {
-			continue // free head entry
-		}
-		_, gen, found := table.Lookup(objNum)
-		if !found {
-			if _, _, ok := table.ObjStream(objNum); ok {
-				gen = 0
-				found = true
-			} else {
-				continue
+	if p.cfg.Lazy {
+		doc.Source = &lazySource{loader: loader, table: table}
+	} else {
+		for _, ref := range tableRefs(table) {
+			obj, err := loader.Load(ctx, ref)
+			if err != nil {
+				return nil, fmt.Errorf("load object %d: %w", ref.Num, err)
 			}
+			doc.Objects[ref] = obj
 		}
-		ref := raw.ObjectRef{Num: objNum, Gen: gen}
-		obj, err := loader.Load(ctx, ref)
-		if err != nil {
-			return nil, fmt.Errorf("load object %d: %w", objNum, err)
-		}
-		doc.Objects[ref] = obj
 	}
 
 	if doc.Trailer != nil {
@@ -182,7 +206,7 @@ func (p *DocumentParser) selectSecurity(ctx context.Context, r io.ReaderAt, tabl
 		return security.NoopHandler(), nil
 	}
 	fileID := fileIDFromTrailer(trailerDict)
-	handler, err := (&security.HandlerBuilder{}).WithEncryptDict(encDict).WithTrailer(trailerDict).WithFileID(fileID).Build()
+	handler, err := (&security.HandlerBuilder{}).WithEncryptDict(encDict).WithTrailer(trailerDict).WithFileID(fileID).WithCredentials(p.cfg.Certificate, p.cfg.PrivateKey).Build()
 	if err != nil {
 		return nil, err
 	}
@@ -64,6 +64,48 @@ func TestDocumentParserFollowsPrevChain(t *testing.T) {
 	}
 }
 
+func TestDocumentParserLazyLoading(t *testing.T) {
+	data := buildIncrementalPDF()
+	cache := NewLRUCache(1)
+	p := NewDocumentParser(Config{Lazy: true, Cache: cache})
+
+	doc, err := p.Parse(context.Background(), bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if !doc.Lazy() {
+		t.Fatalf("expected lazy document")
+	}
+	if len(doc.Objects) != 0 {
+		t.Fatalf("expected no materialized objects, got %d", len(doc.Objects))
+	}
+	refs := doc.Refs()
+	if len(refs) != 3 {
+		t.Fatalf("expected 3 refs, got %v", refs)
+	}
+
+	obj, ok := doc.Get(raw.ObjectRef{Num: 2, Gen: 0})
+	if !ok {
+		t.Fatalf("object 2 not resolved")
+	}
+	if count, _ := obj.(*raw.DictObj).Get(raw.NameObj{Val: "Count"}); count.(raw.NumberObj).Int() != 2 {
+		t.Fatalf("expected updated Count 2, got %#v", count)
+	}
+	if _, ok := cache.Get(raw.ObjectRef{Num: 2, Gen: 0}); !ok {
+		t.Fatalf("expected resolved object cached")
+	}
+	if _, ok := doc.Get(raw.ObjectRef{Num: 99, Gen: 0}); ok {
+		t.Fatalf("expected missing object to fail")
+	}
+
+	if err := doc.LoadAll(context.Background()); err != nil {
+		t.Fatalf("load all: %v", err)
+	}
+	if doc.Lazy() || len(doc.Objects) != 3 {
+		t.Fatalf("expected 3 materialized objects, got %d (lazy=%v)", len(doc.Objects), doc.Lazy())
+	}
+}
+
 func TestDocumentParserPDFA3bFixture(t *testing.T) {
 	path := "../testdata/pdfa-3b-with-embedded-file.pdf"
 	f, err := os.Open(path)
@@ -0,0 +1,256 @@
+package render
+
+import (
+	"math"
+	"sync"
+
+	"github.com/wudi/pdfkit/cmm"
+	"github.com/wudi/pdfkit/function"
+	"github.com/wudi/pdfkit/internal/pdfnum"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// rgb is a straight (non-premultiplied) colour with components in [0,1].
+type rgb struct{ R, G, B float64 }
+
+var (
+	deviceGray = semantic.DeviceColorSpace{Name: "DeviceGray"}
+	deviceRGB  = semantic.DeviceColorSpace{Name: "DeviceRGB"}
+	deviceCMYK = semantic.DeviceColorSpace{Name: "DeviceCMYK"}
+)
+
+// canonicalName maps abbreviated inline-image names to full names.
+func canonicalName(name string) string {
+	switch name {
+	case "G":
+		return "DeviceGray"
+	case "RGB":
+		return "DeviceRGB"
+	case "CMYK":
+		return "DeviceCMYK"
+	case "I":
+		return "Indexed"
+	}
+	return name
+}
+
+// numComponents reports how many operands a colour in cs takes.
+func numComponents(cs semantic.ColorSpace) int {
+	switch c := cs.(type) {
+	case nil:
+		return 1
+	case *semantic.ICCBasedColorSpace:
+		if c.N > 0 {
+			return c.N
+		}
+		if c.Alternate != nil {
+			return numComponents(c.Alternate)
+		}
+		return 3
+	case *semantic.IndexedColorSpace, *semantic.SeparationColorSpace:
+		return 1
+	case *semantic.DeviceNColorSpace:
+		return len(c.Names)
+	case *semantic.PatternColorSpace:
+		if c.Underlying != nil {
+			return numComponents(c.Underlying)
+		}
+		return 0
+	}
+	switch canonicalName(cs.ColorSpaceName()) {
+	case "DeviceRGB", "CalRGB", "Lab":
+		return 3
+	case "DeviceCMYK":
+		return 4
+	case "Pattern":
+		return 0
+	}
+	return 1
+}
+
+// initialColor returns the colour selected when cs becomes current.
+func initialColor(cs semantic.ColorSpace) []float64 {
+	switch c := cs.(type) {
+	case *semantic.SeparationColorSpace:
+		return []float64{1}
+	case *semantic.DeviceNColorSpace:
+		out := make([]float64, len(c.Names))
+		for i := range out {
+			out[i] = 1
+		}
+		return out
+	}
+	if cs != nil && canonicalName(cs.ColorSpaceName()) == "DeviceCMYK" {
+		return []float64{0, 0, 0, 1}
+	}
+	return make([]float64, numComponents(cs))
+}
+
+var iccCache sync.Map // *semantic.ICCBasedColorSpace -> cmm.Transform
+
+// iccTransform returns the conversion of an ICC-based colour space to sRGB,
+// or nil when its profile is unusable. Device colour spaces are sampled
+// into a grid once so that images convert quickly.
+func iccTransform(cs *semantic.ICCBasedColorSpace) cmm.Transform {
+	if cached, ok := iccCache.Load(cs); ok {
+		t, _ := cached.(cmm.Transform)
+		return t
+	}
+	var t cmm.Transform
+	if p, err := cmm.NewICCProfile(cs.Profile); err == nil {
+		opts := cmm.TransformOptions{Intent: cmm.IntentRelativeColorimetric, BlackPointCompensation: true}
+		if pipe, err := cmm.NewFactory().NewChainTransform([]cmm.Profile{p, cmm.SRGBProfile()}, opts); err == nil {
+			t = pipe
+			if n := numComponents(cs); n <= 4 && p.ColorSpace() != "Lab " && p.ColorSpace() != "XYZ " {
+				if cached, err := cmm.NewCachedTransform(pipe, n, 3, 0); err == nil {
+					t = cached
+				}
+			}
+		}
+	}
+	iccCache.Store(cs, t)
+	return t
+}
+
+// toRGB converts a colour in cs to RGB. The second result is false when the
+// colour paints nothing (the Separation /None colorant).
+func toRGB(cs semantic.ColorSpace, v []float64) (rgb, bool) {
+	comp := func(i int) float64 {
+		if i < len(v) {
+			return v[i]
+		}
+		return 0
+	}
+	switch c := cs.(type) {
+	case nil:
+		g := pdfnum.Clamp01(comp(0))
+		return rgb{g, g, g}, true
+	case *semantic.ICCBasedColorSpace:
+		if t := iccTransform(c); t != nil && len(v) >= numComponents(c) {
+			if out, err := t.Convert(v[:numComponents(c)]); err == nil && len(out) == 3 {
+				return rgb{pdfnum.Clamp01(out[0]), pdfnum.Clamp01(out[1]), pdfnum.Clamp01(out[2])}, true
+			}
+		}
+		if c.Alternate != nil {
+			return toRGB(c.Alternate, v)
+		}
+		switch numComponents(c) {
+		case 1:
+			return toRGB(deviceGray, v)
+		case 4:
+			return toRGB(deviceCMYK, v)
+		}
+		return toRGB(deviceRGB, v)
+	case *semantic.IndexedColorSpace:
+		n := numComponents(c.Base)
+		idx := int(math.Round(comp(0)))
+		if idx < 0 {
+			idx = 0
+		}
+		if idx > c.Hival {
+			idx = c.Hival
+		}
+		base := make([]float64, n)
+		for i := 0; i < n; i++ {
+			if off := idx*n + i; off < len(c.Lookup) {
+				base[i] = float64(c.Lookup[off]) / 255
+			}
+		}
+		if _, isLab := c.Base.(semantic.DeviceColorSpace); isLab && c.Base.ColorSpaceName() == "Lab" {
+			// Lab lookups are encoded over the default ranges.
+			base[0] *= 100
+			base[1] = base[1]*200 - 100
+			base[2] = base[2]*200 - 100
+		}
+		return toRGB(c.Base, base)
+	case *semantic.SeparationColorSpace:
+		switch c.Name {
+		case "None":
+			return rgb{}, false
+		case "All":
+			g := 1 - pdfnum.Clamp01(comp(0))
+			return rgb{g, g, g}, true
+		}
+		return tint(c.Alternate, c.TintTransform, v)
+	case *semantic.DeviceNColorSpace:
+		return tint(c.Alternate, c.TintTransform, v)
+	case *semantic.PatternColorSpace:
+		if c.Underlying != nil {
+			return toRGB(c.Underlying, v)
+		}
+		return rgb{}, true
+	}
+
+	switch canonicalName(cs.ColorSpaceName()) {
+	case "DeviceRGB", "CalRGB":
+		return rgb{pdfnum.Clamp01(comp(0)), pdfnum.Clamp01(comp(1)), pdfnum.Clamp01(comp(2))}, true
+	case "DeviceCMYK":
+		cc, m, y, k := pdfnum.Clamp01(comp(0)), pdfnum.Clamp01(comp(1)), pdfnum.Clamp01(comp(2)), pdfnum.Clamp01(comp(3))
+		return rgb{(1 - cc) * (1 - k), (1 - m) * (1 - k), (1 - y) * (1 - k)}, true
+	case "Lab":
+		return labToRGB(comp(0), comp(1), comp(2)), true
+	}
+	g := pdfnum.Clamp01(comp(0))
+	return rgb{g, g, g}, true
+}
+
+func tint(alt semantic.ColorSpace, fn semantic.Function, v []float64) (rgb, bool) {
+	if fn == nil {
+		g := 1 - pdfnum.Clamp01(avg(v))
+		return rgb{g, g, g}, true
+	}
+	out := evalFunction(fn, v)
+	if alt == nil {
+		alt = deviceGray
+	}
+	return toRGB(alt, out)
+}
+
+// evalFunction evaluates fn, returning nil when it cannot be evaluated.
+func evalFunction(fn semantic.Function, in []float64) []float64 {
+	out, err := function.Eval(fn, in)
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func avg(v []float64) float64 {
+	if len(v) == 0 {
+		return 0
+	}
+	var s float64
+	for _, x := range v {
+		s += x
+	}
+	return s / float64(len(v))
+}
+
+// labToRGB converts CIE L*a*b* (D50 white point) to sRGB.
+func labToRGB(l, a, b float64) rgb {
+	fy := (l + 16) / 116
+	fx := fy + a/500
+	fz := fy - b/200
+	finv := func(t float64) float64 {
+		if t > 6.0/29 {
+			return t * t * t
+		}
+		return 3 * (6.0 / 29) * (6.0 / 29) * (t - 4.0/29)
+	}
+	x := 0.9642 * finv(fx)
+	y := 1.0 * finv(fy)
+	z := 0.8249 * finv(fz)
+	// Bradford-adapted D50 XYZ to linear sRGB.
+	r := 3.1339*x - 1.6169*y - 0.4906*z
+	g := -0.9785*x + 1.9160*y + 0.0334*z
+	bl := 0.0720*x - 0.2290*y + 1.4057*z
+	return rgb{srgbGamma(r), srgbGamma(g), srgbGamma(bl)}
+}
+
+func srgbGamma(v float64) float64 {
+	v = pdfnum.Clamp01(v)
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
@@ -0,0 +1,265 @@
+package render
+
+import (
+	"image"
+	"math"
+)
+
+// blendMode is a PDF blend mode (ExtGState /BM).
+type blendMode int
+
+const (
+	blendNormal blendMode = iota
+	blendMultiply
+	blendScreen
+	blendOverlay
+	blendDarken
+	blendLighten
+	blendColorDodge
+	blendColorBurn
+	blendHardLight
+	blendSoftLight
+	blendDifference
+	blendExclusion
+	blendHue
+	blendSaturation
+	blendColor
+	blendLuminosity
+)
+
+var blendModes = map[string]blendMode{
+	"Normal":     blendNormal,
+	"Compatible": blendNormal,
+	"Multiply":   blendMultiply,
+	"Screen":     blendScreen,
+	"Overlay":    blendOverlay,
+	"Darken":     blendDarken,
+	"Lighten":    blendLighten,
+	"ColorDodge": blendColorDodge,
+	"ColorBurn":  blendColorBurn,
+	"HardLight":  blendHardLight,
+	"SoftLight":  blendSoftLight,
+	"Difference": blendDifference,
+	"Exclusion":  blendExclusion,
+	"Hue":        blendHue,
+	"Saturation": blendSaturation,
+	"Color":      blendColor,
+	"Luminosity": blendLuminosity,
+}
+
+func parseBlendMode(name string) blendMode {
+	return blendModes[name] // unknown modes fall back to Normal
+}
+
+// source yields the straight colour and alpha painted at a device pixel.
+type source interface {
+	at(x, y int) (rgb, float64)
+}
+
+type solid struct{ c rgb }
+
+func (s solid) at(int, int) (rgb, float64) { return s.c, 1 }
+
+// layerSource reads a premultiplied layer as a source.
+type layerSource struct{ img *image.RGBA }
+
+func (l layerSource) at(x, y int) (rgb, float64) {
+	if !(image.Point{x, y}.In(l.img.Rect)) {
+		return rgb{}, 0
+	}
+	i := l.img.PixOffset(x, y)
+	a := float64(l.img.Pix[i+3]) / 255
+	if a == 0 {
+		return rgb{}, 0
+	}
+	return rgb{
+		float64(l.img.Pix[i]) / 255 / a,
+		float64(l.img.Pix[i+1]) / 255 / a,
+		float64(l.img.Pix[i+2]) / 255 / a,
+	}, a
+}
+
+// composite paints src through mask with constant alpha using the current
+// blend mode and soft mask. The destination is premultiplied RGBA.
+func (it *interp) composite(mask *image.Alpha, src source, alpha float64) {
+	dst := it.dst
+	rect := mask.Rect.Intersect(dst.Rect)
+	sm := it.gs.softMask
+	if sm != nil {
+		rect = rect.Intersect(sm.Rect)
+	}
+	if rect.Empty() || alpha <= 0 {
+		return
+	}
+	mode := it.gs.blend
+	s, isSolid := src.(solid)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		mi := mask.PixOffset(rect.Min.X, y)
+		di := dst.PixOffset(rect.Min.X, y)
+		si := 0
+		if sm != nil {
+			si = sm.PixOffset(rect.Min.X, y)
+		}
+		for x := rect.Min.X; x < rect.Max.X; x, mi, di, si = x+1, mi+1, di+4, si+1 {
+			cov := mask.Pix[mi]
+			if cov == 0 {
+				continue
+			}
+			as := float64(cov) / 255 * alpha
+			if sm != nil {
+				as *= float64(sm.Pix[si]) / 255
+			}
+			c := s.c
+			if !isSolid {
+				var a float64
+				c, a = src.at(x, y)
+				as *= a
+			}
+			if as <= 0 {
+				continue
+			}
+			px := dst.Pix[di : di+4 : di+4]
+			da := float64(px[3]) / 255
+			dr, dg, db := float64(px[0])/255, float64(px[1])/255, float64(px[2])/255
+			if mode != blendNormal && da > 0 {
+				cb := rgb{dr / da, dg / da, db / da}
+				bl := blend(mode, cb, c)
+				c = rgb{
+					(1-da)*c.R + da*bl.R,
+					(1-da)*c.G + da*bl.G,
+					(1-da)*c.B + da*bl.B,
+				}
+			}
+			px[0] = to8(dr*(1-as) + c.R*as)
+			px[1] = to8(dg*(1-as) + c.G*as)
+			px[2] = to8(db*(1-as) + c.B*as)
+			px[3] = to8(da + as - da*as)
+		}
+	}
+}
+
+func to8(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 1 {
+		return 255
+	}
+	return uint8(v*255 + 0.5)
+}
+
+// blend computes B(cb, cs) for the given mode.
+func blend(mode blendMode, cb, cs rgb) rgb {
+	switch mode {
+	case blendHue:
+		return setLum(setSat(cs, sat(cb)), lum(cb))
+	case blendSaturation:
+		return setLum(setSat(cb, sat(cs)), lum(cb))
+	case blendColor:
+		return setLum(cs, lum(cb))
+	case blendLuminosity:
+		return setLum(cb, lum(cs))
+	}
+	return rgb{
+		blendChannel(mode, cb.R, cs.R),
+		blendChannel(mode, cb.G, cs.G),
+		blendChannel(mode, cb.B, cs.B),
+	}
+}
+
+func blendChannel(mode blendMode, cb, cs float64) float64 {
+	switch mode {
+	case blendMultiply:
+		return cb * cs
+	case blendScreen:
+		return cb + cs - cb*cs
+	case blendOverlay:
+		return blendChannel(blendHardLight, cs, cb)
+	case blendDarken:
+		return math.Min(cb, cs)
+	case blendLighten:
+		return math.Max(cb, cs)
+	case blendColorDodge:
+		if cb == 0 {
+			return 0
+		}
+		if cs >= 1 {
+			return 1
+		}
+		return math.Min(1, cb/(1-cs))
+	case blendColorBurn:
+		if cb >= 1 {
+			return 1
+		}
+		if cs <= 0 {
+			return 0
+		}
+		return 1 - math.Min(1, (1-cb)/cs)
+	case blendHardLight:
+		if cs <= 0.5 {
+			return cb * 2 * cs
+		}
+		return blendChannel(blendScreen, cb, 2*cs-1)
+	case blendSoftLight:
+		if cs <= 0.5 {
+			return cb - (1-2*cs)*cb*(1-cb)
+		}
+		var d float64
+		if cb <= 0.25 {
+			d = ((16*cb-12)*cb + 4) * cb
+		} else {
+			d = math.Sqrt(cb)
+		}
+		return cb + (2*cs-1)*(d-cb)
+	case blendDifference:
+		return math.Abs(cb - cs)
+	case blendExclusion:
+		return cb + cs - 2*cb*cs
+	}
+	return cs
+}
+
+func lum(c rgb) float64 { return 0.3*c.R + 0.59*c.G + 0.11*c.B }
+
+func clipColor(c rgb) rgb {
+	l := lum(c)
+	n := math.Min(c.R, math.Min(c.G, c.B))
+	x := math.Max(c.R, math.Max(c.G, c.B))
+	if n < 0 {
+		c = rgb{l + (c.R-l)*l/(l-n), l + (c.G-l)*l/(l-n), l + (c.B-l)*l/(l-n)}
+	}
+	if x > 1 {
+		c = rgb{l + (c.R-l)*(1-l)/(x-l), l + (c.G-l)*(1-l)/(x-l), l + (c.B-l)*(1-l)/(x-l)}
+	}
+	return c
+}
+
+func setLum(c rgb, l float64) rgb {
+	d := l - lum(c)
+	return clipColor(rgb{c.R + d, c.G + d, c.B + d})
+}
+
+func sat(c rgb) float64 {
+	return math.Max(c.R, math.Max(c.G, c.B)) - math.Min(c.R, math.Min(c.G, c.B))
+}
+
+func setSat(c rgb, s float64) rgb {
+	v := [3]float64{c.R, c.G, c.B}
+	// Order the channels as min, mid, max.
+	imin, imid, imax := 0, 1, 2
+	if v[imin] > v[imid] {
+		imin, imid = imid, imin
+	}
+	if v[imid] > v[imax] {
+		imid, imax = imax, imid
+	}
+	if v[imin] > v[imid] {
+		imin, imid = imid, imin
+	}
+	var out [3]float64
+	if v[imax] > v[imin] {
+		out[imid] = (v[imid] - v[imin]) * s / (v[imax] - v[imin])
+		out[imax] = s
+	}
+	return rgb{out[0], out[1], out[2]}
+}
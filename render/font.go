@@ -0,0 +1,769 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/goregular"
+
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/coords"
+	"github.com/wudi/pdfkit/fonts"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// fontFace resolves character codes of a PDF font to glyph outlines and
+// advance widths.
+type fontFace struct {
+	font *semantic.Font
+
+	program     fonts.OutlineFont
+	embedded    bool          // program is the font's own rather than a substitute
+	glyphMatrix coords.Matrix // glyph space to text space
+	type3       bool
+
+	// Simple fonts.
+	gids  [256]int
+	names [256]string
+
+	// Composite (Type 0) fonts.
+	composite bool
+	cmap      *cmap
+	cidToGID  func(cid int) int
+
+	mu       sync.Mutex
+	outlines map[int]*fonts.GlyphOutline
+	procs    map[string][]semantic.Operation
+}
+
+func loadFontFace(font *semantic.Font) *fontFace {
+	f := &fontFace{
+		font:        font,
+		glyphMatrix: coords.Scale(0.001, 0.001),
+		outlines:    make(map[int]*fonts.GlyphOutline),
+		procs:       make(map[string][]semantic.Operation),
+	}
+	if font == nil {
+		return f
+	}
+	switch font.Subtype {
+	case "Type3":
+		f.type3 = true
+		if len(font.FontMatrix) == 6 {
+			f.glyphMatrix = matrixOf(font.FontMatrix)
+		}
+		f.names = encodingNames(font, nil)
+		return f
+	case "Type0":
+		f.loadComposite(font)
+		return f
+	}
+	f.loadSimple(font)
+	return f
+}
+
+func (f *fontFace) loadSimple(font *semantic.Font) {
+	var desc *semantic.FontDescriptor
+	if font.Descriptor != nil {
+		desc = font.Descriptor
+	}
+	program := parseProgram(desc)
+	embedded := program != nil
+	if !embedded {
+		program = fallbackFont(font.BaseFont)
+	}
+	f.setProgram(program)
+	f.embedded = embedded
+
+	var builtin func(code int) (string, bool)
+	switch p := program.(type) {
+	case *fonts.Type1Font:
+		builtin = p.EncodingName
+	case *fonts.CFFFont:
+		builtin = func(code int) (string, bool) {
+			if gid, ok := p.GlyphIndexByCode(code); ok {
+				return p.GlyphName(gid), true
+			}
+			return "", false
+		}
+	}
+	if !embedded {
+		builtin = nil
+	}
+	f.names = encodingNames(font, builtin)
+
+	symbolic := desc != nil && desc.Flags&4 != 0
+	explicit := font.Encoding != "" || font.EncodingDict != nil
+	for code := 0; code < 256; code++ {
+		f.gids[code] = simpleGID(program, code, f.names[code], symbolic, explicit)
+	}
+}
+
+// simpleGID maps a single-byte code to a glyph index following the rules of
+// PDF 32000-1 9.6.6.
+func simpleGID(program fonts.OutlineFont, code int, name string, symbolic, explicit bool) int {
+	switch p := program.(type) {
+	case *fonts.Type1Font:
+		if gid, ok := p.GlyphIndexByName(name); ok && name != "" {
+			return gid
+		}
+	case *fonts.CFFFont:
+		if name != "" {
+			if gid, ok := p.GlyphIndexByName(name); ok {
+				return gid
+			}
+		}
+		if gid, ok := p.GlyphIndexByCode(code); ok {
+			return gid
+		}
+	case *fonts.TrueTypeFont:
+		if (!symbolic || explicit) && name != "" {
+			if r, ok := fonts.GlyphNameToRune(name); ok {
+				if gid, ok := p.LookupCMap(3, 1, uint32(r)); ok {
+					return gid
+				}
+			}
+			if c, ok := codeFor(&fonts.MacRomanEncoding, name); ok {
+				if gid, ok := p.LookupCMap(1, 0, uint32(c)); ok {
+					return gid
+				}
+			}
+		}
+		if p.HasCMap(3, 0) {
+			for _, base := range []uint32{0xF000, 0, 0xF100, 0xF200} {
+				if gid, ok := p.LookupCMap(3, 0, base|uint32(code)); ok {
+					return gid
+				}
+			}
+		}
+		if gid, ok := p.LookupCMap(1, 0, uint32(code)); ok {
+			return gid
+		}
+		if gid, ok := p.LookupAnyCMap(uint32(code)); ok {
+			return gid
+		}
+		if cff := p.CFF(); cff != nil && name != "" {
+			if gid, ok := cff.GlyphIndexByName(name); ok {
+				return gid
+			}
+		}
+		if symbolic {
+			return code
+		}
+	}
+	return 0
+}
+
+func codeFor(enc *fonts.EncodingTable, name string) (int, bool) {
+	for c, n := range enc {
+		if n == name {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// encodingNames computes the glyph name for each code from the font's
+// encoding, differences and, as a base, the font program's built-in
+// encoding.
+func encodingNames(font *semantic.Font, builtin func(int) (string, bool)) [256]string {
+	var names [256]string
+	base := font.Encoding
+	if font.EncodingDict != nil && font.EncodingDict.BaseEncoding != "" {
+		base = font.EncodingDict.BaseEncoding
+	}
+	if enc, ok := fonts.NamedEncoding(base); ok {
+		names = *enc
+	} else if builtin != nil {
+		for c := range names {
+			if n, ok := builtin(c); ok {
+				names[c] = n
+			}
+		}
+	} else if font.Subtype != "Type3" {
+		names = fonts.StandardEncoding
+	}
+	if font.EncodingDict != nil {
+		for _, d := range font.EncodingDict.Differences {
+			if d.Code >= 0 && d.Code < 256 {
+				names[d.Code] = d.Name
+			}
+		}
+	}
+	return names
+}
+
+func (f *fontFace) setProgram(p fonts.OutlineFont) {
+	f.program = p
+	switch fp := p.(type) {
+	case nil:
+	case *fonts.CFFFont:
+		f.glyphMatrix = matrix6(fp.FontMatrix())
+	case *fonts.Type1Font:
+		f.glyphMatrix = matrix6(fp.FontMatrix())
+	default:
+		if upem := p.UnitsPerEm(); upem > 0 {
+			f.glyphMatrix = coords.Scale(1/upem, 1/upem)
+		}
+	}
+}
+
+func matrix6(m [6]float64) coords.Matrix {
+	if m[0] == 0 && m[3] == 0 {
+		return coords.Scale(0.001, 0.001)
+	}
+	return coords.Matrix{m[0], m[1], m[2], m[3], m[4], m[5]}
+}
+
+func (f *fontFace) loadComposite(font *semantic.Font) {
+	f.composite = true
+	f.cmap = predefinedCMap(font.Encoding)
+	if len(font.EncodingCMap) > 0 {
+		f.cmap = parseCMap(font.EncodingCMap)
+	}
+	desc := font.DescendantFont
+	if desc == nil {
+		return
+	}
+	program := parseProgram(desc.Descriptor)
+	f.embedded = program != nil
+	if program == nil {
+		program = fallbackFont(font.BaseFont)
+	}
+	f.setProgram(program)
+	switch p := program.(type) {
+	case *fonts.CFFFont:
+		f.cidToGID = func(cid int) int {
+			gid, _ := p.GlyphIndexByCID(cid)
+			return gid
+		}
+	case *fonts.TrueTypeFont:
+		if cff := p.CFF(); cff != nil && cff.IsCID() {
+			f.cidToGID = func(cid int) int {
+				gid, _ := cff.GlyphIndexByCID(cid)
+				return gid
+			}
+			return
+		}
+		if m := desc.CIDToGIDMap; len(m) >= 2 {
+			f.cidToGID = func(cid int) int {
+				if 2*cid+1 < len(m) {
+					return int(binary.BigEndian.Uint16(m[2*cid:]))
+				}
+				return 0
+			}
+		}
+	}
+}
+
+// parseProgram parses the embedded font program described by desc.
+func parseProgram(desc *semantic.FontDescriptor) fonts.OutlineFont {
+	if desc == nil || len(desc.FontFile) == 0 {
+		return nil
+	}
+	data := desc.FontFile
+	switch desc.FontFileType {
+	case "FontFile":
+		if f, err := fonts.ParseType1Font(data, desc.Length1, desc.Length2); err == nil {
+			return f
+		}
+	case "FontFile2":
+		if f, err := fonts.ParseTrueTypeFont(data); err == nil {
+			return f
+		}
+	case "FontFile3":
+		if desc.FontFileSubtype == "OpenType" {
+			if f, err := fonts.ParseTrueTypeFont(data); err == nil {
+				return f
+			}
+		}
+		if f, err := fonts.ParseCFFFont(data); err == nil {
+			return f
+		}
+	}
+	// Sniff the format when the declared type is missing or wrong.
+	switch {
+	case bytes.HasPrefix(data, []byte{0, 1, 0, 0}), bytes.HasPrefix(data, []byte("true")), bytes.HasPrefix(data, []byte("OTTO")):
+		if f, err := fonts.ParseTrueTypeFont(data); err == nil {
+			return f
+		}
+	case bytes.HasPrefix(data, []byte("%!")), bytes.HasPrefix(data, []byte{0x80, 0x01}):
+		if f, err := fonts.ParseType1Font(data, desc.Length1, desc.Length2); err == nil {
+			return f
+		}
+	case data[0] == 1:
+		if f, err := fonts.ParseCFFFont(data); err == nil {
+			return f
+		}
+	}
+	return nil
+}
+
+var (
+	fallbackMu    sync.Mutex
+	fallbackFaces = map[string]*fonts.TrueTypeFont{}
+)
+
+// fallbackFont substitutes a Go font for non-embedded fonts, chosen by the
+// style hints in the base font name.
+func fallbackFont(baseFont string) fonts.OutlineFont {
+	name := strings.ToLower(baseFont)
+	if i := strings.IndexByte(name, '+'); i >= 0 {
+		name = name[i+1:]
+	}
+	bold := strings.Contains(name, "bold") || strings.Contains(name, "black") || strings.Contains(name, "heavy")
+	italic := strings.Contains(name, "italic") || strings.Contains(name, "oblique")
+	mono := strings.Contains(name, "courier") || strings.Contains(name, "mono")
+
+	key, data := "regular", goregular.TTF
+	switch {
+	case mono && bold:
+		key, data = "monobold", gomonobold.TTF
+	case mono:
+		key, data = "mono", gomono.TTF
+	case bold && italic:
+		key, data = "bolditalic", gobolditalic.TTF
+	case bold:
+		key, data = "bold", gobold.TTF
+	case italic:
+		key, data = "italic", goitalic.TTF
+	}
+	fallbackMu.Lock()
+	defer fallbackMu.Unlock()
+	if f, ok := fallbackFaces[key]; ok {
+		return f
+	}
+	f, err := fonts.ParseTrueTypeFont(data)
+	if err != nil {
+		return nil
+	}
+	fallbackFaces[key] = f
+	return f
+}
+
+// glyph is one decoded character of a shown string.
+type glyph struct {
+	code   int
+	cid    int // CID of composite fonts; the code for simple fonts
+	gid    int
+	width  float64 // horizontal advance in text space (w0/1000)
+	single bool    // single-byte code (word spacing applies to code 32)
+}
+
+// decode splits s into glyphs.
+func (f *fontFace) decode(s []byte) []glyph {
+	var out []glyph
+	if !f.composite {
+		out = make([]glyph, len(s))
+		for i, c := range s {
+			code := int(c)
+			out[i] = glyph{code: code, cid: code, gid: f.gids[code], width: f.simpleWidth(code), single: true}
+		}
+		return out
+	}
+	for i := 0; i < len(s); {
+		code, n := f.cmap.next(s[i:])
+		i += n
+		cid := f.cmap.cid(code, n)
+		gid := cid
+		if f.cidToGID != nil {
+			gid = f.cidToGID(cid)
+		}
+		out = append(out, glyph{code: int(code), cid: cid, gid: gid, width: f.cidWidth(cid), single: n == 1})
+	}
+	return out
+}
+
+func (f *fontFace) simpleWidth(code int) float64 {
+	if w, ok := f.font.Widths[code]; ok {
+		if f.type3 {
+			return float64(w) * f.glyphMatrix[0]
+		}
+		return float64(w) / 1000
+	}
+	if f.program == nil || f.type3 {
+		return 0
+	}
+	if o := f.outline(f.gids[code]); o != nil {
+		return o.Advance * f.glyphMatrix[0]
+	}
+	return 0
+}
+
+func (f *fontFace) cidWidth(cid int) float64 {
+	desc := f.font.DescendantFont
+	if desc == nil {
+		return 1
+	}
+	if w, ok := desc.W[cid]; ok {
+		return float64(w) / 1000
+	}
+	if desc.DW > 0 {
+		return float64(desc.DW) / 1000
+	}
+	return 1
+}
+
+// outline returns the cached outline of gid in glyph space.
+func (f *fontFace) outline(gid int) *fonts.GlyphOutline {
+	if f.program == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if o, ok := f.outlines[gid]; ok {
+		return o
+	}
+	o, err := f.program.Outline(gid)
+	if err != nil {
+		o = nil
+	}
+	f.outlines[gid] = o
+	return o
+}
+
+// charProc returns the parsed glyph procedure of a Type 3 character.
+func (f *fontFace) charProc(code int) []semantic.Operation {
+	name := f.names[code&0xff]
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ops, ok := f.procs[name]; ok {
+		return ops
+	}
+	ops, _ := contentstream.ParseOperations(f.font.CharProcs[name])
+	f.procs[name] = ops
+	return ops
+}
+
+// showText paints a string with the current font and advances the text
+// matrix.
+func (it *interp) showText(s []byte) {
+	gs := &it.gs
+	mode := gs.renderMode
+	if mode >= contentstream.TextFillClip {
+		it.textClipped = true
+	}
+	if gs.Font == nil {
+		return
+	}
+	face := it.r.face(gs.Font)
+	vertical := face.composite && face.cmap.vertical
+	doFill := mode == contentstream.TextFill || mode == contentstream.TextFillStroke ||
+		mode == contentstream.TextFillClip || mode == contentstream.TextFillStrokeClip
+	doStroke := mode == contentstream.TextStroke || mode == contentstream.TextFillStroke ||
+		mode == contentstream.TextStrokeClip || mode == contentstream.TextFillStrokeClip
+	doClip := mode >= contentstream.TextFillClip
+
+	var path devicePath
+	for _, g := range face.decode(s) {
+		trm := coords.Matrix{gs.FontSize * gs.hScale, 0, 0, gs.FontSize, 0, gs.rise}.
+			Multiply(gs.TextMatrix).Multiply(gs.CTM)
+		if vertical {
+			// Default vertical metrics: origin at (w0/2, 0.88) in text space.
+			trm = coords.Translate(-g.width/2, -0.88).Multiply(trm)
+		}
+		if face.type3 {
+			if doFill && it.depth < maxFormDepth {
+				it.drawType3Glyph(face, g.code, trm)
+			}
+		} else if o := face.outline(g.gid); o != nil {
+			appendOutline(&path, o, face.glyphMatrix.Multiply(trm))
+		}
+
+		spacing := gs.charSpacing
+		if g.single && g.code == 32 {
+			spacing += gs.wordSpacing
+		}
+		if vertical {
+			gs.TextMatrix = coords.Translate(0, -gs.FontSize+spacing).Multiply(gs.TextMatrix)
+		} else {
+			tx := (g.width*gs.FontSize + spacing) * gs.hScale
+			gs.TextMatrix = coords.Translate(tx, 0).Multiply(gs.TextMatrix)
+		}
+	}
+	if path.empty() {
+		return
+	}
+	if doFill {
+		m := rasterize(path.fillPolygon(), false, it.bounds())
+		it.paintMask(m, gs.fill, gs.fillAlpha)
+	}
+	if doStroke {
+		poly := strokePolygon(&path, gs.CTM, it.strokeStyle())
+		it.paintMask(rasterize(poly, false, it.bounds()), gs.stroke, gs.strokeAlpha)
+	}
+	if doClip {
+		it.textClip = append(it.textClip, path.fillPolygon()...)
+	}
+}
+
+// adjustText applies a TJ position adjustment (thousandths of text space).
+func (it *interp) adjustText(n float64) {
+	gs := &it.gs
+	if gs.Font != nil {
+		if face := it.r.face(gs.Font); face.composite && face.cmap.vertical {
+			gs.TextMatrix = coords.Translate(0, -n/1000*gs.FontSize).Multiply(gs.TextMatrix)
+			return
+		}
+	}
+	tx := -n / 1000 * gs.FontSize * gs.hScale
+	gs.TextMatrix = coords.Translate(tx, 0).Multiply(gs.TextMatrix)
+}
+
+// appendOutline adds a glyph outline transformed by m to p.
+func appendOutline(p *devicePath, o *fonts.GlyphOutline, m coords.Matrix) {
+	tr := func(pt fonts.OutlinePoint) point {
+		d := m.Transform(coords.Point{X: pt.X, Y: pt.Y})
+		return point{d.X, d.Y}
+	}
+	for _, seg := range o.Segments {
+		switch seg.Op {
+		case fonts.OutlineMoveTo:
+			p.closePath()
+			p.moveTo(tr(seg.Points[0]))
+		case fonts.OutlineLineTo:
+			p.lineTo(tr(seg.Points[0]))
+		case fonts.OutlineQuadTo:
+			p.quadTo(tr(seg.Points[0]), tr(seg.Points[1]))
+		case fonts.OutlineCubeTo:
+			p.curveTo(tr(seg.Points[0]), tr(seg.Points[1]), tr(seg.Points[2]))
+		}
+	}
+	p.closePath()
+}
+
+// drawType3Glyph executes a Type 3 glyph procedure with the glyph matrix
+// prepended to the text rendering matrix.
+func (it *interp) drawType3Glyph(face *fontFace, code int, trm coords.Matrix) {
+	ops := face.charProc(code)
+	if len(ops) == 0 {
+		return
+	}
+	res := face.font.Resources
+	if res == nil {
+		res = it.res
+	}
+	sub := it.child(it.dst, res)
+	sub.gs = it.gs
+	sub.gs.CTM = face.glyphMatrix.Multiply(trm)
+	sub.gs.TextMatrix = coords.Identity()
+	sub.gs.TextLineMatrix = coords.Identity()
+	sub.gs.renderMode = contentstream.TextFill
+	sub.base = sub.gs.CTM
+	_ = sub.run(ops)
+}
+
+// cmap is a Type 0 encoding: codespace ranges plus CID mappings.
+type cmap struct {
+	codespace []codespaceRange
+	ranges    []cidRange
+	chars     map[uint32]int
+	identity  bool
+	vertical  bool
+}
+
+type codespaceRange struct {
+	n      int
+	lo, hi []byte
+}
+
+type cidRange struct {
+	n      int
+	lo, hi uint32
+	cid    int
+}
+
+func predefinedCMap(name string) *cmap {
+	// Predefined CMaps other than Identity are not bundled; treating them as
+	// two-byte identity keeps text positioned even when glyphs are wrong.
+	return &cmap{identity: true, vertical: strings.HasSuffix(name, "-V")}
+}
+
+// next reads one character code from s using the codespace ranges.
+func (c *cmap) next(s []byte) (uint32, int) {
+	if len(c.codespace) == 0 {
+		if len(s) >= 2 {
+			return uint32(s[0])<<8 | uint32(s[1]), 2
+		}
+		return uint32(s[0]), 1
+	}
+	for n := 1; n <= 4 && n <= len(s); n++ {
+		for _, r := range c.codespace {
+			if r.n != n {
+				continue
+			}
+			match := true
+			for i := 0; i < n; i++ {
+				if s[i] < r.lo[i] || s[i] > r.hi[i] {
+					match = false
+					break
+				}
+			}
+			if match {
+				return beUint(s[:n]), n
+			}
+		}
+	}
+	// No codespace matched: consume the shortest code length.
+	n := 4
+	for _, r := range c.codespace {
+		if r.n < n {
+			n = r.n
+		}
+	}
+	if n > len(s) {
+		n = len(s)
+	}
+	return beUint(s[:n]), n
+}
+
+func (c *cmap) cid(code uint32, n int) int {
+	if cid, ok := c.chars[code]; ok {
+		return cid
+	}
+	for _, r := range c.ranges {
+		if (r.n == 0 || r.n == n) && code >= r.lo && code <= r.hi {
+			return r.cid + int(code-r.lo)
+		}
+	}
+	if c.identity {
+		return int(code)
+	}
+	return 0
+}
+
+func beUint(b []byte) uint32 {
+	var v uint32
+	for _, x := range b {
+		v = v<<8 | uint32(x)
+	}
+	return v
+}
+
+// parseCMap reads the codespace and CID mappings of an embedded CMap.
+func parseCMap(data []byte) *cmap {
+	c := &cmap{chars: make(map[uint32]int)}
+	toks := cmapTokens(data)
+	for i := 0; i < len(toks); i++ {
+		switch toks[i] {
+		case "/WMode":
+			if i+1 < len(toks) && toks[i+1] == "1" {
+				c.vertical = true
+			}
+		case "usecmap":
+			if i > 0 && strings.HasPrefix(toks[i-1], "/Identity") {
+				c.identity = true
+				c.vertical = c.vertical || strings.HasSuffix(toks[i-1], "-V")
+			}
+		case "begincodespacerange":
+			for i++; i+1 < len(toks) && toks[i] != "endcodespacerange"; i += 2 {
+				lo, hi := hexToken(toks[i]), hexToken(toks[i+1])
+				if len(lo) > 0 && len(lo) == len(hi) {
+					c.codespace = append(c.codespace, codespaceRange{n: len(lo), lo: lo, hi: hi})
+				}
+			}
+		case "begincidrange":
+			for i++; i+2 < len(toks) && toks[i] != "endcidrange"; i += 3 {
+				lo, hi := hexToken(toks[i]), hexToken(toks[i+1])
+				cid, err := strconv.Atoi(toks[i+2])
+				if err == nil && len(lo) > 0 {
+					c.ranges = append(c.ranges, cidRange{n: len(lo), lo: beUint(lo), hi: beUint(hi), cid: cid})
+				}
+			}
+		case "begincidchar":
+			for i++; i+1 < len(toks) && toks[i] != "endcidchar"; i += 2 {
+				code := hexToken(toks[i])
+				if cid, err := strconv.Atoi(toks[i+1]); err == nil && len(code) > 0 {
+					c.chars[beUint(code)] = cid
+				}
+			}
+		}
+	}
+	if len(c.codespace) == 0 && len(c.ranges) == 0 && len(c.chars) == 0 {
+		c.identity = true
+	}
+	return c
+}
+
+func cmapTokens(data []byte) []string {
+	var toks []string
+	for i := 0; i < len(data); {
+		ch := data[i]
+		switch {
+		case ch == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case ch == '<' && i+1 < len(data) && data[i+1] != '<':
+			j := bytes.IndexByte(data[i:], '>')
+			if j < 0 {
+				return toks
+			}
+			toks = append(toks, string(data[i:i+j+1]))
+			i += j + 1
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n' || ch == '\f' || ch == 0:
+			i++
+		case ch == '[' || ch == ']' || ch == '{' || ch == '}':
+			i++
+		default:
+			j := i + 1
+			for j < len(data) && !strings.ContainsRune(" \t\r\n\f\x00<>[]{}%/", rune(data[j])) {
+				j++
+			}
+			if ch == '<' || ch == '>' {
+				j = i + 2
+				if j > len(data) {
+					j = len(data)
+				}
+			}
+			toks = append(toks, string(data[i:j]))
+			i = j
+		}
+	}
+	return toks
+}
+
+func hexToken(tok string) []byte {
+	if len(tok) < 2 || tok[0] != '<' || tok[len(tok)-1] != '>' {
+		return nil
+	}
+	var out []byte
+	var hi byte
+	odd := false
+	for i := 1; i < len(tok)-1; i++ {
+		v, ok := hexVal(tok[i])
+		if !ok {
+			continue
+		}
+		if odd {
+			out = append(out, hi<<4|v)
+		} else {
+			hi = v
+		}
+		odd = !odd
+	}
+	if odd {
+		out = append(out, hi<<4)
+	}
+	return out
+}
+
+func hexVal(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
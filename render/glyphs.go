@@ -0,0 +1,41 @@
+package render
+
+import "github.com/wudi/pdfkit/ir/semantic"
+
+// Glyph describes how the renderer resolves one character of a shown
+// string. Widths are horizontal advances in text space units, so 0.5 is
+// half the font size.
+type Glyph struct {
+	Code    int     // character code
+	CID     int     // CID for composite fonts; the code for simple fonts
+	GID     int     // glyph index in the font program, 0 for .notdef
+	Width   float64 // advance from the font dictionary (Widths, W or DW)
+	Advance float64 // advance from the font program
+	Defined bool    // the font program contains the glyph
+}
+
+// FontGlyphs decodes s as shown with font and resolves each character to
+// the glyph RenderPage paints for it. Embedded reports whether the glyphs
+// come from the font's own program; when it is false they come from the
+// substitute font used in place of a missing or unreadable program. For
+// Type 3 fonts GID is the code and a glyph is defined when the font has a
+// procedure for it.
+func (r *Renderer) FontGlyphs(font *semantic.Font, s []byte) (glyphs []Glyph, embedded bool) {
+	f := r.face(font)
+	for _, g := range f.decode(s) {
+		out := Glyph{Code: g.code, CID: g.cid, GID: g.gid, Width: g.width}
+		switch {
+		case f.type3:
+			out.GID = g.code
+			out.Defined = font.CharProcs[f.names[g.code&0xff]] != nil
+			out.Advance = g.width
+		case f.program != nil && g.gid >= 0 && g.gid < f.program.NumGlyphs():
+			if o := f.outline(g.gid); o != nil {
+				out.Defined = true
+				out.Advance = o.Advance * f.glyphMatrix[0]
+			}
+		}
+		glyphs = append(glyphs, out)
+	}
+	return glyphs, f.embedded || f.type3
+}
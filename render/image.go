@@ -0,0 +1,633 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/wudi/pdfkit/coords"
+	"github.com/wudi/pdfkit/internal/bitpack"
+	"github.com/wudi/pdfkit/ir/raw"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// decodedImage holds an image's pixels as straight RGBA, or for stencil
+// masks the paint coverage in the alpha channel.
+type decodedImage struct {
+	img     *image.NRGBA
+	stencil bool
+	smooth  bool
+}
+
+// maxImagePixels bounds decoded image sizes to keep memory predictable.
+const maxImagePixels = 64 << 20
+
+// DecodeImage converts an image XObject to straight RGBA, applying its
+// colour space, Decode array, colour-key and stencil masks and soft mask.
+// Stencil masks (/ImageMask) come back as black paint over transparency.
+func (r *Renderer) DecodeImage(ctx context.Context, xo *semantic.XObject) (*image.NRGBA, error) {
+	if xo == nil {
+		return nil, errors.New("render: nil image")
+	}
+	it := newInterp(ctx, r, nil, coords.Identity(), nil)
+	di := it.decodeImage(xo, nil)
+	if di == nil || di.img == nil {
+		return nil, fmt.Errorf("render: cannot decode %dx%d image", xo.Width, xo.Height)
+	}
+	return di.img, nil
+}
+
+// InlineImage expands an inline image (BI/ID/EI) into an image XObject.
+// Named colour spaces resolve against res. Generic filters are applied;
+// an image codec (DCT, JPX, CCITT) is left in Filter as for parsed
+// XObjects, so the result can be passed to DecodeImage.
+func (r *Renderer) InlineImage(ctx context.Context, op semantic.InlineImageOperand, res *semantic.Resources) (*semantic.XObject, error) {
+	it := newInterp(ctx, r, nil, coords.Identity(), res)
+	xo, names, params := it.inlineImageXObject(op)
+	if n := len(names); n > 0 && (names[n-1] == "DCTDecode" || names[n-1] == "JPXDecode" || names[n-1] == "CCITTFaxDecode") {
+		xo.Filter, xo.DecodeParms = names[n-1], params[n-1]
+		names, params = names[:n-1], params[:n-1]
+	}
+	if len(names) > 0 {
+		data, err := r.pipeline.Decode(ctx, xo.Data, names, params)
+		if err != nil {
+			return nil, err
+		}
+		xo.Data = data
+	}
+	return xo, nil
+}
+
+func (it *interp) drawImage(xo *semantic.XObject) {
+	di, ok := it.cache.images[xo]
+	if !ok {
+		di = it.decodeImage(xo, nil)
+		it.cache.images[xo] = di
+	}
+	it.paintImage(di)
+}
+
+func (it *interp) drawInlineImage(op semantic.InlineImageOperand) {
+	xo, names, params := it.inlineImageXObject(op)
+	it.paintImage(it.decodeImage(xo, &inlineFilters{names: names, params: params}))
+}
+
+type inlineFilters struct {
+	names  []string
+	params []raw.Dictionary
+}
+
+// paintImage maps the unit square through the CTM and paints the image.
+func (it *interp) paintImage(di *decodedImage) {
+	if di == nil || di.img == nil {
+		return
+	}
+	w, h := di.img.Rect.Dx(), di.img.Rect.Dy()
+	if w == 0 || h == 0 {
+		return
+	}
+	var p devicePath
+	p.moveTo(it.toDevice(0, 0))
+	p.lineTo(it.toDevice(1, 0))
+	p.lineTo(it.toDevice(1, 1))
+	p.lineTo(it.toDevice(0, 1))
+	p.closePath()
+	cover := rasterize(p.fillPolygon(), false, it.bounds())
+	if cover == nil {
+		return
+	}
+	// Image space: (0,0) is the top-left sample, one unit per sample.
+	imgToDev := coords.Matrix{1 / float64(w), 0, 0, -1 / float64(h), 0, 1}.Multiply(it.gs.CTM)
+	devToImg, err := imgToDev.Inverse()
+	if err != nil {
+		return
+	}
+	src := newImageSource(di, devToImg)
+	if di.stencil {
+		// Stencil masks modulate the fill paint by the sampled coverage.
+		for y := cover.Rect.Min.Y; y < cover.Rect.Max.Y; y++ {
+			row := cover.Pix[cover.PixOffset(cover.Rect.Min.X, y):]
+			for x := cover.Rect.Min.X; x < cover.Rect.Max.X; x++ {
+				i := x - cover.Rect.Min.X
+				if row[i] == 0 {
+					continue
+				}
+				_, a := src.at(x, y)
+				row[i] = mul8(row[i], to8(a))
+			}
+		}
+		it.paintMask(cover, it.gs.fill, it.gs.fillAlpha)
+		return
+	}
+	cover = intersectMask(cover, it.gs.clip)
+	if cover == nil {
+		return
+	}
+	it.composite(cover, src, it.gs.fillAlpha)
+}
+
+// imageSource samples an image through the inverse CTM, pre-filtering when
+// the image is minified so that thumbnails do not alias.
+type imageSource struct {
+	img    *image.NRGBA
+	inv    coords.Matrix
+	smooth bool
+}
+
+func newImageSource(di *decodedImage, inv coords.Matrix) imageSource {
+	img := di.img
+	// Image samples per device pixel along each image axis.
+	fx := math.Hypot(inv[0], inv[1])
+	fy := math.Hypot(inv[2], inv[3])
+	kx, ky := int(fx), int(fy)
+	if kx < 1 {
+		kx = 1
+	}
+	if ky < 1 {
+		ky = 1
+	}
+	if kx > 1 || ky > 1 {
+		img = boxDownsample(img, kx, ky)
+		inv = inv.Multiply(coords.Scale(1/float64(kx), 1/float64(ky)))
+	}
+	// Magnified images are interpolated; stencil masks only when the image
+	// asks for it with /Interpolate.
+	return imageSource{img: img, inv: inv, smooth: di.smooth && (fx < 1 || fy < 1)}
+}
+
+func (s imageSource) at(x, y int) (rgb, float64) {
+	p := s.inv.Transform(coords.Point{X: float64(x) + 0.5, Y: float64(y) + 0.5})
+	w, h := s.img.Rect.Dx(), s.img.Rect.Dy()
+	if !s.smooth {
+		ix, iy := clampI(int(math.Floor(p.X)), 0, w-1), clampI(int(math.Floor(p.Y)), 0, h-1)
+		return s.pixel(ix, iy)
+	}
+	fx, fy := p.X-0.5, p.Y-0.5
+	x0, y0 := int(math.Floor(fx)), int(math.Floor(fy))
+	tx, ty := fx-float64(x0), fy-float64(y0)
+	var r, g, b, a float64
+	for _, c := range [4]struct {
+		dx, dy int
+		w      float64
+	}{{0, 0, (1 - tx) * (1 - ty)}, {1, 0, tx * (1 - ty)}, {0, 1, (1 - tx) * ty}, {1, 1, tx * ty}} {
+		cc, ca := s.pixel(clampI(x0+c.dx, 0, w-1), clampI(y0+c.dy, 0, h-1))
+		r += cc.R * ca * c.w
+		g += cc.G * ca * c.w
+		b += cc.B * ca * c.w
+		a += ca * c.w
+	}
+	if a == 0 {
+		return rgb{}, 0
+	}
+	return rgb{r / a, g / a, b / a}, a
+}
+
+func (s imageSource) pixel(x, y int) (rgb, float64) {
+	i := y*s.img.Stride + x*4
+	px := s.img.Pix[i : i+4 : i+4]
+	return rgb{float64(px[0]) / 255, float64(px[1]) / 255, float64(px[2]) / 255}, float64(px[3]) / 255
+}
+
+func clampI(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// boxDownsample averages kx×ky blocks (alpha-weighted).
+func boxDownsample(src *image.NRGBA, kx, ky int) *image.NRGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := (w+kx-1)/kx, (h+ky-1)/ky
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		for dx := 0; dx < dw; dx++ {
+			var r, g, b, a, n float64
+			for y := dy * ky; y < (dy+1)*ky && y < h; y++ {
+				for x := dx * kx; x < (dx+1)*kx && x < w; x++ {
+					px := src.Pix[y*src.Stride+x*4:]
+					pa := float64(px[3])
+					r += float64(px[0]) * pa
+					g += float64(px[1]) * pa
+					b += float64(px[2]) * pa
+					a += pa
+					n++
+				}
+			}
+			o := dst.Pix[dy*dst.Stride+dx*4:]
+			if a > 0 {
+				o[0], o[1], o[2] = uint8(r/a+0.5), uint8(g/a+0.5), uint8(b/a+0.5)
+			}
+			o[3] = uint8(a/n + 0.5)
+		}
+	}
+	return dst
+}
+
+// decodeImage converts an image XObject to straight RGBA. Inline images pass
+// their filter chain explicitly.
+func (it *interp) decodeImage(xo *semantic.XObject, inline *inlineFilters) *decodedImage {
+	w, h := xo.Width, xo.Height
+	if w <= 0 || h <= 0 || w*h > maxImagePixels {
+		return nil
+	}
+	data := xo.Data
+	var names []string
+	var params []raw.Dictionary
+	if inline != nil {
+		names, params = inline.names, inline.params
+	} else if xo.Filter != "" {
+		names = []string{xo.Filter}
+		params = []raw.Dictionary{xo.DecodeParms}
+		switch xo.Filter {
+		case "CCITTFaxDecode":
+			params[0] = ccittParams(xo.DecodeParms, w, h)
+		case "JBIG2Decode":
+			params[0] = jbig2Params(xo.DecodeParms, xo.JBIG2Globals)
+		}
+	}
+	if len(names) > 0 {
+		out, err := it.r.pipeline.Decode(it.ctx, data, names, params)
+		if err != nil {
+			return nil
+		}
+		data = out
+	}
+
+	di := &decodedImage{img: image.NewNRGBA(image.Rect(0, 0, w, h)), smooth: xo.Interpolate || !xo.ImageMask}
+	pix := di.img.Pix
+	if last := lastFilter(names); last == "DCTDecode" || last == "JPXDecode" || last == "JBIG2Decode" {
+		if len(data) >= w*h*4 {
+			// Codec output is already NRGBA.
+			copy(pix, data[:w*h*4])
+			if xo.ImageMask {
+				return it.stencil(xo, bitpack.GrayToBits(pix, w, h, 4))
+			}
+			it.applyMasks(di, xo)
+			return di
+		}
+	}
+	bpc := xo.BitsPerComponent
+	if lastFilter(names) == "CCITTFaxDecode" && len(data) >= w*h {
+		// CCITT output is one 8-bit gray sample per pixel; repack it as the
+		// 1-bit samples the image dictionary describes.
+		data = bitpack.GrayToBits(data, w, h, 1)
+		bpc = 1
+	}
+	if xo.ImageMask {
+		return it.stencil(xo, data)
+	}
+
+	cs := xo.ColorSpace
+	if cs == nil {
+		cs = deviceGray
+	}
+	n := numComponents(cs)
+	if bpc <= 0 {
+		bpc = 8
+	}
+	if n <= 0 || (bpc != 1 && bpc != 2 && bpc != 4 && bpc != 8 && bpc != 16) {
+		return nil
+	}
+	maxV := float64(int(1)<<uint(bpc) - 1)
+	dec := imageDecode(xo.Decode, cs, n, bpc)
+	_, indexed := cs.(*semantic.IndexedColorSpace)
+	rowBits := w * n * bpc
+	rowBytes := (rowBits + 7) / 8
+
+	// Single-component images convert through a lookup table.
+	var lut []rgb
+	var lutOK []bool
+	if n == 1 && bpc <= 8 {
+		lut = make([]rgb, 1<<uint(bpc))
+		lutOK = make([]bool, len(lut))
+		for v := range lut {
+			x := dec[0] + float64(v)*(dec[1]-dec[0])/maxV
+			if indexed {
+				x = math.Round(x)
+			}
+			lut[v], lutOK[v] = toRGB(cs, []float64{x})
+		}
+	}
+	// Colour-key masking compares the raw samples against /Mask ranges.
+	colorKey := xo.ColorKey
+	if len(colorKey) < 2*n {
+		colorKey = nil
+	}
+	comps := make([]float64, n)
+	for y := 0; y < h; y++ {
+		rowStart := y * rowBytes * 8
+		for x := 0; x < w; x++ {
+			o := di.img.PixOffset(x, y)
+			bit := rowStart + x*n*bpc
+			if bit/8 >= len(data) {
+				continue // truncated data stays transparent
+			}
+			if colorKey != nil && keyed(data, bit, n, bpc, colorKey) {
+				continue
+			}
+			var c rgb
+			ok := true
+			if lut != nil {
+				v := bitpack.ReadBits(data, bit, bpc)
+				c, ok = lut[v], lutOK[v]
+			} else {
+				for k := 0; k < n; k++ {
+					v := float64(bitpack.ReadBits(data, bit+k*bpc, bpc))
+					comps[k] = dec[2*k] + v*(dec[2*k+1]-dec[2*k])/maxV
+				}
+				c, ok = toRGB(cs, comps)
+			}
+			if !ok {
+				continue
+			}
+			pix[o], pix[o+1], pix[o+2], pix[o+3] = to8(c.R), to8(c.G), to8(c.B), 0xff
+		}
+	}
+	it.applyMasks(di, xo)
+	return di
+}
+
+// keyed reports whether every sample of the pixel at bit lies within its
+// colour-key range.
+func keyed(data []byte, bit, n, bpc int, ranges []int) bool {
+	for k := 0; k < n; k++ {
+		v := int(bitpack.ReadBits(data, bit+k*bpc, bpc))
+		if v < ranges[2*k] || v > ranges[2*k+1] {
+			return false
+		}
+	}
+	return true
+}
+
+// ccittParams completes CCITT decode parameters with the image geometry,
+// which the stream dictionary may leave implicit.
+func ccittParams(params raw.Dictionary, w, h int) raw.Dictionary {
+	out := raw.Dict()
+	if params != nil {
+		for _, k := range params.Keys() {
+			v, _ := params.Get(k)
+			out.Set(k, v)
+		}
+	}
+	if _, ok := out.Get(raw.NameLiteral("Columns")); !ok {
+		out.Set(raw.NameLiteral("Columns"), raw.NumberInt(int64(w)))
+	}
+	if _, ok := out.Get(raw.NameLiteral("Rows")); !ok {
+		out.Set(raw.NameLiteral("Rows"), raw.NumberInt(int64(h)))
+	}
+	return out
+}
+
+// jbig2Params adds the globals the semantic layer splits out of JBIG2Decode
+// parameters back as an inline stream.
+func jbig2Params(params raw.Dictionary, globals []byte) raw.Dictionary {
+	if len(globals) == 0 {
+		return params
+	}
+	out := raw.Dict()
+	if params != nil {
+		for _, k := range params.Keys() {
+			v, _ := params.Get(k)
+			out.Set(k, v)
+		}
+	}
+	out.Set(raw.NameLiteral("JBIG2Globals"), raw.NewStream(raw.Dict(), globals))
+	return out
+}
+
+func lastFilter(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return names[len(names)-1]
+}
+
+// imageDecode returns the Decode ranges, defaulting per colour space.
+func imageDecode(d []float64, cs semantic.ColorSpace, n, bpc int) []float64 {
+	if len(d) >= 2*n {
+		return d
+	}
+	out := make([]float64, 2*n)
+	_, indexed := cs.(*semantic.IndexedColorSpace)
+	for k := 0; k < n; k++ {
+		out[2*k+1] = 1
+		if indexed {
+			out[2*k+1] = float64(int(1)<<uint(bpc) - 1)
+		}
+	}
+	if cs != nil && cs.ColorSpaceName() == "Lab" && n == 3 {
+		copy(out, []float64{0, 100, -100, 100, -100, 100})
+	}
+	return out
+}
+
+func decodeInverted(d []float64) bool { return len(d) >= 2 && d[0] > d[1] }
+
+// stencil builds a stencil mask: samples equal to 0 paint with the fill
+// colour unless the Decode array is [1 0].
+func (it *interp) stencil(xo *semantic.XObject, data []byte) *decodedImage {
+	w, h := xo.Width, xo.Height
+	paintBit := uint32(0)
+	if decodeInverted(xo.Decode) {
+		paintBit = 1
+	}
+	di := &decodedImage{img: image.NewNRGBA(image.Rect(0, 0, w, h)), stencil: true, smooth: xo.Interpolate}
+	rowBytes := (w + 7) / 8
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if bitpack.ReadBits(data, y*rowBytes*8+x, 1) == paintBit {
+				di.img.Pix[di.img.PixOffset(x, y)+3] = 0xff
+			}
+		}
+	}
+	return di
+}
+
+// applyMasks multiplies the image alpha by its soft mask's gray samples
+// and by the coverage of an explicit stencil /Mask.
+func (it *interp) applyMasks(di *decodedImage, xo *semantic.XObject) {
+	if xo.SMask != nil {
+		smx := *xo.SMask
+		smx.ColorSpace = deviceGray
+		smx.SMask, smx.Mask, smx.ColorKey = nil, nil, nil
+		it.applyMask(di, xo.SMask, &smx, 0)
+	}
+	if xo.Mask != nil {
+		mx := *xo.Mask
+		mx.ImageMask = true
+		mx.BitsPerComponent = 1
+		it.applyMask(di, xo.Mask, &mx, 3)
+	}
+}
+
+// applyMask scales the image alpha by channel ch of the decoded mask,
+// resampling the mask to the image size.
+func (it *interp) applyMask(di *decodedImage, key, mask *semantic.XObject, ch int) {
+	md, ok := it.cache.images[key]
+	if !ok {
+		md = it.decodeImage(mask, nil)
+		it.cache.images[key] = md
+	}
+	if md == nil {
+		return
+	}
+	w, h := di.img.Rect.Dx(), di.img.Rect.Dy()
+	mw, mh := md.img.Rect.Dx(), md.img.Rect.Dy()
+	for y := 0; y < h; y++ {
+		my := y * mh / h
+		for x := 0; x < w; x++ {
+			mx := x * mw / w
+			o := di.img.PixOffset(x, y) + 3
+			di.img.Pix[o] = mul8(di.img.Pix[o], md.img.Pix[md.img.PixOffset(mx, my)+ch])
+		}
+	}
+}
+
+// inlineImageXObject expands an inline image dictionary into an XObject and
+// its filter chain.
+func (it *interp) inlineImageXObject(op semantic.InlineImageOperand) (*semantic.XObject, []string, []raw.Dictionary) {
+	get := func(keys ...string) semantic.Operand {
+		for _, k := range keys {
+			if v, ok := op.Image.Values[k]; ok {
+				return v
+			}
+		}
+		return nil
+	}
+	xo := &semantic.XObject{Subtype: "Image", Data: op.Data}
+	xo.Width = int(number(get("W", "Width")))
+	xo.Height = int(number(get("H", "Height")))
+	xo.BitsPerComponent = int(number(get("BPC", "BitsPerComponent")))
+	if b, ok := get("IM", "ImageMask").(semantic.BoolOperand); ok {
+		xo.ImageMask = b.Value
+	}
+	if b, ok := get("I", "Interpolate").(semantic.BoolOperand); ok {
+		xo.Interpolate = b.Value
+	}
+	if xo.ImageMask && xo.BitsPerComponent == 0 {
+		xo.BitsPerComponent = 1
+	}
+	if arr, ok := get("D", "Decode").(semantic.ArrayOperand); ok {
+		xo.Decode = numbers(arr.Values)
+	}
+	if cs := get("CS", "ColorSpace"); cs != nil {
+		xo.ColorSpace = it.inlineColorSpace(cs)
+	}
+
+	var names []string
+	switch f := get("F", "Filter").(type) {
+	case semantic.NameOperand:
+		names = []string{expandFilter(f.Value)}
+	case semantic.ArrayOperand:
+		for _, v := range f.Values {
+			if n, ok := v.(semantic.NameOperand); ok {
+				names = append(names, expandFilter(n.Value))
+			}
+		}
+	}
+	var params []raw.Dictionary
+	switch p := get("DP", "DecodeParms").(type) {
+	case semantic.DictOperand:
+		params = []raw.Dictionary{operandDict(p)}
+	case semantic.ArrayOperand:
+		for _, v := range p.Values {
+			if d, ok := v.(semantic.DictOperand); ok {
+				params = append(params, operandDict(d))
+			} else {
+				params = append(params, nil)
+			}
+		}
+	}
+	for len(params) < len(names) {
+		params = append(params, nil)
+	}
+	if lastFilter(names) == "CCITTFaxDecode" {
+		i := len(names) - 1
+		params[i] = ccittParams(params[i], xo.Width, xo.Height)
+	}
+	return xo, names, params
+}
+
+func (it *interp) inlineColorSpace(op semantic.Operand) semantic.ColorSpace {
+	switch v := op.(type) {
+	case semantic.NameOperand:
+		return it.lookupColorSpace(v.Value)
+	case semantic.ArrayOperand:
+		// [/Indexed base hival lookup]
+		if len(v.Values) == 4 {
+			if n, ok := v.Values[0].(semantic.NameOperand); ok && canonicalName(n.Value) == "Indexed" {
+				cs := &semantic.IndexedColorSpace{Base: it.inlineColorSpace(v.Values[1]), Hival: int(number(v.Values[2]))}
+				if s, ok := v.Values[3].(semantic.StringOperand); ok {
+					cs.Lookup = s.Value
+				}
+				return cs
+			}
+		}
+		if len(v.Values) > 0 {
+			return it.inlineColorSpace(v.Values[0])
+		}
+	}
+	return deviceGray
+}
+
+var inlineFilterNames = map[string]string{
+	"AHx": "ASCIIHexDecode",
+	"A85": "ASCII85Decode",
+	"LZW": "LZWDecode",
+	"Fl":  "FlateDecode",
+	"RL":  "RunLengthDecode",
+	"CCF": "CCITTFaxDecode",
+	"DCT": "DCTDecode",
+}
+
+func expandFilter(name string) string {
+	if full, ok := inlineFilterNames[name]; ok {
+		return full
+	}
+	return name
+}
+
+// operandDict converts content-stream operands to a raw dictionary for the
+// filter pipeline.
+func operandDict(d semantic.DictOperand) raw.Dictionary {
+	out := raw.Dict()
+	for k, v := range d.Values {
+		if obj := operandObject(v); obj != nil {
+			out.Set(raw.NameLiteral(k), obj)
+		}
+	}
+	return out
+}
+
+func operandObject(op semantic.Operand) raw.Object {
+	switch v := op.(type) {
+	case semantic.NumberOperand:
+		if v.Value == math.Trunc(v.Value) {
+			return raw.NumberInt(int64(v.Value))
+		}
+		return raw.NumberFloat(v.Value)
+	case semantic.NameOperand:
+		return raw.NameLiteral(v.Value)
+	case semantic.BoolOperand:
+		return raw.Bool(v.Value)
+	case semantic.StringOperand:
+		return raw.Str(v.Value)
+	case semantic.DictOperand:
+		return operandDict(v)
+	case semantic.ArrayOperand:
+		arr := raw.NewArray()
+		for _, e := range v.Values {
+			if obj := operandObject(e); obj != nil {
+				arr.Items = append(arr.Items, obj)
+			}
+		}
+		return arr
+	}
+	return nil
+}
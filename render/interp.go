@@ -0,0 +1,811 @@
+package render
+
+import (
+	"context"
+	"image"
+
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/coords"
+	"github.com/wudi/pdfkit/function"
+	"github.com/wudi/pdfkit/internal/pdfnum"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// paint is a fill or stroke colour: components in a colour space, or a
+// pattern when the space is Pattern.
+type paint struct {
+	cs      semantic.ColorSpace
+	comps   []float64
+	pattern semantic.Pattern
+}
+
+// gstate is the renderer's graphics state. The embedded contentstream types
+// carry the CTM, line width, font and text matrices; the remaining fields
+// cover the parameters those types do not model.
+type gstate struct {
+	contentstream.GraphicsState
+	contentstream.TextState
+
+	charSpacing float64
+	wordSpacing float64
+	hScale      float64
+	leading     float64
+	rise        float64
+	renderMode  contentstream.TextRenderMode
+
+	lineCap    contentstream.LineCap
+	lineJoin   contentstream.LineJoin
+	miterLimit float64
+	dash       []float64
+	dashPhase  float64
+
+	fill, stroke paint
+	fillAlpha    float64
+	strokeAlpha  float64
+	blend        blendMode
+	softMask     *image.Alpha
+
+	// clip is the clipping region as device coverage; nil means unclipped.
+	clip *image.Alpha
+}
+
+// interp executes content stream operations onto dst.
+type interp struct {
+	ctx   context.Context
+	r     *Renderer
+	dst   *image.RGBA
+	res   *semantic.Resources
+	gs    gstate
+	stack []gstate
+	// base is the matrix mapping the current content stream's default space
+	// to device space; pattern matrices are relative to it.
+	base  coords.Matrix
+	depth int
+
+	path     devicePath
+	clipMode int // pending W (1) or W* (2)
+
+	textClip    polygon
+	textClipped bool
+
+	// colorLocked ignores colour operators (uncoloured patterns and Type 3
+	// glyphs declared with d1).
+	colorLocked bool
+
+	cache *renderCache
+	count int
+}
+
+const (
+	clipNone = iota
+	clipNonZero
+	clipEvenOdd
+)
+
+// renderCache holds decoded resources shared by all interpreters working on
+// one page.
+type renderCache struct {
+	images map[*semantic.XObject]*decodedImage
+	tiles  map[tileKey]*tile
+	forms  map[*semantic.XObject][]semantic.Operation
+}
+
+func newInterp(ctx context.Context, r *Renderer, dst *image.RGBA, base coords.Matrix, res *semantic.Resources) *interp {
+	it := &interp{
+		ctx:  ctx,
+		r:    r,
+		dst:  dst,
+		res:  res,
+		base: base,
+		cache: &renderCache{
+			images: make(map[*semantic.XObject]*decodedImage),
+			tiles:  make(map[tileKey]*tile),
+			forms:  make(map[*semantic.XObject][]semantic.Operation),
+		},
+	}
+	it.gs = defaultState(base)
+	return it
+}
+
+func defaultState(ctm coords.Matrix) gstate {
+	gs := gstate{
+		hScale:      1,
+		miterLimit:  10,
+		fill:        paint{cs: deviceGray, comps: []float64{0}},
+		stroke:      paint{cs: deviceGray, comps: []float64{0}},
+		fillAlpha:   1,
+		strokeAlpha: 1,
+	}
+	gs.CTM = ctm
+	gs.LineWidth = 1
+	gs.TextMatrix = coords.Identity()
+	gs.TextLineMatrix = coords.Identity()
+	return gs
+}
+
+// child returns an interpreter drawing onto dst with a fresh graphics state
+// at the current CTM, sharing caches and nesting depth.
+func (it *interp) child(dst *image.RGBA, res *semantic.Resources) *interp {
+	c := &interp{
+		ctx:         it.ctx,
+		r:           it.r,
+		dst:         dst,
+		res:         res,
+		base:        it.base,
+		depth:       it.depth + 1,
+		cache:       it.cache,
+		colorLocked: it.colorLocked,
+	}
+	c.gs = defaultState(it.gs.CTM)
+	return c
+}
+
+func (it *interp) run(ops []semantic.Operation) error {
+	for i := range ops {
+		if it.count++; it.count&255 == 0 {
+			if err := it.ctx.Err(); err != nil {
+				return err
+			}
+		}
+		it.exec(ops[i])
+	}
+	return it.ctx.Err()
+}
+
+func (it *interp) bounds() image.Rectangle { return it.dst.Rect }
+
+func (it *interp) toDevice(x, y float64) point {
+	p := it.gs.CTM.Transform(coords.Point{X: x, Y: y})
+	return point{p.X, p.Y}
+}
+
+func (it *interp) exec(op semantic.Operation) {
+	args := op.Operands
+	n := numbers(args)
+	switch op.Operator {
+	// Graphics state.
+	case "q":
+		it.stack = append(it.stack, it.gs)
+	case "Q":
+		if k := len(it.stack); k > 0 {
+			tm, tlm := it.gs.TextMatrix, it.gs.TextLineMatrix
+			it.gs = it.stack[k-1]
+			it.stack = it.stack[:k-1]
+			it.gs.TextMatrix, it.gs.TextLineMatrix = tm, tlm
+		}
+	case "cm":
+		if len(n) == 6 {
+			it.gs.CTM = matrixOf(n).Multiply(it.gs.CTM)
+		}
+	case "w":
+		if len(n) == 1 {
+			it.gs.LineWidth = n[0]
+		}
+	case "J":
+		if len(n) == 1 {
+			it.gs.lineCap = contentstream.LineCap(n[0])
+		}
+	case "j":
+		if len(n) == 1 {
+			it.gs.lineJoin = contentstream.LineJoin(n[0])
+		}
+	case "M":
+		if len(n) == 1 {
+			it.gs.miterLimit = n[0]
+		}
+	case "d":
+		if len(args) == 2 {
+			if arr, ok := args[0].(semantic.ArrayOperand); ok {
+				it.gs.dash = numbers(arr.Values)
+				it.gs.dashPhase = number(args[1])
+			}
+		}
+	case "gs":
+		if name, ok := nameArg(args, 0); ok && it.res != nil {
+			if egs, ok := it.res.ExtGStates[name]; ok {
+				it.applyExtGState(egs)
+			}
+		}
+
+	// Path construction.
+	case "m":
+		if len(n) == 2 {
+			it.path.moveTo(it.toDevice(n[0], n[1]))
+		}
+	case "l":
+		if len(n) == 2 {
+			it.path.lineTo(it.toDevice(n[0], n[1]))
+		}
+	case "c":
+		if len(n) == 6 {
+			it.path.curveTo(it.toDevice(n[0], n[1]), it.toDevice(n[2], n[3]), it.toDevice(n[4], n[5]))
+		}
+	case "v":
+		if len(n) == 4 {
+			it.path.curveTo(it.path.cur, it.toDevice(n[0], n[1]), it.toDevice(n[2], n[3]))
+		}
+	case "y":
+		if len(n) == 4 {
+			end := it.toDevice(n[2], n[3])
+			it.path.curveTo(it.toDevice(n[0], n[1]), end, end)
+		}
+	case "h":
+		it.path.closePath()
+	case "re":
+		if len(n) == 4 {
+			x, y, w, h := n[0], n[1], n[2], n[3]
+			it.path.moveTo(it.toDevice(x, y))
+			it.path.lineTo(it.toDevice(x+w, y))
+			it.path.lineTo(it.toDevice(x+w, y+h))
+			it.path.lineTo(it.toDevice(x, y+h))
+			it.path.closePath()
+		}
+
+	// Path painting.
+	case "S":
+		it.strokePath()
+		it.endPath()
+	case "s":
+		it.path.closePath()
+		it.strokePath()
+		it.endPath()
+	case "f", "F":
+		it.fillPath(false)
+		it.endPath()
+	case "f*":
+		it.fillPath(true)
+		it.endPath()
+	case "B":
+		it.fillPath(false)
+		it.strokePath()
+		it.endPath()
+	case "B*":
+		it.fillPath(true)
+		it.strokePath()
+		it.endPath()
+	case "b":
+		it.path.closePath()
+		it.fillPath(false)
+		it.strokePath()
+		it.endPath()
+	case "b*":
+		it.path.closePath()
+		it.fillPath(true)
+		it.strokePath()
+		it.endPath()
+	case "n":
+		it.endPath()
+	case "W":
+		it.clipMode = clipNonZero
+	case "W*":
+		it.clipMode = clipEvenOdd
+
+	// Text.
+	case "BT":
+		it.gs.TextMatrix = coords.Identity()
+		it.gs.TextLineMatrix = coords.Identity()
+		it.textClip = nil
+		it.textClipped = false
+	case "ET":
+		if it.textClipped {
+			it.intersectClip(rasterize(it.textClip, false, it.bounds()))
+			it.textClip = nil
+			it.textClipped = false
+		}
+	case "Tc":
+		if len(n) == 1 {
+			it.gs.charSpacing = n[0]
+		}
+	case "Tw":
+		if len(n) == 1 {
+			it.gs.wordSpacing = n[0]
+		}
+	case "Tz":
+		if len(n) == 1 {
+			it.gs.hScale = n[0] / 100
+		}
+	case "TL":
+		if len(n) == 1 {
+			it.gs.leading = n[0]
+		}
+	case "Ts":
+		if len(n) == 1 {
+			it.gs.rise = n[0]
+		}
+	case "Tr":
+		if len(n) == 1 {
+			it.gs.renderMode = contentstream.TextRenderMode(n[0])
+		}
+	case "Tf":
+		if len(args) == 2 {
+			if name, ok := nameArg(args, 0); ok && it.res != nil {
+				it.gs.Font = it.res.Fonts[name]
+			}
+			it.gs.FontSize = number(args[1])
+		}
+	case "Td":
+		if len(n) == 2 {
+			it.moveText(n[0], n[1])
+		}
+	case "TD":
+		if len(n) == 2 {
+			it.gs.leading = -n[1]
+			it.moveText(n[0], n[1])
+		}
+	case "Tm":
+		if len(n) == 6 {
+			it.gs.TextMatrix = matrixOf(n)
+			it.gs.TextLineMatrix = it.gs.TextMatrix
+		}
+	case "T*":
+		it.moveText(0, -it.gs.leading)
+	case "Tj":
+		if s, ok := stringArg(args, 0); ok {
+			it.showText(s)
+		}
+	case "'":
+		it.moveText(0, -it.gs.leading)
+		if s, ok := stringArg(args, 0); ok {
+			it.showText(s)
+		}
+	case "\"":
+		if len(args) == 3 {
+			it.gs.wordSpacing = number(args[0])
+			it.gs.charSpacing = number(args[1])
+			it.moveText(0, -it.gs.leading)
+			if s, ok := stringArg(args, 2); ok {
+				it.showText(s)
+			}
+		}
+	case "TJ":
+		if len(args) == 1 {
+			if arr, ok := args[0].(semantic.ArrayOperand); ok {
+				for _, v := range arr.Values {
+					switch e := v.(type) {
+					case semantic.StringOperand:
+						it.showText(e.Value)
+					case semantic.NumberOperand:
+						it.adjustText(e.Value)
+					}
+				}
+			}
+		}
+
+	// Type 3 glyph metrics.
+	case "d1":
+		it.colorLocked = true
+
+	// Colour.
+	case "CS":
+		if name, ok := nameArg(args, 0); ok && !it.colorLocked {
+			cs := it.lookupColorSpace(name)
+			it.gs.stroke = paint{cs: cs, comps: initialColor(cs)}
+		}
+	case "cs":
+		if name, ok := nameArg(args, 0); ok && !it.colorLocked {
+			cs := it.lookupColorSpace(name)
+			it.gs.fill = paint{cs: cs, comps: initialColor(cs)}
+		}
+	case "SC", "SCN":
+		if !it.colorLocked {
+			it.setColor(&it.gs.stroke, args)
+		}
+	case "sc", "scn":
+		if !it.colorLocked {
+			it.setColor(&it.gs.fill, args)
+		}
+	case "G":
+		if len(n) == 1 && !it.colorLocked {
+			it.gs.stroke = paint{cs: deviceGray, comps: n}
+		}
+	case "g":
+		if len(n) == 1 && !it.colorLocked {
+			it.gs.fill = paint{cs: deviceGray, comps: n}
+		}
+	case "RG":
+		if len(n) == 3 && !it.colorLocked {
+			it.gs.stroke = paint{cs: deviceRGB, comps: n}
+		}
+	case "rg":
+		if len(n) == 3 && !it.colorLocked {
+			it.gs.fill = paint{cs: deviceRGB, comps: n}
+		}
+	case "K":
+		if len(n) == 4 && !it.colorLocked {
+			it.gs.stroke = paint{cs: deviceCMYK, comps: n}
+		}
+	case "k":
+		if len(n) == 4 && !it.colorLocked {
+			it.gs.fill = paint{cs: deviceCMYK, comps: n}
+		}
+
+	// Shadings, XObjects and inline images.
+	case "sh":
+		if name, ok := nameArg(args, 0); ok && it.res != nil {
+			if sh, ok := it.res.Shadings[name]; ok && sh != nil {
+				it.paintShading(sh)
+			}
+		}
+	case "Do":
+		if name, ok := nameArg(args, 0); ok && it.res != nil {
+			if xo, ok := it.res.XObjects[name]; ok {
+				it.doXObject(&xo)
+			}
+		}
+	case contentstream.InlineImageOperator:
+		if len(args) == 1 {
+			if img, ok := args[0].(semantic.InlineImageOperand); ok {
+				it.drawInlineImage(img)
+			}
+		}
+	}
+}
+
+func (it *interp) moveText(tx, ty float64) {
+	it.gs.TextLineMatrix = coords.Translate(tx, ty).Multiply(it.gs.TextLineMatrix)
+	it.gs.TextMatrix = it.gs.TextLineMatrix
+}
+
+// endPath applies a pending clip and discards the current path.
+func (it *interp) endPath() {
+	if it.clipMode != clipNone {
+		it.intersectClip(rasterize(it.path.fillPolygon(), it.clipMode == clipEvenOdd, it.bounds()))
+		it.clipMode = clipNone
+	}
+	it.path.reset()
+}
+
+// intersectClip narrows the clip to m; a nil m clips everything.
+func (it *interp) intersectClip(m *image.Alpha) {
+	if m == nil {
+		it.gs.clip = image.NewAlpha(image.Rectangle{})
+		return
+	}
+	if it.gs.clip == nil {
+		it.gs.clip = m
+		return
+	}
+	if c := intersectMask(m, it.gs.clip); c != nil {
+		it.gs.clip = c
+	} else {
+		it.gs.clip = image.NewAlpha(image.Rectangle{})
+	}
+}
+
+func (it *interp) fillPath(evenOdd bool) {
+	if it.path.empty() {
+		return
+	}
+	m := rasterize(it.path.fillPolygon(), evenOdd, it.bounds())
+	it.paintMask(m, it.gs.fill, it.gs.fillAlpha)
+}
+
+func (it *interp) strokeStyle() strokeStyle {
+	return strokeStyle{
+		width:      it.gs.LineWidth,
+		cap:        it.gs.lineCap,
+		join:       it.gs.lineJoin,
+		miterLimit: it.gs.miterLimit,
+		dash:       it.gs.dash,
+		dashPhase:  it.gs.dashPhase,
+	}
+}
+
+func (it *interp) strokePath() {
+	if it.path.empty() {
+		return
+	}
+	poly := strokePolygon(&it.path, it.gs.CTM, it.strokeStyle())
+	m := rasterize(poly, false, it.bounds())
+	it.paintMask(m, it.gs.stroke, it.gs.strokeAlpha)
+}
+
+// paintMask paints p through the coverage mask m, honouring the clip.
+func (it *interp) paintMask(m *image.Alpha, p paint, alpha float64) {
+	m = intersectMask(m, it.gs.clip)
+	if m == nil || m.Rect.Empty() {
+		return
+	}
+	src := it.paintSource(p, m.Rect)
+	if src == nil {
+		return
+	}
+	it.composite(m, src, alpha)
+}
+
+// paintSource returns the colour source for p, or nil if p paints nothing.
+func (it *interp) paintSource(p paint, area image.Rectangle) source {
+	if p.pattern != nil {
+		switch pat := p.pattern.(type) {
+		case *semantic.ShadingPattern:
+			if pat.Shading == nil {
+				return nil
+			}
+			return it.shadingSource(pat.Shading, patternMatrix(&pat.BasePattern).Multiply(it.base), area)
+		case *semantic.TilingPattern:
+			var locked *rgb
+			if pat.PaintType == 2 {
+				c, ok := toRGB(p.cs, p.comps)
+				if !ok {
+					return nil
+				}
+				locked = &c
+			}
+			return it.tilingSource(pat, locked)
+		}
+		return nil
+	}
+	c, ok := toRGB(p.cs, p.comps)
+	if !ok {
+		return nil
+	}
+	return solid{c}
+}
+
+func patternMatrix(p *semantic.BasePattern) coords.Matrix {
+	if len(p.Matrix) == 6 {
+		return matrixOf(p.Matrix)
+	}
+	return coords.Identity()
+}
+
+func (it *interp) lookupColorSpace(name string) semantic.ColorSpace {
+	switch canonicalName(name) {
+	case "DeviceGray":
+		return deviceGray
+	case "DeviceRGB":
+		return deviceRGB
+	case "DeviceCMYK":
+		return deviceCMYK
+	}
+	if it.res != nil {
+		if cs, ok := it.res.ColorSpaces[name]; ok && cs != nil {
+			return cs
+		}
+	}
+	if name == "Pattern" {
+		return &semantic.PatternColorSpace{}
+	}
+	return deviceGray
+}
+
+func (it *interp) setColor(p *paint, args []semantic.Operand) {
+	if len(args) > 0 {
+		if name, ok := args[len(args)-1].(semantic.NameOperand); ok {
+			if it.res != nil {
+				p.pattern = it.res.Patterns[name.Value]
+			}
+			p.comps = numbers(args[:len(args)-1])
+			return
+		}
+	}
+	p.pattern = nil
+	p.comps = numbers(args)
+}
+
+func (it *interp) applyExtGState(egs semantic.ExtGState) {
+	if egs.LineWidth != nil {
+		it.gs.LineWidth = *egs.LineWidth
+	}
+	if egs.FillAlpha != nil {
+		it.gs.fillAlpha = pdfnum.Clamp01(*egs.FillAlpha)
+	}
+	if egs.StrokeAlpha != nil {
+		it.gs.strokeAlpha = pdfnum.Clamp01(*egs.StrokeAlpha)
+	}
+	if egs.BlendMode != "" {
+		it.gs.blend = parseBlendMode(egs.BlendMode)
+	}
+	if sm := egs.SoftMask; sm != nil {
+		if sm.Subtype == "None" || sm.Group == nil {
+			it.gs.softMask = nil
+		} else {
+			it.gs.softMask = it.renderSoftMask(sm)
+		}
+	}
+}
+
+// doXObject paints an image or form XObject.
+func (it *interp) doXObject(xo *semantic.XObject) {
+	switch xo.Subtype {
+	case "Image":
+		it.drawImage(xo)
+	case "Form":
+		it.drawForm(xo)
+	}
+}
+
+func (it *interp) formOperations(xo *semantic.XObject) []semantic.Operation {
+	if ops, ok := it.cache.forms[xo]; ok {
+		return ops
+	}
+	ops, _ := contentstream.ParseOperations(xo.Data)
+	it.cache.forms[xo] = ops
+	return ops
+}
+
+func (it *interp) drawForm(xo *semantic.XObject) {
+	if it.depth >= maxFormDepth {
+		return
+	}
+	res := xo.Resources
+	if res == nil {
+		res = it.res
+	}
+	ops := it.formOperations(xo)
+
+	saved := it.gs
+	if len(xo.Matrix) == 6 {
+		it.gs.CTM = matrixOf(xo.Matrix).Multiply(it.gs.CTM)
+	}
+	if bb := xo.BBox; bb.URX != bb.LLX && bb.URY != bb.LLY {
+		it.path.reset()
+		it.path.moveTo(it.toDevice(bb.LLX, bb.LLY))
+		it.path.lineTo(it.toDevice(bb.URX, bb.LLY))
+		it.path.lineTo(it.toDevice(bb.URX, bb.URY))
+		it.path.lineTo(it.toDevice(bb.LLX, bb.URY))
+		it.path.closePath()
+		it.intersectClip(rasterize(it.path.fillPolygon(), false, it.bounds()))
+		it.path.reset()
+	}
+
+	group := xo.Group != nil && (it.gs.fillAlpha < 1 || it.gs.blend != blendNormal || it.gs.softMask != nil)
+	if group {
+		it.drawGroup(ops, res)
+	} else {
+		sub := it.child(it.dst, res)
+		sub.base = it.gs.CTM
+		sub.gs = it.gs
+		sub.gs.TextMatrix = coords.Identity()
+		sub.gs.TextLineMatrix = coords.Identity()
+		_ = sub.run(ops)
+	}
+	it.gs = saved
+}
+
+// drawGroup renders ops into an isolated layer and composites the result
+// with the current alpha, blend mode and soft mask.
+func (it *interp) drawGroup(ops []semantic.Operation, res *semantic.Resources) {
+	area := it.bounds()
+	if it.gs.clip != nil {
+		area = area.Intersect(it.gs.clip.Rect)
+	}
+	if area.Empty() {
+		return
+	}
+	layer := image.NewRGBA(area)
+	sub := it.child(layer, res)
+	sub.base = it.gs.CTM
+	sub.gs = it.gs
+	sub.gs.fillAlpha, sub.gs.strokeAlpha = 1, 1
+	sub.gs.blend = blendNormal
+	sub.gs.softMask = nil
+	sub.gs.TextMatrix = coords.Identity()
+	sub.gs.TextLineMatrix = coords.Identity()
+	_ = sub.run(ops)
+
+	m := image.NewAlpha(area)
+	for i := range m.Pix {
+		m.Pix[i] = 0xff
+	}
+	if mm := intersectMask(m, it.gs.clip); mm != nil {
+		it.composite(mm, layerSource{layer}, it.gs.fillAlpha)
+	}
+}
+
+// renderSoftMask renders the soft mask group to a device-sized mask using
+// the CTM in effect when the ExtGState is applied.
+func (it *interp) renderSoftMask(sm *semantic.SoftMaskDict) *image.Alpha {
+	if it.depth >= maxFormDepth {
+		return nil
+	}
+	g := sm.Group
+	area := it.bounds()
+	layer := image.NewRGBA(area)
+	byLuminosity := sm.Subtype != "Alpha"
+	var cs semantic.ColorSpace = deviceGray
+	if g.Group != nil && g.Group.CS != nil {
+		cs = g.Group.CS
+	}
+	if byLuminosity {
+		bc := sm.BackdropColor
+		if len(bc) == 0 {
+			bc = make([]float64, numComponents(cs))
+		}
+		c, _ := toRGB(cs, bc)
+		fillRGBA(layer, c)
+	}
+	res := g.Resources
+	if res == nil {
+		res = it.res
+	}
+	sub := it.child(layer, res)
+	sub.base = it.gs.CTM
+	sub.colorLocked = false
+	sub.drawForm(g)
+
+	transfer := transferTable(sm.TransferFunction)
+	m := image.NewAlpha(area)
+	for i := 0; i < len(m.Pix); i++ {
+		px := layer.Pix[i*4 : i*4+4]
+		if byLuminosity {
+			c := rgb{float64(px[0]) / 255, float64(px[1]) / 255, float64(px[2]) / 255}
+			m.Pix[i] = uint8(lum(c)*255 + 0.5)
+		} else {
+			m.Pix[i] = px[3]
+		}
+		if transfer != nil {
+			m.Pix[i] = transfer[m.Pix[i]]
+		}
+	}
+	return m
+}
+
+// transferTable samples a 1-in, 1-out transfer function at every 8-bit
+// value; it returns nil for the identity or an unusable function.
+func transferTable(fn semantic.Function) *[256]uint8 {
+	if fn == nil {
+		return nil
+	}
+	eval, err := function.Compile(fn)
+	if err != nil || eval.Inputs() != 1 || eval.Outputs() < 1 {
+		return nil
+	}
+	var t [256]uint8
+	for v := range t {
+		out, err := eval.Eval([]float64{float64(v) / 255})
+		if err != nil {
+			return nil
+		}
+		t[v] = to8(out[0])
+	}
+	return &t
+}
+
+func fillRGBA(img *image.RGBA, c rgb) {
+	px := [4]uint8{uint8(c.R*255 + 0.5), uint8(c.G*255 + 0.5), uint8(c.B*255 + 0.5), 0xff}
+	for i := 0; i < len(img.Pix); i += 4 {
+		copy(img.Pix[i:i+4], px[:])
+	}
+}
+
+// Operand helpers.
+
+func numbers(ops []semantic.Operand) []float64 {
+	out := make([]float64, 0, len(ops))
+	for _, o := range ops {
+		if n, ok := o.(semantic.NumberOperand); ok {
+			out = append(out, n.Value)
+		}
+	}
+	return out
+}
+
+func number(o semantic.Operand) float64 {
+	if n, ok := o.(semantic.NumberOperand); ok {
+		return n.Value
+	}
+	return 0
+}
+
+func nameArg(ops []semantic.Operand, i int) (string, bool) {
+	if i < len(ops) {
+		if n, ok := ops[i].(semantic.NameOperand); ok {
+			return n.Value, true
+		}
+	}
+	return "", false
+}
+
+func stringArg(ops []semantic.Operand, i int) ([]byte, bool) {
+	if i < len(ops) {
+		if s, ok := ops[i].(semantic.StringOperand); ok {
+			return s.Value, true
+		}
+	}
+	return nil, false
+}
+
+func matrixOf(v []float64) coords.Matrix {
+	return coords.Matrix{v[0], v[1], v[2], v[3], v[4], v[5]}
+}
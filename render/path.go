@@ -0,0 +1,416 @@
+package render
+
+import (
+	"math"
+
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/coords"
+)
+
+// flattenTolerance is the maximum deviation, in device pixels, between a
+// curve and its polyline approximation.
+const flattenTolerance = 0.2
+
+// devicePath accumulates a path in device space. The current transformation
+// matrix cannot change while a path is under construction, so transforming
+// points eagerly is exact.
+type devicePath struct {
+	subpaths []subpath
+	cur      point
+	start    point
+	has      bool
+}
+
+type subpath struct {
+	pts    []point
+	closed bool
+}
+
+func (p *devicePath) reset() { *p = devicePath{} }
+
+func (p *devicePath) empty() bool { return len(p.subpaths) == 0 }
+
+func (p *devicePath) moveTo(pt point) {
+	if n := len(p.subpaths); n > 0 && len(p.subpaths[n-1].pts) == 1 && !p.subpaths[n-1].closed {
+		p.subpaths = p.subpaths[:n-1]
+	}
+	p.subpaths = append(p.subpaths, subpath{pts: []point{pt}})
+	p.cur, p.start, p.has = pt, pt, true
+}
+
+func (p *devicePath) lineTo(pt point) {
+	if !p.has {
+		p.moveTo(pt)
+		return
+	}
+	p.ensureOpen()
+	sp := &p.subpaths[len(p.subpaths)-1]
+	sp.pts = append(sp.pts, pt)
+	p.cur = pt
+}
+
+func (p *devicePath) curveTo(c1, c2, end point) {
+	if !p.has {
+		p.moveTo(c1)
+	}
+	p.ensureOpen()
+	sp := &p.subpaths[len(p.subpaths)-1]
+	sp.pts = flattenCubic(sp.pts, p.cur, c1, c2, end)
+	p.cur = end
+}
+
+func (p *devicePath) quadTo(c, end point) {
+	c1 := point{p.cur.X + 2.0/3*(c.X-p.cur.X), p.cur.Y + 2.0/3*(c.Y-p.cur.Y)}
+	c2 := point{end.X + 2.0/3*(c.X-end.X), end.Y + 2.0/3*(c.Y-end.Y)}
+	p.curveTo(c1, c2, end)
+}
+
+func (p *devicePath) closePath() {
+	if !p.has || len(p.subpaths) == 0 {
+		return
+	}
+	sp := &p.subpaths[len(p.subpaths)-1]
+	if !sp.closed {
+		sp.closed = true
+	}
+	p.cur = p.start
+}
+
+// ensureOpen starts a new subpath at the current point after a closepath.
+func (p *devicePath) ensureOpen() {
+	if len(p.subpaths) == 0 || p.subpaths[len(p.subpaths)-1].closed {
+		p.subpaths = append(p.subpaths, subpath{pts: []point{p.cur}})
+		p.start = p.cur
+	}
+}
+
+// fillPolygon returns the implicitly closed contours used for filling.
+func (p *devicePath) fillPolygon() polygon {
+	poly := make(polygon, 0, len(p.subpaths))
+	for _, sp := range p.subpaths {
+		if len(sp.pts) >= 2 {
+			poly = append(poly, sp.pts)
+		}
+	}
+	return poly
+}
+
+func flattenCubic(dst []point, p0, p1, p2, p3 point) []point {
+	ddx := math.Max(math.Abs(p0.X-2*p1.X+p2.X), math.Abs(p1.X-2*p2.X+p3.X))
+	ddy := math.Max(math.Abs(p0.Y-2*p1.Y+p2.Y), math.Abs(p1.Y-2*p2.Y+p3.Y))
+	dd := math.Hypot(ddx, ddy)
+	n := int(math.Ceil(math.Sqrt(0.75 * dd / flattenTolerance)))
+	if n < 1 {
+		n = 1
+	}
+	if n > 512 {
+		n = 512
+	}
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		mt := 1 - t
+		a, b, c, d := mt*mt*mt, 3*mt*mt*t, 3*mt*t*t, t*t*t
+		dst = append(dst, point{
+			a*p0.X + b*p1.X + c*p2.X + d*p3.X,
+			a*p0.Y + b*p1.Y + c*p2.Y + d*p3.Y,
+		})
+	}
+	return dst
+}
+
+// strokeStyle carries the stroke parameters in user space.
+type strokeStyle struct {
+	width      float64
+	cap        contentstream.LineCap
+	join       contentstream.LineJoin
+	miterLimit float64
+	dash       []float64
+	dashPhase  float64
+}
+
+// strokePolygon converts the path outline into fill contours. Stroking runs
+// in user space (through the inverse CTM) so that non-uniform scaling
+// distorts the pen exactly as the PDF imaging model requires.
+func strokePolygon(p *devicePath, ctm coords.Matrix, st strokeStyle) polygon {
+	inv, err := ctm.Inverse()
+	if err != nil {
+		return nil
+	}
+	devScale := math.Sqrt(math.Abs(ctm[0]*ctm[3] - ctm[1]*ctm[2]))
+	hw := st.width / 2
+	if st.width*devScale < 1 && devScale > 0 {
+		// Thin lines render at least one device pixel wide.
+		hw = 0.5 / devScale
+	}
+	s := &stroker{hw: hw, st: st, devScale: devScale}
+	for _, sp := range p.subpaths {
+		pts := make([]point, 0, len(sp.pts))
+		for _, pt := range sp.pts {
+			u := inv.Transform(coords.Point{X: pt.X, Y: pt.Y})
+			pts = append(pts, point{u.X, u.Y})
+		}
+		pts = dedupe(pts)
+		if len(st.dash) > 0 {
+			for _, seg := range applyDash(pts, sp.closed, st.dash, st.dashPhase) {
+				s.polyline(seg, false)
+			}
+			continue
+		}
+		s.polyline(pts, sp.closed)
+	}
+	for _, c := range s.out {
+		for i, pt := range c {
+			d := ctm.Transform(coords.Point{X: pt.X, Y: pt.Y})
+			c[i] = point{d.X, d.Y}
+		}
+	}
+	return s.out
+}
+
+func dedupe(pts []point) []point {
+	if len(pts) < 2 {
+		return pts
+	}
+	out := pts[:1]
+	for _, p := range pts[1:] {
+		last := out[len(out)-1]
+		if math.Abs(p.X-last.X) > 1e-9 || math.Abs(p.Y-last.Y) > 1e-9 {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+type stroker struct {
+	hw       float64
+	st       strokeStyle
+	devScale float64
+	out      polygon
+}
+
+// emit appends a contour with counter-clockwise orientation so that
+// overlapping pieces never cancel under the nonzero rule.
+func (s *stroker) emit(c []point) {
+	if len(c) < 3 {
+		return
+	}
+	var area float64
+	for i := range c {
+		j := (i + 1) % len(c)
+		area += c[i].X*c[j].Y - c[j].X*c[i].Y
+	}
+	if area < 0 {
+		for i, j := 0, len(c)-1; i < j; i, j = i+1, j-1 {
+			c[i], c[j] = c[j], c[i]
+		}
+	}
+	s.out = append(s.out, c)
+}
+
+func (s *stroker) circle(c point) {
+	r := s.hw
+	n := int(math.Ceil(math.Pi / math.Acos(math.Max(-1, 1-flattenTolerance/math.Max(r*s.devScale, 1e-6)))))
+	if n < 8 {
+		n = 8
+	}
+	if n > 256 {
+		n = 256
+	}
+	pts := make([]point, n)
+	for i := range pts {
+		a := 2 * math.Pi * float64(i) / float64(n)
+		pts[i] = point{c.X + r*math.Cos(a), c.Y + r*math.Sin(a)}
+	}
+	s.emit(pts)
+}
+
+func (s *stroker) polyline(pts []point, closed bool) {
+	pts = dedupe(pts)
+	if len(pts) == 0 {
+		return
+	}
+	if len(pts) == 1 {
+		// Zero-length subpaths only paint with round or square caps.
+		switch s.st.cap {
+		case contentstream.LineCapRound:
+			s.circle(pts[0])
+		case contentstream.LineCapSquare:
+			p, h := pts[0], s.hw
+			s.emit([]point{{p.X - h, p.Y - h}, {p.X + h, p.Y - h}, {p.X + h, p.Y + h}, {p.X - h, p.Y + h}})
+		}
+		return
+	}
+	if closed && len(pts) > 2 {
+		if first, last := pts[0], pts[len(pts)-1]; math.Abs(first.X-last.X) < 1e-9 && math.Abs(first.Y-last.Y) < 1e-9 {
+			pts = pts[:len(pts)-1]
+		}
+	}
+	n := len(pts)
+	segs := n - 1
+	if closed {
+		segs = n
+	}
+	for i := 0; i < segs; i++ {
+		a, b := pts[i], pts[(i+1)%n]
+		nx, ny := normal(a, b, s.hw)
+		s.emit([]point{{a.X + nx, a.Y + ny}, {b.X + nx, b.Y + ny}, {b.X - nx, b.Y - ny}, {a.X - nx, a.Y - ny}})
+	}
+	// Joins.
+	for i := 0; i < n; i++ {
+		if !closed && (i == 0 || i == n-1) {
+			continue
+		}
+		prev, cur, next := pts[(i-1+n)%n], pts[i], pts[(i+1)%n]
+		s.join(prev, cur, next)
+	}
+	if !closed {
+		s.capAt(pts[0], pts[1])
+		s.capAt(pts[n-1], pts[n-2])
+	}
+}
+
+func normal(a, b point, hw float64) (float64, float64) {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	l := math.Hypot(dx, dy)
+	if l == 0 {
+		return 0, 0
+	}
+	return -dy / l * hw, dx / l * hw
+}
+
+func (s *stroker) join(prev, cur, next point) {
+	n1x, n1y := normal(prev, cur, s.hw)
+	n2x, n2y := normal(cur, next, s.hw)
+	// Turn direction decides which side is the outer corner.
+	cross := (cur.X-prev.X)*(next.Y-cur.Y) - (cur.Y-prev.Y)*(next.X-cur.X)
+	if math.Abs(cross) < 1e-12 {
+		dot := (cur.X-prev.X)*(next.X-cur.X) + (cur.Y-prev.Y)*(next.Y-cur.Y)
+		if dot >= 0 {
+			return // collinear continuation
+		}
+	}
+	if cross > 0 {
+		n1x, n1y, n2x, n2y = -n1x, -n1y, -n2x, -n2y
+	}
+	a := point{cur.X + n1x, cur.Y + n1y}
+	b := point{cur.X + n2x, cur.Y + n2y}
+	switch s.st.join {
+	case contentstream.LineJoinRound:
+		s.circle(cur)
+	case contentstream.LineJoinMiter:
+		// Miter length ratio is 1/sin(theta/2) for the angle theta between segments.
+		d1x, d1y := cur.X-prev.X, cur.Y-prev.Y
+		d2x, d2y := next.X-cur.X, next.Y-cur.Y
+		l1, l2 := math.Hypot(d1x, d1y), math.Hypot(d2x, d2y)
+		if l1 > 0 && l2 > 0 {
+			cosT := -(d1x*d2x + d1y*d2y) / (l1 * l2)
+			theta := math.Acos(clampF(cosT, -1, 1))
+			limit := s.st.miterLimit
+			if limit <= 0 {
+				limit = 10
+			}
+			if sin := math.Sin(theta / 2); sin > 1e-9 && 1/sin <= limit {
+				bx, by := (n1x+n2x)/2, (n1y+n2y)/2
+				bl := math.Hypot(bx, by)
+				if bl > 1e-12 {
+					ml := s.hw / sin
+					tip := point{cur.X + bx/bl*ml, cur.Y + by/bl*ml}
+					s.emit([]point{cur, a, tip, b})
+					return
+				}
+			}
+		}
+		s.emit([]point{cur, a, b})
+	default:
+		s.emit([]point{cur, a, b})
+	}
+}
+
+// capAt adds the cap at end, where from is the adjacent point.
+func (s *stroker) capAt(end, from point) {
+	switch s.st.cap {
+	case contentstream.LineCapRound:
+		s.circle(end)
+	case contentstream.LineCapSquare:
+		dx, dy := end.X-from.X, end.Y-from.Y
+		l := math.Hypot(dx, dy)
+		if l == 0 {
+			return
+		}
+		ex, ey := dx/l*s.hw, dy/l*s.hw
+		nx, ny := -ey, ex
+		s.emit([]point{
+			{end.X + nx, end.Y + ny}, {end.X + nx + ex, end.Y + ny + ey},
+			{end.X - nx + ex, end.Y - ny + ey}, {end.X - nx, end.Y - ny},
+		})
+	}
+}
+
+// applyDash splits a polyline into the "on" intervals of the dash pattern.
+func applyDash(pts []point, closed bool, dash []float64, phase float64) [][]point {
+	var total float64
+	for _, d := range dash {
+		if d < 0 {
+			return [][]point{pts}
+		}
+		total += d
+	}
+	if total <= 0 {
+		return [][]point{pts}
+	}
+	if closed && len(pts) > 1 {
+		pts = append(append([]point{}, pts...), pts[0])
+	}
+	// Locate the starting dash entry for the phase.
+	idx := 0
+	on := true
+	remaining := dash[0]
+	phase = math.Mod(phase, total*float64(1+len(dash)%2))
+	if phase < 0 {
+		phase += total
+	}
+	for phase > 0 {
+		if phase < remaining {
+			remaining -= phase
+			break
+		}
+		phase -= remaining
+		idx = (idx + 1) % len(dash)
+		on = !on
+		remaining = dash[idx]
+	}
+
+	var out [][]point
+	var cur []point
+	if on {
+		cur = []point{pts[0]}
+	}
+	for i := 0; i+1 < len(pts); i++ {
+		a, b := pts[i], pts[i+1]
+		segLen := math.Hypot(b.X-a.X, b.Y-a.Y)
+		pos := 0.0
+		for segLen-pos > remaining {
+			pos += remaining
+			t := pos / segLen
+			p := point{a.X + (b.X-a.X)*t, a.Y + (b.Y-a.Y)*t}
+			if on {
+				cur = append(cur, p)
+				out = append(out, cur)
+				cur = nil
+			} else {
+				cur = []point{p}
+			}
+			on = !on
+			idx = (idx + 1) % len(dash)
+			remaining = dash[idx]
+		}
+		remaining -= segLen - pos
+		if on {
+			cur = append(cur, b)
+		}
+	}
+	if on && len(cur) > 0 {
+		out = append(out, cur)
+	}
+	return out
+}
@@ -0,0 +1,205 @@
+package render
+
+import (
+	"image"
+	"math"
+)
+
+// point is a device-space coordinate.
+type point struct{ X, Y float64 }
+
+// polygon is a set of closed contours in device space.
+type polygon [][]point
+
+func (p polygon) bounds() (minX, minY, maxX, maxY float64, ok bool) {
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+	for _, c := range p {
+		for _, pt := range c {
+			minX = math.Min(minX, pt.X)
+			minY = math.Min(minY, pt.Y)
+			maxX = math.Max(maxX, pt.X)
+			maxY = math.Max(maxY, pt.Y)
+		}
+	}
+	return minX, minY, maxX, maxY, minX <= maxX && minY <= maxY
+}
+
+// rasterizer computes exact-area anti-aliased coverage by accumulating
+// signed edge areas per cell and integrating along each row.
+type rasterizer struct {
+	rect image.Rectangle
+	w    int
+	acc  []float32
+}
+
+func newRasterizer(rect image.Rectangle) *rasterizer {
+	w := rect.Dx()
+	return &rasterizer{rect: rect, w: w, acc: make([]float32, (w+2)*rect.Dy())}
+}
+
+func (r *rasterizer) addPolygon(p polygon) {
+	for _, c := range p {
+		n := len(c)
+		if n < 2 {
+			continue
+		}
+		for i := 0; i < n; i++ {
+			a, b := c[i], c[(i+1)%n]
+			r.line(a.X, a.Y, b.X, b.Y)
+		}
+	}
+}
+
+// line deposits one edge. Coordinates are clamped horizontally to the
+// raster; this keeps coverage inside the raster exact.
+func (r *rasterizer) line(x0, y0, x1, y1 float64) {
+	ox, oy := float64(r.rect.Min.X), float64(r.rect.Min.Y)
+	x0, y0, x1, y1 = x0-ox, y0-oy, x1-ox, y1-oy
+	if y0 == y1 || math.IsNaN(x0+y0+x1+y1) {
+		return
+	}
+	dir := float32(1)
+	if y0 > y1 {
+		dir = -1
+		x0, y0, x1, y1 = x1, y1, x0, y0
+	}
+	h := float64(r.rect.Dy())
+	if y1 <= 0 || y0 >= h {
+		return
+	}
+	dxdy := (x1 - x0) / (y1 - y0)
+	x := x0
+	if y0 < 0 {
+		x -= y0 * dxdy
+		y0 = 0
+	}
+	if y1 > h {
+		y1 = h
+	}
+	fw := float64(r.w)
+	stride := r.w + 2
+	for y := int(y0); y < int(math.Ceil(y1)) && y < r.rect.Dy(); y++ {
+		fy := float64(y)
+		dy := math.Min(fy+1, y1) - math.Max(fy, y0)
+		xnext := x + dxdy*dy
+		d := float32(dy) * dir
+		xa, xb := clampF(x, 0, fw), clampF(xnext, 0, fw)
+		if xa > xb {
+			xa, xb = xb, xa
+		}
+		row := r.acc[y*stride : (y+1)*stride]
+		x0f := math.Floor(xa)
+		x0i := int(x0f)
+		x1c := math.Ceil(xb)
+		x1i := int(x1c)
+		if x1i <= x0i+1 {
+			xmf := float32(0.5*(xa+xb) - x0f)
+			row[x0i] += d - d*xmf
+			row[x0i+1] += d * xmf
+		} else {
+			s := float32(1 / (xb - xa))
+			fx0 := float32(xa - x0f)
+			a0 := 0.5 * s * (1 - fx0) * (1 - fx0)
+			fx1 := float32(xb - x1c + 1)
+			am := 0.5 * s * fx1 * fx1
+			row[x0i] += d * a0
+			if x1i == x0i+2 {
+				row[x0i+1] += d * (1 - a0 - am)
+			} else {
+				a1 := s * (1.5 - fx0)
+				row[x0i+1] += d * (a1 - a0)
+				for xi := x0i + 2; xi < x1i-1; xi++ {
+					row[xi] += d * s
+				}
+				a2 := a1 + float32(x1i-x0i-3)*s
+				row[x1i-1] += d * (1 - a2 - am)
+			}
+			if x1i < len(row) {
+				row[x1i] += d * am
+			}
+		}
+		x = xnext
+	}
+}
+
+// mask integrates the accumulated areas into an alpha mask.
+func (r *rasterizer) mask(evenOdd bool) *image.Alpha {
+	m := image.NewAlpha(r.rect)
+	stride := r.w + 2
+	for y := 0; y < r.rect.Dy(); y++ {
+		row := r.acc[y*stride : (y+1)*stride]
+		out := m.Pix[y*m.Stride : y*m.Stride+r.w]
+		var sum float32
+		for x := 0; x < r.w; x++ {
+			sum += row[x]
+			v := sum
+			if v < 0 {
+				v = -v
+			}
+			if evenOdd {
+				v = float32(math.Mod(float64(v), 2))
+				if v > 1 {
+					v = 2 - v
+				}
+			} else if v > 1 {
+				v = 1
+			}
+			out[x] = uint8(v*255 + 0.5)
+		}
+	}
+	return m
+}
+
+func clampF(v, lo, hi float64) float64 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// rasterize fills p with the given rule, restricted to limit. It returns nil
+// when nothing is covered.
+func rasterize(p polygon, evenOdd bool, limit image.Rectangle) *image.Alpha {
+	minX, minY, maxX, maxY, ok := p.bounds()
+	if !ok {
+		return nil
+	}
+	rect := image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX))+1, int(math.Ceil(maxY))+1).Intersect(limit)
+	if rect.Empty() {
+		return nil
+	}
+	r := newRasterizer(rect)
+	r.addPolygon(p)
+	return r.mask(evenOdd)
+}
+
+// intersectMask multiplies m by clip in place; both share device space. A
+// nil clip leaves m unchanged.
+func intersectMask(m, clip *image.Alpha) *image.Alpha {
+	if m == nil || clip == nil {
+		return m
+	}
+	rect := m.Rect.Intersect(clip.Rect)
+	if rect.Empty() {
+		return nil
+	}
+	out := image.NewAlpha(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		mi := m.PixOffset(rect.Min.X, y)
+		ci := clip.PixOffset(rect.Min.X, y)
+		oi := out.PixOffset(rect.Min.X, y)
+		for x := 0; x < rect.Dx(); x++ {
+			out.Pix[oi+x] = mul8(m.Pix[mi+x], clip.Pix[ci+x])
+		}
+	}
+	return out
+}
+
+func mul8(a, b uint8) uint8 {
+	v := uint32(a)*uint32(b) + 128
+	return uint8((v + v>>8) >> 8)
+}
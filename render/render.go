@@ -0,0 +1,194 @@
+// Package render rasterizes semantic pages into RGBA images.
+//
+// The renderer executes page content streams against a model of the PDF
+// graphics state built on contentstream.GraphicsState/TextState and
+// coords.Matrix. It covers path painting, embedded font outlines (TrueType,
+// CFF, Type 1 and Type 3), images decoded through filters.Pipeline,
+// shadings and patterns, clipping, and the transparency features modelled by
+// semantic.ExtGState (constant alpha, blend modes and soft masks).
+package render
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"sync"
+
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/coords"
+	"github.com/wudi/pdfkit/filters"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// Box selects the page boundary that defines the rendered area.
+type Box int
+
+const (
+	// CropBox renders the visible page region (falling back to MediaBox).
+	CropBox Box = iota
+	// MediaBox renders the full media box.
+	MediaBox
+)
+
+// Options configures a Renderer.
+type Options struct {
+	DPI        float64     // Output resolution; 72 when zero.
+	Background color.Color // Page background; white when nil. Use color.Transparent for none.
+	Box        Box         // Page boundary to render.
+	// MaxPixels bounds the output size (width*height); 0 means 100 megapixels.
+	MaxPixels int
+}
+
+// Renderer turns semantic pages into images. A Renderer is safe for
+// concurrent use; decoded font programs are cached across pages.
+type Renderer struct {
+	opts     Options
+	pipeline *filters.Pipeline
+
+	mu    sync.Mutex
+	fonts map[*semantic.Font]*fontFace
+}
+
+const (
+	defaultDPI       = 72
+	defaultMaxPixels = 100 << 20
+	maxFormDepth     = 16
+)
+
+// ErrPageTooLarge is returned when the requested output exceeds MaxPixels.
+var ErrPageTooLarge = errors.New("render: page too large")
+
+// New creates a renderer with the given options.
+func New(opts Options) *Renderer {
+	if opts.DPI <= 0 {
+		opts.DPI = defaultDPI
+	}
+	if opts.MaxPixels <= 0 {
+		opts.MaxPixels = defaultMaxPixels
+	}
+	return &Renderer{
+		opts: opts,
+		pipeline: filters.NewPipeline([]filters.Decoder{
+			filters.NewFlateDecoder(),
+			filters.NewLZWDecoder(),
+			filters.NewRunLengthDecoder(),
+			filters.NewASCII85Decoder(),
+			filters.NewASCIIHexDecoder(),
+			filters.NewDCTDecoder(),
+			filters.NewJPXDecoder(),
+			filters.NewCCITTFaxDecoder(),
+			filters.NewJBIG2Decoder(),
+		}, filters.Limits{MaxDecompressedSize: 256 << 20}),
+		fonts: make(map[*semantic.Font]*fontFace),
+	}
+}
+
+// RenderPage rasterizes page using its own Resources.
+func (r *Renderer) RenderPage(ctx context.Context, page *semantic.Page) (*image.RGBA, error) {
+	if page == nil {
+		return nil, errors.New("render: nil page")
+	}
+	if err := page.Load(ctx); err != nil {
+		return nil, err
+	}
+	return r.RenderPageWithResources(ctx, page, page.Resources)
+}
+
+// RenderPageWithResources rasterizes page resolving resource names against
+// res, which is useful when resources are inherited or supplied separately.
+func (r *Renderer) RenderPageWithResources(ctx context.Context, page *semantic.Page, res *semantic.Resources) (*image.RGBA, error) {
+	if page == nil {
+		return nil, errors.New("render: nil page")
+	}
+	if err := page.Load(ctx); err != nil {
+		return nil, err
+	}
+	box := pageBox(page, r.opts.Box)
+	bw, bh := box.URX-box.LLX, box.URY-box.LLY
+	if bw <= 0 || bh <= 0 {
+		return nil, errors.New("render: empty page box")
+	}
+	unit := page.UserUnit
+	if unit <= 0 {
+		unit = 1
+	}
+	scale := r.opts.DPI / 72 * unit
+	w0 := int(math.Ceil(bw*scale - 1e-6))
+	h0 := int(math.Ceil(bh*scale - 1e-6))
+	if w0 < 1 {
+		w0 = 1
+	}
+	if h0 < 1 {
+		h0 = 1
+	}
+	if w0*h0 > r.opts.MaxPixels || w0 > 1<<16 || h0 > 1<<16 {
+		return nil, ErrPageTooLarge
+	}
+
+	// Default user space to device space: flip Y, then apply /Rotate
+	// clockwise about the page.
+	base := coords.Translate(-box.LLX, -box.LLY).
+		Multiply(coords.Scale(scale, -scale)).
+		Multiply(coords.Translate(0, float64(h0)))
+	w, h := w0, h0
+	switch ((page.Rotate % 360) + 360) % 360 {
+	case 90:
+		base = base.Multiply(coords.Matrix{0, 1, -1, 0, float64(h0), 0})
+		w, h = h0, w0
+	case 180:
+		base = base.Multiply(coords.Matrix{-1, 0, 0, -1, float64(w0), float64(h0)})
+	case 270:
+		base = base.Multiply(coords.Matrix{0, -1, 1, 0, 0, float64(w0)})
+		w, h = h0, w0
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	bg := r.opts.Background
+	if bg == nil {
+		bg = color.White
+	}
+	if cr, cg, cb, ca := bg.RGBA(); ca != 0 {
+		px := [4]uint8{uint8(cr >> 8), uint8(cg >> 8), uint8(cb >> 8), uint8(ca >> 8)}
+		for i := 0; i < len(img.Pix); i += 4 {
+			copy(img.Pix[i:i+4], px[:])
+		}
+	}
+
+	ops, err := contentstream.PageOperations(page)
+	if err != nil && len(ops) == 0 {
+		return img, err
+	}
+	it := newInterp(ctx, r, img, base, res)
+	if err := it.run(ops); err != nil {
+		return img, err
+	}
+	return img, nil
+}
+
+func pageBox(page *semantic.Page, which Box) semantic.Rectangle {
+	box := page.MediaBox
+	if which == CropBox && page.CropBox.URX > page.CropBox.LLX && page.CropBox.URY > page.CropBox.LLY {
+		box = page.CropBox
+	}
+	if box.URX < box.LLX {
+		box.LLX, box.URX = box.URX, box.LLX
+	}
+	if box.URY < box.LLY {
+		box.LLY, box.URY = box.URY, box.LLY
+	}
+	return box
+}
+
+// face returns the cached glyph source for font.
+func (r *Renderer) face(font *semantic.Font) *fontFace {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.fonts[font]; ok {
+		return f
+	}
+	f := loadFontFace(font)
+	r.fonts[font] = f
+	return f
+}
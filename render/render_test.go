@@ -0,0 +1,437 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+
+	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/cmm"
+	"github.com/wudi/pdfkit/filters"
+	"github.com/wudi/pdfkit/fonts"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+func op(name string, args ...interface{}) semantic.Operation {
+	operands := make([]semantic.Operand, len(args))
+	for i, a := range args {
+		switch v := a.(type) {
+		case int:
+			operands[i] = semantic.NumberOperand{Value: float64(v)}
+		case float64:
+			operands[i] = semantic.NumberOperand{Value: v}
+		case string:
+			operands[i] = semantic.NameOperand{Value: v}
+		case semantic.Operand:
+			operands[i] = v
+		}
+	}
+	return semantic.Operation{Operator: name, Operands: operands}
+}
+
+func testPage(w, h float64, res *semantic.Resources, ops ...semantic.Operation) *semantic.Page {
+	return &semantic.Page{
+		MediaBox:  semantic.Rectangle{URX: w, URY: h},
+		Resources: res,
+		Contents:  []semantic.ContentStream{{Operations: ops}},
+	}
+}
+
+func render(t *testing.T, opts Options, page *semantic.Page) *image.RGBA {
+	t.Helper()
+	img, err := New(opts).RenderPage(context.Background(), page)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	return img
+}
+
+func near(c color.RGBA, r, g, b uint8) bool {
+	d := func(x, y uint8) int {
+		if x > y {
+			return int(x - y)
+		}
+		return int(y - x)
+	}
+	return d(c.R, r) <= 3 && d(c.G, g) <= 3 && d(c.B, b) <= 3
+}
+
+func TestRenderFillRect(t *testing.T) {
+	page := testPage(100, 100, nil,
+		op("rg", 1, 0, 0),
+		op("re", 10, 10, 30, 30),
+		op("f"),
+	)
+	img := render(t, Options{}, page)
+	if img.Rect.Dx() != 100 || img.Rect.Dy() != 100 {
+		t.Fatalf("size = %v", img.Rect)
+	}
+	// User space is Y-up: the square sits near the bottom-left corner.
+	if c := img.RGBAAt(25, 75); !near(c, 255, 0, 0) {
+		t.Fatalf("inside fill = %v", c)
+	}
+	if c := img.RGBAAt(25, 25); !near(c, 255, 255, 255) {
+		t.Fatalf("outside fill = %v", c)
+	}
+	// Edges aligned to pixel boundaries are crisp.
+	if c := img.RGBAAt(10, 89); !near(c, 255, 0, 0) {
+		t.Fatalf("edge pixel = %v", c)
+	}
+	if c := img.RGBAAt(9, 89); !near(c, 255, 255, 255) {
+		t.Fatalf("pixel outside edge = %v", c)
+	}
+
+	img = render(t, Options{DPI: 144}, page)
+	if img.Rect.Dx() != 200 || img.Rect.Dy() != 200 {
+		t.Fatalf("size at 144 DPI = %v", img.Rect)
+	}
+	if c := img.RGBAAt(50, 150); !near(c, 255, 0, 0) {
+		t.Fatalf("inside fill at 144 DPI = %v", c)
+	}
+}
+
+func TestRenderStrokeAndEvenOdd(t *testing.T) {
+	page := testPage(100, 100, nil,
+		op("RG", 0, 0, 1),
+		op("w", 4),
+		op("m", 10, 50),
+		op("l", 90, 50),
+		op("S"),
+		// Nested squares filled even-odd leave a hole.
+		op("g", 0),
+		op("re", 10, 60, 30, 30),
+		op("re", 20, 70, 10, 10),
+		op("f*"),
+	)
+	img := render(t, Options{}, page)
+	if c := img.RGBAAt(50, 49); !near(c, 0, 0, 255) {
+		t.Fatalf("stroke = %v", c)
+	}
+	if c := img.RGBAAt(50, 45); !near(c, 255, 255, 255) {
+		t.Fatalf("outside stroke = %v", c)
+	}
+	if c := img.RGBAAt(12, 12); !near(c, 0, 0, 0) {
+		t.Fatalf("even-odd outer = %v", c)
+	}
+	if c := img.RGBAAt(25, 25); !near(c, 255, 255, 255) {
+		t.Fatalf("even-odd hole = %v", c)
+	}
+}
+
+func TestRenderClip(t *testing.T) {
+	page := testPage(100, 100, nil,
+		op("q"),
+		op("re", 0, 0, 50, 100),
+		op("W"),
+		op("n"),
+		op("rg", 0, 1, 0),
+		op("re", 0, 0, 100, 100),
+		op("f"),
+		op("Q"),
+		// The clip ends with Q.
+		op("rg", 0, 0, 1),
+		op("re", 60, 0, 10, 10),
+		op("f"),
+	)
+	img := render(t, Options{}, page)
+	if c := img.RGBAAt(25, 50); !near(c, 0, 255, 0) {
+		t.Fatalf("inside clip = %v", c)
+	}
+	if c := img.RGBAAt(75, 50); !near(c, 255, 255, 255) {
+		t.Fatalf("outside clip = %v", c)
+	}
+	if c := img.RGBAAt(65, 95); !near(c, 0, 0, 255) {
+		t.Fatalf("after restore = %v", c)
+	}
+}
+
+func TestRenderTransparency(t *testing.T) {
+	half := 0.5
+	res := &semantic.Resources{ExtGStates: map[string]semantic.ExtGState{
+		"GS1": {FillAlpha: &half},
+		"GS2": {BlendMode: "Multiply"},
+	}}
+	page := testPage(100, 100, res,
+		op("q"),
+		op("gs", "GS1"),
+		op("rg", 0, 0, 1),
+		op("re", 0, 0, 50, 100),
+		op("f"),
+		op("Q"),
+		op("rg", 1, 1, 0),
+		op("re", 50, 0, 50, 100),
+		op("f"),
+		op("gs", "GS2"),
+		op("rg", 0, 1, 1),
+		op("re", 50, 0, 50, 100),
+		op("f"),
+	)
+	img := render(t, Options{}, page)
+	if c := img.RGBAAt(25, 50); !near(c, 128, 128, 255) {
+		t.Fatalf("half alpha = %v", c)
+	}
+	// Yellow multiplied by cyan is green.
+	if c := img.RGBAAt(75, 50); !near(c, 0, 255, 0) {
+		t.Fatalf("multiply = %v", c)
+	}
+}
+
+func TestRenderSoftMaskTransferFunction(t *testing.T) {
+	group := &semantic.XObject{
+		Subtype: "Form",
+		BBox:    semantic.Rectangle{URX: 100, URY: 100},
+		Data:    []byte("1 g 0 0 50 100 re f"),
+	}
+	// The transfer function inverts the luminosity mask, so the white left
+	// half hides the fill and the black backdrop on the right shows it.
+	invert := &semantic.PostScriptFunction{
+		BaseFunction: semantic.BaseFunction{Type: 4, Domain: []float64{0, 1}, Range: []float64{0, 1}},
+		Code:         []byte("{ 1 exch sub }"),
+	}
+	res := &semantic.Resources{ExtGStates: map[string]semantic.ExtGState{
+		"GS1": {SoftMask: &semantic.SoftMaskDict{Subtype: "Luminosity", Group: group, TransferFunction: invert}},
+	}}
+	page := testPage(100, 100, res,
+		op("gs", "GS1"),
+		op("rg", 0, 0, 1),
+		op("re", 0, 0, 100, 100),
+		op("f"),
+	)
+	img := render(t, Options{}, page)
+	if c := img.RGBAAt(25, 50); !near(c, 255, 255, 255) {
+		t.Fatalf("masked half = %v", c)
+	}
+	if c := img.RGBAAt(75, 50); !near(c, 0, 0, 255) {
+		t.Fatalf("visible half = %v", c)
+	}
+}
+
+func TestRenderRotateAndBackground(t *testing.T) {
+	page := testPage(100, 50, nil,
+		op("g", 0),
+		op("re", 0, 0, 10, 10),
+		op("f"),
+	)
+	page.Rotate = 90
+	img := render(t, Options{Background: color.Transparent}, page)
+	if img.Rect.Dx() != 50 || img.Rect.Dy() != 100 {
+		t.Fatalf("rotated size = %v", img.Rect)
+	}
+	// Rotating clockwise moves the bottom-left corner to the top-left.
+	if c := img.RGBAAt(5, 5); !near(c, 0, 0, 0) || c.A != 255 {
+		t.Fatalf("rotated corner = %v", c)
+	}
+	if c := img.RGBAAt(45, 95); c.A != 0 {
+		t.Fatalf("background should be transparent, got %v", c)
+	}
+}
+
+func TestRenderAxialShading(t *testing.T) {
+	shading := &semantic.FunctionShading{
+		BaseShading: semantic.BaseShading{Type: 2, ColorSpace: semantic.DeviceColorSpace{Name: "DeviceRGB"}},
+		Coords:      []float64{0, 0, 100, 0},
+		Function: []semantic.Function{&semantic.ExponentialFunction{
+			BaseFunction: semantic.BaseFunction{Type: 2, Domain: []float64{0, 1}},
+			C0:           []float64{1, 0, 0},
+			C1:           []float64{0, 0, 1},
+			N:            1,
+		}},
+		Extend: []bool{true, true},
+	}
+	res := &semantic.Resources{Shadings: map[string]semantic.Shading{"Sh1": shading}}
+	page := testPage(100, 10, res, op("sh", "Sh1"))
+	img := render(t, Options{}, page)
+	left, mid, right := img.RGBAAt(0, 5), img.RGBAAt(50, 5), img.RGBAAt(99, 5)
+	if left.R < 250 || left.B > 5 {
+		t.Fatalf("left = %v", left)
+	}
+	if right.B < 250 || right.R > 5 {
+		t.Fatalf("right = %v", right)
+	}
+	if mid.R < 120 || mid.R > 135 || mid.B < 120 || mid.B > 135 {
+		t.Fatalf("middle = %v", mid)
+	}
+}
+
+func TestRenderImage(t *testing.T) {
+	img := &semantic.XObject{
+		Subtype:          "Image",
+		Width:            2,
+		Height:           1,
+		ColorSpace:       semantic.DeviceColorSpace{Name: "DeviceRGB"},
+		BitsPerComponent: 8,
+		Data:             []byte{255, 0, 0, 0, 255, 0},
+	}
+	res := &semantic.Resources{XObjects: map[string]semantic.XObject{"Im1": *img}}
+	page := testPage(100, 50, res,
+		op("q"),
+		op("cm", 100, 0, 0, 50, 0, 0),
+		op("Do", "Im1"),
+		op("Q"),
+	)
+	out := render(t, Options{}, page)
+	if c := out.RGBAAt(10, 25); !near(c, 255, 0, 0) {
+		t.Fatalf("left sample = %v", c)
+	}
+	if c := out.RGBAAt(90, 25); !near(c, 0, 255, 0) {
+		t.Fatalf("right sample = %v", c)
+	}
+
+	// Inline stencil mask: a 1-bit pattern painted with the fill colour.
+	stencil := semantic.InlineImageOperand{
+		Image: semantic.DictOperand{Values: map[string]semantic.Operand{
+			"W":  semantic.NumberOperand{Value: 2},
+			"H":  semantic.NumberOperand{Value: 1},
+			"IM": semantic.BoolOperand{Value: true},
+		}},
+		Data: []byte{0x40}, // first sample 0 (painted), second 1
+	}
+	page = testPage(100, 50, nil,
+		op("rg", 0, 0, 1),
+		op("cm", 100, 0, 0, 50, 0, 0),
+		semantic.Operation{Operator: "INLINE_IMAGE", Operands: []semantic.Operand{stencil}},
+	)
+	out = render(t, Options{}, page)
+	if c := out.RGBAAt(10, 25); !near(c, 0, 0, 255) {
+		t.Fatalf("stencil painted sample = %v", c)
+	}
+	if c := out.RGBAAt(90, 25); !near(c, 255, 255, 255) {
+		t.Fatalf("stencil unpainted sample = %v", c)
+	}
+}
+
+func TestDecodeBilevelCodecs(t *testing.T) {
+	// 24x4 pixels: two identical marks on a white background.
+	samples := []byte{
+		0xFF, 0xFF, 0xFF,
+		0x9F, 0xF9, 0xFF,
+		0x9F, 0xF9, 0xFF,
+		0xFF, 0xFF, 0xFF,
+	}
+	enc := filters.NewJBIG2Encoder()
+	enc.AddPage(samples, 24, 4)
+	enc.AddPage(samples, 24, 4)
+	globals, pages, err := enc.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ccitt, err := filters.EncodeCCITTFax(samples, 24, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray := semantic.DeviceColorSpace{Name: "DeviceGray"}
+	images := map[string]*semantic.XObject{
+		"JBIG2": {Subtype: "Image", Width: 24, Height: 4, BitsPerComponent: 1, ColorSpace: gray, Filter: "JBIG2Decode", Data: pages[0], JBIG2Globals: globals},
+		"CCITT": {Subtype: "Image", Width: 24, Height: 4, BitsPerComponent: 1, ColorSpace: gray, Filter: "CCITTFaxDecode", Data: ccitt, DecodeParms: filters.CCITTFaxParams(24, 4)},
+	}
+	for name, xo := range images {
+		img, err := New(Options{}).DecodeImage(context.Background(), xo)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, p := range []struct {
+			x, y  int
+			black bool
+		}{{1, 1, true}, {0, 1, false}, {13, 2, true}, {15, 2, false}, {20, 1, false}} {
+			if c := img.NRGBAAt(p.x, p.y); (c.R == 0) != p.black || c.A != 255 {
+				t.Fatalf("%s: pixel (%d,%d) = %v", name, p.x, p.y, c)
+			}
+		}
+	}
+}
+
+func TestRenderEmbeddedTrueTypeText(t *testing.T) {
+	b := builder.NewBuilder()
+	b.RegisterTrueTypeFont("Go", goregular.TTF)
+	b.NewPage(200, 100).DrawText("HH", 10, 20, builder.TextOptions{Font: "Go", FontSize: 60}).Finish()
+	doc, err := b.Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	img := render(t, Options{}, doc.Pages[0])
+	dark := 0
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			if img.RGBAAt(x, y).R < 64 {
+				dark++
+			}
+		}
+	}
+	if dark < 500 {
+		t.Fatalf("expected glyph ink, got %d dark pixels", dark)
+	}
+	// The H stems: the left stem of the first H starts just right of x=10
+	// and the crossbar sits at about half the cap height.
+	if c := img.RGBAAt(18, 60); c.R > 64 {
+		t.Fatalf("expected stem ink at (18,60), got %v", c)
+	}
+	if c := img.RGBAAt(5, 60); c.R < 250 {
+		t.Fatalf("expected no ink left of the text, got %v", c)
+	}
+}
+
+func TestFontGlyphs(t *testing.T) {
+	r := New(Options{})
+	embedded, err := fonts.LoadTrueType("Go", goregular.TTF)
+	if err != nil {
+		t.Fatalf("load font: %v", err)
+	}
+	glyphs, ok := r.FontGlyphs(embedded, []byte{0, 43, 0, 0})
+	if !ok || len(glyphs) != 2 {
+		t.Fatalf("glyphs = %+v, embedded %v", glyphs, ok)
+	}
+	if g := glyphs[0]; g.GID != 43 || !g.Defined || math.Abs(g.Width-g.Advance) > 0.001 {
+		t.Errorf("glyph = %+v", g)
+	}
+	if g := glyphs[1]; g.GID != 0 {
+		t.Errorf(".notdef = %+v", g)
+	}
+
+	helvetica := &semantic.Font{Subtype: "Type1", BaseFont: "Helvetica", Encoding: "WinAnsiEncoding"}
+	if glyphs, ok := r.FontGlyphs(helvetica, []byte("A")); ok || len(glyphs) != 1 || glyphs[0].GID == 0 {
+		t.Errorf("substituted glyphs = %+v, embedded %v", glyphs, ok)
+	}
+}
+
+func TestRenderCanceled(t *testing.T) {
+	ops := make([]semantic.Operation, 0, 1024)
+	for i := 0; i < 1024; i++ {
+		ops = append(ops, op("re", 0, 0, 1, 1), op("f"))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := New(Options{}).RenderPage(ctx, testPage(10, 10, nil, ops...))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestRenderPageTooLarge(t *testing.T) {
+	_, err := New(Options{MaxPixels: 100}).RenderPage(context.Background(), testPage(100, 100, nil))
+	if !errors.Is(err, ErrPageTooLarge) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestICCBasedColorUsesProfile(t *testing.T) {
+	cs := &semantic.ICCBasedColorSpace{N: 3, Profile: cmm.SRGBProfile().Data(), Alternate: deviceGray}
+	c, ok := toRGB(cs, []float64{0.8, 0.2, 0.4})
+	if !ok {
+		t.Fatal("colour paints nothing")
+	}
+	for i, want := range []float64{0.8, 0.2, 0.4} {
+		if got := []float64{c.R, c.G, c.B}[i]; got < want-0.01 || got > want+0.01 {
+			t.Fatalf("sRGB colour = %+v", c)
+		}
+	}
+	// An unusable profile falls back to the alternate space.
+	bad := &semantic.ICCBasedColorSpace{N: 3, Profile: []byte("junk"), Alternate: deviceGray}
+	if c, _ := toRGB(bad, []float64{0.5, 0, 0}); c != (rgb{0.5, 0.5, 0.5}) {
+		t.Fatalf("fallback colour = %+v", c)
+	}
+}
@@ -0,0 +1,724 @@
+package render
+
+import (
+	"image"
+	"math"
+
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/coords"
+	"github.com/wudi/pdfkit/internal/bitpack"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// paintShading implements the sh operator: the shading fills the current
+// clip, restricted to its BBox when present.
+func (it *interp) paintShading(sh semantic.Shading) {
+	area := it.bounds()
+	if it.gs.clip != nil {
+		area = area.Intersect(it.gs.clip.Rect)
+	}
+	if area.Empty() {
+		return
+	}
+	m := image.NewAlpha(area)
+	for i := range m.Pix {
+		m.Pix[i] = 0xff
+	}
+	if bb := shadingBBox(sh); bb != nil {
+		var p devicePath
+		p.moveTo(it.toDevice(bb.LLX, bb.LLY))
+		p.lineTo(it.toDevice(bb.URX, bb.LLY))
+		p.lineTo(it.toDevice(bb.URX, bb.URY))
+		p.lineTo(it.toDevice(bb.LLX, bb.URY))
+		p.closePath()
+		m = intersectMask(m, rasterize(p.fillPolygon(), false, area))
+	}
+	m = intersectMask(m, it.gs.clip)
+	if m == nil {
+		return
+	}
+	if src := it.shadingSource(sh, it.gs.CTM, m.Rect); src != nil {
+		it.composite(m, src, it.gs.fillAlpha)
+	}
+}
+
+func shadingBBox(sh semantic.Shading) *semantic.Rectangle {
+	var bb semantic.Rectangle
+	switch s := sh.(type) {
+	case *semantic.FunctionShading:
+		bb = s.BBox
+	case *semantic.MeshShading:
+		bb = s.BBox
+	default:
+		return nil
+	}
+	if bb.URX == bb.LLX || bb.URY == bb.LLY {
+		return nil
+	}
+	return &bb
+}
+
+// shadingSource returns a source painting sh, whose space maps to device
+// space through m. Mesh shadings are rasterized over area.
+func (it *interp) shadingSource(sh semantic.Shading, m coords.Matrix, area image.Rectangle) source {
+	inv, err := m.Inverse()
+	if err != nil {
+		return nil
+	}
+	switch s := sh.(type) {
+	case *semantic.FunctionShading:
+		cs := s.ColorSpace
+		switch s.Type {
+		case 1:
+			return newFunctionSource(s, inv)
+		case 2, 3:
+			return newGradientSource(s, cs, inv)
+		}
+	case *semantic.MeshShading:
+		return newMeshSource(s, m, area)
+	}
+	return nil
+}
+
+// shadeColor evaluates the shading colour for parametric inputs t.
+func shadeColor(cs semantic.ColorSpace, fns []semantic.Function, t []float64) (rgb, bool) {
+	var comps []float64
+	switch len(fns) {
+	case 0:
+		comps = t
+	case 1:
+		comps = evalFunction(fns[0], t)
+	default:
+		comps = make([]float64, 0, len(fns))
+		for _, fn := range fns {
+			out := evalFunction(fn, t)
+			if len(out) > 0 {
+				comps = append(comps, out[0])
+			} else {
+				comps = append(comps, 0)
+			}
+		}
+	}
+	if cs == nil {
+		cs = deviceGray
+	}
+	return toRGB(cs, comps)
+}
+
+// functionSource paints a Type 1 (function-based) shading.
+type functionSource struct {
+	s   *semantic.FunctionShading
+	inv coords.Matrix
+	dom [4]float64
+}
+
+func newFunctionSource(s *semantic.FunctionShading, inv coords.Matrix) source {
+	fs := &functionSource{s: s, inv: inv, dom: [4]float64{0, 1, 0, 1}}
+	if len(s.Domain) == 4 {
+		copy(fs.dom[:], s.Domain)
+	}
+	if len(s.Matrix) == 6 {
+		if mi, err := matrixOf(s.Matrix).Inverse(); err == nil {
+			fs.inv = inv.Multiply(mi)
+		}
+	}
+	return fs
+}
+
+func (f *functionSource) at(x, y int) (rgb, float64) {
+	p := f.inv.Transform(coords.Point{X: float64(x) + 0.5, Y: float64(y) + 0.5})
+	if p.X < f.dom[0] || p.X > f.dom[1] || p.Y < f.dom[2] || p.Y > f.dom[3] {
+		return rgb{}, 0
+	}
+	c, ok := shadeColor(f.s.ColorSpace, f.s.Function, []float64{p.X, p.Y})
+	if !ok {
+		return rgb{}, 0
+	}
+	return c, 1
+}
+
+const gradientSteps = 512
+
+// gradientSource paints axial (Type 2) and radial (Type 3) shadings through
+// a precomputed colour ramp.
+type gradientSource struct {
+	radial     bool
+	inv        coords.Matrix
+	c          [6]float64
+	ext0, ext1 bool
+	ramp       [gradientSteps]rgb
+	rampOK     [gradientSteps]bool
+}
+
+func newGradientSource(s *semantic.FunctionShading, cs semantic.ColorSpace, inv coords.Matrix) source {
+	g := &gradientSource{radial: s.Type == 3, inv: inv}
+	need := 4
+	if g.radial {
+		need = 6
+	}
+	if len(s.Coords) < need {
+		return nil
+	}
+	copy(g.c[:], s.Coords)
+	if len(s.Extend) >= 2 {
+		g.ext0, g.ext1 = s.Extend[0], s.Extend[1]
+	}
+	t0, t1 := 0.0, 1.0
+	if len(s.Domain) >= 2 {
+		t0, t1 = s.Domain[0], s.Domain[1]
+	}
+	for i := range g.ramp {
+		t := t0 + (t1-t0)*float64(i)/(gradientSteps-1)
+		g.ramp[i], g.rampOK[i] = shadeColor(cs, s.Function, []float64{t})
+	}
+	return g
+}
+
+func (g *gradientSource) at(x, y int) (rgb, float64) {
+	p := g.inv.Transform(coords.Point{X: float64(x) + 0.5, Y: float64(y) + 0.5})
+	s, ok := g.param(p.X, p.Y)
+	if !ok {
+		return rgb{}, 0
+	}
+	i := int(s*(gradientSteps-1) + 0.5)
+	i = clampI(i, 0, gradientSteps-1)
+	if !g.rampOK[i] {
+		return rgb{}, 0
+	}
+	return g.ramp[i], 1
+}
+
+// param returns the normalized gradient parameter at shading-space (px, py).
+func (g *gradientSource) param(px, py float64) (float64, bool) {
+	if !g.radial {
+		x0, y0, x1, y1 := g.c[0], g.c[1], g.c[2], g.c[3]
+		dx, dy := x1-x0, y1-y0
+		den := dx*dx + dy*dy
+		if den == 0 {
+			return 0, false
+		}
+		return g.extend(((px-x0)*dx + (py-y0)*dy) / den)
+	}
+	x0, y0, r0, x1, y1, r1 := g.c[0], g.c[1], g.c[2], g.c[3], g.c[4], g.c[5]
+	cdx, cdy, dr := x1-x0, y1-y0, r1-r0
+	pdx, pdy := px-x0, py-y0
+	a := cdx*cdx + cdy*cdy - dr*dr
+	b := pdx*cdx + pdy*cdy + r0*dr
+	c := pdx*pdx + pdy*pdy - r0*r0
+	var cands [2]float64
+	n := 0
+	if math.Abs(a) < 1e-12 {
+		if b == 0 {
+			return 0, false
+		}
+		cands[0] = c / (2 * b)
+		n = 1
+	} else {
+		disc := b*b - a*c
+		if disc < 0 {
+			return 0, false
+		}
+		sq := math.Sqrt(disc)
+		s1, s2 := (b+sq)/a, (b-sq)/a
+		if s1 < s2 {
+			s1, s2 = s2, s1
+		}
+		cands[0], cands[1] = s1, s2
+		n = 2
+	}
+	// The larger parameter wins where circles overlap.
+	for _, s := range cands[:n] {
+		if r0+s*dr < 0 {
+			continue
+		}
+		if v, ok := g.extend(s); ok {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+func (g *gradientSource) extend(s float64) (float64, bool) {
+	switch {
+	case s < 0:
+		return 0, g.ext0
+	case s > 1:
+		return 1, g.ext1
+	}
+	return s, true
+}
+
+// meshSource samples a mesh shading pre-rasterized in device space.
+type meshSource struct{ img *image.NRGBA }
+
+func (m meshSource) at(x, y int) (rgb, float64) {
+	if !(image.Point{x, y}.In(m.img.Rect)) {
+		return rgb{}, 0
+	}
+	i := m.img.PixOffset(x, y)
+	px := m.img.Pix[i : i+4 : i+4]
+	return rgb{float64(px[0]) / 255, float64(px[1]) / 255, float64(px[2]) / 255}, float64(px[3]) / 255
+}
+
+type meshVertex struct {
+	p point
+	c []float64
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) read(n int) (uint32, bool) {
+	if n <= 0 || r.pos+n > len(r.data)*8 {
+		return 0, false
+	}
+	v := bitpack.ReadBits(r.data, r.pos, n)
+	r.pos += n
+	return v, true
+}
+
+func (r *bitReader) align() { r.pos = (r.pos + 7) &^ 7 }
+
+// meshDecoder reads vertices of mesh shadings (Types 4–7).
+type meshDecoder struct {
+	r     bitReader
+	s     *semantic.MeshShading
+	m     coords.Matrix
+	nc    int
+	dec   []float64
+	coord float64
+	comp  float64
+}
+
+func newMeshDecoder(s *semantic.MeshShading, m coords.Matrix) *meshDecoder {
+	nc := 1
+	if s.Function == nil {
+		nc = numComponents(s.ColorSpace)
+	}
+	d := &meshDecoder{r: bitReader{data: s.Stream}, s: s, m: m, nc: nc, dec: s.Decode}
+	d.coord = float64(uint64(1)<<uint(s.BitsPerCoordinate) - 1)
+	d.comp = float64(uint64(1)<<uint(s.BitsPerComponent) - 1)
+	return d
+}
+
+func (d *meshDecoder) valid() bool {
+	s := d.s
+	return s.BitsPerCoordinate > 0 && s.BitsPerCoordinate <= 32 &&
+		s.BitsPerComponent > 0 && s.BitsPerComponent <= 16 && len(d.dec) >= 4+2*d.nc
+}
+
+func (d *meshDecoder) flag() (int, bool) {
+	v, ok := d.r.read(d.s.BitsPerFlag)
+	return int(v), ok
+}
+
+func (d *meshDecoder) point() (point, bool) {
+	xv, ok1 := d.r.read(d.s.BitsPerCoordinate)
+	yv, ok2 := d.r.read(d.s.BitsPerCoordinate)
+	if !ok1 || !ok2 {
+		return point{}, false
+	}
+	x := d.dec[0] + float64(xv)*(d.dec[1]-d.dec[0])/d.coord
+	y := d.dec[2] + float64(yv)*(d.dec[3]-d.dec[2])/d.coord
+	p := d.m.Transform(coords.Point{X: x, Y: y})
+	return point{p.X, p.Y}, true
+}
+
+func (d *meshDecoder) color() ([]float64, bool) {
+	c := make([]float64, d.nc)
+	for i := range c {
+		v, ok := d.r.read(d.s.BitsPerComponent)
+		if !ok {
+			return nil, false
+		}
+		c[i] = d.dec[4+2*i] + float64(v)*(d.dec[5+2*i]-d.dec[4+2*i])/d.comp
+	}
+	return c, true
+}
+
+func (d *meshDecoder) vertex() (meshVertex, bool) {
+	p, ok := d.point()
+	if !ok {
+		return meshVertex{}, false
+	}
+	c, ok := d.color()
+	return meshVertex{p: p, c: c}, ok
+}
+
+// meshRaster accumulates Gouraud-shaded triangles.
+type meshRaster struct {
+	img *image.NRGBA
+	s   *semantic.MeshShading
+}
+
+func newMeshSource(s *semantic.MeshShading, m coords.Matrix, area image.Rectangle) source {
+	d := newMeshDecoder(s, m)
+	if !d.valid() || area.Empty() {
+		return nil
+	}
+	mr := &meshRaster{img: image.NewNRGBA(area), s: s}
+	switch s.Type {
+	case 4:
+		var a, b, c meshVertex
+		for {
+			f, ok := d.flag()
+			if !ok {
+				break
+			}
+			v, ok := d.vertex()
+			if !ok {
+				break
+			}
+			d.r.align()
+			switch f {
+			case 0:
+				v2, ok2 := d.nextFreeVertex()
+				v3, ok3 := d.nextFreeVertex()
+				if !ok2 || !ok3 {
+					return meshSource{mr.img}
+				}
+				a, b, c = v, v2, v3
+			case 1:
+				a, b, c = b, c, v
+			case 2:
+				b, c = c, v
+			}
+			if a.c != nil && b.c != nil {
+				mr.triangle(a, b, c)
+			}
+		}
+	case 5:
+		cols := s.VerticesPerRow
+		if cols < 2 {
+			return nil
+		}
+		var prev []meshVertex
+		for {
+			row := make([]meshVertex, 0, cols)
+			for len(row) < cols {
+				v, ok := d.vertex()
+				if !ok {
+					return meshSource{mr.img}
+				}
+				row = append(row, v)
+			}
+			if prev != nil {
+				for i := 0; i+1 < cols; i++ {
+					mr.triangle(prev[i], prev[i+1], row[i])
+					mr.triangle(prev[i+1], row[i+1], row[i])
+				}
+			}
+			prev = row
+		}
+	case 6, 7:
+		mr.patches(d, s.Type == 7)
+	}
+	return meshSource{mr.img}
+}
+
+// nextFreeVertex reads a vertex whose flag is ignored (the second and third
+// vertices of a new Type 4 triangle).
+func (d *meshDecoder) nextFreeVertex() (meshVertex, bool) {
+	if _, ok := d.flag(); !ok {
+		return meshVertex{}, false
+	}
+	v, ok := d.vertex()
+	d.r.align()
+	return v, ok
+}
+
+// tensorOrder lists the (i, j) control points of a tensor patch in stream
+// order; Coons patches use the first twelve.
+var tensorOrder = [16][2]int{
+	{0, 0}, {0, 1}, {0, 2}, {0, 3}, {1, 3}, {2, 3}, {3, 3}, {3, 2},
+	{3, 1}, {3, 0}, {2, 0}, {1, 0}, {1, 1}, {1, 2}, {2, 2}, {2, 1},
+}
+
+func (mr *meshRaster) patches(d *meshDecoder, tensor bool) {
+	var prev [4][4]point
+	var prevC [4][]float64 // corner colours c00, c03, c33, c30
+	have := false
+	for {
+		f, ok := d.flag()
+		if !ok {
+			return
+		}
+		var p [4][4]point
+		var c [4][]float64
+		start := 0
+		cstart := 0
+		if f != 0 && have {
+			var edge [4]point
+			var ec [2][]float64
+			switch f {
+			case 1:
+				edge = [4]point{prev[0][3], prev[1][3], prev[2][3], prev[3][3]}
+				ec = [2][]float64{prevC[1], prevC[2]}
+			case 2:
+				edge = [4]point{prev[3][3], prev[3][2], prev[3][1], prev[3][0]}
+				ec = [2][]float64{prevC[2], prevC[3]}
+			default:
+				edge = [4]point{prev[3][0], prev[2][0], prev[1][0], prev[0][0]}
+				ec = [2][]float64{prevC[3], prevC[0]}
+			}
+			for k := 0; k < 4; k++ {
+				ij := tensorOrder[k]
+				p[ij[0]][ij[1]] = edge[k]
+			}
+			c[0], c[1] = ec[0], ec[1]
+			start, cstart = 4, 2
+		}
+		n := 12
+		if tensor {
+			n = 16
+		}
+		for k := start; k < n; k++ {
+			pt, ok := d.point()
+			if !ok {
+				return
+			}
+			ij := tensorOrder[k]
+			p[ij[0]][ij[1]] = pt
+		}
+		for k := cstart; k < 4; k++ {
+			col, ok := d.color()
+			if !ok {
+				return
+			}
+			c[k] = col
+		}
+		d.r.align()
+		if !tensor {
+			coonsInterior(&p)
+		}
+		mr.patch(&p, c)
+		prev, prevC, have = p, c, true
+	}
+}
+
+// coonsInterior derives the four interior tensor control points of a Coons
+// patch from its boundary.
+func coonsInterior(p *[4][4]point) {
+	comb := func(w [][2]int, k []float64) point {
+		var x, y float64
+		for i, ij := range w {
+			x += k[i] * p[ij[0]][ij[1]].X
+			y += k[i] * p[ij[0]][ij[1]].Y
+		}
+		return point{x / 9, y / 9}
+	}
+	k := []float64{-4, 6, 6, -2, -2, 3, 3, -1}
+	p[1][1] = comb([][2]int{{0, 0}, {0, 1}, {1, 0}, {0, 3}, {3, 0}, {3, 1}, {1, 3}, {3, 3}}, k)
+	p[1][2] = comb([][2]int{{0, 3}, {0, 2}, {1, 3}, {0, 0}, {3, 3}, {3, 2}, {1, 0}, {3, 0}}, k)
+	p[2][1] = comb([][2]int{{3, 0}, {3, 1}, {2, 0}, {3, 3}, {0, 0}, {0, 1}, {2, 3}, {0, 3}}, k)
+	p[2][2] = comb([][2]int{{3, 3}, {3, 2}, {2, 3}, {3, 0}, {0, 3}, {0, 2}, {2, 0}, {0, 0}}, k)
+}
+
+func bernstein(t float64) [4]float64 {
+	mt := 1 - t
+	return [4]float64{mt * mt * mt, 3 * mt * mt * t, 3 * mt * t * t, t * t * t}
+}
+
+// patch subdivides a tensor-product patch into a grid of triangles.
+func (mr *meshRaster) patch(p *[4][4]point, c [4][]float64) {
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for i := range p {
+		for j := range p[i] {
+			minX, maxX = math.Min(minX, p[i][j].X), math.Max(maxX, p[i][j].X)
+			minY, maxY = math.Min(minY, p[i][j].Y), math.Max(maxY, p[i][j].Y)
+		}
+	}
+	n := clampI(int(math.Max(maxX-minX, maxY-minY)/4), 2, 48)
+	grid := make([][]meshVertex, n+1)
+	for a := 0; a <= n; a++ {
+		u := float64(a) / float64(n)
+		bu := bernstein(u)
+		grid[a] = make([]meshVertex, n+1)
+		for b := 0; b <= n; b++ {
+			v := float64(b) / float64(n)
+			bv := bernstein(v)
+			var x, y float64
+			for i := 0; i < 4; i++ {
+				for j := 0; j < 4; j++ {
+					w := bu[i] * bv[j]
+					x += w * p[i][j].X
+					y += w * p[i][j].Y
+				}
+			}
+			// Corner colours: c00 (u=0,v=0), c03 (u=0,v=1), c33 (1,1), c30 (1,0).
+			col := make([]float64, len(c[0]))
+			for k := range col {
+				col[k] = (1-u)*(1-v)*at(c[0], k) + (1-u)*v*at(c[1], k) + u*v*at(c[2], k) + u*(1-v)*at(c[3], k)
+			}
+			grid[a][b] = meshVertex{p: point{x, y}, c: col}
+		}
+	}
+	for a := 0; a < n; a++ {
+		for b := 0; b < n; b++ {
+			mr.triangle(grid[a][b], grid[a+1][b], grid[a][b+1])
+			mr.triangle(grid[a+1][b], grid[a+1][b+1], grid[a][b+1])
+		}
+	}
+}
+
+func at(v []float64, i int) float64 {
+	if i < len(v) {
+		return v[i]
+	}
+	return 0
+}
+
+// triangle rasterizes a Gouraud-shaded triangle by sampling pixel centres.
+func (mr *meshRaster) triangle(a, b, c meshVertex) {
+	area := (b.p.X-a.p.X)*(c.p.Y-a.p.Y) - (c.p.X-a.p.X)*(b.p.Y-a.p.Y)
+	if area == 0 || math.IsNaN(area) {
+		return
+	}
+	rect := image.Rect(
+		int(math.Floor(math.Min(a.p.X, math.Min(b.p.X, c.p.X)))),
+		int(math.Floor(math.Min(a.p.Y, math.Min(b.p.Y, c.p.Y)))),
+		int(math.Ceil(math.Max(a.p.X, math.Max(b.p.X, c.p.X))))+1,
+		int(math.Ceil(math.Max(a.p.Y, math.Max(b.p.Y, c.p.Y))))+1,
+	).Intersect(mr.img.Rect)
+	var fns []semantic.Function
+	if mr.s.Function != nil {
+		fns = []semantic.Function{mr.s.Function}
+	}
+	const eps = 1e-9
+	col := make([]float64, len(a.c))
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		py := float64(y) + 0.5
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			px := float64(x) + 0.5
+			w0 := ((b.p.X-px)*(c.p.Y-py) - (c.p.X-px)*(b.p.Y-py)) / area
+			w1 := ((c.p.X-px)*(a.p.Y-py) - (a.p.X-px)*(c.p.Y-py)) / area
+			w2 := 1 - w0 - w1
+			if w0 < -eps || w1 < -eps || w2 < -eps {
+				continue
+			}
+			for k := range col {
+				col[k] = w0*at(a.c, k) + w1*at(b.c, k) + w2*at(c.c, k)
+			}
+			rc, ok := shadeColor(mr.s.ColorSpace, fns, col)
+			if !ok {
+				continue
+			}
+			i := mr.img.PixOffset(x, y)
+			mr.img.Pix[i], mr.img.Pix[i+1], mr.img.Pix[i+2], mr.img.Pix[i+3] = to8(rc.R), to8(rc.G), to8(rc.B), 0xff
+		}
+	}
+}
+
+// Tiling patterns.
+
+type tileKey struct {
+	pat    *semantic.TilingPattern
+	m      coords.Matrix
+	color  rgb
+	locked bool
+}
+
+// tile is one rendered pattern cell and the mapping used to repeat it.
+type tile struct {
+	img          *image.RGBA
+	inv          coords.Matrix // device to pattern space
+	llx, lly     float64
+	xstep, ystep float64
+	kx, ky       float64
+}
+
+// maxTileSize bounds the side of a rendered pattern cell in pixels.
+const maxTileSize = 1024
+
+func (it *interp) tilingSource(pat *semantic.TilingPattern, locked *rgb) source {
+	m := patternMatrix(&pat.BasePattern).Multiply(it.base)
+	key := tileKey{pat: pat, m: m}
+	if locked != nil {
+		key.color, key.locked = *locked, true
+	}
+	if t, ok := it.cache.tiles[key]; ok {
+		if t == nil {
+			return nil
+		}
+		return t
+	}
+	t := it.renderTile(pat, m, locked)
+	it.cache.tiles[key] = t
+	if t == nil {
+		return nil
+	}
+	return t
+}
+
+func (it *interp) renderTile(pat *semantic.TilingPattern, m coords.Matrix, locked *rgb) *tile {
+	if it.depth >= maxFormDepth {
+		return nil
+	}
+	inv, err := m.Inverse()
+	if err != nil {
+		return nil
+	}
+	bb := pat.BBox
+	xs, ys := math.Abs(pat.XStep), math.Abs(pat.YStep)
+	if xs == 0 {
+		xs = math.Abs(bb.URX - bb.LLX)
+	}
+	if ys == 0 {
+		ys = math.Abs(bb.URY - bb.LLY)
+	}
+	if xs == 0 || ys == 0 {
+		return nil
+	}
+	kx, ky := math.Hypot(m[0], m[1]), math.Hypot(m[2], m[3])
+	if kx == 0 || ky == 0 {
+		return nil
+	}
+	kx = math.Min(kx, maxTileSize/xs)
+	ky = math.Min(ky, maxTileSize/ys)
+	tw, th := int(math.Ceil(xs*kx)), int(math.Ceil(ys*ky))
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+	// Snap the scale to whole pixels so the cell repeats without seams.
+	kx, ky = float64(tw)/xs, float64(th)/ys
+	llx, lly := math.Min(bb.LLX, bb.URX), math.Min(bb.LLY, bb.URY)
+
+	img := image.NewRGBA(image.Rect(0, 0, tw, th))
+	toTile := coords.Translate(-llx, -lly).Multiply(coords.Scale(kx, -ky)).Multiply(coords.Translate(0, float64(th)))
+	res := pat.Resources
+	if res == nil {
+		res = it.res
+	}
+	sub := it.child(img, res)
+	sub.gs = defaultState(toTile)
+	sub.base = toTile
+	if locked != nil {
+		c := paint{cs: deviceRGB, comps: []float64{locked.R, locked.G, locked.B}}
+		sub.gs.fill, sub.gs.stroke = c, c
+		sub.colorLocked = true
+	}
+	ops, _ := contentstream.ParseOperations(pat.Content)
+	_ = sub.run(ops)
+	return &tile{img: img, inv: inv, llx: llx, lly: lly, xstep: xs, ystep: ys, kx: kx, ky: ky}
+}
+
+func (t *tile) at(x, y int) (rgb, float64) {
+	p := t.inv.Transform(coords.Point{X: float64(x) + 0.5, Y: float64(y) + 0.5})
+	fu := math.Mod(p.X-t.llx, t.xstep)
+	if fu < 0 {
+		fu += t.xstep
+	}
+	fv := math.Mod(p.Y-t.lly, t.ystep)
+	if fv < 0 {
+		fv += t.ystep
+	}
+	w, h := t.img.Rect.Dx(), t.img.Rect.Dy()
+	px := clampI(int(fu*t.kx), 0, w-1)
+	py := clampI(h-1-int(fv*t.ky), 0, h-1)
+	return layerSource{t.img}.at(px, py)
+}
@@ -54,7 +54,7 @@ func (r *resolverImpl) ResolveWithInheritance(ctx context.Context, category Reso
 				if r.doc == nil || r.doc.Decoded() == nil || r.doc.Decoded().Raw == nil {
 					return nil, fmt.Errorf("document context missing")
 				}
-				if obj, ok := r.doc.Decoded().Raw.Objects[font.OriginalRef]; ok {
+				if obj, ok := r.doc.Decoded().Raw.Get(font.OriginalRef); ok {
 					return obj, nil
 				}
 				return nil, fmt.Errorf("raw object %s not found", font.OriginalRef)
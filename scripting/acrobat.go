@@ -0,0 +1,756 @@
+package scripting
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// Viewer properties reported by the app object.
+const (
+	viewerType    = "Exchange-Pro"
+	viewerVersion = 11
+)
+
+// Values of the display property of fields (the display object).
+const (
+	displayVisible = 0
+	displayHidden  = 1
+	displayNoPrint = 2
+	displayNoView  = 3
+)
+
+// fn wraps a Go function as a JavaScript function value. The strings and
+// arrays it returns are charged against the memory limit of the run.
+func (e *GojaEngine) fn(f func(call goja.FunctionCall) goja.Value) goja.Value {
+	return e.vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		v := f(call)
+		e.charge(valueBytes(v))
+		return v
+	})
+}
+
+// accessor defines a property of obj backed by get and, unless set is nil,
+// set. Properties without set are read only.
+func (e *GojaEngine) accessor(obj *goja.Object, name string, get func() goja.Value, set func(goja.Value)) {
+	getter := e.fn(func(goja.FunctionCall) goja.Value { return get() })
+	var setter goja.Value
+	if set != nil {
+		setter = e.fn(func(call goja.FunctionCall) goja.Value {
+			set(call.Argument(0))
+			return goja.Undefined()
+		})
+	}
+	obj.DefineAccessorProperty(name, getter, setter, goja.FLAG_TRUE, goja.FLAG_TRUE)
+}
+
+func defined(v goja.Value) bool {
+	return v != nil && !goja.IsUndefined(v) && !goja.IsNull(v)
+}
+
+// argument returns argument i of call, or the property name of a single
+// object argument: Acrobat methods accept their parameters by position or
+// as the properties of one object, as in app.alert({cMsg: "..."}).
+func (e *GojaEngine) argument(call goja.FunctionCall, i int, name string) goja.Value {
+	if len(call.Arguments) == 1 {
+		if obj, ok := call.Arguments[0].(*goja.Object); ok && obj.ClassName() == "Object" {
+			return obj.Get(name)
+		}
+	}
+	return call.Argument(i)
+}
+
+func (e *GojaEngine) installGlobals() {
+	g := e.vm.GlobalObject()
+	g.Set("event", goja.Undefined())
+	g.Set("app", e.appObject())
+	g.Set("console", e.consoleObject())
+	g.Set("display", e.constants(map[string]interface{}{
+		"visible": displayVisible, "hidden": displayHidden, "noPrint": displayNoPrint, "noView": displayNoView,
+	}))
+	g.Set("border", e.constants(map[string]interface{}{
+		"s": "solid", "d": "dashed", "b": "beveled", "i": "inset", "u": "underline",
+	}))
+	global := e.vm.NewObject()
+	global.Set("setPersistent", e.fn(func(goja.FunctionCall) goja.Value { return goja.Undefined() }))
+	g.Set("global", global)
+	g.Set("color", e.colorObject())
+	g.Set("util", e.utilObject())
+	e.installAF()
+}
+
+func (e *GojaEngine) constants(values map[string]interface{}) *goja.Object {
+	obj := e.vm.NewObject()
+	for k, v := range values {
+		obj.DefineDataProperty(k, e.vm.ToValue(v), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	}
+	return obj
+}
+
+func (e *GojaEngine) alert(msg string) {
+	if e.dom != nil {
+		e.dom.Alert(msg)
+		return
+	}
+	fmt.Fprintln(e.console, msg)
+}
+
+func (e *GojaEngine) appObject() *goja.Object {
+	app := e.vm.NewObject()
+	app.Set("alert", e.fn(func(call goja.FunctionCall) goja.Value {
+		msg := ""
+		if v := e.argument(call, 0, "cMsg"); defined(v) {
+			msg = v.String()
+		}
+		e.alert(msg)
+		return e.vm.ToValue(1) // the OK button
+	}))
+	app.Set("beep", e.fn(func(goja.FunctionCall) goja.Value { return goja.Undefined() }))
+	app.Set("response", e.fn(func(goja.FunctionCall) goja.Value { return goja.Null() }))
+	app.Set("viewerType", viewerType)
+	app.Set("viewerVariation", "Full")
+	app.Set("viewerVersion", viewerVersion)
+	app.Set("formsVersion", viewerVersion)
+	app.Set("platform", "UNIX")
+	app.Set("language", "ENU")
+	return app
+}
+
+func (e *GojaEngine) consoleObject() *goja.Object {
+	console := e.vm.NewObject()
+	console.Set("println", e.fn(func(call goja.FunctionCall) goja.Value {
+		fmt.Fprintln(e.console, call.Argument(0).String())
+		return goja.Undefined()
+	}))
+	for _, name := range []string{"show", "hide", "clear"} {
+		console.Set(name, e.fn(func(goja.FunctionCall) goja.Value { return goja.Undefined() }))
+	}
+	return console
+}
+
+// installDoc makes the global object the document of dom.
+func (e *GojaEngine) installDoc() error {
+	g := e.vm.GlobalObject()
+	if err := g.Set("getField", e.fn(func(call goja.FunctionCall) goja.Value {
+		if obj := e.fieldObject(call.Argument(0).String()); obj != nil {
+			return obj
+		}
+		return goja.Null()
+	})); err != nil {
+		return err
+	}
+	g.Set("getNthFieldName", e.fn(func(call goja.FunctionCall) goja.Value {
+		names := e.dom.FieldNames()
+		n := int(call.Argument(0).ToInteger())
+		if n < 0 || n >= len(names) {
+			panic(e.vm.NewGoError(fmt.Errorf("getNthFieldName: index %d out of range", n)))
+		}
+		return e.vm.ToValue(names[n])
+	}))
+	e.accessor(g, "numFields", func() goja.Value { return e.vm.ToValue(len(e.dom.FieldNames())) }, nil)
+	e.accessor(g, "numPages", func() goja.Value { return e.vm.ToValue(e.dom.NumPages()) }, nil)
+	e.accessor(g, "pageNum", func() goja.Value { return e.vm.ToValue(0) }, func(goja.Value) {})
+	e.accessor(g, "dirty", func() goja.Value { return e.vm.ToValue(e.dirty) }, func(v goja.Value) { e.dirty = v.ToBoolean() })
+	g.Set("calculateNow", e.fn(func(goja.FunctionCall) goja.Value {
+		if e.form != nil {
+			if err := e.form.Calculate(e.ctx); err != nil {
+				panic(e.vm.NewGoError(err))
+			}
+		}
+		return goja.Undefined()
+	}))
+	g.Set("resetForm", e.fn(func(call goja.FunctionCall) goja.Value {
+		var names []string
+		if v := e.argument(call, 0, "aFields"); defined(v) {
+			for _, name := range e.strings(v) {
+				names = append(names, e.terminalNames(name)...)
+			}
+		} else {
+			names = e.dom.FieldNames()
+		}
+		if err := e.resetFields(names); err != nil {
+			panic(e.vm.NewGoError(err))
+		}
+		return goja.Undefined()
+	}))
+	g.Set("getPage", e.fn(func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 1 {
+			return goja.Undefined()
+		}
+		page, err := e.dom.GetPage(int(call.Arguments[0].ToInteger()))
+		if err != nil || page == nil {
+			return goja.Null()
+		}
+		return e.vm.ToValue(&pageProxyWrapper{p: page})
+	}))
+	return nil
+}
+
+// resetFields clears the values of the named fields and, when a form is
+// being processed, recalculates and formats it.
+func (e *GojaEngine) resetFields(names []string) error {
+	for _, name := range names {
+		p, err := e.dom.GetField(name)
+		if err != nil || p == nil {
+			continue
+		}
+		switch p.Type() {
+		case FieldCheckBox, FieldRadioButton:
+			p.SetValue("Off")
+		case FieldListBox:
+			p.SetValue([]string(nil))
+		case FieldText, FieldComboBox:
+			p.SetValue("")
+		default:
+			continue
+		}
+		p.SetDisplayValue("")
+	}
+	e.dirty = true
+	if e.form != nil {
+		return e.form.Calculate(e.ctx)
+	}
+	return nil
+}
+
+// strings converts a string or an array of strings.
+func (e *GojaEngine) strings(v goja.Value) []string {
+	if obj, ok := v.(*goja.Object); ok && obj.ClassName() == "Array" {
+		var out []string
+		e.vm.ForOf(obj, func(item goja.Value) bool {
+			out = append(out, item.String())
+			return true
+		})
+		return out
+	}
+	if !defined(v) {
+		return nil
+	}
+	return []string{v.String()}
+}
+
+// terminalNames returns name if it is a field, and otherwise the fields
+// below the partial name.
+func (e *GojaEngine) terminalNames(name string) []string {
+	if p, err := e.dom.GetField(name); err == nil && p != nil {
+		return []string{name}
+	}
+	var names []string
+	for _, n := range e.dom.FieldNames() {
+		if strings.HasPrefix(n, name+".") {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// fieldObject returns the Field object for name: a terminal field, or a
+// group of the fields below a partial name whose property changes apply
+// to each of them. It returns nil if there is no such field.
+func (e *GojaEngine) fieldObject(name string) *goja.Object {
+	if e.dom == nil || name == "" {
+		return nil
+	}
+	if obj, ok := e.fields[name]; ok {
+		return obj
+	}
+	var proxies []FormFieldProxy
+	terminal := false
+	if p, err := e.dom.GetField(name); err == nil && p != nil {
+		proxies, terminal = []FormFieldProxy{p}, true
+	} else {
+		for _, n := range e.terminalNames(name) {
+			if p, err := e.dom.GetField(n); err == nil && p != nil {
+				proxies = append(proxies, p)
+			}
+		}
+	}
+	if len(proxies) == 0 {
+		return nil
+	}
+	obj := e.newField(name, proxies, terminal)
+	e.fields[name] = obj
+	return obj
+}
+
+// numeric matches the text values Acrobat exposes to scripts as numbers.
+var numeric = regexp.MustCompile(`^[+-]?(\d+[.,]?\d*|[.,]\d+)([eE][+-]?\d+)?$`)
+
+func (e *GojaEngine) fieldValue(p FormFieldProxy) goja.Value {
+	switch v := p.GetValue().(type) {
+	case string:
+		if p.Type() == FieldText {
+			if s := strings.TrimSpace(v); numeric.MatchString(s) {
+				if n, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64); err == nil && !math.IsInf(n, 0) {
+					return e.vm.ToValue(n)
+				}
+			}
+		}
+		return e.vm.ToValue(v)
+	case []string:
+		if len(v) == 1 {
+			return e.vm.ToValue(v[0])
+		}
+		items := make([]interface{}, len(v))
+		for i, s := range v {
+			items[i] = s
+		}
+		return e.vm.NewArray(items...)
+	case nil:
+		return goja.Null()
+	default:
+		return e.vm.ToValue(v)
+	}
+}
+
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ",")
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// setFieldValue stores a value assigned by a script.
+func (e *GojaEngine) setFieldValue(p FormFieldProxy, v goja.Value) {
+	if p.Type() == FieldListBox {
+		if obj, ok := v.(*goja.Object); ok && obj.ClassName() == "Array" {
+			p.SetValue(e.strings(v))
+			return
+		}
+	}
+	s := ""
+	if defined(v) {
+		s = v.String()
+	}
+	p.SetValue(s)
+	p.SetDisplayValue(s)
+	e.dirty = true
+}
+
+func (e *GojaEngine) newField(name string, proxies []FormFieldProxy, terminal bool) *goja.Object {
+	obj := e.vm.NewObject()
+	first := proxies[0]
+	each := func(f func(p FormFieldProxy)) {
+		for _, p := range proxies {
+			f(p)
+		}
+	}
+	obj.DefineDataProperty("name", e.vm.ToValue(name), goja.FLAG_FALSE, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	e.accessor(obj, "type", func() goja.Value {
+		if !terminal {
+			return e.vm.ToValue("")
+		}
+		return e.vm.ToValue(first.Type())
+	}, nil)
+	e.accessor(obj, "value", func() goja.Value {
+		if !terminal {
+			return goja.Undefined()
+		}
+		return e.fieldValue(first)
+	}, func(v goja.Value) {
+		if terminal {
+			e.setFieldValue(first, v)
+		}
+	})
+	e.accessor(obj, "valueAsString", func() goja.Value { return e.vm.ToValue(valueString(first.GetValue())) }, nil)
+	e.accessor(obj, "defaultValue", func() goja.Value { return e.vm.ToValue("") }, nil)
+
+	flag := func(prop string, bit int) {
+		e.accessor(obj, prop, func() goja.Value { return e.vm.ToValue(first.Flags()&bit != 0) }, func(v goja.Value) {
+			each(func(p FormFieldProxy) {
+				if v.ToBoolean() {
+					p.SetFlags(p.Flags() | bit)
+				} else {
+					p.SetFlags(p.Flags() &^ bit)
+				}
+			})
+		})
+	}
+	flag("readonly", semantic.FieldFlagReadOnly)
+	flag("required", semantic.FieldFlagRequired)
+	flag("multiline", semantic.FieldFlagMultiline)
+	flag("password", semantic.FieldFlagPassword)
+	flag("fileSelect", semantic.FieldFlagFileSelect)
+	flag("doNotSpellCheck", semantic.FieldFlagDoNotSpellCheck)
+	flag("doNotScroll", semantic.FieldFlagDoNotScroll)
+	flag("comb", semantic.FieldFlagComb)
+	flag("richText", semantic.FieldFlagRichText)
+	flag("radiosInUnison", semantic.FieldFlagRadiosInUnison)
+	flag("multipleSelection", semantic.FieldFlagMultiSelect)
+	flag("editable", semantic.FieldFlagEdit)
+	flag("commitOnSelChange", semantic.FieldFlagCommitOnSelChange)
+
+	e.accessor(obj, "display", func() goja.Value { return e.vm.ToValue(display(first.AnnotationFlags())) }, func(v goja.Value) {
+		each(func(p FormFieldProxy) { p.SetAnnotationFlags(setDisplay(p.AnnotationFlags(), int(v.ToInteger()))) })
+	})
+	e.accessor(obj, "hidden", func() goja.Value { return e.vm.ToValue(display(first.AnnotationFlags()) == displayHidden) }, func(v goja.Value) {
+		d := displayVisible
+		if v.ToBoolean() {
+			d = displayHidden
+		}
+		each(func(p FormFieldProxy) { p.SetAnnotationFlags(setDisplay(p.AnnotationFlags(), d)) })
+	})
+	colorProperty := func(kind string, names ...string) {
+		for _, prop := range names {
+			e.accessor(obj, prop, func() goja.Value { return e.colorArray(first.Color(kind)) }, func(v goja.Value) {
+				if c, ok := e.components(v); ok {
+					each(func(p FormFieldProxy) { p.SetColor(kind, c) })
+				}
+			})
+		}
+	}
+	colorProperty("text", "textColor", "fgColor")
+	colorProperty("fill", "fillColor", "bgColor")
+	colorProperty("stroke", "strokeColor", "borderColor")
+
+	e.accessor(obj, "charLimit", func() goja.Value { return e.vm.ToValue(first.CharLimit()) }, nil)
+	e.accessor(obj, "page", func() goja.Value { return e.vm.ToValue(first.PageIndex()) }, nil)
+	e.accessor(obj, "rect", func() goja.Value {
+		r := first.Rect()
+		return e.vm.NewArray(r[0], r[3], r[2], r[1]) // upper left and lower right corners
+	}, nil)
+	e.accessor(obj, "numItems", func() goja.Value { return e.vm.ToValue(len(first.Items())) }, nil)
+	e.accessor(obj, "exportValues", func() goja.Value {
+		var values []interface{}
+		for _, item := range first.Items() {
+			values = append(values, item.Export)
+		}
+		return e.vm.NewArray(values...)
+	}, func(v goja.Value) {
+		var items []FieldItem
+		for _, s := range e.strings(v) {
+			items = append(items, FieldItem{Display: s, Export: s})
+		}
+		first.SetItems(items)
+	})
+	e.accessor(obj, "currentValueIndices", func() goja.Value {
+		selected := e.strings(e.fieldValue(first))
+		var indices []interface{}
+		for i, item := range first.Items() {
+			for _, s := range selected {
+				if item.Export == s {
+					indices = append(indices, i)
+				}
+			}
+		}
+		switch {
+		case len(indices) == 0:
+			return e.vm.ToValue(-1)
+		case len(indices) == 1:
+			return e.vm.ToValue(indices[0])
+		}
+		return e.vm.NewArray(indices...)
+	}, func(v goja.Value) {
+		items := first.Items()
+		var values []string
+		for _, s := range e.strings(v) {
+			if i, err := strconv.Atoi(s); err == nil && i >= 0 && i < len(items) {
+				values = append(values, items[i].Export)
+			}
+		}
+		if first.Type() == FieldListBox {
+			first.SetValue(values)
+		} else if len(values) > 0 {
+			first.SetValue(values[0])
+		}
+		first.SetDisplayValue(valueString(first.GetValue()))
+	})
+
+	item := func(call goja.FunctionCall, at int) (int, bool) {
+		items := first.Items()
+		i := len(items) - 1
+		if v := call.Argument(at); defined(v) {
+			i = int(v.ToInteger())
+			if i < 0 {
+				i = len(items) - 1
+			}
+		}
+		return i, i >= 0 && i < len(items)
+	}
+	obj.Set("getItemAt", e.fn(func(call goja.FunctionCall) goja.Value {
+		i, ok := item(call, 0)
+		if !ok {
+			return goja.Null()
+		}
+		it := first.Items()[i]
+		if v := call.Argument(1); defined(v) && !v.ToBoolean() {
+			return e.vm.ToValue(it.Display)
+		}
+		return e.vm.ToValue(it.Export)
+	}))
+	obj.Set("setItems", e.fn(func(call goja.FunctionCall) goja.Value {
+		var items []FieldItem
+		if arr, ok := call.Argument(0).(*goja.Object); ok {
+			e.vm.ForOf(arr, func(v goja.Value) bool {
+				pair := e.strings(v)
+				switch {
+				case len(pair) >= 2:
+					items = append(items, FieldItem{Display: pair[0], Export: pair[1]})
+				case len(pair) == 1:
+					items = append(items, FieldItem{Display: pair[0], Export: pair[0]})
+				}
+				return true
+			})
+		}
+		first.SetItems(items)
+		return goja.Undefined()
+	}))
+	obj.Set("clearItems", e.fn(func(goja.FunctionCall) goja.Value {
+		first.SetItems(nil)
+		return goja.Undefined()
+	}))
+	obj.Set("insertItemAt", e.fn(func(call goja.FunctionCall) goja.Value {
+		display := e.argument(call, 0, "cName").String()
+		export := display
+		if v := e.argument(call, 1, "cExport"); defined(v) {
+			export = v.String()
+		}
+		items := first.Items()
+		i := 0
+		if v := e.argument(call, 2, "nIdx"); defined(v) {
+			i = int(v.ToInteger())
+		}
+		if i < 0 || i > len(items) {
+			i = len(items)
+		}
+		items = append(items[:i:i], append([]FieldItem{{Display: display, Export: export}}, items[i:]...)...)
+		first.SetItems(items)
+		return goja.Undefined()
+	}))
+	obj.Set("deleteItemAt", e.fn(func(call goja.FunctionCall) goja.Value {
+		if i, ok := item(call, 0); ok {
+			items := first.Items()
+			first.SetItems(append(items[:i:i], items[i+1:]...))
+		}
+		return goja.Undefined()
+	}))
+	obj.Set("isBoxChecked", e.fn(func(call goja.FunctionCall) goja.Value {
+		i := int(call.Argument(0).ToInteger())
+		items := first.Items()
+		return e.vm.ToValue(i >= 0 && i < len(items) && valueString(first.GetValue()) == items[i].Export)
+	}))
+	obj.Set("isDefaultChecked", e.fn(func(goja.FunctionCall) goja.Value { return e.vm.ToValue(false) }))
+	obj.Set("checkThisBox", e.fn(func(call goja.FunctionCall) goja.Value {
+		i := int(call.Argument(0).ToInteger())
+		items := first.Items()
+		if i < 0 || i >= len(items) {
+			return goja.Undefined()
+		}
+		check := true
+		if v := call.Argument(1); defined(v) {
+			check = v.ToBoolean()
+		}
+		switch {
+		case check:
+			e.setFieldValue(first, e.vm.ToValue(items[i].Export))
+		case valueString(first.GetValue()) == items[i].Export:
+			e.setFieldValue(first, e.vm.ToValue("Off"))
+		}
+		return goja.Undefined()
+	}))
+	obj.Set("getArray", e.fn(func(goja.FunctionCall) goja.Value {
+		var kids []interface{}
+		if terminal {
+			kids = append(kids, obj)
+		} else {
+			for _, p := range proxies {
+				if kid := e.fieldObject(p.Name()); kid != nil {
+					kids = append(kids, kid)
+				}
+			}
+		}
+		return e.vm.NewArray(kids...)
+	}))
+	obj.Set("setFocus", e.fn(func(goja.FunctionCall) goja.Value { return goja.Undefined() }))
+	return obj
+}
+
+// display returns the display property for annotation flags.
+func display(flags int) int {
+	switch {
+	case flags&semantic.AnnotFlagHidden != 0:
+		return displayHidden
+	case flags&semantic.AnnotFlagNoView != 0:
+		return displayNoView
+	case flags&semantic.AnnotFlagPrint == 0:
+		return displayNoPrint
+	}
+	return displayVisible
+}
+
+// setDisplay returns flags changed to show a widget as d says.
+func setDisplay(flags, d int) int {
+	flags &^= semantic.AnnotFlagHidden | semantic.AnnotFlagNoView | semantic.AnnotFlagPrint
+	switch d {
+	case displayVisible:
+		flags |= semantic.AnnotFlagPrint
+	case displayHidden:
+		flags |= semantic.AnnotFlagHidden
+	case displayNoView:
+		flags |= semantic.AnnotFlagNoView | semantic.AnnotFlagPrint
+	}
+	return flags
+}
+
+// eventObject builds the JavaScript event object for ev.
+func (e *GojaEngine) eventObject(ev *Event) *goja.Object {
+	obj := e.vm.NewObject()
+	typ := ev.Type
+	if typ == "" {
+		typ = "Field"
+	}
+	field := func(name string) goja.Value {
+		if f := e.fieldObject(name); f != nil {
+			return f
+		}
+		return goja.Null()
+	}
+	for _, p := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"name", ev.Name}, {"type", typ}, {"targetName", ev.Target},
+		{"target", field(ev.Target)}, {"source", field(ev.Source)},
+		{"value", ev.Value}, {"change", ev.Change}, {"changeEx", ev.ChangeEx},
+		{"selStart", ev.SelStart}, {"selEnd", ev.SelEnd},
+		{"willCommit", ev.WillCommit}, {"commitKey", ev.CommitKey}, {"fieldFull", ev.FieldFull},
+		{"rc", ev.RC}, {"modifier", false}, {"shift", false}, {"keyDown", false},
+	} {
+		obj.Set(p.name, p.value)
+	}
+	return obj
+}
+
+// readEvent copies the state a script may change from obj to ev.
+func (e *GojaEngine) readEvent(obj *goja.Object, ev *Event) {
+	str := func(name string) string {
+		if v := obj.Get(name); defined(v) {
+			return v.String()
+		}
+		return ""
+	}
+	ev.Value = str("value")
+	ev.Change = str("change")
+	ev.SelStart = int(obj.Get("selStart").ToInteger())
+	ev.SelEnd = int(obj.Get("selEnd").ToInteger())
+	ev.RC = obj.Get("rc").ToBoolean()
+}
+
+// colorObject returns the color object: colour constants and conversions
+// of colour arrays such as ["RGB", 1, 0, 0].
+func (e *GojaEngine) colorObject() *goja.Object {
+	obj := e.vm.NewObject()
+	for name, c := range map[string][]float64{
+		"transparent": {}, "black": {0}, "white": {1}, "dkGray": {0.25}, "gray": {0.5}, "ltGray": {0.75},
+		"red": {1, 0, 0}, "green": {0, 1, 0}, "blue": {0, 0, 1},
+		"cyan": {1, 0, 0, 0}, "magenta": {0, 1, 0, 0}, "yellow": {0, 0, 1, 0},
+	} {
+		obj.Set(name, e.colorArray(c))
+	}
+	obj.Set("convert", e.fn(func(call goja.FunctionCall) goja.Value {
+		c, ok := e.components(e.argument(call, 0, "colorArray"))
+		if !ok {
+			return goja.Null()
+		}
+		return e.colorArray(convertColor(c, e.argument(call, 1, "cColorspace").String()))
+	}))
+	obj.Set("equal", e.fn(func(call goja.FunctionCall) goja.Value {
+		a, ok1 := e.components(e.argument(call, 0, "colorArray1"))
+		b, ok2 := e.components(e.argument(call, 1, "colorArray2"))
+		if !ok1 || !ok2 || (len(a) == 0) != (len(b) == 0) {
+			return e.vm.ToValue(false)
+		}
+		b = convertColor(b, colorSpace(a))
+		for i := range a {
+			if math.Abs(a[i]-b[i]) > 1e-3 {
+				return e.vm.ToValue(false)
+			}
+		}
+		return e.vm.ToValue(true)
+	}))
+	return obj
+}
+
+// colorArray returns the colour array for PDF colour components.
+func (e *GojaEngine) colorArray(c []float64) goja.Value {
+	items := []interface{}{colorSpace(c)}
+	for _, v := range c {
+		items = append(items, v)
+	}
+	return e.vm.NewArray(items...)
+}
+
+// components returns the PDF colour components of a colour array.
+func (e *GojaEngine) components(v goja.Value) ([]float64, bool) {
+	arr, ok := v.(*goja.Object)
+	if !ok || arr.ClassName() != "Array" {
+		return nil, false
+	}
+	var space string
+	var c []float64
+	e.vm.ForOf(arr, func(item goja.Value) bool {
+		if space == "" {
+			space = item.String()
+		} else {
+			c = append(c, item.ToFloat())
+		}
+		return true
+	})
+	want := map[string]int{"T": 0, "G": 1, "RGB": 3, "CMYK": 4}
+	n, ok := want[space]
+	if !ok || len(c) < n {
+		return nil, false
+	}
+	return c[:n], true
+}
+
+func colorSpace(c []float64) string {
+	switch len(c) {
+	case 0:
+		return "T"
+	case 1:
+		return "G"
+	case 4:
+		return "CMYK"
+	}
+	return "RGB"
+}
+
+// convertColor converts PDF colour components to the colour space named
+// as in colour arrays, with the conversions Acrobat uses.
+func convertColor(c []float64, space string) []float64 {
+	if len(c) == 0 || colorSpace(c) == space {
+		return c
+	}
+	var rgb []float64
+	switch len(c) {
+	case 1:
+		rgb = []float64{c[0], c[0], c[0]}
+	case 4:
+		rgb = []float64{1 - math.Min(1, c[0]+c[3]), 1 - math.Min(1, c[1]+c[3]), 1 - math.Min(1, c[2]+c[3])}
+	default:
+		rgb = c
+	}
+	switch space {
+	case "G":
+		return []float64{0.3*rgb[0] + 0.59*rgb[1] + 0.11*rgb[2]}
+	case "CMYK":
+		if len(c) == 1 {
+			return []float64{0, 0, 0, 1 - c[0]}
+		}
+		return []float64{1 - rgb[0], 1 - rgb[1], 1 - rgb[2], 0}
+	case "T":
+		return nil
+	}
+	return rgb
+}
@@ -0,0 +1,438 @@
+package scripting
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/wudi/pdfkit/internal/pdfnum"
+)
+
+// The AF functions are the format, keystroke, validate and calculate
+// helpers of Acrobat forms (AForm.js) that field actions call, such as
+// AFNumber_Format(2, 0, 0, 0, "$", true).
+
+// afDateFormats and afTimeFormats are the numbered formats of AFDate_Format
+// and AFTime_Format.
+var (
+	afDateFormats = []string{"m/d", "m/d/yy", "mm/dd/yy", "mm/yy", "d-mmm", "d-mmm-yy", "dd-mmm-yy",
+		"yy-mm-dd", "mmm-yy", "mmmm-yy", "mmm d, yyyy", "mmmm d, yyyy", "m/d/yy h:MM tt", "m/d/yy HH:MM"}
+	afTimeFormats = []string{"HH:MM", "h:MM tt", "HH:MM:ss", "h:MM:ss tt"}
+)
+
+// afSpecial are the formats of AFSpecial_Format and AFSpecial_Keystroke:
+// zip code, zip+4, phone number and social security number, with the
+// patterns committed and partially typed values must match.
+var afSpecial = []struct {
+	format  string
+	commit  *regexp.Regexp
+	partial *regexp.Regexp
+}{
+	{"99999", regexp.MustCompile(`^\d{5}$`), regexp.MustCompile(`^\d{0,5}$`)},
+	{"99999-9999", regexp.MustCompile(`^\d{5}[.\- ]?\d{4}$`), regexp.MustCompile(`^\d{0,5}([.\- ]\d{0,4}|\d{0,4})$`)},
+	{"999-9999", regexp.MustCompile(`^(\d{3}[.\- ]?\d{4}|\(?\d{3}\)?[.\- ]?\d{3}[.\- ]?\d{4})$`), regexp.MustCompile(`^[\d().\- ]{0,14}$`)},
+	{"999-99-9999", regexp.MustCompile(`^\d{3}[.\- ]?\d{2}[.\- ]?\d{4}$`), regexp.MustCompile(`^[\d.\- ]{0,11}$`)},
+}
+
+var (
+	digitRuns = regexp.MustCompile(`\d+`)
+	// partialNumbers match numbers being typed, with a period or, for the
+	// separator styles 2 and 3, a comma as decimal separator.
+	partialNumbers = [2]*regexp.Regexp{regexp.MustCompile(`^[+-]?\d*\.?\d*$`), regexp.MustCompile(`^[+-]?\d*,?\d*$`)}
+)
+
+// makeNumber implements AFMakeNumber: numbers are taken as they are and
+// strings are read with a period or a comma as decimal separator, ignoring
+// other characters such as currency symbols. Strings with more than one
+// separator between digits are not numbers.
+func makeNumber(v goja.Value) (float64, bool) {
+	if !defined(v) {
+		return 0, false
+	}
+	switch x := v.Export().(type) {
+	case int64:
+		return float64(x), true
+	case float64:
+		return x, !math.IsNaN(x) && !math.IsInf(x, 0)
+	case string:
+		return parseNumber(x)
+	}
+	return 0, false
+}
+
+func parseNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	runs := digitRuns.FindAllStringIndex(s, -1)
+	if len(runs) == 0 || len(runs) > 2 {
+		return 0, false
+	}
+	whole, frac := s[runs[0][0]:runs[0][1]], ""
+	if len(runs) == 2 {
+		frac = s[runs[1][0]:runs[1][1]]
+		if between := s[runs[0][1]:runs[1][0]]; between != "." && between != "," {
+			return 0, false
+		}
+	} else if i := runs[0][0]; i > 0 && (s[i-1] == '.' || s[i-1] == ',') {
+		whole, frac = "0", whole
+	}
+	n, err := strconv.ParseFloat(whole+"."+frac+"0", 64)
+	if err != nil {
+		return 0, false
+	}
+	if strings.Contains(s[:runs[0][0]], "-") {
+		n = -n
+	}
+	return n, true
+}
+
+// event returns the current event object.
+func (e *GojaEngine) event() *goja.Object {
+	if obj, ok := e.vm.Get("event").(*goja.Object); ok {
+		return obj
+	}
+	panic(e.vm.NewTypeError("no event is being processed"))
+}
+
+// mergeChange implements AFMergeChange: the value a keystroke event
+// proposes, the current value with the selection replaced by the change.
+func mergeChange(ev *goja.Object) string {
+	value := []rune(ev.Get("value").String())
+	if ev.Get("willCommit").ToBoolean() {
+		return string(value)
+	}
+	start, end := int(ev.Get("selStart").ToInteger()), int(ev.Get("selEnd").ToInteger())
+	prefix, suffix := "", ""
+	if start >= 0 && start <= len(value) {
+		prefix = string(value[:start])
+	}
+	if end >= 0 && end <= len(value) {
+		suffix = string(value[end:])
+	}
+	return prefix + ev.Get("change").String() + suffix
+}
+
+// reject rejects the current event with an alert.
+func (e *GojaEngine) reject(ev *goja.Object, msg string) {
+	e.alert(msg)
+	ev.Set("rc", false)
+}
+
+// targetName returns the name of the field of ev.
+func targetName(ev *goja.Object) string {
+	if t, ok := ev.Get("target").(*goja.Object); ok {
+		return t.Get("name").String()
+	}
+	return ev.Get("targetName").String()
+}
+
+func invalidFormat(ev *goja.Object) string {
+	return fmt.Sprintf("The value entered does not match the format of the field [ %s ]", targetName(ev))
+}
+
+func intArg(call goja.FunctionCall, i int) int {
+	return int(call.Argument(i).ToInteger())
+}
+
+func (e *GojaEngine) installAF() {
+	g := e.vm.GlobalObject()
+	def := func(name string, f func(call goja.FunctionCall) goja.Value) {
+		g.Set(name, e.fn(f))
+	}
+	void := func(f func(call goja.FunctionCall)) func(call goja.FunctionCall) goja.Value {
+		return func(call goja.FunctionCall) goja.Value {
+			f(call)
+			return goja.Undefined()
+		}
+	}
+
+	def("AFMakeNumber", func(call goja.FunctionCall) goja.Value {
+		if n, ok := makeNumber(call.Argument(0)); ok {
+			return e.vm.ToValue(n)
+		}
+		return goja.Null()
+	})
+	def("AFExtractNums", func(call goja.FunctionCall) goja.Value {
+		runs := digitRuns.FindAllString(call.Argument(0).String(), -1)
+		if len(runs) == 0 {
+			return goja.Null()
+		}
+		items := make([]interface{}, len(runs))
+		for i, r := range runs {
+			items[i] = r
+		}
+		return e.vm.NewArray(items...)
+	})
+	def("AFMergeChange", func(call goja.FunctionCall) goja.Value {
+		ev, ok := call.Argument(0).(*goja.Object)
+		if !ok {
+			ev = e.event()
+		}
+		return e.vm.ToValue(mergeChange(ev))
+	})
+	def("AFSimple", func(call goja.FunctionCall) goja.Value {
+		a, b := call.Argument(1).ToFloat(), call.Argument(2).ToFloat()
+		return e.vm.ToValue(simple(call.Argument(0).String(), a, b))
+	})
+	def("AFParseDateEx", func(call goja.FunctionCall) goja.Value {
+		t, ok := parseDate("", call.Argument(1).String(), call.Argument(0).String(), time.Now())
+		if !ok {
+			return goja.Null()
+		}
+		return e.newDate(t)
+	})
+
+	def("AFNumber_Format", void(func(call goja.FunctionCall) {
+		e.numberFormat(intArg(call, 0), intArg(call, 1), intArg(call, 2), call.Argument(4), call.Argument(5).ToBoolean(), 1)
+	}))
+	def("AFPercent_Format", void(func(call goja.FunctionCall) {
+		e.numberFormat(intArg(call, 0), intArg(call, 1), 0, e.vm.ToValue("%"), call.Argument(2).ToBoolean(), 100)
+	}))
+	numberKeystroke := void(func(call goja.FunctionCall) {
+		ev := e.event()
+		value := mergeChange(ev)
+		if ev.Get("willCommit").ToBoolean() {
+			if strings.TrimSpace(value) == "" {
+				return
+			}
+			if _, ok := parseNumber(value); !ok {
+				e.reject(ev, invalidFormat(ev))
+			}
+			return
+		}
+		re := partialNumbers[0]
+		if sep := intArg(call, 1); sep == 2 || sep == 3 {
+			re = partialNumbers[1]
+		}
+		if !re.MatchString(value) {
+			ev.Set("rc", false)
+		}
+	})
+	def("AFNumber_Keystroke", numberKeystroke)
+	def("AFPercent_Keystroke", numberKeystroke)
+
+	dateFormat := func(format string) {
+		ev := e.event()
+		value := ev.Get("value").String()
+		if strings.TrimSpace(value) == "" {
+			return
+		}
+		if t, ok := parseDate(format, dateOrder(format), value, time.Now()); ok {
+			ev.Set("value", printd(format, t))
+		}
+	}
+	dateKeystroke := func(format string) {
+		ev := e.event()
+		if !ev.Get("willCommit").ToBoolean() {
+			return
+		}
+		value := ev.Get("value").String()
+		if strings.TrimSpace(value) == "" {
+			return
+		}
+		if _, ok := parseDate(format, dateOrder(format), value, time.Now()); !ok {
+			e.reject(ev, fmt.Sprintf("Invalid date/time: please ensure that the date/time exists. Field [ %s ] should match format %s",
+				targetName(ev), format))
+		}
+	}
+	numbered := func(formats []string, call goja.FunctionCall) string {
+		n := intArg(call, 0)
+		if n < 0 || n >= len(formats) {
+			panic(e.vm.NewTypeError(fmt.Sprintf("invalid format index %d", n)))
+		}
+		return formats[n]
+	}
+	def("AFDate_FormatEx", void(func(call goja.FunctionCall) { dateFormat(call.Argument(0).String()) }))
+	def("AFDate_Format", void(func(call goja.FunctionCall) { dateFormat(numbered(afDateFormats, call)) }))
+	def("AFDate_KeystrokeEx", void(func(call goja.FunctionCall) { dateKeystroke(call.Argument(0).String()) }))
+	def("AFDate_Keystroke", void(func(call goja.FunctionCall) { dateKeystroke(numbered(afDateFormats, call)) }))
+	def("AFTime_FormatEx", void(func(call goja.FunctionCall) { dateFormat(call.Argument(0).String()) }))
+	def("AFTime_Format", void(func(call goja.FunctionCall) { dateFormat(numbered(afTimeFormats, call)) }))
+	def("AFTime_KeystrokeEx", void(func(call goja.FunctionCall) { dateKeystroke(call.Argument(0).String()) }))
+	def("AFTime_Keystroke", void(func(call goja.FunctionCall) { dateKeystroke(numbered(afTimeFormats, call)) }))
+
+	def("AFSpecial_Format", void(func(call goja.FunctionCall) {
+		ev := e.event()
+		value := ev.Get("value").String()
+		psf := intArg(call, 0)
+		if value == "" || psf < 0 || psf >= len(afSpecial) {
+			return
+		}
+		format := afSpecial[psf].format
+		if psf == 2 && len(strings.Join(digitRuns.FindAllString(value, -1), "")) >= 10 {
+			format = "(999) 999-9999"
+		}
+		ev.Set("value", printx(format, value))
+	}))
+	def("AFSpecial_Keystroke", void(func(call goja.FunctionCall) {
+		ev := e.event()
+		psf := intArg(call, 0)
+		if psf < 0 || psf >= len(afSpecial) {
+			return
+		}
+		value := mergeChange(ev)
+		if value == "" {
+			return
+		}
+		if ev.Get("willCommit").ToBoolean() {
+			if !afSpecial[psf].commit.MatchString(value) {
+				e.reject(ev, invalidFormat(ev))
+			}
+		} else if !afSpecial[psf].partial.MatchString(value) {
+			ev.Set("rc", false)
+		}
+	}))
+	def("AFSpecial_KeystrokeEx", void(func(call goja.FunctionCall) {
+		ev := e.event()
+		mask := []rune(call.Argument(0).String())
+		value := []rune(mergeChange(ev))
+		if len(mask) == 0 || len(value) == 0 {
+			return
+		}
+		commit := ev.Get("willCommit").ToBoolean()
+		if len(value) > len(mask) || (commit && len(value) < len(mask)) || !matchMask(value, mask) {
+			e.reject(ev, invalidFormat(ev))
+		}
+	}))
+
+	def("AFSimple_Calculate", void(func(call goja.FunctionCall) {
+		ev := e.event()
+		op := strings.ToUpper(call.Argument(0).String())
+		var names []string
+		for _, n := range e.strings(call.Argument(1)) {
+			for _, part := range strings.Split(n, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					names = append(names, e.terminalNames(part)...)
+				}
+			}
+		}
+		var values []float64
+		for _, name := range names {
+			if p, err := e.dom.GetField(name); err == nil && p != nil {
+				n, _ := makeNumber(e.fieldValue(p))
+				values = append(values, n)
+			}
+		}
+		result := 0.0
+		if op == "PRD" && len(values) > 0 {
+			result = 1
+		}
+		for i, n := range values {
+			if i == 0 && (op == "MIN" || op == "MAX") {
+				result = n
+				continue
+			}
+			result = simple(op, result, n)
+		}
+		if op == "AVG" && len(values) > 0 {
+			result /= float64(len(values))
+		}
+		ev.Set("value", result)
+	}))
+
+	def("AFRange_Validate", void(func(call goja.FunctionCall) {
+		ev := e.event()
+		if strings.TrimSpace(ev.Get("value").String()) == "" {
+			return
+		}
+		v, ok := makeNumber(ev.Get("value"))
+		if !ok {
+			return
+		}
+		greater, low := call.Argument(0).ToBoolean(), call.Argument(1).ToFloat()
+		less, high := call.Argument(2).ToBoolean(), call.Argument(3).ToFloat()
+		switch {
+		case greater && less && (v < low || v > high):
+			e.reject(ev, fmt.Sprintf("Invalid value: must be greater than or equal to %s and less than or equal to %s.", pdfnum.Format(low, -1), pdfnum.Format(high, -1)))
+		case greater && !less && v < low:
+			e.reject(ev, fmt.Sprintf("Invalid value: must be greater than or equal to %s.", pdfnum.Format(low, -1)))
+		case less && !greater && v > high:
+			e.reject(ev, fmt.Sprintf("Invalid value: must be less than or equal to %s.", pdfnum.Format(high, -1)))
+		}
+	}))
+}
+
+// numberFormat formats the event value as a number: AFNumber_Format and,
+// with scale 100 and a % sign as currency, AFPercent_Format. Negative
+// styles are 0 (minus sign), 1 (red), 2 (parentheses) and 3 (red
+// parentheses).
+func (e *GojaEngine) numberFormat(decimals, sepStyle, negStyle int, currency goja.Value, prepend bool, scale float64) {
+	ev := e.event()
+	v, ok := makeNumber(ev.Get("value"))
+	if !ok {
+		ev.Set("value", "")
+		return
+	}
+	v *= scale
+	neg := v < 0 && formatNumber(v, decimals, 1) != formatNumber(0, decimals, 1)
+	s := formatNumber(v, decimals, sepStyle)
+	if cur := currency; defined(cur) {
+		if prepend {
+			s = cur.String() + s
+		} else {
+			s += cur.String()
+		}
+	}
+	if neg {
+		switch negStyle {
+		case 2, 3:
+			s = "(" + s + ")"
+		case 1:
+		default:
+			s = "-" + s
+		}
+	}
+	if negStyle == 1 || negStyle == 3 {
+		if target, ok := ev.Get("target").(*goja.Object); ok {
+			c := []float64{0}
+			if neg {
+				c = []float64{1, 0, 0}
+			}
+			target.Set("textColor", e.colorArray(c))
+		}
+	}
+	ev.Set("value", s)
+}
+
+// simple applies an AFSimple_Calculate operation to a running result.
+func simple(op string, a, b float64) float64 {
+	switch op {
+	case "SUM", "AVG":
+		return a + b
+	case "PRD":
+		return a * b
+	case "MIN":
+		return math.Min(a, b)
+	case "MAX":
+		return math.Max(a, b)
+	}
+	return a
+}
+
+// matchMask reports whether value matches the start of an
+// AFSpecial_KeystrokeEx mask, where 9 is a digit, A a letter, O a letter
+// or digit and X any character.
+func matchMask(value, mask []rune) bool {
+	for i, r := range value {
+		ok := false
+		switch mask[i] {
+		case '9':
+			ok = r >= '0' && r <= '9'
+		case 'A':
+			ok = (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		case 'O':
+			ok = (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		case 'X':
+			ok = true
+		default:
+			ok = r == mask[i]
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
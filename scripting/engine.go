@@ -13,6 +13,54 @@ type Engine interface {
 	RegisterDOM(dom PDFDOM) error
 }
 
+// EventEngine is an Engine that runs scripts in response to events, the
+// way a viewer runs the actions of form fields.
+type EventEngine interface {
+	Engine
+
+	// Dispatch runs script with event exposed as the global event object
+	// and updates event with the changes the script made to it.
+	Dispatch(ctx context.Context, script string, event *Event) error
+}
+
+// Event names of the field events driven by FormRunner.
+const (
+	EventKeystroke = "Keystroke"
+	EventFormat    = "Format"
+	EventValidate  = "Validate"
+	EventCalculate = "Calculate"
+)
+
+// Event describes an Acrobat JavaScript event: the trigger that runs a
+// script and the state the script may change.
+type Event struct {
+	Name   string // Keystroke, Format, Validate, Calculate, ...
+	Type   string // Field or Doc
+	Target string // fully qualified name of the field the event is for
+	Source string // field whose change triggered a calculation, if any
+
+	Value      string // field value; scripts may replace it
+	Change     string // text entered by a keystroke
+	ChangeEx   string // export value of a choice item selected by a keystroke
+	SelStart   int    // start of the selection the change replaces
+	SelEnd     int    // end of the selection the change replaces
+	WillCommit bool   // the keystroke commits the value
+	CommitKey  int    // 0 none, 1 mouse, 2 enter, 3 tab
+	FieldFull  bool   // the keystroke exceeds the field's character limit
+	RC         bool   // scripts set it to false to reject the event
+}
+
+// Field types reported by FormFieldProxy.Type.
+const (
+	FieldText        = "text"
+	FieldCheckBox    = "checkbox"
+	FieldRadioButton = "radiobutton"
+	FieldComboBox    = "combobox"
+	FieldListBox     = "listbox"
+	FieldButton      = "button"
+	FieldSignature   = "signature"
+)
+
 // PDFDOM exposes the PDF document structure to the scripting engine.
 // It provides a safe, controlled API for scripts to interact with the PDF.
 type PDFDOM interface {
@@ -24,12 +72,70 @@ type PDFDOM interface {
 
 	// Alert shows an alert dialog (if supported by the viewer/runner).
 	Alert(message string)
+
+	// FieldNames returns the fully qualified names of the form fields in
+	// document order, each name once.
+	FieldNames() []string
+
+	// CalculationOrder returns the names of the fields whose calculate
+	// actions run, in the order they run (CO entry of the form).
+	CalculationOrder() []string
+
+	// NumPages returns the number of pages.
+	NumPages() int
 }
 
-// FormFieldProxy represents a form field exposed to scripts.
+// FormFieldProxy represents a form field exposed to scripts. A field may
+// have several widgets, such as the buttons of a radio group; they share
+// the value.
 type FormFieldProxy interface {
+	// GetValue returns the value: a string for text fields, the export
+	// value of the selected button or "Off" for check boxes and radio
+	// buttons, and the selected items of choice fields as a string or,
+	// for several selected items, a []string.
 	GetValue() interface{}
 	SetValue(value interface{})
+
+	// Name returns the fully qualified field name.
+	Name() string
+	// Type returns the field type, one of the Field* constants.
+	Type() string
+	// Flags returns the field flags (Ff entry).
+	Flags() int
+	SetFlags(flags int)
+	// AnnotationFlags returns the annotation flags of the first widget.
+	AnnotationFlags() int
+	// SetAnnotationFlags sets the annotation flags of every widget.
+	SetAnnotationFlags(flags int)
+	// Items returns the options of a choice field, or the export values
+	// of the widgets of a check box or radio button.
+	Items() []FieldItem
+	SetItems(items []FieldItem)
+	// Color returns a colour of the field as PDF colour components: the
+	// "text" colour of its default appearance, or the "fill" and
+	// "stroke" colours of its widgets (MK BG and BC). No components
+	// means transparent.
+	Color(kind string) []float64
+	SetColor(kind string, components []float64)
+	// CharLimit returns the maximum length of a text field, 0 if none.
+	CharLimit() int
+	// PageIndex returns the page of the first widget.
+	PageIndex() int
+	// Rect returns the rectangle of the first widget.
+	Rect() [4]float64
+	// Action returns the JavaScript of the additional action run by
+	// trigger: "K" (keystroke), "F" (format), "V" (validate) or "C"
+	// (calculate).
+	Action(trigger string) string
+	// SetDisplayValue sets the text shown by the field's appearance, the
+	// value as formatted by its format action.
+	SetDisplayValue(text string)
+}
+
+// FieldItem is an option of a choice field.
+type FieldItem struct {
+	Display string
+	Export  string
 }
 
 // PageProxy represents a page exposed to scripts.
@@ -0,0 +1,231 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// FormRunner processes a form the way an interactive viewer does. Values
+// entered with Commit go through the keystroke (K) and validate (V)
+// actions of their field; every change is followed by the calculate (C)
+// actions of the form in its calculation order; and the format (F)
+// action of each changed field decides the text its appearance shows.
+// Results are written back through the DOM.
+//
+// Script errors do not stop the processing of other fields. They are
+// returned joined, labelled with the event and field. Every event runs
+// within the time and memory limits of the engine, which for an engine
+// from NewEngine are DefaultTimeout and DefaultMemoryLimit; a run that
+// exceeds them stops the processing of the form.
+type FormRunner struct {
+	engine EventEngine
+	dom    PDFDOM
+
+	calculating bool
+}
+
+// NewFormRunner registers dom with engine and returns a runner for its form.
+func NewFormRunner(engine EventEngine, dom PDFDOM) (*FormRunner, error) {
+	if engine == nil || dom == nil {
+		return nil, errors.New("scripting: form runner needs an engine and a DOM")
+	}
+	if err := engine.RegisterDOM(dom); err != nil {
+		return nil, err
+	}
+	r := &FormRunner{engine: engine, dom: dom}
+	if g, ok := engine.(*GojaEngine); ok {
+		g.form = r
+	}
+	return r, nil
+}
+
+// Run recalculates the form and formats every field, as a viewer does when
+// it opens a document.
+func (r *FormRunner) Run(ctx context.Context) error {
+	var errs []error
+	if err := r.Calculate(ctx); err != nil {
+		if isContextError(err) {
+			return err
+		}
+		errs = append(errs, err)
+	}
+	for _, name := range r.dom.FieldNames() {
+		if err := r.Format(ctx, name); err != nil {
+			if isContextError(err) {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Commit enters value into the field name as a user typing it and leaving
+// the field would: the keystroke action sees the value as one change and
+// then as the committed value, the validate action checks it, and only if
+// both accept it is the value stored, the form recalculated and the field
+// formatted. Commit reports whether the value was accepted.
+func (r *FormRunner) Commit(ctx context.Context, name, value string) (bool, error) {
+	field, err := r.dom.GetField(name)
+	if err != nil {
+		return false, err
+	}
+	typ := field.Type()
+	if typ == FieldText || typ == FieldComboBox {
+		if script := field.Action("K"); script != "" {
+			current := valueString(field.GetValue())
+			ev := &Event{Name: EventKeystroke, Target: name, Value: current, Change: value,
+				SelStart: 0, SelEnd: len([]rune(current)), RC: true}
+			if err := r.dispatch(ctx, script, ev); err != nil || !ev.RC {
+				return false, err
+			}
+			value = ev.merged()
+			ev = &Event{Name: EventKeystroke, Target: name, Value: value, WillCommit: true, CommitKey: 3, RC: true}
+			if err := r.dispatch(ctx, script, ev); err != nil || !ev.RC {
+				return false, err
+			}
+			value = ev.Value
+		}
+	}
+	if script := field.Action("V"); script != "" {
+		ev := &Event{Name: EventValidate, Target: name, Value: value, RC: true}
+		if err := r.dispatch(ctx, script, ev); err != nil || !ev.RC {
+			return false, err
+		}
+		value = ev.Value
+	}
+	field.SetValue(value)
+	var errs []error
+	if err := r.calculate(ctx, name); err != nil {
+		if isContextError(err) {
+			return true, err
+		}
+		errs = append(errs, err)
+	}
+	if err := r.Format(ctx, name); err != nil {
+		errs = append(errs, err)
+	}
+	return true, errors.Join(errs...)
+}
+
+// Calculate runs the calculate actions of the form: first those of the
+// fields in the calculation order, then those of other fields in document
+// order. A calculated value replaces the field value if the validate
+// action of the field accepts it, and the field is then formatted.
+func (r *FormRunner) Calculate(ctx context.Context) error {
+	return r.calculate(ctx, "")
+}
+
+func (r *FormRunner) calculate(ctx context.Context, source string) error {
+	if r.calculating {
+		return nil // calculateNow from a calculation
+	}
+	r.calculating = true
+	defer func() { r.calculating = false }()
+
+	var errs []error
+	for _, name := range r.calculationOrder() {
+		if err := r.calculateField(ctx, name, source); err != nil {
+			if isContextError(err) {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// calculationOrder returns the fields with calculate actions in the order
+// they run.
+func (r *FormRunner) calculationOrder() []string {
+	var order []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		if f, err := r.dom.GetField(name); err == nil && f != nil && f.Action("C") != "" {
+			order = append(order, name)
+		}
+	}
+	for _, name := range r.dom.CalculationOrder() {
+		add(name)
+	}
+	for _, name := range r.dom.FieldNames() {
+		add(name)
+	}
+	return order
+}
+
+func (r *FormRunner) calculateField(ctx context.Context, name, source string) error {
+	field, err := r.dom.GetField(name)
+	if err != nil {
+		return err
+	}
+	current := valueString(field.GetValue())
+	ev := &Event{Name: EventCalculate, Target: name, Source: source, Value: current, RC: true}
+	if err := r.dispatch(ctx, field.Action("C"), ev); err != nil || !ev.RC || ev.Value == current {
+		return err
+	}
+	value := ev.Value
+	if script := field.Action("V"); script != "" {
+		ev := &Event{Name: EventValidate, Target: name, Source: source, Value: value, RC: true}
+		if err := r.dispatch(ctx, script, ev); err != nil || !ev.RC {
+			return err
+		}
+		value = ev.Value
+	}
+	field.SetValue(value)
+	return r.Format(ctx, name)
+}
+
+// Format runs the format action of the field name and shows its result,
+// or the plain value if the field has no format action, in the field's
+// appearance.
+func (r *FormRunner) Format(ctx context.Context, name string) error {
+	field, err := r.dom.GetField(name)
+	if err != nil {
+		return err
+	}
+	value := valueString(field.GetValue())
+	script := field.Action("F")
+	if script == "" {
+		field.SetDisplayValue(value)
+		return nil
+	}
+	ev := &Event{Name: EventFormat, Target: name, Value: value, WillCommit: true, RC: true}
+	err = r.dispatch(ctx, script, ev)
+	if err == nil && ev.RC {
+		value = ev.Value
+	}
+	field.SetDisplayValue(value)
+	return err
+}
+
+// merged returns the value a keystroke event proposes: its value with the
+// selection replaced by the change.
+func (ev *Event) merged() string {
+	value := []rune(ev.Value)
+	start, end := max(0, min(ev.SelStart, len(value))), max(0, min(ev.SelEnd, len(value)))
+	if end < start {
+		end = start
+	}
+	return string(value[:start]) + ev.Change + string(value[end:])
+}
+
+func (r *FormRunner) dispatch(ctx context.Context, script string, ev *Event) error {
+	if err := r.engine.Dispatch(ctx, script, ev); err != nil {
+		if isContextError(err) {
+			return err
+		}
+		return fmt.Errorf("%s (%s): %w", ev.Name, ev.Target, err)
+	}
+	return nil
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrTimeout) || errors.Is(err, ErrMemoryLimit)
+}
@@ -0,0 +1,301 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testField and testDOM are an in-memory form.
+type testField struct {
+	name       string
+	typ        string
+	value      interface{}
+	flags      int
+	annotFlags int
+	items      []FieldItem
+	colors     map[string][]float64
+	maxLen     int
+	actions    map[string]string
+	display    string
+}
+
+func (f *testField) GetValue() interface{}        { return f.value }
+func (f *testField) SetValue(v interface{})       { f.value = v }
+func (f *testField) Name() string                 { return f.name }
+func (f *testField) Type() string                 { return f.typ }
+func (f *testField) Flags() int                   { return f.flags }
+func (f *testField) SetFlags(flags int)           { f.flags = flags }
+func (f *testField) AnnotationFlags() int         { return f.annotFlags }
+func (f *testField) SetAnnotationFlags(flags int) { f.annotFlags = flags }
+func (f *testField) Items() []FieldItem           { return f.items }
+func (f *testField) SetItems(items []FieldItem)   { f.items = items }
+func (f *testField) Color(kind string) []float64  { return f.colors[kind] }
+func (f *testField) CharLimit() int               { return f.maxLen }
+func (f *testField) PageIndex() int               { return 0 }
+func (f *testField) Rect() [4]float64             { return [4]float64{10, 20, 110, 40} }
+func (f *testField) Action(trigger string) string { return f.actions[trigger] }
+func (f *testField) SetDisplayValue(text string)  { f.display = text }
+func (f *testField) SetColor(kind string, c []float64) {
+	if f.colors == nil {
+		f.colors = make(map[string][]float64)
+	}
+	f.colors[kind] = c
+}
+
+type testDOM struct {
+	fields []*testField
+	order  []string
+	alerts []string
+}
+
+func (d *testDOM) GetField(name string) (FormFieldProxy, error) {
+	for _, f := range d.fields {
+		if f.name == name {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("field not found: %s", name)
+}
+
+func (d *testDOM) GetPage(index int) (PageProxy, error) { return nil, fmt.Errorf("no pages") }
+func (d *testDOM) Alert(message string)                 { d.alerts = append(d.alerts, message) }
+func (d *testDOM) CalculationOrder() []string           { return d.order }
+func (d *testDOM) NumPages() int                        { return 2 }
+
+func (d *testDOM) FieldNames() []string {
+	var names []string
+	for _, f := range d.fields {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+func (d *testDOM) field(name string) *testField {
+	f, _ := d.GetField(name)
+	return f.(*testField)
+}
+
+func text(name, value string, actions map[string]string) *testField {
+	return &testField{name: name, typ: FieldText, value: value, actions: actions}
+}
+
+// invoice is an order form: quantities and prices, line totals, a
+// discount validated to at most 50 percent and a total of the line totals
+// calculated with AFSimple_Calculate.
+func invoice() *testDOM {
+	money := map[string]string{"F": `AFNumber_Format(2, 0, 0, 0, "$", true);`, "K": `AFNumber_Keystroke(2, 0, 0, 0, "$", true);`}
+	line := func(n string) map[string]string {
+		return map[string]string{
+			"C": `event.value = this.getField("qty` + n + `").value * this.getField("price` + n + `").value;`,
+			"F": money["F"],
+		}
+	}
+	return &testDOM{
+		fields: []*testField{
+			text("qty1", "2", map[string]string{"K": `AFNumber_Keystroke(0, 1, 0, 0, "", true);`}),
+			text("price1", "9.5", money),
+			text("qty2", "1", nil),
+			text("price2", "100", money),
+			text("line.1", "", line("1")),
+			text("line.2", "", line("2")),
+			text("discount", "0.1", map[string]string{
+				"V": `AFRange_Validate(true, 0, true, 0.5);`,
+				"F": `AFPercent_Format(0, 0);`,
+			}),
+			text("total", "", map[string]string{
+				"C": `AFSimple_Calculate("SUM", "line"); event.value = event.value * (1 - this.getField("discount").value);`,
+				"F": `AFNumber_Format(2, 0, 2, 0, "€", false);`,
+			}),
+		},
+		order: []string{"line.1", "line.2", "total"},
+	}
+}
+
+func TestFormRunner_Run(t *testing.T) {
+	dom := invoice()
+	runner, err := NewFormRunner(NewEngine(), dom)
+	if err != nil {
+		t.Fatalf("NewFormRunner: %v", err)
+	}
+	if err := runner.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for name, want := range map[string][2]string{
+		"line.1":   {"19", "$19.00"},
+		"line.2":   {"100", "$100.00"},
+		"price1":   {"9.5", "$9.50"},
+		"qty2":     {"1", "1"},
+		"discount": {"0.1", "10%"},
+	} {
+		f := dom.field(name)
+		if f.value != want[0] || f.display != want[1] {
+			t.Errorf("%s = %v shown as %q, want %q shown as %q", name, f.value, f.display, want[0], want[1])
+		}
+	}
+}
+
+func TestFormRunner_Commit(t *testing.T) {
+	dom := invoice()
+	runner, _ := NewFormRunner(NewEngine(), dom)
+	ctx := context.Background()
+
+	ok, err := runner.Commit(ctx, "qty2", "3")
+	if !ok || err != nil {
+		t.Fatalf("Commit qty2 = %v, %v", ok, err)
+	}
+	if got := dom.field("line.2").display; got != "$300.00" {
+		t.Errorf("line.2 shown as %q after commit", got)
+	}
+	if got := dom.field("total").display; got != "287.10€" {
+		t.Errorf("total shown as %q after commit", got)
+	}
+
+	// The keystroke action rejects letters, the validate action a
+	// discount above 50 percent; rejected values are not stored.
+	if ok, err := runner.Commit(ctx, "qty1", "2x"); ok || err != nil {
+		t.Errorf("Commit qty1 2x = %v, %v", ok, err)
+	}
+	if ok, err := runner.Commit(ctx, "discount", "0.8"); ok || err != nil {
+		t.Errorf("Commit discount 80 = %v, %v", ok, err)
+	}
+	if dom.field("qty1").value != "2" || dom.field("discount").value != "0.1" {
+		t.Errorf("rejected values stored: qty1 %v, discount %v", dom.field("qty1").value, dom.field("discount").value)
+	}
+	if len(dom.alerts) != 1 || !strings.Contains(dom.alerts[0], "less than or equal to 0.5") {
+		t.Errorf("alerts = %q", dom.alerts)
+	}
+
+	if ok, err := runner.Commit(ctx, "discount", "0.5"); !ok || err != nil {
+		t.Fatalf("Commit discount 50 = %v, %v", ok, err)
+	}
+	if got := dom.field("total").display; got != "159.50€" {
+		t.Errorf("total shown as %q", got)
+	}
+
+	dom.field("price2").value = "-10"
+	if err := runner.Calculate(ctx); err != nil {
+		t.Fatalf("Calculate: %v", err)
+	}
+	if got := dom.field("total").display; got != "(5.50€)" {
+		t.Errorf("negative total shown as %q", got)
+	}
+}
+
+func TestFormRunner_KeystrokeChange(t *testing.T) {
+	dom := &testDOM{fields: []*testField{
+		text("code", "", map[string]string{"K": `if (!event.willCommit) event.change = event.change.toUpperCase();`}),
+		text("zip", "", map[string]string{"K": `AFSpecial_Keystroke(0);`, "F": `AFSpecial_Format(0);`}),
+	}}
+	runner, _ := NewFormRunner(NewEngine(), dom)
+	if ok, err := runner.Commit(context.Background(), "code", "ab-1"); !ok || err != nil {
+		t.Fatalf("Commit = %v, %v", ok, err)
+	}
+	if got := dom.field("code").value; got != "AB-1" {
+		t.Errorf("code = %v", got)
+	}
+	if ok, _ := runner.Commit(context.Background(), "zip", "1234"); ok {
+		t.Errorf("short zip code accepted")
+	}
+	if ok, _ := runner.Commit(context.Background(), "zip", "12345"); !ok || dom.field("zip").display != "12345" {
+		t.Errorf("zip code rejected or shown as %q", dom.field("zip").display)
+	}
+}
+
+func TestFormRunner_Errors(t *testing.T) {
+	dom := &testDOM{fields: []*testField{
+		text("bad", "", map[string]string{"C": `nosuchfunction();`}),
+		text("good", "", map[string]string{"C": `event.value = 42;`}),
+	}}
+	runner, _ := NewFormRunner(NewEngine(), dom)
+	err := runner.Calculate(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "Calculate (bad)") {
+		t.Fatalf("expected labelled error, got %v", err)
+	}
+	if dom.field("good").value != "42" {
+		t.Errorf("good = %v, want calculation after a failing one", dom.field("good").value)
+	}
+
+	slow := &testDOM{fields: []*testField{text("loop", "", map[string]string{"C": `while (true) {}`})}}
+	runner, _ = NewFormRunner(NewEngine(WithTimeout(20*time.Millisecond)), slow)
+	if err := runner.Run(context.Background()); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected time limit error, got %v", err)
+	}
+}
+
+func TestDocAndFieldAPI(t *testing.T) {
+	dom := &testDOM{fields: []*testField{
+		text("amount", "1,5", nil),
+		text("name", "007 Agent", nil),
+		{name: "agree", typ: FieldCheckBox, value: "Off", items: []FieldItem{{"Yes", "Yes"}}},
+		{name: "ship", typ: FieldRadioButton, value: "Ground", items: []FieldItem{{"Express", "Express"}, {"Ground", "Ground"}}},
+		{name: "colors", typ: FieldListBox, value: []string{"Red", "Blue"},
+			items: []FieldItem{{"Red", "R"}, {"Green", "G"}, {"Blue", "B"}}},
+		text("party.first", "Jane", nil),
+		text("party.last", "Doe", nil),
+	}}
+	engine := NewEngine()
+	if err := engine.RegisterDOM(dom); err != nil {
+		t.Fatal(err)
+	}
+	run := func(script string) interface{} {
+		t.Helper()
+		v, err := engine.Execute(context.Background(), script)
+		if err != nil {
+			t.Fatalf("%s: %v", script, err)
+		}
+		return v
+	}
+	for script, want := range map[string]interface{}{
+		`this.getField("amount").value + 1`:                                            2.5,
+		`typeof getField("name").value`:                                                "string",
+		`getField("amount").valueAsString`:                                             "1,5",
+		`numFields + "/" + numPages + "/" + getNthFieldName(1)`:                        "7/2/name",
+		`getField("ship").isBoxChecked(1) && !getField("ship").isBoxChecked(0)`:        true,
+		`getField("colors").getItemAt(2, false) + getField("colors").getItemAt(0)`:     "BlueR",
+		`getField("party").getArray().map(function (f) { return f.value; }).join(" ")`: "Jane Doe",
+		`getField("nosuch") === null`:                                                  true,
+		`color.equal(color.convert(["RGB", 1, 1, 1], "G"), color.white)`:               true,
+		`util.printf("%,0.2f|%05d|%s|%x|%+.1f", 1234567.891, 42, "s", 255, 3)`:         "1,234,567.89|00042|s|ff|+3.0",
+		`util.printd("dddd, mmmm d, yyyy HH:MM", new Date(2024, 1, 29, 13, 5))`:        "Thursday, February 29, 2024 13:05",
+		`util.printd(2, util.scand("yyyy-mm-dd h:MM tt", "2023-12-01 9:30 pm"))`:       "12/1/23 9:30:00 pm",
+		`util.scand("mm/dd/yyyy", "02/30/2024")`:                                       nil,
+		`util.printx("(999) 999-9999", "555.123.4567")`:                                "(555) 123-4567",
+		`AFMakeNumber("$1,50") + AFMakeNumber(".5") + AFMakeNumber("abc")`:             int64(2),
+	} {
+		if got := run(script); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %#v, want %#v", script, got, want)
+		}
+	}
+
+	run(`getField("agree").checkThisBox(0);
+		getField("ship").value = "Express";
+		getField("colors").currentValueIndices = [1];
+		var f = getField("party");
+		f.readonly = true;
+		f.display = display.hidden;
+		getField("name").textColor = color.blue;
+		app.alert({cMsg: "done"});`)
+	if dom.field("agree").value != "Yes" || dom.field("ship").value != "Express" {
+		t.Errorf("buttons = %v, %v", dom.field("agree").value, dom.field("ship").value)
+	}
+	if !reflect.DeepEqual(dom.field("colors").value, []string{"G"}) {
+		t.Errorf("colors = %#v", dom.field("colors").value)
+	}
+	if dom.field("party.last").flags != 1 || dom.field("party.first").annotFlags != 2 {
+		t.Errorf("group properties not applied: flags %d, annotation flags %d", dom.field("party.last").flags, dom.field("party.first").annotFlags)
+	}
+	if !reflect.DeepEqual(dom.field("name").colors["text"], []float64{0, 0, 1}) {
+		t.Errorf("text colour = %v", dom.field("name").colors["text"])
+	}
+	if !reflect.DeepEqual(dom.alerts, []string{"done"}) {
+		t.Errorf("alerts = %q", dom.alerts)
+	}
+	if run(`dirty`) != true {
+		t.Errorf("document not dirty after changes")
+	}
+}
@@ -2,111 +2,200 @@ package scripting
 
 import (
 	"context"
+	"errors"
+	"io"
+	"time"
 
 	"github.com/dop251/goja"
 )
 
+// Sandbox errors returned when a script exceeds a limit of the engine.
+var (
+	ErrTimeout     = errors.New("scripting: script exceeded its time limit")
+	ErrMemoryLimit = errors.New("scripting: script exceeded its memory limit")
+)
+
+// Default sandbox limits of NewEngine. Every Execute and Dispatch call of
+// an engine created without WithTimeout fails with ErrTimeout after
+// DefaultTimeout, and with ErrMemoryLimit once it has allocated more than
+// DefaultMemoryLimit bytes; pass WithTimeout(0) or WithMemoryLimit(0) to
+// lift a limit.
+const (
+	DefaultTimeout          = 5 * time.Second
+	DefaultMemoryLimit      = 256 << 20
+	DefaultMaxCallStackSize = 1024
+)
+
+// GojaEngine runs Acrobat JavaScript with goja. Scripts see the document
+// as the global object (this), the event being processed as event, and
+// the app, util, color, display, console and global objects and AF*
+// functions of the Acrobat JavaScript API. Scripts cannot reach the file
+// system, the network or the host process, and each run is bounded by a
+// time limit and a memory limit.
 type GojaEngine struct {
 	vm *goja.Runtime
+
+	timeout     time.Duration
+	memoryLimit uint64
+	allocated   int64
+	console     io.Writer
+
+	dom     PDFDOM
+	form    *FormRunner
+	ctx     context.Context
+	running bool
+	dirty   bool
+	fields  map[string]*goja.Object
+}
+
+// Option configures a GojaEngine.
+type Option func(*GojaEngine)
+
+// WithTimeout bounds the time a single script run may take. A zero or
+// negative duration disables the limit.
+func WithTimeout(d time.Duration) Option {
+	return func(e *GojaEngine) {
+		e.timeout = d
+	}
+}
+
+// WithMemoryLimit interrupts a script run with ErrMemoryLimit once it has
+// allocated more than bytes in total. Scripts are instrumented before they
+// are compiled, so that strings, objects, arrays, functions, object
+// properties, Map and Set entries, ArrayBuffers and typed arrays are
+// charged as the script creates them, at an estimate of what goja
+// allocates for each; builtins whose result size is known in advance,
+// such as repeat, fill or the ArrayBuffer constructor, are refused before
+// they allocate. The budget is kept per run and memory released during
+// the run is not credited back, so the limit bounds the allocations of a
+// run rather than its live heap. Instrumented scripts may not use with
+// statements or rebind eval. Zero disables the limit.
+func WithMemoryLimit(bytes uint64) Option {
+	return func(e *GojaEngine) {
+		e.memoryLimit = bytes
+	}
 }
 
-func NewEngine() *GojaEngine {
+// WithMaxCallStackSize bounds the depth of the script call stack.
+func WithMaxCallStackSize(size int) Option {
+	return func(e *GojaEngine) {
+		e.vm.SetMaxCallStackSize(size)
+	}
+}
+
+// WithConsole sets the writer console.println writes to. Output is
+// discarded by default.
+func WithConsole(w io.Writer) Option {
+	return func(e *GojaEngine) {
+		e.console = w
+	}
+}
+
+// NewEngine creates a JavaScript engine with the default sandbox limits:
+// DefaultTimeout and DefaultMemoryLimit per run and DefaultMaxCallStackSize.
+func NewEngine(opts ...Option) *GojaEngine {
 	vm := goja.New()
-	return &GojaEngine{vm: vm}
+	vm.SetMaxCallStackSize(DefaultMaxCallStackSize)
+	e := &GojaEngine{
+		vm:          vm,
+		timeout:     DefaultTimeout,
+		memoryLimit: DefaultMemoryLimit,
+		console:     io.Discard,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.installGuard()
+	e.installGlobals()
+	return e
 }
 
 func (e *GojaEngine) Execute(ctx context.Context, script string) (interface{}, error) {
+	val, err := e.run(ctx, script)
+	if err != nil {
+		return nil, err
+	}
+	return val.Export(), nil
+}
+
+// Dispatch runs script with event as the global event object. The event
+// is updated with the value, change, selection and return code the script
+// leaves in it, also when the script fails.
+func (e *GojaEngine) Dispatch(ctx context.Context, script string, event *Event) error {
+	obj := e.eventObject(event)
+	prev := e.vm.Get("event")
+	e.vm.Set("event", obj)
+	defer e.vm.Set("event", prev)
+
+	_, err := e.run(ctx, script)
+	e.readEvent(obj, event)
+	return err
+}
+
+// run runs script within the sandbox limits. Scripts started by a running
+// script, such as the calculations of Doc.calculateNow, run within the
+// limits of the outer run and share its memory budget.
+func (e *GojaEngine) run(ctx context.Context, script string) (goja.Value, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
+	prg, err := e.compile(script)
+	if err != nil {
+		return nil, err
+	}
+	if e.running {
+		return e.vm.RunProgram(prg)
+	}
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, e.timeout, ErrTimeout)
+		defer cancel()
+	}
+	e.running, e.ctx, e.allocated = true, ctx, 0
+	defer func() { e.running, e.ctx = false, nil }()
 
 	done := make(chan struct{})
-	defer close(done)
-	defer e.vm.ClearInterrupt()
-
+	stopped := make(chan struct{})
 	go func() {
-		select {
-		case <-ctx.Done():
-			e.vm.Interrupt(ctx.Err())
-		case <-done:
-		}
+		defer close(stopped)
+		e.watch(ctx, done)
 	}()
+	val, err := e.vm.RunProgram(prg)
+	close(done)
+	<-stopped
+	e.vm.ClearInterrupt()
 
-	val, err := e.vm.RunString(script)
 	if err != nil {
-		if interruptedErr, ok := err.(*goja.InterruptedError); ok {
-			if cause := interruptedErr.Unwrap(); cause != nil {
+		var interrupted *goja.InterruptedError
+		if errors.As(err, &interrupted) {
+			if cause := interrupted.Unwrap(); cause != nil {
 				return nil, cause
 			}
 			return nil, context.Canceled
 		}
 		return nil, err
 	}
-	return val.Export(), nil
+	return val, nil
 }
 
-func (e *GojaEngine) RegisterDOM(dom PDFDOM) error {
-	// Expose 'app' object
-	appObj := e.vm.NewObject()
-	err := appObj.Set("alert", func(call goja.FunctionCall) goja.Value {
-		msg := ""
-		if len(call.Arguments) > 0 {
-			msg = call.Arguments[0].String()
-		}
-		dom.Alert(msg)
-		return goja.Undefined()
-	})
-	if err != nil {
-		return err
+// watch interrupts the running script when ctx ends, until done is closed.
+func (e *GojaEngine) watch(ctx context.Context, done <-chan struct{}) {
+	select {
+	case <-done:
+	case <-ctx.Done():
+		e.vm.Interrupt(context.Cause(ctx))
 	}
-	e.vm.Set("app", appObj)
-
-	// Expose Doc methods globally (as if 'this' is the Doc)
-	e.vm.Set("getField", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) < 1 {
-			return goja.Undefined()
-		}
-		name := call.Arguments[0].String()
-		field, err := dom.GetField(name)
-		if err != nil || field == nil {
-			return goja.Null()
-		}
-
-		// Create JS object for field with 'value' property
-		obj := e.vm.NewObject()
-		obj.DefineAccessorProperty("value",
-			e.vm.ToValue(func(call goja.FunctionCall) goja.Value {
-				return e.vm.ToValue(field.GetValue())
-			}),
-			e.vm.ToValue(func(call goja.FunctionCall) goja.Value {
-				if len(call.Arguments) > 0 {
-					field.SetValue(call.Arguments[0].Export())
-				}
-				return goja.Undefined()
-			}),
-			goja.FLAG_TRUE, // Configurable
-			goja.FLAG_TRUE, // Enumerable
-		)
-
-		return obj
-	})
-
-	e.vm.Set("getPage", func(call goja.FunctionCall) goja.Value {
-		if len(call.Arguments) < 1 {
-			return goja.Undefined()
-		}
-		idx := int(call.Arguments[0].ToInteger())
-		page, err := dom.GetPage(idx)
-		if err != nil || page == nil {
-			return goja.Null()
-		}
-		return e.vm.ToValue(&pageProxyWrapper{p: page})
-	})
+}
 
-	return nil
+// RegisterDOM exposes dom to scripts: the global object becomes the
+// document, with getField, numPages and the other Doc members.
+func (e *GojaEngine) RegisterDOM(dom PDFDOM) error {
+	e.dom = dom
+	e.fields = make(map[string]*goja.Object)
+	return e.installDoc()
 }
 
 type pageProxyWrapper struct {
@@ -32,3 +32,116 @@ func TestGojaEngine_ImmediateCancel(t *testing.T) {
 		t.Fatalf("expected context canceled error, got %v", err)
 	}
 }
+
+func TestGojaEngine_Limits(t *testing.T) {
+	engine := NewEngine(WithTimeout(20 * time.Millisecond))
+	if _, err := engine.Execute(context.Background(), "while (true) {}"); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+
+	for _, script := range []string{
+		"var a = []; while (true) { a.push(new Array(1000).fill(1)); }",
+		"var s = 'x'; while (true) { s += s; }",
+		"var s = 'x'; while (true) { s = `${s}${s}`; }",
+		"var a = []; for (var i = 0; ; i++) { a[i] = i; }",
+		"'x'.repeat(1e12)",
+		"new Array(1e9).fill(0)",
+		"eval('var s = \\'x\\'; while (true) { s = s + s; }')",
+		"new Function('var s = \\'x\\'; while (true) { s = s.concat(s); }')()",
+		"(function () {}).constructor('var s = \\'x\\'; while (true) { s += s; }')()",
+		"try { var s = 'x'; while (true) { s += s; } } catch (e) {} 'caught'",
+		"globalThis.eval('var s = \\'x\\'; while (true) { s += s; }')",
+		"(0, eval)('var a = []; for (var i = 0; ; i++) { a[i] = i; }')",
+		"function f() { var s = 'x'; return eval('while (true) { s += s; }'); } f()",
+		"new ArrayBuffer(1 << 30)",
+		"new Uint8Array(1 << 29)",
+		"var o = {}; for (var i = 0; i < 3e6; i++) { o['k' + i] = i; }",
+		"var o = {}; for (var i = 0; i < 3e6; i++) { Object.defineProperty(o, i, { value: i }); }",
+		"var m = new Map(); for (var i = 0; ; i++) { m.set(i, i); }",
+	} {
+		engine = NewEngine(WithMemoryLimit(4<<20), WithTimeout(time.Minute))
+		if _, err := engine.Execute(context.Background(), script); !errors.Is(err, ErrMemoryLimit) {
+			t.Fatalf("%s: expected memory limit error, got %v", script, err)
+		}
+		if v, err := engine.Execute(context.Background(), "'ok'.repeat(2)"); err != nil || v != "okok" {
+			t.Fatalf("%s: engine should recover after the memory limit, got %v, %v", script, v, err)
+		}
+	}
+	for _, script := range []string{
+		"var __pdfkit_charge = function (v) { return v; };",
+		"eval = function (s) { return s; };",
+		"var eval;",
+		"with ({}) { 1; }",
+	} {
+		if _, err := engine.Execute(context.Background(), script); err == nil {
+			t.Fatalf("%s: expected the script to be rejected", script)
+		}
+	}
+
+	engine = NewEngine(WithMaxCallStackSize(64))
+	if _, err := engine.Execute(context.Background(), "function f() { return f(); } f();"); err == nil {
+		t.Fatal("expected stack overflow error")
+	}
+	if v, err := engine.Execute(context.Background(), "1 + 1"); err != nil || v != int64(2) {
+		t.Fatalf("engine should recover after limits, got %v, %v", v, err)
+	}
+}
+
+func TestGojaEngine_DefaultLimits(t *testing.T) {
+	engine := NewEngine()
+	if engine.timeout != DefaultTimeout {
+		t.Errorf("default timeout = %v, want %v", engine.timeout, DefaultTimeout)
+	}
+	if engine.memoryLimit != DefaultMemoryLimit {
+		t.Errorf("default memory limit = %d, want %d", engine.memoryLimit, DefaultMemoryLimit)
+	}
+	// The budget is charged per run, not against the heap of the process.
+	for i := 0; i < 3; i++ {
+		v, err := engine.Execute(context.Background(), "var s = ''; for (var i = 0; i < 1000; i++) { s += 'ab' + i; } s.length")
+		if err != nil || v != int64(4890) {
+			t.Fatalf("run %d = %v, %v", i, v, err)
+		}
+	}
+
+	for _, script := range []string{
+		"new ArrayBuffer(1 << 30)",
+		"new Uint8Array(1 << 29)",
+	} {
+		if _, err := engine.Execute(context.Background(), script); !errors.Is(err, ErrMemoryLimit) {
+			t.Fatalf("%s: expected memory limit error, got %v", script, err)
+		}
+	}
+
+	// WithTimeout(0) restores unbounded runs.
+	engine = NewEngine(WithTimeout(0))
+	if engine.timeout != 0 {
+		t.Fatalf("timeout = %v after WithTimeout(0)", engine.timeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := engine.Execute(ctx, "while (true) {}"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the caller's deadline, got %v", err)
+	}
+}
+
+func TestGojaEngine_GuardSemantics(t *testing.T) {
+	engine := NewEngine()
+	for script, want := range map[string]any{
+		"function f() { var x = 1; return eval('x + 1'); } f()":            int64(2),
+		"var x = 1; (function () { var x = 2; return (0, eval)('x'); })()": int64(1),
+		"var o = { a: 1 }; o.b = 2; o['c'] = 3; o.a += o.b + o.c; o.a":     int64(6),
+		"var a = [1, 2]; a[a.length] = 3; a.push(4); a.join('')":           "1234",
+		"var o = {}; var k = 'x'; o[k] = 1; o[k]++; o.x":                   int64(2),
+		"class A { constructor(v) { this.v = v; } } new A(3).v":            int64(3),
+		"var f = function () { return 'f'; }; f() + (() => 'g')()":         "fg",
+		"`a${1 + 1}b`": "a2b",
+		"new Uint8Array([1, 2, 3]).map(function (v) { return v * 2; })[2]": int64(6),
+		"class B extends Uint8Array {} new B(4) instanceof Uint8Array":     true,
+		"new Function('a', 'b', 'return a + b')(1, 2)":                     int64(3),
+		"var s = 'x'; /* ( */ s += 'y'; s":                                 "xy",
+	} {
+		if v, err := engine.Execute(context.Background(), script); err != nil || v != want {
+			t.Errorf("%s = %v, %v; want %v", script, v, err, want)
+		}
+	}
+}
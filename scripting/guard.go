@@ -0,0 +1,922 @@
+package scripting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/token"
+)
+
+// Globals the instrumented scripts call to charge what they allocate
+// against the budget of the run. Scripts may not use names with the
+// prefix.
+const (
+	guardPrefix = "__pdfkit_"
+	guardValue  = guardPrefix + "charge" // strings and arrays
+	guardObject = guardPrefix + "alloc"  // literals, functions and new
+	guardSlot   = guardPrefix + "slot"   // member assignment
+	guardKey    = guardPrefix + "key"    // key of the last guardSlot
+	guardSource = guardPrefix + "source" // source of a direct eval
+	guardEval   = guardPrefix + "eval"   // eval called other than directly
+)
+
+// Bytes charged per string character, array element, object property or
+// Map and Set entry, and per object, array or function created. They
+// approximate what goja allocates for each.
+const (
+	charBytes   = 2
+	slotBytes   = 32
+	propBytes   = 128
+	objectBytes = 512
+)
+
+var arrayBufferType = reflect.TypeOf(goja.ArrayBuffer{})
+
+// compile parses script and, when the engine has a memory limit,
+// instruments it first.
+func (e *GojaEngine) compile(script string) (*goja.Program, error) {
+	if e.memoryLimit > 0 {
+		var err error
+		if script, err = instrument(script); err != nil {
+			return nil, err
+		}
+	}
+	return goja.Compile("", script, false)
+}
+
+// instrument rewrites the source of a script so that what it allocates is
+// charged to the run: string concatenations and template literals pass
+// their result to guardValue; object, array, function, class and regular
+// expression literals and new expressions pass theirs to guardObject;
+// assignments to a member go through guardSlot, which charges keys the
+// object does not have yet; and the source of a direct eval goes through
+// guardSource. Any other reference to eval is redirected to guardEval.
+// Scripts may not rebind eval or use with statements, which could shadow
+// the guards.
+func instrument(src string) (string, error) {
+	prg, err := goja.Parse("", src)
+	if err != nil {
+		return "", err
+	}
+	in := &instrumenter{src: src, seen: make(map[any]bool)}
+	for _, st := range prg.Body {
+		in.visit(st, valueCtx, 0)
+	}
+	if in.err != nil {
+		return "", in.err
+	}
+	return in.apply(), nil
+}
+
+type visitCtx int
+
+const (
+	valueCtx  visitCtx = iota // evaluated for its value
+	targetCtx                 // assigned to or bound
+)
+
+// instrumenter collects the edits instrument makes to a script.
+type instrumenter struct {
+	src   string
+	seen  map[any]bool
+	masks [][2]int // literal text, in which parentheses do not count
+	wraps []wrap
+	edits []edit
+	err   error
+
+	// enclosing[i] is the innermost open parenthesis at byte i, -1 if none.
+	enclosing []int
+	depth     map[int]int
+	closing   map[int]int
+}
+
+// wrap surrounds node with open and close, or only inserts open before
+// it if close is empty.
+type wrap struct {
+	node        ast.Node
+	open, close string
+	depth       int
+}
+
+// edit inserts text at pos, replacing del bytes. Opening edits of outer
+// nodes go first at a position, closing edits of inner nodes go first.
+type edit struct {
+	pos, del int
+	text     string
+	open     bool
+	depth    int
+}
+
+func (in *instrumenter) fail(err error) {
+	if in.err == nil {
+		in.err = err
+	}
+}
+
+func (in *instrumenter) visit(n any, c visitCtx, d int) {
+	if in.err != nil || n == nil {
+		return
+	}
+	v := reflect.ValueOf(n)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() || in.seen[n] {
+			return
+		}
+		in.seen[n] = true
+	}
+	switch n := n.(type) {
+	case *ast.Identifier:
+		in.identifier(n, c, d)
+	case *ast.StringLiteral:
+		in.mask(int(n.Idx)-1, len(n.Literal))
+	case *ast.TemplateElement:
+		in.mask(int(n.Idx)-1, len(n.Literal))
+	case *ast.RegExpLiteral:
+		in.mask(int(n.Idx)-1, len(n.Literal))
+		in.wrap(n, guardObject, d)
+	case *ast.TemplateLiteral:
+		if n.Tag == nil {
+			in.wrap(n, guardValue, d)
+		}
+		in.children(v, d)
+	case *ast.BinaryExpression:
+		if n.Operator == token.PLUS {
+			in.wrap(n, guardValue, d)
+		}
+		in.children(v, d)
+	case *ast.AssignExpression:
+		if n.Operator == token.PLUS {
+			in.wrap(n, guardValue, d)
+		}
+		in.visit(n.Left, targetCtx, d+1)
+		in.visit(n.Right, valueCtx, d+1)
+	case *ast.UnaryExpression:
+		if n.Operator == token.INCREMENT || n.Operator == token.DECREMENT {
+			in.visit(n.Operand, targetCtx, d+1)
+		} else {
+			in.visit(n.Operand, valueCtx, d+1)
+		}
+	case *ast.DotExpression:
+		in.visit(n.Left, valueCtx, d+1)
+		if c == targetCtx {
+			in.slot(n.Left, n.Identifier.Name.String(), nil, d)
+		}
+	case *ast.BracketExpression:
+		in.visit(n.Left, valueCtx, d+1)
+		in.visit(n.Member, valueCtx, d+1)
+		if c == targetCtx {
+			in.slot(n.Left, "", n, d)
+		}
+	case *ast.PrivateDotExpression:
+		in.visit(n.Left, valueCtx, d+1)
+	case *ast.CallExpression:
+		if id, ok := n.Callee.(*ast.Identifier); ok && id.Name == "eval" {
+			in.seen[id] = true
+			if len(n.ArgumentList) > 0 {
+				in.insert(int(n.LeftParenthesis), guardSource+"(", true, d)
+				in.insert(int(n.RightParenthesis)-1, ")", false, d)
+			}
+		} else {
+			in.visit(n.Callee, valueCtx, d+1)
+		}
+		for _, arg := range n.ArgumentList {
+			in.visit(arg, valueCtx, d+1)
+		}
+	case *ast.ObjectLiteral, *ast.ArrayLiteral, *ast.NewExpression:
+		in.wrap(n.(ast.Node), guardObject, d)
+		in.children(v, d)
+	case *ast.ArrowFunctionLiteral:
+		in.wrap(n, guardObject, d)
+		in.visit(n.ParameterList, targetCtx, d+1)
+		in.visit(n.Body, valueCtx, d+1)
+	case *ast.FunctionLiteral:
+		in.function(n, true, d)
+	case *ast.FunctionDeclaration:
+		in.function(n.Function, false, d)
+	case *ast.ClassLiteral:
+		in.class(n, true, d)
+	case *ast.ClassDeclaration:
+		in.class(n.Class, false, d)
+	case *ast.Binding:
+		in.visit(n.Target, targetCtx, d+1)
+		in.visit(n.Initializer, valueCtx, d+1)
+	case *ast.ParameterList:
+		for _, b := range n.List {
+			in.visit(b, targetCtx, d+1)
+		}
+		in.visit(n.Rest, targetCtx, d+1)
+	case *ast.ArrayPattern:
+		for _, el := range n.Elements {
+			in.visit(el, targetCtx, d+1)
+		}
+		in.visit(n.Rest, targetCtx, d+1)
+	case *ast.ObjectPattern:
+		for _, p := range n.Properties {
+			in.visit(p, targetCtx, d+1)
+		}
+		in.visit(n.Rest, targetCtx, d+1)
+	case *ast.PropertyShort:
+		in.reserved(n.Name.Name.String())
+		if n.Name.Name == "eval" {
+			if c == targetCtx {
+				in.fail(errors.New("scripting: eval may not be assigned or redeclared"))
+			}
+			in.insert(int(n.Name.Idx)-1, "eval: "+guardPrefix, true, d+1)
+		}
+		in.visit(n.Initializer, valueCtx, d+1)
+	case *ast.PropertyKeyed:
+		in.visit(n.Key, valueCtx, d+1)
+		if fn, ok := n.Value.(*ast.FunctionLiteral); ok && n.Kind != ast.PropertyKindValue {
+			in.function(fn, false, d+1)
+		} else {
+			in.visit(n.Value, c, d+1)
+		}
+	case *ast.CatchStatement:
+		in.visit(n.Parameter, targetCtx, d+1)
+		in.visit(n.Body, valueCtx, d+1)
+	case *ast.ForInStatement:
+		in.forInto(n.Into, d)
+		in.visit(n.Source, valueCtx, d+1)
+		in.visit(n.Body, valueCtx, d+1)
+	case *ast.ForOfStatement:
+		in.forInto(n.Into, d)
+		in.visit(n.Source, valueCtx, d+1)
+		in.visit(n.Body, valueCtx, d+1)
+	case *ast.LabelledStatement:
+		in.visit(n.Statement, valueCtx, d+1)
+	case *ast.WithStatement:
+		in.fail(errors.New("scripting: with statements are not supported"))
+	case *ast.BranchStatement, *ast.MetaProperty:
+	default:
+		in.children(v, d)
+	}
+}
+
+// children visits the nodes held by the fields of v.
+func (in *instrumenter) children(v reflect.Value, d int) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			in.children(v.Elem(), d)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			in.field(v.Field(i), d+1)
+		}
+	}
+}
+
+func (in *instrumenter) field(f reflect.Value, d int) {
+	switch f.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !f.IsNil() && f.CanInterface() {
+			in.visit(f.Interface(), valueCtx, d)
+		}
+	case reflect.Slice:
+		for i := 0; i < f.Len(); i++ {
+			in.field(f.Index(i), d)
+		}
+	case reflect.Struct:
+		in.children(f, d)
+	}
+}
+
+func (in *instrumenter) function(fn *ast.FunctionLiteral, expr bool, d int) {
+	if fn == nil {
+		return
+	}
+	if expr {
+		in.wrap(fn, guardObject, d)
+	}
+	in.visit(fn.Name, targetCtx, d+1)
+	in.visit(fn.ParameterList, targetCtx, d+1)
+	in.visit(fn.Body, valueCtx, d+1)
+}
+
+func (in *instrumenter) class(cl *ast.ClassLiteral, expr bool, d int) {
+	if cl == nil {
+		return
+	}
+	if expr {
+		in.wrap(cl, guardObject, d)
+	}
+	in.visit(cl.Name, targetCtx, d+1)
+	in.visit(cl.SuperClass, valueCtx, d+1)
+	for _, el := range cl.Body {
+		switch el := el.(type) {
+		case *ast.MethodDefinition:
+			in.visit(el.Key, valueCtx, d+1)
+			in.function(el.Body, false, d+1)
+		default:
+			in.visit(el, valueCtx, d+1)
+		}
+	}
+}
+
+func (in *instrumenter) forInto(into ast.ForInto, d int) {
+	switch into := into.(type) {
+	case *ast.ForIntoExpression:
+		in.visit(into.Expression, targetCtx, d+1)
+	case *ast.ForDeclaration:
+		in.visit(into.Target, targetCtx, d+1)
+	default:
+		in.visit(into, valueCtx, d+1)
+	}
+}
+
+func (in *instrumenter) identifier(id *ast.Identifier, c visitCtx, d int) {
+	name := id.Name.String()
+	in.reserved(name)
+	if name != "eval" {
+		return
+	}
+	if c == targetCtx {
+		in.fail(errors.New("scripting: eval may not be assigned or redeclared"))
+		return
+	}
+	in.insert(int(id.Idx)-1, guardPrefix, true, d)
+}
+
+func (in *instrumenter) reserved(name string) {
+	if strings.HasPrefix(name, guardPrefix) {
+		in.fail(fmt.Errorf("scripting: %s is reserved", name))
+	}
+}
+
+func (in *instrumenter) mask(pos, n int) {
+	in.masks = append(in.masks, [2]int{pos, pos + n})
+}
+
+func (in *instrumenter) wrap(n ast.Node, name string, d int) {
+	in.wraps = append(in.wraps, wrap{node: n, open: name + "(", close: ")", depth: d})
+}
+
+func (in *instrumenter) insert(pos int, text string, open bool, d int) {
+	in.edits = append(in.edits, edit{pos: pos, text: text, open: open, depth: d})
+}
+
+// slot routes an assignment to a member of obj through guardSlot: obj.name
+// becomes guardSlot(obj, "name").name and obj[key] becomes
+// guardSlot(obj, key)[guardKey()], evaluating obj and key once, in order.
+func (in *instrumenter) slot(obj ast.Expression, name string, br *ast.BracketExpression, d int) {
+	if _, ok := obj.(*ast.SuperExpression); ok {
+		return
+	}
+	if br == nil {
+		quoted, _ := json.Marshal(name)
+		in.wraps = append(in.wraps, wrap{node: obj, open: guardSlot + "(", close: ", " + string(quoted) + ")", depth: d})
+		return
+	}
+	in.wraps = append(in.wraps, wrap{node: obj, open: guardSlot + "(", depth: d})
+	in.edits = append(in.edits,
+		edit{pos: int(br.LeftBracket) - 1, del: 1, text: ", ", depth: d},
+		edit{pos: int(br.RightBracket) - 1, text: ")[" + guardKey + "()", depth: d})
+}
+
+// apply resolves the wraps and returns the instrumented source.
+func (in *instrumenter) apply() string {
+	if len(in.wraps) > 0 {
+		in.parens()
+	}
+	for _, w := range in.wraps {
+		s, e := in.extent(w.node)
+		in.insert(s, w.open, true, w.depth)
+		if w.close != "" {
+			in.insert(e, w.close, false, w.depth)
+		}
+	}
+	sort.SliceStable(in.edits, func(i, j int) bool {
+		a, b := in.edits[i], in.edits[j]
+		if a.pos != b.pos {
+			return a.pos < b.pos
+		}
+		if a.open != b.open {
+			return !a.open
+		}
+		if a.open {
+			return a.depth < b.depth
+		}
+		return a.depth > b.depth
+	})
+	var sb strings.Builder
+	last := 0
+	for _, ed := range in.edits {
+		sb.WriteString(in.src[last:ed.pos])
+		sb.WriteString(ed.text)
+		last = ed.pos + ed.del
+	}
+	sb.WriteString(in.src[last:])
+	return sb.String()
+}
+
+// extent returns the byte range of n, including the parentheses grouping
+// its first or last operand, which the parser does not record.
+func (in *instrumenter) extent(n ast.Node) (int, int) {
+	s, e := int(n.Idx0())-1, in.end(n)
+	for {
+		a, b := in.enclosing[s], in.enclosing[e]
+		if a == b {
+			return s, e
+		}
+		da, db := in.depth[a], in.depth[b]
+		if da >= db {
+			s = a
+		}
+		if db >= da {
+			e = in.closing[b] + 1
+		}
+	}
+}
+
+// end returns the offset just past n. It corrects the parser's positions
+// for identifiers, whose source may be longer than their name.
+func (in *instrumenter) end(n ast.Node) int {
+	switch n := n.(type) {
+	case *ast.Identifier:
+		return in.identEnd(int(n.Idx) - 1)
+	case *ast.DotExpression:
+		return in.identEnd(int(n.Identifier.Idx) - 1)
+	case *ast.PrivateDotExpression:
+		return in.identEnd(int(n.Identifier.Idx))
+	case *ast.BinaryExpression:
+		return in.groupedEnd(n.Right)
+	case *ast.AssignExpression:
+		return in.groupedEnd(n.Right)
+	case *ast.ConditionalExpression:
+		return in.groupedEnd(n.Alternate)
+	case *ast.SequenceExpression:
+		return in.groupedEnd(n.Sequence[len(n.Sequence)-1])
+	case *ast.UnaryExpression:
+		if !n.Postfix {
+			return in.groupedEnd(n.Operand)
+		}
+		i := in.groupedEnd(n.Operand)
+		for i < len(in.src) && in.src[i] != '+' && in.src[i] != '-' {
+			i++
+		}
+		return i + 2
+	case *ast.ArrowFunctionLiteral:
+		if body, ok := n.Body.(*ast.ExpressionBody); ok {
+			return in.groupedEnd(body.Expression)
+		}
+	case *ast.YieldExpression:
+		if n.Argument != nil {
+			return in.groupedEnd(n.Argument)
+		}
+	case *ast.AwaitExpression:
+		return in.groupedEnd(n.Argument)
+	case *ast.SpreadElement:
+		return in.groupedEnd(n.Expression)
+	case *ast.OptionalChain:
+		return in.end(n.Expression)
+	case *ast.Optional:
+		return in.end(n.Expression)
+	case *ast.NewExpression:
+		if n.RightParenthesis > 0 {
+			return int(n.RightParenthesis)
+		}
+		return in.groupedEnd(n.Callee)
+	}
+	return int(n.Idx1()) - 1
+}
+
+// groupedEnd returns the end of the last operand n of an expression,
+// including the parentheses grouping it.
+func (in *instrumenter) groupedEnd(n ast.Node) int {
+	_, e := in.extent(n)
+	return e
+}
+
+func (in *instrumenter) identEnd(i int) int {
+	for i < len(in.src) {
+		c := in.src[i]
+		switch {
+		case c == '$' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			i++
+		case c == '\\':
+			i += 2
+			if i < len(in.src) && in.src[i] == '{' {
+				for i < len(in.src) && in.src[i] != '}' {
+					i++
+				}
+				i++
+			} else {
+				i += 4
+			}
+		case c >= utf8.RuneSelf:
+			r, size := utf8.DecodeRuneInString(in.src[i:])
+			if !unicode.In(r, unicode.L, unicode.Nl, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc) && r != '\u200c' && r != '\u200d' {
+				return i
+			}
+			i += size
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// parens matches the parentheses of the source outside literals and
+// comments.
+func (in *instrumenter) parens() {
+	sort.Slice(in.masks, func(i, j int) bool { return in.masks[i][0] < in.masks[j][0] })
+	in.enclosing = make([]int, len(in.src)+1)
+	in.depth = map[int]int{-1: 0}
+	in.closing = make(map[int]int)
+	var stack []int
+	top := func() int {
+		if len(stack) == 0 {
+			return -1
+		}
+		return stack[len(stack)-1]
+	}
+	m := 0
+	for i := 0; i < len(in.src); {
+		in.enclosing[i] = top()
+		for m < len(in.masks) && in.masks[m][1] <= i {
+			m++
+		}
+		if m < len(in.masks) && in.masks[m][0] <= i {
+			for ; i < in.masks[m][1]; i++ {
+				in.enclosing[i] = top()
+			}
+			continue
+		}
+		switch c := in.src[i]; {
+		case c == '(':
+			stack = append(stack, i)
+			in.depth[i] = len(stack)
+		case c == ')' && len(stack) > 0:
+			in.closing[top()] = i
+			stack = stack[:len(stack)-1]
+		case c == '/' && i+1 < len(in.src) && (in.src[i+1] == '/' || in.src[i+1] == '*'):
+			var end int
+			if in.src[i+1] == '/' {
+				end = strings.IndexAny(in.src[i:], "\n\r\u2028\u2029")
+			} else if end = strings.Index(in.src[i+2:], "*/"); end >= 0 {
+				end += 4
+			}
+			if end < 0 {
+				end = len(in.src) - i
+			}
+			for j := i; j < i+end; j++ {
+				in.enclosing[j] = top()
+			}
+			i += end
+			continue
+		}
+		i++
+	}
+	in.enclosing[len(in.src)] = top()
+}
+
+// charge adds n bytes to the allocations of the running script and
+// interrupts it with ErrMemoryLimit once they exceed the memory limit. It
+// reports whether the allocation may proceed.
+func (e *GojaEngine) charge(n int64) bool {
+	if e.memoryLimit == 0 || !e.running || n <= 0 {
+		return true
+	}
+	e.allocated += n
+	if uint64(e.allocated) > e.memoryLimit {
+		e.vm.Interrupt(ErrMemoryLimit)
+		return false
+	}
+	return true
+}
+
+// valueBytes returns the bytes charged for a string or array v.
+func valueBytes(v goja.Value) int64 {
+	switch v := v.(type) {
+	case goja.String:
+		return int64(v.Length()) * charBytes
+	case *goja.Object:
+		if v.ClassName() == "Array" {
+			return lengthOf(v) * slotBytes
+		}
+	}
+	return 0
+}
+
+// objectSize returns the bytes charged for a new object v: the object
+// and its elements or enumerable properties. The contents of buffers are
+// charged by their constructors.
+func objectSize(v goja.Value) int64 {
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		return valueBytes(v)
+	}
+	if obj.ClassName() == "Array" {
+		return objectBytes + lengthOf(obj)*slotBytes
+	}
+	if t := obj.ExportType(); t == arrayBufferType || t != nil && t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Interface {
+		return objectBytes
+	}
+	return objectBytes + int64(len(obj.Keys()))*propBytes
+}
+
+func lengthOf(v goja.Value) int64 {
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		if s, ok := v.(goja.String); ok {
+			return int64(s.Length())
+		}
+		return 0
+	}
+	if l := obj.Get("length"); l != nil {
+		return l.ToInteger()
+	}
+	return 0
+}
+
+// installGuard defines the guard globals and wraps the builtins that
+// allocate, so that what they create is charged too, before they allocate
+// where the size is known in advance. eval and the Function constructors
+// instrument the source they run.
+func (e *GojaEngine) installGuard() {
+	g := e.vm.GlobalObject()
+	define := func(name string, f func(call goja.FunctionCall) goja.Value) {
+		g.DefineDataProperty(name, e.vm.ToValue(f), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	}
+	define(guardValue, func(call goja.FunctionCall) goja.Value {
+		v := call.Argument(0)
+		e.charge(valueBytes(v))
+		return v
+	})
+	define(guardObject, func(call goja.FunctionCall) goja.Value {
+		v := call.Argument(0)
+		e.charge(objectSize(v))
+		return v
+	})
+	hasOwn, _ := goja.AssertFunction(e.object("Object.prototype").Get("hasOwnProperty"))
+	var key goja.Value
+	define(guardSlot, func(call goja.FunctionCall) goja.Value {
+		obj := call.Argument(0)
+		key = call.Argument(1)
+		if o, ok := obj.(*goja.Object); ok {
+			if _, ok := key.(*goja.Symbol); !ok {
+				key = e.vm.ToValue(key.String())
+			}
+			if own, err := hasOwn(o, key); err != nil {
+				panic(err)
+			} else if !own.ToBoolean() {
+				n := int64(propBytes)
+				if o.ClassName() == "Array" {
+					n = slotBytes
+				}
+				e.charge(n)
+			}
+		}
+		return obj
+	})
+	define(guardKey, func(goja.FunctionCall) goja.Value { return key })
+	define(guardSource, func(call goja.FunctionCall) goja.Value {
+		src, ok := call.Argument(0).(goja.String)
+		if !ok || e.memoryLimit == 0 {
+			return call.Argument(0)
+		}
+		out, err := instrument(src.String())
+		if err != nil {
+			panic(e.vm.NewTypeError(err.Error()))
+		}
+		return e.vm.ToValue(out)
+	})
+
+	// Identifiers named eval resolve to the builtin, so that direct eval
+	// keeps its scope; everything else reaches the instrumenting eval.
+	builtin, _ := goja.AssertFunction(g.Get("eval"))
+	e.vm.RunString("const eval = globalThis.eval;")
+	eval := e.vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		src, ok := call.Argument(0).(goja.String)
+		if ok && e.memoryLimit > 0 {
+			out, err := instrument(src.String())
+			if err != nil {
+				panic(e.vm.NewTypeError(err.Error()))
+			}
+			call.Arguments = []goja.Value{e.vm.ToValue(out)}
+		}
+		v, err := builtin(goja.Undefined(), call.Arguments...)
+		if err != nil {
+			panic(err)
+		}
+		return v
+	})
+	g.DefineDataProperty(guardEval, eval, goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	g.DefineDataProperty("eval", eval, goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	e.guardFunctionConstructor("function")
+	e.guardFunctionConstructor("function*")
+	e.guardFunctionConstructor("async function")
+
+	str := e.object("String.prototype")
+	e.guardMethod(str, "repeat", func(this goja.Value, args []goja.Value) int64 {
+		return lengthOf(this) * argInt(args, 0) * charBytes
+	})
+	pad := func(this goja.Value, args []goja.Value) int64 { return argInt(args, 0) * charBytes }
+	e.guardMethod(str, "padStart", pad)
+	e.guardMethod(str, "padEnd", pad)
+	for _, name := range []string{"concat", "replace", "replaceAll", "split", "match", "normalize", "toLowerCase", "toUpperCase"} {
+		e.guardMethod(str, name, nil)
+	}
+	e.guardMethod(e.object("String"), "fromCharCode", nil)
+	e.guardMethod(e.object("String"), "fromCodePoint", nil)
+
+	arr := e.object("Array.prototype")
+	e.guardMethod(arr, "fill", func(this goja.Value, _ []goja.Value) int64 { return lengthOf(this) * slotBytes })
+	args := func(_ goja.Value, args []goja.Value) int64 { return int64(len(args)) * slotBytes }
+	e.guardMethod(arr, "push", args)
+	e.guardMethod(arr, "unshift", args)
+	e.guardMethod(arr, "splice", args)
+	for _, name := range []string{"concat", "join", "map", "filter", "slice", "flat", "flatMap", "toString"} {
+		e.guardMethod(arr, name, nil)
+	}
+	e.guardMethod(e.object("Array"), "from", func(_ goja.Value, args []goja.Value) int64 {
+		if len(args) == 0 {
+			return 0
+		}
+		return lengthOf(args[0]) * slotBytes
+	})
+
+	object := e.object("Object")
+	e.guardMethod(object, "assign", func(_ goja.Value, args []goja.Value) int64 {
+		var n int64
+		for _, src := range args[min(1, len(args)):] {
+			if o, ok := src.(*goja.Object); ok {
+				n += int64(len(o.Keys())) * propBytes
+			}
+		}
+		return n
+	})
+	for _, name := range []string{"keys", "values", "entries", "getOwnPropertyNames"} {
+		e.guardMethod(object, name, nil)
+	}
+	property := func(goja.Value, []goja.Value) int64 { return propBytes }
+	e.guardMethod(object, "defineProperty", property)
+	e.guardMethod(object, "defineProperties", func(_ goja.Value, args []goja.Value) int64 {
+		if len(args) > 1 {
+			if o, ok := args[1].(*goja.Object); ok {
+				return int64(len(o.Keys())) * propBytes
+			}
+		}
+		return 0
+	})
+	e.guardMethod(e.object("Reflect"), "set", property)
+	e.guardMethod(e.object("Reflect"), "defineProperty", property)
+	e.guardMethod(e.object("JSON"), "stringify", nil)
+	e.guardMethod(e.object("JSON"), "parse", func(_ goja.Value, args []goja.Value) int64 {
+		if len(args) == 0 {
+			return 0
+		}
+		text := args[0].String()
+		values := int64(strings.Count(text, "{") + strings.Count(text, "["))
+		entries := int64(strings.Count(text, ",")) + values
+		return values*objectBytes + entries*propBytes + int64(len(text))*charBytes
+	})
+
+	e.guardMethod(e.object("Map.prototype"), "set", property)
+	e.guardMethod(e.object("Set.prototype"), "add", property)
+	e.guardMethod(e.object("WeakMap.prototype"), "set", property)
+	e.guardMethod(e.object("WeakSet.prototype"), "add", property)
+
+	e.guardConstructor("ArrayBuffer", func(args []goja.Value) int64 { return argInt(args, 0) })
+	byteLength := func(this goja.Value, _ []goja.Value) int64 {
+		if o, ok := this.(*goja.Object); ok {
+			return o.Get("byteLength").ToInteger()
+		}
+		return 0
+	}
+	e.guardMethod(e.object("ArrayBuffer.prototype"), "slice", byteLength)
+	for _, name := range []string{"Int8Array", "Uint8Array", "Uint8ClampedArray", "Int16Array", "Uint16Array",
+		"Int32Array", "Uint32Array", "Float32Array", "Float64Array", "BigInt64Array", "BigUint64Array"} {
+		size := e.object(name).Get("BYTES_PER_ELEMENT").ToInteger()
+		e.guardConstructor(name, func(args []goja.Value) int64 {
+			if len(args) == 0 {
+				return 0
+			}
+			if o, ok := args[0].(*goja.Object); ok {
+				if o.ExportType() == arrayBufferType {
+					return 0 // a view of the buffer
+				}
+				return lengthOf(o) * size
+			}
+			return args[0].ToInteger() * size
+		})
+	}
+	typed := e.object("Uint8Array.prototype").Prototype()
+	for _, name := range []string{"slice", "map", "filter", "toReversed", "toSorted", "with"} {
+		e.guardMethod(typed, name, byteLength)
+	}
+}
+
+// object returns the builtin object at path, such as "Array.prototype".
+func (e *GojaEngine) object(path string) *goja.Object {
+	obj := e.vm.GlobalObject()
+	for _, name := range strings.Split(path, ".") {
+		obj = obj.Get(name).ToObject(e.vm)
+	}
+	return obj
+}
+
+// guardMethod replaces the method name of obj with one that charges the
+// bytes pre reports before calling it, if pre is not nil, and the bytes of
+// the string or array it returns afterwards.
+func (e *GojaEngine) guardMethod(obj *goja.Object, name string, pre func(this goja.Value, args []goja.Value) int64) {
+	orig, ok := goja.AssertFunction(obj.Get(name))
+	if !ok {
+		return
+	}
+	obj.DefineDataProperty(name, e.vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		if pre != nil && !e.charge(pre(call.This, call.Arguments)) {
+			return goja.Undefined()
+		}
+		v, err := orig(call.This, call.Arguments...)
+		if err != nil {
+			panic(err)
+		}
+		e.charge(valueBytes(v))
+		return v
+	}), goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+}
+
+// guardConstructor replaces the global constructor name with one that
+// charges the bytes reported by bytes before constructing. The wrapper
+// shares the prototype of the original and inherits its static members,
+// so subclasses, instanceof and species lookups go through it.
+func (e *GojaEngine) guardConstructor(name string, bytes func(args []goja.Value) int64) {
+	orig := e.object(name)
+	construct, ok := goja.AssertConstructor(orig)
+	if !ok {
+		return
+	}
+	proto := orig.Get("prototype").ToObject(e.vm)
+	ctor := e.vm.ToValue(func(call goja.ConstructorCall) *goja.Object {
+		if !e.charge(bytes(call.Arguments)) {
+			return call.This
+		}
+		obj, err := construct(call.NewTarget, call.Arguments...)
+		if err != nil {
+			panic(err)
+		}
+		return obj
+	}).ToObject(e.vm)
+	ctor.SetPrototype(orig)
+	ctor.DefineDataProperty("prototype", proto, goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	ctor.DefineDataProperty("name", e.vm.ToValue(name), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	proto.DefineDataProperty("constructor", ctor, goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	e.vm.GlobalObject().DefineDataProperty(name, ctor, goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+}
+
+// guardFunctionConstructor replaces the constructor of the functions
+// declared with keyword, reachable as Function or as the constructor
+// property of their prototype, with one compiling the body through the
+// guard.
+func (e *GojaEngine) guardFunctionConstructor(keyword string) {
+	sample, err := e.vm.RunString("(" + keyword + " () {})")
+	if err != nil {
+		return // not supported by the runtime
+	}
+	proto := sample.ToObject(e.vm).Prototype()
+	if proto == nil {
+		return
+	}
+	ctor := e.vm.ToValue(func(call goja.ConstructorCall) *goja.Object {
+		params := make([]string, 0, len(call.Arguments))
+		body := ""
+		for i, arg := range call.Arguments {
+			if i == len(call.Arguments)-1 {
+				body = arg.String()
+			} else {
+				params = append(params, arg.String())
+			}
+		}
+		src := "(" + keyword + " anonymous(" + strings.Join(params, ",") + "\n) {\n" + body + "\n})"
+		prg, err := e.compile(src)
+		if err != nil {
+			panic(e.vm.NewGoError(err))
+		}
+		v, err := e.vm.RunProgram(prg)
+		if err != nil {
+			panic(err)
+		}
+		return v.ToObject(e.vm)
+	}).ToObject(e.vm)
+	ctor.DefineDataProperty("prototype", proto, goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE)
+	proto.DefineDataProperty("constructor", ctor, goja.FLAG_TRUE, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	if keyword == "function" {
+		e.vm.GlobalObject().Set("Function", ctor)
+	}
+}
+
+func argInt(args []goja.Value, i int) int64 {
+	if i >= len(args) {
+		return 0
+	}
+	return args[i].ToInteger()
+}
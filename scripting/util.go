@@ -0,0 +1,631 @@
+package scripting
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/dop251/goja"
+)
+
+// separators are the thousands and decimal separators of the nDecSep
+// styles of util.printf and the sepStyle of AFNumber_Format.
+var separators = [...][2]string{
+	{",", "."},
+	{"", "."},
+	{".", ","},
+	{"", ","},
+	{"'", "."},
+}
+
+// formatNumber formats the absolute value of v with decimals fraction
+// digits and the separators of style sep.
+func formatNumber(v float64, decimals, sep int) string {
+	if v < 0 {
+		v = -v
+	}
+	decimals = max(0, min(decimals, 20))
+	sep = max(0, min(sep, len(separators)-1))
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+	whole, frac, _ := strings.Cut(s, ".")
+	if group := separators[sep][0]; group != "" && len(whole) > 3 {
+		var b strings.Builder
+		lead := len(whole) % 3
+		if lead > 0 {
+			b.WriteString(whole[:lead])
+		}
+		for i := lead; i < len(whole); i += 3 {
+			if b.Len() > 0 {
+				b.WriteString(group)
+			}
+			b.WriteString(whole[i : i+3])
+		}
+		whole = b.String()
+	}
+	if frac == "" {
+		return whole
+	}
+	return whole + separators[sep][1] + frac
+}
+
+// printf implements util.printf: C style conversions d, f, s and x with
+// the flags +, space, 0 and #, a width and a precision, and the Acrobat
+// nDecSep extension (%,0.2f) selecting the separators of the number.
+func printf(format string, args []goja.Value) string {
+	var b strings.Builder
+	next := 0
+	arg := func() goja.Value {
+		if next < len(args) {
+			next++
+			return args[next-1]
+		}
+		return goja.Undefined()
+	}
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		if i+1 < len(format) && format[i+1] == '%' {
+			b.WriteByte('%')
+			i++
+			continue
+		}
+		j := i + 1
+		sep := 1
+		if j+1 < len(format) && format[j] == ',' && format[j+1] >= '0' && format[j+1] <= '9' {
+			sep = int(format[j+1] - '0')
+			j += 2
+		}
+		var plus, space, zero, alt, left bool
+	flags:
+		for ; j < len(format); j++ {
+			switch format[j] {
+			case '+':
+				plus = true
+			case ' ':
+				space = true
+			case '0':
+				zero = true
+			case '#':
+				alt = true
+			case '-':
+				left = true
+			default:
+				break flags
+			}
+		}
+		width := 0
+		for ; j < len(format) && format[j] >= '0' && format[j] <= '9'; j++ {
+			width = width*10 + int(format[j]-'0')
+		}
+		prec := -1
+		if j < len(format) && format[j] == '.' {
+			prec = 0
+			for j++; j < len(format) && format[j] >= '0' && format[j] <= '9'; j++ {
+				prec = prec*10 + int(format[j]-'0')
+			}
+		}
+		if j >= len(format) {
+			b.WriteString(format[i:])
+			break
+		}
+		var s string
+		sign := ""
+		numberValue := func() float64 {
+			v := arg()
+			if n, ok := makeNumber(v); ok {
+				return n
+			}
+			return 0
+		}
+		switch format[j] {
+		case 'd', 'f':
+			n := numberValue()
+			if format[j] == 'd' {
+				n, prec = float64(int64(n)), 0
+			} else if prec < 0 {
+				prec = 6
+			}
+			s = formatNumber(n, prec, sep)
+			if alt && prec == 0 && format[j] == 'f' {
+				s += separators[max(0, min(sep, len(separators)-1))][1]
+			}
+			switch {
+			case n < 0:
+				sign = "-"
+			case plus:
+				sign = "+"
+			case space:
+				sign = " "
+			}
+		case 'x':
+			s = strconv.FormatInt(int64(numberValue()), 16)
+		case 's':
+			if v := arg(); defined(v) {
+				s = v.String()
+			} else if v != nil && goja.IsNull(v) {
+				s = "null"
+			} else {
+				s = "undefined"
+			}
+			if prec >= 0 && prec < len([]rune(s)) {
+				s = string([]rune(s)[:prec])
+			}
+			zero = false
+		default:
+			b.WriteString(format[i : j+1])
+			i = j
+			continue
+		}
+		if pad := width - len([]rune(sign+s)); pad > 0 {
+			switch {
+			case left:
+				s += strings.Repeat(" ", pad)
+			case zero:
+				s = strings.Repeat("0", pad) + s
+			default:
+				sign = strings.Repeat(" ", pad) + sign
+			}
+		}
+		b.WriteString(sign + s)
+		i = j
+	}
+	return b.String()
+}
+
+var (
+	monthNames = []string{"January", "February", "March", "April", "May", "June", "July",
+		"August", "September", "October", "November", "December"}
+	dayNames = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+)
+
+// dateFormats are the numbered formats of util.printd.
+var dateFormats = []string{"D:yyyymmddHHMMss", "yyyy.mm.dd HH:MM:ss", "m/d/yy h:MM:ss tt"}
+
+// dateTokens are the fields of date formats, longest first.
+var dateTokens = []string{"mmmm", "mmm", "mm", "m", "dddd", "ddd", "dd", "d", "yyyy", "yy",
+	"HH", "H", "hh", "h", "MM", "M", "ss", "s", "tt", "t"}
+
+// splitDateFormat splits a date format into fields and literal text. A
+// backslash quotes the character after it.
+func splitDateFormat(format string) (parts []string, fields []bool) {
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			parts, fields = append(parts, lit.String()), append(fields, false)
+			lit.Reset()
+		}
+	}
+outer:
+	for i := 0; i < len(format); {
+		if format[i] == '\\' && i+1 < len(format) {
+			lit.WriteByte(format[i+1])
+			i += 2
+			continue
+		}
+		for _, tok := range dateTokens {
+			if strings.HasPrefix(format[i:], tok) {
+				flush()
+				parts, fields = append(parts, tok), append(fields, true)
+				i += len(tok)
+				continue outer
+			}
+		}
+		lit.WriteByte(format[i])
+		i++
+	}
+	flush()
+	return parts, fields
+}
+
+// printd implements util.printd for string formats.
+func printd(format string, t time.Time) string {
+	var b strings.Builder
+	parts, fields := splitDateFormat(format)
+	two := func(n int) string { return strconv.Itoa(n/10) + strconv.Itoa(n%10) }
+	hour12 := t.Hour() % 12
+	if hour12 == 0 {
+		hour12 = 12
+	}
+	for i, p := range parts {
+		if !fields[i] {
+			b.WriteString(p)
+			continue
+		}
+		switch p {
+		case "mmmm":
+			b.WriteString(monthNames[t.Month()-1])
+		case "mmm":
+			b.WriteString(monthNames[t.Month()-1][:3])
+		case "mm":
+			b.WriteString(two(int(t.Month())))
+		case "m":
+			b.WriteString(strconv.Itoa(int(t.Month())))
+		case "dddd":
+			b.WriteString(dayNames[t.Weekday()])
+		case "ddd":
+			b.WriteString(dayNames[t.Weekday()][:3])
+		case "dd":
+			b.WriteString(two(t.Day()))
+		case "d":
+			b.WriteString(strconv.Itoa(t.Day()))
+		case "yyyy":
+			b.WriteString(strconv.Itoa(t.Year()))
+		case "yy":
+			b.WriteString(two(t.Year() % 100))
+		case "HH":
+			b.WriteString(two(t.Hour()))
+		case "H":
+			b.WriteString(strconv.Itoa(t.Hour()))
+		case "hh":
+			b.WriteString(two(hour12))
+		case "h":
+			b.WriteString(strconv.Itoa(hour12))
+		case "MM":
+			b.WriteString(two(t.Minute()))
+		case "M":
+			b.WriteString(strconv.Itoa(t.Minute()))
+		case "ss":
+			b.WriteString(two(t.Second()))
+		case "s":
+			b.WriteString(strconv.Itoa(t.Second()))
+		case "tt":
+			b.WriteString(map[bool]string{false: "am", true: "pm"}[t.Hour() >= 12])
+		case "t":
+			b.WriteString(map[bool]string{false: "a", true: "p"}[t.Hour() >= 12])
+		}
+	}
+	return b.String()
+}
+
+// dateFields are the parts of a date being parsed; -1 means unset.
+type dateFields struct {
+	year, month, day, hour, minute, second int
+	pm, meridiem                           bool
+}
+
+func newDateFields() dateFields {
+	return dateFields{year: -1, month: -1, day: -1, hour: -1, minute: -1, second: -1}
+}
+
+// time returns the date, taking unset fields from now, or false if a field
+// is out of range.
+func (f dateFields) time(now time.Time) (time.Time, bool) {
+	or := func(v, def int) int {
+		if v < 0 {
+			return def
+		}
+		return v
+	}
+	year, month, day := or(f.year, now.Year()), or(f.month, 1), or(f.day, 1)
+	if f.year >= 0 && f.year < 100 {
+		year += 1900
+		if f.year < 50 {
+			year += 100
+		}
+	}
+	hour := or(f.hour, 0)
+	if f.meridiem {
+		if hour < 1 || hour > 12 {
+			return time.Time{}, false
+		}
+		hour %= 12
+		if f.pm {
+			hour += 12
+		}
+	}
+	minute, second := or(f.minute, 0), or(f.second, 0)
+	if month < 1 || month > 12 || day < 1 || hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, false
+	}
+	t := time.Date(year, time.Month(month), day, hour, minute, second, 0, time.Local)
+	if t.Day() != day {
+		return time.Time{}, false // no such day in the month
+	}
+	return t, true
+}
+
+// monthNumber returns the month named by a full or abbreviated English
+// name, or -1.
+func monthNumber(name string) int {
+	if len(name) < 3 {
+		return -1
+	}
+	for i, m := range monthNames {
+		if strings.HasPrefix(strings.ToLower(m), strings.ToLower(name)) {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// scand implements util.scand: it parses s with the fields of format.
+func scand(format, s string, now time.Time) (time.Time, bool) {
+	parts, fields := splitDateFormat(format)
+	var pattern strings.Builder
+	pattern.WriteString(`(?i)^\s*`)
+	var groups []string
+	for i, p := range parts {
+		if !fields[i] {
+			for _, r := range p {
+				if unicode.IsSpace(r) {
+					pattern.WriteString(`\s*`)
+				} else {
+					pattern.WriteString(regexp.QuoteMeta(string(r)))
+				}
+			}
+			continue
+		}
+		switch p {
+		case "mmmm", "mmm", "dddd", "ddd":
+			pattern.WriteString(`([a-z]+)`)
+		case "yyyy":
+			pattern.WriteString(`(\d{4})`)
+		case "yy":
+			pattern.WriteString(`(\d{2})`)
+		case "tt":
+			pattern.WriteString(`([ap]m?)`)
+		case "t":
+			pattern.WriteString(`([ap])`)
+		default:
+			pattern.WriteString(`(\d{1,2})`)
+		}
+		groups = append(groups, p)
+	}
+	pattern.WriteString(`\s*$`)
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return time.Time{}, false
+	}
+	m := re.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}, false
+	}
+	f := newDateFields()
+	for i, tok := range groups {
+		v := m[i+1]
+		n, _ := strconv.Atoi(v)
+		switch tok {
+		case "mmmm", "mmm":
+			if f.month = monthNumber(v); f.month < 0 {
+				return time.Time{}, false
+			}
+		case "mm", "m":
+			f.month = n
+		case "dd", "d":
+			f.day = n
+		case "yyyy", "yy":
+			f.year = n
+		case "HH", "H", "hh", "h":
+			f.hour = n
+		case "MM", "M":
+			f.minute = n
+		case "ss", "s":
+			f.second = n
+		case "tt", "t":
+			f.meridiem, f.pm = true, strings.EqualFold(v[:1], "p")
+		}
+	}
+	return f.time(now)
+}
+
+var (
+	timePattern = regexp.MustCompile(`(?i)(\d{1,2}):(\d{1,2})(?::(\d{1,2}))?\s*([ap]\.?m?\.?)?`)
+	datePieces  = regexp.MustCompile(`\d+|[A-Za-z]+`)
+)
+
+// dateOrder returns the order of the day, month and year fields of format
+// as a string such as "mdy".
+func dateOrder(format string) string {
+	parts, fields := splitDateFormat(format)
+	var order []byte
+	for i, p := range parts {
+		if !fields[i] {
+			continue
+		}
+		var c byte
+		switch p[0] {
+		case 'm', 'd', 'y':
+			c = p[0]
+		default:
+			continue
+		}
+		if p == "dddd" || p == "ddd" || strings.IndexByte(string(order), c) >= 0 {
+			continue
+		}
+		order = append(order, c)
+	}
+	return string(order)
+}
+
+// parseDate parses a date the way Acrobat's date formats do: exactly as
+// format says if possible, and otherwise leniently, taking the numbers of
+// s as the day, month and year in the order of order and reading a time
+// and month names anywhere in it.
+func parseDate(format, order, s string, now time.Time) (time.Time, bool) {
+	if format != "" {
+		if t, ok := scand(format, s, now); ok {
+			return t, true
+		}
+	}
+	f := newDateFields()
+	if m := timePattern.FindStringSubmatch(s); m != nil {
+		f.hour, _ = strconv.Atoi(m[1])
+		f.minute, _ = strconv.Atoi(m[2])
+		if m[3] != "" {
+			f.second, _ = strconv.Atoi(m[3])
+		}
+		if m[4] != "" {
+			f.meridiem, f.pm = true, strings.EqualFold(m[4][:1], "p")
+		}
+		s = strings.Replace(s, m[0], " ", 1)
+	}
+	var numbers []int
+	for _, piece := range datePieces.FindAllString(s, -1) {
+		if n, err := strconv.Atoi(piece); err == nil {
+			numbers = append(numbers, n)
+		} else if month := monthNumber(piece); month > 0 && f.month < 0 {
+			f.month = month
+		} else if monthNumber(piece) < 0 && !isDayName(piece) {
+			return time.Time{}, false
+		}
+	}
+	if order == "" {
+		order = "mdy"
+	}
+	for _, c := range order {
+		if len(numbers) == 0 {
+			break
+		}
+		switch {
+		case c == 'm' && f.month < 0:
+			f.month = numbers[0]
+		case c == 'd':
+			f.day = numbers[0]
+		case c == 'y':
+			f.year = numbers[0]
+		default:
+			continue
+		}
+		numbers = numbers[1:]
+	}
+	if len(numbers) > 0 || (f.month < 0 && f.day < 0 && f.year < 0 && f.hour < 0) {
+		return time.Time{}, false
+	}
+	if f.year >= 100 && f.year < 1000 {
+		return time.Time{}, false
+	}
+	return f.time(now)
+}
+
+func isDayName(s string) bool {
+	for _, d := range dayNames {
+		if len(s) >= 3 && strings.HasPrefix(strings.ToLower(d), strings.ToLower(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// printx implements util.printx: it copies source into the picture
+// format, where 9, A and X take the next digit, letter or alphanumeric
+// character of source, ? takes any character, * the rest of source, >
+// and < switch to upper and lower case and = back to the source case.
+func printx(format, source string) string {
+	src := []rune(source)
+	var b strings.Builder
+	upper, lower := false, false
+	put := func(r rune) {
+		switch {
+		case upper:
+			r = unicode.ToUpper(r)
+		case lower:
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	take := func(match func(rune) bool) {
+		for len(src) > 0 {
+			r := src[0]
+			src = src[1:]
+			if match(r) {
+				put(r)
+				return
+			}
+		}
+	}
+	pic := []rune(format)
+	for i := 0; i < len(pic) && len(src) > 0; i++ {
+		switch pic[i] {
+		case '?':
+			take(func(rune) bool { return true })
+		case '9':
+			take(unicode.IsDigit)
+		case 'A':
+			take(unicode.IsLetter)
+		case 'X':
+			take(func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) })
+		case '*':
+			for _, r := range src {
+				put(r)
+			}
+			src = nil
+		case '>':
+			upper, lower = true, false
+		case '<':
+			upper, lower = false, true
+		case '=':
+			upper, lower = false, false
+		case '\\':
+			if i+1 < len(pic) {
+				i++
+				b.WriteRune(pic[i])
+			}
+		default:
+			b.WriteRune(pic[i])
+		}
+	}
+	return b.String()
+}
+
+// date converts a JavaScript Date to a time.
+func (e *GojaEngine) date(v goja.Value) (time.Time, bool) {
+	if !defined(v) {
+		return time.Time{}, false
+	}
+	t, ok := v.Export().(time.Time)
+	return t, ok
+}
+
+// newDate returns a JavaScript Date for t.
+func (e *GojaEngine) newDate(t time.Time) goja.Value {
+	d, err := e.vm.New(e.vm.Get("Date"), e.vm.ToValue(t.UnixMilli()))
+	if err != nil {
+		return goja.Null()
+	}
+	return d
+}
+
+func (e *GojaEngine) utilObject() *goja.Object {
+	util := e.vm.NewObject()
+	util.Set("printf", e.fn(func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) == 0 {
+			return e.vm.ToValue("")
+		}
+		return e.vm.ToValue(printf(call.Arguments[0].String(), call.Arguments[1:]))
+	}))
+	util.Set("printd", e.fn(func(call goja.FunctionCall) goja.Value {
+		t, ok := e.date(e.argument(call, 1, "oDate"))
+		if !ok {
+			return goja.Null()
+		}
+		format := e.argument(call, 0, "cFormat")
+		if n, ok := format.Export().(int64); ok {
+			if n < 0 || int(n) >= len(dateFormats) {
+				return goja.Null()
+			}
+			return e.vm.ToValue(printd(dateFormats[n], t))
+		}
+		return e.vm.ToValue(printd(format.String(), t))
+	}))
+	util.Set("scand", e.fn(func(call goja.FunctionCall) goja.Value {
+		format := e.argument(call, 0, "cFormat")
+		f := format.String()
+		if n, ok := format.Export().(int64); ok && n >= 0 && int(n) < len(dateFormats) {
+			f = dateFormats[n]
+		}
+		t, ok := scand(f, e.argument(call, 1, "cDate").String(), time.Now())
+		if !ok {
+			return goja.Null()
+		}
+		return e.newDate(t)
+	}))
+	util.Set("printx", e.fn(func(call goja.FunctionCall) goja.Value {
+		return e.vm.ToValue(printx(e.argument(call, 0, "cFormat").String(), e.argument(call, 1, "cSource").String()))
+	}))
+	return util
+}
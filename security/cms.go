@@ -0,0 +1,442 @@
+package security
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+var (
+	oidDigestAlgorithmSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidDigestAlgorithmSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidDigestAlgorithmSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidSignatureSHA1WithRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSignatureSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSignatureSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSignatureSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidSignatureRSAPSS          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidPublicKeyECDSA           = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSignatureECDSAWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}
+	oidSignatureECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidSignatureECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidSignatureECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidSignatureEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+	oidAttributeSigningCertificate = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 12}
+	// Adobe's revocation information archival attribute (adbe-revocationInfoArchival).
+	oidAttributeAdobeRevocation = asn1.ObjectIdentifier{1, 2, 840, 113583, 1, 1, 8}
+)
+
+// Errors reported by CMSSignature.Verify.
+var (
+	ErrCMSDigestMismatch    = errors.New("cms: message digest does not match signed content")
+	ErrCMSInvalidSignature  = errors.New("cms: signature does not verify with signer certificate")
+	ErrCMSSignerCertMissing = errors.New("cms: signer certificate not found")
+)
+
+// CMSSignature is a parsed CMS/PKCS#7 SignedData signature as embedded in a
+// PDF signature dictionary's /Contents. Only the first SignerInfo is used.
+type CMSSignature struct {
+	// Certificates carried in the SignedData, signer first when found.
+	Certificates []*x509.Certificate
+	// Signer is the certificate matching the SignerInfo identifier, or nil.
+	Signer *x509.Certificate
+	// DigestAlgorithm hashes the signed content (and the signed attributes).
+	DigestAlgorithm crypto.Hash
+	// SigningTime is the signingTime signed attribute; zero when absent.
+	SigningTime time.Time
+	// ContentType is the encapsulated content type, id-data for PDF signatures.
+	ContentType asn1.ObjectIdentifier
+	// Content is the encapsulated content (adbe.pkcs7.sha1, TSTInfo); nil when detached.
+	Content []byte
+	// HasSigningCertificate reports a signing-certificate(-v2) attribute;
+	// SigningCertificateValid whether it binds Signer.
+	HasSigningCertificate   bool
+	SigningCertificateValid bool
+	// Embedded revocation data from the adbe-revocationInfoArchival attribute.
+	CRLs  [][]byte
+	OCSPs [][]byte
+	// UnsignedAttributes maps attribute OIDs (dotted) to their DER values.
+	UnsignedAttributes map[string][]asn1.RawValue
+	// Signature is the SignerInfo signature value.
+	Signature []byte
+
+	messageDigest []byte
+	signedAttrs   []byte // DER SET OF Attribute, nil when absent
+	sigAlg        pkix.AlgorithmIdentifier
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo asn1.RawValue
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+type adobeRevocationInfo struct {
+	CRLs  []asn1.RawValue `asn1:"optional,explicit,tag:0"`
+	OCSPs []asn1.RawValue `asn1:"optional,explicit,tag:1"`
+}
+
+// ParseCMSSignature parses a DER ContentInfo carrying SignedData. Trailing
+// bytes (the zero padding of a PDF /Contents string) are ignored.
+func ParseCMSSignature(der []byte) (*CMSSignature, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("cms: parse content info: %w", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("cms: content type %v is not signedData", ci.ContentType)
+	}
+	var sd cmsSignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("cms: parse signed data: %w", err)
+	}
+	if len(sd.SignerInfos) == 0 {
+		return nil, errors.New("cms: no signer infos")
+	}
+	si := sd.SignerInfos[0]
+
+	s := &CMSSignature{Signature: si.Signature, sigAlg: si.SignatureAlgorithm}
+	if len(sd.Certificates.Bytes) > 0 {
+		certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("cms: parse certificates: %w", err)
+		}
+		s.Certificates = certs
+	}
+	var eci encapsulatedContentInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.FullBytes, &eci); err != nil {
+		return nil, fmt.Errorf("cms: parse encapsulated content: %w", err)
+	}
+	s.ContentType = eci.EContentType
+	if len(eci.EContent.Bytes) > 0 {
+		// eContent is [0] EXPLICIT OCTET STRING.
+		if _, err := asn1.Unmarshal(eci.EContent.Bytes, &s.Content); err != nil {
+			return nil, fmt.Errorf("cms: parse encapsulated content: %w", err)
+		}
+	}
+
+	hash, ok := digestHash(si.DigestAlgorithm.Algorithm)
+	if !ok {
+		return nil, fmt.Errorf("cms: unsupported digest algorithm %v", si.DigestAlgorithm.Algorithm)
+	}
+	s.DigestAlgorithm = hash
+	s.Signer = findSigner(s.Certificates, si.SID)
+	if s.Signer != nil {
+		// Keep the signer first so callers can treat the rest as intermediates.
+		ordered := []*x509.Certificate{s.Signer}
+		for _, c := range s.Certificates {
+			if c != s.Signer {
+				ordered = append(ordered, c)
+			}
+		}
+		s.Certificates = ordered
+	}
+
+	if len(si.SignedAttrs.FullBytes) > 0 {
+		// The signature covers the attributes re-tagged as a universal SET.
+		attrs := append([]byte(nil), si.SignedAttrs.FullBytes...)
+		attrs[0] = 0x31
+		s.signedAttrs = attrs
+		if err := s.parseSignedAttributes(si.SignedAttrs.Bytes); err != nil {
+			return nil, err
+		}
+	}
+	if len(si.UnsignedAttrs.Bytes) > 0 {
+		attrs, err := parseAttributes(si.UnsignedAttrs.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("cms: parse unsigned attributes: %w", err)
+		}
+		s.UnsignedAttributes = make(map[string][]asn1.RawValue)
+		for _, a := range attrs {
+			values, err := attributeValues(a)
+			if err != nil {
+				return nil, err
+			}
+			s.UnsignedAttributes[a.Type.String()] = values
+		}
+	}
+	return s, nil
+}
+
+func (s *CMSSignature) parseSignedAttributes(data []byte) error {
+	attrs, err := parseAttributes(data)
+	if err != nil {
+		return fmt.Errorf("cms: parse signed attributes: %w", err)
+	}
+	for _, a := range attrs {
+		values, err := attributeValues(a)
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			continue
+		}
+		v := values[0]
+		switch {
+		case a.Type.Equal(oidAttributeMessageDigest):
+			if _, err := asn1.Unmarshal(v.FullBytes, &s.messageDigest); err != nil {
+				return fmt.Errorf("cms: parse message digest: %w", err)
+			}
+		case a.Type.Equal(oidAttributeSigningTime):
+			var t time.Time
+			if _, err := asn1.Unmarshal(v.FullBytes, &t); err == nil {
+				s.SigningTime = t
+			}
+		case a.Type.Equal(oidAttributeSigningCertificateV2):
+			s.HasSigningCertificate = true
+			var scv2 signingCertificateV2
+			if _, err := asn1.Unmarshal(v.FullBytes, &scv2); err == nil && len(scv2.Certs) > 0 {
+				h, ok := crypto.SHA256, true
+				if alg := scv2.Certs[0].HashAlgorithm.Algorithm; len(alg) > 0 {
+					h, ok = digestHash(alg)
+				}
+				s.SigningCertificateValid = ok && certHashMatches(s.Signer, h, scv2.Certs[0].CertHash)
+			}
+		case a.Type.Equal(oidAttributeSigningCertificate):
+			s.HasSigningCertificate = true
+			var sc struct {
+				Certs []struct {
+					CertHash []byte
+					Rest     asn1.RawValue `asn1:"optional"`
+				}
+			}
+			if _, err := asn1.Unmarshal(v.FullBytes, &sc); err == nil && len(sc.Certs) > 0 {
+				s.SigningCertificateValid = certHashMatches(s.Signer, crypto.SHA1, sc.Certs[0].CertHash)
+			}
+		case a.Type.Equal(oidAttributeAdobeRevocation):
+			var info adobeRevocationInfo
+			if _, err := asn1.Unmarshal(v.FullBytes, &info); err == nil {
+				for _, c := range info.CRLs {
+					s.CRLs = append(s.CRLs, c.FullBytes)
+				}
+				for _, o := range info.OCSPs {
+					s.OCSPs = append(s.OCSPs, o.FullBytes)
+				}
+			}
+		}
+	}
+	if s.messageDigest == nil {
+		return errors.New("cms: signed attributes lack message digest")
+	}
+	return nil
+}
+
+// Verify checks the signature against digest, the hash of the signed bytes
+// computed with DigestAlgorithm (or, for signatures encapsulating content,
+// the value that content must equal).
+func (s *CMSSignature) Verify(digest []byte) error {
+	if s.Content != nil {
+		// adbe.pkcs7.sha1: the encapsulated content is the document digest
+		// and the signature covers the content itself.
+		if !bytes.Equal(s.Content, digest) {
+			return ErrCMSDigestMismatch
+		}
+		return s.verifyContent()
+	}
+	return s.verifyDigest(digest, nil)
+}
+
+// verifyContent checks a signature over the encapsulated content.
+func (s *CMSSignature) verifyContent() error {
+	h := s.DigestAlgorithm.New()
+	h.Write(s.Content)
+	return s.verifyDigest(h.Sum(nil), s.Content)
+}
+
+// verifyDigest checks the signature given the digest of the signed content;
+// content itself is only needed by Ed25519 without signed attributes.
+func (s *CMSSignature) verifyDigest(digest, content []byte) error {
+	if s.Signer == nil {
+		return ErrCMSSignerCertMissing
+	}
+	if s.signedAttrs == nil {
+		return verifySignature(s.Signer.PublicKey, s.sigAlg, s.DigestAlgorithm, digest, content, s.Signature)
+	}
+	if !bytes.Equal(s.messageDigest, digest) {
+		return ErrCMSDigestMismatch
+	}
+	h := s.DigestAlgorithm.New()
+	h.Write(s.signedAttrs)
+	return verifySignature(s.Signer.PublicKey, s.sigAlg, s.DigestAlgorithm, h.Sum(nil), s.signedAttrs, s.Signature)
+}
+
+// verifySignature checks sig over a message whose hash is digest. msg is the
+// message itself, required only by Ed25519.
+func verifySignature(pub crypto.PublicKey, alg pkix.AlgorithmIdentifier, hash crypto.Hash, digest, msg, sig []byte) error {
+	oid := alg.Algorithm
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if oid.Equal(oidSignatureRSAPSS) {
+			var params pssParameters
+			if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &params); err == nil {
+				if h, ok := digestHash(params.Hash.Algorithm); ok && h != hash {
+					return fmt.Errorf("cms: PSS hash %v differs from digest algorithm %v", h, hash)
+				}
+			}
+			opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto, Hash: hash}
+			if err := rsa.VerifyPSS(key, hash, digest, sig, opts); err != nil {
+				return ErrCMSInvalidSignature
+			}
+			return nil
+		}
+		if !oid.Equal(oidEncryptionAlgorithmRSA) && !isRSAWithHash(oid) {
+			return fmt.Errorf("cms: signature algorithm %v does not match RSA key", oid)
+		}
+		if err := rsa.VerifyPKCS1v15(key, hash, digest, sig); err != nil {
+			return ErrCMSInvalidSignature
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if !oid.Equal(oidPublicKeyECDSA) && !isECDSAWithHash(oid) {
+			return fmt.Errorf("cms: signature algorithm %v does not match ECDSA key", oid)
+		}
+		if !ecdsa.VerifyASN1(key, digest, sig) {
+			return ErrCMSInvalidSignature
+		}
+		return nil
+	case ed25519.PublicKey:
+		if msg == nil {
+			return errors.New("cms: Ed25519 requires signed attributes")
+		}
+		if !ed25519.Verify(key, msg, sig) {
+			return ErrCMSInvalidSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("cms: unsupported public key type %T", pub)
+}
+
+func isRSAWithHash(oid asn1.ObjectIdentifier) bool {
+	return oid.Equal(oidSignatureSHA1WithRSA) || oid.Equal(oidSignatureSHA256WithRSA) ||
+		oid.Equal(oidSignatureSHA384WithRSA) || oid.Equal(oidSignatureSHA512WithRSA)
+}
+
+func isECDSAWithHash(oid asn1.ObjectIdentifier) bool {
+	return oid.Equal(oidSignatureECDSAWithSHA1) || oid.Equal(oidSignatureECDSAWithSHA256) ||
+		oid.Equal(oidSignatureECDSAWithSHA384) || oid.Equal(oidSignatureECDSAWithSHA512)
+}
+
+func digestHash(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	switch {
+	case oid.Equal(oidDigestAlgorithmSHA1):
+		return crypto.SHA1, true
+	case oid.Equal(oidDigestAlgorithmSHA256):
+		return crypto.SHA256, true
+	case oid.Equal(oidDigestAlgorithmSHA384):
+		return crypto.SHA384, true
+	case oid.Equal(oidDigestAlgorithmSHA512):
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+func certHashMatches(cert *x509.Certificate, h crypto.Hash, want []byte) bool {
+	if cert == nil {
+		return false
+	}
+	var sum []byte
+	switch h {
+	case crypto.SHA1:
+		s := sha1.Sum(cert.Raw)
+		sum = s[:]
+	case crypto.SHA256:
+		s := sha256.Sum256(cert.Raw)
+		sum = s[:]
+	case crypto.SHA384:
+		s := sha512.Sum384(cert.Raw)
+		sum = s[:]
+	case crypto.SHA512:
+		s := sha512.Sum512(cert.Raw)
+		sum = s[:]
+	default:
+		return false
+	}
+	return bytes.Equal(sum, want)
+}
+
+// findSigner locates the certificate named by a SignerIdentifier, either
+// IssuerAndSerialNumber or a [0] SubjectKeyIdentifier.
+func findSigner(certs []*x509.Certificate, sid asn1.RawValue) *x509.Certificate {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, c := range certs {
+			if bytes.Equal(c.SubjectKeyId, sid.Bytes) {
+				return c
+			}
+		}
+		return nil
+	}
+	var ias struct {
+		Issuer       asn1.RawValue
+		SerialNumber *big.Int
+	}
+	if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+		return nil
+	}
+	for _, c := range certs {
+		if c.SerialNumber.Cmp(ias.SerialNumber) == 0 && bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) {
+			return c
+		}
+	}
+	return nil
+}
+
+func parseAttributes(data []byte) ([]cmsAttribute, error) {
+	var attrs []cmsAttribute
+	for len(data) > 0 {
+		var a cmsAttribute
+		rest, err := asn1.Unmarshal(data, &a)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, a)
+		data = rest
+	}
+	return attrs, nil
+}
+
+func attributeValues(a cmsAttribute) ([]asn1.RawValue, error) {
+	var values []asn1.RawValue
+	data := a.Values.Bytes
+	for len(data) > 0 {
+		var v asn1.RawValue
+		rest, err := asn1.Unmarshal(data, &v)
+		if err != nil {
+			return nil, fmt.Errorf("cms: parse attribute %v: %w", a.Type, err)
+		}
+		values = append(values, v)
+		data = rest
+	}
+	return values, nil
+}
@@ -0,0 +1,81 @@
+package security
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestParseCMSSignatureRoundTrip(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: "CMS Signer"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256([]byte("signed bytes"))
+	signer := NewRSASigner(key, []*x509.Certificate{cert})
+	signer.SetPAdES(true)
+	der, err := signer.Sign(digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// PDF /Contents strings are zero padded.
+	der = append(der, make([]byte, 64)...)
+
+	sig, err := ParseCMSSignature(der)
+	if err != nil {
+		t.Fatalf("ParseCMSSignature: %v", err)
+	}
+	if sig.Signer == nil || !sig.Signer.Equal(cert) {
+		t.Fatalf("signer = %v", sig.Signer)
+	}
+	if sig.DigestAlgorithm != crypto.SHA256 {
+		t.Fatalf("digest algorithm = %v", sig.DigestAlgorithm)
+	}
+	if sig.SigningTime.IsZero() {
+		t.Fatal("signing time missing")
+	}
+	if !sig.HasSigningCertificate || !sig.SigningCertificateValid {
+		t.Fatalf("signing-certificate-v2 = %v/%v", sig.HasSigningCertificate, sig.SigningCertificateValid)
+	}
+	if err := sig.Verify(digest[:]); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	other := sha256.Sum256([]byte("other bytes"))
+	if err := sig.Verify(other[:]); !errors.Is(err, ErrCMSDigestMismatch) {
+		t.Fatalf("Verify with wrong digest = %v", err)
+	}
+	sig.Signature[0] ^= 0xFF
+	if err := sig.Verify(digest[:]); !errors.Is(err, ErrCMSInvalidSignature) {
+		t.Fatalf("Verify with corrupted signature = %v", err)
+	}
+}
+
+func TestParseCMSSignatureRejectsGarbage(t *testing.T) {
+	if _, err := ParseCMSSignature([]byte{0x30, 0x03, 0x02, 0x01, 0x01}); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -61,33 +61,7 @@ func createSigningCertificateV2Attribute(cert *x509.Certificate) (attribute, err
 	}
 
 	return attribute{
-		Type: oidAttributeSigningCertificateV2,
-		Value: asn1.RawValue{
-			Tag: 4, // asn1.TagOctetString? No, it's a SET of AttributeValue.
-			// AttributeValue is ANY.
-			// For this attribute, it's SigningCertificateV2.
-			// Wait, `attribute` struct in pkcs7.go has `Value asn1.RawValue 'asn1:"set"'`
-			// So we need to provide the bytes of the SigningCertificateV2 structure.
-			// But `asn1.Marshal` above gave us the SEQUENCE (SigningCertificateV2).
-			// We need to wrap it in a SET if we were marshaling the whole attribute manually.
-			// But `attribute` struct handles the SET tag.
-			// We just need the content of the SET, which is the SigningCertificateV2 SEQUENCE.
-			// However, `Value` is `asn1.RawValue`.
-			// If we put the bytes directly, `encoding/asn1` might try to re-encode them if we don't set the tag correctly.
-			// Actually, `Value` is `asn1.RawValue` with `set` tag in the struct field.
-			// This means `Value` *is* the SET.
-			// No, `Value` is an element *inside* the SET.
-			// The struct definition is:
-			// type attribute struct {
-			// 	Type  asn1.ObjectIdentifier
-			// 	Value asn1.RawValue `asn1:"set"`
-			// }
-			// This means `Value` will be marshaled as the elements of the SET.
-			// Since we have only one value (the SigningCertificateV2 sequence),
-			// we should put that sequence in `Value`.
-			// `asn1.RawValue` should preserve the tag of the sequence.
-
-			FullBytes: scv2Bytes,
-		},
+		Type:   oidAttributeSigningCertificateV2,
+		Values: []asn1.RawValue{{FullBytes: scv2Bytes}},
 	}, nil
 }
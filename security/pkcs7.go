@@ -2,9 +2,10 @@ package security
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
@@ -30,11 +31,11 @@ type contentInfo struct {
 
 type signedData struct {
 	Version          int
-	DigestAlgorithms []pkix.AlgorithmIdentifier
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
 	EncapContentInfo encapsulatedContentInfo
 	Certificates     []asn1.RawValue `asn1:"optional,tag:0,set"`
 	CRLs             []asn1.RawValue `asn1:"optional,tag:1,set"`
-	SignerInfos      []signerInfo
+	SignerInfos      []signerInfo    `asn1:"set"`
 }
 
 type encapsulatedContentInfo struct {
@@ -46,10 +47,10 @@ type signerInfo struct {
 	Version                   int
 	IssuerAndSerialNumber     issuerAndSerialNumber
 	DigestAlgorithm           pkix.AlgorithmIdentifier
-	AuthenticatedAttributes   []attribute `asn1:"optional,tag:0"`
+	AuthenticatedAttributes   []attribute `asn1:"optional,tag:0,set"`
 	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
 	EncryptedDigest           []byte
-	UnauthenticatedAttributes []attribute `asn1:"optional,tag:1"`
+	UnauthenticatedAttributes []attribute `asn1:"optional,tag:1,set"`
 }
 
 type issuerAndSerialNumber struct {
@@ -58,73 +59,115 @@ type issuerAndSerialNumber struct {
 }
 
 type attribute struct {
-	Type  asn1.ObjectIdentifier
-	Value asn1.RawValue `asn1:"set"`
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
 }
 
-// createPKCS7Signature creates a detached PKCS#7 signature for the given content digest.
-func createPKCS7Signature(priv *rsa.PrivateKey, cert *x509.Certificate, chain []*x509.Certificate, contentDigest []byte, extraAttrs []attribute) ([]byte, error) {
+// pssParameters is RSASSA-PSS-params from RFC 4055.
+type pssParameters struct {
+	Hash         pkix.AlgorithmIdentifier `asn1:"explicit,tag:0"`
+	MGF          pkix.AlgorithmIdentifier `asn1:"explicit,tag:1"`
+	SaltLength   int                      `asn1:"explicit,tag:2"`
+	TrailerField int                      `asn1:"optional,explicit,tag:3,default:1"`
+}
+
+var oidMGF1 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+
+// createPKCS7Signature creates a detached PKCS#7 signature for the given SHA-256
+// content digest with an RSA (PKCS#1 v1.5) or ECDSA key.
+func createPKCS7Signature(priv crypto.Signer, cert *x509.Certificate, chain []*x509.Certificate, contentDigest []byte, extraAttrs []attribute) ([]byte, error) {
+	return signCMS(cmsRequest{
+		key:        priv,
+		hash:       crypto.SHA256,
+		cert:       cert,
+		chain:      chain,
+		digest:     contentDigest,
+		extraAttrs: extraAttrs,
+	})
+}
+
+// cmsRequest describes a CMS SignedData to produce.
+type cmsRequest struct {
+	key   crypto.Signer
+	hash  crypto.Hash
+	pss   bool // RSASSA-PSS for RSA keys
+	cert  *x509.Certificate
+	chain []*x509.Certificate
+	// contentType defaults to id-data; content is encapsulated when non-nil.
+	contentType asn1.ObjectIdentifier
+	content     []byte
+	// digest is the hash of the signed content, computed with hash.
+	digest     []byte
+	extraAttrs []attribute
+}
+
+// signCMS creates a CMS SignedData with a single signer.
+func signCMS(req cmsRequest) ([]byte, error) {
+	key, hash, cert, contentDigest := req.key, req.hash, req.cert, req.digest
 	if cert == nil {
 		return nil, fmt.Errorf("signer certificate is required")
 	}
+	digestAlg, sigAlg, err := cmsAlgorithms(key.Public(), hash, req.pss)
+	if err != nil {
+		return nil, err
+	}
+	contentType := req.contentType
+	if contentType == nil {
+		contentType = oidData
+	}
 
 	// 1. Prepare Authenticated Attributes
-	// ContentType: pkcs7-data
+	// ContentType: contentType
 	// MessageDigest: contentDigest
 	// SigningTime: now
 
 	attrs := []attribute{
 		{
 			Type: oidAttributeContentType,
-			Value: asn1.RawValue{
+			Values: []asn1.RawValue{{
 				Tag:   6, // asn1.TagObjectIdentifier
-				Bytes: marshalOID(oidData),
-			},
+				Bytes: marshalOID(contentType),
+			}},
 		},
 		{
 			Type: oidAttributeSigningTime,
-			Value: asn1.RawValue{
+			Values: []asn1.RawValue{{
 				Tag:   23, // asn1.TagUTCTime
 				Bytes: []byte(time.Now().UTC().Format("060102150405Z")),
-			},
+			}},
 		},
 		{
 			Type: oidAttributeMessageDigest,
-			Value: asn1.RawValue{
+			Values: []asn1.RawValue{{
 				Tag:   4, // asn1.TagOctetString
 				Bytes: contentDigest,
-			},
+			}},
 		},
 	}
 
 	// Add extra attributes (e.g. PAdES signing-certificate-v2)
-	attrs = append(attrs, extraAttrs...)
-
-	// Marshal attributes to bytes for signing
-	// Note: The tag for AuthenticatedAttributes is [0] IMPLICIT SET OF Attribute
-	// But when signing, we sign the SET OF Attribute (tag 17).
-	// We need to marshal the slice of attributes as a SET.
-
-	// However, encoding/asn1 doesn't easily let us marshal a slice as a SET OF without a struct.
-	// Let's construct the raw bytes for the SET OF.
-
-	// Actually, `signerInfo` defines `AuthenticatedAttributes` as `[]attribute` with `tag:0`.
-	// `encoding/asn1` will marshal this as `[0] IMPLICIT SET OF Attribute`.
-	// But for signing, we need the DER encoding of `SET OF Attribute` (tag 17).
-	// We can achieve this by marshaling the attributes with a different struct or manually changing the tag.
+	attrs = append(attrs, req.extraAttrs...)
 
+	// The signature covers the DER SET OF Attribute (tag 17), while the
+	// SignerInfo carries the same set under the [0] IMPLICIT tag.
 	attrBytes, err := marshalAttributes(attrs)
 	if err != nil {
 		return nil, fmt.Errorf("marshal attributes: %w", err)
 	}
 
-	// Hash the attributes
-	h := sha256.New()
-	h.Write(attrBytes)
-	attrDigest := h.Sum(nil)
-
-	// Sign the attributes hash
-	signature, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, attrDigest)
+	var signature []byte
+	if _, ok := key.Public().(ed25519.PublicKey); ok {
+		// Ed25519 signs the attributes themselves (RFC 8419).
+		signature, err = key.Sign(rand.Reader, attrBytes, crypto.Hash(0))
+	} else {
+		h := hash.New()
+		h.Write(attrBytes)
+		var opts crypto.SignerOpts = hash
+		if req.pss {
+			opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+		}
+		signature, err = key.Sign(rand.Reader, h.Sum(nil), opts)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("sign attributes: %w", err)
 	}
@@ -141,16 +184,10 @@ func createPKCS7Signature(priv *rsa.PrivateKey, cert *x509.Certificate, chain []
 			Issuer:       asn1.RawValue{FullBytes: issuerBytes},
 			SerialNumber: cert.SerialNumber,
 		},
-		DigestAlgorithm: pkix.AlgorithmIdentifier{
-			Algorithm:  oidDigestAlgorithmSHA256,
-			Parameters: asn1.RawValue{Tag: 5}, // asn1.TagNull
-		},
-		AuthenticatedAttributes: attrs,
-		DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{
-			Algorithm:  oidEncryptionAlgorithmRSA,
-			Parameters: asn1.RawValue{Tag: 5}, // asn1.TagNull
-		},
-		EncryptedDigest: signature,
+		DigestAlgorithm:           digestAlg,
+		AuthenticatedAttributes:   attrs,
+		DigestEncryptionAlgorithm: sigAlg,
+		EncryptedDigest:           signature,
 	}
 
 	// 3. Construct SignedData
@@ -158,27 +195,38 @@ func createPKCS7Signature(priv *rsa.PrivateKey, cert *x509.Certificate, chain []
 	// Add signer cert
 	certs = append(certs, asn1.RawValue{FullBytes: cert.Raw})
 	// Add chain
-	for _, c := range chain {
+	for _, c := range req.chain {
 		if !c.Equal(cert) {
 			certs = append(certs, asn1.RawValue{FullBytes: c.Raw})
 		}
 	}
 
 	sd := signedData{
-		Version: 1,
-		DigestAlgorithms: []pkix.AlgorithmIdentifier{
-			{
-				Algorithm:  oidDigestAlgorithmSHA256,
-				Parameters: asn1.RawValue{Tag: 5}, // asn1.TagNull
-			},
-		},
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlg},
 		EncapContentInfo: encapsulatedContentInfo{
-			EContentType: oidData,
+			EContentType: contentType,
 			// EContent is empty for detached signature
 		},
 		Certificates: certs,
 		SignerInfos:  []signerInfo{si},
 	}
+	if !contentType.Equal(oidData) {
+		sd.Version = 3 // RFC 5652, 5.1
+	}
+	if req.content != nil {
+		octets, err := asn1.Marshal(req.content)
+		if err != nil {
+			return nil, fmt.Errorf("marshal content: %w", err)
+		}
+		// RawValue fields ignore the explicit tag, so wrap by hand.
+		sd.EncapContentInfo.EContent = asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      octets,
+		}
+	}
 
 	sdBytes, err := asn1.Marshal(sd)
 	if err != nil {
@@ -199,6 +247,77 @@ func createPKCS7Signature(priv *rsa.PrivateKey, cert *x509.Certificate, chain []
 	return asn1.Marshal(ci)
 }
 
+// cmsAlgorithms returns the digest and signature algorithm identifiers for
+// a key of pub's type signing with hash.
+func cmsAlgorithms(pub crypto.PublicKey, hash crypto.Hash, pss bool) (digest, sig pkix.AlgorithmIdentifier, err error) {
+	null := asn1.RawValue{Tag: 5} // asn1.TagNull
+	digestOID, ok := digestOID(hash)
+	if !ok {
+		return digest, sig, fmt.Errorf("unsupported digest algorithm %v", hash)
+	}
+	digest = pkix.AlgorithmIdentifier{Algorithm: digestOID, Parameters: null}
+
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		if !pss {
+			sig = pkix.AlgorithmIdentifier{Algorithm: oidEncryptionAlgorithmRSA, Parameters: null}
+			return digest, sig, nil
+		}
+		mgfHash, err := asn1.Marshal(digest)
+		if err != nil {
+			return digest, sig, err
+		}
+		params, err := asn1.Marshal(pssParameters{
+			Hash:         digest,
+			MGF:          pkix.AlgorithmIdentifier{Algorithm: oidMGF1, Parameters: asn1.RawValue{FullBytes: mgfHash}},
+			SaltLength:   hash.Size(),
+			TrailerField: 1,
+		})
+		if err != nil {
+			return digest, sig, err
+		}
+		sig = pkix.AlgorithmIdentifier{Algorithm: oidSignatureRSAPSS, Parameters: asn1.RawValue{FullBytes: params}}
+	case *ecdsa.PublicKey:
+		if pss {
+			return digest, sig, fmt.Errorf("PSS requires an RSA key")
+		}
+		switch hash {
+		case crypto.SHA256:
+			sig.Algorithm = oidSignatureECDSAWithSHA256
+		case crypto.SHA384:
+			sig.Algorithm = oidSignatureECDSAWithSHA384
+		case crypto.SHA512:
+			sig.Algorithm = oidSignatureECDSAWithSHA512
+		default:
+			return digest, sig, fmt.Errorf("unsupported ECDSA digest %v", hash)
+		}
+	case ed25519.PublicKey:
+		if pss || hash != crypto.SHA512 {
+			return digest, sig, fmt.Errorf("Ed25519 signatures require SHA-512 digests")
+		}
+		// RFC 8419 section 3.1: both identifiers omit their parameters.
+		digest.Parameters = asn1.RawValue{}
+		sig.Algorithm = oidSignatureEd25519
+	default:
+		return digest, sig, fmt.Errorf("unsupported key type %T", pub)
+	}
+	return digest, sig, nil
+}
+
+func digestOID(hash crypto.Hash) (asn1.ObjectIdentifier, bool) {
+	switch hash {
+	case crypto.SHA1:
+		return oidDigestAlgorithmSHA1, true
+	case crypto.SHA256:
+		return oidDigestAlgorithmSHA256, true
+	case crypto.SHA384:
+		return oidDigestAlgorithmSHA384, true
+	case crypto.SHA512:
+		return oidDigestAlgorithmSHA512, true
+	}
+	return nil, false
+}
+
 func marshalOID(oid asn1.ObjectIdentifier) []byte {
 	b, _ := asn1.Marshal(oid)
 	// Strip tag and length, we just want the value bytes for the RawValue which adds its own tag/length?
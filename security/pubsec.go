@@ -0,0 +1,684 @@
+package security
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+
+	"github.com/wudi/pdfkit/ir/raw"
+)
+
+// Sub-filters of the Adobe.PubSec handler. With s4 the recipients are listed
+// in the Encrypt dictionary and RC4 is used throughout; s5 moves them into a
+// crypt filter so AES can be selected.
+const (
+	SubFilterPKCS7S4 = "adbe.pkcs7.s4"
+	SubFilterPKCS7S5 = "adbe.pkcs7.s5"
+)
+
+// ErrNoRecipient is returned by a public-key handler when none of the
+// document's recipients matches the supplied certificate.
+var ErrNoRecipient = errors.New("certificate is not a recipient of this document")
+
+var (
+	oidEnvelopedData      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidRSAESOAEP          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidAES128CBC          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC         = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	pubSecSeedLen         = 20
+	pubSecEnvelopeDataLen = pubSecSeedLen + 4
+)
+
+// Recipient is a certificate a public-key encrypted document is addressed to,
+// with the permissions granted to the holder of its private key.
+type Recipient struct {
+	Certificate *x509.Certificate
+	Permissions raw.Permissions
+}
+
+type envelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+	UnprotectedAttrs     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+type keyTransRecipientInfo struct {
+	Version                int
+	RID                    asn1.RawValue
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+// publicKeyHandler implements the Adobe.PubSec security handler. Once the
+// file key has been recovered from a recipient envelope, objects are
+// encrypted exactly as with the Standard handler, so it reuses that
+// machinery.
+type publicKeyHandler struct {
+	*standardHandler
+	subFilter  string
+	recipients [][]byte
+	sha256     bool
+	cert       *x509.Certificate
+	privKey    crypto.Decrypter
+}
+
+func (b *HandlerBuilder) buildPublicKey() (Handler, error) {
+	subFilter := SubFilterPKCS7S4
+	if sf, ok := b.encryptDict.Get(raw.NameObj{Val: "SubFilter"}); ok {
+		if name, ok := sf.(raw.NameObj); ok {
+			subFilter = name.Val
+		}
+	}
+	v := int64(1)
+	if n, ok := numberVal(b.encryptDict, "V"); ok && n > 0 {
+		v = n
+	}
+	if v > 5 {
+		return nil, errors.New("encryption V>5 not supported by public-key handler")
+	}
+	encryptMeta := true
+	if m, ok := boolVal(b.encryptDict, "EncryptMetadata"); ok {
+		encryptMeta = m
+	}
+	keyLen := 40
+	if n, ok := numberVal(b.encryptDict, "Length"); ok && n > 0 {
+		keyLen = int(n)
+	}
+
+	recipients := stringArray(b.encryptDict, "Recipients")
+	baseAlgo := algoRC4
+	streamAlgo, stringAlgo := algoRC4, algoRC4
+	cryptFilters := map[string]cryptAlgo{"Identity": algoNone}
+	if v >= 4 {
+		switch subFilter {
+		case SubFilterPKCS7S5:
+		case SubFilterPKCS7S4:
+			return nil, errors.New("adbe.pkcs7.s4 does not support crypt filters")
+		default:
+			return nil, fmt.Errorf("unsupported public-key sub-filter %s", subFilter)
+		}
+		var err error
+		baseAlgo = algoAES
+		cryptFilters, err = parseCryptFilters(b.encryptDict, baseAlgo)
+		if err != nil {
+			return nil, err
+		}
+		delete(cryptFilters, "StdCF")
+		if streamAlgo, err = resolveCryptFilter(b.encryptDict, "StmF", algoNone, cryptFilters); err != nil {
+			return nil, err
+		}
+		if stringAlgo, err = resolveCryptFilter(b.encryptDict, "StrF", algoNone, cryptFilters); err != nil {
+			return nil, err
+		}
+		// The recipients, key length and metadata flag of s5 documents live
+		// in the crypt filter used for streams.
+		if cf := pubSecCryptFilter(b.encryptDict); cf != nil {
+			recipients = stringArray(cf, "Recipients")
+			if m, ok := boolVal(cf, "EncryptMetadata"); ok {
+				encryptMeta = m
+			}
+			if n, ok := numberVal(cf, "Length"); ok && n > 0 {
+				keyLen = int(n)
+				if keyLen <= 32 {
+					keyLen *= 8 // some producers give the length in bytes
+				}
+			}
+			if cfm, ok := cf.Get(raw.NameObj{Val: "CFM"}); ok {
+				if name, ok := cfm.(raw.NameObj); ok {
+					switch name.Val {
+					case "AESV2":
+						keyLen = 128
+					case "AESV3":
+						keyLen = 256
+					}
+				}
+			}
+		}
+	} else if subFilter != SubFilterPKCS7S4 && subFilter != "adbe.pkcs7.s3" {
+		return nil, fmt.Errorf("unsupported public-key sub-filter %s", subFilter)
+	}
+	if len(recipients) == 0 {
+		return nil, errors.New("public-key encryption dictionary has no recipients")
+	}
+	if keyLen%8 != 0 || keyLen < 40 || keyLen > 256 {
+		return nil, fmt.Errorf("invalid public-key encryption length %d", keyLen)
+	}
+	r := 4
+	if v >= 5 {
+		r = 6 // object keys are the file key itself, as with AES-256 Standard security
+	}
+	h := &publicKeyHandler{
+		standardHandler: &standardHandler{
+			v:            int(v),
+			r:            r,
+			lengthBits:   keyLen,
+			encryptMeta:  encryptMeta,
+			useAES:       streamAlgo == algoAES || stringAlgo == algoAES,
+			streamAlgo:   streamAlgo,
+			stringAlgo:   stringAlgo,
+			cryptFilters: cryptFilters,
+		},
+		subFilter:  subFilter,
+		recipients: recipients,
+		sha256:     v >= 5,
+		cert:       b.cert,
+		privKey:    b.privKey,
+	}
+	if len(b.fileKey) > 0 {
+		h.key = b.fileKey
+		h.p = -4
+		h.authed = true
+	}
+	return h, nil
+}
+
+// pubSecCryptFilter returns the crypt filter dictionary named by StmF, or the
+// first one defined when streams are not encrypted.
+func pubSecCryptFilter(d raw.Dictionary) raw.Dictionary {
+	cfObj, ok := d.Get(raw.NameObj{Val: "CF"})
+	if !ok {
+		return nil
+	}
+	cf, ok := cfObj.(raw.Dictionary)
+	if !ok {
+		return nil
+	}
+	for _, key := range []string{"StmF", "StrF"} {
+		if n, ok := d.Get(raw.NameObj{Val: key}); ok {
+			if name, ok := n.(raw.NameObj); ok {
+				if f, ok := cf.Get(name); ok {
+					if fd, ok := f.(raw.Dictionary); ok {
+						return fd
+					}
+				}
+			}
+		}
+	}
+	for _, key := range cf.Keys() {
+		if f, ok := cf.Get(key); ok {
+			if fd, ok := f.(raw.Dictionary); ok {
+				return fd
+			}
+		}
+	}
+	return nil
+}
+
+// stringArray reads a string or an array of strings.
+func stringArray(d raw.Dictionary, key string) [][]byte {
+	obj, ok := d.Get(raw.NameObj{Val: key})
+	if !ok {
+		return nil
+	}
+	if s, ok := obj.(raw.StringObj); ok {
+		return [][]byte{s.Value()}
+	}
+	arr, ok := obj.(*raw.ArrayObj)
+	if !ok {
+		return nil
+	}
+	var out [][]byte
+	for _, item := range arr.Items {
+		if s, ok := item.(raw.StringObj); ok {
+			out = append(out, s.Value())
+		}
+	}
+	return out
+}
+
+// Authenticate opens the envelope addressed to the handler's certificate and
+// derives the file key from it. The password is ignored.
+func (h *publicKeyHandler) Authenticate(password string) error {
+	if h.authed {
+		return nil
+	}
+	if h.cert == nil || h.privKey == nil {
+		return errors.New("public-key encrypted document requires a certificate and private key")
+	}
+	var content []byte
+	for _, recipient := range h.recipients {
+		data, err := openEnvelope(recipient, h.cert, h.privKey)
+		if errors.Is(err, ErrNoRecipient) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		content = data
+		break
+	}
+	if content == nil {
+		return ErrNoRecipient
+	}
+	if len(content) < pubSecEnvelopeDataLen {
+		return errors.New("public-key envelope content too short")
+	}
+	h.key = pubSecFileKey(content[:pubSecSeedLen], h.recipients, h.encryptMeta, h.sha256, h.lengthBits/8)
+	h.p = int32(uint32(content[20])<<24 | uint32(content[21])<<16 | uint32(content[22])<<8 | uint32(content[23]))
+	h.authed = true
+	return nil
+}
+
+func (h *publicKeyHandler) DecryptWithFilter(objNum, gen int, data []byte, class DataClass, cryptFilter string) ([]byte, error) {
+	if err := h.Authenticate(""); err != nil {
+		return nil, err
+	}
+	return h.standardHandler.DecryptWithFilter(objNum, gen, data, class, cryptFilter)
+}
+
+func (h *publicKeyHandler) Decrypt(objNum, gen int, data []byte, class DataClass) ([]byte, error) {
+	return h.DecryptWithFilter(objNum, gen, data, class, "")
+}
+
+func (h *publicKeyHandler) EncryptWithFilter(objNum, gen int, data []byte, class DataClass, cryptFilter string) ([]byte, error) {
+	if err := h.Authenticate(""); err != nil {
+		return nil, err
+	}
+	return h.standardHandler.EncryptWithFilter(objNum, gen, data, class, cryptFilter)
+}
+
+func (h *publicKeyHandler) Encrypt(objNum, gen int, data []byte, class DataClass) ([]byte, error) {
+	return h.EncryptWithFilter(objNum, gen, data, class, "")
+}
+
+// pubSecFileKey hashes the seed, every recipient blob and, when metadata is
+// left in clear, four 0xFF bytes; the key is a prefix of the digest.
+func pubSecFileKey(seed []byte, recipients [][]byte, encryptMeta, useSHA256 bool, keyLen int) []byte {
+	var md hash.Hash
+	if useSHA256 {
+		md = sha256.New()
+	} else {
+		md = sha1.New()
+	}
+	md.Write(seed)
+	for _, r := range recipients {
+		md.Write(r)
+	}
+	if !encryptMeta {
+		md.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+	}
+	sum := md.Sum(nil)
+	if keyLen > len(sum) {
+		keyLen = len(sum)
+	}
+	return sum[:keyLen]
+}
+
+// openEnvelope decrypts a CMS EnvelopedData for the key transport recipient
+// matching cert.
+func openEnvelope(der []byte, cert *x509.Certificate, key crypto.Decrypter) ([]byte, error) {
+	der, err := berToDER(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse recipient: %w", err)
+	}
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("parse recipient: %w", err)
+	}
+	if !ci.ContentType.Equal(oidEnvelopedData) {
+		return nil, fmt.Errorf("recipient is not enveloped data: %v", ci.ContentType)
+	}
+	var env envelopedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &env); err != nil {
+		return nil, fmt.Errorf("parse enveloped data: %w", err)
+	}
+	for _, ri := range env.RecipientInfos {
+		if ri.Class != asn1.ClassUniversal || ri.Tag != asn1.TagSequence {
+			continue // only key transport recipients are supported
+		}
+		var ktri keyTransRecipientInfo
+		if _, err := asn1.Unmarshal(ri.FullBytes, &ktri); err != nil {
+			return nil, fmt.Errorf("parse recipient info: %w", err)
+		}
+		if findSigner([]*x509.Certificate{cert}, ktri.RID) == nil {
+			continue
+		}
+		var opts crypto.DecrypterOpts
+		if ktri.KeyEncryptionAlgorithm.Algorithm.Equal(oidRSAESOAEP) {
+			opts = &rsa.OAEPOptions{Hash: crypto.SHA1}
+		} else if !ktri.KeyEncryptionAlgorithm.Algorithm.Equal(oidEncryptionAlgorithmRSA) {
+			return nil, fmt.Errorf("unsupported key encryption algorithm %v", ktri.KeyEncryptionAlgorithm.Algorithm)
+		}
+		cek, err := key.Decrypt(rand.Reader, ktri.EncryptedKey, opts)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt content key: %w", err)
+		}
+		return decryptContent(env.EncryptedContentInfo, cek)
+	}
+	return nil, ErrNoRecipient
+}
+
+func decryptContent(eci encryptedContentInfo, cek []byte) ([]byte, error) {
+	data := eci.EncryptedContent.Bytes
+	if eci.EncryptedContent.IsCompound {
+		// Constructed OCTET STRING: concatenate the segments.
+		var joined []byte
+		rest := data
+		for len(rest) > 0 {
+			var seg []byte
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &seg); err != nil {
+				return nil, fmt.Errorf("parse encrypted content: %w", err)
+			}
+			joined = append(joined, seg...)
+		}
+		data = joined
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("parse content encryption IV: %w", err)
+	}
+	var block cipher.Block
+	var err error
+	alg := eci.ContentEncryptionAlgorithm.Algorithm
+	switch {
+	case alg.Equal(oidAES128CBC), alg.Equal(oidAES192CBC), alg.Equal(oidAES256CBC):
+		block, err = aes.NewCipher(cek)
+	case alg.Equal(oidDESEDE3CBC):
+		block, err = des.NewTripleDESCipher(cek)
+	default:
+		return nil, fmt.Errorf("unsupported content encryption algorithm %v", alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	bs := block.BlockSize()
+	if len(iv) != bs || len(data) == 0 || len(data)%bs != 0 {
+		return nil, errors.New("malformed encrypted content")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > bs || pad > len(out) {
+		return nil, errors.New("invalid content padding")
+	}
+	return out[:len(out)-pad], nil
+}
+
+// sealEnvelope builds a CMS EnvelopedData carrying content for the given
+// certificates, using AES-256-CBC for the content and RSA PKCS#1 v1.5 for the
+// content key.
+func sealEnvelope(content []byte, certs []*x509.Certificate) ([]byte, error) {
+	cek := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(cek); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	encrypted, err := aesCBCWithIV(cek, iv, pkcs7Pad(content, aes.BlockSize), true)
+	if err != nil {
+		return nil, err
+	}
+	var infos []asn1.RawValue
+	for _, cert := range certs {
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("recipient %s: only RSA certificates are supported", cert.Subject)
+		}
+		encKey, err := rsa.EncryptPKCS1v15(rand.Reader, pub, cek)
+		if err != nil {
+			return nil, err
+		}
+		rid, err := asn1.Marshal(issuerAndSerialNumber{
+			Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+			SerialNumber: new(big.Int).Set(cert.SerialNumber),
+		})
+		if err != nil {
+			return nil, err
+		}
+		info, err := asn1.Marshal(keyTransRecipientInfo{
+			RID:                    asn1.RawValue{FullBytes: rid},
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidEncryptionAlgorithmRSA, Parameters: asn1.NullRawValue},
+			EncryptedKey:           encKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, asn1.RawValue{FullBytes: info})
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	env, err := asn1.Marshal(envelopedData{
+		RecipientInfos: infos,
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+			EncryptedContent:           asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: encrypted},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidEnvelopedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: env},
+	})
+}
+
+func pkcs7Pad(data []byte, bs int) []byte {
+	pad := bs - len(data)%bs
+	return append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+}
+
+// BuildPublicKeyEncryption builds an Adobe.PubSec Encrypt dictionary for the
+// recipients in opts and returns it with the file key. Recipients granted the
+// same permissions share one envelope.
+func BuildPublicKeyEncryption(opts EncryptionOptions, encryptMetadata bool) (*raw.DictObj, []byte, error) {
+	opts = NormalizeEncryptionOptions(opts)
+	if len(opts.Recipients) == 0 {
+		return nil, nil, errors.New("public-key encryption requires at least one recipient")
+	}
+	var cfm string
+	v, keyBits := 2, opts.KeyLength
+	switch opts.SubFilter {
+	case SubFilterPKCS7S4:
+		if opts.Algorithm != EncryptionAlgorithmRC4 {
+			return nil, nil, errors.New("adbe.pkcs7.s4 supports RC4 only")
+		}
+		if keyBits > 128 {
+			keyBits = 128
+		}
+	case SubFilterPKCS7S5:
+		switch {
+		case opts.Algorithm == EncryptionAlgorithmRC4:
+			v, cfm = 4, "V2"
+			if keyBits > 128 {
+				keyBits = 128
+			}
+		case keyBits >= 256:
+			v, cfm, keyBits = 5, "AESV3", 256
+		default:
+			v, cfm, keyBits = 4, "AESV2", 128
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported public-key sub-filter %s", opts.SubFilter)
+	}
+
+	seed := make([]byte, pubSecSeedLen)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, nil, err
+	}
+	var order []int32
+	groups := make(map[int32][]*x509.Certificate)
+	for _, r := range opts.Recipients {
+		if r.Certificate == nil {
+			return nil, nil, errors.New("recipient without certificate")
+		}
+		p := PermissionsValue(r.Permissions)
+		if _, ok := groups[p]; !ok {
+			order = append(order, p)
+		}
+		groups[p] = append(groups[p], r.Certificate)
+	}
+	var blobs [][]byte
+	recipients := make([]raw.Object, 0, len(order))
+	for _, p := range order {
+		content := make([]byte, pubSecEnvelopeDataLen)
+		copy(content, seed)
+		content[20], content[21], content[22], content[23] = byte(p>>24), byte(p>>16), byte(p>>8), byte(p)
+		blob, err := sealEnvelope(content, groups[p])
+		if err != nil {
+			return nil, nil, err
+		}
+		blobs = append(blobs, blob)
+		recipients = append(recipients, raw.Str(blob))
+	}
+	key := pubSecFileKey(seed, blobs, encryptMetadata, v >= 5, keyBits/8)
+
+	dict := raw.Dict()
+	dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("Adobe.PubSec"))
+	dict.Set(raw.NameLiteral("SubFilter"), raw.NameLiteral(opts.SubFilter))
+	dict.Set(raw.NameLiteral("V"), raw.NumberInt(int64(v)))
+	dict.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(keyBits)))
+	if cfm == "" {
+		dict.Set(raw.NameLiteral("Recipients"), raw.NewArray(recipients...))
+		if !encryptMetadata {
+			dict.Set(raw.NameLiteral("EncryptMetadata"), raw.Bool(false))
+		}
+		return dict, key, nil
+	}
+	filter := raw.Dict()
+	filter.Set(raw.NameLiteral("Type"), raw.NameLiteral("CryptFilter"))
+	filter.Set(raw.NameLiteral("CFM"), raw.NameLiteral(cfm))
+	filter.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(keyBits)))
+	filter.Set(raw.NameLiteral("Recipients"), raw.NewArray(recipients...))
+	filter.Set(raw.NameLiteral("EncryptMetadata"), raw.Bool(encryptMetadata))
+	cf := raw.Dict()
+	cf.Set(raw.NameLiteral("DefaultCryptFilter"), filter)
+	dict.Set(raw.NameLiteral("CF"), cf)
+	dict.Set(raw.NameLiteral("StmF"), raw.NameLiteral("DefaultCryptFilter"))
+	dict.Set(raw.NameLiteral("StrF"), raw.NameLiteral("DefaultCryptFilter"))
+	return dict, key, nil
+}
+
+// berToDER rewrites a BER encoding with definite, minimal lengths so that
+// encoding/asn1 accepts it. Envelopes produced by some toolkits use
+// indefinite lengths.
+func berToDER(b []byte) ([]byte, error) {
+	var out []byte
+	for len(b) > 0 {
+		elem, rest, err := berElement(b)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, elem...)
+		b = rest
+	}
+	return out, nil
+}
+
+func berElement(b []byte) (der, rest []byte, err error) {
+	if len(b) < 2 {
+		return nil, nil, errors.New("truncated BER element")
+	}
+	i := 1
+	if b[0]&0x1f == 0x1f {
+		for i < len(b) && b[i]&0x80 != 0 {
+			i++
+		}
+		i++
+	}
+	if i >= len(b) {
+		return nil, nil, errors.New("truncated BER tag")
+	}
+	tag := b[:i]
+	constructed := b[0]&0x20 != 0
+	l := b[i]
+	i++
+	var content []byte
+	switch {
+	case l == 0x80:
+		if !constructed {
+			return nil, nil, errors.New("indefinite length on primitive BER element")
+		}
+		body := b[i:]
+		for {
+			if len(body) < 2 {
+				return nil, nil, errors.New("missing BER end-of-contents")
+			}
+			if body[0] == 0 && body[1] == 0 {
+				body = body[2:]
+				break
+			}
+			elem, r, err := berElement(body)
+			if err != nil {
+				return nil, nil, err
+			}
+			content = append(content, elem...)
+			body = r
+		}
+		return encodeTLV(tag, content), body, nil
+	case l&0x80 == 0:
+		content, rest, err = takeBER(b[i:], int(l))
+	default:
+		k := int(l & 0x7f)
+		if k > 4 || i+k > len(b) {
+			return nil, nil, errors.New("invalid BER length")
+		}
+		n := 0
+		for _, c := range b[i : i+k] {
+			n = n<<8 | int(c)
+		}
+		content, rest, err = takeBER(b[i+k:], n)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if constructed {
+		if content, err = berToDER(content); err != nil {
+			return nil, nil, err
+		}
+	}
+	return encodeTLV(tag, content), rest, nil
+}
+
+func takeBER(b []byte, n int) ([]byte, []byte, error) {
+	if n < 0 || n > len(b) {
+		return nil, nil, errors.New("BER length exceeds data")
+	}
+	return b[:n], b[n:], nil
+}
+
+func encodeTLV(tag, content []byte) []byte {
+	out := append([]byte(nil), tag...)
+	n := len(content)
+	switch {
+	case n < 0x80:
+		out = append(out, byte(n))
+	default:
+		var lb []byte
+		for v := n; v > 0; v >>= 8 {
+			lb = append([]byte{byte(v)}, lb...)
+		}
+		out = append(out, 0x80|byte(len(lb)))
+		out = append(out, lb...)
+	}
+	return append(out, content...)
+}
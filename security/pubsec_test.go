@@ -0,0 +1,132 @@
+package security
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/wudi/pdfkit/ir/raw"
+)
+
+func recipientCert(t *testing.T, name string, serial int64) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestPublicKeyEncryption(t *testing.T) {
+	aliceCert, aliceKey := recipientCert(t, "Alice", 1)
+	bobCert, bobKey := recipientCert(t, "Bob", 2)
+	eveCert, eveKey := recipientCert(t, "Eve", 3)
+	alicePerms := raw.Permissions{Print: true, Copy: true}
+	bobPerms := raw.Permissions{FillForms: true}
+	recipients := []Recipient{
+		{Certificate: aliceCert, Permissions: alicePerms},
+		{Certificate: bobCert, Permissions: bobPerms},
+	}
+
+	cases := []struct {
+		name string
+		opts EncryptionOptions
+		v    int64
+	}{
+		{name: "S4_RC4_128", opts: EncryptionOptions{SubFilter: SubFilterPKCS7S4, KeyLength: 128}, v: 2},
+		{name: "S5_RC4_128", opts: EncryptionOptions{Algorithm: EncryptionAlgorithmRC4, KeyLength: 128}, v: 4},
+		{name: "S5_AES_128", opts: EncryptionOptions{Algorithm: EncryptionAlgorithmAES, KeyLength: 128}, v: 4},
+		{name: "S5_AES_256", opts: EncryptionOptions{}, v: 5},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.Recipients = recipients
+			dict, key, err := BuildEncryption("", "", raw.Permissions{}, nil, tc.opts, false)
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+			if v, _ := numberVal(dict, "V"); v != tc.v {
+				t.Fatalf("V = %d, want %d", v, tc.v)
+			}
+			writerHandler, err := (&HandlerBuilder{}).WithEncryptDict(dict).WithFileKey(key).Build()
+			if err != nil {
+				t.Fatalf("build writer handler: %v", err)
+			}
+			plain := []byte("for recipients only")
+			sealed, err := writerHandler.Encrypt(7, 0, plain, DataClassStream)
+			if err != nil {
+				t.Fatalf("encrypt: %v", err)
+			}
+
+			for _, r := range []struct {
+				cert  *x509.Certificate
+				key   *rsa.PrivateKey
+				perms raw.Permissions
+			}{{aliceCert, aliceKey, alicePerms}, {bobCert, bobKey, bobPerms}} {
+				h, err := (&HandlerBuilder{}).WithEncryptDict(dict).WithCredentials(r.cert, r.key).Build()
+				if err != nil {
+					t.Fatalf("build reader handler: %v", err)
+				}
+				if err := h.Authenticate(""); err != nil {
+					t.Fatalf("%s: authenticate: %v", r.cert.Subject.CommonName, err)
+				}
+				got, err := h.Decrypt(7, 0, sealed, DataClassStream)
+				if err != nil || !bytes.Equal(got, plain) {
+					t.Fatalf("%s: decrypt = %q, %v", r.cert.Subject.CommonName, got, err)
+				}
+				p := h.Permissions()
+				if p.Print != r.perms.Print || p.Copy != r.perms.Copy || p.FillForms != r.perms.FillForms || p.Modify {
+					t.Errorf("%s: permissions = %+v", r.cert.Subject.CommonName, p)
+				}
+				if h.EncryptMetadata() {
+					t.Errorf("EncryptMetadata = true")
+				}
+			}
+
+			h, err := (&HandlerBuilder{}).WithEncryptDict(dict).WithCredentials(eveCert, eveKey).Build()
+			if err != nil {
+				t.Fatalf("build reader handler: %v", err)
+			}
+			if err := h.Authenticate(""); !errors.Is(err, ErrNoRecipient) {
+				t.Fatalf("stranger authenticate = %v", err)
+			}
+		})
+	}
+}
+
+func TestBERToDER(t *testing.T) {
+	// SEQUENCE (indefinite) { [0] constructed (indefinite) { OCTET STRING "ab" }, INTEGER 5 }
+	ber := []byte{0x30, 0x80, 0xA0, 0x80, 0x04, 0x02, 'a', 'b', 0x00, 0x00, 0x02, 0x01, 0x05, 0x00, 0x00}
+	want := []byte{0x30, 0x09, 0xA0, 0x04, 0x04, 0x02, 'a', 'b', 0x02, 0x01, 0x05}
+	got, err := berToDER(ber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("der = % x, want % x", got, want)
+	}
+	if _, err := berToDER([]byte{0x30, 0x80, 0x02, 0x01, 0x05}); err == nil {
+		t.Fatal("missing end-of-contents accepted")
+	}
+}
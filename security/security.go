@@ -2,6 +2,7 @@ package security
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/md5"
@@ -9,6 +10,7 @@ import (
 	"crypto/rc4"
 	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/x509"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -46,6 +48,9 @@ type HandlerBuilder struct {
 	oe          []byte
 	uEntry      []byte
 	oEntry      []byte
+	cert        *x509.Certificate
+	privKey     crypto.Decrypter
+	fileKey     []byte
 }
 
 func (b *HandlerBuilder) WithEncryptDict(d raw.Dictionary) *HandlerBuilder {
@@ -55,12 +60,28 @@ func (b *HandlerBuilder) WithEncryptDict(d raw.Dictionary) *HandlerBuilder {
 func (b *HandlerBuilder) WithTrailer(d raw.Dictionary) *HandlerBuilder { b.trailer = d; return b }
 func (b *HandlerBuilder) WithFileID(id []byte) *HandlerBuilder         { b.fileID = id; return b }
 
+// WithCredentials supplies the recipient certificate and private key used to
+// open documents encrypted with the Adobe.PubSec handler.
+func (b *HandlerBuilder) WithCredentials(cert *x509.Certificate, key crypto.Decrypter) *HandlerBuilder {
+	b.cert = cert
+	b.privKey = key
+	return b
+}
+
+// WithFileKey supplies an already derived file key for a public-key handler,
+// as returned by BuildPublicKeyEncryption, so that it can encrypt without
+// credentials.
+func (b *HandlerBuilder) WithFileKey(key []byte) *HandlerBuilder { b.fileKey = key; return b }
+
 func (b *HandlerBuilder) Build() (Handler, error) {
 	if b.encryptDict == nil {
 		return noEncryptionHandler{}, nil
 	}
 	encFilter, _ := b.encryptDict.Get(raw.NameObj{Val: "Filter"})
 	if name, ok := encFilter.(raw.NameObj); ok && name.Val != "Standard" {
+		if name.Val == "Adobe.PubSec" {
+			return b.buildPublicKey()
+		}
 		return nil, errors.New("unsupported encryption filter")
 	}
 	v := int64(0)
@@ -162,15 +183,30 @@ const (
 	EncryptionAlgorithmAES EncryptionAlgorithm = "AES"
 )
 
-// EncryptionOptions configures Standard security encryption choices.
+// EncryptionOptions configures Standard security encryption choices. When
+// Recipients is set the document is encrypted with the Adobe.PubSec handler
+// for those certificates instead, and passwords are ignored.
 type EncryptionOptions struct {
-	Algorithm EncryptionAlgorithm
-	KeyLength int // bits
+	Algorithm  EncryptionAlgorithm
+	KeyLength  int // bits
+	Recipients []Recipient
+	SubFilter  string // SubFilterPKCS7S5 (default) or SubFilterPKCS7S4
 }
 
 // NormalizeEncryptionOptions fills defaults and clamps values.
 func NormalizeEncryptionOptions(opts EncryptionOptions) EncryptionOptions {
 	out := opts
+	if len(out.Recipients) > 0 {
+		if out.SubFilter == "" {
+			out.SubFilter = SubFilterPKCS7S5
+		}
+		if out.Algorithm == "" && out.SubFilter == SubFilterPKCS7S5 {
+			out.Algorithm = EncryptionAlgorithmAES
+			if out.KeyLength <= 0 {
+				out.KeyLength = 256
+			}
+		}
+	}
 	if out.Algorithm == "" {
 		out.Algorithm = EncryptionAlgorithmRC4
 	}
@@ -462,6 +498,9 @@ func NoopHandler() Handler { return noEncryptionHandler{} }
 // BuildEncryption selects the appropriate Encrypt dictionary builder based on options.
 func BuildEncryption(userPwd, ownerPwd string, permissions raw.Permissions, fileID []byte, opts EncryptionOptions, encryptMetadata bool) (*raw.DictObj, []byte, error) {
 	opts = NormalizeEncryptionOptions(opts)
+	if len(opts.Recipients) > 0 {
+		return BuildPublicKeyEncryption(opts, encryptMetadata)
+	}
 	switch opts.Algorithm {
 	case EncryptionAlgorithmAES:
 		if opts.KeyLength >= 256 {
@@ -1,9 +1,14 @@
 package security
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/x509"
 	"errors"
+	"fmt"
 )
 
 // Signer represents an entity capable of signing data.
@@ -15,33 +20,121 @@ type Signer interface {
 	Certificate() []*x509.Certificate
 }
 
-// RSASigner implements Signer using an RSA private key.
-type RSASigner struct {
-	priv  *rsa.PrivateKey
+// SignerDigest returns the hash a Signer expects its Sign input to be
+// computed with. Signers without a DigestAlgorithm method use SHA-256.
+func SignerDigest(s Signer) crypto.Hash {
+	if d, ok := s.(interface{ DigestAlgorithm() crypto.Hash }); ok {
+		return d.DigestAlgorithm()
+	}
+	return crypto.SHA256
+}
+
+// CryptoSigner implements Signer with any crypto.Signer, so the private key
+// may stay inside a hardware token or remote KMS. RSA (PKCS#1 v1.5 or PSS),
+// ECDSA and Ed25519 keys are supported.
+type CryptoSigner struct {
+	key   crypto.Signer
 	chain []*x509.Certificate
+	hash  crypto.Hash
+	pss   bool
 	pades bool
 }
 
-// NewRSASigner creates a new RSA signer.
-func NewRSASigner(priv *rsa.PrivateKey, chain []*x509.Certificate) *RSASigner {
-	return &RSASigner{
-		priv:  priv,
-		chain: chain,
+// NewCryptoSigner creates a signer for key; chain starts with the signer
+// certificate. The digest defaults to SHA-256, SHA-384 for P-384 keys and
+// SHA-512 for P-521 and Ed25519 keys.
+func NewCryptoSigner(key crypto.Signer, chain []*x509.Certificate) (*CryptoSigner, error) {
+	if key == nil {
+		return nil, errors.New("signer key is nil")
+	}
+	hash, err := defaultDigest(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &CryptoSigner{key: key, chain: chain, hash: hash}, nil
+}
+
+// defaultDigest picks the digest algorithm matching the strength of pub.
+func defaultDigest(pub crypto.PublicKey) (crypto.Hash, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return crypto.SHA256, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P384():
+			return crypto.SHA384, nil
+		case elliptic.P521():
+			return crypto.SHA512, nil
+		}
+		return crypto.SHA256, nil
+	case ed25519.PublicKey:
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("unsupported signer key type %T", pub)
+	}
+}
+
+// NewECDSASigner creates a signer for an ECDSA private key.
+func NewECDSASigner(priv *ecdsa.PrivateKey, chain []*x509.Certificate) (*CryptoSigner, error) {
+	if priv == nil {
+		return nil, errors.New("signer key is nil")
+	}
+	return NewCryptoSigner(priv, chain)
+}
+
+// NewEd25519Signer creates a signer for an Ed25519 private key.
+func NewEd25519Signer(priv ed25519.PrivateKey, chain []*x509.Certificate) (*CryptoSigner, error) {
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid Ed25519 private key")
+	}
+	return NewCryptoSigner(priv, chain)
+}
+
+// SetDigestAlgorithm selects SHA-256, SHA-384 or SHA-512. Ed25519 keys only
+// accept SHA-512 (RFC 8419).
+func (s *CryptoSigner) SetDigestAlgorithm(h crypto.Hash) error {
+	switch h {
+	case crypto.SHA256, crypto.SHA384, crypto.SHA512:
+	default:
+		return fmt.Errorf("unsupported digest algorithm %v", h)
+	}
+	if _, ok := s.key.Public().(ed25519.PublicKey); ok && h != crypto.SHA512 {
+		return errors.New("Ed25519 signatures require SHA-512")
+	}
+	s.hash = h
+	return nil
+}
+
+// DigestAlgorithm returns the hash used for the document digest passed to
+// Sign and for the signed attributes.
+func (s *CryptoSigner) DigestAlgorithm() crypto.Hash {
+	return s.hash
+}
+
+// SetPSS selects RSASSA-PSS instead of PKCS#1 v1.5 for RSA keys.
+func (s *CryptoSigner) SetPSS(enable bool) error {
+	if _, ok := s.key.Public().(*rsa.PublicKey); !ok && enable {
+		return errors.New("PSS requires an RSA key")
 	}
+	s.pss = enable
+	return nil
 }
 
 // SetPAdES enables or disables PAdES (ETSI.CAdES.detached) support.
 // When enabled, the signing-certificate-v2 attribute is included.
-func (s *RSASigner) SetPAdES(enable bool) {
+func (s *CryptoSigner) SetPAdES(enable bool) {
 	s.pades = enable
 }
 
-func (s *RSASigner) Sign(data []byte) ([]byte, error) {
+func (s *CryptoSigner) Sign(data []byte) ([]byte, error) {
 	// data is the digest of the PDF content (calculated by the caller).
 
 	if len(s.chain) == 0 {
 		return nil, errors.New("signer certificate chain is empty")
 	}
+	if len(data) != s.hash.Size() {
+		return nil, fmt.Errorf("digest is %d bytes, want %d for %v", len(data), s.hash.Size(), s.hash)
+	}
 	cert := s.chain[0]
 
 	var extraAttrs []attribute
@@ -53,13 +146,31 @@ func (s *RSASigner) Sign(data []byte) ([]byte, error) {
 		extraAttrs = append(extraAttrs, attr)
 	}
 
-	return createPKCS7Signature(s.priv, cert, s.chain, data, extraAttrs)
+	return signCMS(cmsRequest{
+		key:        s.key,
+		hash:       s.hash,
+		pss:        s.pss,
+		cert:       cert,
+		chain:      s.chain,
+		digest:     data,
+		extraAttrs: extraAttrs,
+	})
 }
 
-func (s *RSASigner) Certificate() []*x509.Certificate {
+func (s *CryptoSigner) Certificate() []*x509.Certificate {
 	return s.chain
 }
 
+// RSASigner implements Signer using an RSA private key.
+type RSASigner struct {
+	*CryptoSigner
+}
+
+// NewRSASigner creates a new RSA signer.
+func NewRSASigner(priv *rsa.PrivateKey, chain []*x509.Certificate) *RSASigner {
+	return &RSASigner{CryptoSigner: &CryptoSigner{key: priv, chain: chain, hash: crypto.SHA256}}
+}
+
 // MockSigner for testing without keys
 type MockSigner struct{}
 
@@ -0,0 +1,244 @@
+package security
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// fakeKMS stands in for a token or remote key service: it exposes only the
+// crypto.Signer methods and records every signing request.
+type fakeKMS struct {
+	key   crypto.Signer
+	calls int
+}
+
+func (k *fakeKMS) Public() crypto.PublicKey { return k.key.Public() }
+
+func (k *fakeKMS) Sign(r io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	k.calls++
+	return k.key.Sign(r, digest, opts)
+}
+
+func selfSigned(t *testing.T, key crypto.Signer) *x509.Certificate {
+	t.Helper()
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "Key Signer"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCryptoSignerAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name   string
+		signer func(cert *x509.Certificate) *CryptoSigner
+		key    crypto.Signer
+		hash   crypto.Hash
+		sigOID string
+	}{
+		{"rsa-sha384", func(c *x509.Certificate) *CryptoSigner {
+			s := NewRSASigner(rsaKey, []*x509.Certificate{c}).CryptoSigner
+			if err := s.SetDigestAlgorithm(crypto.SHA384); err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}, rsaKey, crypto.SHA384, oidEncryptionAlgorithmRSA.String()},
+		{"rsa-pss", func(c *x509.Certificate) *CryptoSigner {
+			s := NewRSASigner(rsaKey, []*x509.Certificate{c}).CryptoSigner
+			if err := s.SetPSS(true); err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}, rsaKey, crypto.SHA256, oidSignatureRSAPSS.String()},
+		{"ecdsa-p256", func(c *x509.Certificate) *CryptoSigner {
+			s, err := NewECDSASigner(p256, []*x509.Certificate{c})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}, p256, crypto.SHA256, oidSignatureECDSAWithSHA256.String()},
+		{"ecdsa-p384", func(c *x509.Certificate) *CryptoSigner {
+			s, err := NewECDSASigner(p384, []*x509.Certificate{c})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}, p384, crypto.SHA384, oidSignatureECDSAWithSHA384.String()},
+		{"ed25519", func(c *x509.Certificate) *CryptoSigner {
+			s, err := NewEd25519Signer(edKey, []*x509.Certificate{c})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}, edKey, crypto.SHA512, oidSignatureEd25519.String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := selfSigned(t, tt.key)
+			signer := tt.signer(cert)
+			signer.SetPAdES(true)
+			if got := SignerDigest(signer); got != tt.hash {
+				t.Fatalf("SignerDigest = %v, want %v", got, tt.hash)
+			}
+			h := tt.hash.New()
+			h.Write([]byte("document bytes"))
+			digest := h.Sum(nil)
+			der, err := signer.Sign(digest)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			sig, err := ParseCMSSignature(der)
+			if err != nil {
+				t.Fatalf("ParseCMSSignature: %v", err)
+			}
+			if sig.DigestAlgorithm != tt.hash {
+				t.Fatalf("digest algorithm = %v", sig.DigestAlgorithm)
+			}
+			if got := sig.sigAlg.Algorithm.String(); got != tt.sigOID {
+				t.Fatalf("signature algorithm = %s, want %s", got, tt.sigOID)
+			}
+			if !sig.SigningCertificateValid {
+				t.Fatal("signing-certificate-v2 does not match")
+			}
+			if err := sig.Verify(digest); err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+		})
+	}
+}
+
+func TestEd25519AlgorithmParametersAbsent(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := NewEd25519Signer(edKey, []*x509.Certificate{selfSigned(t, edKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha512.Sum512([]byte("document bytes"))
+	der, err := signer.Sign(digest[:])
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		t.Fatal(err)
+	}
+	var sd cmsSignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		t.Fatal(err)
+	}
+	var digestAlgs []pkix.AlgorithmIdentifier
+	if _, err := asn1.UnmarshalWithParams(sd.DigestAlgorithms.FullBytes, &digestAlgs, "set"); err != nil {
+		t.Fatal(err)
+	}
+	if len(sd.SignerInfos) != 1 || len(digestAlgs) != 1 {
+		t.Fatalf("signer infos = %d, digest algorithms = %d", len(sd.SignerInfos), len(digestAlgs))
+	}
+	// SEQUENCE { id-sha512 } and SEQUENCE { id-Ed25519 }, with no NULL.
+	want := map[string][]byte{
+		"digestAlgorithms":   {0x30, 0x0b, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03},
+		"digestAlgorithm":    {0x30, 0x0b, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03},
+		"signatureAlgorithm": {0x30, 0x05, 0x06, 0x03, 0x2b, 0x65, 0x70},
+	}
+	for name, alg := range map[string]pkix.AlgorithmIdentifier{
+		"digestAlgorithms":   digestAlgs[0],
+		"digestAlgorithm":    sd.SignerInfos[0].DigestAlgorithm,
+		"signatureAlgorithm": sd.SignerInfos[0].SignatureAlgorithm,
+	} {
+		got, err := asn1.Marshal(alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want[name]) {
+			t.Errorf("%s = % x, want % x", name, got, want[name])
+		}
+	}
+}
+
+func TestCryptoSignerExternalKey(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	kms := &fakeKMS{key: key}
+	cert := selfSigned(t, kms)
+	signer, err := NewCryptoSigner(kms, []*x509.Certificate{cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := crypto.SHA256.New()
+	h.Write([]byte("remote"))
+	digest := h.Sum(nil)
+	der, err := signer.Sign(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kms.calls != 2 { // certificate plus CMS signature
+		t.Fatalf("key used %d times", kms.calls)
+	}
+	sig, err := ParseCMSSignature(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sig.Verify(digest); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+}
+
+func TestCryptoSignerRejects(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ed, err := NewEd25519Signer(edKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEd25519Signer(edKey[:16], nil); err == nil {
+		t.Fatal("accepted a truncated Ed25519 key")
+	}
+	if _, err := NewECDSASigner(nil, nil); err == nil {
+		t.Fatal("accepted a nil ECDSA key")
+	}
+	if err := ed.SetDigestAlgorithm(crypto.SHA256); err == nil {
+		t.Fatal("Ed25519 accepted SHA-256")
+	}
+	if err := ed.SetPSS(true); err == nil {
+		t.Fatal("Ed25519 accepted PSS")
+	}
+	if _, err := ed.Sign(make([]byte, 64)); err == nil {
+		t.Fatal("signed without a certificate")
+	}
+	rsaSigner := NewRSASigner(nil, []*x509.Certificate{{}})
+	if err := rsaSigner.SetDigestAlgorithm(crypto.MD5); err == nil {
+		t.Fatal("accepted MD5")
+	}
+	if _, err := rsaSigner.Sign(make([]byte, 20)); err == nil {
+		t.Fatal("accepted digest of the wrong length")
+	}
+}
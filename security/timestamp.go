@@ -0,0 +1,416 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	oidTSTInfo                 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidAttributeTimestampToken = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+	// ETSI EN 319 421 best practices policy, used by LocalTSA by default.
+	oidBaselineTimestampPolicy = asn1.ObjectIdentifier{0, 4, 0, 2023, 1, 1}
+)
+
+// Errors reported by timestamp verification.
+var (
+	ErrTimestampMismatch = errors.New("timestamp: message imprint does not match")
+	ErrTimestampNotTSA   = errors.New("timestamp: signer certificate lacks the timeStamping usage")
+)
+
+// TimestampClient obtains RFC 3161 timestamp tokens from a time-stamping
+// authority.
+type TimestampClient interface {
+	// Timestamp returns a DER TimeStampToken over digest, which was computed
+	// with hash.
+	Timestamp(ctx context.Context, digest []byte, hash crypto.Hash) ([]byte, error)
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type tstAccuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       tstAccuracy   `asn1:"optional"`
+	Ordering       bool          `asn1:"optional,default:false"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+	Extensions     asn1.RawValue         `asn1:"optional,tag:0"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// TimestampToken is a parsed RFC 3161 TimeStampToken.
+type TimestampToken struct {
+	Raw []byte
+	// CMS is the SignedData wrapping the TSTInfo; CMS.Signer is the TSA.
+	CMS           *CMSSignature
+	Policy        asn1.ObjectIdentifier
+	HashAlgorithm crypto.Hash
+	HashedMessage []byte
+	SerialNumber  *big.Int
+	GenTime       time.Time
+	Nonce         *big.Int
+}
+
+// ParseTimestampToken parses a DER TimeStampToken.
+func ParseTimestampToken(der []byte) (*TimestampToken, error) {
+	sig, err := ParseCMSSignature(der)
+	if err != nil {
+		return nil, err
+	}
+	if !sig.ContentType.Equal(oidTSTInfo) || sig.Content == nil {
+		return nil, errors.New("timestamp: content is not a TSTInfo")
+	}
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sig.Content, &info); err != nil {
+		return nil, fmt.Errorf("timestamp: parse TSTInfo: %w", err)
+	}
+	hash, ok := digestHash(info.MessageImprint.HashAlgorithm.Algorithm)
+	if !ok {
+		return nil, fmt.Errorf("timestamp: unsupported imprint algorithm %v", info.MessageImprint.HashAlgorithm.Algorithm)
+	}
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &raw); err != nil {
+		return nil, err
+	}
+	return &TimestampToken{
+		Raw:           raw.FullBytes,
+		CMS:           sig,
+		Policy:        info.Policy,
+		HashAlgorithm: hash,
+		HashedMessage: info.MessageImprint.HashedMessage,
+		SerialNumber:  info.SerialNumber,
+		GenTime:       info.GenTime,
+		Nonce:         info.Nonce,
+	}, nil
+}
+
+// Verify checks that the token covers digest (computed with HashAlgorithm)
+// and that the TSA signature over the TSTInfo is valid.
+func (t *TimestampToken) Verify(digest []byte) error {
+	if !bytes.Equal(t.HashedMessage, digest) {
+		return ErrTimestampMismatch
+	}
+	if err := t.CMS.verifyContent(); err != nil {
+		return err
+	}
+	for _, u := range t.CMS.Signer.ExtKeyUsage {
+		if u == x509.ExtKeyUsageTimeStamping {
+			return nil
+		}
+	}
+	return ErrTimestampNotTSA
+}
+
+// SignatureTimestamp returns the signature timestamp token carried as an
+// unsigned attribute, or nil when there is none.
+func (s *CMSSignature) SignatureTimestamp() (*TimestampToken, error) {
+	values := s.UnsignedAttributes[oidAttributeTimestampToken.String()]
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return ParseTimestampToken(values[0].FullBytes)
+}
+
+// VerifySignatureTimestamp checks that tok timestamps this signature value.
+func (s *CMSSignature) VerifySignatureTimestamp(tok *TimestampToken) error {
+	h := tok.HashAlgorithm.New()
+	h.Write(s.Signature)
+	return tok.Verify(h.Sum(nil))
+}
+
+// TimestampSignature adds a signature timestamp from tsa to a DER CMS
+// SignedData as the id-aa-signatureTimeStampToken unsigned attribute of its
+// signer (PAdES B-T). The signed content and attributes are left untouched.
+func TimestampSignature(ctx context.Context, der []byte, tsa TimestampClient) ([]byte, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("cms: parse content info: %w", err)
+	}
+	var sd cmsSignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("cms: parse signed data: %w", err)
+	}
+	if len(sd.SignerInfos) == 0 {
+		return nil, errors.New("cms: no signer infos")
+	}
+	si := &sd.SignerInfos[0]
+	hash, ok := digestHash(si.DigestAlgorithm.Algorithm)
+	if !ok {
+		hash = crypto.SHA256
+	}
+	h := hash.New()
+	h.Write(si.Signature)
+	token, err := tsa.Timestamp(ctx, h.Sum(nil), hash)
+	if err != nil {
+		return nil, fmt.Errorf("timestamp signature: %w", err)
+	}
+	attr, err := asn1.Marshal(attribute{
+		Type:   oidAttributeTimestampToken,
+		Values: []asn1.RawValue{{FullBytes: token}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	si.UnsignedAttrs = asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        1,
+		IsCompound: true,
+		Bytes:      append(append([]byte(nil), si.UnsignedAttrs.Bytes...), attr...),
+	}
+	sdBytes, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, fmt.Errorf("marshal signed data: %w", err)
+	}
+	ci.Content = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sdBytes}
+	return asn1.Marshal(ci)
+}
+
+// HTTPTimestampClient requests timestamps from an RFC 3161 TSA over HTTP.
+type HTTPTimestampClient struct {
+	URL    string
+	Client *http.Client
+	// Username and Password enable HTTP basic authentication when set.
+	Username string
+	Password string
+	// Policy requests a specific TSA policy; nil accepts the default.
+	Policy asn1.ObjectIdentifier
+}
+
+func NewHTTPTimestampClient(url string) *HTTPTimestampClient {
+	return &HTTPTimestampClient{
+		URL:    url,
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *HTTPTimestampClient) Timestamp(ctx context.Context, digest []byte, hash crypto.Hash) ([]byte, error) {
+	oid, ok := digestOID(hash)
+	if !ok {
+		return nil, fmt.Errorf("timestamp: unsupported digest %v", hash)
+	}
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	body, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		ReqPolicy: c.Policy,
+		Nonce:     nonce,
+		CertReq:   true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/timestamp-query")
+	req.Header.Set("Accept", "application/timestamp-reply")
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("timestamp request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("timestamp request failed: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read timestamp response: %w", err)
+	}
+
+	var tsr timeStampResp
+	if _, err := asn1.Unmarshal(data, &tsr); err != nil {
+		return nil, fmt.Errorf("failed to parse timestamp response: %w", err)
+	}
+	// 0 granted, 1 grantedWithMods.
+	if tsr.Status.Status > 1 {
+		return nil, fmt.Errorf("timestamp rejected: status %d %v", tsr.Status.Status, tsr.Status.StatusString)
+	}
+	if len(tsr.TimeStampToken.FullBytes) == 0 {
+		return nil, errors.New("timestamp response carries no token")
+	}
+	tok, err := ParseTimestampToken(tsr.TimeStampToken.FullBytes)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(tok.HashedMessage, digest) {
+		return nil, ErrTimestampMismatch
+	}
+	if tok.Nonce == nil || tok.Nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("timestamp nonce mismatch")
+	}
+	return tsr.TimeStampToken.FullBytes, nil
+}
+
+// LocalTSA is an in-process time-stamping authority. It serves as a
+// TimestampClient directly and answers RFC 3161 requests over HTTP, which
+// makes it suitable for tests and closed environments.
+type LocalTSA struct {
+	Key         crypto.Signer
+	Certificate *x509.Certificate
+	// Chain lists further certificates to embed in each token.
+	Chain  []*x509.Certificate
+	Policy asn1.ObjectIdentifier
+	// Now returns the time to stamp; nil uses time.Now.
+	Now func() time.Time
+
+	mu     sync.Mutex
+	serial int64
+}
+
+// NewLocalTSA creates a TSA signing with key. cert should carry the
+// timeStamping extended key usage.
+func NewLocalTSA(key crypto.Signer, cert *x509.Certificate) *LocalTSA {
+	return &LocalTSA{
+		Key:         key,
+		Certificate: cert,
+		Policy:      oidBaselineTimestampPolicy,
+	}
+}
+
+func (t *LocalTSA) Timestamp(ctx context.Context, digest []byte, hash crypto.Hash) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	oid, ok := digestOID(hash)
+	if !ok {
+		return nil, fmt.Errorf("timestamp: unsupported digest %v", hash)
+	}
+	return t.issue(messageImprint{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.NullRawValue},
+		HashedMessage: digest,
+	}, nil)
+}
+
+// ServeHTTP answers application/timestamp-query requests.
+func (t *LocalTSA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp := timeStampResp{}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<16))
+	var req timeStampReq
+	if err == nil {
+		_, err = asn1.Unmarshal(body, &req)
+	}
+	if err == nil {
+		var token []byte
+		token, err = t.issue(req.MessageImprint, req.Nonce)
+		resp.TimeStampToken = asn1.RawValue{FullBytes: token}
+	}
+	if err != nil {
+		resp = timeStampResp{Status: pkiStatusInfo{Status: 2, StatusString: []string{err.Error()}}}
+	}
+	der, err := asn1.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.Write(der)
+}
+
+func (t *LocalTSA) issue(imprint messageImprint, nonce *big.Int) ([]byte, error) {
+	if t.Key == nil || t.Certificate == nil {
+		return nil, errors.New("timestamp: TSA key and certificate required")
+	}
+	if _, ok := digestHash(imprint.HashAlgorithm.Algorithm); !ok {
+		return nil, fmt.Errorf("timestamp: unsupported imprint algorithm %v", imprint.HashAlgorithm.Algorithm)
+	}
+	hash, err := defaultDigest(t.Key.Public())
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now
+	if t.Now != nil {
+		now = t.Now
+	}
+	t.mu.Lock()
+	t.serial++
+	serial := t.serial
+	t.mu.Unlock()
+
+	info, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         t.Policy,
+		MessageImprint: imprint,
+		SerialNumber:   big.NewInt(serial),
+		GenTime:        now().UTC().Truncate(time.Second),
+		Accuracy:       tstAccuracy{Seconds: 1},
+		Nonce:          nonce,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("timestamp: marshal TSTInfo: %w", err)
+	}
+	h := hash.New()
+	h.Write(info)
+	attr, err := createSigningCertificateV2Attribute(t.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	return signCMS(cmsRequest{
+		key:         t.Key,
+		hash:        hash,
+		cert:        t.Certificate,
+		chain:       t.Chain,
+		contentType: oidTSTInfo,
+		content:     info,
+		digest:      h.Sum(nil),
+		extraAttrs:  []attribute{attr},
+	})
+}
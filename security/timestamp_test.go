@@ -0,0 +1,134 @@
+package security
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestTSA(t *testing.T) *LocalTSA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(11),
+		Subject:      pkix.Name{CommonName: "Test TSA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tsa := NewLocalTSA(key, cert)
+	fixed := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	tsa.Now = func() time.Time { return fixed }
+	return tsa
+}
+
+func TestLocalTSA(t *testing.T) {
+	tsa := newTestTSA(t)
+	digest := sha256.Sum256([]byte("data"))
+	der, err := tsa.Timestamp(context.Background(), digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := ParseTimestampToken(der)
+	if err != nil {
+		t.Fatalf("ParseTimestampToken: %v", err)
+	}
+	if !tok.GenTime.Equal(tsa.Now()) {
+		t.Fatalf("genTime = %v", tok.GenTime)
+	}
+	if tok.HashAlgorithm != crypto.SHA256 || tok.SerialNumber.Int64() != 1 {
+		t.Fatalf("token = %+v", tok)
+	}
+	if !tok.Policy.Equal(oidBaselineTimestampPolicy) {
+		t.Fatalf("policy = %v", tok.Policy)
+	}
+	if err := tok.Verify(digest[:]); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	other := sha256.Sum256([]byte("other"))
+	if err := tok.Verify(other[:]); !errors.Is(err, ErrTimestampMismatch) {
+		t.Fatalf("Verify other = %v", err)
+	}
+}
+
+func TestHTTPTimestampClient(t *testing.T) {
+	tsa := newTestTSA(t)
+	srv := httptest.NewServer(tsa)
+	defer srv.Close()
+
+	client := NewHTTPTimestampClient(srv.URL)
+	digest := sha256.Sum256([]byte("over http"))
+	der, err := client.Timestamp(context.Background(), digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Timestamp: %v", err)
+	}
+	tok, err := ParseTimestampToken(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Nonce == nil {
+		t.Fatal("nonce not echoed")
+	}
+	if err := tok.Verify(digest[:]); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	tsa.Key = nil // the TSA now rejects requests
+	if _, err := client.Timestamp(context.Background(), digest[:], crypto.SHA256); err == nil {
+		t.Fatal("expected rejection")
+	}
+}
+
+func TestTimestampSignature(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cert := selfSigned(t, key)
+	signer, err := NewECDSASigner(key, []*x509.Certificate{cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("document"))
+	der, err := signer.Sign(digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamped, err := TimestampSignature(context.Background(), der, newTestTSA(t))
+	if err != nil {
+		t.Fatalf("TimestampSignature: %v", err)
+	}
+	sig, err := ParseCMSSignature(stamped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sig.Verify(digest[:]); err != nil {
+		t.Fatalf("signature no longer verifies: %v", err)
+	}
+	tok, err := sig.SignatureTimestamp()
+	if err != nil || tok == nil {
+		t.Fatalf("SignatureTimestamp = %v, %v", tok, err)
+	}
+	if err := sig.VerifySignatureTimestamp(tok); err != nil {
+		t.Fatalf("VerifySignatureTimestamp: %v", err)
+	}
+}
@@ -0,0 +1,795 @@
+package validation
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/wudi/pdfkit/filters"
+	"github.com/wudi/pdfkit/internal/pdftext"
+	"github.com/wudi/pdfkit/ir/raw"
+	"github.com/wudi/pdfkit/parser"
+	"github.com/wudi/pdfkit/security"
+	"github.com/wudi/pdfkit/xref"
+)
+
+// ChangeKind classifies an object added or replaced after a signature.
+type ChangeKind int
+
+const (
+	ChangeOther ChangeKind = iota
+	ChangeSignature
+	ChangeDSS
+	ChangeFormFill
+	ChangeAnnotation
+	ChangeMetadata
+	ChangePage
+	ChangeCatalog
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeSignature:
+		return "signature"
+	case ChangeDSS:
+		return "dss"
+	case ChangeFormFill:
+		return "form-fill"
+	case ChangeAnnotation:
+		return "annotation"
+	case ChangeMetadata:
+		return "metadata"
+	case ChangePage:
+		return "page"
+	case ChangeCatalog:
+		return "catalog"
+	default:
+		return "other"
+	}
+}
+
+// Change is an object written by an incremental update after the signed revision.
+type Change struct {
+	Ref  raw.ObjectRef
+	Kind ChangeKind
+}
+
+// RevocationSource records where a revocation status came from.
+type RevocationSource int
+
+const (
+	RevocationNone RevocationSource = iota
+	RevocationEmbeddedOCSP
+	RevocationEmbeddedCRL
+	RevocationOnline
+)
+
+// RevocationResult is the revocation status of one non-root chain certificate.
+type RevocationResult struct {
+	Cert   *x509.Certificate
+	Status RevocationStatus
+	Source RevocationSource
+	Err    error
+}
+
+// SignatureReport describes the verification outcome of one signature.
+type SignatureReport struct {
+	FieldName   string
+	Ref         raw.ObjectRef
+	SubFilter   string
+	Name        string
+	Reason      string
+	Location    string
+	ContactInfo string
+	// SigningTime is the CMS signingTime attribute, falling back to /M;
+	// for document timestamps it is the token's genTime.
+	SigningTime time.Time
+	ByteRange   []int64
+	// CoversWholeFile is true when the ByteRange extends to the end of the file.
+	CoversWholeFile bool
+
+	IntegrityValid bool
+	IntegrityError error
+
+	// Timestamp is the signature timestamp token or, for document
+	// timestamps (SubFilter ETSI.RFC3161), the token itself.
+	Timestamp      *security.TimestampToken
+	TimestampValid bool
+	TimestampError error
+
+	Signer       *x509.Certificate
+	Certificates []*x509.Certificate
+	Chain        []*x509.Certificate
+	ChainValid   bool
+	ChainError   error
+	Revocation   []RevocationResult
+
+	ModifiedAfterSigning bool
+	Changes              []Change
+
+	// Errors collects problems that did not prevent verification, such as
+	// an unreadable DSS or an unparsable signed revision.
+	Errors []error
+}
+
+// Valid reports whether the signature is intact, chains to a trusted root
+// and no chain certificate is known to be revoked.
+func (r *SignatureReport) Valid() bool {
+	if !r.IntegrityValid || !r.ChainValid {
+		return false
+	}
+	for _, rev := range r.Revocation {
+		if rev.Status == StatusRevoked {
+			return false
+		}
+	}
+	return true
+}
+
+// SignatureVerifier verifies the digital signatures of a PDF.
+type SignatureVerifier struct {
+	// Roots are the trust anchors; without them chains are never valid.
+	Roots *x509.CertPool
+	// Intermediates supplements the certificates embedded in the signature.
+	Intermediates []*x509.Certificate
+	ChainBuilder  ChainBuilder
+	// Revocation is consulted when no embedded OCSP response or CRL
+	// decides a certificate's status. Nil disables online checks.
+	Revocation RevocationChecker
+	// ValidationTime is the time embedded OCSP responses and CRLs must be
+	// current at; zero means the time of the Verify call.
+	ValidationTime time.Time
+}
+
+func NewSignatureVerifier(roots *x509.CertPool) *SignatureVerifier {
+	return &SignatureVerifier{
+		Roots:        roots,
+		ChainBuilder: NewChainBuilder(),
+	}
+}
+
+// Verify checks every signature in the document, ordered by the revision
+// each one signs.
+func (v *SignatureVerifier) Verify(ctx context.Context, r io.ReaderAt, size int64) ([]SignatureReport, error) {
+	full := io.NewSectionReader(r, 0, size)
+	p := parser.NewDocumentParser(parser.Config{})
+	p.SetLazy(true, 0)
+	doc, err := p.Parse(ctx, full)
+	if err != nil {
+		return nil, fmt.Errorf("parse document: %w", err)
+	}
+
+	sigs := findSignatures(doc)
+	dss := loadDSS(ctx, doc)
+
+	reports := make([]SignatureReport, 0, len(sigs))
+	for _, s := range sigs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		reports = append(reports, v.verifyOne(ctx, r, size, doc, s, dss))
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		return rangeEnd(reports[i].ByteRange) < rangeEnd(reports[j].ByteRange)
+	})
+	return reports, nil
+}
+
+type sigField struct {
+	name string
+	ref  raw.ObjectRef
+	dict *raw.DictObj
+}
+
+type dssData struct {
+	certs []*x509.Certificate
+	ocsps [][]byte
+	crls  [][]byte
+}
+
+func (v *SignatureVerifier) verifyOne(ctx context.Context, r io.ReaderAt, size int64, doc *raw.Document, s sigField, dss dssData) SignatureReport {
+	rep := SignatureReport{FieldName: s.name, Ref: s.ref}
+	rep.SubFilter = nameValue(s.dict, "SubFilter")
+	rep.Name = textValue(s.dict, "Name")
+	rep.Reason = textValue(s.dict, "Reason")
+	rep.Location = textValue(s.dict, "Location")
+	rep.ContactInfo = textValue(s.dict, "ContactInfo")
+	if t, ok := raw.ParseDate(textValue(s.dict, "M")); ok {
+		rep.SigningTime = t
+	}
+
+	br, err := byteRange(s.dict, size)
+	if err != nil {
+		rep.IntegrityError = err
+		return rep
+	}
+	rep.ByteRange = br
+	end := br[2] + br[3]
+	rep.CoversWholeFile = end == size
+	rep.ModifiedAfterSigning = !rep.CoversWholeFile
+
+	contents, _ := resolve(doc, dictGet(s.dict, "Contents")).(raw.StringObj)
+	if err := checkGap(r, br, contents.Value()); err != nil {
+		rep.IntegrityError = err
+		return rep
+	}
+	var cms *security.CMSSignature
+	if rep.SubFilter == subFilterDocTimestamp {
+		cms = verifyDocTimestamp(r, &rep, contents.Value())
+	} else {
+		cms = verifySignature(r, &rep, contents.Value())
+	}
+	if cms == nil {
+		return rep
+	}
+
+	if cms.Signer != nil {
+		v.checkChain(ctx, &rep, cms, dss)
+	}
+	if rep.ModifiedAfterSigning {
+		changes, err := changesSince(ctx, r, size, end, doc)
+		if err != nil {
+			rep.Errors = append(rep.Errors, err)
+		}
+		rep.Changes = changes
+	}
+	return rep
+}
+
+const subFilterDocTimestamp = "ETSI.RFC3161"
+
+// verifySignature checks a CMS signature and its optional signature
+// timestamp, returning nil when the CMS cannot be parsed.
+func verifySignature(r io.ReaderAt, rep *SignatureReport, contents []byte) *security.CMSSignature {
+	cms, err := security.ParseCMSSignature(contents)
+	if err != nil {
+		rep.IntegrityError = err
+		return nil
+	}
+	rep.Signer = cms.Signer
+	rep.Certificates = cms.Certificates
+	if !cms.SigningTime.IsZero() {
+		rep.SigningTime = cms.SigningTime
+	}
+
+	digest, err := hashRanges(r, rep.ByteRange, cms.DigestAlgorithm)
+	if err != nil {
+		rep.IntegrityError = err
+		return cms
+	}
+	if err := cms.Verify(digest); err != nil {
+		rep.IntegrityError = err
+	} else if cms.HasSigningCertificate && !cms.SigningCertificateValid {
+		rep.IntegrityError = errors.New("signing certificate attribute does not match signer")
+	} else {
+		rep.IntegrityValid = true
+	}
+
+	tok, err := cms.SignatureTimestamp()
+	if err == nil && tok != nil {
+		err = cms.VerifySignatureTimestamp(tok)
+	}
+	rep.Timestamp = tok
+	rep.TimestampError = err
+	rep.TimestampValid = tok != nil && err == nil
+	return cms
+}
+
+// verifyDocTimestamp checks a document timestamp, whose contents are an
+// RFC 3161 token over the ByteRange digest.
+func verifyDocTimestamp(r io.ReaderAt, rep *SignatureReport, contents []byte) *security.CMSSignature {
+	tok, err := security.ParseTimestampToken(contents)
+	if err != nil {
+		rep.IntegrityError = err
+		return nil
+	}
+	rep.Timestamp = tok
+	rep.Signer = tok.CMS.Signer
+	rep.Certificates = tok.CMS.Certificates
+	rep.SigningTime = tok.GenTime
+
+	digest, err := hashRanges(r, rep.ByteRange, tok.HashAlgorithm)
+	if err == nil {
+		err = tok.Verify(digest)
+	}
+	rep.IntegrityError = err
+	rep.IntegrityValid = err == nil
+	rep.TimestampError = err
+	rep.TimestampValid = err == nil
+	return tok.CMS
+}
+
+func hashRanges(r io.ReaderAt, br []int64, hash crypto.Hash) ([]byte, error) {
+	h := hash.New()
+	for _, rg := range [][2]int64{{br[0], br[1]}, {br[2], br[3]}} {
+		if _, err := io.Copy(h, io.NewSectionReader(r, rg[0], rg[1])); err != nil {
+			return nil, fmt.Errorf("read signed range: %w", err)
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+func (v *SignatureVerifier) checkChain(ctx context.Context, rep *SignatureReport, cms *security.CMSSignature, dss dssData) {
+	if v.Roots == nil {
+		rep.ChainError = errors.New("no trust roots configured")
+		return
+	}
+	builder := v.ChainBuilder
+	if builder == nil {
+		builder = NewChainBuilder()
+	}
+	var intermediates []*x509.Certificate
+	intermediates = append(intermediates, cms.Certificates[1:]...)
+	intermediates = append(intermediates, v.Intermediates...)
+	intermediates = append(intermediates, dss.certs...)
+	chains, err := builder.BuildChain(cms.Signer, intermediates, v.Roots)
+	if err != nil {
+		rep.ChainError = err
+		return
+	}
+	if len(chains) == 0 {
+		rep.ChainError = errors.New("no certificate chain found")
+		return
+	}
+	rep.Chain = chains[0]
+	rep.ChainValid = true
+
+	ocsps := append(append([][]byte(nil), cms.OCSPs...), dss.ocsps...)
+	crls := append(append([][]byte(nil), cms.CRLs...), dss.crls...)
+	at := v.ValidationTime
+	if at.IsZero() {
+		at = time.Now()
+	}
+	for i := 0; i+1 < len(rep.Chain); i++ {
+		cert, issuer := rep.Chain[i], rep.Chain[i+1]
+		res := embeddedRevocation(cert, issuer, ocsps, crls, at)
+		if res.Source == RevocationNone && v.Revocation != nil {
+			res.Status, res.Err = v.Revocation.Check(ctx, cert, issuer)
+			res.Source = RevocationOnline
+		}
+		rep.Revocation = append(rep.Revocation, res)
+	}
+}
+
+// embeddedRevocation looks up cert in OCSP responses and CRLs signed by
+// issuer. Revocations are reported whenever they were published; a good
+// status only counts from responses and CRLs still current at time at, so
+// a stale one leaves the status unknown.
+func embeddedRevocation(cert, issuer *x509.Certificate, ocsps, crls [][]byte, at time.Time) RevocationResult {
+	res := RevocationResult{Cert: cert, Status: StatusUnknown}
+	for _, der := range ocsps {
+		resp, err := ocsp.ParseResponseForCert(der, cert, issuer)
+		if err != nil {
+			continue
+		}
+		switch resp.Status {
+		case ocsp.Good:
+			if !current(resp.NextUpdate, at) {
+				res.Err = fmt.Errorf("embedded OCSP response not current at %s", at.Format(time.RFC3339))
+				continue
+			}
+			res.Status, res.Source, res.Err = StatusGood, RevocationEmbeddedOCSP, nil
+			return res
+		case ocsp.Revoked:
+			res.Status, res.Source, res.Err = StatusRevoked, RevocationEmbeddedOCSP, nil
+			return res
+		}
+	}
+	for _, der := range crls {
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil || !bytes.Equal(crl.RawIssuer, issuer.RawSubject) {
+			continue
+		}
+		if err := crl.CheckSignatureFrom(issuer); err != nil {
+			continue
+		}
+		for _, revoked := range crl.RevokedCertificateEntries {
+			if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				res.Status, res.Source, res.Err = StatusRevoked, RevocationEmbeddedCRL, nil
+				return res
+			}
+		}
+		if !current(crl.NextUpdate, at) {
+			res.Err = fmt.Errorf("embedded CRL not current at %s", at.Format(time.RFC3339))
+			continue
+		}
+		res.Status, res.Source, res.Err = StatusGood, RevocationEmbeddedCRL, nil
+		return res
+	}
+	return res
+}
+
+// current reports whether revocation information valid until nextUpdate,
+// zero if unbounded, still applies at time at.
+func current(nextUpdate, at time.Time) bool {
+	return nextUpdate.IsZero() || !nextUpdate.Before(at)
+}
+
+// findSignatures collects signature dictionaries reachable from AcroForm
+// fields plus any /Sig dictionaries not attached to a field.
+func findSignatures(doc *raw.Document) []sigField {
+	var out []sigField
+	seen := make(map[raw.ObjectRef]bool)
+	if catalog := catalogDict(doc); catalog != nil {
+		if form, ok := resolve(doc, dictGet(catalog, "AcroForm")).(*raw.DictObj); ok {
+			if fields, ok := resolve(doc, dictGet(form, "Fields")).(*raw.ArrayObj); ok {
+				for _, f := range fields.Items {
+					walkFields(doc, f, "", "", seen, &out, 0)
+				}
+			}
+		}
+	}
+	for _, ref := range doc.Refs() {
+		if seen[ref] {
+			continue
+		}
+		obj, ok := doc.Get(ref)
+		if !ok {
+			continue
+		}
+		if d, ok := obj.(*raw.DictObj); ok && isSignatureDict(d) {
+			seen[ref] = true
+			out = append(out, sigField{ref: ref, dict: d})
+		}
+	}
+	return out
+}
+
+const maxFieldDepth = 32
+
+func walkFields(doc *raw.Document, obj raw.Object, parent, ft string, seen map[raw.ObjectRef]bool, out *[]sigField, depth int) {
+	if depth > maxFieldDepth {
+		return
+	}
+	field, ok := resolve(doc, obj).(*raw.DictObj)
+	if !ok {
+		return
+	}
+	name := parent
+	if t := textValue(field, "T"); t != "" {
+		if name != "" {
+			name += "."
+		}
+		name += t
+	}
+	if n := nameValue(field, "FT"); n != "" {
+		ft = n
+	}
+	if kids, ok := resolve(doc, dictGet(field, "Kids")).(*raw.ArrayObj); ok {
+		for _, k := range kids.Items {
+			walkFields(doc, k, name, ft, seen, out, depth+1)
+		}
+	}
+	if ft != "Sig" {
+		return
+	}
+	ref, isRef := dictGet(field, "V").(raw.RefObj)
+	sig, ok := resolve(doc, dictGet(field, "V")).(*raw.DictObj)
+	if !ok || !isRef || seen[ref.R] {
+		return
+	}
+	seen[ref.R] = true
+	*out = append(*out, sigField{name: name, ref: ref.R, dict: sig})
+}
+
+func isSignatureDict(d *raw.DictObj) bool {
+	switch nameValue(d, "Type") {
+	case "Sig", "DocTimeStamp":
+	default:
+		return false
+	}
+	_, hasRange := d.Get(raw.NameLiteral("ByteRange"))
+	_, hasContents := d.Get(raw.NameLiteral("Contents"))
+	return hasRange && hasContents
+}
+
+func byteRange(sig *raw.DictObj, size int64) ([]int64, error) {
+	arr, ok := dictGet(sig, "ByteRange").(*raw.ArrayObj)
+	if !ok || len(arr.Items) != 4 {
+		return nil, errors.New("ByteRange must hold four integers")
+	}
+	br := make([]int64, 4)
+	for i, it := range arr.Items {
+		n, ok := it.(raw.NumberObj)
+		if !ok || !n.IsInt || n.Int() < 0 {
+			return nil, errors.New("ByteRange must hold four integers")
+		}
+		br[i] = n.Int()
+	}
+	if br[0] != 0 {
+		return nil, errors.New("ByteRange does not start at the beginning of the file")
+	}
+	// Compare each bound separately; large offsets would overflow a sum.
+	if br[1] > br[2] || br[2] > size || br[3] > size-br[2] {
+		return nil, fmt.Errorf("ByteRange %v out of bounds", br)
+	}
+	return br, nil
+}
+
+// checkGap ensures the bytes excluded by the ByteRange are exactly the
+// hex-encoded /Contents value, so nothing else escapes the signature.
+func checkGap(r io.ReaderAt, br []int64, contents []byte) error {
+	gap := make([]byte, br[2]-br[1])
+	if _, err := r.ReadAt(gap, br[1]); err != nil {
+		return fmt.Errorf("read signature contents: %w", err)
+	}
+	gap = bytes.TrimPrefix(gap, []byte("<"))
+	gap = bytes.TrimSuffix(gap, []byte(">"))
+	decoded := make([]byte, hex.DecodedLen(len(gap)))
+	if _, err := hex.Decode(decoded, gap); err != nil {
+		return errors.New("ByteRange gap is not the signature contents")
+	}
+	if !bytes.Equal(decoded, contents) {
+		return errors.New("ByteRange gap does not match /Contents")
+	}
+	return nil
+}
+
+// changesSince lists objects whose xref entry differs between the revision
+// ending at end and the complete file.
+func changesSince(ctx context.Context, r io.ReaderAt, size, end int64, doc *raw.Document) ([]Change, error) {
+	after, err := xref.NewResolver(xref.ResolverConfig{}).Resolve(ctx, io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, fmt.Errorf("resolve xref: %w", err)
+	}
+	before, err := xref.NewResolver(xref.ResolverConfig{}).Resolve(ctx, io.NewSectionReader(r, 0, end))
+	if err != nil {
+		return nil, fmt.Errorf("resolve signed revision xref: %w", err)
+	}
+	dssRefs := dssObjects(doc)
+	var changes []Change
+	for _, num := range after.Objects() {
+		if sameEntry(before, after, num) {
+			continue
+		}
+		off, gen, found := after.Lookup(num)
+		if found && off == 0 && gen >= 65535 {
+			continue // free entry
+		}
+		ref := raw.ObjectRef{Num: num, Gen: gen}
+		obj, ok := doc.Get(ref)
+		if !ok {
+			continue
+		}
+		kind, skip := classifyChange(obj, dssRefs[ref])
+		if skip {
+			continue
+		}
+		changes = append(changes, Change{Ref: ref, Kind: kind})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Ref.Num < changes[j].Ref.Num })
+	return changes, nil
+}
+
+func sameEntry(before, after xref.Table, num int) bool {
+	aOff, aGen, aFound := after.Lookup(num)
+	bOff, bGen, bFound := before.Lookup(num)
+	if aFound || bFound {
+		return aFound == bFound && aOff == bOff && aGen == bGen
+	}
+	aStm, aIdx, aOK := after.ObjStream(num)
+	bStm, bIdx, bOK := before.ObjStream(num)
+	if aOK != bOK || aIdx != bIdx {
+		return false
+	}
+	// A rewritten object stream at a new offset replaces its members.
+	return aStm == bStm && sameEntry(before, after, aStm)
+}
+
+// classifyChange returns the kind of a changed object; skip is true for
+// cross-reference and object streams, which carry no document content.
+func classifyChange(obj raw.Object, inDSS bool) (kind ChangeKind, skip bool) {
+	var d *raw.DictObj
+	switch o := obj.(type) {
+	case *raw.DictObj:
+		d = o
+	case *raw.StreamObj:
+		d = o.Dict
+	}
+	if inDSS {
+		return ChangeDSS, false
+	}
+	if d == nil {
+		return ChangeOther, false
+	}
+	switch nameValue(d, "Type") {
+	case "XRef", "ObjStm":
+		return ChangeOther, true
+	case "Sig", "DocTimeStamp":
+		return ChangeSignature, false
+	case "DSS", "VRI":
+		return ChangeDSS, false
+	case "Metadata":
+		return ChangeMetadata, false
+	case "Page", "Pages":
+		return ChangePage, false
+	case "Catalog":
+		return ChangeCatalog, false
+	case "Annot":
+		if nameValue(d, "Subtype") == "Widget" {
+			return ChangeFormFill, false
+		}
+		return ChangeAnnotation, false
+	}
+	if _, ok := d.Get(raw.NameLiteral("FT")); ok {
+		return ChangeFormFill, false
+	}
+	if _, ok := d.Get(raw.NameLiteral("Parent")); ok {
+		if _, ok := d.Get(raw.NameLiteral("T")); ok {
+			return ChangeFormFill, false
+		}
+	}
+	if _, ok := d.Get(raw.NameLiteral("Subtype")); ok {
+		if _, ok := d.Get(raw.NameLiteral("Rect")); ok {
+			return ChangeAnnotation, false
+		}
+	}
+	return ChangeOther, false
+}
+
+// dssObjects returns the DSS dictionary and every object it references directly.
+func dssObjects(doc *raw.Document) map[raw.ObjectRef]bool {
+	refs := make(map[raw.ObjectRef]bool)
+	catalog := catalogDict(doc)
+	if catalog == nil {
+		return refs
+	}
+	dssObj := dictGet(catalog, "DSS")
+	if ref, ok := dssObj.(raw.RefObj); ok {
+		refs[ref.R] = true
+	}
+	dss, ok := resolve(doc, dssObj).(*raw.DictObj)
+	if !ok {
+		return refs
+	}
+	for _, key := range []string{"Certs", "OCSPs", "CRLs", "VRI"} {
+		v := dictGet(dss, key)
+		if ref, ok := v.(raw.RefObj); ok {
+			refs[ref.R] = true
+		}
+		switch c := resolve(doc, v).(type) {
+		case *raw.ArrayObj:
+			for _, it := range c.Items {
+				if ref, ok := it.(raw.RefObj); ok {
+					refs[ref.R] = true
+				}
+			}
+		case *raw.DictObj:
+			for _, k := range c.Keys() {
+				if ref, ok := dictGet(c, k.Value()).(raw.RefObj); ok {
+					refs[ref.R] = true
+				}
+			}
+		}
+	}
+	return refs
+}
+
+func loadDSS(ctx context.Context, doc *raw.Document) dssData {
+	var data dssData
+	catalog := catalogDict(doc)
+	if catalog == nil {
+		return data
+	}
+	dss, ok := resolve(doc, dictGet(catalog, "DSS")).(*raw.DictObj)
+	if !ok {
+		return data
+	}
+	streams := func(key string) [][]byte {
+		arr, ok := resolve(doc, dictGet(dss, key)).(*raw.ArrayObj)
+		if !ok {
+			return nil
+		}
+		var out [][]byte
+		for _, it := range arr.Items {
+			st, ok := resolve(doc, it).(*raw.StreamObj)
+			if !ok {
+				continue
+			}
+			if b, err := streamData(ctx, st); err == nil {
+				out = append(out, b)
+			}
+		}
+		return out
+	}
+	for _, der := range streams("Certs") {
+		if cert, err := x509.ParseCertificate(der); err == nil {
+			data.certs = append(data.certs, cert)
+		}
+	}
+	data.ocsps = streams("OCSPs")
+	data.crls = streams("CRLs")
+	return data
+}
+
+func streamData(ctx context.Context, st *raw.StreamObj) ([]byte, error) {
+	var names []string
+	var params []raw.Dictionary
+	switch f := dictGet(st.Dict, "Filter").(type) {
+	case raw.NameObj:
+		names = []string{f.Val}
+	case *raw.ArrayObj:
+		for _, it := range f.Items {
+			if n, ok := it.(raw.NameObj); ok {
+				names = append(names, n.Val)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return st.RawData(), nil
+	}
+	if dp, ok := dictGet(st.Dict, "DecodeParms").(*raw.DictObj); ok {
+		params = append(params, dp)
+	}
+	p := filters.NewPipeline([]filters.Decoder{
+		filters.NewFlateDecoder(),
+		filters.NewLZWDecoder(),
+		filters.NewASCII85Decoder(),
+		filters.NewASCIIHexDecoder(),
+	}, filters.Limits{})
+	return p.Decode(ctx, st.RawData(), names, params)
+}
+
+func catalogDict(doc *raw.Document) *raw.DictObj {
+	if doc.Trailer == nil {
+		return nil
+	}
+	root, ok := doc.Trailer.Get(raw.NameLiteral("Root"))
+	if !ok {
+		return nil
+	}
+	catalog, _ := resolve(doc, root).(*raw.DictObj)
+	return catalog
+}
+
+func resolve(doc *raw.Document, obj raw.Object) raw.Object {
+	for i := 0; i < maxFieldDepth; i++ {
+		ref, ok := obj.(raw.RefObj)
+		if !ok {
+			return obj
+		}
+		next, ok := doc.Get(ref.R)
+		if !ok {
+			return nil
+		}
+		obj = next
+	}
+	return nil
+}
+
+func dictGet(d *raw.DictObj, key string) raw.Object {
+	if d == nil {
+		return nil
+	}
+	v, _ := d.Get(raw.NameLiteral(key))
+	return v
+}
+
+func nameValue(d *raw.DictObj, key string) string {
+	n, _ := dictGet(d, key).(raw.NameObj)
+	return n.Val
+}
+
+func textValue(d *raw.DictObj, key string) string {
+	s, ok := dictGet(d, key).(raw.StringObj)
+	if !ok {
+		return ""
+	}
+	return pdftext.Decode(s.Value())
+}
+
+func rangeEnd(br []int64) int64 {
+	if len(br) != 4 {
+		return 0
+	}
+	return br[2] + br[3]
+}
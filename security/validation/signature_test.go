@@ -0,0 +1,387 @@
+package validation
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/ir/raw"
+	"github.com/wudi/pdfkit/security"
+	"github.com/wudi/pdfkit/writer"
+)
+
+type testPKI struct {
+	ca, leaf *x509.Certificate
+	caKey    *rsa.PrivateKey
+	leafKey  *rsa.PrivateKey
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	leafKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "Test Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, ca, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(leafDER)
+	return testPKI{ca: ca, leaf: leaf, caKey: caKey, leafKey: leafKey}
+}
+
+func signedPDF(t *testing.T, pki testPKI) []byte {
+	t.Helper()
+	return signPDF(t, security.NewRSASigner(pki.leafKey, []*x509.Certificate{pki.leaf, pki.ca}), true)
+}
+
+func signPDF(t *testing.T, signer security.Signer, pades bool) []byte {
+	t.Helper()
+	b := builder.NewBuilder()
+	b.NewPage(612, 792).DrawText("Signed", 100, 700, builder.TextOptions{FontSize: 12}).Finish()
+	doc, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writer.NewWriter().Write(context.Background(), doc, &buf, writer.Config{Version: writer.PDF17}); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = writer.Sign(context.Background(), bytes.NewReader(buf.Bytes()), int64(buf.Len()), &out, signer, writer.SignConfig{
+		Reason:   "Approval",
+		Location: "Lab",
+		PAdES:    pades,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func verify(t *testing.T, v *SignatureVerifier, data []byte) SignatureReport {
+	t.Helper()
+	reports, err := v.Verify(context.Background(), bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("reports = %d, want 1", len(reports))
+	}
+	return reports[0]
+}
+
+func TestSignatureVerifierValid(t *testing.T) {
+	pki := newTestPKI(t)
+	data := signedPDF(t, pki)
+	roots := x509.NewCertPool()
+	roots.AddCert(pki.ca)
+
+	rep := verify(t, NewSignatureVerifier(roots), data)
+	if !rep.IntegrityValid {
+		t.Fatalf("integrity: %v", rep.IntegrityError)
+	}
+	if !rep.ChainValid || len(rep.Chain) != 2 {
+		t.Fatalf("chain valid=%v len=%d err=%v", rep.ChainValid, len(rep.Chain), rep.ChainError)
+	}
+	if !rep.Valid() {
+		t.Fatal("report should be valid")
+	}
+	if rep.Signer == nil || rep.Signer.Subject.CommonName != "Test Signer" {
+		t.Fatalf("signer = %v", rep.Signer)
+	}
+	if rep.SubFilter != "ETSI.CAdES.detached" || rep.Reason != "Approval" || rep.Location != "Lab" {
+		t.Fatalf("dictionary fields = %q %q %q", rep.SubFilter, rep.Reason, rep.Location)
+	}
+	if rep.SigningTime.IsZero() {
+		t.Fatal("signing time missing")
+	}
+	if !rep.CoversWholeFile || rep.ModifiedAfterSigning {
+		t.Fatalf("coverage whole=%v modified=%v", rep.CoversWholeFile, rep.ModifiedAfterSigning)
+	}
+	if len(rep.Revocation) != 1 || rep.Revocation[0].Status != StatusUnknown || rep.Revocation[0].Source != RevocationNone {
+		t.Fatalf("revocation = %+v", rep.Revocation)
+	}
+
+	// An untrusted root leaves integrity intact but fails the chain.
+	rep = verify(t, NewSignatureVerifier(x509.NewCertPool()), data)
+	if !rep.IntegrityValid || rep.ChainValid || rep.ChainError == nil {
+		t.Fatalf("untrusted: integrity=%v chain=%v", rep.IntegrityValid, rep.ChainValid)
+	}
+}
+
+func TestSignatureVerifierECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(5),
+		Subject:      pkix.Name{CommonName: "EC Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	signer, err := security.NewECDSASigner(key, []*x509.Certificate{cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := signPDF(t, signer, false)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	rep := verify(t, NewSignatureVerifier(roots), data)
+	if !rep.Valid() {
+		t.Fatalf("integrity=%v chain=%v", rep.IntegrityError, rep.ChainError)
+	}
+	if rep.SubFilter != "adbe.pkcs7.detached" {
+		t.Fatalf("subfilter = %q", rep.SubFilter)
+	}
+}
+
+func TestSignatureVerifierTampered(t *testing.T) {
+	pki := newTestPKI(t)
+	data := signedPDF(t, pki)
+	idx := bytes.Index(data, []byte("Signed"))
+	if idx < 0 {
+		t.Skip("page content is compressed")
+	}
+	data[idx] = 'X'
+	rep := verify(t, NewSignatureVerifier(nil), data)
+	if rep.IntegrityValid || rep.IntegrityError == nil {
+		t.Fatal("tampered document should fail integrity")
+	}
+}
+
+func TestByteRangeBounds(t *testing.T) {
+	const size = 100
+	for _, tc := range []struct {
+		br []int64
+		ok bool
+	}{
+		{[]int64{0, 10, 20, 80}, true},
+		{[]int64{0, 10, 20, 81}, false},
+		{[]int64{0, 30, 20, 10}, false},
+		{[]int64{0, 10, 101, 0}, false},
+		{[]int64{0, 10, 4611686018427387904, 4611686018427387904}, false},
+		{[]int64{0, 10, 20, 9223372036854775807}, false},
+	} {
+		sig := raw.Dict()
+		arr := raw.NewArray()
+		for _, n := range tc.br {
+			arr.Items = append(arr.Items, raw.NumberInt(n))
+		}
+		sig.Set(raw.NameLiteral("ByteRange"), arr)
+		if _, err := byteRange(sig, size); (err == nil) != tc.ok {
+			t.Errorf("ByteRange %v: err = %v", tc.br, err)
+		}
+	}
+}
+
+// withCRL signs crl with the test CA and adds it to the DSS of data in an
+// incremental update.
+func withCRL(t *testing.T, pki testPKI, data []byte, crl *x509.RevocationList) []byte {
+	t.Helper()
+	crlDER, err := x509.CreateRevocationList(rand.Reader, crl, pki.ca, pki.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = writer.AddLTV(context.Background(), bytes.NewReader(data), int64(len(data)), &out, security.LTVData{
+		Certs: [][]byte{pki.ca.Raw},
+		CRLs:  [][]byte{crlDER},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestSignatureVerifierIncrementalUpdate(t *testing.T) {
+	pki := newTestPKI(t)
+	data := withCRL(t, pki, signedPDF(t, pki), &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: pki.leaf.SerialNumber, RevocationTime: time.Now()},
+		},
+	})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(pki.ca)
+	rep := verify(t, NewSignatureVerifier(roots), data)
+	if !rep.IntegrityValid {
+		t.Fatalf("integrity: %v", rep.IntegrityError)
+	}
+	if rep.CoversWholeFile || !rep.ModifiedAfterSigning {
+		t.Fatal("update after signing not detected")
+	}
+	kinds := make(map[ChangeKind]int)
+	for _, c := range rep.Changes {
+		kinds[c.Kind]++
+	}
+	if kinds[ChangeDSS] != 3 || kinds[ChangeCatalog] != 1 || len(kinds) != 2 {
+		t.Fatalf("changes = %v", rep.Changes)
+	}
+	if len(rep.Revocation) != 1 || rep.Revocation[0].Status != StatusRevoked || rep.Revocation[0].Source != RevocationEmbeddedCRL {
+		t.Fatalf("revocation = %+v", rep.Revocation)
+	}
+	if rep.Valid() {
+		t.Fatal("revoked signer should not be valid")
+	}
+}
+
+func TestSignatureVerifierEmbeddedCRLFreshness(t *testing.T) {
+	pki := newTestPKI(t)
+	data := withCRL(t, pki, signedPDF(t, pki), &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-2 * time.Hour),
+		NextUpdate: time.Now().Add(-time.Hour),
+	})
+	roots := x509.NewCertPool()
+	roots.AddCert(pki.ca)
+
+	// The CRL expired an hour ago: it no longer shows the signer is good.
+	rep := verify(t, NewSignatureVerifier(roots), data)
+	if len(rep.Revocation) != 1 || rep.Revocation[0].Status != StatusUnknown || rep.Revocation[0].Source != RevocationNone || rep.Revocation[0].Err == nil {
+		t.Fatalf("stale CRL: revocation = %+v", rep.Revocation)
+	}
+
+	// At a time it was current it does.
+	v := NewSignatureVerifier(roots)
+	v.ValidationTime = time.Now().Add(-90 * time.Minute)
+	rep = verify(t, v, data)
+	if len(rep.Revocation) != 1 || rep.Revocation[0].Status != StatusGood || rep.Revocation[0].Source != RevocationEmbeddedCRL {
+		t.Fatalf("current CRL: revocation = %+v", rep.Revocation)
+	}
+}
+
+func newTestTSA(t *testing.T, pki testPKI) *security.LocalTSA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(77),
+		Subject:      pkix.Name{CommonName: "Test TSA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, pki.ca, &key.PublicKey, pki.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	tsa := security.NewLocalTSA(key, cert)
+	tsa.Chain = []*x509.Certificate{pki.ca}
+	return tsa
+}
+
+func TestSignatureVerifierTimestamps(t *testing.T) {
+	ctx := context.Background()
+	pki := newTestPKI(t)
+	tsa := newTestTSA(t, pki)
+
+	b := builder.NewBuilder()
+	b.NewPage(200, 200).Finish()
+	doc, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plain, signed, ltv, archived bytes.Buffer
+	if err := writer.NewWriter().Write(ctx, doc, &plain, writer.Config{Version: writer.PDF17}); err != nil {
+		t.Fatal(err)
+	}
+	signer := security.NewRSASigner(pki.leafKey, []*x509.Certificate{pki.leaf, pki.ca})
+	err = writer.Sign(ctx, bytes.NewReader(plain.Bytes()), int64(plain.Len()), &signed, signer, writer.SignConfig{PAdES: true, Timestamp: tsa})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	err = writer.AddLTV(ctx, bytes.NewReader(signed.Bytes()), int64(signed.Len()), &ltv, security.LTVData{Certs: [][]byte{pki.ca.Raw}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.AddDocumentTimestamp(ctx, bytes.NewReader(ltv.Bytes()), int64(ltv.Len()), &archived, tsa)
+	if err != nil {
+		t.Fatalf("AddDocumentTimestamp: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(pki.ca)
+	data := archived.Bytes()
+	reports, err := NewSignatureVerifier(roots).Verify(ctx, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("reports = %d", len(reports))
+	}
+	sig, ts := reports[0], reports[1]
+	if !sig.Valid() || !sig.TimestampValid || sig.Timestamp == nil {
+		t.Fatalf("signature: integrity=%v chain=%v timestamp=%v", sig.IntegrityError, sig.ChainError, sig.TimestampError)
+	}
+	if !sig.ModifiedAfterSigning {
+		t.Fatal("signature should report later revisions")
+	}
+	kinds := make(map[ChangeKind]bool)
+	for _, c := range sig.Changes {
+		kinds[c.Kind] = true
+	}
+	if !kinds[ChangeDSS] || !kinds[ChangeSignature] {
+		t.Fatalf("changes = %v", sig.Changes)
+	}
+
+	if ts.SubFilter != "ETSI.RFC3161" || !ts.CoversWholeFile {
+		t.Fatalf("document timestamp = %q whole=%v", ts.SubFilter, ts.CoversWholeFile)
+	}
+	if !ts.Valid() || !ts.TimestampValid {
+		t.Fatalf("document timestamp: integrity=%v chain=%v", ts.IntegrityError, ts.ChainError)
+	}
+	if ts.Signer.Subject.CommonName != "Test TSA" || !ts.SigningTime.Equal(ts.Timestamp.GenTime) {
+		t.Fatalf("document timestamp signer=%v time=%v", ts.Signer.Subject, ts.SigningTime)
+	}
+}
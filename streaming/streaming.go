@@ -99,9 +99,9 @@ type DocumentStream interface {
 }
 
 type StreamConfig struct {
-	BufferSize  int
-	ReadAhead   int
-	Concurrency int
+	BufferSize  int // capacity of the Events channel
+	ReadAhead   int // pages decoding or decoded but not yet emitted (min 1)
+	Concurrency int // pages decoded in parallel, at most ReadAhead (min 1)
 }
 
 type Parser interface {
@@ -114,23 +114,33 @@ type ReaderAt interface {
 	ReadAt(p []byte, off int64) (n int, err error)
 }
 
-// NewParser constructs a streaming parser that emits document boundary events.
+// NewParser constructs a streaming parser that walks the page tree through
+// the xref and loads each page's objects on demand.
 func NewParser() Parser {
 	return &parserImpl{
-		rawParser: parser.NewDocumentParser(parser.Config{}),
+		rawParser: parser.NewDocumentParser(parser.Config{Lazy: true, CacheSize: streamCacheSize}),
 	}
 }
 
+// streamCacheSize bounds the raw objects kept between pages. Shared objects
+// such as fonts usually stay hot; page-private objects age out.
+const streamCacheSize = 256
+
 type parserImpl struct {
 	rawParser *parser.DocumentParser
 }
 
-// Stream parses the document once and emits DocumentStart and DocumentEnd
-// events on the returned stream. Call Close to cancel early.
+// Stream opens the document lazily and emits DocumentStart, per-page events
+// and DocumentEnd on the returned stream. At most cfg.ReadAhead pages are
+// held decoded or decoding at once, by up to cfg.Concurrency workers; events
+// are always delivered in page order. Workers share the document's object
+// loader, which reads one object at a time, so Concurrency parallelises
+// stream decoding and content parsing rather than object reads. Call Close
+// to cancel early.
 func (p *parserImpl) Stream(ctx context.Context, r ReaderAt, cfg StreamConfig) (DocumentStream, error) {
 	events := make(chan Event, cfg.BufferSize)
 	errs := make(chan error, 1)
-	cctx, cancel := context.WithCancel(context.Background())
+	cctx, cancel := context.WithCancel(ctx)
 	ds := &documentStream{events: events, errors: errs, cancel: cancel}
 	ds.wg.Add(1)
 	go func() {
@@ -138,16 +148,13 @@ func (p *parserImpl) Stream(ctx context.Context, r ReaderAt, cfg StreamConfig) (
 		defer close(events)
 		defer close(errs)
 
-		select {
-		case <-ctx.Done():
+		if cctx.Err() != nil {
 			return
-		default:
 		}
 
-		// Emit start/end; reuse existing parser to obtain header info.
 		rp := p.rawParser
 		if rp == nil {
-			rp = parser.NewDocumentParser(parser.Config{})
+			rp = parser.NewDocumentParser(parser.Config{Lazy: true, CacheSize: streamCacheSize})
 		}
 		rawDoc, err := rp.Parse(cctx, readerAtAdapter{r})
 		if err != nil {
@@ -159,14 +166,16 @@ func (p *parserImpl) Stream(ctx context.Context, r ReaderAt, cfg StreamConfig) (
 		}
 
 		start := DocumentStartEvent{Version: rawDoc.Version, Encrypted: rawDoc.Encrypted}
-		if sendEvent(ctx, events, start) {
+		if sendEvent(cctx, events, start) {
 			return
 		}
-		emitMetadata(ctx, rawDoc, events)
+		emitMetadata(cctx, rawDoc, events)
 
-		emitPages(ctx, rawDoc, events)
+		if emitPages(cctx, rawDoc, cfg, events) {
+			return
+		}
 
-		sendEvent(ctx, events, DocumentEndEvent{})
+		sendEvent(cctx, events, DocumentEndEvent{})
 	}()
 
 	return ds, nil
@@ -187,131 +196,237 @@ func (ds *documentStream) Close() error {
 	return nil
 }
 
-func emitPages(ctx context.Context, doc *raw.Document, events chan<- Event) {
-	rootObj, ok := doc.Trailer.Get(raw.NameLiteral("Root"))
-	if !ok {
-		return
-	}
-	_, catalog := resolveDict(doc, rootObj)
-	if catalog == nil {
-		return
+// eventSink receives events in order and reports true when the consumer is
+// gone and production should stop.
+type eventSink func(Event) bool
+
+// pageJob is a page decoded ahead of emission. events is valid once done is
+// closed.
+type pageJob struct {
+	done   chan struct{}
+	events []Event
+}
+
+// emitPages walks the page tree and emits each page's events in order. Pages
+// are decoded concurrently up to cfg.Concurrency, and a page holds one of
+// cfg.ReadAhead slots from before it is decoded until its events are out, so
+// no more than ReadAhead pages are in memory at once. It reports true if ctx
+// was canceled.
+func emitPages(ctx context.Context, doc *raw.Document, cfg StreamConfig, events chan<- Event) bool {
+	walker := newPageWalker(doc)
+	if walker == nil {
+		return false
 	}
-	pagesObj, ok := catalog.Get(raw.NameLiteral("Pages"))
-	if !ok {
-		return
+	readAhead := cfg.ReadAhead
+	if readAhead < 1 {
+		readAhead = 1
 	}
-	pagesRef, dict := resolveDict(doc, pagesObj)
-	if dict == nil {
-		return
+	workers := cfg.Concurrency
+	if workers < 1 {
+		workers = 1
 	}
-	pageList := []pageInfo{}
-	walkPages(doc, pagesRef, dict, [4]float64{}, &pageList)
-	for i, page := range pageList {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-		}
-		pageBox := semantic.Rectangle{LLX: page.mediaBox[0], LLY: page.mediaBox[1], URX: page.mediaBox[2], URY: page.mediaBox[3]}
-		if sendEvent(ctx, events, PageStartEvent{Index: i, MediaBox: pageBox}) {
-			return
-		}
-		if res := resourcesFromDict(doc, page.resources); res != nil {
-			emitResourceRefs(ctx, i, res, events)
-		}
-		for _, content := range page.contents {
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	jobs := make(chan *pageJob, readAhead)
+	slots := make(chan struct{}, readAhead)
+	sem := make(chan struct{}, workers)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(jobs)
+		for i := 0; ; i++ {
+			page, ok := walker.next()
+			if !ok {
+				return
+			}
 			select {
+			case slots <- struct{}{}:
 			case <-ctx.Done():
 				return
-			default:
 			}
-			ops := parseOperations(content.data)
-			usage := collectUsage(ops)
-			emitResourceUsage(ctx, i, usage, events)
-			for _, op := range ops {
-				if sendEvent(ctx, events, ContentOperationEvent{PageIndex: i, Operation: op}) {
-					return
-				}
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			job := &pageJob{done: make(chan struct{})}
+			wg.Add(1)
+			go func(index int, page pageInfo) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				defer close(job.done)
+				job.events = decode(ctx, doc, index, page)
+			}(i, page)
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
 			}
 		}
-		emitAnnotations(ctx, doc, page.annots, i, events)
-		if sendEvent(ctx, events, PageEndEvent{Index: i}) {
-			return
+	}()
+
+	for job := range jobs {
+		select {
+		case <-job.done:
+		case <-ctx.Done():
+			return true
 		}
+		for _, ev := range job.events {
+			if sendEvent(ctx, events, ev) {
+				return true
+			}
+		}
+		// Drop the page's decoded events and objects once PageEnd is out,
+		// and let the producer start the next page.
+		job.events = nil
+		<-slots
 	}
+	return ctx.Err() != nil
 }
 
+// decode is decodePage; tests replace it to watch the pages in flight.
+var decode = decodePage
+
+// decodePage resolves a page's resources, contents and annotations and
+// returns its events from PageStart to PageEnd.
+func decodePage(ctx context.Context, doc *raw.Document, index int, page pageInfo) []Event {
+	out := []Event{PageStartEvent{Index: index, MediaBox: semantic.Rectangle{
+		LLX: page.mediaBox[0], LLY: page.mediaBox[1], URX: page.mediaBox[2], URY: page.mediaBox[3],
+	}}}
+	sink := func(ev Event) bool {
+		out = append(out, ev)
+		return ctx.Err() != nil
+	}
+	if res := resourcesFromDict(doc, page.resources); res != nil {
+		emitResourceRefs(index, res, sink)
+	}
+	for _, content := range collectContents(doc, page.contents) {
+		if ctx.Err() != nil {
+			return nil
+		}
+		ops := parseOperations(content.data)
+		emitResourceUsage(index, collectUsage(ops), sink)
+		for _, op := range ops {
+			out = append(out, ContentOperationEvent{PageIndex: index, Operation: op})
+		}
+	}
+	emitAnnotations(doc, page.annots, index, sink)
+	return append(out, PageEndEvent{Index: index})
+}
+
+// pageInfo is the unresolved description of a leaf page: only the page
+// dictionary's entries (and inherited attributes) are held, not the objects
+// they reference.
 type pageInfo struct {
 	mediaBox  [4]float64
 	resources raw.Object
 	annots    raw.Object
-	contents  []decodedStream
+	contents  raw.Object
+}
+
+// pageWalker iterates the leaf pages of a page tree depth first, loading
+// page tree nodes only as they are reached.
+type pageWalker struct {
+	doc     *raw.Document
+	stack   []pageFrame
+	visited map[raw.ObjectRef]bool
+}
+
+type pageFrame struct {
+	kids      []raw.Object
+	next      int
+	mediaBox  [4]float64
+	resources raw.Object
+}
+
+func newPageWalker(doc *raw.Document) *pageWalker {
+	if doc.Trailer == nil {
+		return nil
+	}
+	rootObj, ok := doc.Trailer.Get(raw.NameLiteral("Root"))
+	if !ok {
+		return nil
+	}
+	_, catalog := resolveDict(doc, rootObj)
+	if catalog == nil {
+		return nil
+	}
+	pagesObj, ok := catalog.Get(raw.NameLiteral("Pages"))
+	if !ok {
+		return nil
+	}
+	return &pageWalker{
+		doc:     doc,
+		stack:   []pageFrame{{kids: []raw.Object{pagesObj}}},
+		visited: make(map[raw.ObjectRef]bool),
+	}
 }
 
-func walkPages(doc *raw.Document, ref raw.ObjectRef, dict raw.Dictionary, inheritedBox [4]float64, pages *[]pageInfo) {
-	typ, _ := dict.Get(raw.NameLiteral("Type"))
-	if name, ok := typ.(raw.NameObj); ok && name.Value() == "Page" {
-		mbox := inheritedBox
+// next returns the next leaf page, or false when the tree is exhausted.
+func (w *pageWalker) next() (pageInfo, bool) {
+	for len(w.stack) > 0 {
+		top := &w.stack[len(w.stack)-1]
+		if top.next >= len(top.kids) {
+			w.stack = w.stack[:len(w.stack)-1]
+			continue
+		}
+		kid := top.kids[top.next]
+		top.next++
+		ref, dict := resolveDict(w.doc, kid)
+		if dict == nil {
+			continue
+		}
+		if ref.Num != 0 {
+			if w.visited[ref] {
+				continue // cyclic page tree
+			}
+			w.visited[ref] = true
+		}
+		mediaBox, resources := top.mediaBox, top.resources
 		if mb, ok := dict.Get(raw.NameLiteral("MediaBox")); ok {
-			if rect, ok := rectFromArray(mb); ok {
-				mbox = rect
+			if rect, ok := rectFromArray(resolve(w.doc, mb)); ok {
+				mediaBox = rect
 			}
 		}
-		var resources raw.Object = dict // keep resources reference for later resolution
 		if res, ok := dict.Get(raw.NameLiteral("Resources")); ok {
 			resources = res
 		}
-		var annots raw.Object
-		if a, ok := dict.Get(raw.NameLiteral("Annots")); ok {
-			annots = a
+		typ, _ := dict.Get(raw.NameLiteral("Type"))
+		name, _ := typ.(raw.NameObj)
+		_, hasKids := dict.Get(raw.NameLiteral("Kids"))
+		if name.Value() == "Page" || (name.Value() != "Pages" && !hasKids) {
+			page := pageInfo{mediaBox: mediaBox, resources: resources}
+			page.annots, _ = dict.Get(raw.NameLiteral("Annots"))
+			page.contents, _ = dict.Get(raw.NameLiteral("Contents"))
+			return page, true
 		}
-		contents := collectContents(doc, dict)
-		*pages = append(*pages, pageInfo{mediaBox: mbox, contents: contents, resources: resources, annots: annots})
-		return
-	}
-	if name, ok := typ.(raw.NameObj); !ok || name.Value() != "Pages" {
-		return
-	}
-	var inheritBox = inheritedBox
-	if mb, ok := dict.Get(raw.NameLiteral("MediaBox")); ok {
-		if rect, ok := rectFromArray(mb); ok {
-			inheritBox = rect
-		}
-	}
-	if kidsObj, ok := dict.Get(raw.NameLiteral("Kids")); ok {
-		if arr, ok := kidsObj.(*raw.ArrayObj); ok {
-			for _, kid := range arr.Items {
-				refKid, kidDict := resolveDict(doc, kid)
-				if kidDict != nil {
-					walkPages(doc, refKid, kidDict, inheritBox, pages)
-				}
-			}
+		kidsObj, _ := dict.Get(raw.NameLiteral("Kids"))
+		if arr, ok := resolve(w.doc, kidsObj).(*raw.ArrayObj); ok {
+			w.stack = append(w.stack, pageFrame{kids: arr.Items, mediaBox: mediaBox, resources: resources})
 		}
 	}
+	return pageInfo{}, false
 }
 
 type decodedStream struct {
 	data []byte
 }
 
-func collectContents(doc *raw.Document, pageDict raw.Dictionary) []decodedStream {
-	contentsObj, ok := pageDict.Get(raw.NameLiteral("Contents"))
-	if !ok {
+func collectContents(doc *raw.Document, contentsObj raw.Object) []decodedStream {
+	if contentsObj == nil {
 		return nil
 	}
 	var data []decodedStream
 	appendStream := func(obj raw.Object) {
-		if ref, ok := obj.(raw.RefObj); ok {
-			if s, ok := doc.Objects[ref.Ref()].(*raw.StreamObj); ok {
-				data = append(data, decodedStream{data: decodeStream(s)})
-			}
-			return
-		}
-		if s, ok := obj.(*raw.StreamObj); ok {
+		if s, ok := resolve(doc, obj).(*raw.StreamObj); ok {
 			data = append(data, decodedStream{data: decodeStream(s)})
 		}
 	}
-	switch v := contentsObj.(type) {
+	switch v := resolve(doc, contentsObj).(type) {
 	case *raw.ArrayObj:
 		for _, it := range v.Items {
 			appendStream(it)
@@ -322,6 +437,20 @@ func collectContents(doc *raw.Document, pageDict raw.Dictionary) []decodedStream
 	return data
 }
 
+// lookup returns the object for ref, loading it on demand, or nil.
+func lookup(doc *raw.Document, ref raw.ObjectRef) raw.Object {
+	obj, _ := doc.Get(ref)
+	return obj
+}
+
+// resolve dereferences obj if it is an indirect reference.
+func resolve(doc *raw.Document, obj raw.Object) raw.Object {
+	if ref, ok := obj.(raw.RefObj); ok {
+		return lookup(doc, ref.Ref())
+	}
+	return obj
+}
+
 func decodeStream(stream *raw.StreamObj) []byte {
 	if stream == nil {
 		return nil
@@ -392,7 +521,7 @@ func parseFilters(dict *raw.DictObj) ([]string, []raw.Dictionary) {
 func resolveDict(doc *raw.Document, obj raw.Object) (raw.ObjectRef, raw.Dictionary) {
 	switch v := obj.(type) {
 	case raw.RefObj:
-		if d, ok := doc.Objects[v.Ref()].(*raw.DictObj); ok {
+		if d, ok := lookup(doc, v.Ref()).(*raw.DictObj); ok {
 			return v.Ref(), d
 		}
 	case *raw.DictObj:
@@ -509,7 +638,7 @@ func parseFont(doc *raw.Document, obj raw.Object) *semantic.Font {
 				font.CharProcs = make(map[string][]byte)
 				for name, streamObj := range cpDict.KV {
 					if ref, ok := streamObj.(raw.RefObj); ok {
-						if s, ok := doc.Objects[ref.Ref()].(*raw.StreamObj); ok {
+						if s, ok := lookup(doc, ref.Ref()).(*raw.StreamObj); ok {
 							font.CharProcs[name] = decodeStream(s)
 						}
 					} else if s, ok := streamObj.(*raw.StreamObj); ok {
@@ -556,7 +685,7 @@ func parseColorSpace(doc *raw.Document, obj raw.Object) semantic.ColorSpace {
 				if arr.Len() > 1 {
 					icc := &semantic.ICCBasedColorSpace{}
 					if ref, ok := arr.Items[1].(raw.RefObj); ok {
-						if stream, ok := doc.Objects[ref.Ref()].(*raw.StreamObj); ok {
+						if stream, ok := lookup(doc, ref.Ref()).(*raw.StreamObj); ok {
 							if n, ok := stream.Dict.Get(raw.NameLiteral("N")); ok {
 								if num, ok := n.(raw.NumberObj); ok {
 									icc.N = int(num.Int())
@@ -616,7 +745,7 @@ func parseColorSpace(doc *raw.Document, obj raw.Object) semantic.ColorSpace {
 
 					lookupObj := arr.Items[3]
 					if ref, ok := lookupObj.(raw.RefObj); ok {
-						lookupObj = doc.Objects[ref.Ref()]
+						lookupObj = lookup(doc, ref.Ref())
 					}
 
 					switch v := lookupObj.(type) {
@@ -642,7 +771,7 @@ func parseXObject(doc *raw.Document, obj raw.Object) *semantic.XObject {
 		if sn, ok := subtype.(raw.NameObj); ok {
 			switch sn.Value() {
 			case "Image":
-				if stream, ok := doc.Objects[ref].(*raw.StreamObj); ok {
+				if stream, ok := lookup(doc, ref).(*raw.StreamObj); ok {
 					xo := semantic.XObject{Subtype: "Image"}
 					if w, ok := xoDict.Get(raw.NameLiteral("Width")); ok {
 						if n, ok := w.(raw.NumberObj); ok {
@@ -666,7 +795,7 @@ func parseXObject(doc *raw.Document, obj raw.Object) *semantic.XObject {
 					return &xo
 				}
 			case "Form":
-				if stream, ok := doc.Objects[ref].(*raw.StreamObj); ok {
+				if stream, ok := lookup(doc, ref).(*raw.StreamObj); ok {
 					xo := semantic.XObject{Subtype: "Form"}
 					if bboxObj, ok := xoDict.Get(raw.NameLiteral("BBox")); ok {
 						if rect, ok := rectFromArray(bboxObj); ok {
@@ -739,7 +868,7 @@ func parsePattern(doc *raw.Document, obj raw.Object) semantic.Pattern {
 		if resObj, ok := pd.Get(raw.NameLiteral("Resources")); ok {
 			p.Resources = resourcesFromDict(doc, resObj)
 		}
-		if stream, ok := doc.Objects[ref].(*raw.StreamObj); ok {
+		if stream, ok := lookup(doc, ref).(*raw.StreamObj); ok {
 			p.Content = decodeStream(stream)
 		}
 		return p
@@ -835,7 +964,7 @@ func resourcesFromDict(doc *raw.Document, obj raw.Object) *semantic.Resources {
 	return res
 }
 
-func emitResourceRefs(ctx context.Context, pageIndex int, res *semantic.Resources, events chan<- Event) {
+func emitResourceRefs(pageIndex int, res *semantic.Resources, sink eventSink) {
 	if res == nil {
 		return
 	}
@@ -843,7 +972,7 @@ func emitResourceRefs(ctx context.Context, pageIndex int, res *semantic.Resource
 		if name == "" {
 			return false
 		}
-		return sendEvent(ctx, events, ResourceRefEvent{PageIndex: pageIndex, Kind: kind, Name: name})
+		return sink(ResourceRefEvent{PageIndex: pageIndex, Kind: kind, Name: name})
 	}
 	for name := range res.Fonts {
 		if emit("Font", name) {
@@ -877,7 +1006,7 @@ func emitResourceRefs(ctx context.Context, pageIndex int, res *semantic.Resource
 	}
 }
 
-func emitResourceUsage(ctx context.Context, pageIndex int, usage usage, events chan<- Event) {
+func emitResourceUsage(pageIndex int, usage usage, sink eventSink) {
 	emitList := func(kind string, names []string) bool {
 		seen := make(map[string]struct{})
 		for _, n := range names {
@@ -888,7 +1017,7 @@ func emitResourceUsage(ctx context.Context, pageIndex int, usage usage, events c
 				continue
 			}
 			seen[n] = struct{}{}
-			if sendEvent(ctx, events, ResourceRefEvent{PageIndex: pageIndex, Kind: kind, Name: n}) {
+			if sink(ResourceRefEvent{PageIndex: pageIndex, Kind: kind, Name: n}) {
 				return true
 			}
 		}
@@ -906,7 +1035,12 @@ func emitResourceUsage(ctx context.Context, pageIndex int, usage usage, events c
 	emitList("Shading", usage.shadings)
 }
 
-func emitAnnotations(ctx context.Context, doc *raw.Document, annots raw.Object, pageIndex int, events chan<- Event) {
+func emitAnnotations(doc *raw.Document, annots raw.Object, pageIndex int, sink eventSink) {
+	if ref, ok := annots.(raw.RefObj); ok {
+		if arr, ok := lookup(doc, ref.Ref()).(*raw.ArrayObj); ok {
+			annots = arr
+		}
+	}
 	var list []raw.Object
 	switch v := annots.(type) {
 	case *raw.ArrayObj:
@@ -927,7 +1061,7 @@ func emitAnnotations(ctx context.Context, doc *raw.Document, annots raw.Object,
 				subtype = n.Value()
 			}
 		}
-		if sendEvent(ctx, events, AnnotationEvent{PageIndex: pageIndex, Ref: ref, Subtype: subtype}) {
+		if sink(AnnotationEvent{PageIndex: pageIndex, Ref: ref, Subtype: subtype}) {
 			return
 		}
 	}
@@ -1340,7 +1474,7 @@ func parseFunction(doc *raw.Document, obj raw.Object) semantic.Function {
 	switch v := obj.(type) {
 	case raw.RefObj:
 		ref = v.Ref()
-		resolved := doc.Objects[ref]
+		resolved := lookup(doc, ref)
 		if d, ok := resolved.(*raw.DictObj); ok {
 			dict = d
 		} else if s, ok := resolved.(*raw.StreamObj); ok {
@@ -1561,7 +1695,7 @@ func parseShading(doc *raw.Document, obj raw.Object) semantic.Shading {
 			}
 		}
 		if ref, ok := obj.(raw.RefObj); ok {
-			if stream, ok := doc.Objects[ref.Ref()].(*raw.StreamObj); ok {
+			if stream, ok := lookup(doc, ref.Ref()).(*raw.StreamObj); ok {
 				mesh.Stream = decodeStream(stream)
 			}
 		}
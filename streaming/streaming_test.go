@@ -3,10 +3,13 @@ package streaming
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/ir/raw"
 	"github.com/wudi/pdfkit/ir/semantic"
 	"github.com/wudi/pdfkit/writer"
 )
@@ -102,6 +105,132 @@ func TestStreamingBackpressure(t *testing.T) {
 	}
 }
 
+func TestStreamingConcurrentReadAheadPreservesOrder(t *testing.T) {
+	b := builder.NewBuilder()
+	const pages = 12
+	for i := 0; i < pages; i++ {
+		pb := b.NewPage(40, 40)
+		// Vary the amount of content so workers finish out of order.
+		for j := 0; j <= (pages-i)%4; j++ {
+			pb.DrawText("x", 2, float64(2+j), builder.TextOptions{FontSize: 6})
+		}
+		pb.Finish()
+	}
+	doc, err := b.Build()
+	if err != nil {
+		t.Fatalf("build doc: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := writer.NewWriter().Write(context.TODO(), doc, &buf, writer.Config{Deterministic: true}); err != nil {
+		t.Fatalf("write pdf: %v", err)
+	}
+
+	collect := func(cfg StreamConfig) []string {
+		ds, err := NewParser().Stream(context.Background(), bytes.NewReader(buf.Bytes()), cfg)
+		if err != nil {
+			t.Fatalf("stream: %v", err)
+		}
+		defer ds.Close()
+		var seq []string
+		current := -1
+		for ev := range ds.Events() {
+			switch e := ev.(type) {
+			case PageStartEvent:
+				if e.Index != current+1 {
+					t.Fatalf("page %d started after page %d", e.Index, current)
+				}
+				current = e.Index
+				seq = append(seq, fmt.Sprintf("start %d", e.Index))
+			case ContentOperationEvent:
+				if e.PageIndex != current {
+					t.Fatalf("operation for page %d emitted during page %d", e.PageIndex, current)
+				}
+				seq = append(seq, fmt.Sprintf("op %d %s", e.PageIndex, e.Operation.Operator))
+			case PageEndEvent:
+				seq = append(seq, fmt.Sprintf("end %d", e.Index))
+			}
+		}
+		if err := <-ds.Errors(); err != nil {
+			t.Fatalf("stream error: %v", err)
+		}
+		return seq
+	}
+
+	serial := collect(StreamConfig{})
+	parallel := collect(StreamConfig{BufferSize: 1, ReadAhead: 3, Concurrency: 4})
+	if len(serial) == 0 || len(serial) != len(parallel) {
+		t.Fatalf("event count mismatch: serial=%d parallel=%d", len(serial), len(parallel))
+	}
+	for i := range serial {
+		if serial[i] != parallel[i] {
+			t.Fatalf("event %d differs: %q vs %q", i, serial[i], parallel[i])
+		}
+	}
+	if serial[len(serial)-1] != fmt.Sprintf("end %d", pages-1) {
+		t.Fatalf("expected %d pages, last event %q", pages, serial[len(serial)-1])
+	}
+}
+
+func TestStreamingReadAheadBoundsPagesInFlight(t *testing.T) {
+	b := builder.NewBuilder()
+	for i := 0; i < 8; i++ {
+		b.NewPage(40, 40).DrawText("x", 2, 2, builder.TextOptions{FontSize: 6}).Finish()
+	}
+	doc, err := b.Build()
+	if err != nil {
+		t.Fatalf("build doc: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := writer.NewWriter().Write(context.TODO(), doc, &buf, writer.Config{Deterministic: true}); err != nil {
+		t.Fatalf("write pdf: %v", err)
+	}
+
+	var started atomic.Int32
+	orig := decode
+	decode = func(ctx context.Context, doc *raw.Document, index int, page pageInfo) []Event {
+		started.Add(1)
+		return orig(ctx, doc, index, page)
+	}
+	defer func() { decode = orig }()
+
+	const readAhead = 2
+	ds, err := NewParser().Stream(context.Background(), bytes.NewReader(buf.Bytes()), StreamConfig{ReadAhead: readAhead, Concurrency: 4})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer ds.Close()
+	// Hold the consumer inside page 0 and give the workers time to run ahead.
+	for ev := range ds.Events() {
+		if _, ok := ev.(PageStartEvent); ok {
+			break
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := started.Load(); n > readAhead {
+		t.Fatalf("%d pages decoded while the consumer holds page 0, want at most %d", n, readAhead)
+	}
+}
+
+func TestStreamingCloseWithoutDraining(t *testing.T) {
+	pdfBytes := buildSamplePDF(t)
+	ds, err := NewParser().Stream(context.Background(), bytes.NewReader(pdfBytes), StreamConfig{ReadAhead: 2, Concurrency: 2})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	<-ds.Events()
+
+	done := make(chan struct{})
+	go func() {
+		ds.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Close blocked on an undrained stream")
+	}
+}
+
 func buildSamplePDF(t *testing.T) []byte {
 	t.Helper()
 	b := builder.NewBuilder()
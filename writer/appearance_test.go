@@ -0,0 +1,123 @@
+package writer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/ir/raw"
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/parser"
+)
+
+func TestWriter_GeneratedAppearances(t *testing.T) {
+	field := &semantic.TextFormField{
+		BaseFormField: semantic.BaseFormField{
+			Name:              "Name",
+			Rect:              semantic.Rectangle{LLX: 10, LLY: 10, URX: 110, URY: 30},
+			DefaultAppearance: "/Helv 0 Tf 0 g",
+			Quadding:          1,
+			BorderColor:       []float64{0},
+			BorderStyle:       &semantic.BorderStyle{Width: 1, Style: "D", Dash: []float64{3}},
+		},
+		Value: "Jane Doe",
+	}
+	square := &semantic.SquareAnnotation{BaseAnnotation: semantic.BaseAnnotation{
+		Subtype:      "Square",
+		RectVal:      semantic.Rectangle{LLX: 20, LLY: 50, URX: 80, URY: 90},
+		Color:        []float64{1, 0, 0},
+		BorderStyle:  &semantic.BorderStyle{Width: 2},
+		BorderEffect: &semantic.BorderEffect{Style: "C", Intensity: 1},
+	}}
+	doc := &semantic.Document{
+		Pages: []*semantic.Page{{
+			MediaBox:    semantic.Rectangle{URX: 200, URY: 200},
+			Annotations: []semantic.Annotation{square},
+		}},
+		AcroForm: &semantic.AcroForm{NeedAppearances: true, Fields: []semantic.FormField{field}},
+	}
+	if err := builder.GenerateAppearances(doc); err != nil {
+		t.Fatalf("generate appearances: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := NewWriter().Write(context.Background(), doc, &buf, Config{Deterministic: true}); err != nil {
+		t.Fatalf("write pdf: %v", err)
+	}
+	rawDoc, err := parser.NewDocumentParser(parser.Config{}).Parse(context.Background(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parse raw: %v", err)
+	}
+
+	dicts := map[string]*raw.DictObj{}
+	for _, obj := range rawDoc.Objects {
+		d, ok := obj.(*raw.DictObj)
+		if !ok {
+			continue
+		}
+		if _, ok := d.Get(raw.NameLiteral("Fields")); ok {
+			dicts["AcroForm"] = d
+		}
+		if sub, ok := d.Get(raw.NameLiteral("Subtype")); ok {
+			dicts[sub.(raw.NameObj).Value()] = d
+		}
+	}
+	if _, ok := dicts["AcroForm"].Get(raw.NameLiteral("NeedAppearances")); ok {
+		t.Errorf("NeedAppearances should be cleared")
+	}
+	widget := dicts["Widget"]
+	if widget == nil || dicts["Square"] == nil {
+		t.Fatalf("annotations not written: %v", dicts)
+	}
+	if da, ok := widget.Get(raw.NameLiteral("DA")); !ok || string(da.(raw.StringObj).Value()) != "/Helv 0 Tf 0 g" {
+		t.Errorf("DA = %#v", da)
+	}
+	if q, ok := widget.Get(raw.NameLiteral("Q")); !ok || q.(raw.NumberObj).Int() != 1 {
+		t.Errorf("Q = %#v", q)
+	}
+	if mk, ok := widget.Get(raw.NameLiteral("MK")); !ok {
+		t.Errorf("MK missing")
+	} else if _, ok := mk.(*raw.DictObj).Get(raw.NameLiteral("BC")); !ok {
+		t.Errorf("MK BC missing")
+	}
+	if bs, ok := widget.Get(raw.NameLiteral("BS")); !ok {
+		t.Errorf("BS missing")
+	} else if s, _ := bs.(*raw.DictObj).Get(raw.NameLiteral("S")); s == nil || s.(raw.NameObj).Value() != "D" {
+		t.Errorf("BS S = %#v", s)
+	}
+	if be, ok := dicts["Square"].Get(raw.NameLiteral("BE")); !ok {
+		t.Errorf("BE missing")
+	} else if s, _ := be.(*raw.DictObj).Get(raw.NameLiteral("S")); s == nil || s.(raw.NameObj).Value() != "C" {
+		t.Errorf("BE S = %#v", s)
+	}
+
+	normal := func(name string, d *raw.DictObj) *raw.StreamObj {
+		t.Helper()
+		ap, ok := d.Get(raw.NameLiteral("AP"))
+		if !ok {
+			t.Fatalf("%s: AP missing", name)
+		}
+		n, _ := ap.(*raw.DictObj).Get(raw.NameLiteral("N"))
+		ref, ok := n.(raw.RefObj)
+		if !ok {
+			t.Fatalf("%s: AP N = %#v", name, n)
+		}
+		stream, ok := rawDoc.Objects[ref.Ref()].(*raw.StreamObj)
+		if !ok {
+			t.Fatalf("%s: AP N is not a stream", name)
+		}
+		for _, key := range []string{"BBox", "Resources"} {
+			if _, ok := stream.Dict.Get(raw.NameLiteral(key)); !ok && (name == "Widget" || key == "BBox") {
+				t.Errorf("%s: appearance %s missing", name, key)
+			}
+		}
+		return stream
+	}
+	if data := string(normal("Widget", widget).Data); !strings.Contains(data, "(Jane Doe) Tj") || !strings.Contains(data, "[3] 0 d") {
+		t.Errorf("widget appearance = %s", data)
+	}
+	if data := string(normal("Square", dicts["Square"]).Data); !strings.Contains(data, " c\n") {
+		t.Errorf("square appearance = %s", data)
+	}
+}
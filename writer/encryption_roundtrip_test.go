@@ -4,9 +4,16 @@ import (
 	"bytes"
 	"context"
 	"crypto/aes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
 	"fmt"
+	"math/big"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/wudi/pdfkit/builder"
 	"github.com/wudi/pdfkit/filters"
@@ -809,3 +816,82 @@ func assertOutlineDestinations(t *testing.T, doc *raw.Document, pageRef raw.Obje
 		}
 	}
 }
+
+func TestEncryptionRoundTrip_PublicKey(t *testing.T) {
+	newRecipient := func(name string, serial int64) (*x509.Certificate, *rsa.PrivateKey) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert, key
+	}
+	readerCert, readerKey := newRecipient("Reader", 10)
+	editorCert, editorKey := newRecipient("Editor", 11)
+	readerPerms := raw.Permissions{Print: true}
+	editorPerms := raw.Permissions{Print: true, Modify: true, Copy: true, FillForms: true}
+
+	b := builder.NewBuilder()
+	b.SetMetadata([]byte("<x:xmpmeta>Recipient Metadata</x:xmpmeta>"))
+	b.NewPage(300, 300).
+		DrawText("Recipient Content", 50, 50, builder.TextOptions{}).
+		Finish()
+	b.SetEncryptionWithOptions("", "", raw.Permissions{}, true, security.EncryptionOptions{
+		Recipients: []security.Recipient{
+			{Certificate: readerCert, Permissions: readerPerms},
+			{Certificate: editorCert, Permissions: editorPerms},
+		},
+	})
+	doc, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := NewWriter().Write(context.Background(), doc, &buf, Config{Deterministic: true}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	pdfData := buf.Bytes()
+	requireNoPlaintext(t, pdfData, "Recipient Content", "Recipient Metadata")
+	if !bytes.Contains(pdfData, []byte("/Adobe.PubSec")) || !bytes.Contains(pdfData, []byte("/adbe.pkcs7.s5")) {
+		t.Fatalf("public-key Encrypt dictionary not written")
+	}
+
+	for _, r := range []struct {
+		cert  *x509.Certificate
+		key   *rsa.PrivateKey
+		perms raw.Permissions
+	}{{readerCert, readerKey, readerPerms}, {editorCert, editorKey, editorPerms}} {
+		parsed, err := parser.NewDocumentParser(parser.Config{Certificate: r.cert, PrivateKey: r.key}).Parse(context.Background(), bytes.NewReader(pdfData))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", r.cert.Subject.CommonName, err)
+		}
+		if !parsed.Encrypted || parsed.Permissions != r.perms {
+			t.Fatalf("%s: encrypted=%v permissions=%+v", r.cert.Subject.CommonName, parsed.Encrypted, parsed.Permissions)
+		}
+		decodedDoc := decodeStreams(t, parsed)
+		requireContentDecrypted(t, decodedDoc, "Recipient Content")
+		requireMetadataDecrypted(t, decodedDoc, "Recipient Metadata")
+	}
+
+	if _, err := parser.NewDocumentParser(parser.Config{Password: "user"}).Parse(context.Background(), bytes.NewReader(pdfData)); err == nil {
+		t.Fatal("parse without a certificate should fail")
+	}
+	strangerCert, strangerKey := newRecipient("Stranger", 12)
+	_, err = parser.NewDocumentParser(parser.Config{Certificate: strangerCert, PrivateKey: strangerKey}).Parse(context.Background(), bytes.NewReader(pdfData))
+	if !errors.Is(err, security.ErrNoRecipient) {
+		t.Fatalf("parse with a foreign certificate = %v", err)
+	}
+}
@@ -3,7 +3,6 @@ package writer
 import (
 	"bytes"
 	"compress/lzw"
-	"compress/zlib"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/ascii85"
@@ -16,6 +15,8 @@ import (
 	"strings"
 	"unicode/utf16"
 
+	"github.com/wudi/pdfkit/contentstream"
+	"github.com/wudi/pdfkit/filters"
 	"github.com/wudi/pdfkit/ir/raw"
 	"github.com/wudi/pdfkit/ir/semantic"
 	"github.com/wudi/pdfkit/security"
@@ -29,7 +30,12 @@ func pdfVersion(cfg Config) string {
 }
 
 func fileID(doc *semantic.Document, cfg Config) [2][]byte {
-	seed := deterministicIDSeed(doc, cfg)
+	return fileIDFromSeed(deterministicIDSeed(doc, cfg), cfg)
+}
+
+// fileIDFromSeed returns the file identifier pair: seed itself for
+// deterministic output and random bytes otherwise.
+func fileIDFromSeed(seed []byte, cfg Config) [2][]byte {
 	if cfg.Deterministic {
 		return [2][]byte{seed, seed}
 	}
@@ -57,6 +63,9 @@ func deterministicIDSeed(doc *semantic.Document, cfg Config) []byte {
 	}
 	if doc.Metadata != nil {
 		h.Write(doc.Metadata.Raw)
+		if doc.Metadata.Packet != nil {
+			h.Write(doc.Metadata.Packet.Marshal(0))
+		}
 	}
 	h.Write([]byte(fmt.Sprintf("%d", len(doc.Pages))))
 	for _, p := range doc.Pages {
@@ -80,6 +89,14 @@ func rectArray(r semantic.Rectangle) *raw.ArrayObj {
 	)
 }
 
+func numberArray(vals []float64) *raw.ArrayObj {
+	arr := raw.NewArray()
+	for _, v := range vals {
+		arr.Append(raw.NumberFloat(v))
+	}
+	return arr
+}
+
 func cropSet(r semantic.Rectangle) bool {
 	return r.LLX != 0 || r.LLY != 0 || r.URX != 0 || r.URY != 0
 }
@@ -95,6 +112,19 @@ func normalizeRotation(rot int) int {
 	return rot
 }
 
+// bilevelImage reports whether xo holds unencoded 1-bit gray samples, as
+// the CCITT and JBIG2 encoders take. Decode arrays are only allowed on
+// image masks, whose samples the codecs reproduce exactly.
+func bilevelImage(xo semantic.XObject) bool {
+	if xo.Subtype != "Image" || xo.Filter != "" || xo.Width <= 0 || xo.Height <= 0 {
+		return false
+	}
+	if xo.ImageMask {
+		return true
+	}
+	return xo.BitsPerComponent == 1 && len(xo.Decode) == 0 && xo.ColorSpace != nil && xo.ColorSpace.ColorSpaceName() == "DeviceGray"
+}
+
 func pickContentFilter(cfg Config) ContentFilter {
 	if cfg.ContentFilter != FilterNone {
 		return cfg.ContentFilter
@@ -105,19 +135,73 @@ func pickContentFilter(cfg Config) ContentFilter {
 	return FilterNone
 }
 
-func flateEncode(data []byte, level int) ([]byte, error) {
-	var buf bytes.Buffer
-	w, err := zlib.NewWriterLevel(&buf, level)
-	if err != nil {
-		return nil, err
+// flateOptions returns how cfg has streams Flate-compressed, applying PNG
+// predictors to the rows pred describes when cfg.Predictors is set.
+func flateOptions(cfg Config, pred *filters.PredictorParams) filters.FlateOptions {
+	opts := filters.FlateOptions{Level: cfg.Compression, Exhaustive: cfg.TryAlternatives}
+	if cfg.AdaptiveCompression {
+		opts.Level = 0
 	}
-	if _, err := w.Write(data); err != nil {
-		return nil, err
+	if cfg.Predictors {
+		opts.Predictor = pred
 	}
-	if err := w.Close(); err != nil {
-		return nil, err
+	return opts
+}
+
+func flateEncode(data []byte, cfg Config) ([]byte, error) {
+	out, _, err := filters.EncodeFlate(data, flateOptions(cfg, nil))
+	return out, err
+}
+
+// imagePredictor returns the rows of samples of an unencoded image, or nil
+// when its layout is unknown.
+func imagePredictor(xo semantic.XObject) *filters.PredictorParams {
+	if xo.Subtype != "Image" || xo.Filter != "" || xo.Width <= 0 || xo.Height <= 0 {
+		return nil
 	}
-	return buf.Bytes(), nil
+	p := filters.PredictorParams{Colors: 1, BitsPerComponent: 1, Columns: xo.Width}
+	if !xo.ImageMask {
+		p.Colors, p.BitsPerComponent = colorComponents(xo.ColorSpace), xo.BitsPerComponent
+	}
+	switch p.BitsPerComponent {
+	case 1, 2, 4, 8, 16:
+	default:
+		return nil
+	}
+	if p.Colors == 0 || len(xo.Data) != (p.Colors*p.BitsPerComponent*xo.Width+7)/8*xo.Height {
+		return nil
+	}
+	return &p
+}
+
+// colorComponents returns the number of colour components of cs, or 0 when
+// it is unknown.
+func colorComponents(cs semantic.ColorSpace) int {
+	switch c := cs.(type) {
+	case nil:
+		return 0
+	case *semantic.ICCBasedColorSpace:
+		if c.N > 0 {
+			return c.N
+		}
+		if c.Alternate == nil {
+			return 0
+		}
+		return colorComponents(c.Alternate)
+	case *semantic.IndexedColorSpace, *semantic.SeparationColorSpace:
+		return 1
+	case *semantic.DeviceNColorSpace:
+		return len(c.Names)
+	}
+	switch cs.ColorSpaceName() {
+	case "DeviceGray", "CalGray":
+		return 1
+	case "DeviceRGB", "CalRGB", "Lab":
+		return 3
+	case "DeviceCMYK":
+		return 4
+	}
+	return 0
 }
 
 func asciiHexEncode(data []byte) []byte {
@@ -217,6 +301,12 @@ func buildToUnicodeCMap(font *semantic.Font) []byte {
 	}
 	name = strings.ReplaceAll(name, " ", "") + "-UTF16"
 	minCID, maxCID := keys[0], keys[len(keys)-1]
+	code := "<%04X>"
+	if font.Subtype != "Type0" {
+		// Simple fonts use single-byte codes.
+		code = "<%02X>"
+		minCID, maxCID = 0, 0xFF
+	}
 	var buf bytes.Buffer
 	buf.WriteString("/CIDInit /ProcSet findresource begin\n")
 	buf.WriteString("12 dict begin\n")
@@ -225,7 +315,7 @@ func buildToUnicodeCMap(font *semantic.Font) []byte {
 	buf.WriteString(fmt.Sprintf("/CMapName /%s def\n", name))
 	buf.WriteString("/CMapType 2 def\n")
 	buf.WriteString("1 begincodespacerange\n")
-	buf.WriteString(fmt.Sprintf("<%04X> <%04X>\n", minCID, maxCID))
+	buf.WriteString(fmt.Sprintf(code+" "+code+"\n", minCID, maxCID))
 	buf.WriteString("endcodespacerange\n")
 	for i := 0; i < len(keys); {
 		chunk := len(keys) - i
@@ -235,7 +325,7 @@ func buildToUnicodeCMap(font *semantic.Font) []byte {
 		buf.WriteString(fmt.Sprintf("%d beginbfchar\n", chunk))
 		for j := 0; j < chunk; j++ {
 			cid := keys[i+j]
-			buf.WriteString(fmt.Sprintf("<%04X> <%s>\n", cid, utf16Hex(font.ToUnicode[cid])))
+			buf.WriteString(fmt.Sprintf(code+" <%s>\n", cid, utf16Hex(font.ToUnicode[cid])))
 		}
 		buf.WriteString("endbfchar\n")
 		i += chunk
@@ -406,12 +496,24 @@ func xoKey(name string, xo semantic.XObject) string {
 	}
 	h.Write([]byte(fmt.Sprintf("%f-%f-%f-%f", xo.BBox.LLX, xo.BBox.LLY, xo.BBox.URX, xo.BBox.URY)))
 	h.Write(xo.Data)
+	h.Write(xo.JBIG2Globals)
 	if xo.Interpolate {
 		h.Write([]byte{1})
 	}
 	if xo.SMask != nil {
 		h.Write([]byte(xoKey(name+":SMask", *xo.SMask)))
 	}
+	if xo.Mask != nil {
+		h.Write([]byte(xoKey(name+":Mask", *xo.Mask)))
+	}
+	h.Write([]byte(fmt.Sprint(xo.ColorKey, xo.Decode, xo.ImageMask, xo.Filter)))
+	h.Write([]byte(fmt.Sprint(xo.Matrix)))
+	if xo.Resources != nil {
+		h.Write([]byte(fmt.Sprintf("%p", xo.Resources)))
+	}
+	if xo.OC != nil {
+		h.Write([]byte(fmt.Sprintf("OC%p", xo.OC)))
+	}
 	return hex.EncodeToString(h.Sum(nil))
 }
 
@@ -489,79 +591,15 @@ func serializeContentStream(cs semantic.ContentStream) []byte {
 	if len(cs.Operations) == 0 {
 		return nil
 	}
-	var buf bytes.Buffer
-	for _, op := range cs.Operations {
-		if op.Operator == "INLINE_IMAGE" && len(op.Operands) > 0 {
-			if ii, ok := op.Operands[0].(semantic.InlineImageOperand); ok {
-				buf.WriteString("BI\n")
-				keys := make([]string, 0, len(ii.Image.Values))
-				for k := range ii.Image.Values {
-					keys = append(keys, k)
-				}
-				sort.Strings(keys)
-				for _, k := range keys {
-					buf.WriteString("/" + k + " ")
-					buf.Write(serializeOperand(ii.Image.Values[k]))
-					buf.WriteByte('\n')
-				}
-				buf.WriteString("ID ")
-				buf.Write(ii.Data)
-				buf.WriteString("\nEI\n")
-				continue
-			}
-		}
-		for i, operand := range op.Operands {
-			if i > 0 {
-				buf.WriteByte(' ')
-			}
-			buf.Write(serializeOperand(operand))
-		}
-		if len(op.Operands) > 0 {
-			buf.WriteByte(' ')
-		}
-		buf.WriteString(op.Operator)
-		buf.WriteByte('\n')
-	}
-	return buf.Bytes()
+	return contentstream.Serialize(cs.Operations)
 }
 
-func serializeOperand(op semantic.Operand) []byte {
-	switch v := op.(type) {
-	case semantic.NumberOperand:
-		// %g keeps minimal form while preserving integer vs float readability.
-		return []byte(fmt.Sprintf("%g", v.Value))
-	case semantic.NameOperand:
-		return []byte("/" + v.Value)
-	case semantic.StringOperand:
-		return escapeLiteralString(v.Value)
-	case semantic.ArrayOperand:
-		var buf bytes.Buffer
-		buf.WriteByte('[')
-		for i, it := range v.Values {
-			if i > 0 {
-				buf.WriteByte(' ')
-			}
-			buf.Write(serializeOperand(it))
-		}
-		buf.WriteByte(']')
-		return buf.Bytes()
-	case semantic.DictOperand:
-		var buf bytes.Buffer
-		buf.WriteString("<<")
-		keys := make([]string, 0, len(v.Values))
-		for k := range v.Values {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		for _, k := range keys {
-			buf.WriteString("/" + k + " ")
-			buf.Write(serializeOperand(v.Values[k]))
-		}
-		buf.WriteString(">>")
-		return buf.Bytes()
-	default:
-		return []byte("null")
+func isContentSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0:
+		return true
 	}
+	return false
 }
 
 func escapeLiteralString(rawBytes []byte) []byte {
@@ -1020,7 +1058,7 @@ func incrementalContext(doc *semantic.Document, out WriterAt, cfg Config) increm
 	info.prevMaxObj = maxObjNumFromBytes(info.base)
 	info.startObjNum = info.prevMaxObj + 1
 	if dec := doc.Decoded(); dec != nil && dec.Raw != nil {
-		for ref := range dec.Raw.Objects {
+		for _, ref := range dec.Raw.Refs() {
 			if ref.Num >= info.startObjNum {
 				info.startObjNum = ref.Num + 1
 			}
@@ -0,0 +1,758 @@
+package writer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/wudi/pdfkit/filters"
+	"github.com/wudi/pdfkit/ir/raw"
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/parser"
+	"github.com/wudi/pdfkit/xref"
+)
+
+// WriteIncremental copies the original file r of the given size to w and
+// appends an incremental update holding what changed in doc, a document
+// parsed from it. Only objects that are new or marked Dirty are written:
+// pages, annotations, form fields, structure elements, document info and
+// metadata. Fonts, images and other resources keep their original objects
+// unless modified. The new cross-reference section has the form of the
+// original one and points back at it through /Prev.
+//
+// The original bytes are left untouched, so existing signatures stay
+// valid, and signature fields and signature dictionaries are never
+// rewritten even when marked dirty. Pages added to doc are appended to the
+// page tree; removing pages or annotations is not supported. Unlike
+// Config.Incremental, the output needs no random access.
+func WriteIncremental(ctx context.Context, doc *semantic.Document, r io.ReaderAt, size int64, w io.Writer, cfg Config) error {
+	switch {
+	case cfg.Linearize:
+		return errors.New("incremental update: linearization is not supported")
+	case cfg.ObjectStreams:
+		return errors.New("incremental update: object streams are not supported")
+	case cfg.SubsetFonts:
+		return errors.New("incremental update: font subsetting is not supported")
+	case cfg.Optimizer != nil:
+		return errors.New("incremental update: optimization is not supported")
+	}
+	if doc == nil {
+		return errors.New("incremental update: nil document")
+	}
+	if err := doc.LoadPages(ctx); err != nil {
+		return err
+	}
+
+	src := io.NewSectionReader(r, 0, size)
+	resolver := xref.NewResolver(xref.ResolverConfig{})
+	table, err := resolver.Resolve(ctx, src)
+	if err != nil {
+		return fmt.Errorf("resolve xref: %w", err)
+	}
+	trailer := resolver.Trailer()
+	if trailer == nil {
+		return fmt.Errorf("no trailer found")
+	}
+	if _, ok := trailer.Get(raw.NameLiteral("Encrypt")); ok {
+		return errors.New("incremental update: encrypted documents are not supported")
+	}
+	rootObj, ok := trailer.Get(raw.NameLiteral("Root"))
+	if !ok {
+		return fmt.Errorf("no root in trailer")
+	}
+	rootRef, ok := rootObj.(raw.RefObj)
+	if !ok {
+		return fmt.Errorf("root is not a reference")
+	}
+	prevXRef, err := xref.FindStartXRef(src, size)
+	if err != nil {
+		return fmt.Errorf("find startxref: %w", err)
+	}
+	loader, err := (&parser.ObjectLoaderBuilder{}).
+		WithReader(src).
+		WithXRef(table).
+		Build()
+	if err != nil {
+		return fmt.Errorf("build loader: %w", err)
+	}
+
+	prevSize := 0
+	for _, num := range table.Objects() {
+		prevSize = maxInt(prevSize, num+1)
+	}
+	if n, ok := trailer.Get(raw.NameLiteral("Size")); ok {
+		if v, ok := n.(raw.NumberObj); ok {
+			prevSize = maxInt(prevSize, int(v.Int()))
+		}
+	}
+
+	ids := fileID(doc, cfg)
+	if idObj, ok := trailer.Get(raw.NameLiteral("ID")); ok {
+		if arr, ok := idObj.(*raw.ArrayObj); ok && arr.Len() == 2 {
+			if first, ok := arr.Items[0].(raw.String); ok {
+				ids[0] = first.Value()
+			}
+		}
+	}
+
+	u := &incrementalUpdate{
+		ctx:        ctx,
+		doc:        doc,
+		b:          newObjectBuilder(doc, cfg, prevSize, ids, nil, nil, nil, nil),
+		loader:     loader,
+		catalogRef: rootRef.Ref(),
+		pageAnnots: make(map[int][]raw.ObjectRef),
+	}
+	u.b.keepOriginals = true
+	if doc.Info != nil && doc.Info.OriginalRef.Num != 0 {
+		u.infoRef = &doc.Info.OriginalRef
+	} else if infoObj, ok := trailer.Get(raw.NameLiteral("Info")); ok {
+		if ref, ok := infoObj.(raw.RefObj); ok {
+			r := ref.Ref()
+			u.infoRef = &r
+		}
+	}
+	if err := u.build(); err != nil {
+		return err
+	}
+
+	// The update starts on a line of its own.
+	last := make([]byte, 1)
+	if size > 0 {
+		if _, err := r.ReadAt(last, size-1); err != nil {
+			return fmt.Errorf("read original: %w", err)
+		}
+	}
+	if _, err := io.Copy(w, io.NewSectionReader(r, 0, size)); err != nil {
+		return err
+	}
+	offset := size
+	var buf bytes.Buffer
+	if size > 0 && last[0] != '\n' && last[0] != '\r' {
+		buf.WriteByte('\n')
+		offset++
+	}
+
+	refs := make([]raw.ObjectRef, 0, len(u.b.objects))
+	for ref := range u.b.objects {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Num < refs[j].Num })
+	entries := make(map[int]xrefEntry, len(refs)+1)
+	for _, ref := range refs {
+		entries[ref.Num] = xrefEntry{typ: 1, field2: offset + int64(buf.Len()), field3: ref.Gen}
+		buf.Write(serializeObject(ref, u.b.objects[ref]))
+	}
+
+	if table.Type() == "xref-stream" {
+		xrefRef := u.b.nextRef()
+		xrefOffset := offset + int64(buf.Len())
+		entries[xrefRef.Num] = xrefEntry{typ: 1, field2: xrefOffset}
+		dict := u.trailer(prevSize, prevXRef, ids)
+		index, data := xrefStreamIndexAndEntries(entries)
+		dict.Set(raw.NameLiteral("Type"), raw.NameLiteral("XRef"))
+		dict.Set(raw.NameLiteral("W"), raw.NewArray(raw.NumberInt(1), raw.NumberInt(4), raw.NumberInt(1)))
+		dict.Set(raw.NameLiteral("Index"), index)
+		if cfg.Compression > 0 {
+			pred := &filters.PredictorParams{Colors: 1, BitsPerComponent: 8, Columns: 6}
+			if compressed, parms, err := filters.EncodeFlate(data, flateOptions(cfg, pred)); err == nil {
+				data = compressed
+				dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("FlateDecode"))
+				if parms != nil {
+					dict.Set(raw.NameLiteral("DecodeParms"), parms)
+				}
+			}
+		}
+		dict.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(data))))
+		buf.Write(serializeObject(xrefRef, raw.NewStream(dict, data)))
+		fmt.Fprintf(&buf, "startxref\n%d\n%%EOF\n", xrefOffset)
+	} else {
+		xrefOffset := offset + int64(buf.Len())
+		buf.WriteString("xref\n0 1\n0000000000 65535 f \n")
+		for i := 0; i < len(refs); {
+			j := i + 1
+			for j < len(refs) && refs[j].Num == refs[j-1].Num+1 {
+				j++
+			}
+			fmt.Fprintf(&buf, "%d %d\n", refs[i].Num, j-i)
+			for _, ref := range refs[i:j] {
+				fmt.Fprintf(&buf, "%010d %05d n \n", entries[ref.Num].field2, ref.Gen)
+			}
+			i = j
+		}
+		buf.WriteString("trailer\n")
+		buf.Write(serializePrimitive(u.trailer(prevSize, prevXRef, ids)))
+		fmt.Fprintf(&buf, "\nstartxref\n%d\n%%EOF\n", xrefOffset)
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// incrementalUpdate collects the objects of an incremental update in the
+// object builder, rewriting original objects in place at their numbers.
+type incrementalUpdate struct {
+	ctx        context.Context
+	doc        *semantic.Document
+	b          *objectBuilder
+	loader     parser.ObjectLoader
+	catalogRef raw.ObjectRef
+	catalog    *raw.DictObj
+	// catalogChanged is set when catalog has entries to be written.
+	catalogChanged bool
+	infoRef        *raw.ObjectRef
+	// pageAnnots holds the widgets of new form fields by page index, to be
+	// added to the annotations of their pages.
+	pageAnnots map[int][]raw.ObjectRef
+	// newPages are the references of the pages appended to the page tree.
+	newPages []raw.ObjectRef
+}
+
+func (u *incrementalUpdate) build() error {
+	u.b.pageRefs = make([]raw.ObjectRef, len(u.doc.Pages))
+	for i, p := range u.doc.Pages {
+		if p.OriginalRef.Num != 0 {
+			u.b.pageRefs[i] = p.OriginalRef
+		} else {
+			u.b.pageRefs[i] = u.b.nextRef()
+			u.newPages = append(u.newPages, u.b.pageRefs[i])
+		}
+	}
+	if err := u.updateMetadata(); err != nil {
+		return err
+	}
+	if err := u.updateFields(); err != nil {
+		return err
+	}
+	if err := u.updatePages(); err != nil {
+		return err
+	}
+	if err := u.updateStructure(); err != nil {
+		return err
+	}
+	if u.catalogChanged {
+		u.b.objects[u.catalogRef] = u.catalog
+	}
+	return nil
+}
+
+// trailer returns the trailer of the update, sized to cover the objects
+// of the original file and of the update.
+func (u *incrementalUpdate) trailer(prevSize int, prev int64, ids [2][]byte) *raw.DictObj {
+	t := buildTrailer(maxInt(prevSize, u.b.objNum), u.catalogRef, u.infoRef, nil, u.doc, u.b.cfg, 0, ids)
+	t.Set(raw.NameLiteral("Prev"), raw.NumberInt(prev))
+	return t
+}
+
+// load returns the dictionary ref, as already rewritten by the update or
+// else as read from the original file.
+func (u *incrementalUpdate) load(ref raw.ObjectRef) (*raw.DictObj, error) {
+	obj, ok := u.b.objects[ref]
+	if !ok {
+		var err error
+		if obj, err = u.loader.Load(u.ctx, ref); err != nil {
+			return nil, fmt.Errorf("load object %s: %w", ref, err)
+		}
+	}
+	dict, ok := obj.(*raw.DictObj)
+	if !ok {
+		return nil, fmt.Errorf("object %s is not a dictionary", ref)
+	}
+	return dict, nil
+}
+
+// resolve returns obj, loading it from the original file when it is a
+// reference.
+func (u *incrementalUpdate) resolve(obj raw.Object) raw.Object {
+	if ref, ok := obj.(raw.RefObj); ok {
+		if o, ok := u.b.objects[ref.Ref()]; ok {
+			return o
+		}
+		if o, err := u.loader.Load(u.ctx, ref.Ref()); err == nil {
+			return o
+		}
+		return nil
+	}
+	return obj
+}
+
+// array returns a copy of the array stored under key in dict, resolving
+// an indirect one, or an empty array.
+func (u *incrementalUpdate) array(dict *raw.DictObj, key string) *raw.ArrayObj {
+	out := raw.NewArray()
+	if v, ok := dict.Get(raw.NameLiteral(key)); ok {
+		if arr, ok := u.resolve(v).(*raw.ArrayObj); ok {
+			out.Items = append(out.Items, arr.Items...)
+		}
+	}
+	return out
+}
+
+func (u *incrementalUpdate) catalogDict() (*raw.DictObj, error) {
+	if u.catalog == nil {
+		dict, err := u.load(u.catalogRef)
+		if err != nil {
+			return nil, err
+		}
+		u.catalog = dict
+	}
+	return u.catalog, nil
+}
+
+// signed reports whether the original object ref is a signature field or
+// a signature dictionary, which the update must never rewrite.
+func (u *incrementalUpdate) signed(ref raw.ObjectRef) bool {
+	obj, err := u.loader.Load(u.ctx, ref)
+	if err != nil {
+		return false
+	}
+	dict, ok := obj.(*raw.DictObj)
+	if !ok {
+		return false
+	}
+	if _, ok := dict.Get(raw.NameLiteral("ByteRange")); ok {
+		return true
+	}
+	for _, key := range []string{"FT", "Type"} {
+		if v, ok := dict.Get(raw.NameLiteral(key)); ok {
+			if n, ok := v.(raw.Name); ok && n.Value() == "Sig" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// relocate moves the object the builder wrote at ref to the original
+// object orig, which it replaces.
+func (u *incrementalUpdate) relocate(ref, orig raw.ObjectRef) {
+	u.b.objects[orig] = u.b.objects[ref]
+	delete(u.b.objects, ref)
+}
+
+// updateMetadata writes the document information dictionary and the XMP
+// metadata stream when they are new or changed, keeping them in
+// agreement as a full write does.
+func (u *incrementalUpdate) updateMetadata() error {
+	docInfo, md := u.doc.Info, u.doc.Metadata
+	infoChanged := docInfo != nil && (docInfo.Dirty || docInfo.OriginalRef.Num == 0)
+	mdChanged := md != nil && (md.Dirty || md.OriginalRef.Num == 0)
+	if !infoChanged && !mdChanged {
+		return nil
+	}
+	info, metadata := syncMetadata(docInfo, md)
+	if infoChanged || (mdChanged && docInfo != nil) {
+		if ref := u.b.addInfo(info); ref != nil {
+			if docInfo.OriginalRef.Num != 0 {
+				u.relocate(*ref, docInfo.OriginalRef)
+				*ref = docInfo.OriginalRef
+			}
+			u.infoRef = ref
+		}
+	}
+	if md != nil && (mdChanged || infoChanged) {
+		ref := u.b.addMetadata(metadata)
+		if ref == nil {
+			return nil
+		}
+		if md.OriginalRef.Num != 0 {
+			u.relocate(*ref, md.OriginalRef)
+			return nil
+		}
+		catalog, err := u.catalogDict()
+		if err != nil {
+			return err
+		}
+		catalog.Set(raw.NameLiteral("Metadata"), raw.Ref(ref.Num, ref.Gen))
+		u.catalogChanged = true
+	}
+	return nil
+}
+
+// updateFields writes new and changed form fields, adding the new ones to
+// the interactive form and their widgets to their pages.
+func (u *incrementalUpdate) updateFields() error {
+	form := u.doc.AcroForm
+	if form == nil {
+		return nil
+	}
+	var added []raw.ObjectRef
+	for _, f := range form.Fields {
+		var orig raw.ObjectRef
+		if base := formFieldBase(f); base != nil {
+			orig = base.OriginalRef
+		}
+		if orig.Num != 0 && (!f.IsDirty() || u.signed(orig)) {
+			continue
+		}
+		ref, err := u.b.addFormField(f)
+		if err != nil {
+			return err
+		}
+		if orig.Num != 0 {
+			u.relocate(ref, orig)
+			f.SetReference(orig)
+			continue
+		}
+		added = append(added, ref)
+		if idx := f.FieldPageIndex(); idx >= 0 && idx < len(u.doc.Pages) {
+			u.pageAnnots[idx] = append(u.pageAnnots[idx], ref)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	catalog, err := u.catalogDict()
+	if err != nil {
+		return err
+	}
+	var formDict *raw.DictObj
+	var formRef raw.ObjectRef
+	switch v, _ := catalog.Get(raw.NameLiteral("AcroForm")); v := v.(type) {
+	case raw.RefObj:
+		formRef = v.Ref()
+		if formDict, err = u.load(formRef); err != nil {
+			return err
+		}
+	case *raw.DictObj:
+		formDict = v
+		u.catalogChanged = true
+	default:
+		formRef = u.b.nextRef()
+		formDict = raw.Dict()
+		if form.NeedAppearances {
+			formDict.Set(raw.NameLiteral("NeedAppearances"), raw.Bool(true))
+		}
+		if dr := form.DefaultResources; dr != nil {
+			if resDict := u.b.serializeResources(dr); resDict != nil {
+				formDict.Set(raw.NameLiteral("DR"), resDict)
+			}
+		}
+		catalog.Set(raw.NameLiteral("AcroForm"), raw.Ref(formRef.Num, formRef.Gen))
+		u.catalogChanged = true
+	}
+	fields := u.array(formDict, "Fields")
+	for _, ref := range added {
+		fields.Append(raw.Ref(ref.Num, ref.Gen))
+	}
+	formDict.Set(raw.NameLiteral("Fields"), fields)
+	if formRef.Num != 0 {
+		u.b.objects[formRef] = formDict
+	}
+	return nil
+}
+
+// updatePages rewrites dirty pages and pages with new annotations, and
+// appends new pages to the page tree.
+func (u *incrementalUpdate) updatePages() error {
+	for i, p := range u.doc.Pages {
+		if p.OriginalRef.Num == 0 {
+			continue
+		}
+		if err := u.updatePage(i, p); err != nil {
+			return err
+		}
+	}
+	if len(u.newPages) == 0 {
+		return nil
+	}
+
+	catalog, err := u.catalogDict()
+	if err != nil {
+		return err
+	}
+	pagesObj, _ := catalog.Get(raw.NameLiteral("Pages"))
+	pagesRef, ok := pagesObj.(raw.RefObj)
+	if !ok {
+		return fmt.Errorf("page tree root is not a reference")
+	}
+	root, err := u.load(pagesRef.Ref())
+	if err != nil {
+		return err
+	}
+	for i, p := range u.doc.Pages {
+		if p.OriginalRef.Num != 0 {
+			continue
+		}
+		ref := u.b.pageRefs[i]
+		content, err := u.b.addContentStream(p)
+		if err != nil {
+			return err
+		}
+		dict, err := u.b.addPage(p, ref, pagesRef.Ref(), content, newResourceUnion())
+		if err != nil {
+			return err
+		}
+		annots := raw.NewArray()
+		for _, a := range p.Annotations {
+			aref, err := u.addAnnotation(p, a)
+			if err != nil {
+				return err
+			}
+			annots.Append(raw.Ref(aref.Num, aref.Gen))
+		}
+		for _, ref := range u.pageAnnots[i] {
+			annots.Append(raw.Ref(ref.Num, ref.Gen))
+		}
+		if annots.Len() > 0 {
+			dict.Set(raw.NameLiteral("Annots"), annots)
+		}
+		u.b.objects[ref] = dict
+	}
+	kids := u.array(root, "Kids")
+	for _, ref := range u.newPages {
+		kids.Append(raw.Ref(ref.Num, ref.Gen))
+	}
+	count := int64(0)
+	if v, ok := u.resolve(dictValue(root, "Count")).(raw.NumberObj); ok {
+		count = v.Int()
+	}
+	root.Set(raw.NameLiteral("Kids"), kids)
+	root.Set(raw.NameLiteral("Count"), raw.NumberInt(count+int64(len(u.newPages))))
+	u.b.objects[pagesRef.Ref()] = root
+	return nil
+}
+
+// updatePage rewrites the original page p when it is dirty or has new or
+// changed annotations. The annotations of the original page are kept.
+func (u *incrementalUpdate) updatePage(i int, p *semantic.Page) error {
+	var annots []semantic.Annotation
+	for _, a := range p.Annotations {
+		if base := a.Base(); base.OriginalRef.Num == 0 || base.Dirty {
+			annots = append(annots, a)
+		}
+	}
+	widgets := u.pageAnnots[i]
+	if !p.Dirty && len(annots) == 0 && len(widgets) == 0 {
+		return nil
+	}
+	dict, err := u.load(p.OriginalRef)
+	if err != nil {
+		return err
+	}
+	if p.Dirty {
+		content, err := u.b.addContentStream(p)
+		if err != nil {
+			return err
+		}
+		page := *p
+		page.Annotations = nil
+		fresh, err := u.b.addPage(&page, p.OriginalRef, raw.ObjectRef{}, content, newResourceUnion())
+		if err != nil {
+			return err
+		}
+		for key, v := range fresh.KV {
+			if key != "Parent" && key != "Annots" {
+				dict.KV[key] = v
+			}
+		}
+	}
+	arr := u.array(dict, "Annots")
+	for _, a := range annots {
+		orig := a.Base().OriginalRef
+		ref, err := u.addAnnotation(p, a)
+		if err != nil {
+			return err
+		}
+		if orig.Num == 0 {
+			arr.Append(raw.Ref(ref.Num, ref.Gen))
+		}
+	}
+	for _, ref := range widgets {
+		arr.Append(raw.Ref(ref.Num, ref.Gen))
+	}
+	if arr.Len() > 0 {
+		dict.Set(raw.NameLiteral("Annots"), arr)
+	}
+	u.b.objects[p.OriginalRef] = dict
+	return nil
+}
+
+// addAnnotation writes the annotation a of page p, at its original object
+// when it has one, and returns its reference.
+func (u *incrementalUpdate) addAnnotation(p *semantic.Page, a semantic.Annotation) (raw.ObjectRef, error) {
+	base := a.Base()
+	orig := base.OriginalRef
+	if orig.Num != 0 && u.signed(orig) {
+		return orig, nil
+	}
+	if !cropSet(base.RectVal) {
+		if cropSet(p.CropBox) {
+			base.RectVal = p.CropBox
+		} else {
+			base.RectVal = p.MediaBox
+		}
+	}
+	ref, err := u.b.annotSerializer.Serialize(a, u.b)
+	if err != nil {
+		return raw.ObjectRef{}, err
+	}
+	if orig.Num == 0 {
+		return ref, nil
+	}
+	u.relocate(ref, orig)
+	a.SetReference(orig)
+	return orig, nil
+}
+
+// updateStructure rewrites dirty structure elements read from the file
+// and writes the new elements they lead to. The parent tree is not
+// updated, so new marked content is not found from the page it is on.
+func (u *incrementalUpdate) updateStructure() error {
+	tree := u.doc.StructTree
+	if tree == nil {
+		return nil
+	}
+	var walk func(elems []*semantic.StructureElement) error
+	walk = func(elems []*semantic.StructureElement) error {
+		for _, elem := range elems {
+			if elem == nil || elem.OriginalRef.Num == 0 {
+				continue
+			}
+			if elem.Dirty {
+				dict, err := u.load(elem.OriginalRef)
+				if err != nil {
+					return err
+				}
+				u.structElemEntries(dict, elem, elem.OriginalRef)
+				u.b.objects[elem.OriginalRef] = dict
+			}
+			var kids []*semantic.StructureElement
+			for _, kid := range elem.K {
+				kids = append(kids, kid.Element)
+			}
+			if err := walk(kids); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(tree.K); err != nil {
+		return err
+	}
+	if !tree.Dirty || tree.OriginalRef.Num == 0 {
+		return nil
+	}
+	root, err := u.load(tree.OriginalRef)
+	if err != nil {
+		return err
+	}
+	kids := raw.NewArray()
+	for _, elem := range tree.K {
+		if ref := u.structElemRef(elem, tree.OriginalRef); ref != nil {
+			kids.Append(raw.Ref(ref.Num, ref.Gen))
+		}
+	}
+	root.Set(raw.NameLiteral("K"), kids)
+	u.b.objects[tree.OriginalRef] = root
+	return nil
+}
+
+// structElemRef returns the object of the structure element elem, writing
+// it under parent when it is new.
+func (u *incrementalUpdate) structElemRef(elem *semantic.StructureElement, parent raw.ObjectRef) *raw.ObjectRef {
+	if elem == nil {
+		return nil
+	}
+	if elem.OriginalRef.Num != 0 {
+		return &elem.OriginalRef
+	}
+	ref := u.b.nextRef()
+	dict := raw.Dict()
+	dict.Set(raw.NameLiteral("Type"), raw.NameLiteral("StructElem"))
+	dict.Set(raw.NameLiteral("P"), raw.Ref(parent.Num, parent.Gen))
+	u.b.objects[ref] = dict
+	u.structElemEntries(dict, elem, ref)
+	return &ref
+}
+
+// structElemEntries sets the entries of the structure element dictionary
+// dict, the object ref, from elem. Entries elem leaves empty are removed.
+func (u *incrementalUpdate) structElemEntries(dict *raw.DictObj, elem *semantic.StructureElement, ref raw.ObjectRef) {
+	setString := func(key, v string) {
+		if v != "" {
+			dict.Set(raw.NameLiteral(key), raw.Str([]byte(v)))
+		} else {
+			delete(dict.KV, key)
+		}
+	}
+	if s := elem.S; s != "" {
+		dict.Set(raw.NameLiteral("S"), raw.NameLiteral(s))
+	}
+	setString("T", elem.Title)
+	setString("Lang", elem.Lang)
+	setString("Alt", elem.Alt)
+	setString("E", elem.Expanded)
+	setString("ActualText", elem.ActualText)
+	setString("ID", elem.ID)
+	if elem.Pg != nil {
+		if pg := pageRefAt(u.b.pageRefs, elem.Pg.Index); pg != nil {
+			dict.Set(raw.NameLiteral("Pg"), raw.Ref(pg.Num, pg.Gen))
+		}
+	}
+
+	kArr := raw.NewArray()
+	for _, kid := range elem.K {
+		switch {
+		case kid.Element != nil:
+			if child := u.structElemRef(kid.Element, ref); child != nil {
+				kArr.Append(raw.Ref(child.Num, child.Gen))
+			}
+		case kid.ObjRef.Num != 0:
+			objr := raw.Dict()
+			objr.Set(raw.NameLiteral("Type"), raw.NameLiteral("OBJR"))
+			objr.Set(raw.NameLiteral("Obj"), raw.Ref(kid.ObjRef.Num, kid.ObjRef.Gen))
+			if kid.MCR != nil && kid.MCR.Pg != nil {
+				if pg := pageRefAt(u.b.pageRefs, kid.MCR.Pg.Index); pg != nil {
+					objr.Set(raw.NameLiteral("Pg"), raw.Ref(pg.Num, pg.Gen))
+				}
+			}
+			kArr.Append(objr)
+		case kid.MCR != nil:
+			mcr := raw.Dict()
+			mcr.Set(raw.NameLiteral("Type"), raw.NameLiteral("MCR"))
+			if kid.MCR.Pg != nil {
+				if pg := pageRefAt(u.b.pageRefs, kid.MCR.Pg.Index); pg != nil {
+					mcr.Set(raw.NameLiteral("Pg"), raw.Ref(pg.Num, pg.Gen))
+				}
+			}
+			if kid.MCR.Stm.Num != 0 {
+				mcr.Set(raw.NameLiteral("Stm"), raw.Ref(kid.MCR.Stm.Num, kid.MCR.Stm.Gen))
+			}
+			mcr.Set(raw.NameLiteral("MCID"), raw.NumberInt(int64(kid.MCR.MCID)))
+			kArr.Append(mcr)
+		case kid.MCID >= 0:
+			kArr.Append(raw.NumberInt(int64(kid.MCID)))
+		}
+	}
+	if kArr.Len() > 0 {
+		dict.Set(raw.NameLiteral("K"), kArr)
+	} else {
+		delete(dict.KV, "K")
+	}
+}
+
+// formFieldBase returns the fields common to all form field types.
+func formFieldBase(f semantic.FormField) *semantic.BaseFormField {
+	switch t := f.(type) {
+	case *semantic.TextFormField:
+		return &t.BaseFormField
+	case *semantic.ChoiceFormField:
+		return &t.BaseFormField
+	case *semantic.ButtonFormField:
+		return &t.BaseFormField
+	case *semantic.SignatureFormField:
+		return &t.BaseFormField
+	case *semantic.GenericFormField:
+		return &t.BaseFormField
+	}
+	return nil
+}
+
+func dictValue(dict *raw.DictObj, key string) raw.Object {
+	v, _ := dict.Get(raw.NameLiteral(key))
+	return v
+}
@@ -0,0 +1,175 @@
+package writer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/ir"
+	"github.com/wudi/pdfkit/ir/raw"
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/parser"
+	"github.com/wudi/pdfkit/security"
+	"github.com/wudi/pdfkit/xref"
+)
+
+func testSigner(t *testing.T) security.Signer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Reviewer"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return security.NewRSASigner(key, []*x509.Certificate{cert})
+}
+
+func TestWriteIncremental(t *testing.T) {
+	ctx := context.Background()
+	img := &semantic.Image{
+		Width:            2,
+		Height:           2,
+		ColorSpace:       &semantic.DeviceColorSpace{Name: "DeviceGray"},
+		BitsPerComponent: 8,
+		Data:             []byte{0x00, 0x40, 0x80, 0xFF},
+	}
+	for _, cfg := range []Config{{Version: PDF17}, {Version: PDF17, XRefStreams: true, Compression: 6}} {
+		b := builder.NewBuilder()
+		b.SetInfo(&semantic.DocumentInfo{Title: "Contract"})
+		b.NewPage(200, 200).
+			DrawText("Terms", 10, 20, builder.TextOptions{FontSize: 12}).
+			DrawImage(img, 10, 50, 20, 20, builder.ImageOptions{}).
+			Finish()
+		doc, err := b.Build()
+		if err != nil {
+			t.Fatalf("Build: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := NewWriter().Write(ctx, doc, &buf, cfg); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		original := buf.Bytes()
+		if !cfg.XRefStreams {
+			// Review comments go on documents that are already signed.
+			var signed bytes.Buffer
+			if err := Sign(ctx, bytes.NewReader(original), int64(len(original)), &signed, testSigner(t), SignConfig{Reason: "Approved"}); err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			original = signed.Bytes()
+		}
+
+		parsed, err := ir.NewDefault().Parse(ctx, bytes.NewReader(original))
+		if err != nil {
+			t.Fatalf("parse original: %v", err)
+		}
+		page := parsed.Pages[0]
+		page.Annotations = append(page.Annotations, &semantic.TextAnnotation{
+			BaseAnnotation: semantic.BaseAnnotation{Subtype: "Text", RectVal: semantic.Rectangle{LLX: 10, LLY: 10, URX: 30, URY: 30}, Contents: "Check clause 2"},
+		})
+		parsed.Pages = append(parsed.Pages, &semantic.Page{MediaBox: semantic.Rectangle{URX: 100, URY: 100}})
+
+		var out bytes.Buffer
+		if err := WriteIncremental(ctx, parsed, bytes.NewReader(original), int64(len(original)), &out, cfg); err != nil {
+			t.Fatalf("xref streams %v: WriteIncremental: %v", cfg.XRefStreams, err)
+		}
+		data := out.Bytes()
+		if !bytes.HasPrefix(data, original) {
+			t.Fatalf("xref streams %v: original bytes were changed", cfg.XRefStreams)
+		}
+
+		// The update holds the annotated page, the annotation, the page
+		// tree root and the new page with its content stream and default
+		// font.
+		updated := scanObjectOffsets(data[len(original):])
+		if _, ok := updated[page.OriginalRef.Num]; !ok {
+			t.Errorf("xref streams %v: annotated page not written", cfg.XRefStreams)
+		}
+		want := 6
+		if cfg.XRefStreams {
+			want++ // the xref stream
+		}
+		if len(updated) != want {
+			t.Errorf("xref streams %v: update holds %d objects, want %d", cfg.XRefStreams, len(updated), want)
+		}
+
+		resolver := xref.NewResolver(xref.ResolverConfig{})
+		table, err := resolver.Resolve(ctx, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("resolve xref: %v", err)
+		}
+		wantType := "table"
+		if cfg.XRefStreams {
+			wantType = "xref-stream"
+		}
+		if table.Type() != wantType {
+			t.Errorf("update xref is %s, want %s", table.Type(), wantType)
+		}
+		prev, _ := xref.FindStartXRef(bytes.NewReader(original), int64(len(original)))
+		if v, ok := resolver.Trailer().Get(raw.NameLiteral("Prev")); !ok || v.(raw.NumberObj).Int() != prev {
+			t.Errorf("xref streams %v: /Prev %v, want %d", cfg.XRefStreams, v, prev)
+		}
+		for num, off := range updated {
+			if got, _, ok := table.Lookup(num); !ok || got != int64(len(original))+off {
+				t.Errorf("xref streams %v: object %d at %d, xref says %d", cfg.XRefStreams, num, int64(len(original))+off, got)
+			}
+		}
+
+		rawDoc, err := parser.NewDocumentParser(parser.Config{}).Parse(ctx, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("parse raw: %v", err)
+		}
+		annots, ok := rawDoc.Objects[page.OriginalRef].(*raw.DictObj).Get(raw.NameLiteral("Annots"))
+		if !ok || annots.(*raw.ArrayObj).Len() != 1 {
+			t.Errorf("xref streams %v: page annotations %v", cfg.XRefStreams, annots)
+		}
+		signatures := 0
+		for _, obj := range rawDoc.Objects {
+			if d, ok := obj.(*raw.DictObj); ok {
+				if _, ok := d.Get(raw.NameLiteral("ByteRange")); ok {
+					signatures++
+				}
+			}
+		}
+		if !cfg.XRefStreams && signatures != 1 {
+			t.Errorf("found %d signatures, want 1", signatures)
+		}
+
+		reparsed, err := ir.NewDefault().Parse(ctx, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		if len(reparsed.Pages) != 2 {
+			t.Errorf("xref streams %v: parsed %d pages, want 2", cfg.XRefStreams, len(reparsed.Pages))
+		}
+		// Sign does not carry /Info over to its trailer.
+		if cfg.XRefStreams && (reparsed.Info == nil || reparsed.Info.Title != "Contract") {
+			t.Errorf("xref streams %v: document info lost", cfg.XRefStreams)
+		}
+	}
+}
+
+func TestWriteIncremental_Unsupported(t *testing.T) {
+	if err := WriteIncremental(context.Background(), &semantic.Document{}, bytes.NewReader(nil), 0, &bytes.Buffer{}, Config{Linearize: true}); err == nil {
+		t.Error("expected error for linearization")
+	}
+}
@@ -0,0 +1,31 @@
+package writer
+
+import (
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/xmp"
+)
+
+// syncMetadata returns the document information and XMP packet to write,
+// each carrying the values of the other as semantic.SyncXMP describes.
+// Metadata that is not well-formed XMP is written unchanged, as is an
+// unchanged raw packet.
+func syncMetadata(info *semantic.DocumentInfo, md *semantic.XMPMetadata) (*semantic.DocumentInfo, []byte) {
+	if md == nil {
+		return info, nil
+	}
+	packet := md.Packet
+	if packet == nil {
+		p, err := xmp.Parse(md.Raw)
+		if err != nil {
+			return info, md.Raw
+		}
+		packet = p
+	} else {
+		packet = packet.Clone()
+	}
+	out, changed := semantic.SyncXMP(info, packet)
+	if md.Packet == nil && !changed {
+		return out, md.Raw
+	}
+	return out, packet.Marshal(xmp.DefaultPadding)
+}
@@ -0,0 +1,92 @@
+package writer
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/ir"
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/xmp"
+)
+
+func TestWriter_XMPSynchronizedWithInfo(t *testing.T) {
+	created := time.Date(2024, 3, 4, 5, 6, 7, 0, time.FixedZone("", 2*3600))
+	packet := xmp.New()
+	packet.SetTitle("Stale title")
+	packet.SetProducer("XMP Producer")
+	packet.SetModifyDate(created.Add(time.Hour))
+	packet.SetPDFAIdentification(2, "B")
+
+	b := builder.NewBuilder().
+		SetInfo(&semantic.DocumentInfo{Title: "Report", Author: "Ann", Keywords: []string{"a", "b"}, CreationDate: created, Trapped: "False"}).
+		SetXMP(packet)
+	b.NewPage(100, 100).Finish()
+	doc, err := b.Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := NewWriter().Write(context.Background(), doc, &buf, Config{Deterministic: true}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if packet.Title() != "Stale title" {
+		t.Errorf("writing modified the document's packet")
+	}
+
+	parsed, err := ir.NewDefault().Parse(context.Background(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	info := parsed.Info
+	if info == nil || info.Title != "Report" || info.Producer != "XMP Producer" || info.Trapped != "False" {
+		t.Fatalf("info = %+v", info)
+	}
+	if !info.CreationDate.Equal(created) || !info.ModDate.Equal(created.Add(time.Hour)) {
+		t.Errorf("dates = %v, %v", info.CreationDate, info.ModDate)
+	}
+	if parsed.Metadata == nil {
+		t.Fatalf("metadata missing")
+	}
+	got, err := parsed.Metadata.XMP()
+	if err != nil {
+		t.Fatalf("parse XMP: %v", err)
+	}
+	if got.Title() != "Report" || got.Keywords() != "a,b" || got.Trapped() != "False" {
+		t.Errorf("XMP title %q, keywords %q, trapped %q", got.Title(), got.Keywords(), got.Trapped())
+	}
+	if c := got.Creators(); len(c) != 1 || c[0] != "Ann" {
+		t.Errorf("creators = %v", c)
+	}
+	if d, ok := got.CreateDate(); !ok || xmp.FormatDate(d) != "2024-03-04T05:06:07+02:00" {
+		t.Errorf("create date = %v", d)
+	}
+	if part, conf := got.PDFAIdentification(); part != 2 || conf != "B" {
+		t.Errorf("PDF/A identification lost: %d%s", part, conf)
+	}
+}
+
+func TestWriter_RawMetadataKeptWhenInSync(t *testing.T) {
+	packet := xmp.New()
+	packet.SetTitle("Same")
+	data := packet.Marshal(100)
+	invalid := []byte("<x:xmpmeta>not RDF</x:xmpmeta>")
+
+	for _, raw := range [][]byte{data, invalid} {
+		b := builder.NewBuilder().SetInfo(&semantic.DocumentInfo{Title: "Same"}).SetMetadata(raw)
+		b.NewPage(100, 100).Finish()
+		doc, err := b.Build()
+		if err != nil {
+			t.Fatalf("build: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := NewWriter().Write(context.Background(), doc, &buf, Config{Deterministic: true}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if !bytes.Contains(buf.Bytes(), raw) {
+			t.Errorf("metadata stream rewritten: %q", raw)
+		}
+	}
+}
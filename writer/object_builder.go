@@ -2,10 +2,13 @@ package writer
 
 import (
 	"crypto/aes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"sort"
 	"strings"
 
+	"github.com/wudi/pdfkit/filters"
 	"github.com/wudi/pdfkit/ir/raw"
 	"github.com/wudi/pdfkit/ir/semantic"
 	"github.com/wudi/pdfkit/security"
@@ -22,8 +25,17 @@ type objectBuilder struct {
 	xobjectRefs map[string]raw.ObjectRef
 	patternRefs map[string]raw.ObjectRef
 	shadingRefs map[string]raw.ObjectRef
+	// jbig2GlobalsRefs holds the JBIG2Globals streams by content hash.
+	jbig2GlobalsRefs map[string]raw.ObjectRef
+	// propertyRefs keeps one object per property list, so that optional
+	// content groups are shared by resources and OCProperties.
+	propertyRefs map[semantic.PropertyList]raw.ObjectRef
 
 	pageRefs []raw.ObjectRef
+	// keepOriginals has fonts, XObjects and property lists read from a
+	// file and not modified since referred to by their original objects
+	// instead of written again, for incremental updates.
+	keepOriginals bool
 
 	annotSerializer  AnnotationSerializer
 	actionSerializer ActionSerializer
@@ -42,6 +54,9 @@ func newObjectBuilder(doc *semantic.Document, cfg Config, startObjNum int, fileI
 		xobjectRefs: make(map[string]raw.ObjectRef),
 		patternRefs: make(map[string]raw.ObjectRef),
 		shadingRefs: make(map[string]raw.ObjectRef),
+
+		jbig2GlobalsRefs: make(map[string]raw.ObjectRef),
+		propertyRefs:     make(map[semantic.PropertyList]raw.ObjectRef),
 	}
 	if actS != nil {
 		b.actionSerializer = actS
@@ -93,62 +108,34 @@ func (b *objectBuilder) Build() (map[raw.ObjectRef]raw.Object, raw.ObjectRef, *r
 	b.pageRefs = make([]raw.ObjectRef, 0, len(b.doc.Pages))
 	pageDicts := make([]*raw.DictObj, len(b.doc.Pages))
 
-	// Document info dictionary
-	var infoRef *raw.ObjectRef
-	if b.doc.Info != nil {
-		infoDict := raw.Dict()
-		if b.doc.Info.Title != "" {
-			infoDict.Set(raw.NameLiteral("Title"), raw.Str([]byte(b.doc.Info.Title)))
-		}
-		if b.doc.Info.Author != "" {
-			infoDict.Set(raw.NameLiteral("Author"), raw.Str([]byte(b.doc.Info.Author)))
-		}
-		if b.doc.Info.Subject != "" {
-			infoDict.Set(raw.NameLiteral("Subject"), raw.Str([]byte(b.doc.Info.Subject)))
-		}
-		if b.doc.Info.Creator != "" {
-			infoDict.Set(raw.NameLiteral("Creator"), raw.Str([]byte(b.doc.Info.Creator)))
-		}
-		if b.doc.Info.Producer != "" {
-			infoDict.Set(raw.NameLiteral("Producer"), raw.Str([]byte(b.doc.Info.Producer)))
-		}
-		if len(b.doc.Info.Keywords) > 0 {
-			infoDict.Set(raw.NameLiteral("Keywords"), raw.Str([]byte(strings.Join(b.doc.Info.Keywords, ","))))
-		}
-		if infoDict.Len() > 0 {
-			ref := b.nextRef()
-			infoRef = &ref
-			b.objects[ref] = infoDict
-		}
-	}
+	// Document info dictionary, kept in agreement with the XMP metadata
+	info, metadata := syncMetadata(b.doc.Info, b.doc.Metadata)
+	infoRef := b.addInfo(info)
 
 	// XMP metadata stream reference
-	var metadataRef *raw.ObjectRef
-	if b.doc.Metadata != nil && len(b.doc.Metadata.Raw) > 0 {
-		ref := b.nextRef()
-		metadataRef = &ref
-		dict := raw.Dict()
-		dict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Metadata"))
-		dict.Set(raw.NameLiteral("Subtype"), raw.NameLiteral("XML"))
-		dict.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(b.doc.Metadata.Raw))))
-		b.objects[ref] = raw.NewStream(dict, b.doc.Metadata.Raw)
-	}
+	metadataRef := b.addMetadata(metadata)
 
-	// Encrypt dictionary (Standard handler)
+	// Encrypt dictionary (Standard or public-key handler)
 	var encryptRef *raw.ObjectRef
 	var encryptionHandler security.Handler
 	if b.doc.Encrypted {
 		encOpts := security.NormalizeEncryptionOptions(b.cfg.Encryption)
-		if b.doc.EncryptionOptions.Algorithm != "" || b.doc.EncryptionOptions.KeyLength != 0 {
+		if b.doc.EncryptionOptions.Algorithm != "" || b.doc.EncryptionOptions.KeyLength != 0 || len(b.doc.EncryptionOptions.Recipients) > 0 {
 			encOpts = security.NormalizeEncryptionOptions(b.doc.EncryptionOptions)
 		}
 		ref := b.nextRef()
 		encryptRef = &ref
-		enc, _, err := security.BuildEncryption(b.doc.UserPassword, b.doc.OwnerPassword, b.doc.Permissions, b.fileID[0], encOpts, b.doc.MetadataEncrypted)
+		enc, key, err := security.BuildEncryption(b.doc.UserPassword, b.doc.OwnerPassword, b.doc.Permissions, b.fileID[0], encOpts, b.doc.MetadataEncrypted)
 		if err != nil {
 			return nil, raw.ObjectRef{}, nil, nil, err
 		}
-		handler, err := (&security.HandlerBuilder{}).WithEncryptDict(enc).WithFileID(b.fileID[0]).Build()
+		hb := (&security.HandlerBuilder{}).WithEncryptDict(enc).WithFileID(b.fileID[0])
+		if len(encOpts.Recipients) > 0 {
+			// Public-key handlers cannot re-derive the key without a
+			// recipient's private key.
+			hb.WithFileKey(key)
+		}
+		handler, err := hb.Build()
 		if err != nil {
 			return nil, raw.ObjectRef{}, nil, nil, err
 		}
@@ -169,39 +156,7 @@ func (b *objectBuilder) Build() (map[raw.ObjectRef]raw.Object, raw.ObjectRef, *r
 	}
 
 	// OutputIntents
-	var outputIntentRefs []raw.ObjectRef
-	for _, oi := range b.doc.OutputIntents {
-		dict := raw.Dict()
-		dict.Set(raw.NameLiteral("Type"), raw.NameLiteral("OutputIntent"))
-		if oi.S != "" {
-			dict.Set(raw.NameLiteral("S"), raw.NameLiteral(oi.S))
-		} else {
-			dict.Set(raw.NameLiteral("S"), raw.NameLiteral("GTS_PDFA1"))
-		}
-		if oi.OutputConditionIdentifier != "" {
-			dict.Set(raw.NameLiteral("OutputConditionIdentifier"), raw.Str([]byte(oi.OutputConditionIdentifier)))
-		} else {
-			dict.Set(raw.NameLiteral("OutputConditionIdentifier"), raw.Str([]byte("Custom")))
-		}
-		if oi.Info != "" {
-			dict.Set(raw.NameLiteral("Info"), raw.Str([]byte(oi.Info)))
-		}
-		var profileRef *raw.ObjectRef
-		if len(oi.DestOutputProfile) > 0 {
-			pr := b.nextRef()
-			profileRef = &pr
-			pd := raw.Dict()
-			pd.Set(raw.NameLiteral("N"), raw.NumberInt(3))
-			pd.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(oi.DestOutputProfile))))
-			b.objects[pr] = raw.NewStream(pd, oi.DestOutputProfile)
-		}
-		if profileRef != nil {
-			dict.Set(raw.NameLiteral("DestOutputProfile"), raw.Ref(profileRef.Num, profileRef.Gen))
-		}
-		ref := b.nextRef()
-		b.objects[ref] = dict
-		outputIntentRefs = append(outputIntentRefs, ref)
-	}
+	outputIntentRefs := b.addOutputIntents(b.doc.OutputIntents)
 
 	var embeddedFilesDict *raw.DictObj
 	var afFileSpecRefs []raw.ObjectRef
@@ -255,403 +210,24 @@ func (b *objectBuilder) Build() (map[raw.ObjectRef]raw.Object, raw.ObjectRef, *r
 	}
 
 	// Page content streams
-	contentRefs := []raw.ObjectRef{}
-	annotationRefs := make([][]raw.ObjectRef, len(b.doc.Pages))
+	contentRefs := make([]raw.ObjectRef, 0, len(b.doc.Pages))
 	for _, p := range b.doc.Pages {
-		contentData := []byte{}
-		for _, cs := range p.Contents {
-			contentData = append(contentData, serializeContentStream(cs)...)
-		}
-		streamData := contentData
-		contentRef := b.nextRef()
-		dict := raw.Dict()
-		switch filter := pickContentFilter(b.cfg); filter {
-		case FilterFlate:
-			data, err := flateEncode(streamData, b.cfg.Compression)
-			if err != nil {
-				return nil, raw.ObjectRef{}, nil, nil, err
-			}
-			streamData = data
-			dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("FlateDecode"))
-		case FilterASCIIHex:
-			streamData = asciiHexEncode(streamData)
-			dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("ASCIIHexDecode"))
-		case FilterASCII85:
-			streamData = ascii85Encode(streamData)
-			dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("ASCII85Decode"))
-		case FilterRunLength:
-			streamData = runLengthEncode(streamData)
-			dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("RunLengthDecode"))
-		case FilterLZW:
-			data, err := lzwEncode(streamData)
-			if err != nil {
-				return nil, raw.ObjectRef{}, nil, nil, err
-			}
-			streamData = data
-			dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("LZWDecode"))
-		case FilterJPX:
-			dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("JPXDecode"))
-		case FilterJBIG2:
-			dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("JBIG2Decode"))
+		ref, err := b.addContentStream(p)
+		if err != nil {
+			return nil, raw.ObjectRef{}, nil, nil, err
 		}
-		dict.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(streamData))))
-		b.objects[contentRef] = raw.NewStream(dict, streamData)
-		contentRefs = append(contentRefs, contentRef)
+		contentRefs = append(contentRefs, ref)
 	}
 	// Pages
-	unionFonts := raw.Dict()
-	unionExtGStates := raw.Dict()
-	unionColorSpaces := raw.Dict()
-	unionXObjects := raw.Dict()
-	unionPatterns := raw.Dict()
-	unionShadings := raw.Dict()
-	unionProperties := raw.Dict()
-	procEntries := map[string]bool{"PDF": true, "Text": true}
-	procSet := raw.NewArray(raw.NameLiteral("PDF"), raw.NameLiteral("Text"))
-	addProc := func(name string) {
-		if !procEntries[name] {
-			procEntries[name] = true
-			procSet.Append(raw.NameLiteral(name))
-		}
-	}
+	union := newResourceUnion()
 	for i, p := range b.doc.Pages {
 		ref := b.nextRef()
 		b.pageRefs = append(b.pageRefs, ref)
-		p.MediaBox = semantic.Rectangle{LLX: 0, LLY: 0, URX: p.MediaBox.URX, URY: p.MediaBox.URY}
-		pageDict := raw.Dict()
-		pageDict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Page"))
-		pageDict.Set(raw.NameLiteral("Parent"), raw.Ref(pagesRef.Num, pagesRef.Gen))
-		pageDicts[i] = pageDict
-		// MediaBox
-		pageDict.Set(raw.NameLiteral("MediaBox"), rectArray(p.MediaBox))
-		if cropSet(p.CropBox) {
-			pageDict.Set(raw.NameLiteral("CropBox"), rectArray(p.CropBox))
-		}
-		if cropSet(p.TrimBox) {
-			pageDict.Set(raw.NameLiteral("TrimBox"), rectArray(p.TrimBox))
-		}
-		if cropSet(p.BleedBox) {
-			pageDict.Set(raw.NameLiteral("BleedBox"), rectArray(p.BleedBox))
-		}
-		if cropSet(p.ArtBox) {
-			pageDict.Set(raw.NameLiteral("ArtBox"), rectArray(p.ArtBox))
-		}
-		if rot := normalizeRotation(p.Rotate); rot != 0 {
-			pageDict.Set(raw.NameLiteral("Rotate"), raw.NumberInt(int64(rot)))
-		}
-		if p.UserUnit > 0 {
-			pageDict.Set(raw.NameLiteral("UserUnit"), raw.NumberFloat(p.UserUnit))
-		}
-		if p.Trans != nil {
-			transDict := raw.Dict()
-			if p.Trans.Style != "" {
-				transDict.Set(raw.NameLiteral("S"), raw.NameLiteral(p.Trans.Style))
-			}
-			if p.Trans.Duration != nil {
-				transDict.Set(raw.NameLiteral("D"), raw.NumberFloat(*p.Trans.Duration))
-			}
-			if p.Trans.Dimension != "" {
-				transDict.Set(raw.NameLiteral("Dm"), raw.NameLiteral(p.Trans.Dimension))
-			}
-			if p.Trans.Motion != "" {
-				transDict.Set(raw.NameLiteral("M"), raw.NameLiteral(p.Trans.Motion))
-			}
-			if p.Trans.Direction != 0 {
-				transDict.Set(raw.NameLiteral("Di"), raw.NumberInt(int64(p.Trans.Direction)))
-			}
-			if p.Trans.Scale != nil {
-				transDict.Set(raw.NameLiteral("SS"), raw.NumberFloat(*p.Trans.Scale))
-			}
-			if p.Trans.Base != nil {
-				transDict.Set(raw.NameLiteral("B"), raw.Bool(*p.Trans.Base))
-			}
-			pageDict.Set(raw.NameLiteral("Trans"), transDict)
-		}
-		// Viewports
-		if len(p.Viewports) > 0 {
-			vpArr := raw.NewArray()
-			for _, vp := range p.Viewports {
-				vpDict := raw.Dict()
-				vpDict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Viewport"))
-				if len(vp.BBox) == 4 {
-					vpDict.Set(raw.NameLiteral("BBox"), raw.NewArray(
-						raw.NumberFloat(vp.BBox[0]),
-						raw.NumberFloat(vp.BBox[1]),
-						raw.NumberFloat(vp.BBox[2]),
-						raw.NumberFloat(vp.BBox[3]),
-					))
-				}
-				if vp.Name != "" {
-					vpDict.Set(raw.NameLiteral("Name"), raw.Str([]byte(vp.Name)))
-				}
-				if vp.Measure != nil {
-					mDict := raw.Dict()
-					mDict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Measure"))
-					if vp.Measure.Subtype != "" {
-						mDict.Set(raw.NameLiteral("Subtype"), raw.NameLiteral(vp.Measure.Subtype))
-					}
-					if len(vp.Measure.Bounds) > 0 {
-						arr := raw.NewArray()
-						for _, v := range vp.Measure.Bounds {
-							arr.Append(raw.NumberFloat(v))
-						}
-						mDict.Set(raw.NameLiteral("Bounds"), arr)
-					}
-					if len(vp.Measure.GPTS) > 0 {
-						arr := raw.NewArray()
-						for _, v := range vp.Measure.GPTS {
-							arr.Append(raw.NumberFloat(v))
-						}
-						mDict.Set(raw.NameLiteral("GPTS"), arr)
-					}
-					if len(vp.Measure.LPTS) > 0 {
-						arr := raw.NewArray()
-						for _, v := range vp.Measure.LPTS {
-							arr.Append(raw.NumberFloat(v))
-						}
-						mDict.Set(raw.NameLiteral("LPTS"), arr)
-					}
-					if vp.Measure.GCS != nil {
-						gcsDict := raw.Dict()
-						if vp.Measure.GCS.Type != "" {
-							gcsDict.Set(raw.NameLiteral("Type"), raw.NameLiteral(vp.Measure.GCS.Type))
-						}
-						if vp.Measure.GCS.WKT != "" {
-							gcsDict.Set(raw.NameLiteral("WKT"), raw.Str([]byte(vp.Measure.GCS.WKT)))
-						}
-						if vp.Measure.GCS.EPSG != 0 {
-							gcsDict.Set(raw.NameLiteral("EPSG"), raw.NumberInt(int64(vp.Measure.GCS.EPSG)))
-						}
-						mDict.Set(raw.NameLiteral("GCS"), gcsDict)
-					}
-					vpDict.Set(raw.NameLiteral("Measure"), mDict)
-				}
-				vpArr.Append(vpDict)
-			}
-			pageDict.Set(raw.NameLiteral("VP"), vpArr)
-		}
-		// OutputIntents (Page Level)
-		if len(p.OutputIntents) > 0 {
-			arr := raw.NewArray()
-			for _, oi := range p.OutputIntents {
-				dict := raw.Dict()
-				dict.Set(raw.NameLiteral("Type"), raw.NameLiteral("OutputIntent"))
-				if oi.S != "" {
-					dict.Set(raw.NameLiteral("S"), raw.NameLiteral(oi.S))
-				}
-				if oi.OutputConditionIdentifier != "" {
-					dict.Set(raw.NameLiteral("OutputConditionIdentifier"), raw.Str([]byte(oi.OutputConditionIdentifier)))
-				}
-				if oi.Info != "" {
-					dict.Set(raw.NameLiteral("Info"), raw.Str([]byte(oi.Info)))
-				}
-				var profileRef *raw.ObjectRef
-				if len(oi.DestOutputProfile) > 0 {
-					pr := b.nextRef()
-					profileRef = &pr
-					pd := raw.Dict()
-					pd.Set(raw.NameLiteral("N"), raw.NumberInt(3)) // Default to 3 components?
-					pd.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(oi.DestOutputProfile))))
-					b.objects[pr] = raw.NewStream(pd, oi.DestOutputProfile)
-				}
-				if profileRef != nil {
-					dict.Set(raw.NameLiteral("DestOutputProfile"), raw.Ref(profileRef.Num, profileRef.Gen))
-				}
-				ref := b.nextRef()
-				b.objects[ref] = dict
-				arr.Append(raw.Ref(ref.Num, ref.Gen))
-			}
-			pageDict.Set(raw.NameLiteral("OutputIntents"), arr)
-		}
-		// Associated Files (Page Level)
-		if len(p.AssociatedFiles) > 0 {
-			if af := SerializeAssociatedFiles(p.AssociatedFiles, b); af != nil {
-				pageDict.Set(raw.NameLiteral("AF"), af)
-			}
-		}
-		// Resources
-		resDict := raw.Dict()
-		fontResDict := raw.Dict()
-		if p.Resources != nil && len(p.Resources.Fonts) > 0 {
-			for name, font := range p.Resources.Fonts {
-				fRef := b.ensureFont(font)
-				fontResDict.Set(raw.NameLiteral(name), raw.Ref(fRef.Num, fRef.Gen))
-				unionFonts.Set(raw.NameLiteral(name), raw.Ref(fRef.Num, fRef.Gen))
-			}
-		} else {
-			fRef := b.ensureFont(nil)
-			fontResDict.Set(raw.NameLiteral("F1"), raw.Ref(fRef.Num, fRef.Gen))
-			if _, ok := unionFonts.KV["F1"]; !ok {
-				unionFonts.Set(raw.NameLiteral("F1"), raw.Ref(fRef.Num, fRef.Gen))
-			}
-		}
-		resDict.Set(raw.NameLiteral("Font"), fontResDict)
-		if p.Resources != nil && len(p.Resources.ExtGStates) > 0 {
-			gsDict := raw.Dict()
-			for name, gs := range p.Resources.ExtGStates {
-				entry := raw.Dict()
-				if gs.LineWidth != nil {
-					entry.Set(raw.NameLiteral("LW"), raw.NumberFloat(*gs.LineWidth))
-				}
-				if gs.StrokeAlpha != nil {
-					entry.Set(raw.NameLiteral("CA"), raw.NumberFloat(*gs.StrokeAlpha))
-				}
-				if gs.FillAlpha != nil {
-					entry.Set(raw.NameLiteral("ca"), raw.NumberFloat(*gs.FillAlpha))
-				}
-				if gs.BlendMode != "" {
-					entry.Set(raw.NameLiteral("BM"), raw.NameLiteral(gs.BlendMode))
-				}
-				if gs.AlphaSource != nil {
-					entry.Set(raw.NameLiteral("AIS"), raw.Bool(*gs.AlphaSource))
-				}
-				if gs.TextKnockout != nil {
-					entry.Set(raw.NameLiteral("TK"), raw.Bool(*gs.TextKnockout))
-				}
-				if gs.Overprint != nil {
-					entry.Set(raw.NameLiteral("OP"), raw.Bool(*gs.Overprint))
-				}
-				if gs.OverprintFill != nil {
-					entry.Set(raw.NameLiteral("op"), raw.Bool(*gs.OverprintFill))
-				}
-				if gs.OverprintMode != nil {
-					entry.Set(raw.NameLiteral("OPM"), raw.NumberInt(int64(*gs.OverprintMode)))
-				}
-				if gs.UseBlackPtComp != nil {
-					entry.Set(raw.NameLiteral("UseBlackPtComp"), raw.Bool(*gs.UseBlackPtComp))
-				}
-				if gs.SoftMask != nil {
-					smDict := raw.Dict()
-					smDict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Mask"))
-					smDict.Set(raw.NameLiteral("S"), raw.NameLiteral(gs.SoftMask.Subtype))
-					if gs.SoftMask.Group != nil {
-						gRef := b.ensureXObject("SMaskGroup", *gs.SoftMask.Group)
-						smDict.Set(raw.NameLiteral("G"), raw.Ref(gRef.Num, gRef.Gen))
-					}
-					if len(gs.SoftMask.BackdropColor) > 0 {
-						bc := raw.NewArray()
-						for _, c := range gs.SoftMask.BackdropColor {
-							bc.Append(raw.NumberFloat(c))
-						}
-						smDict.Set(raw.NameLiteral("BC"), bc)
-					}
-					if gs.SoftMask.Transfer != "" {
-						smDict.Set(raw.NameLiteral("TR"), raw.NameLiteral(gs.SoftMask.Transfer))
-					}
-					entry.Set(raw.NameLiteral("SMask"), smDict)
-				}
-				gsDict.Set(raw.NameLiteral(name), entry)
-				if _, ok := unionExtGStates.KV[name]; !ok {
-					unionExtGStates.Set(raw.NameLiteral(name), entry)
-				}
-			}
-			if gsDict.Len() > 0 {
-				resDict.Set(raw.NameLiteral("ExtGState"), gsDict)
-			}
-		}
-		if p.Resources != nil && len(p.Resources.ColorSpaces) > 0 {
-			csDict := raw.Dict()
-			for name, cs := range p.Resources.ColorSpaces {
-				obj := b.csSerializer.Serialize(cs, b)
-				csDict.Set(raw.NameLiteral(name), obj)
-				if _, ok := unionColorSpaces.KV[name]; !ok {
-					unionColorSpaces.Set(raw.NameLiteral(name), obj)
-				}
-			}
-			if csDict.Len() > 0 {
-				resDict.Set(raw.NameLiteral("ColorSpace"), csDict)
-			}
-		}
-		if p.Resources != nil && len(p.Resources.XObjects) > 0 {
-			xDict := raw.Dict()
-			for name, xo := range p.Resources.XObjects {
-				xref := b.ensureXObject(name, xo)
-				xDict.Set(raw.NameLiteral(name), raw.Ref(xref.Num, xref.Gen))
-				if _, ok := unionXObjects.KV[name]; !ok {
-					unionXObjects.Set(raw.NameLiteral(name), raw.Ref(xref.Num, xref.Gen))
-				}
-				if xo.Subtype == "Image" || xo.Subtype == "" {
-					if xo.ColorSpace != nil && xo.ColorSpace.ColorSpaceName() == "DeviceGray" {
-						addProc("ImageB")
-					} else {
-						addProc("ImageC")
-					}
-				}
-			}
-			if xDict.Len() > 0 {
-				resDict.Set(raw.NameLiteral("XObject"), xDict)
-			}
-		}
-		if p.Resources != nil && len(p.Resources.Patterns) > 0 {
-			patDict := raw.Dict()
-			for name, pat := range p.Resources.Patterns {
-				pRef := b.ensurePattern(name, pat)
-				patDict.Set(raw.NameLiteral(name), raw.Ref(pRef.Num, pRef.Gen))
-				if _, ok := unionPatterns.KV[name]; !ok {
-					unionPatterns.Set(raw.NameLiteral(name), raw.Ref(pRef.Num, pRef.Gen))
-				}
-			}
-			if patDict.Len() > 0 {
-				resDict.Set(raw.NameLiteral("Pattern"), patDict)
-			}
-		}
-		if p.Resources != nil && len(p.Resources.Shadings) > 0 {
-			shDict := raw.Dict()
-			for name, sh := range p.Resources.Shadings {
-				shRef := b.ensureShading(name, sh)
-				shDict.Set(raw.NameLiteral(name), raw.Ref(shRef.Num, shRef.Gen))
-				if _, ok := unionShadings.KV[name]; !ok {
-					unionShadings.Set(raw.NameLiteral(name), raw.Ref(shRef.Num, shRef.Gen))
-				}
-			}
-			if shDict.Len() > 0 {
-				resDict.Set(raw.NameLiteral("Shading"), shDict)
-			}
-		}
-		if p.Resources != nil && len(p.Resources.Properties) > 0 {
-			propDict := raw.Dict()
-			for name, prop := range p.Resources.Properties {
-				ref := b.ensurePropertyList(name, prop)
-				propDict.Set(raw.NameLiteral(name), raw.Ref(ref.Num, ref.Gen))
-				if _, ok := unionProperties.KV[name]; !ok {
-					unionProperties.Set(raw.NameLiteral(name), raw.Ref(ref.Num, ref.Gen))
-				}
-			}
-			if propDict.Len() > 0 {
-				resDict.Set(raw.NameLiteral("Properties"), propDict)
-			}
-		}
-		if procSet.Len() > 0 {
-			resDict.Set(raw.NameLiteral("ProcSet"), procSet)
-		}
-		pageDict.Set(raw.NameLiteral("Resources"), resDict)
-		// Contents
-		contentRef := contentRefs[i]
-		pageDict.Set(raw.NameLiteral("Contents"), raw.Ref(contentRef.Num, contentRef.Gen))
-
-		// Annotations
-		if len(p.Annotations) > 0 {
-			annotArr := raw.NewArray()
-			for _, a := range p.Annotations {
-				base := a.Base()
-				if !cropSet(base.RectVal) {
-					// fall back to crop/media box coordinates
-					if cropSet(p.CropBox) {
-						a.SetRect(p.CropBox)
-					} else {
-						a.SetRect(p.MediaBox)
-					}
-				}
-				aRef, err := b.annotSerializer.Serialize(a, b)
-				if err != nil {
-					return nil, raw.ObjectRef{}, nil, nil, err
-				}
-				annotArr.Append(raw.Ref(aRef.Num, aRef.Gen))
-				annotationRefs[i] = append(annotationRefs[i], aRef)
-			}
-			pageDict.Set(raw.NameLiteral("Annots"), annotArr)
+		pageDict, err := b.addPage(p, ref, pagesRef, contentRefs[i], union)
+		if err != nil {
+			return nil, raw.ObjectRef{}, nil, nil, err
 		}
-		b.objects[ref] = pageDict
+		pageDicts[i] = pageDict
 	}
 	// Pages tree
 	kidsArr := raw.NewArray()
@@ -662,29 +238,29 @@ func (b *objectBuilder) Build() (map[raw.ObjectRef]raw.Object, raw.ObjectRef, *r
 	pagesDict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Pages"))
 	pagesDict.Set(raw.NameLiteral("Count"), raw.NumberInt(int64(len(b.pageRefs))))
 	pagesDict.Set(raw.NameLiteral("Kids"), kidsArr)
-	if unionFonts.Len() > 0 {
+	if union.fonts.Len() > 0 {
 		pagesRes := raw.Dict()
-		pagesRes.Set(raw.NameLiteral("Font"), unionFonts)
-		if unionExtGStates.Len() > 0 {
-			pagesRes.Set(raw.NameLiteral("ExtGState"), unionExtGStates)
+		pagesRes.Set(raw.NameLiteral("Font"), union.fonts)
+		if union.extGStates.Len() > 0 {
+			pagesRes.Set(raw.NameLiteral("ExtGState"), union.extGStates)
 		}
-		if unionColorSpaces.Len() > 0 {
-			pagesRes.Set(raw.NameLiteral("ColorSpace"), unionColorSpaces)
+		if union.colorSpaces.Len() > 0 {
+			pagesRes.Set(raw.NameLiteral("ColorSpace"), union.colorSpaces)
 		}
-		if unionXObjects.Len() > 0 {
-			pagesRes.Set(raw.NameLiteral("XObject"), unionXObjects)
+		if union.xobjects.Len() > 0 {
+			pagesRes.Set(raw.NameLiteral("XObject"), union.xobjects)
 		}
-		if unionPatterns.Len() > 0 {
-			pagesRes.Set(raw.NameLiteral("Pattern"), unionPatterns)
+		if union.patterns.Len() > 0 {
+			pagesRes.Set(raw.NameLiteral("Pattern"), union.patterns)
 		}
-		if unionShadings.Len() > 0 {
-			pagesRes.Set(raw.NameLiteral("Shading"), unionShadings)
+		if union.shadings.Len() > 0 {
+			pagesRes.Set(raw.NameLiteral("Shading"), union.shadings)
 		}
-		if unionProperties.Len() > 0 {
-			pagesRes.Set(raw.NameLiteral("Properties"), unionProperties)
+		if union.properties.Len() > 0 {
+			pagesRes.Set(raw.NameLiteral("Properties"), union.properties)
 		}
-		if procSet.Len() > 0 {
-			pagesRes.Set(raw.NameLiteral("ProcSet"), procSet)
+		if union.procSet.Len() > 0 {
+			pagesRes.Set(raw.NameLiteral("ProcSet"), union.procSet)
 		}
 		pagesDict.Set(raw.NameLiteral("Resources"), pagesRes)
 	}
@@ -726,33 +302,11 @@ func (b *objectBuilder) Build() (map[raw.ObjectRef]raw.Object, raw.ObjectRef, *r
 		vp.Set(raw.NameLiteral("DisplayDocTitle"), raw.Bool(true))
 		catalogDict.Set(raw.NameLiteral("ViewerPreferences"), vp)
 	}
-	if len(b.doc.PageLabels) > 0 {
-		nums := raw.NewArray()
-		indices := make([]int, 0, len(b.doc.PageLabels))
-		for idx := range b.doc.PageLabels {
-			indices = append(indices, idx)
-		}
-		sort.Ints(indices)
-		for _, idx := range indices {
-			nums.Append(raw.NumberInt(int64(idx)))
-			entry := raw.Dict()
-			entry.Set(raw.NameLiteral("P"), raw.Str([]byte(b.doc.PageLabels[idx])))
-			nums.Append(entry)
-		}
-		labels := raw.Dict()
-		labels.Set(raw.NameLiteral("Nums"), nums)
+	if labels := pageLabelsDict(b.doc.PageLabels); labels != nil {
 		catalogDict.Set(raw.NameLiteral("PageLabels"), labels)
 	}
 	if len(b.doc.Outlines) > 0 {
-		outlineRef := b.nextRef()
-		outlineDict := raw.Dict()
-		outlineDict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Outlines"))
-		b.objects[outlineRef] = outlineDict
-
-		first, last, total := b.buildOutlines(b.doc.Outlines, outlineRef, b.pageRefs, b.objects, b.nextRef, outlineRef)
-		outlineDict.Set(raw.NameLiteral("First"), raw.Ref(first.Num, first.Gen))
-		outlineDict.Set(raw.NameLiteral("Last"), raw.Ref(last.Num, last.Gen))
-		outlineDict.Set(raw.NameLiteral("Count"), raw.NumberInt(total))
+		outlineRef := b.addOutlines(b.doc.Outlines)
 		catalogDict.Set(raw.NameLiteral("Outlines"), raw.Ref(outlineRef.Num, outlineRef.Gen))
 		catalogDict.Set(raw.NameLiteral("PageMode"), raw.NameLiteral("UseOutlines"))
 	}
@@ -787,141 +341,716 @@ func (b *objectBuilder) Build() (map[raw.ObjectRef]raw.Object, raw.ObjectRef, *r
 					prev := beadRefs[i-1]
 					bd.Set(raw.NameLiteral("V"), raw.Ref(prev.Num, prev.Gen))
 				}
-				if i < len(beadRefs)-1 {
-					nextBead := beadRefs[i+1]
-					bd.Set(raw.NameLiteral("N"), raw.Ref(nextBead.Num, nextBead.Gen))
+				if i < len(beadRefs)-1 {
+					nextBead := beadRefs[i+1]
+					bd.Set(raw.NameLiteral("N"), raw.Ref(nextBead.Num, nextBead.Gen))
+				}
+				b.objects[beadRefs[i]] = bd
+			}
+			threadDict.Set(raw.NameLiteral("K"), raw.Ref(beadRefs[0].Num, beadRefs[0].Gen))
+			b.objects[threadRef] = threadDict
+		}
+		if threadArr.Len() > 0 {
+			catalogDict.Set(raw.NameLiteral("Threads"), threadArr)
+		}
+	}
+	if b.doc.AcroForm != nil {
+		formRef := b.nextRef()
+		formDict := raw.Dict()
+		fieldsArr := raw.NewArray()
+		fieldRefMap := make(map[semantic.FormField]raw.ObjectRef)
+
+		appendWidgetToPage := func(pageIdx int, ref raw.ObjectRef) {
+			if pageIdx < 0 || pageIdx >= len(b.pageRefs) {
+				return
+			}
+			pref := b.pageRefs[pageIdx]
+			pageObj := b.objects[pref]
+			pd, ok := pageObj.(*raw.DictObj)
+			if !ok {
+				return
+			}
+			if annotsVal, ok := pd.Get(raw.NameLiteral("Annots")); ok {
+				if arr, ok := annotsVal.(*raw.ArrayObj); ok {
+					arr.Append(raw.Ref(ref.Num, ref.Gen))
+					return
+				}
+			}
+			arr := raw.NewArray()
+			arr.Append(raw.Ref(ref.Num, ref.Gen))
+			pd.Set(raw.NameLiteral("Annots"), arr)
+		}
+		for _, f := range b.doc.AcroForm.Fields {
+			fieldRef, err := b.addFormField(f)
+			if err != nil {
+				return nil, raw.ObjectRef{}, nil, nil, err
+			}
+			fieldRefMap[f] = fieldRef
+			appendWidgetToPage(f.FieldPageIndex(), fieldRef)
+
+			fieldsArr.Append(raw.Ref(fieldRef.Num, fieldRef.Gen))
+		}
+		formDict.Set(raw.NameLiteral("Fields"), fieldsArr)
+		if b.doc.AcroForm.NeedAppearances {
+			formDict.Set(raw.NameLiteral("NeedAppearances"), raw.Bool(true))
+		}
+		if dr := b.doc.AcroForm.DefaultResources; dr != nil {
+			if resDict := b.serializeResources(dr); resDict != nil {
+				formDict.Set(raw.NameLiteral("DR"), resDict)
+			}
+		}
+		if len(b.doc.AcroForm.CalculationOrder) > 0 {
+			coArr := raw.NewArray()
+			for _, f := range b.doc.AcroForm.CalculationOrder {
+				if ref, ok := fieldRefMap[f]; ok {
+					coArr.Append(raw.Ref(ref.Num, ref.Gen))
+				}
+			}
+			if coArr.Len() > 0 {
+				formDict.Set(raw.NameLiteral("CO"), coArr)
+			}
+		}
+		b.objects[formRef] = formDict
+		catalogDict.Set(raw.NameLiteral("AcroForm"), raw.Ref(formRef.Num, formRef.Gen))
+	}
+	if ocProps := b.serializeOCProperties(); ocProps != nil {
+		catalogDict.Set(raw.NameLiteral("OCProperties"), ocProps)
+	}
+	if len(outputIntentRefs) > 0 {
+		arr := raw.NewArray()
+		for _, ref := range outputIntentRefs {
+			arr.Append(raw.Ref(ref.Num, ref.Gen))
+		}
+		catalogDict.Set(raw.NameLiteral("OutputIntents"), arr)
+	}
+	if embeddedFilesDict != nil {
+		if namesObj, ok := catalogDict.Get(raw.NameLiteral("Names")); ok {
+			if namesDict, ok := namesObj.(*raw.DictObj); ok {
+				namesDict.Set(raw.NameLiteral("EmbeddedFiles"), embeddedFilesDict)
+			}
+		} else {
+			namesDict := raw.Dict()
+			namesDict.Set(raw.NameLiteral("EmbeddedFiles"), embeddedFilesDict)
+			catalogDict.Set(raw.NameLiteral("Names"), namesDict)
+		}
+	}
+	if len(afFileSpecRefs) > 0 {
+		afArr := raw.NewArray()
+		for _, ref := range afFileSpecRefs {
+			afArr.Append(raw.Ref(ref.Num, ref.Gen))
+		}
+		catalogDict.Set(raw.NameLiteral("AF"), afArr)
+	}
+	b.objects[catalogRef] = catalogDict
+
+	if encryptionHandler != nil {
+		for ref, obj := range b.objects {
+			if encryptRef != nil && ref == *encryptRef {
+				continue
+			}
+			if metadataRef != nil && ref == *metadataRef && !b.doc.MetadataEncrypted {
+				continue
+			}
+			encObj, err := encryptObject(obj, ref, encryptionHandler, metadataRef, b.doc.MetadataEncrypted)
+			if err != nil {
+				return nil, raw.ObjectRef{}, nil, nil, err
+			}
+			b.objects[ref] = encObj
+		}
+	}
+
+	return b.objects, catalogRef, infoRef, encryptRef, nil
+}
+
+// addFormField adds f as a field dictionary merged with its widget
+// annotation, pointing at the page the widget sits on.
+func (b *objectBuilder) addFormField(f semantic.FormField) (raw.ObjectRef, error) {
+	widget := &semantic.WidgetAnnotation{
+		BaseAnnotation: semantic.BaseAnnotation{
+			Subtype:         "Widget",
+			RectVal:         f.FieldRect(),
+			Flags:           widgetFlags(f),
+			Appearance:      f.GetAppearance(),
+			AppearanceForm:  f.GetAppearanceForm(),
+			AppearanceState: f.GetAppearanceState(),
+			Border:          f.GetBorder(),
+			BorderStyle:     f.GetBorderStyle(),
+			Color:           f.GetColor(),
+		},
+		Field: f,
+	}
+	fieldRef, err := b.annotSerializer.Serialize(widget, b)
+	if err != nil {
+		return raw.ObjectRef{}, err
+	}
+	// The serializer does not know the page of the widget.
+	if pref := b.PageRef(f.FieldPageIndex()); pref != nil {
+		if dict, ok := b.objects[fieldRef].(*raw.DictObj); ok {
+			dict.Set(raw.NameLiteral("P"), raw.Ref(pref.Num, pref.Gen))
+		}
+	}
+	return fieldRef, nil
+}
+
+// widgetFlags returns the F entry of the widget of f: its annotation
+// flags or, when none are set, its field flags, which were written as the
+// widget flags before fields carried annotation flags of their own.
+func widgetFlags(f semantic.FormField) int {
+	if flags := f.GetAnnotationFlags(); flags != 0 {
+		return flags
+	}
+	return f.FieldFlags()
+}
+
+// pageLabelsDict returns the page label number tree for labels, keyed by
+// the index of the first page of each range, or nil when there are none.
+func pageLabelsDict(labels map[int]string) *raw.DictObj {
+	if len(labels) == 0 {
+		return nil
+	}
+	nums := raw.NewArray()
+	indices := make([]int, 0, len(labels))
+	for idx := range labels {
+		indices = append(indices, idx)
+	}
+	sort.Ints(indices)
+	for _, idx := range indices {
+		nums.Append(raw.NumberInt(int64(idx)))
+		entry := raw.Dict()
+		entry.Set(raw.NameLiteral("P"), raw.Str([]byte(labels[idx])))
+		nums.Append(entry)
+	}
+	dict := raw.Dict()
+	dict.Set(raw.NameLiteral("Nums"), nums)
+	return dict
+}
+
+// addOutlines adds the outline dictionary and its items, which refer to
+// pages through b.pageRefs.
+func (b *objectBuilder) addOutlines(items []semantic.OutlineItem) raw.ObjectRef {
+	outlineRef := b.nextRef()
+	outlineDict := raw.Dict()
+	outlineDict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Outlines"))
+	b.objects[outlineRef] = outlineDict
+
+	first, last, total := b.buildOutlines(items, outlineRef, b.pageRefs, b.objects, b.nextRef, outlineRef)
+	outlineDict.Set(raw.NameLiteral("First"), raw.Ref(first.Num, first.Gen))
+	outlineDict.Set(raw.NameLiteral("Last"), raw.Ref(last.Num, last.Gen))
+	outlineDict.Set(raw.NameLiteral("Count"), raw.NumberInt(total))
+	return outlineRef
+}
+
+// addInfo adds the document information dictionary, or nothing when info
+// has no entries.
+func (b *objectBuilder) addInfo(info *semantic.DocumentInfo) *raw.ObjectRef {
+	if info == nil {
+		return nil
+	}
+	infoDict := raw.Dict()
+	if info.Title != "" {
+		infoDict.Set(raw.NameLiteral("Title"), raw.Str([]byte(info.Title)))
+	}
+	if info.Author != "" {
+		infoDict.Set(raw.NameLiteral("Author"), raw.Str([]byte(info.Author)))
+	}
+	if info.Subject != "" {
+		infoDict.Set(raw.NameLiteral("Subject"), raw.Str([]byte(info.Subject)))
+	}
+	if info.Creator != "" {
+		infoDict.Set(raw.NameLiteral("Creator"), raw.Str([]byte(info.Creator)))
+	}
+	if info.Producer != "" {
+		infoDict.Set(raw.NameLiteral("Producer"), raw.Str([]byte(info.Producer)))
+	}
+	if len(info.Keywords) > 0 {
+		infoDict.Set(raw.NameLiteral("Keywords"), raw.Str([]byte(strings.Join(info.Keywords, ","))))
+	}
+	if !info.CreationDate.IsZero() {
+		infoDict.Set(raw.NameLiteral("CreationDate"), raw.Str([]byte(formatDate(info.CreationDate))))
+	}
+	if !info.ModDate.IsZero() {
+		infoDict.Set(raw.NameLiteral("ModDate"), raw.Str([]byte(formatDate(info.ModDate))))
+	}
+	if info.Trapped != "" {
+		infoDict.Set(raw.NameLiteral("Trapped"), raw.NameLiteral(info.Trapped))
+	}
+	if infoDict.Len() == 0 {
+		return nil
+	}
+	ref := b.nextRef()
+	b.objects[ref] = infoDict
+	return &ref
+}
+
+// addMetadata adds the XMP metadata stream, if there is one.
+func (b *objectBuilder) addMetadata(metadata []byte) *raw.ObjectRef {
+	if len(metadata) == 0 {
+		return nil
+	}
+	ref := b.nextRef()
+	dict := raw.Dict()
+	dict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Metadata"))
+	dict.Set(raw.NameLiteral("Subtype"), raw.NameLiteral("XML"))
+	dict.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(metadata))))
+	b.objects[ref] = raw.NewStream(dict, metadata)
+	return &ref
+}
+
+// addOutputIntents adds the document output intents.
+func (b *objectBuilder) addOutputIntents(intents []semantic.OutputIntent) []raw.ObjectRef {
+	var outputIntentRefs []raw.ObjectRef
+	for _, oi := range intents {
+		dict := raw.Dict()
+		dict.Set(raw.NameLiteral("Type"), raw.NameLiteral("OutputIntent"))
+		if oi.S != "" {
+			dict.Set(raw.NameLiteral("S"), raw.NameLiteral(oi.S))
+		} else {
+			dict.Set(raw.NameLiteral("S"), raw.NameLiteral("GTS_PDFA1"))
+		}
+		if oi.OutputConditionIdentifier != "" {
+			dict.Set(raw.NameLiteral("OutputConditionIdentifier"), raw.Str([]byte(oi.OutputConditionIdentifier)))
+		} else {
+			dict.Set(raw.NameLiteral("OutputConditionIdentifier"), raw.Str([]byte("Custom")))
+		}
+		if oi.Info != "" {
+			dict.Set(raw.NameLiteral("Info"), raw.Str([]byte(oi.Info)))
+		}
+		var profileRef *raw.ObjectRef
+		if len(oi.DestOutputProfile) > 0 {
+			pr := b.nextRef()
+			profileRef = &pr
+			pd := raw.Dict()
+			pd.Set(raw.NameLiteral("N"), raw.NumberInt(3))
+			pd.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(oi.DestOutputProfile))))
+			b.objects[pr] = raw.NewStream(pd, oi.DestOutputProfile)
+		}
+		if profileRef != nil {
+			dict.Set(raw.NameLiteral("DestOutputProfile"), raw.Ref(profileRef.Num, profileRef.Gen))
+		}
+		ref := b.nextRef()
+		b.objects[ref] = dict
+		outputIntentRefs = append(outputIntentRefs, ref)
+	}
+	return outputIntentRefs
+}
+
+// addContentStream adds the content stream of p, its streams joined into
+// one and encoded with the configured filter.
+func (b *objectBuilder) addContentStream(p *semantic.Page) (raw.ObjectRef, error) {
+	contentData := []byte{}
+	for _, cs := range p.Contents {
+		data := serializeContentStream(cs)
+		if n := len(contentData); n > 0 && len(data) > 0 && !isContentSpace(contentData[n-1]) {
+			// Keep the last token of one stream from running into the next.
+			contentData = append(contentData, '\n')
+		}
+		contentData = append(contentData, data...)
+	}
+	streamData := contentData
+	contentRef := b.nextRef()
+	dict := raw.Dict()
+	switch filter := pickContentFilter(b.cfg); filter {
+	case FilterFlate, FilterJPX, FilterJBIG2, FilterCCITTFax:
+		// The image codecs do not apply to content streams.
+		data, err := flateEncode(streamData, b.cfg)
+		if err != nil {
+			return raw.ObjectRef{}, err
+		}
+		streamData = data
+		dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("FlateDecode"))
+	case FilterASCIIHex:
+		streamData = asciiHexEncode(streamData)
+		dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("ASCIIHexDecode"))
+	case FilterASCII85:
+		streamData = ascii85Encode(streamData)
+		dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("ASCII85Decode"))
+	case FilterRunLength:
+		streamData = runLengthEncode(streamData)
+		dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("RunLengthDecode"))
+	case FilterLZW:
+		data, err := lzwEncode(streamData)
+		if err != nil {
+			return raw.ObjectRef{}, err
+		}
+		streamData = data
+		dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("LZWDecode"))
+	}
+	dict.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(streamData))))
+	b.objects[contentRef] = raw.NewStream(dict, streamData)
+	return contentRef, nil
+}
+
+// resourceUnion merges the resources of the pages of a document, which
+// the page tree root carries for readers that look there.
+type resourceUnion struct {
+	fonts, extGStates, colorSpaces, xobjects *raw.DictObj
+	patterns, shadings, properties           *raw.DictObj
+	procSet                                  *raw.ArrayObj
+	procEntries                              map[string]bool
+}
+
+func newResourceUnion() *resourceUnion {
+	return &resourceUnion{
+		fonts:       raw.Dict(),
+		extGStates:  raw.Dict(),
+		colorSpaces: raw.Dict(),
+		xobjects:    raw.Dict(),
+		patterns:    raw.Dict(),
+		shadings:    raw.Dict(),
+		properties:  raw.Dict(),
+		procSet:     raw.NewArray(raw.NameLiteral("PDF"), raw.NameLiteral("Text")),
+		procEntries: map[string]bool{"PDF": true, "Text": true},
+	}
+}
+
+func (u *resourceUnion) addProc(name string) {
+	if !u.procEntries[name] {
+		u.procEntries[name] = true
+		u.procSet.Append(raw.NameLiteral(name))
+	}
+}
+
+// addPage adds the page object ref of p, a kid of parent drawn by the
+// content stream content. The resources it uses are merged into union.
+func (b *objectBuilder) addPage(p *semantic.Page, ref, parent, content raw.ObjectRef, union *resourceUnion) (*raw.DictObj, error) {
+	p.MediaBox = semantic.Rectangle{LLX: 0, LLY: 0, URX: p.MediaBox.URX, URY: p.MediaBox.URY}
+	pageDict := raw.Dict()
+	pageDict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Page"))
+	pageDict.Set(raw.NameLiteral("Parent"), raw.Ref(parent.Num, parent.Gen))
+	// MediaBox
+	pageDict.Set(raw.NameLiteral("MediaBox"), rectArray(p.MediaBox))
+	if cropSet(p.CropBox) {
+		pageDict.Set(raw.NameLiteral("CropBox"), rectArray(p.CropBox))
+	}
+	if cropSet(p.TrimBox) {
+		pageDict.Set(raw.NameLiteral("TrimBox"), rectArray(p.TrimBox))
+	}
+	if cropSet(p.BleedBox) {
+		pageDict.Set(raw.NameLiteral("BleedBox"), rectArray(p.BleedBox))
+	}
+	if cropSet(p.ArtBox) {
+		pageDict.Set(raw.NameLiteral("ArtBox"), rectArray(p.ArtBox))
+	}
+	if rot := normalizeRotation(p.Rotate); rot != 0 {
+		pageDict.Set(raw.NameLiteral("Rotate"), raw.NumberInt(int64(rot)))
+	}
+	if p.UserUnit > 0 {
+		pageDict.Set(raw.NameLiteral("UserUnit"), raw.NumberFloat(p.UserUnit))
+	}
+	if p.Trans != nil {
+		transDict := raw.Dict()
+		if p.Trans.Style != "" {
+			transDict.Set(raw.NameLiteral("S"), raw.NameLiteral(p.Trans.Style))
+		}
+		if p.Trans.Duration != nil {
+			transDict.Set(raw.NameLiteral("D"), raw.NumberFloat(*p.Trans.Duration))
+		}
+		if p.Trans.Dimension != "" {
+			transDict.Set(raw.NameLiteral("Dm"), raw.NameLiteral(p.Trans.Dimension))
+		}
+		if p.Trans.Motion != "" {
+			transDict.Set(raw.NameLiteral("M"), raw.NameLiteral(p.Trans.Motion))
+		}
+		if p.Trans.Direction != 0 {
+			transDict.Set(raw.NameLiteral("Di"), raw.NumberInt(int64(p.Trans.Direction)))
+		}
+		if p.Trans.Scale != nil {
+			transDict.Set(raw.NameLiteral("SS"), raw.NumberFloat(*p.Trans.Scale))
+		}
+		if p.Trans.Base != nil {
+			transDict.Set(raw.NameLiteral("B"), raw.Bool(*p.Trans.Base))
+		}
+		pageDict.Set(raw.NameLiteral("Trans"), transDict)
+	}
+	// Viewports
+	if len(p.Viewports) > 0 {
+		vpArr := raw.NewArray()
+		for _, vp := range p.Viewports {
+			vpDict := raw.Dict()
+			vpDict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Viewport"))
+			if len(vp.BBox) == 4 {
+				vpDict.Set(raw.NameLiteral("BBox"), raw.NewArray(
+					raw.NumberFloat(vp.BBox[0]),
+					raw.NumberFloat(vp.BBox[1]),
+					raw.NumberFloat(vp.BBox[2]),
+					raw.NumberFloat(vp.BBox[3]),
+				))
+			}
+			if vp.Name != "" {
+				vpDict.Set(raw.NameLiteral("Name"), raw.Str([]byte(vp.Name)))
+			}
+			if vp.Measure != nil {
+				mDict := raw.Dict()
+				mDict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Measure"))
+				if vp.Measure.Subtype != "" {
+					mDict.Set(raw.NameLiteral("Subtype"), raw.NameLiteral(vp.Measure.Subtype))
+				}
+				if len(vp.Measure.Bounds) > 0 {
+					arr := raw.NewArray()
+					for _, v := range vp.Measure.Bounds {
+						arr.Append(raw.NumberFloat(v))
+					}
+					mDict.Set(raw.NameLiteral("Bounds"), arr)
+				}
+				if len(vp.Measure.GPTS) > 0 {
+					arr := raw.NewArray()
+					for _, v := range vp.Measure.GPTS {
+						arr.Append(raw.NumberFloat(v))
+					}
+					mDict.Set(raw.NameLiteral("GPTS"), arr)
+				}
+				if len(vp.Measure.LPTS) > 0 {
+					arr := raw.NewArray()
+					for _, v := range vp.Measure.LPTS {
+						arr.Append(raw.NumberFloat(v))
+					}
+					mDict.Set(raw.NameLiteral("LPTS"), arr)
+				}
+				if vp.Measure.GCS != nil {
+					gcsDict := raw.Dict()
+					if vp.Measure.GCS.Type != "" {
+						gcsDict.Set(raw.NameLiteral("Type"), raw.NameLiteral(vp.Measure.GCS.Type))
+					}
+					if vp.Measure.GCS.WKT != "" {
+						gcsDict.Set(raw.NameLiteral("WKT"), raw.Str([]byte(vp.Measure.GCS.WKT)))
+					}
+					if vp.Measure.GCS.EPSG != 0 {
+						gcsDict.Set(raw.NameLiteral("EPSG"), raw.NumberInt(int64(vp.Measure.GCS.EPSG)))
+					}
+					mDict.Set(raw.NameLiteral("GCS"), gcsDict)
+				}
+				vpDict.Set(raw.NameLiteral("Measure"), mDict)
+			}
+			vpArr.Append(vpDict)
+		}
+		pageDict.Set(raw.NameLiteral("VP"), vpArr)
+	}
+	// OutputIntents (Page Level)
+	if len(p.OutputIntents) > 0 {
+		arr := raw.NewArray()
+		for _, oi := range p.OutputIntents {
+			dict := raw.Dict()
+			dict.Set(raw.NameLiteral("Type"), raw.NameLiteral("OutputIntent"))
+			if oi.S != "" {
+				dict.Set(raw.NameLiteral("S"), raw.NameLiteral(oi.S))
+			}
+			if oi.OutputConditionIdentifier != "" {
+				dict.Set(raw.NameLiteral("OutputConditionIdentifier"), raw.Str([]byte(oi.OutputConditionIdentifier)))
+			}
+			if oi.Info != "" {
+				dict.Set(raw.NameLiteral("Info"), raw.Str([]byte(oi.Info)))
+			}
+			var profileRef *raw.ObjectRef
+			if len(oi.DestOutputProfile) > 0 {
+				pr := b.nextRef()
+				profileRef = &pr
+				pd := raw.Dict()
+				pd.Set(raw.NameLiteral("N"), raw.NumberInt(3)) // Default to 3 components?
+				pd.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(oi.DestOutputProfile))))
+				b.objects[pr] = raw.NewStream(pd, oi.DestOutputProfile)
+			}
+			if profileRef != nil {
+				dict.Set(raw.NameLiteral("DestOutputProfile"), raw.Ref(profileRef.Num, profileRef.Gen))
+			}
+			ref := b.nextRef()
+			b.objects[ref] = dict
+			arr.Append(raw.Ref(ref.Num, ref.Gen))
+		}
+		pageDict.Set(raw.NameLiteral("OutputIntents"), arr)
+	}
+	// Associated Files (Page Level)
+	if len(p.AssociatedFiles) > 0 {
+		if af := SerializeAssociatedFiles(p.AssociatedFiles, b); af != nil {
+			pageDict.Set(raw.NameLiteral("AF"), af)
+		}
+	}
+	// Resources
+	resDict := raw.Dict()
+	fontResDict := raw.Dict()
+	if p.Resources != nil && len(p.Resources.Fonts) > 0 {
+		for name, font := range p.Resources.Fonts {
+			fRef := b.ensureFont(font)
+			fontResDict.Set(raw.NameLiteral(name), raw.Ref(fRef.Num, fRef.Gen))
+			union.fonts.Set(raw.NameLiteral(name), raw.Ref(fRef.Num, fRef.Gen))
+		}
+	} else {
+		fRef := b.ensureFont(nil)
+		fontResDict.Set(raw.NameLiteral("F1"), raw.Ref(fRef.Num, fRef.Gen))
+		if _, ok := union.fonts.KV["F1"]; !ok {
+			union.fonts.Set(raw.NameLiteral("F1"), raw.Ref(fRef.Num, fRef.Gen))
+		}
+	}
+	resDict.Set(raw.NameLiteral("Font"), fontResDict)
+	if p.Resources != nil && len(p.Resources.ExtGStates) > 0 {
+		gsDict := raw.Dict()
+		for name, gs := range p.Resources.ExtGStates {
+			entry := raw.Dict()
+			if gs.LineWidth != nil {
+				entry.Set(raw.NameLiteral("LW"), raw.NumberFloat(*gs.LineWidth))
+			}
+			if gs.StrokeAlpha != nil {
+				entry.Set(raw.NameLiteral("CA"), raw.NumberFloat(*gs.StrokeAlpha))
+			}
+			if gs.FillAlpha != nil {
+				entry.Set(raw.NameLiteral("ca"), raw.NumberFloat(*gs.FillAlpha))
+			}
+			if gs.BlendMode != "" {
+				entry.Set(raw.NameLiteral("BM"), raw.NameLiteral(gs.BlendMode))
+			}
+			if gs.AlphaSource != nil {
+				entry.Set(raw.NameLiteral("AIS"), raw.Bool(*gs.AlphaSource))
+			}
+			if gs.TextKnockout != nil {
+				entry.Set(raw.NameLiteral("TK"), raw.Bool(*gs.TextKnockout))
+			}
+			if gs.Overprint != nil {
+				entry.Set(raw.NameLiteral("OP"), raw.Bool(*gs.Overprint))
+			}
+			if gs.OverprintFill != nil {
+				entry.Set(raw.NameLiteral("op"), raw.Bool(*gs.OverprintFill))
+			}
+			if gs.OverprintMode != nil {
+				entry.Set(raw.NameLiteral("OPM"), raw.NumberInt(int64(*gs.OverprintMode)))
+			}
+			if gs.UseBlackPtComp != nil {
+				entry.Set(raw.NameLiteral("UseBlackPtComp"), raw.Bool(*gs.UseBlackPtComp))
+			}
+			if gs.SoftMask != nil && gs.SoftMask.Subtype == "None" {
+				entry.Set(raw.NameLiteral("SMask"), raw.NameLiteral("None"))
+			} else if gs.SoftMask != nil {
+				smDict := raw.Dict()
+				smDict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Mask"))
+				smDict.Set(raw.NameLiteral("S"), raw.NameLiteral(gs.SoftMask.Subtype))
+				if gs.SoftMask.Group != nil {
+					gRef := b.ensureXObject("SMaskGroup", *gs.SoftMask.Group)
+					smDict.Set(raw.NameLiteral("G"), raw.Ref(gRef.Num, gRef.Gen))
+				}
+				if len(gs.SoftMask.BackdropColor) > 0 {
+					bc := raw.NewArray()
+					for _, c := range gs.SoftMask.BackdropColor {
+						bc.Append(raw.NumberFloat(c))
+					}
+					smDict.Set(raw.NameLiteral("BC"), bc)
 				}
-				b.objects[beadRefs[i]] = bd
+				if gs.SoftMask.TransferFunction != nil {
+					trRef := b.funcSerializer.Serialize(gs.SoftMask.TransferFunction, b)
+					smDict.Set(raw.NameLiteral("TR"), raw.Ref(trRef.Num, trRef.Gen))
+				} else if gs.SoftMask.Transfer != "" {
+					smDict.Set(raw.NameLiteral("TR"), raw.NameLiteral(gs.SoftMask.Transfer))
+				}
+				entry.Set(raw.NameLiteral("SMask"), smDict)
+			}
+			gsDict.Set(raw.NameLiteral(name), entry)
+			if _, ok := union.extGStates.KV[name]; !ok {
+				union.extGStates.Set(raw.NameLiteral(name), entry)
 			}
-			threadDict.Set(raw.NameLiteral("K"), raw.Ref(beadRefs[0].Num, beadRefs[0].Gen))
-			b.objects[threadRef] = threadDict
 		}
-		if threadArr.Len() > 0 {
-			catalogDict.Set(raw.NameLiteral("Threads"), threadArr)
+		if gsDict.Len() > 0 {
+			resDict.Set(raw.NameLiteral("ExtGState"), gsDict)
 		}
 	}
-	if b.doc.AcroForm != nil {
-		formRef := b.nextRef()
-		formDict := raw.Dict()
-		fieldsArr := raw.NewArray()
-		fieldRefMap := make(map[semantic.FormField]raw.ObjectRef)
-
-		appendWidgetToPage := func(pageIdx int, ref raw.ObjectRef) {
-			if pageIdx < 0 || pageIdx >= len(b.pageRefs) {
-				return
-			}
-			pref := b.pageRefs[pageIdx]
-			pageObj := b.objects[pref]
-			pd, ok := pageObj.(*raw.DictObj)
-			if !ok {
-				return
-			}
-			if annotsVal, ok := pd.Get(raw.NameLiteral("Annots")); ok {
-				if arr, ok := annotsVal.(*raw.ArrayObj); ok {
-					arr.Append(raw.Ref(ref.Num, ref.Gen))
-					return
-				}
+	if p.Resources != nil && len(p.Resources.ColorSpaces) > 0 {
+		csDict := raw.Dict()
+		for name, cs := range p.Resources.ColorSpaces {
+			obj := b.csSerializer.Serialize(cs, b)
+			csDict.Set(raw.NameLiteral(name), obj)
+			if _, ok := union.colorSpaces.KV[name]; !ok {
+				union.colorSpaces.Set(raw.NameLiteral(name), obj)
 			}
-			arr := raw.NewArray()
-			arr.Append(raw.Ref(ref.Num, ref.Gen))
-			pd.Set(raw.NameLiteral("Annots"), arr)
 		}
-		for _, f := range b.doc.AcroForm.Fields {
-			// Convert FormField to WidgetAnnotation for serialization
-			widget := &semantic.WidgetAnnotation{
-				BaseAnnotation: semantic.BaseAnnotation{
-					Subtype:         "Widget",
-					RectVal:         f.FieldRect(),
-					Flags:           f.FieldFlags(), // Using Field flags as Annotation flags (legacy behavior)
-					Appearance:      f.GetAppearance(),
-					AppearanceState: f.GetAppearanceState(),
-					Border:          f.GetBorder(),
-					Color:           f.GetColor(),
-				},
-				Field: f,
-			}
-
-			fieldRef, err := b.annotSerializer.Serialize(widget, b)
-			if err != nil {
-				return nil, raw.ObjectRef{}, nil, nil, err
+		if csDict.Len() > 0 {
+			resDict.Set(raw.NameLiteral("ColorSpace"), csDict)
+		}
+	}
+	if p.Resources != nil && len(p.Resources.XObjects) > 0 {
+		xDict := raw.Dict()
+		for name, xo := range p.Resources.XObjects {
+			xref := b.ensureXObject(name, xo)
+			xDict.Set(raw.NameLiteral(name), raw.Ref(xref.Num, xref.Gen))
+			if _, ok := union.xobjects.KV[name]; !ok {
+				union.xobjects.Set(raw.NameLiteral(name), raw.Ref(xref.Num, xref.Gen))
 			}
-			fieldRefMap[f] = fieldRef
-
-			// Post-processing for P (Page) reference which isn't handled by serializer
-			if f.FieldPageIndex() >= 0 && f.FieldPageIndex() < len(b.pageRefs) {
-				pref := b.pageRefs[f.FieldPageIndex()]
-				if obj, ok := b.objects[fieldRef]; ok {
-					if dict, ok := obj.(*raw.DictObj); ok {
-						dict.Set(raw.NameLiteral("P"), raw.Ref(pref.Num, pref.Gen))
-					}
+			if xo.Subtype == "Image" || xo.Subtype == "" {
+				if xo.ColorSpace != nil && xo.ColorSpace.ColorSpaceName() == "DeviceGray" {
+					union.addProc("ImageB")
+				} else {
+					union.addProc("ImageC")
 				}
-				appendWidgetToPage(f.FieldPageIndex(), fieldRef)
 			}
-
-			fieldsArr.Append(raw.Ref(fieldRef.Num, fieldRef.Gen))
 		}
-		formDict.Set(raw.NameLiteral("Fields"), fieldsArr)
-		if b.doc.AcroForm.NeedAppearances {
-			formDict.Set(raw.NameLiteral("NeedAppearances"), raw.Bool(true))
+		if xDict.Len() > 0 {
+			resDict.Set(raw.NameLiteral("XObject"), xDict)
 		}
-		if len(b.doc.AcroForm.CalculationOrder) > 0 {
-			coArr := raw.NewArray()
-			for _, f := range b.doc.AcroForm.CalculationOrder {
-				if ref, ok := fieldRefMap[f]; ok {
-					coArr.Append(raw.Ref(ref.Num, ref.Gen))
-				}
-			}
-			if coArr.Len() > 0 {
-				formDict.Set(raw.NameLiteral("CO"), coArr)
+	}
+	if p.Resources != nil && len(p.Resources.Patterns) > 0 {
+		patDict := raw.Dict()
+		for name, pat := range p.Resources.Patterns {
+			pRef := b.ensurePattern(name, pat)
+			patDict.Set(raw.NameLiteral(name), raw.Ref(pRef.Num, pRef.Gen))
+			if _, ok := union.patterns.KV[name]; !ok {
+				union.patterns.Set(raw.NameLiteral(name), raw.Ref(pRef.Num, pRef.Gen))
 			}
 		}
-		b.objects[formRef] = formDict
-		catalogDict.Set(raw.NameLiteral("AcroForm"), raw.Ref(formRef.Num, formRef.Gen))
-	}
-	if len(outputIntentRefs) > 0 {
-		arr := raw.NewArray()
-		for _, ref := range outputIntentRefs {
-			arr.Append(raw.Ref(ref.Num, ref.Gen))
+		if patDict.Len() > 0 {
+			resDict.Set(raw.NameLiteral("Pattern"), patDict)
 		}
-		catalogDict.Set(raw.NameLiteral("OutputIntents"), arr)
 	}
-	if embeddedFilesDict != nil {
-		if namesObj, ok := catalogDict.Get(raw.NameLiteral("Names")); ok {
-			if namesDict, ok := namesObj.(*raw.DictObj); ok {
-				namesDict.Set(raw.NameLiteral("EmbeddedFiles"), embeddedFilesDict)
+	if p.Resources != nil && len(p.Resources.Shadings) > 0 {
+		shDict := raw.Dict()
+		for name, sh := range p.Resources.Shadings {
+			shRef := b.ensureShading(name, sh)
+			shDict.Set(raw.NameLiteral(name), raw.Ref(shRef.Num, shRef.Gen))
+			if _, ok := union.shadings.KV[name]; !ok {
+				union.shadings.Set(raw.NameLiteral(name), raw.Ref(shRef.Num, shRef.Gen))
 			}
-		} else {
-			namesDict := raw.Dict()
-			namesDict.Set(raw.NameLiteral("EmbeddedFiles"), embeddedFilesDict)
-			catalogDict.Set(raw.NameLiteral("Names"), namesDict)
+		}
+		if shDict.Len() > 0 {
+			resDict.Set(raw.NameLiteral("Shading"), shDict)
 		}
 	}
-	if len(afFileSpecRefs) > 0 {
-		afArr := raw.NewArray()
-		for _, ref := range afFileSpecRefs {
-			afArr.Append(raw.Ref(ref.Num, ref.Gen))
+	if p.Resources != nil && len(p.Resources.Properties) > 0 {
+		propDict := raw.Dict()
+		for name, prop := range p.Resources.Properties {
+			ref := b.ensurePropertyList(name, prop)
+			propDict.Set(raw.NameLiteral(name), raw.Ref(ref.Num, ref.Gen))
+			if _, ok := union.properties.KV[name]; !ok {
+				union.properties.Set(raw.NameLiteral(name), raw.Ref(ref.Num, ref.Gen))
+			}
+		}
+		if propDict.Len() > 0 {
+			resDict.Set(raw.NameLiteral("Properties"), propDict)
 		}
-		catalogDict.Set(raw.NameLiteral("AF"), afArr)
 	}
-	b.objects[catalogRef] = catalogDict
+	if union.procSet.Len() > 0 {
+		resDict.Set(raw.NameLiteral("ProcSet"), union.procSet)
+	}
+	pageDict.Set(raw.NameLiteral("Resources"), resDict)
+	// Contents
+	pageDict.Set(raw.NameLiteral("Contents"), raw.Ref(content.Num, content.Gen))
 
-	if encryptionHandler != nil {
-		for ref, obj := range b.objects {
-			if encryptRef != nil && ref == *encryptRef {
-				continue
-			}
-			if metadataRef != nil && ref == *metadataRef && !b.doc.MetadataEncrypted {
-				continue
+	// Annotations
+	if len(p.Annotations) > 0 {
+		annotArr := raw.NewArray()
+		for _, a := range p.Annotations {
+			base := a.Base()
+			if !cropSet(base.RectVal) {
+				// fall back to crop/media box coordinates
+				if cropSet(p.CropBox) {
+					a.SetRect(p.CropBox)
+				} else {
+					a.SetRect(p.MediaBox)
+				}
 			}
-			encObj, err := encryptObject(obj, ref, encryptionHandler, metadataRef, b.doc.MetadataEncrypted)
+			aRef, err := b.annotSerializer.Serialize(a, b)
 			if err != nil {
-				return nil, raw.ObjectRef{}, nil, nil, err
+				return nil, err
 			}
-			b.objects[ref] = encObj
+			annotArr.Append(raw.Ref(aRef.Num, aRef.Gen))
 		}
+		pageDict.Set(raw.NameLiteral("Annots"), annotArr)
 	}
-
-	return b.objects, catalogRef, infoRef, encryptRef, nil
+	b.objects[ref] = pageDict
+	return pageDict, nil
 }
 
 func (b *objectBuilder) addFontDescriptor(fd *semantic.FontDescriptor) *raw.ObjectRef {
@@ -961,7 +1090,7 @@ func (b *objectBuilder) addFontDescriptor(fd *semantic.FontDescriptor) *raw.Obje
 		streamDict := raw.Dict()
 		streamData := fd.FontFile
 		if b.cfg.Compression > 0 {
-			if compressed, err := flateEncode(streamData, b.cfg.Compression); err == nil {
+			if compressed, err := flateEncode(streamData, b.cfg); err == nil {
 				streamData = compressed
 				streamDict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("FlateDecode"))
 			}
@@ -1000,7 +1129,7 @@ func (b *objectBuilder) addToUnicode(font *semantic.Font) *raw.ObjectRef {
 		d := raw.Dict()
 		data := font.ToUnicodeCMap
 		if b.cfg.Compression > 0 {
-			if compressed, err := flateEncode(data, b.cfg.Compression); err == nil {
+			if compressed, err := flateEncode(data, b.cfg); err == nil {
 				data = compressed
 				d.Set(raw.NameLiteral("Filter"), raw.NameLiteral("FlateDecode"))
 			}
@@ -1036,6 +1165,9 @@ func (b *objectBuilder) ensureFont(font *semantic.Font) raw.ObjectRef {
 			subtype = font.Subtype
 		}
 	}
+	if font != nil && b.keepOriginals && font.OriginalRef.Num != 0 && !font.Dirty {
+		return font.OriginalRef
+	}
 	key := fontKey(base, encoding, subtype, font)
 	if ref, ok := b.fontRefs[key]; ok {
 		return ref
@@ -1054,7 +1186,7 @@ func (b *objectBuilder) ensureFont(font *semantic.Font) raw.ObjectRef {
 			cmapDict := raw.Dict()
 			cmapData := font.EncodingCMap
 			if b.cfg.Compression > 0 {
-				if compressed, err := flateEncode(cmapData, b.cfg.Compression); err == nil {
+				if compressed, err := flateEncode(cmapData, b.cfg); err == nil {
 					cmapData = compressed
 					cmapDict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("FlateDecode"))
 				}
@@ -1128,7 +1260,7 @@ func (b *objectBuilder) ensureFont(font *semantic.Font) raw.ObjectRef {
 				mapDict := raw.Dict()
 				mapData := desc.CIDToGIDMap
 				if b.cfg.Compression > 0 {
-					if compressed, err := flateEncode(mapData, b.cfg.Compression); err == nil {
+					if compressed, err := flateEncode(mapData, b.cfg); err == nil {
 						mapData = compressed
 						mapDict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("FlateDecode"))
 					}
@@ -1230,6 +1362,11 @@ func (b *objectBuilder) ensureFont(font *semantic.Font) raw.ObjectRef {
 		if fd := b.addFontDescriptor(fontDescriptor(nil, font)); fd != nil {
 			fontDict.Set(raw.NameLiteral("FontDescriptor"), raw.Ref(fd.Num, fd.Gen))
 		}
+		if font != nil && (len(font.ToUnicodeCMap) > 0 || len(font.ToUnicode) > 0) {
+			if uref := b.addToUnicode(font); uref != nil {
+				fontDict.Set(raw.NameLiteral("ToUnicode"), raw.Ref(uref.Num, uref.Gen))
+			}
+		}
 	}
 	b.objects[ref] = fontDict
 	b.fontRefs[key] = ref
@@ -1237,6 +1374,9 @@ func (b *objectBuilder) ensureFont(font *semantic.Font) raw.ObjectRef {
 }
 
 func (b *objectBuilder) ensureXObject(name string, xo semantic.XObject) raw.ObjectRef {
+	if b.keepOriginals && xo.OriginalRef.Num != 0 && !xo.Dirty {
+		return xo.OriginalRef
+	}
 	key := xoKey(name, xo)
 	if ref, ok := b.xobjectRefs[key]; ok {
 		return ref
@@ -1256,10 +1396,21 @@ func (b *objectBuilder) ensureXObject(name string, xo semantic.XObject) raw.Obje
 		if xo.Height > 0 {
 			dict.Set(raw.NameLiteral("Height"), raw.NumberInt(int64(xo.Height)))
 		}
-		dict.Set(raw.NameLiteral("ColorSpace"), b.csSerializer.Serialize(xo.ColorSpace, b))
+		if xo.ImageMask {
+			dict.Set(raw.NameLiteral("ImageMask"), raw.Bool(true))
+		} else {
+			dict.Set(raw.NameLiteral("ColorSpace"), b.csSerializer.Serialize(xo.ColorSpace, b))
+		}
 		if xo.BitsPerComponent > 0 {
 			dict.Set(raw.NameLiteral("BitsPerComponent"), raw.NumberInt(int64(xo.BitsPerComponent)))
 		}
+		if len(xo.Decode) > 0 {
+			arr := raw.NewArray()
+			for _, d := range xo.Decode {
+				arr.Append(raw.NumberFloat(d))
+			}
+			dict.Set(raw.NameLiteral("Decode"), arr)
+		}
 		if xo.Interpolate {
 			dict.Set(raw.NameLiteral("Interpolate"), raw.Bool(true))
 		}
@@ -1267,6 +1418,22 @@ func (b *objectBuilder) ensureXObject(name string, xo semantic.XObject) raw.Obje
 	if sub == "Form" && cropSet(xo.BBox) {
 		dict.Set(raw.NameLiteral("BBox"), rectArray(xo.BBox))
 	}
+	if sub == "Form" && len(xo.Matrix) == 6 {
+		arr := raw.NewArray()
+		for _, m := range xo.Matrix {
+			arr.Append(raw.NumberFloat(m))
+		}
+		dict.Set(raw.NameLiteral("Matrix"), arr)
+	}
+	if sub == "Form" && xo.Resources != nil {
+		if resDict := b.serializeResources(xo.Resources); resDict != nil {
+			dict.Set(raw.NameLiteral("Resources"), resDict)
+		}
+	}
+	if xo.OC != nil {
+		ocRef := b.ensurePropertyList("", xo.OC)
+		dict.Set(raw.NameLiteral("OC"), raw.Ref(ocRef.Num, ocRef.Gen))
+	}
 	if sub == "Form" && xo.Group != nil {
 		gDict := raw.Dict()
 		gDict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Group"))
@@ -1287,6 +1454,16 @@ func (b *objectBuilder) ensureXObject(name string, xo semantic.XObject) raw.Obje
 		maskRef := b.ensureXObject(maskName, *xo.SMask)
 		dict.Set(raw.NameLiteral("SMask"), raw.Ref(maskRef.Num, maskRef.Gen))
 	}
+	if xo.Mask != nil {
+		maskRef := b.ensureXObject(fmt.Sprintf("%s:Mask", name), *xo.Mask)
+		dict.Set(raw.NameLiteral("Mask"), raw.Ref(maskRef.Num, maskRef.Gen))
+	} else if len(xo.ColorKey) > 0 {
+		arr := raw.NewArray()
+		for _, v := range xo.ColorKey {
+			arr.Append(raw.NumberInt(int64(v)))
+		}
+		dict.Set(raw.NameLiteral("Mask"), arr)
+	}
 	if len(xo.AssociatedFiles) > 0 {
 		if af := SerializeAssociatedFiles(xo.AssociatedFiles, b); af != nil {
 			dict.Set(raw.NameLiteral("AF"), af)
@@ -1294,16 +1471,47 @@ func (b *objectBuilder) ensureXObject(name string, xo semantic.XObject) raw.Obje
 	}
 
 	streamData := xo.Data
+	filter := pickContentFilter(b.cfg)
+	if xo.Filter == "" && bilevelImage(xo) {
+		switch filter {
+		case FilterCCITTFax:
+			if data, err := filters.EncodeCCITTFax(xo.Data, xo.Width, xo.Height); err == nil {
+				xo.Filter, xo.DecodeParms, streamData = "CCITTFaxDecode", filters.CCITTFaxParams(xo.Width, xo.Height), data
+			}
+		case FilterJBIG2:
+			if data, err := filters.EncodeJBIG2(xo.Data, xo.Width, xo.Height); err == nil {
+				xo.Filter, xo.DecodeParms, streamData = "JBIG2Decode", nil, data
+			}
+		}
+	}
 	if xo.Filter != "" {
 		// Pre-encoded data (e.g. optimized JPEG)
 		dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral(xo.Filter))
+		parms := xo.DecodeParms
+		if len(xo.JBIG2Globals) > 0 {
+			parms = raw.Dict()
+			if xo.DecodeParms != nil {
+				for _, k := range xo.DecodeParms.Keys() {
+					v, _ := xo.DecodeParms.Get(k)
+					parms.Set(k, v)
+				}
+			}
+			globalsRef := b.ensureJBIG2Globals(xo.JBIG2Globals)
+			parms.Set(raw.NameLiteral("JBIG2Globals"), raw.Ref(globalsRef.Num, globalsRef.Gen))
+		}
+		if parms != nil {
+			dict.Set(raw.NameLiteral("DecodeParms"), parms)
+		}
 	} else {
-		switch filter := pickContentFilter(b.cfg); filter {
-		case FilterFlate:
+		switch filter {
+		case FilterFlate, FilterJPX, FilterJBIG2, FilterCCITTFax:
 			if b.cfg.Compression > 0 {
-				if compressed, err := flateEncode(streamData, b.cfg.Compression); err == nil {
+				if compressed, parms, err := filters.EncodeFlate(streamData, flateOptions(b.cfg, imagePredictor(xo))); err == nil {
 					streamData = compressed
 					dict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("FlateDecode"))
+					if parms != nil {
+						dict.Set(raw.NameLiteral("DecodeParms"), parms)
+					}
 				}
 			}
 		case FilterASCIIHex:
@@ -1329,6 +1537,22 @@ func (b *objectBuilder) ensureXObject(name string, xo semantic.XObject) raw.Obje
 	return ref
 }
 
+// ensureJBIG2Globals writes a JBIG2Globals stream once for all the images
+// sharing it.
+func (b *objectBuilder) ensureJBIG2Globals(data []byte) raw.ObjectRef {
+	sum := sha256.Sum256(data)
+	key := hex.EncodeToString(sum[:])
+	if ref, ok := b.jbig2GlobalsRefs[key]; ok {
+		return ref
+	}
+	ref := b.nextRef()
+	dict := raw.Dict()
+	dict.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(data))))
+	b.objects[ref] = raw.NewStream(dict, data)
+	b.jbig2GlobalsRefs[key] = ref
+	return ref
+}
+
 func (b *objectBuilder) ensurePattern(name string, p semantic.Pattern) raw.ObjectRef {
 	key := patternKey(name, p)
 	if ref, ok := b.patternRefs[key]; ok {
@@ -1421,6 +1645,13 @@ func (b *objectBuilder) ensureShading(name string, s semantic.Shading) raw.Objec
 			}
 			dict.Set(raw.NameLiteral("Domain"), arr)
 		}
+		if len(sh.Matrix) == 6 {
+			arr := raw.NewArray()
+			for _, m := range sh.Matrix {
+				arr.Append(raw.NumberFloat(m))
+			}
+			dict.Set(raw.NameLiteral("Matrix"), arr)
+		}
 		if len(sh.Extend) > 0 {
 			arr := raw.NewArray()
 			for _, e := range sh.Extend {
@@ -1452,7 +1683,11 @@ func (b *objectBuilder) ensureShading(name string, s semantic.Shading) raw.Objec
 		}
 		dict.Set(raw.NameLiteral("BitsPerCoordinate"), raw.NumberInt(int64(sh.BitsPerCoordinate)))
 		dict.Set(raw.NameLiteral("BitsPerComponent"), raw.NumberInt(int64(sh.BitsPerComponent)))
-		dict.Set(raw.NameLiteral("BitsPerFlag"), raw.NumberInt(int64(sh.BitsPerFlag)))
+		if sh.Type != 5 {
+			dict.Set(raw.NameLiteral("BitsPerFlag"), raw.NumberInt(int64(sh.BitsPerFlag)))
+		} else if sh.VerticesPerRow > 0 {
+			dict.Set(raw.NameLiteral("VerticesPerRow"), raw.NumberInt(int64(sh.VerticesPerRow)))
+		}
 		if len(sh.Decode) > 0 {
 			arr := raw.NewArray()
 			for _, d := range sh.Decode {
@@ -1570,7 +1805,9 @@ func (b *objectBuilder) serializeResources(res *semantic.Resources) raw.Dictiona
 			if gs.UseBlackPtComp != nil {
 				entry.Set(raw.NameLiteral("UseBlackPtComp"), raw.Bool(*gs.UseBlackPtComp))
 			}
-			if gs.SoftMask != nil {
+			if gs.SoftMask != nil && gs.SoftMask.Subtype == "None" {
+				entry.Set(raw.NameLiteral("SMask"), raw.NameLiteral("None"))
+			} else if gs.SoftMask != nil {
 				smDict := raw.Dict()
 				smDict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Mask"))
 				smDict.Set(raw.NameLiteral("S"), raw.NameLiteral(gs.SoftMask.Subtype))
@@ -1585,7 +1822,10 @@ func (b *objectBuilder) serializeResources(res *semantic.Resources) raw.Dictiona
 					}
 					smDict.Set(raw.NameLiteral("BC"), bc)
 				}
-				if gs.SoftMask.Transfer != "" {
+				if gs.SoftMask.TransferFunction != nil {
+					trRef := b.funcSerializer.Serialize(gs.SoftMask.TransferFunction, b)
+					smDict.Set(raw.NameLiteral("TR"), raw.Ref(trRef.Num, trRef.Gen))
+				} else if gs.SoftMask.Transfer != "" {
 					smDict.Set(raw.NameLiteral("TR"), raw.NameLiteral(gs.SoftMask.Transfer))
 				}
 				entry.Set(raw.NameLiteral("SMask"), smDict)
@@ -1630,8 +1870,29 @@ func (b *objectBuilder) serializeResources(res *semantic.Resources) raw.Dictiona
 	return resDict
 }
 
+// propertyListBase returns the fields common to the property lists the
+// writer knows, or nil for others.
+func propertyListBase(pl semantic.PropertyList) *semantic.BasePropertyList {
+	switch p := pl.(type) {
+	case *semantic.OptionalContentGroup:
+		return &p.BasePropertyList
+	case *semantic.OptionalContentMembership:
+		return &p.BasePropertyList
+	}
+	return nil
+}
+
 func (b *objectBuilder) ensurePropertyList(name string, pl semantic.PropertyList) raw.ObjectRef {
+	if ref, ok := b.propertyRefs[pl]; ok {
+		return ref
+	}
+	if b.keepOriginals {
+		if base := propertyListBase(pl); base != nil && base.OriginalRef.Num != 0 && !base.Dirty {
+			return base.OriginalRef
+		}
+	}
 	ref := b.nextRef()
+	b.propertyRefs[pl] = ref
 	dict := raw.Dict()
 
 	switch p := pl.(type) {
@@ -1639,17 +1900,11 @@ func (b *objectBuilder) ensurePropertyList(name string, pl semantic.PropertyList
 		dict.Set(raw.NameLiteral("Type"), raw.NameLiteral("OCG"))
 		dict.Set(raw.NameLiteral("Name"), raw.Str([]byte(p.Name)))
 		if len(p.Intent) > 0 {
-			if len(p.Intent) == 1 {
-				dict.Set(raw.NameLiteral("Intent"), raw.NameLiteral(p.Intent[0]))
-			} else {
-				arr := raw.NewArray()
-				for _, i := range p.Intent {
-					arr.Append(raw.NameLiteral(i))
-				}
-				dict.Set(raw.NameLiteral("Intent"), arr)
-			}
+			dict.Set(raw.NameLiteral("Intent"), nameOrArray(p.Intent))
+		}
+		if p.Usage != nil {
+			dict.Set(raw.NameLiteral("Usage"), serializeOCUsage(p.Usage))
 		}
-		// Usage serialization skipped for now
 	case *semantic.OptionalContentMembership:
 		dict.Set(raw.NameLiteral("Type"), raw.NameLiteral("OCMD"))
 		if len(p.OCGs) > 0 {
@@ -1657,18 +1912,263 @@ func (b *objectBuilder) ensurePropertyList(name string, pl semantic.PropertyList
 				gRef := b.ensurePropertyList("", p.OCGs[0])
 				dict.Set(raw.NameLiteral("OCGs"), raw.Ref(gRef.Num, gRef.Gen))
 			} else {
-				arr := raw.NewArray()
-				for _, g := range p.OCGs {
-					gRef := b.ensurePropertyList("", g)
-					arr.Append(raw.Ref(gRef.Num, gRef.Gen))
-				}
-				dict.Set(raw.NameLiteral("OCGs"), arr)
+				dict.Set(raw.NameLiteral("OCGs"), b.groupArray(p.OCGs))
 			}
 		}
 		if p.Policy != "" {
 			dict.Set(raw.NameLiteral("P"), raw.NameLiteral(p.Policy))
 		}
+		if p.VE != nil {
+			if ve := b.visibilityExpression(p.VE); ve != nil {
+				dict.Set(raw.NameLiteral("VE"), ve)
+			}
+		}
 	}
 	b.objects[ref] = dict
 	return ref
 }
+
+// groupArray returns an array of references to groups.
+func (b *objectBuilder) groupArray(groups []*semantic.OptionalContentGroup) *raw.ArrayObj {
+	arr := raw.NewArray()
+	for _, g := range groups {
+		if g == nil {
+			continue
+		}
+		ref := b.ensurePropertyList("", g)
+		arr.Append(raw.Ref(ref.Num, ref.Gen))
+	}
+	return arr
+}
+
+func (b *objectBuilder) visibilityExpression(ve *semantic.VisibilityExpression) raw.Object {
+	if ve.Op == "" {
+		if ve.Group == nil {
+			return nil
+		}
+		ref := b.ensurePropertyList("", ve.Group)
+		return raw.Ref(ref.Num, ref.Gen)
+	}
+	arr := raw.NewArray(raw.NameLiteral(ve.Op))
+	for _, operand := range ve.Operands {
+		if operand == nil {
+			continue
+		}
+		if o := b.visibilityExpression(operand); o != nil {
+			arr.Append(o)
+		}
+	}
+	return arr
+}
+
+func serializeOCUsage(u *semantic.OCUsage) *raw.DictObj {
+	state := func(on bool) raw.Object {
+		if on {
+			return raw.NameLiteral("ON")
+		}
+		return raw.NameLiteral("OFF")
+	}
+	dict := raw.Dict()
+	if ci := u.CreatorInfo; ci != nil {
+		d := raw.Dict()
+		d.Set(raw.NameLiteral("Creator"), raw.Str([]byte(ci.Creator)))
+		if ci.Subtype != "" {
+			d.Set(raw.NameLiteral("Subtype"), raw.NameLiteral(ci.Subtype))
+		}
+		dict.Set(raw.NameLiteral("CreatorInfo"), d)
+	}
+	if l := u.Language; l != nil {
+		d := raw.Dict()
+		d.Set(raw.NameLiteral("Lang"), raw.Str([]byte(l.Lang)))
+		if l.Preferred {
+			d.Set(raw.NameLiteral("Preferred"), raw.NameLiteral("ON"))
+		}
+		dict.Set(raw.NameLiteral("Language"), d)
+	}
+	if e := u.Export; e != nil {
+		d := raw.Dict()
+		d.Set(raw.NameLiteral("ExportState"), state(e.ExportState))
+		dict.Set(raw.NameLiteral("Export"), d)
+	}
+	if z := u.Zoom; z != nil {
+		d := raw.Dict()
+		if z.Min != 0 {
+			d.Set(raw.NameLiteral("min"), raw.NumberFloat(z.Min))
+		}
+		if z.Max != 0 {
+			d.Set(raw.NameLiteral("max"), raw.NumberFloat(z.Max))
+		}
+		dict.Set(raw.NameLiteral("Zoom"), d)
+	}
+	if p := u.Print; p != nil {
+		d := raw.Dict()
+		if p.Subtype != "" {
+			d.Set(raw.NameLiteral("Subtype"), raw.NameLiteral(p.Subtype))
+		}
+		d.Set(raw.NameLiteral("PrintState"), state(p.PrintState))
+		dict.Set(raw.NameLiteral("Print"), d)
+	}
+	if v := u.View; v != nil {
+		d := raw.Dict()
+		d.Set(raw.NameLiteral("ViewState"), state(v.ViewState))
+		dict.Set(raw.NameLiteral("View"), d)
+	}
+	if usr := u.User; usr != nil {
+		d := raw.Dict()
+		if usr.Type != "" {
+			d.Set(raw.NameLiteral("Type"), raw.NameLiteral(usr.Type))
+		}
+		if len(usr.User) > 0 {
+			arr := raw.NewArray()
+			for _, n := range usr.User {
+				arr.Append(raw.Str([]byte(n)))
+			}
+			d.Set(raw.NameLiteral("Name"), arr)
+		} else {
+			d.Set(raw.NameLiteral("Name"), raw.Str([]byte(usr.Name)))
+		}
+		dict.Set(raw.NameLiteral("User"), d)
+	}
+	return dict
+}
+
+// serializeOCProperties returns the catalog's OCProperties dictionary. Its
+// OCGs array also lists the groups written for property lists but missing
+// from the document's OCProperties, as every group must be listed there.
+func (b *objectBuilder) serializeOCProperties() *raw.DictObj {
+	props := b.doc.OCProperties
+	var groups []*semantic.OptionalContentGroup
+	listed := make(map[*semantic.OptionalContentGroup]bool)
+	add := func(g *semantic.OptionalContentGroup) {
+		if g != nil && !listed[g] {
+			listed[g] = true
+			groups = append(groups, g)
+		}
+	}
+	if props != nil {
+		for _, g := range props.OCGs {
+			add(g)
+		}
+	}
+	var extra []*semantic.OptionalContentGroup
+	for pl := range b.propertyRefs {
+		if g, ok := pl.(*semantic.OptionalContentGroup); ok && !listed[g] {
+			extra = append(extra, g)
+		}
+	}
+	sort.Slice(extra, func(i, j int) bool { return b.propertyRefs[extra[i]].Num < b.propertyRefs[extra[j]].Num })
+	for _, g := range extra {
+		add(g)
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	dict := raw.Dict()
+	dict.Set(raw.NameLiteral("OCGs"), b.groupArray(groups))
+	var d *semantic.OCConfig
+	if props != nil {
+		d = props.D
+	}
+	if d == nil {
+		d = &semantic.OCConfig{}
+	}
+	dict.Set(raw.NameLiteral("D"), b.ocConfig(d))
+	if props != nil && len(props.Configs) > 0 {
+		arr := raw.NewArray()
+		for _, c := range props.Configs {
+			if c != nil {
+				arr.Append(b.ocConfig(c))
+			}
+		}
+		dict.Set(raw.NameLiteral("Configs"), arr)
+	}
+	return dict
+}
+
+func (b *objectBuilder) ocConfig(c *semantic.OCConfig) *raw.DictObj {
+	dict := raw.Dict()
+	if c.Name != "" {
+		dict.Set(raw.NameLiteral("Name"), raw.Str([]byte(c.Name)))
+	}
+	if c.Creator != "" {
+		dict.Set(raw.NameLiteral("Creator"), raw.Str([]byte(c.Creator)))
+	}
+	if c.BaseState != "" {
+		dict.Set(raw.NameLiteral("BaseState"), raw.NameLiteral(c.BaseState))
+	}
+	if len(c.ON) > 0 {
+		dict.Set(raw.NameLiteral("ON"), b.groupArray(c.ON))
+	}
+	if len(c.OFF) > 0 {
+		dict.Set(raw.NameLiteral("OFF"), b.groupArray(c.OFF))
+	}
+	if len(c.Intent) > 0 {
+		dict.Set(raw.NameLiteral("Intent"), nameOrArray(c.Intent))
+	}
+	if len(c.AS) > 0 {
+		arr := raw.NewArray()
+		for _, as := range c.AS {
+			d := raw.Dict()
+			d.Set(raw.NameLiteral("Event"), raw.NameLiteral(as.Event))
+			d.Set(raw.NameLiteral("OCGs"), b.groupArray(as.OCGs))
+			cat := raw.NewArray()
+			for _, name := range as.Category {
+				cat.Append(raw.NameLiteral(name))
+			}
+			d.Set(raw.NameLiteral("Category"), cat)
+			arr.Append(d)
+		}
+		dict.Set(raw.NameLiteral("AS"), arr)
+	}
+	if len(c.Order) > 0 {
+		dict.Set(raw.NameLiteral("Order"), b.ocOrder(c.Order))
+	}
+	if c.ListMode != "" {
+		dict.Set(raw.NameLiteral("ListMode"), raw.NameLiteral(c.ListMode))
+	}
+	if len(c.RBGroups) > 0 {
+		arr := raw.NewArray()
+		for _, rb := range c.RBGroups {
+			arr.Append(b.groupArray(rb))
+		}
+		dict.Set(raw.NameLiteral("RBGroups"), arr)
+	}
+	if len(c.Locked) > 0 {
+		dict.Set(raw.NameLiteral("Locked"), b.groupArray(c.Locked))
+	}
+	return dict
+}
+
+// ocOrder writes Order items: a group is followed by the array of its
+// nested items, a collection is an array starting with its label.
+func (b *objectBuilder) ocOrder(items []semantic.OCOrderItem) *raw.ArrayObj {
+	arr := raw.NewArray()
+	for _, item := range items {
+		if item.Group != nil {
+			ref := b.ensurePropertyList("", item.Group)
+			arr.Append(raw.Ref(ref.Num, ref.Gen))
+			if len(item.Children) > 0 {
+				arr.Append(b.ocOrder(item.Children))
+			}
+			continue
+		}
+		sub := b.ocOrder(item.Children)
+		if item.Label != "" {
+			sub.Items = append([]raw.Object{raw.Str([]byte(item.Label))}, sub.Items...)
+		}
+		arr.Append(sub)
+	}
+	return arr
+}
+
+func nameOrArray(names []string) raw.Object {
+	if len(names) == 1 {
+		return raw.NameLiteral(names[0])
+	}
+	arr := raw.NewArray()
+	for _, n := range names {
+		arr.Append(raw.NameLiteral(n))
+	}
+	return arr
+}
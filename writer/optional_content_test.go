@@ -0,0 +1,132 @@
+package writer
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/ir"
+	"github.com/wudi/pdfkit/ir/raw"
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/parser"
+)
+
+func TestWriter_OptionalContentRoundTrip(t *testing.T) {
+	b := builder.NewBuilder().
+		AddLayer("Text", true).
+		AddLayer("Notes", false)
+	page := b.NewPage(200, 200).
+		BeginLayer("Text").
+		DrawText("visible", 10, 150, builder.TextOptions{}).
+		BeginLayer("Draft").
+		DrawRectangle(10, 10, 50, 50, builder.RectOptions{Fill: true}).
+		EndLayer().
+		EndLayer().
+		BeginLayer("Notes").
+		AddAnnotation(&semantic.SquareAnnotation{BaseAnnotation: semantic.BaseAnnotation{
+			Subtype: "Square",
+			RectVal: semantic.Rectangle{LLX: 20, LLY: 20, URX: 40, URY: 40},
+		}})
+	doc, err := page.Finish().Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	props := doc.OCProperties
+	text, notes, draft := props.Layer("Text"), props.Layer("Notes"), props.Layer("Draft")
+	if text == nil || notes == nil || draft == nil {
+		t.Fatalf("layers = %v", props.OCGs)
+	}
+	notes.Usage = &semantic.OCUsage{Print: &semantic.OCPrint{Subtype: "Trapping", PrintState: true}}
+	props.D.Name = "Default"
+	props.D.Order = []semantic.OCOrderItem{
+		{Group: text, Children: []semantic.OCOrderItem{{Group: draft}}},
+		{Label: "Review", Children: []semantic.OCOrderItem{{Group: notes}}},
+	}
+	props.D.RBGroups = [][]*semantic.OptionalContentGroup{{text, notes}}
+	props.D.Locked = []*semantic.OptionalContentGroup{draft}
+	props.D.AS = []semantic.OCAutoState{{Event: "Print", OCGs: []*semantic.OptionalContentGroup{notes}, Category: []string{"Print"}}}
+	props.Configs = []*semantic.OCConfig{{Name: "Print", BaseState: "OFF", ON: []*semantic.OptionalContentGroup{notes}}}
+
+	res := doc.Pages[0].Resources
+	res.Properties["MC0"] = &semantic.OptionalContentMembership{VE: &semantic.VisibilityExpression{
+		Op: "And",
+		Operands: []*semantic.VisibilityExpression{
+			{Group: text},
+			{Op: "Not", Operands: []*semantic.VisibilityExpression{{Group: notes}}},
+		},
+	}}
+	res.XObjects["Fm1"] = semantic.XObject{Subtype: "Form", BBox: semantic.Rectangle{URX: 10, URY: 10}, Data: []byte("0 0 10 10 re f"), OC: draft}
+
+	var buf bytes.Buffer
+	if err := NewWriter().Write(context.Background(), doc, &buf, Config{Deterministic: true}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	parsed, err := ir.NewDefault().Parse(context.Background(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	got := parsed.OCProperties
+	if got == nil || len(got.OCGs) != 3 {
+		t.Fatalf("OCProperties = %+v", got)
+	}
+	pText, pNotes, pDraft := got.Layer("Text"), got.Layer("Notes"), got.Layer("Draft")
+	if pNotes.Usage == nil || pNotes.Usage.Print == nil || pNotes.Usage.Print.Subtype != "Trapping" || !pNotes.Usage.Print.PrintState {
+		t.Errorf("usage = %+v", pNotes.Usage)
+	}
+	d := got.D
+	if d.Name != "Default" || !d.GroupVisible(pText) || d.GroupVisible(pNotes) || !d.GroupVisible(pDraft) {
+		t.Errorf("default configuration = %+v", d)
+	}
+	if len(d.Order) != 2 || d.Order[0].Group != pText || len(d.Order[0].Children) != 1 || d.Order[0].Children[0].Group != pDraft ||
+		d.Order[1].Label != "Review" || d.Order[1].Children[0].Group != pNotes {
+		t.Errorf("order = %+v", d.Order)
+	}
+	if len(d.RBGroups) != 1 || d.RBGroups[0][1] != pNotes || len(d.Locked) != 1 || d.Locked[0] != pDraft {
+		t.Errorf("RBGroups %v, Locked %v", d.RBGroups, d.Locked)
+	}
+	if len(d.AS) != 1 || d.AS[0].Event != "Print" || d.AS[0].OCGs[0] != pNotes || d.AS[0].Category[0] != "Print" {
+		t.Errorf("AS = %+v", d.AS)
+	}
+	if len(got.Configs) != 1 || got.Configs[0].BaseState != "OFF" || !got.Configs[0].GroupVisible(pNotes) || got.Configs[0].GroupVisible(pText) {
+		t.Errorf("configs = %+v", got.Configs)
+	}
+
+	// Resources share the groups of OCProperties.
+	pres := parsed.Pages[0].Resources
+	byGroup := map[semantic.PropertyList]bool{}
+	for _, pl := range pres.Properties {
+		byGroup[pl] = true
+	}
+	if !byGroup[pText] || !byGroup[pDraft] || !byGroup[pNotes] {
+		t.Errorf("page properties do not share the catalog's groups: %v", pres.Properties)
+	}
+	ocmd, ok := pres.Properties["MC0"].(*semantic.OptionalContentMembership)
+	if !ok || ocmd.VE == nil || ocmd.VE.Op != "And" || ocmd.VE.Operands[0].Group != pText || ocmd.VE.Operands[1].Operands[0].Group != pNotes {
+		t.Fatalf("OCMD = %+v", pres.Properties["MC0"])
+	}
+	if !got.Visible(ocmd) {
+		t.Errorf("Text and not Notes should be visible")
+	}
+	if xo := pres.XObjects["Fm1"]; xo.OC != pDraft {
+		t.Errorf("XObject OC = %v", xo.OC)
+	}
+
+	rawDoc, err := parser.NewDocumentParser(parser.Config{}).Parse(context.Background(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parse raw: %v", err)
+	}
+	for _, obj := range rawDoc.Objects {
+		if dict, ok := obj.(*raw.DictObj); ok {
+			if sub, _ := dict.Get(raw.NameLiteral("Subtype")); sub == raw.NameLiteral("Square") {
+				oc, ok := dict.Get(raw.NameLiteral("OC"))
+				ref, isRef := oc.(raw.RefObj)
+				if !ok || !isRef || rawDoc.Objects[ref.Ref()].(*raw.DictObj).KV["Name"] == nil {
+					t.Errorf("annotation OC = %v", oc)
+				}
+			}
+		}
+	}
+}
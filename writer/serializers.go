@@ -27,6 +27,33 @@ type ColorSpaceSerializer interface {
 	Serialize(cs semantic.ColorSpace, ctx SerializationContext) raw.Object
 }
 
+// xobjectContext is implemented by serialization contexts that write form
+// XObjects together with their resources.
+type xobjectContext interface {
+	ensureXObject(name string, xo semantic.XObject) raw.ObjectRef
+}
+
+// propertyListContext is implemented by serialization contexts that write
+// property lists, such as the optional content groups of annotations.
+type propertyListContext interface {
+	ensurePropertyList(name string, pl semantic.PropertyList) raw.ObjectRef
+}
+
+// fieldDA and fieldQ return the DA and Q entries of a form field.
+func fieldDA(f semantic.FormField) string {
+	if v, ok := f.(interface{ GetDefaultAppearance() string }); ok {
+		return v.GetDefaultAppearance()
+	}
+	return ""
+}
+
+func fieldQ(f semantic.FormField) int {
+	if v, ok := f.(interface{ GetQuadding() int }); ok {
+		return v.GetQuadding()
+	}
+	return 0
+}
+
 type defaultAnnotationSerializer struct {
 	actionSerializer ActionSerializer
 }
@@ -117,6 +144,28 @@ func (s *defaultAnnotationSerializer) Serialize(a semantic.Annotation, ctx Seria
 		if t.Q != 0 {
 			dict.Set(raw.NameLiteral("Q"), raw.NumberInt(int64(t.Q)))
 		}
+		if t.IT != "" {
+			dict.Set(raw.NameLiteral("IT"), raw.NameLiteral(t.IT))
+		}
+		if len(t.CL) == 4 || len(t.CL) == 6 {
+			dict.Set(raw.NameLiteral("CL"), numberArray(t.CL))
+		}
+		if t.LE != "" {
+			dict.Set(raw.NameLiteral("LE"), raw.NameLiteral(t.LE))
+		}
+		if len(t.RD) == 4 {
+			dict.Set(raw.NameLiteral("RD"), numberArray(t.RD))
+		}
+	case *semantic.PolygonAnnotation:
+		if len(t.Vertices) > 0 {
+			dict.Set(raw.NameLiteral("Vertices"), numberArray(t.Vertices))
+		}
+		if len(t.LE) == 2 {
+			dict.Set(raw.NameLiteral("LE"), raw.NewArray(raw.NameLiteral(t.LE[0]), raw.NameLiteral(t.LE[1])))
+		}
+		if len(t.IC) > 0 {
+			dict.Set(raw.NameLiteral("IC"), numberArray(t.IC))
+		}
 	case *semantic.LineAnnotation:
 		if len(t.L) == 4 {
 			l := raw.NewArray()
@@ -183,7 +232,20 @@ func (s *defaultAnnotationSerializer) Serialize(a semantic.Annotation, ctx Seria
 				if f.Value != "" {
 					dict.Set(raw.NameLiteral("V"), raw.Str([]byte(f.Value)))
 				}
+				if f.RichValue != "" {
+					dict.Set(raw.NameLiteral("RV"), raw.Str([]byte(f.RichValue)))
+				}
+				if f.MaxLen > 0 {
+					dict.Set(raw.NameLiteral("MaxLen"), raw.NumberInt(int64(f.MaxLen)))
+				}
 			case *semantic.ChoiceFormField:
+				if len(f.Options) > 0 {
+					opt := raw.NewArray()
+					for _, o := range f.Options {
+						opt.Append(raw.Str([]byte(o)))
+					}
+					dict.Set(raw.NameLiteral("Opt"), opt)
+				}
 				if len(f.Selected) > 0 {
 					if len(f.Selected) == 1 {
 						dict.Set(raw.NameLiteral("V"), raw.Str([]byte(f.Selected[0])))
@@ -221,6 +283,28 @@ func (s *defaultAnnotationSerializer) Serialize(a semantic.Annotation, ctx Seria
 			if flags := t.Field.FieldFlags(); flags != 0 {
 				dict.Set(raw.NameLiteral("Ff"), raw.NumberInt(int64(flags)))
 			}
+			if da := fieldDA(t.Field); da != "" {
+				dict.Set(raw.NameLiteral("DA"), raw.Str([]byte(da)))
+			}
+			if q := fieldQ(t.Field); q != 0 {
+				dict.Set(raw.NameLiteral("Q"), raw.NumberInt(int64(q)))
+			}
+			mk := raw.Dict()
+			if r := t.Field.GetRotation(); r != 0 {
+				mk.Set(raw.NameLiteral("R"), raw.NumberInt(int64(r)))
+			}
+			if bc := t.Field.GetBorderColor(); len(bc) > 0 {
+				mk.Set(raw.NameLiteral("BC"), numberArray(bc))
+			}
+			if bg := t.Field.GetBackgroundColor(); len(bg) > 0 {
+				mk.Set(raw.NameLiteral("BG"), numberArray(bg))
+			}
+			if btn, ok := t.Field.(*semantic.ButtonFormField); ok && btn.Caption != "" {
+				mk.Set(raw.NameLiteral("CA"), raw.Str([]byte(btn.Caption)))
+			}
+			if mk.Len() > 0 {
+				dict.Set(raw.NameLiteral("MK"), mk)
+			}
 		}
 	case *semantic.StampAnnotation:
 		if t.Name != "" {
@@ -354,6 +438,20 @@ func (s *defaultAnnotationSerializer) Serialize(a semantic.Annotation, ctx Seria
 			dict.Set(raw.NameLiteral("3DV"), viewDict)
 		}
 	case *semantic.RedactAnnotation:
+		if len(t.QuadPoints) > 0 {
+			qp := raw.NewArray()
+			for _, v := range t.QuadPoints {
+				qp.Append(raw.NumberFloat(v))
+			}
+			dict.Set(raw.NameLiteral("QuadPoints"), qp)
+		}
+		if len(t.IC) > 0 {
+			ic := raw.NewArray()
+			for _, v := range t.IC {
+				ic.Append(raw.NumberFloat(v))
+			}
+			dict.Set(raw.NameLiteral("IC"), ic)
+		}
 		if t.OverlayText != "" {
 			dict.Set(raw.NameLiteral("OverlayText"), raw.Str([]byte(t.OverlayText)))
 		}
@@ -373,10 +471,32 @@ func (s *defaultAnnotationSerializer) Serialize(a semantic.Annotation, ctx Seria
 	if base.Contents != "" {
 		dict.Set(raw.NameLiteral("Contents"), raw.Str([]byte(base.Contents)))
 	}
+	if base.RichContents != "" {
+		dict.Set(raw.NameLiteral("RC"), raw.Str([]byte(base.RichContents)))
+	}
+	if base.NM != "" {
+		dict.Set(raw.NameLiteral("NM"), raw.Str([]byte(base.NM)))
+	}
+	if _, widget := a.(*semantic.WidgetAnnotation); !widget && base.Author != "" {
+		dict.Set(raw.NameLiteral("T"), raw.Str([]byte(base.Author)))
+	}
+	if base.Modified != "" {
+		dict.Set(raw.NameLiteral("M"), raw.Str([]byte(base.Modified)))
+	}
 
-	if len(base.Appearance) > 0 {
+	if xc, ok := ctx.(xobjectContext); ok && base.AppearanceForm != nil {
+		apRef := xc.ensureXObject("AP", *base.AppearanceForm)
+		ap := raw.Dict()
+		ap.Set(raw.NameLiteral("N"), raw.Ref(apRef.Num, apRef.Gen))
+		dict.Set(raw.NameLiteral("AP"), ap)
+	} else if len(base.Appearance) > 0 {
 		apRef := ctx.NextRef()
 		apDict := raw.Dict()
+		apDict.Set(raw.NameLiteral("Type"), raw.NameLiteral("XObject"))
+		apDict.Set(raw.NameLiteral("Subtype"), raw.NameLiteral("Form"))
+		// The appearance is drawn in a box of the annotation's size.
+		r := base.RectVal
+		apDict.Set(raw.NameLiteral("BBox"), rectArray(semantic.Rectangle{URX: r.URX - r.LLX, URY: r.URY - r.LLY}))
 		apDict.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(base.Appearance))))
 		apStream := raw.NewStream(apDict, base.Appearance)
 		ctx.AddObject(apRef, apStream)
@@ -395,6 +515,27 @@ func (s *defaultAnnotationSerializer) Serialize(a semantic.Annotation, ctx Seria
 		dict.Set(raw.NameLiteral("Border"), raw.NewArray(raw.NumberInt(0), raw.NumberInt(0), raw.NumberInt(0)))
 	}
 
+	if bs := base.BorderStyle; bs != nil {
+		bsDict := raw.Dict()
+		bsDict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Border"))
+		bsDict.Set(raw.NameLiteral("W"), raw.NumberFloat(bs.Width))
+		if bs.Style != "" {
+			bsDict.Set(raw.NameLiteral("S"), raw.NameLiteral(bs.Style))
+		}
+		if len(bs.Dash) > 0 {
+			bsDict.Set(raw.NameLiteral("D"), numberArray(bs.Dash))
+		}
+		dict.Set(raw.NameLiteral("BS"), bsDict)
+	}
+	if be := base.BorderEffect; be != nil && be.Style != "" {
+		beDict := raw.Dict()
+		beDict.Set(raw.NameLiteral("S"), raw.NameLiteral(be.Style))
+		if be.Intensity != 0 {
+			beDict.Set(raw.NameLiteral("I"), raw.NumberFloat(be.Intensity))
+		}
+		dict.Set(raw.NameLiteral("BE"), beDict)
+	}
+
 	if len(base.Color) > 0 {
 		colArr := raw.NewArray()
 		for _, c := range base.Color {
@@ -407,6 +548,11 @@ func (s *defaultAnnotationSerializer) Serialize(a semantic.Annotation, ctx Seria
 		dict.Set(raw.NameLiteral("AS"), raw.NameLiteral(base.AppearanceState))
 	}
 
+	if pc, ok := ctx.(propertyListContext); ok && base.OC != nil {
+		ocRef := pc.ensurePropertyList("", base.OC)
+		dict.Set(raw.NameLiteral("OC"), raw.Ref(ocRef.Num, ocRef.Gen))
+	}
+
 	if len(base.AssociatedFiles) > 0 {
 		if af := SerializeAssociatedFiles(base.AssociatedFiles, ctx); af != nil {
 			dict.Set(raw.NameLiteral("AF"), af)
@@ -657,10 +803,13 @@ func (s *defaultColorSpaceSerializer) Serialize(cs semantic.ColorSpace, ctx Seri
 	case *semantic.ICCBasedColorSpace:
 		ref := ctx.NextRef()
 		dict := raw.Dict()
-		n := 3
-		if len(t.Range) > 0 {
+		n := t.N
+		if n == 0 && len(t.Range) > 0 {
 			n = len(t.Range) / 2
 		}
+		if n == 0 {
+			n = 3
+		}
 		dict.Set(raw.NameLiteral("N"), raw.NumberInt(int64(n)))
 		dict.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(t.Profile))))
 		if len(t.Range) > 0 {
@@ -719,6 +868,14 @@ func (s *defaultColorSpaceSerializer) Serialize(cs semantic.ColorSpace, ctx Seri
 		}
 		return arr
 
+	case *semantic.IndexedColorSpace:
+		ref := ctx.NextRef()
+		dict := raw.Dict()
+		dict.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(t.Lookup))))
+		ctx.AddObject(ref, raw.NewStream(dict, t.Lookup))
+		return raw.NewArray(raw.NameLiteral("Indexed"), s.Serialize(t.Base, ctx),
+			raw.NumberInt(int64(t.Hival)), raw.Ref(ref.Num, ref.Gen))
+
 	case *semantic.SpectrallyDefinedColorSpace:
 		ref := ctx.NextRef()
 		dict := raw.Dict()
@@ -3,7 +3,7 @@ package writer
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
+	"crypto"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -14,6 +14,14 @@ import (
 	"github.com/wudi/pdfkit/xref"
 )
 
+// Bytes reserved in the file for the encoded signature when
+// SignConfig.SignatureSize is zero. A signature timestamp carries a second
+// CMS structure and the TSA's certificates, so it gets more room.
+const (
+	DefaultSignatureSize   = 8192
+	TimestampSignatureSize = 32768
+)
+
 // SignConfig configures the digital signature.
 type SignConfig struct {
 	Reason    string
@@ -21,11 +29,80 @@ type SignConfig struct {
 	Contact   string
 	FieldName string // Name of the signature field (optional)
 	PAdES     bool   // Enable PAdES (ETSI.CAdES.detached)
+	// Timestamp, when set, embeds a signature timestamp from this TSA
+	// (PAdES B-T).
+	Timestamp security.TimestampClient
+	// SignatureSize is the number of bytes reserved for the DER signature;
+	// zero picks DefaultSignatureSize, or TimestampSignatureSize when
+	// Timestamp is set.
+	SignatureSize int
 }
 
 // Sign appends a digital signature to an existing PDF.
 // It writes the signed PDF to w.
 func Sign(ctx context.Context, r io.ReaderAt, size int64, w io.Writer, signer security.Signer, cfg SignConfig) error {
+	var dict bytes.Buffer
+
+	subFilter := "/adbe.pkcs7.detached"
+	if cfg.PAdES {
+		subFilter = "/ETSI.CAdES.detached"
+		// Auto-configure signers that support the signing-certificate-v2 attribute
+		if p, ok := signer.(interface{ SetPAdES(bool) }); ok {
+			p.SetPAdES(true)
+		}
+	}
+
+	dict.WriteString("<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter " + subFilter)
+
+	if cfg.Reason != "" {
+		fmt.Fprintf(&dict, " /Reason (%s)", cfg.Reason)
+	}
+	if cfg.Location != "" {
+		fmt.Fprintf(&dict, " /Location (%s)", cfg.Location)
+	}
+	if cfg.Contact != "" {
+		fmt.Fprintf(&dict, " /ContactInfo (%s)", cfg.Contact)
+	}
+	fmt.Fprintf(&dict, " /M (%s)", formatDate(time.Now()))
+
+	sigLen := cfg.SignatureSize
+	if sigLen <= 0 {
+		sigLen = DefaultSignatureSize
+		if cfg.Timestamp != nil {
+			sigLen = TimestampSignatureSize
+		}
+	}
+	return appendSignature(ctx, r, size, w, dict.Bytes(), sigLen, security.SignerDigest(signer), func(digest []byte) ([]byte, error) {
+		signature, err := signer.Sign(digest)
+		if err != nil {
+			return nil, fmt.Errorf("sign: %w", err)
+		}
+		if cfg.Timestamp != nil {
+			return security.TimestampSignature(ctx, signature, cfg.Timestamp)
+		}
+		return signature, nil
+	})
+}
+
+// AddDocumentTimestamp appends a document timestamp (/SubFilter
+// /ETSI.RFC3161) from tsa to an existing PDF as an incremental update.
+// Together with AddLTV this yields PAdES B-LTA archives.
+func AddDocumentTimestamp(ctx context.Context, r io.ReaderAt, size int64, w io.Writer, tsa security.TimestampClient) error {
+	dict := []byte("<< /Type /DocTimeStamp /Filter /Adobe.PPKLite /SubFilter /ETSI.RFC3161")
+	return appendSignature(ctx, r, size, w, dict, TimestampSignatureSize, crypto.SHA256, func(digest []byte) ([]byte, error) {
+		token, err := tsa.Timestamp(ctx, digest, crypto.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("timestamp: %w", err)
+		}
+		return token, nil
+	})
+}
+
+// appendSignature writes r followed by an incremental update holding a new
+// signature dictionary. dict opens the dictionary; /ByteRange and /Contents
+// are appended with room for a signature of sigLen bytes, and sign receives
+// the digest (computed with hash) of every byte outside the /Contents value.
+func appendSignature(ctx context.Context, r io.ReaderAt, size int64, w io.Writer, dict []byte, sigLen int, hash crypto.Hash, sign func(digest []byte) ([]byte, error)) error {
 	// 1. Parse original file to find Trailer and Size
 	resolver := xref.NewResolver(xref.ResolverConfig{})
 	table, err := resolver.Resolve(ctx, r)
@@ -49,34 +126,11 @@ func Sign(ctx context.Context, r io.ReaderAt, size int64, w io.Writer, signer se
 	}
 
 	// 3. Prepare Signature Dictionary Parts
-	const sigLen = 8192 // Reserve 8KB for signature
-
 	var updateBuf bytes.Buffer
 
 	// Object Header
 	fmt.Fprintf(&updateBuf, "%d 0 obj\n", sigObjID)
-
-	subFilter := "/adbe.pkcs7.detached"
-	if cfg.PAdES {
-		subFilter = "/ETSI.CAdES.detached"
-		// Auto-configure RSASigner if possible
-		if rsaSigner, ok := signer.(*security.RSASigner); ok {
-			rsaSigner.SetPAdES(true)
-		}
-	}
-
-	updateBuf.WriteString("<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter " + subFilter)
-
-	if cfg.Reason != "" {
-		fmt.Fprintf(&updateBuf, " /Reason (%s)", cfg.Reason)
-	}
-	if cfg.Location != "" {
-		fmt.Fprintf(&updateBuf, " /Location (%s)", cfg.Location)
-	}
-	if cfg.Contact != "" {
-		fmt.Fprintf(&updateBuf, " /ContactInfo (%s)", cfg.Contact)
-	}
-	fmt.Fprintf(&updateBuf, " /M (%s)", formatDate(time.Now()))
+	updateBuf.Write(dict)
 
 	// ByteRange
 	// We use a fixed format for ByteRange to ensure stable length.
@@ -162,7 +216,7 @@ func Sign(ctx context.Context, r io.ReaderAt, size int64, w io.Writer, signer se
 	}
 
 	// Calculate Hash
-	hasher := sha256.New()
+	hasher := hash.New()
 	hasher.Write(originalData)
 	hasher.Write(updateBuf.Bytes())
 	hasher.Write([]byte(byteRangeStr))
@@ -174,9 +228,9 @@ func Sign(ctx context.Context, r io.ReaderAt, size int64, w io.Writer, signer se
 	digest := hasher.Sum(nil)
 
 	// Sign
-	signature, err := signer.Sign(digest)
+	signature, err := sign(digest)
 	if err != nil {
-		return fmt.Errorf("sign: %w", err)
+		return err
 	}
 
 	// Encode signature to hex
@@ -185,7 +239,7 @@ func Sign(ctx context.Context, r io.ReaderAt, size int64, w io.Writer, signer se
 
 	// Pad with 0s to fill hole
 	if int64(len(sigHex)) > holeLen {
-		return fmt.Errorf("signature too large: %d > %d", len(sigHex), holeLen)
+		return fmt.Errorf("signature too large: %d > %d bytes reserved", len(signature), sigLen)
 	}
 
 	// Write Signature
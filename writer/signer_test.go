@@ -257,3 +257,82 @@ func TestSign_ByteRangePadding(t *testing.T) {
 		}
 	}
 }
+
+func TestSign_TimestampChain(t *testing.T) {
+	b := builder.NewBuilder()
+	b.NewPage(612, 792).DrawText("Timestamp Test", 100, 700, builder.TextOptions{FontSize: 12}).Finish()
+	doc, err := b.Build()
+	if err != nil {
+		t.Fatalf("Failed to build PDF doc: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := NewWriter().Write(context.Background(), doc, &buf, Config{Version: PDF17}); err != nil {
+		t.Fatalf("Failed to write PDF: %v", err)
+	}
+	pdfContent := buf.Bytes()
+
+	// A three-level RSA-4096 hierarchy for both the signer and the TSA, as
+	// issued by public CAs. One key keeps the test fast; only the sizes of
+	// the certificates matter here.
+	key, err := rsa.GenerateKey(rand.Reader, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial := int64(0)
+	issue := func(name string, parent *x509.Certificate, ca bool, usage ...x509.ExtKeyUsage) *x509.Certificate {
+		serial++
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: name, Organization: []string{"Example Trust Services Ltd"}, Country: []string{"GB"}},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			ExtKeyUsage:           usage,
+			BasicConstraintsValid: true,
+			IsCA:                  ca,
+			CRLDistributionPoints: []string{"http://crl.example.com/" + name + ".crl"},
+			OCSPServer:            []string{"http://ocsp.example.com"},
+		}
+		if parent == nil {
+			parent = tmpl
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	root := issue("Example Root CA", nil, true)
+	signingCA := issue("Example Signing CA", root, true)
+	tsaCA := issue("Example Timestamping CA", root, true)
+	leaf := issue("Example Signer", signingCA, false)
+	tsa := security.NewLocalTSA(key, issue("Example TSA", tsaCA, false, x509.ExtKeyUsageTimeStamping))
+	tsa.Chain = []*x509.Certificate{tsaCA, root}
+	signer := security.NewRSASigner(key, []*x509.Certificate{leaf, signingCA, root})
+
+	sign := func(cfg SignConfig) ([]byte, error) {
+		var out bytes.Buffer
+		err := Sign(context.Background(), bytes.NewReader(pdfContent), int64(len(pdfContent)), &out, signer, cfg)
+		return out.Bytes(), err
+	}
+	if _, err := sign(SignConfig{PAdES: true, Timestamp: tsa, SignatureSize: DefaultSignatureSize}); err == nil || !strings.Contains(err.Error(), "signature too large") {
+		t.Fatalf("expected the timestamped signature to outgrow %d bytes, got %v", DefaultSignatureSize, err)
+	}
+	signed, err := sign(SignConfig{PAdES: true, Timestamp: tsa})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	start := bytes.Index(signed, []byte("/Contents <"))
+	if start < 0 {
+		t.Fatal("/Contents not found")
+	}
+	start += len("/Contents <")
+	end := bytes.IndexByte(signed[start:], '>')
+	if end != 2*TimestampSignatureSize {
+		t.Fatalf("reserved %d hex digits, want %d", end, 2*TimestampSignatureSize)
+	}
+}
@@ -0,0 +1,384 @@
+package writer
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/wudi/pdfkit/filters"
+	"github.com/wudi/pdfkit/ir/raw"
+	"github.com/wudi/pdfkit/ir/semantic"
+)
+
+// pageTreeFanout is the number of kids of each node of the page tree a
+// StreamWriter builds.
+const pageTreeFanout = 32
+
+// StreamWriter writes a document one page at a time, so that documents
+// of any length can be produced in memory proportional to a page and the
+// resources pages share.
+//
+// Each page is written, with the resources it uses, as soon as WritePage
+// is called. Fonts, images, patterns and shadings are deduplicated as in
+// Write: a resource used again is referenced, not written again, so it
+// must be complete when first used. Annotations and outlines can refer
+// to pages already written only. Close writes the page tree, the catalog
+// with the document-level entries, the cross-reference table or stream
+// and the trailer.
+//
+// Encryption, structure trees, forms, article threads, embedded files,
+// linearization, object streams, incremental updates, font subsetting
+// and optimization need the whole document and are not supported.
+type StreamWriter struct {
+	out    *bufio.Writer
+	cfg    Config
+	b      *objectBuilder
+	offset int64
+	// offsets holds the offset of each object written, by object number.
+	offsets []int64
+	// leaves holds the page tree node of each run of pageTreeFanout pages.
+	leaves []raw.ObjectRef
+	idHash hash.Hash
+	err    error
+	closed bool
+}
+
+// NewStreamWriter starts a document on out with the default serializers.
+func NewStreamWriter(out io.Writer, cfg Config) (*StreamWriter, error) {
+	return (&WriterBuilder{}).BuildStreamWriter(out, cfg)
+}
+
+// BuildStreamWriter starts a document on out with the builder's
+// serializers and writes its header.
+func (b *WriterBuilder) BuildStreamWriter(out io.Writer, cfg Config) (*StreamWriter, error) {
+	switch {
+	case cfg.Linearize:
+		return nil, errors.New("stream writer: linearization is not supported")
+	case cfg.Incremental:
+		return nil, errors.New("stream writer: incremental updates are not supported")
+	case cfg.ObjectStreams:
+		return nil, errors.New("stream writer: object streams are not supported")
+	case cfg.SubsetFonts:
+		return nil, errors.New("stream writer: font subsetting is not supported")
+	case cfg.Optimizer != nil:
+		return nil, errors.New("stream writer: optimization is not supported")
+	}
+	w := &StreamWriter{
+		out:     bufio.NewWriter(out),
+		cfg:     cfg,
+		b:       newObjectBuilder(&semantic.Document{}, cfg, 1, [2][]byte{}, b.annotSerializer, b.actionSerializer, b.csSerializer, b.funcSerializer),
+		offsets: []int64{0},
+		idHash:  sha256.New(),
+	}
+	version := pdfVersion(cfg)
+	w.idHash.Write([]byte(version))
+	w.write([]byte("%PDF-" + version + "\n%\xE2\xE3\xCF\xD3\n"))
+	return w, w.err
+}
+
+// WritePage writes p, and the resources it uses that have not been
+// written yet, to the output. p is not retained.
+func (w *StreamWriter) WritePage(ctx context.Context, p *semantic.Page) error {
+	if w.closed {
+		return errors.New("stream writer: closed")
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(w.b.pageRefs)%pageTreeFanout == 0 {
+		w.leaves = append(w.leaves, w.b.nextRef())
+	}
+	contentRef, err := w.b.addContentStream(p)
+	if err != nil {
+		return err
+	}
+	ref := w.b.nextRef()
+	w.b.pageRefs = append(w.b.pageRefs, ref)
+	if _, err := w.b.addPage(p, ref, w.leaves[len(w.leaves)-1], contentRef, newResourceUnion()); err != nil {
+		return err
+	}
+	fmt.Fprintf(w.idHash, "%f-%f-%f-%f-%d", p.MediaBox.LLX, p.MediaBox.LLY, p.MediaBox.URX, p.MediaBox.URY, p.Rotate)
+	w.flush()
+	return w.err
+}
+
+// PageCount returns the number of pages written so far.
+func (w *StreamWriter) PageCount() int {
+	return len(w.b.pageRefs)
+}
+
+// Close completes the document. doc supplies the document-level entries:
+// Info, Metadata, Lang, Marked, PageLabels, Outlines, OCProperties and
+// OutputIntents; its pages must have been written with WritePage. doc
+// may be nil. Close does not close the underlying writer.
+func (w *StreamWriter) Close(ctx context.Context, doc *semantic.Document) error {
+	if w.closed {
+		return errors.New("stream writer: closed")
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if doc == nil {
+		doc = &semantic.Document{}
+	}
+	if err := streamUnsupported(doc); err != nil {
+		return err
+	}
+	b := w.b
+	b.doc = doc
+
+	pagesRef := w.addPageTree()
+	info, metadata := syncMetadata(doc.Info, doc.Metadata)
+	infoRef := b.addInfo(info)
+	metadataRef := b.addMetadata(metadata)
+	outputIntentRefs := b.addOutputIntents(doc.OutputIntents)
+
+	catalogDict := raw.Dict()
+	catalogDict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Catalog"))
+	catalogDict.Set(raw.NameLiteral("Pages"), raw.Ref(pagesRef.Num, pagesRef.Gen))
+	if doc.Lang != "" {
+		catalogDict.Set(raw.NameLiteral("Lang"), raw.Str([]byte(doc.Lang)))
+	}
+	if doc.Marked {
+		mark := raw.Dict()
+		mark.Set(raw.NameLiteral("Marked"), raw.Bool(true))
+		catalogDict.Set(raw.NameLiteral("MarkInfo"), mark)
+	}
+	if metadataRef != nil {
+		catalogDict.Set(raw.NameLiteral("Metadata"), raw.Ref(metadataRef.Num, metadataRef.Gen))
+	}
+	if doc.Info != nil && doc.Info.Title != "" {
+		vp := raw.Dict()
+		vp.Set(raw.NameLiteral("DisplayDocTitle"), raw.Bool(true))
+		catalogDict.Set(raw.NameLiteral("ViewerPreferences"), vp)
+	}
+	if labels := pageLabelsDict(doc.PageLabels); labels != nil {
+		catalogDict.Set(raw.NameLiteral("PageLabels"), labels)
+	}
+	if len(doc.Outlines) > 0 {
+		outlineRef := b.addOutlines(doc.Outlines)
+		catalogDict.Set(raw.NameLiteral("Outlines"), raw.Ref(outlineRef.Num, outlineRef.Gen))
+		catalogDict.Set(raw.NameLiteral("PageMode"), raw.NameLiteral("UseOutlines"))
+	}
+	if ocProps := b.serializeOCProperties(); ocProps != nil {
+		catalogDict.Set(raw.NameLiteral("OCProperties"), ocProps)
+	}
+	if len(outputIntentRefs) > 0 {
+		arr := raw.NewArray()
+		for _, ref := range outputIntentRefs {
+			arr.Append(raw.Ref(ref.Num, ref.Gen))
+		}
+		catalogDict.Set(raw.NameLiteral("OutputIntents"), arr)
+	}
+	catalogRef := b.nextRef()
+	b.objects[catalogRef] = catalogDict
+	w.flush()
+
+	ids := fileIDFromSeed(w.idSeed(doc), w.cfg)
+	if w.cfg.XRefStreams {
+		w.writeXRefStream(catalogRef, infoRef, doc, ids)
+	} else {
+		w.writeXRefTable(catalogRef, infoRef, doc, ids)
+	}
+	if w.err == nil {
+		w.err = w.out.Flush()
+	}
+	return w.err
+}
+
+// streamUnsupported reports the document-level features a StreamWriter
+// cannot write.
+func streamUnsupported(doc *semantic.Document) error {
+	switch {
+	case len(doc.Pages) > 0:
+		return errors.New("stream writer: pages must be written with WritePage")
+	case doc.Encrypted:
+		return errors.New("stream writer: encryption is not supported")
+	case doc.StructTree != nil:
+		return errors.New("stream writer: structure trees are not supported")
+	case doc.AcroForm != nil:
+		return errors.New("stream writer: forms are not supported")
+	case len(doc.Articles) > 0:
+		return errors.New("stream writer: article threads are not supported")
+	case len(doc.EmbeddedFiles) > 0:
+		return errors.New("stream writer: embedded files are not supported")
+	}
+	return nil
+}
+
+// addPageTree adds the page tree nodes above the leaves pages were
+// assigned to and returns its root. A single leaf is the root itself.
+func (w *StreamWriter) addPageTree() raw.ObjectRef {
+	type node struct {
+		ref   raw.ObjectRef
+		kids  []raw.ObjectRef
+		count int
+	}
+	pages := w.b.pageRefs
+	level := make([]node, len(w.leaves))
+	for i, ref := range w.leaves {
+		kids := pages[i*pageTreeFanout : min((i+1)*pageTreeFanout, len(pages))]
+		level[i] = node{ref: ref, kids: kids, count: len(kids)}
+	}
+	if len(level) == 0 {
+		level = append(level, node{ref: w.b.nextRef()})
+	}
+	emit := func(n node, parent *raw.ObjectRef) {
+		kids := raw.NewArray()
+		for _, k := range n.kids {
+			kids.Append(raw.Ref(k.Num, k.Gen))
+		}
+		dict := raw.Dict()
+		dict.Set(raw.NameLiteral("Type"), raw.NameLiteral("Pages"))
+		dict.Set(raw.NameLiteral("Kids"), kids)
+		dict.Set(raw.NameLiteral("Count"), raw.NumberInt(int64(n.count)))
+		if parent != nil {
+			dict.Set(raw.NameLiteral("Parent"), raw.Ref(parent.Num, parent.Gen))
+		}
+		w.b.objects[n.ref] = dict
+	}
+	for len(level) > 1 {
+		var next []node
+		for i := 0; i < len(level); i += pageTreeFanout {
+			group := level[i:min(i+pageTreeFanout, len(level))]
+			parent := node{ref: w.b.nextRef()}
+			for _, n := range group {
+				emit(n, &parent.ref)
+				parent.kids = append(parent.kids, n.ref)
+				parent.count += n.count
+			}
+			next = append(next, parent)
+		}
+		level = next
+	}
+	emit(level[0], nil)
+	return level[0].ref
+}
+
+// flush writes the objects built since the last flush in object number
+// order and forgets them.
+func (w *StreamWriter) flush() {
+	refs := make([]raw.ObjectRef, 0, len(w.b.objects))
+	for ref := range w.b.objects {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Num < refs[j].Num })
+	for _, ref := range refs {
+		for len(w.offsets) <= ref.Num {
+			w.offsets = append(w.offsets, 0)
+		}
+		w.offsets[ref.Num] = w.offset
+		w.write(serializeObject(ref, w.b.objects[ref]))
+	}
+	clear(w.b.objects)
+}
+
+func (w *StreamWriter) write(data []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.out.Write(data)
+	w.offset += int64(n)
+	w.err = err
+}
+
+// idSeed returns the seed of the file identifier: the version and page
+// boxes hashed as pages were written, and the document information.
+func (w *StreamWriter) idSeed(doc *semantic.Document) []byte {
+	h := w.idHash
+	if doc.Info != nil {
+		h.Write([]byte(doc.Info.Title))
+		h.Write([]byte(doc.Info.Author))
+		h.Write([]byte(doc.Info.Subject))
+		h.Write([]byte(doc.Info.Creator))
+		h.Write([]byte(doc.Info.Producer))
+		h.Write([]byte(strings.Join(doc.Info.Keywords, ",")))
+	}
+	fmt.Fprintf(h, "%d", len(w.b.pageRefs))
+	return h.Sum(nil)[:16]
+}
+
+func (w *StreamWriter) writeXRefTable(catalogRef raw.ObjectRef, infoRef *raw.ObjectRef, doc *semantic.Document, ids [2][]byte) {
+	xrefOffset := w.offset
+	size := w.b.objNum
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "xref\n0 %d\n", size)
+	buf.WriteString("0000000000 65535 f \n")
+	for i := 1; i < size; i++ {
+		if i < len(w.offsets) && w.offsets[i] > 0 {
+			fmt.Fprintf(&buf, "%010d 00000 n \n", w.offsets[i])
+		} else {
+			buf.WriteString("0000000000 65535 f \n")
+		}
+		if buf.Len() >= 64<<10 {
+			w.write([]byte(buf.String()))
+			buf.Reset()
+		}
+	}
+	trailer := buildTrailer(size, catalogRef, infoRef, nil, doc, w.cfg, 0, ids)
+	buf.WriteString("trailer\n")
+	buf.Write(serializePrimitive(trailer))
+	fmt.Fprintf(&buf, "\nstartxref\n%d\n%%EOF\n", xrefOffset)
+	w.write([]byte(buf.String()))
+}
+
+// writeXRefStream writes the cross-reference stream, its offset field
+// as wide as the largest offset needs.
+func (w *StreamWriter) writeXRefStream(catalogRef raw.ObjectRef, infoRef *raw.ObjectRef, doc *semantic.Document, ids [2][]byte) {
+	xrefRef := w.b.nextRef()
+	xrefOffset := w.offset
+	size := w.b.objNum
+	width := 1
+	for v := xrefOffset >> 8; v > 0; v >>= 8 {
+		width++
+	}
+	entries := make([]byte, 0, size*(width+2))
+	entry := func(typ byte, field2 int64, gen byte) {
+		entries = append(entries, typ)
+		for shift := 8 * (width - 1); shift >= 0; shift -= 8 {
+			entries = append(entries, byte(field2>>shift))
+		}
+		entries = append(entries, gen)
+	}
+	entry(0, 0, 0xFF)
+	for i := 1; i < size; i++ {
+		switch {
+		case i == xrefRef.Num:
+			entry(1, xrefOffset, 0)
+		case i < len(w.offsets) && w.offsets[i] > 0:
+			entry(1, w.offsets[i], 0)
+		default:
+			entry(0, 0, 0xFF)
+		}
+	}
+
+	trailer := buildTrailer(size, catalogRef, infoRef, nil, doc, w.cfg, 0, ids)
+	trailer.Set(raw.NameLiteral("Type"), raw.NameLiteral("XRef"))
+	trailer.Set(raw.NameLiteral("W"), raw.NewArray(raw.NumberInt(1), raw.NumberInt(int64(width)), raw.NumberInt(1)))
+	if w.cfg.Compression > 0 {
+		pred := &filters.PredictorParams{Colors: 1, BitsPerComponent: 8, Columns: width + 2}
+		if compressed, parms, err := filters.EncodeFlate(entries, flateOptions(w.cfg, pred)); err == nil {
+			entries = compressed
+			trailer.Set(raw.NameLiteral("Filter"), raw.NameLiteral("FlateDecode"))
+			if parms != nil {
+				trailer.Set(raw.NameLiteral("DecodeParms"), parms)
+			}
+		}
+	}
+	trailer.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(entries))))
+	w.write(serializeObject(xrefRef, raw.NewStream(trailer, entries)))
+	w.write([]byte(fmt.Sprintf("startxref\n%d\n%%EOF\n", xrefOffset)))
+}
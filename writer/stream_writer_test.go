@@ -0,0 +1,128 @@
+package writer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/ir"
+	"github.com/wudi/pdfkit/ir/raw"
+	"github.com/wudi/pdfkit/ir/semantic"
+	"github.com/wudi/pdfkit/parser"
+	"github.com/wudi/pdfkit/xref"
+)
+
+func TestStreamWriter_Builder(t *testing.T) {
+	const pages = 70 // three page tree leaves under a root
+	img := &semantic.Image{
+		Width:            2,
+		Height:           2,
+		ColorSpace:       &semantic.DeviceColorSpace{Name: "DeviceGray"},
+		BitsPerComponent: 8,
+		Data:             []byte{0x00, 0x40, 0x80, 0xFF},
+	}
+	for _, cfg := range []Config{{}, {XRefStreams: true, Compression: 9}} {
+		var buf bytes.Buffer
+		sw, err := NewStreamWriter(&buf, cfg)
+		if err != nil {
+			t.Fatalf("NewStreamWriter: %v", err)
+		}
+		b := builder.NewStreamingBuilder(sw)
+		b.SetInfo(&semantic.DocumentInfo{Title: "Statements"})
+		for i := 0; i < pages; i++ {
+			b.NewPage(200, 200).
+				DrawText(fmt.Sprintf("Statement %d", i), 10, 20, builder.TextOptions{FontSize: 12}).
+				DrawImage(img, 10, 50, 20, 20, builder.ImageOptions{}).
+				Finish()
+		}
+		b.AddOutline(builder.Outline{Title: "Last", PageIndex: pages - 1})
+		doc, err := b.Build()
+		if err != nil {
+			t.Fatalf("Build: %v", err)
+		}
+		if sw.PageCount() != pages {
+			t.Fatalf("streamed %d pages, want %d", sw.PageCount(), pages)
+		}
+		if err := sw.Close(context.Background(), doc); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+
+		data := buf.Bytes()
+		table, err := xref.NewResolver(xref.ResolverConfig{}).Resolve(context.Background(), bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("resolve xref: %v", err)
+		}
+		offsets := scanObjectOffsets(data)
+		if len(table.Objects()) < len(offsets) {
+			t.Fatalf("xref streams %v: %d xref entries for %d objects", cfg.XRefStreams, len(table.Objects()), len(offsets))
+		}
+		for num, actual := range offsets {
+			if off, _, ok := table.Lookup(num); !ok || off != actual {
+				t.Fatalf("xref streams %v: object %d at %d, xref says %d", cfg.XRefStreams, num, actual, off)
+			}
+		}
+
+		rawDoc, err := parser.NewDocumentParser(parser.Config{}).Parse(context.Background(), bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("parse raw: %v", err)
+		}
+		images, fonts, outlines := 0, 0, 0
+		for _, obj := range rawDoc.Objects {
+			var d raw.Dictionary
+			switch o := obj.(type) {
+			case *raw.DictObj:
+				d = o
+			case *raw.StreamObj:
+				d = o.Dictionary()
+			default:
+				continue
+			}
+			if v, ok := d.Get(raw.NameLiteral("Subtype")); ok && v.(raw.NameObj).Value() == "Image" {
+				images++
+			}
+			if v, ok := d.Get(raw.NameLiteral("Type")); ok {
+				switch v.(raw.NameObj).Value() {
+				case "Font":
+					fonts++
+				case "Outlines":
+					outlines++
+				}
+			}
+		}
+		if images != 1 || fonts != 1 {
+			t.Errorf("xref streams %v: %d images and %d fonts written, want one of each", cfg.XRefStreams, images, fonts)
+		}
+		if outlines != 1 {
+			t.Errorf("xref streams %v: outlines missing", cfg.XRefStreams)
+		}
+
+		parsed, err := ir.NewDefault().Parse(context.Background(), bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		if len(parsed.Pages) != pages {
+			t.Fatalf("xref streams %v: parsed %d pages, want %d", cfg.XRefStreams, len(parsed.Pages), pages)
+		}
+		if parsed.Info == nil || parsed.Info.Title != "Statements" {
+			t.Errorf("xref streams %v: info not written", cfg.XRefStreams)
+		}
+	}
+}
+
+func TestStreamWriter_Unsupported(t *testing.T) {
+	if _, err := NewStreamWriter(&bytes.Buffer{}, Config{Linearize: true}); err == nil {
+		t.Error("expected error for linearization")
+	}
+	sw, err := NewStreamWriter(&bytes.Buffer{}, Config{})
+	if err != nil {
+		t.Fatalf("NewStreamWriter: %v", err)
+	}
+	if err := sw.Close(context.Background(), &semantic.Document{Encrypted: true}); err == nil {
+		t.Error("expected error for encryption")
+	}
+	if err := sw.WritePage(context.Background(), &semantic.Page{}); err == nil {
+		t.Error("expected error writing to a closed writer")
+	}
+}
@@ -33,8 +33,15 @@ const (
 	FilterASCII85
 	FilterRunLength
 	FilterLZW
+	// FilterJPX compresses streams with Flate: there is no JPEG 2000
+	// encoder, and the codec only applies to images.
 	FilterJPX
+	// FilterJBIG2 compresses 1-bit gray images and image masks as JBIG2
+	// generic regions, and other streams with Flate.
 	FilterJBIG2
+	// FilterCCITTFax compresses 1-bit gray images and image masks with
+	// CCITT Group 4, and other streams with Flate.
+	FilterCCITTFax
 )
 
 type Config struct {
@@ -50,6 +57,15 @@ type Config struct {
 	PDFALevel     pdfa.Level
 	Optimizer     *optimize.Optimizer
 	Encryption    security.EncryptionOptions
+	// Predictors applies PNG predictors, chosen row by row, to the image
+	// XObjects and xref streams the writer Flate-compresses.
+	Predictors bool
+	// AdaptiveCompression chooses the Flate level of each stream from its
+	// size; Compression then only switches compression on.
+	AdaptiveCompression bool
+	// TryAlternatives compresses each Flate stream at several levels, with
+	// and without predictors, and keeps the smallest result.
+	TryAlternatives bool
 }
 
 type Writer interface {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"sort"
 
+	"github.com/wudi/pdfkit/filters"
 	"github.com/wudi/pdfkit/fonts"
 	"github.com/wudi/pdfkit/ir/raw"
 	"github.com/wudi/pdfkit/ir/semantic"
@@ -20,6 +21,11 @@ type impl struct {
 }
 
 func (w *impl) SerializeObject(ref raw.ObjectRef, obj raw.Object) ([]byte, error) {
+	return serializeObject(ref, obj), nil
+}
+
+// serializeObject returns the indirect object ref holding obj.
+func serializeObject(ref raw.ObjectRef, obj raw.Object) []byte {
 	var buf bytes.Buffer
 	buf.WriteString(fmt.Sprintf("%d %d obj\n", ref.Num, ref.Gen))
 	switch o := obj.(type) {
@@ -42,7 +48,7 @@ func (w *impl) SerializeObject(ref raw.ObjectRef, obj raw.Object) ([]byte, error
 		buf.WriteString("null\n")
 	}
 	buf.WriteString("endobj\n")
-	return buf.Bytes(), nil
+	return buf.Bytes()
 }
 
 func (w *impl) Write(ctx context.Context, doc *semantic.Document, out WriterAt, cfg Config) (err error) {
@@ -57,6 +63,9 @@ func (w *impl) Write(ctx context.Context, doc *semantic.Document, out WriterAt,
 	if err := checkCancelled(); err != nil {
 		return err
 	}
+	if err := doc.LoadPages(ctx); err != nil {
+		return err
+	}
 
 	// Run optimization
 	if cfg.Optimizer != nil {
@@ -93,7 +102,7 @@ func (w *impl) Write(ctx context.Context, doc *semantic.Document, out WriterAt,
 	}
 
 	// Run raw optimization
-	rawDoc := &raw.Document{Objects: objects}
+	rawDoc := &raw.Document{Objects: objects, Encrypted: encryptRef != nil}
 	if cfg.Optimizer != nil {
 		if err := cfg.Optimizer.OptimizeRaw(ctx, rawDoc); err != nil {
 			return err
@@ -174,7 +183,7 @@ func (w *impl) Write(ctx context.Context, doc *semantic.Document, out WriterAt,
 
 		// Compress if needed
 		if cfg.Compression > 0 {
-			compressed, err := flateEncode(fullData, cfg.Compression)
+			compressed, err := flateEncode(fullData, cfg)
 			if err == nil {
 				fullData = compressed
 				stmDict.Set(raw.NameLiteral("Filter"), raw.NameLiteral("FlateDecode"))
@@ -267,10 +276,15 @@ func (w *impl) Write(ctx context.Context, doc *semantic.Document, out WriterAt,
 
 		// Compress XRef stream
 		if cfg.Compression > 0 {
-			compressed, err := flateEncode(entries, cfg.Compression)
+			// Each entry is a row of the 1+4+1 byte fields of W.
+			pred := &filters.PredictorParams{Colors: 1, BitsPerComponent: 8, Columns: 6}
+			compressed, parms, err := filters.EncodeFlate(entries, flateOptions(cfg, pred))
 			if err == nil {
 				entries = compressed
 				trailer.Set(raw.NameLiteral("Filter"), raw.NameLiteral("FlateDecode"))
+				if parms != nil {
+					trailer.Set(raw.NameLiteral("DecodeParms"), parms)
+				}
 			}
 		}
 		trailer.Set(raw.NameLiteral("Length"), raw.NumberInt(int64(len(entries))))
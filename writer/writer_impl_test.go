@@ -19,6 +19,7 @@ import (
 	"fmt"
 
 	"github.com/wudi/pdfkit/builder"
+	"github.com/wudi/pdfkit/filters"
 	"github.com/wudi/pdfkit/fonts"
 	"github.com/wudi/pdfkit/ir"
 	"github.com/wudi/pdfkit/ir/raw"
@@ -534,27 +535,102 @@ func TestWriter_ContentStream_ASCIIHexAndASCII85(t *testing.T) {
 	})
 }
 
-func TestWriter_ContentStreamJPXJBIG2(t *testing.T) {
-	content := []byte{0x00, 0x01, 0x02}
+func TestWriter_ImageCodecFilters(t *testing.T) {
+	// A 16x2 bilevel image: a black pixel at each end of the first row.
+	samples := []byte{0x7F, 0xFE, 0xFF, 0xFF}
 	doc := &semantic.Document{
-		Pages: []*semantic.Page{
-			{MediaBox: semantic.Rectangle{URX: 5, URY: 5}, Contents: []semantic.ContentStream{{RawBytes: content}}},
-		},
+		Pages: []*semantic.Page{{
+			MediaBox: semantic.Rectangle{URX: 16, URY: 2},
+			Resources: &semantic.Resources{XObjects: map[string]semantic.XObject{
+				"Im1": {Subtype: "Image", Width: 16, Height: 2, BitsPerComponent: 1, ColorSpace: semantic.DeviceColorSpace{Name: "DeviceGray"}, Data: samples},
+				"Im2": {Subtype: "Image", Width: 2, Height: 1, BitsPerComponent: 8, ColorSpace: semantic.DeviceColorSpace{Name: "DeviceGray"}, Data: []byte{0, 255}},
+			}},
+			Contents: []semantic.ContentStream{{RawBytes: []byte("q 16 0 0 2 0 0 cm /Im1 Do Q")}},
+		}},
+	}
+	for _, tc := range []struct {
+		filter ContentFilter
+		codec  string
+	}{{FilterJPX, ""}, {FilterJBIG2, "JBIG2Decode"}, {FilterCCITTFax, "CCITTFaxDecode"}} {
+		var buf bytes.Buffer
+		if err := NewWriter().Write(context.Background(), doc, &buf, Config{ContentFilter: tc.filter, Deterministic: true}); err != nil {
+			t.Fatalf("write %s: %v", tc.codec, err)
+		}
+		if bytes.Contains(buf.Bytes(), []byte("/JPXDecode")) {
+			t.Fatalf("JPX filter set on data that is not JPEG 2000")
+		}
+		parsed, err := ir.NewDefault().Parse(context.Background(), bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("parse %s: %v", tc.codec, err)
+		}
+		if cs := parsed.Pages[0].Contents; len(cs) == 0 || !bytes.Contains(cs[0].RawBytes, []byte("/Im1 Do")) {
+			t.Fatalf("%s: content stream not readable", tc.codec)
+		}
+		im1, im2 := parsed.Pages[0].Resources.XObjects["Im1"], parsed.Pages[0].Resources.XObjects["Im2"]
+		if im1.Filter != tc.codec || im2.Filter != "" {
+			t.Fatalf("filters %q and %q, want %q for the bilevel image only", im1.Filter, im2.Filter, tc.codec)
+		}
+		if tc.codec == "" && !bytes.Equal(im1.Data, samples) {
+			t.Fatalf("samples = %x", im1.Data)
+		}
+		if tc.codec != "" && bytes.Equal(im1.Data, samples) {
+			t.Fatalf("%s: samples stored unencoded", tc.codec)
+		}
+	}
+}
+
+func TestWriter_SharesJBIG2Globals(t *testing.T) {
+	enc := filters.NewJBIG2Encoder()
+	page := bytes.Repeat([]byte{0xFF}, 4*8)
+	for y := 1; y < 6; y++ {
+		page[y*4] = 0x9D
+		page[y*4+2] = 0xB9
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := enc.AddPage(page, 32, 8); err != nil {
+			t.Fatal(err)
+		}
+	}
+	globals, streams, err := enc.Encode()
+	if err != nil || len(globals) == 0 {
+		t.Fatalf("Encode: %d bytes of globals, %v", len(globals), err)
+	}
+	xobjects := map[string]semantic.XObject{}
+	for i, s := range streams {
+		xobjects[fmt.Sprintf("Im%d", i)] = semantic.XObject{Subtype: "Image", Width: 32, Height: 8, BitsPerComponent: 1,
+			ColorSpace: semantic.DeviceColorSpace{Name: "DeviceGray"}, Data: s, Filter: "JBIG2Decode", JBIG2Globals: globals}
 	}
+	doc := &semantic.Document{Pages: []*semantic.Page{{
+		MediaBox:  semantic.Rectangle{URX: 32, URY: 8},
+		Resources: &semantic.Resources{XObjects: xobjects},
+	}}}
 	var buf bytes.Buffer
-	w := NewWriter()
-	if err := w.Write(context.TODO(), doc, &buf, Config{ContentFilter: FilterJPX, Deterministic: true}); err != nil {
-		t.Fatalf("write jpx: %v", err)
+	if err := NewWriter().Write(context.Background(), doc, &buf, Config{Deterministic: true}); err != nil {
+		t.Fatalf("write: %v", err)
 	}
-	if !bytes.Contains(buf.Bytes(), []byte("/Filter /JPXDecode")) {
-		t.Fatalf("JPX filter not set")
+	if n := bytes.Count(buf.Bytes(), []byte("/JBIG2Globals")); n != 2 {
+		t.Fatalf("%d JBIG2Globals entries, want 2", n)
 	}
-	buf.Reset()
-	if err := w.Write(context.TODO(), doc, &buf, Config{ContentFilter: FilterJBIG2, Deterministic: true}); err != nil {
-		t.Fatalf("write jbig2: %v", err)
+	if n := bytes.Count(buf.Bytes(), globals); n != 1 {
+		t.Fatalf("globals written %d times, want once", n)
 	}
-	if !bytes.Contains(buf.Bytes(), []byte("/Filter /JBIG2Decode")) {
-		t.Fatalf("JBIG2 filter not set")
+	parsed, err := ir.NewDefault().Parse(context.Background(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	for name, xo := range parsed.Pages[0].Resources.XObjects {
+		if xo.Filter != "JBIG2Decode" || !bytes.Equal(xo.JBIG2Globals, globals) || xo.DecodeParms != nil {
+			t.Fatalf("%s: filter %q, %d bytes of globals, params %v", name, xo.Filter, len(xo.JBIG2Globals), xo.DecodeParms)
+		}
+		params := raw.Dict()
+		params.Set(raw.NameLiteral("JBIG2Globals"), raw.NewStream(raw.Dict(), xo.JBIG2Globals))
+		pix, err := filters.NewJBIG2Decoder().Decode(context.Background(), xo.Data, params)
+		if err != nil || len(pix) != 32*8*4 {
+			t.Fatalf("%s: decode: %d bytes, %v", name, len(pix), err)
+		}
+		if pix[(1*32+1)*4] != 0 || pix[(1*32+0)*4] != 255 {
+			t.Fatalf("%s: decoded pixels differ", name)
+		}
 	}
 }
 
@@ -2941,3 +3017,41 @@ func TestWriter_AdvancedColorAndShading(t *testing.T) {
 		t.Fatalf("Mesh shading not found or malformed")
 	}
 }
+
+func TestWriter_Predictors(t *testing.T) {
+	const size = 64
+	data := make([]byte, size*size*3)
+	for i := range data {
+		data[i] = byte(i/3%size + i/(3*size))
+	}
+	write := func(cfg Config) []byte {
+		t.Helper()
+		doc := &semantic.Document{Pages: []*semantic.Page{{
+			MediaBox: semantic.Rectangle{URX: size, URY: size},
+			Resources: &semantic.Resources{XObjects: map[string]semantic.XObject{
+				"Im1": {Subtype: "Image", Width: size, Height: size, BitsPerComponent: 8,
+					ColorSpace: semantic.DeviceColorSpace{Name: "DeviceRGB"}, Data: data},
+			}},
+		}}}
+		var buf bytes.Buffer
+		if err := NewWriter().Write(context.Background(), doc, &buf, cfg); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		return buf.Bytes()
+	}
+	plain := write(Config{Compression: 9, XRefStreams: true, Deterministic: true})
+	predicted := write(Config{Compression: 9, XRefStreams: true, Deterministic: true, Predictors: true, AdaptiveCompression: true})
+	if n := bytes.Count(predicted, []byte("/Predictor 15")); n != 2 {
+		t.Fatalf("%d predicted streams, want the image and the xref stream", n)
+	}
+	if len(predicted) >= len(plain) {
+		t.Errorf("predicted output %d bytes, plain %d", len(predicted), len(plain))
+	}
+	parsed, err := ir.NewDefault().Parse(context.Background(), bytes.NewReader(predicted))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if xo := parsed.Pages[0].Resources.XObjects["Im1"]; !bytes.Equal(xo.Data, data) {
+		t.Fatalf("image data differs after round trip (filter %q)", xo.Filter)
+	}
+}
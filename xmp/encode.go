@@ -0,0 +1,221 @@
+package xmp
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// DefaultPadding is the whitespace Marshal callers usually reserve so the
+// packet can be edited in place: 2 KB, as the XMP specification suggests.
+const DefaultPadding = 2048
+
+const (
+	packetHeader  = "<?xpacket begin=\"\uFEFF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n"
+	packetTrailer = "<?xpacket end=\"w\"?>"
+)
+
+// Marshal serializes the packet followed by padding bytes of whitespace,
+// inside a writable xpacket wrapper. Each namespace's properties are
+// written in their own rdf:Description; structures use
+// rdf:parseType="Resource".
+func (p *Packet) Marshal(padding int) []byte {
+	body := p.marshalBody()
+	var sb strings.Builder
+	sb.Grow(len(packetHeader) + len(body) + padding + len(packetTrailer))
+	sb.WriteString(packetHeader)
+	sb.WriteString(body)
+	writePadding(&sb, padding)
+	sb.WriteString(packetTrailer)
+	return []byte(sb.String())
+}
+
+// MarshalToSize serializes the packet padded to exactly size bytes, so that
+// it can replace a packet of that size in place. It fails if the packet
+// does not fit.
+func (p *Packet) MarshalToSize(size int) ([]byte, error) {
+	n := len(packetHeader) + len(p.marshalBody()) + len(packetTrailer)
+	if n > size {
+		return nil, fmt.Errorf("xmp: packet needs %d bytes, %d available", n, size)
+	}
+	return p.Marshal(size - n), nil
+}
+
+// writePadding writes n bytes of whitespace in lines of up to 100 bytes.
+func writePadding(sb *strings.Builder, n int) {
+	for n > 0 {
+		line := min(n, 100)
+		sb.WriteString(strings.Repeat(" ", line-1))
+		sb.WriteByte('\n')
+		n -= line
+	}
+}
+
+// encoder serializes a packet with a fixed mapping of namespaces to
+// prefixes.
+type encoder struct {
+	sb       strings.Builder
+	prefixes map[string]string
+}
+
+func (p *Packet) marshalBody() string {
+	props := p.Properties
+	if len(p.Extensions) > 0 {
+		props = append(append([]Property(nil), props...), Property{
+			Namespace: NSPDFAExtension, Name: "schemas", Value: extensionsValue(p.Extensions),
+		})
+	}
+	e := &encoder{prefixes: p.assignPrefixes(props)}
+	e.sb.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/"`)
+	if p.Toolkit != "" {
+		e.sb.WriteString(` x:xmptk="`)
+		e.escape(p.Toolkit)
+		e.sb.WriteByte('"')
+	}
+	e.sb.WriteString(">\n <rdf:RDF xmlns:rdf=\"" + NSRDF + "\">\n")
+
+	var order []string
+	byNS := make(map[string][]Property)
+	for _, prop := range props {
+		if _, ok := byNS[prop.Namespace]; !ok {
+			order = append(order, prop.Namespace)
+		}
+		byNS[prop.Namespace] = append(byNS[prop.Namespace], prop)
+	}
+	for _, ns := range order {
+		group := byNS[ns]
+		e.sb.WriteString(`  <rdf:Description rdf:about="`)
+		e.escape(p.About)
+		e.sb.WriteByte('"')
+		for _, used := range usedNamespaces(group) {
+			e.sb.WriteString(" xmlns:" + e.prefixes[used] + `="`)
+			e.escape(used)
+			e.sb.WriteByte('"')
+		}
+		e.sb.WriteString(">\n")
+		for _, prop := range group {
+			e.element(e.qname(prop.Namespace, prop.Name), prop.Value, 3)
+		}
+		e.sb.WriteString("  </rdf:Description>\n")
+	}
+	e.sb.WriteString(" </rdf:RDF>\n</x:xmpmeta>\n")
+	return e.sb.String()
+}
+
+// assignPrefixes maps the namespaces used by props to distinct prefixes,
+// preferring registered and customary ones.
+func (p *Packet) assignPrefixes(props []Property) map[string]string {
+	out := map[string]string{NSRDF: "rdf", NSXML: "xml", NSX: "x"}
+	taken := map[string]bool{"rdf": true, "xml": true, "x": true}
+	generated := 0
+	for _, ns := range usedNamespaces(props) {
+		if _, ok := out[ns]; ok {
+			continue
+		}
+		prefix := p.Prefix(ns)
+		if prefix == "" || taken[prefix] || !validPrefix(prefix) {
+			for {
+				generated++
+				prefix = fmt.Sprintf("ns%d", generated)
+				if !taken[prefix] {
+					break
+				}
+			}
+		}
+		out[ns] = prefix
+		taken[prefix] = true
+	}
+	return out
+}
+
+func validPrefix(s string) bool {
+	for i, r := range s {
+		switch {
+		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+		case i > 0 && (r == '-' || r == '.' || r >= '0' && r <= '9'):
+		default:
+			return false
+		}
+	}
+	return s != "" && !strings.HasPrefix(strings.ToLower(s), "xml")
+}
+
+// usedNamespaces returns the namespaces of props and their fields, in
+// order of first use.
+func usedNamespaces(props []Property) []string {
+	var out []string
+	seen := make(map[string]bool)
+	var walk func(props []Property)
+	var walkValue func(v Value)
+	walkValue = func(v Value) {
+		for _, item := range v.Items {
+			walkValue(item)
+		}
+		walk(v.Fields)
+	}
+	walk = func(props []Property) {
+		for _, prop := range props {
+			if !seen[prop.Namespace] {
+				seen[prop.Namespace] = true
+				out = append(out, prop.Namespace)
+			}
+			walkValue(prop.Value)
+		}
+	}
+	walk(props)
+	return out
+}
+
+func (e *encoder) qname(ns, name string) string {
+	return e.prefixes[ns] + ":" + name
+}
+
+func (e *encoder) escape(s string) {
+	xml.EscapeText(&e.sb, []byte(s))
+}
+
+// element writes v as the element name, indented by indent spaces.
+func (e *encoder) element(name string, v Value, indent int) {
+	pad := strings.Repeat(" ", indent)
+	e.sb.WriteString(pad + "<" + name)
+	if v.Lang != "" {
+		e.sb.WriteString(` xml:lang="`)
+		e.escape(v.Lang)
+		e.sb.WriteByte('"')
+	}
+	switch v.Kind {
+	case Simple:
+		if v.URI {
+			e.sb.WriteString(` rdf:resource="`)
+			e.escape(v.Text)
+			e.sb.WriteString("\"/>\n")
+			return
+		}
+		e.sb.WriteByte('>')
+		e.escape(v.Text)
+		e.sb.WriteString("</" + name + ">\n")
+	case Struct:
+		if len(v.Fields) == 0 {
+			e.sb.WriteString(" rdf:parseType=\"Resource\"/>\n")
+			return
+		}
+		e.sb.WriteString(" rdf:parseType=\"Resource\">\n")
+		for _, f := range v.Fields {
+			e.element(e.qname(f.Namespace, f.Name), f.Value, indent+1)
+		}
+		e.sb.WriteString(pad + "</" + name + ">\n")
+	default:
+		container := "rdf:" + v.Kind.String()
+		e.sb.WriteString(">\n")
+		if len(v.Items) == 0 {
+			e.sb.WriteString(pad + " <" + container + "/>\n")
+		} else {
+			e.sb.WriteString(pad + " <" + container + ">\n")
+			for _, item := range v.Items {
+				e.element("rdf:li", item, indent+2)
+			}
+			e.sb.WriteString(pad + " </" + container + ">\n")
+		}
+		e.sb.WriteString(pad + "</" + name + ">\n")
+	}
+}
@@ -0,0 +1,197 @@
+package xmp
+
+// ExtensionSchema declares a custom schema in the pdfaExtension:schemas
+// property, which PDF/A requires for every schema it does not predefine.
+type ExtensionSchema struct {
+	Schema       string // description of the schema
+	NamespaceURI string
+	Prefix       string
+	Properties   []ExtensionProperty
+	ValueTypes   []ExtensionValueType
+}
+
+// ExtensionProperty declares a property of an extension schema.
+type ExtensionProperty struct {
+	Name        string
+	ValueType   string // such as "Text", "Integer", "seq Text" or a custom type
+	Category    string // "internal" or "external"
+	Description string
+}
+
+// ExtensionValueType declares a structured value type of an extension
+// schema.
+type ExtensionValueType struct {
+	Type         string
+	NamespaceURI string
+	Prefix       string
+	Description  string
+	Fields       []ExtensionField
+}
+
+// ExtensionField declares a field of an extension value type.
+type ExtensionField struct {
+	Name        string
+	ValueType   string
+	Description string
+}
+
+func (s ExtensionSchema) clone() ExtensionSchema {
+	s.Properties = append([]ExtensionProperty(nil), s.Properties...)
+	types := make([]ExtensionValueType, len(s.ValueTypes))
+	for i, vt := range s.ValueTypes {
+		vt.Fields = append([]ExtensionField(nil), vt.Fields...)
+		types[i] = vt
+	}
+	if s.ValueTypes != nil {
+		s.ValueTypes = types
+	}
+	return s
+}
+
+// Extension returns the extension schema declared for ns, or nil.
+func (p *Packet) Extension(ns string) *ExtensionSchema {
+	for i := range p.Extensions {
+		if p.Extensions[i].NamespaceURI == ns {
+			return &p.Extensions[i]
+		}
+	}
+	return nil
+}
+
+// AddExtension declares schema, replacing any declaration of the same
+// namespace, and registers its prefix.
+func (p *Packet) AddExtension(schema ExtensionSchema) {
+	if schema.Prefix != "" {
+		p.RegisterNamespace(schema.NamespaceURI, schema.Prefix)
+	}
+	if s := p.Extension(schema.NamespaceURI); s != nil {
+		*s = schema
+		return
+	}
+	p.Extensions = append(p.Extensions, schema)
+}
+
+// predefined are the schemas PDF/A allows without an extension schema
+// declaration: those of the XMP specification of 2004 and pdfaid.
+var predefined = map[string]bool{
+	NSDC: true, NSXMP: true, NSXMPRights: true, NSXMPMM: true, NSXMPBJ: true,
+	NSXMPTPg: true, NSXMPIdq: true, NSPDF: true, NSPhotoshop: true,
+	NSTIFF: true, NSEXIF: true, NSEXIFAux: true, NSPDFAID: true,
+	"http://ns.adobe.com/camera-raw-settings/1.0/": true,
+	"http://ns.adobe.com/xmp/1.0/DynamicMedia/":    true,
+}
+
+// Predefined reports whether PDF/A predefines the schema ns.
+func Predefined(ns string) bool { return predefined[ns] }
+
+// UndeclaredNamespaces returns the namespaces of properties that are
+// neither predefined by PDF/A nor declared by an extension schema.
+func (p *Packet) UndeclaredNamespaces() []string {
+	var out []string
+	for _, ns := range p.Namespaces() {
+		if !Predefined(ns) && p.Extension(ns) == nil {
+			out = append(out, ns)
+		}
+	}
+	return out
+}
+
+// parseExtensions converts a pdfaExtension:schemas value.
+func parseExtensions(v Value) []ExtensionSchema {
+	var out []ExtensionSchema
+	for _, item := range v.Items {
+		s := ExtensionSchema{
+			Schema:       fieldText(item, NSPDFASchema, "schema"),
+			NamespaceURI: fieldText(item, NSPDFASchema, "namespaceURI"),
+			Prefix:       fieldText(item, NSPDFASchema, "prefix"),
+		}
+		if props, ok := item.Field(NSPDFASchema, "property"); ok {
+			for _, prop := range props.Items {
+				s.Properties = append(s.Properties, ExtensionProperty{
+					Name:        fieldText(prop, NSPDFAProperty, "name"),
+					ValueType:   fieldText(prop, NSPDFAProperty, "valueType"),
+					Category:    fieldText(prop, NSPDFAProperty, "category"),
+					Description: fieldText(prop, NSPDFAProperty, "description"),
+				})
+			}
+		}
+		if types, ok := item.Field(NSPDFASchema, "valueType"); ok {
+			for _, t := range types.Items {
+				vt := ExtensionValueType{
+					Type:         fieldText(t, NSPDFAType, "type"),
+					NamespaceURI: fieldText(t, NSPDFAType, "namespaceURI"),
+					Prefix:       fieldText(t, NSPDFAType, "prefix"),
+					Description:  fieldText(t, NSPDFAType, "description"),
+				}
+				if fields, ok := t.Field(NSPDFAType, "field"); ok {
+					for _, f := range fields.Items {
+						vt.Fields = append(vt.Fields, ExtensionField{
+							Name:        fieldText(f, NSPDFAField, "name"),
+							ValueType:   fieldText(f, NSPDFAField, "valueType"),
+							Description: fieldText(f, NSPDFAField, "description"),
+						})
+					}
+				}
+				s.ValueTypes = append(s.ValueTypes, vt)
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func fieldText(v Value, ns, name string) string {
+	f, _ := v.Field(ns, name)
+	return f.String()
+}
+
+// extensionsValue converts extension schemas into a pdfaExtension:schemas
+// value.
+func extensionsValue(schemas []ExtensionSchema) Value {
+	v := Value{Kind: Bag}
+	for _, s := range schemas {
+		fields := []Property{
+			{Namespace: NSPDFASchema, Name: "schema", Value: TextValue(s.Schema)},
+			{Namespace: NSPDFASchema, Name: "namespaceURI", Value: TextValue(s.NamespaceURI)},
+			{Namespace: NSPDFASchema, Name: "prefix", Value: TextValue(s.Prefix)},
+		}
+		if len(s.Properties) > 0 {
+			props := Value{Kind: Seq}
+			for _, prop := range s.Properties {
+				props.Items = append(props.Items, StructValue(
+					Property{Namespace: NSPDFAProperty, Name: "name", Value: TextValue(prop.Name)},
+					Property{Namespace: NSPDFAProperty, Name: "valueType", Value: TextValue(prop.ValueType)},
+					Property{Namespace: NSPDFAProperty, Name: "category", Value: TextValue(prop.Category)},
+					Property{Namespace: NSPDFAProperty, Name: "description", Value: TextValue(prop.Description)},
+				))
+			}
+			fields = append(fields, Property{Namespace: NSPDFASchema, Name: "property", Value: props})
+		}
+		if len(s.ValueTypes) > 0 {
+			types := Value{Kind: Seq}
+			for _, vt := range s.ValueTypes {
+				tf := []Property{
+					{Namespace: NSPDFAType, Name: "type", Value: TextValue(vt.Type)},
+					{Namespace: NSPDFAType, Name: "namespaceURI", Value: TextValue(vt.NamespaceURI)},
+					{Namespace: NSPDFAType, Name: "prefix", Value: TextValue(vt.Prefix)},
+					{Namespace: NSPDFAType, Name: "description", Value: TextValue(vt.Description)},
+				}
+				if len(vt.Fields) > 0 {
+					fs := Value{Kind: Seq}
+					for _, f := range vt.Fields {
+						fs.Items = append(fs.Items, StructValue(
+							Property{Namespace: NSPDFAField, Name: "name", Value: TextValue(f.Name)},
+							Property{Namespace: NSPDFAField, Name: "valueType", Value: TextValue(f.ValueType)},
+							Property{Namespace: NSPDFAField, Name: "description", Value: TextValue(f.Description)},
+						))
+					}
+					tf = append(tf, Property{Namespace: NSPDFAType, Name: "field", Value: fs})
+				}
+				types.Items = append(types.Items, StructValue(tf...))
+			}
+			fields = append(fields, Property{Namespace: NSPDFASchema, Name: "valueType", Value: types})
+		}
+		v.Items = append(v.Items, StructValue(fields...))
+	}
+	return v
+}
@@ -0,0 +1,207 @@
+package xmp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxDepth bounds the nesting of parsed values.
+const maxDepth = 64
+
+// arrayKinds maps RDF container elements to array kinds.
+var arrayKinds = map[string]Kind{"Bag": Bag, "Seq": Seq, "Alt": Alt}
+
+// node is an element of the parsed XML tree.
+type node struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*node
+	text     strings.Builder
+}
+
+func (n *node) attr(space, local string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+func (n *node) find(space, local string) *node {
+	if n.name.Space == space && n.name.Local == local {
+		return n
+	}
+	for _, c := range n.children {
+		if found := c.find(space, local); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Parse parses an XMP packet, with or without its xpacket wrapper and
+// x:xmpmeta element. Properties of all rdf:Description elements are merged.
+func Parse(data []byte) (*Packet, error) {
+	p := New()
+	root, err := parseTree(data, p.prefixes)
+	if err != nil {
+		return nil, err
+	}
+	rdf := root.find(NSRDF, "RDF")
+	if rdf == nil {
+		return nil, errors.New("xmp: no rdf:RDF element")
+	}
+	if meta := root.find(NSX, "xmpmeta"); meta != nil {
+		p.Toolkit, _ = meta.attr(NSX, "xmptk")
+	}
+	for _, desc := range rdf.children {
+		if desc.name.Space != NSRDF || desc.name.Local != "Description" {
+			continue
+		}
+		if about, ok := desc.attr(NSRDF, "about"); ok && about != "" {
+			p.About = about
+		}
+		for _, prop := range fields(desc, 0) {
+			if prop.Namespace == NSPDFAExtension && prop.Name == "schemas" {
+				p.Extensions = append(p.Extensions, parseExtensions(prop.Value)...)
+				continue
+			}
+			p.Set(prop.Namespace, prop.Name, prop.Value)
+		}
+	}
+	return p, nil
+}
+
+// parseTree parses data into a tree of elements, recording the prefixes
+// it declares.
+func parseTree(data []byte, prefixes map[string]string) (*node, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	root := &node{}
+	stack := []*node{root}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("xmp: %w", err)
+		}
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if len(stack) > maxDepth*2 {
+				return nil, errors.New("xmp: elements nested too deeply")
+			}
+			n := &node{name: t.Name}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" {
+					if _, ok := prefixes[a.Value]; !ok {
+						prefixes[a.Value] = a.Name.Local
+					}
+					continue
+				}
+				if a.Name.Space == "" && a.Name.Local == "xmlns" {
+					continue
+				}
+				n.attrs = append(n.attrs, a)
+			}
+			top.children = append(top.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			top.text.Write(t)
+		}
+	}
+	return root, nil
+}
+
+// isProperty reports whether an attribute is a property rather than RDF
+// syntax or an XML attribute.
+func isProperty(name xml.Name) bool {
+	return name.Space != "" && name.Space != NSRDF && name.Space != NSXML
+}
+
+// fields returns the properties of a node: its property attributes and
+// property elements.
+func fields(n *node, depth int) []Property {
+	var out []Property
+	for _, a := range n.attrs {
+		if isProperty(a.Name) {
+			out = append(out, Property{Namespace: a.Name.Space, Name: a.Name.Local, Value: TextValue(a.Value)})
+		}
+	}
+	for _, c := range n.children {
+		if !isProperty(c.name) {
+			continue
+		}
+		out = append(out, Property{Namespace: c.name.Space, Name: c.name.Local, Value: parseValue(c, depth+1)})
+	}
+	return out
+}
+
+// parseValue parses the value of a property element or rdf:li.
+func parseValue(n *node, depth int) Value {
+	lang, _ := n.attr(NSXML, "lang")
+	if uri, ok := n.attr(NSRDF, "resource"); ok {
+		return Value{Text: uri, URI: true, Lang: lang}
+	}
+	if depth > maxDepth {
+		return Value{}
+	}
+	if pt, _ := n.attr(NSRDF, "parseType"); pt == "Resource" {
+		return structValue(n, depth, lang)
+	}
+	for _, c := range n.children {
+		if c.name.Space != NSRDF {
+			continue
+		}
+		switch c.name.Local {
+		case "Bag", "Seq", "Alt":
+			v := Value{Kind: arrayKinds[c.name.Local], Items: []Value{}}
+			for _, li := range c.children {
+				if li.name.Space == NSRDF && li.name.Local == "li" {
+					v.Items = append(v.Items, parseValue(li, depth+1))
+				}
+			}
+			return v
+		case "Description":
+			return structValue(c, depth, lang)
+		}
+	}
+	for _, a := range n.attrs {
+		if isProperty(a.Name) {
+			return structValue(n, depth, lang)
+		}
+	}
+	if len(n.children) > 0 {
+		return structValue(n, depth, lang)
+	}
+	return Value{Text: n.text.String(), Lang: lang}
+}
+
+// structValue returns the structure whose fields are the properties of n,
+// or the rdf:value of n if it is a qualified simple value.
+func structValue(n *node, depth int, lang string) Value {
+	if v, ok := n.attr(NSRDF, "value"); ok {
+		return Value{Text: v, Lang: lang}
+	}
+	for _, c := range n.children {
+		if c.name.Space == NSRDF && c.name.Local == "value" {
+			v := parseValue(c, depth+1)
+			if v.Lang == "" {
+				v.Lang = lang
+			}
+			return v
+		}
+	}
+	return Value{Kind: Struct, Fields: fields(n, depth), Lang: lang}
+}
@@ -0,0 +1,171 @@
+package xmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Title returns the default dc:title.
+func (p *Packet) Title() string { return p.LangText(NSDC, "title", XDefault) }
+
+// SetTitle sets the default dc:title.
+func (p *Packet) SetTitle(s string) { p.SetLangText(NSDC, "title", XDefault, s) }
+
+// Creators returns the dc:creator authors.
+func (p *Packet) Creators() []string { return p.Strings(NSDC, "creator") }
+
+// SetCreators sets the dc:creator authors.
+func (p *Packet) SetCreators(names ...string) { p.SetStrings(NSDC, "creator", Seq, names...) }
+
+// Description returns the default dc:description.
+func (p *Packet) Description() string { return p.LangText(NSDC, "description", XDefault) }
+
+// SetDescription sets the default dc:description.
+func (p *Packet) SetDescription(s string) { p.SetLangText(NSDC, "description", XDefault, s) }
+
+// Subjects returns the dc:subject keywords.
+func (p *Packet) Subjects() []string { return p.Strings(NSDC, "subject") }
+
+// SetSubjects sets the dc:subject keywords.
+func (p *Packet) SetSubjects(subjects ...string) { p.SetStrings(NSDC, "subject", Bag, subjects...) }
+
+// Keywords returns pdf:Keywords.
+func (p *Packet) Keywords() string { return p.Text(NSPDF, "Keywords") }
+
+// SetKeywords sets pdf:Keywords.
+func (p *Packet) SetKeywords(s string) { p.SetText(NSPDF, "Keywords", s) }
+
+// Producer returns pdf:Producer.
+func (p *Packet) Producer() string { return p.Text(NSPDF, "Producer") }
+
+// SetProducer sets pdf:Producer.
+func (p *Packet) SetProducer(s string) { p.SetText(NSPDF, "Producer", s) }
+
+// Trapped returns pdf:Trapped: "True", "False" or "Unknown".
+func (p *Packet) Trapped() string { return p.Text(NSPDF, "Trapped") }
+
+// SetTrapped sets pdf:Trapped.
+func (p *Packet) SetTrapped(s string) { p.SetText(NSPDF, "Trapped", s) }
+
+// CreatorTool returns xmp:CreatorTool.
+func (p *Packet) CreatorTool() string { return p.Text(NSXMP, "CreatorTool") }
+
+// SetCreatorTool sets xmp:CreatorTool.
+func (p *Packet) SetCreatorTool(s string) { p.SetText(NSXMP, "CreatorTool", s) }
+
+// Date returns the date property ns:name, reporting whether it is set and
+// valid.
+func (p *Packet) Date(ns, name string) (time.Time, bool) {
+	t, err := ParseDate(p.Text(ns, name))
+	return t, err == nil
+}
+
+// SetDate sets the date property ns:name.
+func (p *Packet) SetDate(ns, name string, t time.Time) { p.SetText(ns, name, FormatDate(t)) }
+
+// CreateDate returns xmp:CreateDate.
+func (p *Packet) CreateDate() (time.Time, bool) { return p.Date(NSXMP, "CreateDate") }
+
+// SetCreateDate sets xmp:CreateDate.
+func (p *Packet) SetCreateDate(t time.Time) { p.SetDate(NSXMP, "CreateDate", t) }
+
+// ModifyDate returns xmp:ModifyDate.
+func (p *Packet) ModifyDate() (time.Time, bool) { return p.Date(NSXMP, "ModifyDate") }
+
+// SetModifyDate sets xmp:ModifyDate.
+func (p *Packet) SetModifyDate(t time.Time) { p.SetDate(NSXMP, "ModifyDate", t) }
+
+// MetadataDate returns xmp:MetadataDate.
+func (p *Packet) MetadataDate() (time.Time, bool) { return p.Date(NSXMP, "MetadataDate") }
+
+// SetMetadataDate sets xmp:MetadataDate.
+func (p *Packet) SetMetadataDate(t time.Time) { p.SetDate(NSXMP, "MetadataDate", t) }
+
+// DocumentID returns xmpMM:DocumentID.
+func (p *Packet) DocumentID() string { return p.Text(NSXMPMM, "DocumentID") }
+
+// SetDocumentID sets xmpMM:DocumentID.
+func (p *Packet) SetDocumentID(s string) { p.SetText(NSXMPMM, "DocumentID", s) }
+
+// InstanceID returns xmpMM:InstanceID.
+func (p *Packet) InstanceID() string { return p.Text(NSXMPMM, "InstanceID") }
+
+// SetInstanceID sets xmpMM:InstanceID.
+func (p *Packet) SetInstanceID(s string) { p.SetText(NSXMPMM, "InstanceID", s) }
+
+// PDFAIdentification returns the PDF/A part and conformance level
+// (pdfaid:part and pdfaid:conformance), or 0 if the packet claims none.
+func (p *Packet) PDFAIdentification() (part int, conformance string) {
+	part, _ = strconv.Atoi(strings.TrimSpace(p.Text(NSPDFAID, "part")))
+	return part, strings.TrimSpace(p.Text(NSPDFAID, "conformance"))
+}
+
+// SetPDFAIdentification claims conformance to PDF/A part at level
+// conformance ("A", "B", "U"; empty for PDF/A-4).
+func (p *Packet) SetPDFAIdentification(part int, conformance string) {
+	p.SetText(NSPDFAID, "part", strconv.Itoa(part))
+	if conformance != "" {
+		p.SetText(NSPDFAID, "conformance", conformance)
+	} else {
+		p.Delete(NSPDFAID, "conformance")
+	}
+}
+
+// PDFUAPart returns pdfuaid:part, or 0.
+func (p *Packet) PDFUAPart() int {
+	part, _ := strconv.Atoi(strings.TrimSpace(p.Text(NSPDFUAID, "part")))
+	return part
+}
+
+// SetPDFUAPart sets pdfuaid:part.
+func (p *Packet) SetPDFUAPart(part int) { p.SetText(NSPDFUAID, "part", strconv.Itoa(part)) }
+
+// PDFXVersion returns the PDF/X version identifier, such as "PDF/X-4",
+// from pdfxid:GTS_PDFXVersion or the older pdfx:GTS_PDFXVersion.
+func (p *Packet) PDFXVersion() string {
+	if v := p.Text(NSPDFXID, "GTS_PDFXVersion"); v != "" {
+		return v
+	}
+	return p.Text(NSPDFX, "GTS_PDFXVersion")
+}
+
+// SetPDFXVersion sets the PDF/X version identifier: in the pdfxid schema
+// from PDF/X-4 on, in the pdfx schema before.
+func (p *Packet) SetPDFXVersion(version string) {
+	ns := NSPDFX
+	if v := strings.TrimPrefix(version, "PDF/X-"); v != version && v >= "4" {
+		ns = NSPDFXID
+	}
+	p.SetText(ns, "GTS_PDFXVersion", version)
+}
+
+// dateLayouts are the ISO 8601 forms XMP dates take, most precise first.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// ParseDate parses an XMP date, an ISO 8601 date and time. Dates without a
+// time zone are UTC. PDF date strings (D:YYYYMMDD...) of the Info
+// dictionary are parsed by raw.ParseDate.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("xmp: invalid date %q", s)
+}
+
+// FormatDate formats t as an XMP date to the second, with its time zone.
+func FormatDate(t time.Time) string {
+	return t.Truncate(time.Second).Format(time.RFC3339)
+}
@@ -0,0 +1,368 @@
+// Package xmp models Extensible Metadata Platform (XMP) packets, the RDF/XML
+// documents carried by PDF metadata streams (ISO 16684-1).
+//
+// A Packet holds namespaced properties whose values are simple text or
+// URIs, structures of fields, or Bag, Seq and Alt arrays. Language
+// alternatives are Alt arrays whose items carry an xml:lang qualifier.
+// PDF/A extension schema declarations are kept apart from the other
+// properties as ExtensionSchemas.
+package xmp
+
+import "strings"
+
+// Namespace URIs of the schemas used in PDF metadata.
+const (
+	NSX         = "adobe:ns:meta/"
+	NSRDF       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	NSXML       = "http://www.w3.org/XML/1998/namespace"
+	NSDC        = "http://purl.org/dc/elements/1.1/"
+	NSXMP       = "http://ns.adobe.com/xap/1.0/"
+	NSXMPRights = "http://ns.adobe.com/xap/1.0/rights/"
+	NSXMPMM     = "http://ns.adobe.com/xap/1.0/mm/"
+	NSXMPBJ     = "http://ns.adobe.com/xap/1.0/bj/"
+	NSXMPTPg    = "http://ns.adobe.com/xap/1.0/t/pg/"
+	NSXMPIdq    = "http://ns.adobe.com/xmp/Identifier/qual/1.0/"
+	NSPDF       = "http://ns.adobe.com/pdf/1.3/"
+	NSPhotoshop = "http://ns.adobe.com/photoshop/1.0/"
+	NSTIFF      = "http://ns.adobe.com/tiff/1.0/"
+	NSEXIF      = "http://ns.adobe.com/exif/1.0/"
+	NSEXIFAux   = "http://ns.adobe.com/exif/1.0/aux/"
+	NSStRef     = "http://ns.adobe.com/xap/1.0/sType/ResourceRef#"
+	NSStEvt     = "http://ns.adobe.com/xap/1.0/sType/ResourceEvent#"
+	NSStVer     = "http://ns.adobe.com/xap/1.0/sType/Version#"
+	NSPDFAID    = "http://www.aiim.org/pdfa/ns/id/"
+	NSPDFUAID   = "http://www.aiim.org/pdfua/ns/id/"
+	NSPDFX      = "http://ns.adobe.com/pdfx/1.3/"
+	NSPDFXID    = "http://www.npes.org/pdfx/ns/id/"
+
+	NSPDFAExtension = "http://www.aiim.org/pdfa/ns/extension/"
+	NSPDFASchema    = "http://www.aiim.org/pdfa/ns/schema#"
+	NSPDFAProperty  = "http://www.aiim.org/pdfa/ns/property#"
+	NSPDFAType      = "http://www.aiim.org/pdfa/ns/type#"
+	NSPDFAField     = "http://www.aiim.org/pdfa/ns/field#"
+)
+
+// defaultPrefixes are the customary prefixes of well-known namespaces.
+var defaultPrefixes = map[string]string{
+	NSX:             "x",
+	NSRDF:           "rdf",
+	NSXML:           "xml",
+	NSDC:            "dc",
+	NSXMP:           "xmp",
+	NSXMPRights:     "xmpRights",
+	NSXMPMM:         "xmpMM",
+	NSXMPBJ:         "xmpBJ",
+	NSXMPTPg:        "xmpTPg",
+	NSXMPIdq:        "xmpidq",
+	NSPDF:           "pdf",
+	NSPhotoshop:     "photoshop",
+	NSTIFF:          "tiff",
+	NSEXIF:          "exif",
+	NSEXIFAux:       "aux",
+	NSStRef:         "stRef",
+	NSStEvt:         "stEvt",
+	NSStVer:         "stVer",
+	NSPDFAID:        "pdfaid",
+	NSPDFUAID:       "pdfuaid",
+	NSPDFX:          "pdfx",
+	NSPDFXID:        "pdfxid",
+	NSPDFAExtension: "pdfaExtension",
+	NSPDFASchema:    "pdfaSchema",
+	NSPDFAProperty:  "pdfaProperty",
+	NSPDFAType:      "pdfaType",
+	NSPDFAField:     "pdfaField",
+}
+
+// Kind is the form of an XMP value.
+type Kind int
+
+const (
+	Simple Kind = iota // text or URI
+	Struct             // named fields
+	Bag                // unordered array
+	Seq                // ordered array
+	Alt                // alternatives, such as language alternatives
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Simple:
+		return "Simple"
+	case Struct:
+		return "Struct"
+	case Bag:
+		return "Bag"
+	case Seq:
+		return "Seq"
+	case Alt:
+		return "Alt"
+	default:
+		return "Unknown"
+	}
+}
+
+// XDefault is the language of the default item of a language alternative.
+const XDefault = "x-default"
+
+// Value is an XMP property value.
+type Value struct {
+	Kind   Kind
+	Text   string     // Simple value
+	URI    bool       // Simple value is a URI (rdf:resource)
+	Lang   string     // xml:lang qualifier
+	Items  []Value    // Bag, Seq and Alt items
+	Fields []Property // Struct fields
+}
+
+// TextValue returns a simple text value.
+func TextValue(s string) Value { return Value{Text: s} }
+
+// ArrayValue returns an array of kind holding simple text items.
+func ArrayValue(kind Kind, items ...string) Value {
+	v := Value{Kind: kind, Items: make([]Value, 0, len(items))}
+	for _, item := range items {
+		v.Items = append(v.Items, TextValue(item))
+	}
+	return v
+}
+
+// StructValue returns a structure with fields.
+func StructValue(fields ...Property) Value { return Value{Kind: Struct, Fields: fields} }
+
+// Field returns the value of the field ns:name of a structure.
+func (v Value) Field(ns, name string) (Value, bool) {
+	for _, f := range v.Fields {
+		if f.Namespace == ns && f.Name == name {
+			return f.Value, true
+		}
+	}
+	return Value{}, false
+}
+
+// String returns the text of a simple value, the default item of a
+// language alternative or the first item of another array.
+func (v Value) String() string {
+	switch v.Kind {
+	case Simple:
+		return v.Text
+	case Alt:
+		for _, item := range v.Items {
+			if item.Lang == XDefault {
+				return item.String()
+			}
+		}
+		fallthrough
+	case Bag, Seq:
+		if len(v.Items) > 0 {
+			return v.Items[0].String()
+		}
+	}
+	return ""
+}
+
+func (v Value) clone() Value {
+	if v.Items != nil {
+		items := make([]Value, len(v.Items))
+		for i, item := range v.Items {
+			items[i] = item.clone()
+		}
+		v.Items = items
+	}
+	if v.Fields != nil {
+		fields := make([]Property, len(v.Fields))
+		for i, f := range v.Fields {
+			fields[i] = Property{Namespace: f.Namespace, Name: f.Name, Value: f.Value.clone()}
+		}
+		v.Fields = fields
+	}
+	return v
+}
+
+// Property is a named value in a namespace.
+type Property struct {
+	Namespace string // namespace URI
+	Name      string
+	Value     Value
+}
+
+// Packet is an XMP packet: the properties of the resource it describes, in
+// the order they were parsed or set.
+type Packet struct {
+	Properties []Property
+	Extensions []ExtensionSchema // PDF/A extension schema declarations
+	About      string            // rdf:about, usually empty for PDF metadata
+	Toolkit    string            // x:xmptk
+
+	prefixes map[string]string // namespace URI to prefix
+}
+
+// New returns an empty packet.
+func New() *Packet {
+	return &Packet{prefixes: make(map[string]string)}
+}
+
+// RegisterNamespace records the prefix used for ns when the packet is
+// serialized. Well-known namespaces have default prefixes; others get
+// generated ones unless registered.
+func (p *Packet) RegisterNamespace(ns, prefix string) {
+	if p.prefixes == nil {
+		p.prefixes = make(map[string]string)
+	}
+	p.prefixes[ns] = prefix
+}
+
+// Prefix returns the prefix registered or customary for ns, or "".
+func (p *Packet) Prefix(ns string) string {
+	if prefix := p.prefixes[ns]; prefix != "" {
+		return prefix
+	}
+	return defaultPrefixes[ns]
+}
+
+// Namespaces returns the namespaces of the packet's properties in order of
+// first use.
+func (p *Packet) Namespaces() []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, prop := range p.Properties {
+		if !seen[prop.Namespace] {
+			seen[prop.Namespace] = true
+			out = append(out, prop.Namespace)
+		}
+	}
+	return out
+}
+
+func (p *Packet) index(ns, name string) int {
+	for i, prop := range p.Properties {
+		if prop.Namespace == ns && prop.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get returns the value of the property ns:name.
+func (p *Packet) Get(ns, name string) (Value, bool) {
+	if i := p.index(ns, name); i >= 0 {
+		return p.Properties[i].Value, true
+	}
+	return Value{}, false
+}
+
+// Set sets the property ns:name, replacing any previous value in place.
+func (p *Packet) Set(ns, name string, v Value) {
+	if i := p.index(ns, name); i >= 0 {
+		p.Properties[i].Value = v
+		return
+	}
+	p.Properties = append(p.Properties, Property{Namespace: ns, Name: name, Value: v})
+}
+
+// Delete removes the property ns:name.
+func (p *Packet) Delete(ns, name string) {
+	if i := p.index(ns, name); i >= 0 {
+		p.Properties = append(p.Properties[:i], p.Properties[i+1:]...)
+	}
+}
+
+// Text returns the text of the property ns:name as Value.String does, or
+// "" if it is not set.
+func (p *Packet) Text(ns, name string) string {
+	v, _ := p.Get(ns, name)
+	return v.String()
+}
+
+// SetText sets ns:name to a simple text value.
+func (p *Packet) SetText(ns, name, text string) {
+	p.Set(ns, name, TextValue(text))
+}
+
+// Strings returns the texts of the items of the array ns:name; a simple
+// value is returned as a single item.
+func (p *Packet) Strings(ns, name string) []string {
+	v, ok := p.Get(ns, name)
+	if !ok {
+		return nil
+	}
+	if v.Kind == Simple {
+		return []string{v.Text}
+	}
+	out := make([]string, 0, len(v.Items))
+	for _, item := range v.Items {
+		out = append(out, item.String())
+	}
+	return out
+}
+
+// SetStrings sets ns:name to an array of kind holding items.
+func (p *Packet) SetStrings(ns, name string, kind Kind, items ...string) {
+	p.Set(ns, name, ArrayValue(kind, items...))
+}
+
+// LangText returns the item of the language alternative ns:name for lang,
+// falling back to the default item and then to the first one.
+func (p *Packet) LangText(ns, name, lang string) string {
+	v, ok := p.Get(ns, name)
+	if !ok {
+		return ""
+	}
+	if v.Kind == Alt {
+		for _, item := range v.Items {
+			if strings.EqualFold(item.Lang, lang) {
+				return item.String()
+			}
+		}
+	}
+	return v.String()
+}
+
+// SetLangText sets the item for lang of the language alternative ns:name,
+// converting a simple value into one. An empty lang is XDefault; the
+// default item is kept first.
+func (p *Packet) SetLangText(ns, name, lang, text string) {
+	if lang == "" {
+		lang = XDefault
+	}
+	v, ok := p.Get(ns, name)
+	if !ok || v.Kind != Alt {
+		v = Value{Kind: Alt}
+	} else {
+		v = v.clone()
+	}
+	item := Value{Text: text, Lang: lang}
+	replaced := false
+	for i := range v.Items {
+		if strings.EqualFold(v.Items[i].Lang, lang) {
+			v.Items[i] = item
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		if lang == XDefault {
+			v.Items = append([]Value{item}, v.Items...)
+		} else {
+			v.Items = append(v.Items, item)
+		}
+	}
+	p.Set(ns, name, v)
+}
+
+// Clone returns a deep copy of p.
+func (p *Packet) Clone() *Packet {
+	out := &Packet{About: p.About, Toolkit: p.Toolkit, prefixes: make(map[string]string, len(p.prefixes))}
+	for ns, prefix := range p.prefixes {
+		out.prefixes[ns] = prefix
+	}
+	if p.Properties != nil {
+		out.Properties = make([]Property, len(p.Properties))
+		for i, prop := range p.Properties {
+			out.Properties[i] = Property{Namespace: prop.Namespace, Name: prop.Name, Value: prop.Value.clone()}
+		}
+	}
+	for _, s := range p.Extensions {
+		out.Extensions = append(out.Extensions, s.clone())
+	}
+	return out
+}
@@ -0,0 +1,189 @@
+package xmp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const samplePacket = `<?xpacket begin="` + "\uFEFF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/" x:xmptk="Test Toolkit">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:pdf="http://ns.adobe.com/pdf/1.3/" pdf:Producer="pdfkit">
+   <pdf:Keywords>alpha, beta</pdf:Keywords>
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+      xmlns:xmpMM="http://ns.adobe.com/xap/1.0/mm/" xmlns:stEvt="http://ns.adobe.com/xap/1.0/sType/ResourceEvent#">
+   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">Report &amp; Notes</rdf:li><rdf:li xml:lang="de-DE">Bericht</rdf:li></rdf:Alt></dc:title>
+   <dc:creator><rdf:Seq><rdf:li>Ada</rdf:li><rdf:li>Grace</rdf:li></rdf:Seq></dc:creator>
+   <dc:subject><rdf:Bag><rdf:li>alpha</rdf:li><rdf:li>beta</rdf:li></rdf:Bag></dc:subject>
+   <xmp:CreateDate>2024-05-06T07:08:09+02:00</xmp:CreateDate>
+   <xmp:BaseURL rdf:resource="https://example.com/"/>
+   <xmpMM:History><rdf:Seq>
+    <rdf:li rdf:parseType="Resource"><stEvt:action>created</stEvt:action><stEvt:when>2024-05-06</stEvt:when></rdf:li>
+    <rdf:li><rdf:Description stEvt:action="saved"/></rdf:li>
+    <rdf:li stEvt:action="converted"/>
+   </rdf:Seq></xmpMM:History>
+   <xmpMM:DerivedFrom rdf:parseType="Resource"><rdf:value>original</rdf:value></xmpMM:DerivedFrom>
+  </rdf:Description>
+  <rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/" pdfaid:part="2" pdfaid:conformance="B"/>
+  <rdf:Description rdf:about="" xmlns:acme="http://example.com/acme/" xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/"
+      xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#" xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">
+   <acme:Job>42</acme:Job>
+   <pdfaExtension:schemas><rdf:Bag><rdf:li rdf:parseType="Resource">
+    <pdfaSchema:schema>Acme job</pdfaSchema:schema>
+    <pdfaSchema:namespaceURI>http://example.com/acme/</pdfaSchema:namespaceURI>
+    <pdfaSchema:prefix>acme</pdfaSchema:prefix>
+    <pdfaSchema:property><rdf:Seq><rdf:li rdf:parseType="Resource">
+     <pdfaProperty:name>Job</pdfaProperty:name>
+     <pdfaProperty:valueType>Integer</pdfaProperty:valueType>
+     <pdfaProperty:category>internal</pdfaProperty:category>
+     <pdfaProperty:description>Job number</pdfaProperty:description>
+    </rdf:li></rdf:Seq></pdfaSchema:property>
+   </rdf:li></rdf:Bag></pdfaExtension:schemas>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+func checkSample(t *testing.T, p *Packet) {
+	t.Helper()
+	if p.Toolkit != "Test Toolkit" {
+		t.Errorf("toolkit = %q", p.Toolkit)
+	}
+	if p.Title() != "Report & Notes" || p.LangText(NSDC, "title", "de-de") != "Bericht" || p.LangText(NSDC, "title", "fr") != "Report & Notes" {
+		t.Errorf("title = %q", p.Title())
+	}
+	if got := strings.Join(p.Creators(), "|"); got != "Ada|Grace" {
+		t.Errorf("creators = %q", got)
+	}
+	if v, _ := p.Get(NSDC, "subject"); v.Kind != Bag || len(v.Items) != 2 {
+		t.Errorf("subject = %+v", v)
+	}
+	if p.Producer() != "pdfkit" || p.Keywords() != "alpha, beta" {
+		t.Errorf("producer %q, keywords %q", p.Producer(), p.Keywords())
+	}
+	if d, ok := p.CreateDate(); !ok || !d.Equal(time.Date(2024, 5, 6, 5, 8, 9, 0, time.UTC)) {
+		t.Errorf("create date = %v", d)
+	}
+	if v, _ := p.Get(NSXMP, "BaseURL"); !v.URI || v.Text != "https://example.com/" {
+		t.Errorf("BaseURL = %+v", v)
+	}
+	history, _ := p.Get(NSXMPMM, "History")
+	if history.Kind != Seq || len(history.Items) != 3 {
+		t.Fatalf("history = %+v", history)
+	}
+	for i, want := range []string{"created", "saved", "converted"} {
+		if item := history.Items[i]; item.Kind != Struct || fieldText(item, NSStEvt, "action") != want {
+			t.Errorf("history[%d] = %+v", i, item)
+		}
+	}
+	if v, _ := p.Get(NSXMPMM, "DerivedFrom"); v.Kind != Simple || v.Text != "original" {
+		t.Errorf("qualified value = %+v", v)
+	}
+	if part, conf := p.PDFAIdentification(); part != 2 || conf != "B" {
+		t.Errorf("PDF/A identification = %d%s", part, conf)
+	}
+	if p.Text("http://example.com/acme/", "Job") != "42" {
+		t.Errorf("custom property missing")
+	}
+	s := p.Extension("http://example.com/acme/")
+	if s == nil || s.Prefix != "acme" || len(s.Properties) != 1 || s.Properties[0].ValueType != "Integer" {
+		t.Fatalf("extension = %+v", s)
+	}
+	if _, ok := p.Get(NSPDFAExtension, "schemas"); ok {
+		t.Errorf("extension schemas should not be a property")
+	}
+	if got := p.UndeclaredNamespaces(); len(got) != 0 {
+		t.Errorf("undeclared = %v", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(samplePacket))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	checkSample(t, p)
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	p, err := Parse([]byte(samplePacket))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	data := p.Marshal(DefaultPadding)
+	if !bytes.HasPrefix(data, []byte("<?xpacket begin=\"\xef\xbb\xbf\"")) || !bytes.HasSuffix(data, []byte(`<?xpacket end="w"?>`)) {
+		t.Fatalf("missing xpacket wrapper:\n%s", data)
+	}
+	if !bytes.Contains(data, []byte(`xmlns:acme="http://example.com/acme/"`)) {
+		t.Errorf("custom prefix not kept")
+	}
+	again, err := Parse(data)
+	if err != nil {
+		t.Fatalf("reparse: %v\n%s", err, data)
+	}
+	checkSample(t, again)
+	if !bytes.Equal(again.Marshal(DefaultPadding), data) {
+		t.Errorf("marshal is not stable")
+	}
+}
+
+func TestMarshalToSize(t *testing.T) {
+	p := New()
+	p.SetTitle("Short")
+	data, err := p.MarshalToSize(4096)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if len(data) != 4096 {
+		t.Fatalf("size = %d", len(data))
+	}
+	p.SetDescription(strings.Repeat("long ", 1000))
+	if _, err := p.MarshalToSize(4096); err == nil {
+		t.Errorf("expected packet too large")
+	}
+	if _, err := Parse(data); err != nil {
+		t.Errorf("padded packet does not parse: %v", err)
+	}
+}
+
+func TestPacketEditing(t *testing.T) {
+	p := New()
+	p.SetLangText(NSDC, "title", "fr", "Titre")
+	p.SetTitle("Title")
+	if v, _ := p.Get(NSDC, "title"); v.Items[0].Lang != XDefault || v.Items[1].Text != "Titre" {
+		t.Errorf("title = %+v", v)
+	}
+	p.SetPDFXVersion("PDF/X-4")
+	p.SetPDFXVersion("PDF/X-3:2002")
+	if p.Text(NSPDFXID, "GTS_PDFXVersion") != "PDF/X-4" || p.Text(NSPDFX, "GTS_PDFXVersion") != "PDF/X-3:2002" {
+		t.Errorf("PDF/X versions not in their schemas")
+	}
+	p.SetText("http://example.com/other/", "Note", "x")
+	p.RegisterNamespace("http://example.com/other/", "dc")
+	if got := p.UndeclaredNamespaces(); len(got) != 3 || got[2] != "http://example.com/other/" {
+		t.Errorf("undeclared = %v", got)
+	}
+	clone := p.Clone()
+	clone.SetTitle("Changed")
+	if p.Title() != "Title" {
+		t.Errorf("clone shares values")
+	}
+	data := p.Marshal(0)
+	if !bytes.Contains(data, []byte(`xmlns:ns1="http://example.com/other/"`)) {
+		t.Errorf("conflicting prefix not replaced:\n%s", data)
+	}
+	p.Delete(NSDC, "title")
+	if p.Title() != "" {
+		t.Errorf("delete failed")
+	}
+
+	if _, err := Parse([]byte("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\"></x:xmpmeta>")); err == nil {
+		t.Errorf("expected error without rdf:RDF")
+	}
+	if d, err := ParseDate("2024-05"); err != nil || d.Month() != time.May {
+		t.Errorf("partial date = %v, %v", d, err)
+	}
+}
@@ -805,7 +805,14 @@ func (t *tableResolver) tryRepair(ctx context.Context, r io.ReaderAt, size int64
 	}
 	action := t.cfg.Recovery.OnError(ctx, originalErr, recovery.Location{Component: "xref"})
 	if action == recovery.ActionFix {
-		return repair(ctx, r, size)
+		tbl, err := repair(ctx, r, size)
+		if err != nil {
+			return nil, err
+		}
+		if rt, ok := tbl.(*table); ok && rt.trailer != nil {
+			t.trailers = []*raw.DictObj{rt.trailer}
+		}
+		return tbl, nil
 	}
 	return nil, originalErr
 }